@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultAuditLogLimit = 100
+
+// CreateAdminHandler creates a handler for the admin API under /admin/. The
+// requests have to authenticate with the token as a bearer token.
+//
+// GET /admin/audit-log returns the latest entries of the audit log. The
+// entries can be filtered with the repository (owner/name), pull_request and
+// since (RFC 3339) query parameters. limit defaults to 100.
+//
+// GET /admin/policies exports the organization and repository policies as a
+// PolicySet and PUT /admin/policies imports one, replacing all of the
+// policies at once. With dry_run=true, the import only reports which policies
+// it would add, change and remove.
+//
+// GET /admin/policies/effective?repository=owner/name returns the policy
+// that applies to the repository, with the layers it was merged from.
+//
+// GET /admin/command-stats returns the daily usage counts and outcomes of the
+// commands and their totals. The counts can be filtered with the repository
+// (owner/name) and since (RFC 3339) query parameters. since defaults to 30
+// days ago.
+func CreateAdminHandler(token string, conf Config, store Store, auditLog AuditLog) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/admin/policies/effective", Handler(func(w http.ResponseWriter, r *http.Request) Response {
+		if r.Method != http.MethodGet {
+			return ErrorResponse{nil, http.StatusMethodNotAllowed, "Only GET is supported"}
+		}
+		key := r.URL.Query().Get("repository")
+		if !repositoryKeyRegexp.MatchString(key) {
+			message := fmt.Sprintf("repository must be in the owner/name format, got %q", key)
+			return ErrorResponse{nil, http.StatusBadRequest, message}
+		}
+		parts := strings.SplitN(key, "/", 2)
+		policy, errResp := getEffectivePolicy(conf, Repository{Owner: parts[0], Name: parts[1]}, store)
+		if errResp != nil {
+			return errResp
+		}
+		return jsonResponse{policy}
+	}))
+	mux.Handle("/admin/policies", Handler(func(w http.ResponseWriter, r *http.Request) Response {
+		switch r.Method {
+		case http.MethodGet:
+			policies, err := store.Policies()
+			if err != nil {
+				return ErrorResponse{err, http.StatusInternalServerError, "Failed to list the policies"}
+			}
+			return jsonResponse{policies}
+		case http.MethodPut:
+			return importPolicies(r, store, auditLog)
+		}
+		return ErrorResponse{nil, http.StatusMethodNotAllowed, "Only GET and PUT are supported"}
+	}))
+	mux.Handle("/admin/audit-log", Handler(func(w http.ResponseWriter, r *http.Request) Response {
+		if r.Method != http.MethodGet {
+			return ErrorResponse{nil, http.StatusMethodNotAllowed, "Only GET is supported"}
+		}
+		filter, err := parseAuditFilter(r)
+		if err != nil {
+			return ErrorResponse{err, http.StatusBadRequest, err.Error()}
+		}
+		entries, err := auditLog.Entries(filter)
+		if err != nil {
+			return ErrorResponse{err, http.StatusInternalServerError, "Failed to read the audit log"}
+		}
+		return jsonResponse{entries}
+	}))
+	mux.Handle("/admin/command-stats", Handler(func(w http.ResponseWriter, r *http.Request) Response {
+		if r.Method != http.MethodGet {
+			return ErrorResponse{nil, http.StatusMethodNotAllowed, "Only GET is supported"}
+		}
+		return getCommandStats(r, store)
+	}))
+	return requireBearerToken(token, "admin", mux)
+}
+
+func importPolicies(r *http.Request, store Store, auditLog AuditLog) Response {
+	var policies PolicySet
+	decoder := json.NewDecoder(r.Body)
+	// Catch misspelled settings instead of silently ignoring them
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&policies); err != nil {
+		return ErrorResponse{err, http.StatusBadRequest, fmt.Sprintf("Failed to parse the policies: %v", err)}
+	} else if err = policies.Validate(); err != nil {
+		return ErrorResponse{err, http.StatusBadRequest, err.Error()}
+	}
+	current, err := store.Policies()
+	if err != nil {
+		return ErrorResponse{err, http.StatusInternalServerError, "Failed to list the policies"}
+	}
+	changes, err := diffPolicies(current, policies)
+	if err != nil {
+		return ErrorResponse{err, http.StatusInternalServerError, "Failed to compare the policies"}
+	}
+	if r.URL.Query().Get("dry_run") == "true" {
+		return jsonResponse{changes}
+	}
+	err = store.SetPolicies(policies)
+	details := fmt.Sprintf("%d added, %d changed, %d removed", len(changes.Added), len(changes.Changed),
+		len(changes.Removed))
+	auditor{auditLog, WebhookContext{}}.record("import-policies", Repository{}, 0, details, err)
+	if err != nil {
+		return ErrorResponse{err, http.StatusInternalServerError, "Failed to store the policies"}
+	}
+	return jsonResponse{changes}
+}
+
+func parseAuditFilter(r *http.Request) (AuditFilter, error) {
+	query := r.URL.Query()
+	filter := AuditFilter{
+		Repository: query.Get("repository"),
+		Limit:      defaultAuditLogLimit,
+	}
+	var err error
+	if value := query.Get("pull_request"); value != "" {
+		if filter.PullRequest, err = strconv.Atoi(value); err != nil {
+			return AuditFilter{}, fmt.Errorf("pull_request must be a number, got %q", value)
+		}
+	}
+	if value := query.Get("since"); value != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, value); err != nil {
+			return AuditFilter{}, fmt.Errorf("since must be an RFC 3339 timestamp, got %q", value)
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		if filter.Limit, err = strconv.Atoi(value); err != nil || filter.Limit < 1 {
+			return AuditFilter{}, fmt.Errorf("limit must be a positive number, got %q", value)
+		}
+	}
+	return filter, nil
+}
+
+// jsonResponse responds with the value encoded as JSON. Only the type of the
+// value is logged.
+type jsonResponse struct {
+	Value interface{}
+}
+
+func (r jsonResponse) WriteResponse(w http.ResponseWriter) {
+	body, err := json.MarshalIndent(r.Value, "", "  ")
+	if err != nil {
+		http.Error(w, "Failed to encode the response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+func (r jsonResponse) logResponse() {
+	log.Printf("Success: responded with %T\n", r.Value)
+}
@@ -0,0 +1,282 @@
+package main_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	grh "github.com/salemove/github-review-helper"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Admin handler", func() {
+	var (
+		conf             grh.Config
+		store            grh.Store
+		auditLog         grh.AuditLog
+		responseRecorder *httptest.ResponseRecorder
+		request          *http.Request
+	)
+
+	BeforeEach(func() {
+		conf = grh.Config{MergeStrategy: grh.MergeStrategyMerge, RequiredApprovals: 1}
+		store = grh.NewMemoryStore()
+		var err error
+		auditLog, err = grh.NewAuditLog(grh.Config{})
+		Expect(err).NotTo(HaveOccurred())
+		responseRecorder = httptest.NewRecorder()
+
+		for _, pr := range []int{1, 2, 2} {
+			Expect(auditLog.Record(grh.AuditEntry{
+				Time:        time.Now(),
+				Action:      "comment",
+				Repository:  "salemove/api",
+				PullRequest: pr,
+				Outcome:     "success",
+			})).To(Succeed())
+		}
+	})
+
+	handle := func() {
+		grh.CreateAdminHandler("admin-token", conf, store, auditLog).ServeHTTP(responseRecorder, request)
+	}
+
+	Context("without a token", func() {
+		BeforeEach(func() {
+			request = httptest.NewRequest("GET", "/admin/audit-log", nil)
+		})
+
+		It("responds with 401", func() {
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusUnauthorized))
+		})
+	})
+
+	Context("with a token", func() {
+		BeforeEach(func() {
+			request = httptest.NewRequest("GET", "/admin/audit-log?repository=salemove/api&pull_request=2", nil)
+			request.Header.Set("Authorization", "Bearer admin-token")
+		})
+
+		It("returns the matching audit log entries", func() {
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+
+			var entries []grh.AuditEntry
+			Expect(json.Unmarshal(responseRecorder.Body.Bytes(), &entries)).To(Succeed())
+			Expect(entries).To(HaveLen(2))
+			Expect(entries[0].PullRequest).To(Equal(2))
+		})
+	})
+
+	Context("with an invalid filter", func() {
+		BeforeEach(func() {
+			request = httptest.NewRequest("GET", "/admin/audit-log?since=yesterday", nil)
+			request.Header.Set("Authorization", "Bearer admin-token")
+		})
+
+		It("responds with 400", func() {
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	Describe("policies", func() {
+		const policiesJSON = `{
+			"organizations": {
+				"salemove": {"required_approvals": 1, "require_resolved_conversations": true}
+			},
+			"repositories": {
+				"salemove/api": {"required_approvals": 2, "approval_max_age": "72h"},
+				"salemove/web": {"merge_strategy": "verified-rebase"}
+			}
+		}`
+
+		importPolicies := func(body, query string) {
+			request = httptest.NewRequest("PUT", "/admin/policies"+query, strings.NewReader(body))
+			request.Header.Set("Authorization", "Bearer admin-token")
+			handle()
+		}
+
+		BeforeEach(func() {
+			Expect(store.SetPolicies(grh.PolicySet{Repositories: map[string]grh.Policy{
+				"salemove/web":    {},
+				"salemove/legacy": {},
+			}})).To(Succeed())
+		})
+
+		It("imports the policies and reports the changes", func() {
+			importPolicies(policiesJSON, "")
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			Expect(responseRecorder.Body.String()).To(MatchJSON(`{
+				"added": ["salemove", "salemove/api"],
+				"changed": ["salemove/web"],
+				"removed": ["salemove/legacy"]
+			}`))
+
+			policy, exists, err := store.Policy(grh.Repository{Owner: "salemove", Name: "api"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeTrue())
+			Expect(*policy.RequiredApprovals).To(Equal(2))
+			Expect(*policy.ApprovalMaxAge).To(Equal(grh.Duration(72 * time.Hour)))
+
+			entries, err := auditLog.Entries(grh.AuditFilter{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries[len(entries)-1].Action).To(Equal("import-policies"))
+		})
+
+		It("exports the imported policies", func() {
+			importPolicies(policiesJSON, "")
+
+			responseRecorder = httptest.NewRecorder()
+			request = httptest.NewRequest("GET", "/admin/policies", nil)
+			request.Header.Set("Authorization", "Bearer admin-token")
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			Expect(responseRecorder.Body.String()).To(MatchJSON(`{
+				"organizations": {
+					"salemove": {"required_approvals": 1, "require_resolved_conversations": true}
+				},
+				"repositories": {
+					"salemove/api": {"required_approvals": 2, "approval_max_age": "72h0m0s"},
+					"salemove/web": {"merge_strategy": "verified-rebase"}
+				}
+			}`))
+		})
+
+		It("returns the effective policy of a repository", func() {
+			importPolicies(policiesJSON, "")
+
+			responseRecorder = httptest.NewRecorder()
+			request = httptest.NewRequest("GET", "/admin/policies/effective?repository=salemove/api", nil)
+			request.Header.Set("Authorization", "Bearer admin-token")
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+
+			var effective struct {
+				Effective map[string]interface{}
+				Layers    map[string]interface{}
+			}
+			Expect(json.Unmarshal(responseRecorder.Body.Bytes(), &effective)).To(Succeed())
+			Expect(effective.Effective).To(Equal(map[string]interface{}{
+				"required_approvals":             2.0,
+				"ignore_stale_approvals":         false,
+				"approval_max_age":               "72h0m0s",
+				"require_resolved_conversations": true,
+				"allow_status_overrides":         false,
+				"merge_strategy":                 grh.MergeStrategyMerge,
+				"pre_merge_hooks_block":          false,
+				"notification_digest_interval":   "0s",
+				"reviewer_assignment":            "",
+				"native_merge_queue":             false,
+				"dependency_auto_merge":          "",
+				"notification_routes":            []interface{}{},
+				"merge_base_branches":            nil,
+				"two_person_merge_branches":      nil,
+				"head_branch_patterns":           nil,
+				"head_branch_policy":             "",
+				"stale_ci_age":                   "0s",
+				"stale_ci_close_after":           "0s",
+				"command_aliases":                nil,
+				"merge_gates": []interface{}{"base branch", "merge freeze", "hold", "blocks", "dependencies",
+					"labels", "description", "approvals", "conversations"},
+				"pre_merge_hooks":  nil,
+				"post_merge_hooks": nil,
+			}))
+			Expect(effective.Layers).To(HaveKeyWithValue("organization", HaveKeyWithValue("required_approvals", 1.0)))
+			Expect(effective.Layers).To(HaveKeyWithValue("repository", HaveKeyWithValue("required_approvals", 2.0)))
+		})
+
+		It("doesn't apply the policies on a dry run", func() {
+			importPolicies(policiesJSON, "?dry_run=true")
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+
+			policies, err := store.Policies()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policies.Repositories).To(HaveLen(2))
+			Expect(policies.Repositories).To(HaveKey("salemove/legacy"))
+		})
+
+		It("rejects all of the policies, if one of them is invalid", func() {
+			importPolicies(`{"repositories": {
+				"salemove/api": {"required_approvals": 2},
+				"salemove/web": {"merge_strategy": "squash"}
+			}}`, "")
+			Expect(responseRecorder.Code).To(Equal(http.StatusBadRequest))
+
+			_, exists, err := store.Policy(grh.Repository{Owner: "salemove", Name: "api"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeFalse())
+		})
+
+		It("rejects invalid base branch patterns alongside other settings", func() {
+			importPolicies(`{"repositories": {
+				"salemove/api": {"reviewer_assignment": "round-robin", "merge_base_branches": ["release/["]}
+			}}`, "")
+			Expect(responseRecorder.Code).To(Equal(http.StatusBadRequest))
+		})
+
+		It("rejects invalid dependency update kinds alongside other settings", func() {
+			importPolicies(`{"repositories": {
+				"salemove/api": {"reviewer_assignment": "round-robin", "dependency_auto_merge": "major"}
+			}}`, "")
+			Expect(responseRecorder.Code).To(Equal(http.StatusBadRequest))
+		})
+
+		It("rejects invalid organizations", func() {
+			importPolicies(`{"organizations": {"salemove/api": {"required_approvals": 2}}}`, "")
+			Expect(responseRecorder.Code).To(Equal(http.StatusBadRequest))
+		})
+
+		It("rejects unknown settings", func() {
+			importPolicies(`{"repositories": {"salemove/api": {"required_aprovals": 2}}}`, "")
+			Expect(responseRecorder.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	Describe("command stats", func() {
+		BeforeEach(func() {
+			api := grh.Repository{Owner: "salemove", Name: "api"}
+			web := grh.Repository{Owner: "salemove", Name: "web"}
+			now := time.Now()
+			Expect(store.RecordCommandUse(api, "!merge", "success", now)).To(Succeed())
+			Expect(store.RecordCommandUse(api, "!merge", "success", now)).To(Succeed())
+			Expect(store.RecordCommandUse(api, "!squash", "failure", now)).To(Succeed())
+			Expect(store.RecordCommandUse(web, "!merge", "failure", now)).To(Succeed())
+			Expect(store.RecordCommandUse(api, "!merge", "failure", now.AddDate(0, 0, -60))).To(Succeed())
+		})
+
+		getStats := func(query string) grh.CommandStatsReport {
+			request = httptest.NewRequest("GET", "/admin/command-stats"+query, nil)
+			request.Header.Set("Authorization", "Bearer admin-token")
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+
+			var report grh.CommandStatsReport
+			Expect(json.Unmarshal(responseRecorder.Body.Bytes(), &report)).To(Succeed())
+			return report
+		}
+
+		It("returns the usage of the last 30 days with the most failing commands first", func() {
+			report := getStats("")
+			Expect(report.Daily).To(HaveLen(3))
+			Expect(report.Commands).To(Equal([]grh.CommandSummary{
+				{Command: "!merge", Uses: 3, Failures: 1},
+				{Command: "!squash", Uses: 1, Failures: 1},
+			}))
+		})
+
+		It("filters the usage by repository and time", func() {
+			since := time.Now().AddDate(0, 0, -90).Format(time.RFC3339)
+			report := getStats("?repository=salemove/api&since=" + since)
+			Expect(report.Commands).To(Equal([]grh.CommandSummary{
+				{Command: "!merge", Uses: 3, Failures: 1},
+				{Command: "!squash", Uses: 1, Failures: 1},
+			}))
+		})
+	})
+})
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/evaluator"
+)
+
+// expiredApprovalState is not a review state GitHub uses. It marks approvals
+// that have expired according to conf.ApprovalMaxAge.
+const expiredApprovalState = "EXPIRED"
+
+// checkApprovals checks whether the PR's reviews allow it to be merged. The
+// rule passes if the approvals gate is disabled or satisfied. On top of the
+// required number of approvals, every OWNERS_FILE rule matching the PR's
+// files needs an approval from one of its owners.
+func checkApprovals(conf Config, pr *github.PullRequest, store Store, pullRequests PullRequests,
+	graphQL GraphQL) (evaluator.Result, *ErrorResponse) {
+
+	ownerRules, errResp := prOwnerRules(conf, pr, store, pullRequests, graphQL)
+	if errResp != nil {
+		return evaluator.Result{}, errResp
+	} else if conf.RequiredApprovals == 0 && len(ownerRules) == 0 {
+		return passed("no approvals are required"), nil
+	}
+	reviews, errResp := getReviews(prIssue(pr), pullRequests)
+	if errResp != nil {
+		return evaluator.Result{}, errResp
+	}
+	var expiresBefore time.Time
+	if conf.ApprovalMaxAge != 0 {
+		expiresBefore = time.Now().Add(-conf.ApprovalMaxAge)
+	}
+	approvers, changeRequesters, expiredApprovers := currentReviewStates(reviews, *pr.Head.SHA,
+		conf.IgnoreStaleApprovals, expiresBefore)
+	evidence := []string{fmt.Sprintf("%d approval(s) are required", conf.RequiredApprovals)}
+	for _, rule := range ownerRules {
+		evidence = append(evidence, fmt.Sprintf("%s is owned by %s", rule.Pattern, describeOwners(rule.Owners)))
+	}
+	if len(approvers) > 0 {
+		evidence = append(evidence, "approved by "+mentions(approvers))
+	}
+	if len(changeRequesters) > 0 {
+		evidence = append(evidence, "changes requested by "+mentions(changeRequesters))
+	}
+	if len(expiredApprovers) > 0 {
+		evidence = append(evidence, "expired approvals by "+mentions(expiredApprovers))
+	}
+
+	if len(changeRequesters) > 0 {
+		reason := fmt.Sprintf("changes have been requested by %s", mentions(changeRequesters))
+		return failed(reason, evidence...), nil
+	} else if len(approvers) < conf.RequiredApprovals {
+		reason := fmt.Sprintf("it has %d current approval(s), but %d are required", len(approvers),
+			conf.RequiredApprovals)
+		if len(expiredApprovers) > 0 {
+			reason += fmt.Sprintf(". The approval(s) of %s are older than %s and have expired, so a "+
+				"re-approval is needed", mentions(expiredApprovers), conf.ApprovalMaxAge)
+		}
+		return failed(reason, evidence...), nil
+	}
+	unapproved, err := unapprovedOwnerRules(ownerRules, pr.User.GetLogin(), approvers, graphQL)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Failed to check the owners' approvals of PR %s", prFullName(pr))
+		return evaluator.Result{}, &ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	} else if len(unapproved) > 0 {
+		reasons := make([]string, len(unapproved))
+		for i, rule := range unapproved {
+			reasons[i] = fmt.Sprintf("changes to %s need an approval from %s", rule.Pattern,
+				describeOwners(rule.Owners))
+		}
+		return failed(strings.Join(reasons, " and "), evidence...), nil
+	}
+	return passed(evidence...), nil
+}
+
+// currentReviewStates finds the reviewers whose latest review approves the PR
+// and those whose latest review requests changes. Dismissed reviews count as
+// if they had never been given and, if ignoreStale is set, so do approvals
+// given to commits other than the current head. Approvals submitted before
+// expiresBefore have expired and are only reported in expiredApprovers. A
+// zero expiresBefore disables the expiry.
+func currentReviewStates(reviews []*github.PullRequestReview, headSHA string, ignoreStale bool,
+	expiresBefore time.Time) (approvers, changeRequesters, expiredApprovers []string) {
+
+	latestStates := make(map[string]string)
+	// Reviews are listed in chronological order
+	for _, review := range reviews {
+		if review.User == nil || review.User.Login == nil || review.State == nil {
+			continue
+		}
+		reviewer := *review.User.Login
+		switch state := strings.ToUpper(*review.State); state {
+		case "APPROVED":
+			if ignoreStale && (review.CommitID == nil || *review.CommitID != headSHA) {
+				delete(latestStates, reviewer)
+			} else if review.SubmittedAt != nil && review.SubmittedAt.Before(expiresBefore) {
+				latestStates[reviewer] = expiredApprovalState
+			} else {
+				latestStates[reviewer] = state
+			}
+		case "CHANGES_REQUESTED":
+			latestStates[reviewer] = state
+		case "DISMISSED":
+			delete(latestStates, reviewer)
+		}
+	}
+	for reviewer, state := range latestStates {
+		switch state {
+		case "APPROVED":
+			approvers = append(approvers, reviewer)
+		case expiredApprovalState:
+			expiredApprovers = append(expiredApprovers, reviewer)
+		default:
+			changeRequesters = append(changeRequesters, reviewer)
+		}
+	}
+	sort.Strings(approvers)
+	sort.Strings(changeRequesters)
+	sort.Strings(expiredApprovers)
+	return approvers, changeRequesters, expiredApprovers
+}
+
+func mentions(logins []string) string {
+	mentions := make([]string, len(logins))
+	for i, login := range logins {
+		mentions[i] = "@" + login
+	}
+	return strings.Join(mentions, ", ")
+}
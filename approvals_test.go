@@ -0,0 +1,185 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var review = func(reviewer, state, commitID string) *github.PullRequestReview {
+	return &github.PullRequestReview{
+		User: &github.User{
+			Login: github.String(reviewer),
+		},
+		State:    github.String(state),
+		CommitID: github.String(commitID),
+	}
+}
+
+var submittedAgo = func(review *github.PullRequestReview, ago time.Duration) *github.PullRequestReview {
+	submittedAt := time.Now().Add(-ago)
+	review.SubmittedAt = &submittedAt
+	return review
+}
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("approvals gate", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+
+			context.Config.RequiredApprovals = 1
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "pull_request_review",
+			}
+		})
+		requestJSON.Is(func() string {
+			return PullRequestReviewEvent("submitted", "approved", []string{grh.MergingLabel})
+		})
+
+		headSHA := "1235"
+		oldHeadSHA := "1233"
+		pr := &github.PullRequest{
+			Number:    github.Int(issueNumber),
+			Merged:    github.Bool(false),
+			Mergeable: github.Bool(true),
+			Base: &github.PullRequestBranch{
+				SHA:  github.String("1234"),
+				Ref:  github.String("master"),
+				Repo: repository,
+			},
+			Head: &github.PullRequestBranch{
+				SHA:  github.String(headSHA),
+				Ref:  github.String("feature"),
+				Repo: repository,
+			},
+			User: &github.User{
+				Login: github.String(arbitraryIssueAuthor),
+			},
+		}
+
+		BeforeEach(func() {
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+				Return(pr, emptyResponse, noError)
+			repositories.
+				On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.AnythingOfType("*github.ListOptions")).
+				Return(&github.CombinedStatus{
+					State: github.String("success"),
+				}, emptyResponse, noError)
+			mockLabels(issues, issueNumber, grh.MergingLabel)
+		})
+
+		mockReviews := func(reviews ...*github.PullRequestReview) {
+			BeforeEach(func() {
+				pullRequests.
+					On("ListReviews", anyContext, repositoryOwner, repositoryName, issueNumber, mock.AnythingOfType("*github.ListOptions")).
+					Return(reviews, emptyResponse, noError)
+			})
+		}
+
+		ItDoesNotMerge := func() {
+			It("succeeds without merging", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(responseRecorder.Body.String()).To(ContainSubstring("Not merging"))
+			})
+		}
+
+		Context("with the PR having a current approval", func() {
+			mockReviews(
+				review("reviewer", "COMMENTED", oldHeadSHA),
+				review("reviewer", "APPROVED", headSHA),
+			)
+
+			ItMergesPR(context, pr)
+		})
+
+		Context("with the approval having been dismissed", func() {
+			mockReviews(
+				review("reviewer", "APPROVED", oldHeadSHA),
+				review("reviewer", "DISMISSED", oldHeadSHA),
+			)
+
+			ItDoesNotMerge()
+		})
+
+		Context("with another reviewer requesting changes", func() {
+			mockReviews(
+				review("reviewer", "APPROVED", headSHA),
+				review("other-reviewer", "CHANGES_REQUESTED", headSHA),
+			)
+
+			ItDoesNotMerge()
+		})
+
+		Context("with approvals expiring", func() {
+			BeforeEach(func() {
+				context.Config.ApprovalMaxAge = 24 * time.Hour
+			})
+
+			Context("with the approval being recent", func() {
+				mockReviews(
+					submittedAgo(review("reviewer", "APPROVED", headSHA), time.Hour),
+				)
+
+				ItMergesPR(context, pr)
+			})
+
+			Context("with the approval having expired", func() {
+				mockReviews(
+					submittedAgo(review("reviewer", "APPROVED", headSHA), 48*time.Hour),
+				)
+
+				It("asks for a re-approval without merging", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					Expect(responseRecorder.Body.String()).To(ContainSubstring("Not merging"))
+					Expect(responseRecorder.Body.String()).To(ContainSubstring("@reviewer"))
+					Expect(responseRecorder.Body.String()).To(ContainSubstring("re-approval is needed"))
+				})
+			})
+		})
+
+		Context("with the approval given to an earlier head", func() {
+			mockReviews(
+				review("reviewer", "APPROVED", oldHeadSHA),
+			)
+
+			Context("with stale approvals being ignored", func() {
+				BeforeEach(func() {
+					context.Config.IgnoreStaleApprovals = true
+				})
+
+				ItDoesNotMerge()
+			})
+
+			Context("with stale approvals being allowed", func() {
+				ItMergesPR(context, pr)
+			})
+		})
+	})
+})
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var loginRegexp = regexp.MustCompile(`^[A-Za-z0-9](?:[A-Za-z0-9-]*[A-Za-z0-9])?$`)
+
+func isAssignCommand(comment string) bool {
+	_, isAssign := parseAssigneesCommand(comment, "!assign")
+	return isAssign
+}
+
+func isUnassignCommand(comment string) bool {
+	_, isUnassign := parseAssigneesCommand(comment, "!unassign")
+	return isUnassign
+}
+
+// parseAssigneesCommand parses a command followed by one or more logins, e.g.
+// "!assign @alice @bob", and returns the logins without the @ prefix.
+func parseAssigneesCommand(comment, command string) ([]string, bool) {
+	fields := strings.Fields(comment)
+	if len(fields) < 2 || fields[0] != command {
+		return nil, false
+	}
+	logins := make([]string, len(fields)-1)
+	for i, field := range fields[1:] {
+		logins[i] = strings.TrimPrefix(field, "@")
+	}
+	return logins, true
+}
+
+// handleAssignCommand assigns the mentioned users to the PR. Only the
+// repository's collaborators can be assigned, so the rest are reported back
+// in a comment.
+func handleAssignCommand(issueComment IssueComment, issues Issues, repositories Repositories) Response {
+	issue := issueComment.Issue()
+	logins, _ := parseAssigneesCommand(issueComment.Comment, "!assign")
+	var assignees, invalidLogins, nonCollaborators []string
+	for _, login := range logins {
+		if !loginRegexp.MatchString(login) {
+			invalidLogins = append(invalidLogins, login)
+			continue
+		}
+		isCollab, err := isCollaborator(issue.Repository, User{Login: login}, repositories)
+		if err != nil {
+			message := fmt.Sprintf("Failed to check if %s can be assigned to PR %s", login, issue.FullName())
+			return ErrorResponse{err, http.StatusBadGateway, message}
+		} else if !isCollab {
+			nonCollaborators = append(nonCollaborators, login)
+			continue
+		}
+		assignees = append(assignees, login)
+	}
+
+	if len(assignees) > 0 {
+		_, _, err := issues.AddAssignees(context.TODO(), issue.Repository.Owner, issue.Repository.Name,
+			issue.Number, assignees)
+		if err != nil {
+			message := fmt.Sprintf("Failed to assign %s to PR %s", strings.Join(assignees, ", "), issue.FullName())
+			return ErrorResponse{err, http.StatusBadGateway, message}
+		}
+	}
+	var problems []string
+	if len(invalidLogins) > 0 {
+		problems = append(problems, fmt.Sprintf("I couldn't assign %s, because they aren't valid GitHub logins.",
+			formatLogins(invalidLogins)))
+	}
+	if len(nonCollaborators) > 0 {
+		problems = append(problems, fmt.Sprintf("I couldn't assign %s, because they aren't collaborators of "+
+			"this repository.", formatUsers(nonCollaborators)))
+	}
+	if len(problems) > 0 {
+		message := fmt.Sprintf("@%s, %s", issueComment.Commenter.Login, strings.Join(problems, " "))
+		if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+			errorMessage := fmt.Sprintf("Failed to report the invalid assignees of PR %s", issue.FullName())
+			return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+		}
+	}
+	return SuccessResponse{fmt.Sprintf("Assigned %d of %d users to PR %s", len(assignees), len(logins),
+		issue.FullName())}
+}
+
+// handleUnassignCommand unassigns the mentioned users from the PR. Former
+// collaborators can be unassigned, so only the format of the logins is
+// checked.
+func handleUnassignCommand(issueComment IssueComment, issues Issues) Response {
+	issue := issueComment.Issue()
+	logins, _ := parseAssigneesCommand(issueComment.Comment, "!unassign")
+	var assignees, invalidLogins []string
+	for _, login := range logins {
+		if loginRegexp.MatchString(login) {
+			assignees = append(assignees, login)
+		} else {
+			invalidLogins = append(invalidLogins, login)
+		}
+	}
+
+	if len(assignees) > 0 {
+		_, _, err := issues.RemoveAssignees(context.TODO(), issue.Repository.Owner, issue.Repository.Name,
+			issue.Number, assignees)
+		if err != nil {
+			message := fmt.Sprintf("Failed to unassign %s from PR %s", strings.Join(assignees, ", "),
+				issue.FullName())
+			return ErrorResponse{err, http.StatusBadGateway, message}
+		}
+	}
+	if len(invalidLogins) > 0 {
+		message := fmt.Sprintf("@%s, I couldn't unassign %s, because they aren't valid GitHub logins.",
+			issueComment.Commenter.Login, formatLogins(invalidLogins))
+		if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+			errorMessage := fmt.Sprintf("Failed to report the invalid assignees of PR %s", issue.FullName())
+			return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+		}
+	}
+	return SuccessResponse{fmt.Sprintf("Unassigned %d of %d users from PR %s", len(assignees), len(logins),
+		issue.FullName())}
+}
+
+func formatLogins(logins []string) string {
+	return "`" + strings.Join(logins, "`, `") + "`"
+}
+
+// formatUsers formats the logins without mentioning the users, so that they
+// wouldn't be notified about not being assigned.
+func formatUsers(logins []string) string {
+	return "`@" + strings.Join(logins, "`, `@") + "`"
+}
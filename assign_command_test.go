@@ -0,0 +1,148 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	var (
+		handle      = context.Handle
+		headers     = context.Headers
+		requestJSON = context.RequestJSON
+
+		responseRecorder *httptest.ResponseRecorder
+		repositories     *mocks.Repositories
+		issues           *mocks.Issues
+	)
+	BeforeEach(func() {
+		responseRecorder = *context.ResponseRecorder
+		repositories = *context.Repositories
+		issues = *context.Issues
+	})
+
+	headers.Is(func() map[string]string {
+		return map[string]string{
+			"X-Github-Event": "issue_comment",
+		}
+	})
+
+	Describe("!assign comment", func() {
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!assign @alice bob @not_a_login @mallory", arbitraryIssueAuthor)
+		})
+
+		ForCollaborator(context, repositoryOwner, repositoryName, arbitraryIssueAuthor, func() {
+			BeforeEach(func() {
+				for _, user := range []string{"alice", "bob"} {
+					repositories.
+						On("IsCollaborator", anyContext, repositoryOwner, repositoryName, user).
+						Return(true, emptyResponse, noError)
+				}
+				repositories.
+					On("IsCollaborator", anyContext, repositoryOwner, repositoryName, "mallory").
+					Return(false, emptyResponse, noError)
+			})
+
+			Context("with assigning failing", func() {
+				BeforeEach(func() {
+					issues.
+						On("AddAssignees", anyContext, repositoryOwner, repositoryName, issueNumber,
+							[]string{"alice", "bob"}).
+						Return(emptyResult, emptyResponse, errArbitrary)
+				})
+
+				It("fails with a gateway error", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusBadGateway))
+				})
+			})
+
+			Context("with assigning succeeding", func() {
+				BeforeEach(func() {
+					issues.
+						On("AddAssignees", anyContext, repositoryOwner, repositoryName, issueNumber,
+							[]string{"alice", "bob"}).
+						Return(emptyResult, emptyResponse, noError)
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("I couldn't assign `not_a_login`, because they "+
+								"aren't valid GitHub logins. I couldn't assign `@mallory`, because they aren't "+
+								"collaborators of this repository."))).
+						Return(emptyResult, emptyResponse, noError)
+				})
+
+				It("assigns the collaborators and reports the rest", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					Expect(responseRecorder.Body.String()).To(ContainSubstring("Assigned 2 of 4 users"))
+				})
+			})
+		})
+	})
+
+	Describe("!unassign comment", func() {
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!unassign @alice @bob", arbitraryIssueAuthor)
+		})
+
+		ForCollaborator(context, repositoryOwner, repositoryName, arbitraryIssueAuthor, func() {
+			BeforeEach(func() {
+				issues.
+					On("RemoveAssignees", anyContext, repositoryOwner, repositoryName, issueNumber,
+						[]string{"alice", "bob"}).
+					Return(emptyResult, emptyResponse, noError)
+			})
+
+			It("unassigns the users", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(responseRecorder.Body.String()).To(ContainSubstring("Unassigned 2 of 2 users"))
+			})
+		})
+	})
+
+	Describe("!unassign comment with an invalid login by someone other than the PR's author", func() {
+		requestJSON.Is(func() string {
+			return withCommenter(IssueCommentEvent("!unassign @alice not_a_login", arbitraryIssueAuthor), "reviewer")
+		})
+
+		ForCollaborator(context, repositoryOwner, repositoryName, arbitraryIssueAuthor, func() {
+			BeforeEach(func() {
+				issues.
+					On("RemoveAssignees", anyContext, repositoryOwner, repositoryName, issueNumber,
+						[]string{"alice"}).
+					Return(emptyResult, emptyResponse, noError)
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("@reviewer, I couldn't unassign `not_a_login`"))).
+					Return(emptyResult, emptyResponse, noError).
+					Once()
+			})
+
+			It("reports the invalid login to the commenter", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+			})
+		})
+	})
+
+	Describe("!assign comment without users", func() {
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!assign", arbitraryIssueAuthor)
+		})
+
+		It("is ignored", func() {
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			Expect(responseRecorder.Body.String()).To(ContainSubstring("Not a command I understand"))
+		})
+	})
+})
@@ -7,9 +7,16 @@ import (
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// scheduledOperations is the number of asynchronous operations that have
+// been scheduled, but haven't finished yet. Reported by /debug/state.
+var scheduledOperations int64
+
+const panicReportFlushTimeout = 5 * time.Second
+
 type asyncResponse struct {
 	Response
 	MayBeRetried bool
@@ -35,8 +42,8 @@ func syncResponse(response Response) MaybeSyncResponse {
 	}
 }
 
-func delayWithRetries(tryDelays []time.Duration, operation func() asyncResponse,
-	asyncOperationWg *sync.WaitGroup) MaybeSyncResponse {
+func delayWithRetries(tryDelays []time.Duration, repository Repository, operation func() asyncResponse,
+	scheduler *Scheduler, reporter webhookReporter, asyncOperationWg *sync.WaitGroup) MaybeSyncResponse {
 
 	if len(tryDelays) < 1 {
 		return syncResponse(ErrorResponse{
@@ -49,7 +56,8 @@ func delayWithRetries(tryDelays []time.Duration, operation func() asyncResponse,
 		response := operation()
 		if len(tryDelays) > 1 && response.MayBeRetried {
 			log.Println("Operation will be retried")
-			if err := asyncDelayWithRetries(tryDelays[1:], operation, asyncOperationWg); err != nil {
+			err := asyncDelayWithRetries(tryDelays[1:], repository, operation, scheduler, reporter, asyncOperationWg)
+			if err != nil {
 				return syncResponse(
 					ErrorResponse{err, http.StatusInternalServerError, "Failed to schedule async retries"},
 				)
@@ -59,7 +67,8 @@ func delayWithRetries(tryDelays []time.Duration, operation func() asyncResponse,
 		return syncResponse(response)
 	}
 
-	if err := asyncDelayWithRetries(tryDelays, operation, asyncOperationWg); err != nil {
+	err := asyncDelayWithRetries(tryDelays, repository, operation, scheduler, reporter, asyncOperationWg)
+	if err != nil {
 		return syncResponse(
 			ErrorResponse{err, http.StatusInternalServerError, "Failed to schedule async delay with retries"},
 		)
@@ -67,19 +76,36 @@ func delayWithRetries(tryDelays []time.Duration, operation func() asyncResponse,
 	return MaybeSyncResponse{OperationFinishedSynchronously: false}
 }
 
-func asyncDelayWithRetries(tryDelays []time.Duration, operation func() asyncResponse,
-	asyncOperationWg *sync.WaitGroup) error {
+func asyncDelayWithRetries(tryDelays []time.Duration, repository Repository, operation func() asyncResponse,
+	scheduler *Scheduler, reporter webhookReporter, asyncOperationWg *sync.WaitGroup) error {
 
 	if len(tryDelays) < 1 {
 		return errors.New("Cannot schedule any delayed operations when tryDelays is empty")
 	}
 
 	delay(tryDelays[0], func() {
-		response := operation()
+		var response asyncResponse
+		scheduler.Run(repository, func() {
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					// The process is about to crash, so make sure the
+					// report gets sent first
+					reporter.reportPanic(recovered)
+					reporter.reporter.Flush(panicReportFlushTimeout)
+					panic(recovered)
+				}
+			}()
+			response = operation()
+		})
 		handleAsyncResponse(response.Response)
+		if len(tryDelays) <= 1 || !response.MayBeRetried {
+			// Only the final failure is worth reporting
+			reporter.reportResponse(response.Response)
+		}
 		if len(tryDelays) > 1 && response.MayBeRetried {
 			log.Println("Operation will be retried")
-			if err := asyncDelayWithRetries(tryDelays[1:], operation, asyncOperationWg); err != nil {
+			err := asyncDelayWithRetries(tryDelays[1:], repository, operation, scheduler, reporter, asyncOperationWg)
+			if err != nil {
 				log.Printf("Failed to schedule another try to start in %s\n", tryDelays[1].String())
 				return
 			}
@@ -96,8 +122,10 @@ func delay(duration time.Duration, operation func(), asyncOperationWg *sync.Wait
 	timer := time.NewTimer(duration)
 
 	asyncOperationWg.Add(1)
+	atomic.AddInt64(&scheduledOperations, 1)
 	go func() {
 		defer asyncOperationWg.Done()
+		defer atomic.AddInt64(&scheduledOperations, -1)
 		// Avoid leaking channels
 		defer signal.Stop(interruptChan)
 
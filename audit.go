@@ -0,0 +1,521 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/git"
+)
+
+const (
+	auditOutcomeSuccess = "success"
+	auditOutcomeFailure = "failure"
+)
+
+// AuditEntry records a command the bot received or a mutating action it took.
+type AuditEntry struct {
+	Time        time.Time `json:"time"`
+	Actor       string    `json:"actor,omitempty"`
+	Action      string    `json:"action"`
+	Repository  string    `json:"repository,omitempty"`
+	PullRequest int       `json:"pull_request,omitempty"`
+	// Details describes the target of the action, e.g. the label or the
+	// branch
+	Details    string `json:"details,omitempty"`
+	DeliveryID string `json:"delivery_id,omitempty"`
+	Outcome    string `json:"outcome"`
+	Error      string `json:"error,omitempty"`
+}
+
+// AuditFilter selects audit entries. Zero values match everything.
+type AuditFilter struct {
+	Repository  string
+	PullRequest int
+	Since       time.Time
+	// Limit is the maximum number of the latest matching entries to return
+	Limit int
+}
+
+func (f AuditFilter) matches(entry AuditEntry) bool {
+	return (f.Repository == "" || entry.Repository == f.Repository) &&
+		(f.PullRequest == 0 || entry.PullRequest == f.PullRequest) &&
+		!entry.Time.Before(f.Since)
+}
+
+// AuditLog is an append-only log of the bot's actions.
+type AuditLog interface {
+	Record(AuditEntry) error
+	// Entries returns the matching entries in the order they were recorded.
+	Entries(AuditFilter) ([]AuditEntry, error)
+}
+
+// NewAuditLog creates an audit log appending to the configured file. Without
+// a file, the log is kept in the SQLITE_PATH file or, without one either, only
+// in memory.
+func NewAuditLog(conf Config) (AuditLog, error) {
+	if conf.AuditLogPath == "" && conf.SQLitePath != "" {
+		return NewSQLiteAuditLog(conf.SQLitePath)
+	} else if conf.AuditLogPath == "" {
+		return &memoryAuditLog{}, nil
+	}
+	file, err := os.OpenFile(conf.AuditLogPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the audit log: %v", err)
+	}
+	return &fileAuditLog{path: conf.AuditLogPath, file: file}, nil
+}
+
+type memoryAuditLog struct {
+	sync.Mutex
+	entries []AuditEntry
+}
+
+func (l *memoryAuditLog) Record(entry AuditEntry) error {
+	l.Lock()
+	defer l.Unlock()
+	l.entries = append(l.entries, entry)
+	return nil
+}
+
+func (l *memoryAuditLog) Entries(filter AuditFilter) ([]AuditEntry, error) {
+	l.Lock()
+	defer l.Unlock()
+	return filterAuditEntries(l.entries, filter), nil
+}
+
+// fileAuditLog writes the entries to a file as JSON lines.
+type fileAuditLog struct {
+	sync.Mutex
+	path string
+	file *os.File
+}
+
+func (l *fileAuditLog) Record(entry AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	l.Lock()
+	defer l.Unlock()
+	if _, err = l.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return l.file.Sync()
+}
+
+func (l *fileAuditLog) Entries(filter AuditFilter) ([]AuditEntry, error) {
+	l.Lock()
+	defer l.Unlock()
+	file, err := os.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := []AuditEntry{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse audit log entry %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return filterAuditEntries(entries, filter), nil
+}
+
+func filterAuditEntries(entries []AuditEntry, filter AuditFilter) []AuditEntry {
+	matching := []AuditEntry{}
+	for _, entry := range entries {
+		if filter.matches(entry) {
+			matching = append(matching, entry)
+		}
+	}
+	if filter.Limit > 0 && len(matching) > filter.Limit {
+		matching = matching[len(matching)-filter.Limit:]
+	}
+	return matching
+}
+
+// auditor records the actions taken while handling a webhook or running a
+// background job, on behalf of the actor in its context.
+type auditor struct {
+	log     AuditLog
+	context WebhookContext
+}
+
+func (a auditor) record(action string, repository Repository, pullRequest int, details string, err error) {
+	entry := AuditEntry{
+		Time:        time.Now(),
+		Actor:       a.context.Actor,
+		Action:      action,
+		PullRequest: pullRequest,
+		Details:     details,
+		DeliveryID:  a.context.DeliveryID,
+		Outcome:     auditOutcomeSuccess,
+	}
+	if repository.Owner != "" {
+		entry.Repository = repositoryKey(repository)
+	}
+	if err != nil {
+		entry.Outcome = auditOutcomeFailure
+		entry.Error = auditErrorMessage(err)
+	}
+	if recordErr := a.log.Record(entry); recordErr != nil {
+		// The action has already been taken, so there's no point in failing it
+		log.Printf("Failed to record %s in the audit log: %v\n", action, recordErr)
+	}
+}
+
+// auditErrorMessage describes the error. GitHub API errors are described by
+// their status and message, leaving out the request's URL.
+func auditErrorMessage(err error) string {
+	if githubErr, ok := err.(*github.ErrorResponse); ok {
+		if githubErr.Response != nil {
+			return fmt.Sprintf("%d %s", githubErr.Response.StatusCode, githubErr.Message)
+		}
+		return githubErr.Message
+	}
+	return err.Error()
+}
+
+// recordCommand records the command in the context, with the outcome of
+// handling it.
+func (a auditor) recordCommand(response Response) {
+	if a.context.Command == "" {
+		return
+	}
+	var err error
+	if errResp, ok := asErrorResponse(response); ok {
+		err = errors.New(errResp.ErrorMessage)
+		if errResp.Error != nil {
+			err = fmt.Errorf("%s: %s", errResp.ErrorMessage, auditErrorMessage(errResp.Error))
+		}
+	}
+	a.record("command", a.context.Repository, a.context.PullRequest, a.context.Command, err)
+}
+
+// auditClients wraps the clients, so that every mutating action they take
+// would be recorded in the audit log.
+func auditClients(a auditor, gitRepos git.Repos, pullRequests PullRequests, repositories Repositories,
+	issues Issues) (git.Repos, PullRequests, Repositories, Issues) {
+
+	return auditedRepos{a, gitRepos}, auditedPullRequests{a, pullRequests}, auditedRepositories{a, repositories},
+		auditedIssues{a, issues}
+}
+
+type auditedPullRequests struct {
+	auditor
+	PullRequests
+}
+
+func (a auditedPullRequests) Merge(ctx context.Context, owner, repo string, number int, commitMessage string,
+	opt *github.PullRequestOptions) (*github.PullRequestMergeResult, *github.Response, error) {
+
+	result, resp, err := a.PullRequests.Merge(ctx, owner, repo, number, commitMessage, opt)
+	recordedErr := err
+	if err == nil && (result == nil || result.Merged == nil || !*result.Merged) {
+		recordedErr = errors.New("not merged")
+	}
+	a.record("merge", Repository{Owner: owner, Name: repo}, number, "", recordedErr)
+	return result, resp, err
+}
+
+func (a auditedPullRequests) RequestReviewers(ctx context.Context, owner, repo string, number int,
+	reviewers github.ReviewersRequest) (*github.PullRequest, *github.Response, error) {
+
+	pr, resp, err := a.PullRequests.RequestReviewers(ctx, owner, repo, number, reviewers)
+	a.record("request-reviewers", Repository{Owner: owner, Name: repo}, number,
+		strings.Join(reviewers.Reviewers, ","), err)
+	return pr, resp, err
+}
+
+func (a auditedPullRequests) Create(ctx context.Context, owner, repo string,
+	pull *github.NewPullRequest) (*github.PullRequest, *github.Response, error) {
+
+	pr, resp, err := a.PullRequests.Create(ctx, owner, repo, pull)
+	a.record("create-pr", Repository{Owner: owner, Name: repo}, pr.GetNumber(), pull.GetHead(), err)
+	return pr, resp, err
+}
+
+func (a auditedPullRequests) CreateReview(ctx context.Context, owner, repo string, number int,
+	review *github.PullRequestReviewRequest) (*github.PullRequestReview, *github.Response, error) {
+
+	createdReview, resp, err := a.PullRequests.CreateReview(ctx, owner, repo, number, review)
+	a.record("create-review", Repository{Owner: owner, Name: repo}, number, review.GetEvent(), err)
+	return createdReview, resp, err
+}
+
+type auditedRepositories struct {
+	auditor
+	Repositories
+}
+
+func (a auditedRepositories) CreateStatus(ctx context.Context, owner, repo, ref string,
+	status *github.RepoStatus) (*github.RepoStatus, *github.Response, error) {
+
+	createdStatus, resp, err := a.Repositories.CreateStatus(ctx, owner, repo, ref, status)
+	details := fmt.Sprintf("%s=%s on %s", status.GetContext(), status.GetState(), ref)
+	a.record("set-status", Repository{Owner: owner, Name: repo}, a.context.PullRequest, details, err)
+	return createdStatus, resp, err
+}
+
+func (a auditedRepositories) CreateComment(ctx context.Context, owner, repo, sha string,
+	comment *github.RepositoryComment) (*github.RepositoryComment, *github.Response, error) {
+
+	createdComment, resp, err := a.Repositories.CreateComment(ctx, owner, repo, sha, comment)
+	details := sha
+	if createdComment != nil && createdComment.HTMLURL != nil {
+		details = *createdComment.HTMLURL
+	}
+	a.record("commit-comment", Repository{Owner: owner, Name: repo}, a.context.PullRequest, details, err)
+	return createdComment, resp, err
+}
+
+func (a auditedRepositories) CreateRelease(ctx context.Context, owner, repo string,
+	release *github.RepositoryRelease) (*github.RepositoryRelease, *github.Response, error) {
+
+	createdRelease, resp, err := a.Repositories.CreateRelease(ctx, owner, repo, release)
+	a.record("create-release", Repository{Owner: owner, Name: repo}, a.context.PullRequest, release.GetName(), err)
+	return createdRelease, resp, err
+}
+
+func (a auditedRepositories) EditRelease(ctx context.Context, owner, repo string, id int,
+	release *github.RepositoryRelease) (*github.RepositoryRelease, *github.Response, error) {
+
+	editedRelease, resp, err := a.Repositories.EditRelease(ctx, owner, repo, id, release)
+	a.record("edit-release", Repository{Owner: owner, Name: repo}, a.context.PullRequest, release.GetName(), err)
+	return editedRelease, resp, err
+}
+
+func (a auditedRepositories) CreateDeployment(ctx context.Context, owner, repo string,
+	request *github.DeploymentRequest) (*github.Deployment, *github.Response, error) {
+
+	deployment, resp, err := a.Repositories.CreateDeployment(ctx, owner, repo, request)
+	details := fmt.Sprintf("%s to %s", request.GetRef(), request.GetEnvironment())
+	a.record("create-deployment", Repository{Owner: owner, Name: repo}, a.context.PullRequest, details, err)
+	return deployment, resp, err
+}
+
+func (a auditedRepositories) Merge(ctx context.Context, owner, repo string,
+	request *github.RepositoryMergeRequest) (*github.RepositoryCommit, *github.Response, error) {
+
+	commit, resp, err := a.Repositories.Merge(ctx, owner, repo, request)
+	details := fmt.Sprintf("%s into %s", request.GetHead(), request.GetBase())
+	a.record("merge-branch", Repository{Owner: owner, Name: repo}, a.context.PullRequest, details, err)
+	return commit, resp, err
+}
+
+type auditedIssues struct {
+	auditor
+	Issues
+}
+
+func (a auditedIssues) AddLabelsToIssue(ctx context.Context, owner, repo string, number int,
+	labels []string) ([]*github.Label, *github.Response, error) {
+
+	addedLabels, resp, err := a.Issues.AddLabelsToIssue(ctx, owner, repo, number, labels)
+	a.record("add-label", Repository{Owner: owner, Name: repo}, number, strings.Join(labels, ","), err)
+	return addedLabels, resp, err
+}
+
+func (a auditedIssues) RemoveLabelForIssue(ctx context.Context, owner, repo string, number int,
+	label string) (*github.Response, error) {
+
+	resp, err := a.Issues.RemoveLabelForIssue(ctx, owner, repo, number, label)
+	a.record("remove-label", Repository{Owner: owner, Name: repo}, number, label, err)
+	return resp, err
+}
+
+func (a auditedIssues) CreateComment(ctx context.Context, owner string, repo string, number int,
+	comment *github.IssueComment) (*github.IssueComment, *github.Response, error) {
+
+	createdComment, resp, err := a.Issues.CreateComment(ctx, owner, repo, number, comment)
+	details := ""
+	if createdComment != nil && createdComment.HTMLURL != nil {
+		details = *createdComment.HTMLURL
+	}
+	a.record("comment", Repository{Owner: owner, Name: repo}, number, details, err)
+	return createdComment, resp, err
+}
+
+func (a auditedIssues) EditComment(ctx context.Context, owner string, repo string, id int64,
+	comment *github.IssueComment) (*github.IssueComment, *github.Response, error) {
+
+	editedComment, resp, err := a.Issues.EditComment(ctx, owner, repo, id, comment)
+	details := ""
+	if editedComment != nil && editedComment.HTMLURL != nil {
+		details = *editedComment.HTMLURL
+	}
+	a.record("edit-comment", Repository{Owner: owner, Name: repo}, a.context.PullRequest, details, err)
+	return editedComment, resp, err
+}
+
+func (a auditedIssues) AddAssignees(ctx context.Context, owner, repo string, number int,
+	assignees []string) (*github.Issue, *github.Response, error) {
+
+	issue, resp, err := a.Issues.AddAssignees(ctx, owner, repo, number, assignees)
+	a.record("assign", Repository{Owner: owner, Name: repo}, number, strings.Join(assignees, ","), err)
+	return issue, resp, err
+}
+
+func (a auditedIssues) RemoveAssignees(ctx context.Context, owner, repo string, number int,
+	assignees []string) (*github.Issue, *github.Response, error) {
+
+	issue, resp, err := a.Issues.RemoveAssignees(ctx, owner, repo, number, assignees)
+	a.record("unassign", Repository{Owner: owner, Name: repo}, number, strings.Join(assignees, ","), err)
+	return issue, resp, err
+}
+
+func (a auditedIssues) Edit(ctx context.Context, owner string, repo string, number int,
+	issue *github.IssueRequest) (*github.Issue, *github.Response, error) {
+
+	editedIssue, resp, err := a.Issues.Edit(ctx, owner, repo, number, issue)
+	a.record("edit", Repository{Owner: owner, Name: repo}, number, issueRequestDetails(issue), err)
+	return editedIssue, resp, err
+}
+
+func (a auditedIssues) CreateMilestone(ctx context.Context, owner string, repo string,
+	milestone *github.Milestone) (*github.Milestone, *github.Response, error) {
+
+	createdMilestone, resp, err := a.Issues.CreateMilestone(ctx, owner, repo, milestone)
+	a.record("create-milestone", Repository{Owner: owner, Name: repo}, a.context.PullRequest,
+		milestone.GetTitle(), err)
+	return createdMilestone, resp, err
+}
+
+func (a auditedIssues) Lock(ctx context.Context, owner string, repo string, number int,
+	opt *github.LockIssueOptions) (*github.Response, error) {
+
+	resp, err := a.Issues.Lock(ctx, owner, repo, number, opt)
+	details := ""
+	if opt != nil {
+		details = opt.LockReason
+	}
+	a.record("lock", Repository{Owner: owner, Name: repo}, number, details, err)
+	return resp, err
+}
+
+func (a auditedIssues) Unlock(ctx context.Context, owner string, repo string, number int) (*github.Response, error) {
+	resp, err := a.Issues.Unlock(ctx, owner, repo, number)
+	a.record("unlock", Repository{Owner: owner, Name: repo}, number, "", err)
+	return resp, err
+}
+
+// issueRequestDetails lists the fields the request changes.
+func issueRequestDetails(issue *github.IssueRequest) string {
+	var changes []string
+	if issue.Title != nil {
+		changes = append(changes, fmt.Sprintf("title=%s", *issue.Title))
+	}
+	if issue.Milestone != nil {
+		changes = append(changes, fmt.Sprintf("milestone=%d", *issue.Milestone))
+	}
+	return strings.Join(changes, ",")
+}
+
+type auditedRepos struct {
+	auditor
+	git.Repos
+}
+
+func (a auditedRepos) GetUpdatedRepo(url, repoOwner, repoName string) (git.Repo, error) {
+	repo, err := a.Repos.GetUpdatedRepo(url, repoOwner, repoName)
+	if err != nil {
+		return nil, err
+	}
+	return auditedRepo{a.auditor, Repository{Owner: repoOwner, Name: repoName}, repo}, nil
+}
+
+func (a auditedRepos) WithContext(ctx context.Context) git.Repos {
+	return auditedRepos{a.auditor, a.Repos.WithContext(ctx)}
+}
+
+type auditedRepo struct {
+	auditor
+	repository Repository
+	git.Repo
+}
+
+func (a auditedRepo) AutosquashAndPush(upstreamRef, branchRef, remote, destinationRef string) error {
+	err := a.Repo.AutosquashAndPush(upstreamRef, branchRef, remote, destinationRef)
+	a.record("squash-push", a.repository, a.context.PullRequest, remote+"/"+destinationRef, err)
+	return err
+}
+
+func (a auditedRepo) SquashAndPush(upstreamRef, branchRef string, count int, message, remote,
+	destinationRef string) error {
+
+	err := a.Repo.SquashAndPush(upstreamRef, branchRef, count, message, remote, destinationRef)
+	a.record("squash-push", a.repository, a.context.PullRequest, remote+"/"+destinationRef, err)
+	return err
+}
+
+func (a auditedRepo) RebaseAndPush(upstreamRef, branchRef, remote, destinationRef string) (string, error) {
+	sha, err := a.Repo.RebaseAndPush(upstreamRef, branchRef, remote, destinationRef)
+	a.record("rebase-push", a.repository, a.context.PullRequest, remote+"/"+destinationRef, err)
+	return sha, err
+}
+
+func (a auditedRepo) RebaseOntoAndPush(upstreamRef, oldBaseRef, branchRef, remote,
+	destinationRef string) (string, error) {
+
+	sha, err := a.Repo.RebaseOntoAndPush(upstreamRef, oldBaseRef, branchRef, remote, destinationRef)
+	a.record("rebase-push", a.repository, a.context.PullRequest,
+		fmt.Sprintf("%s onto %s to %s/%s", branchRef, upstreamRef, remote, destinationRef), err)
+	return sha, err
+}
+
+func (a auditedRepo) CherryPickAndPush(upstreamRef, commit, remote, destinationRef string) error {
+	err := a.Repo.CherryPickAndPush(upstreamRef, commit, remote, destinationRef)
+	a.record("cherry-pick-push", a.repository, a.context.PullRequest,
+		fmt.Sprintf("%s onto %s to %s/%s", commit, upstreamRef, remote, destinationRef), err)
+	return err
+}
+
+func (a auditedRepo) CherryPickOntoBranch(commits []string, remote, branch string) ([]string, error) {
+	shas, err := a.Repo.CherryPickOntoBranch(commits, remote, branch)
+	a.record("cherry-pick-push", a.repository, a.context.PullRequest,
+		fmt.Sprintf("%s onto %s/%s", strings.Join(commits, ", "), remote, branch), err)
+	return shas, err
+}
+
+func (a auditedRepo) RevertAndPush(upstreamRef, commit, remote, destinationRef string) error {
+	err := a.Repo.RevertAndPush(upstreamRef, commit, remote, destinationRef)
+	a.record("revert-push", a.repository, a.context.PullRequest,
+		fmt.Sprintf("%s onto %s to %s/%s", commit, upstreamRef, remote, destinationRef), err)
+	return err
+}
+
+func (a auditedRepo) Push(ref, remote, destinationRef string) error {
+	err := a.Repo.Push(ref, remote, destinationRef)
+	a.record("push", a.repository, a.context.PullRequest, fmt.Sprintf("%s to %s/%s", ref, remote, destinationRef),
+		err)
+	return err
+}
+
+func (a auditedRepo) ForcePush(ref, remote, destinationRef string) error {
+	err := a.Repo.ForcePush(ref, remote, destinationRef)
+	a.record("force-push", a.repository, a.context.PullRequest,
+		fmt.Sprintf("%s to %s/%s", ref, remote, destinationRef), err)
+	return err
+}
+
+func (a auditedRepo) DeleteRemoteBranch(remoteRef string) error {
+	err := a.Repo.DeleteRemoteBranch(remoteRef)
+	a.record("delete-branch", a.repository, a.context.PullRequest, remoteRef, err)
+	return err
+}
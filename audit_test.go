@@ -0,0 +1,198 @@
+package main_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("audit log", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+			auditLog         grh.AuditLog
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			repositories = *context.Repositories
+			issues = *context.Issues
+			auditLog = *context.AuditLog
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event":    "issue_comment",
+				"X-Github-Delivery": "72d3162e-cc78-11e3-81ab-4c9367dc0958",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!merge", arbitraryIssueAuthor)
+		})
+
+		Context("with the commenter not being a collaborator", func() {
+			BeforeEach(func() {
+				repositories.
+					On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+					Return(false, emptyResponse, noError)
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentMentioning(arbitraryIssueAuthor))).
+					Return(emptyResult, emptyResponse, noError)
+			})
+
+			It("records the comment and the command", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+
+				entries, err := auditLog.Entries(grh.AuditFilter{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(entries).To(HaveLen(2))
+				Expect(entries[0].Action).To(Equal("comment"))
+				Expect(entries[1].Action).To(Equal("command"))
+				Expect(entries[1].Details).To(Equal("!merge"))
+				for _, entry := range entries {
+					Expect(entry.Actor).To(Equal(arbitraryIssueAuthor))
+					Expect(entry.Repository).To(Equal(repositoryOwner + "/" + repositoryName))
+					Expect(entry.PullRequest).To(Equal(issueNumber))
+					Expect(entry.DeliveryID).To(Equal("72d3162e-cc78-11e3-81ab-4c9367dc0958"))
+					Expect(entry.Outcome).To(Equal("success"))
+				}
+			})
+		})
+
+		Context("with the collaborator check failing", func() {
+			BeforeEach(func() {
+				repositories.
+					On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+					Return(false, emptyResponse, errArbitrary)
+			})
+
+			It("records the command as failed", func() {
+				handle()
+
+				entries, err := auditLog.Entries(grh.AuditFilter{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(entries).To(HaveLen(1))
+				Expect(entries[0].Action).To(Equal("command"))
+				Expect(entries[0].Outcome).To(Equal("failure"))
+				Expect(entries[0].Error).To(ContainSubstring(errArbitrary.Error()))
+			})
+		})
+
+		Context("with an invalid signature", func() {
+			headers.Is(func() map[string]string {
+				return map[string]string{
+					"X-Github-Event":  "issue_comment",
+					"X-Hub-Signature": "sha1=2f539a59127d552f4565b1a114ec8f4fa2d55f55",
+				}
+			})
+
+			It("doesn't record the command", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusForbidden))
+
+				entries, err := auditLog.Entries(grh.AuditFilter{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(entries).To(BeEmpty())
+			})
+		})
+	})
+})
+
+var _ = Describe("File audit log", func() {
+	var (
+		dir      string
+		auditLog grh.AuditLog
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "audit-log")
+		Expect(err).NotTo(HaveOccurred())
+		auditLog, err = grh.NewAuditLog(grh.Config{AuditLogPath: filepath.Join(dir, "audit.log")})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("appends the entries and filters them", func() {
+		now := time.Now()
+		Expect(auditLog.Record(grh.AuditEntry{Time: now.Add(-time.Hour), Action: "merge",
+			Repository: "salemove/api", PullRequest: 1, Outcome: "success"})).To(Succeed())
+		Expect(auditLog.Record(grh.AuditEntry{Time: now, Action: "comment",
+			Repository: "salemove/api", PullRequest: 2, Outcome: "success"})).To(Succeed())
+		Expect(auditLog.Record(grh.AuditEntry{Time: now, Action: "add-label",
+			Repository: "salemove/web", PullRequest: 2, Outcome: "failure"})).To(Succeed())
+
+		entries, err := auditLog.Entries(grh.AuditFilter{Repository: "salemove/api"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[0].Action).To(Equal("merge"))
+
+		entries, err = auditLog.Entries(grh.AuditFilter{Since: now.Add(-time.Minute)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(2))
+
+		entries, err = auditLog.Entries(grh.AuditFilter{Limit: 1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Action).To(Equal("add-label"))
+	})
+})
+
+var _ = Describe("SQLite audit log", func() {
+	var (
+		dir      string
+		auditLog grh.AuditLog
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "audit-log")
+		Expect(err).NotTo(HaveOccurred())
+		auditLog, err = grh.NewAuditLog(grh.Config{SQLitePath: filepath.Join(dir, "state.db")})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("appends the entries and filters them", func() {
+		now := time.Now()
+		Expect(auditLog.Record(grh.AuditEntry{Time: now.Add(-time.Hour), Action: "merge",
+			Repository: "salemove/api", PullRequest: 1, Outcome: "success"})).To(Succeed())
+		Expect(auditLog.Record(grh.AuditEntry{Time: now, Action: "comment",
+			Repository: "salemove/api", PullRequest: 2, Outcome: "success"})).To(Succeed())
+		Expect(auditLog.Record(grh.AuditEntry{Time: now, Action: "add-label",
+			Repository: "salemove/web", PullRequest: 2, Outcome: "failure"})).To(Succeed())
+
+		entries, err := auditLog.Entries(grh.AuditFilter{Repository: "salemove/api", PullRequest: 2})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Action).To(Equal("comment"))
+
+		entries, err = auditLog.Entries(grh.AuditFilter{Since: now.Add(-time.Minute), Limit: 1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Action).To(Equal("add-label"))
+	})
+})
@@ -3,35 +3,144 @@ package main
 import (
 	"crypto/hmac"
 	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"hash"
 	"net/http"
+	"sort"
+	"strings"
 )
 
-func checkAuthentication(body []byte, r *http.Request, secret string) *ErrorResponse {
-	signature := r.Header.Get("X-Hub-Signature")
+// readOnlyCommands are the commands that neither change the PR nor run any
+// code, so that outside collaborators can be allowed to issue them.
+var readOnlyCommands = map[string]commentType{
+	"!check":          checkCommand,
+	"!status":         statusCommand,
+	"!simulate merge": simulateMergeCommand,
+	"!summary":        summaryCommand,
+	"!whose-turn":     whoseTurnCommand,
+	"!remind":         remindCommand,
+	"!help":           helpCommand,
+}
+
+// trustedAssociations are the author_associations of the users who can issue
+// any command, as long as the PR's author is a collaborator as well
+var trustedAssociations = map[string]bool{
+	"OWNER":        true,
+	"MEMBER":       true,
+	"COLLABORATOR": true,
+}
+
+// checkAuthentication checks that the webhook is signed with one of the
+// secrets. The SHA-256 signature in X-Hub-Signature-256 is preferred over the
+// legacy SHA-1 one in X-Hub-Signature, which is only checked when GitHub
+// didn't send the former.
+func checkAuthentication(body []byte, r *http.Request, secrets []string) *ErrorResponse {
+	header, algorithm, newHash := "X-Hub-Signature-256", "sha256", sha256.New
+	signature := r.Header.Get(header)
 	if signature == "" {
-		return &ErrorResponse{nil, http.StatusUnauthorized, "Please provide a X-Hub-Signature"}
+		header, algorithm, newHash = "X-Hub-Signature", "sha1", sha1.New
+		signature = r.Header.Get(header)
 	}
-	hasSecret, err := hasSecret(body, signature, secret)
+	if signature == "" {
+		return &ErrorResponse{nil, http.StatusUnauthorized, "Please provide a X-Hub-Signature-256"}
+	}
+	hasSecret, err := hasSecret(body, signature, algorithm, newHash, secrets)
 	if err != nil {
 		return &ErrorResponse{err, http.StatusInternalServerError, "Failed to check the signature"}
 	} else if !hasSecret {
-		return &ErrorResponse{nil, http.StatusForbidden, "Bad X-Hub-Signature"}
+		return &ErrorResponse{nil, http.StatusForbidden, fmt.Sprintf("Bad %s", header)}
 	}
 	return nil
 }
 
-func hasSecret(message []byte, signature, key string) (bool, error) {
-	var messageMACString string
-	fmt.Sscanf(signature, "sha1=%s", &messageMACString)
-	messageMAC, err := hex.DecodeString(messageMACString)
+// authenticateWebhook checks the webhook's signature with the secrets of the
+// repository's tenant, so that one tenant couldn't sign webhooks about
+// another's repositories, and returns the tenant's configuration.
+func authenticateWebhook(conf Config, r *http.Request, body []byte, repository Repository) (Config,
+	*ErrorResponse) {
+
+	conf, isTenant := conf.tenantConfig(repository)
+	if !isTenant {
+		return conf, &ErrorResponse{nil, http.StatusForbidden, fmt.Sprintf("%s is not a tenant", repository.Owner)}
+	}
+	return conf, checkAuthentication(body, r, conf.Secrets)
+}
+
+// hasSecret checks whether the message was signed with any of the keys. The
+// signature is in the "<algorithm>=<hex encoded MAC>" format.
+func hasSecret(message []byte, signature, algorithm string, newHash func() hash.Hash, keys []string) (bool, error) {
+	if !strings.HasPrefix(signature, algorithm+"=") {
+		return false, nil
+	}
+	messageMAC, err := hex.DecodeString(strings.TrimPrefix(signature, algorithm+"="))
 	if err != nil {
 		return false, err
 	}
 
-	mac := hmac.New(sha1.New, []byte(key))
-	mac.Write(message)
-	expectedMAC := mac.Sum(nil)
-	return hmac.Equal(messageMAC, expectedMAC), nil
+	for _, key := range keys {
+		mac := hmac.New(newHash, []byte(key))
+		mac.Write(message)
+		if hmac.Equal(messageMAC, mac.Sum(nil)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// isRepositoryAllowed checks whether the bot may act on the repository. A
+// webhook that isn't about any repository is only allowed, if all
+// repositories are.
+func isRepositoryAllowed(repository Repository, allowedRepositories []string) bool {
+	if len(allowedRepositories) == 0 {
+		return true
+	}
+	for _, allowed := range allowedRepositories {
+		if allowed == repository.Owner || allowed == repositoryKey(repository) {
+			return true
+		}
+	}
+	return false
+}
+
+func readOnlyCommandNames() []string {
+	names := make([]string, 0, len(readOnlyCommands))
+	for name := range readOnlyCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// isBotLogin checks whether the login is the bot's own or one of the other
+// configured bots'. GitHub logins are case-insensitive.
+func isBotLogin(conf Config, login string) bool {
+	if conf.BotLogin != "" && strings.EqualFold(conf.BotLogin, login) {
+		return true
+	}
+	for _, botLogin := range conf.BotLogins {
+		if strings.EqualFold(botLogin, login) {
+			return true
+		}
+	}
+	return false
+}
+
+// isOutsideCollaboratorCommand checks whether the command is one of the
+// configured commands that anyone can issue.
+func isOutsideCollaboratorCommand(commentCategory commentType, outsideCollaboratorCommands []string) bool {
+	for _, command := range outsideCollaboratorCommands {
+		if readOnlyCommands[command] == commentCategory {
+			return true
+		}
+	}
+	return false
+}
+
+// isTrustedCommenter checks the commenter's association with the repository.
+// Comments without an association are trusted, leaving the decision to the
+// collaborator check of the PR's author.
+func isTrustedCommenter(issueComment IssueComment) bool {
+	return issueComment.CommenterAssociation == "" || trustedAssociations[issueComment.CommenterAssociation]
 }
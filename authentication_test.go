@@ -1,10 +1,17 @@
 package main_test
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 
+	grh "github.com/salemove/github-review-helper"
 	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -19,15 +26,23 @@ var _ = TestWebhookHandler(func(context WebhookTestContext) {
 
 			responseRecorder *httptest.ResponseRecorder
 			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
 		)
 		BeforeEach(func() {
 			responseRecorder = *context.ResponseRecorder
 			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
 		})
 
 		Context("with an empty X-Hub-Signature header", func() {
+			requestJSON.Is(func() string {
+				return "{}"
+			})
 			headers.Is(func() map[string]string {
 				return map[string]string{
+					"X-Github-Event":  "ping",
 					"X-Hub-Signature": "",
 				}
 			})
@@ -43,6 +58,7 @@ var _ = TestWebhookHandler(func(context WebhookTestContext) {
 			})
 			headers.Is(func() map[string]string {
 				return map[string]string{
+					"X-Github-Event":  "ping",
 					"X-Hub-Signature": "sha1=2f539a59127d552f4565b1a114ec8f4fa2d55f55",
 				}
 			})
@@ -61,13 +77,27 @@ var _ = TestWebhookHandler(func(context WebhookTestContext) {
 			headers.Is(func() map[string]string {
 				return map[string]string{
 					"X-Hub-Signature": validSignature,
+					"X-Github-Event":  "ping",
 				}
 			})
 
-			It("succeeds with 'ignored' response", func() {
+			It("answers the ping", func() {
 				handle()
 				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
-				Expect(responseRecorder.Body.String()).To(ContainSubstring("Ignoring"))
+				Expect(responseRecorder.Body.String()).To(Equal("Pong"))
+			})
+
+			Context("without an event", func() {
+				headers.Is(func() map[string]string {
+					return map[string]string{
+						"X-Hub-Signature": validSignature,
+					}
+				})
+
+				It("fails with StatusBadRequest", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusBadRequest))
+				})
 			})
 
 			Context("with a gibberish event", func() {
@@ -78,12 +108,106 @@ var _ = TestWebhookHandler(func(context WebhookTestContext) {
 					}
 				})
 
-				It("succeeds with 'ignored' response", func() {
+				It("fails with StatusBadRequest", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusBadRequest))
+				})
+			})
+
+			Context("with a form encoded body", func() {
+				headers.Is(func() map[string]string {
+					return map[string]string{
+						"X-Hub-Signature": validSignature,
+						"X-Github-Event":  "ping",
+						"Content-Type":    "application/x-www-form-urlencoded",
+					}
+				})
+
+				It("fails with StatusUnsupportedMediaType", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusUnsupportedMediaType))
+				})
+			})
+
+			Context("with a body larger than the limit", func() {
+				BeforeEach(func() {
+					context.Config.WebhookMaxBodySize = 1
+				})
+
+				It("fails with StatusRequestEntityTooLarge", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusRequestEntityTooLarge))
+				})
+			})
+		})
+
+		Context("with an X-Hub-Signature-256 header", func() {
+			sha256Signature := func(secret string) string {
+				mac := hmac.New(sha256.New, []byte(secret))
+				mac.Write([]byte("{}"))
+				return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+			}
+			var secret string
+
+			requestJSON.Is(func() string {
+				return "{}"
+			})
+			headers.Is(func() map[string]string {
+				return map[string]string{
+					"X-Github-Event":      "ping",
+					"X-Hub-Signature-256": sha256Signature(secret),
+				}
+			})
+
+			Context("signed with the secret", func() {
+				BeforeEach(func() {
+					secret = "a-secret"
+				})
+
+				It("succeeds", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				})
+			})
+
+			Context("signed with a secret that's being rotated out", func() {
+				BeforeEach(func() {
+					secret = "old-secret"
+					context.Config.Secrets = []string{"a-secret", "old-secret"}
+				})
+
+				It("succeeds", func() {
 					handle()
 					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
-					Expect(responseRecorder.Body.String()).To(ContainSubstring("Ignoring"))
 				})
 			})
+
+			Context("signed with another secret", func() {
+				BeforeEach(func() {
+					secret = "another-secret"
+				})
+
+				It("fails with StatusForbidden even though X-Hub-Signature is valid", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusForbidden))
+				})
+			})
+		})
+
+		Context("with a body that isn't JSON", func() {
+			requestJSON.Is(func() string {
+				return "{"
+			})
+			headers.Is(func() map[string]string {
+				return map[string]string{
+					"X-Github-Event": "issue_comment",
+				}
+			})
+
+			It("fails with StatusBadRequest", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusBadRequest))
+			})
 		})
 
 		Context("with a valid signature", func() {
@@ -105,7 +229,174 @@ var _ = TestWebhookHandler(func(context WebhookTestContext) {
 						Expect(responseRecorder.Body.String()).To(ContainSubstring("Ignoring"))
 					})
 				})
+
+				Context("with a command", func() {
+					requestJSON.Is(func() string {
+						return IssueCommentEvent("!merge", arbitraryIssueAuthor)
+					})
+
+					Context("from one of the configured bots", func() {
+						BeforeEach(func() {
+							context.Config.BotLogins = []string{"review-bot", "Author"}
+						})
+
+						It("succeeds with 'ignored' response without acting on the command", func() {
+							handle()
+							Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+							Expect(responseRecorder.Body.String()).To(Equal("Comment by a bot. Ignoring."))
+						})
+					})
+
+					Context("from a repository that isn't allowed", func() {
+						BeforeEach(func() {
+							context.Config.AllowedRepositories = []string{"other-org", repositoryOwner + "/other"}
+						})
+
+						It("succeeds with 'ignored' response without acting on the command", func() {
+							handle()
+							Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+							Expect(responseRecorder.Body.String()).To(ContainSubstring("is not allowed. Ignoring."))
+						})
+					})
+
+					Context("from a repository of an allowed organization", func() {
+						BeforeEach(func() {
+							context.Config.AllowedRepositories = []string{"other-org", repositoryOwner}
+							repositories.
+								On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+								Return(false, emptyResponse, noError)
+							issues.
+								On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+									mock.MatchedBy(commentMentioning(arbitraryIssueAuthor))).
+								Return(emptyResult, emptyResponse, noError)
+						})
+
+						It("acts on the command", func() {
+							handle()
+							Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+							Expect(responseRecorder.Body.String()).To(ContainSubstring("not a collaborator"))
+						})
+					})
+
+					Context("from someone other than the PR's author on a PR by a non-collaborator", func() {
+						requestJSON.Is(func() string {
+							return withCommenter(IssueCommentEvent("!merge", arbitraryIssueAuthor), "reviewer")
+						})
+
+						It("addresses the refusal to the commenter", func() {
+							repositories.
+								On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+								Return(false, emptyResponse, noError)
+							issues.
+								On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+									mock.MatchedBy(commentContaining("I'm sorry, @reviewer. I'm afraid I can't do that."))).
+								Return(emptyResult, emptyResponse, noError)
+
+							handle()
+
+							Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+							issues.AssertExpectations(GinkgoT())
+						})
+					})
+
+					Context("from an outside collaborator", func() {
+						requestJSON.Is(func() string {
+							return withCommenterAssociation(IssueCommentEvent("!merge", arbitraryIssueAuthor),
+								"CONTRIBUTOR")
+						})
+
+						It("refuses the command without checking the PR's author", func() {
+							issues.
+								On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+									mock.MatchedBy(commentContaining("Only collaborators"))).
+								Return(emptyResult, emptyResponse, noError)
+
+							handle()
+
+							Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+							Expect(responseRecorder.Body.String()).To(ContainSubstring("outside collaborator"))
+							repositories.AssertNotCalled(GinkgoT(), "IsCollaborator", anyContext, repositoryOwner,
+								repositoryName, arbitraryIssueAuthor)
+						})
+
+						Context("with a customized refusal message", func() {
+							BeforeEach(func() {
+								templates, err := grh.ParseMessageTemplates(map[string]string{
+									"outside_collaborator": "Sorry @{{.Commenter}}, see " +
+										"https://wiki.example.com/bot for {{.Repository.Owner}}/{{.Repository.Name}}#{{.PR}}.",
+								})
+								Expect(err).NotTo(HaveOccurred())
+								context.Config.MessageTemplates = templates
+							})
+
+							It("refuses the command with the configured message", func() {
+								issues.
+									On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+										mock.MatchedBy(commentContaining(fmt.Sprintf("Sorry @%s, see "+
+											"https://wiki.example.com/bot for %s/%s#%d.", arbitraryIssueAuthor,
+											repositoryOwner, repositoryName, issueNumber)))).
+									Return(emptyResult, emptyResponse, noError)
+
+								handle()
+
+								Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+							})
+						})
+
+						Context("with a comment template", func() {
+							BeforeEach(func() {
+								templates, err := grh.ParseMessageTemplates(map[string]string{
+									"comment": "{{.Details.Message}}\n\nSee https://wiki.example.com/bot",
+								})
+								Expect(err).NotTo(HaveOccurred())
+								context.Config.MessageTemplates = templates
+							})
+
+							It("wraps the refusal in the template", func() {
+								issues.
+									On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+										mock.MatchedBy(commentContaining("Only collaborators can ask me to do that."+
+											"\n\nSee https://wiki.example.com/bot"))).
+									Return(emptyResult, emptyResponse, noError)
+
+								handle()
+
+								Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+								issues.AssertExpectations(GinkgoT())
+							})
+						})
+					})
+				})
+
+				Context("with a command allowed for outside collaborators", func() {
+					requestJSON.Is(func() string {
+						return withCommenterAssociation(IssueCommentEvent("!whose-turn", arbitraryIssueAuthor),
+							"NONE")
+					})
+
+					BeforeEach(func() {
+						context.Config.OutsideCollaboratorCommands = []string{"!status", "!whose-turn"}
+					})
+
+					It("acts on the command without checking the PR's author", func() {
+						issues.
+							On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+								mock.MatchedBy(commentContaining("I don't know of anyone"))).
+							Return(emptyResult, emptyResponse, noError)
+
+						handle()
+
+						Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+						repositories.AssertNotCalled(GinkgoT(), "IsCollaborator", anyContext, repositoryOwner,
+							repositoryName, arbitraryIssueAuthor)
+					})
+				})
 			})
 		})
 	})
 })
+
+func withCommenterAssociation(issueCommentEvent, association string) string {
+	return strings.Replace(issueCommentEvent, `"comment": {`,
+		`"comment": {"author_association": "`+association+`",`, 1)
+}
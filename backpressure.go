@@ -0,0 +1,66 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// overloadedWebhooks counts the webhooks refused for exceeding
+// MAX_SCHEDULED_OPERATIONS. Reported by /debug/vars.
+var overloadedWebhooks = expvar.NewInt("overloaded_webhooks")
+
+func init() {
+	// The depth of the queue of asynchronous operations, so that it could be
+	// monitored along with the other metrics
+	expvar.Publish("scheduled_operations", expvar.Func(func() interface{} {
+		return atomic.LoadInt64(&scheduledOperations)
+	}))
+}
+
+// overloadedResponse refuses a webhook while too many asynchronous operations
+// are scheduled, telling the sender when to try again.
+type overloadedResponse struct {
+	ScheduledOperations int64
+	RetryAfter          time.Duration
+}
+
+func (r overloadedResponse) WriteResponse(w http.ResponseWriter) {
+	seconds := int((r.RetryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, r.message(), http.StatusServiceUnavailable)
+}
+
+func (r overloadedResponse) logResponse() {
+	log.Printf("Overloaded: %s\n", r.message())
+}
+
+func (r overloadedResponse) message() string {
+	return fmt.Sprintf("%d asynchronous operations are already scheduled. Try again later.",
+		r.ScheduledOperations)
+}
+
+// checkBackpressure refuses new work once MAX_SCHEDULED_OPERATIONS
+// asynchronous operations are scheduled, instead of letting the queue grow
+// without bounds. Returns nil, if the webhook can be handled.
+func checkBackpressure(conf Config) Response {
+	if conf.MaxScheduledOperations == 0 {
+		return nil
+	}
+	scheduled := atomic.LoadInt64(&scheduledOperations)
+	if scheduled < int64(conf.MaxScheduledOperations) {
+		return nil
+	}
+	overloadedWebhooks.Add(1)
+	return overloadedResponse{
+		ScheduledOperations: scheduled,
+		RetryAfter:          conf.OverloadRetryAfter,
+	}
+}
@@ -0,0 +1,96 @@
+package main_test
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("backpressure", func() {
+	const (
+		secret  = "a-secret"
+		mockSHA = "c9b5e1096a18765a14f6fb295c585efd40487a24"
+	)
+
+	var (
+		handler          grh.Handler
+		search           *mocks.Search
+		asyncOperationWg *sync.WaitGroup
+		release          chan time.Time
+	)
+
+	BeforeEach(func() {
+		search = new(mocks.Search)
+		asyncOperationWg = &sync.WaitGroup{}
+		release = make(chan time.Time)
+
+		conf := grh.Config{
+			Secrets: []string{secret},
+			// Makes even the first try asynchronous
+			GithubAPITryDeltas:     []time.Duration{time.Millisecond},
+			MaxScheduledOperations: 1,
+			OverloadRetryAfter:     90 * time.Second,
+		}
+		errorReporter, err := grh.NewErrorReporter(grh.Config{})
+		Expect(err).NotTo(HaveOccurred())
+		auditLog, err := grh.NewAuditLog(grh.Config{})
+		Expect(err).NotTo(HaveOccurred())
+		handler = grh.CreateHandler(conf, new(mocks.Repos), grh.NewMemoryStore(), grh.NewScheduler(0, nil),
+			errorReporter, auditLog, asyncOperationWg, new(mocks.PullRequests), new(mocks.Repositories),
+			new(mocks.Issues), search, new(mocks.GraphQL))
+
+		searchQuery := fmt.Sprintf("%s label:\"%s\" -label:\"%s\" is:open repo:%s/%s status:success",
+			mockSHA, grh.MergingLabel, grh.OnHoldLabel, repositoryOwner, repositoryName)
+		search.
+			On("Issues", anyContext, searchQuery, mock.Anything).
+			WaitUntil(release).
+			Return(&github.IssuesSearchResult{Total: github.Int(0), Issues: []github.Issue{}}, &github.Response{},
+				noError)
+	})
+
+	AfterEach(func() {
+		asyncOperationWg.Wait()
+		search.AssertExpectations(GinkgoT())
+	})
+
+	handle := func() *httptest.ResponseRecorder {
+		body := []byte(createStatusEvent(mockSHA, "success", []grh.Branch{}))
+		request, err := http.NewRequest("POST", "/", bytes.NewBuffer(body))
+		Expect(err).NotTo(HaveOccurred())
+		mac := hmac.New(sha1.New, []byte(secret))
+		mac.Write(body)
+		request.Header.Set("X-Hub-Signature", "sha1="+hex.EncodeToString(mac.Sum(nil)))
+		request.Header.Set("X-Github-Event", "status")
+		request.Header.Set("Content-Type", "application/json")
+
+		responseRecorder := httptest.NewRecorder()
+		handler.ServeHTTP(responseRecorder, request)
+		return responseRecorder
+	}
+
+	It("refuses webhooks while the scheduled operations are at the limit", func() {
+		Expect(handle().Code).To(Equal(http.StatusOK))
+
+		responseRecorder := handle()
+		Expect(responseRecorder.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(responseRecorder.Header().Get("Retry-After")).To(Equal("90"))
+
+		close(release)
+		asyncOperationWg.Wait()
+		Expect(handle().Code).To(Equal(http.StatusOK))
+	})
+})
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// isMergeBaseBranchAllowed reports whether the bot may merge PRs into the
+// base branch. All branches are allowed, if MERGE_BASE_BRANCHES is empty.
+func isMergeBaseBranchAllowed(conf Config, base string) bool {
+	if len(conf.MergeBaseBranches) == 0 {
+		return true
+	}
+	for _, pattern := range conf.MergeBaseBranches {
+		if matched, _ := path.Match(pattern, base); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// checkMergeBaseBranch refuses the merge command with an explanation, if the
+// PR's base branch isn't one the bot is allowed to merge into. Returns nil, if
+// the merge can go ahead.
+func checkMergeBaseBranch(conf Config, issueComment IssueComment, issues Issues,
+	pullRequests PullRequests) Response {
+
+	if len(conf.MergeBaseBranches) == 0 {
+		return nil
+	}
+	issue := issueComment.Issue()
+	pr, errResp := getPR(issue, pullRequests)
+	if errResp != nil {
+		return errResp
+	} else if isMergeBaseBranchAllowed(conf, *pr.Base.Ref) {
+		return nil
+	}
+	log.Printf("Not merging PR %s, because its base branch %s isn't allowed.\n", issue.FullName(), *pr.Base.Ref)
+	message := fmt.Sprintf("@%s, I can't merge PRs into `%s`. I only merge PRs into `%s`.",
+		issueComment.Commenter.Login, *pr.Base.Ref, strings.Join(conf.MergeBaseBranches, "`, `"))
+	if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+		errorMessage := fmt.Sprintf("Failed to report the disallowed base branch of PR %s", issue.FullName())
+		return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	return SuccessResponse{fmt.Sprintf("Not merging PR %s into the disallowed base branch %s",
+		issue.FullName(), *pr.Base.Ref)}
+}
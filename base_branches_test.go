@@ -0,0 +1,95 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("!merge comment with allowed base branches", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			issues           *mocks.Issues
+
+			commenter = "procoder"
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			issues = *context.Issues
+			context.Config.MergeBaseBranches = []string{"main", "release/*"}
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!merge", commenter)
+		})
+
+		mockBase := func(base string) {
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+				Return(&github.PullRequest{
+					Merged:    github.Bool(false),
+					Mergeable: github.Bool(false),
+					Base:      &github.PullRequestBranch{Ref: github.String(base)},
+				}, emptyResponse, noError)
+		}
+
+		ForCollaborator(context, repositoryOwner, repositoryName, commenter, func() {
+			Context("with the PR against another branch", func() {
+				BeforeEach(func() {
+					mockBase("feature/x")
+				})
+
+				It("refuses to merge it and explains why", func() {
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("@"+commenter+", I can't merge PRs into `feature/x`. "+
+								"I only merge PRs into `main`, `release/*`."))).
+						Return(emptyResult, emptyResponse, noError).
+						Once()
+
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertNotCalled(GinkgoT(), "AddLabelsToIssue", anyContext, repositoryOwner,
+						repositoryName, issueNumber, []string{grh.MergingLabel})
+				})
+			})
+
+			Context("with the PR against a matching branch", func() {
+				BeforeEach(func() {
+					mockBase("release/1.2")
+					issues.
+						On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+							[]string{grh.MergingLabel}).
+						Return(emptyResult, emptyResponse, noError)
+				})
+
+				It("queues the PR", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertCalled(GinkgoT(), "AddLabelsToIssue", anyContext, repositoryOwner,
+						repositoryName, issueNumber, []string{grh.MergingLabel})
+				})
+			})
+		})
+	})
+})
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/salemove/github-review-helper/evaluator"
+	"github.com/salemove/github-review-helper/git"
+)
+
+func isBlockCommand(comment string) bool {
+	comment = strings.TrimSpace(comment)
+	return comment == "!block" || strings.HasPrefix(comment, "!block ")
+}
+
+func isUnblockCommand(comment string) bool {
+	comment = strings.TrimSpace(comment)
+	return comment == "!unblock" || strings.HasPrefix(comment, "!unblock ")
+}
+
+// parseBlockReason returns the reason of a "!block <reason>" command from the
+// first line of the comment.
+func parseBlockReason(comment string) string {
+	firstLine := strings.SplitN(strings.TrimSpace(comment), "\n", 2)[0]
+	return strings.Join(strings.Fields(strings.TrimPrefix(firstLine, "!block")), " ")
+}
+
+// parseUnblockTarget returns the login of the user whose block a
+// "!unblock [@user]" command lifts or an empty string, if no user was given.
+func parseUnblockTarget(comment string) string {
+	firstLine := strings.SplitN(strings.TrimSpace(comment), "\n", 2)[0]
+	return strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(firstLine, "!unblock")), "@")
+}
+
+// handleBlockCommand records the commenter's block of the PR, which keeps it
+// from being merged until the commenter or an admin lifts it with "!unblock".
+// Blocking the PR again replaces the reason.
+func handleBlockCommand(issueComment IssueComment, store Store, issues Issues) Response {
+	issue := issueComment.Issue()
+	reason := parseBlockReason(issueComment.Comment)
+	if reason == "" {
+		message := fmt.Sprintf("@%s, please say why you're blocking the PR, e.g. `!block the migration needs a "+
+			"rollback plan`, so that its author would know what to address.", issueComment.Commenter.Login)
+		if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+			errorMessage := fmt.Sprintf("Failed to ask for the reason of the block on PR %s", issue.FullName())
+			return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+		}
+		return SuccessResponse{"Block without a reason. Responded with a comment."}
+	}
+	err := store.AddBlock(Block{
+		Issue:     issue,
+		User:      issueComment.Commenter.Login,
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		errorMessage := fmt.Sprintf("Failed to record the block of PR %s", issue.FullName())
+		return ErrorResponse{err, http.StatusInternalServerError, errorMessage}
+	}
+	return SuccessResponse{fmt.Sprintf("%s blocked PR %s", issueComment.Commenter.Login, issue.FullName())}
+}
+
+// handleUnblockCommand lifts the commenter's block of the PR or, with
+// "!unblock @user", the user's block, which only the user and admins can do.
+// Like with "!unhold", a PR that's labeled for merging is merged right away,
+// if the block was the last thing keeping it from being ready.
+func handleUnblockCommand(conf Config, issueComment IssueComment, store Store, issues Issues,
+	pullRequests PullRequests, repositories Repositories, graphQL GraphQL, gitRepos git.Repos) Response {
+
+	issue := issueComment.Issue()
+	commenter := issueComment.Commenter.Login
+	user := parseUnblockTarget(issueComment.Comment)
+	if user == "" {
+		user = commenter
+	}
+	var message string
+	if !strings.EqualFold(user, commenter) {
+		role, err := collaboratorRole(issue.Repository, commenter, graphQL)
+		if err != nil {
+			errorMessage := fmt.Sprintf("Failed to check if %s can lift the blocks of PR %s", commenter,
+				issue.FullName())
+			return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+		} else if roleRank(role) < roleRank("admin") {
+			message = fmt.Sprintf("@%s, only @%s and admins can lift @%s's block.", commenter, user, user)
+		}
+	}
+	if message == "" {
+		block, errResp := findBlock(issue, user, store)
+		if errResp != nil {
+			return errResp
+		} else if block == nil && strings.EqualFold(user, commenter) {
+			message = fmt.Sprintf("@%s, you haven't blocked this PR.", commenter)
+		} else if block == nil {
+			message = fmt.Sprintf("@%s, @%s hasn't blocked this PR.", commenter, user)
+		} else if err := store.RemoveBlock(issue, block.User); err != nil {
+			errorMessage := fmt.Sprintf("Failed to lift %s's block of PR %s", block.User, issue.FullName())
+			return ErrorResponse{err, http.StatusInternalServerError, errorMessage}
+		}
+	}
+	if message != "" {
+		if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+			errorMessage := fmt.Sprintf("Failed to refuse lifting the block of PR %s", issue.FullName())
+			return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+		}
+		return SuccessResponse{"Couldn't lift the block. Responded with a comment."}
+	} else if !issueComment.HasLabel(MergingLabel) {
+		return SuccessResponse{fmt.Sprintf("Lifted %s's block of PR %s", user, issue.FullName())}
+	}
+	return mergeIfReady(conf, issue, true, store, issues, pullRequests, repositories, graphQL, gitRepos)
+}
+
+func findBlock(issue Issue, user string, store Store) (*Block, *ErrorResponse) {
+	blocks, err := store.Blocks(issue)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Failed to get the blocks of PR %s", issue.FullName())
+		return nil, &ErrorResponse{err, http.StatusInternalServerError, errorMessage}
+	}
+	for _, block := range blocks {
+		if strings.EqualFold(block.User, user) {
+			return &block, nil
+		}
+	}
+	return nil, nil
+}
+
+// checkBlocks fails the PR while anyone's block of it hasn't been lifted.
+func checkBlocks(issue Issue, store Store) (evaluator.Result, *ErrorResponse) {
+	blocks, err := store.Blocks(issue)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Failed to get the blocks of PR %s", issue.FullName())
+		return evaluator.Result{}, &ErrorResponse{err, http.StatusInternalServerError, errorMessage}
+	} else if len(blocks) == 0 {
+		return passed(), nil
+	}
+	var blockers, evidence []string
+	for _, block := range blocks {
+		blockers = append(blockers, fmt.Sprintf("@%s (%s)", block.User, block.Reason))
+		evidence = append(evidence, fmt.Sprintf("blocked by @%s at %s", block.User,
+			block.CreatedAt.UTC().Format(time.RFC3339)))
+	}
+	return failed("it's blocked by "+strings.Join(blockers, " and "), evidence...), nil
+}
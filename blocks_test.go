@@ -0,0 +1,233 @@
+package main_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	var (
+		handle      = context.Handle
+		headers     = context.Headers
+		requestJSON = context.RequestJSON
+
+		responseRecorder *httptest.ResponseRecorder
+		pullRequests     *mocks.PullRequests
+		repositories     *mocks.Repositories
+		issues           *mocks.Issues
+		graphQL          *mocks.GraphQL
+		store            grh.Store
+	)
+	BeforeEach(func() {
+		responseRecorder = *context.ResponseRecorder
+		pullRequests = *context.PullRequests
+		repositories = *context.Repositories
+		issues = *context.Issues
+		graphQL = *context.GraphQL
+		store = *context.Store
+
+		repositories.
+			On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+			Return(true, emptyResponse, noError)
+	})
+
+	headers.Is(func() map[string]string {
+		return map[string]string{
+			"X-Github-Event": "issue_comment",
+		}
+	})
+
+	issue := grh.Issue{
+		Number: issueNumber,
+		Repository: grh.Repository{
+			Owner: repositoryOwner,
+			Name:  repositoryName,
+			URL:   sshURL,
+		},
+	}
+
+	block := func(user, reason string) {
+		err := store.AddBlock(grh.Block{Issue: issue, User: user, Reason: reason, CreatedAt: time.Now()})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	blockers := func() []string {
+		blocks, err := store.Blocks(issue)
+		Expect(err).NotTo(HaveOccurred())
+		users := []string{}
+		for _, block := range blocks {
+			users = append(users, block.User)
+		}
+		return users
+	}
+
+	expectComment := func(text string) {
+		issues.
+			On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+				mock.MatchedBy(commentContaining(text))).
+			Return(emptyResult, emptyResponse, noError)
+	}
+
+	Describe("!block comment", func() {
+		Context("with a reason", func() {
+			requestJSON.Is(func() string {
+				return IssueCommentEvent("!block the migration needs a rollback plan", arbitraryIssueAuthor)
+			})
+
+			It("records the commenter's block", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				blocks, err := store.Blocks(issue)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(blocks).To(HaveLen(1))
+				Expect(blocks[0].User).To(Equal(arbitraryIssueAuthor))
+				Expect(blocks[0].Reason).To(Equal("the migration needs a rollback plan"))
+			})
+		})
+
+		Context("without a reason", func() {
+			requestJSON.Is(func() string {
+				return IssueCommentEvent("!block", arbitraryIssueAuthor)
+			})
+
+			It("asks for the reason", func() {
+				expectComment("please say why you're blocking the PR")
+
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+				Expect(blockers()).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("!unblock comment", func() {
+		BeforeEach(func() {
+			block(arbitraryIssueAuthor, "needs tests")
+			block("alice", "breaks the API")
+		})
+
+		Context("lifting the commenter's own block", func() {
+			requestJSON.Is(func() string {
+				return IssueCommentEvent("!unblock", arbitraryIssueAuthor)
+			})
+
+			It("removes only the commenter's block", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(blockers()).To(Equal([]string{"alice"}))
+			})
+		})
+
+		Context("lifting another user's block", func() {
+			requestJSON.Is(func() string {
+				return IssueCommentEvent("!unblock @alice", arbitraryIssueAuthor)
+			})
+
+			mockRole := func(permission string) {
+				data, err := json.Marshal(map[string]interface{}{
+					"repository": map[string]interface{}{
+						"collaborators": map[string]interface{}{
+							"edges": []interface{}{
+								map[string]interface{}{
+									"permission": permission,
+									"node":       map[string]string{"login": arbitraryIssueAuthor},
+								},
+							},
+						},
+					},
+				})
+				Expect(err).NotTo(HaveOccurred())
+				graphQL.
+					On("Query", anyContext, mock.AnythingOfType("string"), mock.Anything, mock.Anything).
+					Return(noError).
+					Run(func(args mock.Arguments) {
+						Expect(json.Unmarshal(data, args.Get(3))).To(Succeed())
+					})
+			}
+
+			Context("as an admin", func() {
+				BeforeEach(func() {
+					mockRole("ADMIN")
+				})
+
+				It("removes the user's block", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					Expect(blockers()).To(Equal([]string{arbitraryIssueAuthor}))
+				})
+			})
+
+			Context("as a maintainer", func() {
+				BeforeEach(func() {
+					mockRole("MAINTAIN")
+				})
+
+				It("refuses to lift the block", func() {
+					expectComment("only @alice and admins can lift @alice's block.")
+
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertExpectations(GinkgoT())
+					Expect(blockers()).To(ConsistOf(arbitraryIssueAuthor, "alice"))
+				})
+			})
+		})
+	})
+
+	Describe("!status comment on a blocked PR", func() {
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!status", arbitraryIssueAuthor)
+		})
+
+		headSHA := "1235"
+		pr := &github.PullRequest{
+			Number:    github.Int(issueNumber),
+			Merged:    github.Bool(false),
+			Mergeable: github.Bool(true),
+			Base: &github.PullRequestBranch{
+				SHA:  github.String("1234"),
+				Ref:  github.String("master"),
+				Repo: repository,
+			},
+			Head: &github.PullRequestBranch{
+				SHA:  github.String(headSHA),
+				Ref:  github.String("feature"),
+				Repo: repository,
+			},
+			User: &github.User{
+				Login: github.String(arbitraryIssueAuthor),
+			},
+		}
+
+		BeforeEach(func() {
+			block("alice", "breaks the API")
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+				Return(pr, emptyResponse, noError)
+			repositories.
+				On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+					mock.AnythingOfType("*github.ListOptions")).
+				Return(&github.CombinedStatus{State: github.String("success")}, emptyResponse, noError)
+			mockLabels(issues, issueNumber)
+		})
+
+		It("shows who blocked the PR and why", func() {
+			expectComment(":x: **blocks**: it's blocked by @alice (breaks the API)")
+
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			issues.AssertExpectations(GinkgoT())
+		})
+	})
+})
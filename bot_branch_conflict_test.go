@@ -0,0 +1,175 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/git"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("!merge comment on a conflicting bot-created PR", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+			gitRepos         *mocks.Repos
+			gitRepo          *mocks.Repo
+
+			issueAuthor    = "procoder"
+			sourcePRAuthor = "original-author"
+			sourcePRNumber = 5
+			mergeCommitSHA = "abcd"
+			branchName     = "bot/backport/5-release"
+			headSHA        = "1235"
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+			gitRepos = *context.GitRepos
+			store := *context.Store
+
+			Expect(store.AddBotBranch(grh.BotBranch{
+				Repository: grh.Repository{
+					Owner: repositoryOwner,
+					Name:  repositoryName,
+					URL:   sshURL,
+				},
+				Name:        branchName,
+				Kind:        "backport",
+				SourcePR:    sourcePRNumber,
+				Target:      "release",
+				PullRequest: issueNumber,
+				CreatedAt:   time.Now(),
+			})).To(Succeed())
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!merge", issueAuthor)
+		})
+
+		ForCollaborator(context, repositoryOwner, repositoryName, issueAuthor, func() {
+			BeforeEach(func() {
+				issues.
+					On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+						[]string{grh.MergingLabel}).
+					Return(emptyResult, emptyResponse, noError)
+				pullRequests.
+					On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+					Return(&github.PullRequest{
+						Number:    github.Int(issueNumber),
+						Merged:    github.Bool(false),
+						Mergeable: github.Bool(true),
+						Base: &github.PullRequestBranch{
+							SHA:  github.String("1234"),
+							Ref:  github.String("release"),
+							Repo: repository,
+						},
+						Head: &github.PullRequestBranch{
+							SHA:  github.String(headSHA),
+							Ref:  github.String(branchName),
+							Repo: repository,
+						},
+						User: &github.User{
+							Login: github.String(issueAuthor),
+						},
+					}, emptyResponse, noError)
+				pullRequests.
+					On("Get", anyContext, repositoryOwner, repositoryName, sourcePRNumber).
+					Return(&github.PullRequest{
+						Number:         github.Int(sourcePRNumber),
+						Merged:         github.Bool(true),
+						MergeCommitSHA: github.String(mergeCommitSHA),
+						User: &github.User{
+							Login: github.String(sourcePRAuthor),
+						},
+					}, emptyResponse, noError)
+				repositories.
+					On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+						mock.AnythingOfType("*github.ListOptions")).
+					Return(&github.CombinedStatus{
+						State: github.String("success"),
+					}, emptyResponse, noError)
+				mockLabels(issues, issueNumber, grh.MergingLabel)
+
+				resp := &http.Response{StatusCode: http.StatusConflict}
+				pullRequests.
+					On("Merge", anyContext, repositoryOwner, repositoryName, issueNumber, "", noSquashOpts).
+					Return(emptyResult, &github.Response{Response: resp}, &github.ErrorResponse{
+						Response: resp,
+						Message:  "Merge conflict",
+					})
+
+				gitRepo = new(mocks.Repo)
+				gitRepos.
+					On("GetUpdatedRepo", sshURL, repositoryOwner, repositoryName).
+					Return(gitRepo, noError)
+			})
+
+			Context("with the change applying cleanly onto the latest target", func() {
+				BeforeEach(func() {
+					gitRepo.
+						On("CherryPickAndPush", "origin/release", mergeCommitSHA, "origin", branchName).
+						Return(noError)
+				})
+
+				It("rebuilds the branch and keeps the PR labeled for merging", func() {
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("recreated it from scratch"))).
+						Return(emptyResult, emptyResponse, noError)
+
+					handle()
+
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					gitRepo.AssertExpectations(GinkgoT())
+					issues.AssertNotCalled(GinkgoT(), "RemoveLabelForIssue", anyContext, repositoryOwner,
+						repositoryName, issueNumber, grh.MergingLabel)
+				})
+			})
+
+			Context("with the change conflicting with the latest target as well", func() {
+				BeforeEach(func() {
+					gitRepo.
+						On("CherryPickAndPush", "origin/release", mergeCommitSHA, "origin", branchName).
+						Return(&git.ErrCherryPickConflict{Err: errArbitrary})
+				})
+
+				It("asks the author of the backported PR for help", func() {
+					issues.
+						On("RemoveLabelForIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+							grh.MergingLabel).
+						Return(emptyResponse, noError)
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentMentioning(sourcePRAuthor))).
+						Return(emptyResult, emptyResponse, noError)
+
+					handle()
+
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				})
+			})
+		})
+	})
+})
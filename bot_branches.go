@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/git"
+)
+
+const (
+	backportBranchKind   = "backport"
+	revertBranchKind     = "revert"
+	cherryPickBranchKind = "cherry-pick"
+	splitBranchKind      = "split"
+)
+
+var invalidBranchCharacters = regexp.MustCompile(`[^A-Za-z0-9._/-]+`)
+
+// botBranchName fills in the {kind}, {pr} and {target} placeholders of the
+// configured branch name template.
+func botBranchName(template, kind string, prNumber int, target string) string {
+	name := strings.NewReplacer(
+		"{kind}", kind,
+		"{pr}", strconv.Itoa(prNumber),
+		"{target}", target,
+	).Replace(template)
+	return invalidBranchCharacters.ReplaceAllString(name, "-")
+}
+
+// createBotBranchName generates a name for a branch the bot is about to
+// create and starts tracking the branch, so that it could be cleaned up once
+// it's no longer needed.
+func createBotBranchName(conf Config, store Store, repository Repository, kind string, prNumber int,
+	target string) (string, error) {
+
+	name := botBranchName(conf.BotBranchTemplate, kind, prNumber, target)
+	err := store.AddBotBranch(BotBranch{
+		Repository: repository,
+		Name:       name,
+		Kind:       kind,
+		SourcePR:   prNumber,
+		Target:     target,
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to track bot branch %s: %v", name, err)
+	}
+	log.Printf("Tracking %s branch %s for %s#%d.\n", kind, name, repositoryKey(repository), prNumber)
+	return name, nil
+}
+
+// trackBotBranchPR records the PR that was opened from a bot-created branch.
+// The branch can be removed once that PR is closed.
+func trackBotBranchPR(store Store, repository Repository, name string, prNumber int) error {
+	branches, err := store.BotBranches(repository)
+	if err != nil {
+		return err
+	}
+	for _, branch := range branches {
+		if branch.Name == name {
+			branch.PullRequest = prNumber
+			return store.AddBotBranch(branch)
+		}
+	}
+	return fmt.Errorf("branch %s is not a tracked bot branch", name)
+}
+
+// rebuildBotBranch recreates the branch of a backport, cherry-pick or revert
+// PR the bot has opened from scratch on top of the latest target, force
+// pushing over the bot's own branch. It returns the PR the branch was created
+// for, or nil if the PR isn't from such a branch, and whether the branch was
+// rebuilt. The branch isn't rebuilt, if the change conflicts with the latest
+// target as well.
+func rebuildBotBranch(pr *github.PullRequest, gitRepos git.Repos, store Store,
+	pullRequests PullRequests) (*github.PullRequest, bool, error) {
+
+	issue := prIssue(pr)
+	branches, err := store.BotBranches(issue.Repository)
+	if err != nil {
+		return nil, false, err
+	}
+	var branch *BotBranch
+	for i := range branches {
+		if branches[i].PullRequest == issue.Number && branches[i].Name == *pr.Head.Ref {
+			branch = &branches[i]
+		}
+	}
+	if branch == nil || isAcrossForks(pr) || (branch.Kind != backportBranchKind && branch.Kind != cherryPickBranchKind &&
+		branch.Kind != revertBranchKind) {
+		return nil, false, nil
+	}
+
+	sourcePR, errResp := getPR(Issue{Number: branch.SourcePR, Repository: issue.Repository}, pullRequests)
+	if errResp != nil {
+		return nil, false, errResp.Error
+	} else if sourcePR.Merged == nil || !*sourcePR.Merged || sourcePR.MergeCommitSHA == nil {
+		return nil, false, fmt.Errorf("PR #%d that %s was created for hasn't been merged", branch.SourcePR,
+			branch.Name)
+	}
+	gitRepo, err := gitRepos.GetUpdatedRepo(issue.Repository.URL, issue.Repository.Owner, issue.Repository.Name)
+	if err != nil {
+		return sourcePR, false, err
+	}
+	log.Printf("Rebuilding %s branch %s of PR %s on top of the latest %s.\n", branch.Kind, branch.Name,
+		issue.FullName(), *pr.Base.Ref)
+	if branch.Kind == revertBranchKind {
+		err = gitRepo.RevertAndPush("origin/"+*pr.Base.Ref, *sourcePR.MergeCommitSHA, "origin", branch.Name)
+	} else {
+		err = gitRepo.CherryPickAndPush("origin/"+*pr.Base.Ref, *sourcePR.MergeCommitSHA, "origin", branch.Name)
+	}
+	if _, ok := err.(*git.ErrCherryPickConflict); ok {
+		log.Printf("Rebuilding branch %s of PR %s failed: %v\n", branch.Name, issue.FullName(), err)
+		return sourcePR, false, nil
+	} else if err != nil {
+		return sourcePR, false, err
+	}
+	return sourcePR, true, nil
+}
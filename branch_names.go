@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+const githubStatusBranchNameContext = "review/branch-name"
+
+// The values of HEAD_BRANCH_POLICY
+const (
+	HeadBranchPolicyWarn  = "warn"
+	HeadBranchPolicyBlock = "block"
+)
+
+func validateHeadBranchPolicy(policy string) error {
+	if policy != HeadBranchPolicyWarn && policy != HeadBranchPolicyBlock {
+		return fmt.Errorf("must be either \"%s\" or \"%s\", got \"%s\"", HeadBranchPolicyWarn,
+			HeadBranchPolicyBlock, policy)
+	}
+	return nil
+}
+
+// isHeadBranchNameAllowed reports whether the PR's head branch is named
+// according to HEAD_BRANCH_PATTERNS. All names are allowed, if the patterns
+// are empty.
+func isHeadBranchNameAllowed(conf Config, head string) bool {
+	if len(conf.HeadBranchPatterns) == 0 {
+		return true
+	}
+	for _, pattern := range conf.HeadBranchPatterns {
+		if matched, _ := path.Match(pattern, head); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// checkHeadBranchName enforces the branch naming policy on an opened or
+// synchronized PR. With the "warn" policy, the author is asked to follow the
+// naming convention in a comment when the PR is opened. With the "block"
+// policy, the PR's head commit gets a review/branch-name status that fails
+// until the PR is opened from a branch with a compliant name. The PRs the bot
+// opens itself are exempt.
+func checkHeadBranchName(conf Config, pullRequestEvent PullRequestEvent, issues Issues,
+	repositories Repositories) *ErrorResponse {
+
+	if len(conf.HeadBranchPatterns) == 0 {
+		return nil
+	}
+	allowed := isHeadBranchNameAllowed(conf, pullRequestEvent.Head.Ref) ||
+		isBotLogin(conf, pullRequestEvent.User.Login)
+	if conf.HeadBranchPolicy == HeadBranchPolicyBlock {
+		status := createBranchNameStatus("success", "The branch name follows the naming convention")
+		if !allowed {
+			status = createBranchNameStatus("failure", "Rename the branch to follow the naming convention")
+		}
+		return setStatusForPREvent(pullRequestEvent, status, repositories)
+	} else if allowed || pullRequestEvent.Action != "opened" {
+		return nil
+	}
+	issue := pullRequestEvent.Issue()
+	log.Printf("The head branch %s of PR %s doesn't follow the naming convention.\n", pullRequestEvent.Head.Ref,
+		issue.FullName())
+	message := fmt.Sprintf("@%s, the name of this PR's branch `%s` doesn't follow the naming convention. Branches "+
+		"should match %s.", pullRequestEvent.User.Login, pullRequestEvent.Head.Ref,
+		formatBranchPatterns(conf.HeadBranchPatterns))
+	if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+		errorMessage := fmt.Sprintf("Failed to report the branch name of PR %s", issue.FullName())
+		return &ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	return nil
+}
+
+func createBranchNameStatus(state, description string) *github.RepoStatus {
+	return &github.RepoStatus{
+		State:       github.String(state),
+		Description: github.String(description),
+		Context:     github.String(githubStatusBranchNameContext),
+	}
+}
+
+func formatBranchPatterns(patterns []string) string {
+	return "`" + strings.Join(patterns, "`, `") + "`"
+}
@@ -0,0 +1,158 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("branch naming policy", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+
+			headSHA = "1235"
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+
+			context.Config.HeadBranchPatterns = []string{"feature/*", "fix/*"}
+
+			pullRequests.
+				On("ListCommits", anyContext, repositoryOwner, repositoryName, issueNumber,
+					mock.AnythingOfType("*github.ListOptions")).
+				Return(githubCommits(commit{headSHA, "Changing things"}), emptyResponse, noError)
+			repositories.
+				On("CreateStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+					mock.MatchedBy(func(status *github.RepoStatus) bool {
+						return status.GetContext() == "review/squash"
+					})).
+				Return(emptyResult, emptyResponse, noError)
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "pull_request",
+			}
+		})
+		// The head branch of the event is named "feature"
+		requestJSON.Is(func() string {
+			return PullRequestEvent("opened", headSHA, grh.Repository{
+				Owner: repositoryOwner,
+				Name:  repositoryName,
+				URL:   sshURL,
+			})
+		})
+
+		branchNameStatus := func(state string) interface{} {
+			return mock.MatchedBy(func(status *github.RepoStatus) bool {
+				return status.GetContext() == "review/branch-name" && status.GetState() == state
+			})
+		}
+
+		Context("with the warn policy", func() {
+			BeforeEach(func() {
+				context.Config.HeadBranchPolicy = grh.HeadBranchPolicyWarn
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("the name of this PR's branch `feature` doesn't follow the "+
+							"naming convention. Branches should match `feature/*`, `fix/*`."))).
+					Return(emptyResult, emptyResponse, noError).
+					Once()
+			})
+
+			It("warns about the branch name in a comment", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+			})
+
+			Context("with the PR synchronized", func() {
+				requestJSON.Is(func() string {
+					return PullRequestEvent("synchronize", headSHA, grh.Repository{
+						Owner: repositoryOwner,
+						Name:  repositoryName,
+						URL:   sshURL,
+					})
+				})
+
+				It("doesn't warn again", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertNotCalled(GinkgoT(), "CreateComment", anyContext, repositoryOwner, repositoryName,
+						issueNumber, mock.Anything)
+				})
+			})
+		})
+
+		Context("with the block policy", func() {
+			BeforeEach(func() {
+				context.Config.HeadBranchPolicy = grh.HeadBranchPolicyBlock
+			})
+
+			Context("with a non-compliant branch name", func() {
+				BeforeEach(func() {
+					repositories.
+						On("CreateStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+							branchNameStatus("failure")).
+						Return(emptyResult, emptyResponse, noError).
+						Once()
+				})
+
+				It("reports a failed status", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					repositories.AssertExpectations(GinkgoT())
+				})
+			})
+
+			Context("with a compliant branch name", func() {
+				BeforeEach(func() {
+					context.Config.HeadBranchPatterns = []string{"feature*"}
+					repositories.
+						On("CreateStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+							branchNameStatus("success")).
+						Return(emptyResult, emptyResponse, noError).
+						Once()
+				})
+
+				It("reports a successful status", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					repositories.AssertExpectations(GinkgoT())
+				})
+			})
+
+			Context("with setting the status failing", func() {
+				BeforeEach(func() {
+					repositories.
+						On("CreateStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+							branchNameStatus("failure")).
+						Return(emptyResult, emptyResponse, errArbitrary)
+				})
+
+				It("fails with a gateway error", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusBadGateway))
+				})
+			})
+		})
+	})
+})
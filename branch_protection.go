@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const branchProtectionRulesQuery = `query($owner: String!, $name: String!) {
+  repository(owner: $owner, name: $name) {
+    id
+    branchProtectionRules(first: 100) {
+      nodes {
+        id
+        pattern
+        requiresStatusChecks
+        requiredStatusCheckContexts
+        requiresStrictStatusChecks
+        requiresApprovingReviews
+        requiredApprovingReviewCount
+        requiresCodeOwnerReviews
+        dismissesStaleReviews
+        requiresLinearHistory
+      }
+    }
+  }
+}`
+
+const createBranchProtectionRuleMutation = `mutation($input: CreateBranchProtectionRuleInput!) {
+  createBranchProtectionRule(input: $input) {
+    branchProtectionRule {
+      id
+    }
+  }
+}`
+
+const updateBranchProtectionRuleMutation = `mutation($input: UpdateBranchProtectionRuleInput!) {
+  updateBranchProtectionRule(input: $input) {
+    branchProtectionRule {
+      id
+    }
+  }
+}`
+
+// BranchProtection is the protection BRANCH_PROTECTION declares for the
+// branches matching Pattern. The settings that aren't declared are turned off.
+type BranchProtection struct {
+	Pattern              string
+	RequiredStatusChecks []string
+	// StrictStatusChecks requires the branches to be up to date with the
+	// base branch before merging
+	StrictStatusChecks      bool
+	RequiredApprovals       int
+	RequireCodeOwnerReviews bool
+	DismissStaleReviews     bool
+	RequireLinearHistory    bool
+}
+
+// branchProtectionRule is GitHub's protection rule for the branches matching
+// its pattern.
+type branchProtectionRule struct {
+	ID                           string   `json:"id"`
+	Pattern                      string   `json:"pattern"`
+	RequiresStatusChecks         bool     `json:"requiresStatusChecks"`
+	RequiredStatusCheckContexts  []string `json:"requiredStatusCheckContexts"`
+	RequiresStrictStatusChecks   bool     `json:"requiresStrictStatusChecks"`
+	RequiresApprovingReviews     bool     `json:"requiresApprovingReviews"`
+	RequiredApprovingReviewCount int      `json:"requiredApprovingReviewCount"`
+	RequiresCodeOwnerReviews     bool     `json:"requiresCodeOwnerReviews"`
+	DismissesStaleReviews        bool     `json:"dismissesStaleReviews"`
+	RequiresLinearHistory        bool     `json:"requiresLinearHistory"`
+}
+
+// ParseBranchProtection parses a semicolon separated list of
+// pattern=settings entries, e.g. "main=checks:ci,lint approvals:1
+// linear-history; release/*=approvals:2". The settings are checks:<contexts>,
+// strict, approvals:<count>, code-owners, dismiss-stale and linear-history.
+func ParseBranchProtection(protectionString string) ([]BranchProtection, error) {
+	var protections []BranchProtection
+	for _, entry := range strings.Split(protectionString, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		i := strings.Index(entry, "=")
+		if i <= 0 || strings.TrimSpace(entry[:i]) == "" {
+			return nil, fmt.Errorf("expected a pattern=settings entry, got \"%s\"", strings.TrimSpace(entry))
+		}
+		protection := BranchProtection{Pattern: strings.TrimSpace(entry[:i])}
+		if _, err := path.Match(protection.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid branch pattern \"%s\"", protection.Pattern)
+		}
+		for _, setting := range strings.Fields(entry[i+1:]) {
+			name, value := setting, ""
+			if j := strings.Index(setting, ":"); j >= 0 {
+				name, value = setting[:j], setting[j+1:]
+			}
+			switch {
+			case name == "checks" && value != "":
+				protection.RequiredStatusChecks = getListFromString(value)
+			case name == "approvals" && value != "":
+				approvals, err := strconv.Atoi(value)
+				if err != nil || approvals < 0 || approvals > 6 {
+					return nil, fmt.Errorf("approvals must be between 0 and 6, got \"%s\"", value)
+				}
+				protection.RequiredApprovals = approvals
+			case setting == "strict":
+				protection.StrictStatusChecks = true
+			case setting == "code-owners":
+				protection.RequireCodeOwnerReviews = true
+			case setting == "dismiss-stale":
+				protection.DismissStaleReviews = true
+			case setting == "linear-history":
+				protection.RequireLinearHistory = true
+			default:
+				return nil, fmt.Errorf("unknown setting \"%s\" for %s", setting, protection.Pattern)
+			}
+		}
+		protections = append(protections, protection)
+	}
+	return protections, nil
+}
+
+// rule returns the GitHub rule that enforces the protection.
+func (p BranchProtection) rule() branchProtectionRule {
+	return branchProtectionRule{
+		Pattern:                      p.Pattern,
+		RequiresStatusChecks:         len(p.RequiredStatusChecks) > 0,
+		RequiredStatusCheckContexts:  p.RequiredStatusChecks,
+		RequiresStrictStatusChecks:   p.StrictStatusChecks,
+		RequiresApprovingReviews:     p.RequiredApprovals > 0 || p.RequireCodeOwnerReviews,
+		RequiredApprovingReviewCount: p.RequiredApprovals,
+		RequiresCodeOwnerReviews:     p.RequireCodeOwnerReviews,
+		DismissesStaleReviews:        p.DismissStaleReviews,
+		RequiresLinearHistory:        p.RequireLinearHistory,
+	}.normalized()
+}
+
+// normalized drops the ID and the settings that have no effect, so that
+// rules could be compared by the protection they enforce.
+func (r branchProtectionRule) normalized() branchProtectionRule {
+	r.ID = ""
+	if r.RequiresStatusChecks {
+		contexts := append([]string{}, r.RequiredStatusCheckContexts...)
+		sort.Strings(contexts)
+		r.RequiredStatusCheckContexts = contexts
+	} else {
+		r.RequiredStatusCheckContexts = nil
+		r.RequiresStrictStatusChecks = false
+	}
+	if !r.RequiresApprovingReviews {
+		r.RequiredApprovingReviewCount = 0
+		r.RequiresCodeOwnerReviews = false
+		r.DismissesStaleReviews = false
+	}
+	return r
+}
+
+// input returns the rule's settings as the input of the create and update
+// mutations.
+func (r branchProtectionRule) input() map[string]interface{} {
+	contexts := r.RequiredStatusCheckContexts
+	if contexts == nil {
+		contexts = []string{}
+	}
+	return map[string]interface{}{
+		"pattern":                      r.Pattern,
+		"requiresStatusChecks":         r.RequiresStatusChecks,
+		"requiredStatusCheckContexts":  contexts,
+		"requiresStrictStatusChecks":   r.RequiresStrictStatusChecks,
+		"requiresApprovingReviews":     r.RequiresApprovingReviews,
+		"requiredApprovingReviewCount": r.RequiredApprovingReviewCount,
+		"requiresCodeOwnerReviews":     r.RequiresCodeOwnerReviews,
+		"dismissesStaleReviews":        r.DismissesStaleReviews,
+		"requiresLinearHistory":        r.RequiresLinearHistory,
+	}
+}
+
+// syncBranchProtection creates or updates the repository's protection rules,
+// so that they'd match the declared protections, and returns the patterns of
+// the rules it changed. The rules that already match are left alone, so that
+// reconciling on the events the changes cause would end, and rules for other
+// patterns are kept.
+func syncBranchProtection(repository Repository, protections []BranchProtection, graphQL GraphQL) ([]string,
+	error) {
+
+	var result struct {
+		Repository struct {
+			ID                    string `json:"id"`
+			BranchProtectionRules struct {
+				Nodes []branchProtectionRule `json:"nodes"`
+			} `json:"branchProtectionRules"`
+		} `json:"repository"`
+	}
+	err := graphQL.Query(context.TODO(), branchProtectionRulesQuery, map[string]interface{}{
+		"owner": repository.Owner,
+		"name":  repository.Name,
+	}, &result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the branch protection rules: %v", err)
+	}
+	existing := make(map[string]branchProtectionRule)
+	for _, rule := range result.Repository.BranchProtectionRules.Nodes {
+		existing[rule.Pattern] = rule
+	}
+	changed := []string{}
+	for _, protection := range protections {
+		desired := protection.rule()
+		input := desired.input()
+		mutation := createBranchProtectionRuleMutation
+		if rule, exists := existing[protection.Pattern]; exists {
+			if reflect.DeepEqual(rule.normalized(), desired) {
+				continue
+			}
+			input["branchProtectionRuleId"] = rule.ID
+			mutation = updateBranchProtectionRuleMutation
+		} else {
+			input["repositoryId"] = result.Repository.ID
+		}
+		var mutationResult struct{}
+		err = graphQL.Query(context.TODO(), mutation, map[string]interface{}{"input": input}, &mutationResult)
+		if err != nil {
+			return changed, fmt.Errorf("failed to apply the branch protection for %s: %v", protection.Pattern, err)
+		}
+		log.Printf("Applied the branch protection for %s in %s\n", protection.Pattern, repositoryKey(repository))
+		changed = append(changed, protection.Pattern)
+	}
+	return changed, nil
+}
+
+func isProtectCommand(comment string) bool {
+	return strings.TrimSpace(comment) == "!protect"
+}
+
+// handleProtectCommand applies BRANCH_PROTECTION to the repository's
+// branches. Only admins can issue the command, unless COMMAND_PERMISSIONS
+// says otherwise.
+func handleProtectCommand(conf Config, issueComment IssueComment, issues Issues, graphQL GraphQL) Response {
+	issue := issueComment.Issue()
+	var message string
+	if len(conf.BranchProtection) == 0 {
+		message = fmt.Sprintf("@%s, BRANCH_PROTECTION doesn't declare any branch protection, so there's "+
+			"nothing to apply.", issueComment.Commenter.Login)
+	} else {
+		changed, err := syncBranchProtection(issue.Repository, conf.BranchProtection, graphQL)
+		if err != nil {
+			errorMessage := fmt.Sprintf("Failed to apply the branch protection of %s",
+				repositoryKey(issue.Repository))
+			return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+		} else if len(changed) == 0 {
+			message = fmt.Sprintf("@%s, the branch protection already matches BRANCH_PROTECTION.",
+				issueComment.Commenter.Login)
+		} else {
+			message = fmt.Sprintf("@%s, I applied BRANCH_PROTECTION to the protection rules for %s.",
+				issueComment.Commenter.Login, formatPatterns(changed))
+		}
+	}
+	if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+		errorMessage := fmt.Sprintf("Failed to report the branch protection on PR %s", issue.FullName())
+		return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	return SuccessResponse{fmt.Sprintf("Applied the branch protection of %s", repositoryKey(issue.Repository))}
+}
+
+// handleBranchProtectionRuleEvent reverts the changes made to the
+// repository's protection rules outside BRANCH_PROTECTION, if
+// BRANCH_PROTECTION_SYNC is enabled. Deleted rules are created again.
+func handleBranchProtectionRuleEvent(conf Config, body []byte, graphQL GraphQL) Response {
+	if !conf.BranchProtectionSync || len(conf.BranchProtection) == 0 {
+		return SuccessResponse{"Branch protection sync is disabled. Ignoring."}
+	}
+	event, err := parseBranchProtectionRuleEvent(body)
+	if err != nil {
+		return ErrorResponse{err, http.StatusInternalServerError, "Failed to parse the request's body"}
+	}
+	changed, err := syncBranchProtection(event.Repository, conf.BranchProtection, graphQL)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Failed to apply the branch protection of %s", repositoryKey(event.Repository))
+		return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	} else if len(changed) == 0 {
+		return SuccessResponse{"The branch protection matches BRANCH_PROTECTION"}
+	}
+	return SuccessResponse{fmt.Sprintf("Applied the branch protection for %s after the rule for %s was %s",
+		strings.Join(changed, ", "), event.Pattern, event.Action)}
+}
+
+func formatPatterns(patterns []string) string {
+	return "`" + strings.Join(patterns, "`, `") + "`"
+}
@@ -0,0 +1,239 @@
+package main_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParseBranchProtection", func() {
+	It("parses the settings of each pattern", func() {
+		protections, err := grh.ParseBranchProtection(
+			"main=checks:ci,lint strict approvals:2 code-owners dismiss-stale linear-history; release/*=approvals:1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(protections).To(Equal([]grh.BranchProtection{
+			{
+				Pattern:                 "main",
+				RequiredStatusChecks:    []string{"ci", "lint"},
+				StrictStatusChecks:      true,
+				RequiredApprovals:       2,
+				RequireCodeOwnerReviews: true,
+				DismissStaleReviews:     true,
+				RequireLinearHistory:    true,
+			},
+			{Pattern: "release/*", RequiredApprovals: 1},
+		}))
+	})
+
+	It("fails for an unknown setting", func() {
+		_, err := grh.ParseBranchProtection("main=signed-commits")
+		Expect(err).To(MatchError(ContainSubstring("unknown setting \"signed-commits\"")))
+	})
+
+	It("fails for an entry without a pattern", func() {
+		_, err := grh.ParseBranchProtection("approvals:1")
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	var (
+		handle      = context.Handle
+		headers     = context.Headers
+		requestJSON = context.RequestJSON
+
+		responseRecorder *httptest.ResponseRecorder
+		repositories     *mocks.Repositories
+		issues           *mocks.Issues
+		graphQL          *mocks.GraphQL
+
+		mutations []map[string]interface{}
+	)
+	BeforeEach(func() {
+		responseRecorder = *context.ResponseRecorder
+		repositories = *context.Repositories
+		issues = *context.Issues
+		graphQL = *context.GraphQL
+
+		context.Config.BranchProtection = []grh.BranchProtection{
+			{Pattern: "main", RequiredStatusChecks: []string{"lint", "ci"}, RequiredApprovals: 1},
+			{Pattern: "release/*", RequireLinearHistory: true},
+		}
+		mutations = nil
+	})
+
+	queryContaining := func(text string) interface{} {
+		return mock.MatchedBy(func(query string) bool { return strings.Contains(query, text) })
+	}
+
+	// mockRules makes GitHub have a rule for main that matches
+	// BRANCH_PROTECTION and one for release/* that doesn't require a linear
+	// history
+	mockRules := func() {
+		data := []byte(`{"repository": {"id": "repo-id", "branchProtectionRules": {"nodes": [
+			{"id": "main-rule", "pattern": "main", "requiresStatusChecks": true,
+			 "requiredStatusCheckContexts": ["ci", "lint"], "requiresApprovingReviews": true,
+			 "requiredApprovingReviewCount": 1},
+			{"id": "release-rule", "pattern": "release/*", "requiresLinearHistory": false}
+		]}}}`)
+		graphQL.
+			On("Query", anyContext, queryContaining("branchProtectionRules("), mock.Anything, mock.Anything).
+			Return(noError).
+			Run(func(args mock.Arguments) {
+				Expect(json.Unmarshal(data, args.Get(3))).To(Succeed())
+			})
+		graphQL.
+			On("Query", anyContext, queryContaining("updateBranchProtectionRule("), mock.Anything, mock.Anything).
+			Return(noError).
+			Run(func(args mock.Arguments) {
+				mutations = append(mutations, args.Get(2).(map[string]interface{})["input"].(map[string]interface{}))
+			})
+	}
+
+	Describe("!protect comment", func() {
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		var commenter string
+		requestJSON.Is(func() string {
+			return withCommenter(IssueCommentEvent("!protect", arbitraryIssueAuthor), commenter)
+		})
+
+		mockRole := func(permission string) {
+			graphQL.
+				On("Query", anyContext, queryContaining("collaborators"), mock.Anything, mock.Anything).
+				Return(noError).
+				Run(func(args mock.Arguments) {
+					data, err := json.Marshal(map[string]interface{}{
+						"repository": map[string]interface{}{
+							"collaborators": map[string]interface{}{
+								"edges": []interface{}{
+									map[string]interface{}{
+										"permission": permission,
+										"node":       map[string]string{"login": commenter},
+									},
+								},
+							},
+						},
+					})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(json.Unmarshal(data, args.Get(3))).To(Succeed())
+				})
+		}
+
+		BeforeEach(func() {
+			commenter = arbitraryIssueAuthor
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+		})
+
+		Context("by an admin", func() {
+			BeforeEach(func() {
+				mockRole("ADMIN")
+				mockRules()
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("I applied BRANCH_PROTECTION to the protection rules for "+
+							"`release/*`."))).
+					Return(emptyResult, emptyResponse, noError)
+			})
+
+			It("updates the rules that don't match the declaration", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+				Expect(mutations).To(HaveLen(1))
+				Expect(mutations[0]).To(HaveKeyWithValue("branchProtectionRuleId", "release-rule"))
+				Expect(mutations[0]).To(HaveKeyWithValue("requiresLinearHistory", true))
+			})
+		})
+
+		Context("by an admin other than the PR's author", func() {
+			BeforeEach(func() {
+				commenter = "admin"
+				mockRole("ADMIN")
+				mockRules()
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("@admin, I applied BRANCH_PROTECTION"))).
+					Return(emptyResult, emptyResponse, noError)
+			})
+
+			It("tells the commenter about the applied rules", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+			})
+		})
+
+		Context("by a maintainer", func() {
+			BeforeEach(func() {
+				mockRole("MAINTAIN")
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("Only users with the admin role or higher can ask me to "+
+							"`!protect` here."))).
+					Return(emptyResult, emptyResponse, noError)
+			})
+
+			It("refuses the command", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+				Expect(mutations).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("branch protection rule event", func() {
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "branch_protection_rule",
+			}
+		})
+		requestJSON.Is(func() string {
+			return `{
+  "action": "edited",
+  "rule": {"name": "release/*"},
+  "repository": {
+    "name": "` + repositoryName + `",
+    "owner": {"login": "` + repositoryOwner + `"},
+    "ssh_url": "` + sshURL + `"
+  }
+}`
+		})
+
+		Context("with BRANCH_PROTECTION_SYNC enabled", func() {
+			BeforeEach(func() {
+				context.Config.BranchProtectionSync = true
+				mockRules()
+			})
+
+			It("reverts the rule to the declaration", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(mutations).To(HaveLen(1))
+				Expect(mutations[0]).To(HaveKeyWithValue("pattern", "release/*"))
+			})
+		})
+
+		Context("with BRANCH_PROTECTION_SYNC disabled", func() {
+			It("ignores the event", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				graphQL.AssertNotCalled(GinkgoT(), "Query", anyContext, mock.Anything, mock.Anything, mock.Anything)
+			})
+		})
+	})
+})
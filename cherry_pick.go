@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/git"
+)
+
+var branchNameRegexp = regexp.MustCompile(`^[A-Za-z0-9._/-]+$`)
+
+func isCherryPickCommand(comment string) bool {
+	_, isCherryPick := parseCherryPickCommand(comment)
+	return isCherryPick
+}
+
+// parseCherryPickCommand parses a "!cherry-pick <branch>" command and returns
+// the branch, or an empty string, if the command doesn't give exactly one.
+// The branch is validated separately, so that invalid branches could be
+// reported back.
+func parseCherryPickCommand(comment string) (string, bool) {
+	fields := strings.Fields(comment)
+	if len(fields) == 0 || fields[0] != "!cherry-pick" {
+		return "", false
+	} else if len(fields) != 2 {
+		return "", true
+	}
+	return fields[1], true
+}
+
+// cherryPickRefusal returns the reply to a cherry-pick onto the branch that
+// can't be done, or an empty string, if it can.
+func cherryPickRefusal(branch string) string {
+	if branch == "" {
+		return "tell me the one branch to cherry-pick onto, e.g. `!cherry-pick release-1.2`."
+	} else if !isValidBranchName(branch) {
+		return fmt.Sprintf("`%s` is not a branch I can cherry-pick onto.", branch)
+	}
+	return ""
+}
+
+func isValidBranchName(branch string) bool {
+	return branchNameRegexp.MatchString(branch) && !strings.HasPrefix(branch, "-") &&
+		!strings.Contains(branch, "..")
+}
+
+// handleCherryPickCommand cherry-picks the PR onto the branch. A merged PR is
+// cherry-picked as its merge commit and an open PR as its commits, leaving
+// out the merge commits.
+func handleCherryPickCommand(issueComment IssueComment, gitRepos git.Repos, pullRequests PullRequests,
+	issues Issues) Response {
+
+	issue := issueComment.Issue()
+	branch, _ := parseCherryPickCommand(issueComment.Comment)
+	reply := func(message string) error {
+		return comment(fmt.Sprintf("@%s, %s", issueComment.Commenter.Login, message), issue.Repository,
+			issue.Number, issues)
+	}
+	if refusal := cherryPickRefusal(branch); refusal != "" {
+		if err := reply(refusal); err != nil {
+			message := fmt.Sprintf("Failed to respond to an invalid cherry-pick on PR %s", issue.FullName())
+			return ErrorResponse{err, http.StatusBadGateway, message}
+		}
+		return SuccessResponse{"Invalid branch. Responded with a comment."}
+	}
+	pr, errResp := getPR(issueComment, pullRequests)
+	if errResp != nil {
+		return errResp
+	}
+
+	var commits []string
+	if pr.GetMerged() {
+		commits = []string{pr.GetMergeCommitSHA()}
+	} else {
+		isExpectedHead := func(sha string) bool { return sha == pr.Head.GetSHA() }
+		prCommits, asyncErrResp := getCommits(issueComment, isExpectedHead, pullRequests)
+		if asyncErrResp != nil {
+			return asyncErrResp.ErrorResponse
+		}
+		commits = nonMergeCommitsInOrder(prCommits)
+	}
+	log.Printf("Cherry-picking PR %s onto %s.\n", issue.FullName(), branch)
+	return cherryPickOntoBranch(issue.Repository, commits, branch, gitRepos, reply, func(gitRepo git.Repo) error {
+		// The commits of open PRs from forks are only in the forks
+		if pr.GetMerged() {
+			return nil
+		}
+		_, err := fetchHeadRemote(pr, gitRepo)
+		return err
+	})
+}
+
+// handleCommitComment handles the commands issued in the comments of
+// commits. Only !cherry-pick, which cherry-picks the commented commit, is
+// supported there.
+func handleCommitComment(conf Config, body []byte, gitRepos git.Repos, repositories Repositories) Response {
+	commitComment, err := parseCommitComment(body)
+	if err != nil {
+		return ErrorResponse{err, http.StatusInternalServerError, "Failed to parse the request's body"}
+	} else if isBotLogin(conf, commitComment.Commenter.Login) {
+		return SuccessResponse{"Comment by a bot. Ignoring."}
+	}
+	branch, isCherryPick := parseCherryPickCommand(commitComment.Comment)
+	if !isCherryPick {
+		return SuccessResponse{"Not a command I understand. Ignoring."}
+	}
+	reply := func(message string) error {
+		repositoryComment := &github.RepositoryComment{
+			Body: github.String(fmt.Sprintf("@%s, %s", commitComment.Commenter.Login, message)),
+		}
+		_, _, err := repositories.CreateComment(context.TODO(), commitComment.Repository.Owner,
+			commitComment.Repository.Name, commitComment.SHA, repositoryComment)
+		return err
+	}
+	// Unlike on PRs, there's no author whose permissions could vouch for the
+	// commenter
+	if isCollab, err := isCollaborator(commitComment.Repository, commitComment.Commenter,
+		repositories); err != nil {
+		return ErrorResponse{err, http.StatusBadGateway, "Failed to check if the user is authorized to issue the command"}
+	} else if !isCollab {
+		if err = reply("I'm sorry. Only collaborators can ask me to do that."); err != nil {
+			return ErrorResponse{err, http.StatusBadGateway, "Failed to respond to unauthorized command"}
+		}
+		return SuccessResponse{"Command issued by a someone who's not a collaborator. Responded with a comment. " +
+			"Ignoring the command."}
+	} else if refusal := cherryPickRefusal(branch); refusal != "" {
+		if err = reply(refusal); err != nil {
+			return ErrorResponse{err, http.StatusBadGateway, "Failed to respond to an invalid cherry-pick"}
+		}
+		return SuccessResponse{"Invalid branch. Responded with a comment."}
+	}
+	log.Printf("Cherry-picking commit %s of %s onto %s.\n", commitComment.SHA,
+		repositoryKey(commitComment.Repository), branch)
+	return cherryPickOntoBranch(commitComment.Repository, []string{commitComment.SHA}, branch, gitRepos, reply,
+		func(git.Repo) error { return nil })
+}
+
+// cherryPickOntoBranch cherry-picks the commits onto the branch and replies
+// with the resulting commits or with the reason the cherry-pick failed.
+// prepare is called with the updated repo before the cherry-pick.
+func cherryPickOntoBranch(repository Repository, commits []string, branch string, gitRepos git.Repos,
+	reply func(string) error, prepare func(git.Repo) error) Response {
+
+	gitRepo, err := gitRepos.GetUpdatedRepo(repository.URL, repository.Owner, repository.Name)
+	if git.IsDiskFull(err) {
+		return replyDiskFull(repository, err, reply)
+	} else if err != nil {
+		message := fmt.Sprintf("Failed to get an updated repo for %s", repositoryKey(repository))
+		return ErrorResponse{err, gitErrorCode(err), message}
+	} else if err = prepare(gitRepo); err != nil {
+		message := fmt.Sprintf("Failed to fetch the commits to cherry-pick onto %s", branch)
+		return ErrorResponse{err, gitErrorCode(err), message}
+	}
+
+	shas, err := gitRepo.CherryPickOntoBranch(commits, "origin", branch)
+	var message string
+	switch err := err.(type) {
+	case nil:
+		message = fmt.Sprintf("I cherry-picked this onto `%s` as %s.", branch, strings.Join(shas, ", "))
+	case *git.ErrCherryPickConflict:
+		if len(err.ConflictingFiles) > 0 {
+			message = fmt.Sprintf("I couldn't cherry-pick %s onto `%s`, because it conflicts with the branch in %s. "+
+				"Please cherry-pick it manually.", err.Commit, branch, formatLogins(err.ConflictingFiles))
+		} else {
+			message = fmt.Sprintf("I couldn't cherry-pick %s onto `%s`. The change may already be on the branch.",
+				err.Commit, branch)
+		}
+	case *git.ErrPushFailed:
+		message = fmt.Sprintf("I cherry-picked this, but couldn't push it to `%s`. The branch may be protected "+
+			"or may have just moved on.", branch)
+	default:
+		// git's output is only logged, because it can include the remote's
+		// messages and the bot's paths
+		if replyErr := reply(fmt.Sprintf("I failed to cherry-pick this onto `%s`. Does the branch exist? A "+
+			"maintainer can look up the details in my logs.", branch)); replyErr != nil {
+			log.Printf("Failed to report the failed cherry-pick onto %s: %v\n", branch, replyErr)
+		}
+		message := fmt.Sprintf("Failed to cherry-pick onto %s in %s", branch, repositoryKey(repository))
+		return ErrorResponse{err, gitErrorCode(err), message}
+	}
+	if err = reply(message); err != nil {
+		errorMessage := fmt.Sprintf("Failed to report the cherry-pick onto %s", branch)
+		return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	return SuccessResponse{fmt.Sprintf("Cherry-picked onto %s. Responded with a comment.", branch)}
+}
+
+// nonMergeCommitsInOrder orders the PR's commits from the oldest to the
+// newest by following their first parents from the head and leaves out the
+// merge commits.
+func nonMergeCommitsInOrder(commits []*github.RepositoryCommit) []string {
+	bySHA := make(map[string]*github.RepositoryCommit, len(commits))
+	for _, commit := range commits {
+		bySHA[commit.GetSHA()] = commit
+	}
+	head, err := findTopologicalHead(commits)
+	if err != nil {
+		return nil
+	}
+	var shas []string
+	for commit := head; commit != nil; {
+		if len(commit.Parents) < 2 {
+			shas = append([]string{commit.GetSHA()}, shas...)
+		}
+		if len(commit.Parents) == 0 {
+			break
+		}
+		commit = bySHA[commit.Parents[0].GetSHA()]
+	}
+	return shas
+}
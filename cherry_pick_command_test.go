@@ -0,0 +1,330 @@
+package main_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/git"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("!cherry-pick comment", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+			gitRepos         *mocks.Repos
+			gitRepo          *mocks.Repo
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+			gitRepos = *context.GitRepos
+			gitRepo = new(mocks.Repo)
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+
+		headSHA := "1235"
+		mergeCommitSHA := "abc123"
+
+		mockPR := func(merged bool) {
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+				Return(&github.PullRequest{
+					Number:         github.Int(issueNumber),
+					Merged:         github.Bool(merged),
+					MergeCommitSHA: github.String(mergeCommitSHA),
+					Base: &github.PullRequestBranch{
+						SHA:  github.String("1234"),
+						Ref:  github.String("master"),
+						Repo: repository,
+					},
+					Head: &github.PullRequestBranch{
+						SHA:  github.String(headSHA),
+						Ref:  github.String("feature"),
+						Repo: repository,
+					},
+				}, emptyResponse, noError)
+			gitRepos.
+				On("GetUpdatedRepo", sshURL, repositoryOwner, repositoryName).
+				Return(gitRepo, noError)
+		}
+
+		BeforeEach(func() {
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+		})
+
+		Context("with an invalid branch", func() {
+			requestJSON.Is(func() string {
+				return IssueCommentEvent("!cherry-pick --force", arbitraryIssueAuthor)
+			})
+
+			It("says so", func() {
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("is not a branch I can cherry-pick onto"))).
+					Return(emptyResult, emptyResponse, noError)
+
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+			})
+		})
+
+		Context("without a branch", func() {
+			requestJSON.Is(func() string {
+				return IssueCommentEvent("!cherry-pick", arbitraryIssueAuthor)
+			})
+
+			It("replies with the usage", func() {
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("tell me the one branch to cherry-pick onto, e.g. "+
+							"`!cherry-pick release-1.2`"))).
+					Return(emptyResult, emptyResponse, noError)
+
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+			})
+		})
+
+		Context("with a valid branch", func() {
+			requestJSON.Is(func() string {
+				return IssueCommentEvent("!cherry-pick release-1.2", arbitraryIssueAuthor)
+			})
+
+			Context("with a merged PR", func() {
+				BeforeEach(func() {
+					mockPR(true)
+				})
+
+				It("cherry-picks the merge commit and comments with the result", func() {
+					gitRepo.
+						On("CherryPickOntoBranch", []string{mergeCommitSHA}, "origin", "release-1.2").
+						Return([]string{"def456"}, noError)
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("I cherry-picked this onto `release-1.2` as def456"))).
+						Return(emptyResult, emptyResponse, noError)
+
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					gitRepo.AssertExpectations(GinkgoT())
+					issues.AssertExpectations(GinkgoT())
+				})
+
+				It("reports the conflicting files", func() {
+					gitRepo.
+						On("CherryPickOntoBranch", []string{mergeCommitSHA}, "origin", "release-1.2").
+						Return(nil, &git.ErrCherryPickConflict{
+							Err:              errors.New("conflict"),
+							Commit:           mergeCommitSHA,
+							ConflictingFiles: []string{"foo.go", "bar.go"},
+						})
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("conflicts with the branch in `foo.go`, `bar.go`"))).
+						Return(emptyResult, emptyResponse, noError)
+
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertExpectations(GinkgoT())
+				})
+
+				It("reports a failure without git's output", func() {
+					gitRepo.
+						On("CherryPickOntoBranch", []string{mergeCommitSHA}, "origin", "release-1.2").
+						Return(nil, errors.New("fatal: invalid reference: origin/release-1.2"))
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(func(c *github.IssueComment) bool {
+								return commentContaining("I failed to cherry-pick this onto `release-1.2`")(c) &&
+									!commentContaining("fatal")(c)
+							})).
+						Return(emptyResult, emptyResponse, noError)
+
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusInternalServerError))
+					issues.AssertExpectations(GinkgoT())
+				})
+
+				It("reports a rejected push", func() {
+					gitRepo.
+						On("CherryPickOntoBranch", []string{mergeCommitSHA}, "origin", "release-1.2").
+						Return(nil, &git.ErrPushFailed{Err: errors.New("rejected")})
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("couldn't push it to `release-1.2`"))).
+						Return(emptyResult, emptyResponse, noError)
+
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertExpectations(GinkgoT())
+				})
+			})
+
+			Context("with no room to clone the repository", func() {
+				BeforeEach(func() {
+					pullRequests.
+						On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+						Return(&github.PullRequest{
+							Number:         github.Int(issueNumber),
+							Merged:         github.Bool(true),
+							MergeCommitSHA: github.String(mergeCommitSHA),
+						}, emptyResponse, noError)
+					gitRepos.
+						On("GetUpdatedRepo", sshURL, repositoryOwner, repositoryName).
+						Return(gitRepo, &git.ErrDiskFull{Usage: 2048, Quota: 1024})
+				})
+
+				It("tells the commenter and fails the webhook", func() {
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("the disk I keep my clones on is full"))).
+						Return(emptyResult, emptyResponse, noError)
+
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusInsufficientStorage))
+					issues.AssertExpectations(GinkgoT())
+				})
+			})
+
+			Context("with an open PR", func() {
+				BeforeEach(func() {
+					mockPR(false)
+					commits := githubCommits(
+						commit{"1111", "Add the feature"},
+						commit{headSHA, "Test the feature"},
+					)
+					mockListCommits(commits, 100, repositoryOwner, repositoryName, issueNumber, pullRequests)
+				})
+
+				It("cherry-picks the PR's commits in order", func() {
+					gitRepo.
+						On("CherryPickOntoBranch", []string{"1111", headSHA}, "origin", "release-1.2").
+						Return([]string{"2222", "3333"}, noError)
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("as 2222, 3333"))).
+						Return(emptyResult, emptyResponse, noError)
+
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					gitRepo.AssertExpectations(GinkgoT())
+				})
+			})
+		})
+	})
+
+	Describe("commit comment", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			repositories     *mocks.Repositories
+			gitRepos         *mocks.Repos
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			repositories = *context.Repositories
+			gitRepos = *context.GitRepos
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "commit_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return `{
+  "comment": {
+    "commit_id": "` + arbitrarySHA + `",
+    "body": "!cherry-pick release-1.2",
+    "user": {
+      "login": "commenter"
+    }
+  },
+  "repository": {
+    "name": "` + repositoryName + `",
+    "owner": {
+      "login": "` + repositoryOwner + `"
+    },
+    "ssh_url": "` + sshURL + `"
+  }
+}`
+		})
+
+		Context("by a collaborator", func() {
+			BeforeEach(func() {
+				repositories.
+					On("IsCollaborator", anyContext, repositoryOwner, repositoryName, "commenter").
+					Return(true, emptyResponse, noError)
+			})
+
+			It("cherry-picks the commit and replies on the commit", func() {
+				gitRepo := new(mocks.Repo)
+				gitRepos.
+					On("GetUpdatedRepo", sshURL, repositoryOwner, repositoryName).
+					Return(gitRepo, noError)
+				gitRepo.
+					On("CherryPickOntoBranch", []string{arbitrarySHA}, "origin", "release-1.2").
+					Return([]string{"def456"}, noError)
+				repositories.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, arbitrarySHA,
+						mock.MatchedBy(func(comment *github.RepositoryComment) bool {
+							return comment.GetBody() == "@commenter, I cherry-picked this onto `release-1.2` as def456."
+						})).
+					Return(&github.RepositoryComment{}, emptyResponse, noError)
+
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				repositories.AssertExpectations(GinkgoT())
+			})
+		})
+
+		Context("by someone who's not a collaborator", func() {
+			BeforeEach(func() {
+				repositories.
+					On("IsCollaborator", anyContext, repositoryOwner, repositoryName, "commenter").
+					Return(false, emptyResponse, noError)
+			})
+
+			It("refuses", func() {
+				repositories.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, arbitrarySHA,
+						mock.MatchedBy(func(comment *github.RepositoryComment) bool {
+							return comment.GetBody() == "@commenter, I'm sorry. Only collaborators can ask me to do that."
+						})).
+					Return(&github.RepositoryComment{}, emptyResponse, noError)
+
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				repositories.AssertExpectations(GinkgoT())
+			})
+		})
+	})
+})
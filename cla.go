@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/salemove/github-review-helper/evaluator"
+	"github.com/salemove/github-review-helper/git"
+)
+
+// The name of the gate that keeps the PRs of authors who haven't signed the
+// CLA from being merged
+const claGate = "cla"
+
+// How much of the CLA service's response is read
+const maxCLAServiceResponseSize = 64 * 1024
+
+var claServiceHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+const claSignaturesQuery = `query($owner: String!, $name: String!, $expression: String!) {
+  repository(owner: $owner, name: $name) {
+    object(expression: $expression) {
+      ... on Blob {
+        text
+      }
+    }
+  }
+}`
+
+type claSignaturesResult struct {
+	Repository struct {
+		Object *struct {
+			Text string `json:"text"`
+		} `json:"object"`
+	} `json:"repository"`
+}
+
+// CLAServiceResponse is the CLA service's answer to whether a user has
+// signed the CLA.
+type CLAServiceResponse struct {
+	Signed bool `json:"signed"`
+}
+
+func isCLASignedCommand(comment string) bool {
+	return strings.TrimSpace(comment) == "!cla-signed"
+}
+
+// isCLARequired reports whether CLA_SERVICE_URL or CLA_SIGNATURES_PATH is
+// set, which enables the gate and the instructions.
+func isCLARequired(conf Config) bool {
+	return conf.CLAServiceURL != "" || conf.CLASignaturesPath != ""
+}
+
+// hasSignedCLA checks whether the user is listed in CLA_SIGNATURES_PATH on
+// the default branch of the repository or, failing that, whether the CLA
+// service knows of the user's signature. Bots don't sign CLAs, so their PRs
+// are let through.
+func hasSignedCLA(conf Config, repository Repository, user string, graphQL GraphQL) (bool, error) {
+	if strings.HasSuffix(user, "[bot]") {
+		return true, nil
+	}
+	if conf.CLASignaturesPath != "" {
+		signers, err := claSigners(repository, conf.CLASignaturesPath, graphQL)
+		if err != nil {
+			return false, err
+		} else if signers[strings.ToLower(user)] {
+			return true, nil
+		}
+	}
+	if conf.CLAServiceURL != "" {
+		return callCLAService(conf.CLAServiceURL, repository, user)
+	}
+	return false, nil
+}
+
+// claSigners reads the logins of the users who have signed the CLA from the
+// file in the repository, one per line. Empty lines and lines starting with
+// "#" are ignored, so are the "@" prefixes of the logins. A missing file
+// means that nobody has signed.
+func claSigners(repository Repository, path string, graphQL GraphQL) (map[string]bool, error) {
+	var result claSignaturesResult
+	err := graphQL.Query(context.TODO(), claSignaturesQuery, map[string]interface{}{
+		"owner":      repository.Owner,
+		"name":       repository.Name,
+		"expression": "HEAD:" + strings.TrimPrefix(path, "/"),
+	}, &result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s of %s: %v", path, repositoryKey(repository), err)
+	}
+	signers := map[string]bool{}
+	if result.Repository.Object == nil {
+		return signers, nil
+	}
+	for _, line := range strings.Split(result.Repository.Object.Text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		signers[strings.ToLower(strings.TrimPrefix(line, "@"))] = true
+	}
+	return signers, nil
+}
+
+// callCLAService asks the CLA service whether the user has signed the CLA.
+// {user}, {owner} and {repo} in the URL are replaced with the user's login
+// and the repository's owner and name.
+func callCLAService(serviceURL string, repository Repository, user string) (bool, error) {
+	requestURL := strings.NewReplacer(
+		"{user}", url.PathEscape(user),
+		"{owner}", url.PathEscape(repository.Owner),
+		"{repo}", url.PathEscape(repository.Name),
+	).Replace(serviceURL)
+	resp, err := claServiceHTTPClient.Get(requestURL)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return false, fmt.Errorf("the CLA service responded with %s", resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxCLAServiceResponseSize))
+	if err != nil {
+		return false, err
+	}
+	var response CLAServiceResponse
+	if err = json.Unmarshal(body, &response); err != nil {
+		return false, fmt.Errorf("the CLA service responded with an invalid answer: %v", err)
+	}
+	return response.Signed, nil
+}
+
+// claUnsignedMessageData describes the PR whose author hasn't signed the CLA
+// to the cla_unsigned message.
+func claUnsignedMessageData(conf Config, issue Issue, author, commenter string) MessageData {
+	return MessageData{
+		Repository: issue.Repository,
+		PR:         issue.Number,
+		Author:     author,
+		Commenter:  commenter,
+		Version:    version,
+		Details:    map[string]interface{}{"SignURL": conf.CLASignURL},
+	}
+}
+
+// requestCLASignature comments the instructions for signing the CLA on a
+// newly opened PR, if its author hasn't signed it yet.
+func requestCLASignature(conf Config, pullRequestEvent PullRequestEvent, issues Issues,
+	graphQL GraphQL) *ErrorResponse {
+
+	if !isCLARequired(conf) {
+		return nil
+	}
+	issue := pullRequestEvent.Issue()
+	author := pullRequestEvent.User.Login
+	signed, err := hasSignedCLA(conf, issue.Repository, author, graphQL)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Failed to check if %s has signed the CLA for PR %s", author, issue.FullName())
+		return &ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	} else if signed {
+		return nil
+	}
+	message := renderMessage(conf, claUnsignedMessage, claUnsignedMessageData(conf, issue, author, ""))
+	if err = comment(message, issue.Repository, issue.Number, issues); err != nil {
+		errorMessage := fmt.Sprintf("Failed to ask for the CLA signature on PR %s", issue.FullName())
+		return &ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	return nil
+}
+
+// handleCLASignedCommand checks the PR author's signature again, once they
+// say they've signed the CLA. A PR that's labeled for merging is merged right
+// away, if it's ready. Otherwise the instructions are repeated or the
+// signature is confirmed.
+func handleCLASignedCommand(conf Config, issueComment IssueComment, store Store, issues Issues,
+	pullRequests PullRequests, repositories Repositories, graphQL GraphQL, gitRepos git.Repos) Response {
+
+	issue := issueComment.Issue()
+	if !isCLARequired(conf) {
+		return SuccessResponse{"Neither CLA_SERVICE_URL nor CLA_SIGNATURES_PATH is set. Ignoring."}
+	}
+	author := issueComment.User.Login
+	signed, err := hasSignedCLA(conf, issue.Repository, author, graphQL)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Failed to check if %s has signed the CLA for PR %s", author, issue.FullName())
+		return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	log.Printf("Checked the CLA signature of %s in PR %s: signed=%t\n", author, issue.FullName(), signed)
+	if signed && issueComment.HasLabel(MergingLabel) {
+		return mergeIfReady(conf, issue, true, store, issues, pullRequests, repositories, graphQL, gitRepos)
+	}
+	message := fmt.Sprintf("@%s, thank you! I found @%s's signature of the CLA.", issueComment.Commenter.Login,
+		author)
+	if !signed {
+		message = renderMessage(conf, claUnsignedMessage,
+			claUnsignedMessageData(conf, issue, author, issueComment.Commenter.Login))
+	}
+	if err = comment(message, issue.Repository, issue.Number, issues); err != nil {
+		errorMessage := fmt.Sprintf("Failed to respond to the CLA signature on PR %s", issue.FullName())
+		return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	return SuccessResponse{fmt.Sprintf("Checked the CLA signature of %s. Responded with a comment.", author)}
+}
+
+// checkCLA fails the PR while its author hasn't signed the CLA. Failing to
+// check the signature fails the evaluation, so that the PR would be checked
+// again later, instead of being merged without a signature.
+func checkCLA(ctx GateContext) (evaluator.Result, *ErrorResponse) {
+	if !isCLARequired(ctx.Config) {
+		return failed("neither CLA_SERVICE_URL nor CLA_SIGNATURES_PATH is set"), nil
+	}
+	issue := prIssue(ctx.PR)
+	author := ctx.PR.User.GetLogin()
+	signed, err := hasSignedCLA(ctx.Config, issue.Repository, author, ctx.GraphQL)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Failed to check if %s has signed the CLA for PR %s", author, issue.FullName())
+		return evaluator.Result{}, &ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	} else if !signed {
+		return failed(fmt.Sprintf("@%s hasn't signed the CLA, which can be checked again with `!cla-signed`",
+			author)), nil
+	}
+	return passed(fmt.Sprintf("@%s has signed the CLA", author)), nil
+}
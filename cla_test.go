@@ -0,0 +1,188 @@
+package main_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("!cla-signed comment", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			issues           *mocks.Issues
+			graphQL          *mocks.GraphQL
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			issues = *context.Issues
+			graphQL = *context.GraphQL
+
+			context.Config.CLASignURL = "https://cla.example.com/sign"
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!cla-signed", arbitraryIssueAuthor)
+		})
+
+		mockSignatures := func(text string) {
+			data, err := json.Marshal(map[string]interface{}{
+				"repository": map[string]interface{}{
+					"object": map[string]string{"text": text},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			graphQL.
+				On("Query", anyContext, mock.AnythingOfType("string"), mock.MatchedBy(
+					func(variables map[string]interface{}) bool {
+						return variables["expression"] == "HEAD:.github/cla-signatures.txt"
+					}), mock.Anything).
+				Return(noError).
+				Run(func(args mock.Arguments) {
+					Expect(json.Unmarshal(data, args.Get(3))).To(Succeed())
+				})
+		}
+
+		expectComment := func(text string) {
+			issues.
+				On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+					mock.MatchedBy(commentContaining(text))).
+				Return(emptyResult, emptyResponse, noError)
+		}
+
+		Context("with CLA_SIGNATURES_PATH", func() {
+			BeforeEach(func() {
+				context.Config.CLASignaturesPath = ".github/cla-signatures.txt"
+			})
+
+			Context("listing the author", func() {
+				BeforeEach(func() {
+					mockSignatures("# Signed CLAs\nalice\n@" + arbitraryIssueAuthor + "\n")
+				})
+
+				It("confirms the signature", func() {
+					expectComment("I found @" + arbitraryIssueAuthor + "'s signature of the CLA.")
+
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertExpectations(GinkgoT())
+				})
+			})
+
+			Context("not listing the author", func() {
+				BeforeEach(func() {
+					mockSignatures("alice\n")
+				})
+
+				It("repeats the instructions", func() {
+					expectComment("you need to sign our Contributor License Agreement at " +
+						"https://cla.example.com/sign.")
+
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertExpectations(GinkgoT())
+				})
+			})
+		})
+
+		Context("with CLA_SERVICE_URL", func() {
+			var (
+				server    *httptest.Server
+				requested string
+			)
+			BeforeEach(func() {
+				server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					requested = r.URL.Path
+					w.Write([]byte(`{"signed": true}`))
+				}))
+				context.Config.CLAServiceURL = server.URL + "/{owner}/{repo}/signatures/{user}"
+			})
+			AfterEach(func() {
+				server.Close()
+			})
+
+			It("asks the service about the author", func() {
+				expectComment("I found @" + arbitraryIssueAuthor + "'s signature of the CLA.")
+
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+				Expect(requested).To(Equal("/" + repositoryOwner + "/" + repositoryName + "/signatures/" +
+					arbitraryIssueAuthor))
+			})
+		})
+	})
+
+	Describe("pull_request opened event with CLA_SIGNATURES_PATH", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			graphQL          *mocks.GraphQL
+
+			headSHA = "1235"
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			graphQL = *context.GraphQL
+
+			context.Config.CLASignaturesPath = ".github/cla-signatures.txt"
+			pullRequests.
+				On("ListCommits", anyContext, repositoryOwner, repositoryName, issueNumber,
+					mock.AnythingOfType("*github.ListOptions")).
+				Return(githubCommits(commit{headSHA, "Changing things"}), emptyResponse, noError)
+			repositories.
+				On("CreateStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.Anything).
+				Return(emptyResult, emptyResponse, noError)
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "pull_request",
+			}
+		})
+		requestJSON.Is(func() string {
+			return PullRequestEvent("opened", headSHA, grh.Repository{
+				Owner: repositoryOwner,
+				Name:  repositoryName,
+				URL:   sshURL,
+			})
+		})
+
+		Context("with checking the signatures failing", func() {
+			BeforeEach(func() {
+				graphQL.
+					On("Query", anyContext, mock.AnythingOfType("string"), mock.Anything, mock.Anything).
+					Return(errArbitrary)
+			})
+
+			It("still checks the PR for fixup commits", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				repositories.AssertExpectations(GinkgoT())
+			})
+		})
+	})
+})
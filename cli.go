@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/git"
+)
+
+// CommandRun is a command run on a PR from the terminal with
+// `github-review-helper run`, e.g. for debugging or when the webhooks are
+// down.
+type CommandRun struct {
+	Repository  Repository
+	PullRequest int
+	Command     string
+	// Actor is the user the command is run on behalf of. Defaults to the
+	// owner of GITHUB_ACCESS_TOKEN.
+	Actor string
+}
+
+// ParseCommandRun parses the arguments of the run subcommand:
+// --repo owner/name --pr 123 --command '!squash' [--as login]
+// The command has to start with one of COMMAND_PREFIXES. Whether it's a
+// command the bot understands is only known once the repository's aliases
+// are, so RunCommand checks that.
+func ParseCommandRun(conf Config, args []string) (CommandRun, error) {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	repo := flags.String("repo", "", "the repository of the PR, in the owner/name format")
+	pr := flags.Int("pr", 0, "the number of the PR")
+	command := flags.String("command", "", "the command to run, e.g. '!squash'")
+	actor := flags.String("as", "", "the user to run the command on behalf of (defaults to the token's owner)")
+	if err := flags.Parse(args); err != nil {
+		return CommandRun{}, err
+	} else if flags.NArg() > 0 {
+		return CommandRun{}, fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	} else if !repositoryKeyRegexp.MatchString(*repo) {
+		return CommandRun{}, fmt.Errorf("--repo must be in the owner/name format, got %q", *repo)
+	} else if *pr < 1 {
+		return CommandRun{}, errors.New("--pr must be the number of a PR")
+	} else if _, isCommand := normalizeCommand(conf, *command); !isCommand {
+		return CommandRun{}, fmt.Errorf("--command must start with one of %s, got %q",
+			strings.Join(conf.CommandPrefixes, ", "), *command)
+	}
+	parts := strings.SplitN(*repo, "/", 2)
+	return CommandRun{
+		Repository:  Repository{Owner: parts[0], Name: parts[1]},
+		PullRequest: *pr,
+		Command:     *command,
+		Actor:       *actor,
+	}, nil
+}
+
+// RunCommand runs the command on the PR through the same code path as a
+// command commented on the PR, including the authorization checks and the
+// audit log, but without the webhook's deduplication and rate limiting.
+// Asynchronous operations are added to asyncOperationWg, which the caller
+// should wait for.
+func RunCommand(conf Config, run CommandRun, store Store, scheduler *Scheduler, errorReporter ErrorReporter,
+	auditLog AuditLog, asyncOperationWg *sync.WaitGroup, gitRepos git.Repos, pullRequests PullRequests,
+	repositories Repositories, issues Issues, search Search, graphQL GraphQL) Response {
+
+	command, _ := normalizeCommand(conf, run.Command)
+	commandContext := WebhookContext{
+		Event:       "cli",
+		Repository:  run.Repository,
+		PullRequest: run.PullRequest,
+		Command:     strings.TrimSpace(strings.SplitN(strings.TrimSpace(command), "\n", 2)[0]),
+		Actor:       run.Actor,
+	}
+	reporter := webhookReporter{errorReporter, ErrorReport{WebhookContext: commandContext}}
+	retry := func(repository Repository, operation func() asyncResponse) MaybeSyncResponse {
+		return delayWithRetries(conf.GithubAPITryDeltas, repository, operation, scheduler, reporter,
+			asyncOperationWg)
+	}
+	pullRequests, issues = retryGithubMutations(conf, pullRequests, issues)
+	audit := auditor{auditLog, commandContext}
+	gitRepos, pullRequests, repositories, issues = auditClients(audit, gitRepos, pullRequests, repositories, issues)
+
+	response := reporter.run(func() Response {
+		conf, errResp := repositoryConfig(conf, run.Repository, store)
+		if errResp != nil {
+			return errResp
+		}
+		pr, errResp := getPR(Issue{Number: run.PullRequest, Repository: run.Repository}, pullRequests)
+		if errResp != nil {
+			return errResp
+		}
+		var labels []string
+		for _, label := range pr.Labels {
+			labels = append(labels, label.GetName())
+		}
+		// The handlers parse the commands in the "!merge" form, with the
+		// repository's aliases resolved
+		repositoryCommand, _ := normalizeCommand(conf, run.Command)
+		issueComment := IssueComment{
+			Action:        "created",
+			IssueNumber:   run.PullRequest,
+			Comment:       repositoryCommand,
+			IsPullRequest: true,
+			Labels:        labels,
+			Repository: Repository{
+				Owner: run.Repository.Owner,
+				Name:  run.Repository.Name,
+				URL:   pr.GetBase().GetRepo().GetSSHURL(),
+			},
+			User:      User{Login: pr.GetUser().GetLogin()},
+			Commenter: User{Login: run.Actor},
+		}
+		commentCategory := parseComment(issueComment.Comment)
+		if commentCategory == regularComment {
+			return ErrorResponse{fmt.Errorf("%q is not a command I understand", run.Command),
+				http.StatusBadRequest, "Not a command I understand"}
+		} else if successResp, errResp := checkUserAuthorization(conf, issueComment, commentCategory, store, issues,
+			pullRequests, repositories, graphQL); errResp != nil {
+			return errResp
+		} else if successResp != nil {
+			return successResp
+		}
+		publishEvent(conf, BusEvent{
+			Type:        CommandReceivedEvent,
+			Repository:  repositoryKey(run.Repository),
+			PullRequest: run.PullRequest,
+			Actor:       run.Actor,
+			Command:     commandNames[commentCategory],
+		}, store)
+		response := handleCommand(conf, issueComment, commentCategory, retry, gitRepos, store, pullRequests,
+			repositories, issues, search, graphQL)
+		recordCommandUse(issueComment, commentCategory, response, store)
+		return response
+	})
+	audit.recordCommand(response)
+	return response
+}
+
+// runCommandLine runs `github-review-helper run` with the arguments and
+// returns the exit code.
+func runCommandLine(conf Config, args []string) int {
+	run, err := ParseCommandRun(conf, args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\nUsage: github-review-helper run --repo owner/name --pr 123 --command '!squash' "+
+			"[--as login]\n", err)
+		return 2
+	}
+	errorReporter, err := NewErrorReporter(conf)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	auditLog, err := NewAuditLog(conf)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	httpClient, err := initGithubHTTPClient(conf)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	githubClient := github.NewClient(httpClient)
+	var owner *github.User
+	if run.Actor == "" {
+		owner, _, err = githubClient.Users.Get(context.TODO(), "")
+		if err != nil {
+			log.Printf("Failed to get the owner of the access token: %v\n", err)
+			return 1
+		}
+		run.Actor = owner.GetLogin()
+	} else {
+		owner = tokenOwner(httpClient)
+	}
+	reposDir, err := ioutil.TempDir("", "github-review-helper")
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	defer os.RemoveAll(reposDir)
+	gitRepos, pullRequests := limitResources(conf,
+		newGitRepos(conf, reposDir, gitIdentity(conf, owner)), githubClient.PullRequests)
+	// Sharing the server's state, e.g. a chosen merge method, if it's kept in
+	// SQLITE_PATH
+	store, err := NewStore(conf)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	var asyncOperationWg sync.WaitGroup
+	log.Printf("Running %s on %s#%d as %s\n", run.Command, repositoryKey(run.Repository), run.PullRequest,
+		run.Actor)
+	response := RunCommand(conf, run, store, NewScheduler(conf.AsyncConcurrency, conf.RepositoryWeights),
+		errorReporter, auditLog, &asyncOperationWg, gitRepos, pullRequests, githubClient.Repositories,
+		githubClient.Issues, githubClient.Search, NewGraphQLClient(httpClient))
+	response.logResponse()
+	// Retried operations finish in the background
+	asyncOperationWg.Wait()
+	errorReporter.Flush(panicReportFlushTimeout)
+	if _, isError := asErrorResponse(response); isError {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,124 @@
+package main_test
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("run subcommand", func() {
+	defaultPrefixes := grh.Config{CommandPrefixes: []string{"!"}}
+
+	Describe("ParseCommandRun", func() {
+		It("parses the repository, the PR, the command and the actor", func() {
+			run, err := grh.ParseCommandRun(defaultPrefixes, []string{"--repo", "salemove/api", "--pr", "123", "--command",
+				"!squash", "--as", "alice"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(run).To(Equal(grh.CommandRun{
+				Repository:  grh.Repository{Owner: "salemove", Name: "api"},
+				PullRequest: 123,
+				Command:     "!squash",
+				Actor:       "alice",
+			}))
+		})
+
+		It("fails without a PR", func() {
+			_, err := grh.ParseCommandRun(defaultPrefixes, []string{"--repo", "salemove/api", "--command", "!squash"})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("fails with a repository in the wrong format", func() {
+			_, err := grh.ParseCommandRun(defaultPrefixes, []string{"--repo", "api", "--pr", "123", "--command", "!squash"})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("fails with something that isn't a command", func() {
+			_, err := grh.ParseCommandRun(defaultPrefixes, []string{"--repo", "salemove/api", "--pr", "123",
+				"--command", "squash"})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("accepts the configured command prefixes", func() {
+			conf := grh.Config{CommandPrefixes: []string{"/", "@review-helper"}}
+			_, err := grh.ParseCommandRun(conf, []string{"--repo", "salemove/api", "--pr", "123", "--command",
+				"@review-helper squash"})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = grh.ParseCommandRun(conf, []string{"--repo", "salemove/api", "--pr", "123", "--command",
+				"!squash"})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("RunCommand", func() {
+		var (
+			pullRequests *mocks.PullRequests
+			repositories *mocks.Repositories
+			issues       *mocks.Issues
+			auditLog     grh.AuditLog
+		)
+
+		BeforeEach(func() {
+			pullRequests = new(mocks.PullRequests)
+			repositories = new(mocks.Repositories)
+			issues = new(mocks.Issues)
+			var err error
+			auditLog, err = grh.NewAuditLog(grh.Config{})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			pullRequests.AssertExpectations(GinkgoT())
+			repositories.AssertExpectations(GinkgoT())
+			issues.AssertExpectations(GinkgoT())
+		})
+
+		It("runs the command like a comment on the PR and audits it in the \"!\" form", func() {
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+				Return(&github.PullRequest{
+					Number: github.Int(issueNumber),
+					User:   &github.User{Login: github.String(arbitraryIssueAuthor)},
+					Base: &github.PullRequestBranch{
+						Ref:  github.String("master"),
+						Repo: repository,
+					},
+				}, emptyResponse, noError)
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+			issues.
+				On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+					mock.MatchedBy(commentContaining("I understand these commands"))).
+				Return(emptyResult, emptyResponse, noError).
+				Once()
+
+			errorReporter, err := grh.NewErrorReporter(grh.Config{})
+			Expect(err).NotTo(HaveOccurred())
+			var asyncOperationWg sync.WaitGroup
+			conf := grh.Config{GithubAPITryDeltas: []time.Duration{0}, CommandPrefixes: []string{"/"}}
+			response := grh.RunCommand(conf, grh.CommandRun{
+				Repository:  grh.Repository{Owner: repositoryOwner, Name: repositoryName},
+				PullRequest: issueNumber,
+				Command:     "/help",
+				Actor:       "alice",
+			}, grh.NewMemoryStore(), grh.NewScheduler(0, nil), errorReporter, auditLog, &asyncOperationWg,
+				new(mocks.Repos), pullRequests, repositories, issues, new(mocks.Search), new(mocks.GraphQL))
+			asyncOperationWg.Wait()
+
+			Expect(response).To(BeAssignableToTypeOf(grh.SuccessResponse{}))
+			entries, err := auditLog.Entries(grh.AuditFilter{})
+			Expect(err).NotTo(HaveOccurred())
+			command := entries[len(entries)-1]
+			Expect(command.Action).To(Equal("command"))
+			Expect(command.Actor).To(Equal("alice"))
+			Expect(command.Details).To(Equal("!help"))
+		})
+	})
+})
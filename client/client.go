@@ -0,0 +1,221 @@
+// Package client is a client for the admin API of github-review-helper, for
+// scripting the bot's policies and reading its audit log without hand-rolled
+// HTTP requests.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls the admin API of the bot at BaseURL, e.g.
+// "https://review-helper.example.com". The requests authenticate with the
+// bot's ADMIN_TOKEN.
+type Client struct {
+	BaseURL    string
+	Token      string
+	HTTPClient *http.Client
+}
+
+// New creates a client with a default HTTP client.
+func New(baseURL, token string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Token:      token,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Policy maps the names of the policy settings, e.g. "required_approvals", to
+// their values. Settings that aren't set are left out.
+type Policy map[string]interface{}
+
+// PolicySet holds the policies of organizations and repositories.
+type PolicySet struct {
+	// Organizations maps owner to the policy of all of the owner's
+	// repositories
+	Organizations map[string]Policy `json:"organizations"`
+	// Repositories maps owner/name to the repository's policy
+	Repositories map[string]Policy `json:"repositories"`
+}
+
+// PolicyChanges lists the organizations and repositories whose policies an
+// import added, changed or removed.
+type PolicyChanges struct {
+	Added   []string `json:"added"`
+	Changed []string `json:"changed"`
+	Removed []string `json:"removed"`
+}
+
+// EffectivePolicy is the policy that applies to a repository and the layers
+// it was merged from. A layer is nil, if there's no policy for it.
+type EffectivePolicy struct {
+	Repository string `json:"repository"`
+	Effective  Policy `json:"effective"`
+	Layers     struct {
+		Global       Policy  `json:"global"`
+		Organization *Policy `json:"organization"`
+		Repository   *Policy `json:"repository"`
+	} `json:"layers"`
+}
+
+// AuditEntry is an action the bot took.
+type AuditEntry struct {
+	Time        time.Time `json:"time"`
+	Actor       string    `json:"actor,omitempty"`
+	Action      string    `json:"action"`
+	Repository  string    `json:"repository,omitempty"`
+	PullRequest int       `json:"pull_request,omitempty"`
+	Details     string    `json:"details,omitempty"`
+	DeliveryID  string    `json:"delivery_id,omitempty"`
+	Outcome     string    `json:"outcome"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// AuditFilter selects audit entries. Zero values match everything and a zero
+// Limit returns the bot's default number of the latest entries.
+type AuditFilter struct {
+	Repository  string
+	PullRequest int
+	Since       time.Time
+	Limit       int
+}
+
+// CommandStat is the number of times a command was handled with an outcome,
+// "success" or "failure", in a repository on a UTC day.
+type CommandStat struct {
+	Repository string    `json:"repository"`
+	Command    string    `json:"command"`
+	Outcome    string    `json:"outcome"`
+	Day        time.Time `json:"day"`
+	Count      int       `json:"count"`
+}
+
+// CommandStats is the usage of the commands since Since. Commands lists the
+// commands' totals with the most failing ones first.
+type CommandStats struct {
+	Since    time.Time `json:"since"`
+	Commands []struct {
+		Command  string `json:"command"`
+		Uses     int    `json:"uses"`
+		Failures int    `json:"failures"`
+	} `json:"commands"`
+	Daily []CommandStat `json:"daily"`
+}
+
+// Error is returned when the bot responds with an error status.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("the admin API responded with %d: %s", e.StatusCode, e.Message)
+}
+
+// Policies exports the organization and repository policies.
+func (c *Client) Policies(ctx context.Context) (PolicySet, error) {
+	var policies PolicySet
+	err := c.do(ctx, http.MethodGet, "/admin/policies", nil, nil, &policies)
+	return policies, err
+}
+
+// ImportPolicies replaces all of the policies with the set. With dryRun, the
+// policies are left as they are and only the changes are reported.
+func (c *Client) ImportPolicies(ctx context.Context, policies PolicySet, dryRun bool) (PolicyChanges, error) {
+	query := url.Values{}
+	if dryRun {
+		query.Set("dry_run", "true")
+	}
+	var changes PolicyChanges
+	err := c.do(ctx, http.MethodPut, "/admin/policies", query, policies, &changes)
+	return changes, err
+}
+
+// EffectivePolicy returns the policy that applies to the repository, given
+// in the owner/name format.
+func (c *Client) EffectivePolicy(ctx context.Context, repository string) (EffectivePolicy, error) {
+	var policy EffectivePolicy
+	err := c.do(ctx, http.MethodGet, "/admin/policies/effective", url.Values{"repository": {repository}}, nil,
+		&policy)
+	return policy, err
+}
+
+// AuditLog returns the latest audit entries matching the filter.
+func (c *Client) AuditLog(ctx context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	query := url.Values{}
+	if filter.Repository != "" {
+		query.Set("repository", filter.Repository)
+	}
+	if filter.PullRequest != 0 {
+		query.Set("pull_request", strconv.Itoa(filter.PullRequest))
+	}
+	if !filter.Since.IsZero() {
+		query.Set("since", filter.Since.Format(time.RFC3339))
+	}
+	if filter.Limit != 0 {
+		query.Set("limit", strconv.Itoa(filter.Limit))
+	}
+	var entries []AuditEntry
+	err := c.do(ctx, http.MethodGet, "/admin/audit-log", query, nil, &entries)
+	return entries, err
+}
+
+// CommandStats returns the usage of the commands since the time, in only the
+// repository, given in the owner/name format, unless it's empty. A zero since
+// returns the bot's default of the last 30 days.
+func (c *Client) CommandStats(ctx context.Context, repository string, since time.Time) (CommandStats, error) {
+	query := url.Values{}
+	if repository != "" {
+		query.Set("repository", repository)
+	}
+	if !since.IsZero() {
+		query.Set("since", since.Format(time.RFC3339))
+	}
+	var stats CommandStats
+	err := c.do(ctx, http.MethodGet, "/admin/command-stats", query, nil, &stats)
+	return stats, err
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, result interface{}) error {
+	requestURL := c.BaseURL + path
+	if len(query) > 0 {
+		requestURL += "?" + query.Encode()
+	}
+	var bodyReader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		bodyReader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequest(method, requestURL, bodyReader)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
@@ -0,0 +1,89 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/salemove/github-review-helper/client"
+)
+
+func TestAuditLog(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "Please provide a valid admin token", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/admin/audit-log" {
+			t.Errorf("Expected the audit log to be requested, got %s", r.URL.Path)
+		}
+		expectedQuery := "limit=5&pull_request=7&repository=salemove%2Fgrh&since=2026-01-02T15%3A04%3A05Z"
+		if r.URL.RawQuery != expectedQuery {
+			t.Errorf("Expected the query %s, got %s", expectedQuery, r.URL.RawQuery)
+		}
+		w.Write([]byte(`[{"time":"2026-01-02T16:00:00Z","action":"merge","repository":"salemove/grh",` +
+			`"pull_request":7,"outcome":"success"}]`))
+	}))
+	defer server.Close()
+
+	entries, err := client.New(server.URL+"/", "secret").AuditLog(context.Background(), client.AuditFilter{
+		Repository:  "salemove/grh",
+		PullRequest: 7,
+		Since:       time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC),
+		Limit:       5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Action != "merge" || entries[0].PullRequest != 7 {
+		t.Errorf("Expected the merge of #7, got %+v", entries)
+	}
+}
+
+func TestImportPolicies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Query().Get("dry_run") != "true" {
+			t.Errorf("Expected a dry run import, got %s %s", r.Method, r.URL)
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		var policies client.PolicySet
+		if err := json.Unmarshal(body, &policies); err != nil {
+			t.Fatal(err)
+		}
+		if policies.Repositories["salemove/grh"]["required_approvals"] != 2.0 {
+			t.Errorf("Expected 2 required approvals, got %s", body)
+		}
+		w.Write([]byte(`{"added":["salemove/grh"],"changed":[],"removed":[]}`))
+	}))
+	defer server.Close()
+
+	changes, err := client.New(server.URL, "secret").ImportPolicies(context.Background(), client.PolicySet{
+		Repositories: map[string]client.Policy{"salemove/grh": {"required_approvals": 2}},
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes.Added) != 1 || changes.Added[0] != "salemove/grh" {
+		t.Errorf("Expected salemove/grh to be added, got %+v", changes)
+	}
+}
+
+func TestError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `repository must be in the owner/name format, got "grh"`, http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	_, err := client.New(server.URL, "secret").EffectivePolicy(context.Background(), "grh")
+	apiErr, ok := err.(*client.Error)
+	if !ok || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected a bad request error, got %v", err)
+	}
+	if apiErr.Message != `repository must be in the owner/name format, got "grh"` {
+		t.Errorf("Expected the error message to be kept, got %q", apiErr.Message)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+
+	"github.com/salemove/github-review-helper/git"
+)
+
+// commandWords are the words the commands start with, e.g. "!simulate" for
+// "!simulate merge"
+var commandWords = func() map[string]bool {
+	words := map[string]bool{}
+	for _, name := range commandNames {
+		words[strings.Fields(name)[0]] = true
+	}
+	return words
+}()
+
+// splitCommands splits a comment into the commands it issues, one per line,
+// e.g. "!label +urgent" and "!merge". The lines that don't start with a
+// command, and the ones inside a quoted argument, e.g. a multi-line merge
+// message, belong to the command before them. The commands are returned in
+// the "!merge" form, whichever prefix or alias was used. Returns nil, if the
+// comment doesn't start with a command.
+func splitCommands(conf Config, comment string) []string {
+	var commands []string
+	for _, line := range strings.Split(strings.TrimLeftFunc(comment, unicode.IsSpace), "\n") {
+		command, isCommand := normalizeCommand(conf, line)
+		last := len(commands) - 1
+		if isCommand && commandWords[strings.Fields(command)[0]] &&
+			(last < 0 || !hasOpenQuote(commands[last])) {
+
+			commands = append(commands, command)
+		} else if last < 0 {
+			return nil
+		} else {
+			commands[last] += "\n" + line
+		}
+	}
+	return commands
+}
+
+// parseCommandBatch returns the commands the comment issues, if it issues
+// several commands and all of them are ones the bot understands. Comments
+// with a single command are handled as they always were, so that the lines
+// after the command keep belonging to it.
+func parseCommandBatch(conf Config, comment string) ([]string, bool) {
+	commands := splitCommands(conf, comment)
+	if len(commands) < 2 {
+		return nil, false
+	}
+	for _, command := range commands {
+		if parseComment(command) == regularComment {
+			return nil, false
+		}
+	}
+	return commands, true
+}
+
+// hasOpenQuote reports whether the command has a quoted argument that isn't
+// closed yet. Quotes escaped with a backslash don't count.
+func hasOpenQuote(command string) bool {
+	open := false
+	for i := 0; i < len(command); i++ {
+		switch command[i] {
+		case '\\':
+			i++
+		case '"':
+			open = !open
+		}
+	}
+	return open
+}
+
+// handleCommandBatch handles a comment that issues several commands, one per
+// line, in order. Every command is authorized and counted on its own, but
+// the comment is only acknowledged once: with the received reaction when the
+// first command is accepted and with the outcome reaction once all of them
+// are done. The commands after one that fails aren't run, because they may
+// depend on it, e.g. "!merge" on "!label +urgent".
+func handleCommandBatch(conf Config, issueComment IssueComment, commands []string, retry retryGithubOperation,
+	gitRepos git.Repos, store Store, limiter *commandRateLimiter, pullRequests PullRequests,
+	repositories Repositories, issues Issues, search Search, graphQL GraphQL) Response {
+
+	// The comment is a single round-trip, so it counts as a single command
+	// towards the rate limit
+	if response := checkCommandRateLimit(conf, issueComment, limiter, issues); response != nil {
+		return response
+	}
+	acknowledged := false
+	handled := 0
+	var response Response
+	for _, command := range commands {
+		commandComment := issueComment
+		commandComment.Comment = command
+		commentCategory := parseComment(command)
+		if issuedBeforeEdit(conf, commandComment) {
+			response = SuccessResponse{fmt.Sprintf("%s was issued before the comment was edited. Ignoring.",
+				commandNames[commentCategory])}
+			response.logResponse()
+			continue
+		}
+		commandID := commentCommandID(commandComment)
+		if response = claimDelivery(conf, commandID, store); response != nil {
+			if _, failed := asErrorResponse(response); failed {
+				break
+			}
+			response.logResponse()
+			continue
+		}
+		successResp, errResp := checkUserAuthorization(conf, commandComment, commentCategory, store, issues,
+			pullRequests, repositories, graphQL)
+		if errResp != nil {
+			response = errResp
+			break
+		} else if successResp != nil {
+			response = successResp
+			response.logResponse()
+			continue
+		}
+		if conf.CommandReactions != nil && !acknowledged {
+			reactToCommand(conf, issueComment, conf.CommandReactions.Received, graphQL)
+		}
+		acknowledged = true
+		publishEvent(conf, BusEvent{
+			Type:        CommandReceivedEvent,
+			Repository:  repositoryKey(issueComment.Repository),
+			PullRequest: issueComment.IssueNumber,
+			Actor:       issueComment.Commenter.Login,
+			Command:     commandNames[commentCategory],
+		}, store)
+		response = handleCommand(conf, commandComment, commentCategory, retry, gitRepos, store, pullRequests,
+			repositories, issues, search, graphQL)
+		recordCommandUse(commandComment, commentCategory, response, store)
+		releaseFailedDelivery(conf, commandID, response, store)
+		if _, failed := asErrorResponse(response); failed {
+			break
+		}
+		log.Printf("Handled %s of the batch in PR %s:\n", commandNames[commentCategory],
+			issueComment.Issue().FullName())
+		response.logResponse()
+		handled++
+	}
+	if acknowledged {
+		reactToCommandOutcome(conf, issueComment, response, graphQL)
+	}
+	if _, failed := asErrorResponse(response); failed {
+		return response
+	}
+	return SuccessResponse{fmt.Sprintf("Handled %d of the %d commands in the comment", handled, len(commands))}
+}
@@ -0,0 +1,127 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("a comment with several commands", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+			graphQL          *mocks.GraphQL
+
+			addedLabels []string
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			repositories = *context.Repositories
+			issues = *context.Issues
+			graphQL = *context.GraphQL
+
+			addedLabels = nil
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent(`!label +urgent\n!hold`, arbitraryIssueAuthor)
+		})
+
+		mockAddLabel := func(label string, err error) {
+			issues.
+				On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{label}).
+				Return(emptyResult, emptyResponse, err).
+				Run(func(mock.Arguments) {
+					addedLabels = append(addedLabels, label)
+				})
+		}
+
+		It("runs the commands in order", func() {
+			mockAddLabel("urgent", noError)
+			mockAddLabel(grh.OnHoldLabel, noError)
+
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			Expect(responseRecorder.Body.String()).To(ContainSubstring("Handled 2 of the 2 commands"))
+			Expect(addedLabels).To(Equal([]string{"urgent", grh.OnHoldLabel}))
+		})
+
+		It("doesn't run the commands after one that fails", func() {
+			mockAddLabel("urgent", errArbitrary)
+
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusBadGateway))
+			Expect(addedLabels).To(Equal([]string{"urgent"}))
+		})
+
+		Context("with COMMAND_REACTIONS", func() {
+			BeforeEach(func() {
+				context.Config.CommandReactions = &grh.CommandReactions{
+					Received:  "eyes",
+					Succeeded: "rocket",
+					Failed:    "confused",
+				}
+			})
+
+			expectReaction := func(content string) {
+				graphQL.
+					On("Query", anyContext, mock.MatchedBy(func(query string) bool {
+						return strings.Contains(query, "addReaction")
+					}), map[string]interface{}{"subjectId": commentNodeID, "content": content}, mock.Anything).
+					Return(noError).
+					Once()
+			}
+
+			It("acknowledges the comment once", func() {
+				expectReaction("EYES")
+				expectReaction("ROCKET")
+				mockAddLabel("urgent", noError)
+				mockAddLabel(grh.OnHoldLabel, noError)
+
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				graphQL.AssertExpectations(GinkgoT())
+				graphQL.AssertNumberOfCalls(GinkgoT(), "Query", 2)
+			})
+		})
+
+		Context("with a line that only continues the command before it", func() {
+			requestJSON.Is(func() string {
+				return IssueCommentEvent(`!label +urgent\n+blocked`, arbitraryIssueAuthor)
+			})
+
+			It("handles the comment as a single command", func() {
+				issues.
+					On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+						[]string{"urgent", "blocked"}).
+					Return(emptyResult, emptyResponse, noError).
+					Once()
+
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+			})
+		})
+	})
+})
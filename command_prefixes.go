@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// normalizeCommand rewrites a comment that starts with one of
+// COMMAND_PREFIXES, e.g. "/merge" or "@review-helper merge", into the "!merge"
+// form the commands are parsed in, resolving the repository's command
+// aliases on the way. The second return value is false, if the comment
+// doesn't start with any of the prefixes, in which case it's a regular
+// comment, even if it starts with "!".
+func normalizeCommand(conf Config, comment string) (string, bool) {
+	trimmed := strings.TrimLeftFunc(comment, unicode.IsSpace)
+	for _, prefix := range conf.CommandPrefixes {
+		rest, ok := stripCommandPrefix(trimmed, prefix)
+		if !ok {
+			continue
+		}
+		word := rest
+		if i := strings.IndexFunc(rest, unicode.IsSpace); i >= 0 {
+			word = rest[:i]
+		}
+		if command, isAlias := conf.CommandAliases[word]; isAlias {
+			rest = command + rest[len(word):]
+		}
+		return "!" + rest, true
+	}
+	return comment, false
+}
+
+// stripCommandPrefix returns the comment without the prefix. Mentions, e.g.
+// "@review-helper", are matched regardless of case and have to be followed by
+// whitespace, so that "@review-helpers" wouldn't match.
+func stripCommandPrefix(comment, prefix string) (string, bool) {
+	if !strings.HasPrefix(prefix, "@") {
+		if !strings.HasPrefix(comment, prefix) {
+			return "", false
+		}
+		return comment[len(prefix):], true
+	}
+	if len(comment) <= len(prefix) || !strings.EqualFold(comment[:len(prefix)], prefix) {
+		return "", false
+	}
+	rest := comment[len(prefix):]
+	if trimmed := strings.TrimLeftFunc(rest, unicode.IsSpace); trimmed != rest {
+		return trimmed, true
+	}
+	return "", false
+}
+
+// validateCommandAliases checks that the aliases are single words that map to
+// commands the bot understands, optionally with arguments, e.g. "ship" to
+// "merge squash".
+func validateCommandAliases(aliases map[string]string) error {
+	for alias, command := range aliases {
+		if alias == "" || strings.IndexFunc(alias, unicode.IsSpace) >= 0 {
+			return fmt.Errorf("aliases must be single words, got \"%s\"", alias)
+		} else if !isCommandName(command) {
+			return fmt.Errorf("aliases must map to commands, e.g. \"merge\", got \"%s\"", command)
+		}
+	}
+	return nil
+}
+
+func isCommandName(command string) bool {
+	command = "!" + strings.TrimSpace(command)
+	for _, name := range commandNames {
+		if command == name || strings.HasPrefix(command, name+" ") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("COMMAND_PREFIXES and COMMAND_ALIASES", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			issues           *mocks.Issues
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			issues = *context.Issues
+			context.Config.CommandPrefixes = []string{"/", "@review-helper"}
+			context.Config.CommandAliases = map[string]string{"pause": "hold"}
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+
+		expectHold := func(comment string) {
+			Context("with a "+comment+" comment", func() {
+				requestJSON.Is(func() string {
+					return IssueCommentEvent(comment, arbitraryIssueAuthor)
+				})
+
+				ForCollaborator(context, repositoryOwner, repositoryName, arbitraryIssueAuthor, func() {
+					BeforeEach(func() {
+						issues.
+							On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+								[]string{grh.OnHoldLabel}).
+							Return(emptyResult, emptyResponse, noError)
+					})
+
+					It("puts the PR on hold and audits the command in the \"!\" form", func() {
+						handle()
+						Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+						issues.AssertExpectations(GinkgoT())
+
+						entries, err := (*context.AuditLog).Entries(grh.AuditFilter{})
+						Expect(err).NotTo(HaveOccurred())
+						Expect(entries).NotTo(BeEmpty())
+						command := entries[len(entries)-1]
+						Expect(command.Action).To(Equal("command"))
+						Expect(command.Details).To(Equal("!hold"))
+					})
+				})
+			})
+		}
+
+		expectHold("/hold")
+		expectHold("@Review-Helper hold")
+		expectHold("/pause")
+
+		Context("with a comment using a prefix that isn't configured", func() {
+			requestJSON.Is(func() string {
+				return IssueCommentEvent("!hold", arbitraryIssueAuthor)
+			})
+
+			It("ignores the comment", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(responseRecorder.Body.String()).To(ContainSubstring("Not a command I understand"))
+			})
+		})
+
+		Context("with a mention of another user starting with the bot's login", func() {
+			requestJSON.Is(func() string {
+				return IssueCommentEvent("@review-helpers hold", arbitraryIssueAuthor)
+			})
+
+			It("ignores the comment", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(responseRecorder.Body.String()).To(ContainSubstring("Not a command I understand"))
+			})
+		})
+	})
+})
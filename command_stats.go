@@ -0,0 +1,139 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// commandStatsRetention is how long the daily command counts are kept for
+const commandStatsRetention = 90 * 24 * time.Hour
+
+// defaultCommandStatsPeriod is how far back /admin/command-stats looks
+// without the since query parameter
+const defaultCommandStatsPeriod = 30 * 24 * time.Hour
+
+// commandOutcomes counts the handled commands by their name and outcome, e.g.
+// "!merge:failure"
+var commandOutcomes = expvar.NewMap("command_outcomes")
+
+// commandNames are the names the commands are counted by in the usage
+// statistics
+var commandNames = map[commentType]string{
+	squashCommand:             "!squash",
+	mergeCommand:              "!merge",
+	checkCommand:              "!check",
+	holdCommand:               "!hold",
+	unholdCommand:             "!unhold",
+	blockCommand:              "!block",
+	unblockCommand:            "!unblock",
+	dependsOnCommand:          "!depends-on",
+	priorityCommand:           "!priority",
+	whoseTurnCommand:          "!whose-turn",
+	statusCommand:             "!status",
+	simulateMergeCommand:      "!simulate merge",
+	summaryCommand:            "!summary",
+	assignCommand:             "!assign",
+	unassignCommand:           "!unassign",
+	titleCommand:              "!title",
+	labelCommand:              "!label",
+	remindCommand:             "!remind",
+	confirmCommand:            "!confirm",
+	cherryPickCommand:         "!cherry-pick",
+	revertCommand:             "!revert",
+	selfTestCommand:           "!selftest",
+	rerunChecksCommand:        "!rerun-checks",
+	dcoOverrideCommand:        "!dco-override",
+	deployCommand:             "!deploy",
+	lockCommand:               "!lock",
+	unlockCommand:             "!unlock",
+	protectCommand:            "!protect",
+	approveContributorCommand: "!approve-contributor",
+	claSignedCommand:          "!cla-signed",
+	helpCommand:               "!help",
+}
+
+// CommandSummary is the total usage of a command over the requested period
+type CommandSummary struct {
+	Command  string `json:"command"`
+	Uses     int    `json:"uses"`
+	Failures int    `json:"failures"`
+}
+
+// CommandStatsReport is the response of /admin/command-stats. Commands lists
+// the commands that failed most often first.
+type CommandStatsReport struct {
+	Since    time.Time        `json:"since"`
+	Commands []CommandSummary `json:"commands"`
+	Daily    []CommandStat    `json:"daily"`
+}
+
+// recordCommandUse counts the command and the outcome of handling it in the
+// usage statistics. Failing to store the count is only logged, because the
+// statistics aren't worth failing the command for.
+func recordCommandUse(issueComment IssueComment, commentCategory commentType, response Response, store Store) {
+	command, ok := commandNames[commentCategory]
+	if !ok {
+		return
+	}
+	outcome := "success"
+	if _, failed := asErrorResponse(response); failed {
+		outcome = "failure"
+	}
+	commandOutcomes.Add(command+":"+outcome, 1)
+	repository := issueComment.Repository
+	if err := store.RecordCommandUse(repository, command, outcome, time.Now()); err != nil {
+		log.Printf("Failed to record the use of %s in %s: %v\n", command, repositoryKey(repository), err)
+	}
+}
+
+// getCommandStats reports the command usage since the since query parameter
+// (RFC 3339), optionally in only the repository (owner/name) query
+// parameter's repository.
+func getCommandStats(r *http.Request, store Store) Response {
+	query := r.URL.Query()
+	since := time.Now().Add(-defaultCommandStatsPeriod)
+	if value := query.Get("since"); value != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, value); err != nil {
+			message := fmt.Sprintf("since must be an RFC 3339 timestamp, got %q", value)
+			return ErrorResponse{err, http.StatusBadRequest, message}
+		}
+	}
+	stats, err := store.CommandStats(since)
+	if err != nil {
+		return ErrorResponse{err, http.StatusInternalServerError, "Failed to list the command statistics"}
+	}
+	report := CommandStatsReport{Since: since, Commands: []CommandSummary{}, Daily: []CommandStat{}}
+	summaries := map[string]*CommandSummary{}
+	repository := query.Get("repository")
+	for _, stat := range stats {
+		if repository != "" && stat.Repository != repository {
+			continue
+		}
+		report.Daily = append(report.Daily, stat)
+		summary, exists := summaries[stat.Command]
+		if !exists {
+			summary = &CommandSummary{Command: stat.Command}
+			summaries[stat.Command] = summary
+		}
+		summary.Uses += stat.Count
+		if stat.Outcome == "failure" {
+			summary.Failures += stat.Count
+		}
+	}
+	for _, summary := range summaries {
+		report.Commands = append(report.Commands, *summary)
+	}
+	sort.Slice(report.Commands, func(i, j int) bool {
+		a, b := report.Commands[i], report.Commands[j]
+		if a.Failures != b.Failures {
+			return a.Failures > b.Failures
+		}
+		return a.Command < b.Command
+	})
+	return jsonResponse{report}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+const githubStatusCommitMessageContext = "review/commit-message"
+
+// conventionalCommitRule is the value of COMMIT_MESSAGE_RULE that checks the
+// commit messages against the Conventional Commits rules.
+const conventionalCommitRule = "conventional"
+
+// conventionalCommitRegexp matches the subject lines in the "type(scope)!:
+// description" format of https://www.conventionalcommits.org, where the
+// scope and the "!" are optional.
+var conventionalCommitRegexp = regexp.MustCompile(
+	`^(build|chore|ci|docs|feat|fix|perf|refactor|revert|style|test)(\([\w$.\-*/ ]+\))?!?: \S`)
+
+// ParseCommitMessageRule parses the rule the commit messages of PRs must
+// follow. The rule is either "conventional" or a regular expression the
+// commit messages must match. An empty rule disables the check and results
+// in nil.
+func ParseCommitMessageRule(rule string) (*regexp.Regexp, error) {
+	if rule == "" {
+		return nil, nil
+	} else if rule == conventionalCommitRule {
+		return conventionalCommitRegexp, nil
+	}
+	return regexp.Compile(rule)
+}
+
+// lintCommitMessages creates a status reporting whether the messages of the
+// commits follow the configured rule. The fixup! and squash! commits are
+// skipped, because they're squashed into the commits they fix before the PR
+// is merged. Returns nil, if the check is disabled.
+func lintCommitMessages(conf Config, commits []*github.RepositoryCommit) *github.RepoStatus {
+	if conf.CommitMessageRule == nil {
+		return nil
+	}
+	var invalid []string
+	for _, commit := range commits {
+		message := commit.Commit.GetMessage()
+		if isFixupCommitMessage(message) || conf.CommitMessageRule.MatchString(message) {
+			continue
+		}
+		invalid = append(invalid, shortSHA(commit.GetSHA()))
+	}
+	if len(invalid) == 0 {
+		return createCommitMessageStatus("success", "All commit messages follow the rules")
+	}
+	return createCommitMessageStatus("failure", fmt.Sprintf("Commit messages not following the rules: %s",
+		strings.Join(invalid, ", ")))
+}
+
+func isFixupCommitMessage(message string) bool {
+	return strings.HasPrefix(message, "fixup! ") || strings.HasPrefix(message, "squash! ")
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+func createCommitMessageStatus(state, description string) *github.RepoStatus {
+	// GitHub limits the descriptions of statuses to 140 characters
+	if len(description) > 140 {
+		description = description[:137] + "..."
+	}
+	return &github.RepoStatus{
+		State:       github.String(state),
+		Description: github.String(description),
+		Context:     github.String(githubStatusCommitMessageContext),
+	}
+}
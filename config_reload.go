@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// ConfigSource provides the configuration to handle a webhook with. A Config
+// is a source of itself, while a ConfigReloader provides the latest
+// configuration it has loaded.
+type ConfigSource interface {
+	Current() Config
+}
+
+func (c Config) Current() Config {
+	return c
+}
+
+// ConfigReloader loads the configuration and loads it again on demand, e.g.
+// on SIGHUP, so that the configuration could be changed without interrupting
+// ongoing merges.
+type ConfigReloader struct {
+	mutex sync.RWMutex
+	conf  Config
+}
+
+// NewConfigReloader loads the initial configuration. Like NewConfig, it
+// panics if the configuration is invalid.
+func NewConfigReloader() *ConfigReloader {
+	if _, err := loadConfigFile(); err != nil {
+		panic(fmt.Sprintf("Failed to load CONFIG_FILE: %v", err))
+	}
+	return &ConfigReloader{conf: NewConfig()}
+}
+
+func (r *ConfigReloader) Current() Config {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.conf
+}
+
+// setBotLogin records the login of the account the bot acts as, which is only
+// known once the GitHub client has been created.
+func (r *ConfigReloader) setBotLogin(login string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.conf.BotLogin = login
+}
+
+// Reload loads the configuration again, including CONFIG_FILE. If the
+// configuration is invalid, the current configuration is kept and the error
+// returned. The settings that are only used at startup, e.g. the port and the
+// tokens, keep their current values until restart.
+func (r *ConfigReloader) Reload() (Config, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	previousFileValues, err := loadConfigFile()
+	if err != nil {
+		return r.conf, fmt.Errorf("Failed to load CONFIG_FILE: %v", err)
+	}
+	conf, err := LoadConfig()
+	if err != nil {
+		setConfigFileValues(previousFileValues)
+		return r.conf, err
+	}
+	r.conf = conf.withStartupSettings(r.conf)
+	return r.conf, nil
+}
+
+// withStartupSettings keeps the settings of the given configuration that the
+// servers, clients and background jobs were started with.
+func (c Config) withStartupSettings(startup Config) Config {
+	c.Port = startup.Port
+	c.AccessTokens = startup.AccessTokens
+	c.BotLogin = startup.BotLogin
+	c.Tenants = startup.Tenants
+	c.DebugPort = startup.DebugPort
+	c.DebugToken = startup.DebugToken
+	c.AdminToken = startup.AdminToken
+	c.OTLPEndpoint = startup.OTLPEndpoint
+	c.AuditLogPath = startup.AuditLogPath
+	c.SQLitePath = startup.SQLitePath
+	c.SentryDSN = startup.SentryDSN
+	c.SentryEnvironment = startup.SentryEnvironment
+	c.CommandRateLimit = startup.CommandRateLimit
+	c.CommandRateLimitPeriod = startup.CommandRateLimitPeriod
+	c.AsyncConcurrency = startup.AsyncConcurrency
+	c.RepositoryWeights = startup.RepositoryWeights
+	c.LockRedisURL = startup.LockRedisURL
+	c.LockTTL = startup.LockTTL
+	c.TLSCertFile = startup.TLSCertFile
+	c.TLSKeyFile = startup.TLSKeyFile
+	c.ACMEHostname = startup.ACMEHostname
+	c.ACMEEmail = startup.ACMEEmail
+	c.ACMECacheDir = startup.ACMECacheDir
+	c.ACMEHTTPPort = startup.ACMEHTTPPort
+	c.WebhookReadTimeout = startup.WebhookReadTimeout
+	c.MaxGitOperations = startup.MaxGitOperations
+	c.MaxRepoGitOperations = startup.MaxRepoGitOperations
+	c.MaxMerges = startup.MaxMerges
+	c.MaxRepoMerges = startup.MaxRepoMerges
+	c.PartialCloneRepositories = startup.PartialCloneRepositories
+	c.SparseCheckoutPaths = startup.SparseCheckoutPaths
+	c.EventBus = startup.EventBus
+	c.GithubFixturesMode = startup.GithubFixturesMode
+	c.GithubFixturesPath = startup.GithubFixturesPath
+	c.OutboundProxy = startup.OutboundProxy
+	c.OutboundNoProxy = startup.OutboundNoProxy
+	// Switching the merge trains off would land the cars behind the front
+	// along with the cars ahead of them
+	c.MergeTrain = startup.MergeTrain
+	c.UpdateQueuedBranches = startup.UpdateQueuedBranches
+	// The background jobs keep ticking at the intervals they were started
+	// with
+	c.GarbageCollectionInterval = startup.GarbageCollectionInterval
+	c.ReviewLoadReportInterval = startup.ReviewLoadReportInterval
+	c.StalePRCheckInterval = startup.StalePRCheckInterval
+	c.GithubStatusCheckInterval = startup.GithubStatusCheckInterval
+	return c
+}
+
+// reloadConfigOnSignal reloads the configuration whenever the process
+// receives a SIGHUP.
+func reloadConfigOnSignal(reloader *ConfigReloader, stop <-chan struct{}) {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-hangups:
+			if _, err := reloader.Reload(); err != nil {
+				log.Printf("Failed to reload the configuration, keeping the current one: %v\n", err)
+			} else {
+				log.Println("Reloaded the configuration")
+			}
+		}
+	}
+}
+
+// CreateConfigReloadHandler creates a handler that reloads the configuration
+// on POST /admin/reload-config. The requests have to authenticate with the
+// token as a bearer token.
+func CreateConfigReloadHandler(token string, reloader *ConfigReloader, auditLog AuditLog) http.Handler {
+	return requireBearerToken(token, "admin", Handler(func(w http.ResponseWriter, r *http.Request) Response {
+		if r.Method != http.MethodPost {
+			return ErrorResponse{nil, http.StatusMethodNotAllowed, "Only POST is supported"}
+		}
+		_, err := reloader.Reload()
+		auditor{auditLog, WebhookContext{}}.record("reload-config", Repository{}, 0, "", err)
+		if err != nil {
+			return ErrorResponse{err, http.StatusBadRequest, fmt.Sprintf("Failed to reload the configuration: %v",
+				err)}
+		}
+		return SuccessResponse{"Reloaded the configuration"}
+	}))
+}
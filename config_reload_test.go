@@ -0,0 +1,221 @@
+package main_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	grh "github.com/salemove/github-review-helper"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ConfigReloader", func() {
+	configFile := filepath.Join(os.TempDir(), "github-review-helper-config.env")
+
+	writeConfigFile := func(content string) {
+		Expect(ioutil.WriteFile(configFile, []byte(content), 0600)).To(Succeed())
+	}
+
+	var reloader *grh.ConfigReloader
+
+	// Declared before the variables are set, so that the configuration
+	// file's values would be cleared before the variables are restored
+	AfterEach(func() {
+		writeConfigFile("")
+		_, err := reloader.Reload()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Remove(configFile)).To(Succeed())
+	})
+
+	setEnvVars(requiredEnvVars)
+	setEnvVar(envVar{name: "CONFIG_FILE", value: configFile})
+	setEnvVar(envVar{name: "MERGE_QUEUE_MAX_DEPTH", value: "3"})
+
+	BeforeEach(func() {
+		writeConfigFile(`
+# Only these repositories for now
+ALLOWED_REPOSITORIES = "salemove/api"
+MERGE_QUEUE_MAX_DEPTH=5
+PORT=8080
+`)
+		reloader = grh.NewConfigReloader()
+	})
+
+	It("loads the settings from the config file", func() {
+		Expect(reloader.Current().AllowedRepositories).To(Equal([]string{"salemove/api"}))
+		Expect(reloader.Current().Port).To(Equal(8080))
+	})
+
+	It("prefers the environment to the config file", func() {
+		Expect(reloader.Current().MergeQueueMaxDepth).To(Equal(3))
+	})
+
+	Context("after the config file has changed", func() {
+		BeforeEach(func() {
+			writeConfigFile("ALLOWED_REPOSITORIES=salemove\nREQUIRED_APPROVALS=2\nPORT=9090\n")
+		})
+
+		It("applies the changes on reload", func() {
+			conf, err := reloader.Reload()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conf.AllowedRepositories).To(Equal([]string{"salemove"}))
+			Expect(conf.RequiredApprovals).To(Equal(2))
+			Expect(reloader.Current()).To(Equal(conf))
+		})
+
+		It("keeps the startup settings until restart", func() {
+			conf, err := reloader.Reload()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conf.Port).To(Equal(8080))
+		})
+
+		Context("with a background job's interval changed", func() {
+			BeforeEach(func() {
+				writeConfigFile("GARBAGE_COLLECTION_INTERVAL=1m\n")
+			})
+
+			It("keeps the interval the job was started with", func() {
+				startupInterval := reloader.Current().GarbageCollectionInterval
+				conf, err := reloader.Reload()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(conf.GarbageCollectionInterval).To(Equal(startupInterval))
+			})
+		})
+	})
+
+	Context("after a setting has been removed from the config file", func() {
+		BeforeEach(func() {
+			writeConfigFile("PORT=8080\n")
+		})
+
+		It("falls back to the default", func() {
+			conf, err := reloader.Reload()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conf.AllowedRepositories).To(BeEmpty())
+		})
+	})
+
+	Context("after the config file has been made invalid", func() {
+		BeforeEach(func() {
+			writeConfigFile("ALLOWED_REPOSITORIES=salemove\nREQUIRED_APPROVALS=many\n")
+		})
+
+		It("keeps the current configuration", func() {
+			_, err := reloader.Reload()
+			Expect(err).To(HaveOccurred())
+			Expect(reloader.Current().AllowedRepositories).To(Equal([]string{"salemove/api"}))
+		})
+	})
+
+	Describe("reload endpoint", func() {
+		var responseRecorder *httptest.ResponseRecorder
+
+		BeforeEach(func() {
+			writeConfigFile("ALLOWED_REPOSITORIES=salemove\n")
+			auditLog, err := grh.NewAuditLog(grh.Config{})
+			Expect(err).NotTo(HaveOccurred())
+			request := httptest.NewRequest("POST", "/admin/reload-config", nil)
+			request.Header.Set("Authorization", "Bearer admin-token")
+			responseRecorder = httptest.NewRecorder()
+			grh.CreateConfigReloadHandler("admin-token", reloader, auditLog).ServeHTTP(responseRecorder, request)
+		})
+
+		It("reloads the configuration", func() {
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			Expect(reloader.Current().AllowedRepositories).To(Equal([]string{"salemove"}))
+		})
+	})
+})
+
+var _ = Describe("LoadConfig", func() {
+	setEnvVars(requiredEnvVars)
+
+	Context("with several invalid settings", func() {
+		setEnvVar(envVar{name: "PORT", value: "leet"})
+		setEnvVar(envVar{name: "MERGE_STRATEGY", value: "squash"})
+
+		It("reports all of them at once", func() {
+			_, err := grh.LoadConfig()
+			Expect(err).To(BeAssignableToTypeOf(grh.ConfigError{}))
+			Expect(err.(grh.ConfigError).Problems).To(HaveLen(2))
+			Expect(err.Error()).To(ContainSubstring("PORT"))
+			Expect(err.Error()).To(ContainSubstring("MERGE_STRATEGY"))
+		})
+	})
+
+	Context("with flags", func() {
+		setEnvVar(envVar{name: "PORT", value: "8080"})
+
+		BeforeEach(func() {
+			Expect(grh.ParseConfigFlags([]string{"--port", "9090", "--allowed-repositories=salemove"})).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(grh.ParseConfigFlags(nil)).To(Succeed())
+		})
+
+		It("prefers the flags to the environment", func() {
+			conf, err := grh.LoadConfig()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conf.Port).To(Equal(9090))
+			Expect(conf.AllowedRepositories).To(Equal([]string{"salemove"}))
+		})
+	})
+
+	Context("with an unknown flag", func() {
+		It("fails", func() {
+			Expect(grh.ParseConfigFlags([]string{"--merge-strategie", "merge"})).NotTo(Succeed())
+		})
+	})
+})
+
+var _ = Describe("ReadConfigFile", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "config-file")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	readConfigFile := func(name, content string) (map[string]string, error) {
+		path := filepath.Join(dir, name)
+		Expect(ioutil.WriteFile(path, []byte(content), 0600)).To(Succeed())
+		return grh.ReadConfigFile(path)
+	}
+
+	It("reads YAML files with lists", func() {
+		values, err := readConfigFile("config.yaml", `
+allowed_repositories:
+  - salemove
+  - deiwin/dotfiles
+REQUIRED_APPROVALS: 2
+sticky_comments: true
+`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(values).To(Equal(map[string]string{
+			"ALLOWED_REPOSITORIES": "salemove,deiwin/dotfiles",
+			"REQUIRED_APPROVALS":   "2",
+			"STICKY_COMMENTS":      "true",
+		}))
+	})
+
+	It("reads KEY=VALUE files", func() {
+		values, err := readConfigFile("config.env", "# Comment\nREQUIRED_APPROVALS='2'\n")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(values).To(Equal(map[string]string{"REQUIRED_APPROVALS": "2"}))
+	})
+
+	It("reports unknown settings", func() {
+		_, err := readConfigFile("config.yml", "required_aprovals: 2\nconfig_file: other.yml\n")
+		Expect(err).To(MatchError("unknown settings: CONFIG_FILE, REQUIRED_APROVALS"))
+	})
+})
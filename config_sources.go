@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// The path of the configuration file, either a YAML file (.yaml or .yml) or
+// a file of KEY=VALUE lines. It can only be set with a flag or in the
+// environment.
+var configFileProperty = newProperty("CONFIG_FILE", "")
+
+// properties holds every configuration variable, so that each of them could
+// be set with a flag and in the configuration file
+var properties []*property
+
+// configSources holds the values of the configuration variables set with the
+// command line flags and in the configuration file, keyed by the variables'
+// names
+var configSources struct {
+	sync.RWMutex
+	flags map[string]string
+	file  map[string]string
+}
+
+// property is a configuration variable, e.g. PORT. Its value is taken from
+// the first of the command line flags, the environment and the configuration
+// file that sets it.
+type property struct {
+	name         string
+	defaultValue string
+	required     bool
+}
+
+func newProperty(name, defaultValue string) *property {
+	p := &property{name: name, defaultValue: defaultValue}
+	properties = append(properties, p)
+	return p
+}
+
+func newRequiredProperty(name string) *property {
+	p := newProperty(name, "")
+	p.required = true
+	return p
+}
+
+// Value returns the value of the variable or its default, if no source sets
+// it. Empty values count as not set.
+func (p *property) Value() string {
+	if value, ok := p.lookup(); ok {
+		return value
+	}
+	return p.defaultValue
+}
+
+func (p *property) lookup() (string, bool) {
+	configSources.RLock()
+	defer configSources.RUnlock()
+	if value := configSources.flags[p.name]; value != "" {
+		return value, true
+	} else if value := os.Getenv(p.name); value != "" {
+		return value, true
+	} else if value := configSources.file[p.name]; value != "" {
+		return value, true
+	}
+	return "", false
+}
+
+// flagName is the name of the command line flag that sets the variable, e.g.
+// allowed-repositories for ALLOWED_REPOSITORIES.
+func (p *property) flagName() string {
+	return strings.ToLower(strings.Replace(p.name, "_", "-", -1))
+}
+
+// ConfigError lists all of the problems with an invalid configuration.
+type ConfigError struct {
+	Problems []string
+}
+
+func (e ConfigError) Error() string {
+	return "Invalid configuration:\n - " + strings.Join(e.Problems, "\n - ")
+}
+
+// configLoader collects the problems found while loading the configuration,
+// so that they could be reported all at once instead of one per restart.
+type configLoader struct {
+	problems []string
+}
+
+func (l *configLoader) fail(format string, args ...interface{}) {
+	l.problems = append(l.problems, fmt.Sprintf(format, args...))
+}
+
+func (l *configLoader) err() error {
+	if len(l.problems) == 0 {
+		return nil
+	}
+	return ConfigError{l.problems}
+}
+
+func (l *configLoader) checkRequiredProperties() {
+	for _, p := range properties {
+		if _, ok := p.lookup(); p.required && !ok {
+			l.fail("%s is required", p.name)
+		}
+	}
+}
+
+// ParseConfigFlags parses the command line flags that set the configuration
+// variables, e.g. --port 8080 or --allowed-repositories=salemove. The flags
+// take precedence over the environment and the configuration file.
+func ParseConfigFlags(args []string) error {
+	flags := flag.NewFlagSet("github-review-helper", flag.ContinueOnError)
+	values := make(map[string]string)
+	for _, p := range properties {
+		name := p.name
+		flags.Func(p.flagName(), fmt.Sprintf("sets %s", name), func(value string) error {
+			values[name] = value
+			return nil
+		})
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	} else if flags.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+	configSources.Lock()
+	defer configSources.Unlock()
+	configSources.flags = values
+	return nil
+}
+
+// loadConfigFile reads the configuration file, if one is set, for the
+// variables to fall back to. It returns the values it replaced, so that they
+// could be restored.
+func loadConfigFile() (map[string]string, error) {
+	values := make(map[string]string)
+	if path := strings.TrimSpace(configFileProperty.Value()); path != "" {
+		var err error
+		if values, err = ReadConfigFile(path); err != nil {
+			return nil, err
+		}
+	}
+	return setConfigFileValues(values), nil
+}
+
+func setConfigFileValues(values map[string]string) map[string]string {
+	configSources.Lock()
+	defer configSources.Unlock()
+	previous := configSources.file
+	configSources.file = values
+	return previous
+}
+
+// ReadConfigFile reads the configuration variables from a YAML file, if the
+// path ends with .yaml or .yml, or from a file of KEY=VALUE lines otherwise.
+// The YAML file is a mapping of the variables' names, in either case, to
+// their values. Lists are joined with commas. Unknown variables are
+// reported as errors.
+func ReadConfigFile(path string) (map[string]string, error) {
+	var (
+		values map[string]string
+		err    error
+	)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		values, err = readYAMLConfigFile(path)
+	default:
+		values, err = readEnvConfigFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool)
+	for _, p := range properties {
+		known[p.name] = true
+	}
+	var unknown []string
+	for name := range values {
+		if !known[name] || name == configFileProperty.name {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown settings: %s", strings.Join(unknown, ", "))
+	}
+	return values, nil
+}
+
+func readYAMLConfigFile(path string) (map[string]string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var document map[string]interface{}
+	if err = yaml.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	for key, value := range document {
+		name := strings.ToUpper(key)
+		switch value := value.(type) {
+		case nil:
+			values[name] = ""
+		case []interface{}:
+			elements := make([]string, len(value))
+			for i, element := range value {
+				elements[i] = fmt.Sprint(element)
+			}
+			values[name] = strings.Join(elements, ",")
+		case map[interface{}]interface{}:
+			return nil, fmt.Errorf("%s must be a value or a list of values", key)
+		default:
+			values[name] = fmt.Sprint(value)
+		}
+	}
+	return values, nil
+}
+
+// readEnvConfigFile reads a file of KEY=VALUE lines. Empty lines and lines
+// starting with # are skipped and quotes around the values are removed.
+func readEnvConfigFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("line %d must be in the KEY=VALUE format, got \"%s\"", lineNumber, line)
+		}
+		value := strings.TrimSpace(line[i+1:])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[strings.TrimSpace(line[:i])] = value
+	}
+	return values, scanner.Err()
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// handlePushEvent checks the PRs labeled with "merging" into the pushed
+// branch for merge conflicts, if CONFLICT_WATCHDOG is enabled, so that their
+// authors would hear about the conflicts before the bot tries to merge them.
+// The PRs based on a deleted branch are retargeted and a push to the default
+// branch invalidates the cached OWNERS_FILE.
+func handlePushEvent(conf Config, body []byte, retry retryGithubOperation, store Store, issues Issues,
+	pullRequests PullRequests, graphQL GraphQL) Response {
+
+	pushEvent, err := parsePushEvent(body)
+	if err != nil {
+		return ErrorResponse{err, http.StatusInternalServerError, "Failed to parse the request's body"}
+	}
+	handleOwnersFilePush(conf, pushEvent, store)
+	if pushEvent.Deleted && strings.HasPrefix(pushEvent.Ref, "refs/heads/") {
+		return retargetOrphanedPRs(conf, pushEvent.Repository, strings.TrimPrefix(pushEvent.Ref, "refs/heads/"),
+			graphQL)
+	} else if !conf.ConflictWatchdog {
+		return SuccessResponse{"Not watching for conflicts. Ignoring."}
+	} else if !strings.HasPrefix(pushEvent.Ref, "refs/heads/") || pushEvent.Deleted {
+		return SuccessResponse{"Push doesn't update a branch. Ignoring."}
+	}
+	baseRef := strings.TrimPrefix(pushEvent.Ref, "refs/heads/")
+	// GitHub checks the mergeability of the PRs asynchronously after the
+	// push, so the check is retried until it has checked all of them
+	maybeSyncResponse := retry(pushEvent.Repository, func() asyncResponse {
+		return checkQueuedPRsForConflicts(pushEvent.Repository, baseRef, store, issues, pullRequests)
+	})
+	if maybeSyncResponse.OperationFinishedSynchronously {
+		return maybeSyncResponse.Response
+	}
+	return SuccessResponse{fmt.Sprintf("Will check the PRs queued for merging into %s for conflicts "+
+		"asynchronously", baseRef)}
+}
+
+func checkQueuedPRsForConflicts(repository Repository, baseRef string, store Store, issues Issues,
+	pullRequests PullRequests) asyncResponse {
+
+	queued, err := queuedPRs(repository, issues)
+	if err != nil {
+		return retriable(ErrorResponse{err, http.StatusBadGateway, "Failed to list the PRs queued for merging"})
+	}
+	unchecked := 0
+	conflicted := 0
+	for _, issue := range queued {
+		pr, errResp := getPR(issue, pullRequests)
+		if errResp != nil {
+			return retriable(errResp)
+		} else if pr.Base.GetRef() != baseRef {
+			continue
+		} else if pr.Mergeable == nil {
+			unchecked++
+			continue
+		} else if *pr.Mergeable {
+			continue
+		}
+		conflicted++
+		if errResp = notifyConflict(pr, store, issues); errResp != nil {
+			return nonRetriable(errResp)
+		}
+	}
+	if unchecked > 0 {
+		return retriable(SuccessResponse{fmt.Sprintf("GitHub hasn't checked %d of the PRs queued for merging "+
+			"into %s for conflicts yet", unchecked, baseRef)})
+	}
+	return nonRetriable(SuccessResponse{fmt.Sprintf("Found %d conflicted PRs queued for merging into %s",
+		conflicted, baseRef)})
+}
+
+// notifyConflict tells the PR's author that the PR has a merge conflict with
+// its base branch. Every head is only commented on once, so that later pushes
+// to the base branch wouldn't repeat it.
+func notifyConflict(pr *github.PullRequest, store Store, issues Issues) *ErrorResponse {
+	issue := prIssue(pr)
+	isNew, err := store.RecordRefusal(issue, pr.Head.GetSHA()+" conflicts with "+pr.Base.GetRef())
+	if err != nil {
+		message := fmt.Sprintf("Failed to record the merge conflict of PR %s", issue.FullName())
+		return &ErrorResponse{err, http.StatusInternalServerError, message}
+	} else if !isNew {
+		return nil
+	}
+	message := fmt.Sprintf("@%s, this PR has a merge conflict with `%s` now, so I can't merge it. Merge `%[2]s` into "+
+		"it or rebase it onto `%[2]s` to resolve the conflict.", pr.User.GetLogin(), pr.Base.GetRef())
+	if err = comment(message, issue.Repository, issue.Number, issues); err != nil {
+		errorMessage := fmt.Sprintf("Failed to notify the author of PR %s of the merge conflict", issue.FullName())
+		return &ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	return nil
+}
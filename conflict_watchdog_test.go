@@ -0,0 +1,137 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	var (
+		handle      = context.Handle
+		headers     = context.Headers
+		requestJSON = context.RequestJSON
+
+		responseRecorder *httptest.ResponseRecorder
+		pullRequests     *mocks.PullRequests
+		issues           *mocks.Issues
+	)
+	BeforeEach(func() {
+		responseRecorder = *context.ResponseRecorder
+		pullRequests = *context.PullRequests
+		issues = *context.Issues
+	})
+
+	queuedPR := func(baseRef string, mergeable *bool) *github.PullRequest {
+		return &github.PullRequest{
+			Number:    github.Int(issueNumber),
+			Mergeable: mergeable,
+			User:      &github.User{Login: github.String(arbitraryIssueAuthor)},
+			Base:      &github.PullRequestBranch{Ref: github.String(baseRef), Repo: repository},
+			Head:      &github.PullRequestBranch{SHA: github.String("1235"), Repo: repository},
+		}
+	}
+
+	Describe("push event", func() {
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "push",
+			}
+		})
+		requestJSON.Is(func() string {
+			return `{
+  "ref": "refs/heads/master",
+  "before": "1111",
+  "after": "2222",
+  "deleted": false,
+  "repository": {
+    "name": "` + repositoryName + `",
+    "owner": {
+      "login": "` + repositoryOwner + `"
+    },
+    "ssh_url": "` + sshURL + `"
+  }
+}`
+		})
+
+		It("ignores the push without CONFLICT_WATCHDOG", func() {
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			Expect(responseRecorder.Body.String()).To(ContainSubstring("Not watching for conflicts"))
+		})
+
+		Context("with CONFLICT_WATCHDOG", func() {
+			BeforeEach(func() {
+				context.Config.ConflictWatchdog = true
+				issues.
+					On("ListByRepo", anyContext, repositoryOwner, repositoryName,
+						mock.AnythingOfType("*github.IssueListByRepoOptions")).
+					Return([]*github.Issue{
+						{Number: github.Int(issueNumber), PullRequestLinks: &github.PullRequestLinks{}},
+					}, emptyResponse, noError)
+			})
+
+			Context("with a queued PR that conflicts with the pushed branch", func() {
+				BeforeEach(func() {
+					pullRequests.
+						On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+						Return(queuedPR("master", nil), emptyResponse, noError).
+						Once()
+					pullRequests.
+						On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+						Return(queuedPR("master", github.Bool(false)), emptyResponse, noError)
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("@"+arbitraryIssueAuthor+", this PR has a merge "+
+								"conflict with `master`"))).
+						Return(emptyResult, emptyResponse, noError).
+						Once()
+				})
+
+				It("notifies the author once GitHub has checked the PR", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				})
+
+				It("doesn't notify the author again on later pushes", func() {
+					handle()
+					handle()
+					issues.AssertNumberOfCalls(GinkgoT(), "CreateComment", 1)
+				})
+			})
+
+			Context("with a queued PR that is still mergeable", func() {
+				BeforeEach(func() {
+					pullRequests.
+						On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+						Return(queuedPR("master", github.Bool(true)), emptyResponse, noError)
+				})
+
+				It("doesn't comment", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					Expect(responseRecorder.Body.String()).To(ContainSubstring("Found 0 conflicted PRs"))
+				})
+			})
+
+			Context("with a conflicted PR queued for another branch", func() {
+				BeforeEach(func() {
+					pullRequests.
+						On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+						Return(queuedPR("release", github.Bool(false)), emptyResponse, noError)
+				})
+
+				It("doesn't comment", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				})
+			})
+		})
+	})
+})
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/salemove/github-review-helper/evaluator"
+	"github.com/salemove/github-review-helper/git"
+)
+
+// The name of the gate that holds back the PRs of first-time contributors
+// until a maintainer approves them
+const contributorApprovalGate = "contributor approval"
+
+// contributorApprovalCommands are the commands that change or run code of a
+// first-time contributor's PR and are refused until a maintainer approves
+// the PR
+var contributorApprovalCommands = map[commentType]bool{
+	squashCommand:      true,
+	mergeCommand:       true,
+	deployCommand:      true,
+	rerunChecksCommand: true,
+}
+
+// isFirstTimeContributor reports whether the author_association marks the PR's
+// author as a newcomer to the repository or to GitHub altogether.
+func isFirstTimeContributor(authorAssociation string) bool {
+	return authorAssociation == "FIRST_TIME_CONTRIBUTOR" || authorAssociation == "FIRST_TIMER"
+}
+
+func isApproveContributorCommand(comment string) bool {
+	return strings.TrimSpace(comment) == "!approve-contributor"
+}
+
+// handleFirstTimeContribution greets the author of a newly opened PR, if it's
+// their first contribution, and records the PR, so that it would be left
+// alone until a maintainer approves it, with REQUIRE_CONTRIBUTOR_APPROVAL.
+func handleFirstTimeContribution(conf Config, pullRequestEvent PullRequestEvent, store Store,
+	issues Issues) *ErrorResponse {
+
+	if !isFirstTimeContributor(pullRequestEvent.AuthorAssociation) ||
+		(!conf.GreetFirstTimeContributors && !conf.RequireContributorApproval) {
+		return nil
+	}
+	issue := pullRequestEvent.Issue()
+	if conf.RequireContributorApproval {
+		err := store.SetFirstTimeContribution(FirstTimeContribution{
+			Issue:    issue,
+			Author:   pullRequestEvent.User.Login,
+			OpenedAt: time.Now(),
+		})
+		if err != nil {
+			errorMessage := fmt.Sprintf("Failed to record PR %s as a first-time contribution", issue.FullName())
+			return &ErrorResponse{err, http.StatusInternalServerError, errorMessage}
+		}
+	}
+	if !conf.GreetFirstTimeContributors {
+		return nil
+	}
+	message := renderMessage(conf, firstTimeContributorMessage, MessageData{
+		Repository: issue.Repository,
+		PR:         issue.Number,
+		Author:     pullRequestEvent.User.Login,
+		Version:    version,
+		Details:    map[string]interface{}{"ApprovalRequired": conf.RequireContributorApproval},
+	})
+	if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+		errorMessage := fmt.Sprintf("Failed to greet the first-time contributor of PR %s", issue.FullName())
+		return &ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	return nil
+}
+
+// revokeContributionApproval withdraws the approval of a first-time
+// contributor's PR when new commits are pushed to it, because the maintainer
+// only approved the code they saw. The author is told that the PR has to be
+// approved again.
+func revokeContributionApproval(conf Config, pullRequestEvent PullRequestEvent, store Store,
+	issues Issues) *ErrorResponse {
+
+	if !conf.RequireContributorApproval {
+		return nil
+	}
+	issue := pullRequestEvent.Issue()
+	contribution, exists, err := store.FirstTimeContribution(issue)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Failed to get the contribution record of PR %s", issue.FullName())
+		return &ErrorResponse{err, http.StatusInternalServerError, errorMessage}
+	} else if !exists || contribution.ApprovedBy == "" {
+		return nil
+	}
+	approvedBy := contribution.ApprovedBy
+	contribution.ApprovedBy = ""
+	if err = store.SetFirstTimeContribution(contribution); err != nil {
+		errorMessage := fmt.Sprintf("Failed to revoke the contribution approval of PR %s", issue.FullName())
+		return &ErrorResponse{err, http.StatusInternalServerError, errorMessage}
+	}
+	log.Printf("Revoked %s's approval of the first-time contribution in PR %s after new commits\n", approvedBy,
+		issue.FullName())
+	message := fmt.Sprintf("@%s, @%s approved the commits this PR had before, so a maintainer has to approve the "+
+		"new ones with `!approve-contributor` again.", contribution.Author, approvedBy)
+	if err = comment(message, issue.Repository, issue.Number, issues); err != nil {
+		errorMessage := fmt.Sprintf("Failed to report the revoked contribution approval of PR %s", issue.FullName())
+		return &ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	return nil
+}
+
+// unapprovedContribution returns the PR's record as a first-time
+// contribution, if REQUIRE_CONTRIBUTOR_APPROVAL holds it back, or nil.
+func unapprovedContribution(conf Config, issue Issue, store Store) (*FirstTimeContribution, *ErrorResponse) {
+	if !conf.RequireContributorApproval {
+		return nil, nil
+	}
+	contribution, exists, err := store.FirstTimeContribution(issue)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Failed to get the contribution record of PR %s", issue.FullName())
+		return nil, &ErrorResponse{err, http.StatusInternalServerError, errorMessage}
+	} else if !exists || contribution.ApprovedBy != "" {
+		return nil, nil
+	}
+	return &contribution, nil
+}
+
+// isApprovedContribution reports whether a maintainer has approved the PR of
+// a first-time contributor, which lets commands be issued on the PR, even
+// though its author isn't a collaborator.
+func isApprovedContribution(conf Config, issue Issue, store Store) (bool, error) {
+	if !conf.RequireContributorApproval {
+		return false, nil
+	}
+	contribution, exists, err := store.FirstTimeContribution(issue)
+	if err != nil {
+		return false, err
+	}
+	return exists && contribution.ApprovedBy != "", nil
+}
+
+// refuseUnapprovedContribution refuses the commands that change or run the
+// code of a first-time contributor's PR that hasn't been approved yet.
+func refuseUnapprovedContribution(conf Config, issueComment IssueComment, commentCategory commentType,
+	store Store, issues Issues) (*SuccessResponse, *ErrorResponse) {
+
+	if !contributorApprovalCommands[commentCategory] {
+		return nil, nil
+	}
+	contribution, errResp := unapprovedContribution(conf, issueComment.Issue(), store)
+	if errResp != nil || contribution == nil {
+		return nil, errResp
+	}
+	message := fmt.Sprintf("@%s, this is @%s's first contribution, so I won't `%s` it until a maintainer "+
+		"approves it with `!approve-contributor`.", issueComment.Commenter.Login, contribution.Author,
+		commandNames[commentCategory])
+	if err := comment(message, issueComment.Repository, issueComment.IssueNumber, issues); err != nil {
+		return nil, &ErrorResponse{err, http.StatusBadGateway, "Failed to respond to the unapproved command"}
+	}
+	return &SuccessResponse{fmt.Sprintf("PR %s is an unapproved first-time contribution. Responded with a "+
+		"comment. Ignoring the command.", issueComment.Issue().FullName())}, nil
+}
+
+// handleApproveContributorCommand approves the PR of a first-time
+// contributor, so that the bot would squash, deploy and merge it like any
+// other PR. A PR that was already labeled for merging is merged right away,
+// if it's ready. Only maintainers can issue the command, unless
+// COMMAND_PERMISSIONS says otherwise.
+func handleApproveContributorCommand(conf Config, issueComment IssueComment, store Store, issues Issues,
+	pullRequests PullRequests, repositories Repositories, graphQL GraphQL, gitRepos git.Repos) Response {
+
+	issue := issueComment.Issue()
+	contribution, errResp := unapprovedContribution(conf, issue, store)
+	if errResp != nil {
+		return errResp
+	} else if contribution == nil {
+		message := fmt.Sprintf("@%s, this PR isn't waiting for a first-time contributor's approval.",
+			issueComment.Commenter.Login)
+		if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+			errorMessage := fmt.Sprintf("Failed to respond to the contributor approval on PR %s", issue.FullName())
+			return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+		}
+		return SuccessResponse{"PR not waiting for a contributor approval. Responded with a comment."}
+	}
+	contribution.ApprovedBy = issueComment.Commenter.Login
+	if err := store.SetFirstTimeContribution(*contribution); err != nil {
+		errorMessage := fmt.Sprintf("Failed to approve the contribution of PR %s", issue.FullName())
+		return ErrorResponse{err, http.StatusInternalServerError, errorMessage}
+	}
+	log.Printf("%s approved the first-time contribution of %s in PR %s\n", contribution.ApprovedBy,
+		contribution.Author, issue.FullName())
+	if !issueComment.HasLabel(MergingLabel) {
+		return SuccessResponse{fmt.Sprintf("Approved the first-time contribution of PR %s", issue.FullName())}
+	}
+	return mergeIfReady(conf, issue, true, store, issues, pullRequests, repositories, graphQL, gitRepos)
+}
+
+// checkContributorApproval keeps a first-time contributor's PR pending until
+// a maintainer approves it.
+func checkContributorApproval(ctx GateContext) (evaluator.Result, *ErrorResponse) {
+	contribution, errResp := unapprovedContribution(ctx.Config, prIssue(ctx.PR), ctx.Store)
+	if errResp != nil {
+		return evaluator.Result{}, errResp
+	} else if contribution != nil {
+		return pending(fmt.Sprintf("it's @%s's first contribution and a maintainer hasn't approved it with "+
+			"`!approve-contributor` yet", contribution.Author)), nil
+	}
+	return passed(), nil
+}
@@ -0,0 +1,246 @@
+package main_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	var (
+		handle      = context.Handle
+		headers     = context.Headers
+		requestJSON = context.RequestJSON
+
+		responseRecorder *httptest.ResponseRecorder
+		pullRequests     *mocks.PullRequests
+		repositories     *mocks.Repositories
+		issues           *mocks.Issues
+		graphQL          *mocks.GraphQL
+		store            grh.Store
+	)
+	BeforeEach(func() {
+		responseRecorder = *context.ResponseRecorder
+		pullRequests = *context.PullRequests
+		repositories = *context.Repositories
+		issues = *context.Issues
+		graphQL = *context.GraphQL
+		store = *context.Store
+	})
+
+	issue := grh.Issue{
+		Number: issueNumber,
+		Repository: grh.Repository{
+			Owner: repositoryOwner,
+			Name:  repositoryName,
+			URL:   sshURL,
+		},
+	}
+
+	recordContribution := func(approvedBy string) {
+		err := store.SetFirstTimeContribution(grh.FirstTimeContribution{
+			Issue:      issue,
+			Author:     arbitraryIssueAuthor,
+			OpenedAt:   time.Now(),
+			ApprovedBy: approvedBy,
+		})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	Describe("pull_request opened event by a first-time contributor", func() {
+		headSHA := "1235"
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "pull_request",
+			}
+		})
+		requestJSON.Is(func() string {
+			return strings.Replace(PullRequestEvent("opened", headSHA, issue.Repository), `"pull_request": {`,
+				`"pull_request": {
+    "author_association": "FIRST_TIME_CONTRIBUTOR",`, 1)
+		})
+
+		BeforeEach(func() {
+			context.Config.GreetFirstTimeContributors = true
+			context.Config.RequireContributorApproval = true
+
+			pullRequests.
+				On("ListCommits", anyContext, repositoryOwner, repositoryName, issueNumber,
+					mock.AnythingOfType("*github.ListOptions")).
+				Return(githubCommits(commit{headSHA, "Changing things"}), emptyResponse, noError)
+			repositories.
+				On("CreateStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+					mock.MatchedBy(func(status *github.RepoStatus) bool {
+						return status.GetContext() == "review/squash"
+					})).
+				Return(emptyResult, emptyResponse, noError)
+		})
+
+		It("greets the author and holds the PR back until it's approved", func() {
+			issues.
+				On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+					mock.MatchedBy(func(comment *github.IssueComment) bool {
+						return commentContaining("Welcome, @"+arbitraryIssueAuthor)(comment) &&
+							commentContaining("!approve-contributor")(comment)
+					})).
+				Return(emptyResult, emptyResponse, noError)
+
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			issues.AssertExpectations(GinkgoT())
+			contribution, exists, err := store.FirstTimeContribution(issue)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeTrue())
+			Expect(contribution.Author).To(Equal(arbitraryIssueAuthor))
+			Expect(contribution.ApprovedBy).To(BeEmpty())
+		})
+
+		Context("with greeting the author failing", func() {
+			BeforeEach(func() {
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber, mock.Anything).
+					Return(emptyResult, emptyResponse, errArbitrary)
+			})
+
+			It("still checks the PR for fixup commits", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				repositories.AssertExpectations(GinkgoT())
+			})
+		})
+	})
+
+	Describe("pull_request synchronize event on an approved first-time contribution", func() {
+		headSHA := "1236"
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "pull_request",
+			}
+		})
+		requestJSON.Is(func() string {
+			return PullRequestEvent("synchronize", headSHA, issue.Repository)
+		})
+
+		BeforeEach(func() {
+			context.Config.RequireContributorApproval = true
+			recordContribution("maintainer")
+
+			pullRequests.
+				On("ListCommits", anyContext, repositoryOwner, repositoryName, issueNumber,
+					mock.AnythingOfType("*github.ListOptions")).
+				Return(githubCommits(commit{headSHA, "Changing more things"}), emptyResponse, noError)
+			repositories.
+				On("CreateStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+					mock.MatchedBy(func(status *github.RepoStatus) bool {
+						return status.GetContext() == "review/squash"
+					})).
+				Return(emptyResult, emptyResponse, noError)
+			issues.
+				On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+					mock.MatchedBy(commentContaining("@maintainer approved the commits this PR had before"))).
+				Return(emptyResult, emptyResponse, noError)
+		})
+
+		It("revokes the approval", func() {
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			issues.AssertExpectations(GinkgoT())
+			contribution, exists, err := store.FirstTimeContribution(issue)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeTrue())
+			Expect(contribution.ApprovedBy).To(BeEmpty())
+		})
+	})
+
+	Describe("issue_comment event on a first-time contribution", func() {
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+
+		BeforeEach(func() {
+			context.Config.RequireContributorApproval = true
+		})
+
+		Context("with !squash before the approval", func() {
+			requestJSON.Is(func() string {
+				return IssueCommentEvent("!squash", arbitraryIssueAuthor)
+			})
+
+			BeforeEach(func() {
+				recordContribution("")
+				repositories.
+					On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+					Return(true, emptyResponse, noError)
+			})
+
+			It("refuses the command", func() {
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("this is @"+arbitraryIssueAuthor+"'s first contribution, "+
+							"so I won't `!squash` it until a maintainer approves it"))).
+					Return(emptyResult, emptyResponse, noError)
+
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+				pullRequests.AssertNotCalled(GinkgoT(), "Get", anyContext, repositoryOwner, repositoryName,
+					issueNumber)
+			})
+		})
+
+		Context("with !approve-contributor", func() {
+			requestJSON.Is(func() string {
+				return IssueCommentEvent("!approve-contributor", arbitraryIssueAuthor)
+			})
+
+			BeforeEach(func() {
+				recordContribution("")
+				repositories.
+					On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+					Return(false, emptyResponse, noError)
+				data, err := json.Marshal(map[string]interface{}{
+					"repository": map[string]interface{}{
+						"collaborators": map[string]interface{}{
+							"edges": []interface{}{
+								map[string]interface{}{
+									"permission": "MAINTAIN",
+									"node":       map[string]string{"login": arbitraryIssueAuthor},
+								},
+							},
+						},
+					},
+				})
+				Expect(err).NotTo(HaveOccurred())
+				graphQL.
+					On("Query", anyContext, mock.AnythingOfType("string"), mock.Anything, mock.Anything).
+					Return(noError).
+					Run(func(args mock.Arguments) {
+						Expect(json.Unmarshal(data, args.Get(3))).To(Succeed())
+					})
+			})
+
+			It("approves the contribution", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				contribution, exists, err := store.FirstTimeContribution(issue)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(exists).To(BeTrue())
+				Expect(contribution.ApprovedBy).To(Equal(arbitraryIssueAuthor))
+			})
+		})
+	})
+})
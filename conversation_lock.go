@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// lockReasons are the reasons GitHub can lock a conversation for
+var lockReasons = []string{"off-topic", "too heated", "resolved", "spam"}
+
+func isLockCommand(comment string) bool {
+	comment = strings.TrimSpace(comment)
+	return comment == "!lock" || strings.HasPrefix(comment, "!lock ")
+}
+
+func isUnlockCommand(comment string) bool {
+	return strings.TrimSpace(comment) == "!unlock"
+}
+
+// parseLockReason returns the reason of a "!lock [reason]" command, e.g.
+// "too heated", or "", if no reason was given. It reports false for a reason
+// GitHub doesn't know.
+func parseLockReason(comment string) (string, bool) {
+	reason := strings.Join(strings.Fields(strings.TrimPrefix(strings.TrimSpace(comment), "!lock")), " ")
+	if reason == "" {
+		return "", true
+	}
+	for _, lockReason := range lockReasons {
+		if strings.EqualFold(reason, lockReason) {
+			return lockReason, true
+		}
+	}
+	return "", false
+}
+
+// handleLockCommand locks the PR's conversation, so that only collaborators
+// can comment on it. Only maintainers can issue the command, unless
+// COMMAND_PERMISSIONS says otherwise.
+func handleLockCommand(issueComment IssueComment, issues Issues) Response {
+	issue := issueComment.Issue()
+	reason, isValid := parseLockReason(issueComment.Comment)
+	if !isValid {
+		message := fmt.Sprintf("@%s, I can only lock the conversation as %s.", issueComment.Commenter.Login,
+			strings.Join(lockReasons, ", "))
+		if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+			errorMessage := fmt.Sprintf("Failed to report the invalid lock reason on PR %s", issue.FullName())
+			return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+		}
+		return SuccessResponse{"Unknown lock reason. Responded with a comment."}
+	}
+	var options *github.LockIssueOptions
+	if reason != "" {
+		options = &github.LockIssueOptions{LockReason: reason}
+	}
+	if _, err := issues.Lock(context.TODO(), issue.Repository.Owner, issue.Repository.Name, issue.Number,
+		options); err != nil {
+		errorMessage := fmt.Sprintf("Failed to lock the conversation of PR %s", issue.FullName())
+		return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	return SuccessResponse{fmt.Sprintf("Locked the conversation of PR %s", issue.FullName())}
+}
+
+func handleUnlockCommand(issueComment IssueComment, issues Issues) Response {
+	issue := issueComment.Issue()
+	if _, err := issues.Unlock(context.TODO(), issue.Repository.Owner, issue.Repository.Name,
+		issue.Number); err != nil {
+		errorMessage := fmt.Sprintf("Failed to unlock the conversation of PR %s", issue.FullName())
+		return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	return SuccessResponse{fmt.Sprintf("Unlocked the conversation of PR %s", issue.FullName())}
+}
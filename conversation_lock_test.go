@@ -0,0 +1,166 @@
+package main_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("!lock and !unlock comments", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+			graphQL          *mocks.GraphQL
+
+			command   string
+			commenter string
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			repositories = *context.Repositories
+			issues = *context.Issues
+			graphQL = *context.GraphQL
+			commenter = arbitraryIssueAuthor
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return withCommenter(IssueCommentEvent(command, arbitraryIssueAuthor), commenter)
+		})
+
+		mockRole := func(permission string) {
+			graphQL.
+				On("Query", anyContext, mock.AnythingOfType("string"), mock.Anything, mock.Anything).
+				Return(noError).
+				Run(func(args mock.Arguments) {
+					data, err := json.Marshal(map[string]interface{}{
+						"repository": map[string]interface{}{
+							"collaborators": map[string]interface{}{
+								"edges": []interface{}{
+									map[string]interface{}{
+										"permission": permission,
+										"node":       map[string]string{"login": commenter},
+									},
+								},
+							},
+						},
+					})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(json.Unmarshal(data, args.Get(3))).To(Succeed())
+				})
+		}
+
+		Context("by a maintainer", func() {
+			BeforeEach(func() {
+				mockRole("MAINTAIN")
+			})
+
+			Context("with a reason", func() {
+				BeforeEach(func() {
+					command = "!lock too heated"
+					issues.
+						On("Lock", anyContext, repositoryOwner, repositoryName, issueNumber,
+							&github.LockIssueOptions{LockReason: "too heated"}).
+						Return(emptyResponse, noError)
+				})
+
+				It("locks the conversation with the reason", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertExpectations(GinkgoT())
+				})
+			})
+
+			Context("with an unknown reason", func() {
+				BeforeEach(func() {
+					command = "!lock rude"
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("I can only lock the conversation as off-topic, "+
+								"too heated, resolved, spam."))).
+						Return(emptyResult, emptyResponse, noError)
+				})
+
+				It("explains the reasons instead of locking it", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertExpectations(GinkgoT())
+					issues.AssertNotCalled(GinkgoT(), "Lock", anyContext, repositoryOwner, repositoryName,
+						issueNumber, mock.Anything)
+				})
+			})
+
+			Context("with an unknown reason from someone other than the PR's author", func() {
+				BeforeEach(func() {
+					command = "!lock rude"
+					commenter = "reviewer"
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("@reviewer, I can only lock the conversation as"))).
+						Return(emptyResult, emptyResponse, noError)
+				})
+
+				It("explains the reasons to the commenter", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertExpectations(GinkgoT())
+				})
+			})
+
+			Context("unlocking", func() {
+				BeforeEach(func() {
+					command = "!unlock"
+					issues.
+						On("Unlock", anyContext, repositoryOwner, repositoryName, issueNumber).
+						Return(emptyResponse, noError)
+				})
+
+				It("unlocks the conversation", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertExpectations(GinkgoT())
+				})
+			})
+		})
+
+		Context("by a collaborator who isn't a maintainer", func() {
+			BeforeEach(func() {
+				command = "!lock"
+				mockRole("WRITE")
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("Only users with the maintain role or higher can ask me "+
+							"to `!lock` here."))).
+					Return(emptyResult, emptyResponse, noError)
+			})
+
+			It("refuses the command", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+				issues.AssertNotCalled(GinkgoT(), "Lock", anyContext, repositoryOwner, repositoryName,
+					issueNumber, mock.Anything)
+			})
+		})
+	})
+})
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/evaluator"
+)
+
+const reviewThreadsQuery = `query($owner: String!, $name: String!, $number: Int!, $cursor: String) {
+  repository(owner: $owner, name: $name) {
+    pullRequest(number: $number) {
+      reviewThreads(first: 100, after: $cursor) {
+        pageInfo {
+          hasNextPage
+          endCursor
+        }
+        nodes {
+          isResolved
+          comments(first: 1) {
+            nodes {
+              author {
+                login
+              }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+type reviewThreadsResult struct {
+	Repository struct {
+		PullRequest struct {
+			ReviewThreads struct {
+				PageInfo struct {
+					HasNextPage bool   `json:"hasNextPage"`
+					EndCursor   string `json:"endCursor"`
+				} `json:"pageInfo"`
+				Nodes []reviewThread `json:"nodes"`
+			} `json:"reviewThreads"`
+		} `json:"pullRequest"`
+	} `json:"repository"`
+}
+
+type reviewThread struct {
+	IsResolved bool `json:"isResolved"`
+	Comments   struct {
+		Nodes []struct {
+			Author *struct {
+				Login string `json:"login"`
+			} `json:"author"`
+		} `json:"nodes"`
+	} `json:"comments"`
+}
+
+// openedBy returns the login of the user who started the thread. The author
+// is missing for deleted accounts.
+func (t reviewThread) openedBy() string {
+	if len(t.Comments.Nodes) == 0 || t.Comments.Nodes[0].Author == nil {
+		return ""
+	}
+	return t.Comments.Nodes[0].Author.Login
+}
+
+// checkConversations checks whether the PR's review conversations allow it
+// to be merged. The rule passes if resolved conversations aren't required or
+// if all of them have been resolved.
+func checkConversations(conf Config, pr *github.PullRequest, graphQL GraphQL) (evaluator.Result, *ErrorResponse) {
+	if !conf.RequireResolvedConversations {
+		return passed("resolved conversations are not required"), nil
+	}
+	threads, errResp := getReviewThreads(prIssue(pr), graphQL)
+	if errResp != nil {
+		return evaluator.Result{}, errResp
+	}
+	unresolved := 0
+	openersSet := make(map[string]bool)
+	for _, thread := range threads {
+		if thread.IsResolved {
+			continue
+		}
+		unresolved++
+		if opener := thread.openedBy(); opener != "" {
+			openersSet[opener] = true
+		}
+	}
+	if unresolved == 0 {
+		return passed(fmt.Sprintf("all %d review conversation(s) have been resolved", len(threads))), nil
+	}
+	openers := make([]string, 0, len(openersSet))
+	for opener := range openersSet {
+		openers = append(openers, opener)
+	}
+	sort.Strings(openers)
+	reason := fmt.Sprintf("it has %d unresolved review conversation(s)", unresolved)
+	if len(openers) > 0 {
+		reason += fmt.Sprintf(" started by %s", mentions(openers))
+	}
+	return failed(reason, fmt.Sprintf("%d of %d review conversation(s) are unresolved", unresolved,
+		len(threads))), nil
+}
+
+func getReviewThreads(issueable Issueable, graphQL GraphQL) ([]reviewThread, *ErrorResponse) {
+	issue := issueable.Issue()
+	variables := map[string]interface{}{
+		"owner":  issue.Repository.Owner,
+		"name":   issue.Repository.Name,
+		"number": issue.Number,
+	}
+	var threads []reviewThread
+	for {
+		var result reviewThreadsResult
+		err := graphQL.Query(context.TODO(), reviewThreadsQuery, variables, &result)
+		if err != nil {
+			message := fmt.Sprintf("Failed to list review conversations for PR %s", issue.FullName())
+			return nil, &ErrorResponse{err, http.StatusBadGateway, message}
+		}
+		reviewThreads := result.Repository.PullRequest.ReviewThreads
+		threads = append(threads, reviewThreads.Nodes...)
+		if !reviewThreads.PageInfo.HasNextPage {
+			return threads, nil
+		}
+		variables["cursor"] = reviewThreads.PageInfo.EndCursor
+	}
+}
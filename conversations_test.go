@@ -0,0 +1,220 @@
+package main_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var reviewThreadsPage = func(hasNextPage bool, endCursor string, threads ...string) string {
+	nodes := "[]"
+	if len(threads) > 0 {
+		nodes = "["
+		for i, thread := range threads {
+			if i > 0 {
+				nodes += ","
+			}
+			nodes += thread
+		}
+		nodes += "]"
+	}
+	hasNextPageJSON, _ := json.Marshal(hasNextPage)
+	return `{
+  "repository": {
+    "pullRequest": {
+      "reviewThreads": {
+        "pageInfo": {
+          "hasNextPage": ` + string(hasNextPageJSON) + `,
+          "endCursor": "` + endCursor + `"
+        },
+        "nodes": ` + nodes + `
+      }
+    }
+  }
+}`
+}
+
+var reviewThread = func(isResolved bool, openedBy string) string {
+	isResolvedJSON, _ := json.Marshal(isResolved)
+	return `{
+  "isResolved": ` + string(isResolvedJSON) + `,
+  "comments": {
+    "nodes": [{ "author": { "login": "` + openedBy + `" } }]
+  }
+}`
+}
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("resolved conversations gate", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+			graphQL          *mocks.GraphQL
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+			graphQL = *context.GraphQL
+
+			context.Config.RequireResolvedConversations = true
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!merge", arbitraryIssueAuthor)
+		})
+
+		headSHA := "1235"
+		pr := &github.PullRequest{
+			Number:    github.Int(issueNumber),
+			Merged:    github.Bool(false),
+			Mergeable: github.Bool(true),
+			Base: &github.PullRequestBranch{
+				SHA:  github.String("1234"),
+				Ref:  github.String("master"),
+				Repo: repository,
+			},
+			Head: &github.PullRequestBranch{
+				SHA:  github.String(headSHA),
+				Ref:  github.String("feature"),
+				Repo: repository,
+			},
+			User: &github.User{
+				Login: github.String(arbitraryIssueAuthor),
+			},
+		}
+
+		BeforeEach(func() {
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+			issues.
+				On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{grh.MergingLabel}).
+				Return(emptyResult, emptyResponse, noError)
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+				Return(pr, emptyResponse, noError)
+			repositories.
+				On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.AnythingOfType("*github.ListOptions")).
+				Return(&github.CombinedStatus{
+					State: github.String("success"),
+				}, emptyResponse, noError)
+			mockLabels(issues, issueNumber, grh.MergingLabel)
+		})
+
+		mockReviewThreads := func(pages ...string) {
+			BeforeEach(func() {
+				for i, page := range pages {
+					page := page
+					// Every page ends with a cursor named after the next page
+					expectedCursor := "cursor-" + strconv.Itoa(i)
+					isPage := func(variables map[string]interface{}) bool {
+						cursor, hasCursor := variables["cursor"]
+						if expectedCursor == "cursor-0" {
+							return !hasCursor
+						}
+						return cursor == expectedCursor
+					}
+					graphQL.
+						On("Query", anyContext, mock.AnythingOfType("string"), mock.MatchedBy(isPage), mock.Anything).
+						Return(noError).
+						Run(func(args mock.Arguments) {
+							Expect(json.Unmarshal([]byte(page), args.Get(3))).To(Succeed())
+						}).
+						Once()
+				}
+			})
+		}
+
+		Context("with listing the review conversations failing", func() {
+			BeforeEach(func() {
+				graphQL.
+					On("Query", anyContext, mock.AnythingOfType("string"), mock.Anything, mock.Anything).
+					Return(errArbitrary)
+			})
+
+			It("fails with a gateway error", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusBadGateway))
+			})
+		})
+
+		Context("with the provider not supporting GraphQL queries", func() {
+			BeforeEach(func() {
+				unsupportedGraphQL := grh.NewGitlabDriver(nil, "https://gitlab.example.com", "a-token").GraphQL()
+				graphQL.
+					On("Query", anyContext, mock.AnythingOfType("string"), mock.Anything, mock.Anything).
+					Return(unsupportedGraphQL.Query(nil, "", nil, nil))
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("GraphQL queries are not supported by GitLab"))).
+					Return(emptyResult, emptyResponse, noError)
+			})
+
+			It("blocks the PR instead of failing", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(responseRecorder.Body.String()).To(ContainSubstring("Not merging"))
+			})
+		})
+
+		Context("with unresolved review conversations", func() {
+			mockReviewThreads(
+				reviewThreadsPage(true, "cursor-1",
+					reviewThread(false, "reviewer"),
+					reviewThread(true, "resolved-reviewer"),
+				),
+				reviewThreadsPage(false, "cursor-2",
+					reviewThread(false, "other-reviewer"),
+					reviewThread(false, "reviewer"),
+				),
+			)
+
+			BeforeEach(func() {
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("3 unresolved review conversation(s) started by "+
+							"@other-reviewer, @reviewer"))).
+					Return(emptyResult, emptyResponse, noError)
+			})
+
+			It("reports the unresolved conversations without merging", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(responseRecorder.Body.String()).To(ContainSubstring("Not merging"))
+			})
+		})
+
+		Context("with all review conversations resolved", func() {
+			mockReviewThreads(
+				reviewThreadsPage(true, "cursor-1",
+					reviewThread(true, "reviewer"),
+				),
+				reviewThreadsPage(false, "cursor-2"),
+			)
+
+			ItMergesPR(context, pr)
+		})
+	})
+})
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// dashboardListLength is the number of the recent merges and errors the
+// dashboard lists
+const dashboardListLength = 20
+
+// dashboardAuditWindow is how far back the audit log is read for the recent
+// activity
+const dashboardAuditWindow = 7 * 24 * time.Hour
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"prURL": func(repository string, number int) string {
+		return "https://github.com/" + repository + "/pull/" + strconv.Itoa(number)
+	},
+	"formatTime": func(t time.Time) string {
+		return t.UTC().Format("2006-01-02 15:04:05 MST")
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>github-review-helper</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+.error { color: #b00; }
+</style>
+</head>
+<body>
+<h1>github-review-helper</h1>
+<p>As of {{formatTime .Time}}</p>
+
+<h2>Merge queues</h2>
+{{range $queue := .Queues}}
+<h3>{{$queue.Repository}}</h3>
+<table>
+<tr><th>PR</th><th>State</th><th>Head</th><th>Enqueued</th></tr>
+{{range .Entries}}<tr>
+<td><a href="{{prURL $queue.Repository .Issue.Number}}">#{{.Issue.Number}}</a></td>
+<td>{{.State}}</td><td>{{.HeadSHA}}</td><td>{{formatTime .EnqueuedAt}}</td>
+</tr>{{end}}
+</table>
+{{else}}<p>No PRs are queued.</p>{{end}}
+
+<h2>PRs labeled merging</h2>
+{{if .Merging}}<table>
+<tr><th>PR</th><th>Labeled</th><th>Blockers</th></tr>
+{{range .Merging}}<tr>
+<td><a href="{{prURL .Repository .PullRequest}}">{{.Repository}}#{{.PullRequest}}</a></td>
+<td>{{if not .Since.IsZero}}{{formatTime .Since}}{{end}}</td>
+<td>{{range .Blockers}}{{.}}<br>{{else}}none{{end}}</td>
+</tr>{{end}}
+</table>{{else}}<p>No PRs are labeled merging.</p>{{end}}
+
+<h2>Recent merges</h2>
+{{if .RecentMerges}}<table>
+<tr><th>PR</th><th>Merged</th><th>By</th></tr>
+{{range .RecentMerges}}<tr>
+<td><a href="{{prURL .Repository .PullRequest}}">{{.Repository}}#{{.PullRequest}}</a></td>
+<td>{{formatTime .Time}}</td><td>{{.Actor}}</td>
+</tr>{{end}}
+</table>{{else}}<p>No recent merges.</p>{{end}}
+
+<h2>Recent errors</h2>
+{{if .RecentErrors}}<table>
+<tr><th>Time</th><th>Action</th><th>PR</th><th>Error</th></tr>
+{{range .RecentErrors}}<tr>
+<td>{{formatTime .Time}}</td><td>{{.Action}} {{.Details}}</td>
+<td>{{if .PullRequest}}<a href="{{prURL .Repository .PullRequest}}">{{.Repository}}#{{.PullRequest}}</a>{{else}}{{.Repository}}{{end}}</td>
+<td class="error">{{.Error}}</td>
+</tr>{{end}}
+</table>{{else}}<p>No recent errors.</p>{{end}}
+</body>
+</html>
+`))
+
+// dashboardState is what the dashboard shows. It's assembled from the store
+// and the audit log, the same state the admin API exposes. The PRs labeled
+// merging come from the store, which tracks the label whoever adds it.
+type dashboardState struct {
+	Time         time.Time
+	Queues       []dashboardQueue
+	Merging      []dashboardMergingPR
+	RecentMerges []AuditEntry
+	RecentErrors []AuditEntry
+}
+
+// dashboardQueue is a repository's entries in GitHub's native merge queue
+type dashboardQueue struct {
+	Repository string
+	Entries    []MergeQueueEntry
+}
+
+// dashboardMergingPR is a PR labeled merging and what keeps the bot from
+// merging it
+type dashboardMergingPR struct {
+	Repository  string
+	PullRequest int
+	// Since is when the PR was labeled. Zero for deferred merges, whose
+	// label is added once the merge freeze ends.
+	Since    time.Time
+	Blockers []string
+}
+
+// CreateDashboardHandler creates a handler for the read-only HTML dashboard
+// at /dashboard, which lists the merge queues, the PRs labeled merging with
+// what blocks them, and the recent merges and errors. The requests have to
+// authenticate with the token either as a bearer token or as the password of
+// HTTP basic authentication, which browsers prompt for.
+func CreateDashboardHandler(token string, store Store, auditLog AuditLog) http.Handler {
+	dashboard := Handler(func(w http.ResponseWriter, r *http.Request) Response {
+		if r.Method != http.MethodGet {
+			return ErrorResponse{nil, http.StatusMethodNotAllowed, "Only GET is supported"}
+		}
+		state, errResp := getDashboardState(store, auditLog, time.Now())
+		if errResp != nil {
+			return errResp
+		}
+		var body bytes.Buffer
+		if err := dashboardTemplate.Execute(&body, state); err != nil {
+			return ErrorResponse{err, http.StatusInternalServerError, "Failed to render the dashboard"}
+		}
+		return htmlResponse{body.Bytes()}
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, password, hasBasicAuth := r.BasicAuth()
+		if hasBasicAuth && subtle.ConstantTimeCompare([]byte(password), []byte(token)) == 1 {
+			dashboard.ServeHTTP(w, r)
+			return
+		} else if r.Header.Get("Authorization") == "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="github-review-helper"`)
+		}
+		requireBearerToken(token, "admin", dashboard).ServeHTTP(w, r)
+	})
+}
+
+func getDashboardState(store Store, auditLog AuditLog, now time.Time) (dashboardState, *ErrorResponse) {
+	state := dashboardState{Time: now}
+	entries, err := store.AllMergeQueueEntries()
+	if err != nil {
+		return dashboardState{}, &ErrorResponse{err, http.StatusInternalServerError,
+			"Failed to list the merge queue entries"}
+	}
+	queues := make(map[string][]MergeQueueEntry)
+	for _, entry := range entries {
+		key := repositoryKey(entry.Issue.Repository)
+		queues[key] = append(queues[key], entry)
+	}
+	for repository, queue := range queues {
+		state.Queues = append(state.Queues, dashboardQueue{Repository: repository, Entries: queue})
+	}
+	sort.Slice(state.Queues, func(i, j int) bool {
+		return state.Queues[i].Repository < state.Queues[j].Repository
+	})
+
+	mergeRequests, err := store.MergeRequests()
+	if err != nil {
+		return dashboardState{}, &ErrorResponse{err, http.StatusInternalServerError,
+			"Failed to list the PRs labeled merging"}
+	}
+	merging := make(map[string]*dashboardMergingPR)
+	issues := make(map[string]Issue)
+	for _, request := range mergeRequests {
+		merging[request.Issue.FullName()] = &dashboardMergingPR{
+			Repository:  repositoryKey(request.Issue.Repository),
+			PullRequest: request.Issue.Number,
+			Since:       request.LabeledAt,
+		}
+		issues[request.Issue.FullName()] = request.Issue
+	}
+	deferredMerges, err := store.DeferredMerges()
+	if err != nil {
+		return dashboardState{}, &ErrorResponse{err, http.StatusInternalServerError,
+			"Failed to list the deferred merges"}
+	}
+	deferred := make(map[string]bool)
+	for _, issue := range deferredMerges {
+		deferred[issue.FullName()] = true
+		if _, exists := merging[issue.FullName()]; !exists {
+			merging[issue.FullName()] = &dashboardMergingPR{
+				Repository:  repositoryKey(issue.Repository),
+				PullRequest: issue.Number,
+			}
+			issues[issue.FullName()] = issue
+		}
+	}
+	for fullName, pr := range merging {
+		if pr.Blockers, err = store.Refusals(issues[fullName]); err != nil {
+			return dashboardState{}, &ErrorResponse{err, http.StatusInternalServerError,
+				"Failed to list the refusals of PR " + fullName}
+		}
+		if deferred[fullName] {
+			pr.Blockers = append(pr.Blockers, "deferred until the merge freeze ends")
+		}
+		state.Merging = append(state.Merging, *pr)
+	}
+	sort.Slice(state.Merging, func(i, j int) bool {
+		if state.Merging[i].Repository != state.Merging[j].Repository {
+			return state.Merging[i].Repository < state.Merging[j].Repository
+		}
+		return state.Merging[i].PullRequest < state.Merging[j].PullRequest
+	})
+
+	auditEntries, err := auditLog.Entries(AuditFilter{Since: now.Add(-dashboardAuditWindow)})
+	if err != nil {
+		return dashboardState{}, &ErrorResponse{err, http.StatusInternalServerError, "Failed to read the audit log"}
+	}
+	// The latest first
+	for i := len(auditEntries) - 1; i >= 0; i-- {
+		entry := auditEntries[i]
+		if entry.Action == "merge" && entry.Outcome == auditOutcomeSuccess &&
+			len(state.RecentMerges) < dashboardListLength {
+			state.RecentMerges = append(state.RecentMerges, entry)
+		} else if entry.Outcome == auditOutcomeFailure && len(state.RecentErrors) < dashboardListLength {
+			state.RecentErrors = append(state.RecentErrors, entry)
+		}
+	}
+	return state, nil
+}
+
+// htmlResponse responds with a rendered HTML page. Only the page's size is
+// logged.
+type htmlResponse struct {
+	Body []byte
+}
+
+func (r htmlResponse) WriteResponse(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// The dashboard shows the current state
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(r.Body)
+}
+
+func (r htmlResponse) logResponse() {
+	log.Printf("Success: responded with a %d byte page\n", len(r.Body))
+}
@@ -0,0 +1,104 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	grh "github.com/salemove/github-review-helper"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Dashboard handler", func() {
+	var (
+		store            grh.Store
+		auditLog         grh.AuditLog
+		responseRecorder *httptest.ResponseRecorder
+		request          *http.Request
+
+		repository = grh.Repository{Owner: "salemove", Name: "api"}
+	)
+
+	BeforeEach(func() {
+		store = grh.NewMemoryStore()
+		var err error
+		auditLog, err = grh.NewAuditLog(grh.Config{})
+		Expect(err).NotTo(HaveOccurred())
+		responseRecorder = httptest.NewRecorder()
+
+		now := time.Now()
+		for _, entry := range []grh.AuditEntry{
+			{Action: "merge", PullRequest: 2, Actor: "alice", Outcome: "success"},
+			{Action: "push", PullRequest: 3, Outcome: "failure", Error: "remote rejected the push"},
+		} {
+			entry.Time = now
+			entry.Repository = "salemove/api"
+			Expect(auditLog.Record(entry)).To(Succeed())
+		}
+		// Labeled by someone other than the bot, so the audit log doesn't
+		// know about it
+		Expect(store.AddMergeRequest(grh.MergeRequest{
+			Issue:       grh.Issue{Number: 1, Repository: repository},
+			RequestedBy: "bob",
+			LabeledAt:   now,
+		})).To(Succeed())
+		Expect(store.RecordRefusal(grh.Issue{Number: 1, Repository: repository},
+			"it's labeled do-not-merge")).To(BeTrue())
+		Expect(store.SetMergeQueueEntry(grh.MergeQueueEntry{
+			Issue:      grh.Issue{Number: 4, Repository: repository},
+			HeadSHA:    "1234",
+			State:      "AWAITING_CHECKS",
+			EnqueuedAt: now,
+		})).To(Succeed())
+	})
+
+	handle := func() {
+		grh.CreateDashboardHandler("admin-token", store, auditLog).ServeHTTP(responseRecorder, request)
+	}
+
+	Context("without a token", func() {
+		BeforeEach(func() {
+			request = httptest.NewRequest("GET", "/dashboard", nil)
+		})
+
+		It("prompts for the token", func() {
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusUnauthorized))
+			Expect(responseRecorder.Header().Get("WWW-Authenticate")).To(HavePrefix("Basic"))
+		})
+	})
+
+	Context("with the token as the basic authentication password", func() {
+		BeforeEach(func() {
+			request = httptest.NewRequest("GET", "/dashboard", nil)
+			request.SetBasicAuth("anyone", "admin-token")
+		})
+
+		It("renders the queues, the blocked PRs and the recent activity", func() {
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			Expect(responseRecorder.Header().Get("Content-Type")).To(HavePrefix("text/html"))
+
+			body := responseRecorder.Body.String()
+			Expect(body).To(ContainSubstring("AWAITING_CHECKS"))
+			Expect(body).To(ContainSubstring("salemove/api#1"))
+			Expect(body).To(ContainSubstring("it&#39;s labeled do-not-merge"))
+			Expect(body).To(ContainSubstring("<td>alice</td>"))
+			Expect(body).To(ContainSubstring("remote rejected the push"))
+		})
+	})
+
+	Context("with the token as a bearer token", func() {
+		BeforeEach(func() {
+			request = httptest.NewRequest("GET", "/dashboard", nil)
+			request.Header.Set("Authorization", "Bearer admin-token")
+		})
+
+		It("renders the dashboard", func() {
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+		})
+	})
+})
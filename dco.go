@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+const githubStatusSignOffContext = "review/dco"
+
+// signOffRegexp matches the Signed-off-by lines of a commit message, which
+// certify the Developer Certificate of Origin, capturing the email address
+var signOffRegexp = regexp.MustCompile(`(?m)^Signed-off-by: [^<\n]+ <([^>\n]+)>\s*$`)
+
+func isDCOOverrideCommand(comment string) bool {
+	return strings.TrimSpace(comment) == "!dco-override"
+}
+
+// checkSignOffs creates a status reporting whether every commit of the PR is
+// signed off by its author. Merge commits are skipped. The status succeeds
+// regardless, if a maintainer has waived the requirement for the PR's current
+// head with !dco-override. Returns nil, if sign-offs aren't required.
+func checkSignOffs(conf Config, issue Issue, commits []*github.RepositoryCommit,
+	store Store) (*github.RepoStatus, *ErrorResponse) {
+
+	if !conf.RequireSignOff {
+		return nil, nil
+	}
+	waiver, err := store.SignOffWaiver(issue)
+	if err != nil {
+		message := fmt.Sprintf("Failed to get the sign-off waiver of PR %s", issue.FullName())
+		return nil, &ErrorResponse{err, http.StatusInternalServerError, message}
+	} else if len(commits) > 0 && waiver.HeadSHA == commits[len(commits)-1].GetSHA() {
+		return createSignOffStatus("success", fmt.Sprintf("Sign-offs waived by @%s", waiver.Login)), nil
+	}
+	var unsigned []string
+	for _, commit := range commits {
+		if len(commit.Parents) > 1 || isSignedOffByAuthor(commit) {
+			continue
+		}
+		unsigned = append(unsigned, shortSHA(commit.GetSHA()))
+	}
+	if len(unsigned) == 0 {
+		return createSignOffStatus("success", "All commits are signed off by their authors"), nil
+	}
+	return createSignOffStatus("failure", fmt.Sprintf("Commits not signed off by their authors: %s",
+		strings.Join(unsigned, ", "))), nil
+}
+
+// isSignedOffByAuthor reports whether the commit's message has a
+// Signed-off-by line with the email address of the commit's author
+func isSignedOffByAuthor(commit *github.RepositoryCommit) bool {
+	authorEmail := commit.Commit.GetAuthor().GetEmail()
+	if authorEmail == "" {
+		return false
+	}
+	for _, match := range signOffRegexp.FindAllStringSubmatch(commit.Commit.GetMessage(), -1) {
+		if strings.EqualFold(strings.TrimSpace(match[1]), authorEmail) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleDCOOverrideCommand waives the sign-off requirement for the PR, e.g.
+// for commits whose authors can't be reached anymore, and sets the PR's
+// review/dco status to success. The waiver only covers the PR's current head,
+// so that unsigned commits can't be pushed under it later. Only maintainers
+// can issue the command, unless COMMAND_PERMISSIONS says otherwise.
+func handleDCOOverrideCommand(conf Config, issueComment IssueComment, store Store, issues Issues,
+	pullRequests PullRequests, repositories Repositories) Response {
+
+	issue := issueComment.Issue()
+	commenter := issueComment.Commenter.Login
+	if !conf.RequireSignOff {
+		message := fmt.Sprintf("@%s, sign-offs aren't required, so there's nothing to override.", commenter)
+		if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+			errorMessage := fmt.Sprintf("Failed to refuse the DCO override on PR %s", issue.FullName())
+			return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+		}
+		return SuccessResponse{"Sign-offs aren't required. Ignoring the DCO override."}
+	}
+	pr, errResp := getPR(issue, pullRequests)
+	if errResp != nil {
+		return errResp
+	}
+	waiver := SignOffWaiver{Login: commenter, HeadSHA: pr.GetHead().GetSHA()}
+	if err := store.SetSignOffWaiver(issue, waiver); err != nil {
+		message := fmt.Sprintf("Failed to record the sign-off waiver of PR %s", issue.FullName())
+		return ErrorResponse{err, http.StatusInternalServerError, message}
+	}
+	log.Printf("%s waived the sign-off requirement of PR %s at %s.\n", commenter, issue.FullName(),
+		waiver.HeadSHA)
+	status := createSignOffStatus("success", fmt.Sprintf("Sign-offs waived by @%s", commenter))
+	if errResp = setStatusForPR(pr, status, repositories); errResp != nil {
+		return errResp
+	}
+	message := fmt.Sprintf("@%s waived the sign-off requirement for this PR at %s. Commits pushed later "+
+		"have to be signed off or waived again.", commenter, shortSHA(waiver.HeadSHA))
+	if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+		errorMessage := fmt.Sprintf("Failed to note the DCO override on PR %s", issue.FullName())
+		return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	return SuccessResponse{fmt.Sprintf("Waived the sign-off requirement of PR %s", issue.FullName())}
+}
+
+func createSignOffStatus(state, description string) *github.RepoStatus {
+	// GitHub limits the descriptions of statuses to 140 characters
+	if len(description) > 140 {
+		description = description[:137] + "..."
+	}
+	return &github.RepoStatus{
+		State:       github.String(state),
+		Description: github.String(description),
+		Context:     github.String(githubStatusSignOffContext),
+	}
+}
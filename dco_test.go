@@ -0,0 +1,293 @@
+package main_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	var (
+		handle      = context.Handle
+		headers     = context.Headers
+		requestJSON = context.RequestJSON
+
+		responseRecorder *httptest.ResponseRecorder
+		store            grh.Store
+		pullRequests     *mocks.PullRequests
+		repositories     *mocks.Repositories
+		issues           *mocks.Issues
+		graphQL          *mocks.GraphQL
+
+		headSHA = "1235"
+		issue   = grh.Issue{
+			Number:     issueNumber,
+			Repository: grh.Repository{Owner: repositoryOwner, Name: repositoryName, URL: sshURL},
+		}
+	)
+	BeforeEach(func() {
+		responseRecorder = *context.ResponseRecorder
+		store = *context.Store
+		pullRequests = *context.PullRequests
+		repositories = *context.Repositories
+		issues = *context.Issues
+		graphQL = *context.GraphQL
+
+		context.Config.RequireSignOff = true
+	})
+
+	signOffStatus := func(state, description string) interface{} {
+		return mock.MatchedBy(func(status *github.RepoStatus) bool {
+			return status.GetContext() == "review/dco" && status.GetState() == state &&
+				strings.Contains(status.GetDescription(), description)
+		})
+	}
+
+	Describe("pull_request event with sign-offs required", func() {
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "pull_request",
+			}
+		})
+		requestJSON.Is(func() string {
+			return PullRequestEvent("synchronize", headSHA, issue.Repository)
+		})
+
+		// Both commits are authored by pro@example.com
+		signedCommits := func(firstMessage, headMessage string) []*github.RepositoryCommit {
+			commits := githubCommits(
+				commit{arbitrarySHA, firstMessage},
+				commit{headSHA, headMessage},
+			)
+			for _, commit := range commits {
+				commit.Commit.Author = &github.CommitAuthor{
+					Name:  github.String("Pro Coder"),
+					Email: github.String("pro@example.com"),
+				}
+			}
+			return commits
+		}
+
+		BeforeEach(func() {
+			repositories.
+				On("CreateStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+					mock.MatchedBy(func(status *github.RepoStatus) bool {
+						return status.GetContext() == "review/squash"
+					})).
+				Return(emptyResult, emptyResponse, noError)
+		})
+
+		Context("with every commit signed off by its author", func() {
+			BeforeEach(func() {
+				pullRequests.
+					On("ListCommits", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.AnythingOfType("*github.ListOptions")).
+					Return(signedCommits(
+						"Add a thing\n\nSigned-off-by: Pro Coder <pro@example.com>",
+						"Fix the thing\n\nSigned-off-by: Pro Coder <PRO@example.com>",
+					), emptyResponse, noError)
+			})
+
+			It("reports a successful sign-off status", func() {
+				repositories.
+					On("CreateStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+						signOffStatus("success", "All commits are signed off")).
+					Return(emptyResult, emptyResponse, noError).
+					Once()
+
+				handle()
+
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			})
+		})
+
+		Context("with a commit signed off by someone other than its author", func() {
+			BeforeEach(func() {
+				pullRequests.
+					On("ListCommits", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.AnythingOfType("*github.ListOptions")).
+					Return(signedCommits(
+						"Add a thing\n\nSigned-off-by: Pro Coder <pro@example.com>",
+						"Fix the thing\n\nSigned-off-by: Someone Else <else@example.com>",
+					), emptyResponse, noError)
+			})
+
+			It("reports a failed sign-off status listing the commit", func() {
+				repositories.
+					On("CreateStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+						signOffStatus("failure", headSHA)).
+					Return(emptyResult, emptyResponse, noError).
+					Once()
+
+				handle()
+
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			})
+
+			Context("with the requirement waived", func() {
+				BeforeEach(func() {
+					waiver := grh.SignOffWaiver{Login: "maintainer", HeadSHA: headSHA}
+					Expect(store.SetSignOffWaiver(issue, waiver)).To(Succeed())
+				})
+
+				It("reports a successful sign-off status", func() {
+					repositories.
+						On("CreateStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+							signOffStatus("success", "waived by @maintainer")).
+						Return(emptyResult, emptyResponse, noError).
+						Once()
+
+					handle()
+
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				})
+			})
+
+			Context("with the requirement waived for an earlier head", func() {
+				BeforeEach(func() {
+					waiver := grh.SignOffWaiver{Login: "maintainer", HeadSHA: arbitrarySHA}
+					Expect(store.SetSignOffWaiver(issue, waiver)).To(Succeed())
+				})
+
+				It("reports a failed sign-off status", func() {
+					repositories.
+						On("CreateStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+							signOffStatus("failure", headSHA)).
+						Return(emptyResult, emptyResponse, noError).
+						Once()
+
+					handle()
+
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				})
+			})
+		})
+	})
+
+	Describe("!dco-override comment", func() {
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!dco-override", arbitraryIssueAuthor)
+		})
+
+		BeforeEach(func() {
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+		})
+
+		mockRole := func(permission string) {
+			BeforeEach(func() {
+				data, err := json.Marshal(map[string]interface{}{
+					"repository": map[string]interface{}{
+						"collaborators": map[string]interface{}{
+							"edges": []interface{}{
+								map[string]interface{}{
+									"permission": permission,
+									"node":       map[string]string{"login": arbitraryIssueAuthor},
+								},
+							},
+						},
+					},
+				})
+				Expect(err).NotTo(HaveOccurred())
+				graphQL.
+					On("Query", anyContext, mock.AnythingOfType("string"), mock.Anything, mock.Anything).
+					Return(noError).
+					Run(func(args mock.Arguments) {
+						Expect(json.Unmarshal(data, args.Get(3))).To(Succeed())
+					})
+			})
+		}
+
+		Context("by a collaborator with write access", func() {
+			mockRole("WRITE")
+
+			It("refuses to waive the requirement", func() {
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("can ask me to `!dco-override`"))).
+					Return(emptyResult, emptyResponse, noError).
+					Once()
+
+				handle()
+
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(store.SignOffWaiver(issue)).To(BeZero())
+				repositories.AssertNotCalled(GinkgoT(), "CreateStatus", anyContext, repositoryOwner,
+					repositoryName, headSHA, mock.Anything)
+			})
+		})
+
+		Context("by a maintainer", func() {
+			mockRole("MAINTAIN")
+
+			It("waives the requirement for the head and sets the sign-off status to success", func() {
+				pullRequests.
+					On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+					Return(&github.PullRequest{
+						Number: github.Int(issueNumber),
+						Base: &github.PullRequestBranch{
+							Ref:  github.String("master"),
+							Repo: repository,
+						},
+						Head: &github.PullRequestBranch{
+							SHA:  github.String(headSHA),
+							Ref:  github.String("feature"),
+							Repo: repository,
+						},
+					}, emptyResponse, noError)
+				repositories.
+					On("CreateStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+						signOffStatus("success", "waived by @"+arbitraryIssueAuthor)).
+					Return(emptyResult, emptyResponse, noError).
+					Once()
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("waived the sign-off requirement"))).
+					Return(emptyResult, emptyResponse, noError).
+					Once()
+
+				handle()
+
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(store.SignOffWaiver(issue)).To(Equal(grh.SignOffWaiver{
+					Login:   arbitraryIssueAuthor,
+					HeadSHA: headSHA,
+				}))
+			})
+
+			Context("with sign-offs not required", func() {
+				BeforeEach(func() {
+					context.Config.RequireSignOff = false
+				})
+
+				It("explains that there's nothing to override", func() {
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("nothing to override"))).
+						Return(emptyResult, emptyResponse, noError).
+						Once()
+
+					handle()
+
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					Expect(store.SignOffWaiver(issue)).To(BeZero())
+				})
+			})
+		})
+	})
+})
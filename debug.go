@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/salemove/github-review-helper/git"
+)
+
+// debugState is a snapshot of the bot's queues and locks, for diagnosing
+// hung git commands and stuck merges.
+type debugState struct {
+	Time                time.Time       `json:"time"`
+	Goroutines          int             `json:"goroutines"`
+	ScheduledOperations int64           `json:"scheduled_operations"`
+	Queues              []QueueStats    `json:"queues"`
+	Repos               []git.RepoState `json:"repos"`
+	DeferredMerges      []Issue         `json:"deferred_merges"`
+	Validations         []Validation    `json:"validations"`
+	BotBranches         []BotBranch     `json:"bot_branches"`
+	SelfTests           []SelfTest      `json:"self_tests"`
+	// GithubIncident is the GitHub incident that merges and background jobs
+	// are paused for
+	GithubIncident *GithubIncident `json:"github_incident"`
+}
+
+// CreateDebugHandler creates a handler for the pprof endpoints under
+// /debug/pprof/, the expvar metrics at /debug/vars and a JSON dump of the
+// bot's state at /debug/state. If token
+// is set, then requests have to authenticate with it as a bearer token.
+func CreateDebugHandler(token string, gitRepos git.Repos, store Store, scheduler *Scheduler) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/state", func(w http.ResponseWriter, r *http.Request) {
+		// Not using Handler, because it would log the whole dump
+		if errResp := dumpDebugState(w, gitRepos, store, scheduler); errResp != nil {
+			errResp.logResponse()
+			errResp.WriteResponse(w)
+		}
+	})
+	if token == "" {
+		return mux
+	}
+	return requireBearerToken(token, "debug", mux)
+}
+
+// requireBearerToken only passes the requests that authenticate with the
+// token as a bearer token on to the handler.
+func requireBearerToken(token, tokenName string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expected := []byte("Bearer " + token)
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			http.Error(w, fmt.Sprintf("Please provide a valid %s token", tokenName), http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func dumpDebugState(w http.ResponseWriter, gitRepos git.Repos, store Store, scheduler *Scheduler) *ErrorResponse {
+	state := debugState{
+		Time:                time.Now(),
+		Goroutines:          runtime.NumGoroutine(),
+		ScheduledOperations: atomic.LoadInt64(&scheduledOperations),
+		Queues:              scheduler.Stats(),
+		Repos:               gitRepos.States(),
+		GithubIncident:      ActiveGithubIncident(),
+	}
+	var err error
+	if state.DeferredMerges, err = store.DeferredMerges(); err != nil {
+		return &ErrorResponse{err, http.StatusInternalServerError, "Failed to list the deferred merges"}
+	} else if state.Validations, err = store.AllValidations(); err != nil {
+		return &ErrorResponse{err, http.StatusInternalServerError, "Failed to list the validations"}
+	} else if state.BotBranches, err = store.AllBotBranches(); err != nil {
+		return &ErrorResponse{err, http.StatusInternalServerError, "Failed to list the bot branches"}
+	} else if state.SelfTests, err = store.SelfTests(); err != nil {
+		return &ErrorResponse{err, http.StatusInternalServerError, "Failed to list the self-tests"}
+	}
+	body, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return &ErrorResponse{err, http.StatusInternalServerError, "Failed to encode the debug state"}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+	return nil
+}
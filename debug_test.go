@@ -0,0 +1,82 @@
+package main_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/git"
+	"github.com/salemove/github-review-helper/mocks"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Debug handler", func() {
+	var (
+		token            string
+		gitRepos         *mocks.Repos
+		store            grh.Store
+		responseRecorder *httptest.ResponseRecorder
+		request          *http.Request
+	)
+
+	BeforeEach(func() {
+		token = ""
+		gitRepos = new(mocks.Repos)
+		store = grh.NewMemoryStore()
+		responseRecorder = httptest.NewRecorder()
+		request = httptest.NewRequest("GET", "/debug/state", nil)
+
+		gitRepos.
+			On("States").
+			Return([]git.RepoState{{Path: "/repos/salemove/github-review-helper", Operation: "fetch"}})
+		Expect(store.AddDeferredMerge(grh.Issue{
+			Number:     issueNumber,
+			Repository: trackedRepository,
+		})).To(Succeed())
+	})
+
+	handle := func() {
+		grh.CreateDebugHandler(token, gitRepos, store, grh.NewScheduler(0, nil)).ServeHTTP(responseRecorder, request)
+	}
+
+	It("dumps the state of the repos and queues", func() {
+		handle()
+		Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+
+		var state struct {
+			Repos          []git.RepoState
+			DeferredMerges []grh.Issue `json:"deferred_merges"`
+		}
+		Expect(json.Unmarshal(responseRecorder.Body.Bytes(), &state)).To(Succeed())
+		Expect(state.Repos).To(HaveLen(1))
+		Expect(state.Repos[0].Operation).To(Equal("fetch"))
+		Expect(state.DeferredMerges).To(HaveLen(1))
+		Expect(state.DeferredMerges[0].Number).To(Equal(issueNumber))
+	})
+
+	Context("with a token", func() {
+		BeforeEach(func() {
+			token = "debug-token"
+		})
+
+		It("refuses requests without the token", func() {
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("refuses requests with a wrong token", func() {
+			request.Header.Set("Authorization", "Bearer wrong-token")
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("accepts requests with the token", func() {
+			request.Header.Set("Authorization", "Bearer "+token)
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+		})
+	})
+})
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// claimDelivery returns a response for a webhook delivery that is already
+// being handled or has been handled within DELIVERY_TTL, so that GitHub's
+// redeliveries wouldn't e.g. race a merge that's already in progress.
+// Returns nil if the delivery should be handled.
+func claimDelivery(conf Config, deliveryID string, store Store) Response {
+	if conf.DeliveryTTL == 0 || deliveryID == "" {
+		return nil
+	}
+	now := time.Now()
+	isNew, err := store.ClaimDelivery(deliveryID, now, now.Add(conf.DeliveryTTL))
+	if err != nil {
+		return ErrorResponse{err, http.StatusInternalServerError, "Failed to record the webhook delivery"}
+	} else if !isNew {
+		return SuccessResponse{"Delivery " + deliveryID + " has already been received. Ignoring."}
+	}
+	return nil
+}
+
+// claimStatusEvent returns a response for a status event that repeats one
+// received within STATUS_DEDUP_WINDOW, so that the duplicate successes CI
+// systems send wouldn't each start evaluating the same PRs. Returns nil if
+// the event should be handled.
+func claimStatusEvent(conf Config, statusEvent StatusEvent, store Store) Response {
+	if conf.StatusDedupWindow == 0 {
+		return nil
+	}
+	now := time.Now()
+	isNew, err := store.ClaimDelivery(statusEventID(statusEvent), now, now.Add(conf.StatusDedupWindow))
+	if err != nil {
+		return ErrorResponse{err, http.StatusInternalServerError, "Failed to record the status event"}
+	} else if !isNew {
+		return SuccessResponse{"The same status was received moments ago. Ignoring."}
+	}
+	return nil
+}
+
+// statusEventID identifies the status event by its commit, context and
+// state. It's claimed like a delivery.
+func statusEventID(statusEvent StatusEvent) string {
+	return fmt.Sprintf("status:%s:%s:%s:%s", repositoryKey(statusEvent.Repository), statusEvent.SHA,
+		statusEvent.Context, statusEvent.State)
+}
+
+// releaseFailedStatusEvent forgets the status event if evaluating the PRs
+// failed, so that redelivering it could retry it.
+func releaseFailedStatusEvent(conf Config, statusEvent StatusEvent, response Response, store Store) {
+	if conf.StatusDedupWindow == 0 {
+		return
+	} else if _, failed := asErrorResponse(response); !failed {
+		return
+	}
+	if err := store.ReleaseDelivery(statusEventID(statusEvent)); err != nil {
+		log.Printf("Failed to release the failed status event for %s: %v\n", statusEvent.SHA, err)
+	}
+}
+
+// commentCommandID identifies the command in the comment, so that editing the
+// comment wouldn't run the same command again. It's claimed like a delivery.
+// Comments without a node ID aren't deduplicated.
+func commentCommandID(issueComment IssueComment) string {
+	if issueComment.CommentNodeID == "" {
+		return ""
+	}
+	return "comment:" + issueComment.CommentNodeID + ":" + commandLine(issueComment.Comment)
+}
+
+// issuedBeforeEdit reports whether the edited comment already issued the
+// command before it was edited, e.g. when only a typo elsewhere in it was
+// fixed. Unlike the claimed command IDs, this doesn't depend on DELIVERY_TTL,
+// so editing an old comment doesn't run its command again either.
+func issuedBeforeEdit(conf Config, issueComment IssueComment) bool {
+	if issueComment.Action != "edited" {
+		return false
+	}
+	for _, previous := range splitCommands(conf, issueComment.PreviousComment) {
+		if commandLine(previous) == commandLine(issueComment.Comment) {
+			return true
+		}
+	}
+	return false
+}
+
+// commandLine returns the first line of the command, which the lines after it
+// are only arguments to
+func commandLine(command string) string {
+	return strings.TrimSpace(strings.SplitN(strings.TrimSpace(command), "\n", 2)[0])
+}
+
+// releaseFailedDelivery forgets the delivery if handling it failed, so that
+// redelivering it could retry it.
+func releaseFailedDelivery(conf Config, deliveryID string, response Response, store Store) {
+	if conf.DeliveryTTL == 0 || deliveryID == "" {
+		return
+	} else if _, failed := asErrorResponse(response); !failed {
+		return
+	}
+	if err := store.ReleaseDelivery(deliveryID); err != nil {
+		log.Printf("Failed to release the failed delivery %s: %v\n", deliveryID, err)
+	}
+}
@@ -0,0 +1,134 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("webhook deliveries", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			repositories *mocks.Repositories
+			issues       *mocks.Issues
+		)
+		BeforeEach(func() {
+			repositories = *context.Repositories
+			issues = *context.Issues
+
+			context.Config.DeliveryTTL = time.Hour
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event":    "issue_comment",
+				"X-Github-Delivery": "72d3162e-cc78-11e3-81ab-4c9367dc0958",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!hold", arbitraryIssueAuthor)
+		})
+
+		// handleAgain handles a redelivery of the same webhook
+		handleAgain := func() *httptest.ResponseRecorder {
+			*context.ResponseRecorder = httptest.NewRecorder()
+			handle()
+			return *context.ResponseRecorder
+		}
+
+		It("ignores a redelivered webhook", func() {
+			issues.
+				On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{"on-hold"}).
+				Return(emptyResult, emptyResponse, noError).
+				Once()
+
+			handle()
+			Expect((*context.ResponseRecorder).Code).To(Equal(http.StatusOK))
+
+			responseRecorder := handleAgain()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			Expect(responseRecorder.Body.String()).To(ContainSubstring("has already been received. Ignoring."))
+		})
+
+		It("handles a redelivery of a webhook that failed", func() {
+			issues.
+				On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{"on-hold"}).
+				Return(emptyResult, emptyResponse, errArbitrary).
+				Once()
+			issues.
+				On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{"on-hold"}).
+				Return(emptyResult, emptyResponse, noError).
+				Once()
+
+			handle()
+			Expect((*context.ResponseRecorder).Code).To(Equal(http.StatusBadGateway))
+
+			responseRecorder := handleAgain()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			Expect(responseRecorder.Body.String()).To(ContainSubstring("on hold"))
+		})
+		Context("with an edited comment", func() {
+			headers.Is(func() map[string]string {
+				return map[string]string{
+					"X-Github-Event": "issue_comment",
+				}
+			})
+			requestJSON.Is(func() string {
+				event := IssueCommentEvent("!hold", arbitraryIssueAuthor)
+				return strings.Replace(event, "{", `{
+  "action": "edited",`, 1)
+			})
+
+			It("doesn't run the same command again", func() {
+				issues.
+					On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{"on-hold"}).
+					Return(emptyResult, emptyResponse, noError).
+					Once()
+
+				handle()
+				Expect((*context.ResponseRecorder).Code).To(Equal(http.StatusOK))
+
+				responseRecorder := handleAgain()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(responseRecorder.Body.String()).To(ContainSubstring("has already been received. Ignoring."))
+			})
+		})
+
+		Context("with a comment edited long after its command was run", func() {
+			headers.Is(func() map[string]string {
+				return map[string]string{
+					"X-Github-Event": "issue_comment",
+				}
+			})
+			requestJSON.Is(func() string {
+				event := IssueCommentEvent(`!hold\n\nThe release is on Monday.`, arbitraryIssueAuthor)
+				return strings.Replace(event, "{", `{
+  "action": "edited",
+  "changes": {"body": {"from": "!hold\n\nThe release is on Friday."}},`, 1)
+			})
+
+			It("doesn't run the command again", func() {
+				handle()
+				responseRecorder := *context.ResponseRecorder
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(responseRecorder.Body.String()).To(ContainSubstring("issued before the comment was edited"))
+				issues.AssertNotCalled(GinkgoT(), "AddLabelsToIssue", anyContext, repositoryOwner, repositoryName,
+					issueNumber, mock.Anything)
+			})
+		})
+	})
+})
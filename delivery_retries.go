@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const deliveryRetryCheckInterval = 15 * time.Second
+
+// retriedHeaders are the headers of a webhook that are needed to handle it
+// again
+var retriedHeaders = []string{"Content-Type", "X-Github-Event", "X-Github-Delivery", "X-Hub-Signature",
+	"X-Hub-Signature-256"}
+
+// isTransientFailure reports whether the response is a failure that may go
+// away when tried again, e.g. GitHub's API failing.
+func isTransientFailure(response Response) bool {
+	errResp, failed := asErrorResponse(response)
+	if !failed {
+		return false
+	}
+	switch errResp.Code {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// queueDeliveryRetry persists the webhook, if handling it failed
+// transiently, so that it would be retried later. A webhook that is already
+// queued, e.g. because it's being retried, isn't queued again.
+func queueDeliveryRetry(conf Config, r *http.Request, body []byte, response Response, store Store) {
+	deliveryID := r.Header.Get("X-Github-Delivery")
+	if conf.DeliveryRetries == 0 || deliveryID == "" || !isTransientFailure(response) {
+		return
+	}
+	headers := make(map[string]string, len(retriedHeaders))
+	for _, header := range retriedHeaders {
+		headers[header] = r.Header.Get(header)
+	}
+	errResp, _ := asErrorResponse(response)
+	queued, err := store.QueueFailedDelivery(FailedDelivery{
+		ID:            deliveryID,
+		Headers:       headers,
+		Body:          body,
+		NextAttemptAt: time.Now().Add(conf.DeliveryRetryBackoff),
+		LastError:     errResp.ErrorMessage,
+	})
+	if err != nil {
+		log.Printf("Failed to queue delivery %s to be retried: %v\n", deliveryID, err)
+	} else if queued {
+		log.Printf("Handling delivery %s failed. Retrying it in %s.\n", deliveryID,
+			formatDuration(conf.DeliveryRetryBackoff))
+	}
+}
+
+func runDeliveryRetries(configSource ConfigSource, store Store, handler Handler, stop <-chan struct{}) {
+	ticker := time.NewTicker(deliveryRetryCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			conf := configSource.Current()
+			if conf.DeliveryRetries == 0 {
+				continue
+			} else if err := RetryFailedDeliveries(conf, store, handler, time.Now()); err != nil {
+				log.Printf("Retrying failed deliveries failed: %v\n", err)
+			}
+		}
+	}
+}
+
+// RetryFailedDeliveries handles the queued deliveries that are due again.
+// The time between the attempts doubles after every attempt. A delivery is
+// given up on after DELIVERY_RETRIES failed retries or if it fails in a way
+// that retrying wouldn't fix.
+func RetryFailedDeliveries(conf Config, store Store, handler Handler, now time.Time) error {
+	deliveries, err := store.FailedDeliveries()
+	if err != nil {
+		return fmt.Errorf("failed to list the failed deliveries: %v", err)
+	}
+	for _, delivery := range deliveries {
+		if now.Before(delivery.NextAttemptAt) {
+			continue
+		}
+		request, err := http.NewRequest("POST", "/", bytes.NewReader(delivery.Body))
+		if err != nil {
+			return fmt.Errorf("failed to recreate delivery %s: %v", delivery.ID, err)
+		}
+		for header, value := range delivery.Headers {
+			request.Header.Set(header, value)
+		}
+		// The handler only returns the response. Writing it is up to
+		// Handler.ServeHTTP.
+		response := handler(nil, request)
+		if _, overloaded := response.(overloadedResponse); overloaded {
+			// The delivery wasn't attempted. The remaining ones would be
+			// refused as well, so they wait for the next round.
+			log.Printf("Too busy to retry delivery %s. Trying again later.\n", delivery.ID)
+			return nil
+		}
+		delivery.Attempts++
+		if !isTransientFailure(response) {
+			log.Printf("Retried delivery %s after %d attempt(s):\n", delivery.ID, delivery.Attempts)
+			response.logResponse()
+			if err = store.RemoveFailedDelivery(delivery.ID); err != nil {
+				return fmt.Errorf("failed to stop retrying delivery %s: %v", delivery.ID, err)
+			}
+			continue
+		} else if delivery.Attempts >= conf.DeliveryRetries {
+			log.Printf("Giving up on delivery %s after %d retries.\n", delivery.ID, delivery.Attempts)
+			response.logResponse()
+			if err = store.RemoveFailedDelivery(delivery.ID); err != nil {
+				return fmt.Errorf("failed to stop retrying delivery %s: %v", delivery.ID, err)
+			}
+			continue
+		}
+		errResp, _ := asErrorResponse(response)
+		delivery.LastError = errResp.ErrorMessage
+		delivery.NextAttemptAt = now.Add(conf.DeliveryRetryBackoff << uint(delivery.Attempts))
+		if err = store.UpdateFailedDelivery(delivery); err != nil {
+			return fmt.Errorf("failed to reschedule delivery %s: %v", delivery.ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package main_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("failed deliveries", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			store        grh.Store
+			repositories *mocks.Repositories
+			issues       *mocks.Issues
+		)
+		BeforeEach(func() {
+			store = *context.Store
+			repositories = *context.Repositories
+			issues = *context.Issues
+
+			context.Config.DeliveryRetries = 3
+			context.Config.DeliveryRetryBackoff = time.Minute
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event":    "issue_comment",
+				"X-Github-Delivery": "72d3162e-cc78-11e3-81ab-4c9367dc0958",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!hold", arbitraryIssueAuthor)
+		})
+
+		It("queues a webhook that failed because of GitHub to be retried", func() {
+			issues.
+				On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{"on-hold"}).
+				Return(emptyResult, emptyResponse, errArbitrary)
+
+			handle()
+			Expect((*context.ResponseRecorder).Code).To(Equal(http.StatusBadGateway))
+
+			deliveries, err := store.FailedDeliveries()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(deliveries).To(HaveLen(1))
+			Expect(deliveries[0].ID).To(Equal("72d3162e-cc78-11e3-81ab-4c9367dc0958"))
+			Expect(deliveries[0].Headers).To(HaveKeyWithValue("X-Github-Event", "issue_comment"))
+			Expect(deliveries[0].Headers["X-Hub-Signature"]).NotTo(BeEmpty())
+			Expect(string(deliveries[0].Body)).To(Equal(IssueCommentEvent("!hold", arbitraryIssueAuthor)))
+		})
+
+		It("doesn't queue a webhook that succeeded", func() {
+			issues.
+				On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{"on-hold"}).
+				Return(emptyResult, emptyResponse, noError)
+
+			handle()
+			Expect((*context.ResponseRecorder).Code).To(Equal(http.StatusOK))
+			Expect(store.FailedDeliveries()).To(BeEmpty())
+		})
+	})
+})
+
+var _ = Describe("RetryFailedDeliveries", func() {
+	var (
+		conf      grh.Config
+		store     grh.Store
+		now       time.Time
+		responses []grh.Response
+		handled   []*http.Request
+	)
+
+	handler := grh.Handler(func(w http.ResponseWriter, r *http.Request) grh.Response {
+		handled = append(handled, r)
+		response := responses[0]
+		responses = responses[1:]
+		return response
+	})
+	transientFailure := grh.ErrorResponse{errors.New("arbitrary error"), http.StatusBadGateway, "GitHub failed"}
+
+	BeforeEach(func() {
+		conf = grh.Config{DeliveryRetries: 2, DeliveryRetryBackoff: time.Minute}
+		store = grh.NewMemoryStore()
+		now = time.Now()
+		handled = nil
+		Expect(store.QueueFailedDelivery(grh.FailedDelivery{
+			ID:            "72d3162e-cc78-11e3-81ab-4c9367dc0958",
+			Headers:       map[string]string{"X-Github-Event": "issue_comment"},
+			Body:          []byte(`{"comment": {}}`),
+			NextAttemptAt: now.Add(time.Minute),
+		})).To(BeTrue())
+	})
+
+	It("waits until the delivery is due", func() {
+		Expect(grh.RetryFailedDeliveries(conf, store, handler, now)).To(Succeed())
+		Expect(handled).To(BeEmpty())
+	})
+
+	It("handles the delivery again and stops retrying it once it succeeds", func() {
+		responses = []grh.Response{grh.SuccessResponse{"Put PR on hold"}}
+		Expect(grh.RetryFailedDeliveries(conf, store, handler, now.Add(time.Minute))).To(Succeed())
+
+		Expect(handled).To(HaveLen(1))
+		Expect(handled[0].Header.Get("X-Github-Event")).To(Equal("issue_comment"))
+		body, err := ioutil.ReadAll(handled[0].Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(body)).To(Equal(`{"comment": {}}`))
+		Expect(store.FailedDeliveries()).To(BeEmpty())
+	})
+
+	It("backs off exponentially and gives up after the configured retries", func() {
+		responses = []grh.Response{transientFailure, transientFailure}
+		Expect(grh.RetryFailedDeliveries(conf, store, handler, now.Add(time.Minute))).To(Succeed())
+		deliveries, err := store.FailedDeliveries()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deliveries).To(HaveLen(1))
+		Expect(deliveries[0].Attempts).To(Equal(1))
+		Expect(deliveries[0].NextAttemptAt).To(Equal(now.Add(3 * time.Minute)))
+		Expect(deliveries[0].LastError).To(Equal("GitHub failed"))
+
+		Expect(grh.RetryFailedDeliveries(conf, store, handler, now.Add(2*time.Minute))).To(Succeed())
+		Expect(handled).To(HaveLen(1))
+
+		Expect(grh.RetryFailedDeliveries(conf, store, handler, now.Add(3*time.Minute))).To(Succeed())
+		Expect(handled).To(HaveLen(2))
+		Expect(store.FailedDeliveries()).To(BeEmpty())
+	})
+
+	It("stops retrying a delivery that fails in a way retrying wouldn't fix", func() {
+		responses = []grh.Response{grh.ErrorResponse{nil, http.StatusInternalServerError, "Failed to parse"}}
+		Expect(grh.RetryFailedDeliveries(conf, store, handler, now.Add(time.Minute))).To(Succeed())
+		Expect(store.FailedDeliveries()).To(BeEmpty())
+	})
+})
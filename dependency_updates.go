@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/git"
+)
+
+// The kinds of dependency updates, from the least to the most disruptive.
+// DEPENDENCY_AUTO_MERGE is the most disruptive kind that's merged
+// automatically.
+const (
+	PatchUpdate = "patch"
+	MinorUpdate = "minor"
+	MajorUpdate = "major"
+)
+
+var updateTypeRanks = map[string]int{
+	PatchUpdate: 1,
+	MinorUpdate: 2,
+	MajorUpdate: 3,
+}
+
+var (
+	// versionChangeRegexps match the version changes in the PRs of
+	// Dependabot, e.g. "Bump lodash from 4.17.20 to 4.17.21", and of
+	// Renovate, e.g. "| lodash | `4.17.20` -> `4.17.21` |"
+	versionChangeRegexps = []*regexp.Regexp{
+		regexp.MustCompile(`\bfrom v?([0-9][\w.+-]*) to v?([0-9][\w.+-]*)`),
+		regexp.MustCompile("`[\\^~]?v?([0-9][\\w.+-]*)` (?:->|→) `[\\^~]?v?([0-9][\\w.+-]*)`"),
+	}
+)
+
+func validateDependencyAutoMerge(updateType string) error {
+	if updateType != "" && updateType != PatchUpdate && updateType != MinorUpdate {
+		return fmt.Errorf("must be either \"%s\" or \"%s\", got \"%s\"", PatchUpdate, MinorUpdate, updateType)
+	}
+	return nil
+}
+
+// dependencyUpdateType returns the most disruptive kind of update among the
+// version changes the PR's title and description list. Returns false, if
+// there are no version changes the kind can be told of.
+func dependencyUpdateType(title, body string) (string, bool) {
+	updateType := ""
+	for _, text := range []string{title, body} {
+		for _, versionChangeRegexp := range versionChangeRegexps {
+			for _, match := range versionChangeRegexp.FindAllStringSubmatch(text, -1) {
+				changeType, ok := versionChangeType(match[1], match[2])
+				if !ok {
+					return "", false
+				} else if updateTypeRanks[changeType] > updateTypeRanks[updateType] {
+					updateType = changeType
+				}
+			}
+		}
+	}
+	return updateType, updateType != ""
+}
+
+// versionChangeType tells whether updating from one semantic version to the
+// other is a major, a minor or a patch update. Missing minor and patch
+// versions, e.g. in "2.1", count as 0.
+func versionChangeType(from, to string) (string, bool) {
+	fromParts, fromOK := versionParts(from)
+	toParts, toOK := versionParts(to)
+	if !fromOK || !toOK {
+		return "", false
+	} else if fromParts[0] != toParts[0] {
+		return MajorUpdate, true
+	} else if fromParts[1] != toParts[1] {
+		return MinorUpdate, true
+	}
+	return PatchUpdate, true
+}
+
+func versionParts(version string) ([3]int, bool) {
+	var parts [3]int
+	version = strings.TrimRight(version, ".")
+	// Pre-release and build metadata, e.g. "-beta.1", don't affect the
+	// kind of the update
+	if i := strings.IndexAny(version, "-+"); i != -1 {
+		version = version[:i]
+	}
+	fields := strings.Split(version, ".")
+	if len(fields) > len(parts) {
+		return parts, false
+	}
+	for i, field := range fields {
+		number, err := strconv.Atoi(field)
+		if err != nil {
+			return parts, false
+		}
+		parts[i] = number
+	}
+	return parts, true
+}
+
+// isDependencyBot checks whether the login is one of the DEPENDENCY_BOTS'.
+// GitHub logins are case-insensitive.
+func isDependencyBot(conf Config, login string) bool {
+	for _, bot := range conf.DependencyBots {
+		if strings.EqualFold(bot, login) {
+			return true
+		}
+	}
+	return false
+}
+
+// autoMergeDependencyUpdate labels the PRs opened by the DEPENDENCY_BOTS for
+// merging, if they only update dependencies by at most DEPENDENCY_AUTO_MERGE,
+// and merges them once they're ready, the same way as if "!merge" was
+// commented. With DEPENDENCY_AUTO_APPROVE, the bot approves the PRs first.
+func autoMergeDependencyUpdate(conf Config, pullRequestEvent PullRequestEvent, store Store, issues Issues,
+	pullRequests PullRequests, repositories Repositories, graphQL GraphQL, gitRepos git.Repos) *ErrorResponse {
+
+	if conf.DependencyAutoMerge == "" || !isDependencyBot(conf, pullRequestEvent.User.Login) {
+		return nil
+	}
+	issue := pullRequestEvent.Issue()
+	updateType, ok := dependencyUpdateType(pullRequestEvent.Title, pullRequestEvent.Body)
+	if !ok {
+		log.Printf("Couldn't tell the kind of the dependency update in PR %s. Not merging it automatically.\n",
+			issue.FullName())
+		return nil
+	} else if updateTypeRanks[updateType] > updateTypeRanks[conf.DependencyAutoMerge] {
+		log.Printf("PR %s is a %s dependency update. Not merging it automatically.\n", issue.FullName(),
+			updateType)
+		return nil
+	}
+	log.Printf("PR %s is a %s dependency update. Merging it once it's ready.\n", issue.FullName(), updateType)
+	if conf.DependencyAutoApprove {
+		_, _, err := pullRequests.CreateReview(context.TODO(), issue.Repository.Owner, issue.Repository.Name,
+			issue.Number, &github.PullRequestReviewRequest{
+				CommitID: github.String(pullRequestEvent.Head.SHA),
+				Body:     github.String(fmt.Sprintf("Approving the %s dependency update automatically.", updateType)),
+				Event:    github.String("APPROVE"),
+			})
+		if err != nil {
+			message := fmt.Sprintf("Failed to approve PR %s", issue.FullName())
+			return &ErrorResponse{err, http.StatusBadGateway, message}
+		}
+	}
+	if errResp := addLabel(issue.Repository, issue.Number, MergingLabel, issues); errResp != nil {
+		return errResp
+	}
+	response := mergeIfReady(conf, issue, false, store, issues, pullRequests, repositories, graphQL, gitRepos)
+	if errResp, isError := asErrorResponse(response); isError {
+		return &errResp
+	}
+	return nil
+}
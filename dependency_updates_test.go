@@ -0,0 +1,152 @@
+package main_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("dependency update auto-merge", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+
+			headSHA = "1235"
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+
+			context.Config.DependencyBots = []string{"dependabot[bot]", "renovate[bot]"}
+			context.Config.DependencyAutoMerge = grh.PatchUpdate
+
+			pullRequests.
+				On("ListCommits", anyContext, repositoryOwner, repositoryName, issueNumber,
+					mock.AnythingOfType("*github.ListOptions")).
+				Return(githubCommits(commit{headSHA, "Bump lodash"}), emptyResponse, noError)
+			repositories.
+				On("CreateStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.Anything).
+				Return(emptyResult, emptyResponse, noError)
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "pull_request",
+			}
+		})
+
+		openedEvent := func(author, title, body string) string {
+			event := PullRequestEvent("opened", headSHA, grh.Repository{
+				Owner: repositoryOwner,
+				Name:  repositoryName,
+				URL:   sshURL,
+			})
+			event = strings.Replace(event, `"login": "`+arbitraryIssueAuthor+`"`, `"login": "`+author+`"`, 1)
+			titleJSON, _ := json.Marshal(title)
+			bodyJSON, _ := json.Marshal(body)
+			return strings.Replace(event, `"pull_request": {`, `"pull_request": {
+    "title": `+string(titleJSON)+`,
+    "body": `+string(bodyJSON)+`,`, 1)
+		}
+
+		Context("with a patch update from Dependabot", func() {
+			requestJSON.Is(func() string {
+				return openedEvent("dependabot[bot]", "Bump lodash from 4.17.20 to 4.17.21",
+					"Bumps [lodash](https://github.com/lodash/lodash) from 4.17.20 to 4.17.21.")
+			})
+
+			BeforeEach(func() {
+				context.Config.DependencyAutoApprove = true
+
+				pullRequests.
+					On("CreateReview", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(func(review *github.PullRequestReviewRequest) bool {
+							return review.GetEvent() == "APPROVE" && review.GetCommitID() == headSHA
+						})).
+					Return(emptyResult, emptyResponse, noError).
+					Once()
+				issues.
+					On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+						[]string{grh.MergingLabel}).
+					Return(emptyResult, emptyResponse, noError).
+					Once()
+				pullRequests.
+					On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+					Return(&github.PullRequest{
+						Number:    github.Int(issueNumber),
+						Merged:    github.Bool(false),
+						Mergeable: github.Bool(true),
+						Base: &github.PullRequestBranch{
+							SHA:  github.String("1234"),
+							Ref:  github.String("master"),
+							Repo: repository,
+						},
+						Head: &github.PullRequestBranch{
+							SHA:  github.String(headSHA),
+							Ref:  github.String("feature"),
+							Repo: repository,
+						},
+					}, emptyResponse, noError)
+				repositories.
+					On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+						mock.AnythingOfType("*github.ListOptions")).
+					Return(&github.CombinedStatus{
+						State: github.String("pending"),
+					}, emptyResponse, noError)
+			})
+
+			It("approves the PR and labels it for merging", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				pullRequests.AssertExpectations(GinkgoT())
+				issues.AssertExpectations(GinkgoT())
+			})
+		})
+
+		Context("with a major update from Renovate", func() {
+			requestJSON.Is(func() string {
+				return openedEvent("renovate[bot]", "Update dependency react to v18",
+					"| Package | Change |\n|---|---|\n| react | `17.0.2` -> `18.2.0` |\n"+
+						"| react-dom | `17.0.1` -> `17.0.2` |")
+			})
+
+			It("leaves the PR for humans", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertNotCalled(GinkgoT(), "AddLabelsToIssue", anyContext, repositoryOwner, repositoryName,
+					issueNumber, mock.Anything)
+			})
+		})
+
+		Context("with a patch update from someone else than a dependency bot", func() {
+			requestJSON.Is(func() string {
+				return openedEvent(arbitraryIssueAuthor, "Bump lodash from 4.17.20 to 4.17.21", "")
+			})
+
+			It("leaves the PR for humans", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertNotCalled(GinkgoT(), "AddLabelsToIssue", anyContext, repositoryOwner, repositoryName,
+					issueNumber, mock.Anything)
+			})
+		})
+	})
+})
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+var deployCommandRegexp = regexp.MustCompile(`^!deploy\s+(\S+)$`)
+
+// finalDeploymentStates are the deployment states after which the deployment
+// is no longer tracked
+var finalDeploymentStates = map[string]bool{
+	"success":  true,
+	"failure":  true,
+	"error":    true,
+	"inactive": true,
+}
+
+func isDeployCommand(comment string) bool {
+	return deployCommandRegexp.MatchString(strings.TrimSpace(comment))
+}
+
+func parseDeployEnvironment(comment string) string {
+	return deployCommandRegexp.FindStringSubmatch(strings.TrimSpace(comment))[1]
+}
+
+// handleDeployCommand creates a GitHub deployment of the PR's head, or of
+// the merge commit, if the PR has been merged, to the environment and posts
+// a comment, which is updated with the deployment's statuses. Only the users
+// listed in DEPLOY_ENVIRONMENTS for the environment may deploy to it.
+func handleDeployCommand(conf Config, issueComment IssueComment, store Store, issues Issues,
+	pullRequests PullRequests, repositories Repositories) Response {
+
+	issue := issueComment.Issue()
+	commenter := issueComment.Commenter.Login
+	environment := parseDeployEnvironment(issueComment.Comment)
+	if reason := deployRefusal(conf, environment, commenter); reason != "" {
+		message := fmt.Sprintf("@%s, I can't deploy this PR to `%s`, because %s.", commenter, environment, reason)
+		if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+			errorMessage := fmt.Sprintf("Failed to refuse the deployment of PR %s", issue.FullName())
+			return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+		}
+		return SuccessResponse{fmt.Sprintf("Refused to deploy PR %s to %s: %s", issue.FullName(), environment,
+			reason)}
+	}
+	pr, errResp := getPR(issue, pullRequests)
+	if errResp != nil {
+		return errResp
+	}
+	ref := pr.GetHead().GetSHA()
+	if pr.GetMerged() {
+		ref = pr.GetMergeCommitSHA()
+	}
+	deployment, resp, err := repositories.CreateDeployment(context.TODO(), issue.Repository.Owner,
+		issue.Repository.Name, &github.DeploymentRequest{
+			Ref:         github.String(ref),
+			Environment: github.String(environment),
+			// The PR is deployed as is, without merging the base branch in
+			AutoMerge:   github.Bool(false),
+			Description: github.String(fmt.Sprintf("Deploying PR #%d, requested by @%s", issue.Number, commenter)),
+		})
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusConflict {
+			// GitHub refuses to deploy refs whose required statuses haven't
+			// succeeded
+			message := fmt.Sprintf("@%s, GitHub refused to deploy %s to `%s`, because its required "+
+				"statuses haven't succeeded yet.", commenter, shortSHA(ref), environment)
+			if err = comment(message, issue.Repository, issue.Number, issues); err != nil {
+				errorMessage := fmt.Sprintf("Failed to report the refused deployment of PR %s", issue.FullName())
+				return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+			}
+			return SuccessResponse{fmt.Sprintf("GitHub refused to deploy PR %s to %s", issue.FullName(),
+				environment)}
+		}
+		message := fmt.Sprintf("Failed to create a deployment of PR %s to %s", issue.FullName(), environment)
+		return ErrorResponse{err, http.StatusBadGateway, message}
+	}
+	tracked := TrackedDeployment{
+		Issue:       issue,
+		ID:          deployment.GetID(),
+		Environment: environment,
+		SHA:         ref,
+		RequestedBy: commenter,
+	}
+	created, _, err := issues.CreateComment(context.TODO(), issue.Repository.Owner, issue.Repository.Name,
+		issue.Number, &github.IssueComment{Body: github.String(deploymentMessage(tracked, "pending", "", ""))})
+	if err != nil {
+		message := fmt.Sprintf("Failed to report the deployment of PR %s", issue.FullName())
+		return ErrorResponse{err, http.StatusBadGateway, message}
+	}
+	tracked.CommentID = created.GetID()
+	if err = store.AddDeployment(tracked); err != nil {
+		message := fmt.Sprintf("Failed to track the deployment %d of PR %s", tracked.ID, issue.FullName())
+		return ErrorResponse{err, http.StatusInternalServerError, message}
+	}
+	log.Printf("%s deployed PR %s to %s as deployment %d.\n", commenter, issue.FullName(), environment,
+		tracked.ID)
+	return SuccessResponse{fmt.Sprintf("Created deployment %d of PR %s to %s", tracked.ID, issue.FullName(),
+		environment)}
+}
+
+// deployRefusal explains why the user can't deploy to the environment or
+// returns an empty string, if they can
+func deployRefusal(conf Config, environment, login string) string {
+	if len(conf.DeployEnvironments) == 0 {
+		return "deployments aren't configured"
+	}
+	allowed, exists := conf.DeployEnvironments[environment]
+	if !exists {
+		var environments []string
+		for name := range conf.DeployEnvironments {
+			environments = append(environments, "`"+name+"`")
+		}
+		sort.Strings(environments)
+		return fmt.Sprintf("it's not one of %s", strings.Join(environments, ", "))
+	}
+	for _, allowedLogin := range allowed {
+		if allowedLogin == "*" || strings.EqualFold(allowedLogin, login) {
+			return ""
+		}
+	}
+	return "you aren't allowed to deploy to it"
+}
+
+// handleDeploymentStatusEvent updates the comment about a deployment created
+// with !deploy with the deployment's new status. Deployments created by
+// anything else are ignored.
+func handleDeploymentStatusEvent(body []byte, store Store, issues Issues) Response {
+	deploymentStatusEvent, err := parseDeploymentStatusEvent(body)
+	if err != nil {
+		return ErrorResponse{err, http.StatusInternalServerError, "Failed to parse the request's body"}
+	}
+	repository := deploymentStatusEvent.Repository
+	tracked, exists, err := store.Deployment(repository, deploymentStatusEvent.DeploymentID)
+	if err != nil {
+		message := fmt.Sprintf("Failed to get the deployment %d", deploymentStatusEvent.DeploymentID)
+		return ErrorResponse{err, http.StatusInternalServerError, message}
+	} else if !exists {
+		return SuccessResponse{"Not a deployment created with !deploy. Ignoring."}
+	}
+	message := deploymentMessage(tracked, deploymentStatusEvent.State, deploymentStatusEvent.Description,
+		deploymentStatusEvent.TargetURL)
+	_, _, err = issues.EditComment(context.TODO(), repository.Owner, repository.Name, tracked.CommentID,
+		&github.IssueComment{Body: github.String(message)})
+	if err != nil {
+		errorMessage := fmt.Sprintf("Failed to update the deployment comment of PR %s", tracked.Issue.FullName())
+		return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	if finalDeploymentStates[deploymentStatusEvent.State] {
+		if err = store.RemoveDeployment(repository, tracked.ID); err != nil {
+			message := fmt.Sprintf("Failed to stop tracking the deployment %d", tracked.ID)
+			return ErrorResponse{err, http.StatusInternalServerError, message}
+		}
+	}
+	return SuccessResponse{fmt.Sprintf("Reported the %s status of deployment %d on PR %s",
+		deploymentStatusEvent.State, tracked.ID, tracked.Issue.FullName())}
+}
+
+func deploymentMessage(deployment TrackedDeployment, state, description, targetURL string) string {
+	message := fmt.Sprintf("Deployment of %s to `%s`, requested by @%s: **%s**", shortSHA(deployment.SHA),
+		deployment.Environment, deployment.RequestedBy, state)
+	if description != "" {
+		message += fmt.Sprintf("\n\n%s", description)
+	}
+	if targetURL != "" {
+		message += fmt.Sprintf("\n\n[Details](%s)", targetURL)
+	}
+	return message
+}
@@ -0,0 +1,235 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	var (
+		handle      = context.Handle
+		headers     = context.Headers
+		requestJSON = context.RequestJSON
+
+		responseRecorder *httptest.ResponseRecorder
+		store            grh.Store
+		pullRequests     *mocks.PullRequests
+		repositories     *mocks.Repositories
+		issues           *mocks.Issues
+
+		headSHA = "1235"
+		issue   = grh.Issue{
+			Number:     issueNumber,
+			Repository: grh.Repository{Owner: repositoryOwner, Name: repositoryName, URL: sshURL},
+		}
+	)
+	BeforeEach(func() {
+		responseRecorder = *context.ResponseRecorder
+		store = *context.Store
+		pullRequests = *context.PullRequests
+		repositories = *context.Repositories
+		issues = *context.Issues
+
+		context.Config.DeployEnvironments = map[string][]string{
+			"staging":    {"*"},
+			"production": {"alice"},
+		}
+	})
+
+	Describe("!deploy comment", func() {
+		var deployComment string
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent(deployComment, arbitraryIssueAuthor)
+		})
+
+		BeforeEach(func() {
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+		})
+
+		Context("to an environment open to all collaborators", func() {
+			BeforeEach(func() {
+				deployComment = "!deploy staging"
+			})
+
+			It("creates a deployment of the head and tracks it", func() {
+				pullRequests.
+					On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+					Return(&github.PullRequest{
+						Number: github.Int(issueNumber),
+						Merged: github.Bool(false),
+						Head: &github.PullRequestBranch{
+							SHA:  github.String(headSHA),
+							Ref:  github.String("feature"),
+							Repo: repository,
+						},
+					}, emptyResponse, noError)
+				repositories.
+					On("CreateDeployment", anyContext, repositoryOwner, repositoryName,
+						mock.MatchedBy(func(request *github.DeploymentRequest) bool {
+							return request.GetRef() == headSHA && request.GetEnvironment() == "staging" &&
+								!request.GetAutoMerge()
+						})).
+					Return(&github.Deployment{ID: github.Int64(42)}, emptyResponse, noError).
+					Once()
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("to `staging`"))).
+					Return(&github.IssueComment{ID: github.Int64(1000)}, emptyResponse, noError).
+					Once()
+
+				handle()
+
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				tracked, exists, err := store.Deployment(issue.Repository, 42)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(exists).To(BeTrue())
+				Expect(tracked.CommentID).To(Equal(int64(1000)))
+				Expect(tracked.RequestedBy).To(Equal(arbitraryIssueAuthor))
+			})
+		})
+
+		Context("to an environment the commenter isn't allowed to deploy to", func() {
+			BeforeEach(func() {
+				deployComment = "!deploy production"
+			})
+
+			It("refuses to deploy", func() {
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("you aren't allowed to deploy to it"))).
+					Return(emptyResult, emptyResponse, noError).
+					Once()
+
+				handle()
+
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				repositories.AssertNotCalled(GinkgoT(), "CreateDeployment", anyContext, repositoryOwner,
+					repositoryName, mock.Anything)
+			})
+		})
+
+		Context("to an unknown environment", func() {
+			BeforeEach(func() {
+				deployComment = "!deploy qa"
+			})
+
+			It("lists the configured environments", func() {
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("`production`, `staging`"))).
+					Return(emptyResult, emptyResponse, noError).
+					Once()
+
+				handle()
+
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			})
+		})
+	})
+
+	Describe("deployment_status event", func() {
+		var state string
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "deployment_status",
+			}
+		})
+		requestJSON.Is(func() string {
+			return `{
+  "deployment_status": {
+    "state": "` + state + `",
+    "description": "Rolled out",
+    "log_url": "https://ci.example.com/deploys/42"
+  },
+  "deployment": {
+    "id": 42,
+    "sha": "` + headSHA + `",
+    "environment": "staging"
+  },
+  "repository": {
+    "name": "` + repositoryName + `",
+    "owner": {
+      "login": "` + repositoryOwner + `"
+    },
+    "ssh_url": "` + sshURL + `"
+  }
+}`
+		})
+
+		BeforeEach(func() {
+			Expect(store.AddDeployment(grh.TrackedDeployment{
+				Issue:       issue,
+				ID:          42,
+				Environment: "staging",
+				SHA:         headSHA,
+				RequestedBy: arbitraryIssueAuthor,
+				CommentID:   1000,
+			})).To(Succeed())
+		})
+
+		deploymentComment := func(state string) interface{} {
+			return mock.MatchedBy(func(comment *github.IssueComment) bool {
+				return strings.Contains(comment.GetBody(), "**"+state+"**") &&
+					strings.Contains(comment.GetBody(), "https://ci.example.com/deploys/42")
+			})
+		}
+
+		Context("with the deployment in progress", func() {
+			BeforeEach(func() {
+				state = "in_progress"
+			})
+
+			It("updates the comment and keeps tracking the deployment", func() {
+				issues.
+					On("EditComment", anyContext, repositoryOwner, repositoryName, int64(1000),
+						deploymentComment("in_progress")).
+					Return(emptyResult, emptyResponse, noError).
+					Once()
+
+				handle()
+
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				_, exists, _ := store.Deployment(issue.Repository, 42)
+				Expect(exists).To(BeTrue())
+			})
+		})
+
+		Context("with the deployment succeeded", func() {
+			BeforeEach(func() {
+				state = "success"
+			})
+
+			It("updates the comment and stops tracking the deployment", func() {
+				issues.
+					On("EditComment", anyContext, repositoryOwner, repositoryName, int64(1000),
+						deploymentComment("success")).
+					Return(emptyResult, emptyResponse, noError).
+					Once()
+
+				handle()
+
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				_, exists, _ := store.Deployment(issue.Repository, 42)
+				Expect(exists).To(BeFalse())
+			})
+		})
+	})
+})
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"time"
+)
+
+// How often to check for notifications that are due to be posted in a digest
+const notificationDigestCheckInterval = time.Minute
+
+// notify posts a non-critical message on the PR. In repositories that have
+// opted into digests, the message is queued to be posted in the PR's next
+// digest instead. Merges, conflicts and other messages asking for action
+// should be commented right away.
+func notify(conf Config, message string, issue Issue, store Store, issues Issues) error {
+	if conf.NotificationDigestInterval == 0 {
+		return comment(message, issue.Repository, issue.Number, issues)
+	}
+	return store.AddNotification(Notification{
+		Repository:  issue.Repository,
+		PullRequest: issue.Number,
+		Message:     message,
+		CreatedAt:   time.Now(),
+	})
+}
+
+// runNotificationDigests periodically posts the notification digests that are
+// due, until stop is closed.
+func runNotificationDigests(configSource ConfigSource, store Store, issues Issues, stop <-chan struct{}) {
+	ticker := time.NewTicker(notificationDigestCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if pausedForGithubIncident("notification digests") {
+				continue
+			}
+			if err := PostNotificationDigests(configSource.Current(), store, issues, time.Now()); err != nil {
+				log.Printf("Posting notification digests failed: %v\n", err)
+			}
+		}
+	}
+}
+
+// PostNotificationDigests posts a single comment for every PR whose oldest
+// queued notification has waited for the repository's digest interval,
+// listing all of the PR's queued notifications.
+func PostNotificationDigests(conf Config, store Store, issues Issues, now time.Time) error {
+	notifications, err := store.Notifications()
+	if err != nil {
+		return fmt.Errorf("failed to list notifications: %v", err)
+	}
+	var issueOrder []Issue
+	notificationsByIssue := make(map[string][]Notification)
+	for _, notification := range notifications {
+		issue := Issue{Number: notification.PullRequest, Repository: notification.Repository}
+		if _, exists := notificationsByIssue[issue.FullName()]; !exists {
+			issueOrder = append(issueOrder, issue)
+		}
+		notificationsByIssue[issue.FullName()] = append(notificationsByIssue[issue.FullName()], notification)
+	}
+	for _, issue := range issueOrder {
+		issueNotifications := notificationsByIssue[issue.FullName()]
+		repoConf, errResp := repositoryConfig(conf, issue.Repository, store)
+		if errResp != nil {
+			return errResp.Error
+		}
+		// If the repository has opted out of digests since, then the digest
+		// is posted right away
+		if now.Sub(issueNotifications[0].CreatedAt) < repoConf.NotificationDigestInterval {
+			continue
+		}
+		if err = comment(formatDigest(issueNotifications), issue.Repository, issue.Number, issues); err != nil {
+			log.Printf("Failed to post the notification digest of PR %s: %v\n", issue.FullName(), err)
+			continue
+		}
+		latest := issueNotifications[len(issueNotifications)-1].CreatedAt
+		if err = store.RemoveNotifications(issue.Repository, issue.Number, latest); err != nil {
+			return fmt.Errorf("failed to remove the posted notifications of PR %s: %v", issue.FullName(), err)
+		}
+	}
+	return nil
+}
+
+func formatDigest(notifications []Notification) string {
+	if len(notifications) == 1 {
+		return notifications[0].Message
+	}
+	var digest bytes.Buffer
+	digest.WriteString("Here's what has happened with this PR since my last update:\n")
+	for _, notification := range notifications {
+		fmt.Fprintf(&digest, "\n- %s", notification.Message)
+	}
+	return digest.String()
+}
@@ -0,0 +1,84 @@
+package main_test
+
+import (
+	"time"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PostNotificationDigests", func() {
+	var (
+		store  grh.Store
+		issues *mocks.Issues
+		now    time.Time
+
+		repository = grh.Repository{Owner: repositoryOwner, Name: repositoryName}
+	)
+
+	BeforeEach(func() {
+		store = grh.NewMemoryStore()
+		issues = new(mocks.Issues)
+		now = time.Now()
+
+		digestInterval := grh.Duration(10 * time.Minute)
+		Expect(store.SetPolicies(grh.PolicySet{Repositories: map[string]grh.Policy{
+			repositoryOwner + "/" + repositoryName: {NotificationDigestInterval: &digestInterval},
+		}})).To(Succeed())
+		for _, notification := range []grh.Notification{
+			{Repository: repository, PullRequest: 1, Message: "first", CreatedAt: now.Add(-11 * time.Minute)},
+			{Repository: repository, PullRequest: 2, Message: "recent", CreatedAt: now.Add(-5 * time.Minute)},
+			{Repository: repository, PullRequest: 1, Message: "second", CreatedAt: now.Add(-time.Minute)},
+		} {
+			Expect(store.AddNotification(notification)).To(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		issues.AssertExpectations(GinkgoT())
+	})
+
+	Context("with the PR's oldest notification having waited for the digest interval", func() {
+		BeforeEach(func() {
+			issues.
+				On("CreateComment", anyContext, repositoryOwner, repositoryName, 1,
+					mock.MatchedBy(func(issueComment *github.IssueComment) bool {
+						return *issueComment.Body == "Here's what has happened with this PR since my last update:\n"+
+							"\n- first\n- second"
+					})).
+				Return(emptyResult, emptyResponse, noError)
+		})
+
+		It("posts the PR's notifications in a single comment", func() {
+			Expect(grh.PostNotificationDigests(grh.Config{}, store, issues, now)).To(Succeed())
+
+			notifications, err := store.Notifications()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(notifications).To(HaveLen(1))
+			Expect(notifications[0].Message).To(Equal("recent"))
+		})
+	})
+
+	Context("with the repository having opted out of digests", func() {
+		BeforeEach(func() {
+			Expect(store.SetPolicies(grh.PolicySet{})).To(Succeed())
+			issues.
+				On("CreateComment", anyContext, repositoryOwner, repositoryName, 1, mock.Anything).
+				Return(emptyResult, emptyResponse, noError)
+			issues.
+				On("CreateComment", anyContext, repositoryOwner, repositoryName, 2,
+					mock.MatchedBy(commentContaining("recent"))).
+				Return(emptyResult, emptyResponse, noError)
+		})
+
+		It("posts all of the digests right away", func() {
+			Expect(grh.PostNotificationDigests(grh.Config{}, store, issues, now)).To(Succeed())
+			Expect(store.Notifications()).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/google/go-github/github"
+)
+
+// reportDiskFull tells the PR's author that the bot can't squash or merge the
+// PR, because cloning its repository would exceed GIT_DISK_QUOTA. The
+// webhook still fails, so that the refusal would show up in the webhook's
+// deliveries.
+func reportDiskFull(conf Config, pr *github.PullRequest, err error, store Store, issues Issues) *ErrorResponse {
+	issue := prIssue(pr)
+	log.Printf("Not cloning %s for PR %s: %v\n", repositoryKey(issue.Repository), issue.FullName(), err)
+	message := renderMessage(conf, diskFullMessage, MessageData{
+		Repository: issue.Repository,
+		PR:         issue.Number,
+		Author:     issue.User.Login,
+		Version:    version,
+	})
+	if commentErr := stickyComment(conf, message, issue, store, issues); commentErr != nil {
+		errorMessage := fmt.Sprintf("Failed to notify the author of PR %s about the full disk", issue.FullName())
+		return &ErrorResponse{commentErr, http.StatusBadGateway, errorMessage}
+	}
+	errorMessage := fmt.Sprintf("No room to clone the repository of PR %s", issue.FullName())
+	return &ErrorResponse{err, http.StatusInsufficientStorage, errorMessage}
+}
+
+// replyDiskFull tells the commenter that the bot can't carry out their
+// command, because cloning the repository would exceed GIT_DISK_QUOTA.
+func replyDiskFull(repository Repository, err error, reply func(string) error) Response {
+	log.Printf("Not cloning %s for a command: %v\n", repositoryKey(repository), err)
+	if replyErr := reply("I'm unable to clone this repository, because the disk I keep my clones on is full. " +
+		"I'll make room by removing the clones I haven't used in a while. Please try again later."); replyErr != nil {
+		errorMessage := fmt.Sprintf("Failed to report the full disk in %s", repositoryKey(repository))
+		return ErrorResponse{replyErr, http.StatusBadGateway, errorMessage}
+	}
+	errorMessage := fmt.Sprintf("No room to clone %s", repositoryKey(repository))
+	return ErrorResponse{err, http.StatusInsufficientStorage, errorMessage}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/gitea"
+	"github.com/salemove/github-review-helper/gitlab"
+)
+
+// Driver provides the clients of a code hosting provider. The handlers only
+// talk to the provider through them, so that the same bot could serve GitHub,
+// GitLab and Gitea repositories.
+type Driver interface {
+	PullRequests() PullRequests
+	Repositories() Repositories
+	Issues() Issues
+	Search() Search
+	GraphQL() GraphQL
+}
+
+type githubDriver struct {
+	client  *github.Client
+	graphQL GraphQL
+}
+
+// NewGithubDriver creates the driver for GitHub's REST and GraphQL APIs.
+func NewGithubDriver(httpClient *http.Client) Driver {
+	return githubDriver{
+		client:  github.NewClient(httpClient),
+		graphQL: NewGraphQLClient(httpClient),
+	}
+}
+
+func (d githubDriver) PullRequests() PullRequests { return d.client.PullRequests }
+func (d githubDriver) Repositories() Repositories { return d.client.Repositories }
+func (d githubDriver) Issues() Issues             { return d.client.Issues }
+func (d githubDriver) Search() Search             { return d.client.Search }
+func (d githubDriver) GraphQL() GraphQL           { return d.graphQL }
+
+type gitlabDriver struct {
+	client *gitlab.Client
+}
+
+// NewGitlabDriver creates the driver for the GitLab instance at baseURL.
+// GitLab has no equivalent for the GitHub GraphQL queries, so the features
+// relying on them fail on GitLab.
+func NewGitlabDriver(httpClient *http.Client, baseURL, token string) Driver {
+	return gitlabDriver{gitlab.NewClient(httpClient, baseURL, token)}
+}
+
+func (d gitlabDriver) PullRequests() PullRequests { return d.client.PullRequests }
+func (d gitlabDriver) Repositories() Repositories { return d.client.Repositories }
+func (d gitlabDriver) Issues() Issues             { return d.client.Issues }
+func (d gitlabDriver) Search() Search             { return d.client.Search }
+func (d gitlabDriver) GraphQL() GraphQL           { return unsupportedGraphQL{gitlab.ErrUnsupported} }
+
+type giteaDriver struct {
+	client *gitea.Client
+}
+
+// NewGiteaDriver creates the driver for the Gitea or Forgejo instance at
+// baseURL. Like GitLab, Gitea has no equivalent for the GitHub GraphQL
+// queries.
+func NewGiteaDriver(httpClient *http.Client, baseURL, token string) (Driver, error) {
+	client, err := gitea.NewClient(httpClient, baseURL, token)
+	if err != nil {
+		return nil, err
+	}
+	return giteaDriver{client}, nil
+}
+
+func (d giteaDriver) PullRequests() PullRequests { return d.client.PullRequests }
+func (d giteaDriver) Repositories() Repositories { return d.client.Repositories }
+func (d giteaDriver) Issues() Issues             { return d.client.Issues }
+func (d giteaDriver) Search() Search             { return d.client.Search }
+func (d giteaDriver) GraphQL() GraphQL           { return unsupportedGraphQL{gitea.ErrUnsupported} }
+
+// unsupportedGraphQL fails all queries with the provider's error for
+// unsupported operations.
+type unsupportedGraphQL struct {
+	err error
+}
+
+func (g unsupportedGraphQL) Query(ctx context.Context, query string, variables map[string]interface{},
+	result interface{}) error {
+
+	return unsupportedError{g.err}
+}
+
+// unsupportedError fails the GraphQL queries of the providers that have no
+// equivalent for them, so that the gates and the commands relying on them
+// could be refused instead of failing as if the provider was down.
+type unsupportedError struct {
+	err error
+}
+
+func (e unsupportedError) Error() string {
+	return "GraphQL queries are " + e.err.Error()
+}
+
+// asUnsupported finds the unsupportedError the error wraps, if any.
+func asUnsupported(err error) (unsupportedError, bool) {
+	var unsupported unsupportedError
+	return unsupported, errors.As(err, &unsupported)
+}
+
+// refuseUnsupportedCommand replies to a command that failed, because it
+// relies on the GraphQL queries the provider doesn't support, that it isn't
+// supported. Other responses are returned as they are.
+func refuseUnsupportedCommand(issueComment IssueComment, commentCategory commentType, response Response,
+	issues Issues) Response {
+
+	errResp, failed := asErrorResponse(response)
+	if !failed {
+		return response
+	}
+	unsupported, isUnsupported := asUnsupported(errResp.Error)
+	if !isUnsupported {
+		return response
+	}
+	message := fmt.Sprintf("`%s` isn't supported here: %s.", commandNames[commentCategory], unsupported.Error())
+	if err := comment(message, issueComment.Repository, issueComment.IssueNumber, issues); err != nil {
+		return ErrorResponse{err, http.StatusBadGateway, "Failed to respond to an unsupported command"}
+	}
+	return SuccessResponse{"Command isn't supported by the provider. Responded with a comment."}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// ErrorReport describes an error the bot ran into while handling a webhook,
+// with enough context to find the webhook's delivery and the PR it was
+// about.
+type ErrorReport struct {
+	WebhookContext
+	Error   error
+	Message string
+	Code    int
+	Panic   bool
+}
+
+// ErrorReporter sends errors to an error tracking service, instead of them
+// only surfacing as HTTP statuses in GitHub's webhook log.
+type ErrorReporter interface {
+	Report(ErrorReport)
+	// Flush waits for the reports to be sent for at most timeout.
+	Flush(timeout time.Duration)
+}
+
+type noopErrorReporter struct{}
+
+func (noopErrorReporter) Report(ErrorReport)  {}
+func (noopErrorReporter) Flush(time.Duration) {}
+
+// NewErrorReporter creates an ErrorReporter sending the errors to Sentry, if
+// a DSN is configured. Otherwise the errors are only logged, as before.
+func NewErrorReporter(conf Config) (ErrorReporter, error) {
+	if conf.SentryDSN == "" {
+		return noopErrorReporter{}, nil
+	}
+	return newSentryReporter(conf.SentryDSN, conf.SentryEnvironment)
+}
+
+// webhookReporter reports the errors of handling a webhook, including the
+// ones of the asynchronous operations it started, with the webhook's context.
+type webhookReporter struct {
+	reporter ErrorReporter
+	report   ErrorReport
+}
+
+// run runs the handler, reporting its error response. A panic is reported
+// and responded to with an error.
+func (w webhookReporter) run(handle func() Response) (response Response) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			response = w.reportPanic(recovered)
+		}
+	}()
+	response = handle()
+	w.reportResponse(response)
+	return response
+}
+
+// reportResponse reports the response, if it's a server error. Client errors,
+// e.g. failed authentication, aren't the bot's problem.
+func (w webhookReporter) reportResponse(response Response) {
+	errResp, ok := asErrorResponse(response)
+	if !ok || errResp.Code < http.StatusInternalServerError {
+		return
+	}
+	report := w.report
+	report.Error = errResp.Error
+	report.Message = errResp.ErrorMessage
+	report.Code = errResp.Code
+	w.reporter.Report(report)
+}
+
+// reportPanic reports the recovered panic with the stack of the panicking
+// goroutine. Must be called from the deferred function that recovered.
+func (w webhookReporter) reportPanic(recovered interface{}) ErrorResponse {
+	stack := debug.Stack()
+	log.Printf("Panic: %v\n%s", recovered, stack)
+	errResp := ErrorResponse{fmt.Errorf("panic: %v", recovered), http.StatusInternalServerError,
+		"Panicked while handling the webhook"}
+	report := w.report
+	report.Error = errResp.Error
+	report.Message = errResp.ErrorMessage
+	report.Code = errResp.Code
+	report.Panic = true
+	w.reporter.Report(report)
+	return errResp
+}
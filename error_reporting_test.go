@@ -0,0 +1,106 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type recordingErrorReporter struct {
+	sync.Mutex
+	reports []grh.ErrorReport
+}
+
+func (r *recordingErrorReporter) Report(report grh.ErrorReport) {
+	r.Lock()
+	defer r.Unlock()
+	r.reports = append(r.reports, report)
+}
+
+func (r *recordingErrorReporter) Flush(time.Duration) {}
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("error reporting", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			repositories     *mocks.Repositories
+			reporter         *recordingErrorReporter
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			repositories = *context.Repositories
+			reporter = &recordingErrorReporter{}
+			*context.ErrorReporter = reporter
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event":    "issue_comment",
+				"X-Github-Delivery": "72d3162e-cc78-11e3-81ab-4c9367dc0958",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!merge", arbitraryIssueAuthor)
+		})
+
+		expectReportedContext := func(report grh.ErrorReport) {
+			Expect(report.Event).To(Equal("issue_comment"))
+			Expect(report.DeliveryID).To(Equal("72d3162e-cc78-11e3-81ab-4c9367dc0958"))
+			Expect(report.Repository.Owner).To(Equal(repositoryOwner))
+			Expect(report.Repository.Name).To(Equal(repositoryName))
+			Expect(report.PullRequest).To(Equal(issueNumber))
+			Expect(report.Command).To(Equal("!merge"))
+		}
+
+		Context("with the handler failing", func() {
+			BeforeEach(func() {
+				repositories.
+					On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+					Return(false, emptyResponse, errArbitrary)
+			})
+
+			It("reports the error with the webhook's context", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusBadGateway))
+				Expect(reporter.reports).To(HaveLen(1))
+				report := reporter.reports[0]
+				expectReportedContext(report)
+				Expect(report.Error).To(Equal(errArbitrary))
+				Expect(report.Code).To(Equal(http.StatusBadGateway))
+				Expect(report.Panic).To(BeFalse())
+			})
+		})
+
+		Context("with the handler panicking", func() {
+			BeforeEach(func() {
+				repositories.
+					On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+					Run(func(mock.Arguments) {
+						panic("boom")
+					})
+			})
+
+			It("reports the panic and responds with an error", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusInternalServerError))
+				Expect(reporter.reports).To(HaveLen(1))
+				report := reporter.reports[0]
+				expectReportedContext(report)
+				Expect(report.Panic).To(BeTrue())
+				Expect(report.Error).To(MatchError(ContainSubstring("boom")))
+			})
+		})
+	})
+})
@@ -0,0 +1,139 @@
+// Package evaluator decides whether a PR is ready to be merged by checking it
+// against a list of rules. Besides the decision itself, it records the
+// outcome of every rule and the evidence the outcome was based on, so that
+// the decision could be explained to the PR's author.
+package evaluator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Outcome is the result of checking a PR against a single rule.
+type Outcome string
+
+const (
+	// Pass means that the rule doesn't block the PR from being merged
+	Pass Outcome = "pass"
+	// Fail means that the rule blocks the PR until someone acts on it
+	Fail Outcome = "fail"
+	// Pending means that the rule blocks the PR until something finishes,
+	// e.g. a CI build
+	Pending Outcome = "pending"
+	// Skipped means that the rule wasn't checked, because an earlier rule
+	// had already blocked the PR
+	Skipped Outcome = "skipped"
+)
+
+var outcomeIcons = map[Outcome]string{
+	Pass:    ":white_check_mark:",
+	Fail:    ":x:",
+	Pending: ":hourglass:",
+	Skipped: ":fast_forward:",
+}
+
+// Rule is a single condition a PR has to meet before it's merged.
+type Rule struct {
+	Name string
+	// Check checks the PR against the rule. Rules are checked lazily, so
+	// Check can query whatever it needs.
+	Check func() (Result, error)
+}
+
+// Result is the outcome of a rule and the reasoning behind it.
+type Result struct {
+	Outcome Outcome `json:"outcome"`
+	// Reason explains why the rule blocks the PR. It's phrased to complete
+	// the sentence "I'm not merging this PR, because ...".
+	Reason string `json:"reason,omitempty"`
+	// Evidence lists the facts the outcome was based on
+	Evidence []string `json:"evidence,omitempty"`
+	// Children are the outcomes of the parts of the rule, e.g. of every
+	// status context
+	Children []Node `json:"children,omitempty"`
+}
+
+// Node is a rule's result in a decision tree.
+type Node struct {
+	Rule string `json:"rule"`
+	Result
+}
+
+// Decision is the outcome of checking a PR against a list of rules.
+type Decision struct {
+	Nodes []Node `json:"rules"`
+}
+
+// Evaluate checks the rules in order. If exhaustive is false, then the rules
+// after the first blocking rule are skipped. Evaluation stops at the first
+// error.
+func Evaluate(rules []Rule, exhaustive bool) (Decision, error) {
+	decision := Decision{Nodes: make([]Node, 0, len(rules))}
+	blocked := false
+	for _, rule := range rules {
+		if blocked && !exhaustive {
+			decision.Nodes = append(decision.Nodes, Node{Rule: rule.Name, Result: Result{Outcome: Skipped}})
+			continue
+		}
+		result, err := rule.Check()
+		if err != nil {
+			return Decision{}, err
+		}
+		decision.Nodes = append(decision.Nodes, Node{Rule: rule.Name, Result: result})
+		if result.Outcome == Fail || result.Outcome == Pending {
+			blocked = true
+		}
+	}
+	return decision, nil
+}
+
+// Ready reports whether none of the rules block the PR.
+func (d Decision) Ready() bool {
+	return d.Blocker() == nil
+}
+
+// Blocker returns the first rule that blocks the PR or nil, if the PR is
+// ready to be merged.
+func (d Decision) Blocker() *Node {
+	for i, node := range d.Nodes {
+		if node.Outcome == Fail || node.Outcome == Pending {
+			return &d.Nodes[i]
+		}
+	}
+	return nil
+}
+
+// Find returns the result of the named rule or nil, if the decision doesn't
+// include the rule.
+func (d Decision) Find(rule string) *Node {
+	for i, node := range d.Nodes {
+		if node.Rule == rule {
+			return &d.Nodes[i]
+		}
+	}
+	return nil
+}
+
+// Markdown renders the decision tree as a nested Markdown list.
+func (d Decision) Markdown() string {
+	var builder strings.Builder
+	writeNodes(&builder, d.Nodes, 0)
+	return builder.String()
+}
+
+func writeNodes(builder *strings.Builder, nodes []Node, depth int) {
+	indent := strings.Repeat("  ", depth)
+	for _, node := range nodes {
+		fmt.Fprintf(builder, "%s- %s **%s**", indent, outcomeIcons[node.Outcome], node.Rule)
+		if node.Reason != "" {
+			fmt.Fprintf(builder, ": %s", node.Reason)
+		} else if node.Outcome == Skipped {
+			builder.WriteString(": not checked")
+		}
+		builder.WriteString("\n")
+		for _, evidence := range node.Evidence {
+			fmt.Fprintf(builder, "%s  - %s\n", indent, evidence)
+		}
+		writeNodes(builder, node.Children, depth+1)
+	}
+}
@@ -0,0 +1,93 @@
+package evaluator_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/salemove/github-review-helper/evaluator"
+)
+
+func staticRule(name string, result evaluator.Result) evaluator.Rule {
+	return evaluator.Rule{
+		Name: name,
+		Check: func() (evaluator.Result, error) {
+			return result, nil
+		},
+	}
+}
+
+var (
+	passing = staticRule("passing", evaluator.Result{Outcome: evaluator.Pass, Evidence: []string{"all good"}})
+	failing = staticRule("failing", evaluator.Result{Outcome: evaluator.Fail, Reason: "it's on hold"})
+	pending = staticRule("pending", evaluator.Result{Outcome: evaluator.Pending, Reason: "CI is running"})
+)
+
+func TestEvaluate(t *testing.T) {
+	decision, err := evaluator.Evaluate([]evaluator.Rule{passing, failing, pending}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var outcomes []evaluator.Outcome
+	for _, node := range decision.Nodes {
+		outcomes = append(outcomes, node.Outcome)
+	}
+	expected := []evaluator.Outcome{evaluator.Pass, evaluator.Fail, evaluator.Skipped}
+	if !reflect.DeepEqual(outcomes, expected) {
+		t.Fatalf("Expected outcomes %v, but got %v", expected, outcomes)
+	}
+	if decision.Ready() {
+		t.Fatal("Expected the decision not to be ready")
+	}
+	if blocker := decision.Blocker(); blocker == nil || blocker.Reason != "it's on hold" {
+		t.Fatalf("Expected the failing rule to block the PR, but got %+v", blocker)
+	}
+}
+
+func TestEvaluate_exhaustive(t *testing.T) {
+	decision, err := evaluator.Evaluate([]evaluator.Rule{pending, failing}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node := decision.Find("failing"); node == nil || node.Outcome != evaluator.Fail {
+		t.Fatalf("Expected the failing rule to be checked, but got %+v", node)
+	}
+	if blocker := decision.Blocker(); blocker == nil || blocker.Rule != "pending" {
+		t.Fatalf("Expected the first blocking rule to be the blocker, but got %+v", blocker)
+	}
+}
+
+func TestEvaluate_error(t *testing.T) {
+	expectedErr := errors.New("an error")
+	erroring := evaluator.Rule{
+		Name: "erroring",
+		Check: func() (evaluator.Result, error) {
+			return evaluator.Result{}, expectedErr
+		},
+	}
+	if _, err := evaluator.Evaluate([]evaluator.Rule{passing, erroring}, true); err != expectedErr {
+		t.Fatalf("Expected %v, but got %v", expectedErr, err)
+	}
+}
+
+func TestDecision_Markdown(t *testing.T) {
+	statuses := staticRule("statuses", evaluator.Result{
+		Outcome: evaluator.Pass,
+		Children: []evaluator.Node{
+			{Rule: "ci", Result: evaluator.Result{Outcome: evaluator.Pass}},
+		},
+	})
+	decision, err := evaluator.Evaluate([]evaluator.Rule{passing, statuses, failing, pending}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "- :white_check_mark: **passing**\n" +
+		"  - all good\n" +
+		"- :white_check_mark: **statuses**\n" +
+		"  - :white_check_mark: **ci**\n" +
+		"- :x: **failing**: it's on hold\n" +
+		"- :fast_forward: **pending**: not checked\n"
+	if markdown := decision.Markdown(); markdown != expected {
+		t.Fatalf("Expected:\n%s\nGot:\n%s", expected, markdown)
+	}
+}
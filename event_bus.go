@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// The events published to EVENT_BUS_URL
+const (
+	CommandReceivedEvent  = "command_received"
+	MergeCompletedEvent   = "merge_completed"
+	SquashPushedEvent     = "squash_pushed"
+	ConflictDetectedEvent = "conflict_detected"
+)
+
+// eventBusRetryInterval is how often the events that couldn't be published
+// are tried again
+const eventBusRetryInterval = 10 * time.Second
+
+const eventBusTimeout = 30 * time.Second
+
+// maxQueuedBusEvents bounds the queue of the events waiting to be published,
+// so that a bus that's down for long wouldn't grow the store without limit.
+// The events that don't fit are dropped.
+const maxQueuedBusEvents = 10000
+
+// maxDeadLetteredBusEvents is how many of the events the bus has rejected are
+// kept for inspection
+const maxDeadLetteredBusEvents = 1000
+
+var eventBusHTTPClient = &http.Client{Timeout: eventBusTimeout}
+
+// failedBusEventPublishes counts the failed attempts to publish the events.
+// Reported by /debug/vars.
+var failedBusEventPublishes = expvar.NewInt("failed_bus_event_publishes")
+
+// droppedBusEvents counts the events that were dropped, because the queue
+// was full. Reported by /debug/vars.
+var droppedBusEvents = expvar.NewInt("dropped_bus_events")
+
+// deadLetteredBusEvents counts the events that were moved to the dead letters,
+// because the bus rejected them. Reported by /debug/vars.
+var deadLetteredBusEvents = expvar.NewInt("dead_lettered_bus_events")
+
+// busEventQueued wakes up the publisher, so that the events wouldn't wait
+// for the next retry
+var busEventQueued = make(chan struct{}, 1)
+
+// BusEvent is an event published to the message bus, so that downstream
+// automation could react to what the bot does. Events can be delivered more
+// than once, so the consumers should use the ID to skip the duplicates.
+type BusEvent struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	Repository  string    `json:"repository"`
+	PullRequest int       `json:"pull_request"`
+	Actor       string    `json:"actor,omitempty"`
+	Command     string    `json:"command,omitempty"`
+	SHA         string    `json:"sha,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+// EventBus is the message bus the events are published to. It's either a
+// NATS server, where the events are published to the URL's path as the
+// subject, or a Kafka REST proxy's topic.
+type EventBus struct {
+	// Backend is either "nats" or "kafka"
+	Backend string
+	URL     *url.URL
+	// TLS is whether the connection to a NATS server is upgraded to TLS
+	TLS bool
+}
+
+// rejectedEventError is the error of an event the bus has refused to accept.
+// Trying to publish it again would fail the same way.
+type rejectedEventError struct {
+	reason string
+}
+
+func (e rejectedEventError) Error() string {
+	return e.reason
+}
+
+// ParseEventBus parses the nats://[user:password@]host:port/subject,
+// tls://[user:password@]host:port/subject or kafka+http(s)://host/topics/topic
+// URL of the message bus. An empty URL disables publishing the events and
+// results in nil.
+func ParseEventBus(busURL string) (*EventBus, error) {
+	if busURL == "" {
+		return nil, nil
+	}
+	parsed, err := url.Parse(busURL)
+	if err != nil {
+		return nil, err
+	}
+	switch parsed.Scheme {
+	case "nats", "tls":
+		subject := strings.TrimPrefix(parsed.Path, "/")
+		if parsed.Host == "" || subject == "" || strings.ContainsAny(subject, " /") {
+			return nil, fmt.Errorf("expected a %s://host:port/subject URL, got \"%s\"", parsed.Scheme, busURL)
+		}
+		return &EventBus{Backend: "nats", URL: parsed, TLS: parsed.Scheme == "tls"}, nil
+	case "kafka+http", "kafka+https":
+		if parsed.Host == "" || !strings.Contains(parsed.Path, "/topics/") {
+			return nil, fmt.Errorf("expected a Kafka REST proxy's topic URL, e.g. "+
+				"kafka+https://host/topics/topic, got \"%s\"", busURL)
+		}
+		return &EventBus{Backend: "kafka", URL: parsed}, nil
+	}
+	return nil, fmt.Errorf("the scheme must be nats, tls, kafka+http or kafka+https, got \"%s\"", parsed.Scheme)
+}
+
+// publishEvent queues the event to be published to EVENT_BUS_URL. The event
+// stays queued until the bus has accepted or rejected it. Failing to queue it,
+// e.g. because the queue is full, is only logged, because the event isn't
+// worth failing the action that triggered it for.
+func publishEvent(conf Config, event BusEvent, store Store) {
+	if conf.EventBus == nil {
+		return
+	}
+	if queued, err := store.BusEvents(); err != nil {
+		log.Printf("Failed to list the queued events: %v\n", err)
+		return
+	} else if len(queued) >= maxQueuedBusEvents {
+		droppedBusEvents.Add(1)
+		log.Printf("The event queue is full. Dropping the %s event of %s#%d.\n", event.Type, event.Repository,
+			event.PullRequest)
+		return
+	}
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		log.Printf("Failed to generate an ID for the %s event of %s#%d: %v\n", event.Type, event.Repository,
+			event.PullRequest, err)
+		return
+	}
+	event.ID = hex.EncodeToString(idBytes)
+	event.Time = time.Now()
+	if err := store.QueueBusEvent(event); err != nil {
+		log.Printf("Failed to queue the %s event of %s#%d: %v\n", event.Type, event.Repository, event.PullRequest,
+			err)
+		return
+	}
+	select {
+	case busEventQueued <- struct{}{}:
+	default:
+	}
+}
+
+func runEventPublisher(configSource ConfigSource, store Store, stop <-chan struct{}) {
+	if configSource.Current().EventBus == nil {
+		return
+	}
+	ticker := time.NewTicker(eventBusRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case <-busEventQueued:
+		}
+		if err := PublishBusEvents(configSource.Current(), store); err != nil {
+			failedBusEventPublishes.Add(1)
+			log.Printf("Publishing the events failed: %v\n", err)
+		}
+	}
+}
+
+// PublishBusEvents publishes the queued events in the order they happened
+// and removes the ones the bus has accepted. The events the bus rejects are
+// moved to the dead letters, so that they wouldn't hold back the rest.
+// Publishing stops at the first other failure, e.g. when the bus can't be
+// reached, so that the events wouldn't be reordered, and the remaining events
+// are tried again later.
+func PublishBusEvents(conf Config, store Store) error {
+	events, err := store.BusEvents()
+	if err != nil {
+		return fmt.Errorf("failed to list the queued events: %v", err)
+	}
+	for _, event := range events {
+		err = publishToEventBus(conf.EventBus, event)
+		if rejection, isRejected := err.(rejectedEventError); isRejected {
+			deadLetteredBusEvents.Add(1)
+			log.Printf("The bus rejected the %s event %s: %v. Moving it to the dead letters.\n", event.Type,
+				event.ID, rejection)
+			if err = store.DeadLetterBusEvent(event.ID); err != nil {
+				return fmt.Errorf("failed to dead-letter the rejected event %s: %v", event.ID, err)
+			}
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to publish the %s event %s: %v", event.Type, event.ID, err)
+		}
+		if err = store.RemoveBusEvent(event.ID); err != nil {
+			return fmt.Errorf("failed to remove the published event %s: %v", event.ID, err)
+		}
+	}
+	return nil
+}
+
+func publishToEventBus(bus *EventBus, event BusEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if bus.Backend == "nats" {
+		return publishToNATS(bus.URL, bus.TLS, payload)
+	}
+	return publishToKafka(bus.URL, fmt.Sprintf("%s#%d", event.Repository, event.PullRequest), payload)
+}
+
+// publishToNATS publishes the payload with NATS' text protocol and waits for
+// the server to answer a PING sent after it, which confirms that the server
+// has processed the message. With useTLS, the connection is upgraded to TLS
+// after the server's INFO, like NATS clients do. The events are only
+// retained, if a JetStream stream captures the subject.
+func publishToNATS(busURL *url.URL, useTLS bool, payload []byte) error {
+	rawConn, err := net.DialTimeout("tcp", busURL.Host, eventBusTimeout)
+	if err != nil {
+		return err
+	}
+	defer rawConn.Close()
+	rawConn.SetDeadline(time.Now().Add(eventBusTimeout))
+	reader := bufio.NewReader(rawConn)
+	// The server greets with its INFO
+	if _, err = reader.ReadString('\n'); err != nil {
+		return err
+	}
+	conn := rawConn
+	if useTLS {
+		tlsConn := tls.Client(rawConn, &tls.Config{ServerName: busURL.Hostname()})
+		if err = tlsConn.Handshake(); err != nil {
+			return fmt.Errorf("TLS handshake with the NATS server failed: %v", err)
+		}
+		conn = tlsConn
+		reader = bufio.NewReader(conn)
+	}
+	options := map[string]interface{}{"verbose": false, "pedantic": false, "name": "github-review-helper"}
+	if busURL.User != nil {
+		options["user"] = busURL.User.Username()
+		options["pass"], _ = busURL.User.Password()
+	}
+	connectOptions, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+	subject := strings.TrimPrefix(busURL.Path, "/")
+	message := fmt.Sprintf("CONNECT %s\r\nPUB %s %d\r\n%s\r\nPING\r\n", connectOptions, subject, len(payload), payload)
+	if _, err = conn.Write([]byte(message)); err != nil {
+		return err
+	}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err = conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR") && strings.Contains(line, "Maximum Payload"):
+			return rejectedEventError{fmt.Sprintf("the NATS server responded with %s", line)}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("the NATS server responded with %s", line)
+		}
+	}
+}
+
+// publishToKafka produces the payload to the topic through the Kafka REST
+// proxy, keyed by the PR, so that the events of a PR would stay in order.
+// The proxy responds once Kafka has acknowledged the record.
+func publishToKafka(busURL *url.URL, key string, payload []byte) error {
+	proxyURL := *busURL
+	proxyURL.Scheme = strings.TrimPrefix(proxyURL.Scheme, "kafka+")
+	body, err := json.Marshal(map[string]interface{}{
+		"records": []map[string]interface{}{{"key": key, "value": json.RawMessage(payload)}},
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := eventBusHTTPClient.Post(proxyURL.String(), "application/vnd.kafka.json.v2+json",
+		bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if isRejectionStatus(resp.StatusCode) {
+		return rejectedEventError{fmt.Sprintf("the Kafka REST proxy responded with %s", resp.Status)}
+	} else if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("the Kafka REST proxy responded with %s", resp.Status)
+	}
+	// The proxy reports the records it failed to produce with a 200
+	var result struct {
+		Offsets []struct {
+			ErrorCode *int   `json:"error_code"`
+			Error     string `json:"error"`
+		} `json:"offsets"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to parse the Kafka REST proxy's response: %v", err)
+	}
+	for _, offset := range result.Offsets {
+		// Error code 2 is a retriable Kafka exception, e.g. a leader election
+		if offset.ErrorCode != nil && *offset.ErrorCode == 2 {
+			return fmt.Errorf("the Kafka REST proxy failed to produce the event: %s", offset.Error)
+		} else if offset.ErrorCode != nil {
+			return rejectedEventError{fmt.Sprintf("the Kafka REST proxy failed to produce the event: %s",
+				offset.Error)}
+		}
+	}
+	return nil
+}
+
+// isRejectionStatus reports whether the Kafka REST proxy's response status
+// means that the event itself was refused, e.g. because it's too large, as
+// opposed to the proxy being unavailable or misconfigured for every event.
+func isRejectionStatus(status int) bool {
+	switch status {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// eventStreamBuffer is how many events a subscriber can fall behind by
+// before the events are dropped for it
+const eventStreamBuffer = 64
+
+// eventStreamKeepAlive is how often an idle stream sends a comment, so that
+// proxies wouldn't close the connection
+const eventStreamKeepAlive = 30 * time.Second
+
+// droppedStreamEvents counts the events dropped for subscribers that didn't
+// keep up. Reported by /debug/vars.
+var droppedStreamEvents = expvar.NewInt("dropped_stream_events")
+
+// EventStream broadcasts the bot's activity, as recorded in the audit log,
+// to the subscribers of the /events endpoint.
+type EventStream struct {
+	sync.Mutex
+	subscribers map[chan AuditEntry]bool
+}
+
+func NewEventStream() *EventStream {
+	return &EventStream{subscribers: make(map[chan AuditEntry]bool)}
+}
+
+func (s *EventStream) subscribe() chan AuditEntry {
+	s.Lock()
+	defer s.Unlock()
+
+	events := make(chan AuditEntry, eventStreamBuffer)
+	s.subscribers[events] = true
+	return events
+}
+
+func (s *EventStream) unsubscribe(events chan AuditEntry) {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.subscribers, events)
+}
+
+// broadcast sends the entry to every subscriber without waiting for them, so
+// that a slow subscriber couldn't hold up the bot
+func (s *EventStream) broadcast(entry AuditEntry) {
+	s.Lock()
+	defer s.Unlock()
+
+	for events := range s.subscribers {
+		select {
+		case events <- entry:
+		default:
+			droppedStreamEvents.Add(1)
+		}
+	}
+}
+
+// StreamAuditLog wraps the audit log, so that the recorded entries would
+// also be broadcast to the event stream.
+func StreamAuditLog(auditLog AuditLog, stream *EventStream) AuditLog {
+	return streamedAuditLog{auditLog, stream}
+}
+
+type streamedAuditLog struct {
+	AuditLog
+	stream *EventStream
+}
+
+func (l streamedAuditLog) Record(entry AuditEntry) error {
+	err := l.AuditLog.Record(entry)
+	l.stream.broadcast(entry)
+	return err
+}
+
+// CreateEventStreamHandler creates a handler for GET /events, which streams
+// the received commands, the merges and the failed actions as Server-Sent
+// Events. The events are named after the action ("command" or "merge") or
+// "failure" and their data is the audit log entry as JSON. With all=true,
+// every action the bot takes is streamed. The events can be limited to a
+// repository (owner/name) with the repository query parameter. The requests
+// have to authenticate with the token as a bearer token.
+func CreateEventStreamHandler(token string, stream *EventStream) http.Handler {
+	return requireBearerToken(token, "admin", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Only GET is supported", http.StatusMethodNotAllowed)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+		repository := r.URL.Query().Get("repository")
+		all := r.URL.Query().Get("all") == "true"
+
+		events := stream.subscribe()
+		defer stream.unsubscribe(events)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(eventStreamKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+			case entry := <-events:
+				if repository != "" && entry.Repository != repository {
+					continue
+				}
+				eventType := streamEventType(entry, all)
+				if eventType == "" {
+					continue
+				}
+				data, err := json.Marshal(entry)
+				if err != nil {
+					continue
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, data)
+			}
+			flusher.Flush()
+		}
+	}))
+}
+
+// streamEventType names the event of the entry or returns an empty string,
+// if the entry isn't streamed
+func streamEventType(entry AuditEntry, all bool) string {
+	switch {
+	case entry.Outcome == auditOutcomeFailure:
+		return "failure"
+	case all, entry.Action == "command", entry.Action == "merge":
+		return entry.Action
+	}
+	return ""
+}
@@ -0,0 +1,110 @@
+package main_test
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	grh "github.com/salemove/github-review-helper"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Event stream handler", func() {
+	var (
+		stream   *grh.EventStream
+		auditLog grh.AuditLog
+		server   *httptest.Server
+	)
+
+	BeforeEach(func() {
+		stream = grh.NewEventStream()
+		memoryLog, err := grh.NewAuditLog(grh.Config{})
+		Expect(err).NotTo(HaveOccurred())
+		auditLog = grh.StreamAuditLog(memoryLog, stream)
+		server = httptest.NewServer(grh.CreateEventStreamHandler("admin-token", stream))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	get := func(path, token string) *http.Response {
+		request, err := http.NewRequest("GET", server.URL+path, nil)
+		Expect(err).NotTo(HaveOccurred())
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		response, err := http.DefaultClient.Do(request)
+		Expect(err).NotTo(HaveOccurred())
+		return response
+	}
+
+	// readEvents reads the events from the stream in the background and sends
+	// them as "<name> <data>"
+	readEvents := func(response *http.Response) chan string {
+		events := make(chan string, 10)
+		go func() {
+			defer GinkgoRecover()
+			reader := bufio.NewReader(response.Body)
+			var name string
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				line = strings.TrimSpace(line)
+				switch {
+				case strings.HasPrefix(line, "event: "):
+					name = strings.TrimPrefix(line, "event: ")
+				case strings.HasPrefix(line, "data: "):
+					events <- name + " " + strings.TrimPrefix(line, "data: ")
+				}
+			}
+		}()
+		return events
+	}
+
+	record := func(entry grh.AuditEntry) {
+		entry.Time = time.Now()
+		Expect(auditLog.Record(entry)).To(Succeed())
+	}
+
+	It("refuses requests without the token", func() {
+		response := get("/events", "")
+		defer response.Body.Close()
+		Expect(response.StatusCode).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("streams the commands, merges and failures of the repository", func() {
+		response := get("/events?repository=salemove/api", "admin-token")
+		defer response.Body.Close()
+		Expect(response.StatusCode).To(Equal(http.StatusOK))
+		Expect(response.Header.Get("Content-Type")).To(Equal("text/event-stream"))
+		events := readEvents(response)
+
+		record(grh.AuditEntry{Action: "command", Repository: "salemove/api", Details: "!merge",
+			Outcome: "success"})
+		record(grh.AuditEntry{Action: "add-label", Repository: "salemove/api", Outcome: "success"})
+		record(grh.AuditEntry{Action: "merge", Repository: "salemove/other", Outcome: "success"})
+		record(grh.AuditEntry{Action: "push", Repository: "salemove/api", Outcome: "failure",
+			Error: "remote rejected the push"})
+
+		Eventually(events).Should(Receive(And(HavePrefix("command "), ContainSubstring(`"details":"!merge"`))))
+		Eventually(events).Should(Receive(And(HavePrefix("failure "), ContainSubstring("remote rejected"))))
+		Consistently(events, 100*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("streams every action with all=true", func() {
+		response := get("/events?all=true", "admin-token")
+		defer response.Body.Close()
+		events := readEvents(response)
+
+		record(grh.AuditEntry{Action: "add-label", Repository: "salemove/api", Outcome: "success"})
+
+		Eventually(events).Should(Receive(HavePrefix("add-label ")))
+	})
+})
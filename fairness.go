@@ -0,0 +1,163 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Scheduler limits how many asynchronous operations run concurrently and
+// decides which of the waiting operations runs next using weighted fair
+// queuing. Every repository gets a share of the slots proportional to its
+// weight, so a repository flooding the queue (e.g. with a storm of status
+// events) doesn't starve the merges of other repositories.
+type Scheduler struct {
+	sync.Mutex
+	concurrency int
+	weights     map[string]int
+	running     int
+	// virtualTime is the start tag of the last dispatched operation
+	virtualTime float64
+	queues      map[string]*repositoryQueue
+}
+
+type repositoryQueue struct {
+	waiting    []*waitingOperation
+	lastFinish float64
+	stats      QueueStats
+}
+
+type waitingOperation struct {
+	start, finish float64
+	queuedAt      time.Time
+	dispatch      chan struct{}
+}
+
+// QueueStats describes how the operations of a repository have been
+// scheduled. A growing OldestWaitingSince indicates that the repository is
+// being starved.
+type QueueStats struct {
+	Repository         string        `json:"repository"`
+	Weight             int           `json:"weight"`
+	Waiting            int           `json:"waiting"`
+	Running            int           `json:"running"`
+	Dispatched         int           `json:"dispatched"`
+	TotalWait          time.Duration `json:"total_wait"`
+	MaxWait            time.Duration `json:"max_wait"`
+	OldestWaitingSince time.Time     `json:"oldest_waiting_since"`
+}
+
+// NewScheduler creates a Scheduler running at most concurrency operations at
+// a time. 0 means no limit. Repositories missing from weights get a weight of
+// 1.
+func NewScheduler(concurrency int, weights map[string]int) *Scheduler {
+	return &Scheduler{
+		concurrency: concurrency,
+		weights:     weights,
+		queues:      make(map[string]*repositoryQueue),
+	}
+}
+
+// Run runs the operation on behalf of the repository once a slot is available
+// and it's the repository's turn.
+func (s *Scheduler) Run(repository Repository, operation func()) {
+	s.acquire(repositoryKey(repository))
+	defer s.release(repositoryKey(repository))
+	operation()
+}
+
+func (s *Scheduler) weight(key string) int {
+	if weight, ok := s.weights[key]; ok && weight > 0 {
+		return weight
+	}
+	return 1
+}
+
+func (s *Scheduler) queue(key string) *repositoryQueue {
+	queue, exists := s.queues[key]
+	if !exists {
+		queue = &repositoryQueue{stats: QueueStats{Repository: key, Weight: s.weight(key)}}
+		s.queues[key] = queue
+	}
+	return queue
+}
+
+func (s *Scheduler) acquire(key string) {
+	s.Lock()
+	queue := s.queue(key)
+	// An operation's finish tag is where it would finish, if every
+	// repository got exactly its weighted share of the slots
+	start := s.virtualTime
+	if queue.lastFinish > start {
+		start = queue.lastFinish
+	}
+	operation := &waitingOperation{
+		start:    start,
+		finish:   start + 1/float64(queue.stats.Weight),
+		queuedAt: time.Now(),
+		dispatch: make(chan struct{}),
+	}
+	queue.lastFinish = operation.finish
+	queue.waiting = append(queue.waiting, operation)
+	s.dispatch()
+	s.Unlock()
+
+	<-operation.dispatch
+}
+
+func (s *Scheduler) release(key string) {
+	s.Lock()
+	defer s.Unlock()
+	s.running--
+	s.queues[key].stats.Running--
+	s.dispatch()
+}
+
+// dispatch starts the waiting operations with the lowest finish tags until
+// all the slots are taken. Must be called while holding the lock.
+func (s *Scheduler) dispatch() {
+	for s.concurrency == 0 || s.running < s.concurrency {
+		var next *repositoryQueue
+		for _, queue := range s.queues {
+			if len(queue.waiting) > 0 && (next == nil || queue.waiting[0].finish < next.waiting[0].finish) {
+				next = queue
+			}
+		}
+		if next == nil {
+			return
+		}
+		operation := next.waiting[0]
+		next.waiting = next.waiting[1:]
+		s.virtualTime = operation.start
+		s.running++
+
+		wait := time.Since(operation.queuedAt)
+		next.stats.Running++
+		next.stats.Dispatched++
+		next.stats.TotalWait += wait
+		if wait > next.stats.MaxWait {
+			next.stats.MaxWait = wait
+		}
+		close(operation.dispatch)
+	}
+}
+
+// Stats returns the scheduling stats of every repository that has had
+// operations scheduled, sorted by repository.
+func (s *Scheduler) Stats() []QueueStats {
+	s.Lock()
+	defer s.Unlock()
+	stats := make([]QueueStats, 0, len(s.queues))
+	for _, queue := range s.queues {
+		queueStats := queue.stats
+		queueStats.Waiting = len(queue.waiting)
+		if len(queue.waiting) > 0 {
+			queueStats.OldestWaitingSince = queue.waiting[0].queuedAt
+		}
+		stats = append(stats, queueStats)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Repository < stats[j].Repository
+	})
+	return stats
+}
@@ -0,0 +1,122 @@
+package main_test
+
+import (
+	"sync"
+
+	grh "github.com/salemove/github-review-helper"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Scheduler", func() {
+	var (
+		monorepo = grh.Repository{Owner: "salemove", Name: "monorepo"}
+		api      = grh.Repository{Owner: "salemove", Name: "api"}
+
+		scheduler *grh.Scheduler
+		ranLock   sync.Mutex
+		ran       []string
+		wg        sync.WaitGroup
+		release   chan struct{}
+	)
+
+	waiting := func() int {
+		count := 0
+		for _, stats := range scheduler.Stats() {
+			count += stats.Waiting
+		}
+		return count
+	}
+
+	schedule := func(repository grh.Repository, name string) {
+		wg.Add(1)
+		before := waiting()
+		go func() {
+			defer wg.Done()
+			scheduler.Run(repository, func() {
+				ranLock.Lock()
+				defer ranLock.Unlock()
+				ran = append(ran, name)
+			})
+		}()
+		Eventually(waiting).Should(Equal(before + 1))
+	}
+
+	BeforeEach(func() {
+		ran = nil
+		release = make(chan struct{})
+	})
+
+	// Takes the only slot until release is closed, so that the scheduled
+	// operations would queue up
+	occupy := func() {
+		started := make(chan struct{})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			scheduler.Run(monorepo, func() {
+				close(started)
+				<-release
+			})
+		}()
+		<-started
+	}
+
+	Context("with equal weights", func() {
+		BeforeEach(func() {
+			scheduler = grh.NewScheduler(1, nil)
+		})
+
+		It("doesn't let a flooding repository starve others", func() {
+			occupy()
+			schedule(monorepo, "monorepo-1")
+			schedule(monorepo, "monorepo-2")
+			schedule(monorepo, "monorepo-3")
+			schedule(api, "api-1")
+			close(release)
+			wg.Wait()
+
+			Expect(ran).To(HaveLen(4))
+			Expect(ran[:2]).To(ContainElement("api-1"))
+		})
+	})
+
+	Context("with a weighted repository", func() {
+		BeforeEach(func() {
+			scheduler = grh.NewScheduler(1, map[string]int{"salemove/api": 3})
+		})
+
+		It("gives the repository a bigger share of the slots", func() {
+			occupy()
+			schedule(monorepo, "monorepo-1")
+			schedule(monorepo, "monorepo-2")
+			schedule(api, "api-1")
+			schedule(api, "api-2")
+			schedule(api, "api-3")
+			close(release)
+			wg.Wait()
+
+			Expect(ran).To(Equal([]string{"api-1", "api-2", "api-3", "monorepo-1", "monorepo-2"}))
+		})
+
+		It("reports the waits of each repository", func() {
+			occupy()
+			schedule(api, "api-1")
+
+			stats := scheduler.Stats()
+			Expect(stats).To(HaveLen(2))
+			Expect(stats[0].Repository).To(Equal("salemove/api"))
+			Expect(stats[0].Weight).To(Equal(3))
+			Expect(stats[0].Waiting).To(Equal(1))
+			Expect(stats[0].OldestWaitingSince.IsZero()).To(BeFalse())
+			Expect(stats[1].Running).To(Equal(1))
+
+			close(release)
+			wg.Wait()
+			stats = scheduler.Stats()
+			Expect(stats[0].Dispatched).To(Equal(1))
+			Expect(stats[0].Waiting).To(Equal(0))
+		})
+	})
+})
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/evaluator"
+	"github.com/salemove/github-review-helper/git"
+)
+
+// The name of the gate that keeps PRs that aren't rebased onto their base
+// branch from being merged with the fast-forward strategy
+const fastForwardGate = "fast-forward"
+
+// checkFastForward fails PRs that can't be merged by fast-forwarding their
+// base branch to their head, because the base branch has commits the PR
+// doesn't. The PR's author is asked to rebase the PR once per head of the
+// PR.
+func checkFastForward(ctx GateContext) (evaluator.Result, *ErrorResponse) {
+	if ctx.Config.MergeStrategy != MergeStrategyFastForward {
+		return passed("MERGE_STRATEGY isn't " + MergeStrategyFastForward), nil
+	}
+	issue := prIssue(ctx.PR)
+	comparison, errResp := compareWithBase(ctx.PR, ctx.Repositories)
+	if errResp != nil {
+		return evaluator.Result{}, errResp
+	}
+	status := comparison.GetStatus()
+	if status == "ahead" || status == "identical" {
+		return passed(), nil
+	}
+	base := ctx.PR.Base.GetRef()
+	isNew, err := ctx.Store.RecordRefusal(issue, ctx.PR.Head.GetSHA()+" isn't rebased")
+	if err != nil {
+		errorMessage := fmt.Sprintf("Failed to record that PR %s isn't rebased", issue.FullName())
+		return evaluator.Result{}, &ErrorResponse{err, http.StatusInternalServerError, errorMessage}
+	} else if isNew {
+		message := fmt.Sprintf("@%s, `%s` has %d commit(s) this PR doesn't. PRs in this repository are merged "+
+			"without merge commits, so please rebase this PR onto the latest `%s` before I can merge it.",
+			ctx.PR.User.GetLogin(), base, comparison.GetBehindBy(), base)
+		if err = comment(message, issue.Repository, issue.Number, ctx.Issues); err != nil {
+			errorMessage := fmt.Sprintf("Failed to ask for PR %s to be rebased", issue.FullName())
+			return evaluator.Result{}, &ErrorResponse{err, http.StatusBadGateway, errorMessage}
+		}
+	}
+	return failed(fmt.Sprintf("it isn't rebased onto the latest `%s`", base),
+		fmt.Sprintf("%d commit(s) behind `%s`", comparison.GetBehindBy(), base)), nil
+}
+
+// compareWithBase compares the PR's head to the current tip of its base
+// branch. The head is "ahead" or "identical", if the base branch can be
+// fast-forwarded to it.
+func compareWithBase(pr *github.PullRequest, repositories Repositories) (*github.CommitsComparison,
+	*ErrorResponse) {
+
+	repository := baseRepository(pr)
+	comparison, _, err := repositories.CompareCommits(context.TODO(), repository.Owner, repository.Name,
+		pr.Base.GetRef(), pr.Head.GetSHA())
+	if err != nil {
+		message := fmt.Sprintf("Failed to compare PR %s to its base branch", prFullName(pr))
+		return nil, &ErrorResponse{err, http.StatusBadGateway, message}
+	}
+	return comparison, nil
+}
+
+// fastForwardPR merges the PR by pushing its head to its base branch, so
+// that the base branch ends up with exactly the commits that were reviewed.
+// If the push is rejected, because the base branch has moved on since the
+// PR was checked, ErrBaseBranchModified is returned for the PR to be checked
+// again.
+func fastForwardPR(conf Config, pr *github.PullRequest, gitRepos git.Repos, store Store, issues Issues,
+	pullRequests PullRequests, repositories Repositories, graphQL GraphQL) *ErrorResponse {
+
+	issue := prIssue(pr)
+	gitRepo, err := gitRepos.GetUpdatedRepo(issue.Repository.URL, issue.Repository.Owner, issue.Repository.Name)
+	if git.IsDiskFull(err) {
+		return reportDiskFull(conf, pr, err, store, issues)
+	} else if err != nil {
+		message := fmt.Sprintf("Failed to get an updated repo for PR %s", issue.FullName())
+		return &ErrorResponse{err, gitErrorCode(err), message}
+	}
+	if _, err = fetchHeadRemote(pr, gitRepo); err != nil {
+		message := fmt.Sprintf("Failed to fetch the fork of PR %s", issue.FullName())
+		return &ErrorResponse{err, gitErrorCode(err), message}
+	}
+	if err = gitRepo.Push(pr.Head.GetSHA(), "origin", pr.Base.GetRef()); err != nil {
+		comparison, errResp := compareWithBase(pr, repositories)
+		if errResp == nil && comparison.GetStatus() != "ahead" && comparison.GetStatus() != "identical" {
+			message := fmt.Sprintf("The base branch of PR %s was modified while merging it", issue.FullName())
+			return &ErrorResponse{ErrBaseBranchModified, http.StatusBadGateway, message}
+		}
+		sendNotification(conf, NotificationEvent{
+			Type:    FailureEvent,
+			Issue:   issue,
+			Message: fmt.Sprintf("Merging failed: %v", err),
+		})
+		message := fmt.Sprintf("Failed to fast-forward %s to PR %s", pr.Base.GetRef(), issue.FullName())
+		return &ErrorResponse{err, gitErrorCode(err), message}
+	}
+	if isAcrossForks(pr) {
+		log.Printf("PR %s is across forks. Not removing the head branch.\n", issue.FullName())
+	} else {
+		restackStackedPRs(conf, issue.Repository, PullRequestBranch{SHA: pr.Head.GetSHA(), Ref: pr.Head.GetRef()},
+			pr.Base.GetRef(), gitRepos, issues, graphQL)
+		if errResp := deleteRemoteBranch(pr, gitRepos); errResp != nil {
+			return errResp
+		}
+	}
+	validation := Validation{SHA: pr.Head.GetSHA(), BaseRef: pr.Base.GetRef()}
+	response := completeValidatedMerge(conf, pr, validation, gitRepos, store, issues, pullRequests, repositories)
+	if errResp, isError := asErrorResponse(response); isError {
+		return &errResp
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("the fast-forward merge strategy", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+			gitRepos         *mocks.Repos
+			gitRepo          *mocks.Repo
+
+			headSHA = "1235"
+			pr      = &github.PullRequest{
+				Number:    github.Int(issueNumber),
+				Merged:    github.Bool(false),
+				Mergeable: github.Bool(true),
+				Base: &github.PullRequestBranch{
+					SHA:  github.String("1234"),
+					Ref:  github.String("master"),
+					Repo: repository,
+				},
+				Head: &github.PullRequestBranch{
+					SHA:  github.String(headSHA),
+					Ref:  github.String("feature"),
+					Repo: repository,
+				},
+				User: &github.User{Login: github.String(arbitraryIssueAuthor)},
+			}
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+			gitRepos = *context.GitRepos
+			gitRepo = new(mocks.Repo)
+
+			context.Config.MergeStrategy = grh.MergeStrategyFastForward
+
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+				Return(pr, emptyResponse, noError)
+			repositories.
+				On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+					mock.AnythingOfType("*github.ListOptions")).
+				Return(&github.CombinedStatus{State: github.String("success")}, emptyResponse, noError)
+		})
+		AfterEach(func() {
+			gitRepo.AssertExpectations(GinkgoT())
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+
+		mockComparison := func(status string, behindBy int) {
+			repositories.
+				On("CompareCommits", anyContext, repositoryOwner, repositoryName, "master", headSHA).
+				Return(&github.CommitsComparison{
+					Status:   github.String(status),
+					BehindBy: github.Int(behindBy),
+				}, emptyResponse, noError)
+		}
+
+		Context("with a PR rebased onto the base branch", func() {
+			requestJSON.Is(func() string {
+				return IssueCommentEvent("!merge", arbitraryIssueAuthor)
+			})
+
+			BeforeEach(func() {
+				mockComparison("ahead", 0)
+				issues.
+					On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+						[]string{grh.MergingLabel}).
+					Return(emptyResult, emptyResponse, noError)
+				mockLabels(issues, issueNumber, grh.MergingLabel)
+				gitRepos.
+					On("GetUpdatedRepo", sshURL, repositoryOwner, repositoryName).
+					Return(gitRepo, noError)
+				gitRepo.
+					On("Push", headSHA, "origin", "master").
+					Return(noError).
+					Once()
+				gitRepo.
+					On("DeleteRemoteBranch", "feature").
+					Return(noError)
+				issues.
+					On("RemoveLabelForIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+						grh.MergingLabel).
+					Return(emptyResponse, noError)
+			})
+
+			It("pushes the PR's head to the base branch", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(responseRecorder.Body.String()).To(ContainSubstring("Successfully merged"))
+				pullRequests.AssertNotCalled(GinkgoT(), "Merge", anyContext, repositoryOwner, repositoryName,
+					issueNumber, mock.Anything, mock.Anything)
+			})
+		})
+
+		Context("with a PR behind the base branch", func() {
+			requestJSON.Is(func() string {
+				return IssueCommentEvent("!status", arbitraryIssueAuthor)
+			})
+
+			BeforeEach(func() {
+				context.Config.MergeGates = []string{"fast-forward"}
+				mockComparison("diverged", 2)
+				mockLabels(issues, issueNumber)
+			})
+
+			It("asks for the PR to be rebased and blocks it", func() {
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("@"+arbitraryIssueAuthor+", `master` has 2 commit(s) this "+
+							"PR doesn't"))).
+					Return(emptyResult, emptyResponse, noError).
+					Once()
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining(":x: **fast-forward**: it isn't rebased onto the latest "+
+							"`master`"))).
+					Return(emptyResult, emptyResponse, noError).
+					Once()
+
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+			})
+		})
+	})
+})
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/salemove/github-review-helper/evaluator"
+)
+
+// The name of the gate that keeps PRs adding large or disallowed files from
+// being merged
+const fileGuardGate = "files"
+
+const fileGuardCheckRunName = "review-helper/files"
+
+// How many blobs' sizes are asked for in a single GraphQL query
+const fileSizesBatchSize = 50
+
+type blobSize struct {
+	ByteSize int `json:"byteSize"`
+}
+
+// flaggedFile is a file the PR adds or changes that's either larger than
+// MAX_FILE_SIZE or matches DISALLOWED_FILE_PATTERNS.
+type flaggedFile struct {
+	Filename string
+	Problem  string
+}
+
+// isFileGuardEnabled reports whether MAX_FILE_SIZE or
+// DISALLOWED_FILE_PATTERNS is set, which enables the gate and the check run.
+func isFileGuardEnabled(conf Config) bool {
+	return conf.MaxFileSize > 0 || len(conf.DisallowedFilePatterns) > 0
+}
+
+// findFlaggedFiles returns the files the PR adds or changes at headSHA that
+// are too large or of a disallowed type. Removed files aren't flagged.
+func findFlaggedFiles(conf Config, issue Issue, headSHA string, pullRequests PullRequests,
+	graphQL GraphQL) ([]flaggedFile, *ErrorResponse) {
+
+	files, errResp := getPRFiles(issue, pullRequests)
+	if errResp != nil {
+		return nil, errResp
+	}
+	var flagged []flaggedFile
+	var sized []string
+	for _, file := range files {
+		if file.GetStatus() == "removed" {
+			continue
+		}
+		filename := file.GetFilename()
+		if pattern := disallowedFilePattern(conf, filename); pattern != "" {
+			flagged = append(flagged, flaggedFile{filename, fmt.Sprintf("matches the disallowed pattern %s",
+				pattern)})
+			continue
+		}
+		if conf.MaxFileSize > 0 {
+			sized = append(sized, filename)
+		}
+	}
+	sizes, err := fileSizes(issue.Repository, headSHA, sized, graphQL)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Failed to get the sizes of the files of PR %s", issue.FullName())
+		return nil, &ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	for _, filename := range sized {
+		if size := sizes[filename]; size > conf.MaxFileSize {
+			flagged = append(flagged, flaggedFile{filename, fmt.Sprintf("is %s, more than the limit of %s",
+				formatByteSize(size), formatByteSize(conf.MaxFileSize))})
+		}
+	}
+	return flagged, nil
+}
+
+func disallowedFilePattern(conf Config, filename string) string {
+	for _, pattern := range conf.DisallowedFilePatterns {
+		if matchesPathPattern(pattern, filename) {
+			return pattern
+		}
+	}
+	return ""
+}
+
+// fileSizes asks GitHub for the sizes of the files at the revision, in
+// batches, because the REST API doesn't include them in the PR's files.
+// Files that aren't blobs at the revision, e.g. submodules, are left out.
+func fileSizes(repository Repository, revision string, filenames []string,
+	graphQL GraphQL) (map[string]int, error) {
+
+	sizes := make(map[string]int)
+	for start := 0; start < len(filenames); start += fileSizesBatchSize {
+		end := start + fileSizesBatchSize
+		if end > len(filenames) {
+			end = len(filenames)
+		}
+		batch := filenames[start:end]
+		variables := map[string]interface{}{
+			"owner": repository.Owner,
+			"name":  repository.Name,
+		}
+		var parameters, fields []string
+		for i, filename := range batch {
+			variable := "e" + strconv.Itoa(i)
+			variables[variable] = revision + ":" + filename
+			parameters = append(parameters, fmt.Sprintf("$%s: String!", variable))
+			fields = append(fields, fmt.Sprintf("f%d: object(expression: $%s) { ... on Blob { byteSize } }", i,
+				variable))
+		}
+		query := fmt.Sprintf("query($owner: String!, $name: String!, %s) {\n  repository(owner: $owner, "+
+			"name: $name) {\n    %s\n  }\n}", strings.Join(parameters, ", "), strings.Join(fields, "\n    "))
+		var result struct {
+			Repository map[string]*blobSize `json:"repository"`
+		}
+		if err := graphQL.Query(context.TODO(), query, variables, &result); err != nil {
+			return nil, err
+		}
+		for i, filename := range batch {
+			if blob := result.Repository["f"+strconv.Itoa(i)]; blob != nil {
+				sizes[filename] = blob.ByteSize
+			}
+		}
+	}
+	return sizes, nil
+}
+
+// formatByteSize formats the size in the largest unit it's at least one of,
+// e.g. "1.5 MB".
+func formatByteSize(size int) string {
+	units := []string{"B", "KB", "MB", "GB"}
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d B", size)
+	}
+	return strconv.FormatFloat(value, 'f', 1, 64) + " " + units[unit]
+}
+
+// publishFileGuardCheckRun lists the large and disallowed files the PR adds
+// in a check run on the PR's head. A PR that's labeled with one of the
+// SKIP_LABELS for the files check gets a successful check run.
+func publishFileGuardCheckRun(conf Config, pullRequestEvent PullRequestEvent, pullRequests PullRequests,
+	graphQL GraphQL) *ErrorResponse {
+
+	if !isFileGuardEnabled(conf) {
+		return nil
+	}
+	issue := pullRequestEvent.Issue()
+	flagged, errResp := findFlaggedFiles(conf, issue, pullRequestEvent.Head.SHA, pullRequests, graphQL)
+	if errResp != nil {
+		return errResp
+	}
+	state := map[string]interface{}{
+		"status":     "COMPLETED",
+		"conclusion": "SUCCESS",
+		"title":      "No large or disallowed files",
+		"summary":    "None of the files the PR adds or changes are too large or of a disallowed type.",
+	}
+	text := ""
+	if len(flagged) > 0 {
+		state["conclusion"] = "FAILURE"
+		state["title"] = fmt.Sprintf("%d large or disallowed file(s)", len(flagged))
+		state["summary"] = "Remove the files listed below from the PR or ask a maintainer to allow them with a " +
+			"label."
+		if label := skipLabel(conf, pullRequestEvent.HasLabel, filesCheck); label != "" {
+			state["conclusion"] = "SUCCESS"
+			state["summary"] = fmt.Sprintf("The files listed below are allowed, because the PR is labeled '%s'.",
+				label)
+		}
+		for _, file := range flagged {
+			text += fmt.Sprintf("- `%s` %s\n", file.Filename, file.Problem)
+		}
+	}
+	err := createCheckRun(pullRequestEvent.Base.Repository, pullRequestEvent.Head.SHA, fileGuardCheckRunName,
+		state, text, graphQL)
+	if err != nil {
+		message := fmt.Sprintf("Failed to report the large and disallowed files of PR %s", issue.FullName())
+		return &ErrorResponse{err, http.StatusBadGateway, message}
+	}
+	return nil
+}
+
+// checkFileGuard fails PRs that add or change large or disallowed files. One
+// of the SKIP_LABELS for the files check lets them through.
+func checkFileGuard(ctx GateContext) (evaluator.Result, *ErrorResponse) {
+	if !isFileGuardEnabled(ctx.Config) {
+		return passed("neither MAX_FILE_SIZE nor DISALLOWED_FILE_PATTERNS is set"), nil
+	}
+	flagged, errResp := findFlaggedFiles(ctx.Config, prIssue(ctx.PR), ctx.PR.Head.GetSHA(), ctx.PullRequests,
+		ctx.GraphQL)
+	if errResp != nil {
+		return evaluator.Result{}, errResp
+	} else if len(flagged) == 0 {
+		return passed(), nil
+	}
+	var filenames, evidence []string
+	for _, file := range flagged {
+		filenames = append(filenames, file.Filename)
+		evidence = append(evidence, file.Filename+" "+file.Problem)
+	}
+	return failed(fmt.Sprintf("it adds large or disallowed files (%s)", strings.Join(filenames, ", ")),
+		evidence...), nil
+}
@@ -0,0 +1,189 @@
+package main_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("large and disallowed files", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+			graphQL          *mocks.GraphQL
+
+			headSHA        = "1235"
+			baseRepository = grh.Repository{Owner: repositoryOwner, Name: repositoryName, URL: sshURL}
+			anyListOptions = mock.AnythingOfType("*github.ListOptions")
+			checkRun       map[string]interface{}
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+			graphQL = *context.GraphQL
+			checkRun = nil
+
+			context.Config.MaxFileSize = 1024
+			context.Config.DisallowedFilePatterns = []string{"*.exe"}
+			context.Config.SkipLabels = map[string][]string{"large-files": {"files"}}
+
+			pullRequests.
+				On("ListCommits", anyContext, repositoryOwner, repositoryName, issueNumber,
+					mock.AnythingOfType("*github.ListOptions")).
+				Return(githubCommits(commit{headSHA, "Add the tools"}), emptyResponse, noError)
+			repositories.
+				On("CreateStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+					mock.MatchedBy(func(status *github.RepoStatus) bool {
+						return status.GetContext() == "review/squash"
+					})).
+				Return(emptyResult, emptyResponse, noError)
+			pullRequests.
+				On("ListFiles", anyContext, repositoryOwner, repositoryName, issueNumber, anyListOptions).
+				Return([]*github.CommitFile{
+					{Filename: github.String("assets/video.mp4"), Status: github.String("added")},
+					{Filename: github.String("bin/tool.exe"), Status: github.String("added")},
+					{Filename: github.String("old/archive.zip"), Status: github.String("removed")},
+					{Filename: github.String("README.md"), Status: github.String("modified")},
+				}, emptyResponse, noError)
+
+			respond := func(query string, response interface{}) {
+				data, err := json.Marshal(response)
+				Expect(err).NotTo(HaveOccurred())
+				graphQL.
+					On("Query", anyContext, mock.MatchedBy(func(q string) bool {
+						return strings.Contains(q, query)
+					}), mock.Anything, mock.Anything).
+					Return(noError).
+					Run(func(args mock.Arguments) {
+						Expect(json.Unmarshal(data, args.Get(3))).To(Succeed())
+					})
+			}
+			respond("byteSize", map[string]interface{}{
+				"repository": map[string]interface{}{
+					"f0": map[string]int{"byteSize": 3 * 1024 * 1024},
+					"f1": map[string]int{"byteSize": 512},
+				},
+			})
+			respond("id\n", map[string]interface{}{
+				"repository": map[string]string{"id": "R_1"},
+			})
+			graphQL.
+				On("Query", anyContext, mock.MatchedBy(func(q string) bool {
+					return strings.Contains(q, "createCheckRun")
+				}), mock.Anything, mock.Anything).
+				Return(noError).
+				Run(func(args mock.Arguments) {
+					checkRun = args.Get(2).(map[string]interface{})
+				})
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "pull_request",
+			}
+		})
+
+		Context("with a PR adding them", func() {
+			requestJSON.Is(func() string {
+				return PullRequestEvent("opened", headSHA, baseRepository)
+			})
+
+			It("lists them in a failed check run", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(checkRun).NotTo(BeNil())
+				Expect(checkRun["name"]).To(Equal("review-helper/files"))
+				Expect(checkRun["conclusion"]).To(Equal("FAILURE"))
+				Expect(checkRun["text"]).To(Equal("- `bin/tool.exe` matches the disallowed pattern *.exe\n" +
+					"- `assets/video.mp4` is 3.0 MB, more than the limit of 1.0 KB\n"))
+			})
+		})
+
+		Context("with the PR labeled with a skip label", func() {
+			requestJSON.Is(func() string {
+				event := LabeledPullRequestEvent("labeled", headSHA, baseRepository, "large-files")
+				return strings.Replace(event, `"action": "labeled",`, `"action": "labeled",
+  "label": {"name": "large-files"},
+  "sender": {"login": "procoder"},`, 1)
+			})
+
+			mockRole := func(permission string) {
+				data, err := json.Marshal(map[string]interface{}{
+					"repository": map[string]interface{}{
+						"collaborators": map[string]interface{}{
+							"edges": []interface{}{
+								map[string]interface{}{
+									"permission": permission,
+									"node":       map[string]string{"login": "procoder"},
+								},
+							},
+						},
+					},
+				})
+				Expect(err).NotTo(HaveOccurred())
+				graphQL.
+					On("Query", anyContext, mock.MatchedBy(func(q string) bool {
+						return strings.Contains(q, "collaborators")
+					}), mock.Anything, mock.Anything).
+					Return(noError).
+					Run(func(args mock.Arguments) {
+						Expect(json.Unmarshal(data, args.Get(3))).To(Succeed())
+					})
+			}
+
+			Context("by a maintainer", func() {
+				BeforeEach(func() {
+					mockRole("MAINTAIN")
+				})
+
+				It("allows the files in the check run", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					Expect(checkRun).NotTo(BeNil())
+					Expect(checkRun["conclusion"]).To(Equal("SUCCESS"))
+					Expect(checkRun["summary"]).To(ContainSubstring("because the PR is labeled 'large-files'"))
+				})
+			})
+
+			Context("by a user with the write role", func() {
+				BeforeEach(func() {
+					mockRole("WRITE")
+					issues.
+						On("RemoveLabelForIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+							"large-files").
+						Return(emptyResponse, noError)
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("@procoder, only maintainers can add the 'large-files' "+
+								"label"))).
+						Return(emptyResult, emptyResponse, noError)
+				})
+
+				It("removes the label", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertExpectations(GinkgoT())
+					Expect(checkRun).To(BeNil())
+				})
+			})
+		})
+	})
+})
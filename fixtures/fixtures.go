@@ -0,0 +1,205 @@
+// Package fixtures records the bot's interactions with the GitHub API to a
+// fixture file and replays them, so that handlers could be integration-tested
+// against real API responses instead of hand-written mocks.
+package fixtures
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Interaction is a recorded request and the response GitHub gave to it.
+// Request headers aren't recorded, so that the fixtures wouldn't include the
+// access token.
+type Interaction struct {
+	Method       string      `json:"method"`
+	URL          string      `json:"url"`
+	RequestBody  string      `json:"request_body,omitempty"`
+	StatusCode   int         `json:"status_code"`
+	Header       http.Header `json:"header,omitempty"`
+	ResponseBody string      `json:"response_body"`
+}
+
+// Recorder is a transport that passes the requests on to Transport and
+// records the interactions. With a Path, the fixture file is rewritten after
+// every interaction, so that the recording would survive a crash.
+type Recorder struct {
+	Transport http.RoundTripper
+	Path      string
+
+	mutex        sync.Mutex
+	interactions []Interaction
+}
+
+// NewRecorder creates a recorder that saves the interactions to the file at
+// path.
+func NewRecorder(transport http.RoundTripper, path string) *Recorder {
+	return &Recorder{Transport: transport, Path: path}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestBody, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	responseBody, err := readBody(&resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	header := resp.Header.Clone()
+	header.Del("Set-Cookie")
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.interactions = append(r.interactions, Interaction{
+		Method:       req.Method,
+		URL:          req.URL.String(),
+		RequestBody:  string(requestBody),
+		StatusCode:   resp.StatusCode,
+		Header:       header,
+		ResponseBody: string(responseBody),
+	})
+	if r.Path != "" {
+		if err = save(r.Path, r.interactions); err != nil {
+			return nil, fmt.Errorf("failed to save the fixtures: %v", err)
+		}
+	}
+	return resp, nil
+}
+
+// Interactions returns the interactions recorded so far.
+func (r *Recorder) Interactions() []Interaction {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]Interaction(nil), r.interactions...)
+}
+
+// Replayer is a transport that responds to the requests with the recorded
+// interactions instead of calling GitHub. Every interaction is replayed once,
+// in the order they were recorded, so that a resource that changed between
+// two requests, e.g. a PR that got merged, would be replayed as it changed.
+type Replayer struct {
+	mutex        sync.Mutex
+	interactions []Interaction
+	replayed     []bool
+}
+
+// NewReplayer creates a replayer of the interactions.
+func NewReplayer(interactions []Interaction) *Replayer {
+	return &Replayer{interactions: interactions, replayed: make([]bool, len(interactions))}
+}
+
+// Load creates a replayer of the interactions in the fixture file at path.
+func Load(path string) (*Replayer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var interactions []Interaction
+	if err = json.Unmarshal(data, &interactions); err != nil {
+		return nil, fmt.Errorf("failed to parse the fixtures in %s: %v", path, err)
+	}
+	return NewReplayer(interactions), nil
+}
+
+// RoundTrip responds with the first interaction that hasn't been replayed yet
+// and has the request's method, URL and body. JSON bodies are compared by
+// their values, so that the order of their keys wouldn't matter. Requests
+// without such an interaction fail.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestBody, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for i, interaction := range r.interactions {
+		if r.replayed[i] || interaction.Method != req.Method || interaction.URL != req.URL.String() ||
+			!equalBodies(interaction.RequestBody, string(requestBody)) {
+			continue
+		}
+		r.replayed[i] = true
+		header := interaction.Header.Clone()
+		if header == nil {
+			header = make(http.Header)
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.StatusCode, http.StatusText(interaction.StatusCode)),
+			StatusCode:    interaction.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          ioutil.NopCloser(strings.NewReader(interaction.ResponseBody)),
+			ContentLength: int64(len(interaction.ResponseBody)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("no recorded interaction for %s %s", req.Method, req.URL)
+}
+
+// Unreplayed returns the interactions that haven't been replayed, e.g. for
+// checking that a handler made every request it was recorded making.
+func (r *Replayer) Unreplayed() []Interaction {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var unreplayed []Interaction
+	for i, interaction := range r.interactions {
+		if !r.replayed[i] {
+			unreplayed = append(unreplayed, interaction)
+		}
+	}
+	return unreplayed
+}
+
+// readBody reads the body and replaces it with a copy, so that it could be
+// read again
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+	data, err := ioutil.ReadAll(*body)
+	(*body).Close()
+	if err != nil {
+		return nil, err
+	}
+	*body = ioutil.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
+
+func equalBodies(recorded, actual string) bool {
+	if recorded == actual {
+		return true
+	}
+	var recordedValue, actualValue interface{}
+	if json.Unmarshal([]byte(recorded), &recordedValue) != nil || json.Unmarshal([]byte(actual), &actualValue) != nil {
+		return false
+	}
+	return reflect.DeepEqual(recordedValue, actualValue)
+}
+
+func save(path string, interactions []Interaction) error {
+	data, err := json.MarshalIndent(interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Writing to a temporary file first, so that a crash wouldn't leave a
+	// half-written fixture file behind
+	tmpPath := path + ".tmp"
+	if err = ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
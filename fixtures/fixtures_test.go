@@ -0,0 +1,112 @@
+package fixtures_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/salemove/github-review-helper/fixtures"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	merged := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			body, _ := ioutil.ReadAll(r.Body)
+			if string(body) != `{"merge_method":"squash","sha":"1235"}` {
+				t.Errorf("Expected the recorder to pass the body on, got %s", body)
+			}
+			merged = true
+			w.Write([]byte(`{"merged":true}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if merged {
+			w.Write([]byte(`{"number":7,"merged":true}`))
+		} else {
+			w.Write([]byte(`{"number":7,"merged":false}`))
+		}
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "merge.json")
+
+	recorder := fixtures.NewRecorder(http.DefaultTransport, path)
+	recording := &http.Client{Transport: recorder}
+	get(t, recording, server.URL+"/repos/salemove/api/pulls/7")
+	put(t, recording, server.URL+"/repos/salemove/api/pulls/7/merge", `{"merge_method":"squash","sha":"1235"}`)
+	get(t, recording, server.URL+"/repos/salemove/api/pulls/7")
+
+	replayer, err := fixtures.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replaying := &http.Client{Transport: replayer}
+	if body := get(t, replaying, server.URL+"/repos/salemove/api/pulls/7"); body != `{"number":7,"merged":false}` {
+		t.Errorf("Expected the PR to be replayed as unmerged first, got %s", body)
+	}
+	// The keys are in a different order than recorded
+	put(t, replaying, server.URL+"/repos/salemove/api/pulls/7/merge", `{"sha":"1235","merge_method":"squash"}`)
+	if len(replayer.Unreplayed()) != 1 {
+		t.Errorf("Expected 1 interaction to be left, got %d", len(replayer.Unreplayed()))
+	}
+	if body := get(t, replaying, server.URL+"/repos/salemove/api/pulls/7"); body != `{"number":7,"merged":true}` {
+		t.Errorf("Expected the PR to be replayed as merged after the merge, got %s", body)
+	}
+	if _, err = replaying.Get(server.URL + "/repos/salemove/api/pulls/7"); err == nil ||
+		!strings.Contains(err.Error(), "no recorded interaction") {
+		t.Errorf("Expected a request without an interaction left to fail, got %v", err)
+	}
+}
+
+func TestReplayHeaders(t *testing.T) {
+	replayer := fixtures.NewReplayer([]fixtures.Interaction{{
+		Method:       http.MethodGet,
+		URL:          "https://api.github.com/repos/salemove/api/pulls?page=1",
+		StatusCode:   http.StatusOK,
+		Header:       http.Header{"Link": {`<https://api.github.com/repos/salemove/api/pulls?page=2>; rel="next"`}},
+		ResponseBody: `[]`,
+	}})
+	resp, err := (&http.Client{Transport: replayer}).Get("https://api.github.com/repos/salemove/api/pulls?page=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if !strings.Contains(resp.Header.Get("Link"), `rel="next"`) {
+		t.Errorf("Expected the Link header to be replayed, got %q", resp.Header.Get("Link"))
+	}
+}
+
+func get(t *testing.T, client *http.Client, url string) string {
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func put(t *testing.T, client *http.Client, url, body string) {
+	req, err := http.NewRequest(http.MethodPut, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
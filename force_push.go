@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/salemove/github-review-helper/git"
+)
+
+// detectForcePush reports whether the synchronize event replaced the PR's
+// previous head instead of adding commits on top of it. The previous head
+// having disappeared from the head repository also counts as a force-push.
+func detectForcePush(pullRequestEvent PullRequestEvent, repositories Repositories) (bool, *ErrorResponse) {
+	if pullRequestEvent.Action != "synchronize" || pullRequestEvent.Before == "" {
+		return false, nil
+	}
+	head := pullRequestEvent.Head
+	comparison, resp, err := repositories.CompareCommits(context.TODO(), head.Repository.Owner,
+		head.Repository.Name, pullRequestEvent.Before, head.SHA)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return true, nil
+	} else if err != nil {
+		message := fmt.Sprintf("Failed to compare the previous head of PR %s to the new one",
+			pullRequestEvent.Issue().FullName())
+		return false, &ErrorResponse{err, http.StatusBadGateway, message}
+	}
+	status := comparison.GetStatus()
+	return status != "ahead" && status != "identical", nil
+}
+
+// handleForcePush notes the force-push in the audit log and drops the state
+// kept about the PR's previous head. A PR that's still labeled for merging
+// is then checked against the new head right away.
+func handleForcePush(conf Config, pullRequestEvent PullRequestEvent, audit auditor, store Store, issues Issues,
+	pullRequests PullRequests, repositories Repositories, graphQL GraphQL, gitRepos git.Repos) *ErrorResponse {
+
+	issue := pullRequestEvent.Issue()
+	log.Printf("PR %s was force-pushed from %s to %s.\n", issue.FullName(), pullRequestEvent.Before,
+		pullRequestEvent.Head.SHA)
+	audit.record("force-push", issue.Repository, issue.Number,
+		fmt.Sprintf("%s..%s", pullRequestEvent.Before, pullRequestEvent.Head.SHA), nil)
+	if errResp := resetMergeState(issue, store); errResp != nil {
+		return errResp
+	} else if !pullRequestEvent.HasLabel(MergingLabel) || conf.CancelMergeOnPush {
+		return nil
+	}
+	pr, errResp := getPR(issue, pullRequests)
+	if errResp != nil {
+		return errResp
+	} else if pr.Head == nil || pr.Head.GetSHA() != pullRequestEvent.Head.SHA || pr.Mergeable == nil {
+		// Either the PR has been pushed to again or GitHub hasn't checked its
+		// mergeability yet. Either way, a later event will trigger the check.
+		return nil
+	}
+	response := mergeIfReady(conf, issue, false, store, issues, pullRequests, repositories, graphQL, gitRepos)
+	if errResp, failed := asErrorResponse(response); failed {
+		return &errResp
+	}
+	return nil
+}
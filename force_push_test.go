@@ -0,0 +1,154 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("pull_request synchronize event with the previous head", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			store            grh.Store
+			auditLog         grh.AuditLog
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+
+			beforeSHA          = "1234"
+			pullRequestHeadSHA = "1235"
+			headRepository     = grh.Repository{
+				Owner: repositoryOwner,
+				Name:  repositoryName,
+				URL:   sshURL,
+			}
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			store = *context.Store
+			auditLog = *context.AuditLog
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+
+			Expect(store.AddStatusOverride(grh.StatusOverride{
+				Repository:  headRepository,
+				PullRequest: issueNumber,
+				Context:     "ci",
+				User:        "procoder",
+				CreatedAt:   time.Now(),
+			})).To(Succeed())
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "pull_request",
+			}
+		})
+
+		requestJSON.Is(func() string {
+			return strings.Replace(PullRequestEvent("synchronize", pullRequestHeadSHA, headRepository),
+				`"action": "synchronize",`, `"action": "synchronize", "before": "`+beforeSHA+`",`, 1)
+		})
+
+		mockFixupCheck := func() {
+			pullRequests.
+				On("ListCommits", anyContext, repositoryOwner, repositoryName, issueNumber,
+					mock.AnythingOfType("*github.ListOptions")).
+				Return(githubCommits(commit{pullRequestHeadSHA, "Changing things"}), emptyResponse, noError)
+			repositories.
+				On("CreateStatus", anyContext, repositoryOwner, repositoryName, pullRequestHeadSHA,
+					mock.AnythingOfType("*github.RepoStatus")).
+				Return(emptyResult, emptyResponse, noError)
+		}
+
+		forcePushEntries := func() []grh.AuditEntry {
+			entries, err := auditLog.Entries(grh.AuditFilter{})
+			Expect(err).NotTo(HaveOccurred())
+			forcePushes := []grh.AuditEntry{}
+			for _, entry := range entries {
+				if entry.Action == "force-push" {
+					forcePushes = append(forcePushes, entry)
+				}
+			}
+			return forcePushes
+		}
+
+		Context("with the new head building on the previous one", func() {
+			BeforeEach(func() {
+				repositories.
+					On("CompareCommits", anyContext, repositoryOwner, repositoryName, beforeSHA, pullRequestHeadSHA).
+					Return(&github.CommitsComparison{Status: github.String("ahead")}, emptyResponse, noError)
+				mockFixupCheck()
+			})
+
+			It("keeps the state of the PR", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(store.StatusOverrides(headRepository)).To(HaveLen(1))
+				Expect(forcePushEntries()).To(BeEmpty())
+			})
+		})
+
+		Context("with the new head diverging from the previous one", func() {
+			BeforeEach(func() {
+				repositories.
+					On("CompareCommits", anyContext, repositoryOwner, repositoryName, beforeSHA, pullRequestHeadSHA).
+					Return(&github.CommitsComparison{Status: github.String("diverged")}, emptyResponse, noError)
+				mockFixupCheck()
+			})
+
+			It("drops the state of the PR and notes the force-push in the audit log", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(store.StatusOverrides(headRepository)).To(BeEmpty())
+				entries := forcePushEntries()
+				Expect(entries).To(HaveLen(1))
+				Expect(entries[0].PullRequest).To(Equal(issueNumber))
+				Expect(entries[0].Details).To(Equal(beforeSHA + ".." + pullRequestHeadSHA))
+			})
+		})
+
+		Context("with the previous head gone", func() {
+			BeforeEach(func() {
+				resp, err := createGithubErrorResponse(http.StatusNotFound)
+				repositories.
+					On("CompareCommits", anyContext, repositoryOwner, repositoryName, beforeSHA, pullRequestHeadSHA).
+					Return(nil, resp, err)
+				mockFixupCheck()
+			})
+
+			It("treats the push as a force-push", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(store.StatusOverrides(headRepository)).To(BeEmpty())
+				Expect(forcePushEntries()).To(HaveLen(1))
+			})
+		})
+
+		Context("with comparing the heads failing", func() {
+			BeforeEach(func() {
+				repositories.
+					On("CompareCommits", anyContext, repositoryOwner, repositoryName, beforeSHA, pullRequestHeadSHA).
+					Return(nil, emptyResponse, errArbitrary)
+			})
+
+			It("fails with a gateway error", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusBadGateway))
+			})
+		})
+	})
+})
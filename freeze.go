@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	minutesPerDay  = 24 * 60
+	minutesPerWeek = 7 * minutesPerDay
+	// How often to check if the PRs deferred by a freeze can be merged
+	deferredMergeCheckInterval = time.Minute
+)
+
+var (
+	weeklyTimeRegexp    = regexp.MustCompile(`^(Sun|Mon|Tue|Wed|Thu|Fri|Sat) (\d{2}):(\d{2})$`)
+	weeklyTimeEndRegexp = regexp.MustCompile(`\d{2}:\d{2}$`)
+	weekdays            = map[string]time.Weekday{
+		"Sun": time.Sunday,
+		"Mon": time.Monday,
+		"Tue": time.Tuesday,
+		"Wed": time.Wednesday,
+		"Thu": time.Thursday,
+		"Fri": time.Friday,
+		"Sat": time.Saturday,
+	}
+)
+
+// MergeFreeze is a weekly recurring period during which PRs are not merged.
+type MergeFreeze struct {
+	// Scope is either an "owner/name" of a repository, an owner whose every
+	// repository the freeze applies to or empty, if the freeze applies to
+	// all repositories.
+	Scope string
+	// Start and End are the minutes since the start of the week (Sunday
+	// 00:00). End can be smaller than Start for freezes spanning the end of
+	// the week.
+	Start int
+	End   int
+	// Location is the time zone of the freeze's times. When nil, the times
+	// are in MERGE_FREEZE_TIMEZONE.
+	Location *time.Location
+}
+
+// ParseMergeFreezes parses a semicolon separated list of freezes in the
+// "[scope=]Fri 16:00-Mon 08:00[ time zone]" format. The time zone is in the
+// LoadTimeZone format.
+func ParseMergeFreezes(freezesString string) ([]MergeFreeze, error) {
+	freezes := []MergeFreeze{}
+	for _, freezeString := range strings.Split(freezesString, ";") {
+		freezeString = strings.TrimSpace(freezeString)
+		if freezeString == "" {
+			continue
+		}
+		var freeze MergeFreeze
+		if i := strings.Index(freezeString, "="); i != -1 {
+			freeze.Scope = strings.TrimSpace(freezeString[:i])
+			freezeString = freezeString[i+1:]
+		}
+		// Time zones can include dashes, so the time zone is split off first
+		if fields := strings.Fields(freezeString); len(fields) > 0 &&
+			!weeklyTimeEndRegexp.MatchString(fields[len(fields)-1]) {
+			location, err := LoadTimeZone(fields[len(fields)-1])
+			if err != nil {
+				return nil, err
+			}
+			freeze.Location = location
+			freezeString = strings.Join(fields[:len(fields)-1], " ")
+		}
+		bounds := strings.Split(freezeString, "-")
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("expected a freeze in the \"Fri 16:00-Mon 08:00\" format, got \"%s\"",
+				freezeString)
+		}
+		var err error
+		if freeze.Start, err = parseWeeklyTime(bounds[0]); err != nil {
+			return nil, err
+		} else if freeze.End, err = parseWeeklyTime(bounds[1]); err != nil {
+			return nil, err
+		} else if freeze.Start == freeze.End {
+			return nil, fmt.Errorf("the freeze \"%s\" ends when it starts", freezeString)
+		}
+		freezes = append(freezes, freeze)
+	}
+	return freezes, nil
+}
+
+func parseWeeklyTime(weeklyTimeString string) (int, error) {
+	matches := weeklyTimeRegexp.FindStringSubmatch(strings.TrimSpace(weeklyTimeString))
+	if matches == nil {
+		return 0, fmt.Errorf("expected a time in the \"Mon 08:00\" format, got \"%s\"", weeklyTimeString)
+	}
+	hours, _ := strconv.Atoi(matches[2])
+	minutes, _ := strconv.Atoi(matches[3])
+	if hours > 23 || minutes > 59 {
+		return 0, fmt.Errorf("invalid time of day in \"%s\"", weeklyTimeString)
+	}
+	return int(weekdays[matches[1]])*minutesPerDay + hours*60 + minutes, nil
+}
+
+func minuteOfWeek(t time.Time) int {
+	return int(t.Weekday())*minutesPerDay + t.Hour()*60 + t.Minute()
+}
+
+// AppliesTo reports whether the freeze covers the repository.
+func (f MergeFreeze) AppliesTo(repository Repository) bool {
+	return f.Scope == "" || f.Scope == repository.Owner || f.Scope == repositoryKey(repository)
+}
+
+// Active reports whether t, in the freeze's time zone, is within the freeze.
+func (f MergeFreeze) Active(t time.Time) bool {
+	minute := minuteOfWeek(t)
+	if f.Start < f.End {
+		return f.Start <= minute && minute < f.End
+	}
+	return minute >= f.Start || minute < f.End
+}
+
+// EndsAfter returns the first time the freeze ends after t, in t's time zone.
+func (f MergeFreeze) EndsAfter(t time.Time) time.Time {
+	return nextWeeklyTime(t, f.End)
+}
+
+// StartsAfter returns the first time the freeze starts after t, in t's time
+// zone.
+func (f MergeFreeze) StartsAfter(t time.Time) time.Time {
+	return nextWeeklyTime(t, f.Start)
+}
+
+// nextWeeklyTime returns the first time after t that's the given minute of
+// the week on the wall clock of t's time zone. The time is computed from the
+// date rather than by adding minutes, so that the weeks with a daylight
+// saving time change wouldn't shift it by an hour.
+func nextWeeklyTime(t time.Time, minute int) time.Time {
+	year, month, day := t.Date()
+	day += (minute/minutesPerDay - int(t.Weekday()) + 7) % 7
+	hour, minuteOfHour := minute%minutesPerDay/60, minute%60
+	next := time.Date(year, month, day, hour, minuteOfHour, 0, 0, t.Location())
+	if !next.After(t) {
+		next = time.Date(year, month, day+7, hour, minuteOfHour, 0, 0, t.Location())
+	}
+	return next
+}
+
+// activeMergeFreezeEnd returns the time the repository's merge freeze ends at
+// in the repository's time zone or a zero time, if merges are currently
+// allowed. Freezes with their own time zones are evaluated in those and the
+// rest in the repository's time zone from REPOSITORY_TIMEZONES or in
+// MERGE_FREEZE_TIMEZONE. Overlapping
+// freezes are followed until all of them have ended, but for no longer than a
+// week, in case the freezes cover the whole week.
+func activeMergeFreezeEnd(conf Config, repository Repository, now time.Time) time.Time {
+	location := conf.mergeFreezeLocation(repository)
+	t := now.In(location)
+	var end time.Time
+	for extended := true; extended && t.Sub(now) < minutesPerWeek*time.Minute; {
+		extended = false
+		for _, freeze := range conf.MergeFreezes {
+			freezeTime := t
+			if freeze.Location != nil {
+				freezeTime = t.In(freeze.Location)
+			}
+			if freeze.AppliesTo(repository) && freeze.Active(freezeTime) {
+				t = freeze.EndsAfter(freezeTime).In(location)
+				end = t
+				extended = true
+			}
+		}
+	}
+	return end
+}
+
+// nextMergeFreezeEnd returns the time the repository's active merge freeze
+// or, if there's none, its next one ends at in the repository's time zone.
+// Returns a zero time, if no freeze applies to the repository.
+func nextMergeFreezeEnd(conf Config, repository Repository, now time.Time) time.Time {
+	if end := activeMergeFreezeEnd(conf, repository, now); !end.IsZero() {
+		return end
+	}
+	var start time.Time
+	for _, freeze := range conf.MergeFreezes {
+		if !freeze.AppliesTo(repository) {
+			continue
+		}
+		freezeTime := now.In(conf.mergeFreezeLocation(repository))
+		if freeze.Location != nil {
+			freezeTime = now.In(freeze.Location)
+		}
+		if freezeStart := freeze.StartsAfter(freezeTime); start.IsZero() || freezeStart.Before(start) {
+			start = freezeStart
+		}
+	}
+	if start.IsZero() {
+		return time.Time{}
+	}
+	return activeMergeFreezeEnd(conf, repository, start)
+}
+
+// checkMergeFreeze returns the reason why the repository's PRs can't be
+// merged right now. The reason is empty if there's no active merge freeze.
+// An ongoing GitHub incident freezes the merges of all repositories.
+func checkMergeFreeze(conf Config, repository Repository) string {
+	if incident := ActiveGithubIncident(); incident != nil {
+		return fmt.Sprintf("GitHub is having an incident (%s). Merging is deferred until it's resolved",
+			incident.Name)
+	}
+	end := activeMergeFreezeEnd(conf, repository, time.Now())
+	if end.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("merges are frozen until %s. Merging is deferred until then",
+		end.Format("Mon Jan 2 15:04 MST"))
+}
+
+// deferMerge records the PR, whose repository is frozen, as deferred, so that
+// it would be merged once the freeze ends.
+func deferMerge(issue Issue, store Store) *ErrorResponse {
+	if err := store.AddDeferredMerge(issue); err != nil {
+		message := fmt.Sprintf("Failed to defer merging PR %s", issue.FullName())
+		return &ErrorResponse{err, http.StatusInternalServerError, message}
+	}
+	return nil
+}
+
+// runDeferredMerges periodically merges the PRs whose merging was deferred by
+// a freeze or a GitHub incident that has since ended, until stop is closed.
+// The job runs even without freezes, because a reload can add them.
+func runDeferredMerges(configSource ConfigSource, store Store, merge func(Issue) Response, stop <-chan struct{}) {
+	ticker := time.NewTicker(deferredMergeCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := MergeDeferredPRs(configSource.Current(), store, merge); err != nil {
+				log.Printf("Merging deferred PRs failed: %v\n", err)
+			}
+		}
+	}
+}
+
+// MergeDeferredPRs tries to merge the deferred PRs whose repositories are no
+// longer frozen. The PRs are no longer tracked as deferred afterwards. If
+// they're still not ready to be merged, then they're merged like any other
+// PR labeled for merging.
+func MergeDeferredPRs(conf Config, store Store, merge func(Issue) Response) error {
+	deferredMerges, err := store.DeferredMerges()
+	if err != nil {
+		return fmt.Errorf("failed to list deferred merges: %v", err)
+	}
+	for _, issue := range deferredMerges {
+		if checkMergeFreeze(conf, issue.Repository) != "" {
+			continue
+		}
+		if err = store.RemoveDeferredMerge(issue); err != nil {
+			return fmt.Errorf("failed to stop tracking the deferred merge of PR %s: %v", issue.FullName(), err)
+		}
+		log.Printf("The merge freeze for PR %s has ended. Merging it if it's ready.\n", issue.FullName())
+		merge(issue).logResponse()
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// freezeAroundNow returns a freeze that's active for an hour before and after
+// the current time.
+var freezeAroundNow = func(scope string) grh.MergeFreeze {
+	now := time.Now().UTC()
+	freezeString := now.Add(-time.Hour).Format("Mon 15:04") + "-" + now.Add(time.Hour).Format("Mon 15:04")
+	if scope != "" {
+		freezeString = scope + "=" + freezeString
+	}
+	freezes, err := grh.ParseMergeFreezes(freezeString)
+	Expect(err).NotTo(HaveOccurred())
+	return freezes[0]
+}
+
+var _ = Describe("ParseMergeFreezes", func() {
+	It("parses scoped and unscoped freezes", func() {
+		freezes, err := grh.ParseMergeFreezes("Fri 16:00-Mon 08:00; salemove=Wed 12:00-Wed 13:30;")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(freezes).To(Equal([]grh.MergeFreeze{
+			{Start: 5*24*60 + 16*60, End: 1*24*60 + 8*60},
+			{Scope: "salemove", Start: 3*24*60 + 12*60, End: 3*24*60 + 13*60 + 30},
+		}))
+	})
+
+	It("parses the time zones of freezes", func() {
+		freezes, err := grh.ParseMergeFreezes("Fri 16:00-Mon 08:00 America/Port-au-Prince; Sat 00:00-Sun 00:00 CET")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(freezes).To(HaveLen(2))
+		Expect(freezes[0].Location.String()).To(Equal("America/Port-au-Prince"))
+		Expect(freezes[0].Start).To(Equal(5*24*60 + 16*60))
+		Expect(freezes[1].Location.String()).To(Equal("CET"))
+	})
+
+	It("fails for invalid freezes", func() {
+		for _, freezesString := range []string{
+			"Fri 16:00",
+			"Friday 16:00-Mon 08:00",
+			"Fri 24:00-Mon 08:00",
+			"Fri 16:00-Fri 16:00",
+			"Fri 16:00-Mon 08:00 Mars/Olympus",
+		} {
+			_, err := grh.ParseMergeFreezes(freezesString)
+			Expect(err).To(HaveOccurred(), freezesString)
+		}
+	})
+})
+
+var _ = Describe("MergeFreeze", func() {
+	freezes, _ := grh.ParseMergeFreezes("Fri 16:00-Mon 08:00")
+	weekendFreeze := freezes[0]
+	// 2018-06-01 was a Friday
+	friday := time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	It("is active during the freeze", func() {
+		Expect(weekendFreeze.Active(friday.Add(16 * time.Hour))).To(BeTrue())
+		Expect(weekendFreeze.Active(friday.Add(36 * time.Hour))).To(BeTrue())
+		Expect(weekendFreeze.Active(friday.Add(79 * time.Hour))).To(BeTrue())
+	})
+
+	It("is not active outside of the freeze", func() {
+		Expect(weekendFreeze.Active(friday.Add(15 * time.Hour))).To(BeFalse())
+		Expect(weekendFreeze.Active(friday.Add(80 * time.Hour))).To(BeFalse())
+	})
+
+	It("ends at the same time of day across a daylight saving time change", func() {
+		tallinn, err := time.LoadLocation("Europe/Tallinn")
+		Expect(err).NotTo(HaveOccurred())
+		freezes, err := grh.ParseMergeFreezes("Sat 22:00-Sun 08:00 Europe/Tallinn")
+		Expect(err).NotTo(HaveOccurred())
+		// Summer time ended in Tallinn on 2026-10-25 at 04:00
+		saturdayNight := time.Date(2026, 10, 24, 23, 0, 0, 0, tallinn)
+
+		end := freezes[0].EndsAfter(saturdayNight)
+		Expect(end.Hour()).To(Equal(8))
+		Expect(end.UTC()).To(Equal(time.Date(2026, 10, 25, 6, 0, 0, 0, time.UTC)))
+		Expect(freezes[0].StartsAfter(end).UTC()).To(Equal(time.Date(2026, 10, 31, 20, 0, 0, 0, time.UTC)))
+	})
+
+	It("applies to the repositories in its scope", func() {
+		repository := grh.Repository{Owner: repositoryOwner, Name: repositoryName}
+		Expect(grh.MergeFreeze{}.AppliesTo(repository)).To(BeTrue())
+		Expect(grh.MergeFreeze{Scope: repositoryOwner}.AppliesTo(repository)).To(BeTrue())
+		Expect(grh.MergeFreeze{Scope: repositoryOwner + "/" + repositoryName}.AppliesTo(repository)).To(BeTrue())
+		Expect(grh.MergeFreeze{Scope: repositoryOwner + "/other"}.AppliesTo(repository)).To(BeFalse())
+	})
+})
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("!merge comment during a merge freeze", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			store            grh.Store
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			store = *context.Store
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+
+			context.Config.MergeFreezes = []grh.MergeFreeze{freezeAroundNow(repositoryOwner)}
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!merge", arbitraryIssueAuthor)
+		})
+
+		headSHA := "1235"
+		pr := &github.PullRequest{
+			Number:    github.Int(issueNumber),
+			Merged:    github.Bool(false),
+			Mergeable: github.Bool(true),
+			Base: &github.PullRequestBranch{
+				SHA:  github.String("1234"),
+				Ref:  github.String("master"),
+				Repo: repository,
+			},
+			Head: &github.PullRequestBranch{
+				SHA:  github.String(headSHA),
+				Ref:  github.String("feature"),
+				Repo: repository,
+			},
+			User: &github.User{
+				Login: github.String(arbitraryIssueAuthor),
+			},
+		}
+
+		BeforeEach(func() {
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+			issues.
+				On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{grh.MergingLabel}).
+				Return(emptyResult, emptyResponse, noError)
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+				Return(pr, emptyResponse, noError)
+			repositories.
+				On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.AnythingOfType("*github.ListOptions")).
+				Return(&github.CombinedStatus{
+					State: github.String("success"),
+				}, emptyResponse, noError)
+			issues.
+				On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+					mock.MatchedBy(commentContaining("Merging is deferred"))).
+				Return(emptyResult, emptyResponse, noError)
+		})
+
+		It("defers merging until the freeze ends", func() {
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			Expect(responseRecorder.Body.String()).To(ContainSubstring("Not merging"))
+
+			deferredMerges, err := store.DeferredMerges()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(deferredMerges).To(HaveLen(1))
+			Expect(deferredMerges[0].Number).To(Equal(issueNumber))
+		})
+	})
+})
+
+var _ = Describe("MergeDeferredPRs", func() {
+	var (
+		conf         grh.Config
+		store        grh.Store
+		mergedIssues []grh.Issue
+
+		deferredIssue = grh.Issue{
+			Number:     issueNumber,
+			Repository: grh.Repository{Owner: repositoryOwner, Name: repositoryName},
+			User:       grh.User{Login: arbitraryIssueAuthor},
+		}
+		merge = func(issue grh.Issue) grh.Response {
+			mergedIssues = append(mergedIssues, issue)
+			return grh.SuccessResponse{}
+		}
+	)
+
+	BeforeEach(func() {
+		conf = grh.Config{}
+		store = grh.NewMemoryStore()
+		mergedIssues = nil
+
+		Expect(store.AddDeferredMerge(deferredIssue)).To(Succeed())
+	})
+
+	Context("with the freeze still being active", func() {
+		BeforeEach(func() {
+			conf.MergeFreezes = []grh.MergeFreeze{freezeAroundNow("")}
+		})
+
+		It("keeps the merge deferred", func() {
+			Expect(grh.MergeDeferredPRs(conf, store, merge)).To(Succeed())
+			Expect(mergedIssues).To(BeEmpty())
+			Expect(store.DeferredMerges()).To(HaveLen(1))
+		})
+	})
+
+	Context("with the freeze being active in another time zone than the repository's", func() {
+		BeforeEach(func() {
+			conf.MergeFreezes = []grh.MergeFreeze{freezeAroundNow("")}
+			kiritimati, err := time.LoadLocation("Pacific/Kiritimati")
+			Expect(err).NotTo(HaveOccurred())
+			conf.RepositoryLocations = map[string]*time.Location{repositoryOwner: kiritimati}
+		})
+
+		It("merges the PR", func() {
+			Expect(grh.MergeDeferredPRs(conf, store, merge)).To(Succeed())
+			Expect(mergedIssues).To(Equal([]grh.Issue{deferredIssue}))
+		})
+	})
+
+	Context("with the freeze having ended", func() {
+		It("merges the PR", func() {
+			Expect(grh.MergeDeferredPRs(conf, store, merge)).To(Succeed())
+			Expect(mergedIssues).To(Equal([]grh.Issue{deferredIssue}))
+			Expect(store.DeferredMerges()).To(BeEmpty())
+		})
+	})
+})
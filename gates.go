@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/evaluator"
+)
+
+// GateContext is what a gate checks a PR with. The configuration has the
+// policies of the PR's organization and repository applied.
+type GateContext struct {
+	Config       Config
+	PR           *github.PullRequest
+	Store        Store
+	Issues       Issues
+	PullRequests PullRequests
+	Repositories Repositories
+	GraphQL      GraphQL
+}
+
+// Gate is a check a PR has to pass before it's merged. The PR is merged once
+// all of the repository's gates pass. A gate reports a PR it blocks with a
+// Fail result, if the PR has to be changed, or a Pending one, if it only has
+// to wait, along with the reason, e.g. "it's on hold", that's shown to the
+// PR's reviewers. An error fails the evaluation of the PR, which is retried
+// later, so gates should only return errors for failures that may pass, like
+// failed API requests.
+//
+// Custom gates are compiled in by registering them in an init function of a
+// file added to this package:
+//
+//	func init() {
+//		RegisterGate("changelog", GateFunc(func(ctx GateContext) (evaluator.Result, error) {
+//			if !strings.Contains(ctx.PR.GetBody(), "Changelog:") {
+//				return evaluator.Result{Outcome: evaluator.Fail, Reason: "it has no changelog entry"}, nil
+//			}
+//			return evaluator.Result{Outcome: evaluator.Pass}, nil
+//		}))
+//	}
+//
+// and adding their names to MERGE_GATES or to the merge_gates of a policy.
+type Gate interface {
+	Check(ctx GateContext) (evaluator.Result, error)
+}
+
+// GateFunc adapts a function to a Gate.
+type GateFunc func(ctx GateContext) (evaluator.Result, error)
+
+func (f GateFunc) Check(ctx GateContext) (evaluator.Result, error) {
+	return f(ctx)
+}
+
+// defaultGates are the built-in gates, in the order they're checked in
+// unless MERGE_GATES says otherwise. The contributor approval, the CLA, the
+// files, the secrets, the path rules, the policy webhook and the Rego policy
+// are checked after them, if REQUIRE_CONTRIBUTOR_APPROVAL, CLA_SERVICE_URL or
+// CLA_SIGNATURES_PATH, MAX_FILE_SIZE or DISALLOWED_FILE_PATTERNS,
+// SECRET_SCAN, PATH_RULES, POLICY_WEBHOOK_URL and REGO_POLICY_PATH are set.
+// PRs merged with the fast-forward MERGE_STRATEGY are checked for being
+// rebased last.
+var defaultGates = []string{baseBranchRule, mergeFreezeRule, holdRule, blocksRule, dependenciesRule, labelsRule,
+	descriptionRule, approvalsRule, conversationsRule}
+
+// mandatoryGates are checked whatever MERGE_GATES says, because they're how
+// reviewers stop a PR from being merged
+var mandatoryGates = []string{holdRule, blocksRule}
+
+// The checks of SKIP_LABELS that exempt PRs from the built-in gates
+var gateSkipChecks = map[string]string{
+	descriptionRule:   descriptionCheck,
+	approvalsRule:     approvalsCheck,
+	conversationsRule: conversationsCheck,
+	fileGuardGate:     filesCheck,
+	secretsGate:       secretsCheck,
+}
+
+var (
+	gatesMutex sync.RWMutex
+	gates      = map[string]Gate{
+		baseBranchRule: builtinGate(func(ctx GateContext) (evaluator.Result, *ErrorResponse) {
+			return checkBaseBranch(ctx.Config, ctx.PR), nil
+		}),
+		mergeFreezeRule: builtinGate(func(ctx GateContext) (evaluator.Result, *ErrorResponse) {
+			return checkFreeze(ctx.Config, baseRepository(ctx.PR)), nil
+		}),
+		holdRule: builtinGate(func(ctx GateContext) (evaluator.Result, *ErrorResponse) {
+			return checkHold(ctx.PR, ctx.Issues)
+		}),
+		blocksRule: builtinGate(func(ctx GateContext) (evaluator.Result, *ErrorResponse) {
+			return checkBlocks(prIssue(ctx.PR), ctx.Store)
+		}),
+		dependenciesRule: builtinGate(checkDependencies),
+		labelsRule: builtinGate(func(ctx GateContext) (evaluator.Result, *ErrorResponse) {
+			return checkLabels(ctx.Config, prIssue(ctx.PR), ctx.Issues)
+		}),
+		descriptionRule: builtinGate(func(ctx GateContext) (evaluator.Result, *ErrorResponse) {
+			return checkDescription(ctx.Config, ctx.PR), nil
+		}),
+		approvalsRule: builtinGate(func(ctx GateContext) (evaluator.Result, *ErrorResponse) {
+			return checkApprovals(ctx.Config, ctx.PR, ctx.Store, ctx.PullRequests, ctx.GraphQL)
+		}),
+		conversationsRule: builtinGate(func(ctx GateContext) (evaluator.Result, *ErrorResponse) {
+			return checkConversations(ctx.Config, ctx.PR, ctx.GraphQL)
+		}),
+		policyWebhookGate:       builtinGate(checkPolicyWebhook),
+		regoGate:                builtinGate(checkRegoPolicy),
+		pathRulesGate:           builtinGate(checkPathRules),
+		contributorApprovalGate: builtinGate(checkContributorApproval),
+		claGate:                 builtinGate(checkCLA),
+		fileGuardGate:           builtinGate(checkFileGuard),
+		secretsGate:             builtinGate(checkSecrets),
+		fastForwardGate:         builtinGate(checkFastForward),
+	}
+)
+
+// RegisterGate makes the gate available to MERGE_GATES and to the policies
+// under the name. It panics if a gate is already registered under the name,
+// like the built-in mergeable and statuses checks, which every PR passes
+// first.
+func RegisterGate(name string, gate Gate) {
+	gatesMutex.Lock()
+	defer gatesMutex.Unlock()
+	if _, exists := gates[name]; exists || name == mergeableRule || name == statusesRule {
+		panic(fmt.Sprintf("a gate named \"%s\" is already registered", name))
+	}
+	gates[name] = gate
+}
+
+func lookupGate(name string) (Gate, bool) {
+	gatesMutex.RLock()
+	defer gatesMutex.RUnlock()
+	gate, exists := gates[name]
+	return gate, exists
+}
+
+func gateNames() []string {
+	gatesMutex.RLock()
+	defer gatesMutex.RUnlock()
+	names := make([]string, 0, len(gates))
+	for name := range gates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateMergeGates checks that all of the gates are registered and listed
+// only once.
+func validateMergeGates(names []string) error {
+	seen := map[string]bool{}
+	for _, name := range names {
+		if _, exists := lookupGate(name); !exists {
+			return fmt.Errorf("must only include the gates %s, got \"%s\"", strings.Join(gateNames(), ", "), name)
+		} else if seen[name] {
+			return fmt.Errorf("must not include \"%s\" more than once", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// mergeGates returns the names of the gates to check the PRs with, in order.
+// The mandatory gates MERGE_GATES leaves out are checked first and the gates
+// the configuration enables that it leaves out are checked last, so that
+// setting MERGE_GATES would never turn a gate off by accident.
+func mergeGates(conf Config) []string {
+	gates := append([]string{}, defaultGates...)
+	if len(conf.MergeGates) > 0 {
+		gates = append(missingGates(conf.MergeGates, mandatoryGates), conf.MergeGates...)
+	}
+	var enabled []string
+	if conf.RequireContributorApproval {
+		enabled = append(enabled, contributorApprovalGate)
+	}
+	if isCLARequired(conf) {
+		enabled = append(enabled, claGate)
+	}
+	if isFileGuardEnabled(conf) {
+		enabled = append(enabled, fileGuardGate)
+	}
+	if conf.SecretScan {
+		enabled = append(enabled, secretsGate)
+	}
+	if len(conf.PathRules) > 0 {
+		enabled = append(enabled, pathRulesGate)
+	}
+	if conf.PolicyWebhookURL != "" {
+		enabled = append(enabled, policyWebhookGate)
+	}
+	if conf.RegoPolicy != nil {
+		enabled = append(enabled, regoGate)
+	}
+	if conf.MergeStrategy == MergeStrategyFastForward {
+		enabled = append(enabled, fastForwardGate)
+	}
+	return append(gates, missingGates(gates, enabled)...)
+}
+
+// missingGates returns the names of the gates that gates doesn't include.
+func missingGates(gates, names []string) []string {
+	included := make(map[string]bool)
+	for _, gate := range gates {
+		included[gate] = true
+	}
+	var missing []string
+	for _, name := range names {
+		if !included[name] {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// builtinGate adapts a check that fails with an ErrorResponse to a Gate.
+func builtinGate(check func(ctx GateContext) (evaluator.Result, *ErrorResponse)) Gate {
+	return GateFunc(func(ctx GateContext) (evaluator.Result, error) {
+		result, errResp := check(ctx)
+		if errResp != nil {
+			return result, ruleError{errResp}
+		}
+		return result, nil
+	})
+}
+
+// gateRule returns the rule that checks the PR with the gate. Errors of
+// custom gates are reported as failed requests to an upstream service,
+// because that's what they're expected to be. Gates that rely on the GraphQL
+// queries the provider doesn't support block the PR instead of failing its
+// evaluation over and over again.
+func gateRule(name string, gate Gate, ctx GateContext) evaluator.Rule {
+	return evaluator.Rule{
+		Name: name,
+		Check: func() (evaluator.Result, error) {
+			result, err := gate.Check(ctx)
+			if err == nil {
+				return result, nil
+			} else if unsupported, isUnsupported := asUnsupported(err); isUnsupported {
+				return evaluator.Result{
+					Outcome: evaluator.Fail,
+					Reason:  fmt.Sprintf("the %s gate can't be checked here: %s", name, unsupported.Error()),
+				}, nil
+			} else if _, isRuleError := err.(ruleError); isRuleError {
+				return result, err
+			}
+			errorMessage := fmt.Sprintf("Checking the %s gate of PR %s failed", name, prIssue(ctx.PR).FullName())
+			return result, ruleError{&ErrorResponse{err, http.StatusBadGateway, errorMessage}}
+		},
+	}
+}
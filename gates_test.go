@@ -0,0 +1,188 @@
+package main_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/evaluator"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func init() {
+	grh.RegisterGate("changelog", grh.GateFunc(func(ctx grh.GateContext) (evaluator.Result, error) {
+		if !strings.Contains(ctx.PR.GetBody(), "Changelog:") {
+			return evaluator.Result{Outcome: evaluator.Fail, Reason: "it has no changelog entry"}, nil
+		}
+		return evaluator.Result{Outcome: evaluator.Pass}, nil
+	}))
+	grh.RegisterGate("unreachable", grh.GateFunc(func(ctx grh.GateContext) (evaluator.Result, error) {
+		return evaluator.Result{}, errors.New("connection refused")
+	}))
+}
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("merge gates", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+		})
+
+		headSHA := "1235"
+		pr := &github.PullRequest{
+			Number:    github.Int(issueNumber),
+			Body:      github.String("Adds the widget."),
+			Merged:    github.Bool(false),
+			Mergeable: github.Bool(true),
+			Base: &github.PullRequestBranch{
+				SHA:  github.String("1234"),
+				Ref:  github.String("master"),
+				Repo: repository,
+			},
+			Head: &github.PullRequestBranch{
+				SHA:  github.String(headSHA),
+				Ref:  github.String("feature"),
+				Repo: repository,
+			},
+			User: &github.User{
+				Login: github.String(arbitraryIssueAuthor),
+			},
+		}
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!status", arbitraryIssueAuthor)
+		})
+
+		BeforeEach(func() {
+			context.Config.RequiredApprovals = 1
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+				Return(pr, emptyResponse, noError)
+			repositories.
+				On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+					mock.AnythingOfType("*github.ListOptions")).
+				Return(&github.CombinedStatus{
+					State: github.String("success"),
+					Statuses: []github.RepoStatus{{
+						Context: github.String("ci"),
+						State:   github.String("success"),
+					}},
+				}, emptyResponse, noError)
+			mockLabels(issues, issueNumber)
+		})
+
+		Context("with a custom gate in MERGE_GATES", func() {
+			BeforeEach(func() {
+				context.Config.MergeGates = []string{"hold", "changelog"}
+			})
+
+			It("checks only the listed gates", func() {
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(func(comment *github.IssueComment) bool {
+							return commentContaining("because it has no changelog entry")(comment) &&
+								commentContaining(":white_check_mark: **hold**")(comment) &&
+								commentContaining(":x: **changelog**: it has no changelog entry")(comment) &&
+								!commentContaining("**approvals**")(comment)
+						})).
+					Return(emptyResult, emptyResponse, noError)
+
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+			})
+		})
+
+		Context("with MERGE_GATES leaving out a gate the configuration enables", func() {
+			var policyWebhook *httptest.Server
+
+			BeforeEach(func() {
+				policyWebhook = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{"allow": false, "reason": "it lacks a security review"}`))
+				}))
+				context.Config.PolicyWebhookURL = policyWebhook.URL
+				context.Config.MergeGates = []string{"hold"}
+			})
+			AfterEach(func() {
+				policyWebhook.Close()
+			})
+
+			It("checks the enabled gate after the listed ones", func() {
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(func(comment *github.IssueComment) bool {
+							return commentContaining(":white_check_mark: **hold**")(comment) &&
+								commentContaining(":x: **policy webhook**: it lacks a security review")(comment)
+						})).
+					Return(emptyResult, emptyResponse, noError)
+
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+			})
+		})
+
+		Context("with MERGE_GATES leaving out the blocks", func() {
+			BeforeEach(func() {
+				context.Config.MergeGates = []string{"changelog"}
+				Expect((*context.Store).AddBlock(grh.Block{
+					Issue:     grh.Issue{Number: issueNumber, Repository: trackedRepository},
+					User:      "reviewer",
+					Reason:    "the migration isn't reversible",
+					CreatedAt: time.Now(),
+				})).To(Succeed())
+			})
+
+			It("still checks the blocks first", func() {
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining(":x: **blocks**: it's blocked by @reviewer"))).
+					Return(emptyResult, emptyResponse, noError)
+
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+			})
+		})
+
+		Context("with a custom gate failing", func() {
+			BeforeEach(func() {
+				context.Config.MergeGates = []string{"unreachable"}
+			})
+
+			It("fails the evaluation", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusBadGateway))
+				Expect(responseRecorder.Body.String()).To(ContainSubstring("Checking the unreachable gate"))
+			})
+		})
+	})
+})
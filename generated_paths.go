@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// generatedDiff is how much of a PR's diff is in GENERATED_PATHS.
+type generatedDiff struct {
+	Files          int
+	Lines          int
+	GeneratedFiles int
+	GeneratedLines int
+}
+
+// dominated reports whether most of the changed lines are in generated or
+// vendored files.
+func (d generatedDiff) dominated() bool {
+	return d.GeneratedLines > 0 && d.GeneratedLines*2 > d.Lines
+}
+
+func isGeneratedPath(conf Config, file string) bool {
+	for _, pattern := range conf.GeneratedPaths {
+		if matchesPathPattern(pattern, file) {
+			return true
+		}
+	}
+	return false
+}
+
+// measureGeneratedDiff counts the changed files and lines of the PR and how
+// many of them are in GENERATED_PATHS.
+func measureGeneratedDiff(conf Config, files []*github.CommitFile) generatedDiff {
+	var diff generatedDiff
+	for _, file := range files {
+		lines := file.GetAdditions() + file.GetDeletions()
+		diff.Files++
+		diff.Lines += lines
+		if isGeneratedPath(conf, file.GetFilename()) {
+			diff.GeneratedFiles++
+			diff.GeneratedLines += lines
+		}
+	}
+	return diff
+}
+
+// writeSummaryGenerated notes how much of the diff is generated or vendored,
+// so that the reviewers would know which files to focus on.
+func writeSummaryGenerated(conf Config, message *strings.Builder, files []*github.CommitFile) {
+	diff := measureGeneratedDiff(conf, files)
+	if diff.GeneratedFiles == 0 {
+		return
+	}
+	fmt.Fprintf(message, "**Generated code**\n- %d of the %d changed lines are in %d generated or vendored "+
+		"file(s) matching `%s`\n", diff.GeneratedLines, diff.Lines, diff.GeneratedFiles,
+		strings.Join(conf.GeneratedPaths, "`, `"))
+	if diff.dominated() {
+		message.WriteString("- the diff is dominated by generated code, so the other files deserve most of the " +
+			"review\n")
+	}
+	message.WriteString("\n")
+}
+
+// labelsGenerated reports whether labelGeneratedPR would label the PR.
+func labelsGenerated(conf Config, pullRequestEvent PullRequestEvent) bool {
+	return conf.GeneratedLabel != "" && len(conf.GeneratedPaths) > 0 &&
+		!pullRequestEvent.HasLabel(conf.GeneratedLabel)
+}
+
+// labelGeneratedPR labels the PR with GENERATED_LABEL, if most of its
+// changed lines are in GENERATED_PATHS. The label isn't removed when that's
+// no longer the case, because it may have been added by hand.
+func labelGeneratedPR(conf Config, pullRequestEvent PullRequestEvent, files []*github.CommitFile,
+	issues Issues) *ErrorResponse {
+
+	if !labelsGenerated(conf, pullRequestEvent) || !measureGeneratedDiff(conf, files).dominated() {
+		return nil
+	}
+	issue := pullRequestEvent.Issue()
+	log.Printf("Labeling PR %s as %s, because most of its diff is generated.\n", issue.FullName(),
+		conf.GeneratedLabel)
+	return addLabel(issue.Repository, issue.Number, conf.GeneratedLabel, issues)
+}
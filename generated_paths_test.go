@@ -0,0 +1,218 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	var (
+		handle      = context.Handle
+		headers     = context.Headers
+		requestJSON = context.RequestJSON
+
+		responseRecorder *httptest.ResponseRecorder
+		pullRequests     *mocks.PullRequests
+		repositories     *mocks.Repositories
+		issues           *mocks.Issues
+
+		headSHA        = "1235"
+		anyListOptions = mock.AnythingOfType("*github.ListOptions")
+
+		changedFile = func(name string, additions, deletions int) *github.CommitFile {
+			return &github.CommitFile{
+				Filename:  github.String(name),
+				Status:    github.String("modified"),
+				Additions: github.Int(additions),
+				Deletions: github.Int(deletions),
+			}
+		}
+		mockFiles = func(files ...*github.CommitFile) {
+			pullRequests.
+				On("ListFiles", anyContext, repositoryOwner, repositoryName, issueNumber, anyListOptions).
+				Return(files, emptyResponse, noError)
+		}
+	)
+	BeforeEach(func() {
+		responseRecorder = *context.ResponseRecorder
+		pullRequests = *context.PullRequests
+		repositories = *context.Repositories
+		issues = *context.Issues
+
+		context.Config.GeneratedPaths = []string{"vendor/"}
+		context.Config.GeneratedLabel = "vendored"
+	})
+
+	Describe("pull_request synchronize event with generated paths", func() {
+		BeforeEach(func() {
+			pullRequests.
+				On("ListCommits", anyContext, repositoryOwner, repositoryName, issueNumber, anyListOptions).
+				Return(githubCommits(commit{headSHA, "Update the dependencies"}), emptyResponse, noError)
+			repositories.
+				On("CreateStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.Anything).
+				Return(emptyResult, emptyResponse, noError)
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "pull_request",
+			}
+		})
+		requestJSON.Is(func() string {
+			return PullRequestEvent("synchronize", headSHA, grh.Repository{
+				Owner: repositoryOwner,
+				Name:  repositoryName,
+				URL:   sshURL,
+			})
+		})
+
+		Context("with most of the diff generated", func() {
+			BeforeEach(func() {
+				context.Config.SizeLabels = true
+				context.Config.SizeLabelLineThresholds = []int{10, 30, 100, 500}
+				mockLabels(issues, issueNumber, "size/XS")
+				mockFiles(
+					changedFile("go.mod", 2, 1),
+					changedFile("vendor/lib/lib.go", 600, 0),
+				)
+				issues.
+					On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+						[]string{"vendored"}).
+					Return(emptyResult, emptyResponse, noError).
+					Once()
+			})
+
+			It("labels the PR, fetching its files only once for both labels", func() {
+				handle()
+
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+				pullRequests.AssertNumberOfCalls(GinkgoT(), "ListFiles", 1)
+			})
+		})
+
+		Context("with most of the diff written by hand", func() {
+			BeforeEach(func() {
+				mockLabels(issues, issueNumber)
+				mockFiles(
+					changedFile("main.go", 40, 10),
+					changedFile("vendor/lib/lib.go", 20, 0),
+				)
+			})
+
+			It("doesn't label the PR", func() {
+				handle()
+
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertNotCalled(GinkgoT(), "AddLabelsToIssue", anyContext, repositoryOwner, repositoryName,
+					issueNumber, mock.Anything)
+			})
+		})
+
+		Context("with neither the size nor the generated label to update", func() {
+			BeforeEach(func() {
+				context.Config.GeneratedLabel = ""
+				mockLabels(issues, issueNumber)
+			})
+
+			It("doesn't fetch the PR's files", func() {
+				handle()
+
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				pullRequests.AssertNotCalled(GinkgoT(), "ListFiles", anyContext, repositoryOwner, repositoryName,
+					issueNumber, anyListOptions)
+			})
+		})
+	})
+
+	Describe("!summary comment with generated paths", func() {
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!summary", arbitraryIssueAuthor)
+		})
+
+		BeforeEach(func() {
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+				Return(&github.PullRequest{
+					Number:    github.Int(issueNumber),
+					Merged:    github.Bool(false),
+					Mergeable: github.Bool(true),
+					Base: &github.PullRequestBranch{
+						SHA:  github.String("1234"),
+						Ref:  github.String("master"),
+						Repo: repository,
+					},
+					Head: &github.PullRequestBranch{
+						SHA:  github.String(headSHA),
+						Ref:  github.String("feature"),
+						Repo: repository,
+					},
+					User: &github.User{Login: github.String(arbitraryIssueAuthor)},
+				}, emptyResponse, noError)
+			mockListCommits(githubCommits(commit{headSHA, "Update the dependencies"}), 100, repositoryOwner,
+				repositoryName, issueNumber, pullRequests)
+			repositories.
+				On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA, anyListOptions).
+				Return(&github.CombinedStatus{State: github.String("success")}, emptyResponse, noError)
+			mockLabels(issues, issueNumber)
+		})
+
+		Context("with most of the diff generated", func() {
+			BeforeEach(func() {
+				mockFiles(
+					changedFile("go.mod", 2, 1),
+					changedFile("vendor/lib/lib.go", 600, 0),
+				)
+			})
+
+			It("notes how much of the diff is generated and that it dominates", func() {
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("**Generated code**\n- 600 of the 603 changed lines are "+
+							"in 1 generated or vendored file(s) matching `vendor/`\n- the diff is dominated by "+
+							"generated code"))).
+					Return(emptyResult, emptyResponse, noError)
+
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+			})
+		})
+
+		Context("without generated files", func() {
+			BeforeEach(func() {
+				mockFiles(changedFile("main.go", 40, 10))
+			})
+
+			It("leaves the generated code out of the summary", func() {
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(func(comment *github.IssueComment) bool {
+							return commentContaining("Summary of PR #7")(comment) &&
+								!commentContaining("**Generated code**")(comment)
+						})).
+					Return(emptyResult, emptyResponse, noError)
+
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+			})
+		})
+	})
+})
@@ -0,0 +1,166 @@
+package git_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/salemove/github-review-helper/git"
+)
+
+func TestCherryPickAndPush(t *testing.T) {
+	skipWithoutGit(t)
+
+	testRepoGit, testRepoDir, cleanup := createTestRepo(t)
+	defer cleanup()
+
+	testRepoGit("checkout", "-b", "release")
+	testRepoGit("checkout", "master")
+	createFile(t, testRepoDir, foo)
+	testRepoGit("add", foo.Name)
+	testRepoGit("commit", "-m", "Add foo")
+	fooSHA := testRepoGit("rev-parse", "HEAD")
+
+	testRepoGit("checkout", "release")
+	createFile(t, testRepoDir, bar)
+	testRepoGit("add", bar.Name)
+	testRepoGit("commit", "-m", "Add bar")
+
+	repo, cleanup := cloneTestRepo(t, testRepoDir)
+	defer cleanup()
+
+	err := repo.CherryPickAndPush("origin/release", fooSHA, "origin", "backport")
+	checkError(t, err)
+
+	parentSHA := testRepoGit("rev-parse", "backport^")
+	if releaseSHA := testRepoGit("rev-parse", "release"); parentSHA != releaseSHA {
+		t.Fatalf("Expected the cherry-picked commit to be on top of release (%s), but its parent is %s",
+			releaseSHA, parentSHA)
+	}
+	if files := testRepoGit("show", "--name-only", "--format=", "backport"); files != foo.Name {
+		t.Fatalf("Expected the cherry-picked commit to add %s, but it changed: %s", foo.Name, files)
+	}
+}
+
+func TestRevertAndPush(t *testing.T) {
+	skipWithoutGit(t)
+
+	testRepoGit, testRepoDir, cleanup := createTestRepo(t)
+	defer cleanup()
+
+	createFile(t, testRepoDir, foo)
+	testRepoGit("add", foo.Name)
+	testRepoGit("commit", "-m", "Add foo")
+	fooSHA := testRepoGit("rev-parse", "HEAD")
+	createFile(t, testRepoDir, bar)
+	testRepoGit("add", bar.Name)
+	testRepoGit("commit", "-m", "Add bar")
+
+	repo, cleanup := cloneTestRepo(t, testRepoDir)
+	defer cleanup()
+
+	err := repo.RevertAndPush("origin/master", fooSHA, "origin", "revert")
+	checkError(t, err)
+
+	if files := testRepoGit("ls-tree", "--name-only", "revert"); files != readme.Name+"\n"+bar.Name {
+		t.Fatalf("Expected only %s and %s to be left after the revert, but got: %s", readme.Name, bar.Name,
+			files)
+	}
+}
+
+func TestCherryPickAndPush_conflict(t *testing.T) {
+	skipWithoutGit(t)
+
+	testRepoGit, testRepoDir, cleanup := createTestRepo(t)
+	defer cleanup()
+
+	testRepoGit("checkout", "-b", "release")
+	testRepoGit("checkout", "master")
+	createFile(t, testRepoDir, foo)
+	testRepoGit("add", foo.Name)
+	testRepoGit("commit", "-m", "Add foo")
+	fooSHA := testRepoGit("rev-parse", "HEAD")
+
+	testRepoGit("checkout", "release")
+	createFile(t, testRepoDir, file{Name: foo.Name, Contents: "conflicting"})
+	testRepoGit("add", foo.Name)
+	testRepoGit("commit", "-m", "Add another foo")
+
+	repo, cleanup := cloneTestRepo(t, testRepoDir)
+	defer cleanup()
+
+	err := repo.CherryPickAndPush("origin/release", fooSHA, "origin", "backport")
+	if _, ok := err.(*git.ErrCherryPickConflict); !ok {
+		t.Fatalf("Expected a cherry-pick conflict, but got: %v", err)
+	}
+	// The repository is left usable for the next operation
+	err = repo.RevertAndPush("origin/master", fooSHA, "origin", "revert")
+	checkError(t, err)
+}
+
+func TestCherryPickOntoBranch(t *testing.T) {
+	skipWithoutGit(t)
+
+	testRepoGit, testRepoDir, cleanup := createTestRepo(t)
+	defer cleanup()
+
+	testRepoGit("checkout", "-b", "hotfix")
+	testRepoGit("checkout", "master")
+	createFile(t, testRepoDir, foo)
+	testRepoGit("add", foo.Name)
+	testRepoGit("commit", "-m", "Add foo")
+	fooSHA := testRepoGit("rev-parse", "HEAD")
+	createFile(t, testRepoDir, bar)
+	testRepoGit("add", bar.Name)
+	testRepoGit("commit", "-m", "Add bar")
+	barSHA := testRepoGit("rev-parse", "HEAD")
+
+	repo, cleanup := cloneTestRepo(t, testRepoDir)
+	defer cleanup()
+
+	shas, err := repo.CherryPickOntoBranch([]string{fooSHA, barSHA}, "origin", "hotfix")
+	checkError(t, err)
+
+	if len(shas) != 2 || testRepoGit("rev-parse", "hotfix") != shas[1] ||
+		testRepoGit("rev-parse", "hotfix^") != shas[0] {
+		t.Fatalf("Expected hotfix to end with the cherry-picked commits %v, but got: %s", shas,
+			testRepoGit("log", "--format=%H", "hotfix"))
+	}
+	if message := testRepoGit("log", "-1", "--format=%B", "hotfix"); !strings.Contains(message,
+		"cherry picked from commit "+barSHA) {
+		t.Fatalf("Expected the message to refer to the original commit, but got: %s", message)
+	}
+}
+
+func TestCherryPickOntoBranch_conflict(t *testing.T) {
+	skipWithoutGit(t)
+
+	testRepoGit, testRepoDir, cleanup := createTestRepo(t)
+	defer cleanup()
+
+	testRepoGit("checkout", "-b", "hotfix")
+	createFile(t, testRepoDir, file{Name: foo.Name, Contents: "conflicting"})
+	testRepoGit("add", foo.Name)
+	testRepoGit("commit", "-m", "Add another foo")
+	hotfixSHA := testRepoGit("rev-parse", "HEAD")
+	testRepoGit("checkout", "master")
+	createFile(t, testRepoDir, foo)
+	testRepoGit("add", foo.Name)
+	testRepoGit("commit", "-m", "Add foo")
+	fooSHA := testRepoGit("rev-parse", "HEAD")
+
+	repo, cleanup := cloneTestRepo(t, testRepoDir)
+	defer cleanup()
+
+	_, err := repo.CherryPickOntoBranch([]string{fooSHA}, "origin", "hotfix")
+	conflict, ok := err.(*git.ErrCherryPickConflict)
+	if !ok {
+		t.Fatalf("Expected a cherry-pick conflict, but got: %v", err)
+	} else if conflict.Commit != fooSHA || len(conflict.ConflictingFiles) != 1 ||
+		conflict.ConflictingFiles[0] != foo.Name {
+		t.Fatalf("Expected %s to conflict in %s, but got %s conflicting in %v", fooSHA, foo.Name,
+			conflict.Commit, conflict.ConflictingFiles)
+	}
+	if sha := testRepoGit("rev-parse", "hotfix"); sha != hotfixSHA {
+		t.Fatalf("Expected hotfix to be left at %s, but it's at %s", hotfixSHA, sha)
+	}
+}
@@ -0,0 +1,41 @@
+package git
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// tokenVariable is the variable the credential helper reads the token from.
+const tokenVariable = "GITHUB_REVIEW_HELPER_GIT_TOKEN"
+
+// credentialHelper answers git's requests for the credentials of HTTPS remotes with the token in tokenVariable. git
+// also tells the helpers to store or erase the credentials it used, which this one ignores.
+const credentialHelper = `!f() { if test "$1" = get; then echo username=x-access-token; ` +
+	`echo "password=$` + tokenVariable + `"; fi; }; f`
+
+// credentialArgs are the options that make git get the credentials of HTTPS remotes from credentialHelper alone,
+// instead of the helpers configured on the host, and access the SSH remotes on GitHub over HTTPS, so that the
+// repositories could be cloned from the SSH URLs of the webhooks.
+var credentialArgs = []string{
+	"-c", "credential.helper=",
+	"-c", "credential.helper=" + credentialHelper,
+	"-c", "url.https://github.com/.insteadOf=git@github.com:",
+	"-c", "url.https://github.com/.insteadOf=ssh://git@github.com/",
+}
+
+// withToken returns the options and the run function that authenticate a git command to HTTPS remotes with the
+// token that token returns. The token is never written to the repo's config or to the remotes' URLs, so every
+// command gets a fresh one, even if the previous one expired during a long operation.
+func withToken(allArgs []string, run func(*exec.Cmd) error, token func() (string, error)) ([]string,
+	func(*exec.Cmd) error, error) {
+
+	value, err := token()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get a token for git: %v", err)
+	}
+	allArgs = append(append([]string{}, credentialArgs...), allArgs...)
+	return allArgs, func(cmd *exec.Cmd) error {
+		cmd.Env = append(cmd.Env, tokenVariable+"="+value)
+		return run(cmd)
+	}, nil
+}
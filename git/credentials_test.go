@@ -0,0 +1,77 @@
+package git_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/salemove/github-review-helper/git"
+)
+
+func TestGetUpdatedRepo_token(t *testing.T) {
+	skipWithoutGit(t)
+
+	_, testRepoDir, cleanup := createTestRepo(t)
+	defer cleanup()
+
+	execPath, err := exec.Command("git", "--exec-path").Output()
+	checkError(t, err)
+
+	// The remote only accepts the latest token, like GitHub doesn't accept
+	// the expired installation tokens
+	var (
+		tokenLock sync.Mutex
+		tokens    int
+	)
+	currentToken := func() string {
+		return fmt.Sprintf("token-%d", tokens)
+	}
+	backend := &cgi.Handler{
+		Path: filepath.Join(strings.TrimSpace(string(execPath)), "git-http-backend"),
+		Env:  []string{"GIT_PROJECT_ROOT=" + filepath.Dir(testRepoDir), "GIT_HTTP_EXPORT_ALL=1"},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenLock.Lock()
+		token := currentToken()
+		tokenLock.Unlock()
+		if user, password, ok := r.BasicAuth(); !ok || user != "x-access-token" || password != token {
+			w.Header().Set("WWW-Authenticate", `Basic realm="GitHub"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		backend.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	reposDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	gitRepos := git.NewReposWithOptions(reposDir, git.Options{
+		Token: func() (string, error) {
+			tokenLock.Lock()
+			defer tokenLock.Unlock()
+			tokens++
+			return currentToken(), nil
+		},
+	})
+	url := server.URL + "/" + filepath.Base(testRepoDir)
+	_, err = gitRepos.GetUpdatedRepo(url, "my", "test-repo")
+	checkError(t, err)
+	// Fetching with a new token, after the one the repo was cloned with has
+	// been replaced
+	_, err = gitRepos.GetUpdatedRepo(url, "my", "test-repo")
+	checkError(t, err)
+
+	remoteURL, err := exec.Command("git", "-C", filepath.Join(reposDir, "my", "test-repo"), "config",
+		"remote.origin.url").Output()
+	checkError(t, err)
+	if strings.Contains(string(remoteURL), "token") {
+		t.Fatalf("Expected the token to be left out of the remote's URL, got %s", remoteURL)
+	}
+}
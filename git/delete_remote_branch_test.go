@@ -3,6 +3,8 @@ package git_test
 import (
 	"strings"
 	"testing"
+
+	"github.com/salemove/github-review-helper/git"
 )
 
 func TestDeleteRemoteBranch(t *testing.T) {
@@ -50,8 +52,8 @@ func TestDeleteRemoteBranch_noBranch(t *testing.T) {
 
 	nonExistentBranchName := "feature"
 	err := repo.DeleteRemoteBranch(nonExistentBranchName)
-	if err == nil {
-		t.Fatal("Expected deletion of a non-existent branch to fail")
+	if !git.IsRemoteBranchNotFound(err) {
+		t.Fatalf("Expected deletion of a non-existent branch to fail with ErrRemoteBranchNotFound, but got: %v", err)
 	}
 }
 
@@ -0,0 +1,73 @@
+package git_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/salemove/github-review-helper/git"
+)
+
+func TestGetUpdatedRepo_diskFull(t *testing.T) {
+	skipWithoutGit(t)
+
+	_, testRepoDir, cleanup := createTestRepo(t)
+	defer cleanup()
+
+	reposDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	gitRepos := git.NewReposWithOptions(reposDir, git.Options{DiskQuota: 1})
+	_, err := gitRepos.GetUpdatedRepo(testRepoDir, "my", "test-repo")
+	checkError(t, err)
+
+	// Fetching the repos that are already cloned is still allowed
+	_, err = gitRepos.GetUpdatedRepo(testRepoDir, "my", "test-repo")
+	checkError(t, err)
+
+	_, err = gitRepos.GetUpdatedRepo(testRepoDir, "my", "other-repo")
+	if !git.IsDiskFull(err) {
+		t.Fatalf("Expected the clone to be refused, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(reposDir, "my", "other-repo")); !os.IsNotExist(err) {
+		t.Fatalf("Expected the repo not to be cloned, got %v", err)
+	}
+}
+
+func TestRemoveIdleRepos(t *testing.T) {
+	skipWithoutGit(t)
+
+	_, testRepoDir, cleanup := createTestRepo(t)
+	defer cleanup()
+
+	reposDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	gitRepos := git.NewRepos(reposDir)
+	_, err := gitRepos.GetUpdatedRepo(testRepoDir, "my", "test-repo")
+	checkError(t, err)
+
+	removed, err := gitRepos.RemoveIdleRepos(time.Hour)
+	checkError(t, err)
+	if len(removed) != 0 {
+		t.Fatalf("Expected the recently used repo to be kept, but %v were removed", removed)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	removed, err = gitRepos.RemoveIdleRepos(time.Millisecond)
+	checkError(t, err)
+	localPath := filepath.Join(reposDir, "my", "test-repo")
+	if len(removed) != 1 || removed[0] != localPath {
+		t.Fatalf("Expected %s to be removed, but got %v", localPath, removed)
+	} else if _, err := os.Stat(localPath); !os.IsNotExist(err) {
+		t.Fatalf("Expected %s to be deleted, got %v", localPath, err)
+	} else if len(gitRepos.States()) != 0 {
+		t.Fatalf("Expected the removed repo to be forgotten, got %v", gitRepos.States())
+	}
+
+	// The removed repo is cloned again when it's needed
+	_, err = gitRepos.GetUpdatedRepo(testRepoDir, "my", "test-repo")
+	checkError(t, err)
+	checkFile(t, localPath, readme)
+}
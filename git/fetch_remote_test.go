@@ -0,0 +1,43 @@
+package git_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/salemove/github-review-helper/git"
+)
+
+func TestFetchRemote(t *testing.T) {
+	skipWithoutGit(t)
+
+	_, testRepoDir, cleanup := createTestRepo(t)
+	defer cleanup()
+	forkGit, forkDir, cleanup := createTestRepo(t)
+	defer cleanup()
+
+	featureBranchName := "feature"
+	forkGit("checkout", "-b", featureBranchName)
+	createFile(t, forkDir, foo)
+	forkGit("add", foo.Name)
+	forkGit("commit", "-m", "Add foo")
+
+	reposDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	gitRepos := git.NewRepos(reposDir)
+	repo, err := gitRepos.GetUpdatedRepo(testRepoDir, "my", "test-repo")
+	checkError(t, err)
+	cloneGit := gitForPath(t, filepath.Join(reposDir, "my", "test-repo"))
+
+	// Fetching twice makes sure that an existing remote is reused
+	for i := 0; i < 2; i++ {
+		err = repo.FetchRemote("fork", forkDir)
+		checkError(t, err)
+	}
+
+	forkBranches := cloneGit("for-each-ref", "--format=%(refname:short)", "refs/remotes/fork/")
+	if !strings.Contains(forkBranches, "fork/"+featureBranchName) {
+		t.Fatalf("Expected fork/%s to be fetched, but found: %s", featureBranchName, forkBranches)
+	}
+}
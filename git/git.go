@@ -2,27 +2,159 @@ package git
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Repos interface {
 	// GetUpdatedRepo either clones the specified repository if it hasn't been cloned yet or simply
 	// fetches the latest changes for it. Returns the Repo in any case.
 	GetUpdatedRepo(url, repoOwner, repoName string) (Repo, error)
+	// PruneStaleRefs removes the remote-tracking refs of all local repos that no longer exist on the remote.
+	PruneStaleRefs() error
+	// States describes what each of the local repos is currently doing. It doesn't wait for any of the
+	// repos' operations to finish, so it can be used to diagnose hung git commands.
+	States() []RepoState
+	// RemoveIdleRepos removes the local repos that haven't been used for maxIdle and, while the local repos take
+	// up more than the disk quota, the least recently used of the rest. Busy repos and the ones used in the last
+	// minute, which are likely about to be used by the operation that fetched them, are kept. Zero maxIdle only
+	// enforces the quota. Returns the paths of the removed repos.
+	RemoveIdleRepos(maxIdle time.Duration) ([]string, error)
+	// WithContext returns Repos sharing the same local repos, whose commands are traced as children of the
+	// span in ctx.
+	WithContext(ctx context.Context) Repos
+}
+
+// CloneOptions describes how to clone a repository that's too big to be cloned in full.
+type CloneOptions struct {
+	// Filter is the partial clone filter, e.g. "blob:none", which makes git download the file contents only
+	// when an operation needs them. If cloning with the filter fails, the repository is cloned in full.
+	// Servers that don't support filters send everything anyway.
+	Filter string
+	// SparsePaths are the directories to check out in cone mode. The whole working tree is checked out, if
+	// it's empty.
+	SparsePaths []string
+}
+
+// Timeouts limits how long the git commands may run. A command that runs for longer is killed and fails with
+// ErrTimeout. Zero means no limit.
+type Timeouts struct {
+	// Network limits the commands that talk to the remotes: clone, fetch and push
+	Network time.Duration
+	// Local limits the rest of the git commands, e.g. rebase
+	Local time.Duration
+	// Command limits the commands run with RunCommand, e.g. the merge hooks
+	Command time.Duration
+}
+
+// Identity is the name and email address of the author and committer of the commits the repos create, e.g. the
+// reverts and the squashes. The squashes keep the author of the squashed commits.
+type Identity struct {
+	Name  string
+	Email string
+}
+
+// Options describes how NewReposWithOptions clones the repositories and runs the git commands.
+type Options struct {
+	// CloneOptions returns the options for cloning a repository. Repositories are cloned in full, if it's nil.
+	CloneOptions func(repoOwner, repoName string) CloneOptions
+	// Env holds the variables, e.g. ProxyEnv's, added to the environment of every git command and of the commands
+	// run with RunCommand
+	Env      []string
+	Timeouts Timeouts
+	// Identity defaults to github-review-helper without an email address
+	Identity Identity
+	// SkipLFSSmudge keeps the files Git LFS tracks as pointers in the working trees, instead of downloading them.
+	// The rewrites don't need the files' contents, so only the commands run with RunCommand see the difference.
+	SkipLFSSmudge bool
+	// DiskQuota is the number of bytes the local repos may take up. Repositories aren't cloned once the local
+	// repos take up the quota. Zero means no limit.
+	DiskQuota int64
+	// Token returns the token to authenticate to HTTPS remotes with, e.g. a GitHub App installation's token,
+	// which expires. It's called for every git command and the token is handed to git by a credential helper,
+	// rather than stored in the remotes' URLs. The SSH remotes on GitHub are accessed over HTTPS, when it's set.
+	Token func() (string, error)
+}
+
+// RepoState describes the operation a local repo is busy with.
+type RepoState struct {
+	Path string `json:"path"`
+	// Operation is the operation holding the repo's lock or empty, if the repo is idle
+	Operation string    `json:"operation,omitempty"`
+	LockedAt  time.Time `json:"locked_at"`
+	// Waiting is the number of operations waiting for the repo's lock
+	Waiting int `json:"waiting"`
+	// Command is the command the operation is currently running
+	Command          string    `json:"command,omitempty"`
+	CommandStartedAt time.Time `json:"command_started_at"`
+	// Progress describes how far the command has got, e.g. "cloning 45%" or
+	// "rebasing commit 3/10", if the command reports its progress
+	Progress string `json:"progress,omitempty"`
+	// UsedAt is when the repo's last operation finished
+	UsedAt time.Time `json:"used_at"`
 }
 
 type Repo interface {
 	Fetch() error
+	// FetchRemote adds a remote with the given name and URL, unless the repo already has a remote with that
+	// name, and fetches it. Used for fetching the branches of forks.
+	FetchRemote(name, url string) error
 	// Runs `git rebase --interactive --autosquash` for the given refs and automatically saves and closes
-	// the editor for interactive rebase. Then force pushes the current HEAD to destinationRef on origin.
-	AutosquashAndPush(upstreamRef, branchRef, destinationRef string) error
+	// the editor for interactive rebase. Then force pushes the current HEAD to destinationRef on remote.
+	// The push fails with ErrPushRejected, if destinationRef no longer points to branchRef.
+	AutosquashAndPush(upstreamRef, branchRef, remote, destinationRef string) error
+	// SquashAndPush squashes the last count commits of branchRef, or all of its commits since it branched off
+	// upstreamRef if count is 0, into one commit and force pushes it to destinationRef on remote. The commit
+	// keeps the author of the oldest squashed commit and its message, unless message isn't empty. The push
+	// fails with ErrPushRejected, if destinationRef no longer points to branchRef.
+	SquashAndPush(upstreamRef, branchRef string, count int, message, remote, destinationRef string) error
+	// RebaseAndPush rebases branchRef onto upstreamRef and force pushes the result to the destinationRef
+	// branch on remote. Returns the SHA of the rebased commit.
+	RebaseAndPush(upstreamRef, branchRef, remote, destinationRef string) (string, error)
+	// RebaseOntoAndPush rebases the commits of branchRef that aren't in oldBaseRef onto upstreamRef, like
+	// `git rebase --onto`, and force pushes the result to the destinationRef branch on remote. Returns the SHA
+	// of the rebased commit. The push fails with ErrPushRejected, if destinationRef no longer points to
+	// branchRef.
+	RebaseOntoAndPush(upstreamRef, oldBaseRef, branchRef, remote, destinationRef string) (string, error)
+	// CherryPickAndPush cherry-picks commit on top of upstreamRef and force pushes the result to the
+	// destinationRef branch on remote. Merge commits are cherry-picked relative to their first parent.
+	CherryPickAndPush(upstreamRef, commit, remote, destinationRef string) error
+	// CherryPickOntoBranch cherry-picks the commits in order on top of the branch on remote and pushes the
+	// result to the branch. Only fast-forwards are allowed. Merge commits are cherry-picked relative to
+	// their first parent. Returns the SHAs of the resulting commits.
+	CherryPickOntoBranch(commits []string, remote, branch string) ([]string, error)
+	// RevertAndPush reverts commit on top of upstreamRef and force pushes the result to the destinationRef
+	// branch on remote. Merge commits are reverted relative to their first parent.
+	RevertAndPush(upstreamRef, commit, remote, destinationRef string) error
+	// Push pushes ref to the destinationRef branch on remote. Only fast-forwards are allowed. The push fails
+	// with ErrPushRejected, if destinationRef has moved on the remote, so that ref no longer contains it.
+	Push(ref, remote, destinationRef string) error
+	// ForcePush force pushes ref to the destinationRef branch on remote.
+	ForcePush(ref, remote, destinationRef string) error
 	DeleteRemoteBranch(remoteRef string) error
+	// RunCommand checks out the given ref and runs the command with `sh -c` in the repo's working tree. The
+	// variables in env are added to the command's environment. The command is killed along with the processes
+	// it started and fails with ErrTimeout, if it runs for longer than the Command timeout.
+	RunCommand(ref, command string, env []string) error
 }
 
 type ErrSquashConflict struct {
@@ -33,37 +165,294 @@ func (e *ErrSquashConflict) Error() string {
 	return fmt.Sprintf("failed to rebase with autosquash: %v", e.Err)
 }
 
+func (e *ErrSquashConflict) Unwrap() error {
+	return e.Err
+}
+
+type ErrRebaseConflict struct {
+	Err error
+}
+
+func (e *ErrRebaseConflict) Error() string {
+	return fmt.Sprintf("failed to rebase: %v", e.Err)
+}
+
+func (e *ErrRebaseConflict) Unwrap() error {
+	return e.Err
+}
+
+type ErrCherryPickConflict struct {
+	Err error
+	// Commit is the commit that failed to apply and ConflictingFiles the files it conflicted in. Only set
+	// by CherryPickOntoBranch.
+	Commit           string
+	ConflictingFiles []string
+}
+
+func (e *ErrCherryPickConflict) Error() string {
+	return fmt.Sprintf("failed to apply the commit: %v", e.Err)
+}
+
+func (e *ErrCherryPickConflict) Unwrap() error {
+	return e.Err
+}
+
+type ErrPushFailed struct {
+	Remote string
+	Err    error
+}
+
+func (e *ErrPushFailed) Error() string {
+	return fmt.Sprintf("failed to force push to %s: %v", e.Remote, e.Err)
+}
+
+func (e *ErrPushFailed) Unwrap() error {
+	return e.Err
+}
+
+// ErrPushRejected is returned when a rewritten branch isn't pushed, because the branch on the remote no longer
+// points to the commit that was rewritten, e.g. because someone pushed to it in the meantime. The operation can
+// be retried once the remote has been fetched again.
+type ErrPushRejected struct {
+	Remote string
+	Ref    string
+	Err    error
+}
+
+func (e *ErrPushRejected) Error() string {
+	return fmt.Sprintf("%s on %s changed while it was being rewritten: %v", e.Ref, e.Remote, e.Err)
+}
+
+func (e *ErrPushRejected) Unwrap() error {
+	return e.Err
+}
+
+// IsPushRejected reports whether the operation failed, because the branch it rewrote changed on the remote.
+func IsPushRejected(err error) bool {
+	var rejected *ErrPushRejected
+	return errors.As(err, &rejected)
+}
+
+// ErrRemoteBranchNotFound is returned when a remote branch isn't deleted, because it doesn't exist, e.g. because
+// it has already been deleted.
+type ErrRemoteBranchNotFound struct {
+	Ref string
+	Err error
+}
+
+func (e *ErrRemoteBranchNotFound) Error() string {
+	return fmt.Sprintf("remote branch %s doesn't exist: %v", e.Ref, e.Err)
+}
+
+func (e *ErrRemoteBranchNotFound) Unwrap() error {
+	return e.Err
+}
+
+// IsRemoteBranchNotFound reports whether the remote branch wasn't deleted, because it doesn't exist.
+func IsRemoteBranchNotFound(err error) bool {
+	var notFound *ErrRemoteBranchNotFound
+	return errors.As(err, &notFound)
+}
+
+// ErrTimeout is returned when a git command is killed for running longer than its timeout. The operation can be
+// retried, because the command most likely hung waiting for the remote.
+type ErrTimeout struct {
+	Command string
+	Timeout time.Duration
+}
+
+func (e *ErrTimeout) Error() string {
+	return fmt.Sprintf("%s timed out after %s", e.Command, e.Timeout)
+}
+
+// IsTimeout reports whether the operation failed, because one of its commands timed out.
+func IsTimeout(err error) bool {
+	var timeout *ErrTimeout
+	return errors.As(err, &timeout)
+}
+
+// ErrDiskFull is returned instead of cloning a repository, when the local repos already take up the disk quota.
+type ErrDiskFull struct {
+	Usage int64
+	Quota int64
+}
+
+func (e *ErrDiskFull) Error() string {
+	return fmt.Sprintf("the local repos take up %d bytes of the %d byte disk quota", e.Usage, e.Quota)
+}
+
+// ErrLFSPointers is returned instead of pushing rewritten commits that store the files Git LFS tracks as something
+// other than valid pointers, e.g. as the files' contents.
+type ErrLFSPointers struct {
+	Err error
+}
+
+func (e *ErrLFSPointers) Error() string {
+	return fmt.Sprintf("the rewritten commits have invalid Git LFS pointers: %v", e.Err)
+}
+
+func (e *ErrLFSPointers) Unwrap() error {
+	return e.Err
+}
+
+// IsDiskFull reports whether the repository wasn't cloned, because the local repos take up the disk quota.
+func IsDiskFull(err error) bool {
+	var diskFull *ErrDiskFull
+	return errors.As(err, &diskFull)
+}
+
+// minIdleBeforeEviction is how long a repo has to be idle, before it's
+// removed to free up the disk quota
+const minIdleBeforeEviction = time.Minute
+
+var tracer = otel.Tracer("github.com/salemove/github-review-helper/git")
+
+var (
+	rebaseProgressRegexp   = regexp.MustCompile(`^Rebasing \((\d+)/(\d+)\)`)
+	transferProgressRegexp = regexp.MustCompile(`^(?:Receiving|Writing) objects:\s+(\d+)%`)
+)
+
+// gitPhases maps the git commands that can take a while to the progress they
+// report before they output anything more specific.
+var gitPhases = map[string]string{
+	"clone":       "cloning",
+	"fetch":       "fetching",
+	"push":        "pushing",
+	"rebase":      "rebasing",
+	"cherry-pick": "cherry-picking",
+	"revert":      "reverting",
+}
+
 type repos struct {
+	*localRepos
+	// ctx is the parent of the spans of the commands the repos run
+	ctx context.Context
+}
+
+// localRepos is the state shared by all Repos created with WithContext.
+type localRepos struct {
 	sync.Mutex
 	basePath string
-	repos    map[string]*repo
+	// reposLock guards the repos map, so that States wouldn't have to wait
+	// for the repos' lock, which is held while fetching
+	reposLock sync.Mutex
+	repos     map[string]*localRepo
+	// cloneOptions returns the options for cloning a repository
+	cloneOptions func(repoOwner, repoName string) CloneOptions
+	// env holds the variables added to the environment of every command
+	env       []string
+	timeouts  Timeouts
+	diskQuota int64
+	// skipLFSSmudge is whether the LFS files are left as pointers
+	skipLFSSmudge bool
+	identity      Identity
+	// token returns the token for the HTTPS remotes or is nil
+	token func() (string, error)
 }
 
 // NewRepos creates a new Repos instance which will hold all its repos in the specified base path
 func NewRepos(basePath string) Repos {
+	return NewReposWithOptions(basePath, Options{})
+}
+
+// NewReposWithCloneOptions creates a new Repos instance like NewRepos, which clones every repository with the
+// options cloneOptions returns for it. The variables in env, e.g. ProxyEnv's, are added to the environment of
+// every git command and of the commands run with RunCommand.
+func NewReposWithCloneOptions(basePath string, cloneOptions func(repoOwner, repoName string) CloneOptions,
+	env ...string) Repos {
+
+	return NewReposWithOptions(basePath, Options{CloneOptions: cloneOptions, Env: env})
+}
+
+// NewReposWithOptions creates a new Repos instance like NewRepos, which clones the repositories and runs the git
+// commands as options describes.
+func NewReposWithOptions(basePath string, options Options) Repos {
+	cloneOptions := options.CloneOptions
+	if cloneOptions == nil {
+		cloneOptions = func(string, string) CloneOptions {
+			return CloneOptions{}
+		}
+	}
+	identity := options.Identity
+	if identity.Name == "" {
+		identity.Name = "github-review-helper"
+	}
+	if identity.Email == "" {
+		identity.Email = "<>"
+	}
+	// The committer is set in the environment as well, so that it would
+	// override the committer of the environment the bot runs in
+	env := append(append([]string{}, options.Env...), "GIT_COMMITTER_NAME="+identity.Name,
+		"GIT_COMMITTER_EMAIL="+identity.Email)
+	if options.SkipLFSSmudge {
+		env = append(env, "GIT_LFS_SKIP_SMUDGE=1")
+	}
 	return &repos{
-		basePath: basePath,
-		repos:    make(map[string]*repo),
+		localRepos: &localRepos{
+			basePath:      basePath,
+			repos:         make(map[string]*localRepo),
+			cloneOptions:  cloneOptions,
+			env:           env,
+			timeouts:      options.Timeouts,
+			diskQuota:     options.DiskQuota,
+			skipLFSSmudge: options.SkipLFSSmudge,
+			identity:      identity,
+			token:         options.Token,
+		},
+		ctx: context.Background(),
 	}
 }
 
+func (g *repos) WithContext(ctx context.Context) Repos {
+	return &repos{g.localRepos, ctx}
+}
+
 func (g *repos) repo(path string) *repo {
+	g.reposLock.Lock()
+	defer g.reposLock.Unlock()
+
 	existingRepo, exists := g.repos[path]
 	if !exists {
-		newRepo := &repo{path: path}
-		g.repos[path] = newRepo
-		return newRepo
+		existingRepo = &localRepo{path: path, env: g.env, timeouts: g.timeouts, token: g.token}
+		existingRepo.state.UsedAt = time.Now()
+		g.repos[path] = existingRepo
 	}
-	return existingRepo
+	return &repo{existingRepo, g.ctx}
 }
 
-func (g *repos) clone(url, localPath string) (Repo, error) {
-	if err := runWithLogging("git", "clone", url, localPath); err != nil {
-		return nil, fmt.Errorf("failed to clone: %v", err)
-	}
+func (g *repos) clone(url, localPath string, options CloneOptions) (Repo, error) {
+	// Registering the repo before cloning it, so that the clone's progress
+	// would be visible in its state
 	newRepo := g.repo(localPath)
-	if err := newRepo.configureNameEmail(); err != nil {
+	newRepo.lock("clone")
+	defer newRepo.unlock()
+
+	err := newRepo.cloneFrom(url, options.Filter)
+	if err != nil && options.Filter != "" {
+		log.Printf("Failed to clone %s with the %s filter, falling back to a full clone: %v\n", url,
+			options.Filter, err)
+		if err = os.RemoveAll(localPath); err == nil {
+			err = newRepo.cloneFrom(url, "")
+		}
+	}
+	if err != nil {
+		g.reposLock.Lock()
+		delete(g.repos, localPath)
+		g.reposLock.Unlock()
+		return nil, fmt.Errorf("failed to clone: %w", err)
+	}
+	if err := newRepo.configureNameEmail(g.identity); err != nil {
 		return nil, fmt.Errorf("failed to configure name and email: %v", err)
+	} else if err := newRepo.setUpLFS(g.skipLFSSmudge); err != nil {
+		return nil, fmt.Errorf("failed to set up Git LFS: %v", err)
+	}
+	if len(options.SparsePaths) > 0 {
+		if err := newRepo.git("sparse-checkout", "init", "--cone"); err != nil {
+			return nil, fmt.Errorf("failed to enable sparse checkout: %v", err)
+		}
+		if err := newRepo.git(append([]string{"sparse-checkout", "set"}, options.SparsePaths...)...); err != nil {
+			return nil, fmt.Errorf("failed to set the sparse checkout paths: %v", err)
+		}
 	}
 	return newRepo, nil
 }
@@ -78,8 +467,16 @@ func (g *repos) GetUpdatedRepo(url, repoOwner, repoName string) (Repo, error) {
 		return nil, fmt.Errorf("failed to check if the repo exists locally: %v", err)
 	}
 	if !exists {
+		if g.diskQuota > 0 {
+			usage, err := dirSize(g.basePath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to measure the disk usage of the local repos: %v", err)
+			} else if usage >= g.diskQuota {
+				return nil, &ErrDiskFull{Usage: usage, Quota: g.diskQuota}
+			}
+		}
 		log.Printf("Cloning %s into %s\n", url, localPath)
-		return g.clone(url, localPath)
+		return g.clone(url, localPath, g.cloneOptions(repoOwner, repoName))
 	}
 
 	log.Printf("Fetching latest changes for %s\n", url)
@@ -88,6 +485,119 @@ func (g *repos) GetUpdatedRepo(url, repoOwner, repoName string) (Repo, error) {
 	return repo, err
 }
 
+func (g *repos) PruneStaleRefs() error {
+	// Each repo is only locked while it's being pruned, so that the other
+	// repos can be used in the meantime
+	g.reposLock.Lock()
+	localRepos := make([]*localRepo, 0, len(g.repos))
+	for _, localRepo := range g.repos {
+		localRepos = append(localRepos, localRepo)
+	}
+	g.reposLock.Unlock()
+
+	var firstErr error
+	for _, localRepo := range localRepos {
+		repo := &repo{localRepo, g.ctx}
+		if err := repo.pruneStaleRefs(); err != nil {
+			err = fmt.Errorf("failed to prune stale refs in %s: %v", localRepo.path, err)
+			log.Println(err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+func (g *repos) RemoveIdleRepos(maxIdle time.Duration) ([]string, error) {
+	g.Lock()
+	defer g.Unlock()
+
+	g.reposLock.Lock()
+	candidates := make([]*localRepo, 0, len(g.repos))
+	for _, repo := range g.repos {
+		candidates = append(candidates, repo)
+	}
+	g.reposLock.Unlock()
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].currentState().UsedAt.Before(candidates[j].currentState().UsedAt)
+	})
+
+	var usage int64
+	if g.diskQuota > 0 {
+		var err error
+		if usage, err = dirSize(g.basePath); err != nil {
+			return nil, fmt.Errorf("failed to measure the disk usage of the local repos: %v", err)
+		}
+	}
+	var (
+		removed  []string
+		firstErr error
+	)
+	for _, repo := range candidates {
+		idle := time.Since(repo.currentState().UsedAt)
+		overQuota := g.diskQuota > 0 && usage > g.diskQuota && idle >= minIdleBeforeEviction
+		if !overQuota && (maxIdle == 0 || idle < maxIdle) {
+			continue
+		}
+		// Busy repos are kept, because their operations are using them
+		if !repo.TryLock() {
+			continue
+		}
+		size, err := dirSize(repo.path)
+		if err == nil {
+			err = os.RemoveAll(repo.path)
+		}
+		if err == nil {
+			g.reposLock.Lock()
+			delete(g.repos, repo.path)
+			g.reposLock.Unlock()
+		}
+		repo.Unlock()
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("failed to remove %s: %v", repo.path, err)
+			}
+			continue
+		}
+		usage -= size
+		removed = append(removed, repo.path)
+	}
+	return removed, firstErr
+}
+
+// dirSize returns the total size of the files in the directory. A directory
+// that doesn't exist takes up no space.
+func dirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+func (g *repos) States() []RepoState {
+	g.reposLock.Lock()
+	defer g.reposLock.Unlock()
+
+	states := make([]RepoState, 0, len(g.repos))
+	for _, repo := range g.repos {
+		states = append(states, repo.currentState())
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Path < states[j].Path
+	})
+	return states
+}
+
 func exists(path string) (bool, error) {
 	_, err := os.Stat(path)
 	if os.IsNotExist(err) {
@@ -99,30 +609,354 @@ func exists(path string) (bool, error) {
 }
 
 type repo struct {
+	*localRepo
+	// ctx is the parent of the spans of the commands the repo runs
+	ctx context.Context
+}
+
+// localRepo is the state shared by all instances of a local repo.
+type localRepo struct {
 	sync.Mutex
-	path string
+	path     string
+	env      []string
+	timeouts Timeouts
+	token    func() (string, error)
+
+	stateLock sync.Mutex
+	state     RepoState
 }
 
-func (r *repo) AutosquashAndPush(upstreamRef, branchRef, destinationRef string) error {
+// lock acquires the repo's lock for the named operation and records the
+// operation for diagnostics.
+func (r *localRepo) lock(operation string) {
+	r.updateState(func(state *RepoState) {
+		state.Waiting++
+	})
 	r.Lock()
-	defer r.Unlock()
+	r.updateState(func(state *RepoState) {
+		state.Waiting--
+		state.Operation = operation
+		state.LockedAt = time.Now()
+	})
+}
+
+func (r *localRepo) unlock() {
+	r.updateState(func(state *RepoState) {
+		state.Operation = ""
+		state.LockedAt = time.Time{}
+		state.Command = ""
+		state.CommandStartedAt = time.Time{}
+		state.Progress = ""
+		state.UsedAt = time.Now()
+	})
+	r.Unlock()
+}
+
+func (r *localRepo) updateState(update func(*RepoState)) {
+	r.stateLock.Lock()
+	defer r.stateLock.Unlock()
+	update(&r.state)
+}
 
+func (r *localRepo) currentState() RepoState {
+	r.stateLock.Lock()
+	defer r.stateLock.Unlock()
+	state := r.state
+	state.Path = r.path
+	return state
+}
+
+// startCommand records the command the repo's current operation is running
+// and starts a span for it.
+func (r *repo) startCommand(name string, args []string) trace.Span {
+	r.updateState(func(state *RepoState) {
+		state.Command = strings.Join(append([]string{name}, args...), " ")
+		state.CommandStartedAt = time.Now()
+		state.Progress = ""
+		if name == "git" && len(args) > 0 {
+			state.Progress = gitPhases[args[0]]
+		}
+	})
+	return startCommandSpan(r.ctx, r.path, name, args)
+}
+
+func startCommandSpan(ctx context.Context, path, name string, args []string) trace.Span {
+	spanName := name
+	if len(args) > 0 {
+		spanName += " " + args[0]
+	}
+	_, span := tracer.Start(ctx, spanName, trace.WithAttributes(
+		attribute.String("git.repo.path", path),
+		attribute.StringSlice("process.command_args", append([]string{name}, args...)),
+	))
+	return span
+}
+
+func endCommandSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (r *repo) AutosquashAndPush(upstreamRef, branchRef, remote, destinationRef string) error {
+	r.lock("autosquash and push")
+	defer r.unlock()
+
+	expected, err := r.output("rev-parse", branchRef+"^{commit}")
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %v", branchRef, err)
+	}
 	if err := r.rebaseAutosquash(upstreamRef, branchRef); err != nil {
 		return err
 	}
-	return r.forcePushHeadTo(destinationRef)
+	return r.forcePushHeadWithLease(upstreamRef, remote, destinationRef, expected)
+}
+
+func (r *repo) SquashAndPush(upstreamRef, branchRef string, count int, message, remote,
+	destinationRef string) error {
+
+	r.lock("squash and push")
+	defer r.unlock()
+
+	if err := r.git("checkout", "--detach", branchRef); err != nil {
+		return fmt.Errorf("failed to check out %s: %v", branchRef, err)
+	}
+	expected, err := r.output("rev-parse", "HEAD")
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %v", branchRef, err)
+	}
+	base := "HEAD~" + strconv.Itoa(count)
+	if count == 0 {
+		mergeBase, err := r.output("merge-base", upstreamRef, "HEAD")
+		if err != nil {
+			return fmt.Errorf("failed to find where %s branched off %s: %v", branchRef, upstreamRef, err)
+		}
+		base = mergeBase
+	}
+	commits, err := r.output("rev-list", "--reverse", base+"..HEAD")
+	if err != nil {
+		return fmt.Errorf("failed to list the commits to squash: %v", err)
+	} else if commits == "" {
+		return fmt.Errorf("%s has no commits to squash", branchRef)
+	}
+	oldest := strings.SplitN(commits, "\n", 2)[0]
+	commitArgs := []string{"commit", "--allow-empty", "--reuse-message=" + oldest}
+	if message != "" {
+		author, err := r.output("log", "-1", "--format=%an <%ae>", oldest)
+		if err != nil {
+			return fmt.Errorf("failed to get the author of %s: %v", oldest, err)
+		}
+		commitArgs = []string{"commit", "--allow-empty", "--author=" + author, "--message=" + message}
+	}
+	if err = r.git("reset", "--soft", base); err != nil {
+		return fmt.Errorf("failed to reset to %s: %v", base, err)
+	} else if err = r.git(commitArgs...); err != nil {
+		return fmt.Errorf("failed to commit the squashed changes: %v", err)
+	}
+	return r.forcePushHeadWithLease(upstreamRef, remote, destinationRef, expected)
+}
+
+func (r *repo) RebaseAndPush(upstreamRef, branchRef, remote, destinationRef string) (string, error) {
+	r.lock("rebase and push")
+	defer r.unlock()
+
+	if err := r.git("rebase", upstreamRef, branchRef); err != nil {
+		err = &ErrRebaseConflict{err}
+		log.Println(err, " Trying to clean up.")
+		if cleanupErr := r.git("rebase", "--abort"); cleanupErr != nil {
+			log.Println("Also failed to clean up after the failed rebase: ", cleanupErr)
+		}
+		return "", err
+	}
+	sha, err := r.output("rev-parse", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve the rebased HEAD: %v", err)
+	}
+	// The destination branch usually doesn't exist yet and the detached
+	// HEAD doesn't tell git what kind of a ref to create
+	return sha, r.forcePushHeadTo(upstreamRef, remote, "refs/heads/"+destinationRef)
+}
+
+func (r *repo) RebaseOntoAndPush(upstreamRef, oldBaseRef, branchRef, remote, destinationRef string) (string,
+	error) {
+
+	r.lock("rebase onto and push")
+	defer r.unlock()
+
+	expected, err := r.output("rev-parse", branchRef)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %v", branchRef, err)
+	}
+	if err = r.git("rebase", "--onto", upstreamRef, oldBaseRef, branchRef); err != nil {
+		err = &ErrRebaseConflict{err}
+		log.Println(err, " Trying to clean up.")
+		if cleanupErr := r.git("rebase", "--abort"); cleanupErr != nil {
+			log.Println("Also failed to clean up after the failed rebase: ", cleanupErr)
+		}
+		return "", err
+	}
+	sha, err := r.output("rev-parse", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve the rebased HEAD: %v", err)
+	}
+	return sha, r.forcePushHeadWithLease(upstreamRef, remote, destinationRef, expected)
+}
+
+func (r *repo) CherryPickAndPush(upstreamRef, commit, remote, destinationRef string) error {
+	r.lock("cherry-pick and push")
+	defer r.unlock()
+
+	return r.applyAndPush("cherry-pick", upstreamRef, commit, remote, destinationRef)
+}
+
+func (r *repo) CherryPickOntoBranch(commits []string, remote, branch string) ([]string, error) {
+	r.lock("cherry-pick onto branch")
+	defer r.unlock()
+
+	upstreamRef := remote + "/" + branch
+	if err := r.git("checkout", "--detach", upstreamRef); err != nil {
+		return nil, fmt.Errorf("failed to check out %s: %v", upstreamRef, err)
+	}
+	shas := make([]string, 0, len(commits))
+	for _, commit := range commits {
+		parents, err := r.output("rev-list", "--parents", "-n", "1", commit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve the parents of %s: %v", commit, err)
+		}
+		// Recording the original commit in the message, so that it could be
+		// traced back to
+		args := []string{"cherry-pick", "-x"}
+		if len(strings.Fields(parents)) > 2 {
+			args = append(args, "-m", "1")
+		}
+		if err = r.git(append(args, commit)...); err != nil {
+			conflict := &ErrCherryPickConflict{Err: err, Commit: commit}
+			if files, diffErr := r.output("diff", "--name-only", "--diff-filter=U"); diffErr == nil && files != "" {
+				conflict.ConflictingFiles = strings.Split(files, "\n")
+			}
+			log.Println(conflict, " Trying to clean up.")
+			if cleanupErr := r.git("cherry-pick", "--abort"); cleanupErr != nil {
+				log.Printf("Also failed to clean up after the failed cherry-pick: %v\n", cleanupErr)
+			}
+			return nil, conflict
+		}
+		sha, err := r.output("rev-parse", "HEAD")
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve the cherry-picked HEAD: %v", err)
+		}
+		shas = append(shas, sha)
+	}
+	if err := r.checkLFSPointers(upstreamRef); err != nil {
+		return nil, err
+	}
+	if err := r.git("push", "--progress", remote, "@:refs/heads/"+branch); err != nil {
+		return nil, &ErrPushFailed{remote, err}
+	}
+	return shas, nil
+}
+
+func (r *repo) RevertAndPush(upstreamRef, commit, remote, destinationRef string) error {
+	r.lock("revert and push")
+	defer r.unlock()
+
+	return r.applyAndPush("revert", upstreamRef, commit, remote, destinationRef)
+}
+
+// applyAndPush runs either cherry-pick or revert for the commit on top of
+// upstreamRef and force pushes the result.
+func (r *repo) applyAndPush(operation, upstreamRef, commit, remote, destinationRef string) error {
+	if err := r.git("checkout", "--detach", upstreamRef); err != nil {
+		return fmt.Errorf("failed to check out %s: %v", upstreamRef, err)
+	}
+	parents, err := r.output("rev-list", "--parents", "-n", "1", commit)
+	if err != nil {
+		return fmt.Errorf("failed to resolve the parents of %s: %v", commit, err)
+	}
+	args := []string{operation}
+	// The first field is the commit itself
+	if len(strings.Fields(parents)) > 2 {
+		args = append(args, "-m", "1")
+	}
+	if err := r.git(append(args, commit)...); err != nil {
+		err = &ErrCherryPickConflict{Err: err}
+		log.Println(err, " Trying to clean up.")
+		if cleanupErr := r.git(operation, "--abort"); cleanupErr != nil {
+			log.Printf("Also failed to clean up after the failed %s: %v\n", operation, cleanupErr)
+		}
+		return err
+	}
+	return r.forcePushHeadTo(upstreamRef, remote, "refs/heads/"+destinationRef)
+}
+
+func (r *repo) Push(ref, remote, destinationRef string) error {
+	r.lock("push")
+	defer r.unlock()
+
+	err := r.git("push", "--progress", remote, ref+":refs/heads/"+destinationRef)
+	if err == nil {
+		return nil
+	}
+	// Telling a push that isn't a fast-forward anymore apart from the ones
+	// the remote refuses for other reasons, e.g. branch protection, which
+	// pushing again won't help with
+	if current, lsErr := r.output("ls-remote", remote, "refs/heads/"+destinationRef); lsErr == nil {
+		if fields := strings.Fields(current); len(fields) > 0 &&
+			r.git("merge-base", "--is-ancestor", fields[0], ref) != nil {
+
+			return &ErrPushRejected{Remote: remote, Ref: destinationRef, Err: err}
+		}
+	}
+	return &ErrPushFailed{remote, err}
+}
+
+func (r *repo) ForcePush(ref, remote, destinationRef string) error {
+	r.lock("force push")
+	defer r.unlock()
+
+	if err := r.git("push", "--progress", "--force", remote, ref+":refs/heads/"+destinationRef); err != nil {
+		return &ErrPushFailed{remote, err}
+	}
+	return nil
 }
 
 func (r *repo) Fetch() error {
-	r.Lock()
-	defer r.Unlock()
+	r.lock("fetch")
+	defer r.unlock()
+
+	if err := r.git("fetch", "--progress"); err != nil {
+		return fmt.Errorf("failed to fetch: %w", err)
+	}
+	return nil
+}
+
+func (r *repo) FetchRemote(name, url string) error {
+	r.lock("fetch remote")
+	defer r.unlock()
 
-	if err := r.git("fetch"); err != nil {
-		return fmt.Errorf("failed to fetch: %v", err)
+	if err := r.git("remote", "get-url", name); err != nil {
+		if err = r.git("remote", "add", name, url); err != nil {
+			return fmt.Errorf("failed to add remote %s: %v", name, err)
+		}
+	}
+	if err := r.git("fetch", "--progress", name); err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", name, err)
 	}
 	return nil
 }
 
+func (r *repo) pruneStaleRefs() error {
+	r.lock("prune stale refs")
+	defer r.unlock()
+
+	// The repo may have been removed for being idle in the meantime
+	if exists, err := exists(r.path); err != nil || !exists {
+		return err
+	}
+	return r.git("remote", "prune", "origin")
+}
+
 func (r *repo) rebaseAutosquash(upstreamRef, branchRef string) error {
 	// This makes the --interactive rebase not actually interactive
 	if err := os.Setenv("GIT_SEQUENCE_EDITOR", "true"); err != nil {
@@ -141,37 +975,271 @@ func (r *repo) rebaseAutosquash(upstreamRef, branchRef string) error {
 	return nil
 }
 
-func (r *repo) forcePushHeadTo(destinationRef string) error {
-	if err := r.git("push", "--force", "origin", "@:"+destinationRef); err != nil {
-		return fmt.Errorf("failed to force push to remote: %v", err)
+// forcePushHeadTo force pushes HEAD, which has been rewritten on top of
+// upstreamRef, to destinationRef on remote.
+func (r *repo) forcePushHeadTo(upstreamRef, remote, destinationRef string) error {
+	if err := r.checkLFSPointers(upstreamRef); err != nil {
+		return err
+	}
+	if err := r.git("push", "--progress", "--force", remote, "@:"+destinationRef); err != nil {
+		return &ErrPushFailed{remote, err}
 	}
 	return nil
 }
 
-func (r *repo) configureNameEmail() error {
-	if err := r.git("config", "user.name", "github-review-helper"); err != nil {
+// forcePushHeadWithLease force pushes HEAD, which has been rewritten on top
+// of upstreamRef, to destinationRef on remote, unless destinationRef no
+// longer points to expected. Overwriting the commits pushed since the rewrite
+// started would lose them.
+func (r *repo) forcePushHeadWithLease(upstreamRef, remote, destinationRef, expected string) error {
+	if err := r.checkLFSPointers(upstreamRef); err != nil {
+		return err
+	}
+	leasedRef := destinationRef
+	if !strings.HasPrefix(leasedRef, "refs/") {
+		leasedRef = "refs/heads/" + leasedRef
+	}
+	err := r.git("push", "--progress", "--force-with-lease="+leasedRef+":"+expected, remote, "@:"+destinationRef)
+	if err == nil {
+		return nil
+	}
+	// git's exit code doesn't tell a stale lease apart from other failures,
+	// so checking where the branch points to now
+	if current, lsErr := r.output("ls-remote", remote, leasedRef); lsErr == nil {
+		if fields := strings.Fields(current); len(fields) > 0 && fields[0] != expected {
+			return &ErrPushRejected{Remote: remote, Ref: destinationRef, Err: err}
+		}
+	}
+	return &ErrPushFailed{remote, err}
+}
+
+// cloneFrom clones url into the repo's path. The clone is partial, unless filter is empty.
+func (r *repo) cloneFrom(url, filter string) error {
+	args := []string{"clone", "--progress"}
+	if filter != "" {
+		args = append(args, "--filter="+filter)
+	}
+	args = append(args, url, r.path)
+	span := r.startCommand("git", args)
+	err := r.runGit(args, args, func(cmd *exec.Cmd) error {
+		return runCmdWithLogging("git", cmd, r.progressReporter(args))
+	})
+	endCommandSpan(span, err)
+	return err
+}
+
+func (r *repo) configureNameEmail(identity Identity) error {
+	if err := r.git("config", "user.name", identity.Name); err != nil {
 		return err
 	}
-	return r.git("config", "user.email", "<>")
+	return r.git("config", "user.email", identity.Email)
+}
+
+// setUpLFS installs Git LFS's filters and hooks in the repo, if git-lfs is
+// installed, so that the rewrites would store the files LFS tracks as
+// pointers and the pushes would upload the LFS objects. Without the files'
+// contents, the pushes have nothing to upload, but the remotes already have
+// the objects of the commits being rewritten.
+func (r *repo) setUpLFS(skipSmudge bool) error {
+	if !lfsInstalled() {
+		return nil
+	}
+	args := []string{"lfs", "install", "--local"}
+	if skipSmudge {
+		args = append(args, "--skip-smudge")
+	}
+	if err := r.git(args...); err != nil {
+		return err
+	} else if skipSmudge {
+		return r.git("config", "lfs.allowincompletepush", "true")
+	}
+	return nil
+}
+
+// checkLFSPointers checks that the commits on top of upstreamRef store the
+// files Git LFS tracks as valid pointers, so that a rewrite wouldn't replace
+// the pointers with the files' contents or corrupt them.
+func (r *repo) checkLFSPointers(upstreamRef string) error {
+	if !lfsInstalled() {
+		return nil
+	}
+	if err := r.git("lfs", "fsck", "--pointers", upstreamRef+"..HEAD"); err != nil {
+		return &ErrLFSPointers{err}
+	}
+	return nil
+}
+
+var (
+	lfsLookup sync.Once
+	hasLFS    bool
+)
+
+// lfsInstalled reports whether git-lfs is on PATH. Without it, git handles
+// the pointers like any other file, which keeps them intact.
+func lfsInstalled() bool {
+	lfsLookup.Do(func() {
+		_, err := exec.LookPath("git-lfs")
+		hasLFS = err == nil
+	})
+	return hasLFS
 }
 
 func (r *repo) git(args ...string) error {
+	span := r.startCommand("git", args)
+	allArgs := append([]string{"-C", r.path}, args...)
+	err := r.runGit(args, allArgs, func(cmd *exec.Cmd) error {
+		return runCmdWithLogging("git", cmd, r.progressReporter(args))
+	})
+	endCommandSpan(span, err)
+	return err
+}
+
+// runGit runs git with allArgs, which are args with the options preceding the
+// subcommand, and kills it, if it runs for longer than the subcommand's
+// timeout.
+func (r *repo) runGit(args, allArgs []string, run func(*exec.Cmd) error) error {
+	timeout := r.timeouts.Local
+	if isNetworkCommand(args) {
+		timeout = r.timeouts.Network
+	}
+	// Even the local commands may fetch, e.g. the missing objects of a
+	// partial clone, so they all get the token
+	if r.token != nil {
+		var err error
+		if allArgs, run, err = withToken(allArgs, run, r.token); err != nil {
+			return err
+		}
+	}
+	return r.runWithTimeout("git "+args[0], timeout, "git", allArgs, run)
+}
+
+// runWithTimeout runs the named command with args and kills it along with the
+// processes it started, if it runs for longer than timeout. The timeout is
+// reported as the description timing out. The command isn't cancelled with
+// the repo's context, which is usually the webhook's and ends when the
+// webhook is responded to, while the operations continue in the background.
+func (r *repo) runWithTimeout(description string, timeout time.Duration, name string, args []string,
+	run func(*exec.Cmd) error) error {
+
+	ctx, cancel := context.Background(), func() {}
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	defer cancel()
+
+	cmd := r.command(ctx, name, args...)
+	// Killing the command's whole process group, so that its children, e.g.
+	// git's ssh, wouldn't be left hanging and keep its output open
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = time.Second
+	err := run(cmd)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		err = &ErrTimeout{Command: description, Timeout: timeout}
+		log.Println(err)
+	}
+	return err
+}
+
+// isNetworkCommand reports whether the git command with the given arguments
+// talks to a remote.
+func isNetworkCommand(args []string) bool {
+	switch args[0] {
+	case "clone", "fetch", "push", "ls-remote":
+		return true
+	case "remote":
+		return len(args) > 1 && args[1] == "prune"
+	}
+	return false
+}
+
+// progressReporter returns a function that updates the repo's progress from
+// the lines the git command with the given arguments outputs.
+func (r *repo) progressReporter(args []string) func(string) {
+	phase := gitPhases[args[0]]
+	return func(line string) {
+		var progress string
+		if matches := rebaseProgressRegexp.FindStringSubmatch(line); matches != nil {
+			progress = fmt.Sprintf("rebasing commit %s/%s", matches[1], matches[2])
+		} else if matches := transferProgressRegexp.FindStringSubmatch(line); matches != nil && phase != "" {
+			progress = fmt.Sprintf("%s %s%%", phase, matches[1])
+		} else {
+			return
+		}
+		r.updateState(func(state *RepoState) {
+			state.Progress = progress
+		})
+	}
+}
+
+// output runs git with the given arguments and returns its trimmed stdout.
+func (r *repo) output(args ...string) (string, error) {
+	span := r.startCommand("git", args)
 	allArgs := append([]string{"-C", r.path}, args...)
-	return runWithLogging("git", allArgs...)
+	var out []byte
+	err := r.runGit(args, allArgs, func(cmd *exec.Cmd) (err error) {
+		out, err = cmd.Output()
+		return err
+	})
+	endCommandSpan(span, err)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
 }
 
 func (r *repo) DeleteRemoteBranch(remoteRef string) error {
-	r.Lock()
-	defer r.Unlock()
+	r.lock("delete remote branch")
+	defer r.unlock()
 
-	if err := runWithLogging("git", "-C", r.path, "push", "origin", "--delete", remoteRef); err != nil {
+	if err := r.git("push", "origin", "--delete", remoteRef); err != nil {
+		// The push fails the same way for any reason, so checking whether the
+		// branch is still there
+		if current, lsErr := r.output("ls-remote", "origin", "refs/heads/"+remoteRef); lsErr == nil &&
+			strings.TrimSpace(current) == "" {
+
+			return &ErrRemoteBranchNotFound{Ref: remoteRef, Err: err}
+		}
 		return fmt.Errorf("failed to remove remote branch %s: %v", remoteRef, err)
 	}
 	return nil
 }
 
-func runWithLogging(name string, args ...string) error {
-	cmd := exec.Command(name, args...)
+func (r *repo) RunCommand(ref, command string, env []string) error {
+	r.lock("run command")
+	defer r.unlock()
+
+	if err := r.git("checkout", "--detach", ref); err != nil {
+		return fmt.Errorf("failed to check out %s: %v", ref, err)
+	}
+	args := []string{"-c", command}
+	span := r.startCommand("sh", args)
+	err := r.runWithTimeout("sh", r.timeouts.Command, "sh", args, func(cmd *exec.Cmd) error {
+		cmd.Dir = r.path
+		cmd.Env = append(cmd.Env, env...)
+		return runCmdWithLogging("sh", cmd, nil)
+	})
+	endCommandSpan(span, err)
+	if err != nil {
+		return fmt.Errorf("failed to run %q: %w", command, err)
+	}
+	return nil
+}
+
+// command creates a command with the repos' variables added to its environment.
+// The command is killed when ctx is done.
+func (r *repo) command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), r.env...)
+	return cmd
+}
+
+// runCmdWithLogging runs the command and logs its output. If progress isn't
+// nil, then it's called with every line of the output, including the progress
+// updates that end with a carriage return. These aren't logged.
+func runCmdWithLogging(name string, cmd *exec.Cmd, progress func(string)) error {
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return err
@@ -186,8 +1254,17 @@ func runWithLogging(name string, args ...string) error {
 	}
 
 	scanner := bufio.NewScanner(io.MultiReader(stdout, stderr))
+	scanner.Split(scanOutputLines)
 	for scanner.Scan() {
-		log.Printf("%s: %s\n", name, scanner.Text())
+		line := scanner.Text()
+		isProgressUpdate := strings.HasSuffix(line, "\r")
+		line = strings.TrimRight(line, "\r\n")
+		if progress != nil {
+			progress(line)
+		}
+		if !isProgressUpdate && line != "" {
+			log.Printf("%s: %s\n", name, line)
+		}
 	}
 	if err := scanner.Err(); err != nil {
 		log.Printf("error reading %s's stdout/stderr: %s\n", name, err)
@@ -198,3 +1275,15 @@ func runWithLogging(name string, args ...string) error {
 	}
 	return nil
 }
+
+// scanOutputLines is a bufio.SplitFunc that splits the output on both
+// newlines and carriage returns and keeps the line endings, so that progress
+// updates could be told apart from the rest of the output.
+func scanOutputLines(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i+1], nil
+	} else if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,37 @@
+package git_test
+
+import (
+	"testing"
+
+	"github.com/salemove/github-review-helper/git"
+)
+
+func TestRevertAndPush_identity(t *testing.T) {
+	skipWithoutGit(t)
+
+	testRepoGit, testRepoDir, cleanup := createTestRepo(t)
+	defer cleanup()
+	createFile(t, testRepoDir, foo)
+	testRepoGit("add", foo.Name)
+	testRepoGit("commit", "-m", "Add foo")
+
+	reposDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	gitRepos := git.NewReposWithOptions(reposDir, git.Options{
+		Identity: git.Identity{Name: "review-bot", Email: "1+review-bot@users.noreply.github.com"},
+	})
+	repo, err := gitRepos.GetUpdatedRepo(testRepoDir, "my", "test-repo")
+	checkError(t, err)
+
+	err = repo.RevertAndPush("origin/master", "origin/master", "origin", "revert")
+	checkError(t, err)
+
+	expected := "review-bot <1+review-bot@users.noreply.github.com>"
+	if author := testRepoGit("log", "-1", "--format=%an <%ae>", "revert"); author != expected {
+		t.Errorf("Expected the revert to be authored by %s, got %s", expected, author)
+	}
+	if committer := testRepoGit("log", "-1", "--format=%cn <%ce>", "revert"); committer != expected {
+		t.Errorf("Expected the revert to be committed by %s, got %s", expected, committer)
+	}
+}
@@ -0,0 +1,52 @@
+package git_test
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/salemove/github-review-helper/git"
+)
+
+func skipWithoutLFS(t *testing.T) {
+	skipWithoutGit(t)
+	if _, err := exec.LookPath("git-lfs"); err != nil {
+		t.Skip("Could not find git-lfs on PATH")
+	}
+}
+
+func TestAutosquashAndPush_lfs(t *testing.T) {
+	skipWithoutLFS(t)
+
+	testRepoGit, testRepoDir, cleanup := createTestRepo(t)
+	defer cleanup()
+	testRepoGit("lfs", "install", "--local")
+	testRepoGit("lfs", "track", "*.bin")
+	testRepoGit("add", ".gitattributes")
+	testRepoGit("commit", "-m", "Track binaries with LFS")
+
+	testRepoGit("checkout", "-b", "feature")
+	binary := file{Name: "image.bin", Contents: "binary contents\n"}
+	createFile(t, testRepoDir, binary)
+	testRepoGit("add", binary.Name)
+	testRepoGit("commit", "-m", "Add the image")
+	createFile(t, testRepoDir, foo)
+	testRepoGit("add", foo.Name)
+	testRepoGit("commit", "--fixup=@")
+	testRepoGit("checkout", "master")
+
+	reposDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	gitRepos := git.NewReposWithOptions(reposDir, git.Options{SkipLFSSmudge: true})
+	repo, err := gitRepos.GetUpdatedRepo(testRepoDir, "my", "test-repo")
+	checkError(t, err)
+
+	err = repo.AutosquashAndPush("origin/master", "origin/feature", "origin", "feature")
+	checkError(t, err)
+
+	stored := testRepoGit("cat-file", "-p", "feature:"+binary.Name)
+	if !strings.HasPrefix(stored, "version https://git-lfs.github.com/spec/v1") {
+		t.Fatalf("Expected %s to be stored as an LFS pointer, got %q", binary.Name, stored)
+	}
+}
@@ -0,0 +1,62 @@
+package git_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/salemove/github-review-helper/git"
+)
+
+func TestPartialClone(t *testing.T) {
+	skipWithoutGit(t)
+
+	testRepoGit, testRepoDir, cleanup := createTestRepo(t)
+	defer cleanup()
+	// Local clones ignore filters, unless they go through the file:// protocol
+	// and the repository allows them
+	testRepoGit("config", "uploadpack.allowFilter", "true")
+	for _, dir := range []string{"docs", "src"} {
+		checkError(t, os.Mkdir(filepath.Join(testRepoDir, dir), 0755))
+		createFile(t, filepath.Join(testRepoDir, dir), foo)
+		testRepoGit("add", filepath.Join(dir, foo.Name))
+	}
+	testRepoGit("commit", "-m", "Add docs and src")
+
+	reposDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	gitRepos := git.NewReposWithCloneOptions(reposDir, func(repoOwner, repoName string) git.CloneOptions {
+		return git.CloneOptions{Filter: "blob:none", SparsePaths: []string{"docs"}}
+	})
+	_, err := gitRepos.GetUpdatedRepo("file://"+testRepoDir, "my", "test-repo")
+	checkError(t, err)
+	clonePath := filepath.Join(reposDir, "my", "test-repo")
+	cloneGit := gitForPath(t, clonePath)
+
+	if promisor := cloneGit("config", "remote.origin.promisor"); promisor != "true" {
+		t.Fatalf("Expected a partial clone, but remote.origin.promisor is %q", promisor)
+	}
+	checkFile(t, filepath.Join(clonePath, "docs"), foo)
+	if _, err := os.Stat(filepath.Join(clonePath, "src")); !os.IsNotExist(err) {
+		t.Fatalf("Expected src to be left out of the sparse checkout, but got %v", err)
+	}
+}
+
+func TestPartialClone_fallback(t *testing.T) {
+	skipWithoutGit(t)
+
+	_, testRepoDir, cleanup := createTestRepo(t)
+	defer cleanup()
+
+	reposDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	gitRepos := git.NewReposWithCloneOptions(reposDir, func(repoOwner, repoName string) git.CloneOptions {
+		return git.CloneOptions{Filter: "unsupported:filter"}
+	})
+	_, err := gitRepos.GetUpdatedRepo("file://"+testRepoDir, "my", "test-repo")
+	checkError(t, err)
+
+	checkFile(t, filepath.Join(reposDir, "my", "test-repo"), readme)
+}
@@ -0,0 +1,36 @@
+package git_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/salemove/github-review-helper/git"
+)
+
+func TestPruneStaleRefs(t *testing.T) {
+	skipWithoutGit(t)
+
+	testRepoGit, testRepoDir, cleanup := createTestRepo(t)
+	defer cleanup()
+
+	featureBranchName := "feature"
+	testRepoGit("branch", featureBranchName)
+
+	reposDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	gitRepos := git.NewRepos(reposDir)
+	_, err := gitRepos.GetUpdatedRepo(testRepoDir, "my", "test-repo")
+	checkError(t, err)
+	cloneGit := gitForPath(t, filepath.Join(reposDir, "my", "test-repo"))
+
+	testRepoGit("branch", "-D", featureBranchName)
+	err = gitRepos.PruneStaleRefs()
+	checkError(t, err)
+
+	remoteBranches := cloneGit("for-each-ref", "--format=%(refname:short)", "refs/remotes/origin/")
+	if strings.Contains(remoteBranches, featureBranchName) {
+		t.Fatalf("Expected origin/%s to be pruned, but found: %s", featureBranchName, remoteBranches)
+	}
+}
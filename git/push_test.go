@@ -0,0 +1,59 @@
+package git_test
+
+import (
+	"testing"
+
+	"github.com/salemove/github-review-helper/git"
+)
+
+func TestPush_branchMoved(t *testing.T) {
+	skipWithoutGit(t)
+
+	testRepoGit, testRepoDir, cleanup := createTestRepo(t)
+	defer cleanup()
+
+	testRepoGit("checkout", "-b", "feature")
+	createFile(t, testRepoDir, foo)
+	testRepoGit("add", foo.Name)
+	testRepoGit("commit", "-m", "Add foo")
+	testRepoGit("checkout", "-b", "release", "master")
+
+	repo, cleanup := cloneTestRepo(t, testRepoDir)
+	defer cleanup()
+
+	// The release branch moves on after it has been fetched
+	createFile(t, testRepoDir, bar)
+	testRepoGit("add", bar.Name)
+	testRepoGit("commit", "-m", "Add bar")
+	testRepoGit("checkout", "master")
+
+	err := repo.Push("origin/feature", "origin", "release")
+	if !git.IsPushRejected(err) {
+		t.Fatalf("Expected the push to be rejected, but got %v", err)
+	}
+}
+
+func TestPush_refused(t *testing.T) {
+	skipWithoutGit(t)
+
+	testRepoGit, testRepoDir, cleanup := createTestRepo(t)
+	defer cleanup()
+
+	testRepoGit("checkout", "-b", "feature")
+	createFile(t, testRepoDir, foo)
+	testRepoGit("add", foo.Name)
+	testRepoGit("commit", "-m", "Add foo")
+	testRepoGit("checkout", "master")
+
+	repo, cleanup := cloneTestRepo(t, testRepoDir)
+	defer cleanup()
+
+	// The remote refuses to update its checked out branch, even though the
+	// push is a fast-forward
+	err := repo.Push("origin/feature", "origin", "master")
+	if err == nil {
+		t.Fatal("Expected the push to fail")
+	} else if git.IsPushRejected(err) {
+		t.Fatalf("Expected the push to fail for another reason than the branch moving, but got %v", err)
+	}
+}
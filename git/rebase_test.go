@@ -0,0 +1,116 @@
+package git_test
+
+import (
+	"testing"
+
+	"github.com/salemove/github-review-helper/git"
+)
+
+func TestRebaseAndPush(t *testing.T) {
+	skipWithoutGit(t)
+
+	testRepoGit, testRepoDir, cleanup := createTestRepo(t)
+	defer cleanup()
+
+	featureBranchName := "feature"
+	testRepoGit("checkout", "-b", featureBranchName)
+	createFile(t, testRepoDir, foo)
+	testRepoGit("add", foo.Name)
+	testRepoGit("commit", "-m", "Add foo")
+
+	testRepoGit("checkout", "master")
+	createFile(t, testRepoDir, bar)
+	testRepoGit("add", bar.Name)
+	testRepoGit("commit", "-m", "Add bar")
+
+	repo, cleanup := cloneTestRepo(t, testRepoDir)
+	defer cleanup()
+
+	validationBranchName := "validation"
+	sha, err := repo.RebaseAndPush("origin/master", "origin/"+featureBranchName, "origin", validationBranchName)
+	checkError(t, err)
+
+	validationSHA := testRepoGit("rev-parse", validationBranchName)
+	if sha != validationSHA {
+		t.Fatalf("Expected the rebased commit %s to be pushed, but %s was", sha, validationSHA)
+	}
+	parentSHA := testRepoGit("rev-parse", validationBranchName+"^")
+	if masterSHA := testRepoGit("rev-parse", "master"); parentSHA != masterSHA {
+		t.Fatalf("Expected the rebased commit to be on top of master (%s), but its parent is %s", masterSHA,
+			parentSHA)
+	}
+
+	// The validated commit can be fast-forwarded to. Git doesn't allow
+	// pushing onto the branch that's currently checked out.
+	testRepoGit("checkout", featureBranchName)
+	err = repo.Push(sha, "origin", "master")
+	checkError(t, err)
+	if masterSHA := testRepoGit("rev-parse", "master"); masterSHA != sha {
+		t.Fatalf("Expected master to be fast-forwarded to %s, but it's at %s", sha, masterSHA)
+	}
+}
+
+func TestRebaseAndPush_conflict(t *testing.T) {
+	skipWithoutGit(t)
+
+	testRepoGit, testRepoDir, cleanup := createTestRepo(t)
+	defer cleanup()
+
+	featureBranchName := "feature"
+	testRepoGit("checkout", "-b", featureBranchName)
+	createFile(t, testRepoDir, foo)
+	testRepoGit("add", foo.Name)
+	testRepoGit("commit", "-m", "Add foo")
+
+	testRepoGit("checkout", "master")
+	createFile(t, testRepoDir, file{Name: foo.Name, Contents: "conflicting"})
+	testRepoGit("add", foo.Name)
+	testRepoGit("commit", "-m", "Add another foo")
+
+	repo, cleanup := cloneTestRepo(t, testRepoDir)
+	defer cleanup()
+
+	_, err := repo.RebaseAndPush("origin/master", "origin/"+featureBranchName, "origin", "validation")
+	if _, ok := err.(*git.ErrRebaseConflict); !ok {
+		t.Fatalf("Expected a rebase conflict, but got: %v", err)
+	}
+}
+
+func TestRebaseOntoAndPush(t *testing.T) {
+	skipWithoutGit(t)
+
+	testRepoGit, testRepoDir, cleanup := createTestRepo(t)
+	defer cleanup()
+
+	testRepoGit("checkout", "-b", "parent")
+	createFile(t, testRepoDir, foo)
+	testRepoGit("add", foo.Name)
+	testRepoGit("commit", "-m", "Add foo")
+	parentSHA := testRepoGit("rev-parse", "HEAD")
+
+	testRepoGit("checkout", "-b", "child")
+	createFile(t, testRepoDir, bar)
+	testRepoGit("add", bar.Name)
+	testRepoGit("commit", "-m", "Add bar")
+
+	// The parent was squash merged with changes of its own, so rebasing its
+	// commit onto master would conflict
+	testRepoGit("checkout", "master")
+	createFile(t, testRepoDir, file{Name: foo.Name, Contents: "squashed foo\n"})
+	testRepoGit("add", foo.Name)
+	testRepoGit("commit", "-m", "Add foo (#1)")
+
+	repo, cleanup := cloneTestRepo(t, testRepoDir)
+	defer cleanup()
+
+	sha, err := repo.RebaseOntoAndPush("origin/master", parentSHA, "origin/child", "origin", "child")
+	checkError(t, err)
+
+	if childSHA := testRepoGit("rev-parse", "child"); sha != childSHA {
+		t.Fatalf("Expected the rebased commit %s to be pushed, but %s was", sha, childSHA)
+	}
+	parent := testRepoGit("rev-parse", "child^")
+	if masterSHA := testRepoGit("rev-parse", "master"); parent != masterSHA {
+		t.Fatalf("Expected the child's commit to be on top of master (%s), but its parent is %s", masterSHA, parent)
+	}
+}
@@ -0,0 +1,44 @@
+package git_test
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRunCommand(t *testing.T) {
+	skipWithoutGit(t)
+
+	_, testRepoDir, cleanup := createTestRepo(t)
+	defer cleanup()
+
+	repo, cleanup := cloneTestRepo(t, testRepoDir)
+	defer cleanup()
+
+	outputDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	// The command runs in the working tree of the clone, so README.md has to
+	// be available through a relative path.
+	command := "cp " + readme.Name + " " + filepath.Join(outputDir, readme.Name) +
+		" && echo \"$GREETING\" > " + filepath.Join(outputDir, foo.Name)
+	err := repo.RunCommand("origin/master", command, []string{"GREETING=foo"})
+	checkError(t, err)
+
+	checkFile(t, outputDir, readme)
+	checkFile(t, outputDir, foo)
+}
+
+func TestRunCommand_failure(t *testing.T) {
+	skipWithoutGit(t)
+
+	_, testRepoDir, cleanup := createTestRepo(t)
+	defer cleanup()
+
+	repo, cleanup := cloneTestRepo(t, testRepoDir)
+	defer cleanup()
+
+	err := repo.RunCommand("origin/master", "exit 1", nil)
+	if err == nil {
+		t.Fatal("Expected a failing command to return an error")
+	}
+}
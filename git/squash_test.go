@@ -1,6 +1,10 @@
 package git_test
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/salemove/github-review-helper/git"
+)
 
 func TestSquash(t *testing.T) {
 	skipWithoutGit(t)
@@ -28,7 +32,7 @@ func TestSquash(t *testing.T) {
 	repo, cleanup := cloneTestRepo(t, testRepoDir)
 	defer cleanup()
 
-	err := repo.AutosquashAndPush("origin/master", "origin/"+featureBranchName, featureBranchName)
+	err := repo.AutosquashAndPush("origin/master", "origin/"+featureBranchName, "origin", featureBranchName)
 	checkError(t, err)
 
 	// Check that all files still exist in the feature branch and that the
@@ -48,3 +52,93 @@ func TestSquash(t *testing.T) {
 		)
 	}
 }
+
+func TestSquashAndPush(t *testing.T) {
+	skipWithoutGit(t)
+
+	testRepoGit, testRepoDir, cleanup := createTestRepo(t)
+	defer cleanup()
+
+	featureBranchName := "feature"
+	testRepoGit("checkout", "-b", featureBranchName)
+
+	createFile(t, testRepoDir, foo)
+	testRepoGit("add", foo.Name)
+	testRepoGit("commit", "-m", "Add foo")
+
+	createFile(t, testRepoDir, bar)
+	testRepoGit("add", bar.Name)
+	testRepoGit("commit", "-m", "Add bar")
+
+	createFile(t, testRepoDir, file{Name: bar.Name, Contents: "baz\n"})
+	testRepoGit("commit", "-am", "Change bar")
+	testRepoGit("checkout", "master")
+
+	repo, cleanup := cloneTestRepo(t, testRepoDir)
+	defer cleanup()
+
+	err := repo.SquashAndPush("origin/master", "origin/"+featureBranchName, 2, "", "origin", featureBranchName)
+	checkError(t, err)
+
+	commitMessages := testRepoGit("log", "--format=%s", "master.."+featureBranchName)
+	if commitMessages != "Add bar\nAdd foo" {
+		t.Fatalf("Expected the last 2 commits to be squashed into \"Add bar\", but got %q", commitMessages)
+	}
+
+	err = repo.SquashAndPush("origin/master", "origin/"+featureBranchName, 0, "Add foo and bar", "origin",
+		featureBranchName)
+	checkError(t, err)
+
+	commitMessages = testRepoGit("log", "--format=%s", "master.."+featureBranchName)
+	if commitMessages != "Add foo and bar" {
+		t.Fatalf("Expected all commits to be squashed into \"Add foo and bar\", but got %q", commitMessages)
+	}
+	testRepoGit("checkout", featureBranchName)
+	checkFile(t, testRepoDir, foo)
+	checkFile(t, testRepoDir, file{Name: bar.Name, Contents: "baz\n"})
+}
+
+func TestAutosquashAndPush_branchChanged(t *testing.T) {
+	skipWithoutGit(t)
+
+	testRepoGit, testRepoDir, cleanup := createTestRepo(t)
+	defer cleanup()
+
+	featureBranchName := "feature"
+	testRepoGit("checkout", "-b", featureBranchName)
+
+	createFile(t, testRepoDir, foo)
+	testRepoGit("add", foo.Name)
+	testRepoGit("commit", "-m", "Add foo")
+	createFile(t, testRepoDir, file{Name: foo.Name, Contents: "fixed foo\n"})
+	testRepoGit("commit", "-a", "--fixup=@")
+	testRepoGit("checkout", "master")
+
+	repo, cleanup := cloneTestRepo(t, testRepoDir)
+	defer cleanup()
+
+	// Someone pushes to the branch after it has been fetched
+	testRepoGit("checkout", featureBranchName)
+	createFile(t, testRepoDir, bar)
+	testRepoGit("add", bar.Name)
+	testRepoGit("commit", "-m", "Add bar")
+	testRepoGit("checkout", "master")
+	pushedHead := testRepoGit("rev-parse", featureBranchName)
+
+	err := repo.AutosquashAndPush("origin/master", "origin/"+featureBranchName, "origin", featureBranchName)
+	if !git.IsPushRejected(err) {
+		t.Fatalf("Expected the push to be rejected, but got %v", err)
+	}
+	if head := testRepoGit("rev-parse", featureBranchName); head != pushedHead {
+		t.Fatalf("Expected %s to still point to %s, but got %s", featureBranchName, pushedHead, head)
+	}
+
+	checkError(t, repo.Fetch())
+	err = repo.AutosquashAndPush("origin/master", "origin/"+featureBranchName, "origin", featureBranchName)
+	checkError(t, err)
+
+	commitMessages := testRepoGit("log", "--format=%s", "master.."+featureBranchName)
+	if commitMessages != "Add bar\nAdd foo" {
+		t.Fatalf("Expected the fixup to be squashed on top of the new head, but got %q", commitMessages)
+	}
+}
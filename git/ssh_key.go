@@ -0,0 +1,24 @@
+package git
+
+import "strings"
+
+const sshCommandVariable = "GIT_SSH_COMMAND="
+
+// SSHKeyEnv returns env with the variable that makes git authenticate to SSH remotes with only the private key at
+// keyPath. The key is added to the SSH command env already sets, e.g. ProxyEnv's, if it sets one.
+func SSHKeyEnv(env []string, keyPath string) []string {
+	keyOptions := "-i " + shellQuote(keyPath) + " -o IdentitiesOnly=yes"
+	result := make([]string, 0, len(env)+1)
+	found := false
+	for _, variable := range env {
+		if strings.HasPrefix(variable, sshCommandVariable) {
+			variable += " " + keyOptions
+			found = true
+		}
+		result = append(result, variable)
+	}
+	if !found {
+		result = append(result, sshCommandVariable+"ssh "+keyOptions)
+	}
+	return result
+}
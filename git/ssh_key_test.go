@@ -0,0 +1,26 @@
+package git_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/salemove/github-review-helper/git"
+)
+
+func TestSSHKeyEnv(t *testing.T) {
+	env := git.SSHKeyEnv([]string{"GREETING=foo"}, "/keys/salemove")
+
+	expected := []string{"GREETING=foo", "GIT_SSH_COMMAND=ssh -i '/keys/salemove' -o IdentitiesOnly=yes"}
+	if !reflect.DeepEqual(env, expected) {
+		t.Errorf("Expected %q, got %q", expected, env)
+	}
+}
+
+func TestSSHKeyEnv_withSSHCommand(t *testing.T) {
+	env := git.SSHKeyEnv([]string{"GIT_SSH_COMMAND=ssh -o 'ProxyCommand=socat'"}, "/keys/salemove")
+
+	expected := []string{"GIT_SSH_COMMAND=ssh -o 'ProxyCommand=socat' -i '/keys/salemove' -o IdentitiesOnly=yes"}
+	if !reflect.DeepEqual(env, expected) {
+		t.Errorf("Expected %q, got %q", expected, env)
+	}
+}
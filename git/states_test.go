@@ -0,0 +1,89 @@
+package git_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/salemove/github-review-helper/git"
+)
+
+func TestStates(t *testing.T) {
+	skipWithoutGit(t)
+
+	_, testRepoDir, cleanup := createTestRepo(t)
+	defer cleanup()
+
+	reposDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	gitRepos := git.NewRepos(reposDir)
+	_, err := gitRepos.GetUpdatedRepo(testRepoDir, "my", "test-repo")
+	checkError(t, err)
+
+	states := gitRepos.States()
+	if len(states) != 1 {
+		t.Fatalf("Expected the state of 1 repo, but got %d", len(states))
+	}
+	expectedPath := filepath.Join(reposDir, "my", "test-repo")
+	if states[0].Path != expectedPath {
+		t.Fatalf("Expected the state of %s, but got %s", expectedPath, states[0].Path)
+	}
+	if states[0].Operation != "" || states[0].Waiting != 0 {
+		t.Fatalf("Expected the repo to be idle, but got %+v", states[0])
+	}
+}
+
+func TestStates_progress(t *testing.T) {
+	skipWithoutGit(t)
+
+	testRepoGit, testRepoDir, cleanup := createTestRepo(t)
+	defer cleanup()
+	testRepoGit("checkout", "-b", "feature")
+	createFile(t, testRepoDir, foo)
+	testRepoGit("add", foo.Name)
+	testRepoGit("commit", "-m", "Add foo")
+	testRepoGit("checkout", "master")
+
+	// The hook keeps the push going until the test has seen its progress
+	signalPath := filepath.Join(testRepoDir, "pushed")
+	hook := fmt.Sprintf("#!/bin/sh\nwhile [ ! -f %s ]; do sleep 0.05; done\n", signalPath)
+	err := ioutil.WriteFile(filepath.Join(testRepoDir, ".git", "hooks", "pre-receive"), []byte(hook), 0755)
+	checkError(t, err)
+
+	reposDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	gitRepos := git.NewRepos(reposDir)
+	repo, err := gitRepos.GetUpdatedRepo(testRepoDir, "my", "test-repo")
+	checkError(t, err)
+
+	pushed := make(chan error)
+	go func() {
+		pushed <- repo.ForcePush("origin/feature", "origin", "validation")
+	}()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		state := gitRepos.States()[0]
+		if strings.HasPrefix(state.Progress, "pushing") {
+			if state.Operation != "force push" {
+				t.Errorf("Expected the progress of the force push, but got %+v", state)
+			}
+			break
+		} else if time.Now().After(deadline) {
+			t.Errorf("Expected the push's progress to be reported, but got %+v", state)
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	checkError(t, ioutil.WriteFile(signalPath, nil, 0644))
+	checkError(t, <-pushed)
+
+	if state := gitRepos.States()[0]; state.Progress != "" {
+		t.Fatalf("Expected the progress to be cleared after the push, but got %q", state.Progress)
+	}
+}
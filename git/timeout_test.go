@@ -0,0 +1,72 @@
+package git_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/salemove/github-review-helper/git"
+)
+
+func TestGetUpdatedRepo_timeout(t *testing.T) {
+	skipWithoutGit(t)
+
+	reposDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	// The SSH command never connects, like a remote that stopped responding
+	gitRepos := git.NewReposWithOptions(reposDir, git.Options{
+		Env:      []string{"GIT_SSH_COMMAND=sleep 60 #"},
+		Timeouts: git.Timeouts{Network: 100 * time.Millisecond},
+	})
+	started := time.Now()
+	_, err := gitRepos.GetUpdatedRepo("ssh://git.example.com/my/test-repo", "my", "test-repo")
+	if !git.IsTimeout(err) {
+		t.Fatalf("Expected the clone to time out, got %v", err)
+	} else if elapsed := time.Since(started); elapsed > 10*time.Second {
+		t.Fatalf("Expected the hung clone to be killed, but it ran for %s", elapsed)
+	}
+}
+
+func TestGetUpdatedRepo_withinTimeout(t *testing.T) {
+	skipWithoutGit(t)
+
+	_, testRepoDir, cleanup := createTestRepo(t)
+	defer cleanup()
+
+	reposDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	gitRepos := git.NewReposWithOptions(reposDir, git.Options{
+		Timeouts: git.Timeouts{Network: time.Minute, Local: time.Minute},
+	})
+	_, err := gitRepos.GetUpdatedRepo(testRepoDir, "my", "test-repo")
+	checkError(t, err)
+	_, err = gitRepos.GetUpdatedRepo(testRepoDir, "my", "test-repo")
+	checkError(t, err)
+}
+
+func TestRunCommand_timeout(t *testing.T) {
+	skipWithoutGit(t)
+
+	_, testRepoDir, cleanup := createTestRepo(t)
+	defer cleanup()
+
+	reposDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	gitRepos := git.NewReposWithOptions(reposDir, git.Options{
+		Timeouts: git.Timeouts{Network: time.Minute, Local: time.Minute, Command: time.Second},
+	})
+	repo, err := gitRepos.GetUpdatedRepo(testRepoDir, "my", "test-repo")
+	checkError(t, err)
+
+	// The background sleep keeps the command's output open, so killing only
+	// the shell wouldn't be enough
+	started := time.Now()
+	err = repo.RunCommand("origin/master", "sleep 60 & sleep 60", nil)
+	if !git.IsTimeout(err) {
+		t.Fatalf("Expected the command to time out, got %v", err)
+	} else if elapsed := time.Since(started); elapsed > 10*time.Second {
+		t.Fatalf("Expected the hung command to be killed, but it ran for %s", elapsed)
+	}
+}
@@ -0,0 +1,42 @@
+package git_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/salemove/github-review-helper/git"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestWithContext(t *testing.T) {
+	skipWithoutGit(t)
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	defer provider.Shutdown(context.Background())
+
+	_, testRepoDir, cleanup := createTestRepo(t)
+	defer cleanup()
+
+	reposDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "webhook")
+	gitRepos := git.NewRepos(reposDir).WithContext(ctx)
+	_, err := gitRepos.GetUpdatedRepo(testRepoDir, "my", "test-repo")
+	checkError(t, err)
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) < 2 {
+		t.Fatalf("Expected spans for the git commands, but got %d spans", len(spans))
+	}
+	for _, span := range spans[:len(spans)-1] {
+		if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Fatalf("Expected span %s to be a child of the webhook span", span.Name())
+		}
+	}
+}
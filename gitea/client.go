@@ -0,0 +1,151 @@
+// Package gitea implements the bot's GitHub client interfaces on top of the
+// REST API of Gitea and of Forgejo, its fork. Their API mirrors GitHub's for
+// most of what the bot uses, so the services wrap go-github's services,
+// pointed at the forge, and only override the endpoints whose requests or
+// responses differ from GitHub's.
+package gitea
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/github"
+)
+
+// ErrUnsupported is returned for the operations Gitea has no equivalent for,
+// e.g. GitHub deployments.
+var ErrUnsupported = errors.New("not supported by Gitea")
+
+// Client talks to a Gitea or Forgejo instance's REST API. Its services
+// satisfy the bot's PullRequests, Repositories, Issues and Search interfaces.
+type Client struct {
+	PullRequests *PullRequestsService
+	Repositories *RepositoriesService
+	Issues       *IssuesService
+	Search       *SearchService
+
+	github *github.Client
+
+	mutex sync.Mutex
+	// labels maps the repositories' label names to their IDs, because Gitea
+	// only labels issues by ID
+	labels map[string]map[string]int64
+}
+
+// NewClient creates a client for the instance at baseURL, e.g.
+// "https://codeberg.org", that authenticates with the access token.
+func NewClient(httpClient *http.Client, baseURL, token string) (*Client, error) {
+	apiURL, err := url.Parse(strings.TrimSuffix(baseURL, "/") + "/api/v1/")
+	if err != nil {
+		return nil, fmt.Errorf("invalid Gitea URL \"%s\": %v", baseURL, err)
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	authenticated := *httpClient
+	authenticated.Transport = tokenTransport{token, httpClient.Transport}
+	c := &Client{
+		github: github.NewClient(&authenticated),
+		labels: map[string]map[string]int64{},
+	}
+	c.github.BaseURL = apiURL
+	c.PullRequests = &PullRequestsService{c.github.PullRequests, c}
+	c.Repositories = &RepositoriesService{c.github.Repositories, c}
+	c.Issues = &IssuesService{c.github.Issues, c}
+	c.Search = &SearchService{c}
+	return c, nil
+}
+
+// tokenTransport authenticates the requests with the access token.
+type tokenTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Copying the request, because http.RoundTripper mustn't change it
+	authenticated := new(http.Request)
+	*authenticated = *req
+	authenticated.Header = make(http.Header, len(req.Header)+1)
+	for name, values := range req.Header {
+		authenticated.Header[name] = append([]string(nil), values...)
+	}
+	authenticated.Header.Set("Authorization", "token "+t.token)
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(authenticated)
+}
+
+// do sends the request to the API path and decodes the response into result
+// through go-github, so that the errors and the pagination of the response
+// would be the same as for GitHub.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body interface{},
+	result interface{}) (*github.Response, error) {
+
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	req, err := c.github.NewRequest(method, path, body)
+	if err != nil {
+		return nil, err
+	}
+	return c.github.Do(ctx, req, result)
+}
+
+// convert converts the GitHub-shaped value to the go-github type through
+// JSON.
+func convert(value interface{}, result interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, result)
+}
+
+func repoPath(owner, repo string) string {
+	return fmt.Sprintf("repos/%s/%s", url.PathEscape(owner), url.PathEscape(repo))
+}
+
+// pageQuery converts go-github's list options to Gitea's pagination
+// parameters, which name the page size limit.
+func pageQuery(opt *github.ListOptions) url.Values {
+	query := url.Values{}
+	if opt != nil && opt.Page != 0 {
+		query.Set("page", strconv.Itoa(opt.Page))
+	}
+	if opt != nil && opt.PerPage != 0 {
+		query.Set("limit", strconv.Itoa(opt.PerPage))
+	}
+	return query
+}
+
+// withStatusCode changes the status code of the response and of its error,
+// so that the callers' checks for GitHub's status codes would apply.
+func withStatusCode(resp *github.Response, err error, statusCode int, message string) (*github.Response, error) {
+	httpResponse := &http.Response{StatusCode: statusCode, Header: http.Header{}}
+	if resp != nil && resp.Response != nil {
+		httpResponse.Request = resp.Request
+		httpResponse.Header = resp.Header
+	}
+	if errResp, ok := err.(*github.ErrorResponse); ok {
+		err = &github.ErrorResponse{Response: httpResponse, Message: message, Errors: errResp.Errors}
+	}
+	return &github.Response{Response: httpResponse}, err
+}
+
+// errorMessage returns the message of the API's error response.
+func errorMessage(err error) string {
+	if errResp, ok := err.(*github.ErrorResponse); ok {
+		return errResp.Message
+	}
+	return ""
+}
@@ -0,0 +1,233 @@
+package gitea_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/gitea"
+)
+
+func pullRequestJSON(sha string, merged bool) string {
+	return fmt.Sprintf(`{
+  "number": 7,
+  "state": "closed",
+  "merged": %t,
+  "merge_commit_sha": "9876",
+  "head": {"ref": "feature", "sha": "%s", "repo": {"name": "widget", "owner": {"login": "acme"}}},
+  "base": {"ref": "master", "sha": "1234", "repo": {"name": "widget", "owner": {"login": "acme"}}}
+}`, merged, sha)
+}
+
+const issueJSON = `{
+  "number": 7,
+  "url": "%s/api/v1/repos/acme/widget/issues/7",
+  "labels": [{"id": 1, "name": "%s"}],
+  "pull_request": {"merged": false},
+  "repository": {"name": "widget", "owner": "acme", "full_name": "acme/widget"},
+  "milestone": {"id": 5, "title": "1.0"}
+}`
+
+func newServer(t *testing.T, routes map[string]func(w http.ResponseWriter, r *http.Request)) (*httptest.Server,
+	*gitea.Client) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token secret" {
+			t.Errorf("Expected the token to be sent, got \"%s\"", r.Header.Get("Authorization"))
+		}
+		route, exists := routes[r.Method+" "+r.URL.EscapedPath()]
+		if !exists {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.EscapedPath())
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		route(w, r)
+	}))
+	client, err := gitea.NewClient(server.Client(), server.URL, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, client
+}
+
+func respond(body string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}
+}
+
+func decode(t *testing.T, r *http.Request) map[string]interface{} {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+func TestMergeReportsMergeCommit(t *testing.T) {
+	server, client := newServer(t, map[string]func(w http.ResponseWriter, r *http.Request){
+		"POST /api/v1/repos/acme/widget/pulls/7/merge": func(w http.ResponseWriter, r *http.Request) {
+			request := decode(t, r)
+			if request["Do"] != "squash" || request["MergeMessageField"] != "Add the widget" {
+				t.Errorf("Unexpected merge request %v", request)
+			}
+		},
+		"GET /api/v1/repos/acme/widget/pulls/7": respond(pullRequestJSON("1235", true)),
+	})
+	defer server.Close()
+
+	result, _, err := client.PullRequests.Merge(context.Background(), "acme", "widget", 7, "Add the widget",
+		&github.PullRequestOptions{MergeMethod: "squash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.GetMerged() || result.GetSHA() != "9876" {
+		t.Errorf("Expected the PR to be merged as 9876, got %v", result)
+	}
+}
+
+func TestMergeOntoMovedBaseIsNotAllowed(t *testing.T) {
+	server, client := newServer(t, map[string]func(w http.ResponseWriter, r *http.Request){
+		"POST /api/v1/repos/acme/widget/pulls/7/merge": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"message": "merge push out of date"}`))
+		},
+	})
+	defer server.Close()
+
+	_, resp, err := client.PullRequests.Merge(context.Background(), "acme", "widget", 7, "", nil)
+	if err == nil {
+		t.Fatal("Expected the merge to fail")
+	} else if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Expected a 405, got %d", resp.StatusCode)
+	}
+}
+
+func TestCombinedStatus(t *testing.T) {
+	server, client := newServer(t, map[string]func(w http.ResponseWriter, r *http.Request){
+		"GET /api/v1/repos/acme/widget/commits/1235/status": respond(`{
+  "state": "warning",
+  "sha": "1235",
+  "statuses": [
+    {"id": 1, "status": "success", "context": "test"},
+    {"id": 2, "status": "warning", "context": "lint"}
+  ]
+}`),
+	})
+	defer server.Close()
+
+	combined, _, err := client.Repositories.GetCombinedStatus(context.Background(), "acme", "widget", "1235", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if combined.GetState() != "failure" {
+		t.Errorf("Expected the combined state to be failure, got %s", combined.GetState())
+	}
+	if state := combined.Statuses[0].GetState(); state != "success" {
+		t.Errorf("Expected the status's state to be read, got %s", state)
+	}
+}
+
+func TestAddLabelsCreatesMissingLabels(t *testing.T) {
+	server, client := newServer(t, map[string]func(w http.ResponseWriter, r *http.Request){
+		"GET /api/v1/repos/acme/widget/labels": respond(`[{"id": 1, "name": "bug"}]`),
+		"POST /api/v1/repos/acme/widget/labels": func(w http.ResponseWriter, r *http.Request) {
+			if name := decode(t, r)["name"]; name != "merging" {
+				t.Errorf("Expected the merging label to be created, got %v", name)
+			}
+			w.Write([]byte(`{"id": 2, "name": "merging"}`))
+		},
+		"POST /api/v1/repos/acme/widget/issues/7/labels": func(w http.ResponseWriter, r *http.Request) {
+			if ids := decode(t, r)["labels"]; fmt.Sprint(ids) != "[1 2]" {
+				t.Errorf("Expected the labels to be added by ID, got %v", ids)
+			}
+			w.Write([]byte(`[{"id": 1, "name": "bug"}, {"id": 2, "name": "merging"}]`))
+		},
+	})
+	defer server.Close()
+
+	labels, _, err := client.Issues.AddLabelsToIssue(context.Background(), "acme", "widget", 7,
+		[]string{"bug", "merging"})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(labels) != 2 {
+		t.Errorf("Expected 2 labels, got %v", labels)
+	}
+}
+
+func TestSearchIssues(t *testing.T) {
+	var server *httptest.Server
+	server, client := newServer(t, map[string]func(w http.ResponseWriter, r *http.Request){
+		"GET /api/v1/repos/acme/widget/issues": func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			if query.Get("labels") != "merging" || query.Get("state") != "open" || query.Get("type") != "pulls" {
+				t.Errorf("Unexpected query %s", r.URL.RawQuery)
+			}
+			w.Write([]byte("[" + fmt.Sprintf(issueJSON, server.URL, "merging") + "]"))
+		},
+		"GET /api/v1/repos/acme/widget/pulls/7": respond(pullRequestJSON("1235abc", false)),
+	})
+	defer server.Close()
+
+	result, _, err := client.Search.Issues(context.Background(),
+		`1235abc label:"merging" -label:"on hold" is:open repo:acme/widget`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Issues) != 1 {
+		t.Fatalf("Expected the SHA to match 1 pull request, got %d", len(result.Issues))
+	}
+	issue := result.Issues[0]
+	if owner := issue.GetRepository().GetOwner().GetLogin(); owner != "acme" {
+		t.Errorf("Expected the repository's owner to be acme, got \"%s\"", owner)
+	}
+	if number := issue.GetMilestone().GetNumber(); number != 5 {
+		t.Errorf("Expected the milestone's number to be its ID, got %d", number)
+	}
+}
+
+func TestSearchRequiresRepositories(t *testing.T) {
+	client, err := gitea.NewClient(nil, "https://gitea.example.com", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := client.Search.Issues(context.Background(), "is:pr is:open", nil); err == nil {
+		t.Error("Expected a search without repo: or user: to fail")
+	}
+}
+
+func TestAuthorAssociation(t *testing.T) {
+	server, client := newServer(t, map[string]func(w http.ResponseWriter, r *http.Request){
+		"GET /api/v1/repos/acme/widget/collaborators/maintainer/permission": respond(`{"permission": "admin"}`),
+		"GET /api/v1/repos/acme/widget/collaborators/reader/permission":     respond(`{"permission": "read"}`),
+		"GET /api/v1/repos/acme/widget/collaborators/stranger/permission": func(w http.ResponseWriter,
+			r *http.Request) {
+
+			http.NotFound(w, r)
+		},
+	})
+	defer server.Close()
+
+	for username, expected := range map[string]string{
+		"maintainer": "MEMBER",
+		"reader":     "NONE",
+		"stranger":   "NONE",
+	} {
+		association, err := client.Repositories.AuthorAssociation(context.Background(), "acme", "widget", username)
+		if err != nil {
+			t.Fatal(err)
+		} else if association != expected {
+			t.Errorf("Expected %s to be associated as %s, got %s", username, expected, association)
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package gitea
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// defaultLabelColor is the color of the labels created for labeling issues,
+// which GitHub creates implicitly with the same color
+const defaultLabelColor = "#ededed"
+
+// IssuesService handles the issues and pull requests' comments and labels.
+// Creating and editing comments and listing an issue's labels are
+// go-github's, because Gitea's API is the same for them.
+type IssuesService struct {
+	*github.IssuesService
+	client *Client
+}
+
+// githubIssue converts Gitea's issue to go-github's. Gitea refers to the
+// issue's repository by its owner's login only and its milestones have no
+// numbers apart from their IDs.
+func githubIssue(giteaIssue map[string]interface{}) (*github.Issue, error) {
+	if repository, ok := giteaIssue["repository"].(map[string]interface{}); ok {
+		if owner, ok := repository["owner"].(string); ok {
+			repository["owner"] = map[string]interface{}{"login": owner}
+		}
+	}
+	if milestone, ok := giteaIssue["milestone"].(map[string]interface{}); ok {
+		milestone["number"] = milestone["id"]
+	}
+	var issue github.Issue
+	if err := convert(giteaIssue, &issue); err != nil {
+		return nil, err
+	}
+	return &issue, nil
+}
+
+func githubMilestone(giteaMilestone map[string]interface{}) (*github.Milestone, error) {
+	giteaMilestone["number"] = giteaMilestone["id"]
+	var milestone github.Milestone
+	if err := convert(giteaMilestone, &milestone); err != nil {
+		return nil, err
+	}
+	return &milestone, nil
+}
+
+func (s *IssuesService) get(ctx context.Context, owner, repo string, number int) (*github.Issue,
+	*github.Response, error) {
+
+	var giteaIssue map[string]interface{}
+	path := fmt.Sprintf("%s/issues/%d", repoPath(owner, repo), number)
+	resp, err := s.client.do(ctx, "GET", path, nil, nil, &giteaIssue)
+	if err != nil {
+		return nil, resp, err
+	}
+	issue, err := githubIssue(giteaIssue)
+	return issue, resp, err
+}
+
+// labelIDs looks up the IDs of the repository's labels. The labels are
+// cached and only listed again when a label isn't found, in case it was
+// created since. Labels that don't exist are created, if create is set.
+func (c *Client) labelIDs(ctx context.Context, owner, repo string, names []string, create bool) ([]int64,
+	*github.Response, error) {
+
+	key := owner + "/" + repo
+	ids := make([]int64, 0, len(names))
+	var resp *github.Response
+	reloaded := false
+	for _, name := range names {
+		c.mutex.Lock()
+		id, exists := c.labels[key][name]
+		c.mutex.Unlock()
+		if !exists && !reloaded {
+			var err error
+			if resp, err = c.loadLabels(ctx, owner, repo); err != nil {
+				return nil, resp, err
+			}
+			reloaded = true
+			c.mutex.Lock()
+			id, exists = c.labels[key][name]
+			c.mutex.Unlock()
+		}
+		if !exists && !create {
+			return nil, notFound(resp), fmt.Errorf("label %s doesn't exist in %s", name, key)
+		} else if !exists {
+			var label github.Label
+			var err error
+			resp, err = c.do(ctx, "POST", repoPath(owner, repo)+"/labels", nil,
+				map[string]interface{}{"name": name, "color": defaultLabelColor}, &label)
+			if err != nil {
+				return nil, resp, err
+			}
+			id = label.GetID()
+			c.mutex.Lock()
+			c.labels[key][name] = id
+			c.mutex.Unlock()
+		}
+		ids = append(ids, id)
+	}
+	return ids, resp, nil
+}
+
+func (c *Client) loadLabels(ctx context.Context, owner, repo string) (*github.Response, error) {
+	labels := map[string]int64{}
+	listOptions := &github.ListOptions{Page: 1, PerPage: 50}
+	for {
+		var page []github.Label
+		resp, err := c.do(ctx, "GET", repoPath(owner, repo)+"/labels", pageQuery(listOptions), nil, &page)
+		if err != nil {
+			return resp, err
+		}
+		for _, label := range page {
+			labels[label.GetName()] = label.GetID()
+		}
+		if resp.NextPage == 0 {
+			c.mutex.Lock()
+			c.labels[owner+"/"+repo] = labels
+			c.mutex.Unlock()
+			return resp, nil
+		}
+		listOptions.Page = resp.NextPage
+	}
+}
+
+// AddLabelsToIssue adds the labels, creating the ones the repository doesn't
+// have yet, like GitHub does.
+func (s *IssuesService) AddLabelsToIssue(ctx context.Context, owner, repo string, number int,
+	labels []string) ([]*github.Label, *github.Response, error) {
+
+	ids, resp, err := s.client.labelIDs(ctx, owner, repo, labels, true)
+	if err != nil {
+		return nil, resp, err
+	}
+	var result []*github.Label
+	path := fmt.Sprintf("%s/issues/%d/labels", repoPath(owner, repo), number)
+	resp, err = s.client.do(ctx, "POST", path, nil, map[string]interface{}{"labels": ids}, &result)
+	return result, resp, err
+}
+
+// RemoveLabelForIssue removes the label. Labels the repository doesn't have
+// respond with a 404, as labels the issue doesn't have do on GitHub.
+func (s *IssuesService) RemoveLabelForIssue(ctx context.Context, owner, repo string, number int,
+	label string) (*github.Response, error) {
+
+	ids, resp, err := s.client.labelIDs(ctx, owner, repo, []string{label}, false)
+	if err != nil {
+		return resp, err
+	}
+	path := fmt.Sprintf("%s/issues/%d/labels/%d", repoPath(owner, repo), number, ids[0])
+	return s.client.do(ctx, "DELETE", path, nil, nil, nil)
+}
+
+// ListByRepo lists all of the repository's issues at once, sorted as GitHub
+// would, because Gitea doesn't sort them as asked.
+func (s *IssuesService) ListByRepo(ctx context.Context, owner string, repo string,
+	opt *github.IssueListByRepoOptions) ([]*github.Issue, *github.Response, error) {
+
+	if opt == nil {
+		opt = &github.IssueListByRepoOptions{}
+	}
+	query := url.Values{"state": {"open"}, "limit": {"50"}}
+	if opt.State != "" {
+		query.Set("state", opt.State)
+	}
+	if len(opt.Labels) > 0 {
+		query.Set("labels", strings.Join(opt.Labels, ","))
+	}
+	if opt.Milestone != "" && opt.Milestone != "*" {
+		query.Set("milestones", opt.Milestone)
+	}
+	if opt.Creator != "" {
+		query.Set("created_by", opt.Creator)
+	}
+	if opt.Assignee != "" {
+		query.Set("assigned_by", opt.Assignee)
+	}
+	if opt.Mentioned != "" {
+		query.Set("mentioned_by", opt.Mentioned)
+	}
+	if !opt.Since.IsZero() {
+		query.Set("since", opt.Since.Format(time.RFC3339))
+	}
+	issues, resp, err := s.client.listIssues(ctx, repoPath(owner, repo)+"/issues", query)
+	if err != nil {
+		return nil, resp, err
+	}
+	sortIssues(issues, opt.Sort, opt.Direction)
+	return issues, resp, nil
+}
+
+// listIssues lists all pages of the issues at the path.
+func (c *Client) listIssues(ctx context.Context, path string, query url.Values) ([]*github.Issue,
+	*github.Response, error) {
+
+	var issues []*github.Issue
+	for {
+		var page []map[string]interface{}
+		resp, err := c.do(ctx, "GET", path, query, nil, &page)
+		if err != nil {
+			return nil, resp, err
+		}
+		for _, giteaIssue := range page {
+			issue, err := githubIssue(giteaIssue)
+			if err != nil {
+				return nil, resp, err
+			}
+			issues = append(issues, issue)
+		}
+		if resp.NextPage == 0 {
+			return issues, resp, nil
+		}
+		query.Set("page", fmt.Sprint(resp.NextPage))
+	}
+}
+
+func sortIssues(issues []*github.Issue, by, direction string) {
+	key := func(issue *github.Issue) time.Time {
+		if by == "updated" {
+			return issue.GetUpdatedAt()
+		}
+		return issue.GetCreatedAt()
+	}
+	sort.SliceStable(issues, func(i, j int) bool {
+		if by == "comments" {
+			if direction == "asc" {
+				return issues[i].GetComments() < issues[j].GetComments()
+			}
+			return issues[i].GetComments() > issues[j].GetComments()
+		} else if direction == "asc" {
+			return key(issues[i]).Before(key(issues[j]))
+		}
+		return key(issues[i]).After(key(issues[j]))
+	})
+}
+
+// AddAssignees adds the assignees by editing the issue's assignees, because
+// Gitea can only replace them all at once.
+func (s *IssuesService) AddAssignees(ctx context.Context, owner, repo string, number int,
+	assignees []string) (*github.Issue, *github.Response, error) {
+
+	return s.changeAssignees(ctx, owner, repo, number, func(current []string) []string {
+		for _, assignee := range assignees {
+			if !containsFold(current, assignee) {
+				current = append(current, assignee)
+			}
+		}
+		return current
+	})
+}
+
+func (s *IssuesService) RemoveAssignees(ctx context.Context, owner, repo string, number int,
+	assignees []string) (*github.Issue, *github.Response, error) {
+
+	return s.changeAssignees(ctx, owner, repo, number, func(current []string) []string {
+		remaining := []string{}
+		for _, assignee := range current {
+			if !containsFold(assignees, assignee) {
+				remaining = append(remaining, assignee)
+			}
+		}
+		return remaining
+	})
+}
+
+func (s *IssuesService) changeAssignees(ctx context.Context, owner, repo string, number int,
+	change func(current []string) []string) (*github.Issue, *github.Response, error) {
+
+	issue, resp, err := s.get(ctx, owner, repo, number)
+	if err != nil {
+		return nil, resp, err
+	}
+	current := []string{}
+	for _, assignee := range issue.Assignees {
+		current = append(current, assignee.GetLogin())
+	}
+	assignees := change(current)
+	return s.Edit(ctx, owner, repo, number, &github.IssueRequest{Assignees: &assignees})
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Edit edits the issue. The milestone is set by its ID, which is the
+// milestone's number on Gitea.
+func (s *IssuesService) Edit(ctx context.Context, owner string, repo string, number int,
+	request *github.IssueRequest) (*github.Issue, *github.Response, error) {
+
+	var giteaIssue map[string]interface{}
+	path := fmt.Sprintf("%s/issues/%d", repoPath(owner, repo), number)
+	resp, err := s.client.do(ctx, "PATCH", path, nil, request, &giteaIssue)
+	if err != nil {
+		return nil, resp, err
+	}
+	issue, err := githubIssue(giteaIssue)
+	return issue, resp, err
+}
+
+func (s *IssuesService) ListMilestones(ctx context.Context, owner string, repo string,
+	opt *github.MilestoneListOptions) ([]*github.Milestone, *github.Response, error) {
+
+	query := url.Values{}
+	if opt != nil {
+		query = pageQuery(&opt.ListOptions)
+		if opt.State != "" {
+			query.Set("state", opt.State)
+		}
+	}
+	var giteaMilestones []map[string]interface{}
+	resp, err := s.client.do(ctx, "GET", repoPath(owner, repo)+"/milestones", query, nil, &giteaMilestones)
+	if err != nil {
+		return nil, resp, err
+	}
+	milestones := make([]*github.Milestone, len(giteaMilestones))
+	for i, giteaMilestone := range giteaMilestones {
+		if milestones[i], err = githubMilestone(giteaMilestone); err != nil {
+			return nil, resp, err
+		}
+	}
+	return milestones, resp, nil
+}
+
+func (s *IssuesService) CreateMilestone(ctx context.Context, owner string, repo string,
+	milestone *github.Milestone) (*github.Milestone, *github.Response, error) {
+
+	var giteaMilestone map[string]interface{}
+	resp, err := s.client.do(ctx, "POST", repoPath(owner, repo)+"/milestones", nil, milestone, &giteaMilestone)
+	if err != nil {
+		return nil, resp, err
+	}
+	created, err := githubMilestone(giteaMilestone)
+	return created, resp, err
+}
+
+func (s *IssuesService) Lock(ctx context.Context, owner string, repo string, number int,
+	opt *github.LockIssueOptions) (*github.Response, error) {
+
+	return nil, fmt.Errorf("locking conversations is %v", ErrUnsupported)
+}
+
+func (s *IssuesService) Unlock(ctx context.Context, owner string, repo string, number int) (*github.Response,
+	error) {
+
+	return nil, fmt.Errorf("unlocking conversations is %v", ErrUnsupported)
+}
@@ -0,0 +1,202 @@
+package gitea
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// PullRequestsService handles the pull requests. Getting, creating and
+// listing the files of pull requests are go-github's, because Gitea's API is
+// the same for them.
+type PullRequestsService struct {
+	*github.PullRequestsService
+	client *Client
+}
+
+// ListCommits lists all of the pull request's commits at once, from the
+// oldest to the newest like GitHub does, because Gitea lists them from the
+// newest.
+func (s *PullRequestsService) ListCommits(ctx context.Context, owner, repo string, number int,
+	opt *github.ListOptions) ([]*github.RepositoryCommit, *github.Response, error) {
+
+	var commits []*github.RepositoryCommit
+	var resp *github.Response
+	listOptions := &github.ListOptions{Page: 1, PerPage: 50}
+	for {
+		var page []*github.RepositoryCommit
+		var err error
+		path := fmt.Sprintf("%s/pulls/%d/commits", repoPath(owner, repo), number)
+		resp, err = s.client.do(ctx, "GET", path, pageQuery(listOptions), nil, &page)
+		if err != nil {
+			return nil, resp, err
+		}
+		commits = append(commits, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		listOptions.Page = resp.NextPage
+	}
+	for i, j := 0, len(commits)-1; i < j; i, j = i+1, j-1 {
+		commits[i], commits[j] = commits[j], commits[i]
+	}
+	return commits, resp, nil
+}
+
+// Merge merges the pull request with the merge method. Gitea doesn't respond
+// with the merge's result, so the merged pull request is fetched for its
+// merge commit.
+func (s *PullRequestsService) Merge(ctx context.Context, owner, repo string, number int, commitMessage string,
+	opt *github.PullRequestOptions) (*github.PullRequestMergeResult, *github.Response, error) {
+
+	request := map[string]interface{}{"Do": "merge"}
+	if opt != nil && opt.MergeMethod != "" {
+		request["Do"] = opt.MergeMethod
+	}
+	if opt != nil && opt.CommitTitle != "" {
+		request["MergeTitleField"] = opt.CommitTitle
+	}
+	if commitMessage != "" {
+		request["MergeMessageField"] = commitMessage
+	}
+	if opt != nil && opt.SHA != "" {
+		request["head_commit_id"] = opt.SHA
+	}
+	path := fmt.Sprintf("%s/pulls/%d/merge", repoPath(owner, repo), number)
+	resp, err := s.client.do(ctx, "POST", path, nil, request, nil)
+	if err != nil {
+		// Gitea refuses the merge with a conflict, if the base branch moved
+		// during the merge, where GitHub refuses it as not allowed
+		if resp != nil && resp.StatusCode == http.StatusConflict &&
+			strings.Contains(errorMessage(err), "push out of date") {
+			resp, err = withStatusCode(resp, err, http.StatusMethodNotAllowed,
+				"Base branch was modified. Review and try the merge again.")
+		}
+		return nil, resp, err
+	}
+	pr, resp, err := s.Get(ctx, owner, repo, number)
+	if err != nil {
+		return nil, resp, err
+	}
+	result := &github.PullRequestMergeResult{
+		SHA:     github.String(pr.GetMergeCommitSHA()),
+		Merged:  github.Bool(pr.GetMerged()),
+		Message: github.String(fmt.Sprintf("Pull request #%d %s", number, pr.GetState())),
+	}
+	return result, resp, nil
+}
+
+// review is a Gitea pull request review.
+type review struct {
+	ID          int64     `json:"id"`
+	User        user      `json:"user"`
+	Body        string    `json:"body"`
+	CommitID    string    `json:"commit_id"`
+	State       string    `json:"state"`
+	Dismissed   bool      `json:"dismissed"`
+	SubmittedAt time.Time `json:"submitted_at"`
+	HTMLURL     string    `json:"html_url"`
+}
+
+type user struct {
+	ID    int64  `json:"id"`
+	Login string `json:"login"`
+}
+
+// githubReview converts the review, whose states Gitea names differently.
+// Review requests are listed as reviews by Gitea and aren't converted.
+func (r review) githubReview() (*github.PullRequestReview, bool, error) {
+	state := r.State
+	switch {
+	case r.State == "REQUEST_REVIEW":
+		return nil, false, nil
+	case r.Dismissed:
+		state = "DISMISSED"
+	case r.State == "REQUEST_CHANGES":
+		state = "CHANGES_REQUESTED"
+	case r.State == "COMMENT":
+		state = "COMMENTED"
+	}
+	var githubReview github.PullRequestReview
+	err := convert(map[string]interface{}{
+		"id":           r.ID,
+		"user":         r.User,
+		"body":         r.Body,
+		"commit_id":    r.CommitID,
+		"state":        state,
+		"submitted_at": r.SubmittedAt,
+		"html_url":     r.HTMLURL,
+	}, &githubReview)
+	return &githubReview, true, err
+}
+
+func (s *PullRequestsService) ListReviews(ctx context.Context, owner, repo string, number int,
+	opt *github.ListOptions) ([]*github.PullRequestReview, *github.Response, error) {
+
+	var reviews []review
+	path := fmt.Sprintf("%s/pulls/%d/reviews", repoPath(owner, repo), number)
+	resp, err := s.client.do(ctx, "GET", path, pageQuery(opt), nil, &reviews)
+	if err != nil {
+		return nil, resp, err
+	}
+	result := make([]*github.PullRequestReview, 0, len(reviews))
+	for _, r := range reviews {
+		githubReview, isReview, err := r.githubReview()
+		if err != nil {
+			return nil, resp, err
+		} else if isReview {
+			result = append(result, githubReview)
+		}
+	}
+	return result, resp, nil
+}
+
+// RequestReviewers requests the reviews. Gitea responds with the requested
+// reviews, so the pull request is fetched for its reviewers.
+func (s *PullRequestsService) RequestReviewers(ctx context.Context, owner, repo string, number int,
+	reviewers github.ReviewersRequest) (*github.PullRequest, *github.Response, error) {
+
+	path := fmt.Sprintf("%s/pulls/%d/requested_reviewers", repoPath(owner, repo), number)
+	resp, err := s.client.do(ctx, "POST", path, nil, reviewers, nil)
+	if err != nil {
+		return nil, resp, err
+	}
+	return s.Get(ctx, owner, repo, number)
+}
+
+// CreateReview submits the review. Gitea names the approving event
+// differently and positions the comments on the new version of the file.
+func (s *PullRequestsService) CreateReview(ctx context.Context, owner, repo string, number int,
+	request *github.PullRequestReviewRequest) (*github.PullRequestReview, *github.Response, error) {
+
+	event := request.GetEvent()
+	if event == "APPROVE" {
+		event = "APPROVED"
+	}
+	comments := make([]map[string]interface{}, len(request.Comments))
+	for i, comment := range request.Comments {
+		comments[i] = map[string]interface{}{
+			"path":         comment.GetPath(),
+			"body":         comment.GetBody(),
+			"new_position": comment.GetPosition(),
+		}
+	}
+	body := map[string]interface{}{
+		"event":     event,
+		"body":      request.GetBody(),
+		"commit_id": request.GetCommitID(),
+		"comments":  comments,
+	}
+	var created review
+	path := fmt.Sprintf("%s/pulls/%d/reviews", repoPath(owner, repo), number)
+	resp, err := s.client.do(ctx, "POST", path, nil, body, &created)
+	if err != nil {
+		return nil, resp, err
+	}
+	githubReview, _, err := created.githubReview()
+	return githubReview, resp, err
+}
@@ -0,0 +1,223 @@
+package gitea
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// RepositoriesService handles the repositories. Getting repositories,
+// checking collaborators and the releases are go-github's, because Gitea's
+// API is the same for them.
+type RepositoriesService struct {
+	*github.RepositoriesService
+	client *Client
+}
+
+// CompareCommits compares the commits both ways, because Gitea only lists
+// the commits head is ahead by.
+func (s *RepositoriesService) CompareCommits(ctx context.Context, owner, repo string, base,
+	head string) (*github.CommitsComparison, *github.Response, error) {
+
+	ahead, resp, err := s.compare(ctx, owner, repo, base, head)
+	if err != nil {
+		return nil, resp, err
+	}
+	behind, resp, err := s.compare(ctx, owner, repo, head, base)
+	if err != nil {
+		return nil, resp, err
+	}
+	status := "diverged"
+	switch {
+	case len(ahead) == 0 && len(behind) == 0:
+		status = "identical"
+	case len(behind) == 0:
+		status = "ahead"
+	case len(ahead) == 0:
+		status = "behind"
+	}
+	comparison := &github.CommitsComparison{
+		Status:   github.String(status),
+		AheadBy:  github.Int(len(ahead)),
+		BehindBy: github.Int(len(behind)),
+		Commits:  ahead,
+	}
+	return comparison, resp, nil
+}
+
+func (s *RepositoriesService) compare(ctx context.Context, owner, repo, from, to string) (
+	[]github.RepositoryCommit, *github.Response, error) {
+
+	var comparison struct {
+		Commits []github.RepositoryCommit `json:"commits"`
+	}
+	path := fmt.Sprintf("%s/compare/%s...%s", repoPath(owner, repo), url.PathEscape(from), url.PathEscape(to))
+	resp, err := s.client.do(ctx, "GET", path, nil, nil, &comparison)
+	return comparison.Commits, resp, err
+}
+
+// commitStatus is a Gitea commit status, whose state is named status.
+type commitStatus struct {
+	ID          int64     `json:"id"`
+	Status      string    `json:"status"`
+	Context     string    `json:"context"`
+	Description string    `json:"description"`
+	TargetURL   string    `json:"target_url"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (s commitStatus) githubStatus() github.RepoStatus {
+	createdAt, updatedAt := s.CreatedAt, s.UpdatedAt
+	return github.RepoStatus{
+		ID:          github.Int64(s.ID),
+		State:       github.String(githubState(s.Status)),
+		Context:     github.String(s.Context),
+		Description: github.String(s.Description),
+		TargetURL:   github.String(s.TargetURL),
+		CreatedAt:   &createdAt,
+		UpdatedAt:   &updatedAt,
+	}
+}
+
+// githubState maps the status's state to GitHub's. Gitea's warnings block
+// merges like failures do.
+func githubState(state string) string {
+	if state == "warning" {
+		return "failure"
+	}
+	return state
+}
+
+func (s *RepositoriesService) CreateStatus(ctx context.Context, owner, repo, ref string,
+	status *github.RepoStatus) (*github.RepoStatus, *github.Response, error) {
+
+	var created commitStatus
+	path := fmt.Sprintf("%s/statuses/%s", repoPath(owner, repo), url.PathEscape(ref))
+	resp, err := s.client.do(ctx, "POST", path, nil, status, &created)
+	if err != nil {
+		return nil, resp, err
+	}
+	githubStatus := created.githubStatus()
+	return &githubStatus, resp, nil
+}
+
+// GetCombinedStatus gets the combined status of the ref. The combined state
+// is computed from the statuses, because Gitea counts warnings as neither
+// successes nor failures.
+func (s *RepositoriesService) GetCombinedStatus(ctx context.Context, owner, repo, ref string,
+	opt *github.ListOptions) (*github.CombinedStatus, *github.Response, error) {
+
+	var combinedStatus struct {
+		SHA      string         `json:"sha"`
+		Statuses []commitStatus `json:"statuses"`
+	}
+	path := fmt.Sprintf("%s/commits/%s/status", repoPath(owner, repo), url.PathEscape(ref))
+	resp, err := s.client.do(ctx, "GET", path, pageQuery(opt), nil, &combinedStatus)
+	if err != nil {
+		return nil, resp, err
+	}
+	combined := &github.CombinedStatus{
+		SHA:        github.String(combinedStatus.SHA),
+		TotalCount: github.Int(len(combinedStatus.Statuses)),
+		Statuses:   make([]github.RepoStatus, len(combinedStatus.Statuses)),
+	}
+	failed, pending := false, len(combinedStatus.Statuses) == 0
+	for i, status := range combinedStatus.Statuses {
+		combined.Statuses[i] = status.githubStatus()
+		state := combined.Statuses[i].GetState()
+		failed = failed || state == "failure" || state == "error"
+		pending = pending || state == "pending"
+	}
+	switch {
+	case failed:
+		combined.State = github.String("failure")
+	case pending:
+		combined.State = github.String("pending")
+	default:
+		combined.State = github.String("success")
+	}
+	return combined, resp, nil
+}
+
+// GetRequiredStatusChecks gets the status contexts the branch's protection
+// requires. Branches that don't require statuses respond with a 404, as
+// unprotected branches do on GitHub.
+func (s *RepositoriesService) GetRequiredStatusChecks(ctx context.Context, owner, repo,
+	branch string) (*github.RequiredStatusChecks, *github.Response, error) {
+
+	var protection struct {
+		EnableStatusCheck   bool     `json:"enable_status_check"`
+		StatusCheckContexts []string `json:"status_check_contexts"`
+	}
+	path := fmt.Sprintf("%s/branch_protections/%s", repoPath(owner, repo), url.PathEscape(branch))
+	resp, err := s.client.do(ctx, "GET", path, nil, nil, &protection)
+	if err != nil {
+		return nil, resp, err
+	} else if !protection.EnableStatusCheck {
+		return nil, notFound(resp), fmt.Errorf("branch %s doesn't require status checks", branch)
+	}
+	return &github.RequiredStatusChecks{Contexts: protection.StatusCheckContexts}, resp, nil
+}
+
+// AuthorAssociation maps the user's permission on the repository to the
+// author_association GitHub would give the user's comments: the owner is
+// OWNER, admins are MEMBER and the users who can push are COLLABORATOR.
+// Everyone else, including the users who can only read the repository, is
+// NONE.
+func (s *RepositoriesService) AuthorAssociation(ctx context.Context, owner, repo, username string) (string,
+	error) {
+
+	var permission struct {
+		Permission string `json:"permission"`
+	}
+	path := fmt.Sprintf("%s/collaborators/%s/permission", repoPath(owner, repo), url.PathEscape(username))
+	resp, err := s.client.do(ctx, "GET", path, nil, nil, &permission)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return "NONE", nil
+		}
+		return "", err
+	}
+	switch permission.Permission {
+	case "owner":
+		return "OWNER", nil
+	case "admin":
+		return "MEMBER", nil
+	case "write":
+		return "COLLABORATOR", nil
+	}
+	return "NONE", nil
+}
+
+// notFound turns the response into a 404 one, so that the callers' checks
+// for missing resources would apply to what Gitea doesn't have.
+func notFound(resp *github.Response) *github.Response {
+	httpResponse := &http.Response{StatusCode: http.StatusNotFound, Header: http.Header{}}
+	if resp != nil && resp.Response != nil {
+		httpResponse.Request = resp.Request
+	}
+	return &github.Response{Response: httpResponse}
+}
+
+func (s *RepositoriesService) CreateComment(ctx context.Context, owner, repo, sha string,
+	comment *github.RepositoryComment) (*github.RepositoryComment, *github.Response, error) {
+
+	return nil, nil, fmt.Errorf("commit comments are %v", ErrUnsupported)
+}
+
+func (s *RepositoriesService) CreateDeployment(ctx context.Context, owner, repo string,
+	request *github.DeploymentRequest) (*github.Deployment, *github.Response, error) {
+
+	return nil, nil, fmt.Errorf("deployments are %v", ErrUnsupported)
+}
+
+func (s *RepositoriesService) Merge(ctx context.Context, owner, repo string,
+	request *github.RepositoryMergeRequest) (*github.RepositoryCommit, *github.Response, error) {
+
+	return nil, nil, fmt.Errorf("merging branches without a pull request is %v", ErrUnsupported)
+}
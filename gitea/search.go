@@ -0,0 +1,217 @@
+package gitea
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/google/go-github/github"
+)
+
+var shaRegexp = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// SearchService searches pull requests with the subset of GitHub's issue
+// search syntax the bot uses.
+type SearchService struct {
+	client *Client
+}
+
+// searchQuery is a GitHub issue search query translated to the issue list
+// parameters of the repositories and owners to search in and the filters
+// Gitea can't apply itself.
+type searchQuery struct {
+	repositories []string
+	owners       []string
+	params       url.Values
+	notLabels    []string
+	merged       bool
+	sha          string
+	status       string
+}
+
+// parseSearchQuery parses the qualifiers the bot's searches use: repo:,
+// user:, label:, -label:, is:, status:, updated:< and a commit SHA, which
+// matches the pull requests it's the head of.
+func parseSearchQuery(query string) (searchQuery, error) {
+	parsed := searchQuery{params: url.Values{"type": {"pulls"}, "state": {"all"}, "limit": {"50"}}}
+	var labels, terms []string
+	for _, token := range splitQuery(query) {
+		i := strings.Index(token, ":")
+		if i < 0 {
+			if shaRegexp.MatchString(token) {
+				parsed.sha = token
+			} else {
+				terms = append(terms, token)
+			}
+			continue
+		}
+		qualifier, value := token[:i], strings.Trim(token[i+1:], `"`)
+		switch qualifier {
+		case "repo":
+			if !strings.Contains(value, "/") {
+				return searchQuery{}, fmt.Errorf("expected repo:owner/name, got \"%s\"", token)
+			}
+			parsed.repositories = append(parsed.repositories, value)
+		case "user", "org":
+			parsed.owners = append(parsed.owners, value)
+		case "label":
+			labels = append(labels, value)
+		case "-label":
+			parsed.notLabels = append(parsed.notLabels, value)
+		case "is":
+			switch value {
+			case "pr":
+			case "open", "closed":
+				parsed.params.Set("state", value)
+			case "merged":
+				parsed.params.Set("state", "closed")
+				parsed.merged = true
+			default:
+				return searchQuery{}, fmt.Errorf("the \"%s\" qualifier is %v", token, ErrUnsupported)
+			}
+		case "status":
+			parsed.status = value
+		case "updated":
+			if !strings.HasPrefix(value, "<") {
+				return searchQuery{}, fmt.Errorf("the \"%s\" qualifier is %v", token, ErrUnsupported)
+			}
+			before := strings.TrimPrefix(value, "<")
+			if !strings.Contains(before, "T") {
+				before += "T00:00:00Z"
+			}
+			parsed.params.Set("before", before)
+		default:
+			return searchQuery{}, fmt.Errorf("the \"%s\" qualifier is %v", token, ErrUnsupported)
+		}
+	}
+	if len(parsed.repositories) == 0 && len(parsed.owners) == 0 {
+		return searchQuery{}, fmt.Errorf("expected the query \"%s\" to be limited with repo: or user:", query)
+	}
+	if len(labels) > 0 {
+		parsed.params.Set("labels", strings.Join(labels, ","))
+	}
+	if len(terms) > 0 {
+		parsed.params.Set("q", strings.Join(terms, " "))
+	}
+	return parsed, nil
+}
+
+// splitQuery splits the query on whitespace outside double quotes.
+func splitQuery(query string) []string {
+	var tokens []string
+	var token strings.Builder
+	quoted := false
+	for _, r := range query {
+		if r == '"' {
+			quoted = !quoted
+		} else if unicode.IsSpace(r) && !quoted {
+			if token.Len() > 0 {
+				tokens = append(tokens, token.String())
+				token.Reset()
+			}
+			continue
+		}
+		token.WriteRune(r)
+	}
+	if token.Len() > 0 {
+		tokens = append(tokens, token.String())
+	}
+	return tokens
+}
+
+// Issues searches the pull requests of the repositories and owners the
+// query names. All matches are returned at once, because some of the filters
+// are applied after listing the pull requests.
+func (s *SearchService) Issues(ctx context.Context, query string,
+	opt *github.SearchOptions) (*github.IssuesSearchResult, *github.Response, error) {
+
+	parsed, err := parseSearchQuery(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	type listing struct {
+		path  string
+		query url.Values
+	}
+	var listings []listing
+	for _, repository := range parsed.repositories {
+		i := strings.Index(repository, "/")
+		listings = append(listings, listing{repoPath(repository[:i], repository[i+1:]) + "/issues",
+			copyValues(parsed.params)})
+	}
+	for _, owner := range parsed.owners {
+		ownerQuery := copyValues(parsed.params)
+		ownerQuery.Set("owner", owner)
+		listings = append(listings, listing{"repos/issues/search", ownerQuery})
+	}
+	var resp *github.Response
+	issues := []github.Issue{}
+	for _, l := range listings {
+		var listed []*github.Issue
+		listed, resp, err = s.client.listIssues(ctx, l.path, l.query)
+		if err != nil {
+			return nil, resp, err
+		}
+		for _, issue := range listed {
+			matches, err := s.match(ctx, parsed, issue)
+			if err != nil {
+				return nil, resp, err
+			} else if matches {
+				issues = append(issues, *issue)
+			}
+		}
+	}
+	result := &github.IssuesSearchResult{
+		Total:             github.Int(len(issues)),
+		IncompleteResults: github.Bool(false),
+		Issues:            issues,
+	}
+	if resp != nil {
+		resp.NextPage = 0
+	}
+	return result, resp, nil
+}
+
+func copyValues(values url.Values) url.Values {
+	copied := url.Values{}
+	for key, v := range values {
+		copied[key] = append([]string(nil), v...)
+	}
+	return copied
+}
+
+// match applies the filters Gitea can't. The pull request is only fetched,
+// if the filters depend on its merge or its head.
+func (s *SearchService) match(ctx context.Context, parsed searchQuery, issue *github.Issue) (bool, error) {
+	for _, label := range issue.Labels {
+		if containsFold(parsed.notLabels, label.GetName()) {
+			return false, nil
+		}
+	}
+	if !parsed.merged && parsed.sha == "" && parsed.status == "" {
+		return true, nil
+	}
+	repository := issue.GetRepository()
+	pr, _, err := s.client.PullRequests.Get(ctx, repository.GetOwner().GetLogin(), repository.GetName(),
+		issue.GetNumber())
+	if err != nil {
+		return false, err
+	}
+	if parsed.merged && !pr.GetMerged() {
+		return false, nil
+	} else if parsed.sha != "" && !strings.HasPrefix(pr.Head.GetSHA(), parsed.sha) {
+		return false, nil
+	} else if parsed.status != "" {
+		head := pr.Head.GetRepo()
+		combined, _, err := s.client.Repositories.GetCombinedStatus(ctx, head.GetOwner().GetLogin(),
+			head.GetName(), pr.Head.GetSHA(), nil)
+		if err != nil {
+			return false, err
+		}
+		return combined.GetState() == parsed.status, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/salemove/github-review-helper/gitea"
+)
+
+// createGiteaHandler creates the handler for the webhooks of the Gitea or
+// Forgejo instance at GITEA_URL. Its repositories are cloned to a directory
+// of their own, like GitLab's.
+func createGiteaHandler(conf Config, configSource ConfigSource, reposDir string, store Store, scheduler *Scheduler,
+	errorReporter ErrorReporter, auditLog AuditLog, asyncOperationWg *sync.WaitGroup) (Handler, error) {
+
+	httpClient := &http.Client{
+		Transport: proxyTransport(conf),
+		Timeout:   30 * time.Second,
+	}
+	client, err := gitea.NewClient(httpClient, conf.GiteaURL, conf.GiteaAccessToken)
+	if err != nil {
+		return nil, err
+	}
+	driver := giteaDriver{client}
+	// GitHub's tenants don't apply to the instance's repositories
+	gitRepos := newGitReposWithEnv(conf, filepath.Join(reposDir, "gitea"), gitIdentity(conf, nil), gitEnv(conf))
+	gitRepos, pullRequests := limitResources(conf, gitRepos, driver.PullRequests())
+	handler := CreateHandler(configSource, gitRepos, store, scheduler, errorReporter, auditLog, asyncOperationWg,
+		pullRequests, driver.Repositories(), driver.Issues(), driver.Search(), driver.GraphQL())
+	return CreateGiteaWebhookHandler(configSource, client.Repositories, handler), nil
+}
+
+// CreateGiteaWebhookHandler creates the handler for the webhooks of Gitea and
+// Forgejo. Their webhooks are mostly GitHub's, but they're signed in a header
+// of their own and some of their events and actions are named differently,
+// so they're translated before being passed on to the handler created with
+// the Gitea driver's clients. Their comments and reviews don't say how their
+// authors are associated with the repository, so the associations are looked
+// up from the authors' permissions.
+func CreateGiteaWebhookHandler(configSource ConfigSource, associations AuthorAssociations,
+	handler Handler) Handler {
+
+	labels := &giteaLabels{labels: map[string][]string{}}
+	return func(w http.ResponseWriter, r *http.Request) Response {
+		conf := configSource.Current()
+		body, errResp := readWebhookBody(conf, r)
+		if errResp != nil {
+			return errResp
+		}
+		secret, errResp := checkGiteaSignature(r, body, conf.Secrets)
+		if errResp != nil {
+			return errResp
+		}
+		var webhook map[string]interface{}
+		if err := json.Unmarshal(body, &webhook); err != nil {
+			return ErrorResponse{err, http.StatusBadRequest, "Failed to parse the request's body"}
+		}
+		translations, errResp := translateGiteaWebhook(giteaHeader(r, "Event"), webhook, labels, associations)
+		if errResp != nil {
+			return errResp
+		}
+		return forwardTranslations(w, r, secret, giteaHeader(r, "Delivery"), translations, handler)
+	}
+}
+
+// giteaHeader gets the X-Gitea- header, or Forgejo's X-Forgejo- header of the
+// same name.
+func giteaHeader(r *http.Request, name string) string {
+	if value := r.Header.Get("X-Gitea-" + name); value != "" {
+		return value
+	}
+	return r.Header.Get("X-Forgejo-" + name)
+}
+
+// checkGiteaSignature checks that the webhook is signed with one of the
+// secrets and returns it. Gitea signs its webhooks like GitHub does, but
+// without the algorithm's prefix.
+func checkGiteaSignature(r *http.Request, body []byte, secrets []string) (string, *ErrorResponse) {
+	signature := giteaHeader(r, "Signature")
+	if signature == "" {
+		return "", &ErrorResponse{nil, http.StatusUnauthorized, "Please provide a X-Gitea-Signature"}
+	}
+	messageMAC, err := hex.DecodeString(signature)
+	if err != nil {
+		return "", &ErrorResponse{nil, http.StatusForbidden, "Bad X-Gitea-Signature"}
+	}
+	for _, secret := range secrets {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		if hmac.Equal(messageMAC, mac.Sum(nil)) {
+			return secret, nil
+		}
+	}
+	return "", &ErrorResponse{nil, http.StatusForbidden, "Bad X-Gitea-Signature"}
+}
+
+// giteaLabels remembers the labels of the pull requests the webhooks were
+// about, because Gitea's label webhooks only include the pull request's
+// current labels, not the label that was added or removed.
+type giteaLabels struct {
+	mutex  sync.Mutex
+	labels map[string][]string
+}
+
+// update remembers the pull request's current labels and returns the labels
+// it had before. The labels of pull requests no webhook was received for yet
+// are unknown, so all of their labels count as added.
+func (l *giteaLabels) update(key string, current []string) []string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	previous := l.labels[key]
+	l.labels[key] = current
+	return previous
+}
+
+func (l *giteaLabels) forget(key string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	delete(l.labels, key)
+}
+
+// translateGiteaWebhook translates the webhook to GitHub's webhooks. A label
+// change that adds and removes several labels translates to a webhook per
+// label. Events without a GitHub counterpart translate to none.
+func translateGiteaWebhook(event string, webhook map[string]interface{}, labels *giteaLabels,
+	associations AuthorAssociations) ([]webhookTranslation, *ErrorResponse) {
+
+	switch event {
+	case "pull_request":
+		return translateGiteaPullRequestEvent(webhook, labels), nil
+	case "pull_request_approved", "pull_request_rejected", "pull_request_comment":
+		association, errResp := giteaSenderAssociation(webhook, associations)
+		if errResp != nil {
+			return nil, errResp
+		}
+		states := map[string]string{
+			"pull_request_approved": "approved",
+			"pull_request_rejected": "changes_requested",
+			"pull_request_comment":  "commented",
+		}
+		review, _ := webhook["review"].(map[string]interface{})
+		return []webhookTranslation{{"pull_request_review", map[string]interface{}{
+			"action": "submitted",
+			"review": map[string]interface{}{
+				"state":              states[event],
+				"body":               review["content"],
+				"user":               webhook["sender"],
+				"author_association": association,
+			},
+			"pull_request": webhook["pull_request"],
+			"repository":   webhook["repository"],
+			"sender":       webhook["sender"],
+		}}}, nil
+	case "issue_comment":
+		if isPull, _ := webhook["is_pull"].(bool); !isPull {
+			return nil, nil
+		}
+		association, errResp := giteaSenderAssociation(webhook, associations)
+		if errResp != nil {
+			return nil, errResp
+		}
+		// The issue's pull request field lacks the URL GitHub's has and the
+		// comment's GraphQL ID is replaced with a stable one, so that the
+		// comment's command would only be run once
+		if issue, ok := webhook["issue"].(map[string]interface{}); ok {
+			issue["pull_request"] = map[string]interface{}{"url": issue["html_url"]}
+		}
+		if comment, ok := webhook["comment"].(map[string]interface{}); ok {
+			comment["node_id"] = fmt.Sprintf("gitea-comment-%v", comment["id"])
+			comment["author_association"] = association
+		}
+		return []webhookTranslation{{"issue_comment", webhook}}, nil
+	case "push":
+		after, _ := webhook["after"].(string)
+		webhook["deleted"] = after != "" && strings.Trim(after, "0") == ""
+		return []webhookTranslation{{"push", webhook}}, nil
+	case "status":
+		return []webhookTranslation{{"status", webhook}}, nil
+	}
+	return nil, nil
+}
+
+// giteaSenderAssociation looks up the association of the webhook's sender
+// with the webhook's repository.
+func giteaSenderAssociation(webhook map[string]interface{}, associations AuthorAssociations) (string,
+	*ErrorResponse) {
+
+	repository, _ := webhook["repository"].(map[string]interface{})
+	owner, _ := repository["owner"].(map[string]interface{})
+	sender, _ := webhook["sender"].(map[string]interface{})
+	ownerLogin, _ := owner["login"].(string)
+	name, _ := repository["name"].(string)
+	login, _ := sender["login"].(string)
+	return authorAssociation(Repository{Owner: ownerLogin, Name: name}, login, associations)
+}
+
+// translateGiteaPullRequestEvent translates the actions Gitea names
+// differently. Label changes are translated to an event per added or removed
+// label.
+func translateGiteaPullRequestEvent(webhook map[string]interface{}, labels *giteaLabels) []webhookTranslation {
+	pr, _ := webhook["pull_request"].(map[string]interface{})
+	repository, _ := webhook["repository"].(map[string]interface{})
+	key := fmt.Sprintf("%v#%v", repository["full_name"], webhook["number"])
+	current := giteaLabelNames(pr["labels"])
+	action, _ := webhook["action"].(string)
+	switch action {
+	case "synchronized":
+		webhook["action"] = "synchronize"
+	case "closed":
+		labels.forget(key)
+		return []webhookTranslation{{"pull_request", webhook}}
+	case "label_updated", "label_cleared":
+		previous := labels.update(key, current)
+		var translations []webhookTranslation
+		for _, label := range current {
+			if !containsLabel(previous, label) {
+				translations = append(translations, giteaLabelTranslation(webhook, "labeled", label))
+			}
+		}
+		for _, label := range previous {
+			if !containsLabel(current, label) {
+				translations = append(translations, giteaLabelTranslation(webhook, "unlabeled", label))
+			}
+		}
+		return translations
+	}
+	labels.update(key, current)
+	return []webhookTranslation{{"pull_request", webhook}}
+}
+
+func giteaLabelTranslation(webhook map[string]interface{}, action, label string) webhookTranslation {
+	translated := make(map[string]interface{}, len(webhook)+1)
+	for key, value := range webhook {
+		translated[key] = value
+	}
+	translated["action"] = action
+	translated["label"] = map[string]interface{}{"name": label}
+	return webhookTranslation{"pull_request", translated}
+}
+
+func giteaLabelNames(labels interface{}) []string {
+	list, _ := labels.([]interface{})
+	names := []string{}
+	for _, label := range list {
+		if fields, ok := label.(map[string]interface{}); ok {
+			if name, ok := fields["name"].(string); ok {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,166 @@
+package main_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CreateGiteaWebhookHandler", func() {
+	const secret = "a-secret"
+
+	var (
+		handler          http.Handler
+		associations     *mocks.AuthorAssociations
+		responseRecorder *httptest.ResponseRecorder
+		translated       []translatedWebhook
+		signingSecret    string
+	)
+
+	sign := func(body string) string {
+		mac := hmac.New(sha256.New, []byte(signingSecret))
+		mac.Write([]byte(body))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+
+	BeforeEach(func() {
+		translated = nil
+		signingSecret = secret
+		associations = new(mocks.AuthorAssociations)
+		associations.
+			On("AuthorAssociation", anyContext, "acme", "widget", "reviewer").
+			Return("COLLABORATOR", noError)
+		handler = grh.CreateGiteaWebhookHandler(grh.Config{Secrets: []string{secret}}, associations,
+			func(w http.ResponseWriter, r *http.Request) grh.Response {
+				body, err := ioutil.ReadAll(r.Body)
+				Expect(err).NotTo(HaveOccurred())
+				translated = append(translated, translatedWebhook{
+					event:     r.Header.Get("X-Github-Event"),
+					signature: r.Header.Get("X-Hub-Signature-256"),
+					body:      body,
+				})
+				return grh.SuccessResponse{}
+			})
+	})
+
+	handle := func(event, webhook string) {
+		responseRecorder = httptest.NewRecorder()
+		request, err := http.NewRequest("POST", "/gitea", strings.NewReader(webhook))
+		Expect(err).NotTo(HaveOccurred())
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("X-Gitea-Event", event)
+		request.Header.Set("X-Gitea-Signature", sign(webhook))
+		handler.ServeHTTP(responseRecorder, request)
+	}
+
+	field := func(body []byte, path ...string) interface{} {
+		var value interface{}
+		Expect(json.Unmarshal(body, &value)).To(Succeed())
+		for _, key := range path {
+			value = value.(map[string]interface{})[key]
+		}
+		return value
+	}
+
+	Context("with a comment on a pull request", func() {
+		const webhook = `{
+  "action": "created",
+  "is_pull": true,
+  "issue": {"number": 7, "html_url": "https://gitea.example.com/acme/widget/pulls/7", "user": {"login": "author"}},
+  "comment": {"id": 1001, "body": "!merge", "user": {"login": "reviewer"}},
+  "repository": {"name": "widget", "owner": {"login": "acme"}},
+  "sender": {"login": "reviewer"}
+}`
+
+		It("passes it on as a signed issue_comment webhook about a PR", func() {
+			handle("issue_comment", webhook)
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			Expect(translated).To(HaveLen(1))
+			Expect(translated[0].event).To(Equal("issue_comment"))
+			Expect(field(translated[0].body, "issue", "pull_request", "url")).
+				To(Equal("https://gitea.example.com/acme/widget/pulls/7"))
+			Expect(field(translated[0].body, "comment", "node_id")).To(Equal("gitea-comment-1001"))
+			Expect(field(translated[0].body, "comment", "author_association")).To(Equal("COLLABORATOR"))
+
+			mac := hmac.New(sha256.New, []byte(secret))
+			mac.Write(translated[0].body)
+			Expect(translated[0].signature).To(Equal("sha256=" + hex.EncodeToString(mac.Sum(nil))))
+		})
+
+		Context("signed with another secret", func() {
+			BeforeEach(func() {
+				signingSecret = "not-the-secret"
+			})
+
+			It("refuses the webhook", func() {
+				handle("issue_comment", webhook)
+				Expect(responseRecorder.Code).To(Equal(http.StatusForbidden))
+				Expect(translated).To(BeEmpty())
+			})
+		})
+	})
+
+	Context("with label changes", func() {
+		labelUpdate := func(labels string) string {
+			return `{
+  "action": "label_updated",
+  "number": 7,
+  "pull_request": {"number": 7, "labels": [` + labels + `]},
+  "repository": {"name": "widget", "full_name": "acme/widget", "owner": {"login": "acme"}}
+}`
+		}
+
+		It("passes on a webhook per added and removed label", func() {
+			handle("pull_request", labelUpdate(`{"name": "on hold"}`))
+			Expect(translated).To(HaveLen(1))
+			Expect(field(translated[0].body, "action")).To(Equal("labeled"))
+			Expect(field(translated[0].body, "label", "name")).To(Equal(grh.OnHoldLabel))
+
+			translated = nil
+			handle("pull_request", labelUpdate(`{"name": "merging"}`))
+			Expect(translated).To(HaveLen(2))
+			Expect(field(translated[0].body, "action")).To(Equal("labeled"))
+			Expect(field(translated[0].body, "label", "name")).To(Equal(grh.MergingLabel))
+			Expect(field(translated[1].body, "action")).To(Equal("unlabeled"))
+			Expect(field(translated[1].body, "label", "name")).To(Equal(grh.OnHoldLabel))
+		})
+	})
+
+	Context("with a push to a pull request", func() {
+		It("passes it on as a synchronize action", func() {
+			handle("pull_request", `{"action": "synchronized", "number": 7, "pull_request": {"number": 7}}`)
+			Expect(translated).To(HaveLen(1))
+			Expect(translated[0].event).To(Equal("pull_request"))
+			Expect(field(translated[0].body, "action")).To(Equal("synchronize"))
+		})
+	})
+
+	Context("with an approval", func() {
+		It("passes it on as an approving review", func() {
+			handle("pull_request_approved", `{
+  "action": "reviewed",
+  "number": 7,
+  "pull_request": {"number": 7},
+  "review": {"type": "pull_request_review_approved", "content": "LGTM"},
+  "repository": {"name": "widget", "owner": {"login": "acme"}},
+  "sender": {"login": "reviewer"}
+}`)
+			Expect(translated).To(HaveLen(1))
+			Expect(translated[0].event).To(Equal("pull_request_review"))
+			Expect(field(translated[0].body, "review", "state")).To(Equal("approved"))
+			Expect(field(translated[0].body, "review", "user", "login")).To(Equal("reviewer"))
+			Expect(field(translated[0].body, "review", "author_association")).To(Equal("COLLABORATOR"))
+		})
+	})
+})
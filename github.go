@@ -6,35 +6,69 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 
 	"github.com/google/go-github/github"
 )
 
 var ErrNotMergeable = errors.New("PullRequests is not mergeable.")
 var ErrMergeConflict = errors.New("Merge failed because of a merge conflict.")
+var ErrBaseBranchModified = errors.New("Merge failed because the base branch was modified.")
+var ErrLinearHistoryRequired = errors.New("Merge failed because the base branch requires linear history.")
 
 type PullRequests interface {
 	Get(ctx context.Context, owner, repo string, number int) (*github.PullRequest, *github.Response, error)
 	ListCommits(ctx context.Context, owner, repo string, number int, opt *github.ListOptions) ([]*github.RepositoryCommit, *github.Response, error)
 	Merge(ctx context.Context, owner, repo string, number int, commitMessage string, opt *github.PullRequestOptions) (*github.PullRequestMergeResult, *github.Response, error)
+	ListReviews(ctx context.Context, owner, repo string, number int, opt *github.ListOptions) ([]*github.PullRequestReview, *github.Response, error)
+	ListFiles(ctx context.Context, owner, repo string, number int, opt *github.ListOptions) ([]*github.CommitFile, *github.Response, error)
+	RequestReviewers(ctx context.Context, owner, repo string, number int, reviewers github.ReviewersRequest) (*github.PullRequest, *github.Response, error)
+	Create(ctx context.Context, owner, repo string, pull *github.NewPullRequest) (*github.PullRequest, *github.Response, error)
+	CreateReview(ctx context.Context, owner, repo string, number int, review *github.PullRequestReviewRequest) (*github.PullRequestReview, *github.Response, error)
 }
 
 type Repositories interface {
+	Get(ctx context.Context, owner, repo string) (*github.Repository, *github.Response, error)
+	CompareCommits(ctx context.Context, owner, repo string, base, head string) (*github.CommitsComparison, *github.Response, error)
 	CreateStatus(ctx context.Context, owner, repo, ref string, status *github.RepoStatus) (*github.RepoStatus, *github.Response, error)
 	GetCombinedStatus(ctx context.Context, owner, repo, ref string, opt *github.ListOptions) (*github.CombinedStatus, *github.Response, error)
 	IsCollaborator(ctx context.Context, owner, repo, user string) (bool, *github.Response, error)
+	GetRequiredStatusChecks(ctx context.Context, owner, repo, branch string) (*github.RequiredStatusChecks, *github.Response, error)
+	ListReleases(ctx context.Context, owner, repo string, opt *github.ListOptions) ([]*github.RepositoryRelease, *github.Response, error)
+	CreateRelease(ctx context.Context, owner, repo string, release *github.RepositoryRelease) (*github.RepositoryRelease, *github.Response, error)
+	EditRelease(ctx context.Context, owner, repo string, id int, release *github.RepositoryRelease) (*github.RepositoryRelease, *github.Response, error)
+	CreateComment(ctx context.Context, owner, repo, sha string, comment *github.RepositoryComment) (*github.RepositoryComment, *github.Response, error)
+	CreateDeployment(ctx context.Context, owner, repo string, request *github.DeploymentRequest) (*github.Deployment, *github.Response, error)
+	Merge(ctx context.Context, owner, repo string, request *github.RepositoryMergeRequest) (*github.RepositoryCommit, *github.Response, error)
 }
 
 type Issues interface {
 	AddLabelsToIssue(ctx context.Context, owner, repo string, number int, labels []string) ([]*github.Label, *github.Response, error)
 	RemoveLabelForIssue(ctx context.Context, owner, repo string, number int, label string) (*github.Response, error)
 	CreateComment(ctx context.Context, owner string, repo string, number int, comment *github.IssueComment) (*github.IssueComment, *github.Response, error)
+	EditComment(ctx context.Context, owner string, repo string, id int64, comment *github.IssueComment) (*github.IssueComment, *github.Response, error)
+	ListLabelsByIssue(ctx context.Context, owner string, repo string, number int, opt *github.ListOptions) ([]*github.Label, *github.Response, error)
+	ListByRepo(ctx context.Context, owner string, repo string, opt *github.IssueListByRepoOptions) ([]*github.Issue, *github.Response, error)
+	AddAssignees(ctx context.Context, owner, repo string, number int, assignees []string) (*github.Issue, *github.Response, error)
+	RemoveAssignees(ctx context.Context, owner, repo string, number int, assignees []string) (*github.Issue, *github.Response, error)
+	Edit(ctx context.Context, owner string, repo string, number int, issue *github.IssueRequest) (*github.Issue, *github.Response, error)
+	ListMilestones(ctx context.Context, owner string, repo string, opt *github.MilestoneListOptions) ([]*github.Milestone, *github.Response, error)
+	CreateMilestone(ctx context.Context, owner string, repo string, milestone *github.Milestone) (*github.Milestone, *github.Response, error)
+	Lock(ctx context.Context, owner string, repo string, number int, opt *github.LockIssueOptions) (*github.Response, error)
+	Unlock(ctx context.Context, owner string, repo string, number int) (*github.Response, error)
 }
 
 type Search interface {
 	Issues(ctx context.Context, query string, opt *github.SearchOptions) (*github.IssuesSearchResult, *github.Response, error)
 }
 
+// AuthorAssociations looks up the author_association GitHub would give the
+// user's comments on the repository, for the providers whose webhooks don't
+// say how the commenter is associated with the repository.
+type AuthorAssociations interface {
+	AuthorAssociation(ctx context.Context, owner, repo, username string) (string, error)
+}
+
 func setStatusForPREvent(pullRequestEvent PullRequestEvent, status *github.RepoStatus, repositories Repositories) *ErrorResponse {
 	// see comment in setStatusForPR for why Head is used instead of Base here
 	repository := pullRequestEvent.Head.Repository
@@ -77,7 +111,12 @@ func setStatus(revision string, repository Repository, status *github.RepoStatus
 }
 
 func getStatuses(pr *github.PullRequest, repositories Repositories) (string, []github.RepoStatus, *ErrorResponse) {
-	headRepository := headRepository(pr)
+	return getStatusesForRef(headRepository(pr), *pr.Head.SHA, repositories)
+}
+
+func getStatusesForRef(repository Repository, ref string, repositories Repositories) (string, []github.RepoStatus,
+	*ErrorResponse) {
+
 	pageNr := 1
 	statuses := []github.RepoStatus{}
 	var state string
@@ -88,10 +127,10 @@ func getStatuses(pr *github.PullRequest, repositories Repositories) (string, []g
 			// https://developer.github.com/v3/repos/statuses/#get-the-combined-status-for-a-specific-ref
 			PerPage: 100,
 		}
-		combinedStatus, resp, err := repositories.GetCombinedStatus(context.TODO(), headRepository.Owner,
-			headRepository.Name, *pr.Head.SHA, listOptions)
+		combinedStatus, resp, err := repositories.GetCombinedStatus(context.TODO(), repository.Owner,
+			repository.Name, ref, listOptions)
 		if err != nil {
-			message := fmt.Sprintf("Failed to get combined status for ref %s", *pr.Head.SHA)
+			message := fmt.Sprintf("Failed to get combined status for ref %s", ref)
 			return "", nil, &ErrorResponse{err, http.StatusBadGateway, message}
 		}
 		// Although the combined state should be the same for all pages, use
@@ -104,7 +143,30 @@ func getStatuses(pr *github.PullRequest, repositories Repositories) (string, []g
 		}
 		pageNr = resp.NextPage
 	}
-	return state, statuses, nil
+	return stateWithoutMergeStatus(state, statuses), statuses, nil
+}
+
+// getRequiredStatusContexts returns the status contexts the branch protection
+// of the PR's base branch requires to pass. Unprotected branches don't
+// require any.
+func getRequiredStatusContexts(pr *github.PullRequest, repositories Repositories) ([]string, *ErrorResponse) {
+	return getBranchRequiredStatusContexts(baseRepository(pr), *pr.Base.Ref, repositories)
+}
+
+// getBranchRequiredStatusContexts returns the status contexts the branch's
+// protection requires to pass.
+func getBranchRequiredStatusContexts(repository Repository, branch string, repositories Repositories) ([]string,
+	*ErrorResponse) {
+
+	requiredChecks, resp, err := repositories.GetRequiredStatusChecks(context.TODO(), repository.Owner,
+		repository.Name, branch)
+	if is404Error(resp) {
+		return []string{}, nil
+	} else if err != nil {
+		message := fmt.Sprintf("Failed to get the required status checks for branch %s", branch)
+		return nil, &ErrorResponse{err, http.StatusBadGateway, message}
+	}
+	return requiredChecks.Contexts, nil
 }
 
 func searchIssues(query string, search Search) ([]github.Issue, error) {
@@ -142,6 +204,80 @@ func getPR(issueable Issueable, pullRequests PullRequests) (*github.PullRequest,
 	return pr, nil
 }
 
+func getReviews(issueable Issueable, pullRequests PullRequests) ([]*github.PullRequestReview, *ErrorResponse) {
+	issue := issueable.Issue()
+	pageNr := 1
+	reviews := []*github.PullRequestReview{}
+	for {
+		listOptions := &github.ListOptions{
+			Page:    pageNr,
+			PerPage: 100,
+		}
+		pageReviews, resp, err := pullRequests.ListReviews(context.TODO(), issue.Repository.Owner,
+			issue.Repository.Name, issue.Number, listOptions)
+		if err != nil {
+			message := fmt.Sprintf("Getting reviews for PR %s failed", issue.FullName())
+			return nil, &ErrorResponse{err, http.StatusBadGateway, message}
+		}
+		reviews = append(reviews, pageReviews...)
+		if resp.NextPage == 0 {
+			break
+		}
+		pageNr = resp.NextPage
+	}
+	return reviews, nil
+}
+
+func getPRFiles(issueable Issueable, pullRequests PullRequests) ([]*github.CommitFile, *ErrorResponse) {
+	issue := issueable.Issue()
+	pageNr := 1
+	files := []*github.CommitFile{}
+	for {
+		listOptions := &github.ListOptions{
+			Page:    pageNr,
+			PerPage: 100,
+		}
+		pageFiles, resp, err := pullRequests.ListFiles(context.TODO(), issue.Repository.Owner,
+			issue.Repository.Name, issue.Number, listOptions)
+		if err != nil {
+			message := fmt.Sprintf("Getting files for PR %s failed", issue.FullName())
+			return nil, &ErrorResponse{err, http.StatusBadGateway, message}
+		}
+		files = append(files, pageFiles...)
+		if resp.NextPage == 0 {
+			break
+		}
+		pageNr = resp.NextPage
+	}
+	return files, nil
+}
+
+func getLabels(issueable Issueable, issues Issues) ([]string, *ErrorResponse) {
+	issue := issueable.Issue()
+	pageNr := 1
+	labels := []string{}
+	for {
+		listOptions := &github.ListOptions{
+			Page:    pageNr,
+			PerPage: 100,
+		}
+		pageLabels, resp, err := issues.ListLabelsByIssue(context.TODO(), issue.Repository.Owner,
+			issue.Repository.Name, issue.Number, listOptions)
+		if err != nil {
+			message := fmt.Sprintf("Getting labels for PR %s failed", issue.FullName())
+			return nil, &ErrorResponse{err, http.StatusBadGateway, message}
+		}
+		for _, label := range pageLabels {
+			labels = append(labels, *label.Name)
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		pageNr = resp.NextPage
+	}
+	return labels, nil
+}
+
 func getCommits(issueable Issueable, isExpectedHead func(string) bool,
 	pullRequests PullRequests) ([]*github.RepositoryCommit, *asyncErrorResponse) {
 
@@ -150,8 +286,10 @@ func getCommits(issueable Issueable, isExpectedHead func(string) bool,
 	commits := []*github.RepositoryCommit{}
 	for {
 		listOptions := &github.ListOptions{
-			Page:    pageNr,
-			PerPage: 30,
+			Page: pageNr,
+			// The maximum. A PR can list up to 250 commits:
+			// https://developer.github.com/v3/pulls/#list-commits-on-a-pull-request
+			PerPage: 100,
 		}
 		pageCommits, resp, err := pullRequests.ListCommits(context.TODO(), issue.Repository.Owner,
 			issue.Repository.Name, issue.Number, listOptions)
@@ -251,22 +389,39 @@ func removeLabel(repository Repository, issueNumber int, label string, issues Is
 	return nil
 }
 
-func merge(repository Repository, issueNumber int, pullRequests PullRequests) error {
-	additionalCommitMessage := ""
-	opt := &github.PullRequestOptions{MergeMethod: "merge"}
+// merge merges the PR with the merge method ("merge", "squash" or "rebase")
+// and returns the SHA of the resulting commit. The empty fields of the
+// message are left to GitHub. Rebase merges keep the original commits and
+// ignore it.
+func merge(repository Repository, issueNumber int, mergeMethod string, message commitMessage,
+	pullRequests PullRequests) (string, error) {
+
+	opt := &github.PullRequestOptions{MergeMethod: mergeMethod, CommitTitle: message.Title}
 	result, resp, err := pullRequests.Merge(context.TODO(), repository.Owner, repository.Name,
-		issueNumber, additionalCommitMessage, opt)
+		issueNumber, message.Body, opt)
 	if err != nil {
 		if resp != nil && resp.StatusCode == http.StatusMethodNotAllowed {
-			return ErrNotMergeable
+			// GitHub refuses the merge, if the base branch moved after it
+			// had checked the PR's mergeability
+			if errResp, ok := err.(*github.ErrorResponse); ok &&
+				strings.Contains(errResp.Message, "Base branch was modified") {
+				return "", ErrBaseBranchModified
+			} else if ok && mergeMethod == "merge" &&
+				strings.Contains(errResp.Message, "must not contain merge commits") {
+				// Branches requiring linear history refuse merge commits.
+				// Other refusals mentioning merge commits, e.g. the
+				// repository not allowing them, aren't worked around.
+				return "", ErrLinearHistoryRequired
+			}
+			return "", ErrNotMergeable
 		} else if resp != nil && resp.StatusCode == http.StatusConflict {
-			return ErrMergeConflict
+			return "", ErrMergeConflict
 		}
-		return err
+		return "", err
 	} else if result.Merged == nil || !*result.Merged {
-		return errors.New("Request successful, but PR not merged.")
+		return "", errors.New("Request successful, but PR not merged.")
 	}
-	return nil
+	return result.GetSHA(), nil
 }
 
 func comment(message string, repository Repository, issueNumber int, issues Issues) error {
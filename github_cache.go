@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"expvar"
+	"net/http"
+	"net/http/httputil"
+	"regexp"
+	"sync"
+
+	"github.com/gregjones/httpcache"
+)
+
+// The reads that are repeated for the same PR whenever its statuses, reviews
+// or labels change
+var conditionallyCachedPaths = []*regexp.Regexp{
+	regexp.MustCompile(`^/repos/[^/]+/[^/]+/pulls/\d+$`),
+	regexp.MustCompile(`^/repos/[^/]+/[^/]+/commits/[^/]+/status$`),
+	regexp.MustCompile(`^/repos/[^/]+/[^/]+/issues/\d+/labels$`),
+}
+
+// conditionalRequestHits counts the reads that GitHub answered with 304 Not
+// Modified. Reported by /debug/vars.
+var conditionalRequestHits = expvar.NewInt("conditional_request_hits")
+
+// ConditionalRequestTransport caches the responses of PR, status and label
+// reads and revalidates them with If-None-Match and If-Modified-Since on
+// every read. GitHub doesn't count 304 Not Modified responses against the
+// rate limit, so repeatedly evaluating an unchanged PR is nearly free.
+// Unlike httpcache, which serves responses from the cache for as long as
+// GitHub's max-age allows, the reads are never stale. Other requests are
+// passed on to Next.
+type ConditionalRequestTransport struct {
+	Transport http.RoundTripper
+	Next      http.RoundTripper
+
+	sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	// The most recently used entries are at the front
+	recency *list.List
+}
+
+type conditionalCacheEntry struct {
+	key          string
+	etag         string
+	lastModified string
+	response     []byte
+}
+
+// NewConditionalRequestTransport creates a transport that caches the
+// responses of at most capacity reads, evicting the least recently used ones.
+func NewConditionalRequestTransport(transport, next http.RoundTripper, capacity int) *ConditionalRequestTransport {
+	return &ConditionalRequestTransport{
+		Transport: transport,
+		Next:      next,
+		capacity:  capacity,
+		entries:   make(map[string]*list.Element),
+		recency:   list.New(),
+	}
+}
+
+func (t *ConditionalRequestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || !isConditionallyCachedPath(req.URL.Path) {
+		return t.Next.RoundTrip(req)
+	}
+	// Preview media types change the shape of the response
+	key := req.URL.String() + " " + req.Header.Get("Accept")
+	cached := t.get(key)
+	if cached != nil {
+		req = cloneRequest(req)
+		if cached.etag != "" {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+	resp, err := t.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		resp.Body.Close()
+		cachedResp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(cached.response)), req)
+		if err != nil {
+			return nil, err
+		}
+		// The rate limit headers of the 304 are the current ones
+		for _, header := range []string{"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset"} {
+			if value := resp.Header.Get(header); value != "" {
+				cachedResp.Header.Set(header, value)
+			}
+		}
+		cachedResp.Header.Set(httpcache.XFromCache, "1")
+		conditionalRequestHits.Add(1)
+		return cachedResp, nil
+	}
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if resp.StatusCode != http.StatusOK || (etag == "" && lastModified == "") {
+		return resp, nil
+	}
+	dumped, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	t.put(&conditionalCacheEntry{key: key, etag: etag, lastModified: lastModified, response: dumped})
+	// DumpResponse has replaced the read body with a copy
+	return resp, nil
+}
+
+func (t *ConditionalRequestTransport) get(key string) *conditionalCacheEntry {
+	t.Lock()
+	defer t.Unlock()
+	element, exists := t.entries[key]
+	if !exists {
+		return nil
+	}
+	t.recency.MoveToFront(element)
+	return element.Value.(*conditionalCacheEntry)
+}
+
+func (t *ConditionalRequestTransport) put(entry *conditionalCacheEntry) {
+	t.Lock()
+	defer t.Unlock()
+	if element, exists := t.entries[entry.key]; exists {
+		element.Value = entry
+		t.recency.MoveToFront(element)
+		return
+	}
+	t.entries[entry.key] = t.recency.PushFront(entry)
+	for t.recency.Len() > t.capacity {
+		oldest := t.recency.Back()
+		t.recency.Remove(oldest)
+		delete(t.entries, oldest.Value.(*conditionalCacheEntry).key)
+	}
+}
+
+func isConditionallyCachedPath(path string) bool {
+	for _, pathRegexp := range conditionallyCachedPaths {
+		if pathRegexp.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// cloneRequest copies the request, so that its headers could be changed
+// without changing the caller's request, as http.RoundTripper requires.
+func cloneRequest(req *http.Request) *http.Request {
+	clone := new(http.Request)
+	*clone = *req
+	clone.Header = make(http.Header, len(req.Header))
+	for name, values := range req.Header {
+		clone.Header[name] = append([]string(nil), values...)
+	}
+	return clone
+}
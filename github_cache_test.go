@@ -0,0 +1,99 @@
+package main_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+
+	grh "github.com/salemove/github-review-helper"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+var _ = Describe("ConditionalRequestTransport", func() {
+	var (
+		server     *httptest.Server
+		client     *http.Client
+		version    string
+		fullReads  int
+		notMatched int
+	)
+
+	BeforeEach(func() {
+		version, fullReads, notMatched = "1", 0, 0
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			etag := fmt.Sprintf("\"%s\"", version)
+			if r.Header.Get("If-None-Match") == etag {
+				w.Header().Set("X-RateLimit-Remaining", "4999")
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			fullReads++
+			w.Header().Set("ETag", etag)
+			w.Header().Set("X-RateLimit-Remaining", "4998")
+			fmt.Fprintf(w, "version %s of %s", version, r.URL.Path)
+		}))
+		next := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			notMatched++
+			return http.DefaultTransport.RoundTrip(req)
+		})
+		client = &http.Client{Transport: grh.NewConditionalRequestTransport(http.DefaultTransport, next, 1)}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	get := func(path string) (*http.Response, string) {
+		resp, err := client.Get(server.URL + path)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return resp, string(body)
+	}
+
+	It("answers unchanged PR reads from the cache", func() {
+		get("/repos/salemove/grh/pulls/7")
+		resp, body := get("/repos/salemove/grh/pulls/7")
+
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(body).To(Equal("version 1 of /repos/salemove/grh/pulls/7"))
+		Expect(resp.Header.Get("X-From-Cache")).To(Equal("1"))
+		Expect(resp.Header.Get("X-RateLimit-Remaining")).To(Equal("4999"))
+		Expect(fullReads).To(Equal(1))
+	})
+
+	It("reads changed statuses again", func() {
+		get("/repos/salemove/grh/commits/abc123/status")
+		version = "2"
+		resp, body := get("/repos/salemove/grh/commits/abc123/status")
+
+		Expect(body).To(Equal("version 2 of /repos/salemove/grh/commits/abc123/status"))
+		Expect(resp.Header.Get("X-From-Cache")).To(BeEmpty())
+		Expect(fullReads).To(Equal(2))
+	})
+
+	It("evicts the least recently used reads", func() {
+		get("/repos/salemove/grh/issues/7/labels")
+		get("/repos/salemove/grh/issues/8/labels")
+		get("/repos/salemove/grh/issues/7/labels")
+
+		Expect(fullReads).To(Equal(3))
+	})
+
+	It("passes other requests on", func() {
+		get("/repos/salemove/grh/pulls/7/reviews")
+
+		Expect(notMatched).To(Equal(1))
+		Expect(fullReads).To(Equal(1))
+	})
+})
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// The components of the GitHub status page whose incidents the bot can't
+// work through
+var githubIncidentComponents = map[string]bool{
+	"API Requests": true,
+	"Webhooks":     true,
+}
+
+var githubStatusHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// GithubIncident is an unresolved incident on the GitHub status page that
+// affects the API or webhooks.
+type GithubIncident struct {
+	Name  string    `json:"name"`
+	URL   string    `json:"url"`
+	Since time.Time `json:"since"`
+}
+
+// githubIncident holds the incident the merges and background jobs are
+// paused for, if any.
+var githubIncident struct {
+	sync.Mutex
+	current *GithubIncident
+}
+
+// ActiveGithubIncident returns the incident the bot is currently paused for
+// or nil, if there's none.
+func ActiveGithubIncident() *GithubIncident {
+	githubIncident.Lock()
+	defer githubIncident.Unlock()
+	return githubIncident.current
+}
+
+func setGithubIncident(incident *GithubIncident) {
+	githubIncident.Lock()
+	defer githubIncident.Unlock()
+	if incident != nil && githubIncident.current == nil {
+		log.Printf("GitHub is having an incident (%s). Pausing merges and background jobs.\n", incident.Name)
+	} else if incident == nil && githubIncident.current != nil {
+		log.Printf("The GitHub incident (%s) has been resolved. Resuming merges and background jobs.\n",
+			githubIncident.current.Name)
+	}
+	githubIncident.current = incident
+}
+
+// pausedForGithubIncident reports whether the background job should skip its
+// run, because GitHub is having an incident.
+func pausedForGithubIncident(job string) bool {
+	incident := ActiveGithubIncident()
+	if incident == nil {
+		return false
+	}
+	log.Printf("Skipping %s during the GitHub incident (%s).\n", job, incident.Name)
+	return true
+}
+
+// runGithubStatusChecks periodically checks the GitHub status page for
+// incidents until stop is closed.
+func runGithubStatusChecks(configSource ConfigSource, stop <-chan struct{}) {
+	interval := configSource.Current().GithubStatusCheckInterval
+	if interval == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := CheckGithubStatus(configSource.Current()); err != nil {
+				log.Printf("Checking the GitHub status failed: %v\n", err)
+			}
+		}
+	}
+}
+
+// CheckGithubStatus pauses the merges and background jobs if the GitHub
+// status page lists an unresolved incident affecting the API or webhooks and
+// resumes them once there's none. The PRs whose merges were deferred during
+// the incident are merged by runDeferredMerges. If the status page can't be
+// reached, then the bot carries on as it was.
+func CheckGithubStatus(conf Config) error {
+	resp, err := githubStatusHTTPClient.Get(conf.GithubStatusURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("the status page responded with %s", resp.Status)
+	}
+	var unresolved struct {
+		Incidents []struct {
+			Name       string    `json:"name"`
+			Shortlink  string    `json:"shortlink"`
+			CreatedAt  time.Time `json:"created_at"`
+			Components []struct {
+				Name string `json:"name"`
+			} `json:"components"`
+		} `json:"incidents"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&unresolved); err != nil {
+		return fmt.Errorf("failed to parse the unresolved incidents: %v", err)
+	}
+	for _, incident := range unresolved.Incidents {
+		for _, component := range incident.Components {
+			if githubIncidentComponents[component.Name] {
+				setGithubIncident(&GithubIncident{
+					Name:  incident.Name,
+					URL:   incident.Shortlink,
+					Since: incident.CreatedAt,
+				})
+				return nil
+			}
+		}
+	}
+	setGithubIncident(nil)
+	return nil
+}
@@ -0,0 +1,108 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	grh "github.com/salemove/github-review-helper"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CheckGithubStatus", func() {
+	var (
+		server      *httptest.Server
+		conf        grh.Config
+		statusCode  int
+		unresolved  string
+		noIncidents = `{"incidents": []}`
+	)
+
+	BeforeEach(func() {
+		statusCode = http.StatusOK
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(statusCode)
+			w.Write([]byte(unresolved))
+		}))
+		conf = grh.Config{GithubStatusURL: server.URL}
+	})
+
+	AfterEach(func() {
+		statusCode, unresolved = http.StatusOK, noIncidents
+		Expect(grh.CheckGithubStatus(conf)).To(Succeed())
+		server.Close()
+	})
+
+	Context("with an incident affecting webhooks", func() {
+		BeforeEach(func() {
+			unresolved = `{"incidents": [{"name": "Delayed webhook deliveries",
+				"shortlink": "https://stspg.io/abc", "created_at": "2026-03-04T10:00:00Z",
+				"components": [{"name": "Webhooks"}]}]}`
+		})
+
+		It("pauses the merges", func() {
+			Expect(grh.CheckGithubStatus(conf)).To(Succeed())
+			incident := grh.ActiveGithubIncident()
+			Expect(incident).NotTo(BeNil())
+			Expect(incident.Name).To(Equal("Delayed webhook deliveries"))
+			Expect(incident.URL).To(Equal("https://stspg.io/abc"))
+		})
+
+		Context("and the incident having been resolved", func() {
+			It("resumes the merges", func() {
+				Expect(grh.CheckGithubStatus(conf)).To(Succeed())
+				unresolved = noIncidents
+				Expect(grh.CheckGithubStatus(conf)).To(Succeed())
+				Expect(grh.ActiveGithubIncident()).To(BeNil())
+			})
+		})
+
+		Context("and the status page failing later", func() {
+			It("stays paused", func() {
+				Expect(grh.CheckGithubStatus(conf)).To(Succeed())
+				statusCode = http.StatusServiceUnavailable
+				Expect(grh.CheckGithubStatus(conf)).NotTo(Succeed())
+				Expect(grh.ActiveGithubIncident()).NotTo(BeNil())
+			})
+		})
+
+		Context("with a deferred merge", func() {
+			It("keeps the merge deferred until the incident is resolved", func() {
+				store := grh.NewMemoryStore()
+				deferredIssue := grh.Issue{
+					Number:     issueNumber,
+					Repository: grh.Repository{Owner: repositoryOwner, Name: repositoryName},
+					User:       grh.User{Login: arbitraryIssueAuthor},
+				}
+				Expect(store.AddDeferredMerge(deferredIssue)).To(Succeed())
+				var mergedIssues []grh.Issue
+				merge := func(issue grh.Issue) grh.Response {
+					mergedIssues = append(mergedIssues, issue)
+					return grh.SuccessResponse{}
+				}
+
+				Expect(grh.CheckGithubStatus(conf)).To(Succeed())
+				Expect(grh.MergeDeferredPRs(conf, store, merge)).To(Succeed())
+				Expect(mergedIssues).To(BeEmpty())
+
+				unresolved = noIncidents
+				Expect(grh.CheckGithubStatus(conf)).To(Succeed())
+				Expect(grh.MergeDeferredPRs(conf, store, merge)).To(Succeed())
+				Expect(mergedIssues).To(Equal([]grh.Issue{deferredIssue}))
+			})
+		})
+	})
+
+	Context("with an incident not affecting the API or webhooks", func() {
+		BeforeEach(func() {
+			unresolved = `{"incidents": [{"name": "Degraded Pages builds",
+				"components": [{"name": "Pages"}]}]}`
+		})
+
+		It("doesn't pause the merges", func() {
+			Expect(grh.CheckGithubStatus(conf)).To(Succeed())
+			Expect(grh.ActiveGithubIncident()).To(BeNil())
+		})
+	})
+})
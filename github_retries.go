@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// githubRetryPolicy retries the GitHub API calls that failed with a server
+// error, doubling the backoff after every try. The server errors are usually
+// momentary and giving up on a mutation, e.g. on removing the "merging"
+// label after a merge, could leave a PR stranded.
+type githubRetryPolicy struct {
+	retries int
+	backoff time.Duration
+}
+
+// isGithubServerError reports whether the call failed with one of the
+// server errors GitHub responds with when it's having trouble.
+func isGithubServerError(resp *github.Response, err error) bool {
+	if err == nil || resp == nil || resp.Response == nil {
+		return false
+	}
+	switch resp.StatusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable:
+		return true
+	}
+	return false
+}
+
+func (p githubRetryPolicy) do(operation string, call func() (*github.Response, error)) error {
+	backoff := p.backoff
+	for try := 0; ; try++ {
+		resp, err := call()
+		if try >= p.retries || !isGithubServerError(resp, err) {
+			return err
+		}
+		log.Printf("%s failed with %d. Trying again in %s.\n", operation, resp.StatusCode, formatDuration(backoff))
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// retryGithubMutations wraps the clients, so that merging PRs, labeling them
+// and editing comments would be retried on GitHub's server errors up to
+// GITHUB_MUTATION_RETRIES times. New comments aren't retried, because GitHub
+// may have created the comment despite the error, and a retry would post it
+// twice.
+func retryGithubMutations(conf Config, pullRequests PullRequests, issues Issues) (PullRequests, Issues) {
+	if conf.GithubMutationRetries == 0 {
+		return pullRequests, issues
+	}
+	policy := githubRetryPolicy{retries: conf.GithubMutationRetries, backoff: conf.GithubMutationBackoff}
+	return retryingPullRequests{policy, pullRequests}, retryingIssues{policy, issues}
+}
+
+type retryingPullRequests struct {
+	policy githubRetryPolicy
+	PullRequests
+}
+
+func (r retryingPullRequests) Merge(ctx context.Context, owner, repo string, number int, commitMessage string,
+	opt *github.PullRequestOptions) (*github.PullRequestMergeResult, *github.Response, error) {
+
+	var result *github.PullRequestMergeResult
+	var resp *github.Response
+	err := r.policy.do("Merging a PR", func() (*github.Response, error) {
+		var err error
+		result, resp, err = r.PullRequests.Merge(ctx, owner, repo, number, commitMessage, opt)
+		return resp, err
+	})
+	return result, resp, err
+}
+
+type retryingIssues struct {
+	policy githubRetryPolicy
+	Issues
+}
+
+func (r retryingIssues) AddLabelsToIssue(ctx context.Context, owner, repo string, number int,
+	labels []string) ([]*github.Label, *github.Response, error) {
+
+	var result []*github.Label
+	var resp *github.Response
+	err := r.policy.do("Adding labels", func() (*github.Response, error) {
+		var err error
+		result, resp, err = r.Issues.AddLabelsToIssue(ctx, owner, repo, number, labels)
+		return resp, err
+	})
+	return result, resp, err
+}
+
+func (r retryingIssues) RemoveLabelForIssue(ctx context.Context, owner, repo string, number int,
+	label string) (*github.Response, error) {
+
+	var resp *github.Response
+	err := r.policy.do("Removing a label", func() (*github.Response, error) {
+		var err error
+		resp, err = r.Issues.RemoveLabelForIssue(ctx, owner, repo, number, label)
+		return resp, err
+	})
+	return resp, err
+}
+
+func (r retryingIssues) EditComment(ctx context.Context, owner string, repo string, id int64,
+	comment *github.IssueComment) (*github.IssueComment, *github.Response, error) {
+
+	var result *github.IssueComment
+	var resp *github.Response
+	err := r.policy.do("Editing a comment", func() (*github.Response, error) {
+		var err error
+		result, resp, err = r.Issues.EditComment(ctx, owner, repo, id, comment)
+		return resp, err
+	})
+	return result, resp, err
+}
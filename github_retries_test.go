@@ -0,0 +1,123 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("retrying GitHub's server errors", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			issues           *mocks.Issues
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			issues = *context.Issues
+
+			context.Config.GithubMutationRetries = 2
+			context.Config.GithubMutationBackoff = time.Millisecond
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!label +bug", arbitraryIssueAuthor)
+		})
+
+		serverError := func(code int) *github.Response {
+			return &github.Response{Response: &http.Response{StatusCode: code}}
+		}
+
+		ForCollaborator(context, repositoryOwner, repositoryName, arbitraryIssueAuthor, func() {
+			Context("with GitHub recovering within the retries", func() {
+				BeforeEach(func() {
+					issues.
+						On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+							[]string{"bug"}).
+						Return(emptyResult, serverError(http.StatusBadGateway), errArbitrary).
+						Once()
+					issues.
+						On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+							[]string{"bug"}).
+						Return(emptyResult, serverError(http.StatusServiceUnavailable), errArbitrary).
+						Once()
+					issues.
+						On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+							[]string{"bug"}).
+						Return(emptyResult, emptyResponse, noError).
+						Once()
+				})
+
+				It("adds the label", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertNumberOfCalls(GinkgoT(), "AddLabelsToIssue", 3)
+				})
+			})
+
+			Context("with GitHub failing longer than the retries", func() {
+				BeforeEach(func() {
+					issues.
+						On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+							[]string{"bug"}).
+						Return(emptyResult, serverError(http.StatusInternalServerError), errArbitrary)
+				})
+
+				It("fails with a gateway error", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusBadGateway))
+					issues.AssertNumberOfCalls(GinkgoT(), "AddLabelsToIssue", 3)
+				})
+			})
+
+			Context("with GitHub refusing the request", func() {
+				BeforeEach(func() {
+					issues.
+						On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+							[]string{"bug"}).
+						Return(emptyResult, serverError(http.StatusUnprocessableEntity), errArbitrary)
+				})
+
+				It("doesn't retry", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusBadGateway))
+					issues.AssertNumberOfCalls(GinkgoT(), "AddLabelsToIssue", 1)
+				})
+			})
+
+			Context("with commenting failing", func() {
+				requestJSON.Is(func() string {
+					return IssueCommentEvent("!label bug", arbitraryIssueAuthor)
+				})
+
+				BeforeEach(func() {
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.AnythingOfType("*github.IssueComment")).
+						Return(emptyResult, serverError(http.StatusBadGateway), errArbitrary)
+				})
+
+				It("doesn't retry, because the comment may have been posted anyway", func() {
+					handle()
+					issues.AssertNumberOfCalls(GinkgoT(), "CreateComment", 1)
+				})
+			})
+		})
+	})
+})
@@ -34,6 +34,7 @@ const (
 	sshURL               = "git@github.com:salemove/github-review-helper.git"
 	issueNumber          = 7
 	arbitraryIssueAuthor = "author"
+	commentNodeID        = "IC_kwDOABCDEF4AAAAB"
 	arbitrarySHA         = "1afdea0acb09ff392fcdb89acfa9d7e9feac4bc1"
 	numberOfGithubTries  = 4
 )
@@ -61,15 +62,23 @@ func TestGithubReviewHelper(t *testing.T) {
 }
 
 type WebhookTestContext struct {
+	// Config, ErrorReporter and AuditLog can be modified in BeforeEach
+	// blocks. The handler is created with them right before the request is
+	// handled.
+	Config           *grh.Config
+	ErrorReporter    *grh.ErrorReporter
+	AuditLog         *grh.AuditLog
 	RequestJSON      StringMemoizer
 	Headers          StringMapMemoizer
 	Handle           func()
 	ResponseRecorder **httptest.ResponseRecorder
 	GitRepos         **mocks.Repos
+	Store            *grh.Store
 	PullRequests     **mocks.PullRequests
 	Repositories     **mocks.Repositories
 	Issues           **mocks.Issues
 	Search           **mocks.Search
+	GraphQL          **mocks.GraphQL
 }
 
 type WebhookTest func(WebhookTestContext)
@@ -77,7 +86,9 @@ type WebhookTest func(WebhookTestContext)
 var TestWebhookHandler = func(test WebhookTest) bool {
 	Describe("webhook handler", func() {
 		var (
-			conf             grh.Config
+			conf             = new(grh.Config)
+			errorReporter    = new(grh.ErrorReporter)
+			auditLog         = new(grh.AuditLog)
 			asyncOperationWg *sync.WaitGroup
 
 			requestJSON = NewStringMemoizer(func() string {
@@ -91,18 +102,22 @@ var TestWebhookHandler = func(test WebhookTest) bool {
 			request          = new(*http.Request)
 			responseRecorder = new(*httptest.ResponseRecorder)
 			gitRepos         = new(*mocks.Repos)
+			store            = new(grh.Store)
 			pullRequests     = new(*mocks.PullRequests)
 			repositories     = new(*mocks.Repositories)
 			issues           = new(*mocks.Issues)
 			search           = new(*mocks.Search)
+			graphQL          = new(*mocks.GraphQL)
 		)
 
 		BeforeEach(func() {
 			*gitRepos = new(mocks.Repos)
+			*store = grh.NewMemoryStore()
 			*pullRequests = new(mocks.PullRequests)
 			*repositories = new(mocks.Repositories)
 			*issues = new(mocks.Issues)
 			*search = new(mocks.Search)
+			*graphQL = new(mocks.GraphQL)
 
 			*responseRecorder = httptest.NewRecorder()
 
@@ -116,17 +131,29 @@ var TestWebhookHandler = func(test WebhookTest) bool {
 					githubAPITryDeltas[i] = time.Millisecond
 				}
 			}
-			conf = grh.Config{
-				Secret:             "a-secret",
+			*conf = grh.Config{
+				Secrets:            []string{"a-secret"},
 				GithubAPITryDeltas: githubAPITryDeltas,
+				CommandPrefixes:    []string{"!"},
 			}
 
+			var err error
+			*errorReporter, err = grh.NewErrorReporter(grh.Config{})
+			Expect(err).NotTo(HaveOccurred())
+			*auditLog, err = grh.NewAuditLog(grh.Config{})
+			Expect(err).NotTo(HaveOccurred())
+
 			asyncOperationWg = &sync.WaitGroup{}
-			*handler = grh.CreateHandler(conf, *gitRepos, asyncOperationWg, *pullRequests,
-				*repositories, *issues, *search)
 		})
 
 		JustBeforeEach(func() {
+			*handler = grh.CreateHandler(*conf, *gitRepos, *store, grh.NewScheduler(0, nil), *errorReporter,
+				*auditLog, asyncOperationWg, *pullRequests, *repositories, *issues, *search, *graphQL)
+		})
+
+		// The request's body can only be read once, so the request is created
+		// again every time the webhook is handled
+		var createRequest = func() {
 			data := []byte(requestJSON.Get())
 			var err error
 			*request, err = http.NewRequest("GET", "http://localhost/whatever", bytes.NewBuffer(data))
@@ -134,7 +161,7 @@ var TestWebhookHandler = func(test WebhookTest) bool {
 			(*request).Header.Add("Content-Type", "application/json")
 			(*request).Header.Add("Content-Length", strconv.Itoa(len(data)))
 
-			mac := hmac.New(sha1.New, []byte(conf.Secret))
+			mac := hmac.New(sha1.New, []byte(conf.Secrets[0]))
 			mac.Write([]byte(requestJSON.Get()))
 			sig := hex.EncodeToString(mac.Sum(nil))
 			(*request).Header.Add("X-Hub-Signature", "sha1="+sig)
@@ -142,8 +169,7 @@ var TestWebhookHandler = func(test WebhookTest) bool {
 			for key, val := range headers.Get() {
 				(*request).Header.Set(key, val)
 			}
-
-		})
+		}
 
 		AfterEach(func() {
 			(*gitRepos).AssertExpectations(GinkgoT())
@@ -151,9 +177,11 @@ var TestWebhookHandler = func(test WebhookTest) bool {
 			(*repositories).AssertExpectations(GinkgoT())
 			(*issues).AssertExpectations(GinkgoT())
 			(*search).AssertExpectations(GinkgoT())
+			(*graphQL).AssertExpectations(GinkgoT())
 		})
 
 		var handle = func() {
+			createRequest()
 			response := (*handler)(*responseRecorder, *request)
 			response.WriteResponse(*responseRecorder)
 			// The delay is set to 0 for tests. Wait for all of the operations
@@ -162,15 +190,20 @@ var TestWebhookHandler = func(test WebhookTest) bool {
 		}
 
 		test(WebhookTestContext{
+			Config:           conf,
+			ErrorReporter:    errorReporter,
+			AuditLog:         auditLog,
 			RequestJSON:      requestJSON,
 			Headers:          headers,
 			Handle:           handle,
 			ResponseRecorder: responseRecorder,
 			GitRepos:         gitRepos,
+			Store:            store,
 			PullRequests:     pullRequests,
 			Repositories:     repositories,
 			Issues:           issues,
 			Search:           search,
+			GraphQL:          graphQL,
 		})
 	})
 
@@ -180,6 +213,14 @@ var TestWebhookHandler = func(test WebhookTest) bool {
 }
 
 var IssueCommentEvent = func(comment, issueAuthor string) string {
+	return IssueCommentEventWithLabels(comment, issueAuthor, nil)
+}
+
+var IssueCommentEventWithLabels = func(comment, issueAuthor string, labels []string) string {
+	labelObjects := make([]string, len(labels))
+	for i, label := range labels {
+		labelObjects[i] = `{"name": "` + label + `"}`
+	}
 	return `{
   "issue": {
     "number": ` + strconv.Itoa(issueNumber) + `,
@@ -188,10 +229,15 @@ var IssueCommentEvent = func(comment, issueAuthor string) string {
     },
     "user": {
       "login": "` + issueAuthor + `"
-    }
+    },
+    "labels": [` + strings.Join(labelObjects, ", ") + `]
   },
   "comment": {
-    "body": "` + comment + `"
+    "node_id": "` + commentNodeID + `",
+    "body": "` + comment + `",
+    "user": {
+      "login": "` + issueAuthor + `"
+    }
   },
   "repository": {
     "name": "` + repositoryName + `",
@@ -203,6 +249,14 @@ var IssueCommentEvent = func(comment, issueAuthor string) string {
 }`
 }
 
+// withCommenter makes someone other than the PR's author the author of the
+// comment in the issue comment event
+func withCommenter(issueCommentEvent, commenter string) string {
+	i := strings.Index(issueCommentEvent, `"comment": {`)
+	return issueCommentEvent[:i] + strings.Replace(issueCommentEvent[i:], `"login": "`+arbitraryIssueAuthor+`"`,
+		`"login": "`+commenter+`"`, 1)
+}
+
 var PullRequestEvent = func(action, headSHA string, headRepository grh.Repository) string {
 	return `{
   "action": "` + action + `",
@@ -211,6 +265,7 @@ var PullRequestEvent = func(action, headSHA string, headRepository grh.Repositor
     "url": "https://api.github.com/repos/` + repositoryOwner + `/` + repositoryName + `/pulls/` + strconv.Itoa(issueNumber) + `",
     "head": {
       "sha": "` + headSHA + `",
+      "ref": "feature",
       "repo": {
         "name": "` + headRepository.Name + `",
         "owner": {
@@ -219,6 +274,78 @@ var PullRequestEvent = func(action, headSHA string, headRepository grh.Repositor
         "ssh_url": "` + headRepository.URL + `"
       }
     },
+    "base": {
+      "ref": "master",
+      "repo": {
+        "name": "` + repositoryName + `",
+        "owner": {
+          "login": "` + repositoryOwner + `"
+        },
+        "ssh_url": "` + sshURL + `"
+      }
+    },
+    "user": {
+      "login": "` + arbitraryIssueAuthor + `"
+    }
+  },
+  "repository": {
+    "name": "` + repositoryName + `",
+    "owner": {
+      "login": "` + repositoryOwner + `"
+    },
+    "ssh_url": "` + sshURL + `"
+  }
+}`
+}
+
+var LabeledPullRequestEvent = func(action, headSHA string, headRepository grh.Repository, labels ...string) string {
+	labelsJSON := make([]string, len(labels))
+	for i, label := range labels {
+		labelsJSON[i] = `{"name": "` + label + `"}`
+	}
+	return strings.Replace(PullRequestEvent(action, headSHA, headRepository), `"pull_request": {`,
+		`"pull_request": {
+    "labels": [`+strings.Join(labelsJSON, ", ")+`],`, 1)
+}
+
+var ReviewRequestEvent = func(action, reviewer string) string {
+	return `{
+  "action": "` + action + `",
+  "number": ` + strconv.Itoa(issueNumber) + `,
+  "pull_request": {
+    "user": {
+      "login": "` + arbitraryIssueAuthor + `"
+    }
+  },
+  "requested_reviewer": {
+    "login": "` + reviewer + `"
+  },
+  "repository": {
+    "name": "` + repositoryName + `",
+    "owner": {
+      "login": "` + repositoryOwner + `"
+    },
+    "ssh_url": "` + sshURL + `"
+  }
+}`
+}
+
+var PullRequestReviewEvent = func(action, state string, labels []string) string {
+	labelObjects := make([]string, len(labels))
+	for i, label := range labels {
+		labelObjects[i] = `{"name": "` + label + `"}`
+	}
+	return `{
+  "action": "` + action + `",
+  "review": {
+    "state": "` + state + `",
+    "user": {
+      "login": "reviewer"
+    }
+  },
+  "pull_request": {
+    "number": ` + strconv.Itoa(issueNumber) + `,
+    "labels": [` + strings.Join(labelObjects, ", ") + `],
     "user": {
       "login": "` + arbitraryIssueAuthor + `"
     }
@@ -234,24 +361,20 @@ var PullRequestEvent = func(action, headSHA string, headRepository grh.Repositor
 }
 
 var createStatusEvent = func(sha, state string, branches []grh.Branch) string {
-	branchSHAs := make([]string, len(branches))
+	branchObjects := make([]string, len(branches))
 	for i, branch := range branches {
-		branchSHAs[i] = branch.SHA
+		branchObjects[i] = `{
+      "commit": {
+        "sha": "` + branch.SHA + `"
+      }
+    }`
 	}
 	return `{
   "sha": "` + sha + `",
   "state": "` + state + `",
   "branches": [
-    {
-      "commit": {
-        "sha": "` + strings.Join(branchSHAs, `"
-      }
-    },
-    {
-      "commit": {
-        "sha": "`) + `"
-      }
-    }
+    ` + strings.Join(branchObjects, `,
+    `) + `
   ],
   "repository": {
     "name": "` + repositoryName + `",
@@ -316,7 +439,7 @@ var mockListCommits = func(commits []*github.RepositoryCommit, perPage int, repo
 			pullRequests.
 				On("ListCommits", anyContext, repositoryOwner, repositoryName, issueNumber, &github.ListOptions{
 					Page:    pageNumber,
-					PerPage: 30,
+					PerPage: 100,
 				}).
 				Return(commitsOnThisPage, &github.Response{}, noError)
 			break
@@ -326,9 +449,20 @@ var mockListCommits = func(commits []*github.RepositoryCommit, perPage int, repo
 		pullRequests.
 			On("ListCommits", anyContext, repositoryOwner, repositoryName, issueNumber, &github.ListOptions{
 				Page:    pageNumber,
-				PerPage: 30,
+				PerPage: 100,
 			}).
 			Return(commitsOnThisPage, &github.Response{NextPage: pageNumber + 1}, noError)
 		pageNumber++
 	}
 }
+
+var mockLabels = func(issues *mocks.Issues, issueNumber int, labels ...string) {
+	githubLabels := make([]*github.Label, len(labels))
+	for i, label := range labels {
+		githubLabels[i] = &github.Label{Name: github.String(label)}
+	}
+	issues.
+		On("ListLabelsByIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+			mock.AnythingOfType("*github.ListOptions")).
+		Return(githubLabels, emptyResponse, noError)
+}
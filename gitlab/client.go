@@ -0,0 +1,260 @@
+// Package gitlab implements the bot's GitHub client interfaces on top of
+// GitLab's REST API, so that one bot could serve repositories on both. Merge
+// requests are exposed as pull requests, their notes as comments and the
+// commit statuses of pipelines as statuses. The results are go-github types,
+// which the GitLab responses are converted to through GitHub-shaped JSON.
+package gitlab
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/github"
+)
+
+// ErrUnsupported is returned for the operations GitLab has no equivalent
+// for, e.g. GitHub releases and deployments.
+var ErrUnsupported = errors.New("not supported by GitLab")
+
+// Client talks to a GitLab instance's REST API. Its services satisfy the
+// bot's PullRequests, Repositories, Issues and Search interfaces.
+type Client struct {
+	PullRequests *PullRequestsService
+	Repositories *RepositoriesService
+	Issues       *IssuesService
+	Search       *SearchService
+
+	httpClient *http.Client
+	apiURL     string
+	token      string
+
+	mutex    sync.Mutex
+	projects map[int64]project
+	users    map[string]int64
+	// notes maps the IDs of the notes the client has created to their merge
+	// requests, because GitLab can only edit a note through its merge request
+	notes map[int64]noteTarget
+}
+
+type noteTarget struct {
+	owner, repo string
+	number      int
+}
+
+// NewClient creates a client for the GitLab instance at baseURL, e.g.
+// "https://gitlab.com", that authenticates with the personal, project or
+// group access token.
+func NewClient(httpClient *http.Client, baseURL, token string) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	c := &Client{
+		httpClient: httpClient,
+		apiURL:     strings.TrimSuffix(baseURL, "/") + "/api/v4/",
+		token:      token,
+		projects:   map[int64]project{},
+		users:      map[string]int64{},
+		notes:      map[int64]noteTarget{},
+	}
+	c.PullRequests = &PullRequestsService{c}
+	c.Repositories = &RepositoriesService{c}
+	c.Issues = &IssuesService{c}
+	c.Search = &SearchService{c}
+	return c
+}
+
+type user struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+type namespace struct {
+	FullPath string `json:"full_path"`
+}
+
+type project struct {
+	ID                int64     `json:"id"`
+	Path              string    `json:"path"`
+	PathWithNamespace string    `json:"path_with_namespace"`
+	Namespace         namespace `json:"namespace"`
+	SSHURLToRepo      string    `json:"ssh_url_to_repo"`
+	HTTPURLToRepo     string    `json:"http_url_to_repo"`
+	WebURL            string    `json:"web_url"`
+	DefaultBranch     string    `json:"default_branch"`
+}
+
+// do sends the request to the API path and decodes the response into result.
+// Errors are go-github's *ErrorResponse, so that the callers could check the
+// status code the same way as for GitHub.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body interface{},
+	result interface{}) (*github.Response, error) {
+
+	u := c.apiURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var bodyReader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		bodyReader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, u, bodyReader)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("PRIVATE-TOKEN", c.token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	response := &github.Response{Response: resp}
+	response.NextPage, _ = strconv.Atoi(resp.Header.Get("X-Next-Page"))
+	if err := github.CheckResponse(resp); err != nil {
+		return response, err
+	}
+	if result != nil {
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return response, err
+		} else if err := json.Unmarshal(data, result); err != nil {
+			return response, fmt.Errorf("failed to decode the response of %s %s: %v", method, path, err)
+		}
+	}
+	return response, nil
+}
+
+// convert converts the GitHub-shaped value to the go-github type through
+// JSON, which spares the pointer fields and the mismatching ID types.
+func convert(value interface{}, result interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, result)
+}
+
+// projectPath is the API path of the owner/repo project. The owner is the
+// project's namespace, which may include subgroups, e.g. "group/subgroup".
+func projectPath(owner, repo string) string {
+	return "projects/" + url.PathEscape(owner+"/"+repo)
+}
+
+func mergeRequestPath(owner, repo string, number int) string {
+	return fmt.Sprintf("%s/merge_requests/%d", projectPath(owner, repo), number)
+}
+
+// pageQuery converts go-github's list options to GitLab's pagination
+// parameters.
+func pageQuery(opt *github.ListOptions) url.Values {
+	query := url.Values{}
+	if opt != nil && opt.Page != 0 {
+		query.Set("page", strconv.Itoa(opt.Page))
+	}
+	if opt != nil && opt.PerPage != 0 {
+		query.Set("per_page", strconv.Itoa(opt.PerPage))
+	}
+	return query
+}
+
+// getProject gets the project by ID. Projects are cached, because every
+// merge request refers to its source and target projects by ID.
+func (c *Client) getProject(ctx context.Context, id int64) (project, error) {
+	c.mutex.Lock()
+	cached, exists := c.projects[id]
+	c.mutex.Unlock()
+	if exists {
+		return cached, nil
+	}
+	var p project
+	if _, err := c.do(ctx, "GET", fmt.Sprintf("projects/%d", id), nil, nil, &p); err != nil {
+		return project{}, err
+	}
+	c.mutex.Lock()
+	c.projects[id] = p
+	c.mutex.Unlock()
+	return p, nil
+}
+
+// userID looks up the ID of the user with the username, which the API
+// requires for assignees, reviewers and memberships.
+func (c *Client) userID(ctx context.Context, username string) (int64, *github.Response, error) {
+	c.mutex.Lock()
+	cached, exists := c.users[username]
+	c.mutex.Unlock()
+	if exists {
+		return cached, nil, nil
+	}
+	var users []user
+	resp, err := c.do(ctx, "GET", "users", url.Values{"username": {username}}, nil, &users)
+	if err != nil {
+		return 0, resp, err
+	} else if len(users) == 0 {
+		return 0, notFound(resp), fmt.Errorf("unknown GitLab user %s", username)
+	}
+	c.mutex.Lock()
+	c.users[username] = users[0].ID
+	c.mutex.Unlock()
+	return users[0].ID, resp, nil
+}
+
+func (c *Client) userIDs(ctx context.Context, usernames []string) ([]int64, *github.Response, error) {
+	ids := make([]int64, 0, len(usernames))
+	for _, username := range usernames {
+		id, resp, err := c.userID(ctx, username)
+		if err != nil {
+			return nil, resp, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil, nil
+}
+
+// notFound turns the response into a 404 one, so that the callers' checks
+// for missing resources would apply to what GitLab doesn't have.
+func notFound(resp *github.Response) *github.Response {
+	httpResponse := &http.Response{StatusCode: http.StatusNotFound, Header: http.Header{}}
+	if resp != nil && resp.Response != nil {
+		httpResponse.Request = resp.Request
+	}
+	return &github.Response{Response: httpResponse}
+}
+
+func repositoryJSON(p project) map[string]interface{} {
+	return map[string]interface{}{
+		"id":             p.ID,
+		"name":           p.Path,
+		"full_name":      p.PathWithNamespace,
+		"owner":          map[string]interface{}{"login": p.Namespace.FullPath},
+		"ssh_url":        p.SSHURLToRepo,
+		"clone_url":      p.HTTPURLToRepo,
+		"html_url":       p.WebURL,
+		"default_branch": p.DefaultBranch,
+	}
+}
+
+func labelsJSON(labels []string) []map[string]interface{} {
+	result := make([]map[string]interface{}, len(labels))
+	for i, label := range labels {
+		result[i] = map[string]interface{}{"name": label}
+	}
+	return result
+}
@@ -0,0 +1,203 @@
+package gitlab_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/gitlab"
+)
+
+const projectJSON = `{
+  "id": 3,
+  "path": "widget",
+  "path_with_namespace": "acme/tools/widget",
+  "namespace": {"full_path": "acme/tools"},
+  "ssh_url_to_repo": "git@gitlab.example.com:acme/tools/widget.git"
+}`
+
+func mergeRequestJSON(sha string, labels string) string {
+	return fmt.Sprintf(`{
+  "iid": 7,
+  "title": "Add the widget",
+  "state": "opened",
+  "author": {"id": 11, "username": "procoder"},
+  "labels": [%s],
+  "source_branch": "feature",
+  "target_branch": "master",
+  "source_project_id": 3,
+  "target_project_id": 3,
+  "sha": "%s",
+  "merge_status": "can_be_merged",
+  "diff_refs": {"base_sha": "1234"}
+}`, labels, sha)
+}
+
+func newServer(t *testing.T, routes map[string]func(w http.ResponseWriter, r *http.Request)) (*httptest.Server,
+	*gitlab.Client) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("PRIVATE-TOKEN") != "secret" {
+			t.Errorf("Expected the token to be sent, got \"%s\"", r.Header.Get("PRIVATE-TOKEN"))
+		}
+		route, exists := routes[r.Method+" "+r.URL.EscapedPath()]
+		if !exists {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.EscapedPath())
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		route(w, r)
+	}))
+	return server, gitlab.NewClient(server.Client(), server.URL, "secret")
+}
+
+func respond(body string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}
+}
+
+func TestGetConvertsMergeRequest(t *testing.T) {
+	server, client := newServer(t, map[string]func(w http.ResponseWriter, r *http.Request){
+		"GET /api/v4/projects/acme%2Ftools%2Fwidget/merge_requests/7": respond(mergeRequestJSON("1235", `"bug"`)),
+		"GET /api/v4/projects/3": respond(projectJSON),
+	})
+	defer server.Close()
+
+	pr, _, err := client.PullRequests.Get(context.Background(), "acme/tools", "widget", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.GetNumber() != 7 || pr.GetState() != "open" || pr.Head.GetSHA() != "1235" || pr.Base.GetRef() != "master" {
+		t.Errorf("Unexpected PR %v", pr)
+	}
+	if pr.Mergeable == nil || !*pr.Mergeable {
+		t.Errorf("Expected the PR to be mergeable, got %v", pr.Mergeable)
+	}
+	if login := pr.Base.Repo.Owner.GetLogin(); login != "acme/tools" {
+		t.Errorf("Expected the owner to be the namespace, got \"%s\"", login)
+	}
+	if len(pr.Labels) != 1 || pr.Labels[0].GetName() != "bug" {
+		t.Errorf("Expected the PR to be labeled with bug, got %v", pr.Labels)
+	}
+}
+
+func TestMergeConflictIsReportedAsConflict(t *testing.T) {
+	server, client := newServer(t, map[string]func(w http.ResponseWriter, r *http.Request){
+		"PUT /api/v4/projects/acme%2Fwidget/merge_requests/7/merge": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotAcceptable)
+			w.Write([]byte(`{"message": "Branch cannot be merged"}`))
+		},
+	})
+	defer server.Close()
+
+	_, resp, err := client.PullRequests.Merge(context.Background(), "acme", "widget", 7, "",
+		&github.PullRequestOptions{MergeMethod: "squash"})
+	if err == nil {
+		t.Fatal("Expected the merge to fail")
+	} else if resp.StatusCode != http.StatusConflict {
+		t.Errorf("Expected a 409, got %d", resp.StatusCode)
+	}
+}
+
+func TestCombinedStatus(t *testing.T) {
+	server, client := newServer(t, map[string]func(w http.ResponseWriter, r *http.Request){
+		"GET /api/v4/projects/acme%2Fwidget/repository/commits/1235/statuses": respond(`[
+  {"id": 1, "name": "test", "status": "success"},
+  {"id": 2, "name": "lint", "status": "failed", "allow_failure": true},
+  {"id": 3, "name": "review/squash", "status": "running"}
+]`),
+	})
+	defer server.Close()
+
+	combined, _, err := client.Repositories.GetCombinedStatus(context.Background(), "acme", "widget", "1235", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if combined.GetState() != "pending" {
+		t.Errorf("Expected the combined state to be pending, got %s", combined.GetState())
+	}
+	if state := combined.Statuses[1].GetState(); state != "success" {
+		t.Errorf("Expected a job allowed to fail to succeed, got %s", state)
+	}
+}
+
+func TestSearchIssues(t *testing.T) {
+	server, client := newServer(t, map[string]func(w http.ResponseWriter, r *http.Request){
+		"GET /api/v4/projects/acme%2Fwidget/merge_requests": func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			if query.Get("labels") != "merging" || query.Get("not[labels]") != "on hold" ||
+				query.Get("state") != "opened" {
+				t.Errorf("Unexpected query %s", r.URL.RawQuery)
+			}
+			w.Write([]byte("[" + mergeRequestJSON("1235abc", `"merging"`) + "," +
+				mergeRequestJSON("9999", `"merging"`) + "]"))
+		},
+		"GET /api/v4/projects/3": respond(projectJSON),
+	})
+	defer server.Close()
+
+	result, _, err := client.Search.Issues(context.Background(),
+		`1235abc label:"merging" -label:"on hold" is:open repo:acme/widget`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Issues) != 1 {
+		t.Fatalf("Expected the SHA to match 1 merge request, got %d", len(result.Issues))
+	}
+	expectedURL := server.URL + "/api/v4/repos/acme%2Ftools/widget/issues/7"
+	if url := result.Issues[0].GetURL(); url != expectedURL {
+		t.Errorf("Expected the URL to be %s, got %s", expectedURL, url)
+	}
+}
+
+func TestSearchRequiresRepositories(t *testing.T) {
+	client := gitlab.NewClient(nil, "https://gitlab.example.com", "secret")
+	if _, _, err := client.Search.Issues(context.Background(), "is:pr is:open", nil); err == nil {
+		t.Error("Expected a search without repo: or user: to fail")
+	}
+}
+
+func TestEditingUnknownNoteIsNotFound(t *testing.T) {
+	client := gitlab.NewClient(nil, "https://gitlab.example.com", "secret")
+	_, resp, err := client.Issues.EditComment(context.Background(), "acme", "widget", 42,
+		&github.IssueComment{Body: github.String("Updated")})
+	if err == nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected a 404, got %v", err)
+	}
+}
+
+func TestAuthorAssociation(t *testing.T) {
+	server, client := newServer(t, map[string]func(w http.ResponseWriter, r *http.Request){
+		"GET /api/v4/users": func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Query().Get("username") {
+			case "maintainer":
+				w.Write([]byte(`[{"id": 11}]`))
+			case "reporter":
+				w.Write([]byte(`[{"id": 12}]`))
+			default:
+				w.Write([]byte(`[]`))
+			}
+		},
+		"GET /api/v4/projects/acme%2Fwidget/members/all/11": respond(`{"access_level": 40}`),
+		"GET /api/v4/projects/acme%2Fwidget/members/all/12": respond(`{"access_level": 20}`),
+	})
+	defer server.Close()
+
+	for username, expected := range map[string]string{
+		"maintainer": "MEMBER",
+		"reporter":   "NONE",
+		"stranger":   "NONE",
+	} {
+		association, err := client.Repositories.AuthorAssociation(context.Background(), "acme", "widget", username)
+		if err != nil {
+			t.Fatal(err)
+		} else if association != expected {
+			t.Errorf("Expected %s to be associated as %s, got %s", username, expected, association)
+		}
+	}
+}
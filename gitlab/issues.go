@@ -0,0 +1,363 @@
+package gitlab
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// IssuesService exposes merge requests as the issues GitHub considers pull
+// requests to be, and their notes as issue comments. GitLab's issues aren't
+// exposed, because the bot only acts on pull requests.
+type IssuesService struct {
+	client *Client
+}
+
+type note struct {
+	ID        int64     `json:"id"`
+	Body      string    `json:"body"`
+	Author    user      `json:"author"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// milestone is a project milestone. Its ID is the milestone's number, because
+// that's what a merge request's milestone is set by.
+type milestone struct {
+	ID          int64  `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	State       string `json:"state"`
+	DueDate     string `json:"due_date"`
+}
+
+func (m milestone) json() map[string]interface{} {
+	state := "open"
+	if m.State == "closed" {
+		state = "closed"
+	}
+	value := map[string]interface{}{
+		"number":      m.ID,
+		"title":       m.Title,
+		"description": m.Description,
+		"state":       state,
+	}
+	if m.DueDate != "" {
+		value["due_on"] = m.DueDate + "T00:00:00Z"
+	}
+	return value
+}
+
+// issue converts the merge request to an issue. Its API URL is shaped like
+// GitHub's, with the owner escaped, so that the repository could be parsed
+// from it.
+func (c *Client) issue(owner, repo string, mr mergeRequest) (*github.Issue, error) {
+	state := "open"
+	if mr.State != "opened" {
+		state = "closed"
+	}
+	repositoryURL := fmt.Sprintf("%srepos/%s/%s", c.apiURL, url.PathEscape(owner), repo)
+	value := map[string]interface{}{
+		"number":         mr.IID,
+		"state":          state,
+		"title":          mr.Title,
+		"body":           mr.Description,
+		"user":           map[string]interface{}{"login": mr.Author.Username},
+		"labels":         labelsJSON(mr.Labels),
+		"assignees":      usersJSON(mr.Assignees),
+		"html_url":       mr.WebURL,
+		"updated_at":     mr.UpdatedAt,
+		"repository_url": repositoryURL,
+		"url":            fmt.Sprintf("%s/issues/%d", repositoryURL, mr.IID),
+		"pull_request":   map[string]interface{}{"html_url": mr.WebURL},
+	}
+	if mr.Milestone != nil {
+		value["milestone"] = mr.Milestone.json()
+	}
+	var issue github.Issue
+	if err := convert(value, &issue); err != nil {
+		return nil, err
+	}
+	return &issue, nil
+}
+
+func (s *IssuesService) update(ctx context.Context, owner, repo string, number int,
+	request map[string]interface{}) (mergeRequest, *github.Response, error) {
+
+	var mr mergeRequest
+	resp, err := s.client.do(ctx, "PUT", mergeRequestPath(owner, repo, number), nil, request, &mr)
+	return mr, resp, err
+}
+
+func (s *IssuesService) updateIssue(ctx context.Context, owner, repo string, number int,
+	request map[string]interface{}) (*github.Issue, *github.Response, error) {
+
+	mr, resp, err := s.update(ctx, owner, repo, number, request)
+	if err != nil {
+		return nil, resp, err
+	}
+	issue, err := s.client.issue(owner, repo, mr)
+	return issue, resp, err
+}
+
+func githubLabels(names []string) []*github.Label {
+	labels := make([]*github.Label, len(names))
+	for i, name := range names {
+		labels[i] = &github.Label{Name: github.String(name)}
+	}
+	return labels
+}
+
+func (s *IssuesService) AddLabelsToIssue(ctx context.Context, owner, repo string, number int,
+	labels []string) ([]*github.Label, *github.Response, error) {
+
+	mr, resp, err := s.update(ctx, owner, repo, number, map[string]interface{}{
+		"add_labels": strings.Join(labels, ","),
+	})
+	if err != nil {
+		return nil, resp, err
+	}
+	return githubLabels(mr.Labels), resp, nil
+}
+
+func (s *IssuesService) RemoveLabelForIssue(ctx context.Context, owner, repo string, number int,
+	label string) (*github.Response, error) {
+
+	_, resp, err := s.update(ctx, owner, repo, number, map[string]interface{}{"remove_labels": label})
+	return resp, err
+}
+
+// CreateComment adds a note to the merge request.
+func (s *IssuesService) CreateComment(ctx context.Context, owner string, repo string, number int,
+	comment *github.IssueComment) (*github.IssueComment, *github.Response, error) {
+
+	var created note
+	resp, err := s.client.do(ctx, "POST", mergeRequestPath(owner, repo, number)+"/notes", nil,
+		map[string]interface{}{"body": comment.GetBody()}, &created)
+	if err != nil {
+		return nil, resp, err
+	}
+	s.client.mutex.Lock()
+	s.client.notes[created.ID] = noteTarget{owner, repo, number}
+	s.client.mutex.Unlock()
+	var issueComment github.IssueComment
+	err = convert(map[string]interface{}{
+		"id":         created.ID,
+		"body":       created.Body,
+		"user":       map[string]interface{}{"login": created.Author.Username},
+		"created_at": created.CreatedAt,
+	}, &issueComment)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &issueComment, resp, nil
+}
+
+// EditComment edits a note the client has created. Other notes can't be
+// found without their merge request, so they are reported missing with a 404.
+func (s *IssuesService) EditComment(ctx context.Context, owner string, repo string, id int64,
+	comment *github.IssueComment) (*github.IssueComment, *github.Response, error) {
+
+	s.client.mutex.Lock()
+	target, exists := s.client.notes[id]
+	s.client.mutex.Unlock()
+	if !exists {
+		return nil, notFound(nil), fmt.Errorf("unknown note %d", id)
+	}
+	path := fmt.Sprintf("%s/notes/%d", mergeRequestPath(target.owner, target.repo, target.number), id)
+	resp, err := s.client.do(ctx, "PUT", path, nil, map[string]interface{}{"body": comment.GetBody()}, nil)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &github.IssueComment{ID: github.Int64(id), Body: comment.Body}, resp, nil
+}
+
+// ListLabelsByIssue lists all of the merge request's labels on a single page.
+func (s *IssuesService) ListLabelsByIssue(ctx context.Context, owner string, repo string, number int,
+	opt *github.ListOptions) ([]*github.Label, *github.Response, error) {
+
+	var mr mergeRequest
+	resp, err := s.client.do(ctx, "GET", mergeRequestPath(owner, repo, number), nil, nil, &mr)
+	if err != nil {
+		return nil, resp, err
+	}
+	return githubLabels(mr.Labels), resp, nil
+}
+
+// ListByRepo lists the project's merge requests.
+func (s *IssuesService) ListByRepo(ctx context.Context, owner string, repo string,
+	opt *github.IssueListByRepoOptions) ([]*github.Issue, *github.Response, error) {
+
+	query := pageQuery(&opt.ListOptions)
+	switch opt.State {
+	case "", "open":
+		query.Set("state", "opened")
+	case "closed", "all":
+		query.Set("state", opt.State)
+	}
+	if len(opt.Labels) > 0 {
+		query.Set("labels", strings.Join(opt.Labels, ","))
+	}
+	if opt.Sort == "created" || opt.Sort == "updated" {
+		query.Set("order_by", opt.Sort+"_at")
+	}
+	if opt.Direction != "" {
+		query.Set("sort", opt.Direction)
+	}
+	var mrs []mergeRequest
+	resp, err := s.client.do(ctx, "GET", projectPath(owner, repo)+"/merge_requests", query, nil, &mrs)
+	if err != nil {
+		return nil, resp, err
+	}
+	issues := make([]*github.Issue, len(mrs))
+	for i, mr := range mrs {
+		if issues[i], err = s.client.issue(owner, repo, mr); err != nil {
+			return nil, resp, err
+		}
+	}
+	return issues, resp, nil
+}
+
+func (s *IssuesService) AddAssignees(ctx context.Context, owner, repo string, number int,
+	assignees []string) (*github.Issue, *github.Response, error) {
+
+	return s.changeAssignees(ctx, owner, repo, number, assignees, nil)
+}
+
+func (s *IssuesService) RemoveAssignees(ctx context.Context, owner, repo string, number int,
+	assignees []string) (*github.Issue, *github.Response, error) {
+
+	return s.changeAssignees(ctx, owner, repo, number, nil, assignees)
+}
+
+func (s *IssuesService) changeAssignees(ctx context.Context, owner, repo string, number int, added,
+	removed []string) (*github.Issue, *github.Response, error) {
+
+	var mr mergeRequest
+	resp, err := s.client.do(ctx, "GET", mergeRequestPath(owner, repo, number), nil, nil, &mr)
+	if err != nil {
+		return nil, resp, err
+	}
+	ids, resp, err := s.client.userIDs(ctx, added)
+	if err != nil {
+		return nil, resp, err
+	}
+	for _, assignee := range mr.Assignees {
+		if !containsFold(removed, assignee.Username) && !containsFold(added, assignee.Username) {
+			ids = append(ids, assignee.ID)
+		}
+	}
+	return s.updateIssue(ctx, owner, repo, number, map[string]interface{}{"assignee_ids": ids})
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Edit edits the merge request. Closing and reopening are state events on
+// GitLab.
+func (s *IssuesService) Edit(ctx context.Context, owner string, repo string, number int,
+	issue *github.IssueRequest) (*github.Issue, *github.Response, error) {
+
+	request := map[string]interface{}{}
+	if issue.Title != nil {
+		request["title"] = *issue.Title
+	}
+	if issue.Body != nil {
+		request["description"] = *issue.Body
+	}
+	if issue.Labels != nil {
+		request["labels"] = strings.Join(*issue.Labels, ",")
+	}
+	if issue.Milestone != nil {
+		request["milestone_id"] = *issue.Milestone
+	}
+	if issue.State != nil {
+		switch *issue.State {
+		case "closed":
+			request["state_event"] = "close"
+		case "open":
+			request["state_event"] = "reopen"
+		}
+	}
+	if issue.Assignees != nil {
+		ids, resp, err := s.client.userIDs(ctx, *issue.Assignees)
+		if err != nil {
+			return nil, resp, err
+		}
+		request["assignee_ids"] = ids
+	}
+	return s.updateIssue(ctx, owner, repo, number, request)
+}
+
+func (s *IssuesService) ListMilestones(ctx context.Context, owner string, repo string,
+	opt *github.MilestoneListOptions) ([]*github.Milestone, *github.Response, error) {
+
+	query := pageQuery(&opt.ListOptions)
+	switch opt.State {
+	case "", "open":
+		query.Set("state", "active")
+	case "closed":
+		query.Set("state", "closed")
+	}
+	var milestones []milestone
+	resp, err := s.client.do(ctx, "GET", projectPath(owner, repo)+"/milestones", query, nil, &milestones)
+	if err != nil {
+		return nil, resp, err
+	}
+	result := make([]*github.Milestone, len(milestones))
+	for i, m := range milestones {
+		var githubMilestone github.Milestone
+		if err := convert(m.json(), &githubMilestone); err != nil {
+			return nil, resp, err
+		}
+		result[i] = &githubMilestone
+	}
+	return result, resp, nil
+}
+
+func (s *IssuesService) CreateMilestone(ctx context.Context, owner string, repo string,
+	m *github.Milestone) (*github.Milestone, *github.Response, error) {
+
+	request := map[string]interface{}{
+		"title":       m.GetTitle(),
+		"description": m.GetDescription(),
+	}
+	if m.DueOn != nil {
+		request["due_date"] = m.DueOn.Format("2006-01-02")
+	}
+	var created milestone
+	resp, err := s.client.do(ctx, "POST", projectPath(owner, repo)+"/milestones", nil, request, &created)
+	if err != nil {
+		return nil, resp, err
+	}
+	var githubMilestone github.Milestone
+	if err := convert(created.json(), &githubMilestone); err != nil {
+		return nil, resp, err
+	}
+	return &githubMilestone, resp, nil
+}
+
+// Lock locks the merge request's discussion. GitLab doesn't record why, so
+// the reason is ignored.
+func (s *IssuesService) Lock(ctx context.Context, owner string, repo string, number int,
+	opt *github.LockIssueOptions) (*github.Response, error) {
+
+	_, resp, err := s.update(ctx, owner, repo, number, map[string]interface{}{"discussion_locked": true})
+	return resp, err
+}
+
+func (s *IssuesService) Unlock(ctx context.Context, owner string, repo string, number int) (*github.Response,
+	error) {
+
+	_, resp, err := s.update(ctx, owner, repo, number, map[string]interface{}{"discussion_locked": false})
+	return resp, err
+}
@@ -0,0 +1,407 @@
+package gitlab
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// PullRequestsService exposes a project's merge requests as pull requests.
+// The merge request's IID is the pull request's number.
+type PullRequestsService struct {
+	client *Client
+}
+
+type mergeRequest struct {
+	IID                int        `json:"iid"`
+	Title              string     `json:"title"`
+	Description        string     `json:"description"`
+	State              string     `json:"state"`
+	Author             user       `json:"author"`
+	Labels             []string   `json:"labels"`
+	Assignees          []user     `json:"assignees"`
+	Reviewers          []user     `json:"reviewers"`
+	Milestone          *milestone `json:"milestone"`
+	SourceBranch       string     `json:"source_branch"`
+	TargetBranch       string     `json:"target_branch"`
+	SourceProjectID    int64      `json:"source_project_id"`
+	TargetProjectID    int64      `json:"target_project_id"`
+	SHA                string     `json:"sha"`
+	MergeCommitSHA     string     `json:"merge_commit_sha"`
+	SquashCommitSHA    string     `json:"squash_commit_sha"`
+	MergeStatus        string     `json:"merge_status"`
+	HasConflicts       bool       `json:"has_conflicts"`
+	AllowCollaboration bool       `json:"allow_collaboration"`
+	WebURL             string     `json:"web_url"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+	DiffRefs           struct {
+		BaseSHA string `json:"base_sha"`
+	} `json:"diff_refs"`
+}
+
+type commit struct {
+	ID          string    `json:"id"`
+	Message     string    `json:"message"`
+	ParentIDs   []string  `json:"parent_ids"`
+	AuthorName  string    `json:"author_name"`
+	AuthorEmail string    `json:"author_email"`
+	AuthoredAt  time.Time `json:"authored_date"`
+}
+
+type diff struct {
+	NewPath     string `json:"new_path"`
+	Diff        string `json:"diff"`
+	NewFile     bool   `json:"new_file"`
+	RenamedFile bool   `json:"renamed_file"`
+	DeletedFile bool   `json:"deleted_file"`
+}
+
+// pullRequest converts the merge request to a pull request. The source and
+// target projects are the head and base repositories.
+func (s *PullRequestsService) pullRequest(ctx context.Context, mr mergeRequest) (*github.PullRequest, error) {
+	head, err := s.client.getProject(ctx, mr.SourceProjectID)
+	if err != nil {
+		return nil, err
+	}
+	base, err := s.client.getProject(ctx, mr.TargetProjectID)
+	if err != nil {
+		return nil, err
+	}
+	state := "open"
+	if mr.State != "opened" {
+		state = "closed"
+	}
+	// GitHub's mergeable is null while the mergeability is being computed
+	var mergeable interface{}
+	mergeableState := "unknown"
+	if mr.MergeStatus == "can_be_merged" && !mr.HasConflicts {
+		mergeable, mergeableState = true, "clean"
+	} else if mr.MergeStatus == "cannot_be_merged" || mr.HasConflicts {
+		mergeable, mergeableState = false, "dirty"
+	}
+	mergeCommitSHA := mr.MergeCommitSHA
+	if mr.SquashCommitSHA != "" {
+		mergeCommitSHA = mr.SquashCommitSHA
+	}
+	value := map[string]interface{}{
+		"number":                mr.IID,
+		"state":                 state,
+		"title":                 mr.Title,
+		"body":                  mr.Description,
+		"user":                  map[string]interface{}{"login": mr.Author.Username},
+		"labels":                labelsJSON(mr.Labels),
+		"assignees":             usersJSON(mr.Assignees),
+		"requested_reviewers":   usersJSON(mr.Reviewers),
+		"merged":                mr.State == "merged",
+		"merge_commit_sha":      mergeCommitSHA,
+		"mergeable":             mergeable,
+		"mergeable_state":       mergeableState,
+		"maintainer_can_modify": mr.AllowCollaboration,
+		"html_url":              mr.WebURL,
+		"updated_at":            mr.UpdatedAt,
+		"head": map[string]interface{}{
+			"ref":  mr.SourceBranch,
+			"sha":  mr.SHA,
+			"repo": repositoryJSON(head),
+		},
+		"base": map[string]interface{}{
+			"ref":  mr.TargetBranch,
+			"sha":  mr.DiffRefs.BaseSHA,
+			"repo": repositoryJSON(base),
+		},
+	}
+	if mr.Milestone != nil {
+		value["milestone"] = mr.Milestone.json()
+	}
+	var pr github.PullRequest
+	if err := convert(value, &pr); err != nil {
+		return nil, err
+	}
+	return &pr, nil
+}
+
+func usersJSON(users []user) []map[string]interface{} {
+	result := make([]map[string]interface{}, len(users))
+	for i, u := range users {
+		result[i] = map[string]interface{}{"id": u.ID, "login": u.Username}
+	}
+	return result
+}
+
+func (s *PullRequestsService) getMergeRequest(ctx context.Context, owner, repo string,
+	number int) (mergeRequest, *github.Response, error) {
+
+	var mr mergeRequest
+	resp, err := s.client.do(ctx, "GET", mergeRequestPath(owner, repo, number), nil, nil, &mr)
+	return mr, resp, err
+}
+
+func (s *PullRequestsService) Get(ctx context.Context, owner, repo string, number int) (*github.PullRequest,
+	*github.Response, error) {
+
+	mr, resp, err := s.getMergeRequest(ctx, owner, repo, number)
+	if err != nil {
+		return nil, resp, err
+	}
+	pr, err := s.pullRequest(ctx, mr)
+	return pr, resp, err
+}
+
+// ListCommits lists all of the merge request's commits at once, from the
+// oldest to the newest like GitHub does, because GitLab lists them from the
+// newest.
+func (s *PullRequestsService) ListCommits(ctx context.Context, owner, repo string, number int,
+	opt *github.ListOptions) ([]*github.RepositoryCommit, *github.Response, error) {
+
+	var commits []commit
+	var resp *github.Response
+	query := url.Values{"per_page": {"100"}}
+	for {
+		var page []commit
+		var err error
+		resp, err = s.client.do(ctx, "GET", mergeRequestPath(owner, repo, number)+"/commits", query, nil, &page)
+		if err != nil {
+			return nil, resp, err
+		}
+		commits = append(commits, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		query.Set("page", fmt.Sprint(resp.NextPage))
+	}
+	result := make([]*github.RepositoryCommit, len(commits))
+	for i, c := range commits {
+		var repositoryCommit github.RepositoryCommit
+		if err := convert(c.json(), &repositoryCommit); err != nil {
+			return nil, resp, err
+		}
+		result[len(commits)-1-i] = &repositoryCommit
+	}
+	return result, resp, nil
+}
+
+func (c commit) json() map[string]interface{} {
+	parents := make([]map[string]interface{}, len(c.ParentIDs))
+	for i, parentID := range c.ParentIDs {
+		parents[i] = map[string]interface{}{"sha": parentID}
+	}
+	return map[string]interface{}{
+		"sha": c.ID,
+		"commit": map[string]interface{}{
+			"message": c.Message,
+			"author": map[string]interface{}{
+				"name":  c.AuthorName,
+				"email": c.AuthorEmail,
+				"date":  c.AuthoredAt,
+			},
+		},
+		"parents": parents,
+	}
+}
+
+// Merge accepts the merge request. The "merge" and "squash" merge methods are
+// supported; how the merge commit is created is up to the project's merge
+// method setting. GitLab's 406, which it responds with for conflicts, is
+// turned into GitHub's 409.
+func (s *PullRequestsService) Merge(ctx context.Context, owner, repo string, number int, commitMessage string,
+	opt *github.PullRequestOptions) (*github.PullRequestMergeResult, *github.Response, error) {
+
+	request := map[string]interface{}{}
+	if opt != nil && opt.MergeMethod == "rebase" {
+		return nil, nil, fmt.Errorf("rebase merges are %v", ErrUnsupported)
+	} else if opt != nil && opt.MergeMethod == "squash" {
+		request["squash"] = true
+		if commitMessage != "" {
+			request["squash_commit_message"] = commitMessage
+		}
+	} else if commitMessage != "" {
+		request["merge_commit_message"] = commitMessage
+	}
+	if opt != nil && opt.SHA != "" {
+		request["sha"] = opt.SHA
+	}
+	var mr mergeRequest
+	resp, err := s.client.do(ctx, "PUT", mergeRequestPath(owner, repo, number)+"/merge", nil, request, &mr)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotAcceptable {
+			resp.StatusCode = http.StatusConflict
+		}
+		return nil, resp, err
+	}
+	sha := mr.MergeCommitSHA
+	if mr.SquashCommitSHA != "" {
+		sha = mr.SquashCommitSHA
+	}
+	result := &github.PullRequestMergeResult{
+		SHA:     github.String(sha),
+		Merged:  github.Bool(mr.State == "merged"),
+		Message: github.String(fmt.Sprintf("Merge request !%d %s", mr.IID, mr.State)),
+	}
+	return result, resp, nil
+}
+
+// ListReviews lists the merge request's approvals as approving reviews.
+// GitLab has no reviews that request changes.
+func (s *PullRequestsService) ListReviews(ctx context.Context, owner, repo string, number int,
+	opt *github.ListOptions) ([]*github.PullRequestReview, *github.Response, error) {
+
+	var approvals struct {
+		ApprovedBy []struct {
+			User user `json:"user"`
+		} `json:"approved_by"`
+	}
+	resp, err := s.client.do(ctx, "GET", mergeRequestPath(owner, repo, number)+"/approvals", nil, nil, &approvals)
+	if err != nil {
+		return nil, resp, err
+	}
+	reviews := make([]*github.PullRequestReview, len(approvals.ApprovedBy))
+	for i, approval := range approvals.ApprovedBy {
+		var review github.PullRequestReview
+		err := convert(map[string]interface{}{
+			"state": "APPROVED",
+			"user":  map[string]interface{}{"id": approval.User.ID, "login": approval.User.Username},
+		}, &review)
+		if err != nil {
+			return nil, resp, err
+		}
+		reviews[i] = &review
+	}
+	return reviews, resp, nil
+}
+
+// ListFiles lists the files the merge request changes. The additions and
+// deletions are counted from the diffs.
+func (s *PullRequestsService) ListFiles(ctx context.Context, owner, repo string, number int,
+	opt *github.ListOptions) ([]*github.CommitFile, *github.Response, error) {
+
+	var diffs []diff
+	resp, err := s.client.do(ctx, "GET", mergeRequestPath(owner, repo, number)+"/diffs", pageQuery(opt), nil,
+		&diffs)
+	if err != nil {
+		return nil, resp, err
+	}
+	files := make([]*github.CommitFile, len(diffs))
+	for i, d := range diffs {
+		files[i] = d.commitFile()
+	}
+	return files, resp, nil
+}
+
+func (d diff) commitFile() *github.CommitFile {
+	status := "modified"
+	switch {
+	case d.NewFile:
+		status = "added"
+	case d.DeletedFile:
+		status = "removed"
+	case d.RenamedFile:
+		status = "renamed"
+	}
+	additions, deletions := 0, 0
+	for _, line := range strings.Split(d.Diff, "\n") {
+		if strings.HasPrefix(line, "+") && !strings.HasPrefix(line, "+++") {
+			additions++
+		} else if strings.HasPrefix(line, "-") && !strings.HasPrefix(line, "---") {
+			deletions++
+		}
+	}
+	return &github.CommitFile{
+		Filename:  github.String(d.NewPath),
+		Status:    github.String(status),
+		Additions: github.Int(additions),
+		Deletions: github.Int(deletions),
+		Changes:   github.Int(additions + deletions),
+		Patch:     github.String(d.Diff),
+	}
+}
+
+// RequestReviewers adds the users to the merge request's reviewers. GitLab
+// has no team reviewers.
+func (s *PullRequestsService) RequestReviewers(ctx context.Context, owner, repo string, number int,
+	reviewers github.ReviewersRequest) (*github.PullRequest, *github.Response, error) {
+
+	if len(reviewers.TeamReviewers) > 0 {
+		return nil, nil, fmt.Errorf("team reviewers are %v", ErrUnsupported)
+	}
+	mr, resp, err := s.getMergeRequest(ctx, owner, repo, number)
+	if err != nil {
+		return nil, resp, err
+	}
+	ids, resp, err := s.client.userIDs(ctx, reviewers.Reviewers)
+	if err != nil {
+		return nil, resp, err
+	}
+	for _, reviewer := range mr.Reviewers {
+		ids = append(ids, reviewer.ID)
+	}
+	return s.update(ctx, owner, repo, number, map[string]interface{}{"reviewer_ids": ids})
+}
+
+func (s *PullRequestsService) update(ctx context.Context, owner, repo string, number int,
+	request map[string]interface{}) (*github.PullRequest, *github.Response, error) {
+
+	var mr mergeRequest
+	resp, err := s.client.do(ctx, "PUT", mergeRequestPath(owner, repo, number), nil, request, &mr)
+	if err != nil {
+		return nil, resp, err
+	}
+	pr, err := s.pullRequest(ctx, mr)
+	return pr, resp, err
+}
+
+// Create opens a merge request from the head branch of the same project.
+func (s *PullRequestsService) Create(ctx context.Context, owner, repo string,
+	pull *github.NewPullRequest) (*github.PullRequest, *github.Response, error) {
+
+	head := pull.GetHead()
+	if strings.Contains(head, ":") {
+		return nil, nil, fmt.Errorf("merge requests from other projects' branches are %v", ErrUnsupported)
+	}
+	request := map[string]interface{}{
+		"source_branch": head,
+		"target_branch": pull.GetBase(),
+		"title":         pull.GetTitle(),
+		"description":   pull.GetBody(),
+	}
+	var mr mergeRequest
+	resp, err := s.client.do(ctx, "POST", projectPath(owner, repo)+"/merge_requests", nil, request, &mr)
+	if err != nil {
+		return nil, resp, err
+	}
+	pr, err := s.pullRequest(ctx, mr)
+	return pr, resp, err
+}
+
+// CreateReview approves the merge request for APPROVE reviews. The review's
+// body, if any, is posted as a note, because GitLab's approvals have none.
+func (s *PullRequestsService) CreateReview(ctx context.Context, owner, repo string, number int,
+	review *github.PullRequestReviewRequest) (*github.PullRequestReview, *github.Response, error) {
+
+	var resp *github.Response
+	var err error
+	if review.GetBody() != "" {
+		_, resp, err = s.client.Issues.CreateComment(ctx, owner, repo, number,
+			&github.IssueComment{Body: review.Body})
+		if err != nil {
+			return nil, resp, err
+		}
+	}
+	state := "COMMENTED"
+	if review.GetEvent() == "APPROVE" {
+		request := map[string]interface{}{}
+		if review.GetCommitID() != "" {
+			request["sha"] = review.GetCommitID()
+		}
+		resp, err = s.client.do(ctx, "POST", mergeRequestPath(owner, repo, number)+"/approve", nil, request, nil)
+		if err != nil {
+			return nil, resp, err
+		}
+		state = "APPROVED"
+	}
+	return &github.PullRequestReview{State: github.String(state)}, resp, nil
+}
@@ -0,0 +1,303 @@
+package gitlab
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// The access levels of a project's members. A developer is the lowest that
+// can push to a project, which is what a collaborator can do on GitHub.
+const (
+	developerAccessLevel  = 30
+	maintainerAccessLevel = 40
+	ownerAccessLevel      = 50
+)
+
+// RepositoriesService exposes projects as repositories and the commit
+// statuses of their pipelines' jobs as statuses.
+type RepositoriesService struct {
+	client *Client
+}
+
+type commitStatus struct {
+	ID           int64  `json:"id"`
+	Name         string `json:"name"`
+	Status       string `json:"status"`
+	Description  string `json:"description"`
+	TargetURL    string `json:"target_url"`
+	AllowFailure bool   `json:"allow_failure"`
+}
+
+func (s *RepositoriesService) Get(ctx context.Context, owner, repo string) (*github.Repository, *github.Response,
+	error) {
+
+	var p project
+	resp, err := s.client.do(ctx, "GET", projectPath(owner, repo), nil, nil, &p)
+	if err != nil {
+		return nil, resp, err
+	}
+	var repository github.Repository
+	if err := convert(repositoryJSON(p), &repository); err != nil {
+		return nil, resp, err
+	}
+	return &repository, resp, nil
+}
+
+// CompareCommits compares the commits both ways, because GitLab only lists
+// the commits that head has and base doesn't.
+func (s *RepositoriesService) CompareCommits(ctx context.Context, owner, repo string, base,
+	head string) (*github.CommitsComparison, *github.Response, error) {
+
+	ahead, resp, err := s.compare(ctx, owner, repo, base, head)
+	if err != nil {
+		return nil, resp, err
+	}
+	behind, resp, err := s.compare(ctx, owner, repo, head, base)
+	if err != nil {
+		return nil, resp, err
+	}
+	status := "diverged"
+	switch {
+	case len(ahead) == 0 && len(behind) == 0:
+		status = "identical"
+	case len(behind) == 0:
+		status = "ahead"
+	case len(ahead) == 0:
+		status = "behind"
+	}
+	commits := make([]map[string]interface{}, len(ahead))
+	for i, c := range ahead {
+		commits[i] = c.json()
+	}
+	var comparison github.CommitsComparison
+	err = convert(map[string]interface{}{
+		"status":    status,
+		"ahead_by":  len(ahead),
+		"behind_by": len(behind),
+		"commits":   commits,
+	}, &comparison)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &comparison, resp, nil
+}
+
+func (s *RepositoriesService) compare(ctx context.Context, owner, repo, from, to string) ([]commit,
+	*github.Response, error) {
+
+	var comparison struct {
+		Commits []commit `json:"commits"`
+	}
+	query := url.Values{"from": {from}, "to": {to}}
+	resp, err := s.client.do(ctx, "GET", projectPath(owner, repo)+"/repository/compare", query, nil, &comparison)
+	return comparison.Commits, resp, err
+}
+
+// CreateStatus creates an external commit status. GitLab refuses to set a
+// status to the state it's already in, which is treated as a success.
+func (s *RepositoriesService) CreateStatus(ctx context.Context, owner, repo, ref string,
+	status *github.RepoStatus) (*github.RepoStatus, *github.Response, error) {
+
+	state := status.GetState()
+	if state == "failure" || state == "error" {
+		state = "failed"
+	}
+	request := map[string]interface{}{
+		"state":       state,
+		"name":        status.GetContext(),
+		"description": status.GetDescription(),
+	}
+	if status.GetTargetURL() != "" {
+		request["target_url"] = status.GetTargetURL()
+	}
+	path := fmt.Sprintf("%s/statuses/%s", projectPath(owner, repo), url.PathEscape(ref))
+	resp, err := s.client.do(ctx, "POST", path, nil, request, nil)
+	if err != nil {
+		if errResp, ok := err.(*github.ErrorResponse); ok && resp.StatusCode == http.StatusBadRequest &&
+			strings.Contains(errResp.Message, "Cannot transition status") {
+			return status, resp, nil
+		}
+		return nil, resp, err
+	}
+	return status, resp, nil
+}
+
+// GetCombinedStatus combines the latest statuses of the commit's jobs and
+// external statuses. Failed jobs that are allowed to fail count as
+// successful. All pages are fetched at once, because the combined state
+// depends on all of them.
+func (s *RepositoriesService) GetCombinedStatus(ctx context.Context, owner, repo, ref string,
+	opt *github.ListOptions) (*github.CombinedStatus, *github.Response, error) {
+
+	path := fmt.Sprintf("%s/repository/commits/%s/statuses", projectPath(owner, repo), url.PathEscape(ref))
+	query := url.Values{"per_page": {"100"}}
+	var statuses []commitStatus
+	var resp *github.Response
+	for {
+		var page []commitStatus
+		var err error
+		resp, err = s.client.do(ctx, "GET", path, query, nil, &page)
+		if err != nil {
+			return nil, resp, err
+		}
+		statuses = append(statuses, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		query.Set("page", fmt.Sprint(resp.NextPage))
+	}
+	combined := &github.CombinedStatus{
+		SHA:        github.String(ref),
+		TotalCount: github.Int(len(statuses)),
+		Statuses:   make([]github.RepoStatus, len(statuses)),
+	}
+	failed, pending := false, len(statuses) == 0
+	for i, status := range statuses {
+		state := githubState(status)
+		failed = failed || state == "failure" || state == "error"
+		pending = pending || state == "pending"
+		combined.Statuses[i] = github.RepoStatus{
+			ID:          github.Int64(status.ID),
+			State:       github.String(state),
+			Context:     github.String(status.Name),
+			Description: github.String(status.Description),
+			TargetURL:   github.String(status.TargetURL),
+		}
+	}
+	switch {
+	case failed:
+		combined.State = github.String("failure")
+	case pending:
+		combined.State = github.String("pending")
+	default:
+		combined.State = github.String("success")
+	}
+	return combined, resp, nil
+}
+
+func githubState(status commitStatus) string {
+	switch status.Status {
+	case "success", "skipped":
+		return "success"
+	case "failed":
+		if status.AllowFailure {
+			return "success"
+		}
+		return "failure"
+	case "canceled":
+		return "error"
+	}
+	return "pending"
+}
+
+// IsCollaborator checks whether the user is a member of the project, directly
+// or through its groups, who can push to it.
+func (s *RepositoriesService) IsCollaborator(ctx context.Context, owner, repo, username string) (bool,
+	*github.Response, error) {
+
+	accessLevel, resp, err := s.accessLevel(ctx, owner, repo, username)
+	return accessLevel >= developerAccessLevel, resp, err
+}
+
+// AuthorAssociation maps the user's access level in the project to the
+// author_association GitHub would give the user's comments: owners are
+// OWNER, maintainers MEMBER and developers COLLABORATOR. Everyone else,
+// including the reporters and the guests, who can't push to the project, is
+// NONE.
+func (s *RepositoriesService) AuthorAssociation(ctx context.Context, owner, repo, username string) (string,
+	error) {
+
+	accessLevel, _, err := s.accessLevel(ctx, owner, repo, username)
+	switch {
+	case err != nil:
+		return "", err
+	case accessLevel >= ownerAccessLevel:
+		return "OWNER", nil
+	case accessLevel >= maintainerAccessLevel:
+		return "MEMBER", nil
+	case accessLevel >= developerAccessLevel:
+		return "COLLABORATOR", nil
+	}
+	return "NONE", nil
+}
+
+// accessLevel gets the user's access level in the project, directly or
+// through its groups. Users who aren't members have none.
+func (s *RepositoriesService) accessLevel(ctx context.Context, owner, repo, username string) (int,
+	*github.Response, error) {
+
+	id, resp, err := s.client.userID(ctx, username)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return 0, resp, nil
+		}
+		return 0, resp, err
+	}
+	var member struct {
+		AccessLevel int `json:"access_level"`
+	}
+	resp, err = s.client.do(ctx, "GET", fmt.Sprintf("%s/members/all/%d", projectPath(owner, repo), id), nil, nil,
+		&member)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return 0, resp, nil
+		}
+		return 0, resp, err
+	}
+	return member.AccessLevel, resp, nil
+}
+
+// GetRequiredStatusChecks responds with a 404, as GitHub does for unprotected
+// branches, because GitLab's protected branches don't require statuses.
+func (s *RepositoriesService) GetRequiredStatusChecks(ctx context.Context, owner, repo,
+	branch string) (*github.RequiredStatusChecks, *github.Response, error) {
+
+	return nil, notFound(nil), fmt.Errorf("required status checks are %v", ErrUnsupported)
+}
+
+func (s *RepositoriesService) ListReleases(ctx context.Context, owner, repo string,
+	opt *github.ListOptions) ([]*github.RepositoryRelease, *github.Response, error) {
+
+	return nil, nil, fmt.Errorf("release drafts are %v", ErrUnsupported)
+}
+
+func (s *RepositoriesService) CreateRelease(ctx context.Context, owner, repo string,
+	release *github.RepositoryRelease) (*github.RepositoryRelease, *github.Response, error) {
+
+	return nil, nil, fmt.Errorf("release drafts are %v", ErrUnsupported)
+}
+
+func (s *RepositoriesService) EditRelease(ctx context.Context, owner, repo string, id int,
+	release *github.RepositoryRelease) (*github.RepositoryRelease, *github.Response, error) {
+
+	return nil, nil, fmt.Errorf("release drafts are %v", ErrUnsupported)
+}
+
+// CreateComment comments on the commit.
+func (s *RepositoriesService) CreateComment(ctx context.Context, owner, repo, sha string,
+	comment *github.RepositoryComment) (*github.RepositoryComment, *github.Response, error) {
+
+	path := fmt.Sprintf("%s/repository/commits/%s/comments", projectPath(owner, repo), url.PathEscape(sha))
+	resp, err := s.client.do(ctx, "POST", path, nil, map[string]interface{}{"note": comment.GetBody()}, nil)
+	if err != nil {
+		return nil, resp, err
+	}
+	return comment, resp, nil
+}
+
+func (s *RepositoriesService) CreateDeployment(ctx context.Context, owner, repo string,
+	request *github.DeploymentRequest) (*github.Deployment, *github.Response, error) {
+
+	return nil, nil, fmt.Errorf("deployments are %v", ErrUnsupported)
+}
+
+func (s *RepositoriesService) Merge(ctx context.Context, owner, repo string,
+	request *github.RepositoryMergeRequest) (*github.RepositoryCommit, *github.Response, error) {
+
+	return nil, nil, fmt.Errorf("merging branches without a merge request is %v", ErrUnsupported)
+}
@@ -0,0 +1,215 @@
+package gitlab
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/google/go-github/github"
+)
+
+var shaRegexp = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// SearchService searches merge requests with the subset of GitHub's issue
+// search syntax the bot uses.
+type SearchService struct {
+	client *Client
+}
+
+// searchQuery is a GitHub issue search query translated to the merge request
+// list parameters of the projects and groups to search in and the filters
+// GitLab can't apply itself.
+type searchQuery struct {
+	projects []string
+	groups   []string
+	params   url.Values
+	sha      string
+	status   string
+}
+
+// parseSearchQuery parses the qualifiers the bot's searches use: repo:, user:
+// (a group on GitLab), label:, -label:, is:, status:, updated:< and a commit
+// SHA, which matches the merge requests it's the head of.
+func parseSearchQuery(query string) (searchQuery, error) {
+	parsed := searchQuery{params: url.Values{"state": {"all"}}}
+	var labels, notLabels, terms []string
+	for _, token := range splitQuery(query) {
+		i := strings.Index(token, ":")
+		if i < 0 {
+			if shaRegexp.MatchString(token) {
+				parsed.sha = token
+			} else {
+				terms = append(terms, token)
+			}
+			continue
+		}
+		qualifier, value := token[:i], strings.Trim(token[i+1:], `"`)
+		switch qualifier {
+		case "repo":
+			if !strings.Contains(value, "/") {
+				return searchQuery{}, fmt.Errorf("expected repo:namespace/project, got \"%s\"", token)
+			}
+			parsed.projects = append(parsed.projects, value)
+		case "user", "org":
+			parsed.groups = append(parsed.groups, value)
+		case "label":
+			labels = append(labels, value)
+		case "-label":
+			notLabels = append(notLabels, value)
+		case "is":
+			switch value {
+			case "pr":
+			case "open":
+				parsed.params.Set("state", "opened")
+			case "closed", "merged":
+				parsed.params.Set("state", value)
+			default:
+				return searchQuery{}, fmt.Errorf("the \"%s\" qualifier is %v", token, ErrUnsupported)
+			}
+		case "status":
+			parsed.status = value
+		case "updated":
+			if !strings.HasPrefix(value, "<") {
+				return searchQuery{}, fmt.Errorf("the \"%s\" qualifier is %v", token, ErrUnsupported)
+			}
+			parsed.params.Set("updated_before", strings.TrimPrefix(value, "<"))
+		default:
+			return searchQuery{}, fmt.Errorf("the \"%s\" qualifier is %v", token, ErrUnsupported)
+		}
+	}
+	if len(parsed.projects) == 0 && len(parsed.groups) == 0 {
+		return searchQuery{}, fmt.Errorf("expected the query \"%s\" to be limited with repo: or user:", query)
+	}
+	if len(labels) > 0 {
+		parsed.params.Set("labels", strings.Join(labels, ","))
+	}
+	if len(notLabels) > 0 {
+		parsed.params.Set("not[labels]", strings.Join(notLabels, ","))
+	}
+	if len(terms) > 0 {
+		parsed.params.Set("search", strings.Join(terms, " "))
+	}
+	return parsed, nil
+}
+
+// splitQuery splits the query on whitespace outside double quotes.
+func splitQuery(query string) []string {
+	var tokens []string
+	var token strings.Builder
+	quoted := false
+	for _, r := range query {
+		if r == '"' {
+			quoted = !quoted
+		} else if unicode.IsSpace(r) && !quoted {
+			if token.Len() > 0 {
+				tokens = append(tokens, token.String())
+				token.Reset()
+			}
+			continue
+		}
+		token.WriteRune(r)
+	}
+	if token.Len() > 0 {
+		tokens = append(tokens, token.String())
+	}
+	return tokens
+}
+
+// Issues searches the merge requests of the projects and groups the query
+// names. All matches are returned at once, because the SHA and status:
+// filters are applied after listing the merge requests.
+func (s *SearchService) Issues(ctx context.Context, query string,
+	opt *github.SearchOptions) (*github.IssuesSearchResult, *github.Response, error) {
+
+	parsed, err := parseSearchQuery(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	var paths []string
+	for _, p := range parsed.projects {
+		paths = append(paths, "projects/"+url.PathEscape(p)+"/merge_requests")
+	}
+	for _, group := range parsed.groups {
+		paths = append(paths, "groups/"+url.PathEscape(group)+"/merge_requests")
+	}
+	var resp *github.Response
+	issues := []github.Issue{}
+	for _, path := range paths {
+		var mrs []mergeRequest
+		mrs, resp, err = s.listAll(ctx, path, parsed.params)
+		if err != nil {
+			return nil, resp, err
+		}
+		for _, mr := range mrs {
+			issue, matches, err := s.match(ctx, parsed, mr)
+			if err != nil {
+				return nil, resp, err
+			} else if matches {
+				issues = append(issues, *issue)
+			}
+		}
+	}
+	result := &github.IssuesSearchResult{
+		Total:             github.Int(len(issues)),
+		IncompleteResults: github.Bool(false),
+		Issues:            issues,
+	}
+	if resp != nil {
+		resp.NextPage = 0
+	}
+	return result, resp, nil
+}
+
+func (s *SearchService) listAll(ctx context.Context, path string, params url.Values) ([]mergeRequest,
+	*github.Response, error) {
+
+	query := url.Values{"per_page": {"100"}}
+	for key, values := range params {
+		query[key] = values
+	}
+	var mrs []mergeRequest
+	for {
+		var page []mergeRequest
+		resp, err := s.client.do(ctx, "GET", path, query, nil, &page)
+		if err != nil {
+			return nil, resp, err
+		}
+		mrs = append(mrs, page...)
+		if resp.NextPage == 0 {
+			return mrs, resp, nil
+		}
+		query.Set("page", fmt.Sprint(resp.NextPage))
+	}
+}
+
+// match applies the filters GitLab can't and converts the merge request to
+// an issue of its target project.
+func (s *SearchService) match(ctx context.Context, parsed searchQuery, mr mergeRequest) (*github.Issue, bool,
+	error) {
+
+	if parsed.sha != "" && !strings.HasPrefix(mr.SHA, parsed.sha) {
+		return nil, false, nil
+	}
+	if parsed.status != "" {
+		source, err := s.client.getProject(ctx, mr.SourceProjectID)
+		if err != nil {
+			return nil, false, err
+		}
+		combined, _, err := s.client.Repositories.GetCombinedStatus(ctx, source.Namespace.FullPath, source.Path,
+			mr.SHA, nil)
+		if err != nil {
+			return nil, false, err
+		} else if combined.GetState() != parsed.status {
+			return nil, false, nil
+		}
+	}
+	target, err := s.client.getProject(ctx, mr.TargetProjectID)
+	if err != nil {
+		return nil, false, err
+	}
+	issue, err := s.client.issue(target.Namespace.FullPath, target.Path, mr)
+	return issue, err == nil, err
+}
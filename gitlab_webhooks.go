@@ -0,0 +1,310 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/salemove/github-review-helper/gitlab"
+)
+
+// gitlabPipelineContext is the status context GitLab's pipelines are
+// reported with, for the webhooks translated from pipeline events
+const gitlabPipelineContext = "gitlab/pipeline"
+
+// gitlabWebhook holds the fields of GitLab's merge request, note, pipeline
+// and push events that the translations need.
+type gitlabWebhook struct {
+	ObjectKind string `json:"object_kind"`
+	User       struct {
+		Username string `json:"username"`
+	} `json:"user"`
+	Project struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+		GitSSHURL         string `json:"git_ssh_url"`
+	} `json:"project"`
+	ObjectAttributes struct {
+		ID           int64  `json:"id"`
+		IID          int    `json:"iid"`
+		Action       string `json:"action"`
+		OldRev       string `json:"oldrev"`
+		Note         string `json:"note"`
+		NoteableType string `json:"noteable_type"`
+		SHA          string `json:"sha"`
+		Ref          string `json:"ref"`
+		Status       string `json:"status"`
+	} `json:"object_attributes"`
+	MergeRequest struct {
+		IID int `json:"iid"`
+	} `json:"merge_request"`
+	Changes struct {
+		Labels *struct {
+			Previous []gitlabLabel `json:"previous"`
+			Current  []gitlabLabel `json:"current"`
+		} `json:"labels"`
+		Title       json.RawMessage `json:"title"`
+		Description json.RawMessage `json:"description"`
+	} `json:"changes"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+	Ref    string `json:"ref"`
+}
+
+type gitlabLabel struct {
+	Title string `json:"title"`
+}
+
+// createGitlabHandler creates the handler for the webhooks of the GitLab
+// instance at GITLAB_URL. GitLab's repositories are cloned to a directory of
+// their own, so that they wouldn't be mixed up with GitHub's repositories of
+// the same name.
+func createGitlabHandler(conf Config, configSource ConfigSource, reposDir string, store Store, scheduler *Scheduler,
+	errorReporter ErrorReporter, auditLog AuditLog, asyncOperationWg *sync.WaitGroup) Handler {
+
+	httpClient := &http.Client{
+		Transport: proxyTransport(conf),
+		Timeout:   30 * time.Second,
+	}
+	driver := gitlabDriver{gitlab.NewClient(httpClient, conf.GitlabURL, conf.GitlabAccessToken)}
+	// GitHub's tenants don't apply to the instance's repositories
+	gitRepos := newGitReposWithEnv(conf, filepath.Join(reposDir, "gitlab"), gitIdentity(conf, nil), gitEnv(conf))
+	gitRepos, pullRequests := limitResources(conf, gitRepos, driver.PullRequests())
+	handler := CreateHandler(configSource, gitRepos, store, scheduler, errorReporter, auditLog, asyncOperationWg,
+		pullRequests, driver.Repositories(), driver.Issues(), driver.Search(), driver.GraphQL())
+	return CreateGitlabWebhookHandler(configSource, pullRequests, driver.client.Repositories, handler)
+}
+
+// CreateGitlabWebhookHandler creates the handler for GitLab's webhooks. They
+// are translated to the GitHub webhooks they correspond to, which are passed
+// on to the handler created with the GitLab driver's clients. GitLab
+// authenticates its webhooks with a secret token instead of signing them, so
+// the token is checked against GITHUB_SECRET instead and the translated
+// webhooks are signed with it. GitLab's notes don't say how their authors
+// are associated with the project either, so the associations are looked up
+// from the authors' access levels.
+func CreateGitlabWebhookHandler(configSource ConfigSource, pullRequests PullRequests,
+	associations AuthorAssociations, handler Handler) Handler {
+
+	return func(w http.ResponseWriter, r *http.Request) Response {
+		conf := configSource.Current()
+		secret, errResp := checkGitlabToken(r, conf.Secrets)
+		if errResp != nil {
+			return errResp
+		}
+		body, errResp := readWebhookBody(conf, r)
+		if errResp != nil {
+			return errResp
+		}
+		var webhook gitlabWebhook
+		if err := json.Unmarshal(body, &webhook); err != nil {
+			return ErrorResponse{err, http.StatusBadRequest, "Failed to parse the request's body"}
+		}
+		translations, errResp := translateGitlabWebhook(webhook, pullRequests, associations)
+		if errResp != nil {
+			return errResp
+		}
+		return forwardTranslations(w, r, secret, r.Header.Get("X-Gitlab-Event-UUID"), translations, handler)
+	}
+}
+
+// checkGitlabToken checks that the webhook's X-Gitlab-Token is one of the
+// secrets and returns it.
+func checkGitlabToken(r *http.Request, secrets []string) (string, *ErrorResponse) {
+	token := r.Header.Get("X-Gitlab-Token")
+	if token == "" {
+		return "", &ErrorResponse{nil, http.StatusUnauthorized, "Please provide a X-Gitlab-Token"}
+	}
+	for _, secret := range secrets {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1 {
+			return secret, nil
+		}
+	}
+	return "", &ErrorResponse{nil, http.StatusForbidden, "Bad X-Gitlab-Token"}
+}
+
+// translateGitlabWebhook translates the webhook to GitHub's webhooks. A
+// merge request update that changes several labels translates to a webhook
+// per label. Events without a GitHub counterpart translate to none.
+func translateGitlabWebhook(webhook gitlabWebhook, pullRequests PullRequests,
+	associations AuthorAssociations) ([]webhookTranslation, *ErrorResponse) {
+
+	repository := gitlabRepository(webhook.Project.PathWithNamespace)
+	repository.URL = webhook.Project.GitSSHURL
+	sender := map[string]interface{}{"login": webhook.User.Username}
+	switch webhook.ObjectKind {
+	case "merge_request":
+		pr, errResp := getPR(Issue{Number: webhook.ObjectAttributes.IID, Repository: repository}, pullRequests)
+		if errResp != nil {
+			return nil, errResp
+		}
+		event := func(action string) map[string]interface{} {
+			return map[string]interface{}{
+				"action":       action,
+				"number":       pr.GetNumber(),
+				"pull_request": pr,
+				"repository":   pr.Base.Repo,
+				"sender":       sender,
+			}
+		}
+		return translateMergeRequestAction(webhook, event), nil
+	case "note":
+		if webhook.ObjectAttributes.NoteableType != "MergeRequest" {
+			return nil, nil
+		}
+		pr, errResp := getPR(Issue{Number: webhook.MergeRequest.IID, Repository: repository}, pullRequests)
+		if errResp != nil {
+			return nil, errResp
+		}
+		association, errResp := authorAssociation(repository, webhook.User.Username, associations)
+		if errResp != nil {
+			return nil, errResp
+		}
+		action := "created"
+		if webhook.ObjectAttributes.Action == "update" {
+			action = "edited"
+		}
+		return []webhookTranslation{{"issue_comment", map[string]interface{}{
+			"action": action,
+			"issue": map[string]interface{}{
+				"number":       pr.GetNumber(),
+				"pull_request": map[string]interface{}{"url": pr.GetHTMLURL()},
+				"user":         pr.User,
+				"labels":       pr.Labels,
+			},
+			"comment": map[string]interface{}{
+				"node_id":            fmt.Sprintf("gitlab-note-%d", webhook.ObjectAttributes.ID),
+				"body":               webhook.ObjectAttributes.Note,
+				"user":               sender,
+				"author_association": association,
+			},
+			"repository": pr.Base.Repo,
+			"sender":     sender,
+		}}}, nil
+	case "pipeline":
+		return []webhookTranslation{{"status", map[string]interface{}{
+			"sha":     webhook.ObjectAttributes.SHA,
+			"state":   githubPipelineState(webhook.ObjectAttributes.Status),
+			"context": gitlabPipelineContext,
+			"branches": []interface{}{map[string]interface{}{
+				"name":   webhook.ObjectAttributes.Ref,
+				"commit": map[string]interface{}{"sha": webhook.ObjectAttributes.SHA},
+			}},
+			"repository": gitlabRepositoryJSON(repository),
+			"sender":     sender,
+		}}}, nil
+	case "push":
+		return []webhookTranslation{{"push", map[string]interface{}{
+			"ref":        webhook.Ref,
+			"before":     webhook.Before,
+			"after":      webhook.After,
+			"deleted":    strings.Trim(webhook.After, "0") == "",
+			"repository": gitlabRepositoryJSON(repository),
+			"sender":     sender,
+		}}}, nil
+	}
+	return nil, nil
+}
+
+// translateMergeRequestAction translates a merge request event's action to
+// the pull request event actions. Approvals are translated to approving
+// reviews.
+func translateMergeRequestAction(webhook gitlabWebhook,
+	event func(action string) map[string]interface{}) []webhookTranslation {
+
+	switch webhook.ObjectAttributes.Action {
+	case "open":
+		return []webhookTranslation{{"pull_request", event("opened")}}
+	case "reopen":
+		return []webhookTranslation{{"pull_request", event("reopened")}}
+	case "close", "merge":
+		return []webhookTranslation{{"pull_request", event("closed")}}
+	case "approved", "approval":
+		review := event("submitted")
+		review["review"] = map[string]interface{}{
+			"state": "approved",
+			"user":  map[string]interface{}{"login": webhook.User.Username},
+		}
+		return []webhookTranslation{{"pull_request_review", review}}
+	case "update":
+		return translateMergeRequestUpdate(webhook, event)
+	}
+	return nil
+}
+
+// translateMergeRequestUpdate translates an update to a synchronize event, if
+// commits were pushed, and to an event per added or removed label.
+func translateMergeRequestUpdate(webhook gitlabWebhook,
+	event func(action string) map[string]interface{}) []webhookTranslation {
+
+	var translations []webhookTranslation
+	if webhook.ObjectAttributes.OldRev != "" {
+		synchronize := event("synchronize")
+		synchronize["before"] = webhook.ObjectAttributes.OldRev
+		translations = append(translations, webhookTranslation{"pull_request", synchronize})
+	}
+	if labels := webhook.Changes.Labels; labels != nil {
+		previous, current := gitlabLabelTitles(labels.Previous), gitlabLabelTitles(labels.Current)
+		for _, label := range current {
+			if !containsLabel(previous, label) {
+				labeled := event("labeled")
+				labeled["label"] = map[string]interface{}{"name": label}
+				translations = append(translations, webhookTranslation{"pull_request", labeled})
+			}
+		}
+		for _, label := range previous {
+			if !containsLabel(current, label) {
+				unlabeled := event("unlabeled")
+				unlabeled["label"] = map[string]interface{}{"name": label}
+				translations = append(translations, webhookTranslation{"pull_request", unlabeled})
+			}
+		}
+	}
+	if len(webhook.Changes.Title) > 0 || len(webhook.Changes.Description) > 0 {
+		translations = append(translations, webhookTranslation{"pull_request", event("edited")})
+	}
+	return translations
+}
+
+func gitlabLabelTitles(labels []gitlabLabel) []string {
+	titles := make([]string, len(labels))
+	for i, label := range labels {
+		titles[i] = label.Title
+	}
+	return titles
+}
+
+// gitlabRepository splits the project's path into its namespace, which is
+// the owner, and its path, which is the name.
+func gitlabRepository(pathWithNamespace string) Repository {
+	i := strings.LastIndex(pathWithNamespace, "/")
+	if i < 0 {
+		return Repository{Name: pathWithNamespace}
+	}
+	return Repository{Owner: pathWithNamespace[:i], Name: pathWithNamespace[i+1:]}
+}
+
+func gitlabRepositoryJSON(repository Repository) map[string]interface{} {
+	return map[string]interface{}{
+		"name":    repository.Name,
+		"owner":   map[string]interface{}{"login": repository.Owner},
+		"ssh_url": repository.URL,
+	}
+}
+
+// githubPipelineState maps the pipeline's status to a status state.
+func githubPipelineState(status string) string {
+	switch status {
+	case "success", "skipped":
+		return "success"
+	case "failed":
+		return "failure"
+	case "canceled":
+		return "error"
+	}
+	return "pending"
+}
@@ -0,0 +1,186 @@
+package main_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type translatedWebhook struct {
+	event     string
+	signature string
+	body      []byte
+}
+
+var _ = Describe("CreateGitlabWebhookHandler", func() {
+	const secret = "a-secret"
+
+	var (
+		pullRequests     *mocks.PullRequests
+		associations     *mocks.AuthorAssociations
+		responseRecorder *httptest.ResponseRecorder
+		translated       []translatedWebhook
+		token            string
+		webhook          string
+	)
+
+	BeforeEach(func() {
+		pullRequests = new(mocks.PullRequests)
+		associations = new(mocks.AuthorAssociations)
+		responseRecorder = httptest.NewRecorder()
+		translated = nil
+		token = secret
+		pullRequests.
+			On("Get", anyContext, "acme/tools", "widget", issueNumber).
+			Return(&github.PullRequest{
+				Number:  github.Int(issueNumber),
+				HTMLURL: github.String("https://gitlab.example.com/acme/tools/widget/-/merge_requests/7"),
+				User:    &github.User{Login: github.String(arbitraryIssueAuthor)},
+				Base: &github.PullRequestBranch{
+					Ref: github.String("master"),
+					Repo: &github.Repository{
+						Name:  github.String("widget"),
+						Owner: &github.User{Login: github.String("acme/tools")},
+					},
+				},
+			}, emptyResponse, noError)
+	})
+
+	handle := func() {
+		handler := grh.CreateGitlabWebhookHandler(grh.Config{Secrets: []string{secret}}, pullRequests, associations,
+			func(w http.ResponseWriter, r *http.Request) grh.Response {
+				body, err := ioutil.ReadAll(r.Body)
+				Expect(err).NotTo(HaveOccurred())
+				translated = append(translated, translatedWebhook{
+					event:     r.Header.Get("X-Github-Event"),
+					signature: r.Header.Get("X-Hub-Signature-256"),
+					body:      body,
+				})
+				return grh.SuccessResponse{}
+			})
+		request, err := http.NewRequest("POST", "/gitlab", strings.NewReader(webhook))
+		Expect(err).NotTo(HaveOccurred())
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("X-Gitlab-Token", token)
+		handler.ServeHTTP(responseRecorder, request)
+	}
+
+	field := func(body []byte, path ...string) interface{} {
+		var value interface{}
+		Expect(json.Unmarshal(body, &value)).To(Succeed())
+		for _, key := range path {
+			value = value.(map[string]interface{})[key]
+		}
+		return value
+	}
+
+	Context("with a note on a merge request", func() {
+		BeforeEach(func() {
+			webhook = `{
+  "object_kind": "note",
+  "user": {"username": "reviewer"},
+  "project": {"path_with_namespace": "acme/tools/widget"},
+  "object_attributes": {"id": 1001, "note": "!merge", "noteable_type": "MergeRequest"},
+  "merge_request": {"iid": 7}
+}`
+			associations.
+				On("AuthorAssociation", anyContext, "acme/tools", "widget", "reviewer").
+				Return("NONE", noError)
+		})
+
+		It("passes it on as a signed issue_comment webhook", func() {
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			Expect(translated).To(HaveLen(1))
+			Expect(translated[0].event).To(Equal("issue_comment"))
+			Expect(field(translated[0].body, "comment", "body")).To(Equal("!merge"))
+			Expect(field(translated[0].body, "comment", "author_association")).To(Equal("NONE"))
+			Expect(field(translated[0].body, "issue", "user", "login")).To(Equal(arbitraryIssueAuthor))
+			Expect(field(translated[0].body, "repository", "owner", "login")).To(Equal("acme/tools"))
+
+			mac := hmac.New(sha256.New, []byte(secret))
+			mac.Write(translated[0].body)
+			Expect(translated[0].signature).To(Equal("sha256=" + hex.EncodeToString(mac.Sum(nil))))
+		})
+
+		Context("with a wrong token", func() {
+			BeforeEach(func() {
+				token = "not-the-secret"
+			})
+
+			It("refuses the webhook", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusForbidden))
+				Expect(translated).To(BeEmpty())
+			})
+		})
+	})
+
+	Context("with a merge request update changing its labels", func() {
+		BeforeEach(func() {
+			webhook = `{
+  "object_kind": "merge_request",
+  "user": {"username": "procoder"},
+  "project": {"path_with_namespace": "acme/tools/widget"},
+  "object_attributes": {"iid": 7, "action": "update"},
+  "changes": {"labels": {
+    "previous": [{"title": "on hold"}],
+    "current": [{"title": "merging"}]
+  }}
+}`
+		})
+
+		It("passes on a webhook per added and removed label", func() {
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			Expect(translated).To(HaveLen(2))
+			Expect(translated[0].event).To(Equal("pull_request"))
+			Expect(field(translated[0].body, "action")).To(Equal("labeled"))
+			Expect(field(translated[0].body, "label", "name")).To(Equal(grh.MergingLabel))
+			Expect(field(translated[1].body, "action")).To(Equal("unlabeled"))
+			Expect(field(translated[1].body, "label", "name")).To(Equal(grh.OnHoldLabel))
+		})
+	})
+
+	Context("with a failed pipeline", func() {
+		BeforeEach(func() {
+			webhook = `{
+  "object_kind": "pipeline",
+  "project": {"path_with_namespace": "acme/tools/widget"},
+  "object_attributes": {"sha": "1235abc", "ref": "feature", "status": "failed"}
+}`
+		})
+
+		It("passes it on as a failed status", func() {
+			handle()
+			Expect(translated).To(HaveLen(1))
+			Expect(translated[0].event).To(Equal("status"))
+			Expect(field(translated[0].body, "state")).To(Equal("failure"))
+			Expect(field(translated[0].body, "sha")).To(Equal("1235abc"))
+		})
+	})
+
+	Context("with an event without a GitHub counterpart", func() {
+		BeforeEach(func() {
+			webhook = `{"object_kind": "wiki_page", "project": {"path_with_namespace": "acme/tools/widget"}}`
+		})
+
+		It("ignores it", func() {
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			Expect(translated).To(BeEmpty())
+		})
+	})
+})
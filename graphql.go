@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const githubGraphQLURL = "https://api.github.com/graphql"
+
+// GraphQL executes queries against GitHub's GraphQL API. It's used for data
+// that the REST API doesn't expose.
+type GraphQL interface {
+	// Query runs the query with the given variables and unmarshals the
+	// "data" field of the response into result.
+	Query(ctx context.Context, query string, variables map[string]interface{}, result interface{}) error
+}
+
+type graphQLClient struct {
+	httpClient *http.Client
+	url        string
+}
+
+func NewGraphQLClient(httpClient *http.Client) GraphQL {
+	return graphQLClient{
+		httpClient: httpClient,
+		url:        githubGraphQLURL,
+	}
+}
+
+func (c graphQLClient) Query(ctx context.Context, query string, variables map[string]interface{},
+	result interface{}) error {
+
+	body, err := json.Marshal(struct {
+		Query     string                 `json:"query"`
+		Variables map[string]interface{} `json:"variables,omitempty"`
+	}{query, variables})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GraphQL API responded with %s", resp.Status)
+	}
+	var response struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return err
+	}
+	if len(response.Errors) > 0 {
+		messages := make([]string, len(response.Errors))
+		for i, graphQLErr := range response.Errors {
+			messages[i] = graphQLErr.Message
+		}
+		return errors.New(strings.Join(messages, "; "))
+	}
+	return json.Unmarshal(response.Data, result)
+}
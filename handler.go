@@ -37,6 +37,17 @@ func (r ErrorResponse) logResponse() {
 	}
 }
 
+// asErrorResponse returns the response as an ErrorResponse, if it is one.
+func asErrorResponse(response Response) (ErrorResponse, bool) {
+	switch r := response.(type) {
+	case ErrorResponse:
+		return r, true
+	case *ErrorResponse:
+		return *r, r != nil
+	}
+	return ErrorResponse{}, false
+}
+
 type SuccessResponse struct {
 	Message string
 }
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// version is set when building the bot, e.g. with
+// go install -ldflags "-X main.version=1.2.3"
+var version = "dev"
+
+// commandUsages lists the commands the bot understands, in the order they're
+// explained in.
+var commandUsages = []struct {
+	Usage       string
+	Description string
+}{
+	{"!squash", "squash the fixup! and squash! commits"},
+	{"!squash [<count>] [\"<message>\"]", "squash the last <count> or all commits into one"},
+	{"!check", "check for fixup! and squash! commits"},
+	{"!merge [squash|rebase|commit] [force-wait] [--next] [--message \"<message>\"] [ignore=<context>...]",
+		"squash and merge the PR once it's ready"},
+	{"!merge at <time>|after-freeze",
+		"merge the PR at the time, e.g. 2024-06-01T09:00Z, or when the merge freeze ends"},
+	{"!hold", "keep the PR from being merged"},
+	{"!unhold", "remove the hold"},
+	{"!block <reason>", "keep the PR from being merged until you lift the block"},
+	{"!unblock [@user]", "lift your or, as an admin, the user's block"},
+	{"!depends-on #<number>...|none", "keep the PR from being merged before the other PRs"},
+	{"!priority high|normal", "move the PR to the front of the merge queue or back"},
+	{"!status", "explain whether the PR is ready to be merged"},
+	{"!simulate merge", "explain what merging the PR would do now"},
+	{"!summary", "post a digest of the PR for its reviewers"},
+	{"!whose-turn", "show who the PR is waiting for"},
+	{"!assign @user...", "assign the users to the PR"},
+	{"!unassign @user...", "unassign the users from the PR"},
+	{"!title <title>", "rename the PR"},
+	{"!label +label -label...", "add and remove the PR's labels"},
+	{"!remind me in <delay> [to <what>]", "remind you about the PR later"},
+	{"!confirm", "confirm an action during the soft-fail period or another maintainer's merge"},
+	{"!cherry-pick <branch>", "cherry-pick the merged PR onto the branch"},
+	{"!revert [merge]", "open a PR that reverts the merged PR"},
+	{"!selftest", "check the bot's access to the repository"},
+	{"!rerun-checks", "re-run the failed check suites"},
+	{"!dco-override", "waive the sign-off requirement"},
+	{"!deploy <environment>", "deploy the PR to the environment"},
+	{"!lock [off-topic|too heated|resolved|spam]", "lock the conversation, so that only collaborators can comment"},
+	{"!unlock", "unlock the conversation"},
+	{"!protect", "apply BRANCH_PROTECTION to the repository's branches"},
+	{"!approve-contributor", "let the bot automate a first-time contributor's PR"},
+	{"!cla-signed", "check the PR author's CLA signature again"},
+	{"!help", "list the commands"},
+}
+
+func isHelpCommand(comment string) bool {
+	return strings.TrimSpace(comment) == "!help"
+}
+
+func handleHelpCommand(conf Config, issueComment IssueComment, issues Issues) Response {
+	issue := issueComment.Issue()
+	message := renderMessage(conf, helpMessage, commandMessageData(issueComment, map[string]interface{}{
+		"Commands": commandUsages,
+	}))
+	if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+		errorMessage := fmt.Sprintf("Failed to list the commands on %s", issue.FullName())
+		return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	return SuccessResponse{message}
+}
+
+// versionInfo describes what a deployment of the bot is capable of.
+type versionInfo struct {
+	Version   string   `json:"version"`
+	GoVersion string   `json:"go_version"`
+	Features  []string `json:"features"`
+	Commands  []string `json:"commands"`
+	// Providers maps the kinds of external services, e.g. "notifications",
+	// to the configured ones
+	Providers map[string][]string `json:"providers"`
+}
+
+// CreateVersionHandler creates a handler that responds with the bot's
+// version and the features, commands and providers enabled in conf.
+func CreateVersionHandler(conf Config) http.Handler {
+	body, err := json.MarshalIndent(newVersionInfo(conf), "", "  ")
+	if err != nil {
+		panic(fmt.Sprintf("Failed to encode the version: %v", err))
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	})
+}
+
+func newVersionInfo(conf Config) versionInfo {
+	info := versionInfo{
+		Version:   version,
+		GoVersion: runtime.Version(),
+		Features:  enabledFeatures(conf),
+		Commands:  make([]string, len(commandUsages)),
+		Providers: configuredProviders(conf),
+	}
+	for i, command := range commandUsages {
+		info.Commands[i] = strings.Fields(command.Usage)[0]
+	}
+	return info
+}
+
+func enabledFeatures(conf Config) []string {
+	features := []string{"merge strategy: " + conf.MergeStrategy}
+	enabled := []struct {
+		name    string
+		enabled bool
+	}{
+		{"required approvals", conf.RequiredApprovals > 0},
+		{"resolved conversations", conf.RequireResolvedConversations},
+		{"status overrides", conf.AllowStatusOverrides},
+		{"size labels", conf.SizeLabels},
+		{"reviewer assignment", conf.ReviewerAssignment != ""},
+		{"review load reports", conf.ReviewLoadReportInterval != 0},
+		{"stale PR reminders", conf.StalePRCheckInterval != 0},
+		{"release notes", conf.ReleaseNotes},
+		{"milestone assignment", conf.MilestonePattern != nil},
+		{"commit message rule", conf.CommitMessageRule != nil},
+		{"sign-off requirement", conf.RequireSignOff},
+		{"issue reference rule", conf.IssueReferenceRule != nil},
+		{"description rules", descriptionRulesEnabled(conf)},
+		{"branch naming policy", len(conf.HeadBranchPatterns) > 0},
+		{"native merge queue", conf.NativeMergeQueue},
+		{"merge trains", conf.MergeTrain && conf.MergeStrategy == MergeStrategyVerifiedRebase},
+		{"dependency update auto-merge", conf.DependencyAutoMerge != ""},
+		{"merge receipts", conf.MergeReceiptStorage.Bucket != ""},
+		{"event bus", conf.EventBus != nil},
+		{"deployments", len(conf.DeployEnvironments) > 0},
+		{"soft-fail period", conf.SoftFailPeriod != 0},
+		{"merge freezes", len(conf.MergeFreezes) > 0},
+		{"merge queue limit", conf.MergeQueueMaxDepth != 0},
+		{"notification digests", conf.NotificationDigestInterval != 0},
+		{"merge hooks", len(conf.PreMergeHooks) > 0 || len(conf.PostMergeHooks) > 0},
+		{"GitHub status checks", conf.GithubStatusCheckInterval != 0},
+		{"admin API", conf.AdminToken != ""},
+		{"branch protection sync", conf.BranchProtectionSync && len(conf.BranchProtection) > 0},
+	}
+	for _, feature := range enabled {
+		if feature.enabled {
+			features = append(features, feature.name)
+		}
+	}
+	return features
+}
+
+func configuredProviders(conf Config) map[string][]string {
+	providers := map[string][]string{}
+	add := func(kind, provider string) {
+		for _, existing := range providers[kind] {
+			if existing == provider {
+				return
+			}
+		}
+		providers[kind] = append(providers[kind], provider)
+	}
+	for _, route := range conf.NotificationRoutes {
+		if backend, _, err := parseNotificationTarget(route.Target); err == nil {
+			add("notifications", backend)
+		}
+	}
+	if conf.SentryDSN != "" {
+		add("error_reporting", "sentry")
+	}
+	if conf.OTLPEndpoint != "" {
+		add("tracing", "otlp")
+	}
+	if conf.MergeReceiptStorage.Bucket != "" {
+		add("merge_receipts", "s3")
+	}
+	if conf.EventBus != nil {
+		add("event_bus", conf.EventBus.Backend)
+	}
+	if conf.LockRedisURL != nil {
+		add("locks", "redis")
+	} else {
+		add("locks", "local")
+	}
+	if conf.TLSCertFile != "" {
+		add("tls", "files")
+	} else if conf.ACMEHostname != "" {
+		add("tls", "acme")
+	}
+	for kind := range providers {
+		sort.Strings(providers[kind])
+	}
+	return providers
+}
@@ -0,0 +1,105 @@
+package main_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Version handler", func() {
+	var (
+		conf             grh.Config
+		responseRecorder *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		conf = grh.Config{MergeStrategy: grh.MergeStrategyMerge}
+		responseRecorder = httptest.NewRecorder()
+	})
+
+	handle := func() map[string]interface{} {
+		request := httptest.NewRequest("GET", "/version", nil)
+		grh.CreateVersionHandler(conf).ServeHTTP(responseRecorder, request)
+		Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+		var info map[string]interface{}
+		Expect(json.Unmarshal(responseRecorder.Body.Bytes(), &info)).To(Succeed())
+		return info
+	}
+
+	It("reports the version and the registered commands", func() {
+		info := handle()
+		Expect(info["version"]).To(Equal("dev"))
+		Expect(info["commands"]).To(ContainElement("!merge"))
+		Expect(info["commands"]).To(ContainElement("!help"))
+		Expect(info["features"]).To(Equal([]interface{}{"merge strategy: merge"}))
+	})
+
+	It("reports the enabled features and configured providers", func() {
+		conf.SizeLabels = true
+		conf.SentryDSN = "https://key@sentry.example.com/1"
+		conf.LockRedisURL = &url.URL{Scheme: "redis", Host: "redis.example.com:6379"}
+		conf.NotificationRoutes = grh.NotificationRoutes{
+			{Target: "slack:https://hooks.slack.com/services/1"},
+			{Events: []string{"merge"}, Target: "mailto:team@example.com"},
+			{Events: []string{"conflict"}, Target: "slack:https://hooks.slack.com/services/2"},
+		}
+
+		info := handle()
+		Expect(info["features"]).To(ContainElement("size labels"))
+		Expect(info["providers"]).To(Equal(map[string]interface{}{
+			"notifications":   []interface{}{"mailto", "slack"},
+			"error_reporting": []interface{}{"sentry"},
+			"locks":           []interface{}{"redis"},
+		}))
+	})
+})
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("!help comment", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			repositories = *context.Repositories
+			issues = *context.Issues
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!help", arbitraryIssueAuthor)
+		})
+
+		It("lists the commands along with the bot's version", func() {
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+			issues.
+				On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+					mock.MatchedBy(commentContaining("I'm github-review-helper dev and I understand these "+
+						"commands:\n\n- `!squash`"))).
+				Return(emptyResult, emptyResponse, noError)
+
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+		})
+	})
+})
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/salemove/github-review-helper/git"
+)
+
+const (
+	OnHoldLabel = "on-hold"
+)
+
+func isHoldCommand(comment string) bool {
+	return strings.TrimSpace(comment) == "!hold"
+}
+
+func isUnholdCommand(comment string) bool {
+	return strings.TrimSpace(comment) == "!unhold"
+}
+
+func handleHoldCommand(issueComment IssueComment, issues Issues) Response {
+	errResp := addLabel(issueComment.Repository, issueComment.IssueNumber, OnHoldLabel, issues)
+	if errResp != nil {
+		return errResp
+	}
+	return SuccessResponse{fmt.Sprintf("Put PR %s on hold", issueComment.Issue().FullName())}
+}
+
+// handleUnholdCommand removes the hold from the PR. A PR that was already
+// labeled for merging may have only been waiting for the hold to be lifted,
+// so it's merged right away if it's ready.
+func handleUnholdCommand(conf Config, issueComment IssueComment, store Store, issues Issues, pullRequests PullRequests,
+	repositories Repositories, graphQL GraphQL, gitRepos git.Repos) Response {
+	issue := issueComment.Issue()
+	if !issueComment.HasLabel(OnHoldLabel) {
+		return SuccessResponse{fmt.Sprintf("PR %s is not on hold. Ignoring.", issue.FullName())}
+	}
+	errResp := removeLabel(issueComment.Repository, issueComment.IssueNumber, OnHoldLabel, issues)
+	if errResp != nil {
+		return errResp
+	} else if !issueComment.HasLabel(MergingLabel) {
+		return SuccessResponse{fmt.Sprintf("Removed the hold from PR %s", issue.FullName())}
+	}
+	return mergeIfReady(conf, issue, true, store, issues, pullRequests, repositories, graphQL, gitRepos)
+}
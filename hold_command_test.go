@@ -0,0 +1,172 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	var (
+		handle      = context.Handle
+		headers     = context.Headers
+		requestJSON = context.RequestJSON
+
+		responseRecorder *httptest.ResponseRecorder
+		pullRequests     *mocks.PullRequests
+		repositories     *mocks.Repositories
+		issues           *mocks.Issues
+	)
+	BeforeEach(func() {
+		responseRecorder = *context.ResponseRecorder
+		pullRequests = *context.PullRequests
+		repositories = *context.Repositories
+		issues = *context.Issues
+	})
+
+	headers.Is(func() map[string]string {
+		return map[string]string{
+			"X-Github-Event": "issue_comment",
+		}
+	})
+
+	headSHA := "1235"
+	pr := &github.PullRequest{
+		Number:    github.Int(issueNumber),
+		Merged:    github.Bool(false),
+		Mergeable: github.Bool(true),
+		Base: &github.PullRequestBranch{
+			SHA:  github.String("1234"),
+			Ref:  github.String("master"),
+			Repo: repository,
+		},
+		Head: &github.PullRequestBranch{
+			SHA:  github.String(headSHA),
+			Ref:  github.String("feature"),
+			Repo: repository,
+		},
+		User: &github.User{
+			Login: github.String(arbitraryIssueAuthor),
+		},
+	}
+
+	mockMergeablePR := func(pr *github.PullRequest) {
+		BeforeEach(func() {
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+				Return(pr, emptyResponse, noError)
+			repositories.
+				On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.AnythingOfType("*github.ListOptions")).
+				Return(&github.CombinedStatus{
+					State: github.String("success"),
+				}, emptyResponse, noError)
+		})
+	}
+
+	Describe("!hold comment", func() {
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!hold", arbitraryIssueAuthor)
+		})
+
+		ForCollaborator(context, repositoryOwner, repositoryName, arbitraryIssueAuthor, func() {
+			BeforeEach(func() {
+				issues.
+					On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{grh.OnHoldLabel}).
+					Return(emptyResult, emptyResponse, noError)
+			})
+
+			It("labels the PR as being on hold", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			})
+		})
+	})
+
+	Describe("!unhold comment", func() {
+		BeforeEach(func() {
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+		})
+
+		Context("with the PR not being on hold", func() {
+			requestJSON.Is(func() string {
+				return IssueCommentEvent("!unhold", arbitraryIssueAuthor)
+			})
+
+			It("succeeds without changing anything", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			})
+		})
+
+		Context("with the PR being on hold", func() {
+			BeforeEach(func() {
+				issues.
+					On("RemoveLabelForIssue", anyContext, repositoryOwner, repositoryName, issueNumber, grh.OnHoldLabel).
+					Return(emptyResponse, noError)
+			})
+
+			Context("without the 'merging' label", func() {
+				requestJSON.Is(func() string {
+					return IssueCommentEventWithLabels("!unhold", arbitraryIssueAuthor, []string{grh.OnHoldLabel})
+				})
+
+				It("removes the hold", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				})
+			})
+
+			Context("with the 'merging' label", func() {
+				requestJSON.Is(func() string {
+					return IssueCommentEventWithLabels("!unhold", arbitraryIssueAuthor,
+						[]string{grh.MergingLabel, grh.OnHoldLabel})
+				})
+
+				mockMergeablePR(pr)
+
+				BeforeEach(func() {
+					mockLabels(issues, issueNumber, grh.MergingLabel)
+				})
+
+				ItMergesPR(context, pr)
+			})
+		})
+	})
+
+	Describe("!merge comment for a PR on hold", func() {
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!merge", arbitraryIssueAuthor)
+		})
+
+		BeforeEach(func() {
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+			issues.
+				On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{grh.MergingLabel}).
+				Return(emptyResult, emptyResponse, noError)
+			issues.
+				On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+					mock.MatchedBy(commentContaining("on hold"))).
+				Return(emptyResult, emptyResponse, noError)
+			mockLabels(issues, issueNumber, grh.OnHoldLabel)
+		})
+
+		mockMergeablePR(pr)
+
+		It("reports the hold without merging", func() {
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			Expect(responseRecorder.Body.String()).To(ContainSubstring("Not merging"))
+		})
+	})
+})
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/git"
+)
+
+const (
+	preMergeHookPhase        = "pre-merge"
+	postMergeHookPhase       = "post-merge"
+	previewTeardownHookPhase = "preview-teardown"
+)
+
+var hookHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// hookPayload describes the PR a hook is run for. URL hooks receive it as the
+// JSON body of the request and command hooks as environment variables.
+type hookPayload struct {
+	Phase   string `json:"phase"`
+	Owner   string `json:"owner"`
+	Name    string `json:"name"`
+	Number  int    `json:"number"`
+	HeadSHA string `json:"head_sha"`
+	HeadRef string `json:"head_ref"`
+	BaseRef string `json:"base_ref"`
+}
+
+func (p hookPayload) env() []string {
+	return []string{
+		"MERGE_HOOK_PHASE=" + p.Phase,
+		"PR_REPO_OWNER=" + p.Owner,
+		"PR_REPO_NAME=" + p.Name,
+		"PR_NUMBER=" + strconv.Itoa(p.Number),
+		"PR_HEAD_SHA=" + p.HeadSHA,
+		"PR_HEAD_REF=" + p.HeadRef,
+		"PR_BASE_REF=" + p.BaseRef,
+	}
+}
+
+func newHookPayload(phase string, pr *github.PullRequest) hookPayload {
+	repository := baseRepository(pr)
+	return hookPayload{
+		Phase:   phase,
+		Owner:   repository.Owner,
+		Name:    repository.Name,
+		Number:  *pr.Number,
+		HeadSHA: *pr.Head.SHA,
+		HeadRef: *pr.Head.Ref,
+		BaseRef: *pr.Base.Ref,
+	}
+}
+
+// runPreMergeHooks runs the configured pre-merge hooks in order and stops at
+// the first one that fails.
+func runPreMergeHooks(hooks []string, pr *github.PullRequest, gitRepos git.Repos) error {
+	if len(hooks) == 0 {
+		return nil
+	}
+	payload := newHookPayload(preMergeHookPhase, pr)
+	// Command hooks run on the bot's host, so they're run in a checkout of
+	// the base branch rather than of the PR's code, which may come from
+	// anyone's fork. They find the PR's head in the variables.
+	repository := baseRepository(pr)
+	for _, hook := range hooks {
+		if err := runHook(hook, payload, repository, "origin/"+*pr.Base.Ref, gitRepos); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runPostMergeHooks runs all of the configured post-merge hooks, even if some
+// of them fail, because the PR has already been merged at this point. The
+// first error is returned.
+func runPostMergeHooks(hooks []string, pr *github.PullRequest, gitRepos git.Repos) error {
+	if len(hooks) == 0 {
+		return nil
+	}
+	payload := newHookPayload(postMergeHookPhase, pr)
+	repository := baseRepository(pr)
+	var firstErr error
+	for _, hook := range hooks {
+		if err := runHook(hook, payload, repository, "origin/"+*pr.Base.Ref, gitRepos); err != nil {
+			log.Println(err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+func runHook(hook string, payload hookPayload, repository Repository, ref string,
+	gitRepos git.Repos) error {
+
+	log.Printf("Running %s hook %s for PR %s/%s#%d.\n", payload.Phase, hook, payload.Owner,
+		payload.Name, payload.Number)
+	if isURLHook(hook) {
+		if err := callURLHook(hook, payload); err != nil {
+			return fmt.Errorf("%s hook %s failed: %v", payload.Phase, hook, err)
+		}
+		return nil
+	}
+	gitRepo, err := gitRepos.GetUpdatedRepo(repository.URL, repository.Owner, repository.Name)
+	if err != nil {
+		return fmt.Errorf("failed to update the local repo for %s hook %s: %w", payload.Phase, hook, err)
+	}
+	if err = gitRepo.RunCommand(ref, hook, payload.env()); err != nil {
+		return fmt.Errorf("%s hook %s failed: %w", payload.Phase, hook, err)
+	}
+	return nil
+}
+
+func isURLHook(hook string) bool {
+	return strings.HasPrefix(hook, "http://") || strings.HasPrefix(hook, "https://")
+}
+
+func callURLHook(url string, payload hookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := hookHTTPClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("responded with %s", resp.Status)
+	}
+	return nil
+}
+
+func handlePreMergeHookFailure(conf Config, issue Issue, hookErr error, issues Issues) *ErrorResponse {
+	log.Printf(
+		"Not merging PR %s, because a pre-merge hook failed: %v. Removing the '%s' label and notifying the author.\n",
+		issue.FullName(),
+		hookErr,
+		MergingLabel,
+	)
+	removeLabelErrResp := removeLabel(issue.Repository, issue.Number, MergingLabel, issues)
+	if removeLabelErrResp != nil {
+		log.Printf(
+			"Failed to remove the '%s' label. Still notifying the author of the failed hook. %v\n",
+			MergingLabel,
+			removeLabelErrResp.Error,
+		)
+	}
+	// The hook's output may include secrets, so it's only logged
+	reason := "a pre-merge check failed"
+	var timeout *git.ErrTimeout
+	if errors.As(hookErr, &timeout) {
+		reason = fmt.Sprintf("a pre-merge check didn't finish in %s", timeout.Timeout)
+	}
+	sendNotification(conf, NotificationEvent{
+		Type:    FailureEvent,
+		Issue:   issue,
+		Message: fmt.Sprintf("Not merged, because %s.", reason),
+	})
+	message := fmt.Sprintf("I'm unable to merge this PR, because %s. @%s, can you please ask a maintainer to "+
+		"look up the details in my logs?", reason, issue.User.Login)
+	err := comment(message, issue.Repository, issue.Number, issues)
+	if err != nil {
+		errorMessage := fmt.Sprintf(
+			"Failed to notify the author of PR %s about the failed pre-merge hook",
+			issue.FullName(),
+		)
+		return &ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	} else if removeLabelErrResp != nil {
+		return removeLabelErrResp
+	}
+	return nil
+}
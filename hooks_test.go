@@ -0,0 +1,177 @@
+package main_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/git"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("pre-merge hooks", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+			gitRepos         *mocks.Repos
+			gitRepo          *mocks.Repo
+		)
+
+		headSHA := "1235"
+		pr := &github.PullRequest{
+			Number:    github.Int(issueNumber),
+			Merged:    github.Bool(false),
+			Mergeable: github.Bool(true),
+			Base: &github.PullRequestBranch{
+				SHA:  github.String("1234"),
+				Ref:  github.String("master"),
+				Repo: repository,
+			},
+			Head: &github.PullRequestBranch{
+				SHA:  github.String(headSHA),
+				Ref:  github.String("feature"),
+				Repo: repository,
+			},
+			User: &github.User{Login: github.String(arbitraryIssueAuthor)},
+		}
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!merge", arbitraryIssueAuthor)
+		})
+
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+			gitRepos = *context.GitRepos
+			gitRepo = new(mocks.Repo)
+
+			context.Config.PreMergeHooksBlock = true
+
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+			issues.
+				On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+					[]string{grh.MergingLabel}).
+				Return(emptyResult, emptyResponse, noError)
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+				Return(pr, emptyResponse, noError)
+			repositories.
+				On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+					mock.AnythingOfType("*github.ListOptions")).
+				Return(&github.CombinedStatus{State: github.String("success")}, emptyResponse, noError)
+			mockLabels(issues, issueNumber, grh.MergingLabel)
+			gitRepos.
+				On("GetUpdatedRepo", sshURL, repositoryOwner, repositoryName).
+				Return(gitRepo, noError)
+		})
+		AfterEach(func() {
+			gitRepo.AssertExpectations(GinkgoT())
+		})
+
+		mockFailedHook := func(hook string) {
+			BeforeEach(func() {
+				gitRepo.
+					On("RunCommand", "origin/master", hook, mock.AnythingOfType("[]string")).
+					Return(errArbitrary)
+				issues.
+					On("RemoveLabelForIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+						grh.MergingLabel).
+					Return(emptyResponse, noError)
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(func(comment *github.IssueComment) bool {
+							return commentContaining("because a pre-merge check failed.")(comment) &&
+								!commentContaining(errArbitrary.Error())(comment)
+						})).
+					Return(emptyResult, emptyResponse, noError)
+			})
+		}
+
+		Context("with a command hook failing", func() {
+			BeforeEach(func() {
+				context.Config.PreMergeHooks = []string{"make check"}
+			})
+			mockFailedHook("make check")
+
+			It("runs the hook on the base branch and doesn't merge the PR", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				pullRequests.AssertNotCalled(GinkgoT(), "Merge", anyContext, repositoryOwner, repositoryName,
+					issueNumber, mock.Anything, mock.Anything)
+				gitRepo.AssertNotCalled(GinkgoT(), "RunCommand", headSHA, mock.Anything, mock.Anything)
+			})
+
+			It("tells the author without the hook's output", func() {
+				handle()
+				issues.AssertExpectations(GinkgoT())
+			})
+		})
+
+		Context("with a command hook timing out", func() {
+			BeforeEach(func() {
+				context.Config.PreMergeHooks = []string{"make check"}
+				gitRepo.
+					On("RunCommand", "origin/master", "make check", mock.AnythingOfType("[]string")).
+					Return(fmt.Errorf("failed to run \"make check\": %w",
+						&git.ErrTimeout{Command: "sh", Timeout: 10 * time.Minute}))
+				issues.
+					On("RemoveLabelForIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+						grh.MergingLabel).
+					Return(emptyResponse, noError).
+					Once()
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("because a pre-merge check didn't finish in 10m0s."))).
+					Return(emptyResult, emptyResponse, noError).
+					Once()
+			})
+
+			It("tells the author that the check timed out and doesn't merge the PR", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+				pullRequests.AssertNotCalled(GinkgoT(), "Merge", anyContext, repositoryOwner, repositoryName,
+					issueNumber, mock.Anything, mock.Anything)
+			})
+		})
+
+		Context("with the repository's policy setting the hooks", func() {
+			BeforeEach(func() {
+				context.Config.PreMergeHooks = []string{"make check"}
+				Expect((*context.Store).SetPolicies(grh.PolicySet{Repositories: map[string]grh.Policy{
+					repositoryOwner + "/" + repositoryName: {PreMergeHooks: &[]string{"./bin/check"}},
+				}})).To(Succeed())
+			})
+			mockFailedHook("./bin/check")
+
+			It("runs the repository's hooks instead of the global ones", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				gitRepo.AssertNotCalled(GinkgoT(), "RunCommand", "origin/master", "make check", mock.Anything)
+			})
+		})
+	})
+})
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"regexp"
+
+	"github.com/google/go-github/github"
+)
+
+const githubStatusIssueReferenceContext = "review/issue-reference"
+
+// The values of REQUIRED_ISSUE_REFERENCE that require references of a kind,
+// instead of a custom regular expression
+const (
+	githubIssueReferenceRule = "github"
+	jiraIssueReferenceRule   = "jira"
+)
+
+// githubIssueReferenceRegexp matches references to GitHub issues, e.g.
+// "#123", "owner/name#123" or the issue's URL.
+var githubIssueReferenceRegexp = regexp.MustCompile(
+	`(^|[^\w/])([\w.-]+/[\w.-]+)?#[0-9]+\b|https://github\.com/[\w.-]+/[\w.-]+/issues/[0-9]+`)
+
+// ParseIssueReferenceRule parses the rule the PRs' titles or descriptions
+// must reference a tracking issue by. The rule is "github" for GitHub issues,
+// "jira" for the Jira issue keys matched by jiraIssueKeyPattern or a regular
+// expression the references must match. An empty rule disables the check and
+// results in nil.
+func ParseIssueReferenceRule(rule string, jiraIssueKeyPattern *regexp.Regexp) (*regexp.Regexp, error) {
+	switch rule {
+	case "":
+		return nil, nil
+	case githubIssueReferenceRule:
+		return githubIssueReferenceRegexp, nil
+	case jiraIssueReferenceRule:
+		return jiraIssueKeyPattern, nil
+	}
+	return regexp.Compile(rule)
+}
+
+// checkIssueReference creates a status reporting whether the PR's title or
+// description references a tracking issue. Returns nil, if the check is
+// disabled.
+func checkIssueReference(conf Config, title, body string) *github.RepoStatus {
+	if conf.IssueReferenceRule == nil {
+		return nil
+	} else if conf.IssueReferenceRule.MatchString(title) || conf.IssueReferenceRule.MatchString(body) {
+		return createIssueReferenceStatus("success", "References a tracking issue")
+	}
+	return createIssueReferenceStatus("failure", "Reference a tracking issue in the PR's title or description")
+}
+
+// updateIssueReferenceStatus reports whether the PR references a tracking
+// issue on its head commit. The status is a failure until it does, so
+// requiring the status keeps the bot from merging the PR.
+func updateIssueReferenceStatus(conf Config, pullRequestEvent PullRequestEvent,
+	repositories Repositories) *ErrorResponse {
+
+	status := checkIssueReference(conf, pullRequestEvent.Title, pullRequestEvent.Body)
+	if status == nil {
+		return nil
+	}
+	return setStatusForPREvent(pullRequestEvent, status, repositories)
+}
+
+func createIssueReferenceStatus(state, description string) *github.RepoStatus {
+	return &github.RepoStatus{
+		State:       github.String(state),
+		Description: github.String(description),
+		Context:     github.String(githubStatusIssueReferenceContext),
+	}
+}
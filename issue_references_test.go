@@ -0,0 +1,119 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("issue reference gate", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			repositories     *mocks.Repositories
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			repositories = *context.Repositories
+
+			rule, err := grh.ParseIssueReferenceRule("github", nil)
+			Expect(err).NotTo(HaveOccurred())
+			context.Config.IssueReferenceRule = rule
+		})
+
+		headSHA := "1235"
+		headRepository := grh.Repository{
+			Owner: repositoryOwner,
+			Name:  repositoryName,
+			URL:   sshURL,
+		}
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "pull_request",
+			}
+		})
+
+		editedEvent := func(title, body string) string {
+			return strings.Replace(PullRequestEvent("edited", headSHA, headRepository), `"pull_request": {`,
+				`"pull_request": {
+    "title": "`+title+`",
+    "body": "`+body+`",`, 1)
+		}
+
+		issueReferenceStatus := func(state string) interface{} {
+			return mock.MatchedBy(func(status *github.RepoStatus) bool {
+				return status.GetContext() == "review/issue-reference" && status.GetState() == state
+			})
+		}
+
+		Context("with the description referencing an issue", func() {
+			requestJSON.Is(func() string {
+				return editedEvent("Fix the login form", "Fixes #12")
+			})
+
+			BeforeEach(func() {
+				repositories.
+					On("CreateStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+						issueReferenceStatus("success")).
+					Return(emptyResult, emptyResponse, noError).
+					Once()
+			})
+
+			It("reports a successful status", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				repositories.AssertExpectations(GinkgoT())
+			})
+		})
+
+		Context("without an issue reference", func() {
+			requestJSON.Is(func() string {
+				return editedEvent("Fix the login form", "The button was misaligned.")
+			})
+
+			BeforeEach(func() {
+				repositories.
+					On("CreateStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+						issueReferenceStatus("failure")).
+					Return(emptyResult, emptyResponse, noError).
+					Once()
+			})
+
+			It("reports a failing status", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				repositories.AssertExpectations(GinkgoT())
+			})
+		})
+
+		Context("with setting the status failing", func() {
+			requestJSON.Is(func() string {
+				return editedEvent("Fix the login form", "")
+			})
+
+			BeforeEach(func() {
+				repositories.
+					On("CreateStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.Anything).
+					Return(emptyResult, emptyResponse, errArbitrary)
+			})
+
+			It("fails with a gateway error", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusBadGateway))
+			})
+		})
+	})
+})
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/salemove/github-review-helper/git"
+)
+
+// runJanitor periodically collects garbage until stop is closed.
+func runJanitor(configSource ConfigSource, store Store, gitRepos git.Repos, pullRequests PullRequests,
+	stop <-chan struct{}) {
+
+	conf := configSource.Current()
+	if conf.GarbageCollectionInterval == 0 {
+		log.Println("Garbage collection disabled")
+		return
+	}
+	ticker := time.NewTicker(conf.GarbageCollectionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			conf := configSource.Current()
+			if pausedForGithubIncident("garbage collection") || throttledForRateLimit(conf, "garbage collection") {
+				continue
+			}
+			if err := CollectGarbage(conf, store, gitRepos, pullRequests); err != nil {
+				log.Printf("Garbage collection failed: %v\n", err)
+			}
+		}
+	}
+}
+
+// CollectGarbage deletes the tracked bot-created branches that are no longer
+// needed, removes the local clones that have been idle for too long or don't
+// fit the disk quota and prunes stale remote refs in the rest. A branch is no
+// longer needed once the PR opened from it has been closed or, if no PR was
+// ever opened from it, once it's older than conf.BotBranchMaxAge.
+func CollectGarbage(conf Config, store Store, gitRepos git.Repos, pullRequests PullRequests) error {
+	branches, err := store.AllBotBranches()
+	if err != nil {
+		return fmt.Errorf("failed to list bot branches: %v", err)
+	}
+	var firstErr error
+	for _, branch := range branches {
+		if err := collectBotBranch(conf, branch, store, gitRepos, pullRequests); err != nil {
+			log.Println(err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	if conf.GitCloneMaxIdle > 0 || conf.GitDiskQuota > 0 {
+		removed, err := gitRepos.RemoveIdleRepos(conf.GitCloneMaxIdle)
+		for _, path := range removed {
+			log.Printf("Removed the idle local repo %s\n", path)
+		}
+		if err != nil {
+			log.Println(err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	if err := gitRepos.PruneStaleRefs(); err != nil {
+		log.Println(err)
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func collectBotBranch(conf Config, branch BotBranch, store Store, gitRepos git.Repos,
+	pullRequests PullRequests) error {
+
+	if branch.PullRequest == 0 {
+		if time.Since(branch.CreatedAt) < conf.BotBranchMaxAge {
+			return nil
+		}
+		log.Printf("Bot branch %s in %s has no PR and is older than %s. Deleting it.\n", branch.Name,
+			repositoryKey(branch.Repository), conf.BotBranchMaxAge)
+	} else {
+		repository := branch.Repository
+		pr, _, err := pullRequests.Get(context.TODO(), repository.Owner, repository.Name, branch.PullRequest)
+		if err != nil {
+			return fmt.Errorf("failed to get PR #%d for bot branch %s: %v", branch.PullRequest, branch.Name, err)
+		} else if pr.State == nil || *pr.State != "closed" {
+			return nil
+		}
+		log.Printf("PR %s of bot branch %s has been closed. Deleting the branch.\n", prFullName(pr),
+			branch.Name)
+	}
+
+	gitRepo, err := gitRepos.GetUpdatedRepo(branch.Repository.URL, branch.Repository.Owner, branch.Repository.Name)
+	if err != nil {
+		return fmt.Errorf("failed to get an updated repo for bot branch %s: %v", branch.Name, err)
+	}
+	// The branch may have already been deleted by GitHub's automatic head
+	// branch deletion or by someone else. Otherwise it's kept tracked, so
+	// that deleting it would be tried again next time.
+	if err = gitRepo.DeleteRemoteBranch(branch.Name); git.IsRemoteBranchNotFound(err) {
+		log.Printf("Bot branch %s has already been deleted\n", branch.Name)
+	} else if err != nil {
+		return fmt.Errorf("failed to delete bot branch %s: %v", branch.Name, err)
+	}
+	return store.RemoveBotBranch(branch.Repository, branch.Name)
+}
@@ -0,0 +1,164 @@
+package main_test
+
+import (
+	"time"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/git"
+	"github.com/salemove/github-review-helper/mocks"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CollectGarbage", func() {
+	var (
+		conf         grh.Config
+		store        grh.Store
+		gitRepos     *mocks.Repos
+		gitRepo      *mocks.Repo
+		pullRequests *mocks.PullRequests
+
+		botRepository = grh.Repository{
+			Owner: repositoryOwner,
+			Name:  repositoryName,
+			URL:   sshURL,
+		}
+		branchWithPR = grh.BotBranch{
+			Repository:  botRepository,
+			Name:        "bot/revert/7-master",
+			SourcePR:    issueNumber,
+			PullRequest: 8,
+			CreatedAt:   time.Now(),
+		}
+	)
+
+	BeforeEach(func() {
+		conf = grh.Config{BotBranchMaxAge: time.Hour}
+		store = grh.NewMemoryStore()
+		gitRepos = new(mocks.Repos)
+		gitRepo = new(mocks.Repo)
+		pullRequests = new(mocks.PullRequests)
+
+		gitRepos.On("PruneStaleRefs").Return(noError)
+	})
+
+	AfterEach(func() {
+		gitRepos.AssertExpectations(GinkgoT())
+		gitRepo.AssertExpectations(GinkgoT())
+		pullRequests.AssertExpectations(GinkgoT())
+	})
+
+	Context("with a bot branch whose PR is open", func() {
+		BeforeEach(func() {
+			Expect(store.AddBotBranch(branchWithPR)).To(Succeed())
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, branchWithPR.PullRequest).
+				Return(&github.PullRequest{State: github.String("open")}, emptyResponse, noError)
+		})
+
+		It("keeps the branch", func() {
+			Expect(grh.CollectGarbage(conf, store, gitRepos, pullRequests)).To(Succeed())
+			Expect(store.BotBranches(botRepository)).To(HaveLen(1))
+		})
+	})
+
+	Context("with a bot branch whose PR is closed", func() {
+		BeforeEach(func() {
+			Expect(store.AddBotBranch(branchWithPR)).To(Succeed())
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, branchWithPR.PullRequest).
+				Return(&github.PullRequest{
+					Number: github.Int(branchWithPR.PullRequest),
+					State:  github.String("closed"),
+					Base: &github.PullRequestBranch{
+						Repo: repository,
+					},
+				}, emptyResponse, noError)
+			gitRepos.
+				On("GetUpdatedRepo", sshURL, repositoryOwner, repositoryName).
+				Return(gitRepo, noError)
+			gitRepo.On("DeleteRemoteBranch", branchWithPR.Name).Return(noError)
+		})
+
+		It("deletes the branch and stops tracking it", func() {
+			Expect(grh.CollectGarbage(conf, store, gitRepos, pullRequests)).To(Succeed())
+			Expect(store.BotBranches(botRepository)).To(BeEmpty())
+		})
+	})
+
+	Context("with a bot branch without a PR", func() {
+		branch := grh.BotBranch{
+			Repository: botRepository,
+			Name:       "bot/backport/7-release",
+			SourcePR:   issueNumber,
+		}
+
+		Context("that is recent", func() {
+			BeforeEach(func() {
+				branch.CreatedAt = time.Now()
+				Expect(store.AddBotBranch(branch)).To(Succeed())
+			})
+
+			It("keeps the branch", func() {
+				Expect(grh.CollectGarbage(conf, store, gitRepos, pullRequests)).To(Succeed())
+				Expect(store.BotBranches(botRepository)).To(HaveLen(1))
+			})
+		})
+
+		Context("that is older than the max age", func() {
+			BeforeEach(func() {
+				branch.CreatedAt = time.Now().Add(-2 * time.Hour)
+				Expect(store.AddBotBranch(branch)).To(Succeed())
+				gitRepos.
+					On("GetUpdatedRepo", sshURL, repositoryOwner, repositoryName).
+					Return(gitRepo, noError)
+			})
+
+			Context("and already gone", func() {
+				BeforeEach(func() {
+					gitRepo.
+						On("DeleteRemoteBranch", branch.Name).
+						Return(&git.ErrRemoteBranchNotFound{Ref: branch.Name, Err: errArbitrary})
+				})
+
+				It("stops tracking the branch", func() {
+					Expect(grh.CollectGarbage(conf, store, gitRepos, pullRequests)).To(Succeed())
+					Expect(store.BotBranches(botRepository)).To(BeEmpty())
+				})
+			})
+
+			Context("with deleting it failing", func() {
+				otherBranch := grh.BotBranch{
+					Repository: botRepository,
+					Name:       "bot/backport/7-stable",
+					SourcePR:   issueNumber,
+				}
+
+				BeforeEach(func() {
+					otherBranch.CreatedAt = time.Now().Add(-2 * time.Hour)
+					Expect(store.AddBotBranch(otherBranch)).To(Succeed())
+					gitRepo.On("DeleteRemoteBranch", branch.Name).Return(errArbitrary)
+					gitRepo.On("DeleteRemoteBranch", otherBranch.Name).Return(noError)
+				})
+
+				It("keeps tracking the branch and deletes the others", func() {
+					Expect(grh.CollectGarbage(conf, store, gitRepos, pullRequests)).NotTo(Succeed())
+					Expect(store.BotBranches(botRepository)).To(Equal([]grh.BotBranch{branch}))
+				})
+			})
+		})
+	})
+
+	Context("with GIT_CLONE_MAX_IDLE", func() {
+		BeforeEach(func() {
+			conf.GitCloneMaxIdle = 72 * time.Hour
+			gitRepos.On("RemoveIdleRepos", 72*time.Hour).Return([]string{"/repos/salemove/idle"}, noError)
+		})
+
+		It("removes the idle local repos", func() {
+			Expect(grh.CollectGarbage(conf, store, gitRepos, pullRequests)).To(Succeed())
+		})
+	})
+})
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// defaultJiraIssueKeyPattern matches Jira issue keys, e.g. "PROJ-123"
+const defaultJiraIssueKeyPattern = `\b[A-Z][A-Z0-9_]+-[0-9]+\b`
+
+var jiraHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// failedJiraTransitions counts the Jira issues that couldn't be transitioned
+// after their PRs were merged. Reported by /debug/vars.
+var failedJiraTransitions = expvar.NewInt("failed_jira_transitions")
+
+// ParseJiraIssueKeyPattern compiles the pattern Jira issue keys are found in
+// PR titles and branch names with. An empty pattern falls back to the
+// default, which matches keys like "PROJ-123".
+func ParseJiraIssueKeyPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		pattern = defaultJiraIssueKeyPattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// jiraIssueKeys returns the Jira issue keys referenced by the PR's title and
+// head branch, in the order they're referenced in, without duplicates. If
+// the pattern has a capturing group, the first group is used as the key.
+func jiraIssueKeys(pattern *regexp.Regexp, pr *github.PullRequest) []string {
+	var keys []string
+	seen := map[string]bool{}
+	for _, text := range []string{pr.GetTitle(), pr.Head.GetRef()} {
+		for _, match := range pattern.FindAllStringSubmatch(text, -1) {
+			key := match[0]
+			if len(match) > 1 {
+				key = match[1]
+			}
+			if key != "" && !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+// transitionJiraIssues moves the Jira issues referenced by the merged PR
+// through the configured transition, e.g. to "Done". Every issue is tried,
+// even if some of them fail, and the failures are only counted and logged,
+// because the PR has already been merged.
+func transitionJiraIssues(conf Config, pr *github.PullRequest) {
+	if conf.JiraURL == "" || conf.JiraTransitionID == "" {
+		return
+	}
+	issue := prIssue(pr)
+	for _, key := range jiraIssueKeys(conf.JiraIssueKeyPattern, pr) {
+		if err := transitionJiraIssue(conf, key); err != nil {
+			failedJiraTransitions.Add(1)
+			log.Printf("Failed to transition Jira issue %s of PR %s: %v\n", key, issue.FullName(), err)
+			continue
+		}
+		log.Printf("Transitioned Jira issue %s of PR %s.\n", key, issue.FullName())
+	}
+}
+
+func transitionJiraIssue(conf Config, key string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"transition": map[string]string{"id": conf.JiraTransitionID},
+	})
+	if err != nil {
+		return err
+	}
+	transitionsURL := fmt.Sprintf("%s/rest/api/2/issue/%s/transitions", conf.JiraURL, url.PathEscape(key))
+	req, err := http.NewRequest("POST", transitionsURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(conf.JiraUser, conf.JiraAPIToken)
+	resp, err := jiraHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("Jira responded with %s: %s", resp.Status, bytes.TrimSpace(message))
+	}
+	return nil
+}
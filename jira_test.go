@@ -0,0 +1,161 @@
+package main_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("Jira transitions", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+			gitRepos         *mocks.Repos
+
+			jira            *httptest.Server
+			jiraStatus      int
+			transitionPaths []string
+			transitionIDs   []string
+			username        string
+			password        string
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+			gitRepos = *context.GitRepos
+
+			jiraStatus = http.StatusNoContent
+			transitionPaths, transitionIDs = nil, nil
+			jira = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				transitionPaths = append(transitionPaths, r.URL.Path)
+				username, password, _ = r.BasicAuth()
+				body, _ := ioutil.ReadAll(r.Body)
+				var request struct {
+					Transition struct {
+						ID string `json:"id"`
+					} `json:"transition"`
+				}
+				Expect(json.Unmarshal(body, &request)).To(Succeed())
+				transitionIDs = append(transitionIDs, request.Transition.ID)
+				w.WriteHeader(jiraStatus)
+			}))
+
+			pattern, err := grh.ParseJiraIssueKeyPattern("")
+			Expect(err).NotTo(HaveOccurred())
+			context.Config.JiraURL = jira.URL
+			context.Config.JiraUser = "bot@example.com"
+			context.Config.JiraAPIToken = "token"
+			context.Config.JiraIssueKeyPattern = pattern
+			context.Config.JiraTransitionID = "31"
+		})
+		AfterEach(func() {
+			jira.Close()
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!merge", arbitraryIssueAuthor)
+		})
+
+		headSHA := "1235"
+		pr := &github.PullRequest{
+			Number:    github.Int(issueNumber),
+			Title:     github.String("PROJ-12: Fix the login form"),
+			Merged:    github.Bool(false),
+			Mergeable: github.Bool(true),
+			Base: &github.PullRequestBranch{
+				SHA:  github.String("1234"),
+				Ref:  github.String("master"),
+				Repo: repository,
+			},
+			Head: &github.PullRequestBranch{
+				SHA:  github.String(headSHA),
+				Ref:  github.String("OPS-7-PROJ-12-login"),
+				Repo: repository,
+			},
+			User: &github.User{
+				Login: github.String(arbitraryIssueAuthor),
+			},
+		}
+
+		BeforeEach(func() {
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+			issues.
+				On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{grh.MergingLabel}).
+				Return(emptyResult, emptyResponse, noError)
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+				Return(pr, emptyResponse, noError)
+			repositories.
+				On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.AnythingOfType("*github.ListOptions")).
+				Return(&github.CombinedStatus{
+					State: github.String("success"),
+				}, emptyResponse, noError)
+			mockLabels(issues, issueNumber, grh.MergingLabel)
+			pullRequests.
+				On("Merge", anyContext, repositoryOwner, repositoryName, issueNumber, "", noSquashOpts).
+				Return(&github.PullRequestMergeResult{
+					Merged: github.Bool(true),
+					SHA:    github.String("abc123"),
+				}, emptyResponse, noError)
+			issues.
+				On("RemoveLabelForIssue", anyContext, repositoryOwner, repositoryName, issueNumber, grh.MergingLabel).
+				Return(emptyResponse, noError)
+			gitRepo := new(mocks.Repo)
+			gitRepos.
+				On("GetUpdatedRepo", sshURL, repositoryOwner, repositoryName).
+				Return(gitRepo, noError)
+			gitRepo.On("DeleteRemoteBranch", "OPS-7-PROJ-12-login").Return(noError)
+		})
+
+		It("transitions every Jira issue the PR references once", func() {
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+
+			Expect(transitionPaths).To(Equal([]string{
+				"/rest/api/2/issue/PROJ-12/transitions",
+				"/rest/api/2/issue/OPS-7/transitions",
+			}))
+			Expect(transitionIDs).To(Equal([]string{"31", "31"}))
+			Expect(username).To(Equal("bot@example.com"))
+			Expect(password).To(Equal("token"))
+		})
+
+		Context("with Jira failing", func() {
+			BeforeEach(func() {
+				jiraStatus = http.StatusBadRequest
+			})
+
+			It("still merges the PR", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(transitionPaths).To(HaveLen(2))
+				pullRequests.AssertExpectations(GinkgoT())
+			})
+		})
+	})
+})
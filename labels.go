@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/evaluator"
+)
+
+// checkLabels blocks PRs labeled with any of the configured blocking labels,
+// e.g. "do not merge", and the PRs missing any of the required labels. A
+// required label can be a group of alternatives, e.g. "feature|bug", of which
+// any satisfies the requirement. Labels are compared case-insensitively, like
+// GitHub does.
+func checkLabels(conf Config, issue Issue, issues Issues) (evaluator.Result, *ErrorResponse) {
+	if len(conf.BlockingLabels) == 0 && len(conf.RequiredLabels) == 0 {
+		return passed(), nil
+	}
+	labels, errResp := getLabels(issue, issues)
+	if errResp != nil {
+		return evaluator.Result{}, errResp
+	}
+	var blocking []string
+	for _, label := range labels {
+		if containsLabelFold(conf.BlockingLabels, label) {
+			blocking = append(blocking, label)
+		}
+	}
+	if len(blocking) > 0 {
+		return failed(fmt.Sprintf("it's labeled '%s'", strings.Join(blocking, "', '")),
+			fmt.Sprintf("blocking labels: %s", strings.Join(conf.BlockingLabels, ", "))), nil
+	}
+	for _, required := range conf.RequiredLabels {
+		alternatives := strings.Split(required, "|")
+		if !containsAnyLabelFold(labels, alternatives) {
+			return failed(fmt.Sprintf("it's missing %s label", describeAlternatives(alternatives)),
+				fmt.Sprintf("required labels: %s", strings.Join(conf.RequiredLabels, ", "))), nil
+		}
+	}
+	return passed(), nil
+}
+
+// describeAlternatives lists the labels for a sentence, e.g. "a 'feature' or
+// 'bug'".
+func describeAlternatives(alternatives []string) string {
+	quoted := make([]string, len(alternatives))
+	for i, alternative := range alternatives {
+		quoted[i] = "'" + alternative + "'"
+	}
+	if len(quoted) == 1 {
+		return "a " + quoted[0]
+	}
+	return "a " + strings.Join(quoted[:len(quoted)-1], ", ") + " or " + quoted[len(quoted)-1]
+}
+
+func containsAnyLabelFold(labels []string, alternatives []string) bool {
+	for _, alternative := range alternatives {
+		if containsLabelFold(labels, alternative) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsLabelFold(labels []string, label string) bool {
+	for _, l := range labels {
+		if strings.EqualFold(l, label) {
+			return true
+		}
+	}
+	return false
+}
+
+// reportRefusal comments why the bot refuses to merge the PR, if the PR is
+// blocked by its labels or by missing ones, or the credentials it seems to
+// add. Every reason is only commented once per PR, so that status updates
+// wouldn't repeat it. Returns whether the refusal was reported.
+func reportRefusal(conf Config, blocker evaluator.Node, pr *github.PullRequest, store Store, issues Issues) (bool,
+	*ErrorResponse) {
+
+	if blocker.Rule == secretsGate {
+		return reportSecrets(blocker, pr, store, issues)
+	} else if blocker.Rule != labelsRule {
+		return false, nil
+	}
+	issue := prIssue(pr)
+	isNew, err := store.RecordRefusal(issue, blocker.Reason)
+	if err != nil {
+		message := fmt.Sprintf("Failed to record the refusal to merge PR %s", issue.FullName())
+		return false, &ErrorResponse{err, http.StatusInternalServerError, message}
+	} else if !isNew {
+		return true, nil
+	}
+	message := fmt.Sprintf("I'm not merging this PR, because %s.", blocker.Reason)
+	if err = stickyComment(conf, message, issue, store, issues); err != nil {
+		errorMessage := fmt.Sprintf("Failed to report why PR %s is not being merged", issue.FullName())
+		return false, &ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	return true, nil
+}
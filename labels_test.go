@@ -0,0 +1,169 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("blocking and required labels", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+
+			context.Config.BlockingLabels = []string{"do not merge", "needs QA"}
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!merge", arbitraryIssueAuthor)
+		})
+
+		headSHA := "1235"
+		pr := &github.PullRequest{
+			Number:    github.Int(issueNumber),
+			Merged:    github.Bool(false),
+			Mergeable: github.Bool(true),
+			Base: &github.PullRequestBranch{
+				SHA:  github.String("1234"),
+				Ref:  github.String("master"),
+				Repo: repository,
+			},
+			Head: &github.PullRequestBranch{
+				SHA:  github.String(headSHA),
+				Ref:  github.String("feature"),
+				Repo: repository,
+			},
+			User: &github.User{
+				Login: github.String(arbitraryIssueAuthor),
+			},
+		}
+
+		BeforeEach(func() {
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+			issues.
+				On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{grh.MergingLabel}).
+				Return(emptyResult, emptyResponse, noError)
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+				Return(pr, emptyResponse, noError)
+			repositories.
+				On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.AnythingOfType("*github.ListOptions")).
+				Return(&github.CombinedStatus{
+					State: github.String("success"),
+				}, emptyResponse, noError)
+		})
+
+		Context("with a blocking label", func() {
+			BeforeEach(func() {
+				mockLabels(issues, issueNumber, grh.MergingLabel, "Do Not Merge")
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("I'm not merging this PR, because it's labeled 'Do Not Merge'."))).
+					Return(emptyResult, emptyResponse, noError).
+					Once()
+			})
+
+			It("refuses to merge the PR and explains why only once", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(responseRecorder.Body.String()).To(ContainSubstring("Not merging"))
+
+				*context.ResponseRecorder = httptest.NewRecorder()
+				handle()
+				Expect((*context.ResponseRecorder).Code).To(Equal(http.StatusOK))
+				issues.AssertNumberOfCalls(GinkgoT(), "CreateComment", 1)
+			})
+		})
+
+		Context("with a blocking label and a sticky status comment", func() {
+			BeforeEach(func() {
+				context.Config.StickyComments = true
+				err := (*context.Store).SetStickyComment(grh.StickyComment{
+					Issue:  grh.Issue{Number: issueNumber, Repository: grh.Repository{Owner: repositoryOwner, Name: repositoryName}},
+					ID:     42,
+					NodeID: "status-comment",
+				})
+				Expect(err).NotTo(HaveOccurred())
+				mockLabels(issues, issueNumber, grh.MergingLabel, "Do Not Merge")
+				issues.
+					On("EditComment", anyContext, repositoryOwner, repositoryName, int64(42),
+						mock.MatchedBy(commentContaining("because it's labeled 'Do Not Merge'."))).
+					Return(emptyResult, emptyResponse, noError)
+			})
+
+			It("updates the status comment instead of posting a new one", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertNumberOfCalls(GinkgoT(), "EditComment", 1)
+				issues.AssertNotCalled(GinkgoT(), "CreateComment", anyContext, repositoryOwner, repositoryName,
+					issueNumber, mock.Anything)
+			})
+		})
+
+		Context("without blocking labels", func() {
+			BeforeEach(func() {
+				mockLabels(issues, issueNumber, grh.MergingLabel, "bug")
+			})
+
+			ItMergesPR(context, pr)
+		})
+
+		Context("with labels required", func() {
+			BeforeEach(func() {
+				context.Config.RequiredLabels = []string{"feature|bug", "approved-by-security"}
+			})
+
+			Context("with a required label missing", func() {
+				BeforeEach(func() {
+					mockLabels(issues, issueNumber, grh.MergingLabel, "approved-by-security")
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("because it's missing a 'feature' or 'bug' label."))).
+						Return(emptyResult, emptyResponse, noError).
+						Once()
+				})
+
+				It("refuses to merge the PR", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					Expect(responseRecorder.Body.String()).To(ContainSubstring("Not merging"))
+				})
+			})
+
+			Context("with every required label present", func() {
+				BeforeEach(func() {
+					mockLabels(issues, issueNumber, grh.MergingLabel, "Bug", "approved-by-security")
+				})
+
+				ItMergesPR(context, pr)
+			})
+		})
+	})
+})
@@ -1,19 +1,20 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"os"
 	"sync"
 	"time"
 
-	"gopkg.in/tylerb/graceful.v1"
-
 	"github.com/google/go-github/github"
 	"github.com/gregjones/httpcache"
+	"github.com/salemove/github-review-helper/fixtures"
 	"github.com/salemove/github-review-helper/git"
-	"golang.org/x/oauth2"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -21,65 +22,321 @@ const (
 	githubStatusPeerReviewContext = "review/peer"
 )
 
-type retryGithubOperation func(func() asyncResponse) MaybeSyncResponse
+type retryGithubOperation func(Repository, func() asyncResponse) MaybeSyncResponse
 
 func main() {
-	conf := NewConfig()
-	githubClient := initGithubClient(conf.AccessToken)
+	if len(os.Args) > 1 && os.Args[1] == "run" {
+		os.Exit(runCommandLine(NewConfigReloader().Current(), os.Args[2:]))
+	}
+	if err := ParseConfigFlags(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	configReloader := NewConfigReloader()
+	conf := configReloader.Current()
+	stopTracing, err := initTracing(conf)
+	if err != nil {
+		panic(err)
+	}
+	defer stopTracing()
+	errorReporter, err := NewErrorReporter(conf)
+	if err != nil {
+		panic(err)
+	}
+	defer errorReporter.Flush(5 * time.Second)
+	auditLog, err := NewAuditLog(conf)
+	if err != nil {
+		panic(err)
+	}
+	eventStream := NewEventStream()
+	auditLog = StreamAuditLog(auditLog, eventStream)
+	httpClient, err := initGithubHTTPClient(conf)
+	if err != nil {
+		panic(err)
+	}
+	owner := tokenOwner(httpClient)
+	configReloader.setBotLogin(owner.GetLogin())
+	conf = configReloader.Current()
+	driver := NewGithubDriver(httpClient)
+	graphQL := driver.GraphQL()
 	reposDir, err := ioutil.TempDir("", "github-review-helper")
 	if err != nil {
 		panic(err)
 	}
 	defer os.RemoveAll(reposDir)
 
-	gitRepos := git.NewRepos(reposDir)
+	// Limiting the resources of the clients every webhook and background job
+	// shares, so that the limits would be global
+	gitRepos, pullRequests := limitResources(conf,
+		newGitRepos(conf, reposDir, gitIdentity(conf, owner)), driver.PullRequests())
+	store, err := NewStore(conf)
+	if err != nil {
+		panic(err)
+	}
+	if err = LoadScheduledMerges(conf, store); err != nil {
+		log.Printf("Failed to load the scheduled merges: %v\n", err)
+	}
+	if conf.LockRedisURL != nil {
+		prLocks = NewRedisPRLocker(conf.LockRedisURL, conf.LockTTL)
+	}
+	scheduler := NewScheduler(conf.AsyncConcurrency, conf.RepositoryWeights)
 	var asyncOperationWg sync.WaitGroup
 
 	mux := http.NewServeMux()
-	mux.Handle("/", CreateHandler(
-		conf,
+	handler := CreateHandler(
+		configReloader,
 		gitRepos,
+		store,
+		scheduler,
+		errorReporter,
+		auditLog,
 		&asyncOperationWg,
-		githubClient.PullRequests,
-		githubClient.Repositories,
-		githubClient.Issues,
-		githubClient.Search,
-	))
+		pullRequests,
+		driver.Repositories(),
+		driver.Issues(),
+		driver.Search(),
+		graphQL,
+	)
+	mux.Handle("/", handler)
+	// The other providers' state is kept apart from GitHub's, because the
+	// background jobs below only act on GitHub's repositories
+	if conf.GitlabURL != "" {
+		gitlabStore, err := NewProviderStore(conf, "gitlab")
+		if err != nil {
+			panic(err)
+		}
+		mux.Handle("/gitlab", createGitlabHandler(conf, configReloader, reposDir, gitlabStore, scheduler,
+			errorReporter, auditLog, &asyncOperationWg))
+	}
+	if conf.GiteaURL != "" {
+		giteaStore, err := NewProviderStore(conf, "gitea")
+		if err != nil {
+			panic(err)
+		}
+		giteaHandler, err := createGiteaHandler(conf, configReloader, reposDir, giteaStore, scheduler,
+			errorReporter, auditLog, &asyncOperationWg)
+		if err != nil {
+			panic(err)
+		}
+		mux.Handle("/gitea", giteaHandler)
+	}
+
+	// The webhook handler wraps the clients for every webhook itself
+	retriedPullRequests, retriedIssues := retryGithubMutations(conf, pullRequests, driver.Issues())
+	retriedIssues = templateComments(configReloader, retriedIssues)
+	// The background jobs act on nobody's behalf, so their audit entries have
+	// no actor
+	backgroundGitRepos, backgroundPullRequests, backgroundRepositories, backgroundIssues := auditClients(
+		auditor{auditLog, WebhookContext{}}, gitRepos, retriedPullRequests, driver.Repositories(),
+		retriedIssues)
+	stopBackgroundJobs := make(chan struct{})
+	go runJanitor(configReloader, store, backgroundGitRepos, backgroundPullRequests, stopBackgroundJobs)
+	go runReviewLoadReport(configReloader, store, backgroundIssues, stopBackgroundJobs)
+	mergeDeferred := func(issue Issue) Response {
+		jobContext := WebhookContext{
+			Repository:  issue.Repository,
+			PullRequest: issue.Number,
+		}
+		reporter := webhookReporter{errorReporter, ErrorReport{WebhookContext: jobContext}}
+		gitRepos, pullRequests, repositories, issues := auditClients(auditor{auditLog, jobContext}, gitRepos,
+			retriedPullRequests, driver.Repositories(), retriedIssues)
+		return reporter.run(func() Response {
+			conf, errResp := repositoryConfig(configReloader.Current(), issue.Repository, store)
+			if errResp != nil {
+				return errResp
+			}
+			return mergeIfLabeled(conf, issue, store, issues, pullRequests, repositories,
+				graphQLForTenant(conf, issue.Repository.Owner, graphQL), gitRepos)
+		})
+	}
+	go runDeferredMerges(configReloader, store, mergeDeferred, stopBackgroundJobs)
+	startScheduled := func(scheduled ScheduledMerge) Response {
+		issue := scheduled.Issue
+		jobContext := WebhookContext{
+			Repository:  issue.Repository,
+			PullRequest: issue.Number,
+		}
+		reporter := webhookReporter{errorReporter, ErrorReport{WebhookContext: jobContext}}
+		gitRepos, pullRequests, repositories, issues := auditClients(auditor{auditLog, jobContext}, gitRepos,
+			retriedPullRequests, driver.Repositories(), retriedIssues)
+		return reporter.run(func() Response {
+			conf, errResp := repositoryConfig(configReloader.Current(), issue.Repository, store)
+			if errResp != nil {
+				return errResp
+			}
+			return startScheduledMerge(conf, scheduled, store, issues, pullRequests, repositories,
+				graphQLForTenant(conf, issue.Repository.Owner, graphQL), gitRepos)
+		})
+	}
+	go runScheduledMerges(configReloader, store, startScheduled, stopBackgroundJobs)
+	go runForceWaits(store, mergeDeferred, backgroundIssues, stopBackgroundJobs)
+	go runQueueReevaluations(configReloader, backgroundIssues, backgroundPullRequests, backgroundRepositories,
+		mergeDeferred, stopBackgroundJobs)
+	go runNotificationDigests(configReloader, store, backgroundIssues, stopBackgroundJobs)
+	go runReminders(store, backgroundIssues, stopBackgroundJobs)
+	go runStalePRReminders(configReloader, store, driver.Search(), backgroundIssues, stopBackgroundJobs)
+	go runStaleCIPolicy(configReloader, store, driver.Search(), backgroundIssues, backgroundPullRequests,
+		backgroundRepositories, stopBackgroundJobs)
+	go runMergingLabelExpiry(configReloader, store, backgroundIssues, backgroundPullRequests,
+		backgroundRepositories, graphQL, stopBackgroundJobs)
+	go runGithubStatusChecks(configReloader, stopBackgroundJobs)
+	go runDeliveryRetries(configReloader, store, handler, stopBackgroundJobs)
+	go runEventPublisher(configReloader, store, stopBackgroundJobs)
+	go reloadConfigOnSignal(configReloader, stopBackgroundJobs)
 
-	graceful.Run(fmt.Sprintf(":%d", conf.Port), 10*time.Second, mux)
+	mux.Handle("/version", CreateVersionHandler(conf))
+	if conf.AdminToken != "" {
+		mux.Handle("/admin/", CreateAdminHandler(conf.AdminToken, conf, store, auditLog))
+		mux.Handle("/admin/reload-config", CreateConfigReloadHandler(conf.AdminToken, configReloader, auditLog))
+		mux.Handle("/dashboard", CreateDashboardHandler(conf.AdminToken, store, auditLog))
+		mux.Handle("/events", CreateEventStreamHandler(conf.AdminToken, eventStream))
+	}
+
+	debugHandler := CreateDebugHandler(conf.DebugToken, gitRepos, store, scheduler)
+	if conf.DebugToken != "" {
+		mux.Handle("/debug/", debugHandler)
+	}
+	if conf.DebugPort != 0 {
+		go func() {
+			log.Printf("Serving the debug endpoints on port %d\n", conf.DebugPort)
+			log.Println(http.ListenAndServe(fmt.Sprintf(":%d", conf.DebugPort), debugHandler))
+		}()
+	}
+
+	serve(conf, mux)
+	close(stopBackgroundJobs)
 	asyncOperationWg.Wait()
 }
 
-func CreateHandler(conf Config, gitRepos git.Repos, asyncOperationWg *sync.WaitGroup,
-	pullRequests PullRequests, repositories Repositories, issues Issues, search Search) Handler {
+// CreateHandler creates the webhook handler. Every webhook is handled with
+// the configuration the source provides at the time.
+func CreateHandler(configSource ConfigSource, gitRepos git.Repos, store Store, scheduler *Scheduler,
+	errorReporter ErrorReporter, auditLog AuditLog, asyncOperationWg *sync.WaitGroup, pullRequests PullRequests,
+	repositories Repositories, issues Issues, search Search, graphQL GraphQL) Handler {
+
+	startupConf := configSource.Current()
+	limiter := newCommandRateLimiter(startupConf.CommandRateLimit, startupConf.CommandRateLimitPeriod)
+	handle := func(conf Config, r *http.Request, body []byte, repository Repository, retry retryGithubOperation,
+		audit auditor, gitRepos git.Repos, pullRequests PullRequests, repositories Repositories, issues Issues,
+		search Search, graphQL GraphQL) Response {
 
-	retry := func(operation func() asyncResponse) MaybeSyncResponse {
-		return delayWithRetries(conf.GithubAPITryDeltas, operation, asyncOperationWg)
+		if !isRepositoryAllowed(repository, conf.AllowedRepositories) {
+			// Acknowledging the webhook, so that GitHub wouldn't keep
+			// redelivering it
+			return SuccessResponse{fmt.Sprintf("Repository %s is not allowed. Ignoring.",
+				repositoryKey(repository))}
+		}
+		// Shadowing the configuration, so that the repository's policy would
+		// apply to everything the webhook triggers
+		conf, errResp := repositoryConfig(conf, repository, store)
+		if errResp != nil {
+			return errResp
+		}
+		deliveryID := r.Header.Get("X-Github-Delivery")
+		if response := claimDelivery(conf, deliveryID, store); response != nil {
+			return response
+		}
+		response := handleEvent(conf, r, body, retry, audit, gitRepos, store, limiter, pullRequests, repositories,
+			issues, search, graphQL)
+		releaseFailedDelivery(conf, deliveryID, response, store)
+		return response
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) Response {
-		body, err := ioutil.ReadAll(r.Body)
-		if err != nil {
-			return ErrorResponse{err, http.StatusInternalServerError, "Failed to read the request's body"}
+		conf := configSource.Current()
+		if errResp := checkWebhookRequest(r); errResp != nil {
+			return errResp
+		} else if response := checkBackpressure(conf); response != nil {
+			return response
 		}
-		if errResp := checkAuthentication(body, r, conf.Secret); errResp != nil {
+		body, errResp := readWebhookBody(conf, r)
+		if errResp != nil {
 			return errResp
 		}
-		eventType := r.Header.Get("X-Github-Event")
-		switch eventType {
-		case "issue_comment":
-			return handleIssueComment(body, retry, gitRepos, pullRequests, repositories, issues)
-		case "pull_request":
-			return handlePullRequestEvent(body, retry, pullRequests, repositories)
-		case "status":
-			return handleStatusEvent(body, retry, gitRepos, search, issues, pullRequests)
+		// Nothing else is parsed from the body before it's authenticated, so
+		// that unsigned requests couldn't reach the audit log or the error
+		// reports
+		repository := parseWebhookRepository(body)
+		conf, errResp = authenticateWebhook(conf, r, body, repository)
+		if errResp != nil {
+			return errResp
+		}
+		webhookContext := parseWebhookContext(conf, r, body)
+		reporter := webhookReporter{errorReporter, ErrorReport{WebhookContext: webhookContext}}
+		retry := func(repository Repository, operation func() asyncResponse) MaybeSyncResponse {
+			return delayWithRetries(conf.GithubAPITryDeltas, repository, operation, scheduler, reporter,
+				asyncOperationWg)
+		}
+
+		// Shadowing the clients, so that they'd only be wrapped for this webhook
+		gitRepos, pullRequests, repositories, issues, search, graphQL := gitRepos, pullRequests, repositories,
+			issues, search, graphQL
+		pullRequests, issues = retryGithubMutations(conf, pullRequests, issues)
+		issues = templateComments(conf, issues)
+		graphQL = graphQLForTenant(conf, repository.Owner, graphQL)
+		var span trace.Span
+		if conf.OTLPEndpoint != "" {
+			var ctx context.Context
+			ctx, span = traceWebhook(r)
+			gitRepos, pullRequests, repositories, issues, search, graphQL = traceClients(ctx, gitRepos,
+				pullRequests, repositories, issues, search, graphQL)
+		}
+		audit := auditor{auditLog, webhookContext}
+		gitRepos, pullRequests, repositories, issues = auditClients(audit, gitRepos, pullRequests, repositories,
+			issues)
+
+		response := reporter.run(func() Response {
+			return handle(conf, r, body, repository, retry, audit, gitRepos, pullRequests, repositories, issues,
+				search, graphQL)
+		})
+		audit.recordCommand(response)
+		queueDeliveryRetry(conf, r, body, response, store)
+		if span != nil {
+			endWebhookSpan(span, response)
 		}
-		return SuccessResponse{"Not an event I understand. Ignoring."}
+		return response
+	}
+}
+
+func handleEvent(conf Config, r *http.Request, body []byte, retry retryGithubOperation, audit auditor,
+	gitRepos git.Repos, store Store, limiter *commandRateLimiter, pullRequests PullRequests, repositories Repositories, issues Issues,
+	search Search, graphQL GraphQL) Response {
+
+	switch r.Header.Get("X-Github-Event") {
+	case "issue_comment":
+		return handleIssueComment(conf, body, retry, gitRepos, store, limiter, pullRequests, repositories, issues,
+			search, graphQL)
+	case "pull_request":
+		return handlePullRequestEvent(conf, body, retry, audit, gitRepos, store, pullRequests, repositories, issues,
+			graphQL)
+	case "pull_request_review":
+		return handlePullRequestReviewEvent(conf, body, retry, gitRepos, store, limiter, pullRequests,
+			repositories, issues, search, graphQL)
+	case "pull_request_review_comment":
+		return handleReviewCommentEvent(conf, body, retry, gitRepos, store, limiter, pullRequests, repositories,
+			issues, search, graphQL)
+	case "status":
+		return handleStatusEvent(conf, body, retry, gitRepos, store, search, issues, pullRequests, repositories,
+			graphQL)
+	case "commit_comment":
+		return handleCommitComment(conf, body, gitRepos, repositories)
+	case "check_suite":
+		return handleCheckSuiteEvent(conf, body, gitRepos, store, issues, pullRequests, repositories, graphQL)
+	case "deployment_status":
+		return handleDeploymentStatusEvent(body, store, issues)
+	case "push":
+		return handlePushEvent(conf, body, retry, store, issues, pullRequests, graphQL)
+	case "branch_protection_rule":
+		return handleBranchProtectionRuleEvent(conf, body, graphQL)
 	}
+	// checkWebhookRequest has refused the events that aren't in webhookEvents,
+	// so this is the ping GitHub sends when the webhook is created
+	return SuccessResponse{"Pong"}
 }
 
-func handleIssueComment(body []byte, retry retryGithubOperation, gitRepos git.Repos,
-	pullRequests PullRequests, repositories Repositories, issues Issues) Response {
+func handleIssueComment(conf Config, body []byte, retry retryGithubOperation, gitRepos git.Repos, store Store,
+	limiter *commandRateLimiter, pullRequests PullRequests, repositories Repositories, issues Issues,
+	search Search, graphQL GraphQL) Response {
 
 	issueComment, err := parseIssueComment(body)
 	if err != nil {
@@ -87,23 +344,166 @@ func handleIssueComment(body []byte, retry retryGithubOperation, gitRepos git.Re
 	}
 	if !issueComment.IsPullRequest {
 		return SuccessResponse{"Not a PR. Ignoring."}
+	} else if issueComment.Action == "deleted" {
+		return SuccessResponse{"Comment deleted. Ignoring."}
+	}
+	return handleCommandComment(conf, issueComment, retry, gitRepos, store, limiter, pullRequests, repositories,
+		issues, search, graphQL)
+}
+
+func handleReviewCommentEvent(conf Config, body []byte, retry retryGithubOperation, gitRepos git.Repos,
+	store Store, limiter *commandRateLimiter, pullRequests PullRequests, repositories Repositories, issues Issues,
+	search Search, graphQL GraphQL) Response {
+
+	reviewCommentEvent, err := parsePullRequestReviewCommentEvent(body)
+	if err != nil {
+		return ErrorResponse{err, http.StatusInternalServerError, "Failed to parse the request's body"}
+	} else if reviewCommentEvent.Action == "deleted" {
+		return SuccessResponse{"Review comment deleted. Ignoring."}
+	}
+	return handleCommandComment(conf, reviewCommentEvent.Comment, retry, gitRepos, store, limiter, pullRequests,
+		repositories, issues, search, graphQL)
+}
+
+// handleCommandComment handles the command in a comment on a PR, whether
+// it's in the PR's conversation, in a review's summary or on the PR's diff.
+// A comment may issue several commands, one per line.
+func handleCommandComment(conf Config, issueComment IssueComment, retry retryGithubOperation, gitRepos git.Repos,
+	store Store, limiter *commandRateLimiter, pullRequests PullRequests, repositories Repositories, issues Issues,
+	search Search, graphQL GraphQL) Response {
+
+	if isBotLogin(conf, issueComment.Commenter.Login) {
+		// The bot's own comments may quote commands, e.g. in message
+		// templates, which would otherwise trigger the bot again
+		return SuccessResponse{"Comment by a bot. Ignoring."}
+	}
+	if commands, isBatch := parseCommandBatch(conf, issueComment.Comment); isBatch {
+		return handleCommandBatch(conf, issueComment, commands, retry, gitRepos, store, limiter, pullRequests,
+			repositories, issues, search, graphQL)
+	}
+	command, isCommand := normalizeCommand(conf, issueComment.Comment)
+	if !isCommand {
+		return SuccessResponse{"Not a command I understand. Ignoring."}
 	}
+	// The handlers parse the commands in the "!merge" form, whichever prefix
+	// or alias was used
+	issueComment.Comment = command
 	commentCategory := parseComment(issueComment.Comment)
 	if commentCategory == regularComment {
 		return SuccessResponse{"Not a command I understand. Ignoring."}
 	}
-	if successResp, errResp := checkUserAuthorization(issueComment, issues, repositories); errResp != nil {
-		return errResp
+	// Edited comments are handled as well, e.g. to run a command whose typo
+	// was fixed, but a comment's command is only run once
+	if issuedBeforeEdit(conf, issueComment) {
+		return SuccessResponse{"The command was issued before the comment was edited. Ignoring."}
+	}
+	commandID := commentCommandID(issueComment)
+	if response := claimDelivery(conf, commandID, store); response != nil {
+		return response
+	}
+	// Checking the limit before the authorization, so that outsiders
+	// couldn't make the bot spam the API either
+	if response := checkCommandRateLimit(conf, issueComment, limiter, issues); response != nil {
+		return response
+	}
+	if successResp, errResp := checkUserAuthorization(conf, issueComment, commentCategory, store, issues,
+		pullRequests, repositories, graphQL); errResp != nil {
+		return refuseUnsupportedCommand(issueComment, commentCategory, errResp, issues)
 	} else if successResp != nil {
 		return successResp
 	}
+	if conf.CommandReactions != nil {
+		reactToCommand(conf, issueComment, conf.CommandReactions.Received, graphQL)
+	}
+	publishEvent(conf, BusEvent{
+		Type:        CommandReceivedEvent,
+		Repository:  repositoryKey(issueComment.Repository),
+		PullRequest: issueComment.IssueNumber,
+		Actor:       issueComment.Commenter.Login,
+		Command:     commandNames[commentCategory],
+	}, store)
+	response := refuseUnsupportedCommand(issueComment, commentCategory, handleCommand(conf, issueComment,
+		commentCategory, retry, gitRepos, store, pullRequests, repositories, issues, search, graphQL), issues)
+	reactToCommandOutcome(conf, issueComment, response, graphQL)
+	recordCommandUse(issueComment, commentCategory, response, store)
+	releaseFailedDelivery(conf, commandID, response, store)
+	return response
+}
+
+func handleCommand(conf Config, issueComment IssueComment, commentCategory commentType,
+	retry retryGithubOperation, gitRepos git.Repos, store Store, pullRequests PullRequests,
+	repositories Repositories, issues Issues, search Search, graphQL GraphQL) Response {
+
 	switch commentCategory {
 	case squashCommand:
-		return handleSquashCommand(issueComment, gitRepos, pullRequests, repositories)
+		return handleSquashCommand(conf, issueComment, issueComment.Comment, store, gitRepos, pullRequests,
+			repositories, issues)
 	case mergeCommand:
-		return handleMergeCommand(issueComment, issues, pullRequests, repositories, gitRepos)
+		return handleMergeCommand(conf, issueComment, store, search, issues, pullRequests, repositories, graphQL,
+			gitRepos)
 	case checkCommand:
-		return checkForFixupCommitsOnIssueComment(issueComment, pullRequests, repositories, retry)
+		return checkForFixupCommitsOnIssueComment(conf, issueComment, store, pullRequests, repositories, retry)
+	case holdCommand:
+		return handleHoldCommand(issueComment, issues)
+	case unholdCommand:
+		return handleUnholdCommand(conf, issueComment, store, issues, pullRequests, repositories, graphQL, gitRepos)
+	case blockCommand:
+		return handleBlockCommand(issueComment, store, issues)
+	case unblockCommand:
+		return handleUnblockCommand(conf, issueComment, store, issues, pullRequests, repositories, graphQL,
+			gitRepos)
+	case dependsOnCommand:
+		return handleDependsOnCommand(conf, issueComment, store, issues, pullRequests, repositories, graphQL,
+			gitRepos)
+	case priorityCommand:
+		return handlePriorityCommand(conf, issueComment, store, issues, pullRequests, repositories, graphQL,
+			gitRepos)
+	case whoseTurnCommand:
+		return handleWhoseTurnCommand(conf, issueComment, store, issues)
+	case statusCommand:
+		return handleStatusCommand(conf, issueComment, false, store, issues, pullRequests, repositories, graphQL)
+	case simulateMergeCommand:
+		return handleStatusCommand(conf, issueComment, true, store, issues, pullRequests, repositories, graphQL)
+	case summaryCommand:
+		return handleSummaryCommand(conf, issueComment, store, issues, pullRequests, repositories, graphQL)
+	case assignCommand:
+		return handleAssignCommand(issueComment, issues, repositories)
+	case unassignCommand:
+		return handleUnassignCommand(issueComment, issues)
+	case titleCommand:
+		return handleTitleCommand(issueComment, issues)
+	case labelCommand:
+		return handleLabelCommand(conf, issueComment, issues, graphQL)
+	case remindCommand:
+		return handleRemindCommand(conf, issueComment, store, issues)
+	case confirmCommand:
+		return handleConfirmCommand(conf, issueComment, store, issues, pullRequests, repositories, graphQL, gitRepos)
+	case cherryPickCommand:
+		return handleCherryPickCommand(issueComment, gitRepos, pullRequests, issues)
+	case revertCommand:
+		return handleRevertCommand(conf, issueComment, store, gitRepos, pullRequests, issues)
+	case selfTestCommand:
+		return handleSelfTestCommand(issueComment, store, gitRepos, repositories, issues)
+	case rerunChecksCommand:
+		return handleRerunChecksCommand(issueComment, store, issues, pullRequests, graphQL)
+	case dcoOverrideCommand:
+		return handleDCOOverrideCommand(conf, issueComment, store, issues, pullRequests, repositories)
+	case deployCommand:
+		return handleDeployCommand(conf, issueComment, store, issues, pullRequests, repositories)
+	case lockCommand:
+		return handleLockCommand(issueComment, issues)
+	case unlockCommand:
+		return handleUnlockCommand(issueComment, issues)
+	case protectCommand:
+		return handleProtectCommand(conf, issueComment, issues, graphQL)
+	case approveContributorCommand:
+		return handleApproveContributorCommand(conf, issueComment, store, issues, pullRequests, repositories,
+			graphQL, gitRepos)
+	case claSignedCommand:
+		return handleCLASignedCommand(conf, issueComment, store, issues, pullRequests, repositories, graphQL,
+			gitRepos)
+	case helpCommand:
+		return handleHelpCommand(conf, issueComment, issues)
 	}
 	return ErrorResponse{
 		Code:         http.StatusInternalServerError,
@@ -111,29 +511,240 @@ func handleIssueComment(body []byte, retry retryGithubOperation, gitRepos git.Re
 	}
 }
 
-func handlePullRequestEvent(body []byte, retry retryGithubOperation, pullRequests PullRequests,
-	repositories Repositories) Response {
+func handlePullRequestEvent(conf Config, body []byte, retry retryGithubOperation, audit auditor, gitRepos git.Repos,
+	store Store, pullRequests PullRequests, repositories Repositories, issues Issues, graphQL GraphQL) Response {
 
 	pullRequestEvent, err := parsePullRequestEvent(body)
 	if err != nil {
 		return ErrorResponse{err, http.StatusInternalServerError, "Failed to parse the request's body"}
+	} else if pullRequestEvent.Action == "review_requested" || pullRequestEvent.Action == "review_request_removed" {
+		return trackReviewRequest(pullRequestEvent, store)
+	} else if pullRequestEvent.Action == "closed" {
+		// Requests for closed PRs shouldn't count towards anyone's review load
+		// and would otherwise be kept forever
+		issue := pullRequestEvent.Issue()
+		if err = store.RemoveReviewRequests(issue.Repository, issue.Number); err != nil {
+			log.Printf("Failed to stop tracking the review requests of PR %s: %v\n", issue.FullName(), err)
+		}
+		if err = store.RemoveStatusOverrides(issue.Repository, issue.Number); err != nil {
+			log.Printf("Failed to remove the status overrides of PR %s: %v\n", issue.FullName(), err)
+		}
+		if err = store.RemoveBlocks(issue); err != nil {
+			log.Printf("Failed to remove the blocks of PR %s: %v\n", issue.FullName(), err)
+		}
+		if err = store.RemoveDependencies(issue); err != nil {
+			log.Printf("Failed to remove the dependencies of PR %s: %v\n", issue.FullName(), err)
+		}
+		if err = store.RemoveFirstTimeContribution(issue); err != nil {
+			log.Printf("Failed to forget the first-time contribution of PR %s: %v\n", issue.FullName(), err)
+		}
+		if err = store.RemovePendingConfirmation(issue.Repository, issue.Number); err != nil {
+			log.Printf("Failed to remove the pending confirmation of PR %s: %v\n", issue.FullName(), err)
+		}
+		if err = store.SetMergeMethod(issue, ""); err != nil {
+			log.Printf("Failed to forget the merge method of PR %s: %v\n", issue.FullName(), err)
+		}
+		if err = store.SetMergeMessage(issue, ""); err != nil {
+			log.Printf("Failed to forget the merge message of PR %s: %v\n", issue.FullName(), err)
+		}
+		if err = store.SetSignOffWaiver(issue, SignOffWaiver{}); err != nil {
+			log.Printf("Failed to forget the sign-off waiver of PR %s: %v\n", issue.FullName(), err)
+		}
+		if err = store.RemoveRefusals(issue); err != nil {
+			log.Printf("Failed to forget the refusals to merge PR %s: %v\n", issue.FullName(), err)
+		}
+		if err = store.RemoveMergeQueueEntry(issue); err != nil {
+			log.Printf("Failed to remove the merge queue entry of PR %s: %v\n", issue.FullName(), err)
+		}
+		if err = store.RemoveForceWait(issue); err != nil {
+			log.Printf("Failed to stop waiting for the statuses of PR %s: %v\n", issue.FullName(), err)
+		}
+		forgetMergeRequest(issue, store)
+		unscheduleMerge(conf, issue, store)
+		if err = store.RemovePendingRerun(issue); err != nil {
+			log.Printf("Failed to stop tracking the check suite rerun of PR %s: %v\n", issue.FullName(), err)
+		}
+		// The validation branch is deleted along with the PR's other bot
+		// branches
+		if err = store.RemoveValidation(issue.Repository, issue.Number); err != nil {
+			log.Printf("Failed to stop tracking the validation of PR %s: %v\n", issue.FullName(), err)
+		}
+		if pullRequestEvent.Merged {
+			handleDependencyMerged(conf, pullRequestEvent, gitRepos, store, issues, pullRequests, repositories,
+				graphQL)
+		}
+		response := tearDownPreviewEnvironment(conf, pullRequestEvent, gitRepos, store, issues)
+		// A failed teardown stays in the status comment until it's resolved,
+		// so that closing the PR again updates the same comment
+		if _, failed := asErrorResponse(response); !failed {
+			minimizeStickyComment(issue, store, graphQL)
+		}
+		return response
+	} else if pullRequestEvent.Action == "labeled" && isSkipLabel(conf, pullRequestEvent.Label) {
+		return handleSkipLabeled(conf, pullRequestEvent, audit, store, issues, pullRequests, repositories, graphQL,
+			retry)
+	} else if pullRequestEvent.Action == "labeled" {
+		return handleMergingLabeled(conf, pullRequestEvent, gitRepos, store, issues, pullRequests, repositories,
+			graphQL)
+	} else if pullRequestEvent.Action == "unlabeled" && isSkipLabel(conf, pullRequestEvent.Label) {
+		return handleSkipUnlabeled(conf, pullRequestEvent, store, issues, pullRequests, repositories, graphQL, retry)
+	} else if pullRequestEvent.Action == "unlabeled" {
+		if pullRequestEvent.Label == MergingLabel {
+			forgetMergeRequest(pullRequestEvent.Issue(), store)
+		} else if pullRequestEvent.Label == ScheduledMergeLabel {
+			unscheduleMerge(conf, pullRequestEvent.Issue(), store)
+		}
+		return handleMergingUnlabeled(conf, pullRequestEvent, repositories)
+	} else if pullRequestEvent.Action == "enqueued" {
+		return handlePullRequestEnqueued(pullRequestEvent, store)
+	} else if pullRequestEvent.Action == "dequeued" {
+		return handlePullRequestDequeued(conf, pullRequestEvent, store, issues)
+	} else if pullRequestEvent.Action == "edited" && pullRequestEvent.PreviousBaseRef != "" {
+		return handleBaseBranchChanged(conf, pullRequestEvent, retry, gitRepos, store, issues, pullRequests,
+			repositories, graphQL)
+	} else if pullRequestEvent.Action == "edited" {
+		return handlePullRequestEdited(conf, pullRequestEvent, repositories, graphQL)
 	} else if !(pullRequestEvent.Action == "opened" || pullRequestEvent.Action == "synchronize") {
 		return SuccessResponse{"PR not opened or synchronized. Ignoring."}
 	}
-	return checkForFixupCommitsOnPREvent(pullRequestEvent, pullRequests, repositories, retry)
+	forcePushed, errResp := detectForcePush(pullRequestEvent, repositories)
+	if errResp != nil {
+		return errResp
+	}
+	// The status comment describes the previous head, so the new head gets a
+	// new one
+	if pullRequestEvent.Action == "synchronize" {
+		minimizeStickyComment(pullRequestEvent.Issue(), store, graphQL)
+	}
+	if pullRequestEvent.Action == "synchronize" && pullRequestEvent.HasLabel(MergingLabel) {
+		if errResp = cancelPendingMerge(conf, pullRequestEvent, store, issues); errResp != nil {
+			return errResp
+		}
+	}
+	if pullRequestEvent.Action == "synchronize" {
+		if errResp = revokeContributionApproval(conf, pullRequestEvent, store, issues); errResp != nil {
+			return errResp
+		}
+	}
+	if forcePushed {
+		errResp = handleForcePush(conf, pullRequestEvent, audit, store, issues, pullRequests, repositories, graphQL,
+			gitRepos)
+		if errResp != nil {
+			return errResp
+		}
+	}
+	// Failing to assign reviewers, to label the PR or to publish its check
+	// runs shouldn't keep the PR from being checked for fixup commits
+	if pullRequestEvent.Action == "opened" {
+		if errResp := assignReviewers(conf, pullRequestEvent, store, pullRequests, graphQL); errResp != nil {
+			log.Printf("%s: %v\n", errResp.ErrorMessage, errResp.Error)
+		}
+	}
+	if files, errResp := getLabeledFiles(conf, pullRequestEvent, pullRequests); errResp != nil {
+		log.Printf("%s: %v\n", errResp.ErrorMessage, errResp.Error)
+	} else {
+		if errResp := updateSizeLabel(conf, pullRequestEvent, files, issues); errResp != nil {
+			log.Printf("%s: %v\n", errResp.ErrorMessage, errResp.Error)
+		}
+		if errResp := labelGeneratedPR(conf, pullRequestEvent, files, issues); errResp != nil {
+			log.Printf("%s: %v\n", errResp.ErrorMessage, errResp.Error)
+		}
+	}
+	// Statuses are per commit, so every new head needs its own
+	if errResp := updateIssueReferenceStatus(conf, pullRequestEvent, repositories); errResp != nil {
+		return errResp
+	}
+	if errResp := publishDescriptionCheckRun(conf, pullRequestEvent, graphQL); errResp != nil {
+		log.Printf("%s: %v\n", errResp.ErrorMessage, errResp.Error)
+	}
+	if errResp := publishFileGuardCheckRun(conf, pullRequestEvent, pullRequests, graphQL); errResp != nil {
+		log.Printf("%s: %v\n", errResp.ErrorMessage, errResp.Error)
+	}
+	if errResp := checkHeadBranchName(conf, pullRequestEvent, issues, repositories); errResp != nil {
+		return errResp
+	}
+	if pullRequestEvent.Action == "opened" {
+		if errResp := handleFirstTimeContribution(conf, pullRequestEvent, store, issues); errResp != nil {
+			log.Printf("%s: %v\n", errResp.ErrorMessage, errResp.Error)
+		}
+		if errResp := requestCLASignature(conf, pullRequestEvent, issues, graphQL); errResp != nil {
+			log.Printf("%s: %v\n", errResp.ErrorMessage, errResp.Error)
+		}
+		errResp := autoMergeDependencyUpdate(conf, pullRequestEvent, store, issues, pullRequests, repositories,
+			graphQL, gitRepos)
+		if errResp != nil {
+			return errResp
+		}
+	}
+	return checkForFixupCommitsOnPREvent(conf, pullRequestEvent, store, pullRequests, repositories, retry)
 }
 
-func handleStatusEvent(body []byte, retry retryGithubOperation, gitRepos git.Repos, search Search,
-	issues Issues, pullRequests PullRequests) Response {
+func handlePullRequestReviewEvent(conf Config, body []byte, retry retryGithubOperation, gitRepos git.Repos,
+	store Store, limiter *commandRateLimiter, pullRequests PullRequests, repositories Repositories, issues Issues,
+	search Search, graphQL GraphQL) Response {
+
+	reviewEvent, err := parsePullRequestReviewEvent(body)
+	if err != nil {
+		return ErrorResponse{err, http.StatusInternalServerError, "Failed to parse the request's body"}
+	}
+	if reviewEvent.Action == "submitted" {
+		issue := reviewEvent.Issue()
+		err = store.CompleteReviewRequest(issue.Repository, issue.Number, reviewEvent.Reviewer.Login, time.Now())
+		if err != nil {
+			log.Printf("Failed to track the review of PR %s: %v\n", issue.FullName(), err)
+		}
+		// A command in the review's summary, e.g. an approval with "!merge",
+		// is handled like a command in a comment, instead of the approval.
+		// "!merge" checks the approval anyway and others, e.g. "!hold",
+		// shouldn't be raced by the approval merging the PR.
+		if command, isCommand := normalizeCommand(conf, reviewEvent.Body); isCommand &&
+			parseComment(command) != regularComment {
+
+			return handleCommandComment(conf, reviewEvent.CommandComment(), retry, gitRepos, store, limiter,
+				pullRequests, repositories, issues, search, graphQL)
+		}
+	}
+	if reviewEvent.Action != "submitted" || reviewEvent.State != "approved" {
+		return SuccessResponse{"Not an approving review. Ignoring."}
+	} else if !reviewEvent.HasLabel(MergingLabel) {
+		return SuccessResponse{fmt.Sprintf("PR not labeled with '%s'. Ignoring.", MergingLabel)}
+	}
+	// The approval might have been the last thing blocking the PR from being
+	// merged. Don't wait for another status event to find out.
+	return mergeIfReady(conf, reviewEvent.Issue(), false, store, issues, pullRequests, repositories, graphQL,
+		gitRepos)
+}
+
+func handleStatusEvent(conf Config, body []byte, retry retryGithubOperation, gitRepos git.Repos, store Store,
+	search Search, issues Issues, pullRequests PullRequests, repositories Repositories, graphQL GraphQL) Response {
 
 	statusEvent, err := parseStatusEvent(body)
 	if err != nil {
 		return ErrorResponse{err, http.StatusInternalServerError, "Failed to parse the request's body"}
-	} else if newPullRequestsPossiblyReadyForMerging(statusEvent) {
-		maybeSyncResponse := retry(func() asyncResponse {
-			return mergePullRequestsReadyForMerging(statusEvent, gitRepos, search, issues, pullRequests)
+	}
+	if validation, errResp := findValidation(statusEvent, store); errResp != nil {
+		return errResp
+	} else if validation != nil {
+		return handleValidationStatus(conf, *validation, gitRepos, store, issues, pullRequests, repositories)
+	}
+	if statusEvent.Context == githubStatusMergeContext {
+		return SuccessResponse{"Status update is the bot's own merge status. Ignoring."}
+	}
+	if newPullRequestsPossiblyReadyForMerging(statusEvent) {
+		if isTrigger, errResp := isMergeTrigger(conf, statusEvent, store, pullRequests, repositories); errResp != nil {
+			return errResp
+		} else if !isTrigger {
+			return SuccessResponse{"Status update is not for one of MERGE_TRIGGER_CONTEXTS. Ignoring."}
+		} else if response := claimStatusEvent(conf, statusEvent, store); response != nil {
+			return response
+		}
+		mergeOverriddenPRs(conf, statusEvent, gitRepos, store, issues, pullRequests, repositories, graphQL)
+		maybeSyncResponse := retry(statusEvent.Repository, func() asyncResponse {
+			return mergePullRequestsReadyForMerging(conf, statusEvent, gitRepos, store, search, issues,
+				pullRequests, repositories, graphQL)
 		})
 		if maybeSyncResponse.OperationFinishedSynchronously {
+			releaseFailedStatusEvent(conf, statusEvent, maybeSyncResponse.Response, store)
 			return maybeSyncResponse.Response
 		}
 		return SuccessResponse{"Status update might have caused a PR to become mergeable. Will check for " +
@@ -142,12 +753,136 @@ func handleStatusEvent(body []byte, retry retryGithubOperation, gitRepos git.Rep
 	return SuccessResponse{"Status update does not affect any PRs mergeability. Ignoring."}
 }
 
-func initGithubClient(accessToken string) *github.Client {
-	tokenSource := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: accessToken},
-	)
-	oauthTransport := &oauth2.Transport{
-		Source: tokenSource,
+// The number of PR, status and label reads whose responses are kept for
+// conditional requests
+const conditionalRequestCacheCapacity = 5000
+
+// newGitRepos creates the repos to clone the repositories into basePath
+// with. The clones are configured with PARTIAL_CLONE_REPOSITORIES,
+// SPARSE_CHECKOUT_PATHS, GIT_LFS_SKIP_SMUDGE and the proxy and limited with
+// GIT_DISK_QUOTA, and the git commands are limited with GIT_NETWORK_TIMEOUT
+// and GIT_COMMAND_TIMEOUT and the command hooks with HOOK_TIMEOUT. The bot's
+// commits are created as identity. With tenants, every tenant's repositories
+// are cloned into a directory of their own with the tenant's SSH key or, for
+// the tenants with an app and without a key, over HTTPS with the app
+// installation's tokens.
+func newGitRepos(conf Config, basePath string, identity git.Identity) git.Repos {
+	if len(conf.Tenants) > 0 {
+		return newTenantGitRepos(conf.Tenants, basePath, func(basePath string, tenant Tenant) git.Repos {
+			if tenant.SSHKeyPath == "" {
+				installation := NewAppInstallationTransport(*tenant.App, proxyTransport(conf))
+				return newGitReposWithToken(conf, basePath, identity, gitEnv(conf), installation.installationToken)
+			}
+			return newGitReposWithEnv(conf, basePath, identity, git.SSHKeyEnv(gitEnv(conf), tenant.SSHKeyPath))
+		})
+	}
+	return newGitReposWithEnv(conf, basePath, identity, gitEnv(conf))
+}
+
+func newGitReposWithEnv(conf Config, basePath string, identity git.Identity, env []string) git.Repos {
+	return newGitReposWithToken(conf, basePath, identity, env, nil)
+}
+
+// newGitReposWithToken creates the repos like newGitReposWithEnv, which
+// authenticate to the HTTPS remotes with the tokens token returns, unless
+// it's nil.
+func newGitReposWithToken(conf Config, basePath string, identity git.Identity, env []string,
+	token func() (string, error)) git.Repos {
+
+	return git.NewReposWithOptions(basePath, git.Options{
+		CloneOptions: cloneOptions(conf),
+		Env:          env,
+		Timeouts: git.Timeouts{
+			Network: conf.GitNetworkTimeout,
+			Local:   conf.GitCommandTimeout,
+			Command: conf.HookTimeout,
+		},
+		Identity:      identity,
+		SkipLFSSmudge: conf.GitLFSSkipSmudge,
+		DiskQuota:     int64(conf.GitDiskQuota),
+		Token:         token,
+	})
+}
+
+// gitIdentity returns the identity the bot's commits are created as:
+// GIT_COMMITTER_NAME and GIT_COMMITTER_EMAIL or, if they're not set, the login
+// and the noreply address of owner, the GitHub account the bot acts as. The
+// identity is left to the git package's default without either.
+func gitIdentity(conf Config, owner *github.User) git.Identity {
+	identity := git.Identity{Name: conf.GitCommitterName, Email: conf.GitCommitterEmail}
+	if owner == nil {
+		return identity
+	}
+	if identity.Name == "" {
+		identity.Name = owner.GetLogin()
+	}
+	if identity.Email == "" {
+		identity.Email = fmt.Sprintf("%d+%s@users.noreply.github.com", owner.GetID(), owner.GetLogin())
+	}
+	return identity
+}
+
+// tokenOwner gets the GitHub account the bot acts as. Nil is returned, if the
+// account couldn't be fetched.
+func tokenOwner(httpClient *http.Client) *github.User {
+	owner, _, err := github.NewClient(httpClient).Users.Get(context.TODO(), "")
+	if err != nil {
+		log.Printf("Failed to get the owner of the access token: %v\n", err)
+		return nil
+	}
+	return owner
+}
+
+// gitErrorCode returns the status code of the response to a webhook whose
+// git operation failed. Timed out operations fail with a 504, so that the
+// webhook would be retried like the ones GitHub's API failed transiently for,
+// and the ones GIT_DISK_QUOTA kept from cloning the repository with a 507.
+func gitErrorCode(err error) int {
+	if git.IsTimeout(err) {
+		return http.StatusGatewayTimeout
+	} else if git.IsDiskFull(err) {
+		return http.StatusInsufficientStorage
+	}
+	return http.StatusInternalServerError
+}
+
+// cloneOptions returns the options for cloning the repositories configured
+// with PARTIAL_CLONE_REPOSITORIES and SPARSE_CHECKOUT_PATHS.
+func cloneOptions(conf Config) func(repoOwner, repoName string) git.CloneOptions {
+	return func(repoOwner, repoName string) git.CloneOptions {
+		repository := Repository{Owner: repoOwner, Name: repoName}
+		options := git.CloneOptions{SparsePaths: conf.SparseCheckoutPaths[repositoryKey(repository)]}
+		if len(conf.PartialCloneRepositories) > 0 && isRepositoryAllowed(repository, conf.PartialCloneRepositories) {
+			options.Filter = "blob:none"
+		}
+		return options
+	}
+}
+
+// initGithubHTTPClient creates an HTTP client that authenticates with the
+// configured token. It's shared by the REST and GraphQL API clients. With
+// GITHUB_FIXTURES, the interactions with GitHub are recorded or replayed
+// beneath the caches, so that the fixtures would only include the requests
+// that reached GitHub.
+func initGithubHTTPClient(conf Config) (*http.Client, error) {
+	transport := proxyTransport(conf)
+	tokenPool := NewTokenPoolTransport(conf.AccessTokens, transport)
+	publishTokenRateLimits(tokenPool)
+	var oauthTransport http.RoundTripper = tokenPool
+	if len(conf.Tenants) > 0 {
+		oauthTransport = NewTenantTransport(conf.Tenants, tokenPool, transport)
+	}
+	switch conf.GithubFixturesMode {
+	case "record":
+		log.Printf("Recording the GitHub API interactions to %s\n", conf.GithubFixturesPath)
+		oauthTransport = fixtures.NewRecorder(oauthTransport, conf.GithubFixturesPath)
+	case "replay":
+		replayer, err := fixtures.Load(conf.GithubFixturesPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the GitHub API fixtures: %v", err)
+		}
+		log.Printf("Replaying the GitHub API interactions from %s\n", conf.GithubFixturesPath)
+		oauthTransport = replayer
 	}
 
 	memoryCacheTransport := &httpcache.Transport{
@@ -156,11 +891,15 @@ func initGithubClient(accessToken string) *github.Client {
 		MarkCachedResponses: true,
 	}
 
-	httpClient := &http.Client{
-		Transport: memoryCacheTransport,
+	// PR, status and label reads bypass the memory cache, which would serve
+	// them for up to a minute without checking whether they've changed
+	conditionalRequestTransport := NewConditionalRequestTransport(oauthTransport, memoryCacheTransport,
+		conditionalRequestCacheCapacity)
+
+	return &http.Client{
+		Transport: conditionalRequestTransport,
 		Timeout:   30 * time.Second,
-	}
-	return github.NewClient(httpClient)
+	}, nil
 }
 
 type commentType int
@@ -169,6 +908,34 @@ const (
 	squashCommand commentType = iota
 	mergeCommand
 	checkCommand
+	holdCommand
+	unholdCommand
+	blockCommand
+	unblockCommand
+	dependsOnCommand
+	priorityCommand
+	whoseTurnCommand
+	statusCommand
+	simulateMergeCommand
+	summaryCommand
+	assignCommand
+	unassignCommand
+	titleCommand
+	labelCommand
+	remindCommand
+	confirmCommand
+	cherryPickCommand
+	revertCommand
+	selfTestCommand
+	rerunChecksCommand
+	dcoOverrideCommand
+	deployCommand
+	lockCommand
+	unlockCommand
+	protectCommand
+	approveContributorCommand
+	claSignedCommand
+	helpCommand
 	regularComment
 )
 
@@ -180,16 +947,108 @@ func parseComment(comment string) commentType {
 		return mergeCommand
 	case isCheckCommand(comment):
 		return checkCommand
+	case isHoldCommand(comment):
+		return holdCommand
+	case isUnholdCommand(comment):
+		return unholdCommand
+	case isBlockCommand(comment):
+		return blockCommand
+	case isUnblockCommand(comment):
+		return unblockCommand
+	case isDependsOnCommand(comment):
+		return dependsOnCommand
+	case isPriorityCommand(comment):
+		return priorityCommand
+	case isWhoseTurnCommand(comment):
+		return whoseTurnCommand
+	case isStatusCommand(comment):
+		return statusCommand
+	case isSimulateMergeCommand(comment):
+		return simulateMergeCommand
+	case isSummaryCommand(comment):
+		return summaryCommand
+	case isAssignCommand(comment):
+		return assignCommand
+	case isUnassignCommand(comment):
+		return unassignCommand
+	case isTitleCommand(comment):
+		return titleCommand
+	case isLabelCommand(comment):
+		return labelCommand
+	case isRemindCommand(comment):
+		return remindCommand
+	case isConfirmCommand(comment):
+		return confirmCommand
+	case isCherryPickCommand(comment):
+		return cherryPickCommand
+	case isRevertCommand(comment):
+		return revertCommand
+	case isSelfTestCommand(comment):
+		return selfTestCommand
+	case isRerunChecksCommand(comment):
+		return rerunChecksCommand
+	case isDCOOverrideCommand(comment):
+		return dcoOverrideCommand
+	case isDeployCommand(comment):
+		return deployCommand
+	case isLockCommand(comment):
+		return lockCommand
+	case isUnlockCommand(comment):
+		return unlockCommand
+	case isProtectCommand(comment):
+		return protectCommand
+	case isApproveContributorCommand(comment):
+		return approveContributorCommand
+	case isCLASignedCommand(comment):
+		return claSignedCommand
+	case isHelpCommand(comment):
+		return helpCommand
 	}
 	return regularComment
 }
 
-func checkUserAuthorization(issueComment IssueComment, issues Issues, repositories Repositories) (*SuccessResponse, *ErrorResponse) {
-	if isAuthorized, err := isCollaborator(issueComment.Repository, issueComment.User, repositories); err != nil {
+// checkUserAuthorization allows the configured read-only commands from anyone.
+// Other commands can only be issued by trusted commenters on PRs whose authors
+// are collaborators or approved first-time contributors. COMMAND_PERMISSIONS
+// can open a command up to anyone or further limit who can issue it.
+func checkUserAuthorization(conf Config, issueComment IssueComment, commentCategory commentType, store Store,
+	issues Issues, pullRequests PullRequests, repositories Repositories, graphQL GraphQL) (*SuccessResponse,
+	*ErrorResponse) {
+
+	permission, errResp := commandPermission(conf, issueComment, commentCategory, pullRequests)
+	if errResp != nil {
+		return nil, errResp
+	} else if permission != nil && permission.isOpenToAnyone() {
+		return refuseUnapprovedContribution(conf, issueComment, commentCategory, store, issues)
+	} else if permission == nil && isOutsideCollaboratorCommand(commentCategory, conf.OutsideCollaboratorCommands) {
+		return nil, nil
+	} else if !isTrustedCommenter(issueComment) {
+		err := comment(
+			renderMessage(conf, outsideCollaboratorMessage, commandMessageData(issueComment, nil)),
+			issueComment.Repository,
+			issueComment.IssueNumber,
+			issues,
+		)
+		if err != nil {
+			return nil, &ErrorResponse{err, http.StatusBadGateway, "Failed to respond to unauthorized command"}
+		}
+		return &SuccessResponse{"Command issued by an outside collaborator. Responded with a comment. " +
+			"Ignoring the command."}, nil
+	}
+	isAuthorized, err := isCollaborator(issueComment.Repository, issueComment.User, repositories)
+	if err == nil && !isAuthorized {
+		// Approving a first-time contributor is what lets the other
+		// commands be issued on their PR
+		isAuthorized = commentCategory == approveContributorCommand
+		if !isAuthorized {
+			isAuthorized, err = isApprovedContribution(conf, issueComment.Issue(), store)
+		}
+	}
+	if err != nil {
 		return nil, &ErrorResponse{err, http.StatusBadGateway, "Failed to check if the user is authorized to issue the command"}
 	} else if !isAuthorized {
 		err = comment(
-			fmt.Sprintf("I'm sorry, @%s. I'm afraid I can't do that.", issueComment.User.Login),
+			renderMessage(conf, unauthorizedMessage, commandMessageData(issueComment, nil)),
 			issueComment.Repository,
 			issueComment.IssueNumber,
 			issues,
@@ -200,5 +1059,11 @@ func checkUserAuthorization(issueComment IssueComment, issues Issues, repositori
 		return &SuccessResponse{"Command issued by a someone who's not a collaborator." +
 			" Responded with a comment. Ignoring the command."}, nil
 	}
-	return nil, nil
+	if permission != nil {
+		successResp, errResp := checkCommandPermission(conf, issueComment, *permission, issues, graphQL)
+		if successResp != nil || errResp != nil {
+			return successResp, errResp
+		}
+	}
+	return refuseUnapprovedContribution(conf, issueComment, commentCategory, store, issues)
 }
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// cancelPendingMerge keeps commits pushed to a PR labeled "merging" from being
+// merged on the strength of the previous commits. The status overrides, the
+// pending confirmation and the validation all apply to the previous head, so
+// they're dropped and the merge waits for CI to pass on the new head. With
+// CANCEL_MERGE_ON_PUSH, the merge is cancelled altogether by removing the
+// label.
+func cancelPendingMerge(conf Config, pullRequestEvent PullRequestEvent, store Store, issues Issues) *ErrorResponse {
+	issue := pullRequestEvent.Issue()
+	if errResp := resetMergeState(issue, store); errResp != nil {
+		return errResp
+	}
+	if !conf.CancelMergeOnPush {
+		log.Printf("New commits were pushed to PR %s. Waiting for CI to pass on them before merging.\n",
+			issue.FullName())
+		return nil
+	}
+	if errResp := removeLabel(issue.Repository, issue.Number, MergingLabel, issues); errResp != nil {
+		return errResp
+	}
+	if err := store.RemoveDeferredMerge(issue); err != nil {
+		log.Printf("Failed to remove the deferred merge of PR %s: %v\n", issue.FullName(), err)
+	}
+	message := fmt.Sprintf("@%s, I cancelled the merge, because new commits were pushed. Please ask me to "+
+		"`!merge` again once they've been reviewed.", issue.User.Login)
+	if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+		errorMessage := fmt.Sprintf("Failed to report the cancelled merge of PR %s", issue.FullName())
+		return &ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	log.Printf("New commits were pushed to PR %s. Cancelled the merge.\n", issue.FullName())
+	return nil
+}
+
+// resetMergeState forgets the status overrides, the pending confirmation and
+// the validation of the PR, which were all given for a previous head.
+func resetMergeState(issue Issue, store Store) *ErrorResponse {
+	if err := store.RemoveStatusOverrides(issue.Repository, issue.Number); err != nil {
+		message := fmt.Sprintf("Failed to remove the status overrides of PR %s", issue.FullName())
+		return &ErrorResponse{err, http.StatusInternalServerError, message}
+	} else if err = store.RemovePendingConfirmation(issue.Repository, issue.Number); err != nil {
+		message := fmt.Sprintf("Failed to remove the pending confirmation of PR %s", issue.FullName())
+		return &ErrorResponse{err, http.StatusInternalServerError, message}
+	} else if err = store.RemoveValidation(issue.Repository, issue.Number); err != nil {
+		message := fmt.Sprintf("Failed to stop tracking the validation of PR %s", issue.FullName())
+		return &ErrorResponse{err, http.StatusInternalServerError, message}
+	}
+	return nil
+}
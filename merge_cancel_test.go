@@ -0,0 +1,176 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("pull_request synchronize event for a PR labeled merging", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			store            grh.Store
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+
+			pullRequestHeadSHA = "1235"
+			headRepository     = grh.Repository{
+				Owner: repositoryOwner,
+				Name:  repositoryName,
+				URL:   sshURL,
+			}
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			store = *context.Store
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+
+			Expect(store.AddStatusOverride(grh.StatusOverride{
+				Repository:  headRepository,
+				PullRequest: issueNumber,
+				Context:     "ci",
+				User:        "procoder",
+				CreatedAt:   time.Now(),
+			})).To(Succeed())
+		})
+
+		mockFixupCheck := func() {
+			pullRequests.
+				On("ListCommits", anyContext, repositoryOwner, repositoryName, issueNumber,
+					mock.AnythingOfType("*github.ListOptions")).
+				Return(githubCommits(commit{pullRequestHeadSHA, "Changing things"}), emptyResponse, noError)
+			repositories.
+				On("CreateStatus", anyContext, repositoryOwner, repositoryName, pullRequestHeadSHA,
+					mock.AnythingOfType("*github.RepoStatus")).
+				Return(emptyResult, emptyResponse, noError)
+		}
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "pull_request",
+			}
+		})
+
+		requestJSON.Is(func() string {
+			return LabeledPullRequestEvent("synchronize", pullRequestHeadSHA, headRepository, grh.MergingLabel)
+		})
+
+		It("drops the status overrides and keeps the label", func() {
+			mockFixupCheck()
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			Expect(store.StatusOverrides(headRepository)).To(BeEmpty())
+			issues.AssertNotCalled(GinkgoT(), "RemoveLabelForIssue", anyContext, repositoryOwner, repositoryName,
+				issueNumber, grh.MergingLabel)
+		})
+
+		Context("with CANCEL_MERGE_ON_PUSH", func() {
+			BeforeEach(func() {
+				context.Config.CancelMergeOnPush = true
+			})
+
+			Context("with removing the label succeeding", func() {
+				BeforeEach(func() {
+					issues.
+						On("RemoveLabelForIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+							grh.MergingLabel).
+						Return(emptyResponse, noError)
+					mockFixupCheck()
+				})
+
+				It("removes the label and explains why", func() {
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("@"+arbitraryIssueAuthor+", I cancelled the merge, "+
+								"because new commits were pushed."))).
+						Return(emptyResult, emptyResponse, noError).
+						Once()
+
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					Expect(store.StatusOverrides(headRepository)).To(BeEmpty())
+					issues.AssertExpectations(GinkgoT())
+				})
+			})
+
+			Context("with removing the label failing", func() {
+				BeforeEach(func() {
+					issues.
+						On("RemoveLabelForIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+							grh.MergingLabel).
+						Return(emptyResponse, errArbitrary)
+				})
+
+				It("fails with a gateway error", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusBadGateway))
+				})
+			})
+		})
+	})
+
+	Describe("pull_request synchronize event for a PR not labeled merging", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+			context.Config.CancelMergeOnPush = true
+
+			pullRequests.
+				On("ListCommits", anyContext, repositoryOwner, repositoryName, issueNumber,
+					mock.AnythingOfType("*github.ListOptions")).
+				Return(githubCommits(commit{"1235", "Changing things"}), emptyResponse, noError)
+			repositories.
+				On("CreateStatus", anyContext, repositoryOwner, repositoryName, "1235",
+					mock.AnythingOfType("*github.RepoStatus")).
+				Return(emptyResult, emptyResponse, noError)
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "pull_request",
+			}
+		})
+
+		requestJSON.Is(func() string {
+			return LabeledPullRequestEvent("synchronize", "1235", grh.Repository{
+				Owner: repositoryOwner,
+				Name:  repositoryName,
+				URL:   sshURL,
+			}, "bug")
+		})
+
+		It("leaves the labels alone", func() {
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			issues.AssertNotCalled(GinkgoT(), "RemoveLabelForIssue", anyContext, repositoryOwner, repositoryName,
+				issueNumber, grh.MergingLabel)
+		})
+	})
+})
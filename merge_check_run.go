@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/evaluator"
+)
+
+const mergeCheckRunName = "review-helper/merge decision"
+
+const repositoryIDQuery = `query($owner: String!, $name: String!) {
+  repository(owner: $owner, name: $name) {
+    id
+  }
+}`
+
+const createCheckRunMutation = `mutation($repositoryId: ID!, $headSha: GitObjectID!, $name: String!,
+  $status: RequestableCheckStatusState!, $conclusion: CheckConclusionState, $title: String!, $summary: String!,
+  $text: String) {
+  createCheckRun(input: {repositoryId: $repositoryId, headSha: $headSha, name: $name, status: $status,
+    conclusion: $conclusion, output: {title: $title, summary: $summary, text: $text}}) {
+    checkRun {
+      id
+    }
+  }
+}`
+
+type repositoryIDResult struct {
+	Repository struct {
+		ID string `json:"id"`
+	} `json:"repository"`
+}
+
+// publishMergeCheckRun explains the outcome of evaluating the PR for merging
+// in a check run on the PR's head, listing every rule the PR has to pass with
+// its outcome. Every evaluation completes its check run, because nothing
+// would complete one that's left in progress if the PR stopped being
+// evaluated, e.g. because it was closed. Blocked PRs and PRs that are waiting
+// for something, e.g. pending statuses, get a neutral check run, so that the
+// explanation wouldn't block the merge itself. If the evaluation failed, the
+// check run only says so. Failing to publish the check run is only logged,
+// because the check run is just an explanation.
+func publishMergeCheckRun(conf Config, pr *github.PullRequest, response Response, store Store, issues Issues,
+	pullRequests PullRequests, repositories Repositories, graphQL GraphQL) {
+
+	if !conf.MergeCheckRun {
+		return
+	}
+	issue := prIssue(pr)
+	var (
+		state map[string]interface{}
+		text  string
+	)
+	if errResp, isError := asErrorResponse(response); isError {
+		state = failedMergeCheckRunState(errResp)
+	} else {
+		decision, errResp := evaluate(readinessRules(conf, pr, store, issues, pullRequests, repositories,
+			graphQL), true)
+		if errResp != nil {
+			log.Printf("Failed to explain the merge decision of PR %s: %s: %v\n", issue.FullName(),
+				errResp.ErrorMessage, errResp.Error)
+			state = failedMergeCheckRunState(*errResp)
+		} else {
+			state = mergeCheckRunState(decision)
+			text = decision.Markdown()
+		}
+	}
+	err := createCheckRun(baseRepository(pr), *pr.Head.SHA, mergeCheckRunName, state, text, graphQL)
+	if err != nil {
+		log.Printf("Failed to publish the merge decision of PR %s: %v\n", issue.FullName(), err)
+	}
+}
+
+// createCheckRun creates a check run on the head commit of a PR in the
+// repository. The state holds the check run's status, conclusion, title and
+// summary and the text is shown below the summary.
+func createCheckRun(repository Repository, headSHA, name string, state map[string]interface{}, text string,
+	graphQL GraphQL) error {
+
+	var repositoryID repositoryIDResult
+	err := graphQL.Query(context.TODO(), repositoryIDQuery, map[string]interface{}{
+		"owner": repository.Owner,
+		"name":  repository.Name,
+	}, &repositoryID)
+	if err != nil {
+		return fmt.Errorf("failed to get the ID of %s: %v", repositoryKey(repository), err)
+	}
+	variables := map[string]interface{}{
+		"repositoryId": repositoryID.Repository.ID,
+		"headSha":      headSHA,
+		"name":         name,
+		"text":         text,
+	}
+	for name, value := range state {
+		variables[name] = value
+	}
+	var result struct{}
+	return graphQL.Query(context.TODO(), createCheckRunMutation, variables, &result)
+}
+
+// mergeCheckRunState returns the status, conclusion, title and summary of
+// the check run explaining the decision.
+func mergeCheckRunState(decision evaluator.Decision) map[string]interface{} {
+	blocker := decision.Blocker()
+	switch {
+	case blocker == nil:
+		return map[string]interface{}{
+			"status":     "COMPLETED",
+			"conclusion": "SUCCESS",
+			"title":      "Ready to be merged",
+			"summary":    "This PR passes all of the rules it has to pass before it's merged.",
+		}
+	case blocker.Outcome == evaluator.Pending:
+		return map[string]interface{}{
+			"status":     "COMPLETED",
+			"conclusion": "NEUTRAL",
+			"title":      fmt.Sprintf("Waiting: %s", blocker.Rule),
+			"summary":    fmt.Sprintf("This PR is not merged yet, because %s.", blocker.Reason),
+		}
+	}
+	return map[string]interface{}{
+		"status":     "COMPLETED",
+		"conclusion": "NEUTRAL",
+		"title":      fmt.Sprintf("Blocked: %s", blocker.Rule),
+		"summary":    fmt.Sprintf("This PR is not merged, because %s.", blocker.Reason),
+	}
+}
+
+// failedMergeCheckRunState returns the status, conclusion, title and summary
+// of the check run of an evaluation that failed.
+func failedMergeCheckRunState(errResp ErrorResponse) map[string]interface{} {
+	return map[string]interface{}{
+		"status":     "COMPLETED",
+		"conclusion": "NEUTRAL",
+		"title":      "Not merged: something went wrong",
+		"summary":    fmt.Sprintf("This PR is not merged, because of an error: %s.", errResp.ErrorMessage),
+	}
+}
@@ -0,0 +1,203 @@
+package main_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("merge check run", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+			graphQL          *mocks.GraphQL
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+			graphQL = *context.GraphQL
+
+			context.Config.MergeCheckRun = true
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!merge", arbitraryIssueAuthor)
+		})
+
+		headSHA := "1235"
+		newPR := func(mergeable bool) *github.PullRequest {
+			return &github.PullRequest{
+				Number:    github.Int(issueNumber),
+				Merged:    github.Bool(false),
+				Mergeable: github.Bool(mergeable),
+				Base: &github.PullRequestBranch{
+					SHA:  github.String("1234"),
+					Ref:  github.String("master"),
+					Repo: repository,
+				},
+				Head: &github.PullRequestBranch{
+					SHA:  github.String(headSHA),
+					Ref:  github.String("feature"),
+					Repo: repository,
+				},
+				User: &github.User{
+					Login: github.String(arbitraryIssueAuthor),
+				},
+			}
+		}
+
+		isCheckRunMutation := func(query string) bool {
+			return strings.Contains(query, "createCheckRun")
+		}
+
+		BeforeEach(func() {
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+			issues.
+				On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{grh.MergingLabel}).
+				Return(emptyResult, emptyResponse, noError)
+			mockLabels(issues, issueNumber, grh.MergingLabel)
+			graphQL.
+				On("Query", anyContext, mock.MatchedBy(func(query string) bool {
+					return !isCheckRunMutation(query)
+				}), mock.Anything, mock.Anything).
+				Return(noError).
+				Run(func(args mock.Arguments) {
+					Expect(json.Unmarshal([]byte(`{"repository": {"id": "repo-id"}}`), args.Get(3))).To(Succeed())
+				})
+		})
+
+		Context("with a merge conflict", func() {
+			BeforeEach(func() {
+				pullRequests.
+					On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+					Return(newPR(false), emptyResponse, noError)
+				repositories.
+					On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.AnythingOfType("*github.ListOptions")).
+					Return(&github.CombinedStatus{
+						State: github.String("success"),
+						Statuses: []github.RepoStatus{{
+							Context: github.String("ci"),
+							State:   github.String("success"),
+						}},
+					}, emptyResponse, noError)
+				graphQL.
+					On("Query", anyContext, mock.MatchedBy(isCheckRunMutation), mock.MatchedBy(func(variables map[string]interface{}) bool {
+						text, _ := variables["text"].(string)
+						return variables["repositoryId"] == "repo-id" && variables["headSha"] == headSHA &&
+							variables["conclusion"] == "NEUTRAL" && variables["title"] == "Blocked: mergeable" &&
+							strings.Contains(text, ":x: **mergeable**: it has a merge conflict") &&
+							strings.Contains(text, ":white_check_mark: **ci**") &&
+							strings.Contains(text, ":white_check_mark: **hold**")
+					}), mock.Anything).
+					Return(noError).
+					Once()
+			})
+
+			It("explains every rule in a neutral check run", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(responseRecorder.Body.String()).To(ContainSubstring("has a merge conflict"))
+				graphQL.AssertExpectations(GinkgoT())
+			})
+		})
+
+		Context("with pending statuses", func() {
+			BeforeEach(func() {
+				pullRequests.
+					On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+					Return(newPR(true), emptyResponse, noError)
+				repositories.
+					On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.AnythingOfType("*github.ListOptions")).
+					Return(&github.CombinedStatus{
+						State: github.String("pending"),
+						Statuses: []github.RepoStatus{{
+							Context: github.String("ci"),
+							State:   github.String("pending"),
+						}},
+					}, emptyResponse, noError)
+				graphQL.
+					On("Query", anyContext, mock.MatchedBy(isCheckRunMutation), mock.MatchedBy(func(variables map[string]interface{}) bool {
+						return variables["status"] == "COMPLETED" && variables["conclusion"] == "NEUTRAL" &&
+							variables["title"] == "Waiting: statuses"
+					}), mock.Anything).
+					Return(noError).
+					Once()
+			})
+
+			It("publishes a completed check run, so that it's never left in progress", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(responseRecorder.Body.String()).To(ContainSubstring("has pending statuses"))
+				graphQL.AssertExpectations(GinkgoT())
+			})
+		})
+
+		Context("with getting the statuses failing", func() {
+			BeforeEach(func() {
+				pullRequests.
+					On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+					Return(newPR(true), emptyResponse, noError)
+				repositories.
+					On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.AnythingOfType("*github.ListOptions")).
+					Return(emptyResult, emptyResponse, errArbitrary)
+				graphQL.
+					On("Query", anyContext, mock.MatchedBy(isCheckRunMutation), mock.MatchedBy(func(variables map[string]interface{}) bool {
+						return variables["status"] == "COMPLETED" && variables["conclusion"] == "NEUTRAL" &&
+							variables["title"] == "Not merged: something went wrong"
+					}), mock.Anything).
+					Return(noError).
+					Once()
+			})
+
+			It("completes the check run with the failure", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusBadGateway))
+				graphQL.AssertExpectations(GinkgoT())
+			})
+		})
+
+		Context("with publishing the check run failing", func() {
+			BeforeEach(func() {
+				pullRequests.
+					On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+					Return(newPR(false), emptyResponse, noError)
+				repositories.
+					On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.AnythingOfType("*github.ListOptions")).
+					Return(&github.CombinedStatus{State: github.String("success")}, emptyResponse, noError)
+				graphQL.
+					On("Query", anyContext, mock.MatchedBy(isCheckRunMutation), mock.Anything, mock.Anything).
+					Return(errArbitrary)
+			})
+
+			It("still responds successfully", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			})
+		})
+	})
+})
@@ -4,18 +4,104 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/evaluator"
 	"github.com/salemove/github-review-helper/git"
 )
 
 const (
 	MergingLabel = "merging"
+	// The number of PRs fetched at once when a status update may have made
+	// several of them ready for merging
+	prFetchParallelism = 4
 )
 
+var (
+	mergeMethodArgumentRegexp = regexp.MustCompile(`^\s+(squash|rebase|commit)\b`)
+	ignoreArgumentRegexp      = regexp.MustCompile(`^\s+ignore=(?:"([^"]+)"|(\S+))`)
+	forceWaitArgumentRegexp   = regexp.MustCompile(`^\s+force-wait\b`)
+	nextArgumentRegexp        = regexp.MustCompile(`^\s+--next\b`)
+	atArgumentRegexp          = regexp.MustCompile(`^\s+at\s+(\S+)`)
+	afterFreezeArgumentRegexp = regexp.MustCompile(`^\s+after-freeze\b`)
+	messageArgumentRegexp     = regexp.MustCompile(`^\s+--message[ =]"((?:[^"\\]|\\.)+)"`)
+)
+
+// mergeArguments are the arguments of a "!merge" command
+type mergeArguments struct {
+	// Method is the merge method chosen for the PR, if any
+	Method          string
+	IgnoredContexts []string
+	// ForceWait keeps the bot checking for the required statuses that CI
+	// hasn't reported for FORCE_WAIT_TIMEOUT
+	ForceWait bool
+	// Next moves the PR to the front of the merge queue, like "!priority
+	// high"
+	Next bool
+	// Message is the message of the commit the merge creates, if given
+	Message string
+	// At is the time the merge is scheduled for, as it was given
+	At string
+	// AfterFreeze schedules the merge for when the active or next merge
+	// freeze ends
+	AfterFreeze bool
+}
+
 func isMergeCommand(comment string) bool {
-	return strings.TrimSpace(comment) == "!merge"
+	_, isMerge := parseMergeCommand(comment)
+	return isMerge
+}
+
+// parseMergeCommand parses a "!merge" command, which may be followed by a
+// merge method (squash, rebase or commit), a "force-wait", a "--next", a
+// quoted "--message", an "at <time>" or an "after-freeze" and any number of
+// "ignore=<context>" arguments. Contexts containing spaces have to be
+// quoted. The message may span several lines and escape quotes, backslashes
+// and newlines with a backslash.
+func parseMergeCommand(comment string) (mergeArguments, bool) {
+	arguments := strings.TrimSpace(comment)
+	if !strings.HasPrefix(arguments, "!merge") {
+		return mergeArguments{}, false
+	}
+	arguments = strings.TrimPrefix(arguments, "!merge")
+	parsed := mergeArguments{IgnoredContexts: []string{}}
+	if matches := mergeMethodArgumentRegexp.FindStringSubmatch(arguments); matches != nil {
+		parsed.Method = matches[1]
+		arguments = arguments[len(matches[0]):]
+	}
+	for arguments != "" {
+		if match := forceWaitArgumentRegexp.FindString(arguments); match != "" {
+			parsed.ForceWait = true
+			arguments = arguments[len(match):]
+			continue
+		} else if match := nextArgumentRegexp.FindString(arguments); match != "" {
+			parsed.Next = true
+			arguments = arguments[len(match):]
+			continue
+		} else if match := afterFreezeArgumentRegexp.FindString(arguments); match != "" && parsed.At == "" {
+			parsed.AfterFreeze = true
+			arguments = arguments[len(match):]
+			continue
+		} else if matches := atArgumentRegexp.FindStringSubmatch(arguments); matches != nil && !parsed.AfterFreeze {
+			parsed.At = matches[1]
+			arguments = arguments[len(matches[0]):]
+			continue
+		} else if matches := messageArgumentRegexp.FindStringSubmatch(arguments); matches != nil {
+			parsed.Message = strings.TrimSpace(mergeMessageUnescaper.Replace(matches[1]))
+			arguments = arguments[len(matches[0]):]
+			continue
+		}
+		matches := ignoreArgumentRegexp.FindStringSubmatch(arguments)
+		if matches == nil {
+			return mergeArguments{}, false
+		}
+		parsed.IgnoredContexts = append(parsed.IgnoredContexts, matches[1]+matches[2])
+		arguments = arguments[len(matches[0]):]
+	}
+	return parsed, true
 }
 
 func newPullRequestsPossiblyReadyForMerging(statusEvent StatusEvent) bool {
@@ -24,53 +110,447 @@ func newPullRequestsPossiblyReadyForMerging(statusEvent StatusEvent) bool {
 	// enabling us to merge the PR.
 	// In a similar manner we also only care about status updates to commits
 	// that are the head commit of a branch, because only they have the ability
-	// to change a PR's combined status.
-	return statusEvent.State == "success" && isStatusForBranchHead(statusEvent)
+	// to change a PR's combined status. The head commits of PRs from forks
+	// aren't on any of the base repository's branches, so statuses for
+	// commits that aren't on any branch are considered as well.
+	return statusEvent.State == "success" &&
+		(len(statusEvent.Branches) == 0 || isStatusForBranchHead(statusEvent))
+}
+
+// requiredContextsTrigger is the value of MERGE_TRIGGER_CONTEXTS that stands
+// for the contexts the protection of a PR's base branch requires
+const requiredContextsTrigger = "required"
+
+// isMergeTrigger reports whether the status' context is one of
+// MERGE_TRIGGER_CONTEXTS, so that the successes of the contexts that don't
+// gate merging, e.g. of chatty CI jobs, wouldn't each cost a search for PRs to
+// merge. Every context is a trigger, if MERGE_TRIGGER_CONTEXTS is empty. A
+// status that leaves the commit's combined state successful is a trigger as
+// well, because it may be the last one a PR is waiting for.
+func isMergeTrigger(conf Config, statusEvent StatusEvent, store Store, pullRequests PullRequests,
+	repositories Repositories) (bool, *ErrorResponse) {
+
+	if len(conf.MergeTriggerContexts) == 0 {
+		return true, nil
+	}
+	triggersRequired := false
+	for _, trigger := range conf.MergeTriggerContexts {
+		if trigger == statusEvent.Context {
+			return true, nil
+		}
+		triggersRequired = triggersRequired || trigger == requiredContextsTrigger
+	}
+	state, _, errResp := getStatusesForRef(statusEvent.Repository, statusEvent.SHA, repositories)
+	if errResp != nil {
+		return false, errResp
+	} else if state == "success" {
+		return true, nil
+	} else if !triggersRequired {
+		return false, nil
+	}
+	baseRefs, errResp := mergingBaseRefs(statusEvent, store, pullRequests)
+	if errResp != nil {
+		return false, errResp
+	}
+	for _, baseRef := range baseRefs {
+		required, errResp := getBranchRequiredStatusContexts(statusEvent.Repository, baseRef, repositories)
+		if errResp != nil {
+			return false, errResp
+		}
+		for _, context := range required {
+			if context == statusEvent.Context {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// mergingBaseRefs returns the base branches of the PRs labeled for merging
+// whose head is the commit the status is for.
+func mergingBaseRefs(statusEvent StatusEvent, store Store, pullRequests PullRequests) ([]string,
+	*ErrorResponse) {
+
+	repository := statusEvent.Repository
+	requests, err := store.MergeRequests()
+	if err != nil {
+		message := fmt.Sprintf("Failed to list the merge requests of %s", repositoryKey(repository))
+		return nil, &ErrorResponse{err, http.StatusInternalServerError, message}
+	}
+	var baseRefs []string
+	seen := make(map[string]bool)
+	for _, request := range requests {
+		if repositoryKey(request.Issue.Repository) != repositoryKey(repository) {
+			continue
+		}
+		pr, errResp := getPR(request.Issue, pullRequests)
+		if errResp != nil {
+			return nil, errResp
+		} else if pr.Head.GetSHA() != statusEvent.SHA || seen[*pr.Base.Ref] {
+			continue
+		}
+		seen[*pr.Base.Ref] = true
+		baseRefs = append(baseRefs, *pr.Base.Ref)
+	}
+	return baseRefs, nil
 }
 
-func handleMergeCommand(issueComment IssueComment, issues Issues, pullRequests PullRequests,
-	repositories Repositories, gitRepos git.Repos) Response {
+func handleMergeCommand(conf Config, issueComment IssueComment, store Store, search Search, issues Issues,
+	pullRequests PullRequests, repositories Repositories, graphQL GraphQL, gitRepos git.Repos) Response {
+	issue := issueComment.Issue()
+	if response := checkMergeBaseBranch(conf, issueComment, issues, pullRequests); response != nil {
+		return response
+	}
+	arguments, _ := parseMergeCommand(issueComment.Comment)
+	if arguments.Next {
+		// Jumping the queue is up to the same people as "!priority high"
+		permission := CommandPermission{Command: "!merge --next", Role: "maintain"}
+		if response, errResp := checkCommandPermission(conf, issueComment, permission, issues,
+			graphQL); errResp != nil {
+			return errResp
+		} else if response != nil {
+			return response
+		}
+	}
+	if response := checkMergeQueueDepth(conf, issueComment, search, issues); response != nil {
+		return response
+	}
+	if response := chooseMergeMethod(conf, issueComment, arguments.Method, store, issues,
+		repositories); response != nil {
+		return response
+	}
+	if response := chooseMergeMessage(conf, issueComment, arguments, store, issues); response != nil {
+		return response
+	}
+	if len(arguments.IgnoredContexts) > 0 {
+		reason, errResp := overrideStatuses(conf, issueComment, arguments.IgnoredContexts, store, issues,
+			pullRequests, repositories)
+		if errResp != nil {
+			return errResp
+		} else if reason != "" {
+			message := fmt.Sprintf("I can't ignore these statuses, because %s.", reason)
+			if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+				errorMessage := fmt.Sprintf("Failed to report why the statuses of PR %s weren't overridden",
+					issue.FullName())
+				return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+			}
+			return SuccessResponse{fmt.Sprintf("Not overriding the statuses of PR %s, because %s",
+				issue.FullName(), reason)}
+		}
+	}
+	if arguments.Next && !issueComment.HasLabel(PriorityLabel) {
+		if errResp := addLabel(issueComment.Repository, issueComment.IssueNumber, PriorityLabel, issues); errResp != nil {
+			return errResp
+		}
+	}
+	if arguments.At != "" || arguments.AfterFreeze {
+		return scheduleMerge(conf, issueComment, arguments, store, issues)
+	} else if issueComment.HasLabel(ScheduledMergeLabel) {
+		// Merging right away replaces the scheduled merge
+		if errResp := removeLabel(issue.Repository, issue.Number, ScheduledMergeLabel, issues); errResp != nil {
+			return errResp
+		}
+		unscheduleMerge(conf, issue, store)
+	}
 	errResp := addLabel(issueComment.Repository, issueComment.IssueNumber, MergingLabel, issues)
 	if errResp != nil {
 		return errResp
 	}
-	pr, errResp := getPR(issueComment, pullRequests)
+	trackMergeRequest(conf, issue, issueComment.Commenter.Login, store)
+	if arguments.ForceWait {
+		if errResp = addForceWait(conf, issue, store); errResp != nil {
+			return errResp
+		}
+	}
+	errResp = requestTwoPersonConfirmation(conf, issue, issueComment.Commenter.Login, store, issues, pullRequests)
+	if errResp != nil {
+		return errResp
+	}
+	return mergeIfReady(conf, issue, true, store, issues, pullRequests, repositories, graphQL, gitRepos)
+}
+
+// mergeIfReady merges the PR if it's ready for merging. PRs with a pending
+// squash status are squashed first. Overridden statuses are ignored. It's
+// expected that the PR has already been labeled with the 'merging' label. If
+// reportBlocked is set, the reason why a PR with successful statuses can't be
+// merged is commented on the PR.
+// If the base branch is modified while merging, the PR is evaluated again up
+// to MERGE_BASE_MODIFIED_RETRIES times.
+func mergeIfReady(conf Config, issue Issue, reportBlocked bool, store Store, issues Issues,
+	pullRequests PullRequests, repositories Repositories, graphQL GraphQL, gitRepos git.Repos) Response {
+	tryMerge := func() Response {
+		return tryMergeIfReady(conf, issue, reportBlocked, store, issues, pullRequests, repositories, graphQL,
+			gitRepos)
+	}
+	return retryIfBaseBranchModified(conf, issue, tryMerge(), tryMerge)
+}
+
+// retryIfBaseBranchModified evaluates and merges the PR again with tryMerge
+// for as long as the merges fail, because the PR's base branch was modified,
+// but at most MERGE_BASE_MODIFIED_RETRIES times.
+func retryIfBaseBranchModified(conf Config, issue Issue, response Response, tryMerge func() Response) Response {
+	for attempt := 0; attempt < conf.MergeBaseModifiedRetries; attempt++ {
+		if errResp, isError := asErrorResponse(response); !isError || errResp.Error != ErrBaseBranchModified {
+			return response
+		}
+		log.Printf("The base branch of PR %s was modified while merging it. Trying again.\n", issue.FullName())
+		response = tryMerge()
+	}
+	return response
+}
+
+func tryMergeIfReady(conf Config, issue Issue, reportBlocked bool, store Store, issues Issues,
+	pullRequests PullRequests, repositories Repositories, graphQL GraphQL, gitRepos git.Repos) (response Response) {
+	pr, errResp := getPR(issue, pullRequests)
 	if errResp != nil {
 		return errResp
 	} else if *pr.Merged {
-		log.Printf("PR #%d already merged. Removing the '%s' label.\n", issueComment.IssueNumber, MergingLabel)
-		errResp = removeLabel(issueComment.Repository, issueComment.IssueNumber, MergingLabel, issues)
+		log.Printf("PR #%d already merged. Removing the '%s' label.\n", issue.Number, MergingLabel)
+		errResp = removeLabel(issue.Repository, issue.Number, MergingLabel, issues)
 		if errResp != nil {
 			return errResp
 		}
 		return SuccessResponse{}
-	} else if !*pr.Mergeable {
-		return SuccessResponse{}
+	}
+	defer func() {
+		publishMergeCheckRun(conf, pr, response, store, issues, pullRequests, repositories, graphQL)
+	}()
+	if !*pr.Mergeable {
+		return SuccessResponse{fmt.Sprintf("PR %s has a merge conflict. Not merging.", issue.FullName())}
 	}
 	state, statuses, errResp := getStatuses(pr, repositories)
+	if errResp != nil {
+		return errResp
+	}
+	state, errResp = applyStatusOverrides(pr, state, statuses, store)
 	if errResp != nil {
 		return errResp
 	} else if state == "pending" && containsPendingSquashStatus(statuses) {
-		return squashAndReportFailure(pr, gitRepos, repositories)
-	} else if state != "success" {
-		log.Printf("PR #%d has pending and/or failed statuses. Not merging.\n", issueComment.IssueNumber)
-		return SuccessResponse{}
+		arguments := squashArguments{}
+		if conf.SoftFail {
+			pending, confirmed, errResp := confirmedWithReaction(conf, issue, confirmSquashAction, store, graphQL)
+			if errResp != nil {
+				return errResp
+			} else if !confirmed {
+				if errResp = requestConfirmation(conf, issue, confirmSquashAction, "", store, issues); errResp != nil {
+					return errResp
+				}
+				return SuccessResponse{fmt.Sprintf("Waiting for a confirmation to squash PR %s", issue.FullName())}
+			}
+			// The confirmation is only for this action
+			conf.SoftFail = false
+			arguments, _ = parseSquashCommand(pending.Command)
+		}
+		return squashAndReportFailure(conf, pr, arguments, store, gitRepos, repositories, issues)
+	}
+	// The combined state doesn't include the required contexts that haven't
+	// been reported at all, so it can be pending or even successful forever
+	// without the PR ever becoming mergeable
+	if state != "failure" {
+		if missing, errResp := reportMissingContexts(conf, pr, statuses, store, issues,
+			repositories, graphQL); errResp != nil {
+			return errResp
+		} else if missing {
+			return SuccessResponse{fmt.Sprintf("PR %s is waiting on required statuses that haven't been "+
+				"reported. Not merging.", issue.FullName())}
+		}
+	}
+	if state != "success" {
+		log.Printf("PR #%d has pending and/or failed statuses. Not merging.\n", issue.Number)
+		if state == "pending" {
+			reportQueuedStatus(conf, pr, statuses, issues, pullRequests, repositories)
+		} else {
+			reportMergeStatus(conf, pr, "blocked: failing statuses", statuses, repositories)
+		}
+		return SuccessResponse{fmt.Sprintf("PR %s has %s statuses. Not merging.", issue.FullName(), state)}
+	}
+	blocker, errResp := mergeabilityBlocker(conf, pr, store, issues, pullRequests, repositories, graphQL)
+	if errResp != nil {
+		return errResp
+	} else if blocker != nil {
+		reason := blocker.Reason
+		reportMergeStatus(conf, pr, blockerStatusDescription(*blocker), statuses, repositories)
+		log.Printf("PR %s is not ready to be merged: %s. Not merging.\n", issue.FullName(), reason)
+		reported, errResp := reportRefusal(conf, *blocker, pr, store, issues)
+		if errResp != nil {
+			return errResp
+		}
+		if reportBlocked && !reported {
+			message := fmt.Sprintf("I'm not merging this PR yet, because %s.", reason)
+			if err := stickyComment(conf, message, issue, store, issues); err != nil {
+				errorMessage := fmt.Sprintf("Failed to report why PR %s is not being merged", issue.FullName())
+				return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+			}
+		}
+		return SuccessResponse{fmt.Sprintf("Not merging PR %s, because %s", issue.FullName(), reason)}
 	}
-	if errResp = mergeReadyPR(pr, gitRepos, issues, pullRequests); errResp != nil {
+	if confirmed, errResp := checkTwoPersonConfirmation(conf, pr, store, issues, repositories,
+		graphQL); errResp != nil {
 		return errResp
+	} else if !confirmed {
+		reportMergeStatus(conf, pr, "waiting on a second maintainer's confirmation", statuses, repositories)
+		return SuccessResponse{fmt.Sprintf("Waiting for a second maintainer to confirm merging PR %s",
+			issue.FullName())}
 	}
-	return SuccessResponse{fmt.Sprintf("Successfully merged PR %s", issueComment.Issue().FullName())}
+	conf, errResp = withReactionConfirmation(conf, pr, store, graphQL)
+	if errResp != nil {
+		return errResp
+	}
+	errResp = mergeReadyPR(conf, pr, gitRepos, store, issues, pullRequests, repositories, graphQL)
+	if errResp != nil {
+		return errResp
+	} else if needsSoftFailConfirmation(conf, pr) {
+		reportMergeStatus(conf, pr, "waiting on a !confirm", statuses, repositories)
+		return SuccessResponse{fmt.Sprintf("Waiting for a confirmation to merge PR %s", issue.FullName())}
+	} else if conf.NativeMergeQueue {
+		reportMergeStatus(conf, pr, "in GitHub's merge queue", statuses, repositories)
+		return SuccessResponse{fmt.Sprintf("Added PR %s to GitHub's merge queue", issue.FullName())}
+	} else if conf.MergeStrategy == MergeStrategyVerifiedRebase {
+		reportMergeStatus(conf, pr, "validating", statuses, repositories)
+		return SuccessResponse{fmt.Sprintf("Validating PR %s before merging it", issue.FullName())}
+	}
+	return SuccessResponse{fmt.Sprintf("Successfully merged PR %s", issue.FullName())}
 }
 
-func mergeReadyPR(pr *github.PullRequest, gitRepos git.Repos, issues Issues,
-	pullRequests PullRequests) *ErrorResponse {
+// mergeIfLabeled merges the PR, if it's ready and it's (still) labeled for
+// merging.
+func mergeIfLabeled(conf Config, issue Issue, store Store, issues Issues, pullRequests PullRequests,
+	repositories Repositories, graphQL GraphQL, gitRepos git.Repos) Response {
+	labels, errResp := getLabels(issue, issues)
+	if errResp != nil {
+		return errResp
+	} else if !containsLabel(labels, MergingLabel) {
+		return SuccessResponse{fmt.Sprintf("PR %s is no longer labeled with '%s'. Ignoring.", issue.FullName(),
+			MergingLabel)}
+	}
+	return mergeIfReady(conf, issue, false, store, issues, pullRequests, repositories, graphQL, gitRepos)
+}
+
+// mergeabilityBlocker returns the rule that's blocking a PR with successful
+// statuses from being merged or nil, if nothing is blocking the PR. If the PR
+// is blocked by a merge freeze, it's deferred to be merged once the freeze
+// ends.
+func mergeabilityBlocker(conf Config, pr *github.PullRequest, store Store, issues Issues,
+	pullRequests PullRequests, repositories Repositories, graphQL GraphQL) (*evaluator.Node, *ErrorResponse) {
+
+	rules := mergeabilityRules(conf, pr, store, issues, pullRequests, repositories, graphQL)
+	decision, errResp := evaluate(rules, false)
+	if errResp != nil {
+		return nil, errResp
+	}
+	blocker := decision.Blocker()
+	if blocker != nil && blocker.Rule == mergeFreezeRule {
+		if errResp = deferMerge(prIssue(pr), store); errResp != nil {
+			return nil, errResp
+		}
+	}
+	return blocker, nil
+}
+
+// needsSoftFailConfirmation reports whether merging the PR has to be
+// confirmed, because the repository is in its soft-fail period. A second
+// maintainer's confirmation of a two-person merge counts as the confirmation.
+func needsSoftFailConfirmation(conf Config, pr *github.PullRequest) bool {
+	return conf.SoftFail && !requiresTwoPersonMerge(conf, *pr.Base.Ref)
+}
+
+// withReactionConfirmation returns the configuration to merge the PR with,
+// which doesn't hold the merge back for a confirmation, if the merge has been
+// confirmed with a reaction.
+func withReactionConfirmation(conf Config, pr *github.PullRequest, store Store,
+	graphQL GraphQL) (Config, *ErrorResponse) {
+
+	if !needsSoftFailConfirmation(conf, pr) {
+		return conf, nil
+	}
+	_, confirmed, errResp := confirmedWithReaction(conf, prIssue(pr), confirmMergeAction, store, graphQL)
+	if errResp != nil {
+		return conf, errResp
+	} else if confirmed {
+		// The confirmation is only for this action
+		conf.SoftFail = false
+	}
+	return conf, nil
+}
+
+// mergeReadyPR merges the PR with the configured strategy. With the
+// verified-rebase strategy, the PR is only validated here and merged once
+// the validation succeeds. With GitHub's native merge queue, the PR is added
+// to the queue instead. In the soft-fail period, a confirmation is asked for
+// instead. Two-person merges are expected to have been confirmed already.
+func mergeReadyPR(conf Config, pr *github.PullRequest, gitRepos git.Repos, store Store, issues Issues,
+	pullRequests PullRequests, repositories Repositories, graphQL GraphQL) *ErrorResponse {
 	issue := prIssue(pr)
-	err := merge(issue.Repository, issue.Number, pullRequests)
+	if needsSoftFailConfirmation(conf, pr) {
+		return requestConfirmation(conf, issue, confirmMergeAction, "", store, issues)
+	}
+	if conf.MergeTrain && conf.MergeStrategy == MergeStrategyVerifiedRebase && !conf.NativeMergeQueue {
+		unlockTrain, lockErrResp := lockMergeTrain(issue.Repository, *pr.Base.Ref)
+		if lockErrResp != nil {
+			return lockErrResp
+		}
+		defer unlockTrain()
+	}
+	unlock, lockErrResp := lockPR(pr)
+	if lockErrResp != nil {
+		return lockErrResp
+	}
+	defer unlock()
+	if err := runPreMergeHooks(conf.PreMergeHooks, pr, gitRepos); git.IsDiskFull(err) {
+		return reportDiskFull(conf, pr, err, store, issues)
+	} else if err != nil {
+		if conf.PreMergeHooksBlock {
+			return handlePreMergeHookFailure(conf, issue, err, issues)
+		}
+		log.Printf("Ignoring the failed pre-merge hook for PR %s: %v\n", issue.FullName(), err)
+	}
+	if conf.NativeMergeQueue {
+		return enqueuePR(pr, store, graphQL)
+	} else if conf.MergeStrategy == MergeStrategyVerifiedRebase {
+		return startValidation(conf, pr, gitRepos, store, issues, pullRequests, repositories)
+	} else if conf.MergeStrategy == MergeStrategyFastForward {
+		return fastForwardPR(conf, pr, gitRepos, store, issues, pullRequests, repositories, graphQL)
+	}
+	method, err := store.MergeMethod(issue)
+	if err != nil {
+		message := fmt.Sprintf("Failed to get the merge method of PR %s", issue.FullName())
+		return &ErrorResponse{err, http.StatusInternalServerError, message}
+	}
+	givenMessage, err := store.MergeMessage(issue)
+	if err != nil {
+		message := fmt.Sprintf("Failed to get the merge message of PR %s", issue.FullName())
+		return &ErrorResponse{err, http.StatusInternalServerError, message}
+	}
+	// Merge commits can fall back to squashing, if the base branch requires
+	// a linear history
+	var message commitMessage
+	if method != mergeMethodRebase {
+		var errResp *ErrorResponse
+		if message, errResp = squashCommitMessage(conf, pr, givenMessage, pullRequests); errResp != nil {
+			return errResp
+		}
+	}
+	mergeSHA, linearMethod, err := mergeWithLinearHistory(conf, pr, githubMergeMethod(method), message,
+		pullRequests, repositories)
 	if err == ErrMergeConflict {
-		return handleMergeConflict(issue, issues)
+		return resolveMergeConflict(conf, pr, gitRepos, store, issues, pullRequests)
+	} else if err == ErrBaseBranchModified {
+		message := fmt.Sprintf("The base branch of PR %s was modified while merging it", issue.FullName())
+		return &ErrorResponse{err, http.StatusBadGateway, message}
 	} else if err != nil {
+		sendNotification(conf, NotificationEvent{
+			Type:    FailureEvent,
+			Issue:   issue,
+			Message: fmt.Sprintf("Merging failed: %v", err),
+		})
 		message := fmt.Sprintf("Failed to merge PR %s", issue.FullName())
 		return &ErrorResponse{err, http.StatusBadGateway, message}
+	} else if linearMethod != "" {
+		message := fmt.Sprintf("I used %s instead of a merge commit, because `%s` requires a linear history.",
+			mergeMethodNames[linearMethod], *pr.Base.Ref)
+		if err = comment(message, issue.Repository, issue.Number, issues); err != nil {
+			log.Printf("Failed to explain the merge method of PR %s: %v\n", issue.FullName(), err)
+		}
 	}
 	log.Printf(
 		"PR %s successfully merged. Removing the '%s' label.\n",
@@ -84,30 +564,67 @@ func mergeReadyPR(pr *github.PullRequest, gitRepos git.Repos, issues Issues,
 	if isAcrossForks(pr) {
 		log.Printf("PR %s is across forks. Not removing the head branch.\n", issue.FullName())
 	} else {
+		restackStackedPRs(conf, issue.Repository, PullRequestBranch{SHA: pr.Head.GetSHA(), Ref: pr.Head.GetRef()},
+			pr.Base.GetRef(), gitRepos, issues, graphQL)
 		errResp = deleteRemoteBranch(pr, gitRepos)
 		if errResp != nil {
 			return errResp
 		}
 	}
+	if err := writeMergeReceipt(conf, pr, mergeSHA, pullRequests, repositories); err != nil {
+		failedMergeReceipts.Add(1)
+		log.Println(err)
+	}
+	if linearMethod != "" {
+		method = linearMethod
+	}
+	commentMergeOutcome(conf, pr, mergeSHA, githubMergeMethod(method), store, issues)
+	sendNotification(conf, NotificationEvent{
+		Type:    MergeEvent,
+		Issue:   issue,
+		Message: fmt.Sprintf("Merged into `%s`.", *pr.Base.Ref),
+	})
+	publishEvent(conf, BusEvent{
+		Type:        MergeCompletedEvent,
+		Repository:  repositoryKey(issue.Repository),
+		PullRequest: issue.Number,
+		SHA:         mergeSHA,
+	}, store)
+	notifyBaseBranchMerged(pr)
+	if err := addReleaseNote(conf, pr, issues, repositories); err != nil {
+		log.Printf("Failed to add PR %s to the release notes: %v\n", issue.FullName(), err)
+	}
+	if err := assignMilestone(conf, pr, issues); err != nil {
+		log.Printf("Failed to assign a milestone to PR %s: %v\n", issue.FullName(), err)
+	}
+	transitionJiraIssues(conf, pr)
+	if err := runPostMergeHooks(conf.PostMergeHooks, pr, gitRepos); err != nil {
+		message := fmt.Sprintf("PR %s was merged, but a post-merge hook failed", issue.FullName())
+		return &ErrorResponse{err, http.StatusInternalServerError, message}
+	}
 	return nil
 }
 
-func mergePullRequestsReadyForMerging(statusEvent StatusEvent, gitRepos git.Repos, search Search,
-	issues Issues, pullRequests PullRequests) asyncResponse {
-	// Not sure if applying the additional repo:owner/name filter to the query
-	// works for cross-fork PRs, but nothing else has been tested with
-	// cross-fork PRs either so this is left in for now.
+func mergePullRequestsReadyForMerging(conf Config, statusEvent StatusEvent, gitRepos git.Repos, store Store,
+	search Search, issues Issues, pullRequests PullRequests, repositories Repositories, graphQL GraphQL) asyncResponse {
+	// The repo:owner/name filter matches the base repository, so PRs from
+	// forks are found as well. Their statuses are reported to the base
+	// repository for the fork's head commit.
 	//
-	// Also, specifying the SHA for the search query doesn't guarantee that the
+	// Specifying the SHA for the search query doesn't guarantee that the
 	// SHA is the HEAD of the returned PRs. This means that, if the commit is
 	// in 2 different PRs, both of which have the "merging" label and have
 	// "success" status then it can happen that it will try to merge both.
 	// Which might not be intended, but is still okay, because both PRs do
 	// match all the criteria required for merging.
+	//
+	// The status:success filter also counts the bot's own merge status, so
+	// the statuses of the found PRs are checked again without it.
 	query := fmt.Sprintf(
-		"%s label:\"%s\" is:open repo:%s/%s status:success",
+		"%s label:\"%s\" -label:\"%s\" is:open repo:%s/%s status:success",
 		statusEvent.SHA,
 		MergingLabel,
+		OnHoldLabel,
 		statusEvent.Repository.Owner,
 		statusEvent.Repository.Name,
 	)
@@ -115,8 +632,6 @@ func mergePullRequestsReadyForMerging(statusEvent StatusEvent, gitRepos git.Repo
 	if err != nil {
 		message := fmt.Sprintf("Searching for issues with query '%s' failed", query)
 		return nonRetriable(ErrorResponse{err, http.StatusBadGateway, message})
-	} else if len(issuesToMerge) == 0 {
-		return retriable(SuccessResponse{"Found no PRs to merge"})
 	}
 
 	var finalErrResp *ErrorResponse
@@ -131,31 +646,164 @@ func mergePullRequestsReadyForMerging(statusEvent StatusEvent, gitRepos git.Repo
 		}
 	}
 
-	for _, issueToMerge := range issuesToMerge {
-		issue := Issue{
-			Number:     *issueToMerge.Number,
-			Repository: statusEvent.Repository,
-			User: User{
-				Login: *issueToMerge.User.Login,
-			},
+	var prs []*github.PullRequest
+	if len(issuesToMerge) == 0 {
+		// The search index lags behind label changes, so the labeled PRs
+		// are listed instead, if there are any
+		fallbackPRs, errResp := labeledPRsWithHead(statusEvent, store, issues, pullRequests, repositories)
+		if errResp != nil {
+			return nonRetriable(errResp)
+		} else if len(fallbackPRs) == 0 {
+			return retriable(SuccessResponse{"Found no PRs to merge"})
+		}
+		prs = fallbackPRs
+	} else {
+		var errResps []*ErrorResponse
+		prs, errResps = getPRsConcurrently(searchResultIssues(issuesToMerge, statusEvent.Repository), pullRequests)
+		for _, errResp := range errResps {
+			handleErrResp(errResp)
+		}
+		prs = withSuccessfulStatuses(prs, repositories, handleErrResp)
+	}
+	merging := make(map[string]int)
+	// The PRs that were blocked, skipped or failed to merge aren't counted
+	merged := 0
+	for _, pr := range prs {
+		issue := prIssue(pr)
+		// PRs with the same head and base would all be merged as the first
+		// one of them
+		key := pr.Head.GetSHA() + " " + pr.Base.GetRef()
+		if number, isDuplicate := merging[key]; isDuplicate {
+			log.Printf("PR %s has the same head and base as #%d. Not merging it separately.\n",
+				issue.FullName(), number)
+			continue
 		}
-		pr, errResp := getPR(issue, pullRequests)
+		merging[key] = issue.Number
+		// An approval may have been dismissed after new commits were pushed,
+		// for example, in which case the successful status is not enough to
+		// merge the PR.
+		blocker, errResp := mergeabilityBlocker(conf, pr, store, issues, pullRequests, repositories, graphQL)
 		if errResp != nil {
 			handleErrResp(errResp)
 			continue
+		} else if blocker != nil {
+			log.Printf("PR %s is not ready to be merged: %s. Not merging.\n", issue.FullName(), blocker.Reason)
+			if _, errResp = reportRefusal(conf, *blocker, pr, store, issues); errResp != nil {
+				handleErrResp(errResp)
+			}
+			continue
 		}
-		if errResp := mergeReadyPR(pr, gitRepos, issues, pullRequests); errResp != nil {
+		if confirmed, errResp := checkTwoPersonConfirmation(conf, pr, store, issues, repositories,
+			graphQL); errResp != nil {
 			handleErrResp(errResp)
+			continue
+		} else if !confirmed {
+			log.Printf("PR %s is waiting for a second maintainer's confirmation. Not merging.\n", issue.FullName())
+			continue
+		}
+		conf, errResp := withReactionConfirmation(conf, pr, store, graphQL)
+		if errResp != nil {
+			handleErrResp(errResp)
+			continue
+		}
+		errResp = mergeReadyPR(conf, pr, gitRepos, store, issues, pullRequests, repositories, graphQL)
+		if errResp != nil && errResp.Error == ErrBaseBranchModified {
+			response := retryIfBaseBranchModified(conf, issue, errResp, func() Response {
+				return tryMergeIfReady(conf, issue, false, store, issues, pullRequests, repositories, graphQL,
+					gitRepos)
+			})
+			if retryErrResp, isError := asErrorResponse(response); isError {
+				handleErrResp(&retryErrResp)
+			} else {
+				merged++
+			}
+		} else if errResp != nil {
+			handleErrResp(errResp)
+		} else {
+			merged++
 		}
 	}
 	if finalErrResp != nil {
 		return nonRetriable(finalErrResp)
 	}
 	return nonRetriable(
-		SuccessResponse{fmt.Sprintf("Successfully merged %d PRs", len(issuesToMerge))},
+		SuccessResponse{fmt.Sprintf("Successfully merged %d PRs", merged)},
 	)
 }
 
+// searchResultIssues converts the search results to the repository's issues.
+// Issues that moved between the pages of the results while paginating are
+// only included once.
+func searchResultIssues(searchResults []github.Issue, repository Repository) []Issue {
+	var result []Issue
+	seen := make(map[int]bool, len(searchResults))
+	for _, searchResult := range searchResults {
+		if seen[*searchResult.Number] {
+			continue
+		}
+		seen[*searchResult.Number] = true
+		result = append(result, Issue{
+			Number:     *searchResult.Number,
+			Repository: repository,
+			User: User{
+				Login: *searchResult.User.Login,
+			},
+		})
+	}
+	return result
+}
+
+// withSuccessfulStatuses returns the PRs whose heads' combined state, without
+// the bot's own merge status, is success.
+func withSuccessfulStatuses(prs []*github.PullRequest, repositories Repositories,
+	handleErrResp func(*ErrorResponse)) []*github.PullRequest {
+
+	var result []*github.PullRequest
+	for _, pr := range prs {
+		state, _, errResp := getStatuses(pr, repositories)
+		if errResp != nil {
+			handleErrResp(errResp)
+			continue
+		} else if state != "success" {
+			log.Printf("PR %s has %s statuses. Not merging.\n", prIssue(pr).FullName(), state)
+			continue
+		}
+		result = append(result, pr)
+	}
+	return result
+}
+
+// getPRsConcurrently fetches the PRs of the issues with at most
+// prFetchParallelism requests in flight. The PRs are returned in the order of
+// the issues, leaving out the ones that couldn't be fetched.
+func getPRsConcurrently(issues []Issue, pullRequests PullRequests) ([]*github.PullRequest, []*ErrorResponse) {
+	prs := make([]*github.PullRequest, len(issues))
+	errResps := make([]*ErrorResponse, len(issues))
+	semaphore := make(chan struct{}, prFetchParallelism)
+	var wg sync.WaitGroup
+	for i, issue := range issues {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, issue Issue) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			prs[i], errResps[i] = getPR(issue, pullRequests)
+		}(i, issue)
+	}
+	wg.Wait()
+
+	var fetched []*github.PullRequest
+	var failed []*ErrorResponse
+	for i := range issues {
+		if errResps[i] != nil {
+			failed = append(failed, errResps[i])
+		} else {
+			fetched = append(fetched, prs[i])
+		}
+	}
+	return fetched, failed
+}
+
 func containsPendingSquashStatus(statuses []github.RepoStatus) bool {
 	for _, status := range statuses {
 		if *status.Context == githubStatusSquashContext && *status.State == "pending" {
@@ -174,7 +822,33 @@ func isStatusForBranchHead(statusEvent StatusEvent) bool {
 	return false
 }
 
-func handleMergeConflict(issue Issue, issues Issues) *ErrorResponse {
+// resolveMergeConflict rebuilds the branch of a conflicting backport,
+// cherry-pick or revert PR the bot has opened on top of the latest base. Only
+// if that doesn't resolve the conflict, are humans asked for help. For such
+// PRs, that's the author of the PR the branch was created for.
+func resolveMergeConflict(conf Config, pr *github.PullRequest, gitRepos git.Repos, store Store, issues Issues,
+	pullRequests PullRequests) *ErrorResponse {
+
+	issue := prIssue(pr)
+	sourcePR, rebuilt, err := rebuildBotBranch(pr, gitRepos, store, pullRequests)
+	if err != nil {
+		log.Printf("Failed to rebuild the branch of PR %s: %v\n", issue.FullName(), err)
+	} else if rebuilt {
+		message := fmt.Sprintf("This PR conflicted with `%s`, so I recreated it from scratch on top of the "+
+			"latest `%s`.", *pr.Base.Ref, *pr.Base.Ref)
+		if err = comment(message, issue.Repository, issue.Number, issues); err != nil {
+			errorMessage := fmt.Sprintf("Failed to report the rebuilt branch of PR %s", issue.FullName())
+			return &ErrorResponse{err, http.StatusBadGateway, errorMessage}
+		}
+		return nil
+	}
+	if sourcePR != nil {
+		issue.User = User{Login: *sourcePR.User.Login}
+	}
+	return handleMergeConflict(conf, issue, store, issues)
+}
+
+func handleMergeConflict(conf Config, issue Issue, store Store, issues Issues) *ErrorResponse {
 	log.Printf(
 		"Merging PR %s failed due to a merge conflict. Removing the '%s' label and notifying the author.\n",
 		issue.FullName(),
@@ -188,9 +862,23 @@ func handleMergeConflict(issue Issue, issues Issues) *ErrorResponse {
 			removeLabelErrResp.Error,
 		)
 	}
-	message := fmt.Sprintf("I'm unable to merge this PR because of a merge conflict."+
-		" @%s, can you please take a look?", issue.User.Login)
-	err := comment(message, issue.Repository, issue.Number, issues)
+	publishEvent(conf, BusEvent{
+		Type:        ConflictDetectedEvent,
+		Repository:  repositoryKey(issue.Repository),
+		PullRequest: issue.Number,
+	}, store)
+	sendNotification(conf, NotificationEvent{
+		Type:    ConflictEvent,
+		Issue:   issue,
+		Message: fmt.Sprintf("Not merged because of a merge conflict. Waiting for @%s to take a look.", issue.User.Login),
+	})
+	message := renderMessage(conf, mergeConflictMessage, MessageData{
+		Repository: issue.Repository,
+		PR:         issue.Number,
+		Author:     issue.User.Login,
+		Version:    version,
+	})
+	err := stickyComment(conf, message, issue, store, issues)
 	if err != nil {
 		errorMessage := fmt.Sprintf(
 			"Failed to notify the author of PR %s about the merge conflict",
@@ -212,7 +900,7 @@ func deleteRemoteBranch(pr *github.PullRequest, gitRepos git.Repos) *ErrorRespon
 	gitRepo, err := gitRepos.GetUpdatedRepo(repository.URL, repository.Owner, repository.Name)
 	if err != nil {
 		message := fmt.Sprintf("Failed to get an updated repo for PR %s", prFullName(pr))
-		return &ErrorResponse{err, http.StatusInternalServerError, message}
+		return &ErrorResponse{err, gitErrorCode(err), message}
 	}
 	err = gitRepo.DeleteRemoteBranch(*pr.Head.Ref)
 	if err != nil {
@@ -221,7 +909,33 @@ func deleteRemoteBranch(pr *github.PullRequest, gitRepos git.Repos) *ErrorRespon
 			*pr.Head.Ref,
 			prFullName(pr),
 		)
-		return &ErrorResponse{err, http.StatusInternalServerError, message}
+		return &ErrorResponse{err, gitErrorCode(err), message}
 	}
 	return nil
 }
+
+// handleMergingLabeled starts merging a PR that was labeled with "merging"
+// directly, e.g. in GitHub's UI, the same way as if "!merge" was commented.
+// Labels added by the bot itself, e.g. in response to the "!merge" command,
+// or by BOT_LOGINS are ignored, because the command has already started the
+// merge.
+func handleMergingLabeled(conf Config, pullRequestEvent PullRequestEvent, gitRepos git.Repos, store Store,
+	issues Issues, pullRequests PullRequests, repositories Repositories, graphQL GraphQL) Response {
+
+	if pullRequestEvent.Label != MergingLabel {
+		return SuccessResponse{fmt.Sprintf("PR not labeled with '%s'. Ignoring.", MergingLabel)}
+	}
+	issue := pullRequestEvent.Issue()
+	// The PRs the bot labels itself, e.g. dependency updates, expire as well
+	trackMergeRequest(conf, issue, pullRequestEvent.Sender.Login, store)
+	if isBotLogin(conf, pullRequestEvent.Sender.Login) {
+		return SuccessResponse{"PR labeled by a bot. Ignoring."}
+	}
+	log.Printf("PR %s was labeled with '%s' by %s. Merging it once it's ready.\n", issue.FullName(),
+		MergingLabel, pullRequestEvent.Sender.Login)
+	errResp := requestTwoPersonConfirmation(conf, issue, pullRequestEvent.Sender.Login, store, issues, pullRequests)
+	if errResp != nil {
+		return errResp
+	}
+	return mergeIfReady(conf, issue, false, store, issues, pullRequests, repositories, graphQL, gitRepos)
+}
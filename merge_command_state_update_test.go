@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"time"
 
 	"github.com/google/go-github/github"
 	grh "github.com/salemove/github-review-helper"
@@ -26,6 +28,7 @@ var _ = TestWebhookHandler(func(context WebhookTestContext) {
 
 			responseRecorder *httptest.ResponseRecorder
 			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
 			issues           *mocks.Issues
 			search           *mocks.Search
 			gitRepos         *mocks.Repos
@@ -33,6 +36,7 @@ var _ = TestWebhookHandler(func(context WebhookTestContext) {
 		BeforeEach(func() {
 			responseRecorder = *context.ResponseRecorder
 			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
 			issues = *context.Issues
 			search = *context.Search
 			gitRepos = *context.GitRepos
@@ -64,6 +68,143 @@ var _ = TestWebhookHandler(func(context WebhookTestContext) {
 		Context("with success status", func() {
 			status := "success"
 
+			mockSearchQuery := func(pageNr int) *mock.Call {
+				searchQuery := fmt.Sprintf("%s label:\"%s\" -label:\"%s\" is:open repo:%s/%s status:success",
+					mockSHA, grh.MergingLabel, grh.OnHoldLabel, repositoryOwner, repositoryName)
+				return search.
+					On("Issues", anyContext, searchQuery, mock.MatchedBy(func(searchOptions *github.SearchOptions) bool {
+						return searchOptions.Page == pageNr
+					}))
+			}
+
+			Context("when updating a commit that is not on any branch", func() {
+				// Like the head commit of a PR from a fork
+				requestJSON.Is(func() string {
+					return createStatusEvent(mockSHA, status, []grh.Branch{})
+				})
+
+				BeforeEach(func() {
+					searchResult := &github.IssuesSearchResult{
+						Total:  github.Int(0),
+						Issues: []github.Issue{},
+					}
+					mockSearchQuery(1).Return(searchResult, &github.Response{}, noError)
+				})
+
+				It("searches for PRs to merge", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					search.AssertNumberOfCalls(GinkgoT(), "Issues", numberOfGithubTries)
+				})
+
+				Context("with STATUS_DEDUP_WINDOW set", func() {
+					BeforeEach(func() {
+						context.Config.StatusDedupWindow = time.Minute
+					})
+
+					It("ignores the same status repeated within the window", func() {
+						handle()
+						Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+
+						*context.ResponseRecorder = httptest.NewRecorder()
+						handle()
+						Expect((*context.ResponseRecorder).Code).To(Equal(http.StatusOK))
+						Expect((*context.ResponseRecorder).Body.String()).To(ContainSubstring("moments ago"))
+						search.AssertNumberOfCalls(GinkgoT(), "Issues", numberOfGithubTries)
+					})
+				})
+			})
+
+			Context("with MERGE_TRIGGER_CONTEXTS including the required contexts", func() {
+				statusEvent := func(statusContext string) string {
+					event := createStatusEvent(mockSHA, status, []grh.Branch{})
+					return strings.Replace(event, `"state": "success",`, `"state": "success",
+  "context": "`+statusContext+`",`, 1)
+				}
+				mockCombinedState := func(state string) {
+					BeforeEach(func() {
+						repositories.
+							On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, mockSHA,
+								mock.AnythingOfType("*github.ListOptions")).
+							Return(&github.CombinedStatus{State: github.String(state)}, emptyResponse, noError)
+					})
+				}
+				mockNoPRsFound := func() {
+					BeforeEach(func() {
+						searchResult := &github.IssuesSearchResult{
+							Total:  github.Int(0),
+							Issues: []github.Issue{},
+						}
+						mockSearchQuery(1).Return(searchResult, &github.Response{}, noError)
+						issues.
+							On("ListByRepo", anyContext, repositoryOwner, repositoryName,
+								mock.AnythingOfType("*github.IssueListByRepoOptions")).
+							Return([]*github.Issue{}, &github.Response{}, noError)
+					})
+				}
+
+				BeforeEach(func() {
+					context.Config.MergeTriggerContexts = []string{"required", "deploy"}
+					// The PR labeled for merging targets a release branch,
+					// whose protection requires other contexts than the
+					// default branch's
+					Expect((*context.Store).AddMergeRequest(grh.MergeRequest{
+						Issue: grh.Issue{Number: issueNumber, Repository: trackedRepository},
+					})).To(Succeed())
+					pullRequests.
+						On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+						Return(&github.PullRequest{
+							Number: github.Int(issueNumber),
+							Base:   &github.PullRequestBranch{Ref: github.String("release")},
+							Head:   &github.PullRequestBranch{SHA: github.String(mockSHA)},
+						}, emptyResponse, noError)
+					repositories.
+						On("GetRequiredStatusChecks", anyContext, repositoryOwner, repositoryName, "release").
+						Return(&github.RequiredStatusChecks{Contexts: []string{"ci"}}, emptyResponse, noError)
+				})
+
+				Context("with a status for a context the PR's base branch requires", func() {
+					requestJSON.Is(func() string {
+						return statusEvent("ci")
+					})
+					mockCombinedState("pending")
+					mockNoPRsFound()
+
+					It("searches for PRs to merge", func() {
+						handle()
+						Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+						search.AssertCalled(GinkgoT(), "Issues", anyContext, mock.Anything, mock.Anything)
+					})
+				})
+
+				Context("with a status for a context that doesn't gate merging", func() {
+					requestJSON.Is(func() string {
+						return statusEvent("lint")
+					})
+
+					Context("with other statuses still pending", func() {
+						mockCombinedState("pending")
+
+						It("doesn't search for PRs to merge", func() {
+							handle()
+							Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+							search.AssertNotCalled(GinkgoT(), "Issues", anyContext, mock.Anything, mock.Anything)
+						})
+					})
+
+					Context("with the combined state having become successful", func() {
+						mockCombinedState("success")
+						mockNoPRsFound()
+
+						It("searches for PRs to merge", func() {
+							handle()
+							Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+							search.AssertCalled(GinkgoT(), "Issues", anyContext, mock.Anything, mock.Anything)
+						})
+					})
+				})
+			})
+
 			Context("when updating a commit that is not a branch's head", func() {
 				otherSHA := "4eaf26faa8819ab5aee991461b8c4fff41778f41"
 				branches := []grh.Branch{{
@@ -89,14 +230,12 @@ var _ = TestWebhookHandler(func(context WebhookTestContext) {
 					return createStatusEvent(mockSHA, status, branches)
 				})
 
-				mockSearchQuery := func(pageNr int) *mock.Call {
-					searchQuery := fmt.Sprintf("%s label:\"%s\" is:open repo:%s/%s status:success",
-						mockSHA, grh.MergingLabel, repositoryOwner, repositoryName)
-					return search.
-						On("Issues", anyContext, searchQuery, mock.MatchedBy(func(searchOptions *github.SearchOptions) bool {
-							return searchOptions.Page == pageNr
-						}))
-				}
+				BeforeEach(func() {
+					repositories.
+						On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, mock.Anything,
+							mock.AnythingOfType("*github.ListOptions")).
+						Return(&github.CombinedStatus{State: github.String("success")}, emptyResponse, noError)
+				})
 
 				Context("with issue search failing", func() {
 					BeforeEach(func() {
@@ -132,6 +271,52 @@ var _ = TestWebhookHandler(func(context WebhookTestContext) {
 						handle()
 						search.AssertNumberOfCalls(GinkgoT(), "Issues", numberOfGithubTries)
 					})
+
+					Context("with the search missing a PR labeled for merging", func() {
+						issueNumber := 7331
+						pr := &github.PullRequest{
+							Number: github.Int(issueNumber),
+							Base: &github.PullRequestBranch{
+								Ref:  github.String("master"),
+								Repo: repository,
+							},
+							Head: &github.PullRequestBranch{
+								SHA:  github.String(mockSHA),
+								Ref:  github.String("feature"),
+								Repo: repository,
+							},
+							User: &github.User{
+								Login: github.String("bestcoder"),
+							},
+						}
+
+						BeforeEach(func() {
+							Expect((*context.Store).AddMergeRequest(grh.MergeRequest{
+								Issue: grh.Issue{
+									Number:     issueNumber,
+									Repository: grh.Repository{Owner: repositoryOwner, Name: repositoryName},
+								},
+							})).To(Succeed())
+							issues.
+								On("ListByRepo", anyContext, repositoryOwner, repositoryName,
+									mock.AnythingOfType("*github.IssueListByRepoOptions")).
+								Return([]*github.Issue{{
+									Number:           github.Int(issueNumber),
+									PullRequestLinks: &github.PullRequestLinks{},
+								}}, &github.Response{}, noError)
+							pullRequests.
+								On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+								Return(pr, emptyResponse, noError)
+							repositories.
+								On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, mockSHA,
+									mock.AnythingOfType("*github.ListOptions")).
+								Return(&github.CombinedStatus{State: github.String("success")}, emptyResponse,
+									noError)
+							mockLabels(issues, issueNumber, grh.MergingLabel)
+						})
+
+						ItMergesPR(context, pr)
+					})
 				})
 
 				Context("with issue search returning a PR", func() {
@@ -177,6 +362,7 @@ var _ = TestWebhookHandler(func(context WebhookTestContext) {
 								Repo: repository,
 							},
 							Head: &github.PullRequestBranch{
+								SHA:  github.String(mockSHA),
 								Ref:  github.String("feature"),
 								Repo: repository,
 							},
@@ -189,6 +375,7 @@ var _ = TestWebhookHandler(func(context WebhookTestContext) {
 							pullRequests.
 								On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
 								Return(pr, emptyResponse, noError)
+							mockLabels(issues, issueNumber, grh.MergingLabel)
 						})
 
 						ItMergesPR(context, pr)
@@ -201,9 +388,7 @@ var _ = TestWebhookHandler(func(context WebhookTestContext) {
 					firstAuthor := "me"
 					secondAuthor := "you"
 
-					expectMerge := func(number int, author string) {
-						// Fetch PR
-						headRef := "feature"
+					expectFetch := func(number int, author, headSHA string) {
 						pr := &github.PullRequest{
 							Number: github.Int(number),
 							Base: &github.PullRequestBranch{
@@ -211,7 +396,8 @@ var _ = TestWebhookHandler(func(context WebhookTestContext) {
 								Repo: repository,
 							},
 							Head: &github.PullRequestBranch{
-								Ref:  github.String(headRef),
+								SHA:  github.String(headSHA),
+								Ref:  github.String("feature"),
 								Repo: repository,
 							},
 							User: &github.User{
@@ -222,6 +408,11 @@ var _ = TestWebhookHandler(func(context WebhookTestContext) {
 							On("Get", anyContext, repositoryOwner, repositoryName, number).
 							Return(pr, emptyResponse, noError).
 							Once()
+					}
+					expectMerge := func(number int, author, headSHA string) {
+						expectFetch(number, author, headSHA)
+						headRef := "feature"
+						mockLabels(issues, number, grh.MergingLabel)
 						// Merge
 						additionalCommitMessage := ""
 						pullRequests.
@@ -276,11 +467,48 @@ var _ = TestWebhookHandler(func(context WebhookTestContext) {
 					})
 
 					It("it merges both PRs and removes the 'merging' label from both PRs after the merge", func() {
-						expectMerge(firstIssueNumber, firstAuthor)
-						expectMerge(secondIssueNumber, secondAuthor)
+						expectMerge(firstIssueNumber, firstAuthor, mockSHA)
+						expectMerge(secondIssueNumber, secondAuthor, "8d2b1cbe1ad8f0c0c5c1b24c0f6c0fa9c7d4e2a1")
+
+						handle()
+						Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+						Expect(responseRecorder.Body.String()).To(ContainSubstring("Successfully merged 2 PRs"))
+					})
+
+					It("merges only the first of the PRs with the same head and base", func() {
+						expectMerge(firstIssueNumber, firstAuthor, mockSHA)
+						expectFetch(secondIssueNumber, secondAuthor, mockSHA)
 
 						handle()
 						Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+						Expect(responseRecorder.Body.String()).To(ContainSubstring("Successfully merged 1 PRs"))
+						pullRequests.AssertNumberOfCalls(GinkgoT(), "Merge", 1)
+					})
+				})
+
+				Context("with issue search returning the same PR on 2 pages", func() {
+					BeforeEach(func() {
+						searchResult := &github.IssuesSearchResult{
+							Total: github.Int(1),
+							Issues: []github.Issue{{
+								Number: github.Int(561),
+								User: &github.User{
+									Login: github.String("me"),
+								},
+							}},
+						}
+						mockSearchQuery(1).Return(searchResult, &github.Response{NextPage: 2}, noError)
+						mockSearchQuery(2).Return(searchResult, &github.Response{}, noError)
+						pullRequests.
+							On("Get", anyContext, repositoryOwner, repositoryName, 561).
+							Return(emptyResult, emptyResponse, errArbitrary).
+							Once()
+					})
+
+					It("fetches the PR once", func() {
+						handle()
+						Expect(responseRecorder.Code).To(Equal(http.StatusBadGateway))
+						pullRequests.AssertNumberOfCalls(GinkgoT(), "Get", 1)
 					})
 				})
 			})
@@ -202,9 +202,160 @@ var _ = TestWebhookHandler(func(context WebhookTestContext) {
 								Return(&github.CombinedStatus{
 									State: github.String("success"),
 								}, emptyResponse, noError)
+							mockLabels(issues, issueNumber, grh.MergingLabel)
 						})
 
 						ItMergesPR(context, pr)
+
+						Context("with merge failing, because the base branch was modified", func() {
+							BeforeEach(func() {
+								context.Config.MergeBaseModifiedRetries = 2
+
+								additionalCommitMessage := ""
+								resp := &http.Response{
+									StatusCode: http.StatusMethodNotAllowed,
+								}
+								pullRequests.
+									On(
+										"Merge",
+										anyContext,
+										repositoryOwner,
+										repositoryName,
+										issueNumber,
+										additionalCommitMessage,
+										noSquashOpts,
+									).
+									Return(emptyResult, &github.Response{
+										Response: resp,
+									}, &github.ErrorResponse{
+										Response: resp,
+										Message:  "Base branch was modified. Review and try the merge again.",
+									})
+							})
+
+							It("evaluates the PR and tries merging it again up to the configured times", func() {
+								handle()
+								Expect(responseRecorder.Code).To(Equal(http.StatusBadGateway))
+								pullRequests.AssertNumberOfCalls(GinkgoT(), "Merge", 3)
+							})
+						})
+
+						Context("with the repository not allowing merge commits", func() {
+							BeforeEach(func() {
+								resp := &http.Response{
+									StatusCode: http.StatusMethodNotAllowed,
+								}
+								pullRequests.
+									On("Merge", anyContext, repositoryOwner, repositoryName, issueNumber, "",
+										noSquashOpts).
+									Return(emptyResult, &github.Response{
+										Response: resp,
+									}, &github.ErrorResponse{
+										Response: resp,
+										Message:  "Merge commits are not allowed on this repository.",
+									})
+							})
+
+							It("doesn't fall back to another merge method", func() {
+								handle()
+								pullRequests.AssertNumberOfCalls(GinkgoT(), "Merge", 1)
+								repositories.AssertNotCalled(GinkgoT(), "Get", anyContext, repositoryOwner,
+									repositoryName)
+							})
+						})
+
+						Context("with the base branch requiring linear history", func() {
+							additionalCommitMessage := ""
+							BeforeEach(func() {
+								resp := &http.Response{
+									StatusCode: http.StatusMethodNotAllowed,
+								}
+								pullRequests.
+									On(
+										"Merge",
+										anyContext,
+										repositoryOwner,
+										repositoryName,
+										issueNumber,
+										additionalCommitMessage,
+										noSquashOpts,
+									).
+									Return(emptyResult, &github.Response{
+										Response: resp,
+									}, &github.ErrorResponse{
+										Response: resp,
+										Message:  "This branch must not contain merge commits.",
+									})
+								repositories.
+									On("Get", anyContext, repositoryOwner, repositoryName).
+									Return(&github.Repository{
+										AllowRebaseMerge: github.Bool(true),
+										AllowSquashMerge: github.Bool(true),
+									}, emptyResponse, noError)
+								pullRequests.
+									On(
+										"Merge",
+										anyContext,
+										repositoryOwner,
+										repositoryName,
+										issueNumber,
+										additionalCommitMessage,
+										&github.PullRequestOptions{MergeMethod: "rebase"},
+									).
+									Return(&github.PullRequestMergeResult{
+										Merged: github.Bool(true),
+									}, emptyResponse, noError)
+								issues.
+									On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+										mock.MatchedBy(commentContaining("requires a linear history"))).
+									Return(emptyResult, emptyResponse, noError)
+								issues.
+									On("RemoveLabelForIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+										grh.MergingLabel).
+									Return(emptyResponse, errArbitrary)
+							})
+
+							Context("without merge commits of its own", func() {
+								BeforeEach(func() {
+									mockListCommits(githubCommits(commit{headSHA, "Add a feature"}), 100,
+										repositoryOwner, repositoryName, issueNumber, pullRequests)
+								})
+
+								It("rebases and merges the PR instead and explains why", func() {
+									handle()
+									pullRequests.AssertNumberOfCalls(GinkgoT(), "Merge", 2)
+									issues.AssertCalled(GinkgoT(), "CreateComment", anyContext, repositoryOwner,
+										repositoryName, issueNumber, mock.MatchedBy(commentContaining("rebase merging")))
+								})
+							})
+
+							Context("with a merge commit of its own", func() {
+								BeforeEach(func() {
+									commits := githubCommits(commit{"1234abc", "Add a feature"},
+										commit{headSHA, "Merge master into feature"})
+									commits[1].Parents = append(commits[1].Parents,
+										github.Commit{SHA: github.String(arbitraryParentSHA)})
+									mockListCommits(commits, 100, repositoryOwner, repositoryName, issueNumber,
+										pullRequests)
+									pullRequests.
+										On("Merge", anyContext, repositoryOwner, repositoryName, issueNumber,
+											additionalCommitMessage, &github.PullRequestOptions{MergeMethod: "squash"}).
+										Return(&github.PullRequestMergeResult{
+											Merged: github.Bool(true),
+										}, emptyResponse, noError)
+								})
+
+								It("squashes and merges the PR instead, because rebasing wouldn't be linear", func() {
+									handle()
+									pullRequests.AssertCalled(GinkgoT(), "Merge", anyContext, repositoryOwner,
+										repositoryName, issueNumber, additionalCommitMessage,
+										&github.PullRequestOptions{MergeMethod: "squash"})
+									pullRequests.AssertNotCalled(GinkgoT(), "Merge", anyContext, repositoryOwner,
+										repositoryName, issueNumber, additionalCommitMessage,
+										&github.PullRequestOptions{MergeMethod: "rebase"})
+								})
+							})
+						})
 					})
 				})
 			})
@@ -213,8 +364,12 @@ var _ = TestWebhookHandler(func(context WebhookTestContext) {
 })
 
 func commentMentioning(user string) func(issueComment *github.IssueComment) bool {
+	return commentContaining("@" + user)
+}
+
+func commentContaining(text string) func(issueComment *github.IssueComment) bool {
 	return func(issueComment *github.IssueComment) bool {
-		return strings.Contains(*issueComment.Body, "@"+user)
+		return strings.Contains(*issueComment.Body, text)
 	}
 }
 
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+var mergeMessageUnescaper = strings.NewReplacer(`\\`, `\`, `\"`, `"`, `\n`, "\n")
+
+// commitMessage is the message of the commit merging a PR creates. An empty
+// Title keeps GitHub's default title, e.g. the PR's title for squash merges,
+// and an empty Body GitHub's default body.
+type commitMessage struct {
+	Title string
+	Body  string
+}
+
+// splitCommitMessage splits a message given with "!merge --message" into
+// the commit's title, which is its first line, and body.
+func splitCommitMessage(message string) commitMessage {
+	lines := strings.SplitN(strings.TrimSpace(message), "\n", 2)
+	if len(lines) == 1 {
+		return commitMessage{Title: lines[0]}
+	}
+	return commitMessage{Title: strings.TrimSpace(lines[0]), Body: strings.TrimSpace(lines[1])}
+}
+
+// chooseMergeMessage records the commit message given in the merge command
+// for the PR, after checking that the PR's merge creates a commit and that
+// the message follows COMMIT_MESSAGE_RULE. A merge command without a message
+// forgets the earlier one. Returns nil, if the merge can go ahead.
+func chooseMergeMessage(conf Config, issueComment IssueComment, arguments mergeArguments, store Store,
+	issues Issues) Response {
+
+	issue := issueComment.Issue()
+	if arguments.Message != "" {
+		reason := mergeMessageRefusal(conf, arguments)
+		if reason != "" {
+			log.Printf("Not merging PR %s with the given message, because %s.\n", issue.FullName(), reason)
+			message := fmt.Sprintf("@%s, I can't merge this PR with that message, because %s.",
+				issueComment.Commenter.Login, reason)
+			if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+				errorMessage := fmt.Sprintf("Failed to report the refused merge message on PR %s",
+					issue.FullName())
+				return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+			}
+			return SuccessResponse{fmt.Sprintf("Not merging PR %s with the given message, because %s",
+				issue.FullName(), reason)}
+		}
+	}
+	if err := store.SetMergeMessage(issue, arguments.Message); err != nil {
+		message := fmt.Sprintf("Failed to record the merge message of PR %s", issue.FullName())
+		return ErrorResponse{err, http.StatusInternalServerError, message}
+	}
+	return nil
+}
+
+// mergeMessageRefusal returns the reason why the PR can't be merged with the
+// message, or an empty string, if it can.
+func mergeMessageRefusal(conf Config, arguments mergeArguments) string {
+	if conf.NativeMergeQueue {
+		return "PRs in this repository are merged by GitHub's merge queue"
+	} else if conf.MergeStrategy == MergeStrategyFastForward {
+		return "PRs in this repository are fast-forwarded onto the base branch as they are, without a new commit"
+	} else if conf.MergeStrategy != MergeStrategyMerge {
+		return fmt.Sprintf("PRs in this repository are merged with the `%s` strategy, which doesn't create a "+
+			"commit", conf.MergeStrategy)
+	} else if arguments.Method == mergeMethodRebase {
+		return "rebase merging keeps the PR's commits and doesn't create a commit"
+	} else if conf.CommitMessageRule != nil && !conf.CommitMessageRule.MatchString(arguments.Message) {
+		return fmt.Sprintf("it doesn't follow the commit message rule `%s`", conf.CommitMessageRule)
+	}
+	return ""
+}
@@ -0,0 +1,177 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("!merge comment with a message", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+
+			commenter = "procoder"
+			headSHA   = "1235"
+			pr        = &github.PullRequest{
+				Number:    github.Int(issueNumber),
+				Merged:    github.Bool(false),
+				Mergeable: github.Bool(true),
+				Base: &github.PullRequestBranch{
+					SHA:  github.String("1234"),
+					Ref:  github.String("master"),
+					Repo: repository,
+				},
+				Head: &github.PullRequestBranch{
+					SHA:  github.String(headSHA),
+					Ref:  github.String("feature"),
+					Repo: repository,
+				},
+				User: &github.User{
+					Login: github.String(arbitraryIssueAuthor),
+				},
+			}
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+
+			repositories.
+				On("Get", anyContext, repositoryOwner, repositoryName).
+				Return(&github.Repository{
+					AllowSquashMerge: github.Bool(true),
+					AllowRebaseMerge: github.Bool(true),
+					AllowMergeCommit: github.Bool(true),
+				}, emptyResponse, noError)
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+
+		ForCollaborator(context, repositoryOwner, repositoryName, commenter, func() {
+			Context("with a message following the commit message rule", func() {
+				requestJSON.Is(func() string {
+					return IssueCommentEvent(`!merge squash --message \"Release 1.2.3\\n\\nShips the \\\"widget\\\".\"`,
+						commenter)
+				})
+
+				BeforeEach(func() {
+					context.Config.CommitMessageRule = regexp.MustCompile(`^Release `)
+					issues.
+						On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+							[]string{grh.MergingLabel}).
+						Return(emptyResult, emptyResponse, noError)
+					pullRequests.
+						On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+						Return(pr, emptyResponse, noError)
+					repositories.
+						On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+							mock.AnythingOfType("*github.ListOptions")).
+						Return(&github.CombinedStatus{
+							State: github.String("success"),
+						}, emptyResponse, noError)
+					mockLabels(issues, issueNumber, grh.MergingLabel)
+					pullRequests.
+						On("Merge", anyContext, repositoryOwner, repositoryName, issueNumber,
+							`Ships the "widget".`,
+							&github.PullRequestOptions{MergeMethod: "squash", CommitTitle: "Release 1.2.3"}).
+						Return(emptyResult, emptyResponse, errArbitrary).
+						Once()
+				})
+
+				It("asks GitHub to merge the PR with the message", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusBadGateway))
+					pullRequests.AssertExpectations(GinkgoT())
+				})
+			})
+
+			Context("with a message not following the commit message rule", func() {
+				requestJSON.Is(func() string {
+					return IssueCommentEvent(`!merge --message \"ship it\"`, commenter)
+				})
+
+				BeforeEach(func() {
+					context.Config.CommitMessageRule = regexp.MustCompile(`^[A-Z]`)
+				})
+
+				It("refuses to merge the PR", func() {
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("@"+commenter+", I can't merge this PR with that "+
+								"message, because it doesn't follow the commit message rule `^[A-Z]`."))).
+						Return(emptyResult, emptyResponse, noError).
+						Once()
+
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertNotCalled(GinkgoT(), "AddLabelsToIssue", anyContext, repositoryOwner,
+						repositoryName, issueNumber, []string{grh.MergingLabel})
+				})
+			})
+
+			Context("with the rebase method", func() {
+				requestJSON.Is(func() string {
+					return IssueCommentEvent(`!merge rebase --message \"Release 1.2.3\"`, commenter)
+				})
+
+				It("refuses to merge the PR", func() {
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("because rebase merging keeps the PR's commits"))).
+						Return(emptyResult, emptyResponse, noError).
+						Once()
+
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertExpectations(GinkgoT())
+				})
+			})
+
+			Context("with the fast-forward merge strategy", func() {
+				requestJSON.Is(func() string {
+					return IssueCommentEvent(`!merge --message \"Release 1.2.3\"`, commenter)
+				})
+
+				BeforeEach(func() {
+					context.Config.MergeStrategy = grh.MergeStrategyFastForward
+				})
+
+				It("refuses to merge the PR instead of dropping the message", func() {
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("because PRs in this repository are fast-forwarded onto "+
+								"the base branch as they are"))).
+						Return(emptyResult, emptyResponse, noError).
+						Once()
+
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertExpectations(GinkgoT())
+					issues.AssertNotCalled(GinkgoT(), "AddLabelsToIssue", anyContext, repositoryOwner,
+						repositoryName, issueNumber, []string{grh.MergingLabel})
+				})
+			})
+		})
+	})
+})
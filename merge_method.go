@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// The merge methods that can be chosen with "!merge <method>"
+const (
+	mergeMethodSquash = "squash"
+	mergeMethodRebase = "rebase"
+	mergeMethodCommit = "commit"
+)
+
+var mergeMethodNames = map[string]string{
+	mergeMethodSquash: "squash merging",
+	mergeMethodRebase: "rebase merging",
+	mergeMethodCommit: "merge commits",
+}
+
+// githubMergeMethod maps the chosen merge method to GitHub's name for it.
+// PRs without a chosen method are merged with a merge commit.
+func githubMergeMethod(method string) string {
+	if method == "" || method == mergeMethodCommit {
+		return "merge"
+	}
+	return method
+}
+
+// chooseMergeMethod records the merge method chosen in the merge command for
+// the PR, after checking that the repository allows it. A merge command
+// without a method forgets the earlier choice. Returns nil, if the merge can
+// go ahead.
+func chooseMergeMethod(conf Config, issueComment IssueComment, method string, store Store, issues Issues,
+	repositories Repositories) Response {
+
+	issue := issueComment.Issue()
+	if method != "" {
+		reason, errResp := mergeMethodRefusal(conf, issue.Repository, method, repositories)
+		if errResp != nil {
+			return errResp
+		} else if reason != "" {
+			log.Printf("Not merging PR %s with the %s method, because %s.\n", issue.FullName(), method, reason)
+			message := fmt.Sprintf("@%s, I can't %s this PR, because %s.", issueComment.Commenter.Login,
+				mergeMethodVerb(method), reason)
+			if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+				errorMessage := fmt.Sprintf("Failed to report the disabled merge method on PR %s",
+					issue.FullName())
+				return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+			}
+			return SuccessResponse{fmt.Sprintf("Not merging PR %s with the %s method, because %s",
+				issue.FullName(), method, reason)}
+		}
+	}
+	if err := store.SetMergeMethod(issue, method); err != nil {
+		message := fmt.Sprintf("Failed to record the merge method of PR %s", issue.FullName())
+		return ErrorResponse{err, http.StatusInternalServerError, message}
+	}
+	return nil
+}
+
+// mergeMethodRefusal returns the reason why the PR can't be merged with the
+// method, or an empty string, if it can.
+func mergeMethodRefusal(conf Config, repository Repository, method string,
+	repositories Repositories) (string, *ErrorResponse) {
+
+	if conf.MergeStrategy != MergeStrategyMerge {
+		return fmt.Sprintf("PRs in this repository are merged with the `%s` strategy", conf.MergeStrategy), nil
+	} else if method == mergeMethodRebase && len(conf.MergeTrailers) > 0 {
+		// Rebasing keeps the original commits, which can't get the trailers
+		return "rebase merges wouldn't get the configured commit trailers", nil
+	}
+	githubRepository, _, err := repositories.Get(context.TODO(), repository.Owner, repository.Name)
+	if err != nil {
+		message := fmt.Sprintf("Failed to get the settings of %s", repositoryKey(repository))
+		return "", &ErrorResponse{err, http.StatusBadGateway, message}
+	}
+	allowed := map[string]bool{
+		mergeMethodSquash: githubRepository.GetAllowSquashMerge(),
+		mergeMethodRebase: githubRepository.GetAllowRebaseMerge(),
+		mergeMethodCommit: githubRepository.GetAllowMergeCommit(),
+	}
+	if allowed[method] {
+		return "", nil
+	}
+	allowedMethods := []string{}
+	for _, allowedMethod := range []string{mergeMethodSquash, mergeMethodRebase, mergeMethodCommit} {
+		if allowed[allowedMethod] {
+			allowedMethods = append(allowedMethods, "`"+allowedMethod+"`")
+		}
+	}
+	reason := fmt.Sprintf("the repository's settings don't allow %s", mergeMethodNames[method])
+	if len(allowedMethods) > 0 {
+		reason += fmt.Sprintf(". The allowed methods are %s", strings.Join(allowedMethods, ", "))
+	}
+	return reason, nil
+}
+
+// mergeWithLinearHistory merges the PR with the GitHub merge method. If the
+// base branch refuses merge commits, because it requires a linear history,
+// the PR is rebased or, if the repository doesn't allow that, squashed
+// instead. With MERGE_TRAILERS or if the PR has merge commits of its own,
+// which rebasing can't keep linear, squashing is preferred. The method used
+// instead is returned along with the
+// SHA of the resulting commit, or an empty string, if the method wasn't
+// changed. The
+// message is the message of the commit the merge creates (see
+// commitMessageFor).
+func mergeWithLinearHistory(conf Config, pr *github.PullRequest, githubMethod string, message commitMessage,
+	pullRequests PullRequests, repositories Repositories) (string, string, error) {
+
+	issue := prIssue(pr)
+	mergeSHA, err := merge(issue.Repository, issue.Number, githubMethod, commitMessageFor(githubMethod, message),
+		pullRequests)
+	if err != ErrLinearHistoryRequired || githubMethod != "merge" {
+		return mergeSHA, "", err
+	}
+	githubRepository, _, err := repositories.Get(context.TODO(), issue.Repository.Owner, issue.Repository.Name)
+	if err != nil {
+		return "", "", err
+	}
+	isExpectedHead := func(head string) bool { return head == pr.Head.GetSHA() }
+	commits, asyncErrResp := getCommits(issue, isExpectedHead, pullRequests)
+	if asyncErrResp != nil {
+		return "", "", fmt.Errorf("%s: %v", asyncErrResp.ErrorMessage, asyncErrResp.Error)
+	}
+	hasMergeCommits := false
+	for _, commit := range commits {
+		if len(commit.Parents) > 1 {
+			hasMergeCommits = true
+		}
+	}
+	var method string
+	if githubRepository.GetAllowRebaseMerge() && !hasMergeCommits &&
+		(len(conf.MergeTrailers) == 0 || !githubRepository.GetAllowSquashMerge()) {
+		method = mergeMethodRebase
+	} else if githubRepository.GetAllowSquashMerge() {
+		method = mergeMethodSquash
+	} else {
+		return "", "", ErrLinearHistoryRequired
+	}
+	log.Printf("The base branch of PR %s requires a linear history. Using %s instead.\n", issue.FullName(),
+		mergeMethodNames[method])
+	mergeSHA, err = merge(issue.Repository, issue.Number, githubMergeMethod(method),
+		commitMessageFor(githubMergeMethod(method), message), pullRequests)
+	if err != nil {
+		return "", "", err
+	}
+	return mergeSHA, method, nil
+}
+
+// commitMessageFor returns the message for squash merges and, if it was
+// given with "!merge --message", which sets the title, for merge commits.
+// The other merges keep GitHub's default message.
+func commitMessageFor(githubMethod string, message commitMessage) commitMessage {
+	if githubMethod == "squash" || (githubMethod == "merge" && message.Title != "") {
+		return message
+	}
+	return commitMessage{}
+}
+
+func mergeMethodVerb(method string) string {
+	switch method {
+	case mergeMethodSquash:
+		return "squash and merge"
+	case mergeMethodRebase:
+		return "rebase and merge"
+	}
+	return "merge"
+}
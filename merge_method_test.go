@@ -0,0 +1,172 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("!merge comment with a merge method", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+
+			commenter = "procoder"
+			headSHA   = "1235"
+			pr        = &github.PullRequest{
+				Number:    github.Int(issueNumber),
+				Merged:    github.Bool(false),
+				Mergeable: github.Bool(true),
+				Base: &github.PullRequestBranch{
+					SHA:  github.String("1234"),
+					Ref:  github.String("master"),
+					Repo: repository,
+				},
+				Head: &github.PullRequestBranch{
+					SHA:  github.String(headSHA),
+					Ref:  github.String("feature"),
+					Repo: repository,
+				},
+				User: &github.User{
+					Login: github.String(arbitraryIssueAuthor),
+				},
+			}
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!merge squash", commenter)
+		})
+
+		mockRepositorySettings := func(squash, rebase, mergeCommit bool) {
+			repositories.
+				On("Get", anyContext, repositoryOwner, repositoryName).
+				Return(&github.Repository{
+					AllowSquashMerge: github.Bool(squash),
+					AllowRebaseMerge: github.Bool(rebase),
+					AllowMergeCommit: github.Bool(mergeCommit),
+				}, emptyResponse, noError)
+		}
+
+		ForCollaborator(context, repositoryOwner, repositoryName, commenter, func() {
+			Context("with the method disabled in the repository", func() {
+				BeforeEach(func() {
+					mockRepositorySettings(false, true, true)
+				})
+
+				It("refuses to merge the PR and lists the allowed methods", func() {
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("@"+commenter+", I can't squash and merge this PR, "+
+								"because the repository's settings don't allow squash merging. The allowed "+
+								"methods are `rebase`, `commit`."))).
+						Return(emptyResult, emptyResponse, noError).
+						Once()
+
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertNotCalled(GinkgoT(), "AddLabelsToIssue", anyContext, repositoryOwner,
+						repositoryName, issueNumber, []string{grh.MergingLabel})
+				})
+			})
+
+			Context("with the verified-rebase merge strategy", func() {
+				BeforeEach(func() {
+					context.Config.MergeStrategy = grh.MergeStrategyVerifiedRebase
+				})
+
+				It("refuses to merge the PR", func() {
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("because PRs in this repository are merged with the "+
+								"`verified-rebase` strategy"))).
+						Return(emptyResult, emptyResponse, noError).
+						Once()
+
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				})
+			})
+
+			Context("with rebasing and merge trailers configured", func() {
+				requestJSON.Is(func() string {
+					return IssueCommentEvent("!merge rebase", commenter)
+				})
+
+				BeforeEach(func() {
+					context.Config.MergeTrailers = []string{"reviewed-by"}
+				})
+
+				It("refuses to merge the PR", func() {
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("@"+commenter+", I can't rebase and merge this PR, "+
+								"because rebase merges wouldn't get the configured commit trailers."))).
+						Return(emptyResult, emptyResponse, noError).
+						Once()
+
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertNotCalled(GinkgoT(), "AddLabelsToIssue", anyContext, repositoryOwner,
+						repositoryName, issueNumber, []string{grh.MergingLabel})
+				})
+			})
+
+			Context("with the method allowed in the repository", func() {
+				BeforeEach(func() {
+					mockRepositorySettings(true, false, true)
+					issues.
+						On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+							[]string{grh.MergingLabel}).
+						Return(emptyResult, emptyResponse, noError)
+					pullRequests.
+						On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+						Return(pr, emptyResponse, noError)
+					repositories.
+						On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+							mock.AnythingOfType("*github.ListOptions")).
+						Return(&github.CombinedStatus{
+							State: github.String("success"),
+						}, emptyResponse, noError)
+					mockLabels(issues, issueNumber, grh.MergingLabel)
+					pullRequests.
+						On("Merge", anyContext, repositoryOwner, repositoryName, issueNumber, "",
+							&github.PullRequestOptions{MergeMethod: "squash"}).
+						Return(emptyResult, emptyResponse, errArbitrary).
+						Once()
+				})
+
+				It("asks GitHub to merge the PR with the method", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusBadGateway))
+					pullRequests.AssertExpectations(GinkgoT())
+				})
+			})
+		})
+	})
+})
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// mergeOutcomeMethods describe how the PRs were merged, by GitHub's merge
+// method or "fast-forward" for the verified-rebase strategy
+var mergeOutcomeMethods = map[string]string{
+	"merge":        "a merge commit",
+	"squash":       "a squash merge",
+	"rebase":       "a rebase merge",
+	"fast-forward": "a fast-forward of the validated commit",
+}
+
+// mergeOutcomeMessage summarizes the merge of the PR as mergeSHA with the
+// method for its reviewers.
+func mergeOutcomeMessage(conf Config, pr *github.PullRequest, mergeSHA, method string) string {
+	repository := baseRepository(pr)
+	base := pr.Base.GetRef()
+	message := fmt.Sprintf(":tada: Merged into `%s` as %s with %s.\n\n", base, shortSHA(mergeSHA),
+		mergeOutcomeMethods[method])
+	message += fmt.Sprintf("- **CI**: [the checks of `%s`](%s/commit/%s/checks)\n", base,
+		repositoryHTMLURL(pr), mergeSHA)
+	if conf.DeployPipelineURL != "" {
+		deployURL := strings.NewReplacer(
+			"{owner}", repository.Owner,
+			"{repo}", repository.Name,
+			"{branch}", base,
+			"{sha}", mergeSHA,
+			"{pr}", strconv.Itoa(pr.GetNumber()),
+		).Replace(conf.DeployPipelineURL)
+		message += fmt.Sprintf("- **Next steps**: follow [the deployment pipeline](%s)\n", deployURL)
+	}
+	return message
+}
+
+// repositoryHTMLURL returns the web address of the PR's base repository,
+// which is on the GitHub Enterprise host for the repositories there.
+func repositoryHTMLURL(pr *github.PullRequest) string {
+	if htmlURL := pr.GetBase().GetRepo().GetHTMLURL(); htmlURL != "" {
+		return strings.TrimSuffix(htmlURL, "/")
+	}
+	repository := baseRepository(pr)
+	return fmt.Sprintf("https://github.com/%s/%s", repository.Owner, repository.Name)
+}
+
+// commentMergeOutcome comments the outcome of the merge on the PR, if
+// MERGE_OUTCOME_COMMENTS is enabled. With STICKY_COMMENTS, it replaces the
+// status comment, which is then left as it is, instead of being minimized
+// when the PR is closed. Failing to comment is only logged, because the PR
+// has already been merged.
+func commentMergeOutcome(conf Config, pr *github.PullRequest, mergeSHA, method string, store Store,
+	issues Issues) {
+
+	if !conf.MergeOutcomeComments {
+		return
+	}
+	issue := prIssue(pr)
+	if err := stickyComment(conf, mergeOutcomeMessage(conf, pr, mergeSHA, method), issue, store,
+		issues); err != nil {
+		log.Printf("Failed to comment the merge outcome of PR %s: %v\n", issue.FullName(), err)
+	} else if err = store.RemoveStickyComment(issue); err != nil {
+		log.Printf("Failed to forget the status comment of PR %s: %v\n", issue.FullName(), err)
+	}
+}
@@ -0,0 +1,168 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("merge outcome comments", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+			gitRepos         *mocks.Repos
+			store            grh.Store
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+			gitRepos = *context.GitRepos
+			store = *context.Store
+
+			context.Config.MergeOutcomeComments = true
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!merge", arbitraryIssueAuthor)
+		})
+
+		headSHA := "1235"
+		mergeSHA := "abc1234def5678"
+		// A GitHub Enterprise repository
+		enterpriseRepository := *repository
+		enterpriseRepository.HTMLURL = github.String("https://github.example.com/" + repositoryOwner + "/" +
+			repositoryName)
+		pr := &github.PullRequest{
+			Number:    github.Int(issueNumber),
+			Merged:    github.Bool(false),
+			Mergeable: github.Bool(true),
+			Base: &github.PullRequestBranch{
+				SHA:  github.String("1234"),
+				Ref:  github.String("master"),
+				Repo: &enterpriseRepository,
+			},
+			Head: &github.PullRequestBranch{
+				SHA:  github.String(headSHA),
+				Ref:  github.String("feature"),
+				Repo: repository,
+			},
+			User: &github.User{
+				Login: github.String(arbitraryIssueAuthor),
+			},
+		}
+
+		BeforeEach(func() {
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+			issues.
+				On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{grh.MergingLabel}).
+				Return(emptyResult, emptyResponse, noError)
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+				Return(pr, emptyResponse, noError)
+			repositories.
+				On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.AnythingOfType("*github.ListOptions")).
+				Return(&github.CombinedStatus{State: github.String("success")}, emptyResponse, noError)
+			mockLabels(issues, issueNumber, grh.MergingLabel)
+			pullRequests.
+				On("Merge", anyContext, repositoryOwner, repositoryName, issueNumber, "", noSquashOpts).
+				Return(&github.PullRequestMergeResult{
+					Merged: github.Bool(true),
+					SHA:    github.String(mergeSHA),
+				}, emptyResponse, noError)
+			issues.
+				On("RemoveLabelForIssue", anyContext, repositoryOwner, repositoryName, issueNumber, grh.MergingLabel).
+				Return(emptyResponse, noError)
+			gitRepo := new(mocks.Repo)
+			gitRepos.
+				On("GetUpdatedRepo", sshURL, repositoryOwner, repositoryName).
+				Return(gitRepo, noError)
+			gitRepo.On("DeleteRemoteBranch", "feature").Return(noError)
+		})
+
+		Context("without a deployment pipeline", func() {
+			It("comments the merge commit, the method and the CI link on the repository's host", func() {
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(func(comment *github.IssueComment) bool {
+							return commentContaining(":tada: Merged into `master` as abc1234 with a merge "+
+								"commit.")(comment) &&
+								commentContaining("(https://github.example.com/"+repositoryOwner+"/"+repositoryName+
+									"/commit/"+mergeSHA+"/checks)")(comment) &&
+								!commentContaining("Next steps")(comment)
+						})).
+					Return(emptyResult, emptyResponse, noError)
+
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+			})
+		})
+
+		Context("with DEPLOY_PIPELINE_URL set", func() {
+			BeforeEach(func() {
+				context.Config.DeployPipelineURL = "https://ci.example.com/{owner}/{repo}/deploy?sha={sha}&pr={pr}"
+			})
+
+			It("links to the deployment pipeline of the merge commit", func() {
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("- **Next steps**: follow [the deployment pipeline]"+
+							"(https://ci.example.com/"+repositoryOwner+"/"+repositoryName+"/deploy?sha="+mergeSHA+
+							"&pr=7)"))).
+					Return(emptyResult, emptyResponse, noError)
+
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+			})
+		})
+
+		Context("with a sticky status comment", func() {
+			issue := grh.Issue{
+				Number:     issueNumber,
+				Repository: grh.Repository{Owner: repositoryOwner, Name: repositoryName, URL: sshURL},
+			}
+
+			BeforeEach(func() {
+				context.Config.StickyComments = true
+				Expect(store.SetStickyComment(grh.StickyComment{Issue: issue, ID: 42, NodeID: "IC_42"})).To(Succeed())
+				issues.
+					On("EditComment", anyContext, repositoryOwner, repositoryName, int64(42),
+						mock.MatchedBy(commentContaining(":tada: Merged into `master`"))).
+					Return(emptyResult, emptyResponse, noError)
+			})
+
+			It("replaces the status comment and stops tracking it", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+				_, exists, err := store.StickyComment(issue)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(exists).To(BeFalse())
+			})
+		})
+	})
+})
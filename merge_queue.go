@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// checkMergeQueueDepth turns down the !merge command when the repository
+// already has MERGE_QUEUE_MAX_DEPTH PRs waiting to be merged, replying with
+// the depth of the queue and the expected wait. PRs that are already in the
+// queue can be merged again, e.g. to ignore a status. Returns nil if the
+// command can go ahead.
+func checkMergeQueueDepth(conf Config, issueComment IssueComment, search Search, issues Issues) Response {
+	if conf.MergeQueueMaxDepth == 0 || issueComment.HasLabel(MergingLabel) {
+		return nil
+	}
+	issue := issueComment.Issue()
+	depth, errResp := mergeQueueDepth(issue.Repository, search)
+	if errResp != nil {
+		return errResp
+	} else if depth < conf.MergeQueueMaxDepth {
+		return nil
+	}
+	log.Printf("The merge queue of %s is full with %d PRs. Not queueing PR %s.\n",
+		repositoryKey(issue.Repository), depth, issue.FullName())
+	message := renderMessage(conf, mergeQueueFullMessage, commandMessageData(issueComment, map[string]interface{}{
+		"Depth": depth,
+		"Wait":  formatDuration(time.Duration(depth) * conf.MergeQueuePRDuration),
+	}))
+	if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+		errorMessage := fmt.Sprintf("Failed to report the full merge queue on PR %s", issue.FullName())
+		return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	return SuccessResponse{fmt.Sprintf("The merge queue is full. Not queueing PR %s.", issue.FullName())}
+}
+
+// mergeQueueDepth counts the repository's open PRs labeled with "merging".
+// PRs on hold are counted as well, because they'll be merged once they're
+// released.
+func mergeQueueDepth(repository Repository, search Search) (int, *ErrorResponse) {
+	query := fmt.Sprintf("label:\"%s\" is:pr is:open repo:%s/%s", MergingLabel, repository.Owner, repository.Name)
+	queued, err := searchIssues(query, search)
+	if err != nil {
+		message := fmt.Sprintf("Searching for issues with query '%s' failed", query)
+		return 0, &ErrorResponse{err, http.StatusBadGateway, message}
+	}
+	return len(queued), nil
+}
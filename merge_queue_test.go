@@ -0,0 +1,212 @@
+package main_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("!merge comment with a full merge queue", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			issues           *mocks.Issues
+			search           *mocks.Search
+			graphQL          *mocks.GraphQL
+
+			commenter = "procoder"
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			issues = *context.Issues
+			search = *context.Search
+			graphQL = *context.GraphQL
+			context.Config.MergeQueueMaxDepth = 2
+			context.Config.MergeQueuePRDuration = 30 * time.Minute
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+
+		mockQueue := func(numbers ...int) {
+			queued := make([]github.Issue, len(numbers))
+			for i, number := range numbers {
+				queued[i] = github.Issue{Number: github.Int(number), User: &github.User{Login: github.String("me")}}
+			}
+			query := fmt.Sprintf("label:\"%s\" is:pr is:open repo:%s/%s", grh.MergingLabel, repositoryOwner,
+				repositoryName)
+			search.
+				On("Issues", anyContext, query, mock.AnythingOfType("*github.SearchOptions")).
+				Return(&github.IssuesSearchResult{Issues: queued}, &github.Response{}, noError)
+		}
+
+		mockRole := func(permission string) {
+			data, err := json.Marshal(map[string]interface{}{
+				"repository": map[string]interface{}{
+					"collaborators": map[string]interface{}{
+						"edges": []interface{}{
+							map[string]interface{}{
+								"permission": permission,
+								"node":       map[string]string{"login": commenter},
+							},
+						},
+					},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			graphQL.
+				On("Query", anyContext, mock.AnythingOfType("string"), mock.Anything, mock.Anything).
+				Return(noError).
+				Run(func(args mock.Arguments) {
+					Expect(json.Unmarshal(data, args.Get(3))).To(Succeed())
+				})
+		}
+
+		Context("with a new PR", func() {
+			requestJSON.Is(func() string {
+				return IssueCommentEvent("!merge", commenter)
+			})
+
+			ForCollaborator(context, repositoryOwner, repositoryName, commenter, func() {
+				Context("with the queue full", func() {
+					BeforeEach(func() {
+						mockQueue(1, 2)
+					})
+
+					It("replies with the depth of the queue and the expected wait", func() {
+						issues.
+							On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+								mock.MatchedBy(commentContaining("the merge queue is full with 2 PRs, so I can't queue "+
+									"this PR right now. Merging them should take about 1h0m0s."))).
+							Return(emptyResult, emptyResponse, noError).
+							Once()
+
+						handle()
+						Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+						issues.AssertNotCalled(GinkgoT(), "AddLabelsToIssue", anyContext, repositoryOwner,
+							repositoryName, issueNumber, []string{grh.MergingLabel})
+					})
+				})
+
+				Context("with --next from a maintainer", func() {
+					requestJSON.Is(func() string {
+						return IssueCommentEvent("!merge --next", commenter)
+					})
+
+					BeforeEach(func() {
+						mockRole("MAINTAIN")
+					})
+
+					Context("with the queue full", func() {
+						BeforeEach(func() {
+							mockQueue(1, 2)
+							issues.
+								On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+									mock.MatchedBy(commentContaining("the merge queue is full with 2 PRs"))).
+								Return(emptyResult, emptyResponse, noError).
+								Once()
+						})
+
+						It("checks the depth of the queue like for other PRs", func() {
+							handle()
+							Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+							issues.AssertNotCalled(GinkgoT(), "AddLabelsToIssue", anyContext, repositoryOwner,
+								repositoryName, issueNumber, mock.Anything)
+						})
+					})
+
+					Context("with room in the queue", func() {
+						BeforeEach(func() {
+							mockQueue(1)
+							issues.
+								On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+									mock.AnythingOfType("[]string")).
+								Return(emptyResult, emptyResponse, noError)
+							pullRequests.
+								On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+								Return(&github.PullRequest{
+									Merged:    github.Bool(false),
+									Mergeable: github.Bool(false),
+								}, emptyResponse, noError)
+						})
+
+						It("queues the PR at the front of the queue", func() {
+							handle()
+							Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+							issues.AssertCalled(GinkgoT(), "AddLabelsToIssue", anyContext, repositoryOwner,
+								repositoryName, issueNumber, []string{grh.PriorityLabel})
+							issues.AssertCalled(GinkgoT(), "AddLabelsToIssue", anyContext, repositoryOwner,
+								repositoryName, issueNumber, []string{grh.MergingLabel})
+						})
+					})
+				})
+
+				Context("with --next from a collaborator who isn't a maintainer", func() {
+					requestJSON.Is(func() string {
+						return IssueCommentEvent("!merge --next", commenter)
+					})
+
+					BeforeEach(func() {
+						mockRole("WRITE")
+						issues.
+							On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+								mock.MatchedBy(commentContaining("Only users with the maintain role or higher can "+
+									"ask me to `!merge --next` here."))).
+							Return(emptyResult, emptyResponse, noError).
+							Once()
+					})
+
+					It("refuses to queue the PR", func() {
+						handle()
+						Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+						issues.AssertNotCalled(GinkgoT(), "AddLabelsToIssue", anyContext, repositoryOwner,
+							repositoryName, issueNumber, mock.Anything)
+						search.AssertNotCalled(GinkgoT(), "Issues", anyContext, mock.Anything, mock.Anything)
+					})
+				})
+
+				Context("with room in the queue", func() {
+					BeforeEach(func() {
+						mockQueue(1)
+						issues.
+							On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+								[]string{grh.MergingLabel}).
+							Return(emptyResult, emptyResponse, noError)
+						pullRequests.
+							On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+							Return(&github.PullRequest{
+								Merged:    github.Bool(false),
+								Mergeable: github.Bool(false),
+							}, emptyResponse, noError)
+					})
+
+					It("queues the PR", func() {
+						handle()
+						Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+						issues.AssertCalled(GinkgoT(), "AddLabelsToIssue", anyContext, repositoryOwner,
+							repositoryName, issueNumber, []string{grh.MergingLabel})
+					})
+				})
+			})
+		})
+	})
+})
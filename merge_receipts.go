@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+var receiptHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// failedMergeReceipts counts the merges whose receipts couldn't be written.
+// Reported by /debug/vars.
+var failedMergeReceipts = expvar.NewInt("failed_merge_receipts")
+
+// MergeReceiptStorage is the S3 compatible object storage bucket the merge
+// receipts are written to. Google Cloud Storage buckets are written to
+// through its S3 compatible XML API with HMAC keys.
+type MergeReceiptStorage struct {
+	Endpoint        string
+	Bucket          string
+	Prefix          string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// ParseMergeReceiptStorage parses the bucket URL, e.g. "s3://bucket/prefix"
+// or "gs://bucket/prefix". The endpoint and the region default to the
+// provider's, if empty. An empty bucket URL disables the receipts and
+// results in a zero MergeReceiptStorage.
+func ParseMergeReceiptStorage(bucketURL, endpoint, region string) (MergeReceiptStorage, error) {
+	if bucketURL == "" {
+		return MergeReceiptStorage{}, nil
+	}
+	parsed, err := url.Parse(bucketURL)
+	if err != nil {
+		return MergeReceiptStorage{}, err
+	} else if parsed.Host == "" {
+		return MergeReceiptStorage{}, fmt.Errorf("no bucket in \"%s\"", bucketURL)
+	}
+	storage := MergeReceiptStorage{
+		Endpoint: strings.TrimSuffix(endpoint, "/"),
+		Bucket:   parsed.Host,
+		Prefix:   strings.Trim(parsed.Path, "/"),
+		Region:   region,
+	}
+	switch parsed.Scheme {
+	case "s3":
+		if storage.Region == "" {
+			storage.Region = "us-east-1"
+		}
+		if storage.Endpoint == "" {
+			storage.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", storage.Region)
+		}
+	case "gs":
+		if storage.Region == "" {
+			storage.Region = "auto"
+		}
+		if storage.Endpoint == "" {
+			storage.Endpoint = "https://storage.googleapis.com"
+		}
+	default:
+		return MergeReceiptStorage{}, fmt.Errorf("bucket URLs must start with s3:// or gs://, got \"%s\"",
+			bucketURL)
+	}
+	return storage, nil
+}
+
+// MergeReceipt records what a PR was merged with, so that the merge can be
+// audited independently of GitHub.
+type MergeReceipt struct {
+	Repository  string              `json:"repository"`
+	PullRequest int                 `json:"pull_request"`
+	Title       string              `json:"title"`
+	Author      string              `json:"author"`
+	BaseRef     string              `json:"base_ref"`
+	HeadSHA     string              `json:"head_sha"`
+	MergeSHA    string              `json:"merge_sha,omitempty"`
+	MergedAt    time.Time           `json:"merged_at"`
+	Approvals   []string            `json:"approvals"`
+	Checks      []MergeReceiptCheck `json:"checks"`
+	// Policy is the effective policy of the repository at the time of the
+	// merge
+	Policy Policy `json:"policy"`
+}
+
+// MergeReceiptCheck is the state of a status of the merged commit.
+type MergeReceiptCheck struct {
+	Context string `json:"context"`
+	State   string `json:"state"`
+}
+
+// signedMergeReceipt is the object written to the storage. The signature is
+// in the format of GitHub's X-Hub-Signature-256 header, computed over the
+// JSON encoded receipt.
+type signedMergeReceipt struct {
+	Receipt   json.RawMessage `json:"receipt"`
+	Signature string          `json:"signature,omitempty"`
+}
+
+// writeMergeReceipt writes a receipt of the merged PR to the configured
+// storage. mergeSHA is the SHA of the commit the PR was merged as.
+func writeMergeReceipt(conf Config, pr *github.PullRequest, mergeSHA string, pullRequests PullRequests,
+	repositories Repositories) error {
+
+	if conf.MergeReceiptStorage.Bucket == "" {
+		return nil
+	}
+	issue := prIssue(pr)
+	receipt, err := newMergeReceipt(conf, pr, mergeSHA, pullRequests, repositories)
+	if err != nil {
+		return fmt.Errorf("failed to collect the merge receipt of PR %s: %v", issue.FullName(), err)
+	}
+	body, err := signMergeReceipt(receipt, conf.MergeReceiptSigningKey)
+	if err != nil {
+		return err
+	}
+	key := mergeReceiptKey(conf.MergeReceiptStorage.Prefix, receipt)
+	if err = putObject(conf.MergeReceiptStorage, key, body, time.Now()); err != nil {
+		return fmt.Errorf("failed to write the merge receipt of PR %s: %v", issue.FullName(), err)
+	}
+	log.Printf("Wrote the merge receipt of PR %s to %s.\n", issue.FullName(), key)
+	return nil
+}
+
+func newMergeReceipt(conf Config, pr *github.PullRequest, mergeSHA string, pullRequests PullRequests,
+	repositories Repositories) (MergeReceipt, error) {
+
+	issue := prIssue(pr)
+	reviews, errResp := getReviews(issue, pullRequests)
+	if errResp != nil {
+		return MergeReceipt{}, errResp.Error
+	}
+	var expiresBefore time.Time
+	if conf.ApprovalMaxAge != 0 {
+		expiresBefore = time.Now().Add(-conf.ApprovalMaxAge)
+	}
+	approvers, _, _ := currentReviewStates(reviews, *pr.Head.SHA, conf.IgnoreStaleApprovals, expiresBefore)
+	_, statuses, errResp := getStatuses(pr, repositories)
+	if errResp != nil {
+		return MergeReceipt{}, errResp.Error
+	}
+	checks := make([]MergeReceiptCheck, len(statuses))
+	for i, status := range statuses {
+		checks[i] = MergeReceiptCheck{Context: status.GetContext(), State: status.GetState()}
+	}
+	sort.Slice(checks, func(i, j int) bool {
+		return checks[i].Context < checks[j].Context
+	})
+	if approvers == nil {
+		approvers = []string{}
+	}
+	return MergeReceipt{
+		Repository:  repositoryKey(issue.Repository),
+		PullRequest: issue.Number,
+		Title:       pr.GetTitle(),
+		Author:      pr.User.GetLogin(),
+		BaseRef:     *pr.Base.Ref,
+		HeadSHA:     *pr.Head.SHA,
+		MergeSHA:    mergeSHA,
+		MergedAt:    time.Now().UTC(),
+		Approvals:   approvers,
+		Checks:      checks,
+		Policy:      configPolicy(conf),
+	}, nil
+}
+
+func signMergeReceipt(receipt MergeReceipt, signingKey string) ([]byte, error) {
+	receiptJSON, err := json.Marshal(receipt)
+	if err != nil {
+		return nil, err
+	}
+	signed := signedMergeReceipt{Receipt: receiptJSON}
+	if signingKey != "" {
+		mac := hmac.New(sha256.New, []byte(signingKey))
+		mac.Write(receiptJSON)
+		signed.Signature = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	return json.Marshal(signed)
+}
+
+// mergeReceiptKey names the receipt after the PR and the time of the merge,
+// so that the receipts of reopened and merged again PRs wouldn't overwrite
+// each other.
+func mergeReceiptKey(prefix string, receipt MergeReceipt) string {
+	key := fmt.Sprintf("%s/%d/%s.json", receipt.Repository, receipt.PullRequest,
+		receipt.MergedAt.Format("20060102T150405Z"))
+	if prefix == "" {
+		return key
+	}
+	return prefix + "/" + key
+}
+
+// putObject uploads the object with a request signed with AWS Signature
+// Version 4.
+func putObject(storage MergeReceiptStorage, key string, body []byte, now time.Time) error {
+	objectURL := fmt.Sprintf("%s/%s/%s", storage.Endpoint, storage.Bucket, key)
+	req, err := http.NewRequest("PUT", objectURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	signAWSRequest(req, body, storage, now)
+	resp, err := receiptHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("responded with %s", resp.Status)
+	}
+	return nil
+}
+
+func signAWSRequest(req *http.Request, body []byte, storage MergeReceiptStorage, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "content-type;host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"content-type:" + req.Header.Get("Content-Type"),
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, storage.Region)
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+	signingKey := []byte("AWS4" + storage.SecretAccessKey)
+	for _, part := range []string{date, storage.Region, "s3", "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		storage.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,180 @@
+package main_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("merge receipts", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+			gitRepos         *mocks.Repos
+
+			bucket        *httptest.Server
+			bucketStatus  int
+			receiptPath   string
+			authorization string
+			receiptBody   []byte
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+			gitRepos = *context.GitRepos
+
+			bucketStatus = http.StatusOK
+			receiptPath, authorization, receiptBody = "", "", nil
+			bucket = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				receiptPath = r.URL.Path
+				authorization = r.Header.Get("Authorization")
+				receiptBody, _ = ioutil.ReadAll(r.Body)
+				w.WriteHeader(bucketStatus)
+			}))
+
+			storage, err := grh.ParseMergeReceiptStorage("s3://receipts/merges", bucket.URL, "eu-west-1")
+			Expect(err).NotTo(HaveOccurred())
+			storage.AccessKeyID = "AKID"
+			storage.SecretAccessKey = "secret"
+			context.Config.MergeReceiptStorage = storage
+			context.Config.MergeReceiptSigningKey = "signing-key"
+		})
+		AfterEach(func() {
+			bucket.Close()
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!merge", arbitraryIssueAuthor)
+		})
+
+		headSHA := "1235"
+		pr := &github.PullRequest{
+			Number:    github.Int(issueNumber),
+			Title:     github.String("Fix the login form"),
+			Merged:    github.Bool(false),
+			Mergeable: github.Bool(true),
+			Base: &github.PullRequestBranch{
+				SHA:  github.String("1234"),
+				Ref:  github.String("master"),
+				Repo: repository,
+			},
+			Head: &github.PullRequestBranch{
+				SHA:  github.String(headSHA),
+				Ref:  github.String("feature"),
+				Repo: repository,
+			},
+			User: &github.User{
+				Login: github.String(arbitraryIssueAuthor),
+			},
+		}
+
+		BeforeEach(func() {
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+			issues.
+				On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{grh.MergingLabel}).
+				Return(emptyResult, emptyResponse, noError)
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+				Return(pr, emptyResponse, noError)
+			repositories.
+				On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.AnythingOfType("*github.ListOptions")).
+				Return(&github.CombinedStatus{
+					State: github.String("success"),
+					Statuses: []github.RepoStatus{{
+						Context: github.String("ci/build"),
+						State:   github.String("success"),
+					}},
+				}, emptyResponse, noError)
+			mockLabels(issues, issueNumber, grh.MergingLabel)
+			pullRequests.
+				On("Merge", anyContext, repositoryOwner, repositoryName, issueNumber, "", noSquashOpts).
+				Return(&github.PullRequestMergeResult{
+					Merged: github.Bool(true),
+					SHA:    github.String("abc123"),
+				}, emptyResponse, noError)
+			issues.
+				On("RemoveLabelForIssue", anyContext, repositoryOwner, repositoryName, issueNumber, grh.MergingLabel).
+				Return(emptyResponse, noError)
+			gitRepo := new(mocks.Repo)
+			gitRepos.
+				On("GetUpdatedRepo", sshURL, repositoryOwner, repositoryName).
+				Return(gitRepo, noError)
+			gitRepo.On("DeleteRemoteBranch", "feature").Return(noError)
+			pullRequests.
+				On("ListReviews", anyContext, repositoryOwner, repositoryName, issueNumber, mock.AnythingOfType("*github.ListOptions")).
+				Return([]*github.PullRequestReview{{
+					User:  &github.User{Login: github.String("alice")},
+					State: github.String("APPROVED"),
+				}}, emptyResponse, noError)
+		})
+
+		It("writes a signed receipt of the merge to the bucket", func() {
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+
+			Expect(receiptPath).To(MatchRegexp(`^/receipts/merges/` + repositoryOwner + `/` + repositoryName + `/` +
+				strconv.Itoa(issueNumber) + `/\d{8}T\d{6}Z\.json$`))
+			Expect(authorization).To(HavePrefix("AWS4-HMAC-SHA256 Credential=AKID/"))
+			Expect(authorization).To(ContainSubstring("/eu-west-1/s3/aws4_request"))
+
+			var signed struct {
+				Receipt   json.RawMessage `json:"receipt"`
+				Signature string          `json:"signature"`
+			}
+			Expect(json.Unmarshal(receiptBody, &signed)).To(Succeed())
+			mac := hmac.New(sha256.New, []byte("signing-key"))
+			mac.Write(signed.Receipt)
+			Expect(signed.Signature).To(Equal("sha256=" + hex.EncodeToString(mac.Sum(nil))))
+
+			var receipt grh.MergeReceipt
+			Expect(json.Unmarshal(signed.Receipt, &receipt)).To(Succeed())
+			Expect(receipt.PullRequest).To(Equal(issueNumber))
+			Expect(receipt.HeadSHA).To(Equal(headSHA))
+			Expect(receipt.MergeSHA).To(Equal("abc123"))
+			Expect(receipt.Approvals).To(Equal([]string{"alice"}))
+			Expect(receipt.Checks).To(Equal([]grh.MergeReceiptCheck{{Context: "ci/build", State: "success"}}))
+			Expect(receipt.Policy.RequiredApprovals).NotTo(BeNil())
+		})
+
+		Context("with the bucket failing", func() {
+			BeforeEach(func() {
+				bucketStatus = http.StatusForbidden
+			})
+
+			It("still merges the PR", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				pullRequests.AssertExpectations(GinkgoT())
+			})
+		})
+	})
+})
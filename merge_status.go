@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/evaluator"
+)
+
+const githubStatusMergeContext = "review-helper/merge"
+
+// GitHub rejects statuses with longer descriptions
+const maxStatusDescriptionLength = 140
+
+// reportMergeStatus sets the bot's review-helper/merge status on the PR's head
+// to describe why the PR hasn't been merged yet. The status is informational,
+// so its state is always success. Any other state would hold back the
+// combined state the merge itself waits for. The status isn't set again, if
+// the PR's current statuses already include the same description.
+func reportMergeStatus(conf Config, pr *github.PullRequest, description string, statuses []github.RepoStatus,
+	repositories Repositories) {
+
+	if !conf.MergeStatus {
+		return
+	}
+	if runes := []rune(description); len(runes) > maxStatusDescriptionLength {
+		description = string(runes[:maxStatusDescriptionLength-1]) + "…"
+	}
+	for _, status := range statuses {
+		if status.GetContext() == githubStatusMergeContext && status.GetDescription() == description {
+			return
+		}
+	}
+	status := &github.RepoStatus{
+		State:       github.String("success"),
+		Description: github.String(description),
+		Context:     github.String(githubStatusMergeContext),
+	}
+	// Failing to describe the merge's progress mustn't hold back the merge
+	if errResp := setStatusForPR(pr, status, repositories); errResp != nil {
+		log.Printf("%s: %v\n", errResp.ErrorMessage, errResp.Error)
+	}
+}
+
+// stateWithoutMergeStatus returns the combined state of the statuses without
+// the bot's own review-helper/merge status. GitHub counts that status in the
+// combined state as well, so a head whose CI hasn't reported anything yet
+// would otherwise pass as successful. The state is pending, if the merge
+// status is the only one.
+func stateWithoutMergeStatus(state string, statuses []github.RepoStatus) string {
+	others := make([]github.RepoStatus, 0, len(statuses))
+	for _, status := range statuses {
+		if status.GetContext() != githubStatusMergeContext {
+			others = append(others, status)
+		}
+	}
+	if len(others) == len(statuses) {
+		return state
+	} else if len(others) == 0 {
+		return "pending"
+	}
+	state = "success"
+	for _, status := range others {
+		switch status.GetState() {
+		case "failure", "error":
+			return "failure"
+		case "pending":
+			state = "pending"
+		}
+	}
+	return state
+}
+
+// reportQueuedStatus sets the merge status of a PR that's waiting for its
+// statuses to pass to its position in the merge queue.
+func reportQueuedStatus(conf Config, pr *github.PullRequest, statuses []github.RepoStatus, issues Issues,
+	pullRequests PullRequests, repositories Repositories) {
+
+	if !conf.MergeStatus {
+		return
+	}
+	description := "queued"
+	if position, errResp := mergeQueuePosition(pr, issues, pullRequests); errResp != nil {
+		log.Printf("%s: %v\n", errResp.ErrorMessage, errResp.Error)
+	} else if position > 0 {
+		description = fmt.Sprintf("queued (#%d)", position)
+	}
+	reportMergeStatus(conf, pr, description, statuses, repositories)
+}
+
+// blockerStatusDescription describes the rule that's blocking the merge in a
+// few words, e.g. "waiting on approvals".
+func blockerStatusDescription(blocker evaluator.Node) string {
+	switch blocker.Rule {
+	case approvalsRule:
+		return "waiting on approvals"
+	case conversationsRule:
+		return "waiting on resolved conversations"
+	case holdRule:
+		return "blocked: label " + OnHoldLabel
+	case blocksRule:
+		return "blocked by a reviewer"
+	case dependenciesRule:
+		return "blocked: waiting for dependencies"
+	case labelsRule:
+		return "blocked: " + strings.TrimPrefix(blocker.Reason, "it's ")
+	case mergeFreezeRule:
+		return "blocked: merge freeze"
+	case baseBranchRule:
+		return "blocked: base branch not allowed"
+	case claGate:
+		return "blocked: CLA not signed"
+	case fileGuardGate:
+		return "blocked: large or disallowed files"
+	case secretsGate:
+		return "blocked: possible credentials"
+	case fastForwardGate:
+		return "blocked: not rebased"
+	}
+	return "blocked: " + blocker.Reason
+}
+
+// mergeQueuePosition returns the PR's position among the open PRs labeled
+// with "merging" into the same base branch, oldest first, with the ones
+// labeled with "merge-priority" ahead of the rest. PRs into other base
+// branches are merged independently, so they don't count. The position is 0,
+// if the PR isn't labeled.
+func mergeQueuePosition(pr *github.PullRequest, issues Issues, pullRequests PullRequests) (int, *ErrorResponse) {
+	issue := prIssue(pr)
+	options := &github.IssueListByRepoOptions{
+		State:       "open",
+		Labels:      []string{MergingLabel},
+		Sort:        "created",
+		Direction:   "asc",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	var prioritized, rest []int
+	for {
+		queued, resp, err := issues.ListByRepo(context.TODO(), issue.Repository.Owner, issue.Repository.Name,
+			options)
+		if err != nil {
+			message := fmt.Sprintf("Failed to list the merge queue of %s", repositoryKey(issue.Repository))
+			return 0, &ErrorResponse{err, http.StatusBadGateway, message}
+		}
+		for _, queuedIssue := range queued {
+			if queuedIssue.PullRequestLinks == nil {
+				continue
+			} else if hasGithubLabel(queuedIssue.Labels, PriorityLabel) {
+				prioritized = append(prioritized, queuedIssue.GetNumber())
+			} else {
+				rest = append(rest, queuedIssue.GetNumber())
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		options.Page = resp.NextPage
+	}
+	position := 0
+	for _, number := range append(prioritized, rest...) {
+		if number == issue.Number {
+			return position + 1, nil
+		}
+		queuedPR, errResp := getPR(Issue{Repository: issue.Repository, Number: number}, pullRequests)
+		if errResp != nil {
+			return 0, errResp
+		} else if queuedPR.Base.GetRef() == pr.Base.GetRef() {
+			position++
+		}
+	}
+	return 0, nil
+}
+
+// handleMergingUnlabeled clears the merge status of a PR that's no longer
+// labeled with "merging", so that it wouldn't claim the PR is still queued.
+func handleMergingUnlabeled(conf Config, pullRequestEvent PullRequestEvent,
+	repositories Repositories) Response {
+
+	if !conf.MergeStatus {
+		return SuccessResponse{"Merge statuses are disabled. Ignoring."}
+	} else if pullRequestEvent.Label != MergingLabel {
+		return SuccessResponse{fmt.Sprintf("PR not unlabeled with '%s'. Ignoring.", MergingLabel)}
+	}
+	status := &github.RepoStatus{
+		State:       github.String("success"),
+		Description: github.String("not queued"),
+		Context:     github.String(githubStatusMergeContext),
+	}
+	if errResp := setStatusForPREvent(pullRequestEvent, status, repositories); errResp != nil {
+		return errResp
+	}
+	return SuccessResponse{fmt.Sprintf("Cleared the merge status of PR %s", pullRequestEvent.Issue().FullName())}
+}
@@ -0,0 +1,262 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("merge status", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+
+			context.Config.MergeStatus = true
+		})
+
+		headSHA := "1235"
+		pr := &github.PullRequest{
+			Number:    github.Int(issueNumber),
+			Merged:    github.Bool(false),
+			Mergeable: github.Bool(true),
+			Base: &github.PullRequestBranch{
+				SHA:  github.String("1234"),
+				Ref:  github.String("master"),
+				Repo: repository,
+			},
+			Head: &github.PullRequestBranch{
+				SHA:  github.String(headSHA),
+				Ref:  github.String("feature"),
+				Repo: repository,
+			},
+			User: &github.User{
+				Login: github.String(arbitraryIssueAuthor),
+			},
+		}
+
+		mockStatuses := func(state string, statuses ...github.RepoStatus) {
+			repositories.
+				On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.AnythingOfType("*github.ListOptions")).
+				Return(&github.CombinedStatus{
+					State:    github.String(state),
+					Statuses: statuses,
+				}, emptyResponse, noError)
+		}
+
+		mergeStatusWithDescription := func(description string) interface{} {
+			return mock.MatchedBy(func(status *github.RepoStatus) bool {
+				return status.GetContext() == "review-helper/merge" && status.GetState() == "success" &&
+					status.GetDescription() == description
+			})
+		}
+
+		Context("with a !merge command", func() {
+			headers.Is(func() map[string]string {
+				return map[string]string{
+					"X-Github-Event": "issue_comment",
+				}
+			})
+			requestJSON.Is(func() string {
+				return IssueCommentEvent("!merge", arbitraryIssueAuthor)
+			})
+
+			BeforeEach(func() {
+				repositories.
+					On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+					Return(true, emptyResponse, noError)
+				issues.
+					On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{grh.MergingLabel}).
+					Return(emptyResult, emptyResponse, noError)
+				pullRequests.
+					On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+					Return(pr, emptyResponse, noError)
+			})
+
+			Context("with pending statuses", func() {
+				mockQueuedPR := func(number int, base string) {
+					pullRequests.
+						On("Get", anyContext, repositoryOwner, repositoryName, number).
+						Return(&github.PullRequest{
+							Number: github.Int(number),
+							Base:   &github.PullRequestBranch{Ref: github.String(base)},
+						}, emptyResponse, noError)
+				}
+
+				BeforeEach(func() {
+					mockStatuses("pending")
+					issues.
+						On("ListByRepo", anyContext, repositoryOwner, repositoryName,
+							mock.AnythingOfType("*github.IssueListByRepoOptions")).
+						Return([]*github.Issue{
+							{Number: github.Int(3), PullRequestLinks: &github.PullRequestLinks{}},
+							{Number: github.Int(5)},
+							{Number: github.Int(4), PullRequestLinks: &github.PullRequestLinks{}},
+							{Number: github.Int(issueNumber), PullRequestLinks: &github.PullRequestLinks{}},
+						}, emptyResponse, noError)
+				})
+
+				Context("with all of the queued PRs into the same base branch", func() {
+					BeforeEach(func() {
+						mockQueuedPR(3, "master")
+						mockQueuedPR(4, "master")
+						repositories.
+							On("CreateStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+								mergeStatusWithDescription("queued (#3)")).
+							Return(emptyResult, emptyResponse, noError).
+							Once()
+					})
+
+					It("reports the PR's position in the merge queue", func() {
+						handle()
+						Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					})
+				})
+
+				Context("with a queued PR into another base branch", func() {
+					BeforeEach(func() {
+						mockQueuedPR(3, "release/1.0")
+						mockQueuedPR(4, "master")
+						repositories.
+							On("CreateStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+								mergeStatusWithDescription("queued (#2)")).
+							Return(emptyResult, emptyResponse, noError).
+							Once()
+					})
+
+					It("only counts the PRs into the same base branch", func() {
+						handle()
+						Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					})
+				})
+			})
+
+			Context("with the merge status as the only status", func() {
+				BeforeEach(func() {
+					mockStatuses("success", github.RepoStatus{
+						Context:     github.String("review-helper/merge"),
+						State:       github.String("success"),
+						Description: github.String("queued"),
+					})
+					issues.
+						On("ListByRepo", anyContext, repositoryOwner, repositoryName,
+							mock.AnythingOfType("*github.IssueListByRepoOptions")).
+						Return([]*github.Issue{}, emptyResponse, noError)
+				})
+
+				It("doesn't count it as a successful status", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					Expect(responseRecorder.Body.String()).To(ContainSubstring("has pending statuses"))
+					pullRequests.AssertNotCalled(GinkgoT(), "Merge", anyContext, repositoryOwner, repositoryName,
+						issueNumber, mock.Anything, mock.Anything)
+				})
+			})
+
+			Context("with the PR on hold", func() {
+				BeforeEach(func() {
+					mockLabels(issues, issueNumber, grh.MergingLabel, grh.OnHoldLabel)
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("because it's on hold"))).
+						Return(emptyResult, emptyResponse, noError)
+				})
+
+				It("reports the label blocking the merge", func() {
+					mockStatuses("success")
+					repositories.
+						On("CreateStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+							mergeStatusWithDescription("blocked: label "+grh.OnHoldLabel)).
+						Return(emptyResult, emptyResponse, noError).
+						Once()
+
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				})
+
+				It("doesn't report the block again", func() {
+					mockStatuses("success", github.RepoStatus{
+						Context: github.String("ci"),
+						State:   github.String("success"),
+					}, github.RepoStatus{
+						Context:     github.String("review-helper/merge"),
+						State:       github.String("success"),
+						Description: github.String("blocked: label " + grh.OnHoldLabel),
+					})
+
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					repositories.AssertNotCalled(GinkgoT(), "CreateStatus", anyContext, repositoryOwner,
+						repositoryName, headSHA, mock.Anything)
+				})
+			})
+		})
+
+		Context("with the merging label removed", func() {
+			headers.Is(func() map[string]string {
+				return map[string]string{
+					"X-Github-Event": "pull_request",
+				}
+			})
+			requestJSON.Is(func() string {
+				event := PullRequestEvent("unlabeled", headSHA, grh.Repository{
+					Owner: repositoryOwner,
+					Name:  repositoryName,
+					URL:   sshURL,
+				})
+				return strings.Replace(event, `"action": "unlabeled",`, `"action": "unlabeled",
+  "label": {"name": "`+grh.MergingLabel+`"},`, 1)
+			})
+
+			It("reports that the PR is no longer queued", func() {
+				repositories.
+					On("CreateStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+						mergeStatusWithDescription("not queued")).
+					Return(emptyResult, emptyResponse, noError).
+					Once()
+
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			})
+		})
+
+		Context("with a status event for the merge status", func() {
+			headers.Is(func() map[string]string {
+				return map[string]string{
+					"X-Github-Event": "status",
+				}
+			})
+			requestJSON.Is(func() string {
+				event := createStatusEvent(headSHA, "success", nil)
+				return strings.Replace(event, `"state": "success",`, `"state": "success",
+  "context": "review-helper/merge",`, 1)
+			})
+
+			It("ignores it", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(responseRecorder.Body.String()).To(ContainSubstring("the bot's own merge status"))
+			})
+		})
+	})
+})
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// The trailers MERGE_TRAILERS can add to the squash merge commits
+const (
+	reviewedByTrailer   = "reviewed-by"
+	coAuthoredByTrailer = "co-authored-by"
+	prTrailer           = "pr"
+)
+
+var mergeTrailerNames = map[string]bool{
+	reviewedByTrailer:   true,
+	coAuthoredByTrailer: true,
+	prTrailer:           true,
+}
+
+// squashCommitMessage builds the message of the PR's squash merge commit: the
+// givenMessage of "!merge --message" or else the messages of the PR's
+// commits, like GitHub's default message, followed by the configured
+// trailers. The trailers keep the attribution that squashing the commits
+// would otherwise lose. Returns an empty message, which leaves the message to
+// GitHub, if neither a message was given nor trailers are configured.
+func squashCommitMessage(conf Config, pr *github.PullRequest, givenMessage string,
+	pullRequests PullRequests) (commitMessage, *ErrorResponse) {
+
+	if len(conf.MergeTrailers) == 0 {
+		if givenMessage == "" {
+			return commitMessage{}, nil
+		}
+		return splitCommitMessage(givenMessage), nil
+	}
+	issue := prIssue(pr)
+	isExpectedHead := func(head string) bool { return head == pr.Head.GetSHA() }
+	commits, asyncErrResp := getCommits(issue, isExpectedHead, pullRequests)
+	if asyncErrResp != nil {
+		return commitMessage{}, &asyncErrResp.ErrorResponse
+	}
+	var title string
+	messages := []string{}
+	if givenMessage != "" {
+		given := splitCommitMessage(givenMessage)
+		title = given.Title
+		if given.Body != "" {
+			messages = append(messages, given.Body)
+		}
+	} else {
+		for _, commit := range commits {
+			if len(commit.Parents) <= 1 {
+				messages = append(messages, "* "+strings.TrimSpace(commit.Commit.GetMessage()))
+			}
+		}
+	}
+	trailers := []string{}
+	for _, name := range conf.MergeTrailers {
+		switch name {
+		case reviewedByTrailer:
+			reviewers, errResp := reviewedByTrailers(conf, pr, pullRequests)
+			if errResp != nil {
+				return commitMessage{}, errResp
+			}
+			trailers = append(trailers, reviewers...)
+		case coAuthoredByTrailer:
+			trailers = append(trailers, coAuthoredByTrailers(pr, commits)...)
+		case prTrailer:
+			trailers = append(trailers, fmt.Sprintf("PR: %s#%d", repositoryKey(issue.Repository), issue.Number))
+		}
+	}
+	if len(trailers) > 0 {
+		messages = append(messages, strings.Join(trailers, "\n"))
+	}
+	return commitMessage{Title: title, Body: strings.Join(messages, "\n\n")}, nil
+}
+
+// reviewedByTrailers credits the reviewers whose approvals count towards
+// merging the PR. GitHub attributes the trailers to the reviewers by their
+// noreply addresses.
+func reviewedByTrailers(conf Config, pr *github.PullRequest, pullRequests PullRequests) ([]string,
+	*ErrorResponse) {
+
+	reviews, errResp := getReviews(prIssue(pr), pullRequests)
+	if errResp != nil {
+		return nil, errResp
+	}
+	ids := make(map[string]int64)
+	for _, review := range reviews {
+		if review.User != nil {
+			ids[review.User.GetLogin()] = review.User.GetID()
+		}
+	}
+	var expiresBefore time.Time
+	if conf.ApprovalMaxAge != 0 {
+		expiresBefore = time.Now().Add(-conf.ApprovalMaxAge)
+	}
+	approvers, _, _ := currentReviewStates(reviews, pr.Head.GetSHA(), conf.IgnoreStaleApprovals, expiresBefore)
+	sort.Strings(approvers)
+	trailers := make([]string, len(approvers))
+	for i, approver := range approvers {
+		trailers[i] = fmt.Sprintf("Reviewed-by: %s <%d+%s@users.noreply.github.com>", approver, ids[approver],
+			approver)
+	}
+	return trailers, nil
+}
+
+// coAuthoredByTrailers credits the authors of the PR's commits other than the
+// PR's author, whom GitHub attributes the squash merge commit to.
+func coAuthoredByTrailers(pr *github.PullRequest, commits []*github.RepositoryCommit) []string {
+	trailers := []string{}
+	seen := make(map[string]bool)
+	for _, commit := range commits {
+		author := commit.Commit.GetAuthor()
+		if author == nil || author.GetEmail() == "" {
+			continue
+		} else if commit.Author != nil && commit.Author.GetLogin() == pr.User.GetLogin() {
+			continue
+		}
+		email := strings.ToLower(author.GetEmail())
+		if seen[email] {
+			continue
+		}
+		seen[email] = true
+		trailers = append(trailers, fmt.Sprintf("Co-authored-by: %s <%s>", author.GetName(), author.GetEmail()))
+	}
+	return trailers
+}
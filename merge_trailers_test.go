@@ -0,0 +1,146 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("merge trailers", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+			gitRepos         *mocks.Repos
+
+			mergeMessage string
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+			gitRepos = *context.GitRepos
+
+			context.Config.MergeTrailers = []string{"reviewed-by", "co-authored-by", "pr"}
+			mergeMessage = ""
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!merge squash", arbitraryIssueAuthor)
+		})
+
+		headSHA := "1235"
+		pr := &github.PullRequest{
+			Number:    github.Int(issueNumber),
+			Merged:    github.Bool(false),
+			Mergeable: github.Bool(true),
+			Base: &github.PullRequestBranch{
+				SHA:  github.String("1234"),
+				Ref:  github.String("master"),
+				Repo: repository,
+			},
+			Head: &github.PullRequestBranch{
+				SHA:  github.String(headSHA),
+				Ref:  github.String("feature"),
+				Repo: repository,
+			},
+			User: &github.User{
+				Login: github.String(arbitraryIssueAuthor),
+			},
+		}
+		commits := githubCommits(
+			commit{"1233", "Add the login form"},
+			commit{headSHA, "Fix the login form"},
+		)
+		commits[0].Author = &github.User{Login: github.String(arbitraryIssueAuthor)}
+		commits[0].Commit.Author = &github.CommitAuthor{
+			Name:  github.String("Author"),
+			Email: github.String("author@example.com"),
+		}
+		commits[1].Author = &github.User{Login: github.String("bob")}
+		commits[1].Commit.Author = &github.CommitAuthor{
+			Name:  github.String("Bob"),
+			Email: github.String("bob@example.com"),
+		}
+
+		BeforeEach(func() {
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+			repositories.
+				On("Get", anyContext, repositoryOwner, repositoryName).
+				Return(&github.Repository{
+					AllowSquashMerge: github.Bool(true),
+					AllowMergeCommit: github.Bool(true),
+				}, emptyResponse, noError)
+			issues.
+				On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{grh.MergingLabel}).
+				Return(emptyResult, emptyResponse, noError)
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+				Return(pr, emptyResponse, noError)
+			repositories.
+				On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.AnythingOfType("*github.ListOptions")).
+				Return(&github.CombinedStatus{
+					State: github.String("success"),
+				}, emptyResponse, noError)
+			mockLabels(issues, issueNumber, grh.MergingLabel)
+			pullRequests.
+				On("ListCommits", anyContext, repositoryOwner, repositoryName, issueNumber,
+					mock.AnythingOfType("*github.ListOptions")).
+				Return(commits, emptyResponse, noError)
+			pullRequests.
+				On("ListReviews", anyContext, repositoryOwner, repositoryName, issueNumber, mock.AnythingOfType("*github.ListOptions")).
+				Return([]*github.PullRequestReview{{
+					User:  &github.User{Login: github.String("alice"), ID: github.Int64(42)},
+					State: github.String("APPROVED"),
+				}}, emptyResponse, noError)
+			pullRequests.
+				On("Merge", anyContext, repositoryOwner, repositoryName, issueNumber, mock.AnythingOfType("string"),
+					&github.PullRequestOptions{MergeMethod: "squash"}).
+				Run(func(args mock.Arguments) {
+					mergeMessage = args.String(4)
+				}).
+				Return(&github.PullRequestMergeResult{
+					Merged: github.Bool(true),
+				}, emptyResponse, noError)
+			issues.
+				On("RemoveLabelForIssue", anyContext, repositoryOwner, repositoryName, issueNumber, grh.MergingLabel).
+				Return(emptyResponse, noError)
+			gitRepo := new(mocks.Repo)
+			gitRepos.
+				On("GetUpdatedRepo", sshURL, repositoryOwner, repositoryName).
+				Return(gitRepo, noError)
+			gitRepo.On("DeleteRemoteBranch", "feature").Return(noError)
+		})
+
+		It("appends the trailers to the squashed commits' messages", func() {
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			Expect(mergeMessage).To(Equal("* Add the login form\n\n" +
+				"* Fix the login form\n\n" +
+				"Reviewed-by: alice <42+alice@users.noreply.github.com>\n" +
+				"Co-authored-by: Bob <bob@example.com>\n" +
+				"PR: salemove/github-review-helper#7"))
+		})
+	})
+})
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/git"
+)
+
+// trainCars returns the validations of the PRs merging into the base branch
+// in the order they're stacked on each other, the one at the front of the
+// train first. With MERGE_TRAIN, each PR is validated on top of the
+// validation of the PR ahead of it, so that a successful build of a car
+// covers every car ahead of it as well.
+func trainCars(repository Repository, baseRef string, store Store) ([]Validation, *ErrorResponse) {
+	validations, err := store.Validations(repository)
+	if err != nil {
+		message := fmt.Sprintf("Failed to list the validations of %s", repositoryKey(repository))
+		return nil, &ErrorResponse{err, http.StatusInternalServerError, message}
+	}
+	onTrain := make(map[int]bool)
+	behind := make(map[int]Validation)
+	for _, validation := range validations {
+		if validation.BaseRef != baseRef {
+			continue
+		}
+		onTrain[validation.PullRequest] = true
+		if validation.Parent != 0 {
+			behind[validation.Parent] = validation
+		}
+	}
+	var cars []Validation
+	for _, validation := range validations {
+		if validation.BaseRef == baseRef && !onTrain[validation.Parent] {
+			cars = append(cars, validation)
+			break
+		}
+	}
+	for len(cars) > 0 {
+		next, ok := behind[cars[len(cars)-1].PullRequest]
+		if !ok {
+			break
+		}
+		cars = append(cars, next)
+	}
+	return cars, nil
+}
+
+// lockMergeTrain locks the merge train of the base branch, so that only one
+// operation would add, restack or land its cars at a time. The train has to
+// be locked before the PRs on it.
+func lockMergeTrain(repository Repository, baseRef string) (func(), *ErrorResponse) {
+	name := repositoryKey(repository) + ":" + baseRef
+	unlock, err := prLocks.Lock("github-review-helper:train:"+name, prLockWait)
+	if err == ErrPRLocked {
+		message := fmt.Sprintf("The merge train of %s is still being changed by another operation", name)
+		return nil, &ErrorResponse{err, http.StatusConflict, message}
+	} else if err != nil {
+		message := fmt.Sprintf("Failed to lock the merge train of %s", name)
+		return nil, &ErrorResponse{err, http.StatusInternalServerError, message}
+	}
+	return unlock, nil
+}
+
+// joinMergeTrain returns the commit to rebase the PR onto to add it to the
+// end of the merge train of its base branch, along with the PR it's stacked
+// on. If the PR is already on the train with an outdated head, then the cars
+// behind it are stacked again without it first.
+func joinMergeTrain(conf Config, pr *github.PullRequest, gitRepos git.Repos, store Store, issues Issues,
+	pullRequests PullRequests, repositories Repositories) (string, int, *ErrorResponse) {
+
+	issue := prIssue(pr)
+	cars, errResp := trainCars(issue.Repository, *pr.Base.Ref, store)
+	if errResp != nil {
+		return "", 0, errResp
+	}
+	for i, car := range cars {
+		if car.PullRequest != issue.Number {
+			continue
+		}
+		errResp = restackTrainCars(conf, cars[i:], gitRepos, store, issues, pullRequests, repositories)
+		if errResp != nil {
+			return "", 0, errResp
+		}
+		if cars, errResp = trainCars(issue.Repository, *pr.Base.Ref, store); errResp != nil {
+			return "", 0, errResp
+		}
+		break
+	}
+	if len(cars) == 0 {
+		return "origin/" + *pr.Base.Ref, 0, nil
+	}
+	tail := cars[len(cars)-1]
+	return tail.SHA, tail.PullRequest, nil
+}
+
+// restackTrainCars takes the cars off the train and validates the PRs that
+// haven't changed since again at the end of the train, in the same order.
+func restackTrainCars(conf Config, cars []Validation, gitRepos git.Repos, store Store, issues Issues,
+	pullRequests PullRequests, repositories Repositories) *ErrorResponse {
+
+	for _, car := range cars {
+		if errResp := stopValidation(car, gitRepos, store); errResp != nil {
+			return errResp
+		}
+	}
+	for _, car := range cars {
+		pr, errResp := getPR(Issue{Number: car.PullRequest, Repository: car.Repository}, pullRequests)
+		if errResp != nil {
+			return errResp
+		} else if hasChangedSinceValidation(pr, car) {
+			continue
+		}
+		log.Printf("Restacking PR %s in the merge train of %s.\n", prIssue(pr).FullName(), car.BaseRef)
+		if errResp = startValidation(conf, pr, gitRepos, store, issues, pullRequests, repositories); errResp != nil {
+			return errResp
+		}
+	}
+	return nil
+}
+
+// handleTrainConflict gives up on merging the PR, which conflicts with the
+// PRs ahead of it on the merge train. Whether it still conflicts once they
+// have been merged is up to the author to find out.
+func handleTrainConflict(conf Config, issue Issue, baseRef string, issues Issues) *ErrorResponse {
+	log.Printf("PR %s conflicts with the merge train of %s. Removing the '%s' label and notifying the author.\n",
+		issue.FullName(), baseRef, MergingLabel)
+	if errResp := removeLabel(issue.Repository, issue.Number, MergingLabel, issues); errResp != nil {
+		return errResp
+	}
+	sendNotification(conf, NotificationEvent{
+		Type:    FailureEvent,
+		Issue:   issue,
+		Message: fmt.Sprintf("Not merged, because it conflicts with the merge train of `%s`.", baseRef),
+	})
+	message := fmt.Sprintf("I didn't merge this PR, because it conflicts with the PRs ahead of it on the merge "+
+		"train of `%s`. @%s, can you please take a look once they have been merged?", baseRef, issue.User.Login)
+	if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+		errorMessage := fmt.Sprintf("Failed to notify the author of PR %s about the conflict with the merge train",
+			issue.FullName())
+		return &ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	return nil
+}
+
+func hasChangedSinceValidation(pr *github.PullRequest, validation Validation) bool {
+	return *pr.Head.SHA != validation.HeadSHA || *pr.Merged || (pr.State != nil && *pr.State == "closed")
+}
+
+// handleTrainStatus handles the finished validation build of a merge train's
+// car. A successful build lands the car along with every car ahead of it,
+// because it has tested all of them together. A failed build only counts once
+// the car is at the front of the train, because until then the failure may
+// have been caused by a car ahead of it.
+func handleTrainStatus(conf Config, validation Validation, state string, gitRepos git.Repos, store Store,
+	issues Issues, pullRequests PullRequests, repositories Repositories) Response {
+
+	issue := Issue{Number: validation.PullRequest, Repository: validation.Repository}
+	cars, errResp := trainCars(validation.Repository, validation.BaseRef, store)
+	if errResp != nil {
+		return errResp
+	}
+	position := -1
+	for i, car := range cars {
+		if car.PullRequest == validation.PullRequest {
+			position = i
+		}
+	}
+	if position == -1 {
+		return SuccessResponse{fmt.Sprintf("PR %s is no longer on the merge train. Ignoring.", issue.FullName())}
+	} else if cars[0].Parent != 0 {
+		// The car ahead of the train's front left without landing, so every
+		// car includes changes that aren't going to be merged
+		errResp = restackTrainCars(conf, cars, gitRepos, store, issues, pullRequests, repositories)
+		if errResp != nil {
+			return errResp
+		}
+		return SuccessResponse{fmt.Sprintf("Restacked the merge train of %s", validation.BaseRef)}
+	} else if state != "success" && position > 0 {
+		return SuccessResponse{fmt.Sprintf("The validation of PR %s failed behind %d other PRs on the merge "+
+			"train. Waiting for them.", issue.FullName(), position)}
+	}
+	response := landTrainCars(conf, cars, position, state, gitRepos, store, issues, pullRequests, repositories)
+	if _, isError := asErrorResponse(response); isError || position+1 == len(cars) {
+		return response
+	}
+	// The new front of the train may have finished its build already
+	next := cars[position+1]
+	if nextState, errResp := validationState(next, repositories); errResp != nil {
+		return errResp
+	} else if nextState != "pending" {
+		return handleTrainStatus(conf, next, nextState, gitRepos, store, issues, pullRequests, repositories)
+	}
+	return response
+}
+
+// landTrainCars lands the cars up to and including the one at the position,
+// fast-forwarding the base branch past each of them in turn. If a car's PR
+// has changed, a car's own build failed or the base branch has moved on, then
+// the cars behind it are stacked again.
+func landTrainCars(conf Config, cars []Validation, position int, state string, gitRepos git.Repos, store Store,
+	issues Issues, pullRequests PullRequests, repositories Repositories) Response {
+
+	for i, car := range cars[:position+1] {
+		pr, errResp := getPR(Issue{Number: car.PullRequest, Repository: car.Repository}, pullRequests)
+		if errResp != nil {
+			return errResp
+		}
+		if i < position {
+			// The build of a car behind this one doesn't make up for a
+			// failure of this car's own build
+			carState, errResp := validationState(car, repositories)
+			if errResp != nil {
+				return errResp
+			} else if carState == "failure" || carState == "error" {
+				state = carState
+			}
+		}
+		issue := prIssue(pr)
+		if hasChangedSinceValidation(pr, car) {
+			errResp = restackTrainCars(conf, cars[i:], gitRepos, store, issues, pullRequests, repositories)
+			if errResp != nil {
+				return errResp
+			}
+			return SuccessResponse{fmt.Sprintf("PR %s has changed since its validation started. Restacked the "+
+				"merge train behind it.", issue.FullName())}
+		} else if errResp = stopValidation(car, gitRepos, store); errResp != nil {
+			return errResp
+		} else if state != "success" {
+			errResp = restackTrainCars(conf, cars[i+1:], gitRepos, store, issues, pullRequests, repositories)
+			if errResp != nil {
+				return errResp
+			}
+			return handleValidationFailure(conf, issue, car, issues)
+		}
+		if response := landTrainCar(conf, pr, car, gitRepos, store, issues, pullRequests,
+			repositories); response != nil {
+			return response
+		}
+		if i+1 < len(cars) {
+			// The next car is at the front of the train now
+			next := cars[i+1]
+			next.Parent = 0
+			if err := store.AddValidation(next); err != nil {
+				message := fmt.Sprintf("Failed to move PR #%d to the front of the merge train", next.PullRequest)
+				return ErrorResponse{err, http.StatusInternalServerError, message}
+			}
+		}
+	}
+	return SuccessResponse{fmt.Sprintf("Merged %d PRs of the merge train into %s", position+1,
+		cars[position].BaseRef)}
+}
+
+// landTrainCar fast-forwards the base branch to the car's validated commit.
+// If the base branch has moved on, then the car and the cars behind it are
+// stacked again onto the latest base. If pushing fails for another reason,
+// then the car is given up on and only the cars behind it are stacked again.
+// Returns nil, if the car was landed.
+func landTrainCar(conf Config, pr *github.PullRequest, car Validation, gitRepos git.Repos, store Store,
+	issues Issues, pullRequests PullRequests, repositories Repositories) Response {
+
+	unlock, errResp := lockPR(pr)
+	if errResp != nil {
+		return errResp
+	}
+	defer unlock()
+	landed, landingErrResp := fastForwardToValidation(pr, car, gitRepos)
+	if landed {
+		response := completeValidatedMerge(conf, pr, car, gitRepos, store, issues, pullRequests, repositories)
+		if _, isError := asErrorResponse(response); isError {
+			return response
+		}
+		return nil
+	}
+	cars, errResp := trainCars(car.Repository, car.BaseRef, store)
+	if errResp != nil {
+		return errResp
+	}
+	if landingErrResp != nil {
+		errResp = restackTrainCars(conf, cars, gitRepos, store, issues, pullRequests, repositories)
+		if errResp != nil {
+			return errResp
+		}
+		return handleLandingFailure(conf, prIssue(pr), car, landingErrResp, issues)
+	}
+	// The car itself has already been taken off the train
+	errResp = restackTrainCars(conf, append([]Validation{car}, cars...), gitRepos, store, issues, pullRequests,
+		repositories)
+	if errResp != nil {
+		return errResp
+	}
+	return SuccessResponse{fmt.Sprintf("%s has moved on. Restacked the merge train.", car.BaseRef)}
+}
@@ -0,0 +1,284 @@
+package main_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/git"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("merge train", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			store            grh.Store
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+			gitRepos         *mocks.Repos
+			gitRepo          *mocks.Repo
+		)
+
+		// The PR at the front of the train, which issueNumber is stacked on
+		frontNumber := issueNumber + 1
+		frontBranch := fmt.Sprintf("bot/validation/%d-master", frontNumber)
+		frontSHA := "3456"
+		frontPR := &github.PullRequest{
+			Number:    github.Int(frontNumber),
+			Merged:    github.Bool(false),
+			Mergeable: github.Bool(true),
+			Base:      &github.PullRequestBranch{Ref: github.String("master"), Repo: repository},
+			Head: &github.PullRequestBranch{
+				SHA:  github.String("3333"),
+				Ref:  github.String("hotfix"),
+				Repo: repository,
+			},
+			User: &github.User{Login: github.String(arbitraryIssueAuthor)},
+		}
+
+		headSHA := "1235"
+		validationSHA := "2345"
+		validationBranch := fmt.Sprintf("bot/validation/%d-master", issueNumber)
+		pr := &github.PullRequest{
+			Number:    github.Int(issueNumber),
+			Merged:    github.Bool(false),
+			Mergeable: github.Bool(true),
+			Base: &github.PullRequestBranch{
+				SHA:  github.String("1234"),
+				Ref:  github.String("master"),
+				Repo: repository,
+			},
+			Head: &github.PullRequestBranch{
+				SHA:  github.String(headSHA),
+				Ref:  github.String("feature"),
+				Repo: repository,
+			},
+			User: &github.User{Login: github.String(arbitraryIssueAuthor)},
+		}
+
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			store = *context.Store
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+			gitRepos = *context.GitRepos
+			gitRepo = new(mocks.Repo)
+
+			context.Config.MergeStrategy = grh.MergeStrategyVerifiedRebase
+			context.Config.MergeTrain = true
+			context.Config.BotBranchTemplate = "bot/{kind}/{pr}-{target}"
+
+			Expect(store.AddValidation(grh.Validation{
+				Repository:  trackedRepository,
+				PullRequest: frontNumber,
+				Branch:      frontBranch,
+				HeadSHA:     "3333",
+				SHA:         frontSHA,
+				BaseRef:     "master",
+				StartedAt:   time.Now(),
+			})).To(Succeed())
+			gitRepos.
+				On("GetUpdatedRepo", sshURL, repositoryOwner, repositoryName).
+				Return(gitRepo, noError)
+		})
+		AfterEach(func() {
+			gitRepo.AssertExpectations(GinkgoT())
+		})
+
+		Describe("!merge comment", func() {
+			headers.Is(func() map[string]string {
+				return map[string]string{
+					"X-Github-Event": "issue_comment",
+				}
+			})
+			requestJSON.Is(func() string {
+				return IssueCommentEvent("!merge", arbitraryIssueAuthor)
+			})
+
+			BeforeEach(func() {
+				repositories.
+					On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+					Return(true, emptyResponse, noError)
+				issues.
+					On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+						[]string{grh.MergingLabel}).
+					Return(emptyResult, emptyResponse, noError)
+				pullRequests.
+					On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+					Return(pr, emptyResponse, noError)
+				repositories.
+					On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+						mock.AnythingOfType("*github.ListOptions")).
+					Return(&github.CombinedStatus{State: github.String("success")}, emptyResponse, noError)
+				repositories.
+					On("GetRequiredStatusChecks", anyContext, repositoryOwner, repositoryName, "master").
+					Return(&github.RequiredStatusChecks{}, emptyResponse, noError)
+				mockLabels(issues, issueNumber, grh.MergingLabel)
+			})
+
+			It("stacks the PR onto the end of the train", func() {
+				gitRepo.
+					On("RebaseAndPush", frontSHA, headSHA, "origin", validationBranch).
+					Return(validationSHA, noError)
+
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+
+				validations, err := store.Validations(trackedRepository)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(validations).To(HaveLen(2))
+				Expect(validations[1].PullRequest).To(Equal(issueNumber))
+				Expect(validations[1].Parent).To(Equal(frontNumber))
+			})
+
+			Context("with the PR conflicting with the train", func() {
+				BeforeEach(func() {
+					gitRepo.
+						On("RebaseAndPush", frontSHA, headSHA, "origin", validationBranch).
+						Return("", &git.ErrRebaseConflict{Err: errArbitrary})
+					issues.
+						On("RemoveLabelForIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+							grh.MergingLabel).
+						Return(emptyResponse, noError)
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("it conflicts with the PRs ahead of it on the merge "+
+								"train of `master`"))).
+						Return(emptyResult, emptyResponse, noError)
+				})
+
+				It("tells the author and stops merging the PR", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					Expect(store.Validations(trackedRepository)).To(HaveLen(1))
+					issues.AssertExpectations(GinkgoT())
+				})
+			})
+		})
+
+		Describe("status event for a car behind the front of the train", func() {
+			headers.Is(func() map[string]string {
+				return map[string]string{
+					"X-Github-Event": "status",
+				}
+			})
+			requestJSON.Is(func() string {
+				return createStatusEvent(validationSHA, "success", []grh.Branch{{SHA: validationSHA}})
+			})
+
+			mockValidationStatus := func(state string) {
+				BeforeEach(func() {
+					repositories.
+						On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, validationSHA,
+							mock.AnythingOfType("*github.ListOptions")).
+						Return(&github.CombinedStatus{State: github.String(state)}, emptyResponse, noError)
+				})
+			}
+
+			BeforeEach(func() {
+				Expect(store.AddValidation(grh.Validation{
+					Repository:  trackedRepository,
+					PullRequest: issueNumber,
+					Branch:      validationBranch,
+					HeadSHA:     headSHA,
+					SHA:         validationSHA,
+					BaseRef:     "master",
+					Parent:      frontNumber,
+					StartedAt:   time.Now(),
+				})).To(Succeed())
+			})
+
+			Context("with the build having failed", func() {
+				mockValidationStatus("failure")
+
+				It("waits for the cars ahead of it", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					Expect(store.Validations(trackedRepository)).To(HaveLen(2))
+				})
+			})
+
+			Context("with the build having succeeded", func() {
+				mockValidationStatus("success")
+
+				BeforeEach(func() {
+					for _, mergedPR := range []*github.PullRequest{frontPR, pr} {
+						pullRequests.
+							On("Get", anyContext, repositoryOwner, repositoryName, *mergedPR.Number).
+							Return(mergedPR, emptyResponse, noError)
+						issues.
+							On("RemoveLabelForIssue", anyContext, repositoryOwner, repositoryName, *mergedPR.Number,
+								grh.MergingLabel).
+							Return(emptyResponse, noError)
+					}
+					gitRepo.On("DeleteRemoteBranch", frontBranch).Return(noError)
+					gitRepo.On("DeleteRemoteBranch", validationBranch).Return(noError)
+				})
+
+				It("merges every car up to it", func() {
+					repositories.
+						On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, frontSHA,
+							mock.AnythingOfType("*github.ListOptions")).
+						Return(&github.CombinedStatus{State: github.String("pending")}, emptyResponse, noError)
+					gitRepo.On("ForcePush", frontSHA, "origin", "hotfix").Return(noError)
+					gitRepo.On("Push", frontSHA, "origin", "master").Return(noError)
+					gitRepo.On("ForcePush", validationSHA, "origin", "feature").Return(noError)
+					gitRepo.On("Push", validationSHA, "origin", "master").Return(noError)
+
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					Expect(responseRecorder.Body.String()).To(ContainSubstring("Merged 2 PRs of the merge train"))
+					Expect(store.Validations(trackedRepository)).To(BeEmpty())
+				})
+
+				Context("with the build of the car ahead of it having failed", func() {
+					BeforeEach(func() {
+						repositories.
+							On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, frontSHA,
+								mock.AnythingOfType("*github.ListOptions")).
+							Return(&github.CombinedStatus{State: github.String("failure")}, emptyResponse, noError)
+						repositories.
+							On("GetRequiredStatusChecks", anyContext, repositoryOwner, repositoryName, "master").
+							Return(&github.RequiredStatusChecks{}, emptyResponse, noError)
+						issues.
+							On("CreateComment", anyContext, repositoryOwner, repositoryName, frontNumber,
+								mock.MatchedBy(commentContaining("the build of it rebased onto the latest `master` "+
+									"failed"))).
+							Return(emptyResult, emptyResponse, noError)
+						gitRepo.
+							On("RebaseAndPush", "origin/master", headSHA, "origin", validationBranch).
+							Return("4567", noError)
+					})
+
+					It("drops the failed car and restacks the car behind it", func() {
+						handle()
+						Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+						gitRepo.AssertNotCalled(GinkgoT(), "Push", frontSHA, "origin", "master")
+						gitRepo.AssertNotCalled(GinkgoT(), "Push", validationSHA, "origin", "master")
+
+						validations, err := store.Validations(trackedRepository)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(validations).To(HaveLen(1))
+						Expect(validations[0].PullRequest).To(Equal(issueNumber))
+						Expect(validations[0].SHA).To(Equal("4567"))
+						Expect(validations[0].Parent).To(BeZero())
+					})
+				})
+			})
+		})
+	})
+})
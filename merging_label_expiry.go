@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// How often to check for PRs whose merging label has expired
+const mergingLabelExpiryCheckInterval = 10 * time.Minute
+
+// trackMergeRequest remembers when the PR was labeled for merging and by
+// whom, so that the label could be removed once MERGING_LABEL_TTL has passed.
+// A failure is only logged, because it doesn't keep the PR from being merged.
+func trackMergeRequest(conf Config, issue Issue, requestedBy string, store Store) {
+	if isBotLogin(conf, requestedBy) {
+		requestedBy = ""
+	}
+	err := store.AddMergeRequest(MergeRequest{Issue: issue, RequestedBy: requestedBy, LabeledAt: time.Now()})
+	if err != nil {
+		log.Printf("Failed to track the merge request of PR %s: %v\n", issue.FullName(), err)
+	}
+}
+
+func forgetMergeRequest(issue Issue, store Store) {
+	if err := store.RemoveMergeRequest(issue); err != nil {
+		log.Printf("Failed to forget the merge request of PR %s: %v\n", issue.FullName(), err)
+	}
+}
+
+// runMergingLabelExpiry periodically removes the expired merging labels,
+// until stop is closed.
+func runMergingLabelExpiry(configSource ConfigSource, store Store, issues Issues, pullRequests PullRequests,
+	repositories Repositories, graphQL GraphQL, stop <-chan struct{}) {
+
+	ticker := time.NewTicker(mergingLabelExpiryCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			conf := configSource.Current()
+			if conf.MergingLabelTTL == 0 {
+				continue
+			} else if pausedForGithubIncident("merging label expiry") {
+				continue
+			}
+			err := ExpireMergingLabels(conf, store, issues, pullRequests, repositories, graphQL, time.Now())
+			if err != nil {
+				log.Printf("Expiring the merging labels failed: %v\n", err)
+			}
+		}
+	}
+}
+
+// ExpireMergingLabels removes the merging label from the PRs that have been
+// labeled for MERGING_LABEL_TTL without becoming ready to be merged, so that
+// they wouldn't linger in the queue and get merged unexpectedly long after
+// they were labeled. The reason the PR isn't ready is commented on it,
+// mentioning whoever labeled it. PRs that are ready are left alone, because
+// they're about to be merged.
+func ExpireMergingLabels(conf Config, store Store, issues Issues, pullRequests PullRequests,
+	repositories Repositories, graphQL GraphQL, now time.Time) error {
+
+	requests, err := store.MergeRequests()
+	if err != nil {
+		return fmt.Errorf("failed to list the merge requests: %v", err)
+	}
+	for _, request := range requests {
+		if now.Sub(request.LabeledAt) < conf.MergingLabelTTL {
+			continue
+		}
+		if errResp := expireMergingLabel(conf, request, store, issues, pullRequests, repositories,
+			graphQL); errResp != nil {
+			errResp.logResponse()
+		}
+	}
+	return nil
+}
+
+func expireMergingLabel(conf Config, request MergeRequest, store Store, issues Issues, pullRequests PullRequests,
+	repositories Repositories, graphQL GraphQL) *ErrorResponse {
+
+	issue := request.Issue
+	conf, errResp := repositoryConfig(conf, issue.Repository, store)
+	if errResp != nil {
+		return errResp
+	}
+	labels, errResp := getLabels(issue, issues)
+	if errResp != nil {
+		return errResp
+	} else if !containsLabel(labels, MergingLabel) {
+		// The label's removal wasn't noticed
+		forgetMergeRequest(issue, store)
+		return nil
+	}
+	pr, errResp := getPR(issue, pullRequests)
+	if errResp != nil {
+		return errResp
+	} else if pr.GetState() == "closed" {
+		forgetMergeRequest(issue, store)
+		return nil
+	}
+	decision, errResp := evaluate(readinessRules(conf, pr, store, issues, pullRequests, repositories, graphQL),
+		false)
+	if errResp != nil {
+		return errResp
+	}
+	blocker := decision.Blocker()
+	if blocker == nil {
+		return nil
+	}
+	if errResp = removeLabel(issue.Repository, issue.Number, MergingLabel, issues); errResp != nil {
+		return errResp
+	}
+	forgetMergeRequest(issue, store)
+	if err := store.RemoveDeferredMerge(issue); err != nil {
+		log.Printf("Failed to remove the deferred merge of PR %s: %v\n", issue.FullName(), err)
+	}
+	mention := request.RequestedBy
+	if mention == "" {
+		mention = pr.User.GetLogin()
+	}
+	message := fmt.Sprintf("@%s, this PR has been labeled `%s` for %s, but it's still not ready to be merged, "+
+		"because %s. I removed the label, so that it wouldn't be merged unexpectedly later. Please ask me to "+
+		"`!merge` it again once it's ready.", mention, MergingLabel, formatDuration(conf.MergingLabelTTL),
+		blocker.Reason)
+	if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+		errorMessage := fmt.Sprintf("Failed to explain removing the expired merging label of PR %s",
+			issue.FullName())
+		return &ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	log.Printf("Removed the expired '%s' label of PR %s, because %s.\n", MergingLabel, issue.FullName(),
+		blocker.Reason)
+	return nil
+}
@@ -0,0 +1,104 @@
+package main_test
+
+import (
+	"time"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ExpireMergingLabels", func() {
+	var (
+		conf         grh.Config
+		store        grh.Store
+		issues       *mocks.Issues
+		pullRequests *mocks.PullRequests
+		repositories *mocks.Repositories
+		graphQL      *mocks.GraphQL
+		now          time.Time
+
+		labeledIssue = grh.Issue{
+			Number:     issueNumber,
+			Repository: grh.Repository{Owner: repositoryOwner, Name: repositoryName},
+		}
+	)
+
+	BeforeEach(func() {
+		conf = grh.Config{MergingLabelTTL: 24 * time.Hour}
+		store = grh.NewMemoryStore()
+		issues = new(mocks.Issues)
+		pullRequests = new(mocks.PullRequests)
+		repositories = new(mocks.Repositories)
+		graphQL = new(mocks.GraphQL)
+		now = time.Now()
+
+		Expect(store.AddMergeRequest(grh.MergeRequest{
+			Issue:       labeledIssue,
+			RequestedBy: "alice",
+			LabeledAt:   now.Add(-25 * time.Hour),
+		})).To(Succeed())
+	})
+
+	AfterEach(func() {
+		issues.AssertExpectations(GinkgoT())
+	})
+
+	expire := func() {
+		Expect(grh.ExpireMergingLabels(conf, store, issues, pullRequests, repositories, graphQL, now)).To(Succeed())
+	}
+
+	Context("with the PR labeled for less than MERGING_LABEL_TTL", func() {
+		BeforeEach(func() {
+			conf.MergingLabelTTL = 48 * time.Hour
+		})
+
+		It("leaves the PR alone", func() {
+			expire()
+			Expect(store.MergeRequests()).To(HaveLen(1))
+		})
+	})
+
+	Context("with the PR no longer being labeled for merging", func() {
+		BeforeEach(func() {
+			mockLabels(issues, issueNumber)
+		})
+
+		It("forgets the request", func() {
+			expire()
+			Expect(store.MergeRequests()).To(BeEmpty())
+		})
+	})
+
+	Context("with the PR still not being ready to be merged", func() {
+		BeforeEach(func() {
+			mockLabels(issues, issueNumber, grh.MergingLabel)
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+				Return(&github.PullRequest{
+					Number:    github.Int(issueNumber),
+					State:     github.String("open"),
+					Mergeable: github.Bool(false),
+					User:      &github.User{Login: github.String(arbitraryIssueAuthor)},
+				}, emptyResponse, noError)
+			issues.
+				On("RemoveLabelForIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+					grh.MergingLabel).
+				Return(emptyResponse, noError)
+			issues.
+				On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+					mock.MatchedBy(commentContaining("@alice, this PR has been labeled `merging` for 24h0m0s, but "+
+						"it's still not ready to be merged, because it has a merge conflict."))).
+				Return(emptyResult, emptyResponse, noError)
+		})
+
+		It("removes the label and tells the requester why", func() {
+			expire()
+			Expect(store.MergeRequests()).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,113 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("pull_request labeled event", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+
+			label  string
+			sender string
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			label = grh.MergingLabel
+			sender = "procoder"
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "pull_request",
+			}
+		})
+
+		requestJSON.Is(func() string {
+			event := PullRequestEvent("labeled", "1235", grh.Repository{
+				Owner: repositoryOwner,
+				Name:  repositoryName,
+				URL:   sshURL,
+			})
+			return strings.Replace(event, `"action": "labeled",`, `"action": "labeled",
+  "label": {"name": "`+label+`"},
+  "sender": {"login": "`+sender+`"},`, 1)
+		})
+
+		Context("with the merging label added by a user", func() {
+			BeforeEach(func() {
+				pullRequests.
+					On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+					Return(&github.PullRequest{
+						Merged:    github.Bool(false),
+						Mergeable: github.Bool(false),
+					}, emptyResponse, noError)
+			})
+
+			It("checks whether the PR can be merged", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				pullRequests.AssertCalled(GinkgoT(), "Get", anyContext, repositoryOwner, repositoryName,
+					issueNumber)
+			})
+		})
+
+		Context("with the merging label added by a bot", func() {
+			BeforeEach(func() {
+				sender = "review-helper"
+				context.Config.BotLogins = []string{"review-helper"}
+			})
+
+			It("ignores the event", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(responseRecorder.Body.String()).To(ContainSubstring("Ignoring"))
+				pullRequests.AssertNotCalled(GinkgoT(), "Get", anyContext, repositoryOwner, repositoryName,
+					issueNumber)
+			})
+		})
+
+		Context("with the merging label added by the bot itself", func() {
+			BeforeEach(func() {
+				sender = "review-helper"
+				context.Config.BotLogin = "review-helper"
+			})
+
+			It("ignores the event", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(responseRecorder.Body.String()).To(ContainSubstring("Ignoring"))
+				pullRequests.AssertNotCalled(GinkgoT(), "Get", anyContext, repositoryOwner, repositoryName,
+					issueNumber)
+			})
+		})
+
+		Context("with another label added", func() {
+			BeforeEach(func() {
+				label = "bug"
+			})
+
+			It("ignores the event", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(responseRecorder.Body.String()).To(ContainSubstring("Ignoring"))
+			})
+		})
+	})
+})
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/google/go-github/github"
+)
+
+// The names of the messages whose templates can be customized
+const (
+	mergeConflictMessage          = "merge_conflict"
+	outsideCollaboratorMessage    = "outside_collaborator"
+	unauthorizedMessage           = "unauthorized"
+	insufficientPermissionMessage = "insufficient_permission"
+	rateLimitedMessage            = "rate_limited"
+	mergeQueueFullMessage         = "merge_queue_full"
+	diskFullMessage               = "disk_full"
+	firstTimeContributorMessage   = "first_time_contributor"
+	claUnsignedMessage            = "cla_unsigned"
+	helpMessage                   = "help"
+	// commentMessage wraps every comment the bot posts, including the ones
+	// above, e.g. to add a footer with a link to an internal runbook
+	commentMessage = "comment"
+)
+
+var defaultMessageTemplates = map[string]string{
+	mergeConflictMessage: "I'm unable to merge this PR because of a merge conflict. @{{.Author}}, can you please " +
+		"take a look?",
+	outsideCollaboratorMessage: "I'm sorry, @{{.Commenter}}. Only collaborators can ask me to do that.",
+	unauthorizedMessage:        "I'm sorry, @{{.Commenter}}. I'm afraid I can't do that.",
+	insufficientPermissionMessage: "I'm sorry, @{{.Commenter}}. Only {{.Details.Required}} can ask me to " +
+		"`{{.Details.Command}}` here.",
+	rateLimitedMessage: "@{{.Commenter}}, you've issued more than {{.Details.Limit}} commands in " +
+		"{{.Details.Period}}. I'll ignore your commands in this repository for a while.",
+	mergeQueueFullMessage: "@{{.Commenter}}, the merge queue is full with {{.Details.Depth}} PRs, so I can't " +
+		"queue this PR right now. Merging them should take about {{.Details.Wait}}. Please try again later.",
+	diskFullMessage: "@{{.Author}}, I'm unable to clone this repository, because the disk I keep my clones on is " +
+		"full. I'll make room by removing the clones I haven't used in a while. Please try again later.",
+	firstTimeContributorMessage: "Welcome, @{{.Author}}, and thank you for your first contribution! A maintainer " +
+		"will review it soon.{{if .Details.ApprovalRequired}} Until a maintainer approves it with " +
+		"`!approve-contributor`, I won't squash, deploy or merge it.{{end}}",
+	claUnsignedMessage: "@{{.Author}}, thank you for the PR! Before it can be merged, you need to sign our " +
+		"Contributor License Agreement{{if .Details.SignURL}} at {{.Details.SignURL}}{{end}}. Once you've signed " +
+		"it, comment `!cla-signed` and I'll check again.",
+	helpMessage: "I'm github-review-helper {{.Version}} and I understand these commands:\n" +
+		"{{range .Details.Commands}}\n- `{{.Usage}}` - {{.Description}}{{end}}",
+	commentMessage: "{{.Details.Message}}",
+}
+
+var parsedDefaultMessageTemplates = mustParseMessageTemplates(defaultMessageTemplates)
+
+// MessageTemplates maps the names of messages to the templates that replace
+// their default texts.
+type MessageTemplates map[string]*template.Template
+
+// MessageData is what the message templates can refer to. The fields that
+// don't apply to a message are left empty.
+type MessageData struct {
+	Repository Repository
+	// PR is the number of the PR the message is posted on
+	PR int
+	// Author is the login of the PR's author
+	Author    string
+	Commenter string
+	Version   string
+	// Details holds the values specific to the message, e.g. the depth of
+	// the merge queue
+	Details map[string]interface{}
+}
+
+// LoadMessageTemplates reads a JSON object of message names and templates
+// from the file, e.g. {"merge_conflict": "@{{.Author}}, please rebase."}.
+func LoadMessageTemplates(path string) (MessageTemplates, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var templateStrings map[string]string
+	if err = json.Unmarshal(content, &templateStrings); err != nil {
+		return nil, err
+	}
+	return ParseMessageTemplates(templateStrings)
+}
+
+// ParseMessageTemplates parses the templates of the named messages. Unknown
+// message names are rejected, so that typos wouldn't go unnoticed.
+func ParseMessageTemplates(templateStrings map[string]string) (MessageTemplates, error) {
+	templates := MessageTemplates{}
+	for name, templateString := range templateStrings {
+		if _, exists := defaultMessageTemplates[name]; !exists {
+			return nil, fmt.Errorf("unknown message \"%s\", expected one of %s", name,
+				strings.Join(messageNames(), ", "))
+		}
+		tmpl, err := template.New(name).Option("missingkey=error").Parse(templateString)
+		if err != nil {
+			return nil, err
+		}
+		templates[name] = tmpl
+	}
+	return templates, nil
+}
+
+func mustParseMessageTemplates(templateStrings map[string]string) MessageTemplates {
+	templates, err := ParseMessageTemplates(templateStrings)
+	if err != nil {
+		panic(err)
+	}
+	return templates
+}
+
+func messageNames() []string {
+	names := make([]string, 0, len(defaultMessageTemplates))
+	for name := range defaultMessageTemplates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// renderMessage renders the configured template of the message or its
+// default one. The default is also used if the configured template fails, so
+// that the message would still be posted.
+func renderMessage(conf Config, name string, data MessageData) string {
+	if tmpl, ok := conf.MessageTemplates[name]; ok {
+		message, err := executeMessageTemplate(tmpl, data)
+		if err == nil {
+			return message
+		}
+		log.Printf("Failed to render the %s message template, using the default: %v\n", name, err)
+	}
+	message, err := executeMessageTemplate(parsedDefaultMessageTemplates[name], data)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to render the default %s message: %v", name, err))
+	}
+	return message
+}
+
+// commandMessageData describes the PR a command was issued on. The PR's
+// author is the user the command is issued on behalf of.
+func commandMessageData(issueComment IssueComment, details map[string]interface{}) MessageData {
+	return MessageData{
+		Repository: issueComment.Repository,
+		PR:         issueComment.IssueNumber,
+		Author:     issueComment.User.Login,
+		Commenter:  issueComment.Commenter.Login,
+		Version:    version,
+		Details:    details,
+	}
+}
+
+// templateComments returns issues that render the body of every comment
+// they post with the comment template, if one is configured.
+func templateComments(configSource ConfigSource, issues Issues) Issues {
+	return templatedIssues{configSource, issues}
+}
+
+type templatedIssues struct {
+	configSource ConfigSource
+	Issues
+}
+
+func (t templatedIssues) CreateComment(ctx context.Context, owner string, repo string, number int,
+	comment *github.IssueComment) (*github.IssueComment, *github.Response, error) {
+
+	conf := t.configSource.Current()
+	if _, isCustomized := conf.MessageTemplates[commentMessage]; isCustomized {
+		templated := *comment
+		templated.Body = github.String(renderMessage(conf, commentMessage, MessageData{
+			Repository: Repository{Owner: owner, Name: repo},
+			PR:         number,
+			Version:    version,
+			Details:    map[string]interface{}{"Message": comment.GetBody()},
+		}))
+		comment = &templated
+	}
+	return t.Issues.CreateComment(ctx, owner, repo, number, comment)
+}
+
+func executeMessageTemplate(tmpl *template.Template, data MessageData) (string, error) {
+	var buffer bytes.Buffer
+	if err := tmpl.Execute(&buffer, data); err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
@@ -0,0 +1,60 @@
+package main_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	grh "github.com/salemove/github-review-helper"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LoadMessageTemplates", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "message-templates")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	load := func(content string) (grh.MessageTemplates, error) {
+		path := filepath.Join(dir, "messages.json")
+		Expect(ioutil.WriteFile(path, []byte(content), 0600)).To(Succeed())
+		return grh.LoadMessageTemplates(path)
+	}
+
+	It("parses the templates of the known messages", func() {
+		templates, err := load(`{"merge_conflict": "@{{.Author}}, see https://wiki.example.com/conflicts"}`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(templates).To(HaveKey("merge_conflict"))
+	})
+
+	It("fails for unknown messages", func() {
+		_, err := load(`{"merge_conflicts": "@{{.Author}}, please rebase."}`)
+		Expect(err).To(MatchError(ContainSubstring("unknown message \"merge_conflicts\"")))
+	})
+
+	It("fails for invalid templates", func() {
+		_, err := load(`{"merge_conflict": "@{{.Author}, please rebase."}`)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("ParseMessageTemplates", func() {
+	It("rejects templates referring to missing details when rendered", func() {
+		templates, err := grh.ParseMessageTemplates(map[string]string{
+			"rate_limited": "@{{.Commenter}}, slow down for {{.Details.Cooldown}}.",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(templates["rate_limited"].Execute(ioutil.Discard, grh.MessageData{
+			Details: map[string]interface{}{"Limit": 5},
+		})).NotTo(Succeed())
+	})
+})
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// GitHub rejects titles that are longer
+const maxTitleLength = 256
+
+// parseTitleCommand parses a "!title <new title>" command and returns the new
+// title. The title has to fit on the command's line.
+func parseTitleCommand(comment string) (string, bool) {
+	comment = strings.TrimSpace(comment)
+	if !strings.HasPrefix(comment, "!title") || strings.Contains(comment, "\n") {
+		return "", false
+	}
+	rest := strings.TrimPrefix(comment, "!title")
+	title := strings.TrimSpace(rest)
+	if title == "" || title == rest {
+		// Either there's no title or the command is e.g. "!titles"
+		return "", false
+	}
+	return title, true
+}
+
+func isTitleCommand(comment string) bool {
+	_, isTitle := parseTitleCommand(comment)
+	return isTitle
+}
+
+func isLabelCommand(comment string) bool {
+	fields := strings.Fields(comment)
+	return len(fields) >= 2 && fields[0] == "!label"
+}
+
+// handleTitleCommand renames the PR. The rename triggers an edited event,
+// which re-checks the title against the configured rules.
+func handleTitleCommand(issueComment IssueComment, issues Issues) Response {
+	issue := issueComment.Issue()
+	title, _ := parseTitleCommand(issueComment.Comment)
+	if len([]rune(title)) > maxTitleLength {
+		message := fmt.Sprintf("@%s, I couldn't rename this PR, because the title is longer than %d characters.",
+			issueComment.Commenter.Login, maxTitleLength)
+		if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+			errorMessage := fmt.Sprintf("Failed to report the invalid title of PR %s", issue.FullName())
+			return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+		}
+		return SuccessResponse{fmt.Sprintf("The new title of PR %s is too long. Ignoring.", issue.FullName())}
+	}
+	_, _, err := issues.Edit(context.TODO(), issue.Repository.Owner, issue.Repository.Name, issue.Number,
+		&github.IssueRequest{Title: github.String(title)})
+	if err != nil {
+		message := fmt.Sprintf("Failed to rename PR %s", issue.FullName())
+		return ErrorResponse{err, http.StatusBadGateway, message}
+	}
+	return SuccessResponse{fmt.Sprintf("Renamed PR %s to %q", issue.FullName(), title)}
+}
+
+// handleLabelCommand adds the labels prefixed with + to the PR and removes the
+// ones prefixed with -, e.g. "!label +bug -feature". Labels that are already
+// in the desired state are left alone. The labels the bot manages itself
+// have their own commands, so they're reported back along with the arguments
+// it didn't understand. Only maintainers can add the SKIP_LABELS, because the
+// bot adds the labels as itself, so the label event doesn't say who asked for
+// them.
+func handleLabelCommand(conf Config, issueComment IssueComment, issues Issues, graphQL GraphQL) Response {
+	issue := issueComment.Issue()
+	var toAdd, toRemove, invalidArguments, managedLabels, skipLabels []string
+	for _, argument := range strings.Fields(issueComment.Comment)[1:] {
+		if len(argument) < 2 || (argument[0] != '+' && argument[0] != '-') {
+			invalidArguments = append(invalidArguments, argument)
+			continue
+		}
+		label := argument[1:]
+		switch {
+		case label == MergingLabel || label == OnHoldLabel || label == PriorityLabel:
+			managedLabels = append(managedLabels, label)
+		case argument[0] == '+' && !issueComment.HasLabel(label) && isSkipLabel(conf, label):
+			skipLabels = append(skipLabels, label)
+		case argument[0] == '+' && !issueComment.HasLabel(label):
+			toAdd = append(toAdd, label)
+		case argument[0] == '-' && issueComment.HasLabel(label):
+			toRemove = append(toRemove, label)
+		}
+	}
+
+	if len(skipLabels) > 0 {
+		isAllowed, err := isMaintainer(issue.Repository, issueComment.Commenter.Login, graphQL)
+		if err != nil {
+			message := fmt.Sprintf("Failed to check if %s can skip the checks of PR %s",
+				issueComment.Commenter.Login, issue.FullName())
+			return ErrorResponse{err, http.StatusBadGateway, message}
+		} else if isAllowed {
+			toAdd, skipLabels = append(toAdd, skipLabels...), nil
+		}
+	}
+	if len(toAdd) > 0 {
+		_, _, err := issues.AddLabelsToIssue(context.TODO(), issue.Repository.Owner, issue.Repository.Name,
+			issue.Number, toAdd)
+		if err != nil {
+			message := fmt.Sprintf("Failed to add the labels %s to PR %s", strings.Join(toAdd, ", "),
+				issue.FullName())
+			return ErrorResponse{err, http.StatusBadGateway, message}
+		}
+	}
+	for _, label := range toRemove {
+		if errResp := removeLabel(issue.Repository, issue.Number, label, issues); errResp != nil {
+			return errResp
+		}
+	}
+	var problems []string
+	if len(invalidArguments) > 0 {
+		problems = append(problems, fmt.Sprintf("I didn't understand %s. Prefix the labels with + to add them "+
+			"or with - to remove them, e.g. `!label +bug -feature`.", formatLabels(invalidArguments)))
+	}
+	if len(managedLabels) > 0 {
+		problems = append(problems, fmt.Sprintf("I didn't change %s, because I manage those myself. Use `!merge`, "+
+			"`!hold`, `!unhold` and `!priority` instead.", formatLabels(managedLabels)))
+	}
+	if len(skipLabels) > 0 {
+		problems = append(problems, fmt.Sprintf("I didn't add %s, because only maintainers can skip checks.",
+			formatLabels(skipLabels)))
+	}
+	if len(problems) > 0 {
+		message := fmt.Sprintf("@%s, %s", issueComment.Commenter.Login, strings.Join(problems, " "))
+		if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+			errorMessage := fmt.Sprintf("Failed to report the invalid labels of PR %s", issue.FullName())
+			return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+		}
+	}
+	return SuccessResponse{fmt.Sprintf("Added %d and removed %d labels on PR %s", len(toAdd), len(toRemove),
+		issue.FullName())}
+}
+
+func formatLabels(labels []string) string {
+	return "`" + strings.Join(labels, "`, `") + "`"
+}
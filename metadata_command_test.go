@@ -0,0 +1,233 @@
+package main_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	var (
+		handle      = context.Handle
+		headers     = context.Headers
+		requestJSON = context.RequestJSON
+
+		responseRecorder *httptest.ResponseRecorder
+		issues           *mocks.Issues
+		graphQL          *mocks.GraphQL
+	)
+	BeforeEach(func() {
+		responseRecorder = *context.ResponseRecorder
+		issues = *context.Issues
+		graphQL = *context.GraphQL
+	})
+
+	headers.Is(func() map[string]string {
+		return map[string]string{
+			"X-Github-Event": "issue_comment",
+		}
+	})
+
+	Describe("!title comment", func() {
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!title  Fix the login form ", arbitraryIssueAuthor)
+		})
+
+		ForCollaborator(context, repositoryOwner, repositoryName, arbitraryIssueAuthor, func() {
+			Context("with renaming failing", func() {
+				BeforeEach(func() {
+					issues.
+						On("Edit", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.AnythingOfType("*github.IssueRequest")).
+						Return(emptyResult, emptyResponse, errArbitrary)
+				})
+
+				It("fails with a gateway error", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusBadGateway))
+				})
+			})
+
+			Context("with renaming succeeding", func() {
+				BeforeEach(func() {
+					issues.
+						On("Edit", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(func(issueRequest *github.IssueRequest) bool {
+								return *issueRequest.Title == "Fix the login form" && issueRequest.Body == nil
+							})).
+						Return(emptyResult, emptyResponse, noError)
+				})
+
+				It("renames the PR", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					Expect(responseRecorder.Body.String()).To(ContainSubstring("Renamed PR"))
+				})
+			})
+		})
+	})
+
+	Describe("!title comment without a title", func() {
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!title", arbitraryIssueAuthor)
+		})
+
+		It("is ignored", func() {
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			Expect(responseRecorder.Body.String()).To(ContainSubstring("Not a command I understand"))
+		})
+	})
+
+	Describe("!title comment with a too long title by someone other than the PR's author", func() {
+		requestJSON.Is(func() string {
+			return withCommenter(IssueCommentEvent("!title "+strings.Repeat("a", 257), arbitraryIssueAuthor),
+				"reviewer")
+		})
+
+		ForCollaborator(context, repositoryOwner, repositoryName, arbitraryIssueAuthor, func() {
+			BeforeEach(func() {
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("@reviewer, I couldn't rename this PR"))).
+					Return(emptyResult, emptyResponse, noError)
+			})
+
+			It("tells the commenter that the title is too long", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertNotCalled(GinkgoT(), "Edit", anyContext, repositoryOwner, repositoryName, issueNumber,
+					mock.Anything)
+			})
+		})
+	})
+
+	Describe("!label comment", func() {
+		requestJSON.Is(func() string {
+			return IssueCommentEventWithLabels("!label +bug +docs -feature -wontfix +"+grh.MergingLabel+" bug",
+				arbitraryIssueAuthor, []string{"docs", "feature"})
+		})
+
+		ForCollaborator(context, repositoryOwner, repositoryName, arbitraryIssueAuthor, func() {
+			Context("with labeling failing", func() {
+				BeforeEach(func() {
+					issues.
+						On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+							[]string{"bug"}).
+						Return(emptyResult, emptyResponse, errArbitrary)
+				})
+
+				It("fails with a gateway error", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusBadGateway))
+				})
+			})
+
+			Context("with labeling succeeding", func() {
+				BeforeEach(func() {
+					issues.
+						On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+							[]string{"bug"}).
+						Return(emptyResult, emptyResponse, noError).
+						Once()
+					issues.
+						On("RemoveLabelForIssue", anyContext, repositoryOwner, repositoryName, issueNumber, "feature").
+						Return(emptyResponse, noError).
+						Once()
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("I didn't understand `bug`. Prefix the labels with + "+
+								"to add them or with - to remove them, e.g. `!label +bug -feature`. I didn't change "+
+								"`merging`, because I manage those myself."))).
+						Return(emptyResult, emptyResponse, noError)
+				})
+
+				It("changes only the labels that aren't in the desired state yet and reports the rest", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					Expect(responseRecorder.Body.String()).To(ContainSubstring("Added 1 and removed 1 labels"))
+				})
+			})
+		})
+	})
+
+	Describe("!label comment adding a skip label", func() {
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!label +vendored", arbitraryIssueAuthor)
+		})
+
+		mockRole := func(permission string) {
+			data, err := json.Marshal(map[string]interface{}{
+				"repository": map[string]interface{}{
+					"collaborators": map[string]interface{}{
+						"edges": []interface{}{
+							map[string]interface{}{
+								"permission": permission,
+								"node":       map[string]string{"login": arbitraryIssueAuthor},
+							},
+						},
+					},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			graphQL.
+				On("Query", anyContext, mock.MatchedBy(func(q string) bool {
+					return strings.Contains(q, "collaborators")
+				}), mock.Anything, mock.Anything).
+				Return(noError).
+				Run(func(args mock.Arguments) {
+					Expect(json.Unmarshal(data, args.Get(3))).To(Succeed())
+				})
+		}
+
+		BeforeEach(func() {
+			context.Config.SkipLabels = map[string][]string{"vendored": {"squash"}}
+		})
+
+		ForCollaborator(context, repositoryOwner, repositoryName, arbitraryIssueAuthor, func() {
+			Context("by a maintainer", func() {
+				BeforeEach(func() {
+					mockRole("MAINTAIN")
+					issues.
+						On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+							[]string{"vendored"}).
+						Return(emptyResult, emptyResponse, noError).
+						Once()
+				})
+
+				It("adds the label", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertExpectations(GinkgoT())
+				})
+			})
+
+			Context("by a user with the write role", func() {
+				BeforeEach(func() {
+					mockRole("WRITE")
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("I didn't add `vendored`, because only maintainers can "+
+								"skip checks."))).
+						Return(emptyResult, emptyResponse, noError)
+				})
+
+				It("refuses to add the label", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertNotCalled(GinkgoT(), "AddLabelsToIssue", anyContext, repositoryOwner, repositoryName,
+						issueNumber, mock.Anything)
+				})
+			})
+		})
+	})
+})
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/google/go-github/github"
+)
+
+// assignMilestone sets the merged PR's milestone to the repository's open
+// milestone matching the configured pattern. If several milestones match,
+// the one due the soonest is used, as GitHub lists them by their due dates.
+// If none match, a milestone with the configured title is created. PRs that
+// already have a milestone keep it.
+func assignMilestone(conf Config, pr *github.PullRequest, issues Issues) error {
+	if conf.MilestonePattern == nil || pr.Milestone != nil {
+		return nil
+	}
+	issue := prIssue(pr)
+	milestone, err := findMilestone(conf, issue.Repository, issues)
+	if err != nil {
+		return fmt.Errorf("failed to list the milestones of %s: %v", repositoryKey(issue.Repository), err)
+	} else if milestone == nil {
+		if conf.MilestoneTitle == "" {
+			log.Printf("No open milestone of %s matches. Not assigning one to PR %s.\n",
+				repositoryKey(issue.Repository), issue.FullName())
+			return nil
+		}
+		milestone, _, err = issues.CreateMilestone(context.TODO(), issue.Repository.Owner, issue.Repository.Name,
+			&github.Milestone{Title: github.String(conf.MilestoneTitle)})
+		if err != nil {
+			return fmt.Errorf("failed to create milestone %s in %s: %v", conf.MilestoneTitle,
+				repositoryKey(issue.Repository), err)
+		}
+	}
+	_, _, err = issues.Edit(context.TODO(), issue.Repository.Owner, issue.Repository.Name, issue.Number,
+		&github.IssueRequest{Milestone: milestone.Number})
+	if err != nil {
+		return fmt.Errorf("failed to set the milestone of PR %s: %v", issue.FullName(), err)
+	}
+	log.Printf("Added PR %s to milestone %s.\n", issue.FullName(), milestone.GetTitle())
+	return nil
+}
+
+// findMilestone returns the first open milestone matching the configured
+// pattern or nil, if none match.
+func findMilestone(conf Config, repository Repository, issues Issues) (*github.Milestone, error) {
+	options := &github.MilestoneListOptions{
+		State:       "open",
+		Sort:        "due_on",
+		Direction:   "asc",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		milestones, resp, err := issues.ListMilestones(context.TODO(), repository.Owner, repository.Name, options)
+		if err != nil {
+			return nil, err
+		}
+		for _, milestone := range milestones {
+			if conf.MilestonePattern.MatchString(milestone.GetTitle()) {
+				return milestone, nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return nil, nil
+		}
+		options.Page = resp.NextPage
+	}
+}
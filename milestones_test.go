@@ -0,0 +1,183 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("milestone assignment", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+			gitRepos         *mocks.Repos
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+			gitRepos = *context.GitRepos
+
+			context.Config.MilestonePattern = regexp.MustCompile(`^v[0-9]+\.[0-9]+$`)
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!merge", arbitraryIssueAuthor)
+		})
+
+		headSHA := "1235"
+		pr := &github.PullRequest{
+			Number:    github.Int(issueNumber),
+			Merged:    github.Bool(false),
+			Mergeable: github.Bool(true),
+			Base: &github.PullRequestBranch{
+				SHA:  github.String("1234"),
+				Ref:  github.String("master"),
+				Repo: repository,
+			},
+			Head: &github.PullRequestBranch{
+				SHA:  github.String(headSHA),
+				Ref:  github.String("feature"),
+				Repo: repository,
+			},
+			User: &github.User{
+				Login: github.String(arbitraryIssueAuthor),
+			},
+		}
+
+		BeforeEach(func() {
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+			issues.
+				On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{grh.MergingLabel}).
+				Return(emptyResult, emptyResponse, noError)
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+				Return(pr, emptyResponse, noError)
+			repositories.
+				On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.AnythingOfType("*github.ListOptions")).
+				Return(&github.CombinedStatus{
+					State: github.String("success"),
+				}, emptyResponse, noError)
+			mockLabels(issues, issueNumber, grh.MergingLabel)
+			pullRequests.
+				On("Merge", anyContext, repositoryOwner, repositoryName, issueNumber, "", noSquashOpts).
+				Return(&github.PullRequestMergeResult{
+					Merged: github.Bool(true),
+					SHA:    github.String("abc123"),
+				}, emptyResponse, noError)
+			issues.
+				On("RemoveLabelForIssue", anyContext, repositoryOwner, repositoryName, issueNumber, grh.MergingLabel).
+				Return(emptyResponse, noError)
+			gitRepo := new(mocks.Repo)
+			gitRepos.
+				On("GetUpdatedRepo", sshURL, repositoryOwner, repositoryName).
+				Return(gitRepo, noError)
+			gitRepo.On("DeleteRemoteBranch", "feature").Return(noError)
+		})
+
+		setsMilestone := func(number int) {
+			issues.
+				On("Edit", anyContext, repositoryOwner, repositoryName, issueNumber,
+					&github.IssueRequest{Milestone: github.Int(number)}).
+				Return(emptyResult, emptyResponse, noError).
+				Once()
+		}
+
+		Context("with a matching open milestone", func() {
+			BeforeEach(func() {
+				issues.
+					On("ListMilestones", anyContext, repositoryOwner, repositoryName,
+						mock.AnythingOfType("*github.MilestoneListOptions")).
+					Return([]*github.Milestone{
+						{Number: github.Int(3), Title: github.String("Backlog")},
+						{Number: github.Int(4), Title: github.String("v1.2")},
+						{Number: github.Int(5), Title: github.String("v1.3")},
+					}, emptyResponse, noError)
+				setsMilestone(4)
+			})
+
+			It("adds the PR to the milestone due the soonest", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+			})
+		})
+
+		Context("without a matching open milestone", func() {
+			BeforeEach(func() {
+				issues.
+					On("ListMilestones", anyContext, repositoryOwner, repositoryName,
+						mock.AnythingOfType("*github.MilestoneListOptions")).
+					Return([]*github.Milestone{
+						{Number: github.Int(3), Title: github.String("Backlog")},
+					}, emptyResponse, noError)
+			})
+
+			Context("with a milestone title configured", func() {
+				BeforeEach(func() {
+					context.Config.MilestoneTitle = "v2.0"
+					issues.
+						On("CreateMilestone", anyContext, repositoryOwner, repositoryName,
+							&github.Milestone{Title: github.String("v2.0")}).
+						Return(&github.Milestone{Number: github.Int(6), Title: github.String("v2.0")},
+							emptyResponse, noError).
+						Once()
+					setsMilestone(6)
+				})
+
+				It("creates the milestone and adds the PR to it", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertExpectations(GinkgoT())
+				})
+			})
+
+			Context("without a milestone title configured", func() {
+				It("merges the PR without a milestone", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertNotCalled(GinkgoT(), "Edit", anyContext, repositoryOwner, repositoryName,
+						issueNumber, mock.Anything)
+				})
+			})
+		})
+
+		Context("with listing the milestones failing", func() {
+			BeforeEach(func() {
+				issues.
+					On("ListMilestones", anyContext, repositoryOwner, repositoryName,
+						mock.AnythingOfType("*github.MilestoneListOptions")).
+					Return(nil, emptyResponse, errArbitrary)
+			})
+
+			It("still merges the PR", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				pullRequests.AssertExpectations(GinkgoT())
+			})
+		})
+	})
+})
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// How often to check the PRs that are force-waiting for their statuses
+const forceWaitCheckInterval = time.Minute
+
+const checkRunsQuery = `query($owner: String!, $name: String!, $sha: GitObjectID!) {
+  repository(owner: $owner, name: $name) {
+    object(oid: $sha) {
+      ... on Commit {
+        checkSuites(first: 100) {
+          nodes {
+            checkRuns(first: 100) {
+              nodes {
+                name
+                conclusion
+              }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+// successfulCheckConclusions are the conclusions with which a check run
+// satisfies a required context
+var successfulCheckConclusions = map[string]bool{
+	"SUCCESS": true,
+	"NEUTRAL": true,
+	"SKIPPED": true,
+}
+
+// missingRequiredContexts returns the status contexts the branch protection
+// of the PR's base branch requires, but that haven't been reported for the
+// PR's head at all, neither as statuses nor as successful check runs. GitHub
+// keeps such PRs from being merged, no matter how long the bot waits for
+// them.
+func missingRequiredContexts(pr *github.PullRequest, statuses []github.RepoStatus, repositories Repositories,
+	graphQL GraphQL) ([]string, *ErrorResponse) {
+
+	requiredContexts, errResp := getRequiredStatusContexts(pr, repositories)
+	if errResp != nil {
+		return nil, errResp
+	}
+	reported := make(map[string]bool, len(statuses))
+	for _, status := range statuses {
+		reported[status.GetContext()] = true
+	}
+	var missing []string
+	for _, context := range requiredContexts {
+		if !reported[context] {
+			missing = append(missing, context)
+		}
+	}
+	if len(missing) == 0 {
+		return missing, nil
+	}
+	checkRuns, err := successfulCheckRuns(baseRepository(pr), pr.Head.GetSHA(), graphQL)
+	if err != nil {
+		message := fmt.Sprintf("Failed to get the check runs of PR %s", prIssue(pr).FullName())
+		return nil, &ErrorResponse{err, http.StatusBadGateway, message}
+	}
+	var unsatisfied []string
+	for _, context := range missing {
+		if !checkRuns[context] {
+			unsatisfied = append(unsatisfied, context)
+		}
+	}
+	return unsatisfied, nil
+}
+
+// successfulCheckRuns returns the names of the check runs on the commit that
+// have completed successfully.
+func successfulCheckRuns(repository Repository, sha string, graphQL GraphQL) (map[string]bool, error) {
+	var result struct {
+		Repository struct {
+			Object struct {
+				CheckSuites struct {
+					Nodes []struct {
+						CheckRuns struct {
+							Nodes []struct {
+								Name       string `json:"name"`
+								Conclusion string `json:"conclusion"`
+							} `json:"nodes"`
+						} `json:"checkRuns"`
+					} `json:"nodes"`
+				} `json:"checkSuites"`
+			} `json:"object"`
+		} `json:"repository"`
+	}
+	err := graphQL.Query(context.TODO(), checkRunsQuery, map[string]interface{}{
+		"owner": repository.Owner,
+		"name":  repository.Name,
+		"sha":   sha,
+	}, &result)
+	if _, isUnsupported := asUnsupported(err); isUnsupported {
+		// The providers without GraphQL have no check runs either
+		return map[string]bool{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	successful := make(map[string]bool)
+	for _, suite := range result.Repository.Object.CheckSuites.Nodes {
+		for _, run := range suite.CheckRuns.Nodes {
+			if successfulCheckConclusions[run.Conclusion] {
+				successful[run.Name] = true
+			}
+		}
+	}
+	return successful, nil
+}
+
+// reportMissingContexts tells the PR's author which required contexts the PR
+// is waiting on, if CI hasn't reported some of them, and returns whether
+// any are missing. Every head is only commented on once, so that the status
+// updates and the polling of "!merge force-wait" wouldn't repeat it.
+func reportMissingContexts(conf Config, pr *github.PullRequest, statuses []github.RepoStatus, store Store,
+	issues Issues, repositories Repositories, graphQL GraphQL) (bool, *ErrorResponse) {
+
+	if !conf.ReportMissingContexts {
+		return false, nil
+	}
+	missing, errResp := missingRequiredContexts(pr, statuses, repositories, graphQL)
+	if errResp != nil {
+		return false, errResp
+	} else if len(missing) == 0 {
+		return false, nil
+	}
+	description := "waiting on contexts: " + strings.Join(missing, ", ")
+	reportMergeStatus(conf, pr, description, statuses, repositories)
+	issue := prIssue(pr)
+	isNew, err := store.RecordRefusal(issue, pr.Head.GetSHA()+" "+description)
+	if err != nil {
+		message := fmt.Sprintf("Failed to record the missing contexts of PR %s", issue.FullName())
+		return false, &ErrorResponse{err, http.StatusInternalServerError, message}
+	} else if !isNew {
+		return true, nil
+	}
+	message := fmt.Sprintf("I'm waiting on the required statuses %s, which haven't been reported for %s. If CI "+
+		"isn't going to report them, fix the CI configuration or the branch protection. Comment `!merge "+
+		"force-wait` to keep checking for them for %s.", formatContexts(missing), shortSHA(pr.Head.GetSHA()),
+		formatDuration(conf.ForceWaitTimeout))
+	if err = stickyComment(conf, message, issue, store, issues); err != nil {
+		errorMessage := fmt.Sprintf("Failed to report the missing contexts of PR %s", issue.FullName())
+		return false, &ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	return true, nil
+}
+
+// addForceWait starts polling the PR for its missing statuses for
+// FORCE_WAIT_TIMEOUT.
+func addForceWait(conf Config, issue Issue, store Store) *ErrorResponse {
+	err := store.AddForceWait(ForceWait{
+		Issue: issue,
+		Until: time.Now().Add(conf.ForceWaitTimeout),
+	})
+	if err != nil {
+		message := fmt.Sprintf("Failed to start waiting for the statuses of PR %s", issue.FullName())
+		return &ErrorResponse{err, http.StatusInternalServerError, message}
+	}
+	return nil
+}
+
+// runForceWaits periodically polls the PRs that are force-waiting for their
+// statuses, until stop is closed.
+func runForceWaits(store Store, merge func(Issue) Response, issues Issues, stop <-chan struct{}) {
+	ticker := time.NewTicker(forceWaitCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := PollForceWaits(store, merge, issues, time.Now()); err != nil {
+				log.Printf("Polling the force-waiting PRs failed: %v\n", err)
+			}
+		}
+	}
+}
+
+// PollForceWaits tries to merge the PRs that are force-waiting for their
+// statuses, in case the statuses were reported without the bot noticing.
+// PRs whose wait has timed out are no longer polled and, if they're still
+// labeled for merging, the timeout is commented on them. Merged and closed
+// PRs stop waiting when they're closed.
+func PollForceWaits(store Store, merge func(Issue) Response, issues Issues, now time.Time) error {
+	waits, err := store.ForceWaits()
+	if err != nil {
+		return fmt.Errorf("failed to list the force-waits: %v", err)
+	}
+	for _, wait := range waits {
+		issue := wait.Issue
+		if now.Before(wait.Until) {
+			merge(issue).logResponse()
+			continue
+		}
+		if err = store.RemoveForceWait(issue); err != nil {
+			return fmt.Errorf("failed to stop waiting for the statuses of PR %s: %v", issue.FullName(), err)
+		}
+		log.Printf("Stopped waiting for the statuses of PR %s.\n", issue.FullName())
+		labels, errResp := getLabels(issue, issues)
+		if errResp != nil {
+			errResp.logResponse()
+			continue
+		} else if !containsLabel(labels, MergingLabel) {
+			continue
+		}
+		message := "I stopped waiting for the missing statuses of this PR. I'll still merge it, if CI reports " +
+			"them. Comment `!merge force-wait` to keep checking for them."
+		if err = comment(message, issue.Repository, issue.Number, issues); err != nil {
+			log.Printf("Failed to report the end of the force-wait of PR %s: %v\n", issue.FullName(), err)
+		}
+	}
+	return nil
+}
+
+func formatContexts(contexts []string) string {
+	return "`" + strings.Join(contexts, "`, `") + "`"
+}
@@ -0,0 +1,212 @@
+package main_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PollForceWaits", func() {
+	var (
+		store        grh.Store
+		issues       *mocks.Issues
+		mergedIssues []grh.Issue
+		now          time.Time
+
+		waitingIssue = grh.Issue{
+			Number:     issueNumber,
+			Repository: grh.Repository{Owner: repositoryOwner, Name: repositoryName},
+			User:       grh.User{Login: arbitraryIssueAuthor},
+		}
+		merge = func(issue grh.Issue) grh.Response {
+			mergedIssues = append(mergedIssues, issue)
+			return grh.SuccessResponse{}
+		}
+	)
+
+	BeforeEach(func() {
+		store = grh.NewMemoryStore()
+		issues = new(mocks.Issues)
+		mergedIssues = nil
+		now = time.Now()
+
+		Expect(store.AddForceWait(grh.ForceWait{Issue: waitingIssue, Until: now.Add(time.Hour)})).To(Succeed())
+	})
+
+	AfterEach(func() {
+		issues.AssertExpectations(GinkgoT())
+	})
+
+	Context("with the wait still being active", func() {
+		It("tries to merge the PR", func() {
+			Expect(grh.PollForceWaits(store, merge, issues, now)).To(Succeed())
+			Expect(mergedIssues).To(Equal([]grh.Issue{waitingIssue}))
+			Expect(store.ForceWaits()).To(HaveLen(1))
+		})
+	})
+
+	Context("with the wait having timed out", func() {
+		BeforeEach(func() {
+			now = now.Add(2 * time.Hour)
+		})
+
+		Context("with the PR still being labeled for merging", func() {
+			BeforeEach(func() {
+				mockLabels(issues, issueNumber, grh.MergingLabel)
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("stopped waiting"))).
+					Return(emptyResult, emptyResponse, noError)
+			})
+
+			It("stops waiting and reports it", func() {
+				Expect(grh.PollForceWaits(store, merge, issues, now)).To(Succeed())
+				Expect(mergedIssues).To(BeEmpty())
+				Expect(store.ForceWaits()).To(BeEmpty())
+			})
+		})
+
+		Context("with the PR no longer being labeled for merging", func() {
+			BeforeEach(func() {
+				mockLabels(issues, issueNumber)
+			})
+
+			It("stops waiting silently", func() {
+				Expect(grh.PollForceWaits(store, merge, issues, now)).To(Succeed())
+				Expect(mergedIssues).To(BeEmpty())
+				Expect(store.ForceWaits()).To(BeEmpty())
+			})
+		})
+	})
+})
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("missing required contexts", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+			graphQL          *mocks.GraphQL
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+			graphQL = *context.GraphQL
+
+			context.Config.ReportMissingContexts = true
+		})
+
+		headSHA := "1235"
+		pr := &github.PullRequest{
+			Number:    github.Int(issueNumber),
+			Merged:    github.Bool(false),
+			Mergeable: github.Bool(true),
+			Base: &github.PullRequestBranch{
+				SHA:  github.String("1234"),
+				Ref:  github.String("master"),
+				Repo: repository,
+			},
+			Head: &github.PullRequestBranch{
+				SHA:  github.String(headSHA),
+				Ref:  github.String("feature"),
+				Repo: repository,
+			},
+			User: &github.User{
+				Login: github.String(arbitraryIssueAuthor),
+			},
+		}
+
+		queryContaining := func(text string) interface{} {
+			return mock.MatchedBy(func(query string) bool { return strings.Contains(query, text) })
+		}
+
+		mockCheckRuns := func(data string) {
+			graphQL.
+				On("Query", anyContext, queryContaining("checkRuns("), mock.Anything, mock.Anything).
+				Return(noError).
+				Run(func(args mock.Arguments) {
+					Expect(json.Unmarshal([]byte(data), args.Get(3))).To(Succeed())
+				})
+		}
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!merge", arbitraryIssueAuthor)
+		})
+
+		BeforeEach(func() {
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+			issues.
+				On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{grh.MergingLabel}).
+				Return(emptyResult, emptyResponse, noError)
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+				Return(pr, emptyResponse, noError)
+			repositories.
+				On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+					mock.AnythingOfType("*github.ListOptions")).
+				Return(&github.CombinedStatus{State: github.String("pending")}, emptyResponse, noError)
+			repositories.
+				On("GetRequiredStatusChecks", anyContext, repositoryOwner, repositoryName, "master").
+				Return(&github.RequiredStatusChecks{Contexts: []string{"ci"}}, emptyResponse, noError)
+		})
+
+		Context("with the required context satisfied by a check run", func() {
+			BeforeEach(func() {
+				mockCheckRuns(`{"repository": {"object": {"checkSuites": {"nodes": [
+					{"checkRuns": {"nodes": [{"name": "ci", "conclusion": "SUCCESS"}]}}
+				]}}}}`)
+			})
+
+			It("doesn't report the context as missing", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(responseRecorder.Body.String()).To(ContainSubstring("has pending statuses"))
+				issues.AssertNotCalled(GinkgoT(), "CreateComment", anyContext, repositoryOwner, repositoryName,
+					issueNumber, mock.Anything)
+			})
+		})
+
+		Context("with the required context reported neither as a status nor as a check run", func() {
+			BeforeEach(func() {
+				mockCheckRuns(`{"repository": {"object": {"checkSuites": {"nodes": [
+					{"checkRuns": {"nodes": [{"name": "lint", "conclusion": "SUCCESS"}]}}
+				]}}}}`)
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("I'm waiting on the required statuses `ci`"))).
+					Return(emptyResult, emptyResponse, noError).
+					Once()
+			})
+
+			It("reports the context as missing", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(responseRecorder.Body.String()).To(ContainSubstring("waiting on required statuses"))
+			})
+		})
+	})
+})
@@ -0,0 +1,29 @@
+package mocks
+
+import "github.com/stretchr/testify/mock"
+
+import "context"
+
+type AuthorAssociations struct {
+	mock.Mock
+}
+
+func (_m *AuthorAssociations) AuthorAssociation(ctx context.Context, owner string, repo string, username string) (string, error) {
+	ret := _m.Called(ctx, owner, repo, username)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) string); ok {
+		r0 = rf(ctx, owner, repo, username)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string) error); ok {
+		r1 = rf(ctx, owner, repo, username)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
@@ -0,0 +1,22 @@
+package mocks
+
+import "github.com/stretchr/testify/mock"
+
+import "context"
+
+type GraphQL struct {
+	mock.Mock
+}
+
+func (_m *GraphQL) Query(ctx context.Context, query string, variables map[string]interface{}, result interface{}) error {
+	ret := _m.Called(ctx, query, variables, result)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, map[string]interface{}, interface{}) error); ok {
+		r0 = rf(ctx, query, variables, result)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
@@ -91,3 +91,285 @@ func (_m *Issues) CreateComment(ctx context.Context, owner string, repo string,
 
 	return r0, r1, r2
 }
+func (_m *Issues) EditComment(ctx context.Context, owner string, repo string, id int64, comment *github.IssueComment) (*github.IssueComment, *github.Response, error) {
+	ret := _m.Called(ctx, owner, repo, id, comment)
+
+	var r0 *github.IssueComment
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int64, *github.IssueComment) *github.IssueComment); ok {
+		r0 = rf(ctx, owner, repo, id, comment)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*github.IssueComment)
+		}
+	}
+
+	var r1 *github.Response
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, int64, *github.IssueComment) *github.Response); ok {
+		r1 = rf(ctx, owner, repo, id, comment)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*github.Response)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string, string, int64, *github.IssueComment) error); ok {
+		r2 = rf(ctx, owner, repo, id, comment)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+func (_m *Issues) ListLabelsByIssue(ctx context.Context, owner string, repo string, number int, opt *github.ListOptions) ([]*github.Label, *github.Response, error) {
+	ret := _m.Called(ctx, owner, repo, number, opt)
+
+	var r0 []*github.Label
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int, *github.ListOptions) []*github.Label); ok {
+		r0 = rf(ctx, owner, repo, number, opt)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*github.Label)
+		}
+	}
+
+	var r1 *github.Response
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, int, *github.ListOptions) *github.Response); ok {
+		r1 = rf(ctx, owner, repo, number, opt)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*github.Response)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string, string, int, *github.ListOptions) error); ok {
+		r2 = rf(ctx, owner, repo, number, opt)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+func (_m *Issues) AddAssignees(ctx context.Context, owner string, repo string, number int, assignees []string) (*github.Issue, *github.Response, error) {
+	ret := _m.Called(ctx, owner, repo, number, assignees)
+
+	var r0 *github.Issue
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int, []string) *github.Issue); ok {
+		r0 = rf(ctx, owner, repo, number, assignees)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*github.Issue)
+		}
+	}
+
+	var r1 *github.Response
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, int, []string) *github.Response); ok {
+		r1 = rf(ctx, owner, repo, number, assignees)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*github.Response)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string, string, int, []string) error); ok {
+		r2 = rf(ctx, owner, repo, number, assignees)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+func (_m *Issues) RemoveAssignees(ctx context.Context, owner string, repo string, number int, assignees []string) (*github.Issue, *github.Response, error) {
+	ret := _m.Called(ctx, owner, repo, number, assignees)
+
+	var r0 *github.Issue
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int, []string) *github.Issue); ok {
+		r0 = rf(ctx, owner, repo, number, assignees)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*github.Issue)
+		}
+	}
+
+	var r1 *github.Response
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, int, []string) *github.Response); ok {
+		r1 = rf(ctx, owner, repo, number, assignees)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*github.Response)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string, string, int, []string) error); ok {
+		r2 = rf(ctx, owner, repo, number, assignees)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+func (_m *Issues) ListByRepo(ctx context.Context, owner string, repo string, opt *github.IssueListByRepoOptions) ([]*github.Issue, *github.Response, error) {
+	ret := _m.Called(ctx, owner, repo, opt)
+
+	var r0 []*github.Issue
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, *github.IssueListByRepoOptions) []*github.Issue); ok {
+		r0 = rf(ctx, owner, repo, opt)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*github.Issue)
+		}
+	}
+
+	var r1 *github.Response
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, *github.IssueListByRepoOptions) *github.Response); ok {
+		r1 = rf(ctx, owner, repo, opt)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*github.Response)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string, string, *github.IssueListByRepoOptions) error); ok {
+		r2 = rf(ctx, owner, repo, opt)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+func (_m *Issues) Edit(ctx context.Context, owner string, repo string, number int, issue *github.IssueRequest) (*github.Issue, *github.Response, error) {
+	ret := _m.Called(ctx, owner, repo, number, issue)
+
+	var r0 *github.Issue
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int, *github.IssueRequest) *github.Issue); ok {
+		r0 = rf(ctx, owner, repo, number, issue)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*github.Issue)
+		}
+	}
+
+	var r1 *github.Response
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, int, *github.IssueRequest) *github.Response); ok {
+		r1 = rf(ctx, owner, repo, number, issue)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*github.Response)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string, string, int, *github.IssueRequest) error); ok {
+		r2 = rf(ctx, owner, repo, number, issue)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+func (_m *Issues) ListMilestones(ctx context.Context, owner string, repo string, opt *github.MilestoneListOptions) ([]*github.Milestone, *github.Response, error) {
+	ret := _m.Called(ctx, owner, repo, opt)
+
+	var r0 []*github.Milestone
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, *github.MilestoneListOptions) []*github.Milestone); ok {
+		r0 = rf(ctx, owner, repo, opt)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*github.Milestone)
+		}
+	}
+
+	var r1 *github.Response
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, *github.MilestoneListOptions) *github.Response); ok {
+		r1 = rf(ctx, owner, repo, opt)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*github.Response)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string, string, *github.MilestoneListOptions) error); ok {
+		r2 = rf(ctx, owner, repo, opt)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+func (_m *Issues) CreateMilestone(ctx context.Context, owner string, repo string, milestone *github.Milestone) (*github.Milestone, *github.Response, error) {
+	ret := _m.Called(ctx, owner, repo, milestone)
+
+	var r0 *github.Milestone
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, *github.Milestone) *github.Milestone); ok {
+		r0 = rf(ctx, owner, repo, milestone)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*github.Milestone)
+		}
+	}
+
+	var r1 *github.Response
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, *github.Milestone) *github.Response); ok {
+		r1 = rf(ctx, owner, repo, milestone)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*github.Response)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string, string, *github.Milestone) error); ok {
+		r2 = rf(ctx, owner, repo, milestone)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+func (_m *Issues) Lock(ctx context.Context, owner string, repo string, number int, opt *github.LockIssueOptions) (*github.Response, error) {
+	ret := _m.Called(ctx, owner, repo, number, opt)
+
+	var r0 *github.Response
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int, *github.LockIssueOptions) *github.Response); ok {
+		r0 = rf(ctx, owner, repo, number, opt)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*github.Response)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, int, *github.LockIssueOptions) error); ok {
+		r1 = rf(ctx, owner, repo, number, opt)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+func (_m *Issues) Unlock(ctx context.Context, owner string, repo string, number int) (*github.Response, error) {
+	ret := _m.Called(ctx, owner, repo, number)
+
+	var r0 *github.Response
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int) *github.Response); ok {
+		r0 = rf(ctx, owner, repo, number)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*github.Response)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, int) error); ok {
+		r1 = rf(ctx, owner, repo, number)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
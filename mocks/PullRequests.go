@@ -100,3 +100,153 @@ func (_m *PullRequests) Merge(ctx context.Context, owner string, repo string, nu
 
 	return r0, r1, r2
 }
+func (_m *PullRequests) ListReviews(ctx context.Context, owner string, repo string, number int, opt *github.ListOptions) ([]*github.PullRequestReview, *github.Response, error) {
+	ret := _m.Called(ctx, owner, repo, number, opt)
+
+	var r0 []*github.PullRequestReview
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int, *github.ListOptions) []*github.PullRequestReview); ok {
+		r0 = rf(ctx, owner, repo, number, opt)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*github.PullRequestReview)
+		}
+	}
+
+	var r1 *github.Response
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, int, *github.ListOptions) *github.Response); ok {
+		r1 = rf(ctx, owner, repo, number, opt)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*github.Response)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string, string, int, *github.ListOptions) error); ok {
+		r2 = rf(ctx, owner, repo, number, opt)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+func (_m *PullRequests) ListFiles(ctx context.Context, owner string, repo string, number int, opt *github.ListOptions) ([]*github.CommitFile, *github.Response, error) {
+	ret := _m.Called(ctx, owner, repo, number, opt)
+
+	var r0 []*github.CommitFile
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int, *github.ListOptions) []*github.CommitFile); ok {
+		r0 = rf(ctx, owner, repo, number, opt)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*github.CommitFile)
+		}
+	}
+
+	var r1 *github.Response
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, int, *github.ListOptions) *github.Response); ok {
+		r1 = rf(ctx, owner, repo, number, opt)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*github.Response)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string, string, int, *github.ListOptions) error); ok {
+		r2 = rf(ctx, owner, repo, number, opt)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+func (_m *PullRequests) RequestReviewers(ctx context.Context, owner string, repo string, number int, reviewers github.ReviewersRequest) (*github.PullRequest, *github.Response, error) {
+	ret := _m.Called(ctx, owner, repo, number, reviewers)
+
+	var r0 *github.PullRequest
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int, github.ReviewersRequest) *github.PullRequest); ok {
+		r0 = rf(ctx, owner, repo, number, reviewers)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*github.PullRequest)
+		}
+	}
+
+	var r1 *github.Response
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, int, github.ReviewersRequest) *github.Response); ok {
+		r1 = rf(ctx, owner, repo, number, reviewers)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*github.Response)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string, string, int, github.ReviewersRequest) error); ok {
+		r2 = rf(ctx, owner, repo, number, reviewers)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+func (_m *PullRequests) Create(ctx context.Context, owner string, repo string, pull *github.NewPullRequest) (*github.PullRequest, *github.Response, error) {
+	ret := _m.Called(ctx, owner, repo, pull)
+
+	var r0 *github.PullRequest
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, *github.NewPullRequest) *github.PullRequest); ok {
+		r0 = rf(ctx, owner, repo, pull)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*github.PullRequest)
+		}
+	}
+
+	var r1 *github.Response
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, *github.NewPullRequest) *github.Response); ok {
+		r1 = rf(ctx, owner, repo, pull)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*github.Response)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string, string, *github.NewPullRequest) error); ok {
+		r2 = rf(ctx, owner, repo, pull)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+func (_m *PullRequests) CreateReview(ctx context.Context, owner string, repo string, number int, review *github.PullRequestReviewRequest) (*github.PullRequestReview, *github.Response, error) {
+	ret := _m.Called(ctx, owner, repo, number, review)
+
+	var r0 *github.PullRequestReview
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int, *github.PullRequestReviewRequest) *github.PullRequestReview); ok {
+		r0 = rf(ctx, owner, repo, number, review)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*github.PullRequestReview)
+		}
+	}
+
+	var r1 *github.Response
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, int, *github.PullRequestReviewRequest) *github.Response); ok {
+		r1 = rf(ctx, owner, repo, number, review)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*github.Response)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string, string, int, *github.PullRequestReviewRequest) error); ok {
+		r2 = rf(ctx, owner, repo, number, review)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
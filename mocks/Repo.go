@@ -18,12 +18,24 @@ func (_m *Repo) Fetch() error {
 
 	return r0
 }
-func (_m *Repo) AutosquashAndPush(upstreamRef string, branchRef string, destinationRef string) error {
-	ret := _m.Called(upstreamRef, branchRef, destinationRef)
+func (_m *Repo) AutosquashAndPush(upstreamRef string, branchRef string, remote string, destinationRef string) error {
+	ret := _m.Called(upstreamRef, branchRef, remote, destinationRef)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(string, string, string) error); ok {
-		r0 = rf(upstreamRef, branchRef, destinationRef)
+	if rf, ok := ret.Get(0).(func(string, string, string, string) error); ok {
+		r0 = rf(upstreamRef, branchRef, remote, destinationRef)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+func (_m *Repo) SquashAndPush(upstreamRef string, branchRef string, count int, message string, remote string, destinationRef string) error {
+	ret := _m.Called(upstreamRef, branchRef, count, message, remote, destinationRef)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, int, string, string, string) error); ok {
+		r0 = rf(upstreamRef, branchRef, count, message, remote, destinationRef)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -42,3 +54,135 @@ func (_m *Repo) DeleteRemoteBranch(remoteRef string) error {
 
 	return r0
 }
+func (_m *Repo) RunCommand(ref string, command string, env []string) error {
+	ret := _m.Called(ref, command, env)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, []string) error); ok {
+		r0 = rf(ref, command, env)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+func (_m *Repo) FetchRemote(name string, url string) error {
+	ret := _m.Called(name, url)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(name, url)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+func (_m *Repo) Push(ref string, remote string, destinationRef string) error {
+	ret := _m.Called(ref, remote, destinationRef)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, string) error); ok {
+		r0 = rf(ref, remote, destinationRef)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+func (_m *Repo) CherryPickAndPush(upstreamRef string, commit string, remote string, destinationRef string) error {
+	ret := _m.Called(upstreamRef, commit, remote, destinationRef)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, string, string) error); ok {
+		r0 = rf(upstreamRef, commit, remote, destinationRef)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+func (_m *Repo) CherryPickOntoBranch(commits []string, remote string, branch string) ([]string, error) {
+	ret := _m.Called(commits, remote, branch)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func([]string, string, string) []string); ok {
+		r0 = rf(commits, remote, branch)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func([]string, string, string) error); ok {
+		r1 = rf(commits, remote, branch)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+func (_m *Repo) RevertAndPush(upstreamRef string, commit string, remote string, destinationRef string) error {
+	ret := _m.Called(upstreamRef, commit, remote, destinationRef)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, string, string) error); ok {
+		r0 = rf(upstreamRef, commit, remote, destinationRef)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+func (_m *Repo) ForcePush(ref string, remote string, destinationRef string) error {
+	ret := _m.Called(ref, remote, destinationRef)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, string) error); ok {
+		r0 = rf(ref, remote, destinationRef)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+func (_m *Repo) RebaseOntoAndPush(upstreamRef string, oldBaseRef string, branchRef string, remote string, destinationRef string) (string, error) {
+	ret := _m.Called(upstreamRef, oldBaseRef, branchRef, remote, destinationRef)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(string, string, string, string, string) string); ok {
+		r0 = rf(upstreamRef, oldBaseRef, branchRef, remote, destinationRef)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, string, string, string) error); ok {
+		r1 = rf(upstreamRef, oldBaseRef, branchRef, remote, destinationRef)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+func (_m *Repo) RebaseAndPush(upstreamRef string, branchRef string, remote string, destinationRef string) (string, error) {
+	ret := _m.Called(upstreamRef, branchRef, remote, destinationRef)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(string, string, string, string) string); ok {
+		r0 = rf(upstreamRef, branchRef, remote, destinationRef)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, string, string) error); ok {
+		r1 = rf(upstreamRef, branchRef, remote, destinationRef)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
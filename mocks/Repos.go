@@ -1,5 +1,8 @@
 package mocks
 
+import "context"
+import "time"
+
 import "github.com/salemove/github-review-helper/git"
 import "github.com/stretchr/testify/mock"
 
@@ -26,3 +29,64 @@ func (_m *Repos) GetUpdatedRepo(url string, repoOwner string, repoName string) (
 
 	return r0, r1
 }
+func (_m *Repos) PruneStaleRefs() error {
+	ret := _m.Called()
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func() error); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+func (_m *Repos) States() []git.RepoState {
+	ret := _m.Called()
+
+	var r0 []git.RepoState
+	if rf, ok := ret.Get(0).(func() []git.RepoState); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]git.RepoState)
+		}
+	}
+
+	return r0
+}
+func (_m *Repos) RemoveIdleRepos(maxIdle time.Duration) ([]string, error) {
+	ret := _m.Called(maxIdle)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(time.Duration) []string); ok {
+		r0 = rf(maxIdle)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(time.Duration) error); ok {
+		r1 = rf(maxIdle)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+func (_m *Repos) WithContext(ctx context.Context) git.Repos {
+	ret := _m.Called(ctx)
+
+	var r0 git.Repos
+	if rf, ok := ret.Get(0).(func(context.Context) git.Repos); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(git.Repos)
+		}
+	}
+
+	return r0
+}
@@ -70,6 +70,66 @@ func (_m *Repositories) GetCombinedStatus(ctx context.Context, owner string, rep
 
 	return r0, r1, r2
 }
+func (_m *Repositories) Get(ctx context.Context, owner string, repo string) (*github.Repository, *github.Response, error) {
+	ret := _m.Called(ctx, owner, repo)
+
+	var r0 *github.Repository
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) *github.Repository); ok {
+		r0 = rf(ctx, owner, repo)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*github.Repository)
+		}
+	}
+
+	var r1 *github.Response
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) *github.Response); ok {
+		r1 = rf(ctx, owner, repo)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*github.Response)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string, string) error); ok {
+		r2 = rf(ctx, owner, repo)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+func (_m *Repositories) CompareCommits(ctx context.Context, owner string, repo string, base string, head string) (*github.CommitsComparison, *github.Response, error) {
+	ret := _m.Called(ctx, owner, repo, base, head)
+
+	var r0 *github.CommitsComparison
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string, string) *github.CommitsComparison); ok {
+		r0 = rf(ctx, owner, repo, base, head)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*github.CommitsComparison)
+		}
+	}
+
+	var r1 *github.Response
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string, string) *github.Response); ok {
+		r1 = rf(ctx, owner, repo, base, head)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*github.Response)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string, string, string, string) error); ok {
+		r2 = rf(ctx, owner, repo, base, head)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
 func (_m *Repositories) IsCollaborator(ctx context.Context, owner string, repo string, user string) (bool, *github.Response, error) {
 	ret := _m.Called(ctx, owner, repo, user)
 
@@ -98,3 +158,214 @@ func (_m *Repositories) IsCollaborator(ctx context.Context, owner string, repo s
 
 	return r0, r1, r2
 }
+func (_m *Repositories) GetRequiredStatusChecks(ctx context.Context, owner string, repo string, branch string) (*github.RequiredStatusChecks, *github.Response, error) {
+	ret := _m.Called(ctx, owner, repo, branch)
+
+	var r0 *github.RequiredStatusChecks
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) *github.RequiredStatusChecks); ok {
+		r0 = rf(ctx, owner, repo, branch)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*github.RequiredStatusChecks)
+		}
+	}
+
+	var r1 *github.Response
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string) *github.Response); ok {
+		r1 = rf(ctx, owner, repo, branch)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*github.Response)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string, string, string) error); ok {
+		r2 = rf(ctx, owner, repo, branch)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+func (_m *Repositories) ListReleases(ctx context.Context, owner string, repo string, opt *github.ListOptions) ([]*github.RepositoryRelease, *github.Response, error) {
+	ret := _m.Called(ctx, owner, repo, opt)
+
+	var r0 []*github.RepositoryRelease
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, *github.ListOptions) []*github.RepositoryRelease); ok {
+		r0 = rf(ctx, owner, repo, opt)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*github.RepositoryRelease)
+		}
+	}
+
+	var r1 *github.Response
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, *github.ListOptions) *github.Response); ok {
+		r1 = rf(ctx, owner, repo, opt)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*github.Response)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string, string, *github.ListOptions) error); ok {
+		r2 = rf(ctx, owner, repo, opt)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+func (_m *Repositories) CreateRelease(ctx context.Context, owner string, repo string, release *github.RepositoryRelease) (*github.RepositoryRelease, *github.Response, error) {
+	ret := _m.Called(ctx, owner, repo, release)
+
+	var r0 *github.RepositoryRelease
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, *github.RepositoryRelease) *github.RepositoryRelease); ok {
+		r0 = rf(ctx, owner, repo, release)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*github.RepositoryRelease)
+		}
+	}
+
+	var r1 *github.Response
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, *github.RepositoryRelease) *github.Response); ok {
+		r1 = rf(ctx, owner, repo, release)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*github.Response)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string, string, *github.RepositoryRelease) error); ok {
+		r2 = rf(ctx, owner, repo, release)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+func (_m *Repositories) EditRelease(ctx context.Context, owner string, repo string, id int, release *github.RepositoryRelease) (*github.RepositoryRelease, *github.Response, error) {
+	ret := _m.Called(ctx, owner, repo, id, release)
+
+	var r0 *github.RepositoryRelease
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int, *github.RepositoryRelease) *github.RepositoryRelease); ok {
+		r0 = rf(ctx, owner, repo, id, release)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*github.RepositoryRelease)
+		}
+	}
+
+	var r1 *github.Response
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, int, *github.RepositoryRelease) *github.Response); ok {
+		r1 = rf(ctx, owner, repo, id, release)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*github.Response)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string, string, int, *github.RepositoryRelease) error); ok {
+		r2 = rf(ctx, owner, repo, id, release)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+func (_m *Repositories) CreateComment(ctx context.Context, owner string, repo string, sha string, comment *github.RepositoryComment) (*github.RepositoryComment, *github.Response, error) {
+	ret := _m.Called(ctx, owner, repo, sha, comment)
+
+	var r0 *github.RepositoryComment
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string, *github.RepositoryComment) *github.RepositoryComment); ok {
+		r0 = rf(ctx, owner, repo, sha, comment)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*github.RepositoryComment)
+		}
+	}
+
+	var r1 *github.Response
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string, *github.RepositoryComment) *github.Response); ok {
+		r1 = rf(ctx, owner, repo, sha, comment)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*github.Response)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string, string, string, *github.RepositoryComment) error); ok {
+		r2 = rf(ctx, owner, repo, sha, comment)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+func (_m *Repositories) CreateDeployment(ctx context.Context, owner string, repo string, request *github.DeploymentRequest) (*github.Deployment, *github.Response, error) {
+	ret := _m.Called(ctx, owner, repo, request)
+
+	var r0 *github.Deployment
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, *github.DeploymentRequest) *github.Deployment); ok {
+		r0 = rf(ctx, owner, repo, request)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*github.Deployment)
+		}
+	}
+
+	var r1 *github.Response
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, *github.DeploymentRequest) *github.Response); ok {
+		r1 = rf(ctx, owner, repo, request)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*github.Response)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string, string, *github.DeploymentRequest) error); ok {
+		r2 = rf(ctx, owner, repo, request)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+func (_m *Repositories) Merge(ctx context.Context, owner string, repo string, request *github.RepositoryMergeRequest) (*github.RepositoryCommit, *github.Response, error) {
+	ret := _m.Called(ctx, owner, repo, request)
+
+	var r0 *github.RepositoryCommit
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, *github.RepositoryMergeRequest) *github.RepositoryCommit); ok {
+		r0 = rf(ctx, owner, repo, request)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*github.RepositoryCommit)
+		}
+	}
+
+	var r1 *github.Response
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, *github.RepositoryMergeRequest) *github.Response); ok {
+		r1 = rf(ctx, owner, repo, request)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*github.Response)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string, string, *github.RepositoryMergeRequest) error); ok {
+		r2 = rf(ctx, owner, repo, request)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
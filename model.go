@@ -17,28 +17,142 @@ type (
 	}
 
 	IssueComment struct {
+		// Action is either "created", "edited" or "deleted"
+		Action        string
 		IssueNumber   int
 		Comment       string
 		IsPullRequest bool
+		Labels        []string
 		Repository    Repository
-		User          User
+		User          User // The author of the PR
+		Commenter     User
+		// CommenterAssociation is the commenter's author_association with
+		// the repository, e.g. "MEMBER" or "CONTRIBUTOR"
+		CommenterAssociation string
+		// CommentNodeID is the comment's GraphQL ID
+		CommentNodeID string
+		// PreviousComment is the comment before it was edited, if Action is
+		// "edited"
+		PreviousComment string
+	}
+
+	CommitComment struct {
+		SHA        string // The commented commit
+		Comment    string
+		Repository Repository
+		Commenter  User
 	}
 
 	PullRequestEvent struct {
 		IssueNumber int
 		Action      string
+		Merged      bool
 		Head        PullRequestBranch
+		Base        PullRequestBranch
 		Repository  Repository
 		User        User
+		// RequestedReviewer is only set for "review_requested" and
+		// "review_request_removed" actions. Requests for teams are ignored.
+		RequestedReviewer User
+		// RequestedReviewers are the users whose reviews are pending on the
+		// PR
+		RequestedReviewers []User
+		Labels             []string
+		Title              string
+		Body               string
+		// Before is the previous head commit of the PR. It's only set for
+		// "synchronize" actions.
+		Before string
+		// Label is the label that was added or removed. It's only set for
+		// "labeled" and "unlabeled" actions.
+		Label string
+		// Sender is the user whose action triggered the event
+		Sender User
+		// DequeueReason is why GitHub's merge queue removed the PR, e.g.
+		// "CI_FAILURE". It's only set for "dequeued" actions.
+		DequeueReason string
+		// AuthorAssociation is the PR author's author_association with the
+		// repository, e.g. "FIRST_TIME_CONTRIBUTOR"
+		AuthorAssociation string
+		// PreviousBaseRef is the base branch the PR had before it was
+		// retargeted. It's only set for "edited" actions that changed the
+		// base branch.
+		PreviousBaseRef string
+	}
+
+	PullRequestReviewEvent struct {
+		IssueNumber int
+		Action      string
+		State       string
+		Labels      []string
+		Repository  Repository
+		User        User // The author of the PR
+		Reviewer    User
+		// Body is the review's summary comment, which may be a command
+		Body string
+		// ReviewerAssociation is the reviewer's author_association with the
+		// repository
+		ReviewerAssociation string
+		// ReviewNodeID is the review's GraphQL ID
+		ReviewNodeID string
+	}
+
+	// PullRequestReviewCommentEvent is a comment on a PR's diff. The comment
+	// is described as an IssueComment, so that commands in it could be
+	// handled like the commands in the PR's conversation.
+	PullRequestReviewCommentEvent struct {
+		Action  string
+		Comment IssueComment
 	}
 
 	StatusEvent struct {
 		SHA        string
 		State      string
+		Context    string
 		Branches   []Branch
 		Repository Repository
 	}
 
+	// CheckSuiteEvent is a change in a check suite. NodeID is the suite's
+	// GraphQL ID.
+	CheckSuiteEvent struct {
+		Action     string
+		NodeID     string
+		HeadSHA    string
+		Conclusion string
+		Repository Repository
+	}
+
+	// DeploymentStatusEvent is a new status of a deployment. TargetURL is
+	// the status' log or target URL.
+	DeploymentStatusEvent struct {
+		DeploymentID int64
+		State        string
+		Description  string
+		TargetURL    string
+		Repository   Repository
+	}
+
+	// BranchProtectionRuleEvent is a change to one of the repository's
+	// branch protection rules. Action is "created", "edited" or "deleted".
+	BranchProtectionRuleEvent struct {
+		Action     string
+		Pattern    string
+		Repository Repository
+	}
+
+	// PushEvent is a push to a branch or a tag of the repository. Ref is the
+	// full name of the pushed ref, e.g. "refs/heads/master".
+	PushEvent struct {
+		Ref        string
+		Before     string
+		After      string
+		Deleted    bool
+		Repository Repository
+		// DefaultBranch is the name of the repository's default branch
+		DefaultBranch string
+	}
+
 	Repository struct {
 		Owner string
 		Name  string
@@ -47,6 +161,7 @@ type (
 
 	PullRequestBranch struct {
 		SHA        string
+		Ref        string
 		Repository Repository
 	}
 
@@ -75,6 +190,51 @@ func (p PullRequestEvent) Issue() Issue {
 	}
 }
 
+func (p PullRequestReviewEvent) Issue() Issue {
+	return Issue{
+		Number:     p.IssueNumber,
+		Repository: p.Repository,
+		User:       p.User,
+	}
+}
+
+func (p PullRequestEvent) HasLabel(label string) bool {
+	return containsLabel(p.Labels, label)
+}
+
+// CommandComment describes the review's summary comment as an IssueComment,
+// so that a command in it could be handled like any other.
+func (p PullRequestReviewEvent) CommandComment() IssueComment {
+	return IssueComment{
+		IssueNumber:          p.IssueNumber,
+		Comment:              p.Body,
+		IsPullRequest:        true,
+		Labels:               p.Labels,
+		Repository:           p.Repository,
+		User:                 p.User,
+		Commenter:            p.Reviewer,
+		CommenterAssociation: p.ReviewerAssociation,
+		CommentNodeID:        p.ReviewNodeID,
+	}
+}
+
+func (p PullRequestReviewEvent) HasLabel(label string) bool {
+	return containsLabel(p.Labels, label)
+}
+
+func (i IssueComment) HasLabel(label string) bool {
+	return containsLabel(i.Labels, label)
+}
+
+func containsLabel(labels []string, label string) bool {
+	for _, l := range labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
 func (i Issue) Issue() Issue {
 	return i
 }
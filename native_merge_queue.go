@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+const enqueuePullRequestMutation = `mutation($pullRequestId: ID!, $expectedHeadOid: GitObjectID) {
+  enqueuePullRequest(input: {pullRequestId: $pullRequestId, expectedHeadOid: $expectedHeadOid}) {
+    mergeQueueEntry {
+      id
+      state
+    }
+  }
+}`
+
+// dequeueReasons explains the reasons GitHub's merge queue gives for removing
+// PRs from the queue without merging them
+var dequeueReasons = map[string]string{
+	"CI_FAILURE":           "the required checks failed in the merge queue",
+	"CI_TIMEOUT":           "the required checks timed out in the merge queue",
+	"MERGE_CONFLICT":       "it conflicts with the PRs ahead of it in the queue",
+	"BRANCH_PROTECTIONS":   "it doesn't pass the base branch's protection rules",
+	"GIT_TREE_INVALID":     "GitHub couldn't create its merge commit",
+	"INVALID_MERGE_COMMIT": "GitHub couldn't create its merge commit",
+	"QUEUE_CLEARED":        "the merge queue was cleared",
+	"ROLL_BACK":            "a PR ahead of it in the queue failed",
+}
+
+// enqueuePR adds the ready PR to GitHub's native merge queue, which merges
+// it once it passes the checks on top of the PRs ahead of it. Adding a PR
+// that's already queued with the same head does nothing, so that the bot
+// wouldn't fight the queue over it.
+func enqueuePR(pr *github.PullRequest, store Store, graphQL GraphQL) *ErrorResponse {
+	issue := prIssue(pr)
+	entry, queued, err := store.MergeQueueEntry(issue)
+	if err != nil {
+		message := fmt.Sprintf("Failed to get the merge queue entry of PR %s", issue.FullName())
+		return &ErrorResponse{err, http.StatusInternalServerError, message}
+	} else if queued && entry.HeadSHA == pr.Head.GetSHA() {
+		log.Printf("PR %s is already in GitHub's merge queue. Not adding it again.\n", issue.FullName())
+		return nil
+	}
+	var result struct {
+		EnqueuePullRequest struct {
+			MergeQueueEntry struct {
+				ID    string `json:"id"`
+				State string `json:"state"`
+			} `json:"mergeQueueEntry"`
+		} `json:"enqueuePullRequest"`
+	}
+	// The expected head keeps the queue from merging commits that were
+	// pushed after the PR was found to be ready
+	err = graphQL.Query(context.TODO(), enqueuePullRequestMutation, map[string]interface{}{
+		"pullRequestId":   pr.GetNodeID(),
+		"expectedHeadOid": pr.Head.GetSHA(),
+	}, &result)
+	if err != nil {
+		message := fmt.Sprintf("Failed to add PR %s to GitHub's merge queue", issue.FullName())
+		return &ErrorResponse{err, http.StatusBadGateway, message}
+	}
+	log.Printf("Added PR %s to GitHub's merge queue.\n", issue.FullName())
+	err = store.SetMergeQueueEntry(MergeQueueEntry{
+		Issue:      issue,
+		ID:         result.EnqueuePullRequest.MergeQueueEntry.ID,
+		HeadSHA:    pr.Head.GetSHA(),
+		State:      result.EnqueuePullRequest.MergeQueueEntry.State,
+		EnqueuedAt: time.Now(),
+	})
+	if err != nil {
+		message := fmt.Sprintf("Failed to record the merge queue entry of PR %s", issue.FullName())
+		return &ErrorResponse{err, http.StatusInternalServerError, message}
+	}
+	return nil
+}
+
+// handlePullRequestEnqueued tracks the PRs that were added to GitHub's merge
+// queue by someone else than the bot, e.g. in GitHub's UI, so that the bot
+// wouldn't try to add them again.
+func handlePullRequestEnqueued(pullRequestEvent PullRequestEvent, store Store) Response {
+	issue := pullRequestEvent.Issue()
+	if _, queued, err := store.MergeQueueEntry(issue); err != nil {
+		message := fmt.Sprintf("Failed to get the merge queue entry of PR %s", issue.FullName())
+		return ErrorResponse{err, http.StatusInternalServerError, message}
+	} else if queued {
+		return SuccessResponse{fmt.Sprintf("PR %s is already tracked in the merge queue", issue.FullName())}
+	}
+	err := store.SetMergeQueueEntry(MergeQueueEntry{
+		Issue:      issue,
+		HeadSHA:    pullRequestEvent.Head.SHA,
+		State:      "QUEUED",
+		EnqueuedAt: time.Now(),
+	})
+	if err != nil {
+		message := fmt.Sprintf("Failed to record the merge queue entry of PR %s", issue.FullName())
+		return ErrorResponse{err, http.StatusInternalServerError, message}
+	}
+	return SuccessResponse{fmt.Sprintf("Tracking PR %s in the merge queue", issue.FullName())}
+}
+
+// handlePullRequestDequeued stops tracking a PR that GitHub's merge queue has
+// removed. A PR that was removed without being merged loses its "merging"
+// label, so that the bot wouldn't add it back to the queue right away, and
+// the reason is explained in a comment, unless someone removed the PR from
+// the queue on purpose.
+func handlePullRequestDequeued(conf Config, pullRequestEvent PullRequestEvent, store Store,
+	issues Issues) Response {
+
+	issue := pullRequestEvent.Issue()
+	if err := store.RemoveMergeQueueEntry(issue); err != nil {
+		message := fmt.Sprintf("Failed to remove the merge queue entry of PR %s", issue.FullName())
+		return ErrorResponse{err, http.StatusInternalServerError, message}
+	}
+	reason := pullRequestEvent.DequeueReason
+	if !pullRequestEvent.HasLabel(MergingLabel) {
+		return SuccessResponse{fmt.Sprintf("PR %s not labeled with '%s'. Ignoring.", issue.FullName(),
+			MergingLabel)}
+	} else if errResp := removeLabel(issue.Repository, issue.Number, MergingLabel, issues); errResp != nil {
+		return errResp
+	} else if pullRequestEvent.Merged || reason == "MERGE" || reason == "ALREADY_MERGED" {
+		return SuccessResponse{fmt.Sprintf("PR %s was merged by GitHub's merge queue", issue.FullName())}
+	} else if reason == "MANUAL" {
+		return SuccessResponse{fmt.Sprintf("PR %s was removed from GitHub's merge queue manually",
+			issue.FullName())}
+	}
+	explanation, known := dequeueReasons[reason]
+	if !known {
+		explanation = fmt.Sprintf("of `%s`", strings.ToLower(reason))
+	}
+	sendNotification(conf, NotificationEvent{
+		Type:    FailureEvent,
+		Issue:   issue,
+		Message: fmt.Sprintf("Removed from GitHub's merge queue, because %s.", explanation),
+	})
+	message := fmt.Sprintf("GitHub's merge queue removed this PR, because %s. I removed the `%s` label, so "+
+		"comment `!merge` to add the PR back to the queue once it's fixed.", explanation, MergingLabel)
+	if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+		errorMessage := fmt.Sprintf("Failed to report why PR %s was removed from the merge queue",
+			issue.FullName())
+		return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	return SuccessResponse{fmt.Sprintf("PR %s was removed from GitHub's merge queue, because %s",
+		issue.FullName(), explanation)}
+}
@@ -0,0 +1,198 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("GitHub's native merge queue", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+			graphQL          *mocks.GraphQL
+
+			headSHA = "1235"
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+			graphQL = *context.GraphQL
+
+			context.Config.NativeMergeQueue = true
+		})
+
+		Context("with a !merge command", func() {
+			headers.Is(func() map[string]string {
+				return map[string]string{
+					"X-Github-Event": "issue_comment",
+				}
+			})
+			requestJSON.Is(func() string {
+				return IssueCommentEvent("!merge", arbitraryIssueAuthor)
+			})
+
+			pr := &github.PullRequest{
+				Number:    github.Int(issueNumber),
+				NodeID:    github.String("PR_kwDOABCDEF4AAAAC"),
+				Merged:    github.Bool(false),
+				Mergeable: github.Bool(true),
+				Base: &github.PullRequestBranch{
+					SHA:  github.String("1234"),
+					Ref:  github.String("master"),
+					Repo: repository,
+				},
+				Head: &github.PullRequestBranch{
+					SHA:  github.String(headSHA),
+					Ref:  github.String("feature"),
+					Repo: repository,
+				},
+				User: &github.User{
+					Login: github.String(arbitraryIssueAuthor),
+				},
+			}
+
+			isEnqueueMutation := mock.MatchedBy(func(query string) bool {
+				return strings.Contains(query, "enqueuePullRequest")
+			})
+			enqueueVariables := map[string]interface{}{
+				"pullRequestId":   "PR_kwDOABCDEF4AAAAC",
+				"expectedHeadOid": headSHA,
+			}
+
+			BeforeEach(func() {
+				repositories.
+					On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+					Return(true, emptyResponse, noError)
+				issues.
+					On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+						[]string{grh.MergingLabel}).
+					Return(emptyResult, emptyResponse, noError)
+				pullRequests.
+					On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+					Return(pr, emptyResponse, noError)
+				repositories.
+					On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+						mock.AnythingOfType("*github.ListOptions")).
+					Return(&github.CombinedStatus{
+						State: github.String("success"),
+					}, emptyResponse, noError)
+				mockLabels(issues, issueNumber, grh.MergingLabel)
+			})
+
+			Context("with adding the PR to the queue succeeding", func() {
+				BeforeEach(func() {
+					graphQL.
+						On("Query", anyContext, isEnqueueMutation, enqueueVariables, mock.Anything).
+						Return(noError).
+						Once()
+				})
+
+				It("adds the PR to the queue once instead of merging it", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					Expect(responseRecorder.Body.String()).To(ContainSubstring("Added PR"))
+
+					// The command is handled again, e.g. when it's edited
+					*context.ResponseRecorder = httptest.NewRecorder()
+					handle()
+					Expect((*context.ResponseRecorder).Code).To(Equal(http.StatusOK))
+					graphQL.AssertNumberOfCalls(GinkgoT(), "Query", 1)
+					pullRequests.AssertNotCalled(GinkgoT(), "Merge", anyContext, repositoryOwner, repositoryName,
+						issueNumber, mock.Anything, mock.Anything)
+				})
+			})
+
+			Context("with adding the PR to the queue failing", func() {
+				BeforeEach(func() {
+					graphQL.
+						On("Query", anyContext, isEnqueueMutation, enqueueVariables, mock.Anything).
+						Return(errArbitrary)
+				})
+
+				It("fails with a gateway error", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusBadGateway))
+				})
+			})
+		})
+
+		Context("with the PR removed from the queue", func() {
+			headers.Is(func() map[string]string {
+				return map[string]string{
+					"X-Github-Event": "pull_request",
+				}
+			})
+
+			dequeuedEvent := func(reason string) string {
+				event := LabeledPullRequestEvent("dequeued", headSHA, grh.Repository{
+					Owner: repositoryOwner,
+					Name:  repositoryName,
+					URL:   sshURL,
+				}, grh.MergingLabel)
+				return strings.Replace(event, `"action": "dequeued",`, `"action": "dequeued",
+  "reason": "`+reason+`",`, 1)
+			}
+
+			BeforeEach(func() {
+				issues.
+					On("RemoveLabelForIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+						grh.MergingLabel).
+					Return(emptyResponse, noError).
+					Once()
+			})
+
+			Context("because its checks failed", func() {
+				requestJSON.Is(func() string {
+					return dequeuedEvent("CI_FAILURE")
+				})
+
+				BeforeEach(func() {
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("GitHub's merge queue removed this PR, because the "+
+								"required checks failed in the merge queue."))).
+						Return(emptyResult, emptyResponse, noError).
+						Once()
+				})
+
+				It("removes the merging label and explains why", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertExpectations(GinkgoT())
+				})
+			})
+
+			Context("because it was removed manually", func() {
+				requestJSON.Is(func() string {
+					return dequeuedEvent("MANUAL")
+				})
+
+				It("removes the merging label without a comment", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertExpectations(GinkgoT())
+					issues.AssertNotCalled(GinkgoT(), "CreateComment", anyContext, repositoryOwner, repositoryName,
+						issueNumber, mock.Anything)
+				})
+			})
+		})
+	})
+})
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// The events that can be routed to the notifiers
+const (
+	MergeEvent    = "merge"
+	ConflictEvent = "conflict"
+	FailureEvent  = "failure"
+)
+
+var notifierHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// failedNotifications counts the notifications that couldn't be delivered.
+// Reported by /debug/vars.
+var failedNotifications = expvar.NewInt("failed_notifications")
+
+// NotificationRoute sends the events of the listed types to the target. The
+// target is one of "slack:<webhook URL>", "discord:<webhook URL>",
+// "teams:<webhook URL>" or "mailto:<addresses>".
+type NotificationRoute struct {
+	// Events is nil for a route of all events
+	Events []string
+	Target string
+}
+
+// NotificationRoutes is encoded in JSON as a list of routes in the
+// "<events>=<target>" format, e.g. "merge,conflict=slack:https://...".
+type NotificationRoutes []NotificationRoute
+
+func (r NotificationRoutes) MarshalJSON() ([]byte, error) {
+	routeStrings := make([]string, len(r))
+	for i, route := range r {
+		routeStrings[i] = route.String()
+	}
+	return json.Marshal(routeStrings)
+}
+
+func (r *NotificationRoutes) UnmarshalJSON(data []byte) error {
+	var routeStrings []string
+	if err := json.Unmarshal(data, &routeStrings); err != nil {
+		return fmt.Errorf("notification routes must be a list of strings, got %s", data)
+	}
+	routes := NotificationRoutes{}
+	for _, routeString := range routeStrings {
+		route, err := parseNotificationRoute(routeString)
+		if err != nil {
+			return err
+		}
+		routes = append(routes, route)
+	}
+	*r = routes
+	return nil
+}
+
+func (r NotificationRoute) String() string {
+	if r.Events == nil {
+		return "*=" + r.Target
+	}
+	return strings.Join(r.Events, ",") + "=" + r.Target
+}
+
+// ParseNotificationRoutes parses a semicolon separated list of routes in the
+// "<events>=<target>" format, where events is a comma separated list of
+// "merge", "conflict" and "failure" or "*" for all of them.
+func ParseNotificationRoutes(routesString string) (NotificationRoutes, error) {
+	routes := NotificationRoutes{}
+	for _, routeString := range strings.Split(routesString, ";") {
+		if strings.TrimSpace(routeString) == "" {
+			continue
+		}
+		route, err := parseNotificationRoute(routeString)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+func parseNotificationRoute(routeString string) (NotificationRoute, error) {
+	parts := strings.SplitN(routeString, "=", 2)
+	if len(parts) != 2 {
+		return NotificationRoute{}, fmt.Errorf("expected a route in the \"<events>=<target>\" format, got \"%s\"",
+			strings.TrimSpace(routeString))
+	}
+	route := NotificationRoute{Target: strings.TrimSpace(parts[1])}
+	if strings.TrimSpace(parts[0]) != "*" {
+		for _, event := range getListFromString(parts[0]) {
+			if event != MergeEvent && event != ConflictEvent && event != FailureEvent {
+				return NotificationRoute{}, fmt.Errorf("events must be \"%s\", \"%s\" or \"%s\", got \"%s\"",
+					MergeEvent, ConflictEvent, FailureEvent, event)
+			}
+			route.Events = append(route.Events, event)
+		}
+		if len(route.Events) == 0 {
+			return NotificationRoute{}, fmt.Errorf("no events in the route \"%s\"", strings.TrimSpace(routeString))
+		}
+	}
+	if _, _, err := parseNotificationTarget(route.Target); err != nil {
+		return NotificationRoute{}, err
+	}
+	return route, nil
+}
+
+// parseNotificationTarget splits the target into its backend and the
+// backend's address.
+func parseNotificationTarget(target string) (string, string, error) {
+	parts := strings.SplitN(target, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", "", fmt.Errorf("expected a target in the \"<backend>:<address>\" format, got \"%s\"", target)
+	}
+	backend, address := parts[0], parts[1]
+	switch backend {
+	case "slack", "discord", "teams":
+		if parsed, err := url.Parse(address); err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") {
+			return "", "", fmt.Errorf("the %s target must be a webhook URL, got \"%s\"", backend, address)
+		}
+	case "mailto":
+	default:
+		return "", "", fmt.Errorf("the backend must be slack, discord, teams or mailto, got \"%s\"", backend)
+	}
+	return backend, address, nil
+}
+
+func (r NotificationRoute) includes(eventType string) bool {
+	if r.Events == nil {
+		return true
+	}
+	for _, event := range r.Events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// NotificationEvent describes something that happened to a PR that the
+// routes of its type are notified of.
+type NotificationEvent struct {
+	Type    string
+	Issue   Issue
+	Message string
+}
+
+func (e NotificationEvent) title() string {
+	return fmt.Sprintf("%s: %s", e.Issue.FullName(), e.Type)
+}
+
+func (e NotificationEvent) url() string {
+	return fmt.Sprintf("https://github.com/%s/%s/pull/%d", e.Issue.Repository.Owner, e.Issue.Repository.Name,
+		e.Issue.Number)
+}
+
+// sendNotification sends the event to all of the routes of its type. Failed
+// deliveries are logged and counted, but don't fail the action that
+// triggered the event.
+func sendNotification(conf Config, event NotificationEvent) {
+	for _, route := range conf.NotificationRoutes {
+		if !route.includes(event.Type) {
+			continue
+		}
+		if err := deliverNotification(conf, route.Target, event); err != nil {
+			failedNotifications.Add(1)
+			log.Printf("Failed to notify %s of the %s of PR %s: %v\n", route.Target, event.Type,
+				event.Issue.FullName(), err)
+		}
+	}
+}
+
+func deliverNotification(conf Config, target string, event NotificationEvent) error {
+	backend, address, err := parseNotificationTarget(target)
+	if err != nil {
+		return err
+	}
+	text := fmt.Sprintf("%s %s", event.Message, event.url())
+	switch backend {
+	case "slack":
+		return postNotification(address, map[string]string{
+			"text": fmt.Sprintf("*%s* %s <%s>", event.title(), event.Message, event.url()),
+		})
+	case "discord":
+		return postNotification(address, map[string]string{
+			"content": fmt.Sprintf("**%s** %s", event.title(), text),
+		})
+	case "teams":
+		return postNotification(address, map[string]string{
+			"@type":    "MessageCard",
+			"@context": "https://schema.org/extensions",
+			"summary":  event.title(),
+			"title":    event.title(),
+			"text":     text,
+		})
+	default:
+		return mailNotification(conf, getListFromString(address), event.title(), text)
+	}
+}
+
+func postNotification(webhookURL string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := notifierHTTPClient.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// mailNotification sends the notification through the SMTP_URL server.
+func mailNotification(conf Config, to []string, subject, text string) error {
+	if conf.SMTPURL == nil {
+		return fmt.Errorf("SMTP_URL is not configured")
+	}
+	var auth smtp.Auth
+	if password, isSet := conf.SMTPURL.User.Password(); isSet {
+		auth = smtp.PlainAuth("", conf.SMTPURL.User.Username(), password, conf.SMTPURL.Hostname())
+	}
+	message := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s\r\n", conf.NotificationEmailFrom,
+		strings.Join(to, ", "), subject, text)
+	return smtp.SendMail(conf.SMTPURL.Host, auth, conf.NotificationEmailFrom, to, []byte(message))
+}
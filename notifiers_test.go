@@ -0,0 +1,156 @@
+package main_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("notification routes", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+			gitRepos         *mocks.Repos
+
+			slack           *httptest.Server
+			discord         *httptest.Server
+			slackPayloads   []map[string]string
+			discordPayloads []map[string]string
+		)
+		recordPayloads := func(payloads *[]map[string]string) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				var payload map[string]string
+				json.Unmarshal(body, &payload)
+				*payloads = append(*payloads, payload)
+			}
+		}
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+			gitRepos = *context.GitRepos
+
+			slackPayloads, discordPayloads = nil, nil
+			slack = httptest.NewServer(recordPayloads(&slackPayloads))
+			discord = httptest.NewServer(recordPayloads(&discordPayloads))
+			routes, err := grh.ParseNotificationRoutes("merge=slack:" + slack.URL + "; conflict,failure=discord:" +
+				discord.URL)
+			Expect(err).NotTo(HaveOccurred())
+			context.Config.NotificationRoutes = routes
+		})
+		AfterEach(func() {
+			slack.Close()
+			discord.Close()
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!merge", arbitraryIssueAuthor)
+		})
+
+		headSHA := "1235"
+		BeforeEach(func() {
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+			issues.
+				On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{grh.MergingLabel}).
+				Return(emptyResult, emptyResponse, noError)
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+				Return(&github.PullRequest{
+					Number:    github.Int(issueNumber),
+					Merged:    github.Bool(false),
+					Mergeable: github.Bool(true),
+					Base: &github.PullRequestBranch{
+						SHA:  github.String("1234"),
+						Ref:  github.String("master"),
+						Repo: repository,
+					},
+					Head: &github.PullRequestBranch{
+						SHA:  github.String(headSHA),
+						Ref:  github.String("feature"),
+						Repo: repository,
+					},
+					User: &github.User{
+						Login: github.String(arbitraryIssueAuthor),
+					},
+				}, emptyResponse, noError)
+			repositories.
+				On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.AnythingOfType("*github.ListOptions")).
+				Return(&github.CombinedStatus{
+					State: github.String("success"),
+				}, emptyResponse, noError)
+			mockLabels(issues, issueNumber, grh.MergingLabel)
+			issues.
+				On("RemoveLabelForIssue", anyContext, repositoryOwner, repositoryName, issueNumber, grh.MergingLabel).
+				Return(emptyResponse, noError)
+		})
+
+		Context("with the PR merged", func() {
+			BeforeEach(func() {
+				pullRequests.
+					On("Merge", anyContext, repositoryOwner, repositoryName, issueNumber, "", noSquashOpts).
+					Return(&github.PullRequestMergeResult{Merged: github.Bool(true)}, emptyResponse, noError)
+				gitRepo := new(mocks.Repo)
+				gitRepos.
+					On("GetUpdatedRepo", sshURL, repositoryOwner, repositoryName).
+					Return(gitRepo, noError)
+				gitRepo.On("DeleteRemoteBranch", "feature").Return(noError)
+			})
+
+			It("notifies the routes of merges", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(slackPayloads).To(HaveLen(1))
+				Expect(slackPayloads[0]["text"]).To(ContainSubstring("Merged into `master`."))
+				Expect(slackPayloads[0]["text"]).To(ContainSubstring("/" + repositoryOwner + "/" + repositoryName +
+					"/pull/7>"))
+				Expect(discordPayloads).To(BeEmpty())
+			})
+		})
+
+		Context("with the PR conflicting", func() {
+			BeforeEach(func() {
+				pullRequests.
+					On("Merge", anyContext, repositoryOwner, repositoryName, issueNumber, "", noSquashOpts).
+					Return(nil, &github.Response{Response: &http.Response{StatusCode: http.StatusConflict}},
+						errors.New("Merge conflict"))
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("because of a merge conflict"))).
+					Return(emptyResult, emptyResponse, noError)
+			})
+
+			It("notifies the routes of conflicts", func() {
+				handle()
+				Expect(discordPayloads).To(HaveLen(1))
+				Expect(discordPayloads[0]["content"]).To(ContainSubstring("Not merged because of a merge conflict"))
+				Expect(slackPayloads).To(BeEmpty())
+			})
+		})
+	})
+})
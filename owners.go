@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/google/go-github/github"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const ownersFileQuery = `query($owner: String!, $name: String!, $expression: String!) {
+  repository(owner: $owner, name: $name) {
+    object(expression: $expression) {
+      ... on Blob {
+        text
+      }
+    }
+  }
+}`
+
+// OwnerRule lists the owners of the files that match the pattern in the
+// repository's OWNERS_FILE. Owners are users or teams in the org/team-slug
+// format.
+type OwnerRule struct {
+	// Pattern is matched against the changed files with matchesPathPattern
+	Pattern string
+	Owners  []string
+}
+
+func (r OwnerRule) matches(file string) bool {
+	return matchesPathPattern(r.Pattern, file)
+}
+
+// users returns the users among the rule's owners.
+func (r OwnerRule) users() []string {
+	var users []string
+	for _, owner := range r.Owners {
+		if !isTeamOwner(owner) {
+			users = append(users, owner)
+		}
+	}
+	return users
+}
+
+// teams returns the teams among the rule's owners, in the org/team-slug
+// format.
+func (r OwnerRule) teams() []string {
+	var teams []string
+	for _, owner := range r.Owners {
+		if isTeamOwner(owner) {
+			teams = append(teams, owner)
+		}
+	}
+	return teams
+}
+
+func isTeamOwner(owner string) bool {
+	return strings.Contains(owner, "/")
+}
+
+// OwnersFile is the parsed OWNERS_FILE of a repository. A repository without
+// the file has no rules.
+type OwnersFile struct {
+	Rules []OwnerRule
+}
+
+// ParseOwnersFile parses an owners file, which maps path patterns to lists of
+// owners, e.g.
+//
+//	docs/: [alice, bob]
+//	"*.sql": ["@salemove/dba"]
+//
+// Unlike CODEOWNERS, every rule matching a file applies, not only the last
+// one. A single owner doesn't need to be in a list and the "@" prefixes of the
+// owners are optional.
+func ParseOwnersFile(content string) (OwnersFile, error) {
+	var document yaml.MapSlice
+	if err := yaml.Unmarshal([]byte(content), &document); err != nil {
+		return OwnersFile{}, err
+	}
+	file := OwnersFile{Rules: []OwnerRule{}}
+	for _, item := range document {
+		pattern, ok := item.Key.(string)
+		if !ok || pattern == "" {
+			return OwnersFile{}, fmt.Errorf("patterns must be strings, got %v", item.Key)
+		} else if _, err := path.Match(pattern, ""); err != nil {
+			return OwnersFile{}, fmt.Errorf("invalid pattern \"%s\"", pattern)
+		}
+		values, ok := item.Value.([]interface{})
+		if owner, isString := item.Value.(string); isString {
+			values, ok = []interface{}{owner}, true
+		}
+		if !ok || len(values) == 0 {
+			return OwnersFile{}, fmt.Errorf("no owners for \"%s\"", pattern)
+		}
+		rule := OwnerRule{Pattern: pattern}
+		for _, value := range values {
+			owner, ok := value.(string)
+			owner = strings.TrimPrefix(strings.TrimSpace(owner), "@")
+			if !ok || owner == "" {
+				return OwnersFile{}, fmt.Errorf("owners of \"%s\" must be logins or teams, got %v", pattern, value)
+			} else if isTeamOwner(owner) && !repositoryKeyRegexp.MatchString(owner) {
+				return OwnersFile{}, fmt.Errorf("teams must be in the @org/team-slug format, got \"%s\"", value)
+			}
+			rule.Owners = append(rule.Owners, owner)
+		}
+		file.Rules = append(file.Rules, rule)
+	}
+	return file, nil
+}
+
+// repositoryOwners returns the repository's owners file as it is on the
+// default branch. The parsed file is kept in the store until a push to the
+// default branch invalidates it. A file that fails to parse is logged and
+// treated as missing, so that a typo in it wouldn't block every PR.
+func repositoryOwners(conf Config, repository Repository, store Store, graphQL GraphQL) (OwnersFile, error) {
+	if conf.OwnersFile == "" {
+		return OwnersFile{}, nil
+	}
+	if file, exists, err := store.OwnersFile(repository); err != nil {
+		return OwnersFile{}, err
+	} else if exists {
+		return file, nil
+	}
+	var result struct {
+		Repository struct {
+			Object *struct {
+				Text string `json:"text"`
+			} `json:"object"`
+		} `json:"repository"`
+	}
+	err := graphQL.Query(context.TODO(), ownersFileQuery, map[string]interface{}{
+		"owner":      repository.Owner,
+		"name":       repository.Name,
+		"expression": "HEAD:" + strings.TrimPrefix(conf.OwnersFile, "/"),
+	}, &result)
+	if err != nil {
+		return OwnersFile{}, fmt.Errorf("failed to read %s of %s: %v", conf.OwnersFile, repositoryKey(repository),
+			err)
+	}
+	file := OwnersFile{}
+	if result.Repository.Object != nil {
+		if file, err = ParseOwnersFile(result.Repository.Object.Text); err != nil {
+			log.Printf("Ignoring the invalid %s of %s: %v\n", conf.OwnersFile, repositoryKey(repository), err)
+			file = OwnersFile{}
+		}
+	}
+	if err = store.SetOwnersFile(repository, file); err != nil {
+		log.Printf("Failed to cache the %s of %s: %v\n", conf.OwnersFile, repositoryKey(repository), err)
+	}
+	return file, nil
+}
+
+// prOwnerRules returns the rules of the repository's OWNERS_FILE that match
+// the PR's changed files. The files are only listed, if the repository has
+// an owners file.
+func prOwnerRules(conf Config, pr *github.PullRequest, store Store, pullRequests PullRequests,
+	graphQL GraphQL) ([]OwnerRule, *ErrorResponse) {
+
+	if conf.OwnersFile == "" {
+		return nil, nil
+	}
+	issue := prIssue(pr)
+	file, err := repositoryOwners(conf, issue.Repository, store, graphQL)
+	if err != nil {
+		message := fmt.Sprintf("Failed to get the owners of the files of PR %s", issue.FullName())
+		return nil, &ErrorResponse{err, http.StatusBadGateway, message}
+	} else if len(file.Rules) == 0 {
+		return nil, nil
+	}
+	files, errResp := getPRFiles(issue, pullRequests)
+	if errResp != nil {
+		return nil, errResp
+	}
+	fileNames := make([]string, len(files))
+	for i, file := range files {
+		fileNames[i] = file.GetFilename()
+	}
+	return matchingOwnerRules(file, fileNames), nil
+}
+
+// matchingOwnerRules returns the rules matching any of the files, in the
+// order of the owners file.
+func matchingOwnerRules(file OwnersFile, files []string) []OwnerRule {
+	var matching []OwnerRule
+	for _, rule := range file.Rules {
+		for _, name := range files {
+			if rule.matches(name) {
+				matching = append(matching, rule)
+				break
+			}
+		}
+	}
+	return matching
+}
+
+// ownerUsersAndTeams returns the users and the teams owning the rules, in
+// the order of the rules, without duplicates.
+func ownerUsersAndTeams(rules []OwnerRule) (users, teams []string) {
+	added := make(map[string]bool)
+	for _, rule := range rules {
+		for _, owner := range rule.Owners {
+			key := strings.ToLower(owner)
+			if added[key] {
+				continue
+			}
+			added[key] = true
+			if isTeamOwner(owner) {
+				teams = append(teams, owner)
+			} else {
+				users = append(users, owner)
+			}
+		}
+	}
+	return users, teams
+}
+
+// unapprovedOwnerRules returns the rules none of whose owners has approved
+// the PR. A team's approval is given by any of its members. The PR's author
+// can't approve their own PR, so the rules only the author owns are left
+// out.
+func unapprovedOwnerRules(rules []OwnerRule, author string, approvers []string, graphQL GraphQL) ([]OwnerRule,
+	error) {
+
+	approved := make(map[string]bool)
+	for _, approver := range approvers {
+		approved[strings.ToLower(approver)] = true
+	}
+	var unapproved []OwnerRule
+	for _, rule := range rules {
+		users := rule.users()
+		if len(rule.teams()) == 0 && len(users) == 1 && strings.EqualFold(users[0], author) {
+			continue
+		}
+		isApproved := false
+		for _, user := range users {
+			if approved[strings.ToLower(user)] {
+				isApproved = true
+				break
+			}
+		}
+		for _, team := range rule.teams() {
+			if isApproved {
+				break
+			}
+			var err error
+			if isApproved, err = isApprovedByTeam(team, approvers, graphQL); err != nil {
+				return nil, err
+			}
+		}
+		if !isApproved {
+			unapproved = append(unapproved, rule)
+		}
+	}
+	return unapproved, nil
+}
+
+// handleOwnersFilePush forgets the cached owners file of the repository, if
+// the push updated its default branch, so that the next PR to need the file
+// reads it again.
+func handleOwnersFilePush(conf Config, pushEvent PushEvent, store Store) {
+	if conf.OwnersFile == "" || pushEvent.Ref != "refs/heads/"+pushEvent.DefaultBranch {
+		return
+	}
+	if err := store.RemoveOwnersFile(pushEvent.Repository); err != nil {
+		log.Printf("Failed to forget the cached %s of %s: %v\n", conf.OwnersFile,
+			repositoryKey(pushEvent.Repository), err)
+	}
+}
+
+// describeOwners mentions the owners, e.g. "@alice or @salemove/docs".
+func describeOwners(owners []string) string {
+	return strings.Replace(mentions(owners), ", ", " or ", -1)
+}
@@ -0,0 +1,273 @@
+package main_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParseOwnersFile", func() {
+	It("parses the owners of each pattern in order", func() {
+		file, err := grh.ParseOwnersFile("docs/: [alice, \"@bob\"]\n\"*.sql\": \"@salemove/dba\"\n")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(file.Rules).To(Equal([]grh.OwnerRule{
+			{Pattern: "docs/", Owners: []string{"alice", "bob"}},
+			{Pattern: "*.sql", Owners: []string{"salemove/dba"}},
+		}))
+	})
+
+	It("fails for a pattern without owners", func() {
+		_, err := grh.ParseOwnersFile("docs/: []\n")
+		Expect(err).To(MatchError(ContainSubstring("no owners for \"docs/\"")))
+	})
+
+	It("fails for a team that isn't in the org/team-slug format", func() {
+		_, err := grh.ParseOwnersFile("docs/: \"@salemove/docs/writers\"\n")
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	var (
+		handle      = context.Handle
+		headers     = context.Headers
+		requestJSON = context.RequestJSON
+
+		responseRecorder *httptest.ResponseRecorder
+		pullRequests     *mocks.PullRequests
+		repositories     *mocks.Repositories
+		issues           *mocks.Issues
+		graphQL          *mocks.GraphQL
+
+		headSHA        = "1235"
+		anyListOptions = mock.AnythingOfType("*github.ListOptions")
+		ownersFile     = "docs/: [alice, bob]\n\"*.sql\": \"@salemove/dba\"\n"
+	)
+	BeforeEach(func() {
+		responseRecorder = *context.ResponseRecorder
+		pullRequests = *context.PullRequests
+		repositories = *context.Repositories
+		issues = *context.Issues
+		graphQL = *context.GraphQL
+
+		context.Config.OwnersFile = ".github/review-helper-owners.yml"
+	})
+
+	queryContaining := func(text string) interface{} {
+		return mock.MatchedBy(func(query string) bool {
+			return strings.Contains(query, text)
+		})
+	}
+
+	mockOwnersFile := func(content string) {
+		graphQL.
+			On("Query", anyContext, queryContaining("object(expression: $expression)"), mock.Anything,
+				mock.Anything).
+			Return(noError).
+			Run(func(args mock.Arguments) {
+				Expect(args.Get(2)).To(HaveKeyWithValue("expression", "HEAD:.github/review-helper-owners.yml"))
+				data, err := json.Marshal(map[string]interface{}{
+					"repository": map[string]interface{}{
+						"object": map[string]string{"text": content},
+					},
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(json.Unmarshal(data, args.Get(3))).To(Succeed())
+			})
+	}
+
+	mockFiles := func(files ...string) {
+		commitFiles := make([]*github.CommitFile, len(files))
+		for i, file := range files {
+			commitFiles[i] = &github.CommitFile{Filename: github.String(file)}
+		}
+		pullRequests.
+			On("ListFiles", anyContext, repositoryOwner, repositoryName, issueNumber, anyListOptions).
+			Return(commitFiles, emptyResponse, noError)
+	}
+
+	Describe("approvals gate with an owners file", func() {
+		pr := &github.PullRequest{
+			Number:    github.Int(issueNumber),
+			Merged:    github.Bool(false),
+			Mergeable: github.Bool(true),
+			Base: &github.PullRequestBranch{
+				SHA:  github.String("1234"),
+				Ref:  github.String("master"),
+				Repo: repository,
+			},
+			Head: &github.PullRequestBranch{
+				SHA:  github.String(headSHA),
+				Ref:  github.String("feature"),
+				Repo: repository,
+			},
+			User: &github.User{
+				Login: github.String(arbitraryIssueAuthor),
+			},
+		}
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!status", arbitraryIssueAuthor)
+		})
+
+		BeforeEach(func() {
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+				Return(pr, emptyResponse, noError)
+			repositories.
+				On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA, anyListOptions).
+				Return(&github.CombinedStatus{State: github.String("success")}, emptyResponse, noError)
+			pullRequests.
+				On("ListReviews", anyContext, repositoryOwner, repositoryName, issueNumber, anyListOptions).
+				Return([]*github.PullRequestReview{{
+					State: github.String("APPROVED"),
+					User:  &github.User{Login: github.String("carol")},
+				}}, &github.Response{}, noError)
+			mockLabels(issues, issueNumber)
+			mockOwnersFile(ownersFile)
+		})
+
+		expectComment := func(text string) {
+			issues.
+				On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+					mock.MatchedBy(commentContaining(text))).
+				Return(emptyResult, emptyResponse, noError)
+		}
+
+		Context("with the PR changing files no owner has approved", func() {
+			BeforeEach(func() {
+				mockFiles("docs/setup.md", "main.go")
+			})
+
+			It("blocks the merge until an owner approves", func() {
+				expectComment(":x: **approvals**: changes to docs/ need an approval from @alice or @bob")
+
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+			})
+		})
+
+		Context("with the PR changing files no rule matches", func() {
+			BeforeEach(func() {
+				mockFiles("main.go")
+			})
+
+			It("passes the gate", func() {
+				expectComment(":white_check_mark: **approvals**")
+
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+			})
+		})
+	})
+
+	Describe("pull_request opened event with an owners file", func() {
+		BeforeEach(func() {
+			context.Config.ReviewerAssignment = grh.ReviewerAssignmentRoundRobin
+			context.Config.ReviewerAssignmentCount = 1
+			context.Config.Reviewers = []string{"dana"}
+
+			pullRequests.
+				On("ListCommits", anyContext, repositoryOwner, repositoryName, issueNumber, anyListOptions).
+				Return(githubCommits(commit{headSHA, "Changing things"}), emptyResponse, noError)
+			repositories.
+				On("CreateStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.Anything).
+				Return(emptyResult, emptyResponse, noError)
+			mockOwnersFile(ownersFile)
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "pull_request",
+			}
+		})
+		requestJSON.Is(func() string {
+			return PullRequestEvent("opened", headSHA, grh.Repository{
+				Owner: repositoryOwner,
+				Name:  repositoryName,
+				URL:   sshURL,
+			})
+		})
+
+		It("requests reviews from the owners of the PR's files", func() {
+			mockFiles("docs/setup.md", "db/001_users.sql")
+			pullRequests.
+				On("RequestReviewers", anyContext, repositoryOwner, repositoryName, issueNumber,
+					github.ReviewersRequest{Reviewers: []string{"alice"}, TeamReviewers: []string{"dba"}}).
+				Return(emptyResult, emptyResponse, noError).
+				Once()
+
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			pullRequests.AssertExpectations(GinkgoT())
+		})
+
+		It("falls back to the reviewers pool, if no owners match", func() {
+			mockFiles("main.go")
+			pullRequests.
+				On("RequestReviewers", anyContext, repositoryOwner, repositoryName, issueNumber,
+					github.ReviewersRequest{Reviewers: []string{"dana"}}).
+				Return(emptyResult, emptyResponse, noError).
+				Once()
+
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			pullRequests.AssertExpectations(GinkgoT())
+		})
+	})
+
+	Describe("push event to the default branch", func() {
+		ownersRepository := grh.Repository{Owner: repositoryOwner, Name: repositoryName}
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "push",
+			}
+		})
+		requestJSON.Is(func() string {
+			return `{
+  "ref": "refs/heads/master",
+  "before": "1111",
+  "after": "2222",
+  "repository": {
+    "name": "` + repositoryName + `",
+    "owner": {
+      "login": "` + repositoryOwner + `"
+    },
+    "default_branch": "master",
+    "ssh_url": "` + sshURL + `"
+  }
+}`
+		})
+
+		It("forgets the cached owners file", func() {
+			store := *context.Store
+			Expect(store.SetOwnersFile(ownersRepository, grh.OwnersFile{})).To(Succeed())
+
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			_, exists, err := store.OwnersFile(ownersRepository)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeFalse())
+		})
+	})
+})
@@ -1,18 +1,43 @@
 package main
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
 
 type messageRepository struct {
 	Name  string `json:"name"`
 	Owner struct {
 		Login string `json:"login"`
 	} `json:"owner"`
-	SSHURL string `json:"ssh_url"`
+	SSHURL        string `json:"ssh_url"`
+	DefaultBranch string `json:"default_branch"`
+}
+
+type messageLabel struct {
+	Name string `json:"name"`
+}
+
+// messageBodyChanges holds the previous body of an edited comment
+type messageBodyChanges struct {
+	Body struct {
+		From string `json:"from"`
+	} `json:"body"`
+}
+
+func labelNames(messageLabels []messageLabel) []string {
+	labels := make([]string, len(messageLabels))
+	for i, label := range messageLabels {
+		labels[i] = label.Name
+	}
+	return labels
 }
 
 func parseIssueComment(body []byte) (IssueComment, error) {
 	var message struct {
-		Issue struct {
+		Action string `json:"action"`
+		Issue  struct {
 			Number      int `json:"Number"`
 			PullRequest struct {
 				URL string `json:"url"`
@@ -20,20 +45,29 @@ func parseIssueComment(body []byte) (IssueComment, error) {
 			User struct {
 				Login string `json:"login"`
 			} `json:"user"`
+			Labels []messageLabel `json:"labels"`
 		} `json:"issue"`
 		Repository messageRepository `json:"repository"`
 		Comment    struct {
-			Body string `json:"body"`
+			NodeID string `json:"node_id"`
+			Body   string `json:"body"`
+			User   struct {
+				Login string `json:"login"`
+			} `json:"user"`
+			AuthorAssociation string `json:"author_association"`
 		} `json:"comment"`
+		Changes messageBodyChanges `json:"changes"`
 	}
 	err := json.Unmarshal(body, &message)
 	if err != nil {
 		return IssueComment{}, err
 	}
 	return IssueComment{
+		Action:        message.Action,
 		IssueNumber:   message.Issue.Number,
 		Comment:       message.Comment.Body,
 		IsPullRequest: message.Issue.PullRequest.URL != "",
+		Labels:        labelNames(message.Issue.Labels),
 		Repository: Repository{
 			Owner: message.Repository.Owner.Login,
 			Name:  message.Repository.Name,
@@ -42,6 +76,41 @@ func parseIssueComment(body []byte) (IssueComment, error) {
 		User: User{
 			Login: message.Issue.User.Login,
 		},
+		Commenter: User{
+			Login: message.Comment.User.Login,
+		},
+		CommenterAssociation: message.Comment.AuthorAssociation,
+		CommentNodeID:        message.Comment.NodeID,
+		PreviousComment:      message.Changes.Body.From,
+	}, nil
+}
+
+func parseCommitComment(body []byte) (CommitComment, error) {
+	var message struct {
+		Repository messageRepository `json:"repository"`
+		Comment    struct {
+			CommitID string `json:"commit_id"`
+			Body     string `json:"body"`
+			User     struct {
+				Login string `json:"login"`
+			} `json:"user"`
+		} `json:"comment"`
+	}
+	err := json.Unmarshal(body, &message)
+	if err != nil {
+		return CommitComment{}, err
+	}
+	return CommitComment{
+		SHA:     message.Comment.CommitID,
+		Comment: message.Comment.Body,
+		Repository: Repository{
+			Owner: message.Repository.Owner.Login,
+			Name:  message.Repository.Name,
+			URL:   message.Repository.SSHURL,
+		},
+		Commenter: User{
+			Login: message.Comment.User.Login,
+		},
 	}, nil
 }
 
@@ -49,32 +118,135 @@ func parsePullRequestEvent(body []byte) (PullRequestEvent, error) {
 	var message struct {
 		Action      string `json:"action"`
 		Number      int    `json:"number"`
+		Before      string `json:"before"`
 		PullRequest struct {
-			Head struct {
+			Merged bool `json:"merged"`
+			Head   struct {
 				SHA        string            `json:"sha"`
+				Ref        string            `json:"ref"`
 				Repository messageRepository `json:"repo"`
 			} `json:"head"`
+			Base struct {
+				SHA        string            `json:"sha"`
+				Ref        string            `json:"ref"`
+				Repository messageRepository `json:"repo"`
+			} `json:"base"`
 			User struct {
 				Login string `json:"login"`
 			} `json:"user"`
+			RequestedReviewers []struct {
+				Login string `json:"login"`
+			} `json:"requested_reviewers"`
+			Labels            []messageLabel `json:"labels"`
+			Title             string         `json:"title"`
+			Body              string         `json:"body"`
+			AuthorAssociation string         `json:"author_association"`
 		} `json:"pull_request"`
+		RequestedReviewer struct {
+			Login string `json:"login"`
+		} `json:"requested_reviewer"`
+		Label struct {
+			Name string `json:"name"`
+		} `json:"label"`
+		Sender struct {
+			Login string `json:"login"`
+		} `json:"sender"`
+		Reason  string `json:"reason"`
+		Changes struct {
+			Base struct {
+				Ref struct {
+					From string `json:"from"`
+				} `json:"ref"`
+			} `json:"base"`
+		} `json:"changes"`
 		Repository messageRepository `json:"repository"`
 	}
 	err := json.Unmarshal(body, &message)
 	if err != nil {
 		return PullRequestEvent{}, err
 	}
+	requestedReviewers := make([]User, len(message.PullRequest.RequestedReviewers))
+	for i, reviewer := range message.PullRequest.RequestedReviewers {
+		requestedReviewers[i] = User{Login: reviewer.Login}
+	}
 	return PullRequestEvent{
 		IssueNumber: message.Number,
 		Action:      message.Action,
+		Merged:      message.PullRequest.Merged,
 		Head: PullRequestBranch{
 			SHA: message.PullRequest.Head.SHA,
+			Ref: message.PullRequest.Head.Ref,
 			Repository: Repository{
 				Owner: message.PullRequest.Head.Repository.Owner.Login,
 				Name:  message.PullRequest.Head.Repository.Name,
 				URL:   message.PullRequest.Head.Repository.SSHURL,
 			},
 		},
+		Base: PullRequestBranch{
+			SHA: message.PullRequest.Base.SHA,
+			Ref: message.PullRequest.Base.Ref,
+			Repository: Repository{
+				Owner: message.PullRequest.Base.Repository.Owner.Login,
+				Name:  message.PullRequest.Base.Repository.Name,
+				URL:   message.PullRequest.Base.Repository.SSHURL,
+			},
+		},
+		Repository: Repository{
+			Owner: message.Repository.Owner.Login,
+			Name:  message.Repository.Name,
+			URL:   message.Repository.SSHURL,
+		},
+		User: User{
+			Login: message.PullRequest.User.Login,
+		},
+		RequestedReviewer: User{
+			Login: message.RequestedReviewer.Login,
+		},
+		RequestedReviewers: requestedReviewers,
+		Labels:             labelNames(message.PullRequest.Labels),
+		Title:              message.PullRequest.Title,
+		Body:               message.PullRequest.Body,
+		Before:             message.Before,
+		Label:              message.Label.Name,
+		Sender:             User{Login: message.Sender.Login},
+		DequeueReason:      message.Reason,
+		AuthorAssociation:  message.PullRequest.AuthorAssociation,
+		PreviousBaseRef:    message.Changes.Base.Ref.From,
+	}, nil
+}
+
+func parsePullRequestReviewEvent(body []byte) (PullRequestReviewEvent, error) {
+	var message struct {
+		Action string `json:"action"`
+		Review struct {
+			NodeID string `json:"node_id"`
+			State  string `json:"state"`
+			Body   string `json:"body"`
+			User   struct {
+				Login string `json:"login"`
+			} `json:"user"`
+			AuthorAssociation string `json:"author_association"`
+		} `json:"review"`
+		PullRequest struct {
+			Number int            `json:"number"`
+			Labels []messageLabel `json:"labels"`
+			User   struct {
+				Login string `json:"login"`
+			} `json:"user"`
+		} `json:"pull_request"`
+		Repository messageRepository `json:"repository"`
+	}
+	err := json.Unmarshal(body, &message)
+	if err != nil {
+		return PullRequestReviewEvent{}, err
+	}
+	return PullRequestReviewEvent{
+		IssueNumber: message.PullRequest.Number,
+		Action:      message.Action,
+		// The state is documented in upper case for the REST API, but the
+		// webhooks have been seen using lower case
+		State:  strings.ToLower(message.Review.State),
+		Labels: labelNames(message.PullRequest.Labels),
 		Repository: Repository{
 			Owner: message.Repository.Owner.Login,
 			Name:  message.Repository.Name,
@@ -83,6 +255,63 @@ func parsePullRequestEvent(body []byte) (PullRequestEvent, error) {
 		User: User{
 			Login: message.PullRequest.User.Login,
 		},
+		Reviewer: User{
+			Login: message.Review.User.Login,
+		},
+		Body:                message.Review.Body,
+		ReviewerAssociation: message.Review.AuthorAssociation,
+		ReviewNodeID:        message.Review.NodeID,
+	}, nil
+}
+
+func parsePullRequestReviewCommentEvent(body []byte) (PullRequestReviewCommentEvent, error) {
+	var message struct {
+		Action  string `json:"action"`
+		Comment struct {
+			NodeID string `json:"node_id"`
+			Body   string `json:"body"`
+			User   struct {
+				Login string `json:"login"`
+			} `json:"user"`
+			AuthorAssociation string `json:"author_association"`
+		} `json:"comment"`
+		Changes     messageBodyChanges `json:"changes"`
+		PullRequest struct {
+			Number int            `json:"number"`
+			Labels []messageLabel `json:"labels"`
+			User   struct {
+				Login string `json:"login"`
+			} `json:"user"`
+		} `json:"pull_request"`
+		Repository messageRepository `json:"repository"`
+	}
+	err := json.Unmarshal(body, &message)
+	if err != nil {
+		return PullRequestReviewCommentEvent{}, err
+	}
+	return PullRequestReviewCommentEvent{
+		Action: message.Action,
+		Comment: IssueComment{
+			Action:        message.Action,
+			IssueNumber:   message.PullRequest.Number,
+			Comment:       message.Comment.Body,
+			IsPullRequest: true,
+			Labels:        labelNames(message.PullRequest.Labels),
+			Repository: Repository{
+				Owner: message.Repository.Owner.Login,
+				Name:  message.Repository.Name,
+				URL:   message.Repository.SSHURL,
+			},
+			User: User{
+				Login: message.PullRequest.User.Login,
+			},
+			Commenter: User{
+				Login: message.Comment.User.Login,
+			},
+			CommenterAssociation: message.Comment.AuthorAssociation,
+			CommentNodeID:        message.Comment.NodeID,
+			PreviousComment:      message.Changes.Body.From,
+		},
 	}, nil
 }
 
@@ -90,6 +319,7 @@ func parseStatusEvent(body []byte) (StatusEvent, error) {
 	var message struct {
 		SHA      string `json:"sha"`
 		State    string `json:"state"`
+		Context  string `json:"context"`
 		Branches []struct {
 			Commit struct {
 				SHA string `json:"sha"`
@@ -112,6 +342,7 @@ func parseStatusEvent(body []byte) (StatusEvent, error) {
 	return StatusEvent{
 		SHA:      message.SHA,
 		State:    message.State,
+		Context:  message.Context,
 		Branches: branches,
 		Repository: Repository{
 			Owner: message.Repository.Owner.Login,
@@ -120,3 +351,200 @@ func parseStatusEvent(body []byte) (StatusEvent, error) {
 		},
 	}, nil
 }
+
+func parseCheckSuiteEvent(body []byte) (CheckSuiteEvent, error) {
+	var message struct {
+		Action     string `json:"action"`
+		CheckSuite struct {
+			NodeID     string `json:"node_id"`
+			HeadSHA    string `json:"head_sha"`
+			Conclusion string `json:"conclusion"`
+		} `json:"check_suite"`
+		Repository messageRepository `json:"repository"`
+	}
+	if err := json.Unmarshal(body, &message); err != nil {
+		return CheckSuiteEvent{}, err
+	}
+	return CheckSuiteEvent{
+		Action:     message.Action,
+		NodeID:     message.CheckSuite.NodeID,
+		HeadSHA:    message.CheckSuite.HeadSHA,
+		Conclusion: message.CheckSuite.Conclusion,
+		Repository: Repository{
+			Owner: message.Repository.Owner.Login,
+			Name:  message.Repository.Name,
+			URL:   message.Repository.SSHURL,
+		},
+	}, nil
+}
+
+func parsePushEvent(body []byte) (PushEvent, error) {
+	var message struct {
+		Ref        string            `json:"ref"`
+		Before     string            `json:"before"`
+		After      string            `json:"after"`
+		Deleted    bool              `json:"deleted"`
+		Repository messageRepository `json:"repository"`
+	}
+	if err := json.Unmarshal(body, &message); err != nil {
+		return PushEvent{}, err
+	}
+	return PushEvent{
+		Ref:     message.Ref,
+		Before:  message.Before,
+		After:   message.After,
+		Deleted: message.Deleted,
+		Repository: Repository{
+			Owner: message.Repository.Owner.Login,
+			Name:  message.Repository.Name,
+			URL:   message.Repository.SSHURL,
+		},
+		DefaultBranch: message.Repository.DefaultBranch,
+	}, nil
+}
+
+func parseDeploymentStatusEvent(body []byte) (DeploymentStatusEvent, error) {
+	var message struct {
+		Deployment struct {
+			ID int64 `json:"id"`
+		} `json:"deployment"`
+		DeploymentStatus struct {
+			State       string `json:"state"`
+			Description string `json:"description"`
+			TargetURL   string `json:"target_url"`
+			LogURL      string `json:"log_url"`
+		} `json:"deployment_status"`
+		Repository messageRepository `json:"repository"`
+	}
+	if err := json.Unmarshal(body, &message); err != nil {
+		return DeploymentStatusEvent{}, err
+	}
+	targetURL := message.DeploymentStatus.LogURL
+	if targetURL == "" {
+		targetURL = message.DeploymentStatus.TargetURL
+	}
+	return DeploymentStatusEvent{
+		DeploymentID: message.Deployment.ID,
+		State:        message.DeploymentStatus.State,
+		Description:  message.DeploymentStatus.Description,
+		TargetURL:    targetURL,
+		Repository: Repository{
+			Owner: message.Repository.Owner.Login,
+			Name:  message.Repository.Name,
+			URL:   message.Repository.SSHURL,
+		},
+	}, nil
+}
+
+func parseBranchProtectionRuleEvent(body []byte) (BranchProtectionRuleEvent, error) {
+	var message struct {
+		Action string `json:"action"`
+		Rule   struct {
+			Name string `json:"name"`
+		} `json:"rule"`
+		Repository messageRepository `json:"repository"`
+	}
+	if err := json.Unmarshal(body, &message); err != nil {
+		return BranchProtectionRuleEvent{}, err
+	}
+	return BranchProtectionRuleEvent{
+		Action:  message.Action,
+		Pattern: message.Rule.Name,
+		Repository: Repository{
+			Owner: message.Repository.Owner.Login,
+			Name:  message.Repository.Name,
+			URL:   message.Repository.SSHURL,
+		},
+	}, nil
+}
+
+// WebhookContext describes what a webhook was about, for reporting what was
+// done while handling it.
+type WebhookContext struct {
+	Event       string
+	DeliveryID  string
+	Repository  Repository
+	PullRequest int
+	// Command is the first line of the comment, if the comment is a command
+	Command string
+	// Actor is the user whose action triggered the webhook
+	Actor string
+}
+
+// parseWebhookRepository parses the repository any kind of webhook is about.
+// A webhook that isn't about any repository gets the zero Repository.
+func parseWebhookRepository(body []byte) Repository {
+	var message struct {
+		Repository messageRepository `json:"repository"`
+	}
+	if err := json.Unmarshal(body, &message); err != nil {
+		return Repository{}
+	}
+	return Repository{
+		Owner: message.Repository.Owner.Login,
+		Name:  message.Repository.Name,
+		URL:   message.Repository.SSHURL,
+	}
+}
+
+// parseWebhookContext parses the context of any kind of webhook. The body is
+// parsed leniently, because the context is only informational. Commands are
+// recorded in the "!merge" form, whichever of COMMAND_PREFIXES was used.
+func parseWebhookContext(conf Config, r *http.Request, body []byte) WebhookContext {
+	context := WebhookContext{
+		Event:      r.Header.Get("X-Github-Event"),
+		DeliveryID: r.Header.Get("X-Github-Delivery"),
+	}
+	var message struct {
+		Number int `json:"number"`
+		Issue  struct {
+			Number int `json:"number"`
+		} `json:"issue"`
+		PullRequest struct {
+			Number int `json:"number"`
+		} `json:"pull_request"`
+		Comment struct {
+			Body string `json:"body"`
+			User struct {
+				Login string `json:"login"`
+			} `json:"user"`
+		} `json:"comment"`
+		Review struct {
+			Body string `json:"body"`
+		} `json:"review"`
+		Sender struct {
+			Login string `json:"login"`
+		} `json:"sender"`
+		Repository messageRepository `json:"repository"`
+	}
+	if err := json.Unmarshal(body, &message); err != nil {
+		return context
+	}
+	context.Repository = Repository{
+		Owner: message.Repository.Owner.Login,
+		Name:  message.Repository.Name,
+		URL:   message.Repository.SSHURL,
+	}
+	switch {
+	case message.Number != 0:
+		context.PullRequest = message.Number
+	case message.Issue.Number != 0:
+		context.PullRequest = message.Issue.Number
+	default:
+		context.PullRequest = message.PullRequest.Number
+	}
+	commentBody := message.Comment.Body
+	if commentBody == "" {
+		commentBody = message.Review.Body
+	}
+	if command, isCommand := normalizeCommand(conf, commentBody); isCommand &&
+		parseComment(command) != regularComment {
+
+		context.Command = strings.TrimSpace(strings.SplitN(command, "\n", 2)[0])
+	}
+	context.Actor = message.Sender.Login
+	if context.Actor == "" {
+		context.Actor = message.Comment.User.Login
+	}
+	return context
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/salemove/github-review-helper/evaluator"
+)
+
+// The name of the gate that checks the PATH_RULES of the PR's changed files
+const pathRulesGate = "path rules"
+
+// PathRule lists what PRs changing files that match the pattern need before
+// they're merged, on top of the other gates.
+type PathRule struct {
+	// Pattern is matched against the changed files with matchesPathPattern
+	Pattern string
+	Labels  []string
+	// Teams are the teams, in the org/team-slug format, that each have to
+	// approve the PR
+	Teams []string
+	// Contexts are the status contexts that have to succeed on the PR's head
+	Contexts []string
+}
+
+func (r PathRule) matches(file string) bool {
+	return matchesPathPattern(r.Pattern, file)
+}
+
+// ParsePathRules parses a semicolon separated list of pattern=requirements
+// rules, where the requirements are separated by spaces, e.g.
+// "infra/=label:infra-reviewed team:@salemove/platform context:terraform;
+// *.sql=team:@salemove/dba".
+func ParsePathRules(rulesString string) ([]PathRule, error) {
+	rules := []PathRule{}
+	for _, ruleString := range strings.Split(rulesString, ";") {
+		ruleString = strings.TrimSpace(ruleString)
+		if ruleString == "" {
+			continue
+		}
+		i := strings.Index(ruleString, "=")
+		if i == -1 {
+			return nil, fmt.Errorf("rules must be in the pattern=requirements format, got \"%s\"", ruleString)
+		}
+		rule := PathRule{Pattern: strings.TrimSpace(ruleString[:i])}
+		if _, err := path.Match(rule.Pattern, ""); err != nil || rule.Pattern == "" {
+			return nil, fmt.Errorf("invalid pattern in \"%s\"", ruleString)
+		}
+		requirements := strings.Fields(ruleString[i+1:])
+		if len(requirements) == 0 {
+			return nil, fmt.Errorf("no requirements in \"%s\"", ruleString)
+		}
+		for _, requirement := range requirements {
+			j := strings.Index(requirement, ":")
+			if j <= 0 || j == len(requirement)-1 {
+				return nil, fmt.Errorf("requirements must be label:<name>, team:@<org>/<slug> or context:<name>, "+
+					"got \"%s\"", requirement)
+			}
+			switch value := requirement[j+1:]; requirement[:j] {
+			case "label":
+				rule.Labels = append(rule.Labels, value)
+			case "team":
+				team := strings.TrimPrefix(value, "@")
+				if !repositoryKeyRegexp.MatchString(team) {
+					return nil, fmt.Errorf("teams must be in the @org/team-slug format, got \"%s\"", value)
+				}
+				rule.Teams = append(rule.Teams, team)
+			case "context":
+				rule.Contexts = append(rule.Contexts, value)
+			default:
+				return nil, fmt.Errorf("requirements must be label:<name>, team:@<org>/<slug> or context:<name>, "+
+					"got \"%s\"", requirement)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// checkPathRules checks the PATH_RULES matching the PR's changed files. A
+// missing label or team approval or a failed status fails the PR, while
+// statuses that haven't succeeded yet only keep it pending. The PR's labels,
+// reviews and statuses are only fetched, if a matching rule needs them.
+func checkPathRules(ctx GateContext) (evaluator.Result, *ErrorResponse) {
+	conf := ctx.Config
+	issue := prIssue(ctx.PR)
+	if len(conf.PathRules) == 0 {
+		return passed("no path rules are configured"), nil
+	}
+	files, errResp := getPRFiles(issue, ctx.PullRequests)
+	if errResp != nil {
+		return evaluator.Result{}, errResp
+	}
+	var matching []PathRule
+	evidence := []string{}
+	for _, rule := range conf.PathRules {
+		for _, file := range files {
+			if rule.matches(file.GetFilename()) {
+				matching = append(matching, rule)
+				evidence = append(evidence, fmt.Sprintf("%s matches %s", file.GetFilename(), rule.Pattern))
+				break
+			}
+		}
+	}
+	if len(matching) == 0 {
+		return passed("none of the changed files match the path rules"), nil
+	}
+
+	var (
+		labels          map[string]bool
+		approvers       []string
+		reviewsExamined bool
+		statuses        map[string]string
+	)
+	var failures, waits []string
+	for _, rule := range matching {
+		if len(rule.Labels) > 0 && labels == nil {
+			labelList, errResp := getLabels(issue, ctx.Issues)
+			if errResp != nil {
+				return evaluator.Result{}, errResp
+			}
+			labels = make(map[string]bool)
+			for _, label := range labelList {
+				labels[label] = true
+			}
+		}
+		for _, label := range rule.Labels {
+			if !labels[label] {
+				failures = append(failures, fmt.Sprintf("changes to %s need the %s label", rule.Pattern, label))
+			}
+		}
+
+		if len(rule.Teams) > 0 && !reviewsExamined {
+			reviews, errResp := getReviews(issue, ctx.PullRequests)
+			if errResp != nil {
+				return evaluator.Result{}, errResp
+			}
+			var expiresBefore time.Time
+			if conf.ApprovalMaxAge != 0 {
+				expiresBefore = time.Now().Add(-conf.ApprovalMaxAge)
+			}
+			approvers, _, _ = currentReviewStates(reviews, *ctx.PR.Head.SHA, conf.IgnoreStaleApprovals,
+				expiresBefore)
+			reviewsExamined = true
+		}
+		for _, team := range rule.Teams {
+			approved, err := isApprovedByTeam(team, approvers, ctx.GraphQL)
+			if err != nil {
+				errorMessage := fmt.Sprintf("Failed to check the approvals of @%s on PR %s", team,
+					issue.FullName())
+				return evaluator.Result{}, &ErrorResponse{err, http.StatusBadGateway, errorMessage}
+			} else if !approved {
+				failures = append(failures, fmt.Sprintf("changes to %s need an approval from @%s", rule.Pattern,
+					team))
+			}
+		}
+
+		if len(rule.Contexts) > 0 && statuses == nil {
+			_, statusList, errResp := getStatuses(ctx.PR, ctx.Repositories)
+			if errResp != nil {
+				return evaluator.Result{}, errResp
+			}
+			statuses = make(map[string]string)
+			for _, status := range statusList {
+				statuses[status.GetContext()] = status.GetState()
+			}
+		}
+		for _, context := range rule.Contexts {
+			switch statuses[context] {
+			case "success":
+			case "failure", "error":
+				failures = append(failures, fmt.Sprintf("changes to %s need the %s status to succeed",
+					rule.Pattern, context))
+			default:
+				waits = append(waits, fmt.Sprintf("changes to %s are waiting for the %s status", rule.Pattern,
+					context))
+			}
+		}
+	}
+	evidence = append(append(evidence, failures...), waits...)
+	if len(failures) > 0 {
+		return failed(strings.Join(failures, " and "), evidence...), nil
+	} else if len(waits) > 0 {
+		return pending(strings.Join(waits, " and "), evidence...), nil
+	}
+	return passed(evidence...), nil
+}
+
+// isApprovedByTeam reports whether any of the approvers is a member of the
+// team.
+func isApprovedByTeam(team string, approvers []string, graphQL GraphQL) (bool, error) {
+	for _, approver := range approvers {
+		isMember, err := isTeamMember(team, approver, graphQL)
+		if err != nil {
+			return false, err
+		} else if isMember {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,208 @@
+package main_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParsePathRules", func() {
+	It("parses the requirements of each pattern", func() {
+		rules, err := grh.ParsePathRules("infra/=label:infra-reviewed team:@salemove/platform context:plan; " +
+			"*.sql=team:@salemove/dba")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rules).To(Equal([]grh.PathRule{
+			{
+				Pattern:  "infra/",
+				Labels:   []string{"infra-reviewed"},
+				Teams:    []string{"salemove/platform"},
+				Contexts: []string{"plan"},
+			},
+			{Pattern: "*.sql", Teams: []string{"salemove/dba"}},
+		}))
+	})
+
+	It("fails for an unknown requirement", func() {
+		_, err := grh.ParsePathRules("infra/=owner:alice")
+		Expect(err).To(MatchError(ContainSubstring("got \"owner:alice\"")))
+	})
+
+	It("fails for a rule without requirements", func() {
+		_, err := grh.ParsePathRules("infra/=")
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("path rules gate", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+			graphQL          *mocks.GraphQL
+
+			anyListOptions = mock.AnythingOfType("*github.ListOptions")
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+			graphQL = *context.GraphQL
+
+			context.Config.PathRules = []grh.PathRule{
+				{Pattern: "infra/", Labels: []string{"infra-reviewed"}, Teams: []string{"salemove/platform"}},
+				{Pattern: "*.sql", Contexts: []string{"migrations"}},
+			}
+		})
+
+		headSHA := "1235"
+		pr := &github.PullRequest{
+			Number:    github.Int(issueNumber),
+			Merged:    github.Bool(false),
+			Mergeable: github.Bool(true),
+			Base: &github.PullRequestBranch{
+				SHA:  github.String("1234"),
+				Ref:  github.String("master"),
+				Repo: repository,
+			},
+			Head: &github.PullRequestBranch{
+				SHA:  github.String(headSHA),
+				Ref:  github.String("feature"),
+				Repo: repository,
+			},
+			User: &github.User{
+				Login: github.String(arbitraryIssueAuthor),
+			},
+		}
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!status", arbitraryIssueAuthor)
+		})
+
+		BeforeEach(func() {
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+				Return(pr, emptyResponse, noError)
+			repositories.
+				On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA, anyListOptions).
+				Return(&github.CombinedStatus{
+					State: github.String("success"),
+					Statuses: []github.RepoStatus{{
+						Context: github.String("ci"),
+						State:   github.String("success"),
+					}},
+				}, emptyResponse, noError)
+			pullRequests.
+				On("ListReviews", anyContext, repositoryOwner, repositoryName, issueNumber, anyListOptions).
+				Return([]*github.PullRequestReview{{
+					State: github.String("APPROVED"),
+					User:  &github.User{Login: github.String("bob")},
+				}}, &github.Response{}, noError)
+			mockLabels(issues, issueNumber)
+		})
+
+		mockFiles := func(files ...string) {
+			commitFiles := make([]*github.CommitFile, len(files))
+			for i, file := range files {
+				commitFiles[i] = &github.CommitFile{Filename: github.String(file)}
+			}
+			pullRequests.
+				On("ListFiles", anyContext, repositoryOwner, repositoryName, issueNumber, anyListOptions).
+				Return(commitFiles, emptyResponse, noError)
+		}
+
+		mockTeamMembers := func(logins ...string) {
+			nodes := make([]interface{}, len(logins))
+			for i, login := range logins {
+				nodes[i] = map[string]string{"login": login}
+			}
+			data, err := json.Marshal(map[string]interface{}{
+				"organization": map[string]interface{}{
+					"team": map[string]interface{}{
+						"members": map[string]interface{}{"nodes": nodes},
+					},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			graphQL.
+				On("Query", anyContext, mock.AnythingOfType("string"), mock.Anything, mock.Anything).
+				Return(noError).
+				Run(func(args mock.Arguments) {
+					Expect(json.Unmarshal(data, args.Get(3))).To(Succeed())
+				})
+		}
+
+		expectComment := func(text string) {
+			issues.
+				On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+					mock.MatchedBy(commentContaining(text))).
+				Return(emptyResult, emptyResponse, noError)
+		}
+
+		Context("with the PR changing files no rule matches", func() {
+			BeforeEach(func() {
+				mockFiles("main.go")
+			})
+
+			It("passes the gate", func() {
+				expectComment(":white_check_mark: **path rules**")
+
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+			})
+		})
+
+		Context("with the PR changing infrastructure without the label and the team's approval", func() {
+			BeforeEach(func() {
+				mockFiles("infra/main.tf")
+				mockTeamMembers()
+			})
+
+			It("blocks the merge", func() {
+				expectComment(":x: **path rules**: changes to infra/ need the infra-reviewed label and changes to " +
+					"infra/ need an approval from @salemove/platform")
+
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+			})
+		})
+
+		Context("with the PR changing a migration whose status hasn't been reported", func() {
+			BeforeEach(func() {
+				mockFiles("db/001_users.sql")
+			})
+
+			It("waits for the status", func() {
+				expectComment("**path rules**: changes to *.sql are waiting for the migrations status")
+
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+			})
+		})
+	})
+})
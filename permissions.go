@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// repositoryRoles are the roles a user can have in a repository, from the
+// least to the most privileged
+var repositoryRoles = []string{"read", "triage", "write", "maintain", "admin"}
+
+const collaboratorPermissionQuery = `query($owner: String!, $name: String!, $login: String!) {
+  repository(owner: $owner, name: $name) {
+    collaborators(query: $login, first: 10) {
+      edges {
+        permission
+        node {
+          login
+        }
+      }
+    }
+  }
+}`
+
+type collaboratorPermissionResult struct {
+	Repository struct {
+		Collaborators struct {
+			Edges []struct {
+				Permission string `json:"permission"`
+				Node       struct {
+					Login string `json:"login"`
+				} `json:"node"`
+			} `json:"edges"`
+		} `json:"collaborators"`
+	} `json:"repository"`
+}
+
+const teamMembershipQuery = `query($org: String!, $slug: String!, $login: String!) {
+  organization(login: $org) {
+    team(slug: $slug) {
+      members(query: $login, first: 10) {
+        nodes {
+          login
+        }
+      }
+    }
+  }
+}`
+
+type teamMembershipResult struct {
+	Organization *struct {
+		Team *struct {
+			Members struct {
+				Nodes []struct {
+					Login string `json:"login"`
+				} `json:"nodes"`
+			} `json:"members"`
+		} `json:"team"`
+	} `json:"organization"`
+}
+
+// defaultCommandPermissions limit the commands COMMAND_PERMISSIONS has no
+// entries without a base branch for. Moderating the conversation, approving
+// first-time contributors, waiving sign-offs and reordering the merge queue is
+// left to maintainers and changing the branch protection to admins. Authors of
+// PRs don't have to be collaborators to say they've signed the CLA.
+var defaultCommandPermissions = map[string]CommandPermission{
+	"!lock":                {Command: "!lock", Role: "maintain"},
+	"!unlock":              {Command: "!unlock", Role: "maintain"},
+	"!protect":             {Command: "!protect", Role: "admin"},
+	"!approve-contributor": {Command: "!approve-contributor", Role: "maintain"},
+	"!dco-override":        {Command: "!dco-override", Role: "maintain"},
+	"!cla-signed":          {Command: "!cla-signed", Role: "read"},
+	"!priority":            {Command: "!priority", Role: "maintain"},
+}
+
+// CommandPermission limits who can issue a command: users with at least the
+// role in the repository or members of any of the teams.
+type CommandPermission struct {
+	// Command is the command, e.g. "!merge"
+	Command string
+	// BaseBranch limits the permission to PRs into the base branches
+	// matching the pattern, e.g. "release/*". Empty for all PRs.
+	BaseBranch string
+	// Role is the minimum role, e.g. "maintain". Empty, if only the teams
+	// can issue the command.
+	Role string
+	// Teams are the teams in the org/slug format
+	Teams []string
+}
+
+// ParseCommandPermissions parses a comma separated list of
+// command[:base branch pattern]=requirements entries, e.g.
+// "!rerun-checks=read, !merge:release/*=maintain @salemove/releasers". The
+// requirements are a space separated list of roles and @org/team-slug
+// teams, any of which allows issuing the command.
+func ParseCommandPermissions(permissionsString string) ([]CommandPermission, error) {
+	var permissions []CommandPermission
+	for _, entry := range getListFromString(permissionsString) {
+		i := strings.LastIndex(entry, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("expected command=requirements entries, got \"%s\"", entry)
+		}
+		permission := CommandPermission{Command: strings.TrimSpace(entry[:i])}
+		if j := strings.Index(permission.Command, ":"); j >= 0 {
+			permission.BaseBranch = strings.TrimSpace(permission.Command[j+1:])
+			permission.Command = strings.TrimSpace(permission.Command[:j])
+			if _, err := path.Match(permission.BaseBranch, ""); err != nil || permission.BaseBranch == "" {
+				return nil, fmt.Errorf("invalid base branch pattern \"%s\"", permission.BaseBranch)
+			}
+		}
+		if !isCommandName(strings.TrimPrefix(permission.Command, "!")) {
+			return nil, fmt.Errorf("unknown command \"%s\"", permission.Command)
+		}
+		requirements := strings.Fields(entry[i+1:])
+		if len(requirements) == 0 {
+			return nil, fmt.Errorf("expected a role or a team for %s", permission.Command)
+		}
+		for _, requirement := range requirements {
+			if strings.HasPrefix(requirement, "@") {
+				team := strings.TrimPrefix(requirement, "@")
+				if !repositoryKeyRegexp.MatchString(team) {
+					return nil, fmt.Errorf("teams must be in the @org/team-slug format, got \"%s\"", requirement)
+				}
+				permission.Teams = append(permission.Teams, team)
+			} else if roleRank(requirement) < 0 {
+				return nil, fmt.Errorf("roles must be read, triage, write, maintain or admin, got \"%s\"",
+					requirement)
+			} else if permission.Role != "" {
+				return nil, fmt.Errorf("expected a single role for %s, got \"%s\" and \"%s\"", permission.Command,
+					permission.Role, requirement)
+			} else {
+				permission.Role = requirement
+			}
+		}
+		permissions = append(permissions, permission)
+	}
+	return permissions, nil
+}
+
+func roleRank(role string) int {
+	for i, r := range repositoryRoles {
+		if r == role {
+			return i
+		}
+	}
+	return -1
+}
+
+// isOpenToAnyone reports whether anyone who can read the repository, and
+// therefore comment on it, can issue the command.
+func (p CommandPermission) isOpenToAnyone() bool {
+	return p.Role == "read"
+}
+
+// describe lists who can issue the command, e.g. "users with the maintain
+// role or higher or members of @salemove/releasers".
+func (p CommandPermission) describe() string {
+	var who []string
+	if p.Role != "" {
+		who = append(who, fmt.Sprintf("users with the %s role or higher", p.Role))
+	}
+	if len(p.Teams) > 0 {
+		who = append(who, "members of @"+strings.Join(p.Teams, ", @"))
+	}
+	return strings.Join(who, " or ")
+}
+
+// commandPermission returns the permission that applies to the command in
+// the comment or nil, if neither COMMAND_PERMISSIONS nor the default
+// permissions limit the command. A permission limited to the PR's base
+// branch takes precedence over one for all PRs, which takes precedence over
+// the default. The PR is only fetched, if there are permissions limited to base
+// branches for the command.
+func commandPermission(conf Config, issueComment IssueComment, commentCategory commentType,
+	pullRequests PullRequests) (*CommandPermission, *ErrorResponse) {
+
+	command := commandNames[commentCategory]
+	var general *CommandPermission
+	base := ""
+	for i, permission := range conf.CommandPermissions {
+		if permission.Command != command {
+			continue
+		} else if permission.BaseBranch == "" {
+			if general == nil {
+				general = &conf.CommandPermissions[i]
+			}
+			continue
+		}
+		if base == "" {
+			pr, errResp := getPR(issueComment, pullRequests)
+			if errResp != nil {
+				return nil, errResp
+			}
+			base = pr.Base.GetRef()
+		}
+		if matched, _ := path.Match(permission.BaseBranch, base); matched {
+			return &conf.CommandPermissions[i], nil
+		}
+	}
+	if general == nil {
+		if permission, exists := defaultCommandPermissions[command]; exists {
+			return &permission, nil
+		}
+	}
+	return general, nil
+}
+
+// hasCommandPermission checks whether the commenter has the role the
+// permission requires or is a member of one of its teams.
+func hasCommandPermission(permission CommandPermission, issueComment IssueComment,
+	graphQL GraphQL) (bool, error) {
+
+	login := issueComment.Commenter.Login
+	if permission.Role != "" {
+		role, err := collaboratorRole(issueComment.Repository, login, graphQL)
+		if err != nil {
+			return false, err
+		} else if roleRank(role) >= roleRank(permission.Role) {
+			return true, nil
+		}
+	}
+	for _, team := range permission.Teams {
+		isMember, err := isTeamMember(team, login, graphQL)
+		if err != nil {
+			return false, err
+		} else if isMember {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// collaboratorRole returns the user's role in the repository, e.g. "write",
+// or an empty string, if the user is not a collaborator.
+func collaboratorRole(repository Repository, login string, graphQL GraphQL) (string, error) {
+	variables := map[string]interface{}{
+		"owner": repository.Owner,
+		"name":  repository.Name,
+		"login": login,
+	}
+	var result collaboratorPermissionResult
+	if err := graphQL.Query(context.TODO(), collaboratorPermissionQuery, variables, &result); err != nil {
+		return "", err
+	}
+	for _, edge := range result.Repository.Collaborators.Edges {
+		if strings.EqualFold(edge.Node.Login, login) {
+			return strings.ToLower(edge.Permission), nil
+		}
+	}
+	return "", nil
+}
+
+// isTeamMember checks whether the user is a member of the org/slug team. A
+// team the bot can't see has no members.
+func isTeamMember(team, login string, graphQL GraphQL) (bool, error) {
+	parts := strings.SplitN(team, "/", 2)
+	variables := map[string]interface{}{
+		"org":   parts[0],
+		"slug":  parts[1],
+		"login": login,
+	}
+	var result teamMembershipResult
+	if err := graphQL.Query(context.TODO(), teamMembershipQuery, variables, &result); err != nil {
+		return false, err
+	} else if result.Organization == nil || result.Organization.Team == nil {
+		return false, nil
+	}
+	for _, member := range result.Organization.Team.Members.Nodes {
+		if strings.EqualFold(member.Login, login) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// checkCommandPermission refuses the command with a comment, if the commenter
+// doesn't have the permission COMMAND_PERMISSIONS requires for it.
+func checkCommandPermission(conf Config, issueComment IssueComment, permission CommandPermission, issues Issues,
+	graphQL GraphQL) (*SuccessResponse, *ErrorResponse) {
+
+	allowed, err := hasCommandPermission(permission, issueComment, graphQL)
+	if err != nil {
+		message := fmt.Sprintf("Failed to check if %s can issue %s", issueComment.Commenter.Login,
+			permission.Command)
+		return nil, &ErrorResponse{err, http.StatusBadGateway, message}
+	} else if allowed {
+		return nil, nil
+	}
+	err = comment(
+		renderMessage(conf, insufficientPermissionMessage, commandMessageData(issueComment, map[string]interface{}{
+			"Command":  permission.Command,
+			"Required": permission.describe(),
+		})),
+		issueComment.Repository,
+		issueComment.IssueNumber,
+		issues,
+	)
+	if err != nil {
+		return nil, &ErrorResponse{err, http.StatusBadGateway, "Failed to respond to unauthorized command"}
+	}
+	return &SuccessResponse{fmt.Sprintf("%s doesn't have the permission to issue %s. Responded with a comment. "+
+		"Ignoring the command.", issueComment.Commenter.Login, permission.Command)}, nil
+}
@@ -0,0 +1,145 @@
+package main_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("COMMAND_PERMISSIONS", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+			graphQL          *mocks.GraphQL
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			repositories = *context.Repositories
+			issues = *context.Issues
+			graphQL = *context.GraphQL
+			context.Config.CommandPermissions = []grh.CommandPermission{
+				{Command: "!hold", Role: "maintain", Teams: []string{"salemove/releasers"}},
+			}
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!hold", arbitraryIssueAuthor)
+		})
+
+		mockQuery := func(variable string, result map[string]interface{}) {
+			data, err := json.Marshal(result)
+			Expect(err).NotTo(HaveOccurred())
+			graphQL.
+				On("Query", anyContext, mock.AnythingOfType("string"), mock.MatchedBy(
+					func(variables map[string]interface{}) bool {
+						_, exists := variables[variable]
+						return exists
+					}), mock.Anything).
+				Return(noError).
+				Run(func(args mock.Arguments) {
+					Expect(json.Unmarshal(data, args.Get(3))).To(Succeed())
+				})
+		}
+		mockRole := func(permission string) {
+			mockQuery("owner", map[string]interface{}{
+				"repository": map[string]interface{}{
+					"collaborators": map[string]interface{}{
+						"edges": []interface{}{
+							map[string]interface{}{
+								"permission": permission,
+								"node":       map[string]string{"login": arbitraryIssueAuthor},
+							},
+						},
+					},
+				},
+			})
+		}
+		mockTeamMembers := func(logins ...string) {
+			members := make([]interface{}, len(logins))
+			for i, login := range logins {
+				members[i] = map[string]string{"login": login}
+			}
+			mockQuery("slug", map[string]interface{}{
+				"organization": map[string]interface{}{
+					"team": map[string]interface{}{
+						"members": map[string]interface{}{"nodes": members},
+					},
+				},
+			})
+		}
+
+		Context("with the commenter having the required role", func() {
+			BeforeEach(func() {
+				mockRole("MAINTAIN")
+				issues.
+					On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+						[]string{grh.OnHoldLabel}).
+					Return(emptyResult, emptyResponse, noError)
+			})
+
+			It("runs the command", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+			})
+		})
+
+		Context("with the commenter being a member of the team", func() {
+			BeforeEach(func() {
+				mockRole("WRITE")
+				mockTeamMembers(arbitraryIssueAuthor)
+				issues.
+					On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+						[]string{grh.OnHoldLabel}).
+					Return(emptyResult, emptyResponse, noError)
+			})
+
+			It("runs the command", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+			})
+		})
+
+		Context("with the commenter having neither", func() {
+			BeforeEach(func() {
+				mockRole("WRITE")
+				mockTeamMembers("someone-else")
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("Only users with the maintain role or higher or members "+
+							"of @salemove/releasers can ask me to `!hold` here."))).
+					Return(emptyResult, emptyResponse, noError)
+			})
+
+			It("refuses the command", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+				issues.AssertNotCalled(GinkgoT(), "AddLabelsToIssue", anyContext, repositoryOwner, repositoryName,
+					issueNumber, []string{grh.OnHoldLabel})
+			})
+		})
+	})
+})
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"time"
+)
+
+var (
+	repositoryKeyRegexp   = regexp.MustCompile(`^[\w.-]+/[\w.-]+$`)
+	organizationKeyRegexp = regexp.MustCompile(`^[\w.-]+$`)
+)
+
+// Policy overrides the merge settings of the layer below it. Policies are
+// layered global configuration → tenant → organization → repository.
+// Settings left out (nil) are inherited from the layer below, while settings
+// that are set, even to false or 0, override it.
+type Policy struct {
+	RequiredApprovals            *int      `json:"required_approvals,omitempty"`
+	IgnoreStaleApprovals         *bool     `json:"ignore_stale_approvals,omitempty"`
+	ApprovalMaxAge               *Duration `json:"approval_max_age,omitempty"`
+	RequireResolvedConversations *bool     `json:"require_resolved_conversations,omitempty"`
+	AllowStatusOverrides         *bool     `json:"allow_status_overrides,omitempty"`
+	MergeStrategy                *string   `json:"merge_strategy,omitempty"`
+	PreMergeHooksBlock           *bool     `json:"pre_merge_hooks_block,omitempty"`
+	NotificationDigestInterval   *Duration `json:"notification_digest_interval,omitempty"`
+	ReviewerAssignment           *string   `json:"reviewer_assignment,omitempty"`
+	NativeMergeQueue             *bool     `json:"native_merge_queue,omitempty"`
+	DependencyAutoMerge          *string   `json:"dependency_auto_merge,omitempty"`
+	// NotificationRoutes replace the routes of the layer below. An empty
+	// list turns the notifications off.
+	NotificationRoutes *NotificationRoutes `json:"notification_routes,omitempty"`
+	// MergeBaseBranches replace the allowed base branches of the layer
+	// below. An empty list allows all base branches.
+	MergeBaseBranches *[]string `json:"merge_base_branches,omitempty"`
+	// TwoPersonMergeBranches replace the base branches of the layer below
+	// that need a second maintainer to confirm merges. An empty list turns
+	// the confirmations off.
+	TwoPersonMergeBranches *[]string `json:"two_person_merge_branches,omitempty"`
+	// HeadBranchPatterns replace the head branch naming patterns of the
+	// layer below. An empty list allows all names.
+	HeadBranchPatterns *[]string `json:"head_branch_patterns,omitempty"`
+	HeadBranchPolicy   *string   `json:"head_branch_policy,omitempty"`
+	StaleCIAge         *Duration `json:"stale_ci_age,omitempty"`
+	StaleCICloseAfter  *Duration `json:"stale_ci_close_after,omitempty"`
+	// CommandAliases replace the command aliases of the layer below. An
+	// empty map turns the aliases off.
+	CommandAliases *map[string]string `json:"command_aliases,omitempty"`
+	// MergeGates replace the gates of the layer below. An empty list checks
+	// all of the built-in gates.
+	MergeGates *[]string `json:"merge_gates,omitempty"`
+	// PreMergeHooks and PostMergeHooks replace the hooks of the layer
+	// below. An empty list runs no hooks.
+	PreMergeHooks  *[]string `json:"pre_merge_hooks,omitempty"`
+	PostMergeHooks *[]string `json:"post_merge_hooks,omitempty"`
+}
+
+// PolicySet is the declarative format the organization and repository
+// policies are exported and imported in. Importing a PolicySet replaces all
+// of the policies, so organizations and repositories missing from it fall
+// back to the layer below.
+type PolicySet struct {
+	// Organizations maps owner to the policy of all of the owner's
+	// repositories
+	Organizations map[string]Policy `json:"organizations"`
+	// Repositories maps owner/name to the repository's policy
+	Repositories map[string]Policy `json:"repositories"`
+}
+
+// Duration is a time.Duration that's encoded in JSON in the format defined in
+// time.ParseDuration, e.g. "72h".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var durationString string
+	if err := json.Unmarshal(data, &durationString); err != nil {
+		return fmt.Errorf("durations must be strings, e.g. \"72h\", got %s", data)
+	}
+	duration, err := time.ParseDuration(durationString)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+func (p Policy) validate() error {
+	if p.RequiredApprovals != nil && *p.RequiredApprovals < 0 {
+		return fmt.Errorf("required_approvals must not be negative")
+	} else if p.ApprovalMaxAge != nil && *p.ApprovalMaxAge < 0 {
+		return fmt.Errorf("approval_max_age must not be negative")
+	} else if p.NotificationDigestInterval != nil && *p.NotificationDigestInterval < 0 {
+		return fmt.Errorf("notification_digest_interval must not be negative")
+	} else if p.StaleCIAge != nil && *p.StaleCIAge < 0 {
+		return fmt.Errorf("stale_ci_age must not be negative")
+	} else if p.StaleCICloseAfter != nil && *p.StaleCICloseAfter < 0 {
+		return fmt.Errorf("stale_ci_close_after must not be negative")
+	} else if p.MergeStrategy != nil && !isMergeStrategy(*p.MergeStrategy) {
+		return fmt.Errorf("merge_strategy must be one of \"%s\", \"%s\" and \"%s\", got \"%s\"", MergeStrategyMerge,
+			MergeStrategyVerifiedRebase, MergeStrategyFastForward, *p.MergeStrategy)
+	} else if p.ReviewerAssignment != nil {
+		if err := validateReviewerAssignment(*p.ReviewerAssignment); err != nil {
+			return fmt.Errorf("reviewer_assignment %v", err)
+		}
+	}
+	if p.DependencyAutoMerge != nil {
+		if err := validateDependencyAutoMerge(*p.DependencyAutoMerge); err != nil {
+			return fmt.Errorf("dependency_auto_merge %v", err)
+		}
+	}
+	if p.MergeBaseBranches != nil {
+		for _, pattern := range *p.MergeBaseBranches {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("merge_base_branches includes an invalid pattern \"%s\"", pattern)
+			}
+		}
+	}
+	if p.TwoPersonMergeBranches != nil {
+		for _, pattern := range *p.TwoPersonMergeBranches {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("two_person_merge_branches includes an invalid pattern \"%s\"", pattern)
+			}
+		}
+	}
+	if p.HeadBranchPatterns != nil {
+		for _, pattern := range *p.HeadBranchPatterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("head_branch_patterns includes an invalid pattern \"%s\"", pattern)
+			}
+		}
+	}
+	if p.HeadBranchPolicy != nil {
+		if err := validateHeadBranchPolicy(*p.HeadBranchPolicy); err != nil {
+			return fmt.Errorf("head_branch_policy %v", err)
+		}
+	}
+	if p.CommandAliases != nil {
+		if err := validateCommandAliases(*p.CommandAliases); err != nil {
+			return fmt.Errorf("command_aliases %v", err)
+		}
+	}
+	if p.MergeGates != nil {
+		if err := validateMergeGates(*p.MergeGates); err != nil {
+			return fmt.Errorf("merge_gates %v", err)
+		}
+	}
+	return nil
+}
+
+// Validate checks all of the policies, so that an invalid policy wouldn't
+// leave the set partially applied.
+func (s PolicySet) Validate() error {
+	for _, key := range sortedPolicyKeys(s.Organizations) {
+		if !organizationKeyRegexp.MatchString(key) {
+			return fmt.Errorf("organizations must be owner names, got \"%s\"", key)
+		} else if err := s.Organizations[key].validate(); err != nil {
+			return fmt.Errorf("invalid policy for %s: %v", key, err)
+		}
+	}
+	for _, key := range sortedPolicyKeys(s.Repositories) {
+		if !repositoryKeyRegexp.MatchString(key) {
+			return fmt.Errorf("repositories must be in the owner/name format, got \"%s\"", key)
+		} else if err := s.Repositories[key].validate(); err != nil {
+			return fmt.Errorf("invalid policy for %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+func sortedPolicyKeys(policies map[string]Policy) []string {
+	keys := make([]string, 0, len(policies))
+	for key := range policies {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// withPolicy returns the configuration with the policy's settings overriding
+// the configuration's.
+func (c Config) withPolicy(p Policy) Config {
+	if p.RequiredApprovals != nil {
+		c.RequiredApprovals = *p.RequiredApprovals
+	}
+	if p.IgnoreStaleApprovals != nil {
+		c.IgnoreStaleApprovals = *p.IgnoreStaleApprovals
+	}
+	if p.ApprovalMaxAge != nil {
+		c.ApprovalMaxAge = time.Duration(*p.ApprovalMaxAge)
+	}
+	if p.RequireResolvedConversations != nil {
+		c.RequireResolvedConversations = *p.RequireResolvedConversations
+	}
+	if p.AllowStatusOverrides != nil {
+		c.AllowStatusOverrides = *p.AllowStatusOverrides
+	}
+	if p.MergeStrategy != nil {
+		c.MergeStrategy = *p.MergeStrategy
+	}
+	if p.PreMergeHooksBlock != nil {
+		c.PreMergeHooksBlock = *p.PreMergeHooksBlock
+	}
+	if p.PreMergeHooks != nil {
+		c.PreMergeHooks = *p.PreMergeHooks
+	}
+	if p.PostMergeHooks != nil {
+		c.PostMergeHooks = *p.PostMergeHooks
+	}
+	if p.NotificationDigestInterval != nil {
+		c.NotificationDigestInterval = time.Duration(*p.NotificationDigestInterval)
+	}
+	if p.ReviewerAssignment != nil {
+		c.ReviewerAssignment = *p.ReviewerAssignment
+	}
+	if p.NativeMergeQueue != nil {
+		c.NativeMergeQueue = *p.NativeMergeQueue
+	}
+	if p.DependencyAutoMerge != nil {
+		c.DependencyAutoMerge = *p.DependencyAutoMerge
+	}
+	if p.NotificationRoutes != nil {
+		c.NotificationRoutes = *p.NotificationRoutes
+	}
+	if p.MergeBaseBranches != nil {
+		c.MergeBaseBranches = *p.MergeBaseBranches
+	}
+	if p.TwoPersonMergeBranches != nil {
+		c.TwoPersonMergeBranches = *p.TwoPersonMergeBranches
+	}
+	if p.HeadBranchPatterns != nil {
+		c.HeadBranchPatterns = *p.HeadBranchPatterns
+	}
+	if p.HeadBranchPolicy != nil {
+		c.HeadBranchPolicy = *p.HeadBranchPolicy
+	}
+	if p.StaleCIAge != nil {
+		c.StaleCIAge = time.Duration(*p.StaleCIAge)
+	}
+	if p.StaleCICloseAfter != nil {
+		c.StaleCICloseAfter = time.Duration(*p.StaleCICloseAfter)
+	}
+	if p.CommandAliases != nil {
+		c.CommandAliases = *p.CommandAliases
+	}
+	if p.MergeGates != nil {
+		c.MergeGates = *p.MergeGates
+	}
+	return c
+}
+
+// configPolicy returns the settings of the global configuration as a policy
+// with every setting set.
+func configPolicy(conf Config) Policy {
+	approvalMaxAge := Duration(conf.ApprovalMaxAge)
+	notificationDigestInterval := Duration(conf.NotificationDigestInterval)
+	staleCIAge := Duration(conf.StaleCIAge)
+	staleCICloseAfter := Duration(conf.StaleCICloseAfter)
+	mergeGates := mergeGates(conf)
+	return Policy{
+		RequiredApprovals:            &conf.RequiredApprovals,
+		IgnoreStaleApprovals:         &conf.IgnoreStaleApprovals,
+		ApprovalMaxAge:               &approvalMaxAge,
+		RequireResolvedConversations: &conf.RequireResolvedConversations,
+		AllowStatusOverrides:         &conf.AllowStatusOverrides,
+		MergeStrategy:                &conf.MergeStrategy,
+		PreMergeHooksBlock:           &conf.PreMergeHooksBlock,
+		PreMergeHooks:                &conf.PreMergeHooks,
+		PostMergeHooks:               &conf.PostMergeHooks,
+		NotificationDigestInterval:   &notificationDigestInterval,
+		ReviewerAssignment:           &conf.ReviewerAssignment,
+		NativeMergeQueue:             &conf.NativeMergeQueue,
+		DependencyAutoMerge:          &conf.DependencyAutoMerge,
+		NotificationRoutes:           &conf.NotificationRoutes,
+		MergeBaseBranches:            &conf.MergeBaseBranches,
+		TwoPersonMergeBranches:       &conf.TwoPersonMergeBranches,
+		HeadBranchPatterns:           &conf.HeadBranchPatterns,
+		HeadBranchPolicy:             &conf.HeadBranchPolicy,
+		StaleCIAge:                   &staleCIAge,
+		StaleCICloseAfter:            &staleCICloseAfter,
+		CommandAliases:               &conf.CommandAliases,
+		MergeGates:                   &mergeGates,
+	}
+}
+
+// repositoryPolicies returns the policies of the repository's organization
+// and of the repository itself. Either is nil, if there's no such policy.
+func repositoryPolicies(repository Repository, store Store) (*Policy, *Policy, *ErrorResponse) {
+	var organizationPolicy, policy *Policy
+	if orgPolicy, exists, err := store.OrganizationPolicy(repository.Owner); err != nil {
+		message := fmt.Sprintf("Failed to get the policy of %s", repository.Owner)
+		return nil, nil, &ErrorResponse{err, http.StatusInternalServerError, message}
+	} else if exists {
+		organizationPolicy = &orgPolicy
+	}
+	if repoPolicy, exists, err := store.Policy(repository); err != nil {
+		message := fmt.Sprintf("Failed to get the policy of %s", repositoryKey(repository))
+		return nil, nil, &ErrorResponse{err, http.StatusInternalServerError, message}
+	} else if exists {
+		policy = &repoPolicy
+	}
+	return organizationPolicy, policy, nil
+}
+
+// repositoryConfig returns the configuration to use for the repository, with
+// the policies of its tenant, of its organization and of the repository
+// applied, in that order, and with SoftFail set, if the repository is in its
+// soft-fail period.
+func repositoryConfig(conf Config, repository Repository, store Store) (Config, *ErrorResponse) {
+	if repository.Owner == "" {
+		return conf, nil
+	}
+	organizationPolicy, policy, errResp := repositoryPolicies(repository, store)
+	if errResp != nil {
+		return conf, errResp
+	}
+	conf = conf.withPolicies(conf.tenantPolicy(repository), organizationPolicy, policy)
+	conf.SoftFail, errResp = isInSoftFailPeriod(conf, repository, store)
+	return conf, errResp
+}
+
+// withPolicies applies the policies that aren't nil in the given order.
+func (c Config) withPolicies(policies ...*Policy) Config {
+	for _, policy := range policies {
+		if policy != nil {
+			c = c.withPolicy(*policy)
+		}
+	}
+	return c
+}
+
+// effectivePolicy describes the policy that applies to a repository and the
+// layers it was merged from. A layer is null, if there's no policy for it.
+type effectivePolicy struct {
+	Repository string       `json:"repository"`
+	Effective  Policy       `json:"effective"`
+	Layers     policyLayers `json:"layers"`
+}
+
+type policyLayers struct {
+	Global       Policy  `json:"global"`
+	Tenant       *Policy `json:"tenant"`
+	Organization *Policy `json:"organization"`
+	Repository   *Policy `json:"repository"`
+}
+
+func getEffectivePolicy(conf Config, repository Repository, store Store) (effectivePolicy, *ErrorResponse) {
+	organizationPolicy, policy, errResp := repositoryPolicies(repository, store)
+	if errResp != nil {
+		return effectivePolicy{}, errResp
+	}
+	tenantPolicy := conf.tenantPolicy(repository)
+	return effectivePolicy{
+		Repository: repositoryKey(repository),
+		Effective:  configPolicy(conf.withPolicies(tenantPolicy, organizationPolicy, policy)),
+		Layers: policyLayers{
+			Global:       configPolicy(conf),
+			Tenant:       tenantPolicy,
+			Organization: organizationPolicy,
+			Repository:   policy,
+		},
+	}, nil
+}
+
+// policyChanges lists the organizations and repositories whose policies
+// importing the set would add, change or remove, sorted by name.
+type policyChanges struct {
+	Added   []string `json:"added"`
+	Changed []string `json:"changed"`
+	Removed []string `json:"removed"`
+}
+
+func diffPolicies(current, imported PolicySet) (policyChanges, error) {
+	changes := policyChanges{Added: []string{}, Changed: []string{}, Removed: []string{}}
+	// Organizations and repositories can't be confused, because only the
+	// latter include a slash
+	if err := changes.add(current.Organizations, imported.Organizations); err != nil {
+		return policyChanges{}, err
+	} else if err = changes.add(current.Repositories, imported.Repositories); err != nil {
+		return policyChanges{}, err
+	}
+	sort.Strings(changes.Added)
+	sort.Strings(changes.Changed)
+	sort.Strings(changes.Removed)
+	return changes, nil
+}
+
+func (changes *policyChanges) add(current, imported map[string]Policy) error {
+	for key, policy := range imported {
+		currentPolicy, exists := current[key]
+		if !exists {
+			changes.Added = append(changes.Added, key)
+			continue
+		}
+		// Comparing the encoded policies, because the policies consist of
+		// pointers
+		currentJSON, err := json.Marshal(currentPolicy)
+		if err != nil {
+			return err
+		}
+		importedJSON, err := json.Marshal(policy)
+		if err != nil {
+			return err
+		}
+		if string(currentJSON) != string(importedJSON) {
+			changes.Changed = append(changes.Changed, key)
+		}
+	}
+	for key := range current {
+		if _, exists := imported[key]; !exists {
+			changes.Removed = append(changes.Removed, key)
+		}
+	}
+	return nil
+}
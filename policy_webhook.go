@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/salemove/github-review-helper/evaluator"
+)
+
+// The name of the gate that asks POLICY_WEBHOOK_URL whether to merge a PR
+const policyWebhookGate = "policy webhook"
+
+// How much of the policy webhook's response is read
+const maxPolicyWebhookResponseSize = 64 * 1024
+
+var policyWebhookHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// PolicyWebhookRequest describes the PR the policy webhook is asked about.
+// It's the JSON body of the request.
+type PolicyWebhookRequest struct {
+	Repository string   `json:"repository"`
+	Number     int      `json:"number"`
+	Title      string   `json:"title"`
+	Body       string   `json:"body"`
+	Author     string   `json:"author"`
+	BaseRef    string   `json:"base_ref"`
+	HeadRef    string   `json:"head_ref"`
+	HeadSHA    string   `json:"head_sha"`
+	Labels     []string `json:"labels"`
+}
+
+// PolicyWebhookResponse is the policy webhook's decision. The PR is only
+// merged if Allow is true. Reason explains a denial to the PR's reviewers,
+// e.g. "it lacks a security review".
+type PolicyWebhookResponse struct {
+	Allow  bool   `json:"allow"`
+	Reason string `json:"reason"`
+}
+
+// checkPolicyWebhook asks POLICY_WEBHOOK_URL whether the PR can be merged.
+// Failed requests and unexpected responses fail the check, so that PRs
+// wouldn't be merged past an unavailable compliance system.
+func checkPolicyWebhook(ctx GateContext) (evaluator.Result, *ErrorResponse) {
+	conf := ctx.Config
+	issue := prIssue(ctx.PR)
+	if conf.PolicyWebhookURL == "" {
+		return failed("POLICY_WEBHOOK_URL isn't set"), nil
+	}
+	labels, errResp := getLabels(issue, ctx.Issues)
+	if errResp != nil {
+		return evaluator.Result{}, errResp
+	}
+	request := PolicyWebhookRequest{
+		Repository: repositoryKey(issue.Repository),
+		Number:     issue.Number,
+		Title:      ctx.PR.GetTitle(),
+		Body:       ctx.PR.GetBody(),
+		Author:     ctx.PR.User.GetLogin(),
+		BaseRef:    ctx.PR.Base.GetRef(),
+		HeadRef:    ctx.PR.Head.GetRef(),
+		HeadSHA:    ctx.PR.Head.GetSHA(),
+		Labels:     labels,
+	}
+	decision, err := callPolicyWebhook(conf.PolicyWebhookURL, conf.PolicyWebhookSecret, request)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Failed to ask the policy webhook whether to merge PR %s", issue.FullName())
+		return evaluator.Result{}, &ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	} else if !decision.Allow {
+		reason := decision.Reason
+		if reason == "" {
+			reason = "the policy webhook denied it"
+		}
+		return failed(reason), nil
+	}
+	return passed(), nil
+}
+
+// callPolicyWebhook posts the request to the URL. If the secret is set, the
+// body is signed with it in the X-Hub-Signature-256 header, in the format
+// GitHub signs its webhooks in.
+func callPolicyWebhook(url, secret string, request PolicyWebhookRequest) (PolicyWebhookResponse, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return PolicyWebhookResponse{}, err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return PolicyWebhookResponse{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := policyWebhookHTTPClient.Do(req)
+	if err != nil {
+		return PolicyWebhookResponse{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return PolicyWebhookResponse{}, fmt.Errorf("responded with %s", resp.Status)
+	}
+	responseBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxPolicyWebhookResponseSize))
+	if err != nil {
+		return PolicyWebhookResponse{}, err
+	}
+	var decision PolicyWebhookResponse
+	if err = json.Unmarshal(responseBody, &decision); err != nil {
+		return PolicyWebhookResponse{}, fmt.Errorf("responded with an invalid decision: %v", err)
+	}
+	return decision, nil
+}
@@ -0,0 +1,161 @@
+package main_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("policy webhook gate", func() {
+		const secret = "policy-secret"
+
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+
+			policyWebhook *httptest.Server
+			decision      string
+			requests      []grh.PolicyWebhookRequest
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+
+			decision = `{"allow": true}`
+			requests = nil
+			policyWebhook = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				mac := hmac.New(sha256.New, []byte(secret))
+				mac.Write(body)
+				Expect(r.Header.Get("X-Hub-Signature-256")).To(Equal("sha256=" + hex.EncodeToString(mac.Sum(nil))))
+				var request grh.PolicyWebhookRequest
+				Expect(json.Unmarshal(body, &request)).To(Succeed())
+				requests = append(requests, request)
+				w.Write([]byte(decision))
+			}))
+			context.Config.PolicyWebhookURL = policyWebhook.URL
+			context.Config.PolicyWebhookSecret = secret
+		})
+		AfterEach(func() {
+			policyWebhook.Close()
+		})
+
+		headSHA := "1235"
+		pr := &github.PullRequest{
+			Number:    github.Int(issueNumber),
+			Title:     github.String("Add the widget"),
+			Merged:    github.Bool(false),
+			Mergeable: github.Bool(true),
+			Base: &github.PullRequestBranch{
+				SHA:  github.String("1234"),
+				Ref:  github.String("master"),
+				Repo: repository,
+			},
+			Head: &github.PullRequestBranch{
+				SHA:  github.String(headSHA),
+				Ref:  github.String("feature"),
+				Repo: repository,
+			},
+			User: &github.User{
+				Login: github.String(arbitraryIssueAuthor),
+			},
+		}
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!status", arbitraryIssueAuthor)
+		})
+
+		BeforeEach(func() {
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+				Return(pr, emptyResponse, noError)
+			repositories.
+				On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+					mock.AnythingOfType("*github.ListOptions")).
+				Return(&github.CombinedStatus{
+					State: github.String("success"),
+				}, emptyResponse, noError)
+			mockLabels(issues, issueNumber, "security")
+		})
+
+		expectComment := func(text string) {
+			issues.
+				On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+					mock.MatchedBy(commentContaining(text))).
+				Return(emptyResult, emptyResponse, noError)
+		}
+
+		It("asks the webhook about the PR", func() {
+			expectComment(":white_check_mark: **policy webhook**")
+
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			Expect(requests).To(Equal([]grh.PolicyWebhookRequest{{
+				Repository: repositoryOwner + "/" + repositoryName,
+				Number:     issueNumber,
+				Title:      "Add the widget",
+				Author:     arbitraryIssueAuthor,
+				BaseRef:    "master",
+				HeadRef:    "feature",
+				HeadSHA:    headSHA,
+				Labels:     []string{"security"},
+			}}))
+			issues.AssertExpectations(GinkgoT())
+		})
+
+		Context("with the webhook denying the merge", func() {
+			BeforeEach(func() {
+				decision = `{"allow": false, "reason": "it lacks a security review"}`
+			})
+
+			It("blocks the merge with the webhook's reason", func() {
+				expectComment(":x: **policy webhook**: it lacks a security review")
+
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+			})
+		})
+
+		Context("with the webhook responding with an invalid decision", func() {
+			BeforeEach(func() {
+				decision = "OK"
+			})
+
+			It("fails the evaluation", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusBadGateway))
+				Expect(responseRecorder.Body.String()).To(ContainSubstring("Failed to ask the policy webhook"))
+			})
+		})
+	})
+})
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/evaluator"
+)
+
+const descriptionCheckRunName = "review-helper/description"
+
+// allChecklistItems is the PR_CHECKLIST value that requires all of the task
+// list items of the description to be ticked
+const allChecklistItems = "all"
+
+// markdownHeadingRegexp matches the Markdown headings of a PR's description
+// and captures their text.
+var markdownHeadingRegexp = regexp.MustCompile(`(?m)^ {0,3}#{1,6}[ \t]+(.*?)[ \t#]*$`)
+
+// markdownLineHeadingRegexp matches a line that's a Markdown heading and
+// captures its level and its text.
+var markdownLineHeadingRegexp = regexp.MustCompile(`^ {0,3}(#{1,6})[ \t]+(.*?)[ \t#]*$`)
+
+// taskListItemRegexp matches a GitHub task list item and captures its
+// checkbox's mark and its text.
+var taskListItemRegexp = regexp.MustCompile(`^\s*(?:[-*+]|\d+[.)])\s+\[([ xX])\]\s+(.*?)\s*$`)
+
+func descriptionRulesEnabled(conf Config) bool {
+	return conf.PRTitlePattern != nil || conf.PRTitleMaxLength > 0 || len(conf.PRBodySections) > 0 ||
+		conf.PRChecklist != ""
+}
+
+// checklist describes the task list items of a PR's description that
+// PR_CHECKLIST requires to be ticked.
+type checklist struct {
+	ticked int
+	// unticked holds the texts of the items that aren't ticked
+	unticked []string
+}
+
+func (c checklist) total() int {
+	return c.ticked + len(c.unticked)
+}
+
+// parseChecklist collects the task list items of the description. With a
+// section, only the items under the section's heading, including its
+// subsections, are collected.
+func parseChecklist(body, section string) checklist {
+	var items checklist
+	inSection, sectionLevel := section == allChecklistItems, 0
+	for _, line := range strings.Split(strings.Replace(body, "\r\n", "\n", -1), "\n") {
+		if heading := markdownLineHeadingRegexp.FindStringSubmatch(line); heading != nil && section != allChecklistItems {
+			level := len(heading[1])
+			if strings.EqualFold(heading[2], section) {
+				inSection, sectionLevel = true, level
+			} else if inSection && level <= sectionLevel {
+				inSection = false
+			}
+			continue
+		}
+		item := taskListItemRegexp.FindStringSubmatch(line)
+		if !inSection || item == nil {
+			continue
+		}
+		if item[1] == " " {
+			items.unticked = append(items.unticked, item[2])
+		} else {
+			items.ticked++
+		}
+	}
+	return items
+}
+
+// validatePRDescription checks the PR's title and description against the
+// configured rules. Returns the problems found, each phrased to complete the
+// sentence "I'm not merging this PR, because ...".
+func validatePRDescription(conf Config, title, body string) []string {
+	var problems []string
+	if conf.PRTitlePattern != nil && !conf.PRTitlePattern.MatchString(title) {
+		problems = append(problems, fmt.Sprintf("the title doesn't match `%s`", conf.PRTitlePattern))
+	}
+	if conf.PRTitleMaxLength > 0 && utf8.RuneCountInString(title) > conf.PRTitleMaxLength {
+		problems = append(problems, fmt.Sprintf("the title is longer than %d characters", conf.PRTitleMaxLength))
+	}
+	headings := map[string]bool{}
+	for _, match := range markdownHeadingRegexp.FindAllStringSubmatch(body, -1) {
+		headings[strings.ToLower(match[1])] = true
+	}
+	for _, section := range conf.PRBodySections {
+		if !headings[strings.ToLower(section)] {
+			problems = append(problems, fmt.Sprintf("the description is missing the \"%s\" section", section))
+		}
+	}
+	if conf.PRChecklist != "" {
+		if items := parseChecklist(body, conf.PRChecklist); len(items.unticked) > 0 {
+			problems = append(problems, fmt.Sprintf("%d of the %d checklist items aren't ticked: %s",
+				len(items.unticked), items.total(), formatChecklistItems(items.unticked)))
+		}
+	}
+	return problems
+}
+
+func formatChecklistItems(items []string) string {
+	quoted := make([]string, len(items))
+	for i, item := range items {
+		quoted[i] = fmt.Sprintf("\"%s\"", item)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// publishDescriptionCheckRun reports whether the PR's title and description
+// follow the configured rules in a check run on the PR's head. Requiring the
+// check run keeps the PR from being merged until they do.
+func publishDescriptionCheckRun(conf Config, pullRequestEvent PullRequestEvent, graphQL GraphQL) *ErrorResponse {
+	if !descriptionRulesEnabled(conf) {
+		return nil
+	}
+	problems := validatePRDescription(conf, pullRequestEvent.Title, pullRequestEvent.Body)
+	state := map[string]interface{}{
+		"status":     "COMPLETED",
+		"conclusion": "SUCCESS",
+		"title":      "The title and the description follow the rules",
+		"summary":    "The PR's title and description follow all of the repository's rules.",
+	}
+	text := ""
+	if len(problems) > 0 {
+		state["conclusion"] = "FAILURE"
+		state["title"] = fmt.Sprintf("%d problem(s) with the title or the description", len(problems))
+		state["summary"] = "Edit the PR's title or description to fix the problems listed below."
+		for _, problem := range problems {
+			text += fmt.Sprintf("- %s\n", problem)
+		}
+	}
+	if conf.PRChecklist != "" {
+		if items := parseChecklist(pullRequestEvent.Body, conf.PRChecklist); items.total() > 0 {
+			state["summary"] = fmt.Sprintf("%s\n\n%d of the %d checklist items are ticked.", state["summary"],
+				items.ticked, items.total())
+		}
+	}
+	err := createCheckRun(pullRequestEvent.Base.Repository, pullRequestEvent.Head.SHA, descriptionCheckRunName,
+		state, text, graphQL)
+	if err != nil {
+		message := fmt.Sprintf("Failed to report whether the description of PR %s follows the rules",
+			pullRequestEvent.Issue().FullName())
+		return &ErrorResponse{err, http.StatusBadGateway, message}
+	}
+	return nil
+}
+
+// checkDescription blocks PRs whose title or description doesn't follow the
+// rules, if the rules are configured to block merging.
+func checkDescription(conf Config, pr *github.PullRequest) evaluator.Result {
+	if !conf.PRDescriptionBlocksMerge {
+		return passed()
+	}
+	if problems := validatePRDescription(conf, pr.GetTitle(), pr.GetBody()); len(problems) > 0 {
+		return failed(strings.Join(problems, " and "), problems...)
+	}
+	return passed()
+}
+
+// handlePullRequestEdited re-checks the title and the description of an
+// edited PR.
+func handlePullRequestEdited(conf Config, pullRequestEvent PullRequestEvent, repositories Repositories,
+	graphQL GraphQL) Response {
+
+	if conf.IssueReferenceRule == nil && !descriptionRulesEnabled(conf) {
+		return SuccessResponse{"No rules for the title or the description. Ignoring the edit."}
+	}
+	if errResp := updateIssueReferenceStatus(conf, pullRequestEvent, repositories); errResp != nil {
+		return errResp
+	}
+	if errResp := publishDescriptionCheckRun(conf, pullRequestEvent, graphQL); errResp != nil {
+		return errResp
+	}
+	return SuccessResponse{fmt.Sprintf("Checked the title and the description of PR %s",
+		pullRequestEvent.Issue().FullName())}
+}
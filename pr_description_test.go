@@ -0,0 +1,308 @@
+package main_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("PR description rules", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+			graphQL          *mocks.GraphQL
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+			graphQL = *context.GraphQL
+
+			context.Config.PRTitlePattern = regexp.MustCompile(`^[A-Z]`)
+			context.Config.PRTitleMaxLength = 30
+			context.Config.PRBodySections = []string{"Summary", "Testing"}
+		})
+
+		headSHA := "1235"
+
+		Context("with an edited PR", func() {
+			headers.Is(func() map[string]string {
+				return map[string]string{
+					"X-Github-Event": "pull_request",
+				}
+			})
+
+			editedEvent := func(title, body string) string {
+				event := PullRequestEvent("edited", headSHA, grh.Repository{
+					Owner: repositoryOwner,
+					Name:  repositoryName,
+					URL:   sshURL,
+				})
+				titleJSON, _ := json.Marshal(title)
+				bodyJSON, _ := json.Marshal(body)
+				return strings.Replace(event, `"pull_request": {`, `"pull_request": {
+    "title": `+string(titleJSON)+`,
+    "body": `+string(bodyJSON)+`,`, 1)
+			}
+
+			isCheckRunMutation := func(query string) bool {
+				return strings.Contains(query, "createCheckRun")
+			}
+
+			BeforeEach(func() {
+				graphQL.
+					On("Query", anyContext, mock.MatchedBy(func(query string) bool {
+						return !isCheckRunMutation(query)
+					}), mock.Anything, mock.Anything).
+					Return(noError).
+					Run(func(args mock.Arguments) {
+						Expect(json.Unmarshal([]byte(`{"repository": {"id": "repo-id"}}`), args.Get(3))).To(Succeed())
+					})
+			})
+
+			Context("with the title and the description following the rules", func() {
+				requestJSON.Is(func() string {
+					return editedEvent("Fix the login form", "## Summary\nFixed.\n\n### testing ##\nManually.")
+				})
+
+				BeforeEach(func() {
+					graphQL.
+						On("Query", anyContext, mock.MatchedBy(isCheckRunMutation), mock.MatchedBy(func(variables map[string]interface{}) bool {
+							return variables["name"] == "review-helper/description" &&
+								variables["headSha"] == headSHA && variables["conclusion"] == "SUCCESS"
+						}), mock.Anything).
+						Return(noError).
+						Once()
+				})
+
+				It("reports a successful check run", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				})
+			})
+
+			Context("with the title and the description breaking the rules", func() {
+				requestJSON.Is(func() string {
+					return editedEvent("fix the login form and the signup form", "## Summary\nFixed.")
+				})
+
+				BeforeEach(func() {
+					graphQL.
+						On("Query", anyContext, mock.MatchedBy(isCheckRunMutation), mock.MatchedBy(func(variables map[string]interface{}) bool {
+							text, _ := variables["text"].(string)
+							return variables["conclusion"] == "FAILURE" &&
+								strings.Contains(text, "- the title doesn't match `^[A-Z]`\n") &&
+								strings.Contains(text, "- the title is longer than 30 characters\n") &&
+								strings.Contains(text, "- the description is missing the \"Testing\" section\n")
+						}), mock.Anything).
+						Return(noError).
+						Once()
+				})
+
+				It("lists the problems in a failed check run", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				})
+			})
+
+			Context("with unticked items in the required checklist", func() {
+				requestJSON.Is(func() string {
+					return editedEvent("Fix the login form", "## Summary\nFixed.\n## Testing\n- [ ] Not a release item\n"+
+						"## Release checklist\n- [x] Update the changelog\n### Deploy\n- [ ] Run the migrations\n"+
+						"## Notes\n- [ ] Not a release item either")
+				})
+
+				BeforeEach(func() {
+					context.Config.PRChecklist = "release checklist"
+					graphQL.
+						On("Query", anyContext, mock.MatchedBy(isCheckRunMutation), mock.MatchedBy(func(variables map[string]interface{}) bool {
+							text, _ := variables["text"].(string)
+							summary, _ := variables["summary"].(string)
+							return variables["conclusion"] == "FAILURE" &&
+								text == "- 1 of the 2 checklist items aren't ticked: \"Run the migrations\"\n" &&
+								strings.HasSuffix(summary, "1 of the 2 checklist items are ticked.")
+						}), mock.Anything).
+						Return(noError).
+						Once()
+				})
+
+				It("reports the checklist's progress in a failed check run", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				})
+			})
+
+			Context("with creating the check run failing", func() {
+				requestJSON.Is(func() string {
+					return editedEvent("Fix the login form", "")
+				})
+
+				BeforeEach(func() {
+					graphQL.
+						On("Query", anyContext, mock.MatchedBy(isCheckRunMutation), mock.Anything, mock.Anything).
+						Return(errArbitrary)
+				})
+
+				It("fails with a gateway error", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusBadGateway))
+				})
+			})
+		})
+
+		Context("with an opened PR", func() {
+			headers.Is(func() map[string]string {
+				return map[string]string{
+					"X-Github-Event": "pull_request",
+				}
+			})
+			requestJSON.Is(func() string {
+				return PullRequestEvent("opened", headSHA, grh.Repository{
+					Owner: repositoryOwner,
+					Name:  repositoryName,
+					URL:   sshURL,
+				})
+			})
+
+			Context("with creating the check run failing", func() {
+				BeforeEach(func() {
+					graphQL.
+						On("Query", anyContext, mock.Anything, mock.Anything, mock.Anything).
+						Return(errArbitrary)
+					pullRequests.
+						On("ListCommits", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.AnythingOfType("*github.ListOptions")).
+						Return(githubCommits(commit{headSHA, "Changing things"}), emptyResponse, noError)
+					repositories.
+						On("CreateStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.Anything).
+						Return(emptyResult, emptyResponse, noError)
+				})
+
+				It("still checks the PR for fixup commits", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					repositories.AssertExpectations(GinkgoT())
+				})
+			})
+		})
+
+		Context("with a !merge command", func() {
+			headers.Is(func() map[string]string {
+				return map[string]string{
+					"X-Github-Event": "issue_comment",
+				}
+			})
+			requestJSON.Is(func() string {
+				return IssueCommentEvent("!merge", arbitraryIssueAuthor)
+			})
+
+			newPR := func(title, body string) *github.PullRequest {
+				return &github.PullRequest{
+					Number:    github.Int(issueNumber),
+					Title:     github.String(title),
+					Body:      github.String(body),
+					Merged:    github.Bool(false),
+					Mergeable: github.Bool(true),
+					Base: &github.PullRequestBranch{
+						SHA:  github.String("1234"),
+						Ref:  github.String("master"),
+						Repo: repository,
+					},
+					Head: &github.PullRequestBranch{
+						SHA:  github.String(headSHA),
+						Ref:  github.String("feature"),
+						Repo: repository,
+					},
+					User: &github.User{
+						Login: github.String(arbitraryIssueAuthor),
+					},
+				}
+			}
+
+			BeforeEach(func() {
+				context.Config.PRDescriptionBlocksMerge = true
+
+				repositories.
+					On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+					Return(true, emptyResponse, noError)
+				issues.
+					On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{grh.MergingLabel}).
+					Return(emptyResult, emptyResponse, noError)
+				repositories.
+					On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.AnythingOfType("*github.ListOptions")).
+					Return(&github.CombinedStatus{
+						State: github.String("success"),
+					}, emptyResponse, noError)
+				mockLabels(issues, issueNumber, grh.MergingLabel)
+			})
+
+			Context("with the description missing a section", func() {
+				BeforeEach(func() {
+					pullRequests.
+						On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+						Return(newPR("Fix the login form", "## Summary\nFixed."), emptyResponse, noError)
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("because the description is missing the \"Testing\" section."))).
+						Return(emptyResult, emptyResponse, noError)
+				})
+
+				It("doesn't merge the PR", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					Expect(responseRecorder.Body.String()).To(ContainSubstring("Not merging"))
+				})
+			})
+
+			Context("with an unticked checklist item", func() {
+				BeforeEach(func() {
+					context.Config.PRChecklist = "all"
+					pullRequests.
+						On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+						Return(newPR("Fix the login form", "## Summary\n- [X] Fixed\n## Testing\n* [ ] Manually"),
+							emptyResponse, noError)
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("because 1 of the 2 checklist items aren't ticked: \"Manually\"."))).
+						Return(emptyResult, emptyResponse, noError)
+				})
+
+				It("doesn't merge the PR", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					Expect(responseRecorder.Body.String()).To(ContainSubstring("Not merging"))
+				})
+			})
+
+			Context("with the title and the description following the rules", func() {
+				pr := newPR("Fix the login form", "## Summary\nFixed.\n## Testing\nManually.")
+
+				BeforeEach(func() {
+					pullRequests.
+						On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+						Return(pr, emptyResponse, noError)
+				})
+
+				ItMergesPR(context, pr)
+			})
+		})
+	})
+})
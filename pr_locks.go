@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+const (
+	// How long to wait for another operation on the same PR to finish
+	prLockWait = time.Minute
+	// How often to retry taking a lock held by another instance
+	prLockRetryInterval = 250 * time.Millisecond
+	// Deletes the lock only if it's still held with the given token, so
+	// that a lock that expired and was taken by another instance isn't
+	// released
+	redisUnlockScript = `if redis.call("get", KEYS[1]) == ARGV[1] then ` +
+		`return redis.call("del", KEYS[1]) else return 0 end`
+	// Extends the lock's expiry only if it's still held with the given token
+	redisRenewScript = `if redis.call("get", KEYS[1]) == ARGV[1] then ` +
+		`return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`
+)
+
+var ErrPRLocked = errors.New("The PR is being changed by another operation")
+
+// PRLocker serializes the operations that push to or merge a PR, so that
+// they would never run concurrently for the same PR.
+type PRLocker interface {
+	// Lock waits for up to wait for the lock of the key. The returned
+	// function releases the lock.
+	Lock(key string, wait time.Duration) (func(), error)
+}
+
+// prLocks is replaced with a RedisPRLocker when LOCK_REDIS_URL is set, so
+// that processes sharing the Redis server, e.g. during a rolling deploy,
+// don't change the same PR at once
+var prLocks PRLocker = NewLocalPRLocker()
+
+// lockPR locks the PR for an operation that pushes to or merges it.
+func lockPR(pr *github.PullRequest) (func(), *ErrorResponse) {
+	name := prFullName(pr)
+	unlock, err := prLocks.Lock("github-review-helper:pr:"+name, prLockWait)
+	if err == ErrPRLocked {
+		message := fmt.Sprintf("PR %s is still being changed by another operation", name)
+		return nil, &ErrorResponse{err, http.StatusConflict, message}
+	} else if err != nil {
+		message := fmt.Sprintf("Failed to lock PR %s", name)
+		return nil, &ErrorResponse{err, http.StatusInternalServerError, message}
+	}
+	return unlock, nil
+}
+
+// localPRLocker locks the PRs within a single instance.
+type localPRLocker struct {
+	mutex sync.Mutex
+	locks map[string]chan struct{}
+}
+
+func NewLocalPRLocker() PRLocker {
+	return &localPRLocker{locks: make(map[string]chan struct{})}
+}
+
+func (l *localPRLocker) Lock(key string, wait time.Duration) (func(), error) {
+	l.mutex.Lock()
+	lock, exists := l.locks[key]
+	if !exists {
+		lock = make(chan struct{}, 1)
+		l.locks[key] = lock
+	}
+	l.mutex.Unlock()
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case lock <- struct{}{}:
+		return func() { <-lock }, nil
+	case <-timer.C:
+		return nil, ErrPRLocked
+	}
+}
+
+// redisPRLocker locks the PRs across all of the instances that share the
+// Redis server. A lock expires after ttl, in case the instance holding it
+// dies, and is renewed every third of the ttl while it's held, so that long
+// operations, e.g. landing a merge train, keep it.
+type redisPRLocker struct {
+	url *url.URL
+	ttl time.Duration
+}
+
+// NewRedisPRLocker creates a locker that keeps the locks in the Redis server
+// at the redis://[:password@]host:port[/db] URL.
+func NewRedisPRLocker(redisURL *url.URL, ttl time.Duration) PRLocker {
+	return &redisPRLocker{url: redisURL, ttl: ttl}
+}
+
+func (l *redisPRLocker) Lock(key string, wait time.Duration) (func(), error) {
+	tokenBytes := make([]byte, 16)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return nil, err
+	}
+	token := hex.EncodeToString(tokenBytes)
+	ttl := strconv.FormatInt(int64(l.ttl/time.Millisecond), 10)
+	deadline := time.Now().Add(wait)
+	for {
+		reply, err := l.command("SET", key, token, "NX", "PX", ttl)
+		if err != nil {
+			return nil, err
+		} else if reply == "OK" {
+			break
+		} else if time.Now().After(deadline) {
+			return nil, ErrPRLocked
+		}
+		time.Sleep(prLockRetryInterval)
+	}
+	released := make(chan struct{})
+	go l.renew(key, token, ttl, released)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(released)
+			if _, err := l.command("EVAL", redisUnlockScript, "1", key, token); err != nil {
+				// The lock expires by itself
+				log.Printf("Failed to release the lock %s: %v\n", key, err)
+			}
+		})
+	}, nil
+}
+
+// renew extends the lock's expiry until it's released. A failed renewal is
+// tried again on the next tick, because the lock is still held until it
+// expires. Renewing stops, if the lock has expired and been taken by someone
+// else.
+func (l *redisPRLocker) renew(key, token, ttl string, released <-chan struct{}) {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-released:
+			return
+		case <-ticker.C:
+			reply, err := l.command("EVAL", redisRenewScript, "1", key, token, ttl)
+			if err != nil {
+				log.Printf("Failed to renew the lock %s: %v\n", key, err)
+			} else if reply == "0" {
+				log.Printf("Lost the lock %s, because it expired.\n", key)
+				return
+			}
+		}
+	}
+}
+
+// command runs the command on a new connection to the server. Simple
+// strings, integers and bulk strings are returned as strings and a nil bulk
+// string as an empty string.
+func (l *redisPRLocker) command(args ...string) (string, error) {
+	conn, err := net.DialTimeout("tcp", l.url.Host, 10*time.Second)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	reader := bufio.NewReader(conn)
+	var setup [][]string
+	if password, isSet := l.url.User.Password(); isSet {
+		setup = append(setup, []string{"AUTH", password})
+	}
+	if db := strings.TrimPrefix(l.url.Path, "/"); db != "" {
+		setup = append(setup, []string{"SELECT", db})
+	}
+	for _, setupArgs := range setup {
+		if _, err = redisRoundTrip(conn, reader, setupArgs); err != nil {
+			return "", err
+		}
+	}
+	return redisRoundTrip(conn, reader, args)
+}
+
+func redisRoundTrip(conn net.Conn, reader *bufio.Reader, args []string) (string, error) {
+	request := fmt.Sprintf("*%d\r\n", len(args))
+	for _, arg := range args {
+		request += fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := conn.Write([]byte(request)); err != nil {
+		return "", err
+	}
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return "", errors.New("empty reply from Redis")
+	}
+	switch line[0] {
+	case '+', ':':
+		return line[1:], nil
+	case '-':
+		return "", fmt.Errorf("Redis responded with an error: %s", line[1:])
+	case '$':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return "", err
+		} else if length < 0 {
+			return "", nil
+		}
+		data := make([]byte, length+2)
+		if _, err = io.ReadFull(reader, data); err != nil {
+			return "", err
+		}
+		return string(data[:length]), nil
+	}
+	return "", fmt.Errorf("unexpected reply from Redis: %q", line)
+}
@@ -0,0 +1,196 @@
+package main_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	grh "github.com/salemove/github-review-helper"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeRedis implements the commands the Redis locker uses, without the
+// expiry
+type fakeRedis struct {
+	sync.Mutex
+	listener net.Listener
+	values   map[string]string
+	commands []string
+	renewals int
+}
+
+func startFakeRedis() *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	redis := &fakeRedis{listener: listener, values: make(map[string]string)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go redis.serve(conn)
+		}
+	}()
+	return redis
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		args, err := readRedisCommand(reader)
+		if err != nil {
+			return
+		}
+		r.Lock()
+		r.commands = append(r.commands, args[0])
+		var reply string
+		switch args[0] {
+		case "AUTH":
+			reply = "+OK\r\n"
+		case "SET":
+			if _, exists := r.values[args[1]]; exists {
+				reply = "$-1\r\n"
+			} else {
+				r.values[args[1]] = args[2]
+				reply = "+OK\r\n"
+			}
+		case "EVAL":
+			if strings.Contains(args[1], "pexpire") {
+				if r.values[args[3]] == args[4] {
+					r.renewals++
+					reply = ":1\r\n"
+				} else {
+					reply = ":0\r\n"
+				}
+			} else if r.values[args[3]] == args[4] {
+				delete(r.values, args[3])
+				reply = ":1\r\n"
+			} else {
+				reply = ":0\r\n"
+			}
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		r.Unlock()
+		conn.Write([]byte(reply))
+	}
+}
+
+func readRedisCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	count, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, count)
+	for i := range args {
+		if line, err = reader.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		length, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		data := make([]byte, length+2)
+		if _, err = io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:length])
+	}
+	return args, nil
+}
+
+func (r *fakeRedis) url() *url.URL {
+	redisURL, err := url.Parse(fmt.Sprintf("redis://:secret@%s", r.listener.Addr()))
+	Expect(err).NotTo(HaveOccurred())
+	return redisURL
+}
+
+var _ = Describe("PRLocker", func() {
+	itLocks := func(newLocker func() grh.PRLocker) {
+		It("doesn't lock the same key twice", func() {
+			locker := newLocker()
+			unlock, err := locker.Lock("salemove/grh#7", time.Second)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = locker.Lock("salemove/grh#7", 10*time.Millisecond)
+			Expect(err).To(Equal(grh.ErrPRLocked))
+
+			unlock()
+			unlockAgain, err := locker.Lock("salemove/grh#7", time.Second)
+			Expect(err).NotTo(HaveOccurred())
+			unlockAgain()
+		})
+
+		It("locks different keys independently", func() {
+			locker := newLocker()
+			unlock, err := locker.Lock("salemove/grh#7", time.Second)
+			Expect(err).NotTo(HaveOccurred())
+			defer unlock()
+
+			unlockOther, err := locker.Lock("salemove/grh#8", 10*time.Millisecond)
+			Expect(err).NotTo(HaveOccurred())
+			unlockOther()
+		})
+	}
+
+	Describe("local", func() {
+		itLocks(grh.NewLocalPRLocker)
+	})
+
+	Describe("Redis", func() {
+		var redis *fakeRedis
+
+		BeforeEach(func() {
+			redis = startFakeRedis()
+		})
+
+		AfterEach(func() {
+			redis.listener.Close()
+		})
+
+		itLocks(func() grh.PRLocker {
+			return grh.NewRedisPRLocker(redis.url(), time.Minute)
+		})
+
+		It("shares the locks between instances", func() {
+			unlock, err := grh.NewRedisPRLocker(redis.url(), time.Minute).Lock("salemove/grh#7", time.Second)
+			Expect(err).NotTo(HaveOccurred())
+			defer unlock()
+
+			_, err = grh.NewRedisPRLocker(redis.url(), time.Minute).Lock("salemove/grh#7", 10*time.Millisecond)
+			Expect(err).To(Equal(grh.ErrPRLocked))
+			redis.Lock()
+			defer redis.Unlock()
+			Expect(redis.commands).To(ContainElement("AUTH"))
+		})
+
+		It("renews the lock while it's held", func() {
+			unlock, err := grh.NewRedisPRLocker(redis.url(), 30*time.Millisecond).Lock("salemove/grh#7", time.Second)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(func() int {
+				redis.Lock()
+				defer redis.Unlock()
+				return redis.renewals
+			}).Should(BeNumerically(">=", 2))
+
+			unlock()
+			redis.Lock()
+			renewals := redis.renewals
+			Expect(redis.values).NotTo(HaveKey("salemove/grh#7"))
+			redis.Unlock()
+			Consistently(func() int {
+				redis.Lock()
+				defer redis.Unlock()
+				return redis.renewals
+			}, 50*time.Millisecond).Should(Equal(renewals))
+		})
+	})
+})
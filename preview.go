@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/salemove/github-review-helper/git"
+)
+
+// tearDownPreviewEnvironment runs the configured teardown hook for a PR that
+// has been merged or closed and reports the outcome in the PR's status
+// comment, so that orphaned preview environments don't go unnoticed. The
+// hook's output may include secrets, so it's only logged.
+func tearDownPreviewEnvironment(conf Config, pullRequestEvent PullRequestEvent, gitRepos git.Repos, store Store,
+	issues Issues) Response {
+
+	if conf.PreviewTeardownHook == "" {
+		return SuccessResponse{"PR closed and no preview teardown hook configured. Ignoring."}
+	}
+	issue := pullRequestEvent.Issue()
+	payload := hookPayload{
+		Phase:   previewTeardownHookPhase,
+		Owner:   issue.Repository.Owner,
+		Name:    issue.Repository.Name,
+		Number:  issue.Number,
+		HeadSHA: pullRequestEvent.Head.SHA,
+		HeadRef: pullRequestEvent.Head.Ref,
+		BaseRef: pullRequestEvent.Base.Ref,
+	}
+	log.Printf("Tearing down the preview environment for PR %s.\n", issue.FullName())
+	hookErr := runHook(conf.PreviewTeardownHook, payload, issue.Repository,
+		"origin/"+pullRequestEvent.Base.Ref, gitRepos)
+
+	message := "The preview environment of this PR has been torn down."
+	if hookErr != nil {
+		log.Println(hookErr)
+		message = "I was unable to tear down the preview environment of this PR, so it may have to be cleaned up " +
+			"manually. A maintainer can look up the details in my logs."
+	}
+	if err := stickyComment(conf, message, issue, store, issues); err != nil {
+		errorMessage := fmt.Sprintf("Failed to report the preview teardown result for PR %s", issue.FullName())
+		return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	} else if hookErr != nil {
+		errorMessage := fmt.Sprintf("Failed to tear down the preview environment for PR %s", issue.FullName())
+		return ErrorResponse{hookErr, http.StatusInternalServerError, errorMessage}
+	}
+	return SuccessResponse{fmt.Sprintf("Tore down the preview environment for PR %s", issue.FullName())}
+}
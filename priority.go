@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/salemove/github-review-helper/git"
+)
+
+const (
+	// PriorityLabel moves a PR labeled with "merging" to the front of the
+	// merge queue
+	PriorityLabel = "merge-priority"
+)
+
+var priorityCommandRegexp = regexp.MustCompile(`^\s*!priority\s+(high|normal)\s*$`)
+
+func isPriorityCommand(comment string) bool {
+	return priorityCommandRegexp.MatchString(comment)
+}
+
+// handlePriorityCommand moves the PR to the front of the merge queue with
+// "!priority high" or back to its place by age with "!priority normal". A
+// queued PR is evaluated again, so that its queue position status would
+// reflect the change.
+func handlePriorityCommand(conf Config, issueComment IssueComment, store Store, issues Issues,
+	pullRequests PullRequests, repositories Repositories, graphQL GraphQL, gitRepos git.Repos) Response {
+
+	issue := issueComment.Issue()
+	high := priorityCommandRegexp.FindStringSubmatch(issueComment.Comment)[1] == "high"
+	if high == issueComment.HasLabel(PriorityLabel) {
+		return SuccessResponse{fmt.Sprintf("PR %s already has the requested priority. Ignoring.", issue.FullName())}
+	}
+	var errResp *ErrorResponse
+	if high {
+		errResp = addLabel(issue.Repository, issue.Number, PriorityLabel, issues)
+	} else {
+		errResp = removeLabel(issue.Repository, issue.Number, PriorityLabel, issues)
+	}
+	if errResp != nil {
+		return errResp
+	} else if !issueComment.HasLabel(MergingLabel) {
+		return SuccessResponse{fmt.Sprintf("Changed the priority of PR %s", issue.FullName())}
+	}
+	return mergeIfReady(conf, issue, false, store, issues, pullRequests, repositories, graphQL, gitRepos)
+}
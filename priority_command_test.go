@@ -0,0 +1,205 @@
+package main_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("!priority comment", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+			graphQL          *mocks.GraphQL
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+			graphQL = *context.GraphQL
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+
+		headSHA := "1235"
+		pr := &github.PullRequest{
+			Number:    github.Int(issueNumber),
+			Merged:    github.Bool(false),
+			Mergeable: github.Bool(true),
+			Base: &github.PullRequestBranch{
+				SHA:  github.String("1234"),
+				Ref:  github.String("master"),
+				Repo: repository,
+			},
+			Head: &github.PullRequestBranch{
+				SHA:  github.String(headSHA),
+				Ref:  github.String("feature"),
+				Repo: repository,
+			},
+			User: &github.User{
+				Login: github.String(arbitraryIssueAuthor),
+			},
+		}
+
+		mockRole := func(permission string) {
+			data, err := json.Marshal(map[string]interface{}{
+				"repository": map[string]interface{}{
+					"collaborators": map[string]interface{}{
+						"edges": []interface{}{
+							map[string]interface{}{
+								"permission": permission,
+								"node":       map[string]string{"login": arbitraryIssueAuthor},
+							},
+						},
+					},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			graphQL.
+				On("Query", anyContext, mock.AnythingOfType("string"), mock.Anything, mock.Anything).
+				Return(noError).
+				Run(func(args mock.Arguments) {
+					Expect(json.Unmarshal(data, args.Get(3))).To(Succeed())
+				})
+		}
+
+		ForCollaborator(context, repositoryOwner, repositoryName, arbitraryIssueAuthor, func() {
+			Context("from a collaborator who isn't a maintainer", func() {
+				requestJSON.Is(func() string {
+					return IssueCommentEvent("!priority high", arbitraryIssueAuthor)
+				})
+
+				BeforeEach(func() {
+					mockRole("WRITE")
+				})
+
+				It("refuses to change the priority", func() {
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("Only users with the maintain role or higher can ask "+
+								"me to `!priority` here."))).
+						Return(emptyResult, emptyResponse, noError).
+						Once()
+
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertNotCalled(GinkgoT(), "AddLabelsToIssue", anyContext, repositoryOwner,
+						repositoryName, issueNumber, []string{grh.PriorityLabel})
+				})
+			})
+
+			Context("from a maintainer", func() {
+				BeforeEach(func() {
+					mockRole("MAINTAIN")
+				})
+
+				Context("on a PR that isn't queued", func() {
+					requestJSON.Is(func() string {
+						return IssueCommentEvent("!priority high", arbitraryIssueAuthor)
+					})
+
+					It("labels the PR", func() {
+						issues.
+							On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+								[]string{grh.PriorityLabel}).
+							Return(emptyResult, emptyResponse, noError).
+							Once()
+
+						handle()
+						Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+						pullRequests.AssertNotCalled(GinkgoT(), "Get", anyContext, repositoryOwner, repositoryName,
+							issueNumber)
+					})
+				})
+
+				Context("on a queued PR with pending statuses", func() {
+					requestJSON.Is(func() string {
+						return IssueCommentEventWithLabels("!priority high", arbitraryIssueAuthor,
+							[]string{grh.MergingLabel})
+					})
+
+					BeforeEach(func() {
+						context.Config.MergeStatus = true
+						issues.
+							On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+								[]string{grh.PriorityLabel}).
+							Return(emptyResult, emptyResponse, noError)
+						pullRequests.
+							On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+							Return(pr, emptyResponse, noError)
+						repositories.
+							On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+								mock.AnythingOfType("*github.ListOptions")).
+							Return(&github.CombinedStatus{State: github.String("pending")}, emptyResponse, noError)
+						issues.
+							On("ListByRepo", anyContext, repositoryOwner, repositoryName,
+								mock.AnythingOfType("*github.IssueListByRepoOptions")).
+							Return([]*github.Issue{
+								{Number: github.Int(3), PullRequestLinks: &github.PullRequestLinks{}},
+								{
+									Number:           github.Int(issueNumber),
+									PullRequestLinks: &github.PullRequestLinks{},
+									Labels: []github.Label{
+										{Name: github.String(grh.MergingLabel)},
+										{Name: github.String(grh.PriorityLabel)},
+									},
+								},
+							}, emptyResponse, noError)
+					})
+
+					It("reports the PR at the front of the merge queue", func() {
+						repositories.
+							On("CreateStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+								mock.MatchedBy(func(status *github.RepoStatus) bool {
+									return status.GetContext() == "review-helper/merge" &&
+										status.GetDescription() == "queued (#1)"
+								})).
+							Return(emptyResult, emptyResponse, noError).
+							Once()
+
+						handle()
+						Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					})
+				})
+
+				Context("with normal priority", func() {
+					requestJSON.Is(func() string {
+						return IssueCommentEventWithLabels("!priority normal", arbitraryIssueAuthor,
+							[]string{grh.PriorityLabel})
+					})
+
+					It("removes the label", func() {
+						issues.
+							On("RemoveLabelForIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+								grh.PriorityLabel).
+							Return(emptyResponse, noError).
+							Once()
+
+						handle()
+						Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					})
+				})
+			})
+		})
+	})
+})
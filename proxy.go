@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/salemove/github-review-helper/git"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// proxyTransport returns the transport to reach GitHub's API with, which
+// goes through OUTBOUND_PROXY, if it's set. Otherwise the transport honors
+// the standard HTTPS_PROXY and NO_PROXY variables.
+func proxyTransport(conf Config) http.RoundTripper {
+	if conf.OutboundProxy == nil {
+		return http.DefaultTransport
+	}
+	proxy := (&httpproxy.Config{
+		HTTPProxy:  conf.OutboundProxy.String(),
+		HTTPSProxy: conf.OutboundProxy.String(),
+		NoProxy:    conf.OutboundNoProxy,
+	}).ProxyFunc()
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		return proxy(req.URL)
+	}
+	return transport
+}
+
+// gitEnv returns the variables to run git with, so that it would reach the
+// remotes through OUTBOUND_PROXY, if it's set.
+func gitEnv(conf Config) []string {
+	if conf.OutboundProxy == nil {
+		return nil
+	}
+	return git.ProxyEnv(conf.OutboundProxy, conf.OutboundNoProxy)
+}
@@ -2,6 +2,7 @@ package main_test
 
 import (
 	"errors"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -33,11 +34,13 @@ var _ = TestWebhookHandler(func(context WebhookTestContext) {
 			responseRecorder *httptest.ResponseRecorder
 			pullRequests     *mocks.PullRequests
 			repositories     *mocks.Repositories
+			issues           *mocks.Issues
 		)
 		BeforeEach(func() {
 			responseRecorder = *context.ResponseRecorder
 			pullRequests = *context.PullRequests
 			repositories = *context.Repositories
+			issues = *context.Issues
 		})
 
 		var pullRequestHeadSHA = "1235"
@@ -63,6 +66,114 @@ var _ = TestWebhookHandler(func(context WebhookTestContext) {
 				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
 				Expect(responseRecorder.Body.String()).To(ContainSubstring("Ignoring"))
 			})
+
+			Context("with a sticky status comment", func() {
+				issue := grh.Issue{Number: issueNumber, Repository: grh.Repository{Owner: repositoryOwner,
+					Name: repositoryName}}
+
+				BeforeEach(func() {
+					Expect((*context.Store).SetStickyComment(grh.StickyComment{Issue: issue, ID: 42,
+						NodeID: "status-comment"})).To(Succeed())
+					(*context.GraphQL).
+						On("Query", anyContext, mock.MatchedBy(func(query string) bool {
+							return strings.Contains(query, "minimizeComment")
+						}), map[string]interface{}{"subjectId": "status-comment"}, mock.Anything).
+						Return(noError)
+				})
+
+				It("minimizes the status comment as outdated", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					(*context.GraphQL).AssertNumberOfCalls(GinkgoT(), "Query", 1)
+					_, exists, err := (*context.Store).StickyComment(issue)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(exists).To(BeFalse())
+				})
+			})
+
+			Context("with a preview teardown hook configured", func() {
+				var (
+					hookServer       *httptest.Server
+					hookResponseCode int
+					hookRequests     []string
+				)
+				BeforeEach(func() {
+					hookResponseCode = http.StatusOK
+					hookRequests = []string{}
+					hookServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						body, err := ioutil.ReadAll(r.Body)
+						Expect(err).NotTo(HaveOccurred())
+						hookRequests = append(hookRequests, string(body))
+						w.WriteHeader(hookResponseCode)
+					}))
+					context.Config.PreviewTeardownHook = hookServer.URL
+				})
+				AfterEach(func() {
+					hookServer.Close()
+				})
+
+				Context("with the hook succeeding", func() {
+					BeforeEach(func() {
+						issues.
+							On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+								mock.MatchedBy(commentContaining("has been torn down"))).
+							Return(emptyResult, emptyResponse, noError)
+					})
+
+					It("calls the hook and confirms the teardown on the PR", func() {
+						handle()
+						Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+						Expect(hookRequests).To(HaveLen(1))
+						Expect(hookRequests[0]).To(ContainSubstring(`"phase":"preview-teardown"`))
+						Expect(hookRequests[0]).To(ContainSubstring(`"head_ref":"feature"`))
+					})
+				})
+
+				Context("with the hook failing", func() {
+					BeforeEach(func() {
+						hookResponseCode = http.StatusInternalServerError
+						issues.
+							On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+								mock.MatchedBy(commentContaining("unable to tear down"))).
+							Return(emptyResult, emptyResponse, noError)
+					})
+
+					It("reports the failure on the PR without the hook's output and fails", func() {
+						handle()
+						Expect(responseRecorder.Code).To(Equal(http.StatusInternalServerError))
+						issues.AssertNotCalled(GinkgoT(), "CreateComment", anyContext, repositoryOwner, repositoryName,
+							issueNumber, mock.MatchedBy(commentContaining("500")))
+					})
+				})
+
+				Context("with the hook failing and a sticky status comment", func() {
+					BeforeEach(func() {
+						hookResponseCode = http.StatusInternalServerError
+						context.Config.StickyComments = true
+						err := (*context.Store).SetStickyComment(grh.StickyComment{
+							Issue: grh.Issue{Number: issueNumber, Repository: grh.Repository{Owner: repositoryOwner,
+								Name: repositoryName}},
+							ID:     42,
+							NodeID: "status-comment",
+						})
+						Expect(err).NotTo(HaveOccurred())
+						issues.
+							On("EditComment", anyContext, repositoryOwner, repositoryName, int64(42),
+								mock.MatchedBy(commentContaining("unable to tear down"))).
+							Return(emptyResult, emptyResponse, noError)
+					})
+
+					It("updates the status comment instead of posting a new one", func() {
+						handle()
+						Expect(responseRecorder.Code).To(Equal(http.StatusInternalServerError))
+						issues.AssertNumberOfCalls(GinkgoT(), "EditComment", 1)
+						issues.AssertNotCalled(GinkgoT(), "CreateComment", anyContext, repositoryOwner, repositoryName,
+							issueNumber, mock.Anything)
+						(*context.GraphQL).AssertNotCalled(GinkgoT(), "Query", anyContext, mock.Anything, mock.Anything,
+							mock.Anything)
+					})
+				})
+			})
 		})
 
 		Context("with the PR being synchronized", func() {
@@ -157,6 +268,34 @@ var _ = TestWebhookHandler(func(context WebhookTestContext) {
 
 					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
 				})
+
+				Context("with a sticky status comment", func() {
+					issue := grh.Issue{Number: issueNumber, Repository: grh.Repository{Owner: repositoryOwner,
+						Name: repositoryName}}
+
+					BeforeEach(func() {
+						Expect((*context.Store).SetStickyComment(grh.StickyComment{Issue: issue, ID: 42,
+							NodeID: "status-comment"})).To(Succeed())
+						(*context.GraphQL).
+							On("Query", anyContext, mock.MatchedBy(func(query string) bool {
+								return strings.Contains(query, "minimizeComment")
+							}), map[string]interface{}{"subjectId": "status-comment"}, mock.Anything).
+							Return(noError)
+						repositories.
+							On("CreateStatus", anyContext, headRepository.Owner, headRepository.Name,
+								pullRequestHeadSHA, mock.Anything).
+							Return(emptyResult, emptyResponse, noError)
+					})
+
+					It("minimizes the status comment of the previous head", func() {
+						handle()
+						Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+						(*context.GraphQL).AssertNumberOfCalls(GinkgoT(), "Query", 1)
+						_, exists, err := (*context.Store).StickyComment(issue)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(exists).To(BeFalse())
+					})
+				})
 			})
 
 			Context("with paged list of commits from GitHub including fixup commits", func() {
@@ -208,6 +347,75 @@ var _ = TestWebhookHandler(func(context WebhookTestContext) {
 					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
 				})
 			})
+
+			Context("with a commit message rule configured", func() {
+				BeforeEach(func() {
+					rule, err := grh.ParseCommitMessageRule("conventional")
+					Expect(err).NotTo(HaveOccurred())
+					context.Config.CommitMessageRule = rule
+
+					repositories.
+						On("CreateStatus", anyContext, headRepository.Owner, headRepository.Name, pullRequestHeadSHA,
+							mock.MatchedBy(func(status *github.RepoStatus) bool {
+								return *status.Context == "review/squash"
+							}),
+						).
+						Return(emptyResult, emptyResponse, noError)
+				})
+
+				Context("with all commit messages following the rule", func() {
+					BeforeEach(func() {
+						pullRequests.
+							On("ListCommits", anyContext, repositoryOwner, repositoryName, issueNumber, mock.AnythingOfType("*github.ListOptions")).
+							Return(githubCommits(
+								commit{arbitrarySHA, "feat(api): add a thing"},
+								commit{pullRequestHeadSHA, "fixup! feat(api): add a thing"},
+							), emptyResponse, noError)
+					})
+
+					It("reports success commit message status to GitHub", func() {
+						repositories.
+							On("CreateStatus", anyContext, headRepository.Owner, headRepository.Name, pullRequestHeadSHA,
+								mock.MatchedBy(func(status *github.RepoStatus) bool {
+									return *status.State == "success" && *status.Context == "review/commit-message"
+								}),
+							).
+							Return(emptyResult, emptyResponse, noError)
+
+						handle()
+
+						Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+						repositories.AssertExpectations(GinkgoT())
+					})
+				})
+
+				Context("with a commit message not following the rule", func() {
+					BeforeEach(func() {
+						pullRequests.
+							On("ListCommits", anyContext, repositoryOwner, repositoryName, issueNumber, mock.AnythingOfType("*github.ListOptions")).
+							Return(githubCommits(
+								commit{arbitrarySHA, "feat: add a thing"},
+								commit{pullRequestHeadSHA, "Changing things"},
+							), emptyResponse, noError)
+					})
+
+					It("reports failure commit message status to GitHub", func() {
+						repositories.
+							On("CreateStatus", anyContext, headRepository.Owner, headRepository.Name, pullRequestHeadSHA,
+								mock.MatchedBy(func(status *github.RepoStatus) bool {
+									return *status.State == "failure" && *status.Context == "review/commit-message" &&
+										strings.Contains(*status.Description, pullRequestHeadSHA[:4])
+								}),
+							).
+							Return(emptyResult, emptyResponse, noError)
+
+						handle()
+
+						Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+						repositories.AssertExpectations(GinkgoT())
+					})
+				})
+			})
 		})
 	})
 })
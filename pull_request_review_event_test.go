@@ -0,0 +1,125 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("pull_request_review event", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "pull_request_review",
+			}
+		})
+
+		Context("with a review requesting changes", func() {
+			requestJSON.Is(func() string {
+				return PullRequestReviewEvent("submitted", "changes_requested", []string{grh.MergingLabel})
+			})
+
+			It("succeeds with 'ignored' response", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(responseRecorder.Body.String()).To(ContainSubstring("Ignoring"))
+			})
+		})
+
+		Context("with an approving review for a PR without the 'merging' label", func() {
+			requestJSON.Is(func() string {
+				return PullRequestReviewEvent("submitted", "approved", []string{"bug"})
+			})
+
+			It("succeeds with 'ignored' response", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(responseRecorder.Body.String()).To(ContainSubstring("Ignoring"))
+			})
+		})
+
+		Context("with an approving review for a PR with the 'merging' label", func() {
+			requestJSON.Is(func() string {
+				return PullRequestReviewEvent("submitted", "APPROVED", []string{"bug", grh.MergingLabel})
+			})
+
+			headSHA := "1235"
+			pr := &github.PullRequest{
+				Number:    github.Int(issueNumber),
+				Merged:    github.Bool(false),
+				Mergeable: github.Bool(true),
+				Base: &github.PullRequestBranch{
+					SHA:  github.String("1234"),
+					Ref:  github.String("master"),
+					Repo: repository,
+				},
+				Head: &github.PullRequestBranch{
+					SHA:  github.String(headSHA),
+					Ref:  github.String("feature"),
+					Repo: repository,
+				},
+				User: &github.User{
+					Login: github.String(arbitraryIssueAuthor),
+				},
+			}
+
+			BeforeEach(func() {
+				pullRequests.
+					On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+					Return(pr, emptyResponse, noError)
+			})
+
+			Context("with combined state being pending", func() {
+				BeforeEach(func() {
+					repositories.
+						On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.AnythingOfType("*github.ListOptions")).
+						Return(&github.CombinedStatus{
+							State: github.String("pending"),
+						}, emptyResponse, noError)
+				})
+
+				It("succeeds without merging", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				})
+			})
+
+			Context("with combined state being success", func() {
+				BeforeEach(func() {
+					repositories.
+						On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.AnythingOfType("*github.ListOptions")).
+						Return(&github.CombinedStatus{
+							State: github.String("success"),
+						}, emptyResponse, noError)
+					mockLabels(issues, issueNumber, grh.MergingLabel)
+				})
+
+				ItMergesPR(context, pr)
+			})
+		})
+	})
+})
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// MergedBaseBranch is a base branch the bot has just merged a PR into.
+type MergedBaseBranch struct {
+	Repository  Repository
+	Ref         string
+	PullRequest int
+}
+
+// baseBranchMerges passes the merged base branches on to the job that
+// re-evaluates the PRs queued for merging into them
+var baseBranchMerges = make(chan MergedBaseBranch, 100)
+
+// notifyBaseBranchMerged has the PRs queued for merging into the PR's base
+// branch evaluated again, because the merge may have changed their
+// mergeability. If the job is behind, then the notification is dropped,
+// because the job's next re-evaluation covers the merge as well.
+func notifyBaseBranchMerged(pr *github.PullRequest) {
+	merged := MergedBaseBranch{
+		Repository:  prIssue(pr).Repository,
+		Ref:         pr.Base.GetRef(),
+		PullRequest: pr.GetNumber(),
+	}
+	select {
+	case baseBranchMerges <- merged:
+	default:
+		log.Printf("Too many merges to re-evaluate the merge queues after. Skipping %s.\n",
+			prIssue(pr).FullName())
+	}
+}
+
+// runQueueReevaluations evaluates the PRs labeled with "merging" again after
+// every merge into their base branch, instead of waiting for a status update
+// of theirs to do it.
+func runQueueReevaluations(configSource ConfigSource, issues Issues, pullRequests PullRequests,
+	repositories Repositories, merge func(Issue) Response, stop <-chan struct{}) {
+
+	for {
+		select {
+		case <-stop:
+			return
+		case merged := <-baseBranchMerges:
+			// Unlike the other background jobs, the re-evaluations aren't
+			// throttled when the rate limit runs low, because the PRs they
+			// evaluate are labeled for merging, which RATE_LIMIT_RESERVE is
+			// kept for
+			if pausedForGithubIncident("merge queue re-evaluation") {
+				continue
+			}
+			if err := ReevaluateQueuedPRs(configSource.Current(), merged, issues, pullRequests, repositories, merge); err != nil {
+				log.Printf("Re-evaluating the merge queue of %s failed: %v\n", repositoryKey(merged.Repository),
+					err)
+			}
+		}
+	}
+}
+
+// ReevaluateQueuedPRs merges the PRs labeled with "merging" into the merged
+// base branch that are ready to be merged now, once GitHub has checked them
+// for conflicts with the new base. With UPDATE_QUEUED_BRANCHES, the queued PRs
+// that are behind their base branch are brought up to date with it instead, so
+// that CI would test them against the new base.
+func ReevaluateQueuedPRs(conf Config, merged MergedBaseBranch, issues Issues, pullRequests PullRequests,
+	repositories Repositories, merge func(Issue) Response) error {
+
+	queued, err := queuedPRs(merged.Repository, issues)
+	if err != nil {
+		return err
+	}
+	for _, issue := range queued {
+		if issue.Number == merged.PullRequest {
+			continue
+		}
+		pr, errResp := getCheckedPR(conf, issue, pullRequests)
+		if errResp != nil {
+			log.Printf("%s: %v\n", errResp.ErrorMessage, errResp.Error)
+			continue
+		} else if pr.Base.GetRef() != merged.Ref {
+			continue
+		} else if conf.UpdateQueuedBranches && pr.GetMergeableState() == "behind" && !isAcrossForks(pr) {
+			updateQueuedBranch(pr, repositories)
+			continue
+		}
+		log.Printf("%s was merged into. Evaluating PR %s again.\n", merged.Ref, issue.FullName())
+		merge(issue).logResponse()
+	}
+	return nil
+}
+
+// getCheckedPR fetches the PR until GitHub has checked it for conflicts with
+// its base branch, retrying after the delays of GITHUB_API_TRIES. A merge
+// into the base branch leaves the mergeability of the PRs into it unknown
+// until GitHub has checked them again, which the first read after the merge
+// starts. If GitHub still hasn't checked the PR after the last try, the PR is
+// returned as it is.
+func getCheckedPR(conf Config, issue Issue, pullRequests PullRequests) (*github.PullRequest, *ErrorResponse) {
+	pr, errResp := getPR(issue, pullRequests)
+	if len(conf.GithubAPITryDeltas) == 0 {
+		return pr, errResp
+	}
+	for _, delay := range conf.GithubAPITryDeltas[1:] {
+		if errResp != nil || pr.Mergeable != nil || pr.GetMerged() {
+			break
+		}
+		time.Sleep(delay)
+		pr, errResp = getPR(issue, pullRequests)
+	}
+	return pr, errResp
+}
+
+// queuedPRs lists the repository's open PRs labeled with "merging", the
+// longest queued first.
+func queuedPRs(repository Repository, issues Issues) ([]Issue, error) {
+	options := &github.IssueListByRepoOptions{
+		State:       "open",
+		Labels:      []string{MergingLabel},
+		Sort:        "created",
+		Direction:   "asc",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	var queued []Issue
+	for {
+		page, resp, err := issues.ListByRepo(context.TODO(), repository.Owner, repository.Name, options)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the PRs labeled with '%s': %v", MergingLabel, err)
+		}
+		for _, issue := range page {
+			if issue.PullRequestLinks != nil {
+				queued = append(queued, Issue{Number: issue.GetNumber(), Repository: repository})
+			}
+		}
+		if resp.NextPage == 0 {
+			return queued, nil
+		}
+		options.Page = resp.NextPage
+	}
+}
+
+// updateQueuedBranch merges the base branch into the PR's head branch, like
+// GitHub's "Update branch" button. The PR is evaluated again once CI has
+// reported on the new head.
+func updateQueuedBranch(pr *github.PullRequest, repositories Repositories) {
+	issue := prIssue(pr)
+	_, _, err := repositories.Merge(context.TODO(), issue.Repository.Owner, issue.Repository.Name,
+		&github.RepositoryMergeRequest{
+			Base:          pr.Head.Ref,
+			Head:          pr.Base.Ref,
+			CommitMessage: github.String(fmt.Sprintf("Merge branch '%s' into %s", pr.Base.GetRef(), pr.Head.GetRef())),
+		})
+	if err != nil {
+		log.Printf("Failed to update the branch of PR %s with %s: %v\n", issue.FullName(), pr.Base.GetRef(), err)
+		return
+	}
+	log.Printf("Updated the branch of PR %s with %s.\n", issue.FullName(), pr.Base.GetRef())
+}
@@ -0,0 +1,124 @@
+package main_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ReevaluateQueuedPRs", func() {
+	var (
+		conf         grh.Config
+		issues       *mocks.Issues
+		pullRequests *mocks.PullRequests
+		repositories *mocks.Repositories
+		mergedIssues []int
+		// The reads of PR 2, the last of which is repeated
+		pr2Reads []*github.PullRequest
+
+		merged = grh.MergedBaseBranch{
+			Repository:  grh.Repository{Owner: repositoryOwner, Name: repositoryName},
+			Ref:         "master",
+			PullRequest: 1,
+		}
+		merge = func(issue grh.Issue) grh.Response {
+			mergedIssues = append(mergedIssues, issue.Number)
+			return grh.SuccessResponse{}
+		}
+	)
+
+	queuedPR := func(number int, baseRef, mergeableState string) *github.PullRequest {
+		pr := &github.PullRequest{
+			Number:         github.Int(number),
+			MergeableState: github.String(mergeableState),
+			Base:           &github.PullRequestBranch{Ref: github.String(baseRef), Repo: repository},
+			Head:           &github.PullRequestBranch{Ref: github.String("feature"), Repo: repository},
+		}
+		if mergeableState != "unknown" {
+			pr.Mergeable = github.Bool(true)
+		}
+		return pr
+	}
+
+	BeforeEach(func() {
+		conf = grh.Config{}
+		issues = new(mocks.Issues)
+		pullRequests = new(mocks.PullRequests)
+		repositories = new(mocks.Repositories)
+		mergedIssues = nil
+		pr2Reads = []*github.PullRequest{queuedPR(2, "master", "behind")}
+
+		issues.
+			On("ListByRepo", anyContext, repositoryOwner, repositoryName,
+				mock.AnythingOfType("*github.IssueListByRepoOptions")).
+			Return([]*github.Issue{
+				{Number: github.Int(1), PullRequestLinks: &github.PullRequestLinks{}},
+				{Number: github.Int(2), PullRequestLinks: &github.PullRequestLinks{}},
+				{Number: github.Int(3), PullRequestLinks: &github.PullRequestLinks{}},
+				{Number: github.Int(4)},
+			}, emptyResponse, noError)
+		pullRequests.
+			On("Get", anyContext, repositoryOwner, repositoryName, 2).
+			Return(func(context.Context, string, string, int) *github.PullRequest {
+				pr := pr2Reads[0]
+				if len(pr2Reads) > 1 {
+					pr2Reads = pr2Reads[1:]
+				}
+				return pr
+			}, emptyResponse, noError)
+		pullRequests.
+			On("Get", anyContext, repositoryOwner, repositoryName, 3).
+			Return(queuedPR(3, "release", "clean"), emptyResponse, noError)
+	})
+
+	It("evaluates the other PRs queued for the base branch again", func() {
+		Expect(grh.ReevaluateQueuedPRs(conf, merged, issues, pullRequests, repositories, merge)).To(Succeed())
+		Expect(mergedIssues).To(Equal([]int{2}))
+	})
+
+	Context("with UPDATE_QUEUED_BRANCHES", func() {
+		BeforeEach(func() {
+			conf.UpdateQueuedBranches = true
+			repositories.
+				On("Merge", anyContext, repositoryOwner, repositoryName,
+					mock.MatchedBy(func(request *github.RepositoryMergeRequest) bool {
+						return request.GetBase() == "feature" && request.GetHead() == "master"
+					})).
+				Return(&github.RepositoryCommit{}, emptyResponse, noError).
+				Once()
+		})
+
+		It("updates the branches that are behind instead", func() {
+			Expect(grh.ReevaluateQueuedPRs(conf, merged, issues, pullRequests, repositories, merge)).To(Succeed())
+			Expect(mergedIssues).To(BeEmpty())
+			repositories.AssertExpectations(GinkgoT())
+		})
+	})
+
+	Context("with GitHub still checking a PR for conflicts after the merge", func() {
+		BeforeEach(func() {
+			conf.GithubAPITryDeltas = []time.Duration{0, 0}
+			conf.UpdateQueuedBranches = true
+			pr2Reads = []*github.PullRequest{queuedPR(2, "master", "unknown"), queuedPR(2, "master", "behind")}
+			repositories.
+				On("Merge", anyContext, repositoryOwner, repositoryName,
+					mock.AnythingOfType("*github.RepositoryMergeRequest")).
+				Return(&github.RepositoryCommit{}, emptyResponse, noError).
+				Once()
+		})
+
+		It("fetches the PR again and acts on its fresh state", func() {
+			Expect(grh.ReevaluateQueuedPRs(conf, merged, issues, pullRequests, repositories, merge)).To(Succeed())
+			Expect(mergedIssues).To(BeEmpty())
+			repositories.AssertExpectations(GinkgoT())
+			pullRequests.AssertNumberOfCalls(GinkgoT(), "Get", 3)
+		})
+	})
+})
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"expvar"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// throttledCommands counts the commands ignored for exceeding the rate limit
+// by repository. Reported by /debug/vars.
+var throttledCommands = expvar.NewMap("throttled_commands")
+
+// commandRateLimiter limits how many commands a user can issue in a
+// repository within a period, so that spamming comments can't make the bot
+// spam the API with its token.
+type commandRateLimiter struct {
+	sync.Mutex
+	limit  int
+	period time.Duration
+	// commands holds the times of the allowed commands within the last
+	// period by user and repository
+	commands map[string][]time.Time
+	// notifiedAt holds the time the user was last told about being
+	// throttled by user and repository
+	notifiedAt map[string]time.Time
+}
+
+// newCommandRateLimiter creates a limiter allowing limit commands per period.
+// A limit of 0 allows any number of commands.
+func newCommandRateLimiter(limit int, period time.Duration) *commandRateLimiter {
+	return &commandRateLimiter{
+		limit:      limit,
+		period:     period,
+		commands:   make(map[string][]time.Time),
+		notifiedAt: make(map[string]time.Time),
+	}
+}
+
+// allow records the user's command, if it's within the limit. Otherwise it
+// reports whether the user should be told about being throttled, which is
+// only the case for the first throttled command within a period.
+func (l *commandRateLimiter) allow(repository Repository, user string, now time.Time) (allowed, notify bool) {
+	if l.limit == 0 {
+		return true, false
+	}
+	l.Lock()
+	defer l.Unlock()
+
+	key := user + "@" + repositoryKey(repository)
+	var recent []time.Time
+	for _, commandTime := range l.commands[key] {
+		if now.Sub(commandTime) < l.period {
+			recent = append(recent, commandTime)
+		}
+	}
+	if len(recent) < l.limit {
+		l.commands[key] = append(recent, now)
+		delete(l.notifiedAt, key)
+		return true, false
+	}
+	l.commands[key] = recent
+	if now.Sub(l.notifiedAt[key]) < l.period {
+		return false, false
+	}
+	l.notifiedAt[key] = now
+	return false, true
+}
+
+// checkCommandRateLimit responds to the command, if the commenter has exceeded
+// the rate limit.
+func checkCommandRateLimit(conf Config, issueComment IssueComment, limiter *commandRateLimiter,
+	issues Issues) Response {
+
+	allowed, notify := limiter.allow(issueComment.Repository, issueComment.Commenter.Login, time.Now())
+	if allowed {
+		return nil
+	}
+	throttledCommands.Add(repositoryKey(issueComment.Repository), 1)
+	log.Printf("%s has exceeded the command rate limit in %s. Ignoring the command.\n", issueComment.Commenter.Login,
+		repositoryKey(issueComment.Repository))
+	if !notify {
+		return SuccessResponse{"Command rate limit exceeded. Ignoring the command."}
+	}
+	message := renderMessage(conf, rateLimitedMessage, commandMessageData(issueComment, map[string]interface{}{
+		"Limit":  conf.CommandRateLimit,
+		"Period": formatDuration(conf.CommandRateLimitPeriod),
+	}))
+	if err := comment(message, issueComment.Repository, issueComment.IssueNumber, issues); err != nil {
+		return ErrorResponse{err, http.StatusBadGateway, "Failed to respond to a throttled command"}
+	}
+	return SuccessResponse{"Command rate limit exceeded. Responded with a comment. Ignoring the command."}
+}
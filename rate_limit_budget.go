@@ -0,0 +1,53 @@
+package main
+
+import (
+	"expvar"
+	"log"
+	"sync"
+)
+
+// rateLimitThrottledJobs counts the background job runs skipped to save the
+// rate limit for merges by job. Reported by /debug/vars.
+var rateLimitThrottledJobs = expvar.NewMap("rate_limit_throttled_jobs")
+
+// rateLimitBudget reports the number of GitHub API requests left until the
+// rate limits reset, if it's known.
+var rateLimitBudget struct {
+	sync.Mutex
+	remaining func() (int, bool)
+}
+
+func setRateLimitBudget(remaining func() (int, bool)) {
+	rateLimitBudget.Lock()
+	defer rateLimitBudget.Unlock()
+	rateLimitBudget.remaining = remaining
+}
+
+// RemainingRateLimit returns the number of GitHub API requests left until
+// the rate limits reset, if it's known.
+func RemainingRateLimit() (int, bool) {
+	rateLimitBudget.Lock()
+	remaining := rateLimitBudget.remaining
+	rateLimitBudget.Unlock()
+	if remaining == nil {
+		return 0, false
+	}
+	return remaining()
+}
+
+// throttledForRateLimit reports whether the non-urgent background job should
+// skip its run, because fewer than conf.RateLimitReserve requests are left,
+// which are kept for merging PRs.
+func throttledForRateLimit(conf Config, job string) bool {
+	if conf.RateLimitReserve == 0 {
+		return false
+	}
+	remaining, ok := RemainingRateLimit()
+	if !ok || remaining >= conf.RateLimitReserve {
+		return false
+	}
+	log.Printf("Skipping %s, because only %d GitHub API requests are left until the rate limit resets.\n", job,
+		remaining)
+	rateLimitThrottledJobs.Add(job, 1)
+	return true
+}
@@ -0,0 +1,139 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("command rate limit", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			repositories = *context.Repositories
+			issues = *context.Issues
+
+			context.Config.CommandRateLimit = 2
+			context.Config.CommandRateLimitPeriod = time.Minute
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!merge", arbitraryIssueAuthor)
+		})
+
+		BeforeEach(func() {
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(false, emptyResponse, noError).
+				Twice()
+			issues.
+				On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+					mock.MatchedBy(commentContaining("I'm sorry"))).
+				Return(emptyResult, emptyResponse, noError).
+				Twice()
+			issues.
+				On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+					mock.MatchedBy(commentContaining("you've issued more than 2 commands in 1m0s"))).
+				Return(emptyResult, emptyResponse, noError).
+				Once()
+		})
+
+		It("ignores the commands exceeding the limit and notifies the user once", func() {
+			for i := 0; i < 2; i++ {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(responseRecorder.Body.String()).NotTo(ContainSubstring("rate limit"))
+				*context.ResponseRecorder = httptest.NewRecorder()
+				responseRecorder = *context.ResponseRecorder
+			}
+
+			handle()
+			Expect(responseRecorder.Body.String()).To(ContainSubstring("Responded with a comment"))
+
+			*context.ResponseRecorder = httptest.NewRecorder()
+			responseRecorder = *context.ResponseRecorder
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			Expect(responseRecorder.Body.String()).To(Equal("Command rate limit exceeded. Ignoring the command."))
+		})
+	})
+
+	Describe("command rate limit with commands issued by someone other than the PR's author", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+
+			commenter string
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			repositories = *context.Repositories
+			issues = *context.Issues
+
+			context.Config.CommandRateLimit = 1
+			context.Config.CommandRateLimitPeriod = time.Minute
+			commenter = "other-user"
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return withCommenter(IssueCommentEvent("!merge", arbitraryIssueAuthor), commenter)
+		})
+
+		It("limits the commenter instead of the PR's author", func() {
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(false, emptyResponse, noError).
+				Twice()
+			issues.
+				On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+					mock.MatchedBy(commentContaining("I'm sorry"))).
+				Return(emptyResult, emptyResponse, noError).
+				Twice()
+			issues.
+				On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+					mock.MatchedBy(commentContaining("@other-user, you've issued more than 1 commands"))).
+				Return(emptyResult, emptyResponse, noError).
+				Once()
+
+			handle()
+			for _, nextCommenter := range []string{"other-user", arbitraryIssueAuthor} {
+				*context.ResponseRecorder = httptest.NewRecorder()
+				responseRecorder = *context.ResponseRecorder
+				commenter = nextCommenter
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			}
+			Expect(responseRecorder.Body.String()).NotTo(ContainSubstring("rate limit"))
+		})
+	})
+})
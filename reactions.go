@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// graphQLReactionContents maps the names of the reactions, as used in the
+// REST API, to their GraphQL ReactionContent values.
+var graphQLReactionContents = map[string]string{
+	"+1":       "THUMBS_UP",
+	"-1":       "THUMBS_DOWN",
+	"laugh":    "LAUGH",
+	"confused": "CONFUSED",
+	"heart":    "HEART",
+	"hooray":   "HOORAY",
+	"rocket":   "ROCKET",
+	"eyes":     "EYES",
+}
+
+// reactionShortcodes maps the names of the reactions to the shortcodes
+// GitHub renders them from in comments.
+var reactionShortcodes = map[string]string{
+	"+1":       ":+1:",
+	"-1":       ":-1:",
+	"laugh":    ":smile:",
+	"confused": ":confused:",
+	"heart":    ":heart:",
+	"hooray":   ":tada:",
+	"rocket":   ":rocket:",
+	"eyes":     ":eyes:",
+}
+
+const commentReactionsQuery = `query($owner: String!, $name: String!, $number: Int!, $content: ReactionContent!) {
+  repository(owner: $owner, name: $name) {
+    pullRequest(number: $number) {
+      comments(last: 100) {
+        nodes {
+          databaseId
+          reactions(content: $content, first: 100) {
+            nodes {
+              user {
+                login
+              }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+type commentReactionsResult struct {
+	Repository struct {
+		PullRequest struct {
+			Comments struct {
+				Nodes []struct {
+					DatabaseID int `json:"databaseId"`
+					Reactions  struct {
+						Nodes []struct {
+							User *struct {
+								Login string `json:"login"`
+							} `json:"user"`
+						} `json:"nodes"`
+					} `json:"reactions"`
+				} `json:"nodes"`
+			} `json:"comments"`
+		} `json:"pullRequest"`
+	} `json:"repository"`
+}
+
+const addReactionMutation = `mutation($subjectId: ID!, $content: ReactionContent!) {
+  addReaction(input: {subjectId: $subjectId, content: $content}) {
+    reaction {
+      content
+    }
+  }
+}`
+
+// CommandReactions are the reactions the bot acknowledges commands with: one
+// when it accepts a command and another when it's done with it.
+type CommandReactions struct {
+	Received  string
+	Succeeded string
+	Failed    string
+}
+
+// ParseCommandReactions parses the received, succeeded and failed reactions
+// from a comma separated list, e.g. "eyes,rocket,confused". An empty string
+// disables the reactions.
+func ParseCommandReactions(reactionsString string) (*CommandReactions, error) {
+	names := getListFromString(reactionsString)
+	if len(names) == 0 {
+		return nil, nil
+	} else if len(names) != 3 {
+		return nil, fmt.Errorf("expected the received, succeeded and failed reactions, got \"%s\"",
+			reactionsString)
+	}
+	for _, name := range names {
+		if _, exists := graphQLReactionContents[name]; !exists {
+			return nil, fmt.Errorf("unknown reaction \"%s\"", name)
+		}
+	}
+	return &CommandReactions{Received: names[0], Succeeded: names[1], Failed: names[2]}, nil
+}
+
+// reactToCommandOutcome reacts to the command comment according to whether
+// handling the command failed.
+func reactToCommandOutcome(conf Config, issueComment IssueComment, response Response, graphQL GraphQL) {
+	if conf.CommandReactions == nil {
+		return
+	} else if _, failed := asErrorResponse(response); failed {
+		reactToCommand(conf, issueComment, conf.CommandReactions.Failed, graphQL)
+	} else {
+		reactToCommand(conf, issueComment, conf.CommandReactions.Succeeded, graphQL)
+	}
+}
+
+// reactToCommand adds the reaction to the command comment, if reactions are
+// enabled. Failing to react is only logged, because the reactions are just a
+// courtesy.
+func reactToCommand(conf Config, issueComment IssueComment, reaction string, graphQL GraphQL) {
+	if conf.CommandReactions == nil || issueComment.CommentNodeID == "" {
+		return
+	}
+	variables := map[string]interface{}{
+		"subjectId": issueComment.CommentNodeID,
+		"content":   graphQLReactionContents[reaction],
+	}
+	var result struct{}
+	if err := graphQL.Query(context.TODO(), addReactionMutation, variables, &result); err != nil {
+		log.Printf("Failed to react with %s to the command on PR %s: %v\n", reaction,
+			issueComment.Issue().FullName(), err)
+	}
+}
+
+// listReactors returns the logins of the users who reacted with the reaction
+// to the comment on the PR. Only the PR's last 100 comments are looked at,
+// which the bot's recent comments are expected to be among.
+func listReactors(issue Issue, commentID int, reaction string, graphQL GraphQL) ([]string, *ErrorResponse) {
+	variables := map[string]interface{}{
+		"owner":   issue.Repository.Owner,
+		"name":    issue.Repository.Name,
+		"number":  issue.Number,
+		"content": graphQLReactionContents[reaction],
+	}
+	var result commentReactionsResult
+	if err := graphQL.Query(context.TODO(), commentReactionsQuery, variables, &result); err != nil {
+		message := fmt.Sprintf("Failed to list the reactions to the bot's comment on PR %s", issue.FullName())
+		return nil, &ErrorResponse{err, http.StatusBadGateway, message}
+	}
+	var reactors []string
+	for _, node := range result.Repository.PullRequest.Comments.Nodes {
+		if node.DatabaseID != commentID {
+			continue
+		}
+		for _, reaction := range node.Reactions.Nodes {
+			// The user is missing for deleted accounts
+			if reaction.User != nil {
+				reactors = append(reactors, reaction.User.Login)
+			}
+		}
+	}
+	return reactors, nil
+}
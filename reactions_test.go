@@ -0,0 +1,98 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("command reactions", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+			graphQL          *mocks.GraphQL
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			repositories = *context.Repositories
+			issues = *context.Issues
+			graphQL = *context.GraphQL
+
+			context.Config.CommandReactions = &grh.CommandReactions{
+				Received:  "eyes",
+				Succeeded: "rocket",
+				Failed:    "confused",
+			}
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!hold", arbitraryIssueAuthor)
+		})
+
+		expectReaction := func(content string) {
+			graphQL.
+				On("Query", anyContext, mock.MatchedBy(func(query string) bool {
+					return strings.Contains(query, "addReaction")
+				}), map[string]interface{}{"subjectId": commentNodeID, "content": content}, mock.Anything).
+				Return(noError).
+				Once()
+		}
+
+		It("reacts when receiving the command and when it succeeds", func() {
+			expectReaction("EYES")
+			expectReaction("ROCKET")
+			issues.
+				On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{"on-hold"}).
+				Return(emptyResult, emptyResponse, noError)
+
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			graphQL.AssertExpectations(GinkgoT())
+		})
+
+		It("reacts when receiving the command and when it fails", func() {
+			expectReaction("EYES")
+			expectReaction("CONFUSED")
+			issues.
+				On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{"on-hold"}).
+				Return(emptyResult, emptyResponse, errArbitrary)
+
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusBadGateway))
+			graphQL.AssertExpectations(GinkgoT())
+		})
+
+		It("handles the command even if reacting fails", func() {
+			graphQL.
+				On("Query", anyContext, mock.Anything, mock.Anything, mock.Anything).
+				Return(errArbitrary)
+			issues.
+				On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{"on-hold"}).
+				Return(emptyResult, emptyResponse, noError)
+
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+		})
+	})
+})
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/evaluator"
+)
+
+// The names of the rules a PR has to pass before it's merged
+const (
+	mergeableRule     = "mergeable"
+	statusesRule      = "statuses"
+	baseBranchRule    = "base branch"
+	mergeFreezeRule   = "merge freeze"
+	holdRule          = "hold"
+	blocksRule        = "blocks"
+	dependenciesRule  = "dependencies"
+	labelsRule        = "labels"
+	descriptionRule   = "description"
+	approvalsRule     = "approvals"
+	conversationsRule = "conversations"
+)
+
+// ruleError passes an ErrorResponse through the evaluator.
+type ruleError struct {
+	*ErrorResponse
+}
+
+func (e ruleError) Error() string {
+	return e.ErrorMessage
+}
+
+func (e ruleError) Unwrap() error {
+	return e.ErrorResponse.Error
+}
+
+func rule(name string, check func() (evaluator.Result, *ErrorResponse)) evaluator.Rule {
+	return evaluator.Rule{
+		Name: name,
+		Check: func() (evaluator.Result, error) {
+			result, errResp := check()
+			if errResp != nil {
+				return result, ruleError{errResp}
+			}
+			return result, nil
+		},
+	}
+}
+
+// evaluate checks the PR against the rules. If exhaustive is false, then the
+// rules after the first blocking rule aren't checked.
+func evaluate(rules []evaluator.Rule, exhaustive bool) (evaluator.Decision, *ErrorResponse) {
+	decision, err := evaluator.Evaluate(rules, exhaustive)
+	if err != nil {
+		return decision, err.(ruleError).ErrorResponse
+	}
+	return decision, nil
+}
+
+func passed(evidence ...string) evaluator.Result {
+	return evaluator.Result{Outcome: evaluator.Pass, Evidence: evidence}
+}
+
+func failed(reason string, evidence ...string) evaluator.Result {
+	return evaluator.Result{Outcome: evaluator.Fail, Reason: reason, Evidence: evidence}
+}
+
+func pending(reason string, evidence ...string) evaluator.Result {
+	return evaluator.Result{Outcome: evaluator.Pending, Reason: reason, Evidence: evidence}
+}
+
+// readinessRules returns all of the rules a PR has to pass before it's
+// merged.
+func readinessRules(conf Config, pr *github.PullRequest, store Store, issues Issues, pullRequests PullRequests,
+	repositories Repositories, graphQL GraphQL) []evaluator.Rule {
+
+	return append([]evaluator.Rule{
+		rule(mergeableRule, func() (evaluator.Result, *ErrorResponse) {
+			return checkMergeable(pr), nil
+		}),
+		rule(statusesRule, func() (evaluator.Result, *ErrorResponse) {
+			return checkStatuses(pr, store, repositories)
+		}),
+	}, mergeabilityRules(conf, pr, store, issues, pullRequests, repositories, graphQL)...)
+}
+
+// mergeabilityRules returns the rules a PR with successful statuses has to
+// pass before it's merged: the repository's MERGE_GATES, in order.
+func mergeabilityRules(conf Config, pr *github.PullRequest, store Store, issues Issues, pullRequests PullRequests,
+	repositories Repositories, graphQL GraphQL) []evaluator.Rule {
+
+	ctx := GateContext{
+		Config:       conf,
+		PR:           pr,
+		Store:        store,
+		Issues:       issues,
+		PullRequests: pullRequests,
+		Repositories: repositories,
+		GraphQL:      graphQL,
+	}
+	var rules []evaluator.Rule
+	for _, name := range mergeGates(conf) {
+		gate, exists := lookupGate(name)
+		if !exists {
+			// The policies and MERGE_GATES are validated, so this can only
+			// be a gate that's no longer compiled in
+			rules = append(rules, rule(name, func() (evaluator.Result, *ErrorResponse) {
+				return failed("the gate isn't registered"), nil
+			}))
+			continue
+		}
+		gateRule := gateRule(name, gate, ctx)
+		if check, isSkippable := gateSkipChecks[name]; isSkippable {
+			gateRule = skippable(conf, pr, issues, check, gateRule)
+		}
+		rules = append(rules, gateRule)
+	}
+	return rules
+}
+
+func checkMergeable(pr *github.PullRequest) evaluator.Result {
+	if pr.Merged != nil && *pr.Merged {
+		return failed("it has already been merged")
+	} else if pr.Mergeable == nil {
+		return pending("GitHub hasn't checked it for merge conflicts yet")
+	} else if !*pr.Mergeable {
+		return failed("it has a merge conflict")
+	}
+	return passed()
+}
+
+// checkStatuses checks the PR's statuses with the overridden statuses
+// ignored. Every context is included as a child of the result.
+func checkStatuses(pr *github.PullRequest, store Store, repositories Repositories) (evaluator.Result,
+	*ErrorResponse) {
+
+	state, statuses, errResp := getStatuses(pr, repositories)
+	if errResp != nil {
+		return evaluator.Result{}, errResp
+	}
+	state, errResp = applyStatusOverrides(pr, state, statuses, store)
+	if errResp != nil {
+		return evaluator.Result{}, errResp
+	}
+	overridden, errResp := overriddenContexts(pr, store)
+	if errResp != nil {
+		return evaluator.Result{}, errResp
+	}
+	var children []evaluator.Node
+	for _, status := range statuses {
+		var result evaluator.Result
+		switch *status.State {
+		case "success":
+			result = passed()
+		case "pending":
+			result = pending("it's pending")
+		default:
+			result = failed(fmt.Sprintf("it has %s", *status.State))
+		}
+		if overridden[*status.Context] {
+			result.Outcome = evaluator.Pass
+			result.Evidence = append(result.Evidence, "overridden")
+		}
+		children = append(children, evaluator.Node{Rule: *status.Context, Result: result})
+	}
+
+	var result evaluator.Result
+	switch state {
+	case "success":
+		result = passed()
+	case "pending":
+		result = pending("some of its statuses are pending")
+	default:
+		result = failed("some of its statuses have failed")
+	}
+	result.Evidence = append(result.Evidence, fmt.Sprintf("the combined state of %s is %s", *pr.Head.SHA, state))
+	result.Children = children
+	return result, nil
+}
+
+func checkBaseBranch(conf Config, pr *github.PullRequest) evaluator.Result {
+	if len(conf.MergeBaseBranches) > 0 && !isMergeBaseBranchAllowed(conf, *pr.Base.Ref) {
+		return failed(fmt.Sprintf("I'm not allowed to merge into `%s`", *pr.Base.Ref))
+	}
+	return passed()
+}
+
+func checkFreeze(conf Config, repository Repository) evaluator.Result {
+	if reason := checkMergeFreeze(conf, repository); reason != "" {
+		return failed(reason)
+	}
+	return passed()
+}
+
+func checkHold(pr *github.PullRequest, issues Issues) (evaluator.Result, *ErrorResponse) {
+	labels, errResp := getLabels(prIssue(pr), issues)
+	if errResp != nil {
+		return evaluator.Result{}, errResp
+	} else if containsLabel(labels, OnHoldLabel) {
+		return failed("it's on hold", fmt.Sprintf("labeled '%s'", OnHoldLabel)), nil
+	}
+	return passed(), nil
+}
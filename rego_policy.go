@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/salemove/github-review-helper/evaluator"
+)
+
+const (
+	// The name of the gate that evaluates PRs with the REGO_POLICY_PATH
+	// policies
+	regoGate = "rego"
+	// The rule the policies are queried for by default
+	defaultRegoPolicyQuery = "data.review_helper.merge"
+	// How long evaluating a PR may take
+	regoPolicyTimeout = 10 * time.Second
+)
+
+// RegoPolicy is the compiled Rego policy the rego gate evaluates PRs with.
+type RegoPolicy struct {
+	query rego.PreparedEvalQuery
+}
+
+// regoPolicyInput is what the policy gets as input.
+type regoPolicyInput struct {
+	PullRequest *github.PullRequest         `json:"pull_request"`
+	Reviews     []*github.PullRequestReview `json:"reviews"`
+	Statuses    []github.RepoStatus         `json:"statuses"`
+	Labels      []string                    `json:"labels"`
+}
+
+// LoadRegoPolicy compiles the .rego files at the path, which is either a
+// file or a directory, for the query, e.g. "data.review_helper.merge". The
+// query defaults to defaultRegoPolicyQuery. An empty path results in a nil
+// policy.
+func LoadRegoPolicy(path, query string) (*RegoPolicy, error) {
+	if path == "" {
+		return nil, nil
+	} else if query == "" {
+		query = defaultRegoPolicyQuery
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), regoPolicyTimeout)
+	defer cancel()
+	prepared, err := rego.New(rego.Query(query), rego.Load([]string{path}, nil)).PrepareForEval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &RegoPolicy{query: prepared}, nil
+}
+
+// Evaluate evaluates the policy with the input. The query has to result in
+// an object with a boolean "allow" and the reasons to deny the merge in
+// "deny", e.g. {"allow": false, "deny": ["it lacks a security review"]}. The
+// merge is only allowed if allow is true and there are no reasons to deny
+// it.
+func (p *RegoPolicy) Evaluate(input interface{}) (bool, []string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), regoPolicyTimeout)
+	defer cancel()
+	results, err := p.query.Eval(ctx, rego.EvalInput(input))
+	if err != nil {
+		return false, nil, err
+	} else if len(results) == 0 || len(results[0].Expressions) == 0 {
+		return false, []string{"the policy made no decision"}, nil
+	}
+	decision, ok := results[0].Expressions[0].Value.(map[string]interface{})
+	if !ok {
+		return false, nil, fmt.Errorf("the policy's decision must be an object, got %v",
+			results[0].Expressions[0].Value)
+	}
+	allow, _ := decision["allow"].(bool)
+	var reasons []string
+	if deny, ok := decision["deny"].([]interface{}); ok {
+		for _, reason := range deny {
+			reasons = append(reasons, fmt.Sprint(reason))
+		}
+	}
+	// The reasons are a set in the policy, which has no order
+	sort.Strings(reasons)
+	return allow && len(reasons) == 0, reasons, nil
+}
+
+// checkRegoPolicy evaluates the PR with REGO_POLICY_PATH, giving the policy
+// the PR, its reviews, the statuses of its head and its labels as input. The
+// reasons to deny the merge are included as the evidence, so that all of
+// them would be shown in the merge decision check run.
+func checkRegoPolicy(ctx GateContext) (evaluator.Result, *ErrorResponse) {
+	conf := ctx.Config
+	issue := prIssue(ctx.PR)
+	if conf.RegoPolicy == nil {
+		return failed("REGO_POLICY_PATH isn't set"), nil
+	}
+	reviews, errResp := getReviews(issue, ctx.PullRequests)
+	if errResp != nil {
+		return evaluator.Result{}, errResp
+	}
+	_, statuses, errResp := getStatuses(ctx.PR, ctx.Repositories)
+	if errResp != nil {
+		return evaluator.Result{}, errResp
+	}
+	labels, errResp := getLabels(issue, ctx.Issues)
+	if errResp != nil {
+		return evaluator.Result{}, errResp
+	}
+	allow, reasons, err := conf.RegoPolicy.Evaluate(regoPolicyInput{
+		PullRequest: ctx.PR,
+		Reviews:     reviews,
+		Statuses:    statuses,
+		Labels:      labels,
+	})
+	if err != nil {
+		errorMessage := fmt.Sprintf("Failed to evaluate the Rego policy for PR %s", issue.FullName())
+		return evaluator.Result{}, &ErrorResponse{err, http.StatusInternalServerError, errorMessage}
+	} else if !allow {
+		if len(reasons) == 0 {
+			return failed("the Rego policy doesn't allow it"), nil
+		}
+		return failed(strings.Join(reasons, " and "), reasons...), nil
+	}
+	return passed(), nil
+}
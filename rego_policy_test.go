@@ -0,0 +1,176 @@
+package main_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const regoPolicy = `package review_helper.merge
+
+import rego.v1
+
+default allow := false
+
+allow if input.pull_request.number > 0
+
+deny contains "it's labeled do-not-merge" if "do-not-merge" in input.labels
+
+deny contains "nobody has reviewed it" if count(input.reviews) == 0
+`
+
+var _ = Describe("LoadRegoPolicy", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "rego-policy")
+		Expect(err).NotTo(HaveOccurred())
+	})
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("returns no policy for an empty path", func() {
+		policy, err := grh.LoadRegoPolicy("", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policy).To(BeNil())
+	})
+
+	It("fails for an invalid policy", func() {
+		path := filepath.Join(dir, "merge.rego")
+		Expect(ioutil.WriteFile(path, []byte("package review_helper.merge\n\nallow if {"), 0644)).To(Succeed())
+		_, err := grh.LoadRegoPolicy(path, "")
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("rego gate", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+
+			dir string
+
+			anyListOptions = mock.AnythingOfType("*github.ListOptions")
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+
+			var err error
+			dir, err = ioutil.TempDir("", "rego-policy")
+			Expect(err).NotTo(HaveOccurred())
+			path := filepath.Join(dir, "merge.rego")
+			Expect(ioutil.WriteFile(path, []byte(regoPolicy), 0644)).To(Succeed())
+			context.Config.RegoPolicy, err = grh.LoadRegoPolicy(path, "")
+			Expect(err).NotTo(HaveOccurred())
+		})
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		headSHA := "1235"
+		pr := &github.PullRequest{
+			Number:    github.Int(issueNumber),
+			Merged:    github.Bool(false),
+			Mergeable: github.Bool(true),
+			Base: &github.PullRequestBranch{
+				SHA:  github.String("1234"),
+				Ref:  github.String("master"),
+				Repo: repository,
+			},
+			Head: &github.PullRequestBranch{
+				SHA:  github.String(headSHA),
+				Ref:  github.String("feature"),
+				Repo: repository,
+			},
+			User: &github.User{
+				Login: github.String(arbitraryIssueAuthor),
+			},
+		}
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!status", arbitraryIssueAuthor)
+		})
+
+		BeforeEach(func() {
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+				Return(pr, emptyResponse, noError)
+			repositories.
+				On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA, anyListOptions).
+				Return(&github.CombinedStatus{
+					State: github.String("success"),
+				}, emptyResponse, noError)
+			pullRequests.
+				On("ListReviews", anyContext, repositoryOwner, repositoryName, issueNumber, anyListOptions).
+				Return([]*github.PullRequestReview{{
+					State: github.String("APPROVED"),
+					User:  &github.User{Login: github.String("bob")},
+				}}, &github.Response{}, noError)
+		})
+
+		expectComment := func(text string) {
+			issues.
+				On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+					mock.MatchedBy(commentContaining(text))).
+				Return(emptyResult, emptyResponse, noError)
+		}
+
+		Context("with the policy allowing the merge", func() {
+			BeforeEach(func() {
+				mockLabels(issues, issueNumber)
+			})
+
+			It("passes the gate", func() {
+				expectComment(":white_check_mark: **rego**")
+
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+			})
+		})
+
+		Context("with the policy denying the merge", func() {
+			BeforeEach(func() {
+				mockLabels(issues, issueNumber, "do-not-merge")
+			})
+
+			It("blocks the merge with the policy's reasons", func() {
+				expectComment(":x: **rego**: it's labeled do-not-merge")
+
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+			})
+		})
+	})
+})
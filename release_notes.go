@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+const (
+	// releaseNotesDraftName is the name of the draft release the notes are
+	// accumulated in. Once the draft is renamed or published, a new one is
+	// started.
+	releaseNotesDraftName = "Unreleased"
+	releaseNotesDraftTag  = "unreleased"
+	// otherChangesCategory is the category of the PRs that have none of the
+	// categories' labels
+	otherChangesCategory = "Other changes"
+)
+
+// ReleaseNoteCategory groups the release notes of the PRs with any of the
+// category's labels under the category's title.
+type ReleaseNoteCategory struct {
+	Title  string
+	Labels []string
+}
+
+// ParseReleaseNoteCategories parses a semicolon separated list of
+// title=labels categories, where the labels are separated by commas, e.g.
+// "Features=feature,enhancement; Bug fixes=bug".
+func ParseReleaseNoteCategories(categoriesString string) ([]ReleaseNoteCategory, error) {
+	categories := []ReleaseNoteCategory{}
+	for _, categoryString := range strings.Split(categoriesString, ";") {
+		categoryString = strings.TrimSpace(categoryString)
+		if categoryString == "" {
+			continue
+		}
+		i := strings.Index(categoryString, "=")
+		if i == -1 {
+			return nil, fmt.Errorf("categories must be in the title=labels format, got \"%s\"", categoryString)
+		}
+		category := ReleaseNoteCategory{
+			Title:  strings.TrimSpace(categoryString[:i]),
+			Labels: getListFromString(categoryString[i+1:]),
+		}
+		if category.Title == "" {
+			return nil, fmt.Errorf("no title in \"%s\"", categoryString)
+		} else if len(category.Labels) == 0 {
+			return nil, fmt.Errorf("no labels in \"%s\"", categoryString)
+		}
+		categories = append(categories, category)
+	}
+	return categories, nil
+}
+
+// addReleaseNote adds an entry for the merged PR to the repository's draft
+// release, creating the draft if there isn't one yet. Only the PRs merged
+// into the repository's default branch are added.
+func addReleaseNote(conf Config, pr *github.PullRequest, issues Issues, repositories Repositories) error {
+	issue := prIssue(pr)
+	defaultBranch := pr.Base.Repo.GetDefaultBranch()
+	if !conf.ReleaseNotes || (defaultBranch != "" && *pr.Base.Ref != defaultBranch) {
+		return nil
+	}
+	allLabels, errResp := getLabels(issue, issues)
+	if errResp != nil {
+		return errResp.Error
+	}
+	// The merging label may still be listed, if it was removed just now
+	var labels []string
+	for _, label := range allLabels {
+		if label != MergingLabel {
+			labels = append(labels, label)
+		}
+	}
+	category := releaseNoteCategory(conf.ReleaseNoteCategories, labels)
+	entry := releaseNoteEntry(pr, labels)
+
+	draft, err := findReleaseNotesDraft(issue.Repository, repositories)
+	if err != nil {
+		return fmt.Errorf("failed to find the draft release of %s: %v", repositoryKey(issue.Repository), err)
+	} else if draft == nil {
+		release := &github.RepositoryRelease{
+			Name:    github.String(releaseNotesDraftName),
+			TagName: github.String(releaseNotesDraftTag),
+			Body:    github.String(addReleaseNoteEntry("", conf.ReleaseNoteCategories, category, entry)),
+			Draft:   github.Bool(true),
+		}
+		_, _, err = repositories.CreateRelease(context.TODO(), issue.Repository.Owner, issue.Repository.Name, release)
+		if err != nil {
+			return fmt.Errorf("failed to create a draft release for PR %s: %v", issue.FullName(), err)
+		}
+		log.Printf("Started a draft release with PR %s.\n", issue.FullName())
+		return nil
+	}
+
+	// The merge may be retried, so the PR may already be in the notes
+	if strings.Contains(draft.GetBody(), fmt.Sprintf("(#%d)", issue.Number)) {
+		return nil
+	}
+	release := &github.RepositoryRelease{
+		Name: github.String(releaseNotesDraftName),
+		Body: github.String(addReleaseNoteEntry(draft.GetBody(), conf.ReleaseNoteCategories, category, entry)),
+	}
+	_, _, err = repositories.EditRelease(context.TODO(), issue.Repository.Owner, issue.Repository.Name,
+		draft.GetID(), release)
+	if err != nil {
+		return fmt.Errorf("failed to add PR %s to the draft release: %v", issue.FullName(), err)
+	}
+	log.Printf("Added PR %s to the draft release.\n", issue.FullName())
+	return nil
+}
+
+func findReleaseNotesDraft(repository Repository, repositories Repositories) (*github.RepositoryRelease, error) {
+	pageNr := 1
+	for {
+		listOptions := &github.ListOptions{
+			Page:    pageNr,
+			PerPage: 100,
+		}
+		releases, resp, err := repositories.ListReleases(context.TODO(), repository.Owner, repository.Name,
+			listOptions)
+		if err != nil {
+			return nil, err
+		}
+		for _, release := range releases {
+			if release.GetDraft() && release.GetName() == releaseNotesDraftName {
+				return release, nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return nil, nil
+		}
+		pageNr = resp.NextPage
+	}
+}
+
+// releaseNoteCategory returns the title of the first category that has any
+// of the labels.
+func releaseNoteCategory(categories []ReleaseNoteCategory, labels []string) string {
+	for _, category := range categories {
+		for _, categoryLabel := range category.Labels {
+			for _, label := range labels {
+				if label == categoryLabel {
+					return category.Title
+				}
+			}
+		}
+	}
+	return otherChangesCategory
+}
+
+func releaseNoteEntry(pr *github.PullRequest, labels []string) string {
+	entry := fmt.Sprintf("- %s (#%d) by @%s", pr.GetTitle(), pr.GetNumber(), pr.User.GetLogin())
+	if len(labels) > 0 {
+		entry += " " + formatLogins(labels)
+	}
+	return entry
+}
+
+// addReleaseNoteEntry appends the entry to the category's section of the
+// release notes. Missing sections are added in the order of the categories,
+// with the other changes last.
+func addReleaseNoteEntry(notes string, categories []ReleaseNoteCategory, category, entry string) string {
+	var lines []string
+	if notes != "" {
+		lines = strings.Split(strings.TrimRight(notes, "\n"), "\n")
+	}
+	heading := "## " + category
+	for i, line := range lines {
+		if line != heading {
+			continue
+		}
+		end := i + 1
+		for end < len(lines) && !strings.HasPrefix(lines[end], "## ") {
+			end++
+		}
+		// Keeping the blank lines that separate the section from the next
+		for end > i+1 && strings.TrimSpace(lines[end-1]) == "" {
+			end--
+		}
+		lines = append(lines[:end], append([]string{entry}, lines[end:]...)...)
+		return strings.Join(lines, "\n") + "\n"
+	}
+
+	order := make([]string, 0, len(categories)+1)
+	for _, c := range categories {
+		order = append(order, c.Title)
+	}
+	order = append(order, otherChangesCategory)
+	later := false
+	laterHeadings := make(map[string]bool)
+	for _, title := range order {
+		if later {
+			laterHeadings["## "+title] = true
+		}
+		later = later || title == category
+	}
+	section := []string{heading, "", entry, ""}
+	for i, line := range lines {
+		if laterHeadings[line] {
+			lines = append(lines[:i], append(section, lines[i:]...)...)
+			return strings.Join(lines, "\n") + "\n"
+		}
+	}
+	if len(lines) > 0 {
+		lines = append(lines, "")
+	}
+	return strings.Join(append(lines, section[:3]...), "\n") + "\n"
+}
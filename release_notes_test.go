@@ -0,0 +1,161 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("release notes", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+			gitRepos         *mocks.Repos
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+			gitRepos = *context.GitRepos
+
+			context.Config.ReleaseNotes = true
+			context.Config.ReleaseNoteCategories = []grh.ReleaseNoteCategory{
+				{Title: "Features", Labels: []string{"feature", "enhancement"}},
+				{Title: "Bug fixes", Labels: []string{"bug"}},
+			}
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!merge", arbitraryIssueAuthor)
+		})
+
+		headSHA := "1235"
+		pr := &github.PullRequest{
+			Number:    github.Int(issueNumber),
+			Title:     github.String("Fix the login form"),
+			Merged:    github.Bool(false),
+			Mergeable: github.Bool(true),
+			Base: &github.PullRequestBranch{
+				SHA:  github.String("1234"),
+				Ref:  github.String("master"),
+				Repo: repository,
+			},
+			Head: &github.PullRequestBranch{
+				SHA:  github.String(headSHA),
+				Ref:  github.String("feature"),
+				Repo: repository,
+			},
+			User: &github.User{
+				Login: github.String(arbitraryIssueAuthor),
+			},
+		}
+
+		BeforeEach(func() {
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+			issues.
+				On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{grh.MergingLabel}).
+				Return(emptyResult, emptyResponse, noError)
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+				Return(pr, emptyResponse, noError)
+			repositories.
+				On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.AnythingOfType("*github.ListOptions")).
+				Return(&github.CombinedStatus{
+					State: github.String("success"),
+				}, emptyResponse, noError)
+			mockLabels(issues, issueNumber, grh.MergingLabel, "bug")
+			pullRequests.
+				On("Merge", anyContext, repositoryOwner, repositoryName, issueNumber, "", noSquashOpts).
+				Return(&github.PullRequestMergeResult{Merged: github.Bool(true)}, emptyResponse, noError)
+			issues.
+				On("RemoveLabelForIssue", anyContext, repositoryOwner, repositoryName, issueNumber, grh.MergingLabel).
+				Return(emptyResponse, noError)
+			gitRepo := new(mocks.Repo)
+			gitRepos.
+				On("GetUpdatedRepo", sshURL, repositoryOwner, repositoryName).
+				Return(gitRepo, noError)
+			gitRepo.On("DeleteRemoteBranch", "feature").Return(noError)
+		})
+
+		mockReleases := func(releases ...*github.RepositoryRelease) {
+			repositories.
+				On("ListReleases", anyContext, repositoryOwner, repositoryName,
+					mock.AnythingOfType("*github.ListOptions")).
+				Return(releases, &github.Response{}, noError)
+		}
+
+		Context("without a draft release", func() {
+			BeforeEach(func() {
+				mockReleases(&github.RepositoryRelease{
+					ID:   github.Int(1),
+					Name: github.String("v1.0.0"),
+				})
+				repositories.
+					On("CreateRelease", anyContext, repositoryOwner, repositoryName,
+						mock.MatchedBy(func(release *github.RepositoryRelease) bool {
+							return release.GetDraft() && release.GetBody() == "## Bug fixes\n\n"+
+								"- Fix the login form (#"+strconv.Itoa(issueNumber)+") by @"+arbitraryIssueAuthor+" `bug`\n"
+						})).
+					Return(emptyResult, emptyResponse, noError)
+			})
+
+			It("starts a draft release with the PR", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				repositories.AssertExpectations(GinkgoT())
+			})
+		})
+
+		Context("with a draft release", func() {
+			BeforeEach(func() {
+				mockReleases(&github.RepositoryRelease{
+					ID:    github.Int(2),
+					Name:  github.String("Unreleased"),
+					Draft: github.Bool(true),
+					Body: github.String("## Features\n\n- Add a logout button (#1) by @alice `feature`\n\n" +
+						"## Other changes\n\n- Bump the dependencies (#2) by @bob\n"),
+				})
+				repositories.
+					On("EditRelease", anyContext, repositoryOwner, repositoryName, 2,
+						mock.MatchedBy(func(release *github.RepositoryRelease) bool {
+							return release.GetBody() == "## Features\n\n"+
+								"- Add a logout button (#1) by @alice `feature`\n\n"+
+								"## Bug fixes\n\n"+
+								"- Fix the login form (#"+strconv.Itoa(issueNumber)+") by @"+arbitraryIssueAuthor+" `bug`\n\n"+
+								"## Other changes\n\n"+
+								"- Bump the dependencies (#2) by @bob\n"
+						})).
+					Return(emptyResult, emptyResponse, noError)
+			})
+
+			It("adds the PR to the draft's section of its category", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				repositories.AssertExpectations(GinkgoT())
+			})
+		})
+	})
+})
@@ -0,0 +1,211 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("!remind comment", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			store            grh.Store
+			issues           *mocks.Issues
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			store = *context.Store
+			issues = *context.Issues
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+
+		Context("with a valid reminder", func() {
+			requestJSON.Is(func() string {
+				return IssueCommentEvent("!remind me in 1d12h to rebase", arbitraryIssueAuthor)
+			})
+
+			ForCollaborator(context, repositoryOwner, repositoryName, arbitraryIssueAuthor, func() {
+				BeforeEach(func() {
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("I'll remind you to rebase at"))).
+						Return(emptyResult, emptyResponse, noError)
+				})
+
+				It("stores the reminder", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+
+					reminders, err := store.Reminders()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(reminders).To(HaveLen(1))
+					Expect(reminders[0].User).To(Equal(arbitraryIssueAuthor))
+					Expect(reminders[0].PullRequest).To(Equal(issueNumber))
+					Expect(reminders[0].Message).To(Equal("rebase"))
+					Expect(reminders[0].DueAt.Sub(reminders[0].CreatedAt)).To(Equal(36 * time.Hour))
+				})
+			})
+		})
+
+		Context("with a reminder set by someone other than the PR's author", func() {
+			requestJSON.Is(func() string {
+				return withCommenter(IssueCommentEvent("!remind me in 2h", arbitraryIssueAuthor), "reviewer")
+			})
+
+			ForCollaborator(context, repositoryOwner, repositoryName, arbitraryIssueAuthor, func() {
+				BeforeEach(func() {
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("@reviewer, I'll remind you"))).
+						Return(emptyResult, emptyResponse, noError)
+				})
+
+				It("reminds the commenter", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+
+					reminders, err := store.Reminders()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(reminders).To(HaveLen(1))
+					Expect(reminders[0].User).To(Equal("reviewer"))
+				})
+			})
+		})
+
+		Context("with a reminder at a time", func() {
+			requestJSON.Is(func() string {
+				return IssueCommentEvent("!remind me at tomorrow 9am CET to rebase", arbitraryIssueAuthor)
+			})
+
+			ForCollaborator(context, repositoryOwner, repositoryName, arbitraryIssueAuthor, func() {
+				BeforeEach(func() {
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("09:00 CET (08:00 UTC)"))).
+						Return(emptyResult, emptyResponse, noError)
+				})
+
+				It("stores the reminder and echoes the time back", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+
+					reminders, err := store.Reminders()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(reminders).To(HaveLen(1))
+					Expect(reminders[0].DueAt.UTC().Hour()).To(Equal(8))
+					Expect(reminders[0].DueAt.After(time.Now())).To(BeTrue())
+				})
+			})
+		})
+
+		Context("with a reminder at a time in a repository with a time zone", func() {
+			requestJSON.Is(func() string {
+				return IssueCommentEvent("!remind me at tomorrow 9am to rebase", arbitraryIssueAuthor)
+			})
+
+			BeforeEach(func() {
+				tokyo, err := time.LoadLocation("Asia/Tokyo")
+				Expect(err).NotTo(HaveOccurred())
+				context.Config.RepositoryLocations = map[string]*time.Location{
+					repositoryOwner + "/" + repositoryName: tokyo,
+				}
+			})
+
+			ForCollaborator(context, repositoryOwner, repositoryName, arbitraryIssueAuthor, func() {
+				BeforeEach(func() {
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("09:00 JST (00:00 UTC)"))).
+						Return(emptyResult, emptyResponse, noError)
+				})
+
+				It("reads the time in the repository's time zone", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertExpectations(GinkgoT())
+				})
+			})
+		})
+
+		Context("with an invalid delay", func() {
+			requestJSON.Is(func() string {
+				return IssueCommentEvent("!remind me in soon to rebase", arbitraryIssueAuthor)
+			})
+
+			BeforeEach(func() {
+				(*context.Repositories).
+					On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+					Return(true, emptyResponse, noError)
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("`soon` is not a delay I understand"))).
+					Return(emptyResult, emptyResponse, noError)
+			})
+
+			It("responds with a comment without storing a reminder", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(store.Reminders()).To(BeEmpty())
+			})
+		})
+	})
+})
+
+var _ = Describe("PostDueReminders", func() {
+	var (
+		store  grh.Store
+		issues *mocks.Issues
+		now    time.Time
+
+		repository = grh.Repository{Owner: repositoryOwner, Name: repositoryName}
+	)
+
+	BeforeEach(func() {
+		store = grh.NewMemoryStore()
+		issues = new(mocks.Issues)
+		now = time.Now()
+
+		Expect(store.AddReminder(grh.Reminder{Repository: repository, PullRequest: 1, User: "alice",
+			Message: "rebase", CreatedAt: now.Add(-time.Hour), DueAt: now.Add(-time.Minute)})).To(Succeed())
+		Expect(store.AddReminder(grh.Reminder{Repository: repository, PullRequest: 2, User: "bob",
+			CreatedAt: now.Add(-time.Hour), DueAt: now.Add(time.Hour)})).To(Succeed())
+
+		issues.
+			On("CreateComment", anyContext, repositoryOwner, repositoryName, 1,
+				mock.MatchedBy(func(issueComment *github.IssueComment) bool {
+					return *issueComment.Body == "@alice, you asked me to remind you to rebase."
+				})).
+			Return(emptyResult, emptyResponse, noError)
+	})
+
+	AfterEach(func() {
+		issues.AssertExpectations(GinkgoT())
+	})
+
+	It("posts the due reminders", func() {
+		Expect(grh.PostDueReminders(store, issues, now)).To(Succeed())
+
+		reminders, err := store.Reminders()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reminders).To(HaveLen(1))
+		Expect(reminders[0].User).To(Equal("bob"))
+	})
+})
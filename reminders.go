@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// How often to check for reminders that are due
+	reminderCheckInterval = time.Minute
+	maxReminderDelay      = 365 * 24 * time.Hour
+)
+
+var (
+	remindCommandRegexp     = regexp.MustCompile(`^!remind me (in|at|on) (.+?)(?:\s+to\s+(.+))?$`)
+	reminderDelayRegexp     = regexp.MustCompile(`^(?:\d+[wdhm])+$`)
+	reminderDelayPartRegexp = regexp.MustCompile(`(\d+)([wdhm])`)
+)
+
+var errReminderTooFar = errors.New("reminders can be at most a year away")
+
+var reminderDelayUnits = map[string]time.Duration{
+	"w": 7 * 24 * time.Hour,
+	"d": 24 * time.Hour,
+	"h": time.Hour,
+	"m": time.Minute,
+}
+
+func isRemindCommand(comment string) bool {
+	return strings.HasPrefix(strings.TrimSpace(comment), "!remind ")
+}
+
+// parseRemindCommand parses a "!remind me in <delay> [to <what>]" or a
+// "!remind me at <time> [to <what>]" command on the first line of the comment,
+// e.g. "!remind me in 3d to rebase" or "!remind me at tomorrow 9am CET to
+// rebase", and returns when the reminder is due. The delay consists of weeks
+// (w), days (d), hours (h) and minutes (m), e.g. "1d12h". Weeks and days are
+// calendar days in the location. The time is a phrase in the ParseTimePhrase
+// format, in the location unless it names a time zone.
+func parseRemindCommand(comment string, now time.Time, location *time.Location) (time.Time, string, error) {
+	firstLine := strings.SplitN(strings.TrimSpace(comment), "\n", 2)[0]
+	matches := remindCommandRegexp.FindStringSubmatch(strings.TrimSpace(firstLine))
+	if matches == nil {
+		return time.Time{}, "", fmt.Errorf("reminders have to be in the `!remind me in 3d to rebase` or " +
+			"`!remind me at tomorrow 9am to rebase` format")
+	}
+	message := strings.TrimSpace(matches[3])
+	if matches[1] != "in" {
+		dueAt, err := ParseTimePhrase(matches[2], now, location)
+		if err != nil {
+			return time.Time{}, "", err
+		} else if dueAt.Sub(now) > maxReminderDelay {
+			return time.Time{}, "", errReminderTooFar
+		}
+		return dueAt, message, nil
+	} else if !reminderDelayRegexp.MatchString(matches[2]) {
+		return time.Time{}, "", fmt.Errorf("`%s` is not a delay I understand, try something like `2h`, `3d` or `1w`",
+			matches[2])
+	}
+	var (
+		days  int
+		delay time.Duration
+	)
+	for _, part := range reminderDelayPartRegexp.FindAllStringSubmatch(matches[2], -1) {
+		count, err := strconv.Atoi(part[1])
+		unit := reminderDelayUnits[part[2]]
+		if err != nil || time.Duration(count) > maxReminderDelay/unit {
+			return time.Time{}, "", errReminderTooFar
+		} else if unit%(24*time.Hour) == 0 {
+			days += count * int(unit/(24*time.Hour))
+		} else {
+			delay += time.Duration(count) * unit
+		}
+	}
+	// Days are added to the date, so that "in 1d" would be at the same time
+	// of day tomorrow, even when daylight saving time starts or ends
+	dueAt := now.In(location).AddDate(0, 0, days).Add(delay)
+	if !dueAt.After(now) {
+		return time.Time{}, "", fmt.Errorf("the delay has to be longer than 0")
+	} else if dueAt.Sub(now) > maxReminderDelay {
+		return time.Time{}, "", errReminderTooFar
+	}
+	return dueAt, message, nil
+}
+
+// handleRemindCommand stores a reminder to mention the commenter on the PR
+// once it's due. The due time is echoed back, so that the commenter could
+// check that it was understood as intended.
+func handleRemindCommand(conf Config, issueComment IssueComment, store Store, issues Issues) Response {
+	issue := issueComment.Issue()
+	now := time.Now()
+	dueAt, message, err := parseRemindCommand(issueComment.Comment, now,
+		conf.repositoryCommandLocation(issue.Repository))
+	if err != nil {
+		reply := fmt.Sprintf("@%s, I can't set that reminder: %s.", issueComment.Commenter.Login, err)
+		if err = comment(reply, issue.Repository, issue.Number, issues); err != nil {
+			errorMessage := fmt.Sprintf("Failed to respond to an invalid reminder on PR %s", issue.FullName())
+			return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+		}
+		return SuccessResponse{"Invalid reminder. Responded with a comment."}
+	}
+	reminder := Reminder{
+		Repository:  issue.Repository,
+		PullRequest: issue.Number,
+		User:        issueComment.Commenter.Login,
+		Message:     message,
+		CreatedAt:   now,
+		DueAt:       dueAt,
+	}
+	if err = store.AddReminder(reminder); err != nil {
+		errorMessage := fmt.Sprintf("Failed to store the reminder for PR %s", issue.FullName())
+		return ErrorResponse{err, http.StatusInternalServerError, errorMessage}
+	}
+	reply := fmt.Sprintf("@%s, I'll remind you %sat %s.", reminder.User, reminderPurpose(reminder),
+		formatTimeInterpretation(dueAt))
+	if err = comment(reply, issue.Repository, issue.Number, issues); err != nil {
+		errorMessage := fmt.Sprintf("Failed to confirm the reminder on PR %s", issue.FullName())
+		return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	return SuccessResponse{fmt.Sprintf("Set a reminder for %s on PR %s", reminder.User, issue.FullName())}
+}
+
+func reminderPurpose(reminder Reminder) string {
+	if reminder.Message == "" {
+		return ""
+	}
+	return fmt.Sprintf("to %s ", reminder.Message)
+}
+
+// runReminders periodically posts the reminders that are due, until stop is
+// closed.
+func runReminders(store Store, issues Issues, stop <-chan struct{}) {
+	ticker := time.NewTicker(reminderCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if pausedForGithubIncident("reminders") {
+				continue
+			}
+			if err := PostDueReminders(store, issues, time.Now()); err != nil {
+				log.Printf("Posting reminders failed: %v\n", err)
+			}
+		}
+	}
+}
+
+// PostDueReminders mentions the users whose reminders are due on the PRs they
+// set them on. The posted reminders are no longer tracked.
+func PostDueReminders(store Store, issues Issues, now time.Time) error {
+	reminders, err := store.Reminders()
+	if err != nil {
+		return fmt.Errorf("failed to list reminders: %v", err)
+	}
+	for _, reminder := range reminders {
+		if reminder.DueAt.After(now) {
+			continue
+		}
+		var message string
+		if reminder.Message == "" {
+			message = fmt.Sprintf("@%s, here's the reminder you asked for.", reminder.User)
+		} else {
+			message = fmt.Sprintf("@%s, you asked me to remind you to %s.", reminder.User, reminder.Message)
+		}
+		if err = comment(message, reminder.Repository, reminder.PullRequest, issues); err != nil {
+			log.Printf("Failed to post %s's reminder on PR %s#%d: %v\n", reminder.User,
+				repositoryKey(reminder.Repository), reminder.PullRequest, err)
+			continue
+		}
+		if err = store.RemoveReminder(reminder); err != nil {
+			return fmt.Errorf("failed to remove %s's posted reminder: %v", reminder.User, err)
+		}
+	}
+	return nil
+}
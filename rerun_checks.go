@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/salemove/github-review-helper/git"
+)
+
+const failedCheckSuitesQuery = `query($owner: String!, $name: String!, $sha: GitObjectID!) {
+  repository(owner: $owner, name: $name) {
+    id
+    object(oid: $sha) {
+      ... on Commit {
+        checkSuites(first: 100) {
+          nodes {
+            id
+            conclusion
+            app {
+              name
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+const rerequestCheckSuiteMutation = `mutation($repositoryId: ID!, $checkSuiteId: ID!) {
+  rerequestCheckSuite(input: {repositoryId: $repositoryId, checkSuiteId: $checkSuiteId}) {
+    checkSuite {
+      id
+    }
+  }
+}`
+
+// failedCheckConclusions are the conclusions of the check suites that
+// "!rerun-checks" re-requests
+var failedCheckConclusions = map[string]bool{
+	"FAILURE":         true,
+	"TIMED_OUT":       true,
+	"CANCELLED":       true,
+	"STARTUP_FAILURE": true,
+}
+
+type checkSuite struct {
+	ID string
+	// App is the name of the GitHub App the suite belongs to, e.g. "GitHub
+	// Actions"
+	App string
+}
+
+func isRerunChecksCommand(comment string) bool {
+	return strings.TrimSpace(comment) == "!rerun-checks"
+}
+
+// handleRerunChecksCommand re-requests the failed check suites on the PR's
+// head, leaving the successful ones alone, which is cheaper than re-running
+// everything when CI is flaky. A PR labeled for merging stays labeled and is
+// evaluated for merging again once the re-requested suites complete.
+func handleRerunChecksCommand(issueComment IssueComment, store Store, issues Issues, pullRequests PullRequests,
+	graphQL GraphQL) Response {
+
+	issue := issueComment.Issue()
+	pr, errResp := getPR(issue, pullRequests)
+	if errResp != nil {
+		return errResp
+	}
+	headSHA := pr.Head.GetSHA()
+	repositoryID, suites, err := failedCheckSuites(baseRepository(pr), headSHA, graphQL)
+	if err != nil {
+		message := fmt.Sprintf("Failed to get the check suites of PR %s", issue.FullName())
+		return ErrorResponse{err, http.StatusBadGateway, message}
+	} else if len(suites) == 0 {
+		message := fmt.Sprintf("@%s, none of the check suites on %s have failed, so there's nothing to rerun.",
+			issueComment.Commenter.Login, shortSHA(headSHA))
+		if err = comment(message, issue.Repository, issue.Number, issues); err != nil {
+			errorMessage := fmt.Sprintf("Failed to report the lack of failed check suites on PR %s",
+				issue.FullName())
+			return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+		}
+		return SuccessResponse{fmt.Sprintf("PR %s has no failed check suites", issue.FullName())}
+	}
+	ids := make([]string, len(suites))
+	apps := make([]string, len(suites))
+	for i, suite := range suites {
+		var result struct{}
+		err = graphQL.Query(context.TODO(), rerequestCheckSuiteMutation, map[string]interface{}{
+			"repositoryId": repositoryID,
+			"checkSuiteId": suite.ID,
+		}, &result)
+		if err != nil {
+			message := fmt.Sprintf("Failed to re-request the %s check suite of PR %s", suite.App, issue.FullName())
+			return ErrorResponse{err, http.StatusBadGateway, message}
+		}
+		ids[i] = suite.ID
+		apps[i] = suite.App
+	}
+	log.Printf("Re-requested %d failed check suites of PR %s.\n", len(suites), issue.FullName())
+	message := fmt.Sprintf("I re-requested the failed check suites of %s: %s.", shortSHA(headSHA),
+		formatCheckSuiteApps(apps))
+	if issueComment.HasLabel(MergingLabel) {
+		err = store.SetPendingRerun(PendingRerun{Issue: issue, HeadSHA: headSHA, CheckSuiteIDs: ids})
+		if err != nil {
+			errorMessage := fmt.Sprintf("Failed to record the rerun of the check suites of PR %s",
+				issue.FullName())
+			return ErrorResponse{err, http.StatusInternalServerError, errorMessage}
+		}
+		message += " The PR stays in the merge queue and I'll check whether it can be merged once they complete."
+	}
+	if err = comment(message, issue.Repository, issue.Number, issues); err != nil {
+		errorMessage := fmt.Sprintf("Failed to report the rerun of the check suites of PR %s", issue.FullName())
+		return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	return SuccessResponse{fmt.Sprintf("Re-requested %d failed check suites of PR %s", len(suites),
+		issue.FullName())}
+}
+
+// failedCheckSuites returns the GraphQL ID of the repository and the check
+// suites on the commit that have failed, timed out or been cancelled.
+func failedCheckSuites(repository Repository, sha string, graphQL GraphQL) (string, []checkSuite, error) {
+	var result struct {
+		Repository struct {
+			ID     string `json:"id"`
+			Object struct {
+				CheckSuites struct {
+					Nodes []struct {
+						ID         string `json:"id"`
+						Conclusion string `json:"conclusion"`
+						App        *struct {
+							Name string `json:"name"`
+						} `json:"app"`
+					} `json:"nodes"`
+				} `json:"checkSuites"`
+			} `json:"object"`
+		} `json:"repository"`
+	}
+	err := graphQL.Query(context.TODO(), failedCheckSuitesQuery, map[string]interface{}{
+		"owner": repository.Owner,
+		"name":  repository.Name,
+		"sha":   sha,
+	}, &result)
+	if err != nil {
+		return "", nil, err
+	}
+	suites := []checkSuite{}
+	for _, node := range result.Repository.Object.CheckSuites.Nodes {
+		if !failedCheckConclusions[node.Conclusion] {
+			continue
+		}
+		suite := checkSuite{ID: node.ID, App: "unknown app"}
+		if node.App != nil {
+			suite.App = node.App.Name
+		}
+		suites = append(suites, suite)
+	}
+	return result.Repository.ID, suites, nil
+}
+
+// handleCheckSuiteEvent tracks the completion of the check suites
+// re-requested with "!rerun-checks". Once all of a PR's re-requested suites
+// have completed, the PR is merged, if it's ready and still labeled for
+// merging.
+func handleCheckSuiteEvent(conf Config, body []byte, gitRepos git.Repos, store Store, issues Issues,
+	pullRequests PullRequests, repositories Repositories, graphQL GraphQL) Response {
+
+	checkSuiteEvent, err := parseCheckSuiteEvent(body)
+	if err != nil {
+		return ErrorResponse{err, http.StatusInternalServerError, "Failed to parse the request's body"}
+	} else if checkSuiteEvent.Action != "completed" {
+		return SuccessResponse{"Check suite not completed. Ignoring."}
+	}
+	reruns, err := store.PendingReruns()
+	if err != nil {
+		return ErrorResponse{err, http.StatusInternalServerError, "Failed to list the pending check suite reruns"}
+	}
+	for _, rerun := range reruns {
+		if rerun.HeadSHA != checkSuiteEvent.HeadSHA ||
+			repositoryKey(rerun.Issue.Repository) != repositoryKey(checkSuiteEvent.Repository) {
+			continue
+		}
+		remaining := []string{}
+		for _, id := range rerun.CheckSuiteIDs {
+			if id != checkSuiteEvent.NodeID {
+				remaining = append(remaining, id)
+			}
+		}
+		issue := rerun.Issue
+		if len(remaining) == len(rerun.CheckSuiteIDs) {
+			continue
+		} else if len(remaining) > 0 {
+			rerun.CheckSuiteIDs = remaining
+			if err = store.SetPendingRerun(rerun); err != nil {
+				message := fmt.Sprintf("Failed to record the rerun of the check suites of PR %s", issue.FullName())
+				return ErrorResponse{err, http.StatusInternalServerError, message}
+			}
+			return SuccessResponse{fmt.Sprintf("Waiting for %d more check suites of PR %s to complete",
+				len(remaining), issue.FullName())}
+		}
+		if err = store.RemovePendingRerun(issue); err != nil {
+			message := fmt.Sprintf("Failed to stop tracking the rerun of the check suites of PR %s",
+				issue.FullName())
+			return ErrorResponse{err, http.StatusInternalServerError, message}
+		}
+		log.Printf("The re-requested check suites of PR %s have completed. Merging it if it's ready.\n",
+			issue.FullName())
+		return mergeIfLabeled(conf, issue, store, issues, pullRequests, repositories, graphQL, gitRepos)
+	}
+	return SuccessResponse{"Check suite wasn't re-requested by the bot. Ignoring."}
+}
+
+func formatCheckSuiteApps(apps []string) string {
+	return "`" + strings.Join(apps, "`, `") + "`"
+}
@@ -0,0 +1,204 @@
+package main_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	var (
+		handle      = context.Handle
+		headers     = context.Headers
+		requestJSON = context.RequestJSON
+
+		responseRecorder *httptest.ResponseRecorder
+		store            grh.Store
+		pullRequests     *mocks.PullRequests
+		repositories     *mocks.Repositories
+		issues           *mocks.Issues
+		graphQL          *mocks.GraphQL
+
+		headSHA = "1235"
+		issue   = grh.Issue{
+			Number:     issueNumber,
+			Repository: grh.Repository{Owner: repositoryOwner, Name: repositoryName, URL: sshURL},
+			User:       grh.User{Login: arbitraryIssueAuthor},
+		}
+	)
+	BeforeEach(func() {
+		responseRecorder = *context.ResponseRecorder
+		store = *context.Store
+		pullRequests = *context.PullRequests
+		repositories = *context.Repositories
+		issues = *context.Issues
+		graphQL = *context.GraphQL
+	})
+
+	queryContaining := func(text string) interface{} {
+		return mock.MatchedBy(func(query string) bool { return strings.Contains(query, text) })
+	}
+
+	Describe("!rerun-checks comment", func() {
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEventWithLabels("!rerun-checks", arbitraryIssueAuthor, []string{grh.MergingLabel})
+		})
+
+		BeforeEach(func() {
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+				Return(&github.PullRequest{
+					Number: github.Int(issueNumber),
+					Base: &github.PullRequestBranch{
+						Ref:  github.String("master"),
+						Repo: repository,
+					},
+					Head: &github.PullRequestBranch{
+						SHA:  github.String(headSHA),
+						Repo: repository,
+					},
+				}, emptyResponse, noError)
+		})
+
+		mockCheckSuites := func(conclusions map[string]string) {
+			nodes := []interface{}{}
+			for id, conclusion := range conclusions {
+				nodes = append(nodes, map[string]interface{}{
+					"id":         id,
+					"conclusion": conclusion,
+					"app":        map[string]string{"name": "CI " + id},
+				})
+			}
+			result, err := json.Marshal(map[string]interface{}{
+				"repository": map[string]interface{}{
+					"id":     "repository-id",
+					"object": map[string]interface{}{"checkSuites": map[string]interface{}{"nodes": nodes}},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			graphQL.
+				On("Query", anyContext, queryContaining("checkSuites("), mock.Anything, mock.Anything).
+				Return(noError).
+				Run(func(args mock.Arguments) {
+					Expect(json.Unmarshal(result, args.Get(3))).To(Succeed())
+				})
+		}
+
+		Context("with failed check suites", func() {
+			BeforeEach(func() {
+				mockCheckSuites(map[string]string{"flaky": "FAILURE", "stable": "SUCCESS"})
+				graphQL.
+					On("Query", anyContext, queryContaining("rerequestCheckSuite"), map[string]interface{}{
+						"repositoryId": "repository-id",
+						"checkSuiteId": "flaky",
+					}, mock.Anything).
+					Return(noError)
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("`CI flaky`"))).
+					Return(emptyResult, emptyResponse, noError)
+			})
+
+			It("re-requests only the failed suites and keeps the PR in the merge queue", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				graphQL.AssertNumberOfCalls(GinkgoT(), "Query", 2)
+
+				reruns, err := store.PendingReruns()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(reruns).To(HaveLen(1))
+				Expect(reruns[0].HeadSHA).To(Equal(headSHA))
+				Expect(reruns[0].CheckSuiteIDs).To(Equal([]string{"flaky"}))
+			})
+		})
+
+		Context("without failed check suites", func() {
+			BeforeEach(func() {
+				mockCheckSuites(map[string]string{"stable": "SUCCESS"})
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("nothing to rerun"))).
+					Return(emptyResult, emptyResponse, noError)
+			})
+
+			It("reports that there's nothing to rerun", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(store.PendingReruns()).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("check_suite event", func() {
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "check_suite",
+			}
+		})
+		requestJSON.Is(func() string {
+			return `{
+  "action": "completed",
+  "check_suite": {
+    "node_id": "flaky",
+    "head_sha": "` + headSHA + `",
+    "conclusion": "success"
+  },
+  "repository": {
+    "name": "` + repositoryName + `",
+    "owner": {
+      "login": "` + repositoryOwner + `"
+    },
+    "ssh_url": "` + sshURL + `"
+  }
+}`
+		})
+
+		Context("with the last re-requested suite completing", func() {
+			BeforeEach(func() {
+				Expect(store.SetPendingRerun(grh.PendingRerun{Issue: issue, HeadSHA: headSHA,
+					CheckSuiteIDs: []string{"flaky"}})).To(Succeed())
+				mockLabels(issues, issueNumber)
+			})
+
+			It("stops tracking the rerun and evaluates the PR for merging", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(responseRecorder.Body.String()).To(ContainSubstring("no longer labeled"))
+				Expect(store.PendingReruns()).To(BeEmpty())
+			})
+		})
+
+		Context("with other re-requested suites still running", func() {
+			BeforeEach(func() {
+				Expect(store.SetPendingRerun(grh.PendingRerun{Issue: issue, HeadSHA: headSHA,
+					CheckSuiteIDs: []string{"flaky", "slow"}})).To(Succeed())
+			})
+
+			It("keeps waiting for them", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				reruns, err := store.PendingReruns()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(reruns).To(HaveLen(1))
+				Expect(reruns[0].CheckSuiteIDs).To(Equal([]string{"slow"}))
+			})
+		})
+	})
+})
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"sync"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/git"
+)
+
+// resourceLimitWaits counts the operations that had to wait for a slot, by
+// the limiter's name. Reported by /debug/vars.
+var resourceLimitWaits = expvar.NewMap("resource_limit_waits")
+
+// ResourceLimiter limits how many operations of a kind, e.g. git operations,
+// run at once, both per repository and in total. An operation takes its
+// repository's slot before a global one, so that the operations of a busy
+// repository, which mostly wait for each other anyway, wouldn't hold the
+// global slots the other repositories could use.
+type ResourceLimiter struct {
+	mutex         sync.Mutex
+	name          string
+	perRepository int
+	global        chan struct{}
+	repositories  map[string]chan struct{}
+}
+
+// NewResourceLimiter creates a ResourceLimiter running at most perRepository
+// operations of a repository and at most global operations in total at a
+// time. 0 means no limit. The waits are counted under the name.
+func NewResourceLimiter(name string, perRepository, global int) *ResourceLimiter {
+	limiter := &ResourceLimiter{
+		name:          name,
+		perRepository: perRepository,
+		repositories:  make(map[string]chan struct{}),
+	}
+	if global > 0 {
+		limiter.global = make(chan struct{}, global)
+	}
+	return limiter
+}
+
+// Run runs the operation on behalf of the repository once both a slot of the
+// repository and a global slot are available.
+func (l *ResourceLimiter) Run(repository Repository, operation func()) {
+	repositorySlots := l.repositorySlots(repositoryKey(repository))
+	l.acquire(repositorySlots)
+	defer l.release(repositorySlots)
+	l.acquire(l.global)
+	defer l.release(l.global)
+	operation()
+}
+
+func (l *ResourceLimiter) repositorySlots(key string) chan struct{} {
+	if l.perRepository == 0 {
+		return nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	slots, exists := l.repositories[key]
+	if !exists {
+		slots = make(chan struct{}, l.perRepository)
+		l.repositories[key] = slots
+	}
+	return slots
+}
+
+func (l *ResourceLimiter) acquire(slots chan struct{}) {
+	if slots == nil {
+		return
+	}
+	select {
+	case slots <- struct{}{}:
+	default:
+		resourceLimitWaits.Add(l.name, 1)
+		slots <- struct{}{}
+	}
+}
+
+func (l *ResourceLimiter) release(slots chan struct{}) {
+	if slots != nil {
+		<-slots
+	}
+}
+
+// limitResources wraps the clients, so that their git operations and merges
+// would run within the configured concurrency limits.
+func limitResources(conf Config, gitRepos git.Repos, pullRequests PullRequests) (git.Repos, PullRequests) {
+	gitLimiter := NewResourceLimiter("git", conf.MaxRepoGitOperations, conf.MaxGitOperations)
+	mergeLimiter := NewResourceLimiter("merge", conf.MaxRepoMerges, conf.MaxMerges)
+	return limitedRepos{gitLimiter, gitRepos}, limitedPullRequests{mergeLimiter, pullRequests}
+}
+
+type limitedPullRequests struct {
+	limiter *ResourceLimiter
+	PullRequests
+}
+
+func (l limitedPullRequests) Merge(ctx context.Context, owner, repo string, number int, commitMessage string,
+	opt *github.PullRequestOptions) (result *github.PullRequestMergeResult, resp *github.Response, err error) {
+
+	l.limiter.Run(Repository{Owner: owner, Name: repo}, func() {
+		result, resp, err = l.PullRequests.Merge(ctx, owner, repo, number, commitMessage, opt)
+	})
+	return result, resp, err
+}
+
+type limitedRepos struct {
+	limiter *ResourceLimiter
+	git.Repos
+}
+
+func (l limitedRepos) GetUpdatedRepo(url, repoOwner, repoName string) (repo git.Repo, err error) {
+	repository := Repository{Owner: repoOwner, Name: repoName}
+	l.limiter.Run(repository, func() {
+		repo, err = l.Repos.GetUpdatedRepo(url, repoOwner, repoName)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return limitedRepo{l.limiter, repository, repo}, nil
+}
+
+func (l limitedRepos) WithContext(ctx context.Context) git.Repos {
+	return limitedRepos{l.limiter, l.Repos.WithContext(ctx)}
+}
+
+type limitedRepo struct {
+	limiter    *ResourceLimiter
+	repository Repository
+	git.Repo
+}
+
+func (l limitedRepo) Fetch() (err error) {
+	l.limiter.Run(l.repository, func() { err = l.Repo.Fetch() })
+	return err
+}
+
+func (l limitedRepo) FetchRemote(name, url string) (err error) {
+	l.limiter.Run(l.repository, func() { err = l.Repo.FetchRemote(name, url) })
+	return err
+}
+
+func (l limitedRepo) AutosquashAndPush(upstreamRef, branchRef, remote, destinationRef string) (err error) {
+	l.limiter.Run(l.repository, func() {
+		err = l.Repo.AutosquashAndPush(upstreamRef, branchRef, remote, destinationRef)
+	})
+	return err
+}
+
+func (l limitedRepo) SquashAndPush(upstreamRef, branchRef string, count int, message, remote,
+	destinationRef string) (err error) {
+
+	l.limiter.Run(l.repository, func() {
+		err = l.Repo.SquashAndPush(upstreamRef, branchRef, count, message, remote, destinationRef)
+	})
+	return err
+}
+
+func (l limitedRepo) RebaseAndPush(upstreamRef, branchRef, remote, destinationRef string) (sha string, err error) {
+	l.limiter.Run(l.repository, func() {
+		sha, err = l.Repo.RebaseAndPush(upstreamRef, branchRef, remote, destinationRef)
+	})
+	return sha, err
+}
+
+func (l limitedRepo) RebaseOntoAndPush(upstreamRef, oldBaseRef, branchRef, remote,
+	destinationRef string) (sha string, err error) {
+
+	l.limiter.Run(l.repository, func() {
+		sha, err = l.Repo.RebaseOntoAndPush(upstreamRef, oldBaseRef, branchRef, remote, destinationRef)
+	})
+	return sha, err
+}
+
+func (l limitedRepo) CherryPickAndPush(upstreamRef, commit, remote, destinationRef string) (err error) {
+	l.limiter.Run(l.repository, func() {
+		err = l.Repo.CherryPickAndPush(upstreamRef, commit, remote, destinationRef)
+	})
+	return err
+}
+
+func (l limitedRepo) CherryPickOntoBranch(commits []string, remote, branch string) (shas []string, err error) {
+	l.limiter.Run(l.repository, func() { shas, err = l.Repo.CherryPickOntoBranch(commits, remote, branch) })
+	return shas, err
+}
+
+func (l limitedRepo) RevertAndPush(upstreamRef, commit, remote, destinationRef string) (err error) {
+	l.limiter.Run(l.repository, func() {
+		err = l.Repo.RevertAndPush(upstreamRef, commit, remote, destinationRef)
+	})
+	return err
+}
+
+func (l limitedRepo) Push(ref, remote, destinationRef string) (err error) {
+	l.limiter.Run(l.repository, func() { err = l.Repo.Push(ref, remote, destinationRef) })
+	return err
+}
+
+func (l limitedRepo) ForcePush(ref, remote, destinationRef string) (err error) {
+	l.limiter.Run(l.repository, func() { err = l.Repo.ForcePush(ref, remote, destinationRef) })
+	return err
+}
+
+func (l limitedRepo) DeleteRemoteBranch(remoteRef string) (err error) {
+	l.limiter.Run(l.repository, func() { err = l.Repo.DeleteRemoteBranch(remoteRef) })
+	return err
+}
+
+func (l limitedRepo) RunCommand(ref, command string, env []string) (err error) {
+	l.limiter.Run(l.repository, func() { err = l.Repo.RunCommand(ref, command, env) })
+	return err
+}
@@ -0,0 +1,76 @@
+package main_test
+
+import (
+	"sync"
+	"sync/atomic"
+
+	grh "github.com/salemove/github-review-helper"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ResourceLimiter", func() {
+	var (
+		monorepo = grh.Repository{Owner: "salemove", Name: "monorepo"}
+		api      = grh.Repository{Owner: "salemove", Name: "api"}
+
+		limiter *grh.ResourceLimiter
+		running int64
+		wg      sync.WaitGroup
+		release chan struct{}
+	)
+
+	BeforeEach(func() {
+		limiter = grh.NewResourceLimiter("test", 1, 2)
+		running = 0
+		release = make(chan struct{})
+	})
+
+	// Runs an operation that holds its slots until release is closed
+	start := func(repository grh.Repository) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limiter.Run(repository, func() {
+				atomic.AddInt64(&running, 1)
+				<-release
+			})
+		}()
+	}
+
+	currentlyRunning := func() int64 {
+		return atomic.LoadInt64(&running)
+	}
+
+	It("doesn't let a busy repository take the global slots of others", func() {
+		start(monorepo)
+		start(monorepo)
+		start(monorepo)
+		Eventually(currentlyRunning).Should(Equal(int64(1)))
+
+		start(api)
+		Eventually(currentlyRunning).Should(Equal(int64(2)))
+		Consistently(currentlyRunning).Should(Equal(int64(2)))
+
+		close(release)
+		wg.Wait()
+		Expect(currentlyRunning()).To(Equal(int64(4)))
+	})
+
+	Context("without limits", func() {
+		BeforeEach(func() {
+			limiter = grh.NewResourceLimiter("test", 0, 0)
+		})
+
+		It("runs everything at once", func() {
+			start(monorepo)
+			start(monorepo)
+			start(api)
+			Eventually(currentlyRunning).Should(Equal(int64(3)))
+
+			close(release)
+			wg.Wait()
+		})
+	})
+})
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/salemove/github-review-helper/git"
+)
+
+const orphanedPRsQuery = `query($owner: String!, $name: String!, $branch: String!) {
+  repository(owner: $owner, name: $name) {
+    orphaned: pullRequests(states: OPEN, baseRefName: $branch, first: 100) {
+      nodes {
+        id
+        number
+      }
+    }
+    merged: pullRequests(states: MERGED, headRefName: $branch, first: 1,
+        orderBy: {field: UPDATED_AT, direction: DESC}) {
+      nodes {
+        number
+        baseRefName
+      }
+    }
+  }
+}`
+
+// retargetOrphanedPRs retargets the open PRs whose base branch was deleted
+// after the branch's own PR was merged to the base branch of the merged PR,
+// if RETARGET_PRS is enabled. GitHub doesn't always do that itself, so the
+// PRs it hasn't already retargeted or closed are retargeted through the API.
+// The PRs are checked again once GitHub reports them as edited.
+func retargetOrphanedPRs(conf Config, repository Repository, branch string, graphQL GraphQL) Response {
+	if !conf.RetargetPRs {
+		return SuccessResponse{"Not retargeting PRs. Ignoring the deleted branch."}
+	}
+	var result struct {
+		Repository struct {
+			Orphaned struct {
+				Nodes []struct {
+					ID     string `json:"id"`
+					Number int    `json:"number"`
+				} `json:"nodes"`
+			} `json:"orphaned"`
+			Merged struct {
+				Nodes []struct {
+					Number      int    `json:"number"`
+					BaseRefName string `json:"baseRefName"`
+				} `json:"nodes"`
+			} `json:"merged"`
+		} `json:"repository"`
+	}
+	err := graphQL.Query(context.TODO(), orphanedPRsQuery, map[string]interface{}{
+		"owner":  repository.Owner,
+		"name":   repository.Name,
+		"branch": branch,
+	}, &result)
+	if err != nil {
+		message := fmt.Sprintf("Failed to list the PRs based on %s in %s", branch, repositoryKey(repository))
+		return ErrorResponse{err, http.StatusBadGateway, message}
+	} else if len(result.Repository.Merged.Nodes) == 0 {
+		return SuccessResponse{fmt.Sprintf("%s isn't the head branch of a merged PR. Not retargeting the PRs "+
+			"based on it.", branch)}
+	}
+	merged := result.Repository.Merged.Nodes[0]
+	retargeted := 0
+	for _, orphaned := range result.Repository.Orphaned.Nodes {
+		issue := Issue{Number: orphaned.Number, Repository: repository}
+		var mutationResult struct{}
+		err = graphQL.Query(context.TODO(), retargetPullRequestMutation, map[string]interface{}{
+			"pullRequestId": orphaned.ID,
+			"baseRefName":   merged.BaseRefName,
+		}, &mutationResult)
+		if err != nil {
+			log.Printf("Failed to retarget PR %s to %s: %v\n", issue.FullName(), merged.BaseRefName, err)
+			continue
+		}
+		log.Printf("Retargeted PR %s from the deleted %s to %s.\n", issue.FullName(), branch, merged.BaseRefName)
+		retargeted++
+	}
+	return SuccessResponse{fmt.Sprintf("Retargeted %d of the %d PRs based on the deleted %s to %s", retargeted,
+		len(result.Repository.Orphaned.Nodes), branch, merged.BaseRefName)}
+}
+
+// handleBaseBranchChanged checks a PR labeled with "merging" again after it
+// was retargeted, because its mergeability, statuses and gates depend on its
+// base branch. GitHub checks the PR for conflicts with its new base branch
+// asynchronously, so the check is retried until GitHub has done that.
+func handleBaseBranchChanged(conf Config, pullRequestEvent PullRequestEvent, retry retryGithubOperation,
+	gitRepos git.Repos, store Store, issues Issues, pullRequests PullRequests, repositories Repositories,
+	graphQL GraphQL) Response {
+
+	issue := pullRequestEvent.Issue()
+	log.Printf("PR %s was retargeted from %s to %s.\n", issue.FullName(), pullRequestEvent.PreviousBaseRef,
+		pullRequestEvent.Base.Ref)
+	if !pullRequestEvent.HasLabel(MergingLabel) {
+		return SuccessResponse{fmt.Sprintf("PR %s isn't labeled with '%s'. Not checking it again.",
+			issue.FullName(), MergingLabel)}
+	}
+	maybeSyncResponse := retry(issue.Repository, func() asyncResponse {
+		pr, errResp := getPR(issue, pullRequests)
+		if errResp != nil {
+			return retriable(errResp)
+		} else if pr.Mergeable == nil {
+			return retriable(SuccessResponse{fmt.Sprintf("GitHub hasn't checked PR %s for conflicts with %s yet",
+				issue.FullName(), pullRequestEvent.Base.Ref)})
+		} else if !*pr.Mergeable && conf.ConflictWatchdog {
+			if errResp = notifyConflict(pr, store, issues); errResp != nil {
+				return nonRetriable(errResp)
+			}
+		}
+		return nonRetriable(mergeIfReady(conf, issue, false, store, issues, pullRequests, repositories, graphQL,
+			gitRepos))
+	})
+	if maybeSyncResponse.OperationFinishedSynchronously {
+		return maybeSyncResponse.Response
+	}
+	return SuccessResponse{fmt.Sprintf("Will check PR %s against %s asynchronously", issue.FullName(),
+		pullRequestEvent.Base.Ref)}
+}
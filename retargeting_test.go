@@ -0,0 +1,201 @@
+package main_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	var (
+		handle      = context.Handle
+		headers     = context.Headers
+		requestJSON = context.RequestJSON
+
+		responseRecorder *httptest.ResponseRecorder
+		pullRequests     *mocks.PullRequests
+		issues           *mocks.Issues
+		graphQL          *mocks.GraphQL
+	)
+	BeforeEach(func() {
+		responseRecorder = *context.ResponseRecorder
+		pullRequests = *context.PullRequests
+		issues = *context.Issues
+		graphQL = *context.GraphQL
+	})
+
+	queryContaining := func(text string) interface{} {
+		return mock.MatchedBy(func(query string) bool {
+			return strings.Contains(query, text)
+		})
+	}
+
+	Describe("push event deleting a branch", func() {
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "push",
+			}
+		})
+		requestJSON.Is(func() string {
+			return `{
+  "ref": "refs/heads/feature",
+  "before": "1111",
+  "after": "0000000000000000000000000000000000000000",
+  "deleted": true,
+  "repository": {
+    "name": "` + repositoryName + `",
+    "owner": {
+      "login": "` + repositoryOwner + `"
+    },
+    "ssh_url": "` + sshURL + `"
+  }
+}`
+		})
+
+		It("ignores the deletion without RETARGET_PRS", func() {
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			Expect(responseRecorder.Body.String()).To(ContainSubstring("Not retargeting PRs"))
+		})
+
+		Context("with RETARGET_PRS", func() {
+			var retargeted []map[string]interface{}
+
+			BeforeEach(func() {
+				context.Config.RetargetPRs = true
+				retargeted = nil
+				graphQL.
+					On("Query", anyContext, queryContaining("updatePullRequest("), mock.Anything, mock.Anything).
+					Return(noError).
+					Run(func(args mock.Arguments) {
+						retargeted = append(retargeted, args.Get(2).(map[string]interface{}))
+					})
+			})
+
+			mockPRs := func(data string) {
+				graphQL.
+					On("Query", anyContext, queryContaining("orphaned: pullRequests("), mock.Anything, mock.Anything).
+					Return(noError).
+					Run(func(args mock.Arguments) {
+						Expect(args.Get(2)).To(HaveKeyWithValue("branch", "feature"))
+						Expect(json.Unmarshal([]byte(data), args.Get(3))).To(Succeed())
+					})
+			}
+
+			Context("with the branch of a merged PR", func() {
+				BeforeEach(func() {
+					mockPRs(`{"repository": {
+  "orphaned": {"nodes": [{"id": "pr-id", "number": 8}]},
+  "merged": {"nodes": [{"number": 7, "baseRefName": "master"}]}
+}}`)
+				})
+
+				It("retargets the PRs based on it to the merged PR's base branch", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					Expect(responseRecorder.Body.String()).To(ContainSubstring("Retargeted 1 of the 1 PRs"))
+					Expect(retargeted).To(Equal([]map[string]interface{}{
+						{"pullRequestId": "pr-id", "baseRefName": "master"},
+					}))
+				})
+			})
+
+			Context("with a branch that wasn't merged", func() {
+				BeforeEach(func() {
+					mockPRs(`{"repository": {
+  "orphaned": {"nodes": [{"id": "pr-id", "number": 8}]},
+  "merged": {"nodes": []}
+}}`)
+				})
+
+				It("leaves the PRs based on it alone", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					Expect(responseRecorder.Body.String()).To(ContainSubstring("isn't the head branch of a merged PR"))
+					Expect(retargeted).To(BeEmpty())
+				})
+			})
+		})
+	})
+
+	Describe("pull_request event changing the base branch", func() {
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "pull_request",
+			}
+		})
+
+		retargetedEvent := func(labels ...string) string {
+			event := LabeledPullRequestEvent("edited", "1235", grh.Repository{
+				Owner: repositoryOwner,
+				Name:  repositoryName,
+				URL:   sshURL,
+			}, labels...)
+			return strings.Replace(event, `"action": "edited",`, `"action": "edited",
+  "changes": {"base": {"ref": {"from": "feature"}}},`, 1)
+		}
+
+		Context("with a PR that isn't labeled for merging", func() {
+			requestJSON.Is(func() string {
+				return retargetedEvent()
+			})
+
+			It("doesn't check the PR again", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(responseRecorder.Body.String()).To(ContainSubstring("Not checking it again"))
+				pullRequests.AssertNotCalled(GinkgoT(), "Get", anyContext, repositoryOwner, repositoryName,
+					issueNumber)
+			})
+		})
+
+		Context("with a PR labeled for merging", func() {
+			requestJSON.Is(func() string {
+				return retargetedEvent(grh.MergingLabel)
+			})
+
+			BeforeEach(func() {
+				context.Config.ConflictWatchdog = true
+				pr := func(mergeable *bool) *github.PullRequest {
+					return &github.PullRequest{
+						Number:    github.Int(issueNumber),
+						Merged:    github.Bool(false),
+						Mergeable: mergeable,
+						User:      &github.User{Login: github.String(arbitraryIssueAuthor)},
+						Base:      &github.PullRequestBranch{Ref: github.String("master"), Repo: repository},
+						Head:      &github.PullRequestBranch{SHA: github.String("1235"), Repo: repository},
+					}
+				}
+				pullRequests.
+					On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+					Return(pr(nil), emptyResponse, noError).
+					Once()
+				pullRequests.
+					On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+					Return(pr(github.Bool(false)), emptyResponse, noError)
+			})
+
+			It("checks the PR against its new base branch once GitHub has", func() {
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("this PR has a merge conflict with `master`"))).
+					Return(emptyResult, emptyResponse, noError).
+					Once()
+
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(responseRecorder.Body.String()).To(ContainSubstring("has a merge conflict. Not merging."))
+				issues.AssertExpectations(GinkgoT())
+			})
+		})
+	})
+})
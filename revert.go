@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/git"
+)
+
+func isRevertCommand(comment string) bool {
+	_, isRevert := parseRevertCommand(comment)
+	return isRevert
+}
+
+// parseRevertCommand parses a "!revert" command and returns whether the
+// revert PR should be merged once it's green, which is asked for with
+// "!revert merge".
+func parseRevertCommand(comment string) (bool, bool) {
+	fields := strings.Fields(comment)
+	if len(fields) == 1 && fields[0] == "!revert" {
+		return false, true
+	} else if len(fields) == 2 && fields[0] == "!revert" && fields[1] == "merge" {
+		return true, true
+	}
+	return false, false
+}
+
+// handleRevertCommand opens a PR reverting the merged PR. The PR's merge
+// commit is reverted relative to its first parent, so that both merged and
+// squashed PRs are reverted as a whole.
+func handleRevertCommand(conf Config, issueComment IssueComment, store Store, gitRepos git.Repos,
+	pullRequests PullRequests, issues Issues) Response {
+
+	issue := issueComment.Issue()
+	mergeRevert, _ := parseRevertCommand(issueComment.Comment)
+	reply := func(message string) error {
+		return comment(fmt.Sprintf("@%s, %s", issueComment.Commenter.Login, message), issue.Repository,
+			issue.Number, issues)
+	}
+	pr, errResp := getPR(issueComment, pullRequests)
+	if errResp != nil {
+		return errResp
+	} else if !pr.GetMerged() || pr.MergeCommitSHA == nil {
+		if err := reply("I can only revert merged PRs."); err != nil {
+			message := fmt.Sprintf("Failed to respond to reverting unmerged PR %s", issue.FullName())
+			return ErrorResponse{err, http.StatusBadGateway, message}
+		}
+		return SuccessResponse{fmt.Sprintf("PR %s hasn't been merged. Responded with a comment.", issue.FullName())}
+	}
+
+	base := *pr.Base.Ref
+	branch, err := createBotBranchName(conf, store, issue.Repository, revertBranchKind, issue.Number, base)
+	if err != nil {
+		return ErrorResponse{err, http.StatusInternalServerError, "Failed to name the revert branch"}
+	}
+	gitRepo, err := gitRepos.GetUpdatedRepo(issue.Repository.URL, issue.Repository.Owner, issue.Repository.Name)
+	if git.IsDiskFull(err) {
+		return replyDiskFull(issue.Repository, err, reply)
+	} else if err != nil {
+		message := fmt.Sprintf("Failed to get an updated repo for PR %s", issue.FullName())
+		return ErrorResponse{err, gitErrorCode(err), message}
+	}
+	log.Printf("Reverting PR %s on top of %s in branch %s.\n", issue.FullName(), base, branch)
+	err = gitRepo.RevertAndPush("origin/"+base, *pr.MergeCommitSHA, "origin", branch)
+	if _, ok := err.(*git.ErrCherryPickConflict); ok {
+		if err = reply(fmt.Sprintf("I couldn't revert this PR, because the latest `%s` conflicts with the revert. "+
+			"Please revert it manually.", base)); err != nil {
+			message := fmt.Sprintf("Failed to report the conflicting revert of PR %s", issue.FullName())
+			return ErrorResponse{err, http.StatusBadGateway, message}
+		}
+		return SuccessResponse{fmt.Sprintf("Reverting PR %s conflicted. Responded with a comment.",
+			issue.FullName())}
+	} else if err != nil {
+		message := fmt.Sprintf("Failed to revert PR %s", issue.FullName())
+		return ErrorResponse{err, gitErrorCode(err), message}
+	}
+
+	revertPR, _, err := pullRequests.Create(context.TODO(), issue.Repository.Owner, issue.Repository.Name,
+		&github.NewPullRequest{
+			Title: github.String(fmt.Sprintf("Revert #%d", issue.Number)),
+			Head:  github.String(branch),
+			Base:  github.String(base),
+			Body: github.String(fmt.Sprintf("Reverts #%d, as requested by @%s.", issue.Number,
+				issueComment.Commenter.Login)),
+		})
+	if err != nil {
+		message := fmt.Sprintf("Failed to open a PR reverting PR %s", issue.FullName())
+		return ErrorResponse{err, http.StatusBadGateway, message}
+	}
+	if err = trackBotBranchPR(store, issue.Repository, branch, revertPR.GetNumber()); err != nil {
+		log.Printf("Failed to track the PR of revert branch %s: %v\n", branch, err)
+	}
+	message := fmt.Sprintf("I opened #%d to revert this PR.", revertPR.GetNumber())
+	if mergeRevert {
+		if errResp = addLabel(issue.Repository, revertPR.GetNumber(), MergingLabel, issues); errResp != nil {
+			return errResp
+		}
+		message = fmt.Sprintf("I opened #%d to revert this PR. I'll merge it once it's green.",
+			revertPR.GetNumber())
+	}
+	if err = reply(message); err != nil {
+		errorMessage := fmt.Sprintf("Failed to link the revert of PR %s", issue.FullName())
+		return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	return SuccessResponse{fmt.Sprintf("Opened PR #%d reverting PR %s", revertPR.GetNumber(), issue.FullName())}
+}
@@ -0,0 +1,189 @@
+package main_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/git"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("!revert comment", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			store            grh.Store
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+			gitRepos         *mocks.Repos
+			gitRepo          *mocks.Repo
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			store = *context.Store
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+			gitRepos = *context.GitRepos
+			gitRepo = new(mocks.Repo)
+
+			context.Config.BotBranchTemplate = "bot/{kind}/{pr}-{target}"
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+
+		mergeCommitSHA := "abc123"
+		branchName := "bot/revert/7-master"
+		revertPRNumber := 8
+
+		mockPR := func(merged bool) {
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+				Return(&github.PullRequest{
+					Number:         github.Int(issueNumber),
+					Merged:         github.Bool(merged),
+					MergeCommitSHA: github.String(mergeCommitSHA),
+					Base: &github.PullRequestBranch{
+						SHA:  github.String("1234"),
+						Ref:  github.String("master"),
+						Repo: repository,
+					},
+					Head: &github.PullRequestBranch{
+						SHA:  github.String("1235"),
+						Ref:  github.String("feature"),
+						Repo: repository,
+					},
+				}, emptyResponse, noError)
+		}
+
+		mockRevert := func(err error) {
+			gitRepos.
+				On("GetUpdatedRepo", sshURL, repositoryOwner, repositoryName).
+				Return(gitRepo, noError)
+			gitRepo.
+				On("RevertAndPush", "origin/master", mergeCommitSHA, "origin", branchName).
+				Return(err)
+		}
+
+		mockCreatePR := func() {
+			pullRequests.
+				On("Create", anyContext, repositoryOwner, repositoryName, &github.NewPullRequest{
+					Title: github.String("Revert #7"),
+					Head:  github.String(branchName),
+					Base:  github.String("master"),
+					Body:  github.String("Reverts #7, as requested by @" + arbitraryIssueAuthor + "."),
+				}).
+				Return(&github.PullRequest{Number: github.Int(revertPRNumber)}, emptyResponse, noError)
+		}
+
+		BeforeEach(func() {
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+		})
+
+		Context("with a !revert command", func() {
+			requestJSON.Is(func() string {
+				return IssueCommentEvent("!revert", arbitraryIssueAuthor)
+			})
+
+			Context("on a merged PR", func() {
+				BeforeEach(func() {
+					mockPR(true)
+				})
+
+				It("opens a revert PR and links it back", func() {
+					mockRevert(noError)
+					mockCreatePR()
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("I opened #8 to revert this PR."))).
+						Return(emptyResult, emptyResponse, noError)
+
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					gitRepo.AssertExpectations(GinkgoT())
+					pullRequests.AssertExpectations(GinkgoT())
+					issues.AssertExpectations(GinkgoT())
+
+					branches, err := store.BotBranches(grh.Repository{Owner: repositoryOwner, Name: repositoryName})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(branches).To(HaveLen(1))
+					Expect(branches[0].Kind).To(Equal("revert"))
+					Expect(branches[0].PullRequest).To(Equal(revertPRNumber))
+				})
+
+				It("reports a conflicting revert", func() {
+					mockRevert(&git.ErrCherryPickConflict{Err: errors.New("conflict")})
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("I couldn't revert this PR"))).
+						Return(emptyResult, emptyResponse, noError)
+
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertExpectations(GinkgoT())
+				})
+			})
+
+			Context("on an unmerged PR", func() {
+				BeforeEach(func() {
+					mockPR(false)
+				})
+
+				It("says so", func() {
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("I can only revert merged PRs."))).
+						Return(emptyResult, emptyResponse, noError)
+
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertExpectations(GinkgoT())
+				})
+			})
+		})
+
+		Context("with a !revert merge command", func() {
+			requestJSON.Is(func() string {
+				return IssueCommentEvent("!revert merge", arbitraryIssueAuthor)
+			})
+
+			BeforeEach(func() {
+				mockPR(true)
+				mockRevert(noError)
+				mockCreatePR()
+			})
+
+			It("labels the revert PR for merging", func() {
+				issues.
+					On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, revertPRNumber, []string{grh.MergingLabel}).
+					Return(emptyResult, emptyResponse, noError)
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("I'll merge it once it's green"))).
+					Return(emptyResult, emptyResponse, noError)
+
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+			})
+		})
+	})
+})
@@ -0,0 +1,144 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var ReviewCommentEvent = func(action, comment, commenter string) string {
+	return `{
+  "action": "` + action + `",
+  "comment": {
+    "node_id": "` + commentNodeID + `",
+    "body": "` + comment + `",
+    "user": {
+      "login": "` + commenter + `"
+    }
+  },
+  "pull_request": {
+    "number": ` + strconv.Itoa(issueNumber) + `,
+    "labels": [],
+    "user": {
+      "login": "` + commenter + `"
+    }
+  },
+  "repository": {
+    "name": "` + repositoryName + `",
+    "owner": {
+      "login": "` + repositoryOwner + `"
+    },
+    "ssh_url": "` + sshURL + `"
+  }
+}`
+}
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("pull_request_review event with a command in the review", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			issues           *mocks.Issues
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			issues = *context.Issues
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "pull_request_review",
+			}
+		})
+
+		requestJSON.Is(func() string {
+			// The reviewer is the PR's author as well, because ForCollaborator
+			// only sets up the one user
+			event := strings.Replace(PullRequestReviewEvent("submitted", "approved", []string{"bug"}),
+				`"login": "`+arbitraryIssueAuthor+`"`, `"login": "reviewer"`, 1)
+			return strings.Replace(event, `"state": "approved",`, `"state": "approved", "body": "!hold",`, 1)
+		})
+
+		ForCollaborator(context, repositoryOwner, repositoryName, "reviewer", func() {
+			BeforeEach(func() {
+				issues.
+					On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+						[]string{grh.OnHoldLabel}).
+					Return(emptyResult, emptyResponse, noError)
+			})
+
+			It("handles the command", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertCalled(GinkgoT(), "AddLabelsToIssue", anyContext, repositoryOwner, repositoryName,
+					issueNumber, []string{grh.OnHoldLabel})
+			})
+		})
+	})
+
+	Describe("pull_request_review_comment event", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			issues           *mocks.Issues
+
+			action string
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			issues = *context.Issues
+			action = "created"
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "pull_request_review_comment",
+			}
+		})
+
+		requestJSON.Is(func() string {
+			return ReviewCommentEvent(action, "!hold", "procoder")
+		})
+
+		ForCollaborator(context, repositoryOwner, repositoryName, "procoder", func() {
+			BeforeEach(func() {
+				issues.
+					On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+						[]string{grh.OnHoldLabel}).
+					Return(emptyResult, emptyResponse, noError)
+			})
+
+			It("handles the command", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertCalled(GinkgoT(), "AddLabelsToIssue", anyContext, repositoryOwner, repositoryName,
+					issueNumber, []string{grh.OnHoldLabel})
+			})
+		})
+
+		Context("with the comment being deleted", func() {
+			BeforeEach(func() {
+				action = "deleted"
+			})
+
+			It("succeeds with 'ignored' response", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(responseRecorder.Body.String()).To(ContainSubstring("Ignoring"))
+			})
+		})
+	})
+})
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+func isWhoseTurnCommand(comment string) bool {
+	return strings.TrimSpace(comment) == "!whose-turn"
+}
+
+// reviewerLoad summarizes a reviewer's tracked review requests.
+type reviewerLoad struct {
+	Login        string
+	OpenRequests int
+	Reviews      int
+	// TotalResponseTime is the sum of the response times of Reviews
+	TotalResponseTime time.Duration
+}
+
+func (l reviewerLoad) averageResponseTime() time.Duration {
+	if l.Reviews == 0 {
+		return 0
+	}
+	return l.TotalResponseTime / time.Duration(l.Reviews)
+}
+
+// reviewerLoads calculates the loads of the reviewers of the given requests.
+// Only the reviews given after since count towards the response times.
+func reviewerLoads(requests []ReviewRequest, since time.Time) map[string]*reviewerLoad {
+	loads := make(map[string]*reviewerLoad)
+	for _, request := range requests {
+		load, exists := loads[request.Reviewer]
+		if !exists {
+			load = &reviewerLoad{Login: request.Reviewer}
+			loads[request.Reviewer] = load
+		}
+		if request.Pending() {
+			load.OpenRequests++
+		} else if !request.RespondedAt.Before(since) {
+			load.Reviews++
+			load.TotalResponseTime += request.RespondedAt.Sub(request.RequestedAt)
+		}
+	}
+	return loads
+}
+
+// lessLoaded orders reviewers by their number of open requests. Ties are
+// broken by preferring quicker reviewers, with reviewers who haven't reviewed
+// anything yet considered the slowest.
+func lessLoaded(a, b reviewerLoad) bool {
+	if a.OpenRequests != b.OpenRequests {
+		return a.OpenRequests < b.OpenRequests
+	} else if (a.Reviews == 0) != (b.Reviews == 0) {
+		return a.Reviews != 0
+	} else if a.averageResponseTime() != b.averageResponseTime() {
+		return a.averageResponseTime() < b.averageResponseTime()
+	}
+	return a.Login < b.Login
+}
+
+func handleWhoseTurnCommand(conf Config, issueComment IssueComment, store Store, issues Issues) Response {
+	issue := issueComment.Issue()
+	requests, err := store.ReviewRequests(issue.Repository)
+	if err != nil {
+		return ErrorResponse{err, http.StatusInternalServerError, "Failed to list the tracked review requests"}
+	}
+	loads := reviewerLoads(requests, time.Time{})
+	candidates := conf.Reviewers
+	if len(candidates) == 0 {
+		for login := range loads {
+			candidates = append(candidates, login)
+		}
+	}
+	var suggestion *reviewerLoad
+	for _, login := range candidates {
+		if login == issue.User.Login {
+			continue
+		}
+		load := reviewerLoad{Login: login}
+		if trackedLoad, exists := loads[login]; exists {
+			load = *trackedLoad
+		}
+		if suggestion == nil || lessLoaded(load, *suggestion) {
+			suggestion = &load
+		}
+	}
+
+	var message string
+	if suggestion == nil {
+		message = "I don't know of anyone who could review this PR yet."
+	} else {
+		message = fmt.Sprintf("@%s has the fewest open review requests (%d)", suggestion.Login,
+			suggestion.OpenRequests)
+		if suggestion.Reviews > 0 {
+			message += fmt.Sprintf(" and responds to review requests in %s on average",
+				formatDuration(suggestion.averageResponseTime()))
+		}
+		message += ", so it's their turn to review this PR."
+	}
+	if err = comment(message, issue.Repository, issue.Number, issues); err != nil {
+		errorMessage := fmt.Sprintf("Failed to suggest a reviewer for PR %s", issue.FullName())
+		return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	return SuccessResponse{fmt.Sprintf("Suggested a reviewer for PR %s", issue.FullName())}
+}
+
+// trackReviewRequest keeps the review requests of the PR up to date, so that
+// reviewer loads could be calculated.
+func trackReviewRequest(pullRequestEvent PullRequestEvent, store Store) Response {
+	issue := pullRequestEvent.Issue()
+	reviewer := pullRequestEvent.RequestedReviewer.Login
+	if reviewer == "" {
+		return SuccessResponse{"Review requested from a team. Ignoring."}
+	}
+	var err error
+	if pullRequestEvent.Action == "review_requested" {
+		err = store.AddReviewRequest(ReviewRequest{
+			Repository:  issue.Repository,
+			PullRequest: issue.Number,
+			Reviewer:    reviewer,
+			RequestedAt: time.Now(),
+		})
+	} else {
+		err = store.RemoveReviewRequest(issue.Repository, issue.Number, reviewer)
+	}
+	if err != nil {
+		message := fmt.Sprintf("Failed to track the review request for PR %s", issue.FullName())
+		return ErrorResponse{err, http.StatusInternalServerError, message}
+	}
+	return SuccessResponse{fmt.Sprintf("Tracked the review request for PR %s", issue.FullName())}
+}
+
+// runReviewLoadReport periodically posts the review load report until stop
+// is closed.
+func runReviewLoadReport(configSource ConfigSource, store Store, issues Issues, stop <-chan struct{}) {
+	conf := configSource.Current()
+	if conf.ReviewLoadReportInterval == 0 {
+		log.Println("Review load report disabled")
+		return
+	}
+	ticker := time.NewTicker(conf.ReviewLoadReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			conf := configSource.Current()
+			if conf.ReviewLoadReportIssue.Number == 0 {
+				continue
+			} else if pausedForGithubIncident("the review load report") ||
+				throttledForRateLimit(conf, "the review load report") {
+				continue
+			}
+			if err := PostReviewLoadReport(conf, store, issues); err != nil {
+				log.Printf("Posting the review load report failed: %v\n", err)
+			}
+		}
+	}
+}
+
+// PostReviewLoadReport comments a summary of every repository's reviewer
+// loads on conf.ReviewLoadReportIssue. Reviewers with more than twice the
+// average number of open review requests are highlighted.
+func PostReviewLoadReport(conf Config, store Store, issues Issues) error {
+	requests, err := store.AllReviewRequests()
+	if err != nil {
+		return fmt.Errorf("failed to list review requests: %v", err)
+	} else if len(requests) == 0 {
+		return nil
+	}
+	requestsByRepository := make(map[string][]ReviewRequest)
+	for _, request := range requests {
+		key := repositoryKey(request.Repository)
+		requestsByRepository[key] = append(requestsByRepository[key], request)
+	}
+	repositoryKeys := make([]string, 0, len(requestsByRepository))
+	for key := range requestsByRepository {
+		repositoryKeys = append(repositoryKeys, key)
+	}
+	sort.Strings(repositoryKeys)
+
+	since := time.Now().Add(-conf.ReviewLoadReportInterval)
+	var report bytes.Buffer
+	fmt.Fprintf(&report, "Review load since %s:\n", since.Format("2006-01-02"))
+	for _, key := range repositoryKeys {
+		writeReviewLoadReport(&report, key, reviewerLoads(requestsByRepository[key], since))
+	}
+	reportIssue := conf.ReviewLoadReportIssue
+	return comment(report.String(), reportIssue.Repository, reportIssue.Number, issues)
+}
+
+func writeReviewLoadReport(report *bytes.Buffer, repository string, loads map[string]*reviewerLoad) {
+	sortedLoads := make([]reviewerLoad, 0, len(loads))
+	totalOpenRequests := 0
+	for _, load := range loads {
+		sortedLoads = append(sortedLoads, *load)
+		totalOpenRequests += load.OpenRequests
+	}
+	sort.Slice(sortedLoads, func(i, j int) bool { return lessLoaded(sortedLoads[j], sortedLoads[i]) })
+	averageOpenRequests := float64(totalOpenRequests) / float64(len(sortedLoads))
+
+	fmt.Fprintf(report, "\n### %s\n\n", repository)
+	fmt.Fprintln(report, "| Reviewer | Open requests | Reviews | Average response time |")
+	fmt.Fprintln(report, "| --- | --- | --- | --- |")
+	var overloaded []string
+	for _, load := range sortedLoads {
+		// Logins aren't mentioned, to not notify everyone of the report
+		login := load.Login
+		if load.OpenRequests > 1 && float64(load.OpenRequests) > 2*averageOpenRequests {
+			login = "**" + login + "**"
+			overloaded = append(overloaded, load.Login)
+		}
+		responseTime := "-"
+		if load.Reviews > 0 {
+			responseTime = formatDuration(load.averageResponseTime())
+		}
+		fmt.Fprintf(report, "| %s | %d | %d | %s |\n", login, load.OpenRequests, load.Reviews, responseTime)
+	}
+	if len(overloaded) > 0 {
+		fmt.Fprintf(report, "\nReviewers with more than twice the average number of open review requests "+
+			"(%.1f): %s\n", averageOpenRequests, strings.Join(overloaded, ", "))
+	}
+}
+
+func formatDuration(duration time.Duration) string {
+	return duration.Round(time.Minute).String()
+}
@@ -0,0 +1,222 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var trackedRepository = grh.Repository{
+	Owner: repositoryOwner,
+	Name:  repositoryName,
+	URL:   sshURL,
+}
+
+var reviewRequest = func(pullRequest int, reviewer string, requestedAgo, respondedAgo time.Duration) grh.ReviewRequest {
+	request := grh.ReviewRequest{
+		Repository:  trackedRepository,
+		PullRequest: pullRequest,
+		Reviewer:    reviewer,
+		RequestedAt: time.Now().Add(-requestedAgo),
+	}
+	if respondedAgo > 0 {
+		request.RespondedAt = time.Now().Add(-respondedAgo)
+	}
+	return request
+}
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	var (
+		handle      = context.Handle
+		headers     = context.Headers
+		requestJSON = context.RequestJSON
+
+		responseRecorder *httptest.ResponseRecorder
+		store            grh.Store
+		repositories     *mocks.Repositories
+		issues           *mocks.Issues
+	)
+	BeforeEach(func() {
+		responseRecorder = *context.ResponseRecorder
+		store = *context.Store
+		repositories = *context.Repositories
+		issues = *context.Issues
+	})
+
+	Describe("review request events", func() {
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "pull_request",
+			}
+		})
+
+		Context("with a review being requested", func() {
+			requestJSON.Is(func() string {
+				return ReviewRequestEvent("review_requested", "reviewer")
+			})
+
+			It("tracks the request", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+
+				requests, err := store.ReviewRequests(trackedRepository)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(requests).To(HaveLen(1))
+				Expect(requests[0].Reviewer).To(Equal("reviewer"))
+				Expect(requests[0].Pending()).To(BeTrue())
+			})
+		})
+
+		Context("with a review request being removed", func() {
+			requestJSON.Is(func() string {
+				return ReviewRequestEvent("review_request_removed", "reviewer")
+			})
+
+			BeforeEach(func() {
+				Expect(store.AddReviewRequest(reviewRequest(issueNumber, "reviewer", time.Hour, 0))).To(Succeed())
+			})
+
+			It("stops tracking the request", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+
+				requests, err := store.ReviewRequests(trackedRepository)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(requests).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("!whose-turn comment", func() {
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!whose-turn", arbitraryIssueAuthor)
+		})
+
+		BeforeEach(func() {
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+		})
+
+		expectSuggestion := func(text string) {
+			BeforeEach(func() {
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining(text))).
+					Return(emptyResult, emptyResponse, noError)
+			})
+
+			It("suggests a reviewer", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			})
+		}
+
+		Context("with no known reviewers", func() {
+			expectSuggestion("I don't know of anyone")
+		})
+
+		Context("with tracked review requests", func() {
+			BeforeEach(func() {
+				for _, request := range []grh.ReviewRequest{
+					reviewRequest(1, "busy-reviewer", 2*time.Hour, 0),
+					reviewRequest(2, "busy-reviewer", time.Hour, 0),
+					reviewRequest(1, "slow-reviewer", 10*time.Hour, time.Hour),
+					reviewRequest(2, "slow-reviewer", time.Hour, 0),
+					reviewRequest(3, "quick-reviewer", 2*time.Hour, time.Hour),
+					reviewRequest(4, "quick-reviewer", time.Hour, 0),
+					reviewRequest(5, arbitraryIssueAuthor, time.Hour, 30*time.Minute),
+				} {
+					Expect(store.AddReviewRequest(request)).To(Succeed())
+				}
+			})
+
+			Context("with any reviewer being eligible", func() {
+				expectSuggestion("@quick-reviewer has the fewest open review requests (1) and responds to " +
+					"review requests in 1h0m0s on average")
+			})
+
+			Context("with eligible reviewers being configured", func() {
+				BeforeEach(func() {
+					context.Config.Reviewers = []string{"busy-reviewer", "new-reviewer"}
+				})
+
+				expectSuggestion("@new-reviewer has the fewest open review requests (0), so it's their turn")
+			})
+		})
+	})
+})
+
+var _ = Describe("PostReviewLoadReport", func() {
+	var (
+		conf   grh.Config
+		store  grh.Store
+		issues *mocks.Issues
+	)
+
+	BeforeEach(func() {
+		conf = grh.Config{
+			ReviewLoadReportIssue: grh.Issue{
+				Number: 1,
+				Repository: grh.Repository{
+					Owner: repositoryOwner,
+					Name:  "reviews",
+				},
+			},
+			ReviewLoadReportInterval: 7 * 24 * time.Hour,
+		}
+		store = grh.NewMemoryStore()
+		issues = new(mocks.Issues)
+	})
+
+	AfterEach(func() {
+		issues.AssertExpectations(GinkgoT())
+	})
+
+	Context("with no tracked review requests", func() {
+		It("doesn't post a report", func() {
+			Expect(grh.PostReviewLoadReport(conf, store, issues)).To(Succeed())
+		})
+	})
+
+	Context("with one reviewer having most of the open review requests", func() {
+		BeforeEach(func() {
+			for _, request := range []grh.ReviewRequest{
+				reviewRequest(1, "busy-reviewer", time.Hour, 0),
+				reviewRequest(2, "busy-reviewer", time.Hour, 0),
+				reviewRequest(3, "busy-reviewer", time.Hour, 0),
+				reviewRequest(3, "other-reviewer", 3*time.Hour, time.Hour),
+				reviewRequest(4, "idle-reviewer", 30*24*time.Hour, 29*24*time.Hour),
+			} {
+				Expect(store.AddReviewRequest(request)).To(Succeed())
+			}
+			issues.
+				On("CreateComment", anyContext, repositoryOwner, "reviews", 1, mock.MatchedBy(
+					func(issueComment *github.IssueComment) bool {
+						return commentContaining("| **busy-reviewer** | 3 | 0 | - |")(issueComment) &&
+							commentContaining("| other-reviewer | 0 | 1 | 2h0m0s |")(issueComment) &&
+							commentContaining("| idle-reviewer | 0 | 0 | - |")(issueComment) &&
+							commentContaining("open review requests (1.0): busy-reviewer")(issueComment)
+					},
+				)).
+				Return(emptyResult, emptyResponse, noError)
+		})
+
+		It("highlights the imbalance", func() {
+			Expect(grh.PostReviewLoadReport(conf, store, issues)).To(Succeed())
+		})
+	})
+})
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+const (
+	ReviewerAssignmentRoundRobin  = "round-robin"
+	ReviewerAssignmentLeastLoaded = "least-loaded"
+)
+
+// ReviewerPathRule routes the review of PRs changing files that match the
+// pattern to the rule's reviewers.
+type ReviewerPathRule struct {
+	// Pattern is matched against the changed files with matchesPathPattern
+	Pattern   string
+	Reviewers []string
+}
+
+func (r ReviewerPathRule) matches(file string) bool {
+	return matchesPathPattern(r.Pattern, file)
+}
+
+// matchesPathPattern matches the files in a directory, if the pattern ends
+// with a slash. Otherwise the pattern is a glob that's matched against the
+// whole path or, if it includes no slashes, against the file name.
+func matchesPathPattern(pattern, file string) bool {
+	if strings.HasSuffix(pattern, "/") {
+		return strings.HasPrefix(file, pattern)
+	} else if !strings.Contains(pattern, "/") {
+		file = path.Base(file)
+	}
+	// Patterns are validated when the configuration is parsed
+	matched, _ := path.Match(pattern, file)
+	return matched
+}
+
+// ParseReviewerPathRules parses a semicolon separated list of
+// pattern=reviewers rules, where the reviewers are separated by commas, e.g.
+// "docs/=alice,bob; *.sql=carol".
+func ParseReviewerPathRules(rulesString string) ([]ReviewerPathRule, error) {
+	rules := []ReviewerPathRule{}
+	for _, ruleString := range strings.Split(rulesString, ";") {
+		ruleString = strings.TrimSpace(ruleString)
+		if ruleString == "" {
+			continue
+		}
+		i := strings.Index(ruleString, "=")
+		if i == -1 {
+			return nil, fmt.Errorf("rules must be in the pattern=reviewers format, got \"%s\"", ruleString)
+		}
+		rule := ReviewerPathRule{
+			Pattern:   strings.TrimSpace(ruleString[:i]),
+			Reviewers: getListFromString(ruleString[i+1:]),
+		}
+		if _, err := path.Match(rule.Pattern, ""); err != nil || rule.Pattern == "" {
+			return nil, fmt.Errorf("invalid pattern in \"%s\"", ruleString)
+		} else if len(rule.Reviewers) == 0 {
+			return nil, fmt.Errorf("no reviewers in \"%s\"", ruleString)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func validateReviewerAssignment(assignment string) error {
+	if assignment != "" && assignment != ReviewerAssignmentRoundRobin &&
+		assignment != ReviewerAssignmentLeastLoaded {
+		return fmt.Errorf("must be either empty, \"%s\" or \"%s\", got \"%s\"", ReviewerAssignmentRoundRobin,
+			ReviewerAssignmentLeastLoaded, assignment)
+	}
+	return nil
+}
+
+// assignReviewers requests reviews for a newly opened PR from reviewers picked
+// with the configured strategy. PRs whose authors have already requested
+// reviews themselves are left alone. The owners of the changed files in the
+// repository's OWNERS_FILE take precedence over the other reviewers and the
+// teams among them are requested to review as teams.
+func assignReviewers(conf Config, pullRequestEvent PullRequestEvent, store Store, pullRequests PullRequests,
+	graphQL GraphQL) *ErrorResponse {
+
+	issue := pullRequestEvent.Issue()
+	if conf.ReviewerAssignment == "" || len(pullRequestEvent.RequestedReviewers) > 0 {
+		return nil
+	}
+	candidates := conf.Reviewers
+	var teams []string
+	if len(conf.ReviewerPathRules) > 0 || conf.OwnersFile != "" {
+		files, errResp := getPRFiles(issue, pullRequests)
+		if errResp != nil {
+			return errResp
+		}
+		fileNames := make([]string, len(files))
+		for i, file := range files {
+			fileNames[i] = file.GetFilename()
+		}
+		if ruleReviewers := pathRuleReviewers(conf.ReviewerPathRules, fileNames); len(ruleReviewers) > 0 {
+			candidates = ruleReviewers
+		}
+		owners, err := repositoryOwners(conf, issue.Repository, store, graphQL)
+		if err != nil {
+			message := fmt.Sprintf("Failed to get the owners of the files of PR %s", issue.FullName())
+			return &ErrorResponse{err, http.StatusBadGateway, message}
+		}
+		if users, ownerTeams := ownerUsersAndTeams(matchingOwnerRules(owners, fileNames)); len(users) > 0 ||
+			len(ownerTeams) > 0 {
+
+			candidates, teams = users, ownerTeams
+		}
+	}
+	var eligible []string
+	for _, candidate := range candidates {
+		if !strings.EqualFold(candidate, issue.User.Login) {
+			eligible = append(eligible, candidate)
+		}
+	}
+	if len(eligible) == 0 && len(teams) == 0 {
+		log.Printf("Found no reviewers to assign to PR %s.\n", issue.FullName())
+		return nil
+	}
+
+	var reviewers []string
+	if len(eligible) == 0 {
+		// Only teams own the changed files
+	} else if conf.ReviewerAssignment == ReviewerAssignmentRoundRobin {
+		last, err := store.LastAssignedReviewer(issue.Repository)
+		if err != nil {
+			message := fmt.Sprintf("Failed to get the last assigned reviewer of %s", repositoryKey(issue.Repository))
+			return &ErrorResponse{err, http.StatusInternalServerError, message}
+		}
+		reviewers = roundRobinReviewers(eligible, last, conf.ReviewerAssignmentCount)
+	} else {
+		requests, err := store.ReviewRequests(issue.Repository)
+		if err != nil {
+			return &ErrorResponse{err, http.StatusInternalServerError, "Failed to list the tracked review requests"}
+		}
+		reviewers = leastLoadedReviewers(eligible, reviewerLoads(requests, time.Time{}),
+			conf.ReviewerAssignmentCount)
+	}
+	teamSlugs := make([]string, len(teams))
+	for i, team := range teams {
+		teamSlugs[i] = strings.SplitN(team, "/", 2)[1]
+	}
+
+	request := github.ReviewersRequest{Reviewers: reviewers}
+	if len(teamSlugs) > 0 {
+		request.TeamReviewers = teamSlugs
+	}
+	_, _, err := pullRequests.RequestReviewers(context.TODO(), issue.Repository.Owner, issue.Repository.Name,
+		issue.Number, request)
+	if err != nil {
+		message := fmt.Sprintf("Failed to request reviews for PR %s", issue.FullName())
+		return &ErrorResponse{err, http.StatusBadGateway, message}
+	}
+	log.Printf("Requested reviews for PR %s from %s.\n", issue.FullName(),
+		strings.Join(append(append([]string{}, reviewers...), teams...), ", "))
+	if conf.ReviewerAssignment == ReviewerAssignmentRoundRobin && len(reviewers) > 0 {
+		if err = store.SetLastAssignedReviewer(issue.Repository, reviewers[len(reviewers)-1]); err != nil {
+			message := fmt.Sprintf("Failed to remember the last assigned reviewer of %s",
+				repositoryKey(issue.Repository))
+			return &ErrorResponse{err, http.StatusInternalServerError, message}
+		}
+	}
+	return nil
+}
+
+// pathRuleReviewers returns the reviewers of all of the rules matching any of
+// the files, in the order of the rules.
+func pathRuleReviewers(rules []ReviewerPathRule, files []string) []string {
+	var reviewers []string
+	added := make(map[string]bool)
+	for _, rule := range rules {
+		for _, file := range files {
+			if !rule.matches(file) {
+				continue
+			}
+			for _, reviewer := range rule.Reviewers {
+				if !added[reviewer] {
+					added[reviewer] = true
+					reviewers = append(reviewers, reviewer)
+				}
+			}
+			break
+		}
+	}
+	return reviewers
+}
+
+// roundRobinReviewers picks count candidates, starting with the one after the
+// last assigned reviewer.
+func roundRobinReviewers(candidates []string, last string, count int) []string {
+	start := 0
+	for i, candidate := range candidates {
+		if candidate == last {
+			start = i + 1
+		}
+	}
+	var reviewers []string
+	for i := 0; i < len(candidates) && len(reviewers) < count; i++ {
+		reviewers = append(reviewers, candidates[(start+i)%len(candidates)])
+	}
+	return reviewers
+}
+
+// leastLoadedReviewers picks the count candidates with the fewest open review
+// requests.
+func leastLoadedReviewers(candidates []string, loads map[string]*reviewerLoad, count int) []string {
+	candidateLoads := make([]reviewerLoad, len(candidates))
+	for i, candidate := range candidates {
+		candidateLoads[i] = reviewerLoad{Login: candidate}
+		if load, exists := loads[candidate]; exists {
+			candidateLoads[i] = *load
+		}
+	}
+	sort.Slice(candidateLoads, func(i, j int) bool {
+		return lessLoaded(candidateLoads[i], candidateLoads[j])
+	})
+	var reviewers []string
+	for i := 0; i < len(candidateLoads) && i < count; i++ {
+		reviewers = append(reviewers, candidateLoads[i].Login)
+	}
+	return reviewers
+}
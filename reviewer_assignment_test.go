@@ -0,0 +1,198 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("pull_request opened event with reviewer assignment", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+
+			headSHA           = "1235"
+			anyListOptions    = mock.AnythingOfType("*github.ListOptions")
+			requestsReviewFor = func(reviewers ...string) github.ReviewersRequest {
+				return github.ReviewersRequest{Reviewers: reviewers}
+			}
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+
+			conf := context.Config
+			conf.Reviewers = []string{arbitraryIssueAuthor, "alice", "bob", "carol"}
+			conf.ReviewerAssignmentCount = 1
+
+			pullRequests.
+				On("ListCommits", anyContext, repositoryOwner, repositoryName, issueNumber, anyListOptions).
+				Return(githubCommits(commit{headSHA, "Changing things"}), emptyResponse, noError)
+			repositories.
+				On("CreateStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.Anything).
+				Return(emptyResult, emptyResponse, noError)
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "pull_request",
+			}
+		})
+		requestJSON.Is(func() string {
+			return PullRequestEvent("opened", headSHA, grh.Repository{
+				Owner: repositoryOwner,
+				Name:  repositoryName,
+				URL:   sshURL,
+			})
+		})
+
+		Context("with round-robin assignment", func() {
+			BeforeEach(func() {
+				context.Config.ReviewerAssignment = grh.ReviewerAssignmentRoundRobin
+			})
+
+			It("takes turns among the reviewers other than the author", func() {
+				pullRequests.
+					On("RequestReviewers", anyContext, repositoryOwner, repositoryName, issueNumber,
+						requestsReviewFor("alice")).
+					Return(emptyResult, emptyResponse, noError).
+					Once()
+				pullRequests.
+					On("RequestReviewers", anyContext, repositoryOwner, repositoryName, issueNumber,
+						requestsReviewFor("bob")).
+					Return(emptyResult, emptyResponse, noError).
+					Once()
+
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				pullRequests.AssertExpectations(GinkgoT())
+			})
+
+			Context("with path rules", func() {
+				BeforeEach(func() {
+					context.Config.ReviewerPathRules = []grh.ReviewerPathRule{
+						{Pattern: "docs/", Reviewers: []string{"dana"}},
+						{Pattern: "*.sql", Reviewers: []string{"erin"}},
+					}
+				})
+
+				It("picks the reviewers of the rules matching the PR's files", func() {
+					pullRequests.
+						On("ListFiles", anyContext, repositoryOwner, repositoryName, issueNumber, anyListOptions).
+						Return([]*github.CommitFile{
+							{Filename: github.String("docs/setup.md")},
+							{Filename: github.String("main.go")},
+						}, emptyResponse, noError)
+					pullRequests.
+						On("RequestReviewers", anyContext, repositoryOwner, repositoryName, issueNumber,
+							requestsReviewFor("dana")).
+						Return(emptyResult, emptyResponse, noError)
+
+					handle()
+
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					pullRequests.AssertExpectations(GinkgoT())
+				})
+
+				It("falls back to the reviewers pool, if no rules match", func() {
+					pullRequests.
+						On("ListFiles", anyContext, repositoryOwner, repositoryName, issueNumber, anyListOptions).
+						Return([]*github.CommitFile{
+							{Filename: github.String("db/migrations/1.sql.go")},
+						}, emptyResponse, noError)
+					pullRequests.
+						On("RequestReviewers", anyContext, repositoryOwner, repositoryName, issueNumber,
+							requestsReviewFor("alice")).
+						Return(emptyResult, emptyResponse, noError)
+
+					handle()
+
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					pullRequests.AssertExpectations(GinkgoT())
+				})
+			})
+
+			Context("with the author having already requested reviews", func() {
+				requestJSON.Is(func() string {
+					return strings.Replace(PullRequestEvent("opened", headSHA, grh.Repository{
+						Owner: repositoryOwner,
+						Name:  repositoryName,
+						URL:   sshURL,
+					}), `"user": {`, `"requested_reviewers": [{"login": "carol"}], "user": {`, 1)
+				})
+
+				It("doesn't request any more reviews", func() {
+					handle()
+
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					pullRequests.AssertNotCalled(GinkgoT(), "RequestReviewers", anyContext, repositoryOwner,
+						repositoryName, issueNumber, mock.Anything)
+				})
+			})
+
+			Context("with requesting reviews failing", func() {
+				BeforeEach(func() {
+					pullRequests.
+						On("RequestReviewers", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.Anything).
+						Return(emptyResult, emptyResponse, errArbitrary)
+				})
+
+				It("still checks the PR for fixup commits", func() {
+					handle()
+
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					repositories.AssertExpectations(GinkgoT())
+				})
+			})
+		})
+
+		Context("with least-loaded assignment", func() {
+			BeforeEach(func() {
+				context.Config.ReviewerAssignment = grh.ReviewerAssignmentLeastLoaded
+				context.Config.ReviewerAssignmentCount = 2
+
+				store := *context.Store
+				repository := grh.Repository{Owner: repositoryOwner, Name: repositoryName}
+				for i, reviewer := range []string{"alice", "alice", "bob"} {
+					Expect(store.AddReviewRequest(grh.ReviewRequest{
+						Repository:  repository,
+						PullRequest: 100 + i,
+						Reviewer:    reviewer,
+						RequestedAt: time.Now(),
+					})).To(Succeed())
+				}
+			})
+
+			It("picks the reviewers with the fewest open review requests", func() {
+				pullRequests.
+					On("RequestReviewers", anyContext, repositoryOwner, repositoryName, issueNumber,
+						requestsReviewFor("carol", "bob")).
+					Return(emptyResult, emptyResponse, noError)
+
+				handle()
+
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				pullRequests.AssertExpectations(GinkgoT())
+			})
+		})
+	})
+})
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/salemove/github-review-helper/git"
+)
+
+const (
+	// ScheduledMergeLabel marks the PRs scheduled to be merged with "!merge
+	// at" or "!merge after-freeze". Removing it cancels the scheduled merge.
+	ScheduledMergeLabel = "merge-scheduled"
+	// How often to check for the scheduled merges that are due
+	scheduledMergeCheckInterval = time.Minute
+	// How long a scheduled merge that failed to start is tried again for
+	scheduledMergeRetryPeriod = time.Hour
+)
+
+// The formats "!merge at" accepts, e.g. 2024-06-01T09:00Z or
+// 2024-06-01T11:00:00+02:00, and the formats of times without a time zone,
+// e.g. 2024-06-01T11:00, which are in the repository's time zone.
+var (
+	scheduledMergeTimeLayouts      = []string{"2006-01-02T15:04Z07:00", time.RFC3339}
+	localScheduledMergeTimeLayouts = []string{"2006-01-02T15:04", "2006-01-02T15:04:05"}
+)
+
+// scheduledMergesFileMutex keeps the scheduled merges from being saved by
+// several webhooks at once
+var scheduledMergesFileMutex sync.Mutex
+
+// scheduleMerge records the PR to be labeled for merging at the time asked
+// for with "!merge at" or, with "!merge after-freeze", when the repository's
+// active or next merge freeze ends. The PR is labeled with
+// ScheduledMergeLabel instead of the merging label until then.
+func scheduleMerge(conf Config, issueComment IssueComment, arguments mergeArguments, store Store,
+	issues Issues) Response {
+
+	issue := issueComment.Issue()
+	at, reason := scheduledMergeTime(conf, issue.Repository, arguments, time.Now())
+	if reason != "" {
+		log.Printf("Not scheduling the merge of PR %s, because %s.\n", issue.FullName(), reason)
+		message := fmt.Sprintf("@%s, I can't schedule the merge, because %s.", issueComment.Commenter.Login, reason)
+		if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+			errorMessage := fmt.Sprintf("Failed to report the refused schedule on PR %s", issue.FullName())
+			return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+		}
+		return SuccessResponse{fmt.Sprintf("Not scheduling the merge of PR %s, because %s", issue.FullName(),
+			reason)}
+	}
+	err := store.AddScheduledMerge(ScheduledMerge{
+		Issue:       issue,
+		At:          at,
+		RequestedBy: issueComment.Commenter.Login,
+		ForceWait:   arguments.ForceWait,
+	})
+	if err != nil {
+		message := fmt.Sprintf("Failed to schedule the merge of PR %s", issue.FullName())
+		return ErrorResponse{err, http.StatusInternalServerError, message}
+	}
+	saveScheduledMerges(conf, store)
+	// The PR would otherwise be merged as soon as it's ready
+	if issueComment.HasLabel(MergingLabel) {
+		if errResp := removeLabel(issue.Repository, issue.Number, MergingLabel, issues); errResp != nil {
+			return errResp
+		}
+		forgetMergeRequest(issue, store)
+	}
+	if !issueComment.HasLabel(ScheduledMergeLabel) {
+		if errResp := addLabel(issue.Repository, issue.Number, ScheduledMergeLabel, issues); errResp != nil {
+			return errResp
+		}
+	}
+	message := fmt.Sprintf("I'll merge this PR at %s, if it's ready then. Remove the '%s' label to cancel.",
+		formatScheduledMergeTime(conf, issue.Repository, at), ScheduledMergeLabel)
+	if err = comment(message, issue.Repository, issue.Number, issues); err != nil {
+		errorMessage := fmt.Sprintf("Failed to confirm the scheduled merge of PR %s", issue.FullName())
+		return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	return SuccessResponse{fmt.Sprintf("Scheduled PR %s to be merged at %s", issue.FullName(),
+		at.Format(time.RFC3339))}
+}
+
+// scheduledMergeTime returns the time the merge command asks the PR to be
+// merged at, or the reason why it can't be scheduled.
+func scheduledMergeTime(conf Config, repository Repository, arguments mergeArguments,
+	now time.Time) (time.Time, string) {
+
+	if arguments.AfterFreeze {
+		end := nextMergeFreezeEnd(conf, repository, now)
+		if end.IsZero() {
+			return time.Time{}, "no merge freeze applies to this repository"
+		}
+		return end, ""
+	}
+	at, parsed := parseScheduledMergeTime(arguments.At, conf.repositoryCommandLocation(repository))
+	if !parsed {
+		return time.Time{}, fmt.Sprintf("`%s` isn't a time I understand, like `2024-06-01T09:00Z`", arguments.At)
+	} else if !at.After(now) {
+		return time.Time{}, fmt.Sprintf("`%s` is in the past", arguments.At)
+	}
+	return at, ""
+}
+
+// parseScheduledMergeTime parses the time given to "!merge at". Times without
+// a time zone are in the location, with the offset the location has on that
+// date, so that daylight saving time is taken into account.
+func parseScheduledMergeTime(value string, location *time.Location) (time.Time, bool) {
+	for _, layout := range scheduledMergeTimeLayouts {
+		if at, err := time.Parse(layout, value); err == nil {
+			return at, true
+		}
+	}
+	for _, layout := range localScheduledMergeTimeLayouts {
+		if at, err := time.ParseInLocation(layout, value, location); err == nil {
+			return at, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func formatScheduledMergeTime(conf Config, repository Repository, at time.Time) string {
+	return at.In(conf.mergeFreezeLocation(repository)).Format("Mon Jan 2 15:04 MST")
+}
+
+// unscheduleMerge forgets the PR's scheduled merge, if it has one. A failure
+// is only logged, because the PR is checked for ScheduledMergeLabel before
+// it's merged anyway.
+func unscheduleMerge(conf Config, issue Issue, store Store) {
+	if _, exists, err := store.ScheduledMerge(issue); err != nil || !exists {
+		return
+	} else if err = store.RemoveScheduledMerge(issue); err != nil {
+		log.Printf("Failed to forget the scheduled merge of PR %s: %v\n", issue.FullName(), err)
+		return
+	}
+	saveScheduledMerges(conf, store)
+}
+
+// saveScheduledMerges writes the scheduled merges to SCHEDULED_MERGES_PATH,
+// so that they would survive a restart. A failure is only logged, because
+// the merges are still scheduled until the bot is restarted.
+func saveScheduledMerges(conf Config, store Store) {
+	if conf.ScheduledMergesPath == "" {
+		return
+	}
+	scheduledMergesFileMutex.Lock()
+	defer scheduledMergesFileMutex.Unlock()
+	scheduledMerges, err := store.ScheduledMerges()
+	if err != nil {
+		log.Printf("Failed to list the scheduled merges to save: %v\n", err)
+		return
+	}
+	data, err := json.MarshalIndent(scheduledMerges, "", "  ")
+	if err != nil {
+		log.Printf("Failed to encode the scheduled merges: %v\n", err)
+		return
+	}
+	// Writing to a temporary file first, so that a crash wouldn't leave a
+	// half-written file behind
+	tmpPath := conf.ScheduledMergesPath + ".tmp"
+	if err = ioutil.WriteFile(tmpPath, data, 0600); err == nil {
+		err = os.Rename(tmpPath, conf.ScheduledMergesPath)
+	}
+	if err != nil {
+		log.Printf("Failed to save the scheduled merges to %s: %v\n", conf.ScheduledMergesPath, err)
+	}
+}
+
+// LoadScheduledMerges adds the scheduled merges saved in
+// SCHEDULED_MERGES_PATH to the store. A missing file has no merges.
+func LoadScheduledMerges(conf Config, store Store) error {
+	if conf.ScheduledMergesPath == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(conf.ScheduledMergesPath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var scheduledMerges []ScheduledMerge
+	if err = json.Unmarshal(data, &scheduledMerges); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", conf.ScheduledMergesPath, err)
+	}
+	for _, scheduled := range scheduledMerges {
+		if err = store.AddScheduledMerge(scheduled); err != nil {
+			return err
+		}
+	}
+	log.Printf("Loaded %d scheduled merge(s) from %s.\n", len(scheduledMerges), conf.ScheduledMergesPath)
+	return nil
+}
+
+// runScheduledMerges periodically starts the scheduled merges that are due,
+// until stop is closed.
+func runScheduledMerges(configSource ConfigSource, store Store, start func(ScheduledMerge) Response,
+	stop <-chan struct{}) {
+
+	ticker := time.NewTicker(scheduledMergeCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := StartScheduledMerges(configSource.Current(), store, start, time.Now()); err != nil {
+				log.Printf("Starting the scheduled merges failed: %v\n", err)
+			}
+		}
+	}
+}
+
+// StartScheduledMerges starts the merges that were scheduled for now or
+// earlier, e.g. while the bot was down. The merges are no longer scheduled
+// afterwards, unless starting them failed, in which case they're tried again
+// on the next check for up to scheduledMergeRetryPeriod.
+func StartScheduledMerges(conf Config, store Store, start func(ScheduledMerge) Response, now time.Time) error {
+	scheduledMerges, err := store.ScheduledMerges()
+	if err != nil {
+		return fmt.Errorf("failed to list the scheduled merges: %v", err)
+	}
+	for _, scheduled := range scheduledMerges {
+		if scheduled.At.After(now) {
+			break
+		}
+		log.Printf("The merge of PR %s is due. Labeling it for merging.\n", scheduled.Issue.FullName())
+		response := start(scheduled)
+		response.logResponse()
+		_, isError := asErrorResponse(response)
+		if isError && now.Before(scheduled.At.Add(scheduledMergeRetryPeriod)) {
+			log.Printf("Trying to start the merge of PR %s again later.\n", scheduled.Issue.FullName())
+			continue
+		}
+		// The merge may have been scheduled again while it was starting
+		current, exists, err := store.ScheduledMerge(scheduled.Issue)
+		if err != nil {
+			return fmt.Errorf("failed to get the scheduled merge of PR %s: %v", scheduled.Issue.FullName(), err)
+		} else if !exists || !current.At.Equal(scheduled.At) {
+			continue
+		}
+		if err = store.RemoveScheduledMerge(scheduled.Issue); err != nil {
+			return fmt.Errorf("failed to unschedule the merge of PR %s: %v", scheduled.Issue.FullName(), err)
+		}
+		saveScheduledMerges(conf, store)
+	}
+	return nil
+}
+
+// startScheduledMerge labels the PR for merging, like "!merge" would, and
+// merges it if it's ready. PRs that were closed or whose ScheduledMergeLabel
+// was removed, e.g. while the bot was down, are left alone. The merging label
+// is added before ScheduledMergeLabel is removed, so that starting the merge
+// again after a failure would be safe.
+func startScheduledMerge(conf Config, scheduled ScheduledMerge, store Store, issues Issues,
+	pullRequests PullRequests, repositories Repositories, graphQL GraphQL, gitRepos git.Repos) Response {
+
+	issue := scheduled.Issue
+	pr, errResp := getPR(issue, pullRequests)
+	if errResp != nil {
+		return errResp
+	} else if pr.GetState() == "closed" {
+		return SuccessResponse{fmt.Sprintf("PR %s was closed before its scheduled merge", issue.FullName())}
+	}
+	labels, errResp := getLabels(issue, issues)
+	if errResp != nil {
+		return errResp
+	} else if !containsLabel(labels, ScheduledMergeLabel) {
+		return SuccessResponse{fmt.Sprintf("The scheduled merge of PR %s was cancelled", issue.FullName())}
+	}
+	if !containsLabel(labels, MergingLabel) {
+		if errResp = addLabel(issue.Repository, issue.Number, MergingLabel, issues); errResp != nil {
+			return errResp
+		}
+	}
+	if errResp = removeLabel(issue.Repository, issue.Number, ScheduledMergeLabel, issues); errResp != nil {
+		return errResp
+	}
+	trackMergeRequest(conf, issue, scheduled.RequestedBy, store)
+	if scheduled.ForceWait {
+		if errResp = addForceWait(conf, issue, store); errResp != nil {
+			return errResp
+		}
+	}
+	errResp = requestTwoPersonConfirmation(conf, issue, scheduled.RequestedBy, store, issues, pullRequests)
+	if errResp != nil {
+		return errResp
+	}
+	return mergeIfReady(conf, issue, true, store, issues, pullRequests, repositories, graphQL, gitRepos)
+}
@@ -0,0 +1,187 @@
+package main_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("!merge comment with a time", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			issues           *mocks.Issues
+
+			commenter = "procoder"
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			issues = *context.Issues
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+
+		ForCollaborator(context, repositoryOwner, repositoryName, commenter, func() {
+			Context("in the future", func() {
+				requestJSON.Is(func() string {
+					return IssueCommentEvent("!merge at 2099-06-01T09:00Z", commenter)
+				})
+
+				It("labels the PR as scheduled instead of for merging", func() {
+					issues.
+						On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+							[]string{grh.ScheduledMergeLabel}).
+						Return(emptyResult, emptyResponse, noError).
+						Once()
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("I'll merge this PR at Mon Jun 1 09:00 UTC"))).
+						Return(emptyResult, emptyResponse, noError).
+						Once()
+
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertExpectations(GinkgoT())
+					issues.AssertNotCalled(GinkgoT(), "AddLabelsToIssue", anyContext, repositoryOwner,
+						repositoryName, issueNumber, []string{grh.MergingLabel})
+				})
+			})
+
+			Context("in the past", func() {
+				requestJSON.Is(func() string {
+					return IssueCommentEvent("!merge at 2020-01-01T09:00Z", commenter)
+				})
+
+				It("refuses to schedule the merge", func() {
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("@"+commenter+", I can't schedule the merge, because "+
+								"`2020-01-01T09:00Z` is in the past."))).
+						Return(emptyResult, emptyResponse, noError).
+						Once()
+
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertExpectations(GinkgoT())
+				})
+			})
+
+			Context("after a freeze without freezes configured", func() {
+				requestJSON.Is(func() string {
+					return IssueCommentEvent("!merge after-freeze", commenter)
+				})
+
+				It("refuses to schedule the merge", func() {
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("because no merge freeze applies to this repository"))).
+						Return(emptyResult, emptyResponse, noError).
+						Once()
+
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertExpectations(GinkgoT())
+				})
+			})
+		})
+	})
+})
+
+var _ = Describe("StartScheduledMerges", func() {
+	var (
+		conf          grh.Config
+		store         grh.Store
+		startedIssues []grh.Issue
+		dir           string
+
+		now   = time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)
+		issue = grh.Issue{
+			Number:     issueNumber,
+			Repository: grh.Repository{Owner: repositoryOwner, Name: repositoryName},
+		}
+		otherIssue = grh.Issue{
+			Number:     issueNumber + 1,
+			Repository: grh.Repository{Owner: repositoryOwner, Name: repositoryName},
+		}
+		start = func(scheduled grh.ScheduledMerge) grh.Response {
+			startedIssues = append(startedIssues, scheduled.Issue)
+			return grh.SuccessResponse{}
+		}
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "scheduled-merges")
+		Expect(err).NotTo(HaveOccurred())
+		conf = grh.Config{ScheduledMergesPath: filepath.Join(dir, "scheduled-merges.json")}
+		store = grh.NewMemoryStore()
+		startedIssues = nil
+
+		Expect(store.AddScheduledMerge(grh.ScheduledMerge{Issue: issue, At: now, RequestedBy: "procoder"})).
+			To(Succeed())
+		Expect(store.AddScheduledMerge(grh.ScheduledMerge{Issue: otherIssue, At: now.Add(time.Hour)})).
+			To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("starts the merges that are due and keeps the rest across restarts", func() {
+		Expect(grh.StartScheduledMerges(conf, store, start, now)).To(Succeed())
+		Expect(startedIssues).To(Equal([]grh.Issue{issue}))
+
+		restartedStore := grh.NewMemoryStore()
+		Expect(grh.LoadScheduledMerges(conf, restartedStore)).To(Succeed())
+		scheduledMerges, err := restartedStore.ScheduledMerges()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(scheduledMerges).To(HaveLen(1))
+		Expect(scheduledMerges[0].Issue.Number).To(Equal(otherIssue.Number))
+		Expect(scheduledMerges[0].At.Equal(now.Add(time.Hour))).To(BeTrue())
+	})
+
+	Context("with starting the merge failing", func() {
+		failingStart := func(scheduled grh.ScheduledMerge) grh.Response {
+			startedIssues = append(startedIssues, scheduled.Issue)
+			return grh.ErrorResponse{errArbitrary, http.StatusBadGateway, "Failed to get the PR"}
+		}
+
+		It("keeps the merge scheduled to try again", func() {
+			Expect(grh.StartScheduledMerges(conf, store, failingStart, now)).To(Succeed())
+			Expect(startedIssues).To(Equal([]grh.Issue{issue}))
+			_, exists, err := store.ScheduledMerge(issue)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeTrue())
+
+			Expect(grh.StartScheduledMerges(conf, store, start, now.Add(time.Minute))).To(Succeed())
+			_, exists, err = store.ScheduledMerge(issue)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeFalse())
+		})
+
+		It("gives up once the merge has been failing for too long", func() {
+			Expect(grh.StartScheduledMerges(conf, store, failingStart, now.Add(time.Hour))).To(Succeed())
+			_, exists, err := store.ScheduledMerge(issue)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/google/go-github/github"
+)
+
+// labeledPRsWithHead finds the open PRs labeled for merging and not on hold
+// whose head is the status' commit and whose combined status is successful,
+// like the search for PRs to merge would, but with the list APIs. GitHub's
+// search index lags behind label changes, so the search can miss a PR that
+// was labeled just before CI finished. The PRs are only listed, if the
+// repository has PRs the bot knows to be labeled for merging, so that a
+// status of a commit that no labeled PR has wouldn't cost a listing.
+func labeledPRsWithHead(statusEvent StatusEvent, store Store, issues Issues, pullRequests PullRequests,
+	repositories Repositories) ([]*github.PullRequest, *ErrorResponse) {
+
+	repository := statusEvent.Repository
+	requests, err := store.MergeRequests()
+	if err != nil {
+		message := fmt.Sprintf("Failed to list the merge requests of %s", repositoryKey(repository))
+		return nil, &ErrorResponse{err, http.StatusInternalServerError, message}
+	}
+	tracked := false
+	for _, request := range requests {
+		if repositoryKey(request.Issue.Repository) == repositoryKey(repository) {
+			tracked = true
+			break
+		}
+	}
+	if !tracked {
+		return nil, nil
+	}
+	queued, err := queuedPRs(repository, issues)
+	if err != nil {
+		message := fmt.Sprintf("Failed to list the PRs of %s labeled for merging", repositoryKey(repository))
+		return nil, &ErrorResponse{err, http.StatusBadGateway, message}
+	}
+	prs, errResps := getPRsConcurrently(queued, pullRequests)
+	if len(errResps) > 0 {
+		return nil, errResps[0]
+	}
+	var matching []*github.PullRequest
+	for _, pr := range prs {
+		if pr.Head.GetSHA() != statusEvent.SHA || hasLabel(pr.Labels, OnHoldLabel) {
+			continue
+		}
+		state, _, errResp := getStatuses(pr, repositories)
+		if errResp != nil {
+			return nil, errResp
+		} else if state == "success" {
+			log.Printf("The search missed PR %s labeled for merging. Found it by listing the labeled PRs.\n",
+				prIssue(pr).FullName())
+			matching = append(matching, pr)
+		}
+	}
+	return matching, nil
+}
+
+func hasLabel(labels []*github.Label, name string) bool {
+	for _, label := range labels {
+		if label.GetName() == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/evaluator"
+)
+
+// The name of the gate that keeps PRs that seem to add credentials from
+// being merged
+const secretsGate = "secrets"
+
+// How long the high-entropy strings the heuristic looks at have to be
+const minHighEntropyLength = 24
+
+// SecretPattern is a regular expression that matches a kind of credential,
+// e.g. AWS access keys, in the lines PRs add.
+type SecretPattern struct {
+	Name   string
+	Regexp *regexp.Regexp
+}
+
+// defaultSecretPatterns match the credentials of the common services, which
+// are scanned for on top of SECRET_PATTERNS.
+var defaultSecretPatterns = []SecretPattern{
+	{"AWS access key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"GitHub token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{60,})\b`)},
+	{"Slack token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`)},
+	{"Google API key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{"Stripe key", regexp.MustCompile(`\b[rs]k_live_[0-9A-Za-z]{24,}\b`)},
+	{"private key", regexp.MustCompile(`-----BEGIN (?:[A-Z]+ )*PRIVATE KEY-----`)},
+	{"password", regexp.MustCompile(`(?i)\b(?:password|passwd|secret|api_?key|access_?token)\b["']?\s*[:=]\s*` +
+		`["'][^"'\s]{8,}["']`)},
+}
+
+var highEntropyCandidateRegexp = regexp.MustCompile(`[A-Za-z0-9+/_=-]{` + strconv.Itoa(minHighEntropyLength) +
+	`,}`)
+
+var hunkHeaderRegexp = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,\d+)? @@`)
+
+// ParseSecretPatterns parses a semicolon separated list of name=regexp
+// pairs, e.g. "internal token=itk_[a-z0-9]{32}; license key=LK-[A-Z0-9]{20}".
+func ParseSecretPatterns(patternsString string) ([]SecretPattern, error) {
+	patterns := []SecretPattern{}
+	for _, pair := range strings.Split(patternsString, ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		i := strings.Index(pair, "=")
+		if i <= 0 || i == len(pair)-1 {
+			return nil, fmt.Errorf("patterns must be in the name=regexp format, got \"%s\"", pair)
+		}
+		compiled, err := regexp.Compile(strings.TrimSpace(pair[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid regexp in \"%s\": %v", pair, err)
+		}
+		patterns = append(patterns, SecretPattern{Name: strings.TrimSpace(pair[:i]), Regexp: compiled})
+	}
+	return patterns, nil
+}
+
+// secretFinding is a potential credential on a line the PR adds.
+type secretFinding struct {
+	Filename string
+	Line     int
+	Kind     string
+	// Redacted is the start of the match, so that the report wouldn't leak
+	// the credential any further
+	Redacted string
+}
+
+// scanForSecrets scans the lines the PR adds for the default and configured
+// secret patterns and, if SECRET_ENTROPY_THRESHOLD isn't 0, for random
+// looking strings. The files matching SECRET_SCAN_EXCLUDED_PATHS and the
+// files GitHub doesn't show a diff for, e.g. binary ones, aren't scanned.
+func scanForSecrets(conf Config, files []*github.CommitFile) []secretFinding {
+	patterns := append(append([]SecretPattern{}, defaultSecretPatterns...), conf.SecretPatterns...)
+	var findings []secretFinding
+	for _, file := range files {
+		if file.GetStatus() == "removed" || isExcludedFromSecretScan(conf, file.GetFilename()) {
+			continue
+		}
+		line := 0
+		for _, diffLine := range strings.Split(file.GetPatch(), "\n") {
+			if match := hunkHeaderRegexp.FindStringSubmatch(diffLine); match != nil {
+				line, _ = strconv.Atoi(match[1])
+				continue
+			} else if strings.HasPrefix(diffLine, "-") {
+				continue
+			} else if !strings.HasPrefix(diffLine, "+") {
+				line++
+				continue
+			}
+			findings = append(findings, scanLine(conf, patterns, file.GetFilename(), line, diffLine[1:])...)
+			line++
+		}
+	}
+	return findings
+}
+
+func isExcludedFromSecretScan(conf Config, filename string) bool {
+	for _, pattern := range conf.SecretScanExcludedPaths {
+		if matchesPathPattern(pattern, filename) {
+			return true
+		}
+	}
+	return false
+}
+
+func scanLine(conf Config, patterns []SecretPattern, filename string, line int, text string) []secretFinding {
+	var findings []secretFinding
+	for _, pattern := range patterns {
+		if match := pattern.Regexp.FindString(text); match != "" {
+			findings = append(findings, secretFinding{filename, line, pattern.Name, redactSecret(match)})
+		}
+	}
+	if len(findings) > 0 || conf.SecretEntropyThreshold == 0 {
+		return findings
+	}
+	for _, candidate := range highEntropyCandidateRegexp.FindAllString(text, -1) {
+		if strings.ContainsAny(candidate, "0123456789") && strings.IndexFunc(candidate, isLetter) != -1 &&
+			shannonEntropy(candidate) >= conf.SecretEntropyThreshold {
+
+			findings = append(findings, secretFinding{filename, line, "high-entropy string",
+				redactSecret(candidate)})
+			break
+		}
+	}
+	return findings
+}
+
+func isLetter(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+// shannonEntropy returns the entropy of the string in bits per character.
+// Random tokens score higher than words and identifiers of the same length.
+func shannonEntropy(s string) float64 {
+	counts := make(map[rune]int)
+	for _, r := range s {
+		counts[r]++
+	}
+	length := float64(len([]rune(s)))
+	entropy := 0.0
+	for _, count := range counts {
+		p := float64(count) / length
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// redactSecret keeps the first 4 characters of the match, which are usually
+// enough to tell what kind of credential it is, e.g. "AKIA…".
+func redactSecret(match string) string {
+	runes := []rune(match)
+	if len(runes) <= 4 {
+		return "…"
+	}
+	return string(runes[:4]) + "…"
+}
+
+// secretScanReport describes the findings the secrets gate listed as its
+// evidence in a comment, without the credentials themselves.
+func secretScanReport(pr *github.PullRequest, evidence []string) string {
+	message := fmt.Sprintf(":rotating_light: @%s, this PR seems to add credentials, so I won't merge it. If they "+
+		"are real, remove them from the PR's history and revoke them, because they may have been seen already. If "+
+		"they aren't, ask a maintainer to let the PR through with a label.\n\n", pr.User.GetLogin())
+	for _, finding := range evidence {
+		message += "- " + finding + "\n"
+	}
+	return message
+}
+
+// reportSecrets comments the credentials the secrets gate found in the PR
+// once per head of the PR. Returns whether the findings were reported.
+func reportSecrets(blocker evaluator.Node, pr *github.PullRequest, store Store, issues Issues) (bool,
+	*ErrorResponse) {
+
+	issue := prIssue(pr)
+	isNew, err := store.RecordRefusal(issue, pr.Head.GetSHA()+" adds credentials")
+	if err != nil {
+		errorMessage := fmt.Sprintf("Failed to record the credentials found in PR %s", issue.FullName())
+		return false, &ErrorResponse{err, http.StatusInternalServerError, errorMessage}
+	} else if !isNew {
+		return true, nil
+	}
+	if err = comment(secretScanReport(pr, blocker.Evidence), issue.Repository, issue.Number, issues); err != nil {
+		errorMessage := fmt.Sprintf("Failed to report the credentials found in PR %s", issue.FullName())
+		return false, &ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	return true, nil
+}
+
+// checkSecrets fails PRs whose diff seems to add credentials, with the
+// redacted findings as the evidence. The gate doesn't comment itself, so that
+// !status wouldn't have side effects. Merging reports the findings instead.
+// One of the SKIP_LABELS for the secrets check lets false positives through.
+func checkSecrets(ctx GateContext) (evaluator.Result, *ErrorResponse) {
+	if !ctx.Config.SecretScan {
+		return passed("SECRET_SCAN is disabled"), nil
+	}
+	files, errResp := getPRFiles(prIssue(ctx.PR), ctx.PullRequests)
+	if errResp != nil {
+		return evaluator.Result{}, errResp
+	}
+	findings := scanForSecrets(ctx.Config, files)
+	if len(findings) == 0 {
+		return passed(), nil
+	}
+	evidence := make([]string, len(findings))
+	for i, finding := range findings {
+		evidence[i] = fmt.Sprintf("`%s` line %d: %s (`%s`)", finding.Filename, finding.Line, finding.Kind,
+			finding.Redacted)
+	}
+	return failed(fmt.Sprintf("it seems to add credentials in %d place(s)", len(findings)), evidence...), nil
+}
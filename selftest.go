@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/salemove/github-review-helper/evaluator"
+	"github.com/salemove/github-review-helper/git"
+)
+
+// The names of the checks a self-test runs
+const (
+	repositoryAccessCheck = "repository access"
+	gitAccessCheck        = "git access"
+	labelCheck            = "labels"
+	pushCheck             = "push"
+	mergeCheck            = "merge"
+)
+
+func isSelfTestCommand(comment string) bool {
+	trimmed := strings.TrimSpace(comment)
+	return trimmed == "!ping" || trimmed == "!selftest"
+}
+
+// handleSelfTestCommand checks whether the bot is permitted to do everything
+// it needs to in the repository, reports the results on the PR and records
+// them in the store. Being able to post the report shows that the bot can
+// comment.
+func handleSelfTestCommand(issueComment IssueComment, store Store, gitRepos git.Repos, repositories Repositories,
+	issues Issues) Response {
+
+	repository := issueComment.Repository
+	decision, errResp := evaluate(selfTestRules(repository, gitRepos, repositories), true)
+	if errResp != nil {
+		return errResp
+	}
+	selfTest := SelfTest{
+		Repository:  repository,
+		RequestedBy: issueComment.Commenter.Login,
+		Failed:      failedChecks(decision),
+		TestedAt:    time.Now(),
+	}
+	if err := store.SetSelfTest(selfTest); err != nil {
+		return ErrorResponse{err, http.StatusInternalServerError, "Failed to record the self-test"}
+	}
+	var summary string
+	if len(selfTest.Failed) == 0 {
+		summary = fmt.Sprintf("@%s, I have all of the access I need in this repository.",
+			issueComment.Commenter.Login)
+	} else {
+		summary = fmt.Sprintf("@%s, I'm missing some of the access I need in this repository: %s.",
+			issueComment.Commenter.Login, strings.Join(selfTest.Failed, ", "))
+	}
+	message := summary + "\n\n" + decision.Markdown()
+	if err := comment(message, repository, issueComment.IssueNumber, issues); err != nil {
+		errorMessage := fmt.Sprintf("Failed to report the self-test of %s", issueComment.Issue().FullName())
+		return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	return SuccessResponse{message}
+}
+
+// selfTestRules returns the checks of the bot's access to the repository.
+// Failing to reach GitHub fails the checks instead of the command, because
+// that's what the self-test is meant to find out.
+func selfTestRules(repository Repository, gitRepos git.Repos, repositories Repositories) []evaluator.Rule {
+	var permissions map[string]bool
+	return []evaluator.Rule{
+		rule(repositoryAccessCheck, func() (evaluator.Result, *ErrorResponse) {
+			githubRepository, _, err := repositories.Get(context.TODO(), repository.Owner, repository.Name)
+			if err != nil {
+				return failed("I can't read the repository through the API", err.Error()), nil
+			}
+			if githubRepository.Permissions != nil {
+				permissions = *githubRepository.Permissions
+			}
+			return passed(), nil
+		}),
+		rule(gitAccessCheck, func() (evaluator.Result, *ErrorResponse) {
+			_, err := gitRepos.GetUpdatedRepo(repository.URL, repository.Owner, repository.Name)
+			if err != nil {
+				return failed("I can't fetch the repository", err.Error()), nil
+			}
+			return passed(), nil
+		}),
+		rule(labelCheck, func() (evaluator.Result, *ErrorResponse) {
+			return permissionResult(permissions, "push", "I can't label PRs"), nil
+		}),
+		rule(pushCheck, func() (evaluator.Result, *ErrorResponse) {
+			return permissionResult(permissions, "push", "I can't push to the repository"), nil
+		}),
+		rule(mergeCheck, func() (evaluator.Result, *ErrorResponse) {
+			result := permissionResult(permissions, "push", "I can't merge PRs")
+			if result.Outcome == evaluator.Pass && !permissions["admin"] {
+				result.Evidence = append(result.Evidence, "without admin access, protected branches' rules apply")
+			}
+			return result, nil
+		}),
+	}
+}
+
+func permissionResult(permissions map[string]bool, permission, reason string) evaluator.Result {
+	if !permissions[permission] {
+		return failed(reason, fmt.Sprintf("no `%s` permission", permission))
+	}
+	return passed(fmt.Sprintf("`%s` permission", permission))
+}
+
+func failedChecks(decision evaluator.Decision) []string {
+	names := []string{}
+	for _, node := range decision.Nodes {
+		if node.Outcome != evaluator.Pass {
+			names = append(names, node.Rule)
+		}
+	}
+	return names
+}
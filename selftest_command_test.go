@@ -0,0 +1,129 @@
+package main_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("!selftest comment", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			store            grh.Store
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+			gitRepos         *mocks.Repos
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			store = *context.Store
+			repositories = *context.Repositories
+			issues = *context.Issues
+			gitRepos = *context.GitRepos
+
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+
+		mockRepository := func(permissions map[string]bool) {
+			repositories.
+				On("Get", anyContext, repositoryOwner, repositoryName).
+				Return(&github.Repository{Permissions: &permissions}, emptyResponse, noError)
+		}
+
+		expectSelfTest := func(failed []string) {
+			selfTests, err := store.SelfTests()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(selfTests).To(HaveLen(1))
+			Expect(selfTests[0].Repository.Name).To(Equal(repositoryName))
+			Expect(selfTests[0].RequestedBy).To(Equal(arbitraryIssueAuthor))
+			Expect(selfTests[0].Failed).To(Equal(failed))
+		}
+
+		for _, command := range []string{"!selftest", "!ping"} {
+			command := command
+
+			Context("with a "+command+" command", func() {
+				requestJSON.Is(func() string {
+					return IssueCommentEvent(command, arbitraryIssueAuthor)
+				})
+
+				It("reports that all of the checks passed", func() {
+					mockRepository(map[string]bool{"admin": true, "push": true, "pull": true})
+					gitRepos.
+						On("GetUpdatedRepo", sshURL, repositoryOwner, repositoryName).
+						Return(new(mocks.Repo), noError)
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("I have all of the access I need"))).
+						Return(emptyResult, emptyResponse, noError)
+
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertExpectations(GinkgoT())
+					expectSelfTest([]string{})
+				})
+			})
+		}
+
+		Context("with a !selftest command", func() {
+			requestJSON.Is(func() string {
+				return IssueCommentEvent("!selftest", arbitraryIssueAuthor)
+			})
+
+			It("reports the missing permissions", func() {
+				mockRepository(map[string]bool{"pull": true})
+				gitRepos.
+					On("GetUpdatedRepo", sshURL, repositoryOwner, repositoryName).
+					Return(new(mocks.Repo), errors.New("permission denied (publickey)"))
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("I'm missing some of the access I need in this "+
+							"repository: git access, labels, push, merge."))).
+					Return(emptyResult, emptyResponse, noError)
+
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+				expectSelfTest([]string{"git access", "labels", "push", "merge"})
+			})
+
+			It("fails the permission checks when the repository can't be read", func() {
+				repositories.
+					On("Get", anyContext, repositoryOwner, repositoryName).
+					Return(nil, emptyResponse, errArbitrary)
+				gitRepos.
+					On("GetUpdatedRepo", sshURL, repositoryOwner, repositoryName).
+					Return(new(mocks.Repo), noError)
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("repository access, labels, push, merge."))).
+					Return(emptyResult, emptyResponse, noError)
+
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				expectSelfTest([]string{"repository access", "labels", "push", "merge"})
+			})
+		})
+	})
+})
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+type sentryReporter struct{}
+
+func newSentryReporter(dsn, environment string) (ErrorReporter, error) {
+	err := sentry.Init(sentry.ClientOptions{
+		Dsn:         dsn,
+		Environment: environment,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize Sentry: %v", err)
+	}
+	return sentryReporter{}, nil
+}
+
+func (sentryReporter) Report(report ErrorReport) {
+	sentry.WithScope(func(scope *sentry.Scope) {
+		if report.Event != "" {
+			scope.SetTag("github.event", report.Event)
+		}
+		if report.DeliveryID != "" {
+			scope.SetTag("github.delivery", report.DeliveryID)
+		}
+		if report.Repository.Owner != "" {
+			scope.SetTag("repository", repositoryKey(report.Repository))
+		}
+		if report.PullRequest != 0 {
+			scope.SetTag("pull_request", strconv.Itoa(report.PullRequest))
+		}
+		if report.Command != "" {
+			scope.SetTag("command", report.Command)
+		}
+		scope.SetContext("response", sentry.Context{
+			"status_code": report.Code,
+			"message":     report.Message,
+		})
+		if report.Panic {
+			scope.SetLevel(sentry.LevelFatal)
+		}
+
+		err := report.Error
+		if err == nil {
+			err = errors.New(report.Message)
+		} else {
+			err = fmt.Errorf("%s: %w", report.Message, err)
+		}
+		sentry.CaptureException(err)
+	})
+}
+
+func (sentryReporter) Flush(timeout time.Duration) {
+	sentry.Flush(timeout)
+}
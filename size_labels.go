@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+const sizeLabelPrefix = "size/"
+
+// The sizes in the order of the thresholds configured for them. PRs above the
+// last threshold are the last size.
+var sizeNames = []string{"XS", "S", "M", "L", "XL"}
+
+// labelsSize reports whether updateSizeLabel would label the PR.
+func labelsSize(conf Config, pullRequestEvent PullRequestEvent) bool {
+	return conf.SizeLabels && skipLabel(conf, pullRequestEvent.HasLabel, sizeCheck) == ""
+}
+
+// getLabeledFiles fetches the PR's files for updateSizeLabel and
+// labelGeneratedPR, so that they're only fetched once per event. No files are
+// fetched if neither of them labels the PR.
+func getLabeledFiles(conf Config, pullRequestEvent PullRequestEvent, pullRequests PullRequests) (
+	[]*github.CommitFile, *ErrorResponse) {
+
+	if !labelsSize(conf, pullRequestEvent) && !labelsGenerated(conf, pullRequestEvent) {
+		return nil, nil
+	}
+	return getPRFiles(pullRequestEvent, pullRequests)
+}
+
+// updateSizeLabel labels the PR with its size, replacing the PR's previous
+// size label, if the size has changed.
+func updateSizeLabel(conf Config, pullRequestEvent PullRequestEvent, files []*github.CommitFile,
+	issues Issues) *ErrorResponse {
+
+	if !labelsSize(conf, pullRequestEvent) {
+		return nil
+	}
+	issue := pullRequestEvent.Issue()
+	label := sizeLabel(conf, files)
+	labels, errResp := getLabels(issue, issues)
+	if errResp != nil {
+		return errResp
+	}
+	hasLabel := false
+	for _, existingLabel := range labels {
+		if existingLabel == label {
+			hasLabel = true
+		} else if strings.HasPrefix(existingLabel, sizeLabelPrefix) {
+			if errResp = removeLabel(issue.Repository, issue.Number, existingLabel, issues); errResp != nil {
+				return errResp
+			}
+		}
+	}
+	if hasLabel {
+		return nil
+	}
+	log.Printf("Labeling PR %s as %s.\n", issue.FullName(), label)
+	return addLabel(issue.Repository, issue.Number, label, issues)
+}
+
+// sizeLabel picks the size by the number of changed lines or, if file
+// thresholds are configured, the number of changed files, whichever is
+// larger. Excluded and generated files count towards neither.
+func sizeLabel(conf Config, files []*github.CommitFile) string {
+	var lines, fileCount int
+	for _, file := range files {
+		if isExcludedFromSize(file.GetFilename(), conf.SizeLabelExcludedPaths) ||
+			isGeneratedPath(conf, file.GetFilename()) {
+			continue
+		}
+		lines += file.GetAdditions() + file.GetDeletions()
+		fileCount++
+	}
+	size := sizeIndex(lines, conf.SizeLabelLineThresholds)
+	if len(conf.SizeLabelFileThresholds) > 0 {
+		if fileSize := sizeIndex(fileCount, conf.SizeLabelFileThresholds); fileSize > size {
+			size = fileSize
+		}
+	}
+	return sizeLabelPrefix + sizeNames[size]
+}
+
+func sizeIndex(value int, thresholds []int) int {
+	for i, threshold := range thresholds {
+		if value <= threshold {
+			return i
+		}
+	}
+	return len(thresholds)
+}
+
+func isExcludedFromSize(file string, excludedPaths []string) bool {
+	for _, pattern := range excludedPaths {
+		if matchesPathPattern(pattern, file) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSizeThresholds parses a comma separated list of the largest values the
+// sizes other than the largest can have, e.g. "10,30,100,500".
+func parseSizeThresholds(thresholdsString string) ([]int, error) {
+	var thresholds []int
+	for _, element := range getListFromString(thresholdsString) {
+		threshold, err := strconv.Atoi(element)
+		if err != nil || threshold < 0 {
+			return nil, fmt.Errorf("thresholds must be non-negative integers, got \"%s\"", element)
+		} else if len(thresholds) > 0 && threshold <= thresholds[len(thresholds)-1] {
+			return nil, fmt.Errorf("thresholds must be in increasing order")
+		}
+		thresholds = append(thresholds, threshold)
+	}
+	if len(thresholds) != 0 && len(thresholds) != len(sizeNames)-1 {
+		return nil, fmt.Errorf("expected a threshold for each of %s", strings.Join(sizeNames[:len(sizeNames)-1], ", "))
+	}
+	return thresholds, nil
+}
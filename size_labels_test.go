@@ -0,0 +1,181 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("pull_request synchronize event with size labels", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+
+			headSHA        = "1235"
+			anyListOptions = mock.AnythingOfType("*github.ListOptions")
+
+			mockFiles = func(files ...*github.CommitFile) {
+				pullRequests.
+					On("ListFiles", anyContext, repositoryOwner, repositoryName, issueNumber, anyListOptions).
+					Return(files, emptyResponse, noError)
+			}
+			changedFile = func(name string, additions, deletions int) *github.CommitFile {
+				return &github.CommitFile{
+					Filename:  github.String(name),
+					Additions: github.Int(additions),
+					Deletions: github.Int(deletions),
+				}
+			}
+			expectLabel = func(label string) {
+				issues.
+					On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+						[]string{label}).
+					Return(emptyResult, emptyResponse, noError).
+					Once()
+			}
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+
+			conf := context.Config
+			conf.SizeLabels = true
+			conf.SizeLabelLineThresholds = []int{10, 30, 100, 500}
+
+			pullRequests.
+				On("ListCommits", anyContext, repositoryOwner, repositoryName, issueNumber, anyListOptions).
+				Return(githubCommits(commit{headSHA, "Changing things"}), emptyResponse, noError)
+			repositories.
+				On("CreateStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.Anything).
+				Return(emptyResult, emptyResponse, noError)
+		})
+
+		AfterEach(func() {
+			issues.AssertExpectations(GinkgoT())
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "pull_request",
+			}
+		})
+		requestJSON.Is(func() string {
+			return PullRequestEvent("synchronize", headSHA, grh.Repository{
+				Owner: repositoryOwner,
+				Name:  repositoryName,
+				URL:   sshURL,
+			})
+		})
+
+		Context("with a PR without a size label", func() {
+			BeforeEach(func() {
+				mockLabels(issues, issueNumber)
+				mockFiles(changedFile("main.go", 5, 3))
+			})
+
+			It("labels the PR with its size", func() {
+				expectLabel("size/XS")
+
+				handle()
+
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			})
+		})
+
+		Context("with a PR whose size has changed", func() {
+			BeforeEach(func() {
+				mockLabels(issues, issueNumber, "size/XS", grh.MergingLabel)
+				mockFiles(changedFile("main.go", 40, 20))
+			})
+
+			It("replaces the previous size label", func() {
+				issues.
+					On("RemoveLabelForIssue", anyContext, repositoryOwner, repositoryName, issueNumber, "size/XS").
+					Return(emptyResponse, noError)
+				expectLabel("size/M")
+
+				handle()
+
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			})
+		})
+
+		Context("with excluded paths", func() {
+			BeforeEach(func() {
+				context.Config.SizeLabelExcludedPaths = []string{"vendor/", "*.pb.go"}
+				mockLabels(issues, issueNumber, "size/XS")
+				mockFiles(
+					changedFile("main.go", 2, 0),
+					changedFile("vendor/lib/lib.go", 1000, 0),
+					changedFile("api/api.pb.go", 800, 200),
+				)
+			})
+
+			It("doesn't count the excluded files towards the size", func() {
+				handle()
+
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertNotCalled(GinkgoT(), "AddLabelsToIssue", anyContext, repositoryOwner, repositoryName,
+					issueNumber, mock.Anything)
+			})
+		})
+
+		Context("with generated paths", func() {
+			BeforeEach(func() {
+				context.Config.GeneratedPaths = []string{"vendor/"}
+				context.Config.GeneratedLabel = "vendored"
+				mockLabels(issues, issueNumber, "size/XS")
+				mockFiles(
+					changedFile("go.mod", 2, 1),
+					changedFile("vendor/lib/lib.go", 600, 0),
+				)
+			})
+
+			It("labels the PR dominated by them without counting them towards the size", func() {
+				expectLabel("vendored")
+
+				handle()
+
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertNotCalled(GinkgoT(), "RemoveLabelForIssue", anyContext, repositoryOwner, repositoryName,
+					issueNumber, "size/XS")
+			})
+		})
+
+		Context("with file thresholds", func() {
+			BeforeEach(func() {
+				context.Config.SizeLabelFileThresholds = []int{1, 5, 10, 20}
+				mockLabels(issues, issueNumber)
+				files := make([]*github.CommitFile, 30)
+				for i := range files {
+					files[i] = changedFile("file"+string(rune('a'+i)), 1, 0)
+				}
+				mockFiles(files...)
+			})
+
+			It("sizes the PR by the number of files, if that's larger", func() {
+				expectLabel("size/XL")
+
+				handle()
+
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			})
+		})
+	})
+})
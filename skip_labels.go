@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/evaluator"
+)
+
+// The checks SKIP_LABELS can exempt PRs from
+const (
+	squashCheck         = "squash"
+	sizeCheck           = "size"
+	commitMessagesCheck = "commit-messages"
+	signOffsCheck       = "sign-offs"
+	descriptionCheck    = "description"
+	approvalsCheck      = "approvals"
+	conversationsCheck  = "conversations"
+	filesCheck          = "files"
+	secretsCheck        = "secrets"
+)
+
+var skippableChecks = map[string]bool{
+	squashCheck:         true,
+	sizeCheck:           true,
+	commitMessagesCheck: true,
+	signOffsCheck:       true,
+	descriptionCheck:    true,
+	approvalsCheck:      true,
+	conversationsCheck:  true,
+	filesCheck:          true,
+	secretsCheck:        true,
+}
+
+// labeledIssueable is an event about a PR that includes the PR's labels.
+type labeledIssueable interface {
+	Issueable
+	HasLabel(label string) bool
+}
+
+// skipLabel returns the label that exempts the PR from the check, if the PR
+// has one of the SKIP_LABELS configured for the check, or an empty string.
+func skipLabel(conf Config, hasLabel func(string) bool, check string) string {
+	var labels []string
+	for label, checks := range conf.SkipLabels {
+		for _, skipped := range checks {
+			if skipped == check && hasLabel(label) {
+				labels = append(labels, label)
+			}
+		}
+	}
+	if len(labels) == 0 {
+		return ""
+	}
+	sort.Strings(labels)
+	return labels[0]
+}
+
+// skippedStatus reports the status as successful, because the label exempts
+// the PR from the check setting it.
+func skippedStatus(status *github.RepoStatus, label string) *github.RepoStatus {
+	status.State = github.String("success")
+	status.Description = github.String(fmt.Sprintf("Skipped, because the PR is labeled '%s'", label))
+	return status
+}
+
+// skippable passes the rule with the exemption as evidence, if the PR is
+// labeled with one of the SKIP_LABELS configured for the check, so that the
+// merge decision check run would show the exemption.
+func skippable(conf Config, pr *github.PullRequest, issues Issues, check string,
+	skippableRule evaluator.Rule) evaluator.Rule {
+
+	checkRule := skippableRule.Check
+	skippableRule.Check = func() (evaluator.Result, error) {
+		if len(conf.SkipLabels) == 0 {
+			return checkRule()
+		}
+		labels, errResp := getLabels(prIssue(pr), issues)
+		if errResp != nil {
+			return evaluator.Result{}, ruleError{errResp}
+		}
+		hasLabel := func(label string) bool { return containsLabel(labels, label) }
+		if label := skipLabel(conf, hasLabel, check); label != "" {
+			return passed(fmt.Sprintf("skipped: labeled '%s'", label)), nil
+		}
+		return checkRule()
+	}
+	return skippableRule
+}
+
+// handleSkipLabeled notes in the audit log which checks the PR was exempted
+// from by labeling it with one of the SKIP_LABELS. The statuses the bot sets
+// on the PR's head are set again, so that the exempted ones would pass. Only
+// maintainers can skip checks, so the labels are removed, if anyone else adds
+// them.
+func handleSkipLabeled(conf Config, pullRequestEvent PullRequestEvent, audit auditor, store Store,
+	issues Issues, pullRequests PullRequests, repositories Repositories, graphQL GraphQL,
+	retry retryGithubOperation) Response {
+
+	issue := pullRequestEvent.Issue()
+	checks := conf.SkipLabels[pullRequestEvent.Label]
+	if resp := refuseMaintainerOnlySkip(pullRequestEvent, issues, graphQL); resp != nil {
+		return resp
+	}
+	if skipsCheck(checks, filesCheck) {
+		if errResp := publishFileGuardCheckRun(conf, pullRequestEvent, pullRequests, graphQL); errResp != nil {
+			return errResp
+		}
+	}
+	audit.record("skip-checks", issue.Repository, issue.Number, fmt.Sprintf("%s skips %s (by %s)",
+		pullRequestEvent.Label, strings.Join(checks, ", "), pullRequestEvent.Sender.Login), nil)
+	for _, check := range checks {
+		if check == squashCheck || check == commitMessagesCheck || check == signOffsCheck {
+			return checkForFixupCommitsOnPREvent(conf, pullRequestEvent, store, pullRequests, repositories, retry)
+		}
+	}
+	return SuccessResponse{fmt.Sprintf("PR %s skips %s", issue.FullName(), strings.Join(checks, ", "))}
+}
+
+// handleSkipUnlabeled checks the PR again with the checks the removed label
+// of the SKIP_LABELS exempted it from, so that their statuses wouldn't stay
+// successful.
+func handleSkipUnlabeled(conf Config, pullRequestEvent PullRequestEvent, store Store, issues Issues,
+	pullRequests PullRequests, repositories Repositories, graphQL GraphQL, retry retryGithubOperation) Response {
+
+	issue := pullRequestEvent.Issue()
+	checks := conf.SkipLabels[pullRequestEvent.Label]
+	if skipsCheck(checks, filesCheck) {
+		if errResp := publishFileGuardCheckRun(conf, pullRequestEvent, pullRequests, graphQL); errResp != nil {
+			return errResp
+		}
+	}
+	for _, check := range checks {
+		if check == squashCheck || check == commitMessagesCheck || check == signOffsCheck {
+			return checkForFixupCommitsOnPREvent(conf, pullRequestEvent, store, pullRequests, repositories, retry)
+		}
+	}
+	return SuccessResponse{fmt.Sprintf("PR %s no longer skips %s", issue.FullName(), strings.Join(checks, ", "))}
+}
+
+// isSkipLabel checks whether the label is one of the SKIP_LABELS.
+func isSkipLabel(conf Config, label string) bool {
+	return len(conf.SkipLabels[label]) > 0
+}
+
+// isMaintainer checks whether the user has the maintain role or higher in the
+// repository.
+func isMaintainer(repository Repository, login string, graphQL GraphQL) (bool, error) {
+	role, err := collaboratorRole(repository, login, graphQL)
+	if err != nil {
+		return false, err
+	}
+	return roleRank(role) >= roleRank("maintain"), nil
+}
+
+func skipsCheck(checks []string, check string) bool {
+	for _, skipped := range checks {
+		if skipped == check {
+			return true
+		}
+	}
+	return false
+}
+
+// refuseMaintainerOnlySkip removes a label skipping checks, if the user who
+// added it isn't a maintainer, and explains why in a comment. It returns nil,
+// if the label stays. Labels added with !label are added by the bot, whose
+// commenter handleLabelCommand has already checked.
+func refuseMaintainerOnlySkip(pullRequestEvent PullRequestEvent, issues Issues, graphQL GraphQL) Response {
+	issue := pullRequestEvent.Issue()
+	sender := pullRequestEvent.Sender.Login
+	isAllowed, err := isMaintainer(issue.Repository, sender, graphQL)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Failed to check if %s can skip the checks of PR %s", sender, issue.FullName())
+		return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	} else if isAllowed {
+		return nil
+	}
+	if errResp := removeLabel(issue.Repository, issue.Number, pullRequestEvent.Label, issues); errResp != nil {
+		return errResp
+	}
+	message := fmt.Sprintf("@%s, only maintainers can add the '%s' label, because it skips checks, so I removed it.",
+		sender, pullRequestEvent.Label)
+	if err = comment(message, issue.Repository, issue.Number, issues); err != nil {
+		errorMessage := fmt.Sprintf("Failed to explain the removal of the '%s' label from PR %s",
+			pullRequestEvent.Label, issue.FullName())
+		return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	return SuccessResponse{fmt.Sprintf("Removed the '%s' label added by %s from PR %s", pullRequestEvent.Label,
+		sender, issue.FullName())}
+}
@@ -0,0 +1,162 @@
+package main_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("SKIP_LABELS", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			graphQL          *mocks.GraphQL
+
+			headSHA        = "1235"
+			baseRepository = grh.Repository{Owner: repositoryOwner, Name: repositoryName, URL: sshURL}
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			graphQL = *context.GraphQL
+			context.Config.SkipLabels = map[string][]string{"vendored": {"squash", "size"}}
+
+			pullRequests.
+				On("ListCommits", anyContext, repositoryOwner, repositoryName, issueNumber,
+					mock.AnythingOfType("*github.ListOptions")).
+				Return(githubCommits(
+					commit{arbitrarySHA, "Update the vendored dependencies"},
+					commit{headSHA, "fixup! Update the vendored dependencies"},
+				), emptyResponse, noError)
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "pull_request",
+			}
+		})
+
+		expectSquashStatus := func(state string) {
+			repositories.
+				On("CreateStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+					mock.MatchedBy(func(status *github.RepoStatus) bool {
+						return *status.State == state && *status.Context == "review/squash"
+					}),
+				).
+				Return(emptyResult, emptyResponse, noError).
+				Once()
+		}
+
+		Context("with the PR being labeled with a skip label", func() {
+			requestJSON.Is(func() string {
+				event := LabeledPullRequestEvent("labeled", headSHA, baseRepository, "vendored")
+				return strings.Replace(event, `"action": "labeled",`, `"action": "labeled",
+  "label": {"name": "vendored"},
+  "sender": {"login": "procoder"},`, 1)
+			})
+
+			BeforeEach(func() {
+				data, err := json.Marshal(map[string]interface{}{
+					"repository": map[string]interface{}{
+						"collaborators": map[string]interface{}{
+							"edges": []interface{}{
+								map[string]interface{}{
+									"permission": "MAINTAIN",
+									"node":       map[string]string{"login": "procoder"},
+								},
+							},
+						},
+					},
+				})
+				Expect(err).NotTo(HaveOccurred())
+				graphQL.
+					On("Query", anyContext, mock.MatchedBy(func(q string) bool {
+						return strings.Contains(q, "collaborators")
+					}), mock.Anything, mock.Anything).
+					Return(noError).
+					Run(func(args mock.Arguments) {
+						Expect(json.Unmarshal(data, args.Get(3))).To(Succeed())
+					})
+				expectSquashStatus("success")
+			})
+
+			It("passes the skipped squash check and records the exemption", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+
+				entries, err := (*context.AuditLog).Entries(grh.AuditFilter{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(entries).To(ContainElement(WithTransform(func(entry grh.AuditEntry) string {
+					return entry.Action + ": " + entry.Details
+				}, Equal("skip-checks: vendored skips squash, size (by procoder)"))))
+			})
+		})
+
+		Context("with the skip label being removed", func() {
+			requestJSON.Is(func() string {
+				event := LabeledPullRequestEvent("unlabeled", headSHA, baseRepository, "bug")
+				return strings.Replace(event, `"action": "unlabeled",`, `"action": "unlabeled",
+  "label": {"name": "vendored"},`, 1)
+			})
+
+			BeforeEach(func() {
+				expectSquashStatus("pending")
+			})
+
+			It("checks the PR again with the skipped check", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				repositories.AssertExpectations(GinkgoT())
+			})
+		})
+
+		Context("with a skip-labeled PR being synchronized", func() {
+			requestJSON.Is(func() string {
+				return LabeledPullRequestEvent("synchronize", headSHA, baseRepository, "vendored")
+			})
+
+			BeforeEach(func() {
+				context.Config.SizeLabels = true
+				expectSquashStatus("success")
+			})
+
+			It("doesn't require the PR to be squashed or labeled with its size", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				pullRequests.AssertNotCalled(GinkgoT(), "ListFiles", anyContext, repositoryOwner, repositoryName,
+					issueNumber, mock.Anything)
+			})
+		})
+
+		Context("with a PR without skip labels being synchronized", func() {
+			requestJSON.Is(func() string {
+				return LabeledPullRequestEvent("synchronize", headSHA, baseRepository, "bug")
+			})
+
+			BeforeEach(func() {
+				expectSquashStatus("pending")
+			})
+
+			It("requires the PR to be squashed", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			})
+		})
+	})
+})
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/git"
+)
+
+const (
+	confirmMergeAction  = "merge"
+	confirmSquashAction = "squash"
+)
+
+// unconfirmedActions counts the actions held back for a confirmation in
+// repositories in their soft-fail period by repository. Reported by
+// /debug/vars.
+var unconfirmedActions = expvar.NewMap("unconfirmed_actions")
+
+func isConfirmCommand(comment string) bool {
+	return strings.TrimSpace(comment) == "!confirm"
+}
+
+// isInSoftFailPeriod reports whether the repository was onboarded less than
+// conf.SoftFailPeriod ago. Repositories are onboarded when the bot first
+// gets their configuration while the soft-fail period is enabled.
+func isInSoftFailPeriod(conf Config, repository Repository, store Store) (bool, *ErrorResponse) {
+	if conf.SoftFailPeriod == 0 {
+		return false, nil
+	}
+	onboardedAt, err := store.OnboardRepository(repository, time.Now())
+	if err != nil {
+		message := fmt.Sprintf("Failed to get the onboarding time of %s", repositoryKey(repository))
+		return false, &ErrorResponse{err, http.StatusInternalServerError, message}
+	}
+	return time.Since(onboardedAt) < conf.SoftFailPeriod, nil
+}
+
+// requestConfirmation describes the action the bot would take on the PR and
+// asks for a !confirm before taking it. The action is described only once,
+// even if the bot would take it again, e.g. for every status update. The
+// command the action was requested with, if any, is kept for when it's
+// confirmed. With REACTION_CONFIRMERS, the action can also be confirmed by
+// reacting to the bot's comment. Merges are described with the PR's merge
+// method, e.g. as a rebase and merge.
+func requestConfirmation(conf Config, issue Issue, action, command string, store Store,
+	issues Issues) *ErrorResponse {
+
+	pending, exists, err := store.PendingConfirmation(issue.Repository, issue.Number)
+	if err != nil {
+		message := fmt.Sprintf("Failed to get the pending confirmation of PR %s", issue.FullName())
+		return &ErrorResponse{err, http.StatusInternalServerError, message}
+	} else if exists && pending.Action == action {
+		return nil
+	}
+	description := action
+	if action == confirmMergeAction {
+		method, err := store.MergeMethod(issue)
+		if err != nil {
+			message := fmt.Sprintf("Failed to get the merge method of PR %s", issue.FullName())
+			return &ErrorResponse{err, http.StatusInternalServerError, message}
+		}
+		description = mergeMethodVerb(method)
+	}
+	unconfirmedActions.Add(repositoryKey(issue.Repository), 1)
+	log.Printf("Would %s PR %s, but the repository is in its soft-fail period. Asking for a confirmation.\n",
+		description, issue.FullName())
+	message := fmt.Sprintf("I would %s this PR now, but I'm still being tried out in this repository, so I "+
+		"won't do it on my own. Comment `!confirm` to have me %s it.", description, description)
+	if len(conf.ReactionConfirmers) > 0 {
+		message += fmt.Sprintf(" %s can also react with %s to this comment instead.",
+			mentions(conf.ReactionConfirmers), reactionShortcodes[conf.ConfirmationReaction])
+	}
+	confirmationComment, _, err := issues.CreateComment(context.TODO(), issue.Repository.Owner,
+		issue.Repository.Name, issue.Number, &github.IssueComment{Body: github.String(message)})
+	if err != nil {
+		errorMessage := fmt.Sprintf("Failed to ask for a confirmation on PR %s", issue.FullName())
+		return &ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	err = store.SetPendingConfirmation(PendingConfirmation{
+		Repository:  issue.Repository,
+		PullRequest: issue.Number,
+		Action:      action,
+		Command:     command,
+		CommentID:   confirmationComment.GetID(),
+		CreatedAt:   time.Now(),
+	})
+	if err != nil {
+		message := fmt.Sprintf("Failed to store the pending confirmation of PR %s", issue.FullName())
+		return &ErrorResponse{err, http.StatusInternalServerError, message}
+	}
+	return nil
+}
+
+// confirmedWithReaction reports whether one of REACTION_CONFIRMERS has
+// reacted with CONFIRMATION_REACTION to the bot's comment asking for the
+// action to be confirmed. GitHub doesn't send webhooks for reactions, so they
+// are looked up whenever the bot would take the action again. A confirmed
+// action is no longer pending, but the pending confirmation is returned for
+// the command the action was requested with.
+func confirmedWithReaction(conf Config, issue Issue, action string, store Store,
+	graphQL GraphQL) (PendingConfirmation, bool, *ErrorResponse) {
+
+	if len(conf.ReactionConfirmers) == 0 {
+		return PendingConfirmation{}, false, nil
+	}
+	pending, exists, err := store.PendingConfirmation(issue.Repository, issue.Number)
+	if err != nil {
+		message := fmt.Sprintf("Failed to get the pending confirmation of PR %s", issue.FullName())
+		return PendingConfirmation{}, false, &ErrorResponse{err, http.StatusInternalServerError, message}
+	} else if !exists || pending.Action != action || pending.CommentID == 0 {
+		return PendingConfirmation{}, false, nil
+	}
+	reactors, errResp := listReactors(issue, pending.CommentID, conf.ConfirmationReaction, graphQL)
+	if errResp != nil {
+		return PendingConfirmation{}, false, errResp
+	}
+	for _, reactor := range reactors {
+		if !isReactionConfirmer(conf, reactor) {
+			continue
+		}
+		if err = store.RemovePendingConfirmation(issue.Repository, issue.Number); err != nil {
+			message := fmt.Sprintf("Failed to remove the pending confirmation of PR %s", issue.FullName())
+			return PendingConfirmation{}, false, &ErrorResponse{err, http.StatusInternalServerError, message}
+		}
+		log.Printf("%s confirmed the %s of PR %s with a reaction.\n", reactor, action, issue.FullName())
+		return pending, true, nil
+	}
+	return PendingConfirmation{}, false, nil
+}
+
+func isReactionConfirmer(conf Config, login string) bool {
+	for _, confirmer := range conf.ReactionConfirmers {
+		if strings.EqualFold(confirmer, login) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleConfirmCommand takes the action that's waiting for a confirmation on
+// the PR. The PR is checked again, because it may have changed since the
+// action was held back. Two-person merges stay pending until the PR is
+// merged, so that the confirmation wouldn't be asked for again.
+func handleConfirmCommand(conf Config, issueComment IssueComment, store Store, issues Issues,
+	pullRequests PullRequests, repositories Repositories, graphQL GraphQL, gitRepos git.Repos) Response {
+
+	issue := issueComment.Issue()
+	pending, exists, err := store.PendingConfirmation(issue.Repository, issue.Number)
+	if err != nil {
+		message := fmt.Sprintf("Failed to get the pending confirmation of PR %s", issue.FullName())
+		return ErrorResponse{err, http.StatusInternalServerError, message}
+	} else if !exists {
+		message := fmt.Sprintf("@%s, there's nothing waiting for a confirmation on this PR.",
+			issueComment.Commenter.Login)
+		if err = comment(message, issue.Repository, issue.Number, issues); err != nil {
+			errorMessage := fmt.Sprintf("Failed to respond to an unexpected confirmation on PR %s",
+				issue.FullName())
+			return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+		}
+		return SuccessResponse{"Nothing to confirm. Responded with a comment."}
+	}
+	if pending.Action == confirmTwoPersonMergeAction {
+		return confirmTwoPersonMerge(conf, issueComment, pending, store, issues, pullRequests, repositories, graphQL,
+			gitRepos)
+	}
+	if err = store.RemovePendingConfirmation(issue.Repository, issue.Number); err != nil {
+		message := fmt.Sprintf("Failed to remove the pending confirmation of PR %s", issue.FullName())
+		return ErrorResponse{err, http.StatusInternalServerError, message}
+	}
+	log.Printf("%s confirmed the %s of PR %s.\n", issueComment.Commenter.Login, pending.Action, issue.FullName())
+	// The confirmation is only for this action
+	conf.SoftFail = false
+	if pending.Action == confirmSquashAction {
+		return handleSquashCommand(conf, issueComment, pending.Command, store, gitRepos, pullRequests,
+			repositories, issues)
+	} else if !issueComment.HasLabel(MergingLabel) {
+		return SuccessResponse{fmt.Sprintf("PR %s is no longer labeled with '%s'. Ignoring.", issue.FullName(),
+			MergingLabel)}
+	}
+	return mergeIfReady(conf, issue, true, store, issues, pullRequests, repositories, graphQL, gitRepos)
+}
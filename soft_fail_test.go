@@ -0,0 +1,315 @@
+package main_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("soft-fail period", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			store            grh.Store
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+			gitRepos         *mocks.Repos
+			graphQL          *mocks.GraphQL
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			store = *context.Store
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+			gitRepos = *context.GitRepos
+			graphQL = *context.GraphQL
+
+			context.Config.SoftFailPeriod = 14 * 24 * time.Hour
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+
+		headSHA := "1235"
+		pr := &github.PullRequest{
+			Number:    github.Int(issueNumber),
+			Merged:    github.Bool(false),
+			Mergeable: github.Bool(true),
+			Base: &github.PullRequestBranch{
+				SHA:  github.String("1234"),
+				Ref:  github.String("master"),
+				Repo: repository,
+			},
+			Head: &github.PullRequestBranch{
+				SHA:  github.String(headSHA),
+				Ref:  github.String("feature"),
+				Repo: repository,
+			},
+			User: &github.User{
+				Login: github.String(arbitraryIssueAuthor),
+			},
+		}
+
+		BeforeEach(func() {
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+		})
+
+		mockReadyPR := func() {
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+				Return(pr, emptyResponse, noError)
+			repositories.
+				On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.AnythingOfType("*github.ListOptions")).
+				Return(&github.CombinedStatus{
+					State: github.String("success"),
+				}, emptyResponse, noError)
+			mockLabels(issues, issueNumber, grh.MergingLabel)
+		}
+
+		mockMerge := func() {
+			pullRequests.
+				On("Merge", anyContext, repositoryOwner, repositoryName, issueNumber, "", noSquashOpts).
+				Return(&github.PullRequestMergeResult{Merged: github.Bool(true)}, emptyResponse, noError)
+			issues.
+				On("RemoveLabelForIssue", anyContext, repositoryOwner, repositoryName, issueNumber, grh.MergingLabel).
+				Return(emptyResponse, noError)
+			gitRepo := new(mocks.Repo)
+			gitRepos.
+				On("GetUpdatedRepo", sshURL, repositoryOwner, repositoryName).
+				Return(gitRepo, noError)
+			gitRepo.On("DeleteRemoteBranch", "feature").Return(noError)
+		}
+
+		Context("with a !merge command", func() {
+			requestJSON.Is(func() string {
+				return IssueCommentEvent("!merge", arbitraryIssueAuthor)
+			})
+
+			BeforeEach(func() {
+				issues.
+					On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{grh.MergingLabel}).
+					Return(emptyResult, emptyResponse, noError)
+				mockReadyPR()
+			})
+
+			It("asks for a confirmation instead of merging the PR", func() {
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("Comment `!confirm` to have me merge it"))).
+					Return(emptyResult, emptyResponse, noError).
+					Once()
+
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				issues.AssertExpectations(GinkgoT())
+				pullRequests.AssertNotCalled(GinkgoT(), "Merge", anyContext, repositoryOwner, repositoryName,
+					issueNumber, "", noSquashOpts)
+
+				confirmation, exists, err := store.PendingConfirmation(grh.Repository{Owner: repositoryOwner,
+					Name: repositoryName}, issueNumber)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(exists).To(BeTrue())
+				Expect(confirmation.Action).To(Equal("merge"))
+			})
+
+			Context("with the rebase method", func() {
+				requestJSON.Is(func() string {
+					return IssueCommentEvent("!merge rebase", arbitraryIssueAuthor)
+				})
+
+				BeforeEach(func() {
+					repositories.
+						On("Get", anyContext, repositoryOwner, repositoryName).
+						Return(&github.Repository{AllowRebaseMerge: github.Bool(true)}, emptyResponse, noError)
+				})
+
+				It("asks for a confirmation instead of rebasing and merging the PR", func() {
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("Comment `!confirm` to have me rebase and merge it"))).
+						Return(emptyResult, emptyResponse, noError).
+						Once()
+
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertExpectations(GinkgoT())
+					pullRequests.AssertNotCalled(GinkgoT(), "Merge", anyContext, repositoryOwner, repositoryName,
+						issueNumber, mock.Anything, &github.PullRequestOptions{MergeMethod: "rebase"})
+				})
+			})
+
+			Context("after the soft-fail period", func() {
+				BeforeEach(func() {
+					_, err := store.OnboardRepository(grh.Repository{Owner: repositoryOwner, Name: repositoryName},
+						time.Now().Add(-15*24*time.Hour))
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				It("merges the PR", func() {
+					mockMerge()
+
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					pullRequests.AssertExpectations(GinkgoT())
+				})
+			})
+		})
+
+		Context("with a merge waiting for a confirmation with REACTION_CONFIRMERS", func() {
+			confirmationCommentID := 42
+
+			requestJSON.Is(func() string {
+				return IssueCommentEvent("!merge", arbitraryIssueAuthor)
+			})
+
+			mockReactions := func(logins ...string) {
+				reactions := make([]interface{}, len(logins))
+				for i, login := range logins {
+					reactions[i] = map[string]interface{}{"user": map[string]string{"login": login}}
+				}
+				result, err := json.Marshal(map[string]interface{}{
+					"repository": map[string]interface{}{
+						"pullRequest": map[string]interface{}{
+							"comments": map[string]interface{}{
+								"nodes": []interface{}{
+									map[string]interface{}{
+										"databaseId": confirmationCommentID,
+										"reactions":  map[string]interface{}{"nodes": reactions},
+									},
+								},
+							},
+						},
+					},
+				})
+				Expect(err).NotTo(HaveOccurred())
+				graphQL.
+					On("Query", anyContext, mock.AnythingOfType("string"), mock.MatchedBy(
+						func(variables map[string]interface{}) bool {
+							return variables["content"] == "ROCKET"
+						}), mock.Anything).
+					Return(noError).
+					Run(func(args mock.Arguments) {
+						Expect(json.Unmarshal(result, args.Get(3))).To(Succeed())
+					})
+			}
+
+			BeforeEach(func() {
+				context.Config.ReactionConfirmers = []string{"maintainer"}
+				context.Config.ConfirmationReaction = "rocket"
+				err := store.SetPendingConfirmation(grh.PendingConfirmation{
+					Repository:  grh.Repository{Owner: repositoryOwner, Name: repositoryName},
+					PullRequest: issueNumber,
+					Action:      "merge",
+					CommentID:   confirmationCommentID,
+					CreatedAt:   time.Now(),
+				})
+				Expect(err).NotTo(HaveOccurred())
+				issues.
+					On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{grh.MergingLabel}).
+					Return(emptyResult, emptyResponse, noError)
+				mockReadyPR()
+			})
+
+			Context("with a configured maintainer having reacted", func() {
+				BeforeEach(func() {
+					mockReactions(arbitraryIssueAuthor, "Maintainer")
+					mockMerge()
+				})
+
+				It("merges the PR", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					pullRequests.AssertExpectations(GinkgoT())
+				})
+			})
+
+			Context("with only others having reacted", func() {
+				BeforeEach(func() {
+					mockReactions(arbitraryIssueAuthor)
+				})
+
+				It("keeps waiting for the confirmation", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					pullRequests.AssertNotCalled(GinkgoT(), "Merge", anyContext, repositoryOwner, repositoryName,
+						issueNumber, "", noSquashOpts)
+
+					_, exists, err := store.PendingConfirmation(grh.Repository{Owner: repositoryOwner,
+						Name: repositoryName}, issueNumber)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(exists).To(BeTrue())
+				})
+			})
+		})
+
+		Context("with a !confirm command", func() {
+			Context("with a merge waiting for a confirmation", func() {
+				requestJSON.Is(func() string {
+					return IssueCommentEventWithLabels("!confirm", arbitraryIssueAuthor, []string{grh.MergingLabel})
+				})
+
+				BeforeEach(func() {
+					err := store.SetPendingConfirmation(grh.PendingConfirmation{
+						Repository:  grh.Repository{Owner: repositoryOwner, Name: repositoryName},
+						PullRequest: issueNumber,
+						Action:      "merge",
+						CreatedAt:   time.Now(),
+					})
+					Expect(err).NotTo(HaveOccurred())
+					mockReadyPR()
+					mockMerge()
+				})
+
+				It("merges the PR", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					pullRequests.AssertExpectations(GinkgoT())
+
+					_, exists, err := store.PendingConfirmation(grh.Repository{Owner: repositoryOwner,
+						Name: repositoryName}, issueNumber)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(exists).To(BeFalse())
+				})
+			})
+
+			Context("with nothing waiting for a confirmation", func() {
+				requestJSON.Is(func() string {
+					return withCommenter(IssueCommentEvent("!confirm", arbitraryIssueAuthor), "reviewer")
+				})
+
+				BeforeEach(func() {
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("@reviewer, there's nothing waiting for a confirmation"))).
+						Return(emptyResult, emptyResponse, noError)
+				})
+
+				It("tells the commenter so", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertExpectations(GinkgoT())
+				})
+			})
+		})
+	})
+})
@@ -0,0 +1,609 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	// Registers the "sqlite3" database/sql driver
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS store_collections (
+  name TEXT PRIMARY KEY,
+  data TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS audit_entries (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  repository TEXT NOT NULL,
+  pull_request INTEGER NOT NULL,
+  entry TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS audit_entries_pull_request ON audit_entries (repository, pull_request);
+CREATE TABLE IF NOT EXISTS deliveries (
+  namespace TEXT NOT NULL,
+  id TEXT NOT NULL,
+  expires_at INTEGER NOT NULL,
+  PRIMARY KEY (namespace, id)
+);`
+
+// openSQLite opens the SQLite file at the path, creating it and the bot's
+// tables, if they don't exist yet. Writers wait for each other instead of
+// failing with "database is locked", because the store and the audit log
+// share the file.
+func openSQLite(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	if _, err = db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create the tables in %s: %v", path, err)
+	}
+	return db, nil
+}
+
+// sqliteStore keeps the state of a memoryStore in an SQLite file, so that the
+// queue, the scheduled jobs and the other state survive restarts without an
+// external database. Reads are served from memory, while every change is
+// written through to the file before it's acknowledged. Each collection,
+// e.g. all of the reminders, is saved as a whole, but only when it changed,
+// which is plenty for the single instance deployments the file is meant for.
+// The claimed webhook deliveries are the exception: every webhook claims one,
+// so they're saved a row at a time.
+type sqliteStore struct {
+	*memoryStore
+	db *sql.DB
+	// namespace separates the state of the providers sharing the file, see
+	// NewProviderStore. GitHub's state has none.
+	namespace string
+	// saveMutex keeps the saves in the same order as the changes they save
+	saveMutex sync.Mutex
+	// saved maps the names of the collections to their data in the file
+	saved map[string]string
+}
+
+// NewSQLiteStore creates a Store that keeps its state in the SQLite file at
+// the path and loads the state saved there earlier.
+func NewSQLiteStore(path string) (Store, error) {
+	return newSQLiteStore(path, "")
+}
+
+func newSQLiteStore(path, namespace string) (Store, error) {
+	db, err := openSQLite(path)
+	if err != nil {
+		return nil, err
+	}
+	store := &sqliteStore{
+		memoryStore: NewMemoryStore().(*memoryStore),
+		db:          db,
+		namespace:   namespace,
+		saved:       make(map[string]string),
+	}
+	if err = store.load(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to load the state from %s: %v", path, err)
+	}
+	return store, nil
+}
+
+// persistentCollections returns pointers to the state that's saved, keyed by
+// the names it's saved under. The cached owners files aren't saved, because
+// they're read again when needed, and the claimed deliveries are saved in a
+// table of their own.
+func (s *memoryStore) persistentCollections() map[string]interface{} {
+	return map[string]interface{}{
+		"bot_branches":             &s.botBranches,
+		"review_requests":          &s.reviewRequests,
+		"deferred_merges":          &s.deferredMerges,
+		"merge_methods":            &s.mergeMethods,
+		"merge_messages":           &s.mergeMessages,
+		"head_sign_off_waivers":    &s.signOffWaivers,
+		"merge_queue_entries":      &s.mergeQueueEntries,
+		"merge_requests":           &s.mergeRequests,
+		"force_waits":              &s.forceWaits,
+		"scheduled_merges":         &s.scheduledMerges,
+		"pending_reruns":           &s.pendingReruns,
+		"sticky_comments":          &s.stickyComments,
+		"command_stats":            &s.commandStats,
+		"refusals":                 &s.refusals,
+		"status_overrides":         &s.statusOverrides,
+		"validations":              &s.validations,
+		"notifications":            &s.notifications,
+		"reminders":                &s.reminders,
+		"last_assigned_reviewers":  &s.lastAssignedReviewers,
+		"onboarded_at":             &s.onboardedAt,
+		"pending_confirmations":    &s.pendingConfirmations,
+		"policies":                 &s.policies,
+		"organization_policies":    &s.orgPolicies,
+		"self_tests":               &s.selfTests,
+		"failed_deliveries":        &s.failedDeliveries,
+		"deployments":              &s.deployments,
+		"bus_events":               &s.busEvents,
+		"dead_lettered_bus_events": &s.deadLetteredBusEvents,
+		"blocks":                   &s.blocks,
+		"dependencies":             &s.dependencies,
+		"first_time_contributions": &s.firstTimeContributions,
+	}
+}
+
+func (s *sqliteStore) load() error {
+	rows, err := s.db.Query(`SELECT name, data FROM store_collections`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	s.memoryStore.Lock()
+	defer s.memoryStore.Unlock()
+	collections := s.memoryStore.persistentCollections()
+	for rows.Next() {
+		var name, data string
+		if err = rows.Scan(&name, &data); err != nil {
+			return err
+		}
+		namespace := ""
+		if i := strings.Index(name, ":"); i >= 0 {
+			namespace, name = name[:i], name[i+1:]
+		}
+		if namespace != s.namespace {
+			continue
+		}
+		collection, known := collections[name]
+		if name == "deliveries" {
+			// Saved as a collection by earlier versions. The claims expire
+			// soon enough to be dropped.
+			continue
+		} else if !known {
+			log.Printf("Ignoring the unknown collection %s in the SQLite store.\n", name)
+			continue
+		} else if err = json.Unmarshal([]byte(data), collection); err != nil {
+			return fmt.Errorf("failed to decode the %s: %v", name, err)
+		}
+		s.saved[name] = data
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	return s.loadDeliveries()
+}
+
+func (s *sqliteStore) loadDeliveries() error {
+	rows, err := s.db.Query(`SELECT id, expires_at FROM deliveries WHERE namespace = ?`, s.namespace)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var expiresAt int64
+		if err = rows.Scan(&id, &expiresAt); err != nil {
+			return err
+		}
+		s.memoryStore.deliveries[id] = time.Unix(0, expiresAt)
+	}
+	return rows.Err()
+}
+
+// save makes the change in memory and then writes the collections it may
+// have changed to the file, skipping the ones that are still the same as in
+// the file. If writing fails, the change is kept in memory, but the error
+// is returned, so that the webhook or the job making it would fail.
+func (s *sqliteStore) save(change func() error, names ...string) error {
+	s.saveMutex.Lock()
+	defer s.saveMutex.Unlock()
+
+	if err := change(); err != nil {
+		return err
+	}
+	data := make(map[string]string, len(names))
+	s.memoryStore.Lock()
+	collections := s.memoryStore.persistentCollections()
+	for _, name := range names {
+		encoded, err := json.Marshal(collections[name])
+		if err != nil {
+			s.memoryStore.Unlock()
+			return fmt.Errorf("failed to encode the %s: %v", name, err)
+		}
+		if string(encoded) != s.saved[name] {
+			data[name] = string(encoded)
+		}
+	}
+	s.memoryStore.Unlock()
+	if len(data) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to save the %v: %v", names, err)
+	}
+	for name, encoded := range data {
+		_, err = tx.Exec(`INSERT OR REPLACE INTO store_collections (name, data) VALUES (?, ?)`,
+			s.collectionName(name), encoded)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to save the %s: %v", name, err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to save the %v: %v", names, err)
+	}
+	for name, encoded := range data {
+		s.saved[name] = encoded
+	}
+	return nil
+}
+
+// collectionName returns the name the collection is saved under in the
+// store's namespace.
+func (s *sqliteStore) collectionName(name string) string {
+	if s.namespace == "" {
+		return name
+	}
+	return s.namespace + ":" + name
+}
+
+func (s *sqliteStore) AddBotBranch(branch BotBranch) error {
+	return s.save(func() error { return s.memoryStore.AddBotBranch(branch) }, "bot_branches")
+}
+
+func (s *sqliteStore) RemoveBotBranch(repository Repository, name string) error {
+	return s.save(func() error { return s.memoryStore.RemoveBotBranch(repository, name) }, "bot_branches")
+}
+
+func (s *sqliteStore) AddReviewRequest(request ReviewRequest) error {
+	return s.save(func() error { return s.memoryStore.AddReviewRequest(request) }, "review_requests")
+}
+
+func (s *sqliteStore) CompleteReviewRequest(repository Repository, pullRequest int, reviewer string,
+	respondedAt time.Time) error {
+
+	return s.save(func() error {
+		return s.memoryStore.CompleteReviewRequest(repository, pullRequest, reviewer, respondedAt)
+	}, "review_requests")
+}
+
+func (s *sqliteStore) RemoveReviewRequest(repository Repository, pullRequest int, reviewer string) error {
+	return s.save(func() error {
+		return s.memoryStore.RemoveReviewRequest(repository, pullRequest, reviewer)
+	}, "review_requests")
+}
+
+func (s *sqliteStore) RemoveReviewRequests(repository Repository, pullRequest int) error {
+	return s.save(func() error {
+		return s.memoryStore.RemoveReviewRequests(repository, pullRequest)
+	}, "review_requests")
+}
+
+func (s *sqliteStore) AddDeferredMerge(issue Issue) error {
+	return s.save(func() error { return s.memoryStore.AddDeferredMerge(issue) }, "deferred_merges")
+}
+
+func (s *sqliteStore) RemoveDeferredMerge(issue Issue) error {
+	return s.save(func() error { return s.memoryStore.RemoveDeferredMerge(issue) }, "deferred_merges")
+}
+
+func (s *sqliteStore) SetMergeMethod(issue Issue, method string) error {
+	return s.save(func() error { return s.memoryStore.SetMergeMethod(issue, method) }, "merge_methods")
+}
+
+func (s *sqliteStore) SetMergeMessage(issue Issue, message string) error {
+	return s.save(func() error { return s.memoryStore.SetMergeMessage(issue, message) }, "merge_messages")
+}
+
+func (s *sqliteStore) SetSignOffWaiver(issue Issue, waiver SignOffWaiver) error {
+	return s.save(func() error { return s.memoryStore.SetSignOffWaiver(issue, waiver) }, "head_sign_off_waivers")
+}
+
+func (s *sqliteStore) RecordRefusal(issue Issue, reason string) (bool, error) {
+	var isNew bool
+	err := s.save(func() (err error) {
+		isNew, err = s.memoryStore.RecordRefusal(issue, reason)
+		return err
+	}, "refusals")
+	return isNew, err
+}
+
+func (s *sqliteStore) RemoveRefusals(issue Issue) error {
+	return s.save(func() error { return s.memoryStore.RemoveRefusals(issue) }, "refusals")
+}
+
+func (s *sqliteStore) SetMergeQueueEntry(entry MergeQueueEntry) error {
+	return s.save(func() error { return s.memoryStore.SetMergeQueueEntry(entry) }, "merge_queue_entries")
+}
+
+func (s *sqliteStore) RemoveMergeQueueEntry(issue Issue) error {
+	return s.save(func() error { return s.memoryStore.RemoveMergeQueueEntry(issue) }, "merge_queue_entries")
+}
+
+func (s *sqliteStore) AddMergeRequest(request MergeRequest) error {
+	return s.save(func() error { return s.memoryStore.AddMergeRequest(request) }, "merge_requests")
+}
+
+func (s *sqliteStore) RemoveMergeRequest(issue Issue) error {
+	return s.save(func() error { return s.memoryStore.RemoveMergeRequest(issue) }, "merge_requests")
+}
+
+func (s *sqliteStore) AddForceWait(wait ForceWait) error {
+	return s.save(func() error { return s.memoryStore.AddForceWait(wait) }, "force_waits")
+}
+
+func (s *sqliteStore) RemoveForceWait(issue Issue) error {
+	return s.save(func() error { return s.memoryStore.RemoveForceWait(issue) }, "force_waits")
+}
+
+func (s *sqliteStore) AddScheduledMerge(scheduled ScheduledMerge) error {
+	return s.save(func() error { return s.memoryStore.AddScheduledMerge(scheduled) }, "scheduled_merges")
+}
+
+func (s *sqliteStore) RemoveScheduledMerge(issue Issue) error {
+	return s.save(func() error { return s.memoryStore.RemoveScheduledMerge(issue) }, "scheduled_merges")
+}
+
+func (s *sqliteStore) SetPendingRerun(rerun PendingRerun) error {
+	return s.save(func() error { return s.memoryStore.SetPendingRerun(rerun) }, "pending_reruns")
+}
+
+func (s *sqliteStore) RemovePendingRerun(issue Issue) error {
+	return s.save(func() error { return s.memoryStore.RemovePendingRerun(issue) }, "pending_reruns")
+}
+
+func (s *sqliteStore) SetStickyComment(comment StickyComment) error {
+	return s.save(func() error { return s.memoryStore.SetStickyComment(comment) }, "sticky_comments")
+}
+
+func (s *sqliteStore) RemoveStickyComment(issue Issue) error {
+	return s.save(func() error { return s.memoryStore.RemoveStickyComment(issue) }, "sticky_comments")
+}
+
+func (s *sqliteStore) RecordCommandUse(repository Repository, command, outcome string, at time.Time) error {
+	return s.save(func() error {
+		return s.memoryStore.RecordCommandUse(repository, command, outcome, at)
+	}, "command_stats")
+}
+
+func (s *sqliteStore) AddStatusOverride(override StatusOverride) error {
+	return s.save(func() error { return s.memoryStore.AddStatusOverride(override) }, "status_overrides")
+}
+
+func (s *sqliteStore) RemoveStatusOverrides(repository Repository, pullRequest int) error {
+	return s.save(func() error {
+		return s.memoryStore.RemoveStatusOverrides(repository, pullRequest)
+	}, "status_overrides")
+}
+
+func (s *sqliteStore) AddValidation(validation Validation) error {
+	return s.save(func() error { return s.memoryStore.AddValidation(validation) }, "validations")
+}
+
+func (s *sqliteStore) RemoveValidation(repository Repository, pullRequest int) error {
+	return s.save(func() error { return s.memoryStore.RemoveValidation(repository, pullRequest) }, "validations")
+}
+
+func (s *sqliteStore) AddNotification(notification Notification) error {
+	return s.save(func() error { return s.memoryStore.AddNotification(notification) }, "notifications")
+}
+
+func (s *sqliteStore) RemoveNotifications(repository Repository, pullRequest int, until time.Time) error {
+	return s.save(func() error {
+		return s.memoryStore.RemoveNotifications(repository, pullRequest, until)
+	}, "notifications")
+}
+
+func (s *sqliteStore) AddReminder(reminder Reminder) error {
+	return s.save(func() error { return s.memoryStore.AddReminder(reminder) }, "reminders")
+}
+
+func (s *sqliteStore) RemoveReminder(reminder Reminder) error {
+	return s.save(func() error { return s.memoryStore.RemoveReminder(reminder) }, "reminders")
+}
+
+func (s *sqliteStore) SetLastAssignedReviewer(repository Repository, reviewer string) error {
+	return s.save(func() error {
+		return s.memoryStore.SetLastAssignedReviewer(repository, reviewer)
+	}, "last_assigned_reviewers")
+}
+
+func (s *sqliteStore) OnboardRepository(repository Repository, at time.Time) (time.Time, error) {
+	var onboardedAt time.Time
+	err := s.save(func() (err error) {
+		onboardedAt, err = s.memoryStore.OnboardRepository(repository, at)
+		return err
+	}, "onboarded_at")
+	return onboardedAt, err
+}
+
+func (s *sqliteStore) SetPendingConfirmation(confirmation PendingConfirmation) error {
+	return s.save(func() error {
+		return s.memoryStore.SetPendingConfirmation(confirmation)
+	}, "pending_confirmations")
+}
+
+func (s *sqliteStore) RemovePendingConfirmation(repository Repository, pullRequest int) error {
+	return s.save(func() error {
+		return s.memoryStore.RemovePendingConfirmation(repository, pullRequest)
+	}, "pending_confirmations")
+}
+
+func (s *sqliteStore) SetPolicies(policies PolicySet) error {
+	return s.save(func() error {
+		return s.memoryStore.SetPolicies(policies)
+	}, "policies", "organization_policies")
+}
+
+func (s *sqliteStore) SetSelfTest(selfTest SelfTest) error {
+	return s.save(func() error { return s.memoryStore.SetSelfTest(selfTest) }, "self_tests")
+}
+
+func (s *sqliteStore) ClaimDelivery(deliveryID string, now, expiresAt time.Time) (bool, error) {
+	s.saveMutex.Lock()
+	defer s.saveMutex.Unlock()
+
+	claimed, err := s.memoryStore.ClaimDelivery(deliveryID, now, expiresAt)
+	if err != nil || !claimed {
+		return claimed, err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return true, fmt.Errorf("failed to save the delivery %s: %v", deliveryID, err)
+	}
+	// Forgetting the expired deliveries like the memory store did
+	_, err = tx.Exec(`DELETE FROM deliveries WHERE namespace = ? AND expires_at <= ?`, s.namespace,
+		now.UnixNano())
+	if err == nil {
+		_, err = tx.Exec(`INSERT OR REPLACE INTO deliveries (namespace, id, expires_at) VALUES (?, ?, ?)`,
+			s.namespace, deliveryID, expiresAt.UnixNano())
+	}
+	if err != nil {
+		tx.Rollback()
+		return true, fmt.Errorf("failed to save the delivery %s: %v", deliveryID, err)
+	}
+	if err = tx.Commit(); err != nil {
+		return true, fmt.Errorf("failed to save the delivery %s: %v", deliveryID, err)
+	}
+	return true, nil
+}
+
+func (s *sqliteStore) ReleaseDelivery(deliveryID string) error {
+	s.saveMutex.Lock()
+	defer s.saveMutex.Unlock()
+
+	if err := s.memoryStore.ReleaseDelivery(deliveryID); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`DELETE FROM deliveries WHERE namespace = ? AND id = ?`, s.namespace, deliveryID)
+	if err != nil {
+		return fmt.Errorf("failed to forget the delivery %s: %v", deliveryID, err)
+	}
+	return nil
+}
+
+func (s *sqliteStore) QueueFailedDelivery(delivery FailedDelivery) (bool, error) {
+	var queued bool
+	err := s.save(func() (err error) {
+		queued, err = s.memoryStore.QueueFailedDelivery(delivery)
+		return err
+	}, "failed_deliveries")
+	return queued, err
+}
+
+func (s *sqliteStore) UpdateFailedDelivery(delivery FailedDelivery) error {
+	return s.save(func() error { return s.memoryStore.UpdateFailedDelivery(delivery) }, "failed_deliveries")
+}
+
+func (s *sqliteStore) RemoveFailedDelivery(deliveryID string) error {
+	return s.save(func() error { return s.memoryStore.RemoveFailedDelivery(deliveryID) }, "failed_deliveries")
+}
+
+func (s *sqliteStore) AddDeployment(deployment TrackedDeployment) error {
+	return s.save(func() error { return s.memoryStore.AddDeployment(deployment) }, "deployments")
+}
+
+func (s *sqliteStore) RemoveDeployment(repository Repository, id int64) error {
+	return s.save(func() error { return s.memoryStore.RemoveDeployment(repository, id) }, "deployments")
+}
+
+func (s *sqliteStore) QueueBusEvent(event BusEvent) error {
+	return s.save(func() error { return s.memoryStore.QueueBusEvent(event) }, "bus_events")
+}
+
+func (s *sqliteStore) RemoveBusEvent(eventID string) error {
+	return s.save(func() error { return s.memoryStore.RemoveBusEvent(eventID) }, "bus_events")
+}
+
+func (s *sqliteStore) DeadLetterBusEvent(eventID string) error {
+	return s.save(func() error { return s.memoryStore.DeadLetterBusEvent(eventID) }, "bus_events",
+		"dead_lettered_bus_events")
+}
+
+func (s *sqliteStore) AddBlock(block Block) error {
+	return s.save(func() error { return s.memoryStore.AddBlock(block) }, "blocks")
+}
+
+func (s *sqliteStore) RemoveBlock(issue Issue, user string) error {
+	return s.save(func() error { return s.memoryStore.RemoveBlock(issue, user) }, "blocks")
+}
+
+func (s *sqliteStore) RemoveBlocks(issue Issue) error {
+	return s.save(func() error { return s.memoryStore.RemoveBlocks(issue) }, "blocks")
+}
+
+func (s *sqliteStore) AddDependency(issue Issue, dependency int) error {
+	return s.save(func() error { return s.memoryStore.AddDependency(issue, dependency) }, "dependencies")
+}
+
+func (s *sqliteStore) RemoveDependencies(issue Issue) error {
+	return s.save(func() error { return s.memoryStore.RemoveDependencies(issue) }, "dependencies")
+}
+
+func (s *sqliteStore) SetFirstTimeContribution(contribution FirstTimeContribution) error {
+	return s.save(func() error {
+		return s.memoryStore.SetFirstTimeContribution(contribution)
+	}, "first_time_contributions")
+}
+
+func (s *sqliteStore) RemoveFirstTimeContribution(issue Issue) error {
+	return s.save(func() error {
+		return s.memoryStore.RemoveFirstTimeContribution(issue)
+	}, "first_time_contributions")
+}
+
+// sqliteAuditLog keeps the audit log in the same SQLite file as the store.
+type sqliteAuditLog struct {
+	db *sql.DB
+}
+
+// NewSQLiteAuditLog creates an audit log that appends to the audit_entries
+// table of the SQLite file at the path.
+func NewSQLiteAuditLog(path string) (AuditLog, error) {
+	db, err := openSQLite(path)
+	if err != nil {
+		return nil, err
+	}
+	return sqliteAuditLog{db}, nil
+}
+
+func (l sqliteAuditLog) Record(entry AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = l.db.Exec(`INSERT INTO audit_entries (repository, pull_request, entry) VALUES (?, ?, ?)`,
+		entry.Repository, entry.PullRequest, string(data))
+	return err
+}
+
+func (l sqliteAuditLog) Entries(filter AuditFilter) ([]AuditEntry, error) {
+	// The time and the limit are left to filterAuditEntries
+	rows, err := l.db.Query(`SELECT entry FROM audit_entries
+WHERE (? = '' OR repository = ?) AND (? = 0 OR pull_request = ?)
+ORDER BY id`, filter.Repository, filter.Repository, filter.PullRequest, filter.PullRequest)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var data string
+		if err = rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var entry AuditEntry
+		if err = json.Unmarshal([]byte(data), &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse audit log entry %q: %v", data, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return filterAuditEntries(entries, filter), nil
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/google/go-github/github"
@@ -12,25 +14,103 @@ import (
 )
 
 var ErrSquashConflict = errors.New("Rebase failed due to a squash conflict")
+var ErrForkNotModifiable = errors.New("The PR's fork doesn't allow maintainers to modify it")
+var ErrForkPushFailed = errors.New("Pushing to the PR's fork failed")
+var ErrSquashRaced = errors.New("The PR's branch kept changing while it was being squashed")
+
+// squashPushAttempts is how many times the PR's commits are squashed, if
+// someone keeps pushing to the PR's branch while it's being squashed
+const squashPushAttempts = 3
+
+var squashCommandRegexp = regexp.MustCompile(`^!squash(?:\s+([1-9]\d*))?(?:\s+"([^"]+)")?$`)
+
+// squashArguments are the arguments of a "!squash" command. Without any,
+// the fixup! and squash! commits are autosquashed.
+type squashArguments struct {
+	// Count is the number of the latest commits to squash into one. 0 means
+	// all of the PR's commits.
+	Count int
+	// Message is the message of the squashed commit. The message of the
+	// oldest squashed commit is kept, if it's empty.
+	Message string
+}
+
+func (a squashArguments) isAutosquash() bool {
+	return a.Count == 0 && a.Message == ""
+}
+
+func (a squashArguments) String() string {
+	switch {
+	case a.isAutosquash():
+		return "the fixup! and squash! commits"
+	case a.Count == 0:
+		return "all of the commits"
+	case a.Count == 1:
+		return "the last commit"
+	}
+	return fmt.Sprintf("the last %d commits", a.Count)
+}
 
 func isSquashCommand(comment string) bool {
-	return strings.TrimSpace(comment) == "!squash"
+	_, isSquash := parseSquashCommand(comment)
+	return isSquash
+}
+
+// parseSquashCommand parses a "!squash" command, which may be followed by
+// the number of the latest commits to squash and a quoted message for the
+// squashed commit, e.g. `!squash 3 "Add the API"`.
+func parseSquashCommand(comment string) (squashArguments, bool) {
+	matches := squashCommandRegexp.FindStringSubmatch(strings.TrimSpace(comment))
+	if matches == nil {
+		return squashArguments{}, false
+	}
+	arguments := squashArguments{Message: strings.TrimSpace(matches[2])}
+	if matches[1] != "" {
+		count, err := strconv.Atoi(matches[1])
+		if err != nil {
+			return squashArguments{}, false
+		}
+		arguments.Count = count
+	}
+	return arguments, true
 }
 
 func isCheckCommand(comment string) bool {
 	return strings.TrimSpace(comment) == "!check"
 }
 
-func handleSquashCommand(issueComment IssueComment, gitRepos git.Repos, pullRequests PullRequests, repositories Repositories) Response {
+// handleSquashCommand squashes the PR's commits as the command's arguments
+// describe. The command is the "!squash" comment, which is stored while the
+// squash waits for a confirmation, so that the arguments would be kept.
+func handleSquashCommand(conf Config, issueComment IssueComment, command string, store Store, gitRepos git.Repos,
+	pullRequests PullRequests, repositories Repositories, issues Issues) Response {
+
+	issue := issueComment.Issue()
+	arguments, _ := parseSquashCommand(command)
+	if conf.SoftFail {
+		if errResp := requestConfirmation(conf, issue, confirmSquashAction, command, store, issues); errResp != nil {
+			return errResp
+		}
+		return SuccessResponse{fmt.Sprintf("Waiting for a confirmation to squash PR %s", issue.FullName())}
+	}
 	pr, errResp := getPR(issueComment, pullRequests)
 	if errResp != nil {
 		return errResp
 	}
-	return squashAndReportFailure(pr, gitRepos, repositories)
+	if arguments.Count > pr.GetCommits() {
+		message := fmt.Sprintf("@%s, I can't squash the last %d commits, because this PR only has %d.",
+			issueComment.Commenter.Login, arguments.Count, pr.GetCommits())
+		if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+			errorMessage := fmt.Sprintf("Failed to report the invalid commit count on PR %s", issue.FullName())
+			return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+		}
+		return SuccessResponse{fmt.Sprintf("PR %s has fewer than %d commits", issue.FullName(), arguments.Count)}
+	}
+	return squashAndReportFailure(conf, pr, arguments, store, gitRepos, repositories, issues)
 }
 
-func checkForFixupCommitsOnPREvent(pullRequestEvent PullRequestEvent, pullRequests PullRequests,
-	repositories Repositories, retry retryGithubOperation) Response {
+func checkForFixupCommitsOnPREvent(conf Config, pullRequestEvent PullRequestEvent, store Store,
+	pullRequests PullRequests, repositories Repositories, retry retryGithubOperation) Response {
 
 	isExpectedHead := func(head string) bool {
 		return head == pullRequestEvent.Head.SHA
@@ -38,11 +118,11 @@ func checkForFixupCommitsOnPREvent(pullRequestEvent PullRequestEvent, pullReques
 	setStatus := func(status *github.RepoStatus) *ErrorResponse {
 		return setStatusForPREvent(pullRequestEvent, status, repositories)
 	}
-	return checkForFixupCommits(pullRequestEvent, isExpectedHead, setStatus, pullRequests, retry)
+	return checkForFixupCommits(conf, pullRequestEvent, isExpectedHead, setStatus, store, pullRequests, retry)
 }
 
-func checkForFixupCommitsOnIssueComment(issueComment IssueComment, pullRequests PullRequests,
-	repositories Repositories, retry retryGithubOperation) Response {
+func checkForFixupCommitsOnIssueComment(conf Config, issueComment IssueComment, store Store,
+	pullRequests PullRequests, repositories Repositories, retry retryGithubOperation) Response {
 
 	isExpectedHead := func(string) bool { return true }
 	setStatus := func(status *github.RepoStatus) *ErrorResponse {
@@ -52,27 +132,47 @@ func checkForFixupCommitsOnIssueComment(issueComment IssueComment, pullRequests
 		}
 		return setStatusForPR(pr, status, repositories)
 	}
-	return checkForFixupCommits(issueComment, isExpectedHead, setStatus, pullRequests, retry)
+	return checkForFixupCommits(conf, issueComment, isExpectedHead, setStatus, store, pullRequests, retry)
 }
 
-func checkForFixupCommits(issueable Issueable, isExpectedHead func(string) bool,
-	setStatus func(*github.RepoStatus) *ErrorResponse, pullRequests PullRequests,
+// checkForFixupCommits sets the squash status of the PR and, if a commit
+// message rule is configured, the commit message status. If sign-offs are
+// required, the sign-off status is set as well. The statuses of the checks
+// the PR's SKIP_LABELS exempt it from are set to success.
+func checkForFixupCommits(conf Config, issueable labeledIssueable, isExpectedHead func(string) bool,
+	setStatus func(*github.RepoStatus) *ErrorResponse, store Store, pullRequests PullRequests,
 	retry retryGithubOperation) Response {
 
 	log.Printf("Checking for fixup commits for PR %s.\n", issueable.Issue().FullName())
-	maybeSyncResponse := retry(func() asyncResponse {
+	maybeSyncResponse := retry(issueable.Issue().Repository, func() asyncResponse {
 		commits, asyncErrResp := getCommits(issueable, isExpectedHead, pullRequests)
 		if asyncErrResp != nil {
 			return asyncErrResp.toAsyncResponse()
 		}
-		if !includesFixupCommits(commits) {
-			status := createSquashStatus("success", "No fixup! or squash! commits to be squashed")
+		if status := lintCommitMessages(conf, commits); status != nil {
+			if label := skipLabel(conf, issueable.HasLabel, commitMessagesCheck); label != "" {
+				status = skippedStatus(status, label)
+			}
 			if errResp := setStatus(status); errResp != nil {
 				return nonRetriable(errResp)
 			}
-			return nonRetriable(SuccessResponse{})
+		}
+		if status, errResp := checkSignOffs(conf, issueable.Issue(), commits, store); errResp != nil {
+			return nonRetriable(errResp)
+		} else if status != nil {
+			if label := skipLabel(conf, issueable.HasLabel, signOffsCheck); label != "" {
+				status = skippedStatus(status, label)
+			}
+			if errResp = setStatus(status); errResp != nil {
+				return nonRetriable(errResp)
+			}
 		}
 		status := createSquashStatus("pending", "This PR needs to be squashed with !squash before merging")
+		if !includesFixupCommits(commits) {
+			status = createSquashStatus("success", "No fixup! or squash! commits to be squashed")
+		} else if label := skipLabel(conf, issueable.HasLabel, squashCheck); label != "" {
+			status = skippedStatus(status, label)
+		}
 		if errResp := setStatus(status); errResp != nil {
 			return nonRetriable(errResp)
 		}
@@ -89,7 +189,7 @@ func checkForFixupCommits(issueable Issueable, isExpectedHead func(string) bool,
 
 func includesFixupCommits(commits []*github.RepositoryCommit) bool {
 	for _, commit := range commits {
-		if strings.HasPrefix(*commit.Commit.Message, "fixup! ") || strings.HasPrefix(*commit.Commit.Message, "squash! ") {
+		if isFixupCommitMessage(*commit.Commit.Message) {
 			return true
 		}
 	}
@@ -104,35 +204,143 @@ func createSquashStatus(state, description string) *github.RepoStatus {
 	}
 }
 
-func squashAndReportFailure(pr *github.PullRequest, gitRepos git.Repos, repositories Repositories) Response {
-	log.Printf("Squashing %s that's going to be merged into %s\n", *pr.Head.Ref, *pr.Base.Ref)
-	err := squash(pr, gitRepos, repositories)
-	if err == ErrSquashConflict {
-		log.Printf("Failed to autosquash the commits with an interactive rebase: %s. Setting a failure status.\n", err)
+func squashAndReportFailure(conf Config, pr *github.PullRequest, arguments squashArguments, store Store,
+	gitRepos git.Repos, repositories Repositories, issues Issues) Response {
+	unlock, errResp := lockPR(pr)
+	if errResp != nil {
+		return errResp
+	}
+	defer unlock()
+	log.Printf("Squashing %s of %s that's going to be merged into %s\n", arguments, *pr.Head.Ref, *pr.Base.Ref)
+	err := squash(pr, arguments, gitRepos, repositories)
+	if err == ErrSquashConflict || err == ErrSquashRaced {
+		log.Printf("Failed to squash the commits: %s. Setting a failure status.\n", err)
 		status := createSquashStatus("failure", "Automatic squash failed. Please squash manually")
 		if errResp := setStatusForPR(pr, status, repositories); errResp != nil {
 			return errResp
 		}
 		return SuccessResponse{}
+	} else if err == ErrForkNotModifiable || err == ErrForkPushFailed {
+		return handleForkSquashFailure(pr, err, repositories, issues)
+	} else if git.IsDiskFull(err) {
+		return reportDiskFull(conf, pr, err, store, issues)
 	} else if err != nil {
-		return ErrorResponse{err, http.StatusInternalServerError, "Failed to squash the commits in the PR"}
+		return ErrorResponse{err, gitErrorCode(err), "Failed to squash the commits in the PR"}
 	}
+	issue := prIssue(pr)
+	publishEvent(conf, BusEvent{
+		Type:        SquashPushedEvent,
+		Repository:  repositoryKey(issue.Repository),
+		PullRequest: issue.Number,
+	}, store)
 	return SuccessResponse{}
 }
 
-func squash(pr *github.PullRequest, gitRepos git.Repos, repositories Repositories) error {
-	headRepository := headRepository(pr)
-	gitRepo, err := gitRepos.GetUpdatedRepo(headRepository.URL, headRepository.Owner, headRepository.Name)
+// handleForkSquashFailure marks the PR as needing a manual squash and
+// explains to the author why the bot couldn't squash the PR's fork.
+func handleForkSquashFailure(pr *github.PullRequest, err error, repositories Repositories, issues Issues) Response {
+	issue := prIssue(pr)
+	log.Printf("Failed to squash PR %s: %s. Setting a failure status.\n", issue.FullName(), err)
+	status := createSquashStatus("failure", "Automatic squash failed. Please squash manually")
+	if errResp := setStatusForPR(pr, status, repositories); errResp != nil {
+		return errResp
+	}
+	var message string
+	if err == ErrForkNotModifiable {
+		message = fmt.Sprintf("I'm unable to squash this PR, because its fork doesn't allow edits from "+
+			"maintainers. @%s, can you please either allow edits from maintainers or squash the commits "+
+			"yourself?", issue.User.Login)
+	} else {
+		message = fmt.Sprintf("I'm unable to squash this PR, because I'm not permitted to push to %s. @%s, "+
+			"can you please either make sure that edits from maintainers are allowed or squash the commits "+
+			"yourself?", repositoryKey(headRepository(pr)), issue.User.Login)
+	}
+	if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+		errorMessage := fmt.Sprintf("Failed to notify the author of PR %s about the failed squash", issue.FullName())
+		return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	return SuccessResponse{}
+}
+
+// squash autosquashes the PR's commits, or squashes the commits the
+// arguments describe into one, in the local clone of the base repository and
+// pushes them to the PR's head branch. The head branch of a PR from a fork is
+// fetched from and pushed to the fork, which is only permitted if the fork
+// allows edits from maintainers.
+func squash(pr *github.PullRequest, arguments squashArguments, gitRepos git.Repos, repositories Repositories) error {
+	if isAcrossForks(pr) && (pr.MaintainerCanModify == nil || !*pr.MaintainerCanModify) {
+		return ErrForkNotModifiable
+	}
+	baseRepository := baseRepository(pr)
+	gitRepo, err := gitRepos.GetUpdatedRepo(baseRepository.URL, baseRepository.Owner, baseRepository.Name)
 	if err != nil {
 		log.Println(err)
+		if git.IsTimeout(err) || git.IsDiskFull(err) {
+			return err
+		}
 		return errors.New("Failed to update the local repo")
 	}
-	if err = gitRepo.AutosquashAndPush("origin/"+*pr.Base.Ref, *pr.Head.SHA, *pr.Head.Ref); err != nil {
+	headRemote, err := fetchHeadRemote(pr, gitRepo)
+	if err != nil {
 		log.Println(err)
-		if _, ok := err.(*git.ErrSquashConflict); ok {
+		if git.IsTimeout(err) {
+			return err
+		}
+		return errors.New("Failed to fetch the PR's fork")
+	}
+	branchRef := *pr.Head.SHA
+	for attempt := 1; ; attempt++ {
+		if arguments.isAutosquash() {
+			err = gitRepo.AutosquashAndPush("origin/"+*pr.Base.Ref, branchRef, headRemote, *pr.Head.Ref)
+		} else {
+			err = gitRepo.SquashAndPush("origin/"+*pr.Base.Ref, branchRef, arguments.Count, arguments.Message,
+				headRemote, *pr.Head.Ref)
+		}
+		// Squashing the last N commits of the new head could squash other
+		// commits than the ones the command was given for
+		if !git.IsPushRejected(err) || arguments.Count > 0 || attempt == squashPushAttempts {
+			break
+		}
+		log.Printf("%s. Squashing the new head of %s again.\n", err, *pr.Head.Ref)
+		if err = refetchHeadRemote(pr, gitRepo); err != nil {
+			break
+		}
+		branchRef = headRemote + "/" + *pr.Head.Ref
+	}
+	if err != nil {
+		log.Println(err)
+		if git.IsTimeout(err) {
+			return err
+		} else if _, ok := err.(*git.ErrSquashConflict); ok {
 			return ErrSquashConflict
+		} else if git.IsPushRejected(err) {
+			return ErrSquashRaced
+		} else if _, ok := err.(*git.ErrPushFailed); ok && isAcrossForks(pr) {
+			return ErrForkPushFailed
 		}
 		return err
 	}
 	return nil
 }
+
+// fetchHeadRemote makes sure the PR's head commit is available in the local
+// clone of the base repository and returns the remote the PR's head branch
+// is on. Forks are added as remotes named after their owners.
+func fetchHeadRemote(pr *github.PullRequest, gitRepo git.Repo) (string, error) {
+	if !isAcrossForks(pr) {
+		return "origin", nil
+	}
+	headRepository := headRepository(pr)
+	remote := "fork-" + headRepository.Owner
+	return remote, gitRepo.FetchRemote(remote, headRepository.URL)
+}
+
+// refetchHeadRemote fetches the PR's head branch again, after it has changed
+// on the remote.
+func refetchHeadRemote(pr *github.PullRequest, gitRepo git.Repo) error {
+	if !isAcrossForks(pr) {
+		return gitRepo.Fetch()
+	}
+	_, err := fetchHeadRemote(pr, gitRepo)
+	return err
+}
@@ -23,10 +23,16 @@ var _ = TestWebhookHandler(func(context WebhookTestContext) {
 
 			responseRecorder *httptest.ResponseRecorder
 			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+			gitRepos         *mocks.Repos
 		)
 		BeforeEach(func() {
 			responseRecorder = *context.ResponseRecorder
 			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+			gitRepos = *context.GitRepos
 		})
 
 		headers.Is(func() map[string]string {
@@ -75,6 +81,146 @@ var _ = TestWebhookHandler(func(context WebhookTestContext) {
 
 				ItSquashesPR(context, pr)
 			})
+
+			Context("with no room to clone the repository", func() {
+				BeforeEach(func() {
+					pullRequests.
+						On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+						Return(&github.PullRequest{
+							Number: github.Int(issueNumber),
+							Base: &github.PullRequestBranch{
+								SHA:  github.String("1234"),
+								Ref:  github.String("master"),
+								Repo: repository,
+							},
+							Head: &github.PullRequestBranch{
+								SHA:  github.String("1235"),
+								Ref:  github.String("feature"),
+								Repo: repository,
+							},
+							User: &github.User{
+								Login: github.String(arbitraryIssueAuthor),
+							},
+						}, emptyResponse, noError)
+					gitRepos.
+						On("GetUpdatedRepo", sshURL, repositoryOwner, repositoryName).
+						Return(new(mocks.Repo), &git.ErrDiskFull{Usage: 2048, Quota: 1024})
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("disk I keep my clones on is full"))).
+						Return(emptyResult, emptyResponse, noError)
+				})
+
+				It("tells the author and fails the webhook", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusInsufficientStorage))
+				})
+			})
+
+			Context("with the PR being from a fork", func() {
+				forkOwner := "forker"
+				forkURL := "git@github.com:forker/github-review-helper.git"
+				fork := &github.Repository{
+					ID: github.Int(repositoryID + 1),
+					Owner: &github.User{
+						Login: github.String(forkOwner),
+					},
+					Name:   github.String(repositoryName),
+					SSHURL: github.String(forkURL),
+				}
+				forkPR := func(maintainerCanModify bool) *github.PullRequest {
+					return &github.PullRequest{
+						Number:              github.Int(issueNumber),
+						MaintainerCanModify: github.Bool(maintainerCanModify),
+						Base: &github.PullRequestBranch{
+							SHA:  github.String("1234"),
+							Ref:  github.String("master"),
+							Repo: repository,
+						},
+						Head: &github.PullRequestBranch{
+							SHA:  github.String("1235"),
+							Ref:  github.String("feature"),
+							Repo: fork,
+						},
+						User: &github.User{
+							Login: github.String(arbitraryIssueAuthor),
+						},
+					}
+				}
+
+				expectManualSquashRequest := func(text string) {
+					BeforeEach(func() {
+						repositories.
+							On("CreateStatus", anyContext, forkOwner, repositoryName, "1235", mock.MatchedBy(func(status *github.RepoStatus) bool {
+								return *status.State == "failure" && *status.Context == "review/squash"
+							})).
+							Return(emptyResult, emptyResponse, noError)
+						issues.
+							On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+								mock.MatchedBy(commentContaining(text))).
+							Return(emptyResult, emptyResponse, noError)
+					})
+
+					It("asks the author to squash the PR", func() {
+						handle()
+						Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					})
+				}
+
+				Context("with the fork not allowing edits from maintainers", func() {
+					BeforeEach(func() {
+						pullRequests.
+							On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+							Return(forkPR(false), emptyResponse, noError)
+					})
+
+					expectManualSquashRequest("its fork doesn't allow edits from maintainers")
+				})
+
+				Context("with the fork allowing edits from maintainers", func() {
+					var gitRepo *mocks.Repo
+
+					BeforeEach(func() {
+						pullRequests.
+							On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+							Return(forkPR(true), emptyResponse, noError)
+						gitRepo = new(mocks.Repo)
+						gitRepos.
+							On("GetUpdatedRepo", sshURL, repositoryOwner, repositoryName).
+							Return(gitRepo, noError)
+						gitRepo.
+							On("FetchRemote", "fork-"+forkOwner, forkURL).
+							Return(noError)
+					})
+
+					AfterEach(func() {
+						gitRepo.AssertExpectations(GinkgoT())
+					})
+
+					Context("with the push succeeding", func() {
+						BeforeEach(func() {
+							gitRepo.
+								On("AutosquashAndPush", "origin/master", "1235", "fork-"+forkOwner, "feature").
+								Return(noError)
+						})
+
+						It("squashes the fork's branch", func() {
+							handle()
+							Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+						})
+					})
+
+					Context("with the push being rejected", func() {
+						BeforeEach(func() {
+							gitRepo.
+								On("AutosquashAndPush", "origin/master", "1235", "fork-"+forkOwner, "feature").
+								Return(&git.ErrPushFailed{Remote: "fork-" + forkOwner, Err: errors.New("permission denied")})
+						})
+
+						expectManualSquashRequest("I'm not permitted to push to forker/github-review-helper")
+					})
+				})
+			})
 		})
 	})
 })
@@ -112,7 +258,7 @@ var ItSquashesPR = func(context WebhookTestContext, pr *github.PullRequest) {
 		BeforeEach(func() {
 			squashErr := &git.ErrSquashConflict{errors.New("merge conflict")}
 			gitRepo.
-				On("AutosquashAndPush", "origin/"+baseRef, headSHA, headRef).
+				On("AutosquashAndPush", "origin/"+baseRef, headSHA, "origin", headRef).
 				Return(squashErr)
 		})
 
@@ -132,7 +278,7 @@ var ItSquashesPR = func(context WebhookTestContext, pr *github.PullRequest) {
 	Context("with autosquash and push failing due to a reason other than a squash conflict", func() {
 		BeforeEach(func() {
 			gitRepo.
-				On("AutosquashAndPush", "origin/"+baseRef, headSHA, headRef).
+				On("AutosquashAndPush", "origin/"+baseRef, headSHA, "origin", headRef).
 				Return(errors.New("other git error"))
 		})
 
@@ -143,10 +289,75 @@ var ItSquashesPR = func(context WebhookTestContext, pr *github.PullRequest) {
 		})
 	})
 
+	Context("with the push timing out", func() {
+		BeforeEach(func() {
+			gitRepo.
+				On("AutosquashAndPush", "origin/"+baseRef, headSHA, "origin", headRef).
+				Return(&git.ErrPushFailed{Remote: "origin", Err: &git.ErrTimeout{Command: "git push"}})
+		})
+
+		It("responds with a gateway timeout, so that the webhook could be retried", func() {
+			handle()
+
+			Expect(responseRecorder.Code).To(Equal(http.StatusGatewayTimeout))
+		})
+	})
+
+	Context("with the branch changing during the squash", func() {
+		rejected := &git.ErrPushRejected{Remote: "origin", Ref: headRef, Err: errors.New("stale info")}
+
+		BeforeEach(func() {
+			gitRepo.
+				On("AutosquashAndPush", "origin/"+baseRef, headSHA, "origin", headRef).
+				Return(rejected).
+				Once()
+			gitRepo.
+				On("Fetch").
+				Return(noError)
+		})
+
+		Context("and the retry succeeding", func() {
+			BeforeEach(func() {
+				gitRepo.
+					On("AutosquashAndPush", "origin/"+baseRef, "origin/"+headRef, "origin", headRef).
+					Return(noError).
+					Once()
+			})
+
+			It("squashes the new head of the branch", func() {
+				handle()
+
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			})
+		})
+
+		Context("and the branch changing during every retry", func() {
+			BeforeEach(func() {
+				gitRepo.
+					On("AutosquashAndPush", "origin/"+baseRef, "origin/"+headRef, "origin", headRef).
+					Return(rejected).
+					Twice()
+			})
+
+			It("gives up and reports the failure", func() {
+				repositories.
+					On("CreateStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.MatchedBy(func(status *github.RepoStatus) bool {
+						return *status.State == "failure" && *status.Context == "review/squash"
+					})).
+					Return(emptyResult, emptyResponse, noError)
+
+				handle()
+
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				gitRepo.AssertNumberOfCalls(GinkgoT(), "AutosquashAndPush", 3)
+			})
+		})
+	})
+
 	Context("with autosquash and push succeeding", func() {
 		BeforeEach(func() {
 			gitRepo.
-				On("AutosquashAndPush", "origin/"+baseRef, headSHA, headRef).
+				On("AutosquashAndPush", "origin/"+baseRef, headSHA, "origin", headRef).
 				Return(noError)
 		})
 
@@ -157,3 +368,112 @@ var ItSquashesPR = func(context WebhookTestContext, pr *github.PullRequest) {
 		})
 	})
 }
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("!squash comment with arguments", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+			gitRepos         *mocks.Repos
+			gitRepo          *mocks.Repo
+
+			command string
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+			gitRepos = *context.GitRepos
+			gitRepo = new(mocks.Repo)
+
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+				Return(&github.PullRequest{
+					Number:  github.Int(issueNumber),
+					Commits: github.Int(3),
+					Base: &github.PullRequestBranch{
+						SHA:  github.String("1234"),
+						Ref:  github.String("master"),
+						Repo: repository,
+					},
+					Head: &github.PullRequestBranch{
+						SHA:  github.String("1235"),
+						Ref:  github.String("feature"),
+						Repo: repository,
+					},
+				}, emptyResponse, noError)
+		})
+
+		AfterEach(func() {
+			gitRepo.AssertExpectations(GinkgoT())
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent(command, arbitraryIssueAuthor)
+		})
+
+		expectSquash := func(count int, message string) {
+			gitRepos.
+				On("GetUpdatedRepo", sshURL, repositoryOwner, repositoryName).
+				Return(gitRepo, noError)
+			gitRepo.
+				On("SquashAndPush", "origin/master", "1235", count, message, "origin", "feature").
+				Return(noError)
+		}
+
+		Context("with a commit count and a message", func() {
+			BeforeEach(func() {
+				// Escaped, because the comment is embedded in the event's JSON
+				command = `!squash 2 \"Add the feature\"`
+				expectSquash(2, "Add the feature")
+			})
+
+			It("squashes the last commits with the message", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			})
+		})
+
+		Context("with only a message", func() {
+			BeforeEach(func() {
+				command = `!squash \"Add the feature\"`
+				expectSquash(0, "Add the feature")
+			})
+
+			It("squashes all of the commits with the message", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			})
+		})
+
+		Context("with more commits than the PR has", func() {
+			BeforeEach(func() {
+				command = "!squash 5"
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("this PR only has 3"))).
+					Return(emptyResult, emptyResponse, noError)
+			})
+
+			It("refuses to squash", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			})
+		})
+	})
+})
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/evaluator"
+	"github.com/salemove/github-review-helper/git"
+)
+
+const stackedPRsQuery = `query($owner: String!, $name: String!, $baseRefName: String!) {
+  repository(owner: $owner, name: $name) {
+    pullRequests(states: OPEN, baseRefName: $baseRefName, first: 100) {
+      nodes {
+        id
+        number
+        headRefName
+        headRefOid
+        isCrossRepository
+        author {
+          login
+        }
+      }
+    }
+  }
+}`
+
+const retargetPullRequestMutation = `mutation($pullRequestId: ID!, $baseRefName: String!) {
+  updatePullRequest(input: {pullRequestId: $pullRequestId, baseRefName: $baseRefName}) {
+    pullRequest {
+      number
+    }
+  }
+}`
+
+// dependsOnRegexp matches the "depends on #123" markers in the descriptions
+// of PRs
+var dependsOnRegexp = regexp.MustCompile(`(?i)\bdepends on #([0-9]+)\b`)
+
+var pullRequestNumberRegexp = regexp.MustCompile(`^#([0-9]+)$`)
+
+// stackedPR is an open PR whose base branch is the head branch of another PR.
+type stackedPR struct {
+	ID                string `json:"id"`
+	Number            int    `json:"number"`
+	HeadRefName       string `json:"headRefName"`
+	HeadRefOid        string `json:"headRefOid"`
+	IsCrossRepository bool   `json:"isCrossRepository"`
+	Author            struct {
+		Login string `json:"login"`
+	} `json:"author"`
+}
+
+func isDependsOnCommand(comment string) bool {
+	comment = strings.TrimSpace(comment)
+	return comment == "!depends-on" || strings.HasPrefix(comment, "!depends-on ")
+}
+
+// parseDependsOnCommand returns the PRs a "!depends-on #123 #124" command
+// names or no PRs for "!depends-on none". It fails, if the command doesn't
+// name the PRs.
+func parseDependsOnCommand(comment string) ([]int, bool) {
+	firstLine := strings.SplitN(strings.TrimSpace(comment), "\n", 2)[0]
+	fields := strings.Fields(strings.TrimPrefix(firstLine, "!depends-on"))
+	if len(fields) == 1 && fields[0] == "none" {
+		return []int{}, true
+	} else if len(fields) == 0 {
+		return nil, false
+	}
+	dependencies := make([]int, len(fields))
+	for i, field := range fields {
+		match := pullRequestNumberRegexp.FindStringSubmatch(strings.TrimSuffix(field, ","))
+		if match == nil {
+			return nil, false
+		}
+		dependencies[i], _ = strconv.Atoi(match[1])
+	}
+	return dependencies, true
+}
+
+// handleDependsOnCommand records the PRs that the PR mustn't be merged
+// before, on top of the ones its description says it depends on.
+// "!depends-on none" forgets the recorded dependencies and, like "!unblock",
+// merges a PR that's labeled for merging, if they were the last thing
+// keeping it from being ready.
+func handleDependsOnCommand(conf Config, issueComment IssueComment, store Store, issues Issues,
+	pullRequests PullRequests, repositories Repositories, graphQL GraphQL, gitRepos git.Repos) Response {
+
+	issue := issueComment.Issue()
+	dependencies, ok := parseDependsOnCommand(issueComment.Comment)
+	var message string
+	if !ok {
+		message = fmt.Sprintf("@%s, please name the PRs this PR depends on, e.g. `!depends-on #123`, or say "+
+			"`!depends-on none` to forget them.", issueComment.Commenter.Login)
+	}
+	for _, dependency := range dependencies {
+		if dependency == issue.Number {
+			message = fmt.Sprintf("@%s, a PR can't depend on itself.", issueComment.Commenter.Login)
+		}
+	}
+	if message != "" {
+		if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+			errorMessage := fmt.Sprintf("Failed to refuse the dependencies of PR %s", issue.FullName())
+			return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+		}
+		return SuccessResponse{"Couldn't record the dependencies. Responded with a comment."}
+	}
+	if len(dependencies) == 0 {
+		if err := store.RemoveDependencies(issue); err != nil {
+			errorMessage := fmt.Sprintf("Failed to forget the dependencies of PR %s", issue.FullName())
+			return ErrorResponse{err, http.StatusInternalServerError, errorMessage}
+		} else if !issueComment.HasLabel(MergingLabel) {
+			return SuccessResponse{fmt.Sprintf("Forgot the dependencies of PR %s", issue.FullName())}
+		}
+		return mergeIfReady(conf, issue, true, store, issues, pullRequests, repositories, graphQL, gitRepos)
+	}
+	for _, dependency := range dependencies {
+		if err := store.AddDependency(issue, dependency); err != nil {
+			errorMessage := fmt.Sprintf("Failed to record the dependencies of PR %s", issue.FullName())
+			return ErrorResponse{err, http.StatusInternalServerError, errorMessage}
+		}
+	}
+	return SuccessResponse{fmt.Sprintf("PR %s depends on %v", issue.FullName(), dependencies)}
+}
+
+// prDependencies returns the PRs in the same repository that the PR mustn't
+// be merged before, in ascending order: the ones its description says it
+// depends on and the ones named with "!depends-on".
+func prDependencies(pr *github.PullRequest, store Store) ([]int, error) {
+	issue := prIssue(pr)
+	recorded, err := store.Dependencies(issue)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[int]bool{issue.Number: true}
+	var dependencies []int
+	for _, dependency := range recorded {
+		if !seen[dependency] {
+			seen[dependency] = true
+			dependencies = append(dependencies, dependency)
+		}
+	}
+	for _, match := range dependsOnRegexp.FindAllStringSubmatch(pr.GetBody(), -1) {
+		dependency, _ := strconv.Atoi(match[1])
+		if !seen[dependency] {
+			seen[dependency] = true
+			dependencies = append(dependencies, dependency)
+		}
+	}
+	sort.Ints(dependencies)
+	return dependencies, nil
+}
+
+// checkDependencies keeps the PR waiting until the PRs it depends on have
+// been merged. A dependency that was closed without being merged fails the
+// PR, because it won't be merged without someone reopening it. Issues the
+// description says the PR depends on are ignored.
+func checkDependencies(ctx GateContext) (evaluator.Result, *ErrorResponse) {
+	issue := prIssue(ctx.PR)
+	dependencies, err := prDependencies(ctx.PR, ctx.Store)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Failed to get the dependencies of PR %s", issue.FullName())
+		return evaluator.Result{}, &ErrorResponse{err, http.StatusInternalServerError, errorMessage}
+	}
+	var open, closed, evidence []string
+	for _, dependency := range dependencies {
+		pr, resp, err := ctx.PullRequests.Get(context.TODO(), issue.Repository.Owner, issue.Repository.Name,
+			dependency)
+		if is404Error(resp) {
+			evidence = append(evidence, fmt.Sprintf("#%d isn't a PR", dependency))
+			continue
+		} else if err != nil {
+			errorMessage := fmt.Sprintf("Getting PR #%d, which PR %s depends on, failed", dependency,
+				issue.FullName())
+			return evaluator.Result{}, &ErrorResponse{err, http.StatusBadGateway, errorMessage}
+		}
+		switch {
+		case pr.GetMerged():
+			evidence = append(evidence, fmt.Sprintf("#%d is merged", dependency))
+		case pr.GetState() == "closed":
+			closed = append(closed, fmt.Sprintf("#%d", dependency))
+			evidence = append(evidence, fmt.Sprintf("#%d was closed without being merged", dependency))
+		default:
+			open = append(open, fmt.Sprintf("#%d", dependency))
+			evidence = append(evidence, fmt.Sprintf("#%d is open", dependency))
+		}
+	}
+	if len(closed) > 0 {
+		return failed(fmt.Sprintf("it depends on %s, which was closed without being merged",
+			strings.Join(closed, " and ")), evidence...), nil
+	} else if len(open) > 0 {
+		return pending(fmt.Sprintf("it's waiting for %s to be merged", strings.Join(open, " and ")),
+			evidence...), nil
+	}
+	return passed(evidence...), nil
+}
+
+// restackStackedPRs moves the PRs stacked on the merged PR, i.e. the ones
+// whose base branch is the merged PR's head branch, onto the merged PR's base
+// branch, if RESTACK_PRS is enabled. They're retargeted before the head
+// branch is deleted, because GitHub closes the PRs whose base branch is
+// deleted. Their own commits are then rebased onto the base branch, so that
+// the merged PR's commits, which may have been squashed, wouldn't show up in
+// their diffs. In the soft-fail period, their authors are asked to rebase
+// them instead. Failures are only logged, because the merge has already
+// happened.
+func restackStackedPRs(conf Config, repository Repository, mergedHead PullRequestBranch, baseRef string,
+	gitRepos git.Repos, issues Issues, graphQL GraphQL) {
+
+	if !conf.RestackPRs {
+		return
+	}
+	var result struct {
+		Repository struct {
+			PullRequests struct {
+				Nodes []stackedPR `json:"nodes"`
+			} `json:"pullRequests"`
+		} `json:"repository"`
+	}
+	err := graphQL.Query(context.TODO(), stackedPRsQuery, map[string]interface{}{
+		"owner":       repository.Owner,
+		"name":        repository.Name,
+		"baseRefName": mergedHead.Ref,
+	}, &result)
+	if err != nil {
+		log.Printf("Failed to list the PRs stacked on %s in %s: %v\n", mergedHead.Ref, repositoryKey(repository),
+			err)
+		return
+	}
+	for _, stacked := range result.Repository.PullRequests.Nodes {
+		issue := Issue{Number: stacked.Number, Repository: repository}
+		var mutationResult struct{}
+		err = graphQL.Query(context.TODO(), retargetPullRequestMutation, map[string]interface{}{
+			"pullRequestId": stacked.ID,
+			"baseRefName":   baseRef,
+		}, &mutationResult)
+		if err != nil {
+			log.Printf("Failed to retarget PR %s to %s: %v\n", issue.FullName(), baseRef, err)
+			continue
+		}
+		log.Printf("Retargeted PR %s from %s to %s.\n", issue.FullName(), mergedHead.Ref, baseRef)
+		if stacked.IsCrossRepository {
+			askToRebaseStackedPR(stacked, issue, baseRef, "I can't push to its fork", issues)
+			continue
+		} else if conf.SoftFail {
+			askToRebaseStackedPR(stacked, issue, baseRef, "I'm still being tried out in this repository", issues)
+			continue
+		}
+		rebaseStackedPR(stacked, issue, mergedHead.SHA, baseRef, gitRepos, issues)
+	}
+}
+
+// rebaseStackedPR rebases the commits the stacked PR has on top of the
+// merged PR's head onto the base branch. A PR that conflicts with the base
+// branch is left for its author to rebase.
+func rebaseStackedPR(stacked stackedPR, issue Issue, mergedHeadSHA, baseRef string, gitRepos git.Repos,
+	issues Issues) {
+
+	gitRepo, err := gitRepos.GetUpdatedRepo(issue.Repository.URL, issue.Repository.Owner, issue.Repository.Name)
+	if git.IsDiskFull(err) {
+		askToRebaseStackedPR(stacked, issue, baseRef, "the disk I keep my clones on is full", issues)
+		return
+	} else if err != nil {
+		log.Printf("Failed to get an updated repo for rebasing PR %s: %v\n", issue.FullName(), err)
+		return
+	}
+	_, err = gitRepo.RebaseOntoAndPush("origin/"+baseRef, mergedHeadSHA, stacked.HeadRefOid, "origin",
+		stacked.HeadRefName)
+	if _, isConflict := err.(*git.ErrRebaseConflict); isConflict {
+		askToRebaseStackedPR(stacked, issue, baseRef, "it conflicts with it", issues)
+	} else if err != nil {
+		log.Printf("Failed to rebase PR %s onto %s: %v\n", issue.FullName(), baseRef, err)
+	} else {
+		log.Printf("Rebased PR %s onto %s.\n", issue.FullName(), baseRef)
+	}
+}
+
+func askToRebaseStackedPR(stacked stackedPR, issue Issue, baseRef, reason string, issues Issues) {
+	message := fmt.Sprintf("@%s, the PR this PR was stacked on has been merged, so I changed its base branch to "+
+		"`%s`. I couldn't rebase it onto `%s`, because %s, so please rebase it yourself.", stacked.Author.Login,
+		baseRef, baseRef, reason)
+	if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+		log.Printf("Failed to ask for PR %s to be rebased: %v\n", issue.FullName(), err)
+	}
+}
+
+// handleDependencyMerged restacks the PRs stacked on the merged PR, in case
+// it was merged by someone else than the bot, and evaluates the PRs labeled
+// for merging that depend on it again, because the merge may have been the
+// last thing they were waiting for.
+func handleDependencyMerged(conf Config, pullRequestEvent PullRequestEvent, gitRepos git.Repos, store Store,
+	issues Issues, pullRequests PullRequests, repositories Repositories, graphQL GraphQL) {
+
+	merged := pullRequestEvent.Issue()
+	// Only branches of the base repository can be stacked on
+	if pullRequestEvent.Head.Repository.Owner == merged.Repository.Owner &&
+		pullRequestEvent.Head.Repository.Name == merged.Repository.Name {
+
+		restackStackedPRs(conf, merged.Repository, pullRequestEvent.Head, pullRequestEvent.Base.Ref, gitRepos,
+			issues, graphQL)
+	}
+	queued, err := queuedPRs(merged.Repository, issues)
+	if err != nil {
+		log.Printf("Failed to find the PRs depending on PR %s: %v\n", merged.FullName(), err)
+		return
+	}
+	for _, issue := range queued {
+		pr, errResp := getPR(issue, pullRequests)
+		if errResp != nil {
+			log.Printf("%s: %v\n", errResp.ErrorMessage, errResp.Error)
+			continue
+		}
+		dependencies, err := prDependencies(pr, store)
+		if err != nil {
+			log.Printf("Failed to get the dependencies of PR %s: %v\n", issue.FullName(), err)
+			continue
+		} else if !containsInt(dependencies, merged.Number) {
+			continue
+		}
+		log.Printf("PR %s, which PR %s depends on, was merged. Evaluating PR %s again.\n", merged.FullName(),
+			issue.FullName(), issue.FullName())
+		response := mergeIfReady(conf, issue, false, store, issues, pullRequests, repositories, graphQL, gitRepos)
+		response.logResponse()
+	}
+}
+
+func containsInt(numbers []int, number int) bool {
+	for _, n := range numbers {
+		if n == number {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("PR dependencies", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			store            grh.Store
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+
+			headSHA        = "1235"
+			dependency     = issueNumber + 1
+			anyListOptions = mock.AnythingOfType("*github.ListOptions")
+			issue          = grh.Issue{
+				Number:     issueNumber,
+				Repository: grh.Repository{Owner: repositoryOwner, Name: repositoryName, URL: sshURL},
+			}
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			store = *context.Store
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+
+		Describe("!status comment", func() {
+			requestJSON.Is(func() string {
+				return IssueCommentEvent("!status", arbitraryIssueAuthor)
+			})
+
+			BeforeEach(func() {
+				context.Config.MergeGates = []string{"dependencies"}
+
+				repositories.
+					On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+					Return(true, emptyResponse, noError)
+				pullRequests.
+					On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+					Return(&github.PullRequest{
+						Number:    github.Int(issueNumber),
+						Merged:    github.Bool(false),
+						Mergeable: github.Bool(true),
+						Body:      github.String("Depends on #" + strconv.Itoa(dependency) + " for the new API."),
+						Base: &github.PullRequestBranch{
+							SHA:  github.String("1234"),
+							Ref:  github.String("master"),
+							Repo: repository,
+						},
+						Head: &github.PullRequestBranch{
+							SHA:  github.String(headSHA),
+							Ref:  github.String("feature"),
+							Repo: repository,
+						},
+						User: &github.User{Login: github.String(arbitraryIssueAuthor)},
+					}, emptyResponse, noError)
+				repositories.
+					On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA, anyListOptions).
+					Return(&github.CombinedStatus{State: github.String("success")}, emptyResponse, noError)
+				mockLabels(issues, issueNumber)
+			})
+
+			mockDependency := func(state string, merged bool) {
+				pullRequests.
+					On("Get", anyContext, repositoryOwner, repositoryName, dependency).
+					Return(&github.PullRequest{
+						Number: github.Int(dependency),
+						State:  github.String(state),
+						Merged: github.Bool(merged),
+					}, emptyResponse, noError)
+			}
+
+			Context("with the dependency still open", func() {
+				BeforeEach(func() {
+					mockDependency("open", false)
+				})
+
+				It("keeps the PR waiting for it", func() {
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining(":hourglass: **dependencies**: it's waiting for #"+
+								strconv.Itoa(dependency)+" to be merged"))).
+						Return(emptyResult, emptyResponse, noError)
+
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertExpectations(GinkgoT())
+				})
+			})
+
+			Context("with the dependency closed without being merged", func() {
+				BeforeEach(func() {
+					mockDependency("closed", false)
+				})
+
+				It("blocks the PR", func() {
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining(":x: **dependencies**: it depends on #"+
+								strconv.Itoa(dependency)+", which was closed without being merged"))).
+						Return(emptyResult, emptyResponse, noError)
+
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertExpectations(GinkgoT())
+				})
+			})
+
+			Context("with the dependency merged", func() {
+				BeforeEach(func() {
+					mockDependency("closed", true)
+				})
+
+				It("passes the PR", func() {
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining(":white_check_mark: **dependencies**"))).
+						Return(emptyResult, emptyResponse, noError)
+
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					issues.AssertExpectations(GinkgoT())
+				})
+			})
+		})
+
+		ForCollaborator(context, repositoryOwner, repositoryName, arbitraryIssueAuthor, func() {
+			Describe("!depends-on comment", func() {
+				Context("naming PRs", func() {
+					requestJSON.Is(func() string {
+						return IssueCommentEvent("!depends-on #12 #13", arbitraryIssueAuthor)
+					})
+
+					It("records the dependencies", func() {
+						handle()
+						Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+						Expect(store.Dependencies(issue)).To(Equal([]int{12, 13}))
+					})
+				})
+
+				Context("naming the PR itself", func() {
+					requestJSON.Is(func() string {
+						return IssueCommentEvent("!depends-on #"+strconv.Itoa(issueNumber), arbitraryIssueAuthor)
+					})
+
+					It("refuses to record the dependency", func() {
+						issues.
+							On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+								mock.MatchedBy(commentContaining("a PR can't depend on itself"))).
+							Return(emptyResult, emptyResponse, noError).
+							Once()
+
+						handle()
+						Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+						Expect(store.Dependencies(issue)).To(BeEmpty())
+					})
+				})
+			})
+		})
+	})
+})
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+const (
+	// StaleCILabel marks the PRs whose CI has been failing for STALE_CI_AGE
+	// without any new pushes
+	StaleCILabel = "stale-ci"
+)
+
+// runStaleCIPolicy periodically labels the PRs in conf.StalePRRepositories
+// whose CI has been failing for too long, until stop is closed. The policy
+// can be enabled for some repositories only, so the job runs even if
+// STALE_CI_AGE is 0.
+func runStaleCIPolicy(configSource ConfigSource, store Store, search Search, issues Issues,
+	pullRequests PullRequests, repositories Repositories, stop <-chan struct{}) {
+
+	if configSource.Current().StalePRCheckInterval == 0 {
+		log.Println("Stale CI policy disabled")
+		return
+	}
+	ticker := time.NewTicker(configSource.Current().StalePRCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			conf := configSource.Current()
+			if len(conf.StalePRRepositories) == 0 {
+				continue
+			} else if pausedForGithubIncident("stale CI policy") || throttledForRateLimit(conf, "stale CI policy") {
+				continue
+			}
+			err := ApplyStaleCIPolicy(conf, store, search, issues, pullRequests, repositories, time.Now())
+			if err != nil {
+				log.Printf("Applying the stale CI policy failed: %v\n", err)
+			}
+		}
+	}
+}
+
+// ApplyStaleCIPolicy labels the open PRs in conf.StalePRRepositories whose
+// CI has been failing for the repository's STALE_CI_AGE with no new pushes
+// or builds, warning their authors. With STALE_CI_CLOSE_AFTER, the labeled
+// PRs that stay red for that much longer are closed. The label is removed
+// once CI runs again, e.g. after a push. PRs on hold are left alone.
+func ApplyStaleCIPolicy(conf Config, store Store, search Search, issues Issues, pullRequests PullRequests,
+	repositories Repositories, now time.Time) error {
+
+	notOnHold := fmt.Sprintf("-label:\"%s\"", OnHoldLabel)
+	queries := []string{
+		staleCIQuery(conf.StalePRRepositories, "status:failure", notOnHold),
+		staleCIQuery(conf.StalePRRepositories, fmt.Sprintf("label:\"%s\"", StaleCILabel), notOnHold),
+	}
+	seen := make(map[string]bool)
+	var firstErr error
+	for _, query := range queries {
+		results, err := searchIssues(query, search)
+		if err != nil {
+			return fmt.Errorf("searching for PRs with failing CI with query '%s' failed: %v", query, err)
+		}
+		for _, result := range results {
+			if seen[result.GetURL()] {
+				continue
+			}
+			seen[result.GetURL()] = true
+			if err := applyStaleCIPolicy(conf, result, store, issues, pullRequests, repositories,
+				now); err != nil {
+				log.Println(err)
+				if firstErr == nil {
+					firstErr = err
+				}
+			}
+		}
+	}
+	return firstErr
+}
+
+func staleCIQuery(repositories []string, qualifiers ...string) string {
+	qualifiers = append([]string{"is:pr", "is:open"}, qualifiers...)
+	// Multiple user and repo qualifiers match PRs in any of them
+	for _, key := range repositories {
+		if strings.Contains(key, "/") {
+			qualifiers = append(qualifiers, "repo:"+key)
+		} else {
+			qualifiers = append(qualifiers, "user:"+key)
+		}
+	}
+	return strings.Join(qualifiers, " ")
+}
+
+func applyStaleCIPolicy(conf Config, result github.Issue, store Store, issues Issues, pullRequests PullRequests,
+	repositories Repositories, now time.Time) error {
+
+	repository, err := searchResultRepository(result)
+	if err != nil {
+		return err
+	}
+	issue := Issue{Number: result.GetNumber(), Repository: repository}
+	conf, errResp := repositoryConfig(conf, repository, store)
+	if errResp != nil {
+		return fmt.Errorf("%s: %v", errResp.ErrorMessage, errResp.Error)
+	}
+	labeled := hasGithubLabel(result.Labels, StaleCILabel)
+	if conf.StaleCIAge == 0 && !labeled {
+		return nil
+	}
+	pr, errResp := getPR(issue, pullRequests)
+	if errResp != nil {
+		return fmt.Errorf("%s: %v", errResp.ErrorMessage, errResp.Error)
+	}
+	state, statuses, errResp := getStatuses(pr, repositories)
+	if errResp != nil {
+		return fmt.Errorf("%s: %v", errResp.ErrorMessage, errResp.Error)
+	}
+	redFor := now.Sub(lastStatusUpdate(statuses))
+	if conf.StaleCIAge == 0 || (state != "failure" && state != "error") || redFor < conf.StaleCIAge {
+		if !labeled {
+			return nil
+		} else if errResp = removeLabel(repository, issue.Number, StaleCILabel, issues); errResp != nil {
+			return fmt.Errorf("%s: %v", errResp.ErrorMessage, errResp.Error)
+		}
+		log.Printf("CI of PR %s is no longer stale. Removed the %s label.\n", issue.FullName(), StaleCILabel)
+		return nil
+	}
+
+	author := pr.User.GetLogin()
+	if !labeled {
+		if errResp = addLabel(repository, issue.Number, StaleCILabel, issues); errResp != nil {
+			return fmt.Errorf("%s: %v", errResp.ErrorMessage, errResp.Error)
+		}
+		message := fmt.Sprintf("@%s, CI has been failing on this PR for %s without any new pushes, so I "+
+			"labeled it `%s`.", author, formatDuration(conf.StaleCIAge), StaleCILabel)
+		if conf.StaleCICloseAfter > 0 {
+			message += fmt.Sprintf(" I'll close it, if CI is still failing in %s.",
+				formatDuration(conf.StaleCICloseAfter))
+		}
+		if err = comment(message, repository, issue.Number, issues); err != nil {
+			return fmt.Errorf("failed to explain labeling PR %s %s: %v", issue.FullName(), StaleCILabel, err)
+		}
+		log.Printf("Labeled PR %s %s.\n", issue.FullName(), StaleCILabel)
+		return nil
+	} else if conf.StaleCICloseAfter == 0 || redFor < conf.StaleCIAge+conf.StaleCICloseAfter {
+		return nil
+	}
+	message := fmt.Sprintf("@%s, I closed this PR, because CI has been failing on it for %s without any new "+
+		"pushes. Reopen it once it's being worked on again.", author, formatDuration(redFor))
+	if err = comment(message, repository, issue.Number, issues); err != nil {
+		return fmt.Errorf("failed to explain closing PR %s: %v", issue.FullName(), err)
+	}
+	_, _, err = issues.Edit(context.TODO(), repository.Owner, repository.Name, issue.Number,
+		&github.IssueRequest{State: github.String("closed")})
+	if err != nil {
+		return fmt.Errorf("failed to close PR %s: %v", issue.FullName(), err)
+	}
+	log.Printf("Closed PR %s, because its CI has been failing for %s.\n", issue.FullName(), redFor)
+	return nil
+}
+
+// lastStatusUpdate returns when CI last reported a status for the commit,
+// i.e. since when its combined status hasn't changed.
+func lastStatusUpdate(statuses []github.RepoStatus) time.Time {
+	var last time.Time
+	for _, status := range statuses {
+		if status.UpdatedAt != nil && status.UpdatedAt.After(last) {
+			last = *status.UpdatedAt
+		}
+	}
+	return last
+}
@@ -0,0 +1,196 @@
+package main_test
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ApplyStaleCIPolicy", func() {
+	var (
+		conf         grh.Config
+		store        grh.Store
+		search       *mocks.Search
+		issues       *mocks.Issues
+		pullRequests *mocks.PullRequests
+		repositories *mocks.Repositories
+		now          time.Time
+
+		redPRs      []github.Issue
+		labeledPRs  []github.Issue
+		statusState string
+		statusTime  time.Time
+
+		headSHA = "1235"
+		prIssue = func(labels ...string) github.Issue {
+			issue := github.Issue{
+				Number: github.Int(issueNumber),
+				URL: github.String(fmt.Sprintf("https://api.github.com/repos/%s/%s/issues/%d", repositoryOwner,
+					repositoryName, issueNumber)),
+			}
+			for _, label := range labels {
+				issue.Labels = append(issue.Labels, github.Label{Name: github.String(label)})
+			}
+			return issue
+		}
+	)
+
+	BeforeEach(func() {
+		conf = grh.Config{
+			StalePRRepositories: []string{repositoryOwner + "/" + repositoryName},
+			StaleCIAge:          72 * time.Hour,
+		}
+		store = grh.NewMemoryStore()
+		search = new(mocks.Search)
+		issues = new(mocks.Issues)
+		pullRequests = new(mocks.PullRequests)
+		repositories = new(mocks.Repositories)
+		now = time.Date(2017, time.March, 10, 12, 0, 0, 0, time.UTC)
+		redPRs = nil
+		labeledPRs = nil
+		statusState = "failure"
+		statusTime = now.Add(-96 * time.Hour)
+	})
+
+	JustBeforeEach(func() {
+		repo := fmt.Sprintf("repo:%s/%s", repositoryOwner, repositoryName)
+		search.
+			On("Issues", anyContext, fmt.Sprintf("is:pr is:open status:failure -label:\"%s\" %s", grh.OnHoldLabel, repo),
+				mock.AnythingOfType("*github.SearchOptions")).
+			Return(&github.IssuesSearchResult{Total: github.Int(len(redPRs)), Issues: redPRs}, &github.Response{},
+				noError)
+		search.
+			On("Issues", anyContext, fmt.Sprintf("is:pr is:open label:\"%s\" -label:\"%s\" %s", grh.StaleCILabel,
+				grh.OnHoldLabel, repo),
+				mock.AnythingOfType("*github.SearchOptions")).
+			Return(&github.IssuesSearchResult{Total: github.Int(len(labeledPRs)), Issues: labeledPRs},
+				&github.Response{}, noError)
+		pullRequests.
+			On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+			Return(&github.PullRequest{
+				Number: github.Int(issueNumber),
+				User:   &github.User{Login: github.String(arbitraryIssueAuthor)},
+				Base:   &github.PullRequestBranch{Ref: github.String("master"), Repo: repository},
+				Head:   &github.PullRequestBranch{SHA: github.String(headSHA), Repo: repository},
+			}, emptyResponse, noError)
+		repositories.
+			On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA,
+				mock.AnythingOfType("*github.ListOptions")).
+			Return(&github.CombinedStatus{
+				State: github.String(statusState),
+				Statuses: []github.RepoStatus{
+					{Context: github.String("ci"), State: github.String(statusState), UpdatedAt: &statusTime},
+				},
+			}, emptyResponse, noError)
+	})
+
+	AfterEach(func() {
+		search.AssertExpectations(GinkgoT())
+		issues.AssertExpectations(GinkgoT())
+	})
+
+	apply := func() error {
+		return grh.ApplyStaleCIPolicy(conf, store, search, issues, pullRequests, repositories, now)
+	}
+
+	Context("with a PR whose CI has been red for longer than STALE_CI_AGE", func() {
+		BeforeEach(func() {
+			redPRs = []github.Issue{prIssue()}
+			issues.
+				On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+					[]string{grh.StaleCILabel}).
+				Return(emptyResult, emptyResponse, noError)
+			issues.
+				On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+					mock.MatchedBy(commentMentioning(arbitraryIssueAuthor))).
+				Return(emptyResult, emptyResponse, noError)
+		})
+
+		It("labels the PR and warns its author", func() {
+			Expect(apply()).To(Succeed())
+		})
+	})
+
+	Context("with a PR whose CI turned red recently", func() {
+		BeforeEach(func() {
+			redPRs = []github.Issue{prIssue()}
+			statusTime = now.Add(-time.Hour)
+		})
+
+		It("leaves the PR alone", func() {
+			Expect(apply()).To(Succeed())
+		})
+	})
+
+	Context("with the policy disabled for the repository", func() {
+		BeforeEach(func() {
+			redPRs = []github.Issue{prIssue()}
+			disabled := grh.Duration(0)
+			Expect(store.SetPolicies(grh.PolicySet{Repositories: map[string]grh.Policy{
+				repositoryOwner + "/" + repositoryName: {StaleCIAge: &disabled},
+			}})).To(Succeed())
+		})
+
+		It("leaves the PR alone", func() {
+			Expect(apply()).To(Succeed())
+			pullRequests.AssertNotCalled(GinkgoT(), "Get", anyContext, repositoryOwner, repositoryName, issueNumber)
+		})
+	})
+
+	Context("with a labeled PR whose CI has run again", func() {
+		BeforeEach(func() {
+			labeledPRs = []github.Issue{prIssue(grh.StaleCILabel)}
+			statusState = "pending"
+			statusTime = now.Add(-time.Minute)
+			issues.
+				On("RemoveLabelForIssue", anyContext, repositoryOwner, repositoryName, issueNumber,
+					grh.StaleCILabel).
+				Return(emptyResponse, noError)
+		})
+
+		It("removes the label", func() {
+			Expect(apply()).To(Succeed())
+		})
+	})
+
+	Context("with STALE_CI_CLOSE_AFTER", func() {
+		BeforeEach(func() {
+			conf.StaleCICloseAfter = 48 * time.Hour
+			redPRs = []github.Issue{prIssue(grh.StaleCILabel)}
+			labeledPRs = redPRs
+		})
+
+		Context("with the labeled PR red for long enough", func() {
+			BeforeEach(func() {
+				statusTime = now.Add(-120 * time.Hour)
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("I closed this PR"))).
+					Return(emptyResult, emptyResponse, noError).
+					Once()
+				issues.
+					On("Edit", anyContext, repositoryOwner, repositoryName, issueNumber,
+						&github.IssueRequest{State: github.String("closed")}).
+					Return(&github.Issue{}, emptyResponse, noError).
+					Once()
+			})
+
+			It("closes the PR once", func() {
+				Expect(apply()).To(Succeed())
+			})
+		})
+
+		Context("with the labeled PR not red for long enough", func() {
+			It("keeps waiting", func() {
+				Expect(apply()).To(Succeed())
+			})
+		})
+	})
+})
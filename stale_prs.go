@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+var issueAPIURLRegexp = regexp.MustCompile(`/repos/([^/]+)/([^/]+)/issues/\d+$`)
+
+// runStalePRReminders periodically reminds the authors and reviewers of
+// stale PRs about them, until stop is closed.
+func runStalePRReminders(configSource ConfigSource, store Store, search Search, issues Issues,
+	stop <-chan struct{}) {
+
+	conf := configSource.Current()
+	if conf.StalePRCheckInterval == 0 {
+		log.Println("Stale PR reminders disabled")
+		return
+	}
+	ticker := time.NewTicker(conf.StalePRCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			conf := configSource.Current()
+			if conf.StalePRAge == 0 || len(conf.StalePRRepositories) == 0 {
+				continue
+			} else if pausedForGithubIncident("stale PR reminders") || throttledForRateLimit(conf, "stale PR reminders") {
+				continue
+			}
+			if err := RemindOfStalePRs(conf, store, search, issues, time.Now()); err != nil {
+				log.Printf("Reminding of stale PRs failed: %v\n", err)
+			}
+		}
+	}
+}
+
+// RemindOfStalePRs comments on the open PRs in conf.StalePRRepositories that
+// haven't been updated in conf.StalePRAge, mentioning their authors and the
+// reviewers whose reviews are still pending. If conf.RemoveStaleMergingLabels is set, then the
+// merging label is removed from the stale PRs that have it instead. PRs on
+// hold are left alone. The comments count as activity, so a PR is reminded
+// of at most once per conf.StalePRAge.
+func RemindOfStalePRs(conf Config, store Store, search Search, issues Issues, now time.Time) error {
+	query := stalePRQuery(conf.StalePRRepositories, now.Add(-conf.StalePRAge))
+	stalePRs, err := searchIssues(query, search)
+	if err != nil {
+		return fmt.Errorf("searching for stale PRs with query '%s' failed: %v", query, err)
+	}
+	var firstErr error
+	for _, stalePR := range stalePRs {
+		if err := remindOfStalePR(conf, stalePR, store, issues); err != nil {
+			log.Println(err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+func stalePRQuery(repositories []string, updatedBefore time.Time) string {
+	qualifiers := []string{
+		"is:pr",
+		"is:open",
+		fmt.Sprintf("-label:\"%s\"", OnHoldLabel),
+		"updated:<" + updatedBefore.UTC().Format(time.RFC3339),
+	}
+	// Multiple user and repo qualifiers match PRs in any of them
+	for _, key := range repositories {
+		if strings.Contains(key, "/") {
+			qualifiers = append(qualifiers, "repo:"+key)
+		} else {
+			qualifiers = append(qualifiers, "user:"+key)
+		}
+	}
+	return strings.Join(qualifiers, " ")
+}
+
+func remindOfStalePR(conf Config, stalePR github.Issue, store Store, issues Issues) error {
+	repository, err := searchResultRepository(stalePR)
+	if err != nil {
+		return err
+	}
+	number := stalePR.GetNumber()
+	fullName := fmt.Sprintf("%s#%d", repositoryKey(repository), number)
+	author := stalePR.User.GetLogin()
+
+	if conf.RemoveStaleMergingLabels && hasGithubLabel(stalePR.Labels, MergingLabel) {
+		_, err := issues.RemoveLabelForIssue(context.TODO(), repository.Owner, repository.Name, number,
+			MergingLabel)
+		if err != nil {
+			return fmt.Errorf("failed to remove the stale %s label from PR %s: %v", MergingLabel, fullName, err)
+		}
+		message := fmt.Sprintf("@%s, I removed the `%s` label, because this PR hasn't had any activity in %s. "+
+			"Add it back once the PR is ready to be merged.", author, MergingLabel, formatDuration(conf.StalePRAge))
+		if err = comment(message, repository, number, issues); err != nil {
+			return fmt.Errorf("failed to explain removing the stale %s label from PR %s: %v", MergingLabel,
+				fullName, err)
+		}
+		log.Printf("Removed the stale %s label from PR %s.\n", MergingLabel, fullName)
+		return nil
+	}
+
+	requests, err := store.ReviewRequests(repository)
+	if err != nil {
+		return fmt.Errorf("failed to list the tracked review requests of %s: %v", repositoryKey(repository), err)
+	}
+	mentions := []string{"@" + author}
+	for _, request := range requests {
+		if request.PullRequest == number && request.Pending() && request.Reviewer != author {
+			mentions = append(mentions, "@"+request.Reviewer)
+		}
+	}
+	reminder := strings.Replace(conf.StalePRReminder, "{age}", formatDuration(conf.StalePRAge), -1)
+	message := fmt.Sprintf("%s, %s", strings.Join(mentions, ", "), reminder)
+	if err = comment(message, repository, number, issues); err != nil {
+		return fmt.Errorf("failed to remind of stale PR %s: %v", fullName, err)
+	}
+	log.Printf("Reminded %s of stale PR %s.\n", strings.Join(mentions, ", "), fullName)
+	return nil
+}
+
+// searchResultRepository gets the repository of an issue found by searching
+// from the issue's API URL, e.g.
+// "https://api.github.com/repos/owner/name/issues/1".
+func searchResultRepository(issue github.Issue) (Repository, error) {
+	matches := issueAPIURLRegexp.FindStringSubmatch(issue.GetURL())
+	if matches == nil {
+		return Repository{}, fmt.Errorf("failed to parse the repository of issue #%d from \"%s\"",
+			issue.GetNumber(), issue.GetURL())
+	}
+	// GitLab's namespaces may include subgroups, whose slashes are escaped
+	owner, err := url.PathUnescape(matches[1])
+	if err != nil {
+		return Repository{}, fmt.Errorf("failed to parse the repository of issue #%d from \"%s\": %v",
+			issue.GetNumber(), issue.GetURL(), err)
+	}
+	return Repository{Owner: owner, Name: matches[2]}, nil
+}
+
+func hasGithubLabel(labels []github.Label, name string) bool {
+	for _, label := range labels {
+		if label.GetName() == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package main_test
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RemindOfStalePRs", func() {
+	var (
+		conf   grh.Config
+		store  grh.Store
+		search *mocks.Search
+		issues *mocks.Issues
+		now    time.Time
+
+		repository = grh.Repository{Owner: repositoryOwner, Name: repositoryName}
+		stalePR    = func(number int, labels ...string) github.Issue {
+			issue := github.Issue{
+				Number: github.Int(number),
+				URL: github.String(fmt.Sprintf("https://api.github.com/repos/%s/%s/issues/%d", repositoryOwner,
+					repositoryName, number)),
+				User: &github.User{Login: github.String("alice")},
+			}
+			for _, label := range labels {
+				issue.Labels = append(issue.Labels, github.Label{Name: github.String(label)})
+			}
+			return issue
+		}
+	)
+
+	BeforeEach(func() {
+		conf = grh.Config{
+			StalePRRepositories: []string{"salemove", "deiwin/dotfiles"},
+			StalePRAge:          72 * time.Hour,
+			StalePRReminder:     "is this still needed?",
+		}
+		store = grh.NewMemoryStore()
+		search = new(mocks.Search)
+		issues = new(mocks.Issues)
+		now = time.Date(2017, time.March, 10, 12, 0, 0, 0, time.UTC)
+
+		query := fmt.Sprintf("is:pr is:open -label:\"%s\" updated:<2017-03-07T12:00:00Z user:salemove "+
+			"repo:deiwin/dotfiles", grh.OnHoldLabel)
+		searchResult := &github.IssuesSearchResult{
+			Total:  github.Int(2),
+			Issues: []github.Issue{stalePR(1), stalePR(2, grh.MergingLabel)},
+		}
+		search.
+			On("Issues", anyContext, query, mock.AnythingOfType("*github.SearchOptions")).
+			Return(searchResult, &github.Response{}, noError)
+
+		Expect(store.AddReviewRequest(grh.ReviewRequest{Repository: repository, PullRequest: 1, Reviewer: "bob",
+			RequestedAt: now.Add(-100 * time.Hour)})).To(Succeed())
+		Expect(store.AddReviewRequest(grh.ReviewRequest{Repository: repository, PullRequest: 1, Reviewer: "carol",
+			RequestedAt: now.Add(-100 * time.Hour), RespondedAt: now.Add(-90 * time.Hour)})).To(Succeed())
+	})
+
+	AfterEach(func() {
+		search.AssertExpectations(GinkgoT())
+		issues.AssertExpectations(GinkgoT())
+	})
+
+	Context("by default", func() {
+		BeforeEach(func() {
+			issues.
+				On("CreateComment", anyContext, repositoryOwner, repositoryName, 1,
+					mock.MatchedBy(func(issueComment *github.IssueComment) bool {
+						return *issueComment.Body == "@alice, @bob, is this still needed?"
+					})).
+				Return(emptyResult, emptyResponse, noError)
+			issues.
+				On("CreateComment", anyContext, repositoryOwner, repositoryName, 2,
+					mock.MatchedBy(func(issueComment *github.IssueComment) bool {
+						return *issueComment.Body == "@alice, is this still needed?"
+					})).
+				Return(emptyResult, emptyResponse, noError)
+		})
+
+		It("reminds the authors and pending reviewers of the stale PRs", func() {
+			Expect(grh.RemindOfStalePRs(conf, store, search, issues, now)).To(Succeed())
+		})
+	})
+
+	Context("with REMOVE_STALE_MERGING_LABELS", func() {
+		BeforeEach(func() {
+			conf.RemoveStaleMergingLabels = true
+
+			issues.
+				On("CreateComment", anyContext, repositoryOwner, repositoryName, 1,
+					mock.MatchedBy(commentContaining("is this still needed?"))).
+				Return(emptyResult, emptyResponse, noError)
+			issues.
+				On("RemoveLabelForIssue", anyContext, repositoryOwner, repositoryName, 2, grh.MergingLabel).
+				Return(emptyResponse, noError)
+			issues.
+				On("CreateComment", anyContext, repositoryOwner, repositoryName, 2,
+					mock.MatchedBy(commentContaining("I removed the `merging` label"))).
+				Return(emptyResult, emptyResponse, noError)
+		})
+
+		It("removes the merging labels of the stale PRs instead of reminding of them", func() {
+			Expect(grh.RemindOfStalePRs(conf, store, search, issues, now)).To(Succeed())
+		})
+	})
+})
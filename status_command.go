@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/evaluator"
+)
+
+func isStatusCommand(comment string) bool {
+	return strings.TrimSpace(comment) == "!status"
+}
+
+func isSimulateMergeCommand(comment string) bool {
+	return strings.Join(strings.Fields(comment), " ") == "!simulate merge"
+}
+
+// handleStatusCommand explains on the PR which of the merge rules the PR
+// passes and which block it. When simulating a merge, the explanation starts
+// with what the bot would do if the PR was labeled for merging now.
+func handleStatusCommand(conf Config, issueComment IssueComment, simulate bool, store Store, issues Issues,
+	pullRequests PullRequests, repositories Repositories, graphQL GraphQL) Response {
+
+	issue := issueComment.Issue()
+	pr, errResp := getPR(issue, pullRequests)
+	if errResp != nil {
+		return errResp
+	}
+	rules := readinessRules(conf, pr, store, issues, pullRequests, repositories, graphQL)
+	decision, errResp := evaluate(rules, true)
+	if errResp != nil {
+		return errResp
+	}
+	var summary string
+	if simulate {
+		summary = fmt.Sprintf("If this PR was labeled for merging now, I would %s.",
+			simulatedMergeAction(conf, pr, decision))
+	} else if blocker := decision.Blocker(); blocker != nil {
+		summary = fmt.Sprintf("This PR is not ready to be merged, because %s.", blocker.Reason)
+	} else {
+		summary = "This PR is ready to be merged."
+	}
+	message := summary + "\n\n" + decision.Markdown()
+	if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+		errorMessage := fmt.Sprintf("Failed to report the merge status of PR %s", issue.FullName())
+		return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	return SuccessResponse{message}
+}
+
+// simulatedMergeAction describes what the bot would do with a PR labeled for
+// merging, given the decision about the PR's readiness.
+func simulatedMergeAction(conf Config, pr *github.PullRequest, decision evaluator.Decision) string {
+	blocker := decision.Blocker()
+	switch {
+	case blocker == nil && conf.MergeStrategy == MergeStrategyVerifiedRebase:
+		return fmt.Sprintf("rebase it onto the latest `%s` and merge it once the build of the rebased commit "+
+			"succeeds", *pr.Base.Ref)
+	case blocker == nil && conf.MergeStrategy == MergeStrategyFastForward:
+		return fmt.Sprintf("fast-forward `%s` to it", *pr.Base.Ref)
+	case blocker == nil:
+		return "merge it"
+	case blocker.Rule == statusesRule && hasPendingSquashStatus(blocker.Children):
+		return "squash it and merge it once its statuses succeed"
+	case blocker.Rule == mergeFreezeRule:
+		return fmt.Sprintf("not merge it yet, because %s", blocker.Reason)
+	case blocker.Outcome == evaluator.Pending:
+		return fmt.Sprintf("wait with merging it, because %s", blocker.Reason)
+	}
+	return fmt.Sprintf("not merge it, because %s", blocker.Reason)
+}
+
+func hasPendingSquashStatus(statuses []evaluator.Node) bool {
+	for _, status := range statuses {
+		if status.Rule == githubStatusSquashContext && status.Outcome == evaluator.Pending {
+			return true
+		}
+	}
+	return false
+}
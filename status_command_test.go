@@ -0,0 +1,158 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	var (
+		handle      = context.Handle
+		headers     = context.Headers
+		requestJSON = context.RequestJSON
+
+		responseRecorder *httptest.ResponseRecorder
+		pullRequests     *mocks.PullRequests
+		repositories     *mocks.Repositories
+		issues           *mocks.Issues
+	)
+	BeforeEach(func() {
+		responseRecorder = *context.ResponseRecorder
+		pullRequests = *context.PullRequests
+		repositories = *context.Repositories
+		issues = *context.Issues
+	})
+
+	headSHA := "1235"
+	pr := &github.PullRequest{
+		Number:    github.Int(issueNumber),
+		Merged:    github.Bool(false),
+		Mergeable: github.Bool(true),
+		Base: &github.PullRequestBranch{
+			SHA:  github.String("1234"),
+			Ref:  github.String("master"),
+			Repo: repository,
+		},
+		Head: &github.PullRequestBranch{
+			SHA:  github.String(headSHA),
+			Ref:  github.String("feature"),
+			Repo: repository,
+		},
+		User: &github.User{
+			Login: github.String(arbitraryIssueAuthor),
+		},
+	}
+
+	headers.Is(func() map[string]string {
+		return map[string]string{
+			"X-Github-Event": "issue_comment",
+		}
+	})
+
+	BeforeEach(func() {
+		repositories.
+			On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+			Return(true, emptyResponse, noError)
+		pullRequests.
+			On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+			Return(pr, emptyResponse, noError)
+		repositories.
+			On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.AnythingOfType("*github.ListOptions")).
+			Return(&github.CombinedStatus{
+				State: github.String("success"),
+				Statuses: []github.RepoStatus{{
+					Context: github.String("ci"),
+					State:   github.String("success"),
+				}},
+			}, emptyResponse, noError)
+	})
+
+	expectComment := func(texts ...string) {
+		BeforeEach(func() {
+			issues.
+				On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+					mock.MatchedBy(func(comment *github.IssueComment) bool {
+						for _, text := range texts {
+							if !commentContaining(text)(comment) {
+								return false
+							}
+						}
+						return true
+					})).
+				Return(emptyResult, emptyResponse, noError)
+		})
+
+		It("explains the decision in a comment and in the response", func() {
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			for _, text := range texts {
+				Expect(responseRecorder.Body.String()).To(ContainSubstring(text))
+			}
+		})
+	}
+
+	Describe("!status comment", func() {
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!status", arbitraryIssueAuthor)
+		})
+
+		Context("with the PR passing all rules", func() {
+			BeforeEach(func() {
+				mockLabels(issues, issueNumber)
+			})
+
+			expectComment(
+				"This PR is ready to be merged.",
+				":white_check_mark: **statuses**",
+				"  - :white_check_mark: **ci**",
+				":white_check_mark: **hold**",
+			)
+		})
+
+		Context("with the PR on hold and lacking approvals", func() {
+			BeforeEach(func() {
+				context.Config.RequiredApprovals = 1
+				mockLabels(issues, issueNumber, grh.OnHoldLabel)
+				pullRequests.
+					On("ListReviews", anyContext, repositoryOwner, repositoryName, issueNumber, mock.AnythingOfType("*github.ListOptions")).
+					Return([]*github.PullRequestReview{}, &github.Response{}, noError)
+			})
+
+			expectComment(
+				"This PR is not ready to be merged, because it's on hold.",
+				":x: **hold**: it's on hold",
+				":x: **approvals**: it has 0 current approval(s), but 1 are required",
+			)
+		})
+	})
+
+	Describe("!simulate merge comment", func() {
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!simulate merge", arbitraryIssueAuthor)
+		})
+
+		Context("with the PR passing all rules", func() {
+			BeforeEach(func() {
+				mockLabels(issues, issueNumber)
+			})
+
+			expectComment("If this PR was labeled for merging now, I would merge it.")
+		})
+
+		Context("with the PR on hold", func() {
+			BeforeEach(func() {
+				mockLabels(issues, issueNumber, grh.OnHoldLabel)
+			})
+
+			expectComment("If this PR was labeled for merging now, I would not merge it, because it's on hold.")
+		})
+	})
+})
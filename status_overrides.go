@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/git"
+)
+
+// overrideStatuses records the commenter's decision to ignore the statuses of
+// the given contexts when merging the PR's current head and notes the override
+// on the PR.
+// Contexts required by the base branch's protection can't be overridden. The
+// reason why the statuses weren't overridden is returned, if they weren't.
+func overrideStatuses(conf Config, issueComment IssueComment, contexts []string, store Store, issues Issues,
+	pullRequests PullRequests, repositories Repositories) (string, *ErrorResponse) {
+
+	issue := issueComment.Issue()
+	if !conf.AllowStatusOverrides {
+		return "overriding statuses is disabled", nil
+	}
+	pr, errResp := getPR(issue, pullRequests)
+	if errResp != nil {
+		return "", errResp
+	}
+	requiredContexts, errResp := getRequiredStatusContexts(pr, repositories)
+	if errResp != nil {
+		return "", errResp
+	}
+	isRequired := make(map[string]bool)
+	for _, context := range requiredContexts {
+		isRequired[context] = true
+	}
+	var required []string
+	for _, context := range contexts {
+		if isRequired[context] {
+			required = append(required, context)
+		}
+	}
+	if len(required) > 0 {
+		return fmt.Sprintf("the branch protection of %s requires %s", *pr.Base.Ref, formatContexts(required)), nil
+	}
+
+	for _, context := range contexts {
+		override := StatusOverride{
+			Repository:  issue.Repository,
+			PullRequest: issue.Number,
+			Context:     context,
+			User:        issueComment.Commenter.Login,
+			CreatedAt:   time.Now(),
+			HeadSHA:     *pr.Head.SHA,
+		}
+		if err := store.AddStatusOverride(override); err != nil {
+			message := fmt.Sprintf("Failed to record the status override for PR %s", issue.FullName())
+			return "", &ErrorResponse{err, http.StatusInternalServerError, message}
+		}
+		log.Printf("%s overrode the %s status of PR %s.\n", override.User, context, issue.FullName())
+	}
+	message := fmt.Sprintf("@%s overrode the %s status of this PR at %s. I'll ignore it when deciding whether "+
+		"to merge this PR, until new commits are pushed.", issueComment.Commenter.Login, formatContexts(contexts),
+		shortSHA(*pr.Head.SHA))
+	if err := notify(conf, message, issue, store, issues); err != nil {
+		errorMessage := fmt.Sprintf("Failed to note the status override on PR %s", issue.FullName())
+		return "", &ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	return "", nil
+}
+
+func formatContexts(contexts []string) string {
+	return "`" + strings.Join(contexts, "`, `") + "`"
+}
+
+// overriddenContexts returns the contexts whose statuses have been overridden
+// for the PR's current head.
+func overriddenContexts(pr *github.PullRequest, store Store) (map[string]bool, *ErrorResponse) {
+	issue := prIssue(pr)
+	overrides, err := store.StatusOverrides(issue.Repository)
+	if err != nil {
+		message := fmt.Sprintf("Failed to list the status overrides for PR %s", issue.FullName())
+		return nil, &ErrorResponse{err, http.StatusInternalServerError, message}
+	}
+	contexts := make(map[string]bool)
+	for _, override := range overrides {
+		if override.PullRequest == issue.Number && override.HeadSHA == *pr.Head.SHA {
+			contexts[override.Context] = true
+		}
+	}
+	return contexts, nil
+}
+
+// applyStatusOverrides returns the PR's combined state with the statuses of
+// its overridden contexts ignored.
+func applyStatusOverrides(pr *github.PullRequest, state string, statuses []github.RepoStatus,
+	store Store) (string, *ErrorResponse) {
+
+	if state == "success" {
+		return state, nil
+	}
+	ignoredContexts, errResp := overriddenContexts(pr, store)
+	if errResp != nil || len(ignoredContexts) == 0 {
+		return state, errResp
+	}
+	state = "success"
+	for _, status := range statuses {
+		if ignoredContexts[*status.Context] {
+			continue
+		}
+		switch *status.State {
+		case "failure", "error":
+			return "failure", nil
+		case "pending":
+			state = "pending"
+		}
+	}
+	return state, nil
+}
+
+// mergeOverriddenPRs merges the repository's PRs that have overridden
+// statuses, if the status event has made them ready. The search for PRs ready
+// for merging doesn't find them, because their combined state isn't
+// "success".
+func mergeOverriddenPRs(conf Config, statusEvent StatusEvent, gitRepos git.Repos, store Store, issues Issues,
+	pullRequests PullRequests, repositories Repositories, graphQL GraphQL) {
+
+	overrides, err := store.StatusOverrides(statusEvent.Repository)
+	if err != nil {
+		log.Printf("Failed to list the status overrides for %s: %v\n", repositoryKey(statusEvent.Repository), err)
+		return
+	}
+	checked := make(map[int]bool)
+	for _, override := range overrides {
+		if checked[override.PullRequest] || override.HeadSHA != statusEvent.SHA {
+			continue
+		}
+		checked[override.PullRequest] = true
+		issue := Issue{
+			Number:     override.PullRequest,
+			Repository: statusEvent.Repository,
+		}
+		pr, errResp := getPR(issue, pullRequests)
+		if errResp != nil {
+			errResp.logResponse()
+			continue
+		} else if *pr.Head.SHA != statusEvent.SHA {
+			continue
+		}
+		mergeIfLabeled(conf, prIssue(pr), store, issues, pullRequests, repositories, graphQL, gitRepos).
+			logResponse()
+	}
+}
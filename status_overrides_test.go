@@ -0,0 +1,246 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("!merge comment with ignored contexts", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			store            grh.Store
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			store = *context.Store
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!merge ignore=ci/optional", arbitraryIssueAuthor)
+		})
+
+		headSHA := "1235"
+		pr := &github.PullRequest{
+			Number:    github.Int(issueNumber),
+			Merged:    github.Bool(false),
+			Mergeable: github.Bool(true),
+			Base: &github.PullRequestBranch{
+				SHA:  github.String("1234"),
+				Ref:  github.String("master"),
+				Repo: repository,
+			},
+			Head: &github.PullRequestBranch{
+				SHA:  github.String(headSHA),
+				Ref:  github.String("feature"),
+				Repo: repository,
+			},
+			User: &github.User{
+				Login: github.String(arbitraryIssueAuthor),
+			},
+		}
+
+		BeforeEach(func() {
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+		})
+
+		expectRefusal := func(reason string) {
+			BeforeEach(func() {
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining(reason))).
+					Return(emptyResult, emptyResponse, noError)
+			})
+
+			It("refuses to override the status", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(responseRecorder.Body.String()).To(ContainSubstring("Not overriding"))
+				Expect(store.StatusOverrides(trackedRepository)).To(BeEmpty())
+			})
+		}
+
+		Context("with status overrides being disabled", func() {
+			expectRefusal("overriding statuses is disabled")
+		})
+
+		Context("with status overrides being disabled by the organization's policy", func() {
+			BeforeEach(func() {
+				context.Config.AllowStatusOverrides = true
+				Expect(store.SetPolicies(grh.PolicySet{Organizations: map[string]grh.Policy{
+					repositoryOwner: {AllowStatusOverrides: github.Bool(false)},
+				}})).To(Succeed())
+			})
+
+			expectRefusal("overriding statuses is disabled")
+		})
+
+		Context("with status overrides being allowed by the repository's policy", func() {
+			BeforeEach(func() {
+				Expect(store.SetPolicies(grh.PolicySet{
+					Organizations: map[string]grh.Policy{
+						repositoryOwner: {AllowStatusOverrides: github.Bool(false)},
+					},
+					Repositories: map[string]grh.Policy{
+						repositoryOwner + "/" + repositoryName: {AllowStatusOverrides: github.Bool(true)},
+					},
+				})).To(Succeed())
+				pullRequests.
+					On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+					Return(pr, emptyResponse, noError)
+				repositories.
+					On("GetRequiredStatusChecks", anyContext, repositoryOwner, repositoryName, "master").
+					Return(&github.RequiredStatusChecks{
+						Contexts: []string{"ci/optional"},
+					}, emptyResponse, noError)
+			})
+
+			expectRefusal("the branch protection of master requires `ci/optional`")
+		})
+
+		Context("with status overrides being allowed", func() {
+			BeforeEach(func() {
+				context.Config.AllowStatusOverrides = true
+				pullRequests.
+					On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+					Return(pr, emptyResponse, noError)
+			})
+
+			Context("with the context being required", func() {
+				BeforeEach(func() {
+					repositories.
+						On("GetRequiredStatusChecks", anyContext, repositoryOwner, repositoryName, "master").
+						Return(&github.RequiredStatusChecks{
+							Contexts: []string{"ci/required", "ci/optional"},
+						}, emptyResponse, noError)
+				})
+
+				expectRefusal("the branch protection of master requires `ci/optional`")
+			})
+
+			Context("with an override given for an earlier head", func() {
+				requestJSON.Is(func() string {
+					return IssueCommentEvent("!merge", arbitraryIssueAuthor)
+				})
+
+				BeforeEach(func() {
+					Expect(store.AddStatusOverride(grh.StatusOverride{
+						Repository:  trackedRepository,
+						PullRequest: issueNumber,
+						Context:     "ci/optional",
+						User:        arbitraryIssueAuthor,
+						CreatedAt:   time.Now(),
+						HeadSHA:     "1111",
+					})).To(Succeed())
+					issues.
+						On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{grh.MergingLabel}).
+						Return(emptyResult, emptyResponse, noError)
+					repositories.
+						On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.AnythingOfType("*github.ListOptions")).
+						Return(&github.CombinedStatus{
+							State: github.String("failure"),
+							Statuses: []github.RepoStatus{{
+								Context: github.String("ci/optional"),
+								State:   github.String("failure"),
+							}},
+						}, emptyResponse, noError)
+				})
+
+				It("doesn't ignore the status on the new head", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					pullRequests.AssertNotCalled(GinkgoT(), "Merge", anyContext, repositoryOwner, repositoryName,
+						issueNumber, mock.Anything, mock.Anything)
+				})
+			})
+
+			Context("with the context being optional", func() {
+				BeforeEach(func() {
+					repositories.
+						On("GetRequiredStatusChecks", anyContext, repositoryOwner, repositoryName, "master").
+						Return(&github.RequiredStatusChecks{
+							Contexts: []string{"ci/required"},
+						}, emptyResponse, noError)
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("@"+arbitraryIssueAuthor+" overrode the `ci/optional` status"))).
+						Return(emptyResult, emptyResponse, noError)
+					issues.
+						On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{grh.MergingLabel}).
+						Return(emptyResult, emptyResponse, noError)
+				})
+
+				mockStatuses := func(states map[string]string) {
+					BeforeEach(func() {
+						var statuses []github.RepoStatus
+						for context, state := range states {
+							statuses = append(statuses, github.RepoStatus{
+								Context: github.String(context),
+								State:   github.String(state),
+							})
+						}
+						repositories.
+							On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.AnythingOfType("*github.ListOptions")).
+							Return(&github.CombinedStatus{
+								State:    github.String("failure"),
+								Statuses: statuses,
+							}, emptyResponse, noError)
+					})
+				}
+
+				Context("with only the ignored context failing", func() {
+					mockStatuses(map[string]string{"ci/optional": "failure", "ci/required": "success"})
+
+					BeforeEach(func() {
+						mockLabels(issues, issueNumber, grh.MergingLabel)
+					})
+
+					ItMergesPR(context, pr)
+				})
+
+				Context("with another context failing as well", func() {
+					mockStatuses(map[string]string{"ci/optional": "failure", "ci/required": "failure"})
+
+					It("records the override without merging", func() {
+						handle()
+						Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+
+						overrides, err := store.StatusOverrides(trackedRepository)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(overrides).To(HaveLen(1))
+						Expect(overrides[0].PullRequest).To(Equal(issueNumber))
+						Expect(overrides[0].Context).To(Equal("ci/optional"))
+						Expect(overrides[0].User).To(Equal(arbitraryIssueAuthor))
+						Expect(overrides[0].HeadSHA).To(Equal(headSHA))
+					})
+				})
+			})
+		})
+	})
+})
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/google/go-github/github"
+)
+
+const minimizeCommentMutation = `mutation($subjectId: ID!) {
+  minimizeComment(input: {subjectId: $subjectId, classifier: OUTDATED}) {
+    minimizedComment {
+      isMinimized
+    }
+  }
+}`
+
+// stickyComment reports the PR's latest state, e.g. why it isn't being
+// merged, in the bot's status comment on the PR. With STICKY_COMMENTS, the
+// status comment is edited in place, so that long-lived PRs wouldn't collect
+// a comment and a notification for every change. Otherwise, or if the status
+// comment has been deleted, a new comment is posted.
+func stickyComment(conf Config, message string, issue Issue, store Store, issues Issues) error {
+	if !conf.StickyComments {
+		return comment(message, issue.Repository, issue.Number, issues)
+	}
+	existing, exists, err := store.StickyComment(issue)
+	if err != nil {
+		return fmt.Errorf("failed to get the status comment of PR %s: %v", issue.FullName(), err)
+	} else if exists {
+		_, resp, err := issues.EditComment(context.TODO(), issue.Repository.Owner, issue.Repository.Name,
+			existing.ID, &github.IssueComment{Body: github.String(message)})
+		if err == nil {
+			return nil
+		} else if !is404Error(resp) {
+			return err
+		}
+		log.Printf("The status comment of PR %s has been deleted. Posting a new one.\n", issue.FullName())
+	}
+	created, _, err := issues.CreateComment(context.TODO(), issue.Repository.Owner, issue.Repository.Name,
+		issue.Number, &github.IssueComment{Body: github.String(message)})
+	if err != nil {
+		return err
+	}
+	err = store.SetStickyComment(StickyComment{
+		Issue:  issue,
+		ID:     created.GetID(),
+		NodeID: created.GetNodeID(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record the status comment of PR %s: %v", issue.FullName(), err)
+	}
+	return nil
+}
+
+// minimizeStickyComment hides the status comment of a closed PR as outdated,
+// because the state it describes no longer matters. Failing to hide it is
+// only logged.
+func minimizeStickyComment(issue Issue, store Store, graphQL GraphQL) {
+	existing, exists, err := store.StickyComment(issue)
+	if err != nil {
+		log.Printf("Failed to get the status comment of PR %s: %v\n", issue.FullName(), err)
+		return
+	} else if !exists {
+		return
+	}
+	if err = store.RemoveStickyComment(issue); err != nil {
+		log.Printf("Failed to forget the status comment of PR %s: %v\n", issue.FullName(), err)
+	}
+	var result struct{}
+	err = graphQL.Query(context.TODO(), minimizeCommentMutation, map[string]interface{}{
+		"subjectId": existing.NodeID,
+	}, &result)
+	if err != nil {
+		log.Printf("Failed to minimize the status comment of PR %s: %v\n", issue.FullName(), err)
+	}
+}
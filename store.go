@@ -0,0 +1,1661 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store holds the state the bot has to remember between webhooks.
+type Store interface {
+	AddBotBranch(branch BotBranch) error
+	// BotBranches lists the tracked bot-created branches of the repository
+	BotBranches(repository Repository) ([]BotBranch, error)
+	// AllBotBranches lists the tracked bot-created branches of all
+	// repositories
+	AllBotBranches() ([]BotBranch, error)
+	RemoveBotBranch(repository Repository, name string) error
+
+	// AddReviewRequest tracks a review request, replacing the reviewer's
+	// pending request for the same PR, if there is one
+	AddReviewRequest(request ReviewRequest) error
+	// CompleteReviewRequest marks the reviewer's pending request for the PR
+	// as responded to. It does nothing if there's no pending request.
+	CompleteReviewRequest(repository Repository, pullRequest int, reviewer string, respondedAt time.Time) error
+	// RemoveReviewRequest stops tracking the reviewer's pending request for
+	// the PR
+	RemoveReviewRequest(repository Repository, pullRequest int, reviewer string) error
+	// RemoveReviewRequests stops tracking all of the PR's requests, pending
+	// and completed
+	RemoveReviewRequests(repository Repository, pullRequest int) error
+	// ReviewRequests lists the tracked review requests of the repository
+	ReviewRequests(repository Repository) ([]ReviewRequest, error)
+	// AllReviewRequests lists the tracked review requests of all
+	// repositories
+	AllReviewRequests() ([]ReviewRequest, error)
+
+	// AddDeferredMerge remembers to merge the PR once the merge freeze that
+	// blocked it has ended
+	AddDeferredMerge(issue Issue) error
+	DeferredMerges() ([]Issue, error)
+	RemoveDeferredMerge(issue Issue) error
+
+	// SetMergeMethod records the merge method chosen for the PR. An empty
+	// method forgets the earlier choice.
+	SetMergeMethod(issue Issue, method string) error
+	// MergeMethod returns the merge method chosen for the PR or an empty
+	// string, if none was chosen
+	MergeMethod(issue Issue) (string, error)
+	// SetMergeMessage records the commit message given for the PR's merge.
+	// An empty message forgets the earlier one.
+	SetMergeMessage(issue Issue, message string) error
+	// MergeMessage returns the commit message given for the PR's merge or
+	// an empty string, if none was given
+	MergeMessage(issue Issue) (string, error)
+
+	// SetSignOffWaiver records who waived the PR's sign-off requirement and
+	// for which head commit. An empty waiver forgets it.
+	SetSignOffWaiver(issue Issue, waiver SignOffWaiver) error
+	// SignOffWaiver returns the waiver of the PR's sign-off requirement or an
+	// empty waiver, if nobody has waived it
+	SignOffWaiver(issue Issue) (SignOffWaiver, error)
+
+	// RecordRefusal records that the bot explained why it refuses to merge
+	// the PR and reports whether the reason hadn't been recorded before
+	RecordRefusal(issue Issue, reason string) (bool, error)
+	// Refusals lists the reasons the bot has given for refusing to merge
+	// the PR
+	Refusals(issue Issue) ([]string, error)
+	// RemoveRefusals forgets the PR's recorded refusals
+	RemoveRefusals(issue Issue) error
+
+	// SetMergeQueueEntry records that the PR is in GitHub's native merge
+	// queue, replacing the PR's earlier entry
+	SetMergeQueueEntry(entry MergeQueueEntry) error
+	// MergeQueueEntry returns the PR's entry in GitHub's native merge queue
+	// and whether there is one
+	MergeQueueEntry(issue Issue) (MergeQueueEntry, bool, error)
+	// AllMergeQueueEntries lists the PRs' entries in GitHub's native merge
+	// queues of all repositories in the order they were added
+	AllMergeQueueEntries() ([]MergeQueueEntry, error)
+	RemoveMergeQueueEntry(issue Issue) error
+
+	// AddMergeRequest records who labeled the PR for merging and when. It
+	// does nothing if the PR's earlier request is still recorded, so that
+	// repeating "!merge" wouldn't restart MERGING_LABEL_TTL.
+	AddMergeRequest(request MergeRequest) error
+	MergeRequests() ([]MergeRequest, error)
+	RemoveMergeRequest(issue Issue) error
+
+	// AddForceWait keeps polling the PR for its missing required statuses
+	// until the wait's deadline, replacing the PR's earlier wait
+	AddForceWait(wait ForceWait) error
+	ForceWaits() ([]ForceWait, error)
+	RemoveForceWait(issue Issue) error
+
+	// AddScheduledMerge schedules the PR to be merged, replacing the PR's
+	// earlier schedule
+	AddScheduledMerge(scheduled ScheduledMerge) error
+	// ScheduledMerge returns the PR's scheduled merge and whether there is
+	// one
+	ScheduledMerge(issue Issue) (ScheduledMerge, bool, error)
+	// ScheduledMerges lists the scheduled merges of all repositories, the
+	// earliest first
+	ScheduledMerges() ([]ScheduledMerge, error)
+	RemoveScheduledMerge(issue Issue) error
+
+	// SetPendingRerun records the check suites re-requested with
+	// "!rerun-checks", replacing the PR's earlier rerun
+	SetPendingRerun(rerun PendingRerun) error
+	PendingReruns() ([]PendingRerun, error)
+	RemovePendingRerun(issue Issue) error
+
+	// SetStickyComment records the bot's status comment on the PR, which is
+	// edited instead of posting new comments
+	SetStickyComment(comment StickyComment) error
+	// StickyComment returns the PR's status comment and whether there is one
+	StickyComment(issue Issue) (StickyComment, bool, error)
+	RemoveStickyComment(issue Issue) error
+
+	// RecordCommandUse counts a handled command by its repository, name and
+	// outcome on the UTC day it was issued. Days older than
+	// commandStatsRetention are forgotten.
+	RecordCommandUse(repository Repository, command, outcome string, at time.Time) error
+	// CommandStats lists the daily command counts from the day of since on,
+	// ordered by day
+	CommandStats(since time.Time) ([]CommandStat, error)
+
+	// AddStatusOverride records that a failing status context should be
+	// ignored when merging the PR, replacing an earlier override of the same
+	// context
+	AddStatusOverride(override StatusOverride) error
+	// StatusOverrides lists the status overrides of the repository's PRs
+	StatusOverrides(repository Repository) ([]StatusOverride, error)
+	// RemoveStatusOverrides removes all of the PR's status overrides
+	RemoveStatusOverrides(repository Repository, pullRequest int) error
+
+	// AddValidation records a validation build of a PR, replacing an earlier
+	// validation of the same PR
+	AddValidation(validation Validation) error
+	// Validations lists the validation builds in progress in the repository
+	Validations(repository Repository) ([]Validation, error)
+	// AllValidations lists the validation builds in progress in all
+	// repositories
+	AllValidations() ([]Validation, error)
+	RemoveValidation(repository Repository, pullRequest int) error
+
+	// AddNotification queues a notification to be posted in the PR's next
+	// digest
+	AddNotification(notification Notification) error
+	// Notifications lists the queued notifications of all PRs in the order
+	// they were queued
+	Notifications() ([]Notification, error)
+	// RemoveNotifications removes the PR's notifications queued at or before
+	// until
+	RemoveNotifications(repository Repository, pullRequest int, until time.Time) error
+
+	// AddReminder stores a reminder to be posted once it's due
+	AddReminder(reminder Reminder) error
+	// Reminders lists the pending reminders of all PRs
+	Reminders() ([]Reminder, error)
+	RemoveReminder(reminder Reminder) error
+
+	// LastAssignedReviewer returns the reviewer whose turn it was in the
+	// repository's latest round-robin reviewer assignment or "", if there
+	// hasn't been one
+	LastAssignedReviewer(repository Repository) (string, error)
+	SetLastAssignedReviewer(repository Repository, reviewer string) error
+
+	// OnboardRepository records that the bot started acting on the repository
+	// at the given time, unless it has already been recorded. Returns the
+	// recorded time.
+	OnboardRepository(repository Repository, at time.Time) (time.Time, error)
+	// SetPendingConfirmation records an action waiting for a confirmation on
+	// a PR, replacing the PR's earlier pending confirmation
+	SetPendingConfirmation(confirmation PendingConfirmation) error
+	// PendingConfirmation returns the action waiting for a confirmation on
+	// the PR and whether there is one
+	PendingConfirmation(repository Repository, pullRequest int) (PendingConfirmation, bool, error)
+	RemovePendingConfirmation(repository Repository, pullRequest int) error
+
+	// Policy returns the repository's policy and whether it has one
+	Policy(repository Repository) (Policy, bool, error)
+	// OrganizationPolicy returns the policy of the owner's repositories and
+	// whether there is one
+	OrganizationPolicy(owner string) (Policy, bool, error)
+	Policies() (PolicySet, error)
+	// SetPolicies replaces all of the policies with the ones in the set
+	SetPolicies(policies PolicySet) error
+
+	// SetSelfTest records the result of the repository's latest self-test,
+	// replacing the earlier one
+	SetSelfTest(selfTest SelfTest) error
+	// SelfTests lists the latest self-tests of all repositories
+	SelfTests() ([]SelfTest, error)
+
+	// ClaimDelivery records the webhook delivery until expiresAt and reports
+	// whether it was new. A delivery that has already been claimed and
+	// hasn't expired by now can't be claimed again.
+	ClaimDelivery(deliveryID string, now, expiresAt time.Time) (bool, error)
+	// ReleaseDelivery forgets the delivery, so that it could be handled
+	// again
+	ReleaseDelivery(deliveryID string) error
+
+	// QueueFailedDelivery queues the delivery to be retried and reports
+	// whether it was queued. A delivery that is already queued is left as
+	// it is.
+	QueueFailedDelivery(delivery FailedDelivery) (bool, error)
+	// UpdateFailedDelivery replaces the queued delivery with the same ID,
+	// e.g. to reschedule it
+	UpdateFailedDelivery(delivery FailedDelivery) error
+	RemoveFailedDelivery(deliveryID string) error
+	FailedDeliveries() ([]FailedDelivery, error)
+
+	// AddDeployment tracks the deployment, so that its statuses would be
+	// reported on its PR
+	AddDeployment(deployment TrackedDeployment) error
+	// Deployment returns the tracked deployment and whether it's tracked
+	Deployment(repository Repository, id int64) (TrackedDeployment, bool, error)
+	RemoveDeployment(repository Repository, id int64) error
+
+	// QueueBusEvent queues the event to be published to the message bus
+	QueueBusEvent(event BusEvent) error
+	// BusEvents lists the events waiting to be published, oldest first
+	BusEvents() ([]BusEvent, error)
+	RemoveBusEvent(eventID string) error
+	// DeadLetterBusEvent moves the queued event the bus has rejected to the
+	// dead letters. Only the latest maxDeadLetteredBusEvents are kept.
+	DeadLetterBusEvent(eventID string) error
+	// DeadLetteredBusEvents lists the events the bus has rejected, oldest
+	// first
+	DeadLetteredBusEvents() ([]BusEvent, error)
+
+	// AddBlock records a user's block of the PR, replacing the user's earlier
+	// block of the same PR
+	AddBlock(block Block) error
+	// Blocks lists the PR's blocks in the order they were added
+	Blocks(issue Issue) ([]Block, error)
+	RemoveBlock(issue Issue, user string) error
+	// RemoveBlocks removes all of the PR's blocks
+	RemoveBlocks(issue Issue) error
+
+	// AddDependency records that the PR mustn't be merged before the PR
+	// numbered dependency in the same repository
+	AddDependency(issue Issue, dependency int) error
+	// Dependencies lists the PR's recorded dependencies in ascending order
+	Dependencies(issue Issue) ([]int, error)
+	// RemoveDependencies removes all of the PR's recorded dependencies
+	RemoveDependencies(issue Issue) error
+
+	// SetFirstTimeContribution records a first-time contributor's PR,
+	// replacing its earlier record
+	SetFirstTimeContribution(contribution FirstTimeContribution) error
+	// FirstTimeContribution returns the record of the PR, if it's from a
+	// first-time contributor, and whether there is one
+	FirstTimeContribution(issue Issue) (FirstTimeContribution, bool, error)
+	RemoveFirstTimeContribution(issue Issue) error
+
+	// SetOwnersFile caches the parsed OWNERS_FILE of the repository
+	SetOwnersFile(repository Repository, file OwnersFile) error
+	// OwnersFile returns the cached OWNERS_FILE of the repository and
+	// whether it's cached
+	OwnersFile(repository Repository) (OwnersFile, bool, error)
+	RemoveOwnersFile(repository Repository) error
+}
+
+// BotBranch is a branch the bot has created (for a backport, a revert, etc)
+// and is responsible for cleaning up.
+type BotBranch struct {
+	Repository Repository
+	Name       string
+	Kind       string
+	// SourcePR is the number of the PR that caused the branch to be created
+	SourcePR int
+	// Target is the branch the bot-created branch is meant to be merged into
+	Target string
+	// PullRequest is the number of the PR opened from the branch or 0, if no
+	// PR has been opened for it
+	PullRequest int
+	CreatedAt   time.Time
+}
+
+// ReviewRequest is a request for a reviewer to review a PR.
+type ReviewRequest struct {
+	Repository  Repository
+	PullRequest int
+	Reviewer    string
+	RequestedAt time.Time
+	// RespondedAt is zero while the request is pending
+	RespondedAt time.Time
+}
+
+func (r ReviewRequest) Pending() bool {
+	return r.RespondedAt.IsZero()
+}
+
+// StatusOverride is a user's explicit decision to merge a PR regardless of
+// the state of one of its status contexts.
+type StatusOverride struct {
+	Repository  Repository
+	PullRequest int
+	Context     string
+	// User is the login of the user who overrode the status
+	User      string
+	CreatedAt time.Time
+	// HeadSHA is the head commit of the PR the override was given for. The
+	// override doesn't apply to later commits.
+	HeadSHA string
+}
+
+// Validation is a PR that has been rebased onto the latest base in a
+// validation branch and is waiting for CI to pass on that branch before the
+// base is fast-forwarded to it.
+type Validation struct {
+	Repository  Repository
+	PullRequest int
+	// Branch is the name of the validation branch
+	Branch string
+	// HeadSHA is the PR's head commit that was rebased
+	HeadSHA string
+	// SHA is the rebased commit being validated
+	SHA     string
+	BaseRef string
+	// Parent is the PR whose validation this one is stacked on in a merge
+	// train or 0, if it's rebased onto the base branch itself
+	Parent int
+	// RequiredContexts are the status contexts the base branch's protection
+	// requires. If empty, the combined status of the commit is used.
+	RequiredContexts []string
+	StartedAt        time.Time
+}
+
+// Notification is a non-critical message waiting to be posted on a PR as a
+// part of a digest.
+type Notification struct {
+	Repository  Repository
+	PullRequest int
+	Message     string
+	CreatedAt   time.Time
+}
+
+// Reminder is a user's request to be mentioned on a PR at a later time.
+type Reminder struct {
+	Repository  Repository
+	PullRequest int
+	// User is the login of the user to remind
+	User string
+	// Message is what the user wanted to be reminded to do. Can be empty.
+	Message   string
+	CreatedAt time.Time
+	DueAt     time.Time
+}
+
+// PendingConfirmation is an action the bot would have taken on a PR, if the
+// repository wasn't in its soft-fail period or if the PR's base branch didn't
+// require a second maintainer to confirm the merge.
+type PendingConfirmation struct {
+	Repository  Repository
+	PullRequest int
+	// Action is either "merge", "squash" or "two-person merge"
+	Action string
+	// Command is the comment the action was requested with, e.g.
+	// `!squash 3`. Empty if the action wasn't requested with a command.
+	Command string
+	// RequestedBy is the login of the user who asked for a two-person merge.
+	// Empty if it's not known who labeled the PR for merging.
+	RequestedBy string
+	// CommentID is the ID of the bot's comment asking for a two-person
+	// merge's confirmation
+	CommentID int
+	// ConfirmedBy is the login of the second maintainer who confirmed a
+	// two-person merge. Empty until the merge is confirmed.
+	ConfirmedBy string
+	CreatedAt   time.Time
+	// HeadSHA is the head commit of the PR a two-person merge was asked for
+	// or confirmed at. The confirmation doesn't apply to later commits.
+	HeadSHA string
+}
+
+// MergeQueueEntry is a PR in GitHub's native merge queue.
+type MergeQueueEntry struct {
+	Issue Issue
+	// ID is the entry's GraphQL ID. Empty, if the PR was added to the queue
+	// by someone else than the bot.
+	ID string
+	// HeadSHA is the PR's head commit when it was added to the queue
+	HeadSHA string
+	// State is the entry's state in GitHub's MergeQueueEntryState format,
+	// e.g. "QUEUED" or "AWAITING_CHECKS"
+	State      string
+	EnqueuedAt time.Time
+}
+
+// SelfTest is the result of checking what the bot is permitted to do in a
+// repository.
+type SelfTest struct {
+	Repository  Repository
+	RequestedBy string
+	// Failed lists the checks that didn't pass
+	Failed   []string
+	TestedAt time.Time
+}
+
+// MergeRequest is a PR labeled for merging.
+type MergeRequest struct {
+	Issue Issue
+	// RequestedBy is the login of the user who labeled the PR. Empty if it
+	// was labeled by a bot.
+	RequestedBy string
+	LabeledAt   time.Time
+}
+
+// SignOffWaiver is a maintainer's !dco-override of a PR's sign-off
+// requirement. It only covers the head the PR had at the time, so the commits
+// pushed later have to be signed off or waived again.
+type SignOffWaiver struct {
+	// Login is the login of the maintainer who waived the requirement
+	Login   string
+	HeadSHA string
+}
+
+// ForceWait is a PR labeled for merging whose readiness is polled, because
+// "!merge force-wait" was asked for while its required statuses were missing.
+type ForceWait struct {
+	Issue Issue
+	Until time.Time
+}
+
+// ScheduledMerge is a PR that "!merge at" or "!merge after-freeze" asked to
+// be labeled for merging at a later time.
+type ScheduledMerge struct {
+	Issue Issue
+	At    time.Time
+	// RequestedBy is the login of the user who scheduled the merge
+	RequestedBy string
+	// ForceWait starts a force-wait (see ForceWait) when the PR is labeled
+	ForceWait bool
+}
+
+// PendingRerun is a PR whose failed check suites were re-requested with
+// "!rerun-checks" and that's evaluated for merging again once they complete.
+type PendingRerun struct {
+	Issue   Issue
+	HeadSHA string
+	// CheckSuiteIDs are the GraphQL IDs of the re-requested check suites that
+	// haven't completed yet
+	CheckSuiteIDs []string
+}
+
+// TrackedDeployment is a deployment created with "!deploy", whose statuses
+// are reported by editing the bot's comment about it.
+type TrackedDeployment struct {
+	Issue       Issue
+	ID          int64
+	Environment string
+	SHA         string
+	RequestedBy string
+	CommentID   int64
+}
+
+// StickyComment is the bot's status comment on a PR.
+type StickyComment struct {
+	Issue Issue
+	ID    int64
+	// NodeID is the comment's GraphQL ID, which it's minimized with
+	NodeID string
+}
+
+// CommandStat is the number of times a command was handled with an outcome
+// in a repository on a day.
+type CommandStat struct {
+	Repository string `json:"repository"`
+	Command    string `json:"command"`
+	// Outcome is either "success" or "failure"
+	Outcome string `json:"outcome"`
+	// Day is the start of the UTC day the commands were issued on
+	Day   time.Time `json:"day"`
+	Count int       `json:"count"`
+}
+
+// Block is a user's veto of merging a PR, which only the user or an admin
+// can lift.
+type Block struct {
+	Issue Issue
+	// User is the login of the user who blocked the PR
+	User      string
+	Reason    string
+	CreatedAt time.Time
+}
+
+// FirstTimeContribution is a PR opened by a first-time contributor, which
+// the bot doesn't automate with REQUIRE_CONTRIBUTOR_APPROVAL until a
+// maintainer approves it.
+type FirstTimeContribution struct {
+	Issue    Issue
+	Author   string
+	OpenedAt time.Time
+	// ApprovedBy is the login of the maintainer who approved the
+	// contribution. Empty until it's approved and again after new commits
+	// are pushed to the PR.
+	ApprovedBy string
+}
+
+// FailedDelivery is a webhook whose handling failed transiently and that is
+// retried until it succeeds or DELIVERY_RETRIES runs out.
+type FailedDelivery struct {
+	ID string
+	// Headers are the webhook's headers that are needed to handle it again
+	Headers       map[string]string
+	Body          []byte
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+}
+
+type memoryStore struct {
+	sync.Mutex
+	botBranches    map[string][]BotBranch
+	reviewRequests map[string][]ReviewRequest
+	deferredMerges map[string]Issue
+	// mergeMethods maps the full names of PRs to their chosen merge methods
+	mergeMethods map[string]string
+	// mergeMessages maps the full names of PRs to the commit messages given
+	// for their merges
+	mergeMessages map[string]string
+	// signOffWaivers maps the full names of PRs to the waivers of their
+	// sign-off requirements
+	signOffWaivers map[string]SignOffWaiver
+	// mergeQueueEntries maps the full names of PRs to their entries in
+	// GitHub's native merge queue
+	mergeQueueEntries map[string]MergeQueueEntry
+	// mergeRequests maps the full names of PRs to the requests to merge them
+	mergeRequests map[string]MergeRequest
+	// forceWaits maps the full names of PRs to their force-waits
+	forceWaits map[string]ForceWait
+	// scheduledMerges maps the full names of PRs to their scheduled merges
+	scheduledMerges map[string]ScheduledMerge
+	// pendingReruns maps the full names of PRs to their pending check suite
+	// reruns
+	pendingReruns map[string]PendingRerun
+	// stickyComments maps the full names of PRs to their status comments
+	stickyComments map[string]StickyComment
+	commandStats   []CommandStat
+	// refusals maps the full names of PRs to the reasons the bot has given
+	// for refusing to merge them
+	refusals        map[string]map[string]bool
+	statusOverrides map[string][]StatusOverride
+	validations     map[string][]Validation
+	notifications   []Notification
+	reminders       []Reminder
+	// lastAssignedReviewers maps owner/name to the repository's last
+	// round-robin assigned reviewer
+	lastAssignedReviewers map[string]string
+	// onboardedAt maps owner/name to the time the repository was onboarded
+	onboardedAt map[string]time.Time
+	// pendingConfirmations maps the full names of PRs to their pending
+	// confirmations
+	pendingConfirmations map[string]PendingConfirmation
+	policies             map[string]Policy
+	orgPolicies          map[string]Policy
+	// selfTests maps owner/name to the repository's latest self-test
+	selfTests map[string]SelfTest
+	// deliveries maps the IDs of the claimed webhook deliveries to when they
+	// expire
+	deliveries map[string]time.Time
+	// failedDeliveries maps delivery IDs to the deliveries queued to be
+	// retried
+	failedDeliveries map[string]FailedDelivery
+	// deployments maps owner/name/id to the tracked deployments
+	deployments map[string]TrackedDeployment
+	// busEvents are the events waiting to be published, oldest first
+	busEvents []BusEvent
+	// deadLetteredBusEvents are the events the bus has rejected, oldest
+	// first
+	deadLetteredBusEvents []BusEvent
+	// blocks maps the full names of PRs to their blocks
+	blocks map[string][]Block
+	// dependencies maps the full names of PRs to the numbers of the PRs
+	// they depend on
+	dependencies map[string][]int
+	// firstTimeContributions maps the full names of PRs to their records
+	// as first-time contributions
+	firstTimeContributions map[string]FirstTimeContribution
+	// ownersFiles maps owner/name to the cached owners files
+	ownersFiles map[string]OwnersFile
+}
+
+// NewMemoryStore creates a Store that keeps all of its state in memory. The
+// state is lost when the process exits.
+func NewMemoryStore() Store {
+	return &memoryStore{
+		botBranches:            make(map[string][]BotBranch),
+		reviewRequests:         make(map[string][]ReviewRequest),
+		deferredMerges:         make(map[string]Issue),
+		mergeMethods:           make(map[string]string),
+		mergeMessages:          make(map[string]string),
+		signOffWaivers:         make(map[string]SignOffWaiver),
+		refusals:               make(map[string]map[string]bool),
+		mergeQueueEntries:      make(map[string]MergeQueueEntry),
+		mergeRequests:          make(map[string]MergeRequest),
+		forceWaits:             make(map[string]ForceWait),
+		scheduledMerges:        make(map[string]ScheduledMerge),
+		pendingReruns:          make(map[string]PendingRerun),
+		stickyComments:         make(map[string]StickyComment),
+		statusOverrides:        make(map[string][]StatusOverride),
+		validations:            make(map[string][]Validation),
+		lastAssignedReviewers:  make(map[string]string),
+		onboardedAt:            make(map[string]time.Time),
+		pendingConfirmations:   make(map[string]PendingConfirmation),
+		policies:               make(map[string]Policy),
+		orgPolicies:            make(map[string]Policy),
+		selfTests:              make(map[string]SelfTest),
+		deliveries:             make(map[string]time.Time),
+		failedDeliveries:       make(map[string]FailedDelivery),
+		deployments:            make(map[string]TrackedDeployment),
+		blocks:                 make(map[string][]Block),
+		dependencies:           make(map[string][]int),
+		firstTimeContributions: make(map[string]FirstTimeContribution),
+		ownersFiles:            make(map[string]OwnersFile),
+	}
+}
+
+// NewStore creates the Store configured with SQLITE_PATH, falling back to a
+// memory store.
+func NewStore(conf Config) (Store, error) {
+	if conf.SQLitePath == "" {
+		return NewMemoryStore(), nil
+	}
+	return NewSQLiteStore(conf.SQLitePath)
+}
+
+// NewProviderStore creates the Store for the repositories of another
+// provider than GitHub, e.g. "gitlab". Their state is kept apart from
+// GitHub's, in a memory store of its own or in the provider's namespace of
+// the SQLite file, because repositories of the same name on different
+// providers would otherwise share their state and GitHub's background jobs
+// would act on it with GitHub's clients.
+func NewProviderStore(conf Config, provider string) (Store, error) {
+	if conf.SQLitePath == "" {
+		return NewMemoryStore(), nil
+	}
+	return newSQLiteStore(conf.SQLitePath, provider)
+}
+
+func (s *memoryStore) AddBotBranch(branch BotBranch) error {
+	s.Lock()
+	defer s.Unlock()
+
+	key := repositoryKey(branch.Repository)
+	branches := s.botBranches[key]
+	for i, existingBranch := range branches {
+		if existingBranch.Name == branch.Name {
+			branches[i] = branch
+			return nil
+		}
+	}
+	s.botBranches[key] = append(branches, branch)
+	return nil
+}
+
+func (s *memoryStore) BotBranches(repository Repository) ([]BotBranch, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	branches := s.botBranches[repositoryKey(repository)]
+	return append([]BotBranch{}, branches...), nil
+}
+
+func (s *memoryStore) AllBotBranches() ([]BotBranch, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	allBranches := []BotBranch{}
+	for _, branches := range s.botBranches {
+		allBranches = append(allBranches, branches...)
+	}
+	return allBranches, nil
+}
+
+func (s *memoryStore) RemoveBotBranch(repository Repository, name string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	key := repositoryKey(repository)
+	branches := s.botBranches[key]
+	for i, branch := range branches {
+		if branch.Name == name {
+			s.botBranches[key] = append(branches[:i], branches[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) AddReviewRequest(request ReviewRequest) error {
+	s.Lock()
+	defer s.Unlock()
+
+	key := repositoryKey(request.Repository)
+	requests := s.reviewRequests[key]
+	for i, existingRequest := range requests {
+		if existingRequest.Pending() && existingRequest.PullRequest == request.PullRequest &&
+			existingRequest.Reviewer == request.Reviewer {
+			requests[i] = request
+			return nil
+		}
+	}
+	s.reviewRequests[key] = append(requests, request)
+	return nil
+}
+
+func (s *memoryStore) CompleteReviewRequest(repository Repository, pullRequest int, reviewer string,
+	respondedAt time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+
+	requests := s.reviewRequests[repositoryKey(repository)]
+	for i, request := range requests {
+		if request.Pending() && request.PullRequest == pullRequest && request.Reviewer == reviewer {
+			requests[i].RespondedAt = respondedAt
+			break
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) RemoveReviewRequest(repository Repository, pullRequest int, reviewer string) error {
+	s.removeReviewRequests(repository, func(request ReviewRequest) bool {
+		return request.Pending() && request.PullRequest == pullRequest && request.Reviewer == reviewer
+	})
+	return nil
+}
+
+func (s *memoryStore) RemoveReviewRequests(repository Repository, pullRequest int) error {
+	s.removeReviewRequests(repository, func(request ReviewRequest) bool {
+		return request.PullRequest == pullRequest
+	})
+	return nil
+}
+
+func (s *memoryStore) removeReviewRequests(repository Repository, matches func(ReviewRequest) bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	key := repositoryKey(repository)
+	var remaining []ReviewRequest
+	for _, request := range s.reviewRequests[key] {
+		if !matches(request) {
+			remaining = append(remaining, request)
+		}
+	}
+	s.reviewRequests[key] = remaining
+}
+
+func (s *memoryStore) ReviewRequests(repository Repository) ([]ReviewRequest, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	requests := s.reviewRequests[repositoryKey(repository)]
+	return append([]ReviewRequest{}, requests...), nil
+}
+
+func (s *memoryStore) AllReviewRequests() ([]ReviewRequest, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	allRequests := []ReviewRequest{}
+	for _, requests := range s.reviewRequests {
+		allRequests = append(allRequests, requests...)
+	}
+	return allRequests, nil
+}
+
+func (s *memoryStore) AddDeferredMerge(issue Issue) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.deferredMerges[issue.FullName()] = issue
+	return nil
+}
+
+func (s *memoryStore) DeferredMerges() ([]Issue, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	issues := []Issue{}
+	for _, issue := range s.deferredMerges {
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
+
+func (s *memoryStore) RemoveDeferredMerge(issue Issue) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.deferredMerges, issue.FullName())
+	return nil
+}
+
+func (s *memoryStore) SetMergeMethod(issue Issue, method string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if method == "" {
+		delete(s.mergeMethods, issue.FullName())
+	} else {
+		s.mergeMethods[issue.FullName()] = method
+	}
+	return nil
+}
+
+func (s *memoryStore) MergeMethod(issue Issue) (string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.mergeMethods[issue.FullName()], nil
+}
+
+func (s *memoryStore) SetMergeMessage(issue Issue, message string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if message == "" {
+		delete(s.mergeMessages, issue.FullName())
+	} else {
+		s.mergeMessages[issue.FullName()] = message
+	}
+	return nil
+}
+
+func (s *memoryStore) MergeMessage(issue Issue) (string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.mergeMessages[issue.FullName()], nil
+}
+
+func (s *memoryStore) SetSignOffWaiver(issue Issue, waiver SignOffWaiver) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if waiver == (SignOffWaiver{}) {
+		delete(s.signOffWaivers, issue.FullName())
+	} else {
+		s.signOffWaivers[issue.FullName()] = waiver
+	}
+	return nil
+}
+
+func (s *memoryStore) SignOffWaiver(issue Issue) (SignOffWaiver, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.signOffWaivers[issue.FullName()], nil
+}
+
+func (s *memoryStore) RecordRefusal(issue Issue, reason string) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	reasons, hasReasons := s.refusals[issue.FullName()]
+	if !hasReasons {
+		reasons = make(map[string]bool)
+		s.refusals[issue.FullName()] = reasons
+	} else if reasons[reason] {
+		return false, nil
+	}
+	reasons[reason] = true
+	return true, nil
+}
+
+func (s *memoryStore) Refusals(issue Issue) ([]string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	reasons := []string{}
+	for reason := range s.refusals[issue.FullName()] {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	return reasons, nil
+}
+
+func (s *memoryStore) RemoveRefusals(issue Issue) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.refusals, issue.FullName())
+	return nil
+}
+
+func (s *memoryStore) SetMergeQueueEntry(entry MergeQueueEntry) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.mergeQueueEntries[entry.Issue.FullName()] = entry
+	return nil
+}
+
+func (s *memoryStore) MergeQueueEntry(issue Issue) (MergeQueueEntry, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	entry, exists := s.mergeQueueEntries[issue.FullName()]
+	return entry, exists, nil
+}
+
+func (s *memoryStore) AllMergeQueueEntries() ([]MergeQueueEntry, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	entries := []MergeQueueEntry{}
+	for _, entry := range s.mergeQueueEntries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].EnqueuedAt.Before(entries[j].EnqueuedAt)
+	})
+	return entries, nil
+}
+
+func (s *memoryStore) RemoveMergeQueueEntry(issue Issue) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.mergeQueueEntries, issue.FullName())
+	return nil
+}
+
+func (s *memoryStore) AddMergeRequest(request MergeRequest) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, exists := s.mergeRequests[request.Issue.FullName()]; !exists {
+		s.mergeRequests[request.Issue.FullName()] = request
+	}
+	return nil
+}
+
+func (s *memoryStore) MergeRequests() ([]MergeRequest, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	requests := []MergeRequest{}
+	for _, request := range s.mergeRequests {
+		requests = append(requests, request)
+	}
+	return requests, nil
+}
+
+func (s *memoryStore) RemoveMergeRequest(issue Issue) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.mergeRequests, issue.FullName())
+	return nil
+}
+
+func (s *memoryStore) AddForceWait(wait ForceWait) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.forceWaits[wait.Issue.FullName()] = wait
+	return nil
+}
+
+func (s *memoryStore) ForceWaits() ([]ForceWait, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	waits := []ForceWait{}
+	for _, wait := range s.forceWaits {
+		waits = append(waits, wait)
+	}
+	return waits, nil
+}
+
+func (s *memoryStore) RemoveForceWait(issue Issue) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.forceWaits, issue.FullName())
+	return nil
+}
+
+func (s *memoryStore) AddScheduledMerge(scheduled ScheduledMerge) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.scheduledMerges[scheduled.Issue.FullName()] = scheduled
+	return nil
+}
+
+func (s *memoryStore) ScheduledMerge(issue Issue) (ScheduledMerge, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	scheduled, exists := s.scheduledMerges[issue.FullName()]
+	return scheduled, exists, nil
+}
+
+func (s *memoryStore) ScheduledMerges() ([]ScheduledMerge, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	scheduledMerges := []ScheduledMerge{}
+	for _, scheduled := range s.scheduledMerges {
+		scheduledMerges = append(scheduledMerges, scheduled)
+	}
+	sort.Slice(scheduledMerges, func(i, j int) bool {
+		return scheduledMerges[i].At.Before(scheduledMerges[j].At)
+	})
+	return scheduledMerges, nil
+}
+
+func (s *memoryStore) RemoveScheduledMerge(issue Issue) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.scheduledMerges, issue.FullName())
+	return nil
+}
+
+func (s *memoryStore) SetPendingRerun(rerun PendingRerun) error {
+	s.Lock()
+	defer s.Unlock()
+
+	rerun.CheckSuiteIDs = append([]string{}, rerun.CheckSuiteIDs...)
+	s.pendingReruns[rerun.Issue.FullName()] = rerun
+	return nil
+}
+
+func (s *memoryStore) PendingReruns() ([]PendingRerun, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	reruns := []PendingRerun{}
+	for _, rerun := range s.pendingReruns {
+		rerun.CheckSuiteIDs = append([]string{}, rerun.CheckSuiteIDs...)
+		reruns = append(reruns, rerun)
+	}
+	return reruns, nil
+}
+
+func (s *memoryStore) RemovePendingRerun(issue Issue) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.pendingReruns, issue.FullName())
+	return nil
+}
+
+func (s *memoryStore) SetStickyComment(comment StickyComment) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.stickyComments[comment.Issue.FullName()] = comment
+	return nil
+}
+
+func (s *memoryStore) StickyComment(issue Issue) (StickyComment, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	comment, exists := s.stickyComments[issue.FullName()]
+	return comment, exists, nil
+}
+
+func (s *memoryStore) RemoveStickyComment(issue Issue) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.stickyComments, issue.FullName())
+	return nil
+}
+
+func (s *memoryStore) RecordCommandUse(repository Repository, command, outcome string, at time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+
+	day := at.UTC().Truncate(24 * time.Hour)
+	key := repositoryKey(repository)
+	var kept []CommandStat
+	for _, stat := range s.commandStats {
+		if day.Sub(stat.Day) < commandStatsRetention {
+			kept = append(kept, stat)
+		}
+	}
+	s.commandStats = kept
+	for i, stat := range s.commandStats {
+		if stat.Repository == key && stat.Command == command && stat.Outcome == outcome && stat.Day.Equal(day) {
+			s.commandStats[i].Count++
+			return nil
+		}
+	}
+	s.commandStats = append(s.commandStats, CommandStat{
+		Repository: key,
+		Command:    command,
+		Outcome:    outcome,
+		Day:        day,
+		Count:      1,
+	})
+	return nil
+}
+
+func (s *memoryStore) CommandStats(since time.Time) ([]CommandStat, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	from := since.UTC().Truncate(24 * time.Hour)
+	stats := []CommandStat{}
+	for _, stat := range s.commandStats {
+		if !stat.Day.Before(from) {
+			stats = append(stats, stat)
+		}
+	}
+	sort.SliceStable(stats, func(i, j int) bool { return stats[i].Day.Before(stats[j].Day) })
+	return stats, nil
+}
+
+func (s *memoryStore) AddStatusOverride(override StatusOverride) error {
+	s.Lock()
+	defer s.Unlock()
+
+	key := repositoryKey(override.Repository)
+	overrides := s.statusOverrides[key]
+	for i, existingOverride := range overrides {
+		if existingOverride.PullRequest == override.PullRequest && existingOverride.Context == override.Context {
+			overrides[i] = override
+			return nil
+		}
+	}
+	s.statusOverrides[key] = append(overrides, override)
+	return nil
+}
+
+func (s *memoryStore) StatusOverrides(repository Repository) ([]StatusOverride, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	overrides := s.statusOverrides[repositoryKey(repository)]
+	return append([]StatusOverride{}, overrides...), nil
+}
+
+func (s *memoryStore) RemoveStatusOverrides(repository Repository, pullRequest int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	key := repositoryKey(repository)
+	var remaining []StatusOverride
+	for _, override := range s.statusOverrides[key] {
+		if override.PullRequest != pullRequest {
+			remaining = append(remaining, override)
+		}
+	}
+	s.statusOverrides[key] = remaining
+	return nil
+}
+
+func (s *memoryStore) AddValidation(validation Validation) error {
+	s.Lock()
+	defer s.Unlock()
+
+	key := repositoryKey(validation.Repository)
+	validations := s.validations[key]
+	for i, existingValidation := range validations {
+		if existingValidation.PullRequest == validation.PullRequest {
+			validations[i] = validation
+			return nil
+		}
+	}
+	s.validations[key] = append(validations, validation)
+	return nil
+}
+
+func (s *memoryStore) Validations(repository Repository) ([]Validation, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	validations := s.validations[repositoryKey(repository)]
+	return append([]Validation{}, validations...), nil
+}
+
+func (s *memoryStore) AllValidations() ([]Validation, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	allValidations := []Validation{}
+	for _, validations := range s.validations {
+		allValidations = append(allValidations, validations...)
+	}
+	return allValidations, nil
+}
+
+func (s *memoryStore) RemoveValidation(repository Repository, pullRequest int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	key := repositoryKey(repository)
+	var remaining []Validation
+	for _, validation := range s.validations[key] {
+		if validation.PullRequest != pullRequest {
+			remaining = append(remaining, validation)
+		}
+	}
+	s.validations[key] = remaining
+	return nil
+}
+
+func (s *memoryStore) AddNotification(notification Notification) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.notifications = append(s.notifications, notification)
+	return nil
+}
+
+func (s *memoryStore) Notifications() ([]Notification, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	return append([]Notification{}, s.notifications...), nil
+}
+
+func (s *memoryStore) RemoveNotifications(repository Repository, pullRequest int, until time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+
+	var remaining []Notification
+	for _, notification := range s.notifications {
+		if notification.Repository.Owner != repository.Owner || notification.Repository.Name != repository.Name ||
+			notification.PullRequest != pullRequest || notification.CreatedAt.After(until) {
+			remaining = append(remaining, notification)
+		}
+	}
+	s.notifications = remaining
+	return nil
+}
+
+func (s *memoryStore) AddReminder(reminder Reminder) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.reminders = append(s.reminders, reminder)
+	return nil
+}
+
+func (s *memoryStore) Reminders() ([]Reminder, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	return append([]Reminder{}, s.reminders...), nil
+}
+
+func (s *memoryStore) RemoveReminder(reminder Reminder) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for i, existingReminder := range s.reminders {
+		if repositoryKey(existingReminder.Repository) == repositoryKey(reminder.Repository) &&
+			existingReminder.PullRequest == reminder.PullRequest && existingReminder.User == reminder.User &&
+			existingReminder.CreatedAt.Equal(reminder.CreatedAt) && existingReminder.DueAt.Equal(reminder.DueAt) {
+			s.reminders = append(s.reminders[:i], s.reminders[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) LastAssignedReviewer(repository Repository) (string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.lastAssignedReviewers[repositoryKey(repository)], nil
+}
+
+func (s *memoryStore) SetLastAssignedReviewer(repository Repository, reviewer string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.lastAssignedReviewers[repositoryKey(repository)] = reviewer
+	return nil
+}
+
+func (s *memoryStore) OnboardRepository(repository Repository, at time.Time) (time.Time, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	key := repositoryKey(repository)
+	if onboardedAt, exists := s.onboardedAt[key]; exists {
+		return onboardedAt, nil
+	}
+	s.onboardedAt[key] = at
+	return at, nil
+}
+
+func (s *memoryStore) SetPendingConfirmation(confirmation PendingConfirmation) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.pendingConfirmations[Issue{Repository: confirmation.Repository, Number: confirmation.PullRequest}.FullName()] = confirmation
+	return nil
+}
+
+func (s *memoryStore) PendingConfirmation(repository Repository, pullRequest int) (PendingConfirmation, bool,
+	error) {
+
+	s.Lock()
+	defer s.Unlock()
+
+	confirmation, exists := s.pendingConfirmations[Issue{Repository: repository, Number: pullRequest}.FullName()]
+	return confirmation, exists, nil
+}
+
+func (s *memoryStore) RemovePendingConfirmation(repository Repository, pullRequest int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.pendingConfirmations, Issue{Repository: repository, Number: pullRequest}.FullName())
+	return nil
+}
+
+func (s *memoryStore) Policy(repository Repository) (Policy, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	policy, exists := s.policies[repositoryKey(repository)]
+	return policy, exists, nil
+}
+
+func (s *memoryStore) OrganizationPolicy(owner string) (Policy, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	policy, exists := s.orgPolicies[owner]
+	return policy, exists, nil
+}
+
+func (s *memoryStore) Policies() (PolicySet, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	return PolicySet{
+		Organizations: copyPolicies(s.orgPolicies),
+		Repositories:  copyPolicies(s.policies),
+	}, nil
+}
+
+func (s *memoryStore) SetPolicies(policies PolicySet) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.orgPolicies = copyPolicies(policies.Organizations)
+	s.policies = copyPolicies(policies.Repositories)
+	return nil
+}
+
+func (s *memoryStore) SetSelfTest(selfTest SelfTest) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.selfTests[repositoryKey(selfTest.Repository)] = selfTest
+	return nil
+}
+
+func (s *memoryStore) SelfTests() ([]SelfTest, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	selfTests := []SelfTest{}
+	for _, selfTest := range s.selfTests {
+		selfTests = append(selfTests, selfTest)
+	}
+	return selfTests, nil
+}
+
+func (s *memoryStore) ClaimDelivery(deliveryID string, now, expiresAt time.Time) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	for id, expiry := range s.deliveries {
+		if !now.Before(expiry) {
+			delete(s.deliveries, id)
+		}
+	}
+	if _, claimed := s.deliveries[deliveryID]; claimed {
+		return false, nil
+	}
+	s.deliveries[deliveryID] = expiresAt
+	return true, nil
+}
+
+func (s *memoryStore) ReleaseDelivery(deliveryID string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.deliveries, deliveryID)
+	return nil
+}
+
+func (s *memoryStore) QueueFailedDelivery(delivery FailedDelivery) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, queued := s.failedDeliveries[delivery.ID]; queued {
+		return false, nil
+	}
+	s.failedDeliveries[delivery.ID] = delivery
+	return true, nil
+}
+
+func (s *memoryStore) UpdateFailedDelivery(delivery FailedDelivery) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.failedDeliveries[delivery.ID] = delivery
+	return nil
+}
+
+func (s *memoryStore) RemoveFailedDelivery(deliveryID string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.failedDeliveries, deliveryID)
+	return nil
+}
+
+func (s *memoryStore) FailedDeliveries() ([]FailedDelivery, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	deliveries := []FailedDelivery{}
+	for _, delivery := range s.failedDeliveries {
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+func (s *memoryStore) AddDeployment(deployment TrackedDeployment) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.deployments[deploymentKey(deployment.Issue.Repository, deployment.ID)] = deployment
+	return nil
+}
+
+func (s *memoryStore) Deployment(repository Repository, id int64) (TrackedDeployment, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	deployment, exists := s.deployments[deploymentKey(repository, id)]
+	return deployment, exists, nil
+}
+
+func (s *memoryStore) RemoveDeployment(repository Repository, id int64) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.deployments, deploymentKey(repository, id))
+	return nil
+}
+
+func deploymentKey(repository Repository, id int64) string {
+	return fmt.Sprintf("%s/%d", repositoryKey(repository), id)
+}
+
+func (s *memoryStore) QueueBusEvent(event BusEvent) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.busEvents = append(s.busEvents, event)
+	return nil
+}
+
+func (s *memoryStore) BusEvents() ([]BusEvent, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	return append([]BusEvent{}, s.busEvents...), nil
+}
+
+func (s *memoryStore) RemoveBusEvent(eventID string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for i, event := range s.busEvents {
+		if event.ID == eventID {
+			s.busEvents = append(s.busEvents[:i], s.busEvents[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) DeadLetterBusEvent(eventID string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for i, event := range s.busEvents {
+		if event.ID == eventID {
+			s.busEvents = append(s.busEvents[:i], s.busEvents[i+1:]...)
+			s.deadLetteredBusEvents = append(s.deadLetteredBusEvents, event)
+			break
+		}
+	}
+	if excess := len(s.deadLetteredBusEvents) - maxDeadLetteredBusEvents; excess > 0 {
+		s.deadLetteredBusEvents = append([]BusEvent{}, s.deadLetteredBusEvents[excess:]...)
+	}
+	return nil
+}
+
+func (s *memoryStore) DeadLetteredBusEvents() ([]BusEvent, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	return append([]BusEvent{}, s.deadLetteredBusEvents...), nil
+}
+
+func (s *memoryStore) AddBlock(block Block) error {
+	s.Lock()
+	defer s.Unlock()
+
+	key := block.Issue.FullName()
+	for i, existing := range s.blocks[key] {
+		if strings.EqualFold(existing.User, block.User) {
+			s.blocks[key][i] = block
+			return nil
+		}
+	}
+	s.blocks[key] = append(s.blocks[key], block)
+	return nil
+}
+
+func (s *memoryStore) Blocks(issue Issue) ([]Block, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	return append([]Block{}, s.blocks[issue.FullName()]...), nil
+}
+
+func (s *memoryStore) RemoveBlock(issue Issue, user string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	key := issue.FullName()
+	blocks := s.blocks[key]
+	for i, block := range blocks {
+		if strings.EqualFold(block.User, user) {
+			blocks = append(blocks[:i:i], blocks[i+1:]...)
+			break
+		}
+	}
+	if len(blocks) == 0 {
+		delete(s.blocks, key)
+	} else {
+		s.blocks[key] = blocks
+	}
+	return nil
+}
+
+func (s *memoryStore) RemoveBlocks(issue Issue) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.blocks, issue.FullName())
+	return nil
+}
+
+func (s *memoryStore) AddDependency(issue Issue, dependency int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	key := issue.FullName()
+	dependencies := s.dependencies[key]
+	i := sort.SearchInts(dependencies, dependency)
+	if i < len(dependencies) && dependencies[i] == dependency {
+		return nil
+	}
+	dependencies = append(dependencies, 0)
+	copy(dependencies[i+1:], dependencies[i:])
+	dependencies[i] = dependency
+	s.dependencies[key] = dependencies
+	return nil
+}
+
+func (s *memoryStore) Dependencies(issue Issue) ([]int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	return append([]int{}, s.dependencies[issue.FullName()]...), nil
+}
+
+func (s *memoryStore) RemoveDependencies(issue Issue) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.dependencies, issue.FullName())
+	return nil
+}
+
+func (s *memoryStore) SetFirstTimeContribution(contribution FirstTimeContribution) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.firstTimeContributions[contribution.Issue.FullName()] = contribution
+	return nil
+}
+
+func (s *memoryStore) FirstTimeContribution(issue Issue) (FirstTimeContribution, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	contribution, exists := s.firstTimeContributions[issue.FullName()]
+	return contribution, exists, nil
+}
+
+func (s *memoryStore) RemoveFirstTimeContribution(issue Issue) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.firstTimeContributions, issue.FullName())
+	return nil
+}
+
+func (s *memoryStore) SetOwnersFile(repository Repository, file OwnersFile) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.ownersFiles[repositoryKey(repository)] = file
+	return nil
+}
+
+func (s *memoryStore) OwnersFile(repository Repository) (OwnersFile, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	file, exists := s.ownersFiles[repositoryKey(repository)]
+	return file, exists, nil
+}
+
+func (s *memoryStore) RemoveOwnersFile(repository Repository) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.ownersFiles, repositoryKey(repository))
+	return nil
+}
+
+func copyPolicies(policies map[string]Policy) map[string]Policy {
+	copied := make(map[string]Policy, len(policies))
+	for key, policy := range policies {
+		copied[key] = policy
+	}
+	return copied
+}
+
+func repositoryKey(repository Repository) string {
+	return repository.Owner + "/" + repository.Name
+}
@@ -0,0 +1,514 @@
+package main_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	grh "github.com/salemove/github-review-helper"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("memory store", func() {
+	var store grh.Store
+
+	BeforeEach(func() {
+		store = grh.NewMemoryStore()
+	})
+
+	Describe("bot branches", func() {
+		otherRepository := grh.Repository{Owner: repositoryOwner, Name: "other"}
+		branch := grh.BotBranch{
+			Repository: grh.Repository{Owner: repositoryOwner, Name: repositoryName},
+			Name:       "bot/backport/7-release",
+			Kind:       "backport",
+			SourcePR:   issueNumber,
+			Target:     "release",
+		}
+
+		BeforeEach(func() {
+			Expect(store.AddBotBranch(branch)).To(Succeed())
+		})
+
+		It("lists the branches per repository", func() {
+			Expect(store.BotBranches(branch.Repository)).To(Equal([]grh.BotBranch{branch}))
+			Expect(store.BotBranches(otherRepository)).To(BeEmpty())
+		})
+
+		It("replaces a branch with the same name", func() {
+			updatedBranch := branch
+			updatedBranch.PullRequest = 8
+			Expect(store.AddBotBranch(updatedBranch)).To(Succeed())
+			Expect(store.BotBranches(branch.Repository)).To(Equal([]grh.BotBranch{updatedBranch}))
+		})
+
+		It("removes branches", func() {
+			Expect(store.RemoveBotBranch(branch.Repository, branch.Name)).To(Succeed())
+			Expect(store.BotBranches(branch.Repository)).To(BeEmpty())
+		})
+	})
+
+	Describe("review requests", func() {
+		repository := grh.Repository{Owner: repositoryOwner, Name: repositoryName}
+		requestedAt := time.Now().Add(-time.Hour)
+		request := grh.ReviewRequest{
+			Repository:  repository,
+			PullRequest: issueNumber,
+			Reviewer:    "reviewer",
+			RequestedAt: requestedAt,
+		}
+
+		BeforeEach(func() {
+			Expect(store.AddReviewRequest(request)).To(Succeed())
+		})
+
+		It("completes pending requests", func() {
+			respondedAt := time.Now()
+			Expect(store.CompleteReviewRequest(repository, issueNumber, "reviewer", respondedAt)).To(Succeed())
+
+			completedRequest := request
+			completedRequest.RespondedAt = respondedAt
+			Expect(store.ReviewRequests(repository)).To(Equal([]grh.ReviewRequest{completedRequest}))
+		})
+
+		It("removes both pending and completed requests of the PR", func() {
+			otherRequest := request
+			otherRequest.PullRequest = issueNumber + 1
+			Expect(store.AddReviewRequest(otherRequest)).To(Succeed())
+			Expect(store.CompleteReviewRequest(repository, issueNumber, "reviewer", time.Now())).To(Succeed())
+			Expect(store.AddReviewRequest(request)).To(Succeed())
+			Expect(store.RemoveReviewRequests(repository, issueNumber)).To(Succeed())
+
+			Expect(store.ReviewRequests(repository)).To(Equal([]grh.ReviewRequest{otherRequest}))
+		})
+	})
+
+	Describe("merge methods", func() {
+		issue := grh.Issue{
+			Repository: grh.Repository{Owner: repositoryOwner, Name: repositoryName},
+			Number:     issueNumber,
+		}
+
+		It("remembers the method chosen for the PR", func() {
+			Expect(store.MergeMethod(issue)).To(BeEmpty())
+			Expect(store.SetMergeMethod(issue, "squash")).To(Succeed())
+			Expect(store.MergeMethod(issue)).To(Equal("squash"))
+		})
+
+		It("forgets the method when it's set to an empty one", func() {
+			Expect(store.SetMergeMethod(issue, "rebase")).To(Succeed())
+			Expect(store.SetMergeMethod(issue, "")).To(Succeed())
+			Expect(store.MergeMethod(issue)).To(BeEmpty())
+		})
+	})
+
+	Describe("merge messages", func() {
+		issue := grh.Issue{
+			Repository: grh.Repository{Owner: repositoryOwner, Name: repositoryName},
+			Number:     issueNumber,
+		}
+
+		It("remembers the message given for the PR until it's set to an empty one", func() {
+			Expect(store.SetMergeMessage(issue, "Release 1.2.3")).To(Succeed())
+			Expect(store.MergeMessage(issue)).To(Equal("Release 1.2.3"))
+			Expect(store.SetMergeMessage(issue, "")).To(Succeed())
+			Expect(store.MergeMessage(issue)).To(BeEmpty())
+		})
+	})
+
+	Describe("dependencies", func() {
+		issue := grh.Issue{
+			Repository: grh.Repository{Owner: repositoryOwner, Name: repositoryName},
+			Number:     issueNumber,
+		}
+
+		It("lists the PR's dependencies once each, in ascending order", func() {
+			Expect(store.AddDependency(issue, 12)).To(Succeed())
+			Expect(store.AddDependency(issue, 3)).To(Succeed())
+			Expect(store.AddDependency(issue, 12)).To(Succeed())
+			Expect(store.Dependencies(issue)).To(Equal([]int{3, 12}))
+			Expect(store.RemoveDependencies(issue)).To(Succeed())
+			Expect(store.Dependencies(issue)).To(BeEmpty())
+		})
+	})
+
+	Describe("sign-off waivers", func() {
+		issue := grh.Issue{
+			Repository: grh.Repository{Owner: repositoryOwner, Name: repositoryName},
+			Number:     issueNumber,
+		}
+
+		waiver := grh.SignOffWaiver{Login: "maintainer", HeadSHA: "1235"}
+
+		It("remembers who waived the PR's sign-off requirement for which head", func() {
+			Expect(store.SignOffWaiver(issue)).To(BeZero())
+			Expect(store.SetSignOffWaiver(issue, waiver)).To(Succeed())
+			Expect(store.SignOffWaiver(issue)).To(Equal(waiver))
+		})
+
+		It("forgets the waiver when it's set to an empty one", func() {
+			Expect(store.SetSignOffWaiver(issue, waiver)).To(Succeed())
+			Expect(store.SetSignOffWaiver(issue, grh.SignOffWaiver{})).To(Succeed())
+			Expect(store.SignOffWaiver(issue)).To(BeZero())
+		})
+	})
+
+	Describe("refusals", func() {
+		issue := grh.Issue{
+			Repository: grh.Repository{Owner: repositoryOwner, Name: repositoryName},
+			Number:     issueNumber,
+		}
+
+		It("reports every reason as new only once", func() {
+			Expect(store.RecordRefusal(issue, "it's labeled 'do not merge'")).To(BeTrue())
+			Expect(store.RecordRefusal(issue, "it's labeled 'do not merge'")).To(BeFalse())
+			Expect(store.RecordRefusal(issue, "it's labeled 'needs QA'")).To(BeTrue())
+		})
+
+		It("reports the reasons as new again once they're removed", func() {
+			Expect(store.RecordRefusal(issue, "it's labeled 'do not merge'")).To(BeTrue())
+			Expect(store.RemoveRefusals(issue)).To(Succeed())
+			Expect(store.RecordRefusal(issue, "it's labeled 'do not merge'")).To(BeTrue())
+		})
+	})
+
+	Describe("merge queue entries", func() {
+		issue := grh.Issue{
+			Repository: grh.Repository{Owner: repositoryOwner, Name: repositoryName},
+			Number:     issueNumber,
+		}
+
+		It("replaces the PR's earlier entry", func() {
+			Expect(store.SetMergeQueueEntry(grh.MergeQueueEntry{Issue: issue, HeadSHA: "1234"})).To(Succeed())
+			Expect(store.SetMergeQueueEntry(grh.MergeQueueEntry{Issue: issue, HeadSHA: "1235"})).To(Succeed())
+
+			entry, exists, err := store.MergeQueueEntry(issue)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeTrue())
+			Expect(entry.HeadSHA).To(Equal("1235"))
+		})
+
+		It("forgets removed entries", func() {
+			Expect(store.SetMergeQueueEntry(grh.MergeQueueEntry{Issue: issue, HeadSHA: "1234"})).To(Succeed())
+			Expect(store.RemoveMergeQueueEntry(issue)).To(Succeed())
+
+			_, exists, err := store.MergeQueueEntry(issue)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeFalse())
+		})
+	})
+
+	Describe("merge requests", func() {
+		issue := grh.Issue{
+			Repository: grh.Repository{Owner: repositoryOwner, Name: repositoryName},
+			Number:     issueNumber,
+		}
+
+		It("keeps the PR's earlier request", func() {
+			labeledAt := time.Now().Add(-time.Hour)
+			Expect(store.AddMergeRequest(grh.MergeRequest{Issue: issue, RequestedBy: "alice",
+				LabeledAt: labeledAt})).To(Succeed())
+			Expect(store.AddMergeRequest(grh.MergeRequest{Issue: issue, RequestedBy: "bob",
+				LabeledAt: time.Now()})).To(Succeed())
+
+			requests, err := store.MergeRequests()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requests).To(Equal([]grh.MergeRequest{{Issue: issue, RequestedBy: "alice",
+				LabeledAt: labeledAt}}))
+
+			Expect(store.RemoveMergeRequest(issue)).To(Succeed())
+			Expect(store.MergeRequests()).To(BeEmpty())
+		})
+	})
+
+	Describe("force-waits", func() {
+		issue := grh.Issue{
+			Repository: grh.Repository{Owner: repositoryOwner, Name: repositoryName},
+			Number:     issueNumber,
+		}
+
+		It("replaces the PR's earlier wait", func() {
+			until := time.Now().Add(time.Hour)
+			Expect(store.AddForceWait(grh.ForceWait{Issue: issue, Until: until.Add(-time.Minute)})).To(Succeed())
+			Expect(store.AddForceWait(grh.ForceWait{Issue: issue, Until: until})).To(Succeed())
+
+			waits, err := store.ForceWaits()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(waits).To(HaveLen(1))
+			Expect(waits[0].Until).To(Equal(until))
+
+			Expect(store.RemoveForceWait(issue)).To(Succeed())
+			Expect(store.ForceWaits()).To(BeEmpty())
+		})
+	})
+
+	Describe("pending reruns", func() {
+		issue := grh.Issue{
+			Repository: grh.Repository{Owner: repositoryOwner, Name: repositoryName},
+			Number:     issueNumber,
+		}
+
+		It("replaces the PR's earlier rerun", func() {
+			Expect(store.SetPendingRerun(grh.PendingRerun{Issue: issue, HeadSHA: "old",
+				CheckSuiteIDs: []string{"suite-1"}})).To(Succeed())
+			Expect(store.SetPendingRerun(grh.PendingRerun{Issue: issue, HeadSHA: "1235",
+				CheckSuiteIDs: []string{"suite-2"}})).To(Succeed())
+
+			reruns, err := store.PendingReruns()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reruns).To(HaveLen(1))
+			Expect(reruns[0].HeadSHA).To(Equal("1235"))
+			Expect(reruns[0].CheckSuiteIDs).To(Equal([]string{"suite-2"}))
+
+			Expect(store.RemovePendingRerun(issue)).To(Succeed())
+			Expect(store.PendingReruns()).To(BeEmpty())
+		})
+	})
+
+	Describe("sticky comments", func() {
+		issue := grh.Issue{
+			Repository: grh.Repository{Owner: repositoryOwner, Name: repositoryName},
+			Number:     issueNumber,
+		}
+
+		It("replaces the PR's earlier comment", func() {
+			Expect(store.SetStickyComment(grh.StickyComment{Issue: issue, ID: 1})).To(Succeed())
+			Expect(store.SetStickyComment(grh.StickyComment{Issue: issue, ID: 2, NodeID: "comment"})).To(Succeed())
+
+			comment, exists, err := store.StickyComment(issue)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeTrue())
+			Expect(comment.ID).To(Equal(int64(2)))
+
+			Expect(store.RemoveStickyComment(issue)).To(Succeed())
+			_, exists, err = store.StickyComment(issue)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeFalse())
+		})
+	})
+
+	Describe("command stats", func() {
+		repository := grh.Repository{Owner: repositoryOwner, Name: repositoryName}
+		today := time.Date(2018, 3, 14, 15, 0, 0, 0, time.UTC)
+
+		It("counts the commands per day and forgets the old days", func() {
+			Expect(store.RecordCommandUse(repository, "!merge", "success", today.AddDate(0, 0, -100))).To(Succeed())
+			Expect(store.RecordCommandUse(repository, "!merge", "success", today.AddDate(0, 0, -1))).To(Succeed())
+			Expect(store.RecordCommandUse(repository, "!merge", "success", today)).To(Succeed())
+			Expect(store.RecordCommandUse(repository, "!merge", "success", today.Add(time.Hour))).To(Succeed())
+			Expect(store.RecordCommandUse(repository, "!merge", "failure", today)).To(Succeed())
+
+			stats, err := store.CommandStats(today.AddDate(-1, 0, 0))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats).To(HaveLen(3))
+			Expect(stats[0].Day).To(Equal(time.Date(2018, 3, 13, 0, 0, 0, 0, time.UTC)))
+			Expect(stats[1].Count).To(Equal(2))
+
+			Expect(store.CommandStats(today)).To(HaveLen(2))
+		})
+	})
+
+	Describe("status overrides", func() {
+		repository := grh.Repository{Owner: repositoryOwner, Name: repositoryName}
+		override := grh.StatusOverride{
+			Repository:  repository,
+			PullRequest: issueNumber,
+			Context:     "ci/optional",
+			User:        "overrider",
+			CreatedAt:   time.Now(),
+		}
+
+		BeforeEach(func() {
+			Expect(store.AddStatusOverride(override)).To(Succeed())
+		})
+
+		It("replaces an override of the same context", func() {
+			updatedOverride := override
+			updatedOverride.User = "other-overrider"
+			Expect(store.AddStatusOverride(updatedOverride)).To(Succeed())
+			Expect(store.StatusOverrides(repository)).To(Equal([]grh.StatusOverride{updatedOverride}))
+		})
+
+		It("removes only the PR's overrides", func() {
+			otherOverride := override
+			otherOverride.PullRequest = issueNumber + 1
+			Expect(store.AddStatusOverride(otherOverride)).To(Succeed())
+			Expect(store.RemoveStatusOverrides(repository, issueNumber)).To(Succeed())
+			Expect(store.StatusOverrides(repository)).To(Equal([]grh.StatusOverride{otherOverride}))
+		})
+	})
+
+	Describe("validations", func() {
+		repository := grh.Repository{Owner: repositoryOwner, Name: repositoryName}
+		validation := grh.Validation{
+			Repository:  repository,
+			PullRequest: issueNumber,
+			Branch:      "bot/validation/1-master",
+			HeadSHA:     "1235",
+			SHA:         "2345",
+			BaseRef:     "master",
+			StartedAt:   time.Now(),
+		}
+
+		BeforeEach(func() {
+			Expect(store.AddValidation(validation)).To(Succeed())
+		})
+
+		It("replaces an earlier validation of the same PR", func() {
+			updatedValidation := validation
+			updatedValidation.SHA = "3456"
+			Expect(store.AddValidation(updatedValidation)).To(Succeed())
+			Expect(store.Validations(repository)).To(Equal([]grh.Validation{updatedValidation}))
+		})
+
+		It("removes only the PR's validation", func() {
+			otherValidation := validation
+			otherValidation.PullRequest = issueNumber + 1
+			Expect(store.AddValidation(otherValidation)).To(Succeed())
+			Expect(store.RemoveValidation(repository, issueNumber)).To(Succeed())
+			Expect(store.Validations(repository)).To(Equal([]grh.Validation{otherValidation}))
+		})
+	})
+
+	Describe("deliveries", func() {
+		deliveryID := "72d3162e-cc78-11e3-81ab-4c9367dc0958"
+		now := time.Now()
+
+		It("claims a delivery only once until it expires", func() {
+			Expect(store.ClaimDelivery(deliveryID, now, now.Add(time.Hour))).To(BeTrue())
+			Expect(store.ClaimDelivery(deliveryID, now.Add(time.Minute), now.Add(time.Hour))).To(BeFalse())
+			Expect(store.ClaimDelivery(deliveryID, now.Add(time.Hour), now.Add(2*time.Hour))).To(BeTrue())
+		})
+
+		It("claims a released delivery again", func() {
+			Expect(store.ClaimDelivery(deliveryID, now, now.Add(time.Hour))).To(BeTrue())
+			Expect(store.ReleaseDelivery(deliveryID)).To(Succeed())
+			Expect(store.ClaimDelivery(deliveryID, now, now.Add(time.Hour))).To(BeTrue())
+		})
+	})
+
+	Describe("deployments", func() {
+		repository := grh.Repository{Owner: repositoryOwner, Name: repositoryName}
+		deployment := grh.TrackedDeployment{
+			Issue:       grh.Issue{Number: issueNumber, Repository: repository},
+			ID:          42,
+			Environment: "staging",
+			SHA:         "1235",
+			RequestedBy: "alice",
+			CommentID:   1000,
+		}
+
+		BeforeEach(func() {
+			Expect(store.AddDeployment(deployment)).To(Succeed())
+		})
+
+		It("finds a deployment by its repository and ID", func() {
+			tracked, exists, err := store.Deployment(repository, deployment.ID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeTrue())
+			Expect(tracked).To(Equal(deployment))
+
+			_, exists, err = store.Deployment(grh.Repository{Owner: repositoryOwner, Name: "other"}, deployment.ID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeFalse())
+		})
+
+		It("stops tracking a removed deployment", func() {
+			Expect(store.RemoveDeployment(repository, deployment.ID)).To(Succeed())
+			_, exists, err := store.Deployment(repository, deployment.ID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeFalse())
+		})
+	})
+
+	Describe("owners files", func() {
+		repository := grh.Repository{Owner: repositoryOwner, Name: repositoryName}
+		file := grh.OwnersFile{Rules: []grh.OwnerRule{{Pattern: "docs/", Owners: []string{"alice"}}}}
+
+		It("remembers the repository's file until it's removed", func() {
+			Expect(store.SetOwnersFile(repository, file)).To(Succeed())
+			cached, exists, err := store.OwnersFile(repository)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeTrue())
+			Expect(cached).To(Equal(file))
+
+			Expect(store.RemoveOwnersFile(repository)).To(Succeed())
+			_, exists, err = store.OwnersFile(repository)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeFalse())
+		})
+	})
+
+	Describe("refusals", func() {
+		issue := grh.Issue{Number: issueNumber, Repository: grh.Repository{Owner: repositoryOwner, Name: repositoryName}}
+
+		It("lists the recorded reasons until they're removed", func() {
+			Expect(store.RecordRefusal(issue, "it's on hold")).To(BeTrue())
+			Expect(store.RecordRefusal(issue, "it's labeled wip")).To(BeTrue())
+			Expect(store.RecordRefusal(issue, "it's on hold")).To(BeFalse())
+			Expect(store.Refusals(issue)).To(Equal([]string{"it's labeled wip", "it's on hold"}))
+
+			Expect(store.RemoveRefusals(issue)).To(Succeed())
+			Expect(store.Refusals(issue)).To(BeEmpty())
+		})
+	})
+})
+
+var _ = Describe("SQLite store", func() {
+	var (
+		dir  string
+		path string
+
+		issue = grh.Issue{Number: issueNumber, Repository: grh.Repository{Owner: repositoryOwner, Name: repositoryName}}
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "sqlite-store")
+		Expect(err).NotTo(HaveOccurred())
+		path = filepath.Join(dir, "state.db")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("keeps the state across restarts", func() {
+		store, err := grh.NewSQLiteStore(path)
+		Expect(err).NotTo(HaveOccurred())
+		dueAt := time.Now().Add(time.Hour).UTC()
+		reminder := grh.Reminder{Repository: issue.Repository, PullRequest: issue.Number, User: "alice", DueAt: dueAt}
+		Expect(store.AddReminder(reminder)).To(Succeed())
+		Expect(store.AddMergeRequest(grh.MergeRequest{Issue: issue, RequestedBy: "alice"})).To(Succeed())
+		Expect(store.RecordRefusal(issue, "it's on hold")).To(BeTrue())
+		claimed, err := store.ClaimDelivery("delivery", time.Now(), time.Now().Add(time.Hour))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(claimed).To(BeTrue())
+
+		restartedStore, err := grh.NewSQLiteStore(path)
+		Expect(err).NotTo(HaveOccurred())
+		reminders, err := restartedStore.Reminders()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reminders).To(HaveLen(1))
+		Expect(reminders[0].DueAt.Equal(dueAt)).To(BeTrue())
+		Expect(restartedStore.MergeRequests()).To(HaveLen(1))
+		Expect(restartedStore.RecordRefusal(issue, "it's on hold")).To(BeFalse())
+		claimed, err = restartedStore.ClaimDelivery("delivery", time.Now(), time.Now().Add(time.Hour))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(claimed).To(BeFalse())
+	})
+
+	It("saves removals", func() {
+		store, err := grh.NewSQLiteStore(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(store.AddDeferredMerge(issue)).To(Succeed())
+		Expect(store.RemoveDeferredMerge(issue)).To(Succeed())
+
+		restartedStore, err := grh.NewSQLiteStore(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(restartedStore.DeferredMerges()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/evaluator"
+)
+
+// How many of a directory's files the summary lists before only counting the
+// rest, so that the summaries of large PRs would fit in a comment
+const summaryFilesPerDirectory = 10
+
+func isSummaryCommand(comment string) bool {
+	return strings.TrimSpace(comment) == "!summary"
+}
+
+// handleSummaryCommand comments a digest of the PR for its reviewers: the
+// changed files grouped by directory, how much of the diff is generated, the
+// commits, the linked issues, the rules currently blocking the merge and the
+// requested reviewers who haven't responded yet. Everything is gathered from
+// the API.
+func handleSummaryCommand(conf Config, issueComment IssueComment, store Store, issues Issues,
+	pullRequests PullRequests, repositories Repositories, graphQL GraphQL) Response {
+
+	issue := issueComment.Issue()
+	pr, errResp := getPR(issue, pullRequests)
+	if errResp != nil {
+		return errResp
+	}
+	files, errResp := getPRFiles(issue, pullRequests)
+	if errResp != nil {
+		return errResp
+	}
+	isExpectedHead := func(sha string) bool { return sha == pr.Head.GetSHA() }
+	commits, asyncErrResp := getCommits(issue, isExpectedHead, pullRequests)
+	if asyncErrResp != nil {
+		return asyncErrResp.ErrorResponse
+	}
+	rules := readinessRules(conf, pr, store, issues, pullRequests, repositories, graphQL)
+	decision, errResp := evaluate(rules, true)
+	if errResp != nil {
+		return errResp
+	}
+	var message strings.Builder
+	fmt.Fprintf(&message, "Summary of PR #%d", issue.Number)
+	if title := pr.GetTitle(); title != "" {
+		fmt.Fprintf(&message, ", %s", title)
+	}
+	message.WriteString(":\n\n")
+	writeSummaryFiles(&message, files)
+	writeSummaryGenerated(conf, &message, files)
+	writeSummaryCommits(&message, commits)
+	writeSummaryIssues(&message, linkedIssues(conf, pr))
+	writeSummaryBlockers(&message, decision)
+	writeSummaryReviewers(&message, pr.RequestedReviewers)
+	if err := comment(message.String(), issue.Repository, issue.Number, issues); err != nil {
+		errorMessage := fmt.Sprintf("Failed to post the summary of PR %s", issue.FullName())
+		return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	return SuccessResponse{message.String()}
+}
+
+func writeSummaryFiles(message *strings.Builder, files []*github.CommitFile) {
+	additions, deletions := 0, 0
+	byDirectory := map[string][]*github.CommitFile{}
+	for _, file := range files {
+		additions += file.GetAdditions()
+		deletions += file.GetDeletions()
+		directory := path.Dir(file.GetFilename())
+		byDirectory[directory] = append(byDirectory[directory], file)
+	}
+	directories := make([]string, 0, len(byDirectory))
+	for directory := range byDirectory {
+		directories = append(directories, directory)
+	}
+	sort.Strings(directories)
+	fmt.Fprintf(message, "**Files changed** (%d, +%d -%d)\n", len(files), additions, deletions)
+	for _, directory := range directories {
+		dirFiles := byDirectory[directory]
+		name := directory + "/"
+		if directory == "." {
+			name = "/"
+		}
+		fmt.Fprintf(message, "- `%s` (%d)\n", name, len(dirFiles))
+		for i, file := range dirFiles {
+			if i == summaryFilesPerDirectory {
+				fmt.Fprintf(message, "  - and %d more\n", len(dirFiles)-i)
+				break
+			}
+			fmt.Fprintf(message, "  - `%s` %s (+%d -%d)\n", path.Base(file.GetFilename()), file.GetStatus(),
+				file.GetAdditions(), file.GetDeletions())
+		}
+	}
+	message.WriteString("\n")
+}
+
+func writeSummaryCommits(message *strings.Builder, commits []*github.RepositoryCommit) {
+	fmt.Fprintf(message, "**Commits** (%d)\n", len(commits))
+	for _, commit := range commits {
+		subject := strings.SplitN(strings.TrimSpace(commit.Commit.GetMessage()), "\n", 2)[0]
+		fmt.Fprintf(message, "- %s %s\n", shortSHA(commit.GetSHA()), subject)
+	}
+	message.WriteString("\n")
+}
+
+func writeSummaryIssues(message *strings.Builder, references []string) {
+	message.WriteString("**Linked issues**\n")
+	if len(references) == 0 {
+		message.WriteString("- none\n")
+	}
+	for _, reference := range references {
+		fmt.Fprintf(message, "- %s\n", reference)
+	}
+	message.WriteString("\n")
+}
+
+func writeSummaryBlockers(message *strings.Builder, decision evaluator.Decision) {
+	message.WriteString("**Blocking the merge**\n")
+	if decision.Ready() {
+		message.WriteString("- nothing, the PR is ready to be merged\n")
+	}
+	for _, node := range decision.Nodes {
+		if node.Outcome == evaluator.Fail || node.Outcome == evaluator.Pending {
+			fmt.Fprintf(message, "- **%s**: %s\n", node.Rule, node.Reason)
+		}
+	}
+	message.WriteString("\n")
+}
+
+func writeSummaryReviewers(message *strings.Builder, requested []*github.User) {
+	message.WriteString("**Awaiting reviews from**\n")
+	if len(requested) == 0 {
+		message.WriteString("- nobody\n")
+	}
+	for _, reviewer := range requested {
+		fmt.Fprintf(message, "- `@%s`\n", reviewer.GetLogin())
+	}
+}
+
+// linkedIssues returns the GitHub issues referenced by the PR's title and
+// description and, if the Jira integration is enabled, the Jira issues
+// referenced by its title and head branch, without duplicates.
+func linkedIssues(conf Config, pr *github.PullRequest) []string {
+	var references []string
+	seen := map[string]bool{}
+	for _, text := range []string{pr.GetTitle(), pr.GetBody()} {
+		for _, match := range githubIssueReferenceRegexp.FindAllStringSubmatchIndex(text, -1) {
+			// The character preceding a short reference is matched as well
+			start := match[0]
+			if match[3] >= 0 {
+				start = match[3]
+			}
+			reference := text[start:match[1]]
+			if !seen[reference] {
+				seen[reference] = true
+				references = append(references, reference)
+			}
+		}
+	}
+	if conf.JiraURL != "" {
+		for _, key := range jiraIssueKeys(conf.JiraIssueKeyPattern, pr) {
+			if !seen[key] {
+				seen[key] = true
+				references = append(references, key)
+			}
+		}
+	}
+	return references
+}
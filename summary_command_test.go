@@ -0,0 +1,130 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("!summary comment", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+
+			anyListOptions = mock.AnythingOfType("*github.ListOptions")
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+		})
+
+		headSHA := "1235"
+		pr := &github.PullRequest{
+			Number:    github.Int(issueNumber),
+			Title:     github.String("Add the widget"),
+			Body:      github.String("Fixes #12 and salemove/other#3."),
+			Merged:    github.Bool(false),
+			Mergeable: github.Bool(true),
+			Base: &github.PullRequestBranch{
+				SHA:  github.String("1234"),
+				Ref:  github.String("master"),
+				Repo: repository,
+			},
+			Head: &github.PullRequestBranch{
+				SHA:  github.String(headSHA),
+				Ref:  github.String("feature"),
+				Repo: repository,
+			},
+			User: &github.User{
+				Login: github.String(arbitraryIssueAuthor),
+			},
+			RequestedReviewers: []*github.User{{Login: github.String("bob")}},
+		}
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!summary", arbitraryIssueAuthor)
+		})
+
+		BeforeEach(func() {
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+				Return(pr, emptyResponse, noError)
+			pullRequests.
+				On("ListFiles", anyContext, repositoryOwner, repositoryName, issueNumber, anyListOptions).
+				Return([]*github.CommitFile{
+					{Filename: github.String("widget/widget.go"), Status: github.String("added"),
+						Additions: github.Int(40)},
+					{Filename: github.String("widget/widget_test.go"), Status: github.String("added"),
+						Additions: github.Int(20)},
+					{Filename: github.String("README.md"), Status: github.String("modified"),
+						Additions: github.Int(2), Deletions: github.Int(1)},
+				}, emptyResponse, noError)
+			mockListCommits(githubCommits(
+				commit{"1111111111", "Add the widget\n\nWith a test."},
+				commit{headSHA, "Document the widget"},
+			), 100, repositoryOwner, repositoryName, issueNumber, pullRequests)
+			repositories.
+				On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA, anyListOptions).
+				Return(&github.CombinedStatus{
+					State: github.String("success"),
+					Statuses: []github.RepoStatus{{
+						Context: github.String("ci"),
+						State:   github.String("success"),
+					}},
+				}, emptyResponse, noError)
+			mockLabels(issues, issueNumber, grh.OnHoldLabel)
+		})
+
+		It("comments a digest of the PR", func() {
+			texts := []string{
+				"Summary of PR #7, Add the widget",
+				"**Files changed** (3, +62 -1)",
+				"- `/` (1)\n  - `README.md` modified (+2 -1)",
+				"- `widget/` (2)\n  - `widget.go` added (+40 -0)\n  - `widget_test.go` added (+20 -0)",
+				"**Commits** (2)\n- 1111111 Add the widget\n- 1235 Document the widget",
+				"**Linked issues**\n- #12\n- salemove/other#3",
+				"**Blocking the merge**\n- **hold**: it's on hold",
+				"**Awaiting reviews from**\n- `@bob`",
+			}
+			issues.
+				On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+					mock.MatchedBy(func(comment *github.IssueComment) bool {
+						for _, text := range texts {
+							if !commentContaining(text)(comment) {
+								return false
+							}
+						}
+						return true
+					})).
+				Return(emptyResult, emptyResponse, noError)
+
+			handle()
+			Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+			issues.AssertExpectations(GinkgoT())
+		})
+	})
+})
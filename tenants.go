@@ -0,0 +1,568 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/salemove/github-review-helper/git"
+)
+
+const githubAPIURL = "https://api.github.com/"
+
+// Tenant is an organization served with its own webhook secrets,
+// credentials, allowed repositories and policy, so that one process could
+// serve several organizations without them being able to act on each
+// other's repositories.
+type Tenant struct {
+	Organization string
+	// Secrets replace GITHUB_SECRET for the webhooks of the organization's
+	// repositories
+	Secrets []string
+	// The organization's repositories are accessed with either the access
+	// tokens or the GitHub App installation
+	AccessTokens []string
+	App          *GithubApp
+	// SSHKeyPath is the private key the organization's repositories are
+	// cloned and pushed to with. Without one, the repositories are cloned
+	// and pushed to over HTTPS with the tokens of the app's installation.
+	SSHKeyPath string
+	// AllowedRepositories replace ALLOWED_REPOSITORIES. They're all in the
+	// organization, which is allowed as a whole when the list is empty.
+	AllowedRepositories []string
+	// Policy overrides the global configuration for the organization's
+	// repositories. The organization and repository policies of the store
+	// still apply on top of it.
+	Policy Policy
+}
+
+// GithubApp is the installation of a GitHub App the tenant's repositories are
+// accessed with.
+type GithubApp struct {
+	ID             int64
+	InstallationID int64
+	PrivateKey     *rsa.PrivateKey
+}
+
+type tenantFileEntry struct {
+	Secrets      []string `json:"secrets"`
+	AccessTokens []string `json:"access_tokens"`
+	App          *struct {
+		ID             int64  `json:"id"`
+		InstallationID int64  `json:"installation_id"`
+		PrivateKeyPath string `json:"private_key_path"`
+	} `json:"app"`
+	SSHKeyPath          string   `json:"ssh_key_path"`
+	AllowedRepositories []string `json:"allowed_repositories"`
+	Policy              Policy   `json:"policy"`
+}
+
+// LoadTenants loads the tenants from the JSON file at path. See
+// ParseTenants for the format.
+func LoadTenants(path string) (map[string]Tenant, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseTenants(content)
+}
+
+// ParseTenants parses the tenants, which are keyed by organization, e.g.
+//
+//	{
+//	  "salemove": {
+//	    "secrets": ["a-secret"],
+//	    "access_tokens": ["a-token"],
+//	    "ssh_key_path": "/keys/salemove",
+//	    "allowed_repositories": ["salemove/github-review-helper"],
+//	    "policy": {"required_approvals": 2}
+//	  },
+//	  "deiwin": {
+//	    "secrets": ["another-secret"],
+//	    "app": {"id": 1, "installation_id": 2, "private_key_path": "/keys/deiwin.pem"}
+//	  }
+//	}
+//
+// The returned tenants are keyed by the lower case organization, because
+// GitHub's logins are case-insensitive.
+func ParseTenants(content []byte) (map[string]Tenant, error) {
+	var entries map[string]tenantFileEntry
+	if err := json.Unmarshal(content, &entries); err != nil {
+		return nil, err
+	}
+	organizations := make([]string, 0, len(entries))
+	for organization := range entries {
+		organizations = append(organizations, organization)
+	}
+	sort.Strings(organizations)
+	tenants := make(map[string]Tenant, len(entries))
+	for _, organization := range organizations {
+		key := strings.ToLower(organization)
+		if !organizationKeyRegexp.MatchString(organization) {
+			return nil, fmt.Errorf("tenants must be organizations, got \"%s\"", organization)
+		} else if _, exists := tenants[key]; exists {
+			return nil, fmt.Errorf("%s is listed more than once", organization)
+		}
+		tenant, err := parseTenant(organization, entries[organization])
+		if err != nil {
+			return nil, fmt.Errorf("invalid tenant %s: %v", organization, err)
+		}
+		tenants[key] = tenant
+	}
+	return tenants, nil
+}
+
+func parseTenant(organization string, entry tenantFileEntry) (Tenant, error) {
+	tenant := Tenant{
+		Organization:        organization,
+		Secrets:             nonEmptyStrings(entry.Secrets),
+		AccessTokens:        nonEmptyStrings(entry.AccessTokens),
+		SSHKeyPath:          strings.TrimSpace(entry.SSHKeyPath),
+		AllowedRepositories: nonEmptyStrings(entry.AllowedRepositories),
+		Policy:              entry.Policy,
+	}
+	if len(tenant.Secrets) == 0 {
+		return Tenant{}, errors.New("secrets must include at least one secret")
+	} else if (len(tenant.AccessTokens) == 0) == (entry.App == nil) {
+		return Tenant{}, errors.New("either access_tokens or app must be set")
+	} else if tenant.SSHKeyPath == "" && entry.App == nil {
+		// The SSH access of the user the bot runs as would reach every
+		// tenant's repositories
+		return Tenant{}, errors.New("ssh_key_path must be set, unless app is")
+	}
+	// A repository of another organization would be accessed with this
+	// tenant's credentials, so it's rejected instead of ignored
+	for _, allowed := range tenant.AllowedRepositories {
+		if !strings.EqualFold(allowed, organization) && (!repositoryKeyRegexp.MatchString(allowed) ||
+			!strings.EqualFold(strings.SplitN(allowed, "/", 2)[0], organization)) {
+
+			return Tenant{}, fmt.Errorf("allowed_repositories must be in %s, got \"%s\"", organization, allowed)
+		}
+	}
+	if err := tenant.Policy.validate(); err != nil {
+		return Tenant{}, fmt.Errorf("invalid policy: %v", err)
+	}
+	if entry.App != nil {
+		if entry.App.ID <= 0 || entry.App.InstallationID <= 0 {
+			return Tenant{}, errors.New("app must have an id and an installation_id")
+		}
+		privateKey, err := loadRSAPrivateKey(entry.App.PrivateKeyPath)
+		if err != nil {
+			return Tenant{}, fmt.Errorf("failed to load the app's private key: %v", err)
+		}
+		tenant.App = &GithubApp{
+			ID:             entry.App.ID,
+			InstallationID: entry.App.InstallationID,
+			PrivateKey:     privateKey,
+		}
+	}
+	return tenant, nil
+}
+
+func nonEmptyStrings(values []string) []string {
+	var nonEmpty []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			nonEmpty = append(nonEmpty, value)
+		}
+	}
+	return nonEmpty
+}
+
+// loadRSAPrivateKey loads a PEM encoded RSA private key, in either the PKCS#1
+// format GitHub generates the app keys in or in PKCS#8.
+func loadRSAPrivateKey(path string) (*rsa.PrivateKey, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, errors.New("no PEM encoded key found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("the key isn't an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// tenantConfig returns the configuration to handle the webhooks of the
+// repository with: the global configuration with the secrets and the
+// allowed repositories of the repository's tenant. False is returned, if
+// there are tenants, but the repository's owner isn't one of them.
+func (c Config) tenantConfig(repository Repository) (Config, bool) {
+	if len(c.Tenants) == 0 {
+		return c, true
+	}
+	tenant, exists := c.Tenants[strings.ToLower(repository.Owner)]
+	if !exists {
+		return c, false
+	}
+	c.Secrets = tenant.Secrets
+	c.AllowedRepositories = tenant.AllowedRepositories
+	if len(c.AllowedRepositories) == 0 {
+		c.AllowedRepositories = []string{repository.Owner}
+	}
+	return c, true
+}
+
+// tenantPolicy returns the policy of the repository's tenant or nil, if the
+// repository's owner isn't a tenant.
+func (c Config) tenantPolicy(repository Repository) *Policy {
+	tenant, exists := c.Tenants[strings.ToLower(repository.Owner)]
+	if !exists {
+		return nil
+	}
+	return &tenant.Policy
+}
+
+type tenantContextKey struct{}
+
+// withTenant returns a context that makes TenantTransport authenticate the
+// requests made with it as the owner's tenant, if the requests themselves
+// don't say which organization they're about.
+func withTenant(ctx context.Context, owner string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, owner)
+}
+
+// tenantGraphQL runs the GraphQL queries as the tenant that owns the
+// repositories they're about, including the mutations that only refer to
+// nodes by their IDs.
+type tenantGraphQL struct {
+	GraphQL
+	owner string
+}
+
+func (g tenantGraphQL) Query(ctx context.Context, query string, variables map[string]interface{},
+	result interface{}) error {
+
+	return g.GraphQL.Query(withTenant(ctx, g.owner), query, variables, result)
+}
+
+// graphQLForTenant returns the GraphQL client to act on the owner's
+// repositories with.
+func graphQLForTenant(conf Config, owner string, graphQL GraphQL) GraphQL {
+	if len(conf.Tenants) == 0 {
+		return graphQL
+	}
+	return tenantGraphQL{graphQL, owner}
+}
+
+// TenantTransport authenticates the GitHub API requests with the credentials
+// of the tenant whose repository or organization they're about, so that a
+// tenant's credentials are never used on another tenant's repositories.
+// Requests about organizations that aren't tenants are refused. GraphQL
+// requests that don't name an organization, e.g. mutations of nodes by ID,
+// are made as the tenant of their context (see withTenant) and refused
+// without one. Other requests that aren't about any organization, e.g.
+// reading the bot's own account, are authenticated by Default.
+type TenantTransport struct {
+	Default http.RoundTripper
+	tenants map[string]http.RoundTripper
+}
+
+// NewTenantTransport creates a transport that authenticates the requests
+// about each tenant with its access tokens or app installation before
+// passing them on to the transport.
+func NewTenantTransport(tenants map[string]Tenant, defaultTransport, transport http.RoundTripper) *TenantTransport {
+	tenantTransports := make(map[string]http.RoundTripper, len(tenants))
+	for key, tenant := range tenants {
+		if tenant.App != nil {
+			tenantTransports[key] = NewAppInstallationTransport(*tenant.App, transport)
+		} else {
+			tenantTransports[key] = NewTokenPoolTransport(tenant.AccessTokens, transport)
+		}
+	}
+	return &TenantTransport{
+		Default: defaultTransport,
+		tenants: tenantTransports,
+	}
+}
+
+func (t *TenantTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	owner, err := requestOwner(req)
+	if err != nil {
+		return nil, err
+	} else if owner == "" {
+		owner, _ = req.Context().Value(tenantContextKey{}).(string)
+	}
+	if owner == "" && isGraphQLRequest(req) {
+		return nil, errors.New("refusing to make a GraphQL request that isn't about any tenant")
+	} else if owner == "" {
+		return t.Default.RoundTrip(req)
+	}
+	transport, exists := t.tenants[strings.ToLower(owner)]
+	if !exists {
+		return nil, fmt.Errorf("refusing to access %s, which isn't a tenant", owner)
+	}
+	return transport.RoundTrip(req)
+}
+
+// requestOwner returns the owner of the repository or the organization the
+// GitHub API request is about: the one in a /repos/ or /orgs/ path, in the
+// repo:, org: and user: qualifiers of a search or in the owner or org
+// variable of a GraphQL query. An empty owner is returned, if the request
+// isn't about any.
+func requestOwner(req *http.Request) (string, error) {
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	switch {
+	case len(segments) >= 2 && (segments[0] == "repos" || segments[0] == "orgs"):
+		return segments[1], nil
+	case len(segments) >= 1 && segments[0] == "search":
+		return searchOwner(req.URL.Query().Get("q"))
+	case isGraphQLRequest(req) && req.GetBody != nil:
+		body, err := req.GetBody()
+		if err != nil {
+			return "", err
+		}
+		defer body.Close()
+		var query struct {
+			Variables struct {
+				Owner string `json:"owner"`
+				Org   string `json:"org"`
+			} `json:"variables"`
+		}
+		if err = json.NewDecoder(body).Decode(&query); err != nil {
+			return "", fmt.Errorf("failed to parse the GraphQL query: %v", err)
+		}
+		if query.Variables.Owner == "" {
+			return query.Variables.Org, nil
+		}
+		return query.Variables.Owner, nil
+	}
+	return "", nil
+}
+
+func isGraphQLRequest(req *http.Request) bool {
+	return strings.Trim(req.URL.Path, "/") == "graphql"
+}
+
+// searchOwner returns the owner the search query is limited to. Queries
+// spanning several owners are refused, because they can't be authenticated
+// as a single tenant.
+func searchOwner(query string) (string, error) {
+	owner := ""
+	for _, field := range strings.Fields(query) {
+		var fieldOwner string
+		switch {
+		case strings.HasPrefix(field, "repo:"):
+			fieldOwner = strings.SplitN(strings.TrimPrefix(field, "repo:"), "/", 2)[0]
+		case strings.HasPrefix(field, "org:"):
+			fieldOwner = strings.TrimPrefix(field, "org:")
+		case strings.HasPrefix(field, "user:"):
+			fieldOwner = strings.TrimPrefix(field, "user:")
+		default:
+			continue
+		}
+		if owner != "" && !strings.EqualFold(owner, fieldOwner) {
+			return "", fmt.Errorf("refusing to search both %s and %s", owner, fieldOwner)
+		}
+		owner = fieldOwner
+	}
+	return owner, nil
+}
+
+// tenantGitRepos clones the repositories of each tenant into a directory of
+// their own and accesses them with the tenant's SSH key or app installation,
+// so that a tenant's credentials are never used on another tenant's
+// repositories. Repositories of organizations that aren't tenants are
+// refused.
+type tenantGitRepos struct {
+	organizations []string
+	tenants       map[string]git.Repos
+}
+
+// newTenantGitRepos creates the repos for every tenant with newRepos, which
+// is given the tenant's directory beneath basePath and the tenant.
+func newTenantGitRepos(tenants map[string]Tenant, basePath string,
+	newRepos func(basePath string, tenant Tenant) git.Repos) tenantGitRepos {
+
+	repos := tenantGitRepos{tenants: make(map[string]git.Repos, len(tenants))}
+	for key, tenant := range tenants {
+		repos.organizations = append(repos.organizations, key)
+		repos.tenants[key] = newRepos(filepath.Join(basePath, key), tenant)
+	}
+	sort.Strings(repos.organizations)
+	return repos
+}
+
+func (r tenantGitRepos) GetUpdatedRepo(url, repoOwner, repoName string) (git.Repo, error) {
+	repos, exists := r.tenants[strings.ToLower(repoOwner)]
+	if !exists {
+		return nil, fmt.Errorf("refusing to clone %s/%s, because %s isn't a tenant", repoOwner, repoName,
+			repoOwner)
+	}
+	return repos.GetUpdatedRepo(url, repoOwner, repoName)
+}
+
+func (r tenantGitRepos) PruneStaleRefs() error {
+	var errs []string
+	for _, organization := range r.organizations {
+		if err := r.tenants[organization].PruneStaleRefs(); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", organization, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (r tenantGitRepos) States() []git.RepoState {
+	var states []git.RepoState
+	for _, organization := range r.organizations {
+		states = append(states, r.tenants[organization].States()...)
+	}
+	return states
+}
+
+func (r tenantGitRepos) RemoveIdleRepos(maxIdle time.Duration) ([]string, error) {
+	var removed, errs []string
+	for _, organization := range r.organizations {
+		paths, err := r.tenants[organization].RemoveIdleRepos(maxIdle)
+		removed = append(removed, paths...)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", organization, err))
+		}
+	}
+	if len(errs) > 0 {
+		return removed, errors.New(strings.Join(errs, "; "))
+	}
+	return removed, nil
+}
+
+func (r tenantGitRepos) WithContext(ctx context.Context) git.Repos {
+	repos := tenantGitRepos{organizations: r.organizations, tenants: make(map[string]git.Repos, len(r.tenants))}
+	for organization, tenantRepos := range r.tenants {
+		repos.tenants[organization] = tenantRepos.WithContext(ctx)
+	}
+	return repos
+}
+
+// AppInstallationTransport authenticates the GitHub API requests as an
+// installation of a GitHub App. The installation's access token is created
+// with a JWT signed by the app's private key and reused until shortly
+// before it expires.
+type AppInstallationTransport struct {
+	Transport http.RoundTripper
+
+	sync.Mutex
+	app     GithubApp
+	token   string
+	expires time.Time
+	now     func() time.Time
+}
+
+// NewAppInstallationTransport creates a transport that authenticates the
+// requests as the app's installation before passing them on to the
+// transport.
+func NewAppInstallationTransport(app GithubApp, transport http.RoundTripper) *AppInstallationTransport {
+	return &AppInstallationTransport{
+		Transport: transport,
+		app:       app,
+		now:       time.Now,
+	}
+}
+
+func (t *AppInstallationTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.installationToken()
+	if err != nil {
+		return nil, err
+	}
+	req = cloneRequest(req)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return t.Transport.RoundTrip(req)
+}
+
+func (t *AppInstallationTransport) installationToken() (string, error) {
+	t.Lock()
+	defer t.Unlock()
+	now := t.now()
+	if t.token != "" && now.Before(t.expires.Add(-time.Minute)) {
+		return t.token, nil
+	}
+	jwt, err := appJWT(t.app, now)
+	if err != nil {
+		return "", err
+	}
+	url := fmt.Sprintf("%sapp/installations/%d/access_tokens", githubAPIURL, t.app.InstallationID)
+	req, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := t.Transport.RoundTrip(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to create an access token for installation %d: %v",
+			t.app.InstallationID, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("failed to create an access token for installation %d: GitHub responded with %s",
+			t.app.InstallationID, resp.Status)
+	}
+	var created struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return "", fmt.Errorf("failed to parse the access token of installation %d: %v", t.app.InstallationID, err)
+	}
+	t.token, t.expires = created.Token, created.ExpiresAt
+	return t.token, nil
+}
+
+// appJWT creates the JWT the app authenticates as itself with. It's issued a
+// minute in the past to allow for clock drift and expires in the 10 minutes
+// GitHub allows at most.
+func appJWT(app GithubApp, now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]int64{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": app.ID,
+	})
+	if err != nil {
+		return "", err
+	}
+	var token bytes.Buffer
+	token.WriteString(base64.RawURLEncoding.EncodeToString(header))
+	token.WriteString(".")
+	token.WriteString(base64.RawURLEncoding.EncodeToString(claims))
+	digest := sha256.Sum256(token.Bytes())
+	signature, err := rsa.SignPKCS1v15(rand.Reader, app.PrivateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	token.WriteString(".")
+	token.WriteString(base64.RawURLEncoding.EncodeToString(signature))
+	return token.String(), nil
+}
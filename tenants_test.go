@@ -0,0 +1,269 @@
+package main_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+
+	grh "github.com/salemove/github-review-helper"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParseTenants", func() {
+	It("parses the tenants keyed by the lower case organization", func() {
+		tenants, err := grh.ParseTenants([]byte(`{
+  "Salemove": {
+    "secrets": ["a-secret"],
+    "access_tokens": ["a-token"],
+    "ssh_key_path": "/keys/salemove",
+    "allowed_repositories": ["salemove/github-review-helper"],
+    "policy": {"required_approvals": 2}
+  }
+}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tenants).To(HaveLen(1))
+		tenant := tenants["salemove"]
+		Expect(tenant.Organization).To(Equal("Salemove"))
+		Expect(tenant.Secrets).To(Equal([]string{"a-secret"}))
+		Expect(tenant.AccessTokens).To(Equal([]string{"a-token"}))
+		Expect(tenant.SSHKeyPath).To(Equal("/keys/salemove"))
+		Expect(tenant.AllowedRepositories).To(Equal([]string{"salemove/github-review-helper"}))
+		Expect(*tenant.Policy.RequiredApprovals).To(Equal(2))
+	})
+
+	It("fails for an allowed repository of another organization", func() {
+		_, err := grh.ParseTenants([]byte(`{
+  "salemove": {
+    "secrets": ["a-secret"],
+    "access_tokens": ["a-token"],
+    "ssh_key_path": "/keys/salemove",
+    "allowed_repositories": ["deiwin/dotfiles"]
+  }
+}`))
+		Expect(err).To(MatchError(ContainSubstring("allowed_repositories must be in salemove")))
+	})
+
+	It("fails for a tenant without secrets", func() {
+		_, err := grh.ParseTenants([]byte(`{"salemove": {"access_tokens": ["a-token"]}}`))
+		Expect(err).To(MatchError(ContainSubstring("at least one secret")))
+	})
+
+	It("fails for a tenant with both access tokens and an app", func() {
+		_, err := grh.ParseTenants([]byte(`{
+  "salemove": {
+    "secrets": ["a-secret"],
+    "access_tokens": ["a-token"],
+    "app": {"id": 1, "installation_id": 2, "private_key_path": "key.pem"}
+  }
+}`))
+		Expect(err).To(MatchError(ContainSubstring("either access_tokens or app")))
+	})
+
+	It("fails for a tenant without an SSH key", func() {
+		_, err := grh.ParseTenants([]byte(`{"salemove": {"secrets": ["a-secret"], "access_tokens": ["a-token"]}}`))
+		Expect(err).To(MatchError(ContainSubstring("ssh_key_path must be set")))
+	})
+
+	Context("with an app's private key", func() {
+		var keyPath string
+
+		BeforeEach(func() {
+			key, err := rsa.GenerateKey(rand.Reader, 1024)
+			Expect(err).NotTo(HaveOccurred())
+			file, err := ioutil.TempFile("", "tenant-key")
+			Expect(err).NotTo(HaveOccurred())
+			defer file.Close()
+			keyPath = file.Name()
+			Expect(pem.Encode(file, &pem.Block{
+				Type:  "RSA PRIVATE KEY",
+				Bytes: x509.MarshalPKCS1PrivateKey(key),
+			})).To(Succeed())
+		})
+
+		AfterEach(func() {
+			os.Remove(keyPath)
+		})
+
+		It("parses an app's tenant without an SSH key", func() {
+			tenants, err := grh.ParseTenants([]byte(`{
+  "salemove": {
+    "secrets": ["a-secret"],
+    "app": {"id": 1, "installation_id": 2, "private_key_path": "` + keyPath + `"}
+  }
+}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tenants["salemove"].SSHKeyPath).To(BeEmpty())
+			Expect(tenants["salemove"].App).NotTo(BeNil())
+		})
+
+		It("parses the app installation", func() {
+			tenants, err := grh.ParseTenants([]byte(`{
+  "salemove": {
+    "secrets": ["a-secret"],
+    "app": {"id": 1, "installation_id": 2, "private_key_path": "` + keyPath + `"},
+    "ssh_key_path": "/keys/salemove"
+  }
+}`))
+			Expect(err).NotTo(HaveOccurred())
+			app := tenants["salemove"].App
+			Expect(app).NotTo(BeNil())
+			Expect(app.ID).To(Equal(int64(1)))
+			Expect(app.InstallationID).To(Equal(int64(2)))
+			Expect(app.PrivateKey).NotTo(BeNil())
+		})
+	})
+})
+
+var _ = Describe("TenantTransport", func() {
+	var (
+		client     *http.Client
+		usedTokens []string
+	)
+
+	BeforeEach(func() {
+		usedTokens = nil
+		transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			usedTokens = append(usedTokens, req.Header.Get("Authorization"))
+			recorder := httptest.NewRecorder()
+			recorder.Header().Set("X-RateLimit-Remaining", strconv.Itoa(100))
+			return recorder.Result(), nil
+		})
+		tenants := map[string]grh.Tenant{
+			"salemove": {Organization: "salemove", AccessTokens: []string{"salemove-token"}},
+			"deiwin":   {Organization: "deiwin", AccessTokens: []string{"deiwin-token"}},
+		}
+		defaultTransport := grh.NewTokenPoolTransport([]string{"default-token"}, transport)
+		client = &http.Client{Transport: grh.NewTenantTransport(tenants, defaultTransport, transport)}
+	})
+
+	get := func(url string) error {
+		resp, err := client.Get(url)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	It("uses the credentials of the tenant the request is about", func() {
+		Expect(get("https://api.github.com/repos/Salemove/github-review-helper/pulls/1")).To(Succeed())
+		Expect(get("https://api.github.com/orgs/deiwin/teams/reviewers/members")).To(Succeed())
+		Expect(get("https://api.github.com/search/issues?q=is%3Apr+repo%3Adeiwin%2Fdotfiles")).To(Succeed())
+		Expect(usedTokens).To(Equal([]string{"Bearer salemove-token", "Bearer deiwin-token", "Bearer deiwin-token"}))
+	})
+
+	It("routes GraphQL queries by their owner variable", func() {
+		resp, err := client.Post("https://api.github.com/graphql", "application/json",
+			bytes.NewBufferString(`{"query": "query {}", "variables": {"owner": "deiwin", "name": "dotfiles"}}`))
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(usedTokens).To(Equal([]string{"Bearer deiwin-token"}))
+	})
+
+	It("routes GraphQL queries by their org variable", func() {
+		resp, err := client.Post("https://api.github.com/graphql", "application/json",
+			bytes.NewBufferString(`{"query": "query {}", "variables": {"org": "deiwin", "slug": "reviewers"}}`))
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(usedTokens).To(Equal([]string{"Bearer deiwin-token"}))
+	})
+
+	It("refuses the GraphQL requests that aren't about any tenant", func() {
+		_, err := client.Post("https://api.github.com/graphql", "application/json",
+			bytes.NewBufferString(`{"query": "mutation {}", "variables": {"subjectId": "an-id"}}`))
+		Expect(err).To(HaveOccurred())
+		Expect(usedTokens).To(BeEmpty())
+	})
+
+	It("uses the default credentials for the requests that aren't about an organization", func() {
+		Expect(get("https://api.github.com/user")).To(Succeed())
+		Expect(usedTokens).To(Equal([]string{"Bearer default-token"}))
+	})
+
+	It("refuses the requests about organizations that aren't tenants", func() {
+		Expect(get("https://api.github.com/repos/other-org/api/pulls/1")).NotTo(Succeed())
+		Expect(usedTokens).To(BeEmpty())
+	})
+
+	It("refuses the searches spanning several tenants", func() {
+		Expect(get("https://api.github.com/search/issues?q=org%3Asalemove+org%3Adeiwin")).NotTo(Succeed())
+		Expect(usedTokens).To(BeEmpty())
+	})
+})
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("a webhook in multi-tenant mode", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!merge", arbitraryIssueAuthor)
+		})
+
+		Context("about a repository of an organization that isn't a tenant", func() {
+			BeforeEach(func() {
+				context.Config.Tenants = map[string]grh.Tenant{
+					"other-org": {Organization: "other-org", Secrets: []string{"a-secret"}},
+				}
+			})
+
+			It("fails with StatusForbidden", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusForbidden))
+			})
+		})
+
+		Context("signed with the secret of another tenant", func() {
+			BeforeEach(func() {
+				context.Config.Tenants = map[string]grh.Tenant{
+					repositoryOwner: {Organization: repositoryOwner, Secrets: []string{"another-secret"}},
+					"other-org":     {Organization: "other-org", Secrets: []string{"a-secret"}},
+				}
+			})
+
+			It("fails with StatusForbidden", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusForbidden))
+			})
+		})
+
+		Context("about a repository the tenant doesn't allow", func() {
+			BeforeEach(func() {
+				context.Config.Tenants = map[string]grh.Tenant{
+					repositoryOwner: {
+						Organization:        repositoryOwner,
+						Secrets:             []string{"a-secret"},
+						AllowedRepositories: []string{repositoryOwner + "/other"},
+					},
+				}
+			})
+
+			It("succeeds with 'ignored' response without acting on the command", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(responseRecorder.Body.String()).To(ContainSubstring("is not allowed. Ignoring."))
+			})
+		})
+	})
+})
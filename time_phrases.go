@@ -0,0 +1,271 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The hour of the day that phrases naming only a day, e.g. "tomorrow", refer
+// to
+const defaultHourOfDay = 9
+
+var (
+	timeOfDayRegexp = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(am|pm)?$`)
+	utcOffsetRegexp = regexp.MustCompile(`^([+-])(\d{2}):?(\d{2})$`)
+	// The offsets of the common time zone abbreviations. The abbreviations
+	// are taken literally, e.g. CET is always UTC+1, even when the Central
+	// European countries are on summer time. IANA names, e.g. Europe/Berlin,
+	// follow daylight saving time.
+	timeZoneAbbreviationOffsets = map[string]int{
+		"UTC":  0,
+		"GMT":  0,
+		"WET":  0,
+		"WEST": 1,
+		"BST":  1,
+		"CET":  1,
+		"CEST": 2,
+		"EET":  2,
+		"EEST": 3,
+		"MSK":  3,
+		"EST":  -5,
+		"EDT":  -4,
+		"CST":  -6,
+		"CDT":  -5,
+		"MST":  -7,
+		"MDT":  -6,
+		"PST":  -8,
+		"PDT":  -7,
+		"JST":  9,
+	}
+	phraseWeekdays = map[string]time.Weekday{
+		"sun": time.Sunday, "sunday": time.Sunday,
+		"mon": time.Monday, "monday": time.Monday,
+		"tue": time.Tuesday, "tuesday": time.Tuesday,
+		"wed": time.Wednesday, "wednesday": time.Wednesday,
+		"thu": time.Thursday, "thursday": time.Thursday,
+		"fri": time.Friday, "friday": time.Friday,
+		"sat": time.Saturday, "saturday": time.Saturday,
+	}
+)
+
+// LoadTimeZone loads a time zone by its IANA name (e.g. "Europe/Tallinn"),
+// its abbreviation (e.g. "CET") or its offset from UTC (e.g. "+02:00").
+func LoadTimeZone(name string) (*time.Location, error) {
+	if offset, isAbbreviation := timeZoneAbbreviationOffsets[strings.ToUpper(name)]; isAbbreviation {
+		if offset == 0 {
+			return time.UTC, nil
+		}
+		return time.FixedZone(strings.ToUpper(name), offset*60*60), nil
+	} else if matches := utcOffsetRegexp.FindStringSubmatch(name); matches != nil {
+		hours, _ := strconv.Atoi(matches[2])
+		minutes, _ := strconv.Atoi(matches[3])
+		offset := hours*60*60 + minutes*60
+		if matches[1] == "-" {
+			offset = -offset
+		}
+		return time.FixedZone(name, offset), nil
+	} else if !strings.Contains(name, "/") {
+		// time.LoadLocation would also accept "Local" and the names of
+		// files in the zoneinfo directory's root
+		return nil, fmt.Errorf("`%s` is not a time zone I know", name)
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("`%s` is not a time zone I know", name)
+	}
+	return location, nil
+}
+
+// ParseTimePhrase parses a phrase describing a future time, e.g. "tomorrow
+// 9am CET", "fri 17:00", "2026-06-01 14:30 Europe/Tallinn" or
+// "2026-06-01T14:30:00Z". The phrase consists of a day ("today", "tomorrow",
+// a weekday or a date), a time of day or both, optionally followed by a time
+// zone. Phrases without a time zone are in the given location. A day without
+// a time of day refers to 9:00 and a time of day without a day refers to its
+// next occurrence.
+func ParseTimePhrase(phrase string, now time.Time, location *time.Location) (time.Time, error) {
+	phrase = strings.TrimSpace(phrase)
+	if t, err := time.Parse(time.RFC3339, phrase); err == nil {
+		return checkFutureTime(phrase, t, now)
+	}
+	fields := strings.Fields(phrase)
+	if len(fields) > 1 {
+		if zone, err := LoadTimeZone(fields[len(fields)-1]); err == nil {
+			location = zone
+			fields = fields[:len(fields)-1]
+		}
+	}
+	localNow := now.In(location)
+	var (
+		year, day          int
+		month              time.Month
+		weekday            *time.Weekday
+		hour, minute       = -1, 0
+		hasDay, isRelative bool
+	)
+	for _, field := range fields {
+		field = strings.ToLower(field)
+		if field == "at" || field == "on" || field == "next" {
+			continue
+		} else if !hasDay && (field == "today" || field == "tomorrow") {
+			year, month, day = localNow.Date()
+			if field == "tomorrow" {
+				day++
+			}
+			hasDay = true
+		} else if fieldWeekday, isWeekday := phraseWeekdays[field]; !hasDay && isWeekday {
+			weekday = &fieldWeekday
+			hasDay = true
+		} else if date, err := time.Parse("2006-01-02", field); !hasDay && err == nil {
+			year, month, day = date.Date()
+			hasDay = true
+		} else if fieldHour, fieldMinute, isTime := parseTimeOfDay(field); hour == -1 && isTime {
+			hour, minute = fieldHour, fieldMinute
+		} else {
+			return time.Time{}, fmt.Errorf("`%s` is not a time I understand, try something like "+
+				"`tomorrow 9am CET` or `fri 17:00 Europe/Tallinn`", phrase)
+		}
+	}
+	if !hasDay && hour == -1 {
+		return time.Time{}, fmt.Errorf("`%s` doesn't say when", phrase)
+	} else if hour == -1 {
+		hour = defaultHourOfDay
+	}
+	if !hasDay || weekday != nil {
+		year, month, day = localNow.Date()
+		isRelative = true
+	}
+	if weekday != nil {
+		day += (int(*weekday) - int(localNow.Weekday()) + 7) % 7
+	}
+	t := time.Date(year, month, day, hour, minute, 0, 0, location)
+	if isRelative && !t.After(now) {
+		// The next occurrence of the time of day or of the weekday
+		if weekday != nil {
+			t = time.Date(year, month, day+7, hour, minute, 0, 0, location)
+		} else {
+			t = time.Date(year, month, day+1, hour, minute, 0, 0, location)
+		}
+	}
+	return checkFutureTime(phrase, t, now)
+}
+
+func parseTimeOfDay(field string) (int, int, bool) {
+	switch field {
+	case "noon":
+		return 12, 0, true
+	case "midnight":
+		return 0, 0, true
+	}
+	matches := timeOfDayRegexp.FindStringSubmatch(field)
+	// A bare number could be meant as anything
+	if matches == nil || (matches[2] == "" && matches[3] == "") {
+		return 0, 0, false
+	}
+	hour, _ := strconv.Atoi(matches[1])
+	minute, _ := strconv.Atoi(matches[2])
+	if matches[3] != "" {
+		if hour < 1 || hour > 12 {
+			return 0, 0, false
+		}
+		hour %= 12
+		if matches[3] == "pm" {
+			hour += 12
+		}
+	}
+	if hour > 23 || minute > 59 {
+		return 0, 0, false
+	}
+	return hour, minute, true
+}
+
+func checkFutureTime(phrase string, t, now time.Time) (time.Time, error) {
+	if !t.After(now) {
+		return time.Time{}, fmt.Errorf("`%s` is in the past", phrase)
+	}
+	return t, nil
+}
+
+// formatTimeInterpretation formats the time in the time zone it was given in
+// and, for other time zones, also in UTC, so that the reader could check
+// that the time was understood as intended.
+func formatTimeInterpretation(t time.Time) string {
+	formatted := t.Format("Mon Jan 2 2006 15:04 MST")
+	if _, offset := t.Zone(); offset != 0 {
+		formatted += fmt.Sprintf(" (%s)", t.UTC().Format("15:04 MST"))
+	}
+	return formatted
+}
+
+// commandLocation returns the time zone of the times given to commands.
+func (c Config) commandLocation() *time.Location {
+	if c.CommandLocation == nil {
+		return time.UTC
+	}
+	return c.CommandLocation
+}
+
+// ParseRepositoryTimezones parses a semicolon separated list of
+// "<scope>=<time zone>" pairs, where the scope is an owner or an owner/name
+// of a repository and the time zone is an IANA name, e.g.
+// "salemove=Europe/Tallinn; salemove/api=America/New_York". Abbreviations
+// and offsets aren't accepted, because they don't follow daylight saving
+// time.
+func ParseRepositoryTimezones(timezonesString string) (map[string]*time.Location, error) {
+	locations := map[string]*time.Location{}
+	for _, pair := range strings.Split(timezonesString, ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("expected a pair in the \"owner/name=Europe/Tallinn\" format, got \"%s\"", pair)
+		}
+		scope, name := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if !organizationKeyRegexp.MatchString(scope) && !repositoryKeyRegexp.MatchString(scope) {
+			return nil, fmt.Errorf("scopes must be owners or in the owner/name format, got \"%s\"", scope)
+		} else if name != "UTC" && !strings.Contains(name, "/") {
+			return nil, fmt.Errorf("the time zone of %s must be an IANA name, e.g. Europe/Tallinn, got \"%s\"",
+				scope, name)
+		}
+		location, err := time.LoadLocation(name)
+		if err != nil {
+			return nil, fmt.Errorf("the time zone of %s: `%s` is not a time zone I know", scope, name)
+		}
+		locations[scope] = location
+	}
+	return locations, nil
+}
+
+// repositoryLocation returns the time zone configured for the repository or
+// for its owner in REPOSITORY_TIMEZONES, or nil, if neither has one.
+func (c Config) repositoryLocation(repository Repository) *time.Location {
+	if location, exists := c.RepositoryLocations[repositoryKey(repository)]; exists {
+		return location
+	}
+	return c.RepositoryLocations[repository.Owner]
+}
+
+// repositoryCommandLocation returns the time zone of the times given to
+// commands on the repository's PRs.
+func (c Config) repositoryCommandLocation(repository Repository) *time.Location {
+	if location := c.repositoryLocation(repository); location != nil {
+		return location
+	}
+	return c.commandLocation()
+}
+
+// mergeFreezeLocation returns the time zone of the repository's merge
+// freezes that don't name one.
+func (c Config) mergeFreezeLocation(repository Repository) *time.Location {
+	if location := c.repositoryLocation(repository); location != nil {
+		return location
+	} else if c.MergeFreezeLocation != nil {
+		return c.MergeFreezeLocation
+	}
+	return time.UTC
+}
@@ -0,0 +1,66 @@
+package main_test
+
+import (
+	"time"
+
+	grh "github.com/salemove/github-review-helper"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParseTimePhrase", func() {
+	// 2018-06-01 was a Friday
+	now := time.Date(2018, 6, 1, 12, 30, 0, 0, time.UTC)
+	cet := time.FixedZone("CET", 60*60)
+
+	parse := func(phrase string) time.Time {
+		t, err := grh.ParseTimePhrase(phrase, now, time.UTC)
+		Expect(err).NotTo(HaveOccurred(), phrase)
+		return t
+	}
+
+	It("parses days and times of day in the given time zone", func() {
+		Expect(parse("tomorrow 9am CET")).To(BeTemporally("==", time.Date(2018, 6, 2, 9, 0, 0, 0, cet)))
+		Expect(parse("tomorrow at 5:30pm")).To(BeTemporally("==", time.Date(2018, 6, 2, 17, 30, 0, 0, time.UTC)))
+		Expect(parse("today 17:00 +02:00")).To(BeTemporally("==", time.Date(2018, 6, 1, 15, 0, 0, 0, time.UTC)))
+		Expect(parse("2018-06-20 noon")).To(BeTemporally("==", time.Date(2018, 6, 20, 12, 0, 0, 0, time.UTC)))
+		Expect(parse("2018-06-20T08:00:00Z")).To(BeTemporally("==", time.Date(2018, 6, 20, 8, 0, 0, 0, time.UTC)))
+	})
+
+	It("follows daylight saving time in IANA time zones", func() {
+		tallinn, err := time.LoadLocation("Europe/Tallinn")
+		Expect(err).NotTo(HaveOccurred())
+		t := parse("mon 08:00 Europe/Tallinn")
+		Expect(t).To(BeTemporally("==", time.Date(2018, 6, 4, 8, 0, 0, 0, tallinn)))
+		Expect(t.UTC().Hour()).To(Equal(5))
+	})
+
+	It("refers to the next occurrence of times of day and weekdays", func() {
+		Expect(parse("9am")).To(BeTemporally("==", time.Date(2018, 6, 2, 9, 0, 0, 0, time.UTC)))
+		Expect(parse("1pm")).To(BeTemporally("==", time.Date(2018, 6, 1, 13, 0, 0, 0, time.UTC)))
+		Expect(parse("friday")).To(BeTemporally("==", time.Date(2018, 6, 8, 9, 0, 0, 0, time.UTC)))
+		Expect(parse("next fri 4pm")).To(BeTemporally("==", time.Date(2018, 6, 1, 16, 0, 0, 0, time.UTC)))
+	})
+
+	It("uses the given location for phrases without a time zone", func() {
+		t, err := grh.ParseTimePhrase("tomorrow 9am", now, cet)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(t).To(BeTemporally("==", time.Date(2018, 6, 2, 8, 0, 0, 0, time.UTC)))
+	})
+
+	It("fails for past and unknown times", func() {
+		for _, phrase := range []string{
+			"today 9am",
+			"2018-05-01 9am",
+			"soon",
+			"tomorrow 9",
+			"tomorrow 13pm",
+			"tomorrow 9am Mars/Olympus",
+			"",
+		} {
+			_, err := grh.ParseTimePhrase(phrase, now, time.UTC)
+			Expect(err).To(HaveOccurred(), phrase)
+		}
+	})
+})
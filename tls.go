@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+	"gopkg.in/tylerb/graceful.v1"
+)
+
+// serve serves the handler on the configured port until the process is
+// interrupted. HTTPS is served with either the configured certificate or one
+// from Let's Encrypt, if either is configured.
+func serve(conf Config, handler http.Handler) {
+	server := &graceful.Server{
+		Timeout:      10 * time.Second,
+		TCPKeepAlive: 3 * time.Minute,
+		Server: &http.Server{
+			Addr:    fmt.Sprintf(":%d", conf.Port),
+			Handler: handler,
+			// Keeps slow senders from holding connections open
+			ReadHeaderTimeout: conf.WebhookReadTimeout,
+			ReadTimeout:       conf.WebhookReadTimeout,
+		},
+	}
+	var err error
+	switch {
+	case conf.TLSCertFile != "":
+		log.Printf("Serving HTTPS on port %d\n", conf.Port)
+		err = server.ListenAndServeTLS(conf.TLSCertFile, conf.TLSKeyFile)
+	case conf.ACMEHostname != "":
+		manager := newACMEManager(conf)
+		if conf.ACMEHTTPPort != 0 {
+			go func() {
+				log.Printf("Answering ACME challenges on port %d\n", conf.ACMEHTTPPort)
+				log.Println(http.ListenAndServe(fmt.Sprintf(":%d", conf.ACMEHTTPPort), manager.HTTPHandler(nil)))
+			}()
+		}
+		log.Printf("Serving HTTPS for %s on port %d\n", conf.ACMEHostname, conf.Port)
+		err = server.ListenAndServeTLSConfig(acmeTLSConfig(manager))
+	default:
+		err = server.ListenAndServe()
+	}
+	// Like graceful.Run, ignore the error from the listener being closed on
+	// shutdown
+	if opErr, ok := err.(*net.OpError); err != nil && (!ok || opErr.Op != "accept") {
+		log.Println(err)
+		os.Exit(1)
+	}
+}
+
+// newACMEManager creates a manager that gets and renews the Let's Encrypt
+// certificate of the configured hostname.
+func newACMEManager(conf Config) *autocert.Manager {
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(conf.ACMEHostname),
+		Cache:      autocert.DirCache(conf.ACMECacheDir),
+		Email:      conf.ACMEEmail,
+	}
+}
+
+func acmeTLSConfig(manager *autocert.Manager) *tls.Config {
+	config := manager.TLSConfig()
+	config.MinVersion = tls.VersionTLS12
+	return config
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// TokenPoolTransport authenticates the GitHub API requests with several
+// access tokens in turn, so that a burst of requests, e.g. a merge storm,
+// would be spread over the rate limits of all of the tokens. Tokens whose
+// rate limit is exhausted are skipped until the limit resets.
+type TokenPoolTransport struct {
+	Transport http.RoundTripper
+
+	sync.Mutex
+	tokens []*pooledToken
+	next   int
+	now    func() time.Time
+}
+
+type pooledToken struct {
+	token string
+	// remaining is the number of requests left in the token's rate limit, as
+	// last reported by GitHub, or -1 if it's not known yet
+	remaining int
+	reset     time.Time
+}
+
+// TokenRateLimit is the rate limit of a token of the pool, as last reported
+// by GitHub. Reported by /debug/vars as github_token_rate_limits.
+type TokenRateLimit struct {
+	Token     string    `json:"token"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+}
+
+// NewTokenPoolTransport creates a transport that authenticates the requests
+// with the tokens in turn before passing them on to the transport.
+func NewTokenPoolTransport(tokens []string, transport http.RoundTripper) *TokenPoolTransport {
+	pool := &TokenPoolTransport{
+		Transport: transport,
+		now:       time.Now,
+	}
+	for _, token := range tokens {
+		pool.tokens = append(pool.tokens, &pooledToken{token: token, remaining: -1})
+	}
+	return pool
+}
+
+func (t *TokenPoolTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token := t.pick()
+	req = cloneRequest(req)
+	req.Header.Set("Authorization", "Bearer "+token.token)
+	resp, err := t.Transport.RoundTrip(req)
+	if err == nil {
+		t.record(token, resp.Header)
+	}
+	return resp, err
+}
+
+// pick returns the next token that has requests left. If all of the tokens
+// are exhausted, then the one whose limit resets first is picked, so that
+// GitHub would report the exhaustion as usual.
+func (t *TokenPoolTransport) pick() *pooledToken {
+	t.Lock()
+	defer t.Unlock()
+	now := t.now()
+	var soonestReset *pooledToken
+	for i := 0; i < len(t.tokens); i++ {
+		token := t.tokens[(t.next+i)%len(t.tokens)]
+		if token.remaining != 0 || !now.Before(token.reset) {
+			t.next = (t.next + i + 1) % len(t.tokens)
+			return token
+		} else if soonestReset == nil || token.reset.Before(soonestReset.reset) {
+			soonestReset = token
+		}
+	}
+	return soonestReset
+}
+
+func (t *TokenPoolTransport) record(token *pooledToken, header http.Header) {
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	token.remaining = remaining
+	token.reset = time.Unix(reset, 0)
+}
+
+// RateLimits returns the rate limits of the tokens, identified by their
+// positions in the pool and the last four characters.
+func (t *TokenPoolTransport) RateLimits() []TokenRateLimit {
+	t.Lock()
+	defer t.Unlock()
+	limits := make([]TokenRateLimit, len(t.tokens))
+	for i, token := range t.tokens {
+		limits[i] = TokenRateLimit{
+			Token:     fmt.Sprintf("#%d (...%s)", i+1, lastCharacters(token.token, 4)),
+			Remaining: token.remaining,
+			Reset:     token.reset,
+		}
+	}
+	return limits
+}
+
+// Remaining returns the number of requests left in the rate limits of all
+// of the tokens. It's not known, if any of the tokens hasn't been used yet
+// or if its limit has reset since it was last used.
+func (t *TokenPoolTransport) Remaining() (int, bool) {
+	t.Lock()
+	defer t.Unlock()
+	now := t.now()
+	total := 0
+	for _, token := range t.tokens {
+		if token.remaining == -1 || !now.Before(token.reset) {
+			return 0, false
+		}
+		total += token.remaining
+	}
+	return total, true
+}
+
+func lastCharacters(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[len(s)-n:]
+}
+
+// publishTokenRateLimits reports the rate limits of the pool's tokens and
+// their total at /debug/vars and makes the pool's budget throttle the
+// background jobs.
+func publishTokenRateLimits(pool *TokenPoolTransport) {
+	expvar.Publish("github_token_rate_limits", expvar.Func(func() interface{} {
+		return pool.RateLimits()
+	}))
+	expvar.Publish("github_rate_limit_remaining", expvar.Func(func() interface{} {
+		if remaining, ok := pool.Remaining(); ok {
+			return remaining
+		}
+		return nil
+	}))
+	setRateLimitBudget(pool.Remaining)
+}
@@ -0,0 +1,89 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	grh "github.com/salemove/github-review-helper"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TokenPoolTransport", func() {
+	var (
+		client     *http.Client
+		pool       *grh.TokenPoolTransport
+		usedTokens []string
+		remaining  map[string]int
+	)
+
+	BeforeEach(func() {
+		usedTokens = nil
+		remaining = map[string]int{"Bearer first": 100, "Bearer second": 100}
+		transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			authorization := req.Header.Get("Authorization")
+			usedTokens = append(usedTokens, authorization)
+			remaining[authorization]--
+			recorder := httptest.NewRecorder()
+			recorder.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining[authorization]))
+			recorder.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+			return recorder.Result(), nil
+		})
+		pool = grh.NewTokenPoolTransport([]string{"first", "second"}, transport)
+		client = &http.Client{Transport: pool}
+	})
+
+	get := func() {
+		resp, err := client.Get("https://api.github.com/user")
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+	}
+
+	It("uses the tokens in turn", func() {
+		get()
+		get()
+		get()
+		Expect(usedTokens).To(Equal([]string{"Bearer first", "Bearer second", "Bearer first"}))
+	})
+
+	Context("when a token's rate limit is exhausted", func() {
+		BeforeEach(func() {
+			remaining["Bearer first"] = 1
+		})
+
+		It("skips the token until the limit resets", func() {
+			get()
+			get()
+			get()
+			Expect(usedTokens).To(Equal([]string{"Bearer first", "Bearer second", "Bearer second"}))
+		})
+
+		It("reports the token's rate limit", func() {
+			get()
+			limits := pool.RateLimits()
+			Expect(limits).To(HaveLen(2))
+			Expect(limits[0].Token).To(Equal("#1 (...irst)"))
+			Expect(limits[0].Remaining).To(Equal(0))
+			Expect(limits[1].Remaining).To(Equal(-1))
+		})
+	})
+
+	Describe("Remaining", func() {
+		It("is not known before every token has been used", func() {
+			get()
+			_, ok := pool.Remaining()
+			Expect(ok).To(BeFalse())
+		})
+
+		It("sums the requests left for all of the tokens", func() {
+			get()
+			get()
+			remaining, ok := pool.Remaining()
+			Expect(ok).To(BeTrue())
+			Expect(remaining).To(Equal(198))
+		})
+	})
+})
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/git"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/salemove/github-review-helper")
+
+// initTracing starts exporting spans to the configured OTLP endpoint. The
+// returned function flushes the remaining spans and stops the exporter.
+func initTracing(conf Config) (func(), error) {
+	if conf.OTLPEndpoint == "" {
+		return func() {}, nil
+	}
+	exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(conf.OTLPEndpoint))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the OTLP exporter: %v", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName("github-review-helper"),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	return func() {
+		provider.Shutdown(context.Background())
+	}, nil
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func endGithubSpan(span trace.Span, resp *github.Response, err error) {
+	if resp != nil && resp.Response != nil {
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	}
+	endSpan(span, err)
+}
+
+// tracedClients wraps the GitHub API clients and the git repos, so that every
+// API call and git command would be traced as a child of the span in ctx.
+// The API calls are made with context.TODO(), so the given context is
+// replaced with ctx.
+type tracedClients struct {
+	ctx context.Context
+}
+
+func (t tracedClients) start(operation, owner, repo string) (context.Context, trace.Span) {
+	return tracer.Start(t.ctx, "GitHub "+operation, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("github.repository", owner+"/"+repo)))
+}
+
+// traceClients returns clients that trace their calls as children of the
+// span in ctx.
+func traceClients(ctx context.Context, gitRepos git.Repos, pullRequests PullRequests, repositories Repositories,
+	issues Issues, search Search, graphQL GraphQL) (git.Repos, PullRequests, Repositories, Issues, Search,
+	GraphQL) {
+
+	t := tracedClients{ctx}
+	return gitRepos.WithContext(ctx), tracedPullRequests{t, pullRequests}, tracedRepositories{t, repositories},
+		tracedIssues{t, issues}, tracedSearch{t, search}, tracedGraphQL{t, graphQL}
+}
+
+type tracedPullRequests struct {
+	tracedClients
+	PullRequests
+}
+
+func (t tracedPullRequests) Get(_ context.Context, owner, repo string, number int) (*github.PullRequest,
+	*github.Response, error) {
+
+	ctx, span := t.start("PullRequests.Get", owner, repo)
+	pr, resp, err := t.PullRequests.Get(ctx, owner, repo, number)
+	endGithubSpan(span, resp, err)
+	return pr, resp, err
+}
+
+func (t tracedPullRequests) ListCommits(_ context.Context, owner, repo string, number int,
+	opt *github.ListOptions) ([]*github.RepositoryCommit, *github.Response, error) {
+
+	ctx, span := t.start("PullRequests.ListCommits", owner, repo)
+	commits, resp, err := t.PullRequests.ListCommits(ctx, owner, repo, number, opt)
+	endGithubSpan(span, resp, err)
+	return commits, resp, err
+}
+
+func (t tracedPullRequests) Merge(_ context.Context, owner, repo string, number int, commitMessage string,
+	opt *github.PullRequestOptions) (*github.PullRequestMergeResult, *github.Response, error) {
+
+	ctx, span := t.start("PullRequests.Merge", owner, repo)
+	result, resp, err := t.PullRequests.Merge(ctx, owner, repo, number, commitMessage, opt)
+	endGithubSpan(span, resp, err)
+	return result, resp, err
+}
+
+func (t tracedPullRequests) ListReviews(_ context.Context, owner, repo string, number int,
+	opt *github.ListOptions) ([]*github.PullRequestReview, *github.Response, error) {
+
+	ctx, span := t.start("PullRequests.ListReviews", owner, repo)
+	reviews, resp, err := t.PullRequests.ListReviews(ctx, owner, repo, number, opt)
+	endGithubSpan(span, resp, err)
+	return reviews, resp, err
+}
+
+func (t tracedPullRequests) ListFiles(_ context.Context, owner, repo string, number int,
+	opt *github.ListOptions) ([]*github.CommitFile, *github.Response, error) {
+
+	ctx, span := t.start("PullRequests.ListFiles", owner, repo)
+	files, resp, err := t.PullRequests.ListFiles(ctx, owner, repo, number, opt)
+	endGithubSpan(span, resp, err)
+	return files, resp, err
+}
+
+func (t tracedPullRequests) RequestReviewers(_ context.Context, owner, repo string, number int,
+	reviewers github.ReviewersRequest) (*github.PullRequest, *github.Response, error) {
+
+	ctx, span := t.start("PullRequests.RequestReviewers", owner, repo)
+	pr, resp, err := t.PullRequests.RequestReviewers(ctx, owner, repo, number, reviewers)
+	endGithubSpan(span, resp, err)
+	return pr, resp, err
+}
+
+func (t tracedPullRequests) Create(_ context.Context, owner, repo string,
+	pull *github.NewPullRequest) (*github.PullRequest, *github.Response, error) {
+
+	ctx, span := t.start("PullRequests.Create", owner, repo)
+	pr, resp, err := t.PullRequests.Create(ctx, owner, repo, pull)
+	endGithubSpan(span, resp, err)
+	return pr, resp, err
+}
+
+func (t tracedPullRequests) CreateReview(_ context.Context, owner, repo string, number int,
+	review *github.PullRequestReviewRequest) (*github.PullRequestReview, *github.Response, error) {
+
+	ctx, span := t.start("PullRequests.CreateReview", owner, repo)
+	createdReview, resp, err := t.PullRequests.CreateReview(ctx, owner, repo, number, review)
+	endGithubSpan(span, resp, err)
+	return createdReview, resp, err
+}
+
+type tracedRepositories struct {
+	tracedClients
+	Repositories
+}
+
+func (t tracedRepositories) CreateStatus(_ context.Context, owner, repo, ref string,
+	status *github.RepoStatus) (*github.RepoStatus, *github.Response, error) {
+
+	ctx, span := t.start("Repositories.CreateStatus", owner, repo)
+	createdStatus, resp, err := t.Repositories.CreateStatus(ctx, owner, repo, ref, status)
+	endGithubSpan(span, resp, err)
+	return createdStatus, resp, err
+}
+
+func (t tracedRepositories) GetCombinedStatus(_ context.Context, owner, repo, ref string,
+	opt *github.ListOptions) (*github.CombinedStatus, *github.Response, error) {
+
+	ctx, span := t.start("Repositories.GetCombinedStatus", owner, repo)
+	combinedStatus, resp, err := t.Repositories.GetCombinedStatus(ctx, owner, repo, ref, opt)
+	endGithubSpan(span, resp, err)
+	return combinedStatus, resp, err
+}
+
+func (t tracedRepositories) CompareCommits(_ context.Context, owner, repo, base, head string) (
+	*github.CommitsComparison, *github.Response, error) {
+
+	ctx, span := t.start("Repositories.CompareCommits", owner, repo)
+	comparison, resp, err := t.Repositories.CompareCommits(ctx, owner, repo, base, head)
+	endGithubSpan(span, resp, err)
+	return comparison, resp, err
+}
+
+func (t tracedRepositories) Get(_ context.Context, owner, repo string) (*github.Repository, *github.Response,
+	error) {
+
+	ctx, span := t.start("Repositories.Get", owner, repo)
+	repository, resp, err := t.Repositories.Get(ctx, owner, repo)
+	endGithubSpan(span, resp, err)
+	return repository, resp, err
+}
+
+func (t tracedRepositories) IsCollaborator(_ context.Context, owner, repo, user string) (bool, *github.Response,
+	error) {
+
+	ctx, span := t.start("Repositories.IsCollaborator", owner, repo)
+	isCollaborator, resp, err := t.Repositories.IsCollaborator(ctx, owner, repo, user)
+	endGithubSpan(span, resp, err)
+	return isCollaborator, resp, err
+}
+
+func (t tracedRepositories) GetRequiredStatusChecks(_ context.Context, owner, repo,
+	branch string) (*github.RequiredStatusChecks, *github.Response, error) {
+
+	ctx, span := t.start("Repositories.GetRequiredStatusChecks", owner, repo)
+	checks, resp, err := t.Repositories.GetRequiredStatusChecks(ctx, owner, repo, branch)
+	endGithubSpan(span, resp, err)
+	return checks, resp, err
+}
+
+func (t tracedRepositories) ListReleases(_ context.Context, owner, repo string,
+	opt *github.ListOptions) ([]*github.RepositoryRelease, *github.Response, error) {
+
+	ctx, span := t.start("Repositories.ListReleases", owner, repo)
+	releases, resp, err := t.Repositories.ListReleases(ctx, owner, repo, opt)
+	endGithubSpan(span, resp, err)
+	return releases, resp, err
+}
+
+func (t tracedRepositories) CreateRelease(_ context.Context, owner, repo string,
+	release *github.RepositoryRelease) (*github.RepositoryRelease, *github.Response, error) {
+
+	ctx, span := t.start("Repositories.CreateRelease", owner, repo)
+	createdRelease, resp, err := t.Repositories.CreateRelease(ctx, owner, repo, release)
+	endGithubSpan(span, resp, err)
+	return createdRelease, resp, err
+}
+
+func (t tracedRepositories) EditRelease(_ context.Context, owner, repo string, id int,
+	release *github.RepositoryRelease) (*github.RepositoryRelease, *github.Response, error) {
+
+	ctx, span := t.start("Repositories.EditRelease", owner, repo)
+	editedRelease, resp, err := t.Repositories.EditRelease(ctx, owner, repo, id, release)
+	endGithubSpan(span, resp, err)
+	return editedRelease, resp, err
+}
+
+func (t tracedRepositories) CreateComment(_ context.Context, owner, repo, sha string,
+	comment *github.RepositoryComment) (*github.RepositoryComment, *github.Response, error) {
+
+	ctx, span := t.start("Repositories.CreateComment", owner, repo)
+	createdComment, resp, err := t.Repositories.CreateComment(ctx, owner, repo, sha, comment)
+	endGithubSpan(span, resp, err)
+	return createdComment, resp, err
+}
+
+func (t tracedRepositories) CreateDeployment(_ context.Context, owner, repo string,
+	request *github.DeploymentRequest) (*github.Deployment, *github.Response, error) {
+
+	ctx, span := t.start("Repositories.CreateDeployment", owner, repo)
+	deployment, resp, err := t.Repositories.CreateDeployment(ctx, owner, repo, request)
+	endGithubSpan(span, resp, err)
+	return deployment, resp, err
+}
+
+func (t tracedRepositories) Merge(_ context.Context, owner, repo string,
+	request *github.RepositoryMergeRequest) (*github.RepositoryCommit, *github.Response, error) {
+
+	ctx, span := t.start("Repositories.Merge", owner, repo)
+	commit, resp, err := t.Repositories.Merge(ctx, owner, repo, request)
+	endGithubSpan(span, resp, err)
+	return commit, resp, err
+}
+
+type tracedIssues struct {
+	tracedClients
+	Issues
+}
+
+func (t tracedIssues) AddLabelsToIssue(_ context.Context, owner, repo string, number int,
+	labels []string) ([]*github.Label, *github.Response, error) {
+
+	ctx, span := t.start("Issues.AddLabelsToIssue", owner, repo)
+	addedLabels, resp, err := t.Issues.AddLabelsToIssue(ctx, owner, repo, number, labels)
+	endGithubSpan(span, resp, err)
+	return addedLabels, resp, err
+}
+
+func (t tracedIssues) RemoveLabelForIssue(_ context.Context, owner, repo string, number int,
+	label string) (*github.Response, error) {
+
+	ctx, span := t.start("Issues.RemoveLabelForIssue", owner, repo)
+	resp, err := t.Issues.RemoveLabelForIssue(ctx, owner, repo, number, label)
+	endGithubSpan(span, resp, err)
+	return resp, err
+}
+
+func (t tracedIssues) CreateComment(_ context.Context, owner string, repo string, number int,
+	comment *github.IssueComment) (*github.IssueComment, *github.Response, error) {
+
+	ctx, span := t.start("Issues.CreateComment", owner, repo)
+	createdComment, resp, err := t.Issues.CreateComment(ctx, owner, repo, number, comment)
+	endGithubSpan(span, resp, err)
+	return createdComment, resp, err
+}
+
+func (t tracedIssues) EditComment(_ context.Context, owner string, repo string, id int64,
+	comment *github.IssueComment) (*github.IssueComment, *github.Response, error) {
+
+	ctx, span := t.start("Issues.EditComment", owner, repo)
+	editedComment, resp, err := t.Issues.EditComment(ctx, owner, repo, id, comment)
+	endGithubSpan(span, resp, err)
+	return editedComment, resp, err
+}
+
+func (t tracedIssues) ListLabelsByIssue(_ context.Context, owner string, repo string, number int,
+	opt *github.ListOptions) ([]*github.Label, *github.Response, error) {
+
+	ctx, span := t.start("Issues.ListLabelsByIssue", owner, repo)
+	labels, resp, err := t.Issues.ListLabelsByIssue(ctx, owner, repo, number, opt)
+	endGithubSpan(span, resp, err)
+	return labels, resp, err
+}
+
+func (t tracedIssues) ListByRepo(_ context.Context, owner string, repo string,
+	opt *github.IssueListByRepoOptions) ([]*github.Issue, *github.Response, error) {
+
+	ctx, span := t.start("Issues.ListByRepo", owner, repo)
+	repoIssues, resp, err := t.Issues.ListByRepo(ctx, owner, repo, opt)
+	endGithubSpan(span, resp, err)
+	return repoIssues, resp, err
+}
+
+func (t tracedIssues) AddAssignees(_ context.Context, owner, repo string, number int,
+	assignees []string) (*github.Issue, *github.Response, error) {
+
+	ctx, span := t.start("Issues.AddAssignees", owner, repo)
+	issue, resp, err := t.Issues.AddAssignees(ctx, owner, repo, number, assignees)
+	endGithubSpan(span, resp, err)
+	return issue, resp, err
+}
+
+func (t tracedIssues) RemoveAssignees(_ context.Context, owner, repo string, number int,
+	assignees []string) (*github.Issue, *github.Response, error) {
+
+	ctx, span := t.start("Issues.RemoveAssignees", owner, repo)
+	issue, resp, err := t.Issues.RemoveAssignees(ctx, owner, repo, number, assignees)
+	endGithubSpan(span, resp, err)
+	return issue, resp, err
+}
+
+func (t tracedIssues) Edit(_ context.Context, owner string, repo string, number int,
+	issue *github.IssueRequest) (*github.Issue, *github.Response, error) {
+
+	ctx, span := t.start("Issues.Edit", owner, repo)
+	editedIssue, resp, err := t.Issues.Edit(ctx, owner, repo, number, issue)
+	endGithubSpan(span, resp, err)
+	return editedIssue, resp, err
+}
+
+func (t tracedIssues) ListMilestones(_ context.Context, owner string, repo string,
+	opt *github.MilestoneListOptions) ([]*github.Milestone, *github.Response, error) {
+
+	ctx, span := t.start("Issues.ListMilestones", owner, repo)
+	milestones, resp, err := t.Issues.ListMilestones(ctx, owner, repo, opt)
+	endGithubSpan(span, resp, err)
+	return milestones, resp, err
+}
+
+func (t tracedIssues) CreateMilestone(_ context.Context, owner string, repo string,
+	milestone *github.Milestone) (*github.Milestone, *github.Response, error) {
+
+	ctx, span := t.start("Issues.CreateMilestone", owner, repo)
+	createdMilestone, resp, err := t.Issues.CreateMilestone(ctx, owner, repo, milestone)
+	endGithubSpan(span, resp, err)
+	return createdMilestone, resp, err
+}
+
+func (t tracedIssues) Lock(_ context.Context, owner string, repo string, number int,
+	opt *github.LockIssueOptions) (*github.Response, error) {
+
+	ctx, span := t.start("Issues.Lock", owner, repo)
+	resp, err := t.Issues.Lock(ctx, owner, repo, number, opt)
+	endGithubSpan(span, resp, err)
+	return resp, err
+}
+
+func (t tracedIssues) Unlock(_ context.Context, owner string, repo string, number int) (*github.Response, error) {
+	ctx, span := t.start("Issues.Unlock", owner, repo)
+	resp, err := t.Issues.Unlock(ctx, owner, repo, number)
+	endGithubSpan(span, resp, err)
+	return resp, err
+}
+
+type tracedSearch struct {
+	tracedClients
+	Search
+}
+
+func (t tracedSearch) Issues(_ context.Context, query string, opt *github.SearchOptions) (*github.IssuesSearchResult,
+	*github.Response, error) {
+
+	ctx, span := tracer.Start(t.ctx, "GitHub Search.Issues", trace.WithSpanKind(trace.SpanKindClient))
+	result, resp, err := t.Search.Issues(ctx, query, opt)
+	endGithubSpan(span, resp, err)
+	return result, resp, err
+}
+
+type tracedGraphQL struct {
+	tracedClients
+	GraphQL
+}
+
+func (t tracedGraphQL) Query(_ context.Context, query string, variables map[string]interface{},
+	result interface{}) error {
+
+	ctx, span := tracer.Start(t.ctx, "GitHub GraphQL", trace.WithSpanKind(trace.SpanKindClient))
+	err := t.GraphQL.Query(ctx, query, variables, result)
+	endSpan(span, err)
+	return err
+}
+
+// traceWebhook starts the span covering the handling of a webhook.
+func traceWebhook(r *http.Request) (context.Context, trace.Span) {
+	eventType := r.Header.Get("X-Github-Event")
+	return tracer.Start(r.Context(), "webhook "+eventType, trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("github.event", eventType),
+			attribute.String("github.delivery", r.Header.Get("X-Github-Delivery")),
+		))
+}
+
+// endWebhookSpan records the outcome of handling the webhook and ends its
+// span.
+func endWebhookSpan(span trace.Span, response Response) {
+	if errResp, ok := asErrorResponse(response); ok {
+		span.SetAttributes(attribute.Int("http.response.status_code", errResp.Code))
+		endSpan(span, fmt.Errorf("%s: %v", errResp.ErrorMessage, errResp.Error))
+		return
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", http.StatusOK))
+	span.End()
+}
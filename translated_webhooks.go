@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// webhookTranslation is a GitHub webhook another provider's webhook
+// translates to.
+type webhookTranslation struct {
+	event string
+	body  interface{}
+}
+
+// forwardTranslations passes the translated webhooks on to the handler,
+// signed with the secret as GitHub would sign them. The translations'
+// delivery IDs are derived from the original delivery's ID, if the provider
+// sent one. The first failure is returned.
+func forwardTranslations(w http.ResponseWriter, r *http.Request, secret, deliveryID string,
+	translations []webhookTranslation, handler Handler) Response {
+
+	if len(translations) == 0 {
+		return SuccessResponse{"Not an event I understand. Ignoring."}
+	}
+	var response Response
+	for i, translation := range translations {
+		translatedBody, err := json.Marshal(translation.body)
+		if err != nil {
+			return ErrorResponse{err, http.StatusInternalServerError, "Failed to translate the webhook"}
+		}
+		req, err := http.NewRequest(r.Method, r.URL.String(), bytes.NewReader(translatedBody))
+		if err != nil {
+			return ErrorResponse{err, http.StatusInternalServerError, "Failed to translate the webhook"}
+		}
+		req = req.WithContext(r.Context())
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Github-Event", translation.event)
+		if deliveryID != "" {
+			req.Header.Set("X-Github-Delivery", fmt.Sprintf("%s-%d", deliveryID, i))
+		}
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(translatedBody)
+		req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		response = handler(w, req)
+		if _, failed := asErrorResponse(response); failed {
+			return response
+		}
+	}
+	return response
+}
+
+// authorAssociation looks up the user's association with the repository.
+// Without one every commenter would be trusted with the commands that are
+// limited to the repository's members.
+func authorAssociation(repository Repository, username string, associations AuthorAssociations) (string,
+	*ErrorResponse) {
+
+	association, err := associations.AuthorAssociation(context.TODO(), repository.Owner, repository.Name, username)
+	if err != nil {
+		return "", &ErrorResponse{err, http.StatusBadGateway, "Failed to look up the user's access to the repository"}
+	}
+	return association, nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/git"
+)
+
+const confirmTwoPersonMergeAction = "two-person merge"
+
+// requiresTwoPersonMerge reports whether merging into the base branch has to
+// be confirmed by a second maintainer.
+func requiresTwoPersonMerge(conf Config, base string) bool {
+	for _, pattern := range conf.TwoPersonMergeBranches {
+		if matched, _ := path.Match(pattern, base); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// requestTwoPersonConfirmation asks a second maintainer to confirm the merge
+// requestedBy asked for, if the PR's base branch requires it.
+func requestTwoPersonConfirmation(conf Config, issue Issue, requestedBy string, store Store, issues Issues,
+	pullRequests PullRequests) *ErrorResponse {
+
+	if len(conf.TwoPersonMergeBranches) == 0 {
+		return nil
+	}
+	pr, errResp := getPR(issue, pullRequests)
+	if errResp != nil {
+		return errResp
+	} else if !requiresTwoPersonMerge(conf, *pr.Base.Ref) {
+		return nil
+	}
+	return askForSecondMaintainer(pr, requestedBy, store, issues)
+}
+
+// askForSecondMaintainer comments on the PR to ask for the merge of its
+// current head to be confirmed. The confirmation is only asked for once per
+// head, even if the merge is asked for again, but the requester is recorded,
+// if it wasn't known yet, so that they couldn't confirm the merge themselves.
+func askForSecondMaintainer(pr *github.PullRequest, requestedBy string, store Store, issues Issues) *ErrorResponse {
+	issue := prIssue(pr)
+	base := *pr.Base.Ref
+	pending, exists, err := store.PendingConfirmation(issue.Repository, issue.Number)
+	if err != nil {
+		message := fmt.Sprintf("Failed to get the pending confirmation of PR %s", issue.FullName())
+		return &ErrorResponse{err, http.StatusInternalServerError, message}
+	} else if exists && pending.Action == confirmTwoPersonMergeAction {
+		if pending.HeadSHA == *pr.Head.SHA {
+			if pending.RequestedBy != "" || requestedBy == "" {
+				return nil
+			}
+			pending.RequestedBy = requestedBy
+			if err = store.SetPendingConfirmation(pending); err != nil {
+				message := fmt.Sprintf("Failed to store the requester of PR %s's merge", issue.FullName())
+				return &ErrorResponse{err, http.StatusInternalServerError, message}
+			}
+			return nil
+		} else if requestedBy == "" {
+			// New commits have been pushed since the merge was asked for
+			requestedBy = pending.RequestedBy
+		}
+	}
+	log.Printf("Merging PR %s into %s needs a second maintainer's confirmation. Asking for it.\n",
+		issue.FullName(), base)
+	message := fmt.Sprintf("Merging this PR into `%s` needs a second maintainer's confirmation. A maintainer can "+
+		"confirm the merge by reacting with :+1: to this comment or by commenting `!confirm`.", base)
+	if requestedBy != "" {
+		message = fmt.Sprintf("@%s asked me to merge this PR into `%s`, which needs a second maintainer's "+
+			"confirmation. Another maintainer can confirm the merge by reacting with :+1: to this comment or by "+
+			"commenting `!confirm`.", requestedBy, base)
+	}
+	confirmationComment, _, err := issues.CreateComment(context.TODO(), issue.Repository.Owner,
+		issue.Repository.Name, issue.Number, &github.IssueComment{Body: github.String(message)})
+	if err != nil {
+		errorMessage := fmt.Sprintf("Failed to ask for a second maintainer's confirmation on PR %s",
+			issue.FullName())
+		return &ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	err = store.SetPendingConfirmation(PendingConfirmation{
+		Repository:  issue.Repository,
+		PullRequest: issue.Number,
+		Action:      confirmTwoPersonMergeAction,
+		RequestedBy: requestedBy,
+		CommentID:   confirmationComment.GetID(),
+		CreatedAt:   time.Now(),
+		HeadSHA:     *pr.Head.SHA,
+	})
+	if err != nil {
+		message := fmt.Sprintf("Failed to store the pending confirmation of PR %s", issue.FullName())
+		return &ErrorResponse{err, http.StatusInternalServerError, message}
+	}
+	return nil
+}
+
+// checkTwoPersonConfirmation reports whether a second maintainer has
+// confirmed merging the PR's current head, either with a `!confirm` or with a
+// :+1: reaction to the bot's comment. PRs whose base branches don't require a
+// confirmation are always confirmed. The confirmation is asked for, if it
+// hasn't been for the current head yet, e.g. because the PR was labeled for
+// merging by a bot or new commits have been pushed since.
+func checkTwoPersonConfirmation(conf Config, pr *github.PullRequest, store Store, issues Issues,
+	repositories Repositories, graphQL GraphQL) (bool, *ErrorResponse) {
+
+	if !requiresTwoPersonMerge(conf, *pr.Base.Ref) {
+		return true, nil
+	}
+	issue := prIssue(pr)
+	pending, exists, err := store.PendingConfirmation(issue.Repository, issue.Number)
+	if err != nil {
+		message := fmt.Sprintf("Failed to get the pending confirmation of PR %s", issue.FullName())
+		return false, &ErrorResponse{err, http.StatusInternalServerError, message}
+	} else if !exists || pending.Action != confirmTwoPersonMergeAction || pending.HeadSHA != *pr.Head.SHA {
+		return false, askForSecondMaintainer(pr, "", store, issues)
+	} else if pending.ConfirmedBy != "" {
+		return true, nil
+	}
+	confirmer, errResp := findReactionConfirmer(pending, repositories, graphQL)
+	if errResp != nil {
+		return false, errResp
+	} else if confirmer == "" {
+		return false, nil
+	}
+	log.Printf("%s confirmed merging PR %s with a reaction.\n", confirmer, issue.FullName())
+	pending.ConfirmedBy = confirmer
+	if err = store.SetPendingConfirmation(pending); err != nil {
+		message := fmt.Sprintf("Failed to store the confirmation of PR %s", issue.FullName())
+		return false, &ErrorResponse{err, http.StatusInternalServerError, message}
+	}
+	return true, nil
+}
+
+// findReactionConfirmer returns the login of a collaborator, other than the
+// one who asked for the merge, who reacted with :+1: to the bot's comment
+// asking for the confirmation. Empty if there's no such collaborator.
+func findReactionConfirmer(pending PendingConfirmation, repositories Repositories,
+	graphQL GraphQL) (string, *ErrorResponse) {
+
+	issue := Issue{Repository: pending.Repository, Number: pending.PullRequest}
+	reactors, errResp := listReactors(issue, pending.CommentID, "+1", graphQL)
+	if errResp != nil {
+		return "", errResp
+	}
+	for _, reactor := range reactors {
+		if reactor == pending.RequestedBy {
+			continue
+		}
+		isCollab, err := isCollaborator(issue.Repository, User{Login: reactor}, repositories)
+		if err != nil {
+			message := fmt.Sprintf("Failed to check if %s can confirm merging PR %s", reactor, issue.FullName())
+			return "", &ErrorResponse{err, http.StatusBadGateway, message}
+		} else if isCollab {
+			return reactor, nil
+		}
+	}
+	return "", nil
+}
+
+// confirmTwoPersonMerge records the commenter's confirmation of merging the
+// PR's current head and merges the PR, if it's ready. The maintainer who asked
+// for the merge can't confirm it themselves.
+func confirmTwoPersonMerge(conf Config, issueComment IssueComment, pending PendingConfirmation, store Store,
+	issues Issues, pullRequests PullRequests, repositories Repositories, graphQL GraphQL,
+	gitRepos git.Repos) Response {
+
+	issue := issueComment.Issue()
+	confirmer := issueComment.Commenter.Login
+	if confirmer == pending.RequestedBy {
+		message := fmt.Sprintf("@%s, you asked for this merge, so another maintainer has to confirm it.",
+			confirmer)
+		if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+			errorMessage := fmt.Sprintf("Failed to refuse the self-confirmation on PR %s", issue.FullName())
+			return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+		}
+		return SuccessResponse{fmt.Sprintf("Not letting %s confirm their own merge of PR %s", confirmer,
+			issue.FullName())}
+	}
+	pr, errResp := getPR(issue, pullRequests)
+	if errResp != nil {
+		return errResp
+	}
+	pending.ConfirmedBy = confirmer
+	pending.HeadSHA = *pr.Head.SHA
+	if err := store.SetPendingConfirmation(pending); err != nil {
+		message := fmt.Sprintf("Failed to store the confirmation of PR %s", issue.FullName())
+		return ErrorResponse{err, http.StatusInternalServerError, message}
+	}
+	log.Printf("%s confirmed merging PR %s.\n", confirmer, issue.FullName())
+	if !issueComment.HasLabel(MergingLabel) {
+		return SuccessResponse{fmt.Sprintf("PR %s is no longer labeled with '%s'. Ignoring.", issue.FullName(),
+			MergingLabel)}
+	}
+	return mergeIfReady(conf, issue, true, store, issues, pullRequests, repositories, graphQL, gitRepos)
+}
@@ -0,0 +1,361 @@
+package main_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	Describe("two-person merges", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			store            grh.Store
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+			gitRepos         *mocks.Repos
+			graphQL          *mocks.GraphQL
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			store = *context.Store
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+			gitRepos = *context.GitRepos
+			graphQL = *context.GraphQL
+
+			context.Config.TwoPersonMergeBranches = []string{"master"}
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+
+		headSHA := "1235"
+		confirmationCommentID := 42
+		storeRepository := grh.Repository{Owner: repositoryOwner, Name: repositoryName}
+		pr := &github.PullRequest{
+			Number:    github.Int(issueNumber),
+			Merged:    github.Bool(false),
+			Mergeable: github.Bool(true),
+			Base: &github.PullRequestBranch{
+				SHA:  github.String("1234"),
+				Ref:  github.String("master"),
+				Repo: repository,
+			},
+			Head: &github.PullRequestBranch{
+				SHA:  github.String(headSHA),
+				Ref:  github.String("feature"),
+				Repo: repository,
+			},
+			User: &github.User{
+				Login: github.String(arbitraryIssueAuthor),
+			},
+		}
+
+		BeforeEach(func() {
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+		})
+
+		mockReadyPR := func() {
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+				Return(pr, emptyResponse, noError)
+			repositories.
+				On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.AnythingOfType("*github.ListOptions")).
+				Return(&github.CombinedStatus{
+					State: github.String("success"),
+				}, emptyResponse, noError)
+			mockLabels(issues, issueNumber, grh.MergingLabel)
+		}
+
+		mockMerge := func() {
+			pullRequests.
+				On("Merge", anyContext, repositoryOwner, repositoryName, issueNumber, "", noSquashOpts).
+				Return(&github.PullRequestMergeResult{Merged: github.Bool(true)}, emptyResponse, noError)
+			issues.
+				On("RemoveLabelForIssue", anyContext, repositoryOwner, repositoryName, issueNumber, grh.MergingLabel).
+				Return(emptyResponse, noError)
+			gitRepo := new(mocks.Repo)
+			gitRepos.
+				On("GetUpdatedRepo", sshURL, repositoryOwner, repositoryName).
+				Return(gitRepo, noError)
+			gitRepo.On("DeleteRemoteBranch", "feature").Return(noError)
+		}
+
+		// mockThumbsUps mocks the :+1: reactions to the bot's comment asking
+		// for the confirmation
+		mockThumbsUps := func(logins ...string) {
+			reactions := make([]map[string]interface{}, len(logins))
+			for i, login := range logins {
+				reactions[i] = map[string]interface{}{"user": map[string]string{"login": login}}
+			}
+			result, err := json.Marshal(map[string]interface{}{
+				"repository": map[string]interface{}{
+					"pullRequest": map[string]interface{}{
+						"comments": map[string]interface{}{
+							"nodes": []interface{}{
+								map[string]interface{}{
+									"databaseId": confirmationCommentID,
+									"reactions":  map[string]interface{}{"nodes": reactions},
+								},
+							},
+						},
+					},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			graphQL.
+				On("Query", anyContext, mock.AnythingOfType("string"), mock.Anything, mock.Anything).
+				Return(noError).
+				Run(func(args mock.Arguments) {
+					Expect(json.Unmarshal(result, args.Get(3))).To(Succeed())
+				})
+		}
+
+		setPendingConfirmation := func(requestedBy string) {
+			err := store.SetPendingConfirmation(grh.PendingConfirmation{
+				Repository:  storeRepository,
+				PullRequest: issueNumber,
+				Action:      "two-person merge",
+				RequestedBy: requestedBy,
+				CommentID:   confirmationCommentID,
+				CreatedAt:   time.Now(),
+				HeadSHA:     headSHA,
+			})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		Context("with a !merge command", func() {
+			requestJSON.Is(func() string {
+				return IssueCommentEvent("!merge", arbitraryIssueAuthor)
+			})
+
+			BeforeEach(func() {
+				issues.
+					On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{grh.MergingLabel}).
+					Return(emptyResult, emptyResponse, noError)
+				mockReadyPR()
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("@"+arbitraryIssueAuthor+" asked me to merge this PR into "+
+							"`master`, which needs a second maintainer's confirmation"))).
+					Return(&github.IssueComment{ID: github.Int(confirmationCommentID)}, emptyResponse, noError).
+					Once()
+				mockThumbsUps()
+			})
+
+			It("asks for a second maintainer's confirmation instead of merging the PR", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(responseRecorder.Body.String()).To(ContainSubstring("Waiting for a second maintainer"))
+				pullRequests.AssertNotCalled(GinkgoT(), "Merge", anyContext, repositoryOwner, repositoryName,
+					issueNumber, "", noSquashOpts)
+
+				confirmation, exists, err := store.PendingConfirmation(storeRepository, issueNumber)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(exists).To(BeTrue())
+				Expect(confirmation.Action).To(Equal("two-person merge"))
+				Expect(confirmation.RequestedBy).To(Equal(arbitraryIssueAuthor))
+				Expect(confirmation.CommentID).To(Equal(confirmationCommentID))
+				Expect(confirmation.HeadSHA).To(Equal(headSHA))
+			})
+		})
+
+		Context("with a !merge command after the confirmation was asked for without a requester", func() {
+			requestJSON.Is(func() string {
+				return IssueCommentEvent("!merge", arbitraryIssueAuthor)
+			})
+
+			BeforeEach(func() {
+				issues.
+					On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{grh.MergingLabel}).
+					Return(emptyResult, emptyResponse, noError)
+				mockReadyPR()
+				mockThumbsUps()
+				setPendingConfirmation("")
+			})
+
+			It("records the commenter as the requester, so that they couldn't confirm the merge", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+
+				confirmation, _, err := store.PendingConfirmation(storeRepository, issueNumber)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(confirmation.RequestedBy).To(Equal(arbitraryIssueAuthor))
+				Expect(confirmation.CommentID).To(Equal(confirmationCommentID))
+			})
+		})
+
+		Context("with a merge confirmed before new commits were pushed", func() {
+			requestJSON.Is(func() string {
+				return IssueCommentEventWithLabels("!merge", arbitraryIssueAuthor, []string{grh.MergingLabel})
+			})
+
+			BeforeEach(func() {
+				issues.
+					On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{grh.MergingLabel}).
+					Return(emptyResult, emptyResponse, noError)
+				mockReadyPR()
+				Expect(store.SetPendingConfirmation(grh.PendingConfirmation{
+					Repository:  storeRepository,
+					PullRequest: issueNumber,
+					Action:      "two-person merge",
+					RequestedBy: "requester",
+					CommentID:   confirmationCommentID,
+					ConfirmedBy: "second-maintainer",
+					CreatedAt:   time.Now(),
+					HeadSHA:     "1111",
+				})).To(Succeed())
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("@"+arbitraryIssueAuthor+" asked me to merge this PR into "+
+							"`master`, which needs a second maintainer's confirmation"))).
+					Return(&github.IssueComment{ID: github.Int(confirmationCommentID + 1)}, emptyResponse, noError).
+					Once()
+				mockThumbsUps()
+			})
+
+			It("asks for the confirmation again instead of merging the PR", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(responseRecorder.Body.String()).To(ContainSubstring("Waiting for a second maintainer"))
+				pullRequests.AssertNotCalled(GinkgoT(), "Merge", anyContext, repositoryOwner, repositoryName,
+					issueNumber, "", noSquashOpts)
+
+				confirmation, _, err := store.PendingConfirmation(storeRepository, issueNumber)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(confirmation.ConfirmedBy).To(BeEmpty())
+				Expect(confirmation.HeadSHA).To(Equal(headSHA))
+				Expect(confirmation.CommentID).To(Equal(confirmationCommentID + 1))
+			})
+		})
+
+		Context("with a merge waiting for a second maintainer", func() {
+			requestJSON.Is(func() string {
+				return IssueCommentEventWithLabels("!merge", arbitraryIssueAuthor, []string{grh.MergingLabel})
+			})
+
+			BeforeEach(func() {
+				issues.
+					On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{grh.MergingLabel}).
+					Return(emptyResult, emptyResponse, noError)
+				mockReadyPR()
+				setPendingConfirmation(arbitraryIssueAuthor)
+			})
+
+			Context("with a collaborator's :+1: reaction", func() {
+				BeforeEach(func() {
+					mockThumbsUps(arbitraryIssueAuthor, "second-maintainer")
+					repositories.
+						On("IsCollaborator", anyContext, repositoryOwner, repositoryName, "second-maintainer").
+						Return(true, emptyResponse, noError)
+					mockMerge()
+				})
+
+				It("merges the PR", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					pullRequests.AssertExpectations(GinkgoT())
+
+					confirmation, _, err := store.PendingConfirmation(storeRepository, issueNumber)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(confirmation.ConfirmedBy).To(Equal("second-maintainer"))
+				})
+			})
+
+			Context("with only the requester's :+1: reaction", func() {
+				BeforeEach(func() {
+					mockThumbsUps(arbitraryIssueAuthor)
+				})
+
+				It("doesn't merge the PR", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					Expect(responseRecorder.Body.String()).To(ContainSubstring("Waiting for a second maintainer"))
+					pullRequests.AssertNotCalled(GinkgoT(), "Merge", anyContext, repositoryOwner, repositoryName,
+						issueNumber, "", noSquashOpts)
+				})
+			})
+
+			Context("with an outsider's :+1: reaction", func() {
+				BeforeEach(func() {
+					mockThumbsUps("outsider")
+					repositories.
+						On("IsCollaborator", anyContext, repositoryOwner, repositoryName, "outsider").
+						Return(false, emptyResponse, noError)
+				})
+
+				It("doesn't merge the PR", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					Expect(responseRecorder.Body.String()).To(ContainSubstring("Waiting for a second maintainer"))
+				})
+			})
+		})
+
+		Context("with a !confirm command", func() {
+			requestJSON.Is(func() string {
+				return IssueCommentEventWithLabels("!confirm", arbitraryIssueAuthor, []string{grh.MergingLabel})
+			})
+
+			Context("from another maintainer", func() {
+				BeforeEach(func() {
+					setPendingConfirmation("requester")
+					mockReadyPR()
+					mockMerge()
+				})
+
+				It("merges the PR", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+					pullRequests.AssertExpectations(GinkgoT())
+
+					confirmation, _, err := store.PendingConfirmation(storeRepository, issueNumber)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(confirmation.ConfirmedBy).To(Equal(arbitraryIssueAuthor))
+					Expect(confirmation.HeadSHA).To(Equal(headSHA))
+				})
+			})
+
+			Context("from the maintainer who asked for the merge", func() {
+				BeforeEach(func() {
+					setPendingConfirmation(arbitraryIssueAuthor)
+					issues.
+						On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+							mock.MatchedBy(commentContaining("you asked for this merge, so another maintainer has "+
+								"to confirm it"))).
+						Return(emptyResult, emptyResponse, noError)
+				})
+
+				It("refuses the confirmation", func() {
+					handle()
+					Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+
+					confirmation, _, err := store.PendingConfirmation(storeRepository, issueNumber)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(confirmation.ConfirmedBy).To(BeEmpty())
+				})
+			})
+		})
+	})
+})
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/salemove/github-review-helper/git"
+)
+
+const validationBranchKind = "validation"
+
+// startValidation rebases the PR onto the latest base in a validation branch,
+// so that CI would test exactly what's going to land on the base branch. The
+// base branch is fast-forwarded to the rebased commit once its statuses have
+// succeeded. With MERGE_TRAIN, the caller has to hold the lock of the base
+// branch's merge train.
+func startValidation(conf Config, pr *github.PullRequest, gitRepos git.Repos, store Store, issues Issues,
+	pullRequests PullRequests, repositories Repositories) *ErrorResponse {
+
+	issue := prIssue(pr)
+	if isAcrossForks(pr) && (pr.MaintainerCanModify == nil || !*pr.MaintainerCanModify) {
+		return handleUnverifiableFork(issue, issues)
+	}
+	validations, err := store.Validations(issue.Repository)
+	if err != nil {
+		message := fmt.Sprintf("Failed to list the validations of PR %s", issue.FullName())
+		return &ErrorResponse{err, http.StatusInternalServerError, message}
+	}
+	for _, validation := range validations {
+		if validation.PullRequest == issue.Number && validation.HeadSHA == *pr.Head.SHA {
+			log.Printf("PR %s is already being validated in %s. Waiting for its statuses.\n", issue.FullName(),
+				validation.Branch)
+			return nil
+		}
+	}
+	requiredContexts, errResp := getRequiredStatusContexts(pr, repositories)
+	if errResp != nil {
+		return errResp
+	}
+
+	gitRepo, err := gitRepos.GetUpdatedRepo(issue.Repository.URL, issue.Repository.Owner, issue.Repository.Name)
+	if git.IsDiskFull(err) {
+		return reportDiskFull(conf, pr, err, store, issues)
+	} else if err != nil {
+		message := fmt.Sprintf("Failed to get an updated repo for PR %s", issue.FullName())
+		return &ErrorResponse{err, gitErrorCode(err), message}
+	}
+	if _, err = fetchHeadRemote(pr, gitRepo); err != nil {
+		message := fmt.Sprintf("Failed to fetch the fork of PR %s", issue.FullName())
+		return &ErrorResponse{err, gitErrorCode(err), message}
+	}
+	branch, err := createBotBranchName(conf, store, issue.Repository, validationBranchKind, issue.Number,
+		*pr.Base.Ref)
+	if err == nil {
+		// The branch is no longer needed once the PR is closed
+		err = trackBotBranchPR(store, issue.Repository, branch, issue.Number)
+	}
+	if err != nil {
+		message := fmt.Sprintf("Failed to create a validation branch for PR %s", issue.FullName())
+		return &ErrorResponse{err, http.StatusInternalServerError, message}
+	}
+	upstream, parent := "origin/"+*pr.Base.Ref, 0
+	if conf.MergeTrain {
+		upstream, parent, errResp = joinMergeTrain(conf, pr, gitRepos, store, issues, pullRequests, repositories)
+		if errResp != nil {
+			return errResp
+		}
+	}
+	sha, err := gitRepo.RebaseAndPush(upstream, *pr.Head.SHA, "origin", branch)
+	if _, ok := err.(*git.ErrRebaseConflict); ok && parent != 0 {
+		return handleTrainConflict(conf, issue, *pr.Base.Ref, issues)
+	} else if ok {
+		return resolveMergeConflict(conf, pr, gitRepos, store, issues, pullRequests)
+	} else if err != nil {
+		message := fmt.Sprintf("Failed to push the validation branch of PR %s", issue.FullName())
+		return &ErrorResponse{err, gitErrorCode(err), message}
+	}
+
+	err = store.AddValidation(Validation{
+		Repository:       issue.Repository,
+		PullRequest:      issue.Number,
+		Branch:           branch,
+		HeadSHA:          *pr.Head.SHA,
+		SHA:              sha,
+		BaseRef:          *pr.Base.Ref,
+		Parent:           parent,
+		RequiredContexts: requiredContexts,
+		StartedAt:        time.Now(),
+	})
+	if err != nil {
+		message := fmt.Sprintf("Failed to track the validation of PR %s", issue.FullName())
+		return &ErrorResponse{err, http.StatusInternalServerError, message}
+	}
+	if parent != 0 {
+		log.Printf("Validating PR %s rebased onto PR #%d on the merge train of %s as %s in %s.\n", issue.FullName(),
+			parent, *pr.Base.Ref, sha, branch)
+		return nil
+	}
+	log.Printf("Validating PR %s rebased onto %s as %s in %s.\n", issue.FullName(), *pr.Base.Ref, sha, branch)
+	return nil
+}
+
+func handleUnverifiableFork(issue Issue, issues Issues) *ErrorResponse {
+	log.Printf("Not merging PR %s, because its fork doesn't allow edits from maintainers. Removing the '%s' "+
+		"label and notifying the author.\n", issue.FullName(), MergingLabel)
+	if errResp := removeLabel(issue.Repository, issue.Number, MergingLabel, issues); errResp != nil {
+		return errResp
+	}
+	message := fmt.Sprintf("I'm unable to merge this PR, because I have to rebase it onto the latest base "+
+		"branch, but its fork doesn't allow edits from maintainers. @%s, can you please allow edits from "+
+		"maintainers?", issue.User.Login)
+	if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+		errorMessage := fmt.Sprintf("Failed to notify the author of PR %s about the disallowed edits",
+			issue.FullName())
+		return &ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	return nil
+}
+
+// findValidation returns the validation of the commit the status event is
+// for or nil, if the commit isn't being validated.
+func findValidation(statusEvent StatusEvent, store Store) (*Validation, *ErrorResponse) {
+	validations, err := store.Validations(statusEvent.Repository)
+	if err != nil {
+		message := fmt.Sprintf("Failed to list the validations of %s", repositoryKey(statusEvent.Repository))
+		return nil, &ErrorResponse{err, http.StatusInternalServerError, message}
+	}
+	for _, validation := range validations {
+		if validation.SHA == statusEvent.SHA {
+			return &validation, nil
+		}
+	}
+	return nil, nil
+}
+
+// validationState returns the state of the validation build. If the base
+// branch requires specific contexts, then only their statuses are considered.
+func validationState(validation Validation, repositories Repositories) (string, *ErrorResponse) {
+	state, statuses, errResp := getStatusesForRef(validation.Repository, validation.SHA, repositories)
+	if errResp != nil || len(validation.RequiredContexts) == 0 {
+		return state, errResp
+	}
+	states := make(map[string]string)
+	for _, status := range statuses {
+		states[*status.Context] = *status.State
+	}
+	state = "success"
+	for _, context := range validation.RequiredContexts {
+		switch states[context] {
+		case "failure", "error":
+			return "failure", nil
+		case "success":
+		default:
+			state = "pending"
+		}
+	}
+	return state, nil
+}
+
+// handleValidationStatus lands the validated PR once its validation build has
+// succeeded or gives up on merging it, if the build failed.
+func handleValidationStatus(conf Config, validation Validation, gitRepos git.Repos, store Store, issues Issues,
+	pullRequests PullRequests, repositories Repositories) Response {
+
+	issue := Issue{
+		Number:     validation.PullRequest,
+		Repository: validation.Repository,
+	}
+	state, errResp := validationState(validation, repositories)
+	if errResp != nil {
+		return errResp
+	} else if state == "pending" {
+		return SuccessResponse{fmt.Sprintf("The validation of PR %s is still pending", issue.FullName())}
+	}
+	if conf.MergeTrain {
+		unlock, errResp := lockMergeTrain(validation.Repository, validation.BaseRef)
+		if errResp != nil {
+			return errResp
+		}
+		defer unlock()
+		return handleTrainStatus(conf, validation, state, gitRepos, store, issues, pullRequests, repositories)
+	}
+	pr, errResp := getPR(issue, pullRequests)
+	if errResp != nil {
+		return errResp
+	}
+	issue = prIssue(pr)
+	if errResp = stopValidation(validation, gitRepos, store); errResp != nil {
+		return errResp
+	}
+	if hasChangedSinceValidation(pr, validation) {
+		return SuccessResponse{fmt.Sprintf("PR %s has changed since its validation started. Ignoring the "+
+			"validation.", issue.FullName())}
+	} else if state != "success" {
+		return handleValidationFailure(conf, issue, validation, issues)
+	}
+	return landValidatedPR(conf, pr, validation, gitRepos, store, issues, pullRequests, repositories)
+}
+
+// stopValidation stops tracking the validation and deletes its branch.
+func stopValidation(validation Validation, gitRepos git.Repos, store Store) *ErrorResponse {
+	repository := validation.Repository
+	if err := store.RemoveValidation(repository, validation.PullRequest); err != nil {
+		message := fmt.Sprintf("Failed to stop tracking the validation branch %s", validation.Branch)
+		return &ErrorResponse{err, http.StatusInternalServerError, message}
+	}
+	gitRepo, err := gitRepos.GetUpdatedRepo(repository.URL, repository.Owner, repository.Name)
+	if err != nil {
+		message := fmt.Sprintf("Failed to get an updated repo for validation branch %s", validation.Branch)
+		return &ErrorResponse{err, gitErrorCode(err), message}
+	}
+	if err = gitRepo.DeleteRemoteBranch(validation.Branch); err != nil {
+		log.Printf("Failed to delete validation branch %s: %v\n", validation.Branch, err)
+	} else if err = store.RemoveBotBranch(repository, validation.Branch); err != nil {
+		log.Printf("Failed to stop tracking validation branch %s: %v\n", validation.Branch, err)
+	}
+	return nil
+}
+
+func handleValidationFailure(conf Config, issue Issue, validation Validation, issues Issues) Response {
+	log.Printf("The validation of PR %s failed. Removing the '%s' label and notifying the author.\n",
+		issue.FullName(), MergingLabel)
+	if errResp := removeLabel(issue.Repository, issue.Number, MergingLabel, issues); errResp != nil {
+		return errResp
+	}
+	sendNotification(conf, NotificationEvent{
+		Type:    FailureEvent,
+		Issue:   issue,
+		Message: fmt.Sprintf("Not merged, because the build of it rebased onto the latest `%s` failed.", validation.BaseRef),
+	})
+	message := fmt.Sprintf("I didn't merge this PR, because the build of it rebased onto the latest `%s` "+
+		"failed. @%s, can you please take a look?", validation.BaseRef, issue.User.Login)
+	if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+		errorMessage := fmt.Sprintf("Failed to notify the author of PR %s about the failed validation",
+			issue.FullName())
+		return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	return SuccessResponse{fmt.Sprintf("The validation of PR %s failed", issue.FullName())}
+}
+
+// landValidatedPR pushes the validated commit to the PR's head branch and
+// fast-forwards the base branch to it, which GitHub considers as the PR
+// having been merged. If the base branch has moved on since the validation
+// started, then the PR is validated again. Other failures to push end the
+// attempt to merge the PR.
+func landValidatedPR(conf Config, pr *github.PullRequest, validation Validation, gitRepos git.Repos,
+	store Store, issues Issues, pullRequests PullRequests, repositories Repositories) Response {
+
+	issue := prIssue(pr)
+	unlock, errResp := lockPR(pr)
+	if errResp != nil {
+		return errResp
+	}
+	defer unlock()
+	if landed, errResp := fastForwardToValidation(pr, validation, gitRepos); errResp != nil &&
+		git.IsDiskFull(errResp.Error) {
+
+		return reportDiskFull(conf, pr, errResp.Error, store, issues)
+	} else if errResp != nil {
+		return handleLandingFailure(conf, issue, validation, errResp, issues)
+	} else if !landed {
+		log.Printf("Validating PR %s again.\n", issue.FullName())
+		pr.Head.SHA = github.String(validation.SHA)
+		errResp := startValidation(conf, pr, gitRepos, store, issues, pullRequests, repositories)
+		if errResp != nil {
+			return errResp
+		}
+		return SuccessResponse{fmt.Sprintf("%s has moved on. Validating PR %s again.", validation.BaseRef,
+			issue.FullName())}
+	}
+	return completeValidatedMerge(conf, pr, validation, gitRepos, store, issues, pullRequests, repositories)
+}
+
+// fastForwardToValidation fast-forwards the base branch to the validated
+// commit and then pushes it to the PR's head branch as well. It reports
+// false, if the base branch has moved on since the validation started. The
+// head branch is updated only once the base branch has the commit, so that a
+// PR that couldn't be merged is left as it was.
+func fastForwardToValidation(pr *github.PullRequest, validation Validation, gitRepos git.Repos) (bool,
+	*ErrorResponse) {
+
+	issue := prIssue(pr)
+	gitRepo, err := gitRepos.GetUpdatedRepo(issue.Repository.URL, issue.Repository.Owner, issue.Repository.Name)
+	if err != nil {
+		message := fmt.Sprintf("Failed to get an updated repo for PR %s", issue.FullName())
+		return false, &ErrorResponse{err, gitErrorCode(err), message}
+	}
+	headRemote, err := fetchHeadRemote(pr, gitRepo)
+	if err != nil {
+		message := fmt.Sprintf("Failed to fetch the fork of PR %s", issue.FullName())
+		return false, &ErrorResponse{err, gitErrorCode(err), message}
+	}
+	if err = gitRepo.Push(validation.SHA, "origin", validation.BaseRef); git.IsPushRejected(err) {
+		log.Printf("Failed to fast-forward %s to the validated commit of PR %s: %v\n", validation.BaseRef,
+			issue.FullName(), err)
+		return false, nil
+	} else if err != nil {
+		message := fmt.Sprintf("Failed to fast-forward %s to the validated commit of PR %s", validation.BaseRef,
+			issue.FullName())
+		return false, &ErrorResponse{err, gitErrorCode(err), message}
+	}
+	if err = gitRepo.ForcePush(validation.SHA, headRemote, *pr.Head.Ref); err != nil {
+		// The base branch already has the commit, so the PR has landed
+		// regardless
+		log.Printf("Failed to push the validated commit to the head of PR %s: %v\n", issue.FullName(), err)
+	}
+	return true, nil
+}
+
+// handleLandingFailure gives up on merging the PR, whose validated commit
+// couldn't be pushed for another reason than the base branch moving on, e.g.
+// because the branch is protected. Validating the PR again wouldn't help, so
+// the author is asked to take a look instead.
+func handleLandingFailure(conf Config, issue Issue, validation Validation, landingErr *ErrorResponse,
+	issues Issues) Response {
+
+	log.Printf("%s: %v. Removing the '%s' label and notifying the author.\n", landingErr.ErrorMessage,
+		landingErr.Error, MergingLabel)
+	if errResp := removeLabel(issue.Repository, issue.Number, MergingLabel, issues); errResp != nil {
+		return errResp
+	}
+	sendNotification(conf, NotificationEvent{
+		Type:    FailureEvent,
+		Issue:   issue,
+		Message: fmt.Sprintf("Not merged, because pushing it to `%s` failed.", validation.BaseRef),
+	})
+	message := fmt.Sprintf("I didn't merge this PR, because pushing it to `%s` failed. @%s, can you please take a "+
+		"look?", validation.BaseRef, issue.User.Login)
+	if err := comment(message, issue.Repository, issue.Number, issues); err != nil {
+		errorMessage := fmt.Sprintf("Failed to notify the author of PR %s about the failed push", issue.FullName())
+		return ErrorResponse{err, http.StatusBadGateway, errorMessage}
+	}
+	return landingErr
+}
+
+// completeValidatedMerge does what's left to do once the base branch has been
+// fast-forwarded to the validated commit of the PR.
+func completeValidatedMerge(conf Config, pr *github.PullRequest, validation Validation, gitRepos git.Repos,
+	store Store, issues Issues, pullRequests PullRequests, repositories Repositories) Response {
+
+	issue := prIssue(pr)
+	log.Printf("PR %s successfully merged into %s. Removing the '%s' label.\n", issue.FullName(),
+		validation.BaseRef, MergingLabel)
+	if errResp := removeLabel(issue.Repository, issue.Number, MergingLabel, issues); errResp != nil {
+		return errResp
+	}
+	// The validated commit was fast-forwarded to, so it's the merge commit
+	if err := writeMergeReceipt(conf, pr, validation.SHA, pullRequests, repositories); err != nil {
+		failedMergeReceipts.Add(1)
+		log.Println(err)
+	}
+	commentMergeOutcome(conf, pr, validation.SHA, "fast-forward", store, issues)
+	sendNotification(conf, NotificationEvent{
+		Type:    MergeEvent,
+		Issue:   issue,
+		Message: fmt.Sprintf("Merged into `%s`.", validation.BaseRef),
+	})
+	publishEvent(conf, BusEvent{
+		Type:        MergeCompletedEvent,
+		Repository:  repositoryKey(issue.Repository),
+		PullRequest: issue.Number,
+		SHA:         validation.SHA,
+	}, store)
+	notifyBaseBranchMerged(pr)
+	if err := addReleaseNote(conf, pr, issues, repositories); err != nil {
+		log.Printf("Failed to add PR %s to the release notes: %v\n", issue.FullName(), err)
+	}
+	if err := assignMilestone(conf, pr, issues); err != nil {
+		log.Printf("Failed to assign a milestone to PR %s: %v\n", issue.FullName(), err)
+	}
+	transitionJiraIssues(conf, pr)
+	if err := runPostMergeHooks(conf.PostMergeHooks, pr, gitRepos); err != nil {
+		message := fmt.Sprintf("PR %s was merged, but a post-merge hook failed", issue.FullName())
+		return ErrorResponse{err, http.StatusInternalServerError, message}
+	}
+	return SuccessResponse{fmt.Sprintf("Successfully merged PR %s", issue.FullName())}
+}
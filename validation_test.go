@@ -0,0 +1,287 @@
+package main_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/google/go-github/github"
+	grh "github.com/salemove/github-review-helper"
+	"github.com/salemove/github-review-helper/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = TestWebhookHandler(func(context WebhookTestContext) {
+	headSHA := "1235"
+	validationSHA := "2345"
+	validationBranch := fmt.Sprintf("bot/validation/%d-master", issueNumber)
+	pr := &github.PullRequest{
+		Number:    github.Int(issueNumber),
+		Merged:    github.Bool(false),
+		Mergeable: github.Bool(true),
+		Base: &github.PullRequestBranch{
+			SHA:  github.String("1234"),
+			Ref:  github.String("master"),
+			Repo: repository,
+		},
+		Head: &github.PullRequestBranch{
+			SHA:  github.String(headSHA),
+			Ref:  github.String("feature"),
+			Repo: repository,
+		},
+		User: &github.User{
+			Login: github.String(arbitraryIssueAuthor),
+		},
+	}
+
+	Describe("!merge comment with the verified-rebase strategy", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			store            grh.Store
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+			gitRepos         *mocks.Repos
+			gitRepo          *mocks.Repo
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			store = *context.Store
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+			gitRepos = *context.GitRepos
+			gitRepo = new(mocks.Repo)
+
+			context.Config.MergeStrategy = grh.MergeStrategyVerifiedRebase
+			context.Config.BotBranchTemplate = "bot/{kind}/{pr}-{target}"
+		})
+		AfterEach(func() {
+			gitRepo.AssertExpectations(GinkgoT())
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "issue_comment",
+			}
+		})
+		requestJSON.Is(func() string {
+			return IssueCommentEvent("!merge", arbitraryIssueAuthor)
+		})
+
+		BeforeEach(func() {
+			repositories.
+				On("IsCollaborator", anyContext, repositoryOwner, repositoryName, arbitraryIssueAuthor).
+				Return(true, emptyResponse, noError)
+			issues.
+				On("AddLabelsToIssue", anyContext, repositoryOwner, repositoryName, issueNumber, []string{grh.MergingLabel}).
+				Return(emptyResult, emptyResponse, noError)
+			pullRequests.
+				On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+				Return(pr, emptyResponse, noError)
+			repositories.
+				On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, headSHA, mock.AnythingOfType("*github.ListOptions")).
+				Return(&github.CombinedStatus{
+					State: github.String("success"),
+				}, emptyResponse, noError)
+			repositories.
+				On("GetRequiredStatusChecks", anyContext, repositoryOwner, repositoryName, "master").
+				Return(&github.RequiredStatusChecks{
+					Contexts: []string{"ci/required"},
+				}, emptyResponse, noError)
+			mockLabels(issues, issueNumber, grh.MergingLabel)
+			gitRepos.
+				On("GetUpdatedRepo", sshURL, repositoryOwner, repositoryName).
+				Return(gitRepo, noError)
+		})
+
+		Context("with the PR rebasing cleanly", func() {
+			BeforeEach(func() {
+				gitRepo.
+					On("RebaseAndPush", "origin/master", headSHA, "origin", validationBranch).
+					Return(validationSHA, noError)
+			})
+
+			It("starts validating the rebased PR", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(responseRecorder.Body.String()).To(ContainSubstring("Validating PR"))
+
+				validations, err := store.Validations(trackedRepository)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(validations).To(HaveLen(1))
+				Expect(validations[0].Branch).To(Equal(validationBranch))
+				Expect(validations[0].SHA).To(Equal(validationSHA))
+				Expect(validations[0].RequiredContexts).To(Equal([]string{"ci/required"}))
+
+				branches, err := store.BotBranches(trackedRepository)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(branches).To(HaveLen(1))
+				Expect(branches[0].PullRequest).To(Equal(issueNumber))
+			})
+		})
+	})
+
+	Describe("status event for a validation commit", func() {
+		var (
+			handle      = context.Handle
+			headers     = context.Headers
+			requestJSON = context.RequestJSON
+
+			responseRecorder *httptest.ResponseRecorder
+			store            grh.Store
+			pullRequests     *mocks.PullRequests
+			repositories     *mocks.Repositories
+			issues           *mocks.Issues
+			gitRepos         *mocks.Repos
+			gitRepo          *mocks.Repo
+		)
+		BeforeEach(func() {
+			responseRecorder = *context.ResponseRecorder
+			store = *context.Store
+			pullRequests = *context.PullRequests
+			repositories = *context.Repositories
+			issues = *context.Issues
+			gitRepos = *context.GitRepos
+			gitRepo = new(mocks.Repo)
+
+			Expect(store.AddValidation(grh.Validation{
+				Repository:       trackedRepository,
+				PullRequest:      issueNumber,
+				Branch:           validationBranch,
+				HeadSHA:          headSHA,
+				SHA:              validationSHA,
+				BaseRef:          "master",
+				RequiredContexts: []string{"ci/required"},
+				StartedAt:        time.Now(),
+			})).To(Succeed())
+		})
+		AfterEach(func() {
+			gitRepo.AssertExpectations(GinkgoT())
+		})
+
+		headers.Is(func() map[string]string {
+			return map[string]string{
+				"X-Github-Event": "status",
+			}
+		})
+		requestJSON.Is(func() string {
+			return createStatusEvent(validationSHA, "success", []grh.Branch{{SHA: validationSHA}})
+		})
+
+		mockValidationStatus := func(state string) {
+			BeforeEach(func() {
+				repositories.
+					On("GetCombinedStatus", anyContext, repositoryOwner, repositoryName, validationSHA, mock.AnythingOfType("*github.ListOptions")).
+					Return(&github.CombinedStatus{
+						State: github.String("failure"),
+						Statuses: []github.RepoStatus{
+							{Context: github.String("ci/required"), State: github.String(state)},
+							{Context: github.String("ci/optional"), State: github.String("failure")},
+						},
+					}, emptyResponse, noError)
+			})
+		}
+
+		mockStoppedValidation := func() {
+			BeforeEach(func() {
+				pullRequests.
+					On("Get", anyContext, repositoryOwner, repositoryName, issueNumber).
+					Return(pr, emptyResponse, noError)
+				gitRepos.
+					On("GetUpdatedRepo", sshURL, repositoryOwner, repositoryName).
+					Return(gitRepo, noError)
+				gitRepo.
+					On("DeleteRemoteBranch", validationBranch).
+					Return(noError)
+				issues.
+					On("RemoveLabelForIssue", anyContext, repositoryOwner, repositoryName, issueNumber, grh.MergingLabel).
+					Return(emptyResponse, noError)
+			})
+		}
+
+		Context("with the required statuses still pending", func() {
+			mockValidationStatus("pending")
+
+			It("keeps waiting for the statuses", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(store.Validations(trackedRepository)).To(HaveLen(1))
+			})
+		})
+
+		Context("with a required status having failed", func() {
+			mockValidationStatus("failure")
+			mockStoppedValidation()
+
+			BeforeEach(func() {
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("rebased onto the latest `master` failed"))).
+					Return(emptyResult, emptyResponse, noError)
+			})
+
+			It("gives up on merging the PR", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(store.Validations(trackedRepository)).To(BeEmpty())
+			})
+		})
+
+		Context("with the required statuses having succeeded", func() {
+			mockValidationStatus("success")
+			mockStoppedValidation()
+
+			BeforeEach(func() {
+				gitRepo.
+					On("ForcePush", validationSHA, "origin", "feature").
+					Return(noError)
+				gitRepo.
+					On("Push", validationSHA, "origin", "master").
+					Return(noError)
+			})
+
+			It("fast-forwards the base branch to the validated commit", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusOK))
+				Expect(responseRecorder.Body.String()).To(ContainSubstring("Successfully merged"))
+				Expect(store.Validations(trackedRepository)).To(BeEmpty())
+			})
+		})
+
+		Context("with pushing the validated commit being refused", func() {
+			mockValidationStatus("success")
+			mockStoppedValidation()
+
+			BeforeEach(func() {
+				gitRepo.
+					On("Push", validationSHA, "origin", "master").
+					Return(errArbitrary)
+				issues.
+					On("CreateComment", anyContext, repositoryOwner, repositoryName, issueNumber,
+						mock.MatchedBy(commentContaining("because pushing it to `master` failed"))).
+					Return(emptyResult, emptyResponse, noError)
+			})
+
+			It("gives up on merging the PR instead of validating it again", func() {
+				handle()
+				Expect(responseRecorder.Code).To(Equal(http.StatusInternalServerError))
+				Expect(store.Validations(trackedRepository)).To(BeEmpty())
+				issues.AssertExpectations(GinkgoT())
+			})
+
+			It("leaves the head of the PR as it was", func() {
+				handle()
+				gitRepo.AssertNotCalled(GinkgoT(), "ForcePush", validationSHA, "origin", "feature")
+			})
+		})
+	})
+})
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+)
+
+// webhookEvents are the events the bot handles. GitHub sends a ping when the
+// webhook is created.
+var webhookEvents = map[string]bool{
+	"ping":                        true,
+	"issue_comment":               true,
+	"pull_request":                true,
+	"pull_request_review":         true,
+	"pull_request_review_comment": true,
+	"status":                      true,
+	"commit_comment":              true,
+	"check_suite":                 true,
+	"deployment_status":           true,
+	"push":                        true,
+	"branch_protection_rule":      true,
+}
+
+// checkWebhookRequest refuses requests the bot couldn't handle anyway based
+// on their headers alone, before their body is read.
+func checkWebhookRequest(r *http.Request) *ErrorResponse {
+	event := r.Header.Get("X-Github-Event")
+	if !webhookEvents[event] {
+		message := fmt.Sprintf("Unexpected event \"%s\". Configure the webhook to only send the events I handle.",
+			event)
+		return &ErrorResponse{nil, http.StatusBadRequest, message}
+	}
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return &ErrorResponse{err, http.StatusUnsupportedMediaType,
+			"Unsupported content type. Configure the webhook to send application/json."}
+	}
+	return nil
+}
+
+// readWebhookBody reads the request's body, refusing bodies larger than
+// WEBHOOK_MAX_BODY_SIZE and ones that aren't valid JSON. The size limit is
+// also what bounds the time it takes to check the JSON.
+func readWebhookBody(conf Config, r *http.Request) ([]byte, *ErrorResponse) {
+	maxSize := int64(conf.WebhookMaxBodySize)
+	if maxSize > 0 && r.ContentLength > maxSize {
+		return nil, bodyTooLarge(maxSize)
+	}
+	var reader io.Reader = r.Body
+	if maxSize > 0 {
+		// Reading one more byte than allowed tells whether the body was
+		// larger, even if the sender lied about its length
+		reader = io.LimitReader(r.Body, maxSize+1)
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, &ErrorResponse{err, http.StatusInternalServerError, "Failed to read the request's body"}
+	} else if maxSize > 0 && int64(len(body)) > maxSize {
+		return nil, bodyTooLarge(maxSize)
+	}
+	if !json.Valid(body) {
+		return nil, &ErrorResponse{errors.New("the body is not valid JSON"), http.StatusBadRequest,
+			"Failed to decode the request's body"}
+	}
+	return body, nil
+}
+
+func bodyTooLarge(maxSize int64) *ErrorResponse {
+	return &ErrorResponse{nil, http.StatusRequestEntityTooLarge,
+		fmt.Sprintf("The request's body is larger than %d bytes", maxSize)}
+}